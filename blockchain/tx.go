@@ -3,7 +3,7 @@ package blockchain
 import (
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/core"
-	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/types"
 	"github.com/thetatoken/theta/store"
 )
 
@@ -27,7 +27,7 @@ func (ch *Chain) AddTxsToIndex(block *core.ExtendedBlock, force bool) {
 			BlockHeight: block.Height,
 			Index:       uint64(idx),
 		}
-		txHash := crypto.Keccak256Hash(tx)
+		txHash := types.RawTxHash(tx)
 		key := txIndexKey(txHash)
 
 		if !force {
@@ -33,10 +33,6 @@ func doDepositStakeCmd(cmd *cobra.Command, args []string) {
 	}
 	defer wallet.Lock(sourceAddress)
 
-	fee, ok := types.ParseCoinAmount(feeFlag)
-	if !ok {
-		utils.Error("Failed to parse fee")
-	}
 	stake, ok := types.ParseCoinAmount(stakeInThetaFlag)
 	if !ok {
 		utils.Error("Failed to parse stake")
@@ -57,16 +53,24 @@ func doDepositStakeCmd(cmd *cobra.Command, args []string) {
 		Address: common.HexToAddress(holderFlag),
 	}
 
+	purpose, err := core.ParseStakePurpose(purposeFlag)
+	if err != nil {
+		utils.Error("Failed to parse the purpose: %v\n", err)
+	}
+
 	depositStakeTx := &types.DepositStakeTx{
 		Fee: types.Coins{
 			ThetaWei: new(big.Int).SetUint64(0),
-			TFuelWei: fee,
+			TFuelWei: new(big.Int).SetUint64(0),
 		},
-		Source:  source,
-		Holder:  holder,
-		Purpose: purposeFlag,
+		Source:           source,
+		Holder:           holder,
+		Purpose:          purpose,
+		IdempotencyNonce: idempotencyNonceFlag,
 	}
 
+	depositStakeTx.Fee.TFuelWei = getFee(depositStakeTx)
+
 	sig, err := wallet.Sign(sourceAddress, depositStakeTx.SignBytes(chainIDFlag))
 	if err != nil {
 		utils.Error("Failed to sign transaction: %v\n", err)
@@ -96,10 +100,11 @@ func init() {
 	depositStakeCmd.Flags().StringVar(&sourceFlag, "source", "", "Source of the stake")
 	depositStakeCmd.Flags().StringVar(&holderFlag, "holder", "", "Holder of the stake")
 	depositStakeCmd.Flags().StringVar(&pathFlag, "path", "", "Wallet derivation path")
-	depositStakeCmd.Flags().StringVar(&feeFlag, "fee", fmt.Sprintf("%dwei", types.MinimumTransactionFeeTFuelWei), "Fee")
+	depositStakeCmd.Flags().StringVar(&feeFlag, "fee", "", "Fee, the minimum fee estimated by the node if not specified")
 	depositStakeCmd.Flags().Uint64Var(&seqFlag, "seq", 0, "Sequence number of the transaction")
 	depositStakeCmd.Flags().StringVar(&stakeInThetaFlag, "stake", "5000000", "Theta amount to stake")
-	depositStakeCmd.Flags().Uint8Var(&purposeFlag, "purpose", 0, "Purpose of staking")
+	depositStakeCmd.Flags().StringVar(&purposeFlag, "purpose", "validator", "Purpose of staking, by name (validator|guardian) or value")
+	depositStakeCmd.Flags().Uint64Var(&idempotencyNonceFlag, "idempotency_nonce", 0, "Nonce to reuse when retrying the deposit, so that it is not made twice, 0 for none")
 	depositStakeCmd.Flags().StringVar(&walletFlag, "wallet", "soft", "Wallet type (soft|nano)")
 
 	depositStakeCmd.MarkFlagRequired("chain")
@@ -29,10 +29,13 @@ var (
 	dataFlag                     string
 	walletFlag                   string
 	stakeInThetaFlag             string
-	purposeFlag                  uint8
+	purposeFlag                  string
 	sourceFlag                   string
 	holderFlag                   string
+	returnAddressFlag            string
+	idempotencyNonceFlag         uint64
 	asyncFlag                    bool
+	validUntilFlag               uint64
 )
 
 // TxCmd represents the Tx command
@@ -36,19 +36,17 @@ func doReleaseFundCmd(cmd *cobra.Command, args []string) {
 		Sequence: uint64(seqFlag),
 	}
 
-	tfuel, ok := types.ParseCoinAmount(feeFlag)
-	if !ok {
-		utils.Error("Failed to parse tfuel amount")
-	}
 	releaseFundTx := &types.ReleaseFundTx{
 		Fee: types.Coins{
 			ThetaWei: new(big.Int).SetUint64(0),
-			TFuelWei: tfuel,
+			TFuelWei: new(big.Int).SetUint64(0),
 		},
 		Source:          input,
 		ReserveSequence: reserveSeqFlag,
 	}
 
+	releaseFundTx.Fee.TFuelWei = getFee(releaseFundTx)
+
 	sig, err := wallet.Sign(fromAddress, releaseFundTx.SignBytes(chainIDFlag))
 	if err != nil {
 		utils.Error("Failed to sign transaction: %v\n", err)
@@ -77,7 +75,7 @@ func init() {
 	releaseFundCmd.Flags().StringVar(&chainIDFlag, "chain", "", "Chain ID")
 	releaseFundCmd.Flags().StringVar(&fromFlag, "from", "", "Reserve owner's address")
 	releaseFundCmd.Flags().Uint64Var(&seqFlag, "seq", 0, "Sequence number of the transaction")
-	releaseFundCmd.Flags().StringVar(&feeFlag, "fee", fmt.Sprintf("%dwei", types.MinimumTransactionFeeTFuelWei), "Fee")
+	releaseFundCmd.Flags().StringVar(&feeFlag, "fee", "", "Fee, the minimum fee estimated by the node if not specified")
 	releaseFundCmd.Flags().Uint64Var(&reserveSeqFlag, "reserve_seq", 1000, "Reserve sequence")
 	releaseFundCmd.Flags().StringVar(&walletFlag, "wallet", "soft", "Wallet type (soft|nano)")
 
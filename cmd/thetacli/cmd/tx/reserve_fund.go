@@ -31,10 +31,6 @@ func doReserveFundCmd(cmd *cobra.Command, args []string) {
 	}
 	defer wallet.Lock(fromAddress)
 
-	fee, ok := types.ParseCoinAmount(feeFlag)
-	if !ok {
-		utils.Error("Failed to parse fee")
-	}
 	fund, ok := types.ParseCoinAmount(reserveFundInTFuelFlag)
 	if !ok {
 		utils.Error("Failed to parse fund")
@@ -66,7 +62,7 @@ func doReserveFundCmd(cmd *cobra.Command, args []string) {
 	reserveFundTx := &types.ReserveFundTx{
 		Fee: types.Coins{
 			ThetaWei: new(big.Int).SetUint64(0),
-			TFuelWei: fee,
+			TFuelWei: new(big.Int).SetUint64(0),
 		},
 		Source:      input,
 		ResourceIDs: resourceIDs,
@@ -74,6 +70,8 @@ func doReserveFundCmd(cmd *cobra.Command, args []string) {
 		Duration:    durationFlag,
 	}
 
+	reserveFundTx.Fee.TFuelWei = getFee(reserveFundTx)
+
 	sig, err := wallet.Sign(fromAddress, reserveFundTx.SignBytes(chainIDFlag))
 	if err != nil {
 		utils.Error("Failed to sign transaction: %v\n", err)
@@ -104,7 +102,7 @@ func init() {
 	reserveFundCmd.Flags().Uint64Var(&seqFlag, "seq", 0, "Sequence number of the transaction")
 	reserveFundCmd.Flags().StringVar(&reserveFundInTFuelFlag, "fund", "0", "TFuel amount to reserve")
 	reserveFundCmd.Flags().StringVar(&reserveCollateralInTFuelFlag, "collateral", "0", "TFuel amount as collateral")
-	reserveFundCmd.Flags().StringVar(&feeFlag, "fee", fmt.Sprintf("%dwei", types.MinimumTransactionFeeTFuelWei), "Fee")
+	reserveFundCmd.Flags().StringVar(&feeFlag, "fee", "", "Fee, the minimum fee estimated by the node if not specified")
 	reserveFundCmd.Flags().Uint64Var(&durationFlag, "duration", 1000, "Reserve duration")
 	reserveFundCmd.Flags().StringSliceVar(&resourceIDsFlag, "resource_ids", []string{}, "Reserouce IDs")
 	reserveFundCmd.Flags().StringVar(&walletFlag, "wallet", "soft", "Wallet type (soft|nano)")
@@ -60,14 +60,10 @@ func doSendCmd(cmd *cobra.Command, args []string) {
 	if !ok {
 		utils.Error("Failed to parse tfuel amount")
 	}
-	fee, ok := types.ParseCoinAmount(feeFlag)
-	if !ok {
-		utils.Error("Failed to parse fee")
-	}
 	inputs := []types.TxInput{{
 		Address: fromAddress,
 		Coins: types.Coins{
-			TFuelWei: new(big.Int).Add(tfuel, fee),
+			TFuelWei: tfuel,
 			ThetaWei: theta,
 		},
 		Sequence: uint64(seqFlag),
@@ -82,12 +78,17 @@ func doSendCmd(cmd *cobra.Command, args []string) {
 	sendTx := &types.SendTx{
 		Fee: types.Coins{
 			ThetaWei: new(big.Int).SetUint64(0),
-			TFuelWei: fee,
+			TFuelWei: new(big.Int).SetUint64(0),
 		},
-		Inputs:  inputs,
-		Outputs: outputs,
+		Inputs:           inputs,
+		Outputs:          outputs,
+		ValidUntilHeight: validUntilFlag,
 	}
 
+	fee := getFee(sendTx)
+	sendTx.Fee.TFuelWei = fee
+	sendTx.Inputs[0].Coins.TFuelWei = new(big.Int).Add(tfuel, fee)
+
 	sig, err := wallet.Sign(fromAddress, sendTx.SignBytes(chainIDFlag))
 	if err != nil {
 		utils.Error("Failed to sign transaction: %v\n", err)
@@ -135,8 +136,9 @@ func init() {
 	sendCmd.Flags().Uint64Var(&seqFlag, "seq", 0, "Sequence number of the transaction")
 	sendCmd.Flags().StringVar(&thetaAmountFlag, "theta", "0", "Theta amount")
 	sendCmd.Flags().StringVar(&tfuelAmountFlag, "tfuel", "0", "TFuel amount")
-	sendCmd.Flags().StringVar(&feeFlag, "fee", fmt.Sprintf("%dwei", types.MinimumTransactionFeeTFuelWei), "Fee")
+	sendCmd.Flags().StringVar(&feeFlag, "fee", "", "Fee, the minimum fee estimated by the node if not specified")
 	sendCmd.Flags().StringVar(&walletFlag, "wallet", "soft", "Wallet type (soft|nano|trezor)")
+	sendCmd.Flags().Uint64Var(&validUntilFlag, "valid_until", 0, "The last block height the transaction can be included at, 0 means it never expires")
 	sendCmd.Flags().BoolVar(&asyncFlag, "async", false, "block until tx has been included in the blockchain")
 
 	sendCmd.MarkFlagRequired("chain")
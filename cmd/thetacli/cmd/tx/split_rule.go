@@ -65,15 +65,11 @@ func doSplitRuleCmd(cmd *cobra.Command, args []string) {
 		splits = append(splits, split)
 	}
 
-	fee, ok := types.ParseCoinAmount(feeFlag)
-	if !ok {
-		utils.Error("Failed to parse fee")
-	}
 
 	splitRuleTx := &types.SplitRuleTx{
 		Fee: types.Coins{
 			ThetaWei: new(big.Int).SetUint64(0),
-			TFuelWei: fee,
+			TFuelWei: new(big.Int).SetUint64(0),
 		},
 		ResourceID: resourceIDFlag,
 		Initiator:  input,
@@ -81,6 +77,8 @@ func doSplitRuleCmd(cmd *cobra.Command, args []string) {
 		Splits:     splits,
 	}
 
+	splitRuleTx.Fee.TFuelWei = getFee(splitRuleTx)
+
 	sig, err := wallet.Sign(fromAddress, splitRuleTx.SignBytes(chainIDFlag))
 	if err != nil {
 		utils.Error("Failed to sign transaction: %v\n", err)
@@ -109,7 +107,7 @@ func init() {
 	splitRuleCmd.Flags().StringVar(&chainIDFlag, "chain", "", "Chain ID")
 	splitRuleCmd.Flags().StringVar(&fromFlag, "from", "", "Initiator's address")
 	splitRuleCmd.Flags().Uint64Var(&seqFlag, "seq", 0, "Sequence number of the transaction")
-	splitRuleCmd.Flags().StringVar(&feeFlag, "fee", fmt.Sprintf("%dwei", types.MinimumTransactionFeeTFuelWei), "Fee")
+	splitRuleCmd.Flags().StringVar(&feeFlag, "fee", "", "Fee, the minimum fee estimated by the node if not specified")
 	splitRuleCmd.Flags().StringVar(&resourceIDFlag, "resource_id", "", "The resourceID of interest")
 	splitRuleCmd.Flags().StringSliceVar(&addressesFlag, "addresses", []string{}, "List of addresses participating in the split")
 	splitRuleCmd.Flags().StringSliceVar(&percentagesFlag, "percentages", []string{}, "List of integers (between 0 and 100) representing of percentage of split")
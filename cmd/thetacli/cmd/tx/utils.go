@@ -1,19 +1,25 @@
 package tx
 
 import (
+	"encoding/hex"
 	"fmt"
 	"math"
+	"math/big"
 	"strconv"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"github.com/thetatoken/theta/cmd/thetacli/cmd/utils"
 	"github.com/thetatoken/theta/common"
+	ltypes "github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/rpc"
 	"github.com/thetatoken/theta/wallet"
 	"github.com/thetatoken/theta/wallet/types"
 	wtypes "github.com/thetatoken/theta/wallet/types"
+	rpcc "github.com/ybbus/jsonrpc"
 )
 
 const HARDENED_FLAG = 1 << 31
@@ -95,6 +101,37 @@ func SoftWalletUnlock(cfgPath, addressStr string) (wtypes.Wallet, common.Address
 	return wallet, address, nil
 }
 
+// getFee returns the fee given by the fee flag, or if none is given, the minimum fee of the transaction as
+// estimated by the node. It is to be called on the transaction before it is signed.
+func getFee(tx ltypes.Tx) *big.Int {
+	if len(feeFlag) != 0 {
+		fee, ok := ltypes.ParseCoinAmount(feeFlag)
+		if !ok {
+			utils.Error("Failed to parse fee")
+		}
+		return fee
+	}
+
+	raw, err := ltypes.TxToBytes(tx)
+	if err != nil {
+		utils.Error("Failed to encode transaction: %v\n", err)
+	}
+	client := rpcc.NewRPCClient(viper.GetString(utils.CfgRemoteRPCEndpoint))
+	res, err := client.Call("theta.EstimateTxFee", rpc.EstimateTxFeeArgs{TxBytes: hex.EncodeToString(raw)})
+	if err != nil {
+		utils.Error("Failed to estimate the fee: %v\n", err)
+	}
+	if res.Error != nil {
+		utils.Error("Server returned error: %v\n", res.Error)
+	}
+	result := &rpc.EstimateTxFeeResult{}
+	err = res.GetObject(result)
+	if err != nil || result.MinimumFee == nil {
+		utils.Error("Failed to parse server response: %v\n", err)
+	}
+	return result.MinimumFee.ToInt()
+}
+
 func getWalletType(cmd *cobra.Command) (walletType wtypes.WalletType) {
 	walletTypeStr := cmd.Flag("wallet").Value.String()
 	if walletTypeStr == "nano" {
@@ -9,6 +9,7 @@ import (
 	"github.com/spf13/viper"
 	"github.com/thetatoken/theta/cmd/thetacli/cmd/utils"
 	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
 	"github.com/thetatoken/theta/ledger/types"
 	"github.com/thetatoken/theta/rpc"
 
@@ -32,10 +33,6 @@ func doWithdrawStakeCmd(cmd *cobra.Command, args []string) {
 	}
 	defer wallet.Lock(sourceAddress)
 
-	fee, ok := types.ParseCoinAmount(feeFlag)
-	if !ok {
-		utils.Error("Failed to parse fee")
-	}
 
 	source := types.TxInput{
 		Address:  sourceAddress,
@@ -45,16 +42,27 @@ func doWithdrawStakeCmd(cmd *cobra.Command, args []string) {
 		Address: common.HexToAddress(holderFlag),
 	}
 
+	purpose, err := core.ParseStakePurpose(purposeFlag)
+	if err != nil {
+		utils.Error("Failed to parse the purpose: %v\n", err)
+	}
+
 	withdrawStakeTx := &types.WithdrawStakeTx{
 		Fee: types.Coins{
 			ThetaWei: new(big.Int).SetUint64(0),
-			TFuelWei: fee,
+			TFuelWei: new(big.Int).SetUint64(0),
 		},
 		Source:  source,
 		Holder:  holder,
-		Purpose: purposeFlag,
+		Purpose: purpose,
+	}
+	if returnAddressFlag != "" {
+		returnAddress := common.HexToAddress(returnAddressFlag)
+		withdrawStakeTx.ReturnAddress = &returnAddress
 	}
 
+	withdrawStakeTx.Fee.TFuelWei = getFee(withdrawStakeTx)
+
 	sig, err := wallet.Sign(sourceAddress, withdrawStakeTx.SignBytes(chainIDFlag))
 	if err != nil {
 		utils.Error("Failed to sign transaction: %v\n", err)
@@ -84,9 +92,10 @@ func init() {
 	withdrawStakeCmd.Flags().StringVar(&sourceFlag, "source", "", "Source of the stake")
 	withdrawStakeCmd.Flags().StringVar(&holderFlag, "holder", "", "Holder of the stake")
 	withdrawStakeCmd.Flags().StringVar(&pathFlag, "path", "", "Wallet derivation path")
-	withdrawStakeCmd.Flags().StringVar(&feeFlag, "fee", fmt.Sprintf("%dwei", types.MinimumTransactionFeeTFuelWei), "Fee")
+	withdrawStakeCmd.Flags().StringVar(&feeFlag, "fee", "", "Fee, the minimum fee estimated by the node if not specified")
 	withdrawStakeCmd.Flags().Uint64Var(&seqFlag, "seq", 0, "Sequence number of the transaction")
-	withdrawStakeCmd.Flags().Uint8Var(&purposeFlag, "purpose", 0, "Purpose of staking")
+	withdrawStakeCmd.Flags().StringVar(&purposeFlag, "purpose", "validator", "Purpose of staking, by name (validator|guardian) or value")
+	withdrawStakeCmd.Flags().StringVar(&returnAddressFlag, "return_address", "", "Address the stake is returned to, the source if not specified")
 	withdrawStakeCmd.Flags().StringVar(&walletFlag, "wallet", "soft", "Wallet type (soft|nano)")
 
 	withdrawStakeCmd.MarkFlagRequired("chain")
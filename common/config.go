@@ -23,8 +23,36 @@ const (
 	CfgConsensusMaxEpochLength = "consensus.maxEpochLength"
 	// CfgConsensusMinProposalWait defines the minimal interval between proposals.
 	CfgConsensusMinProposalWait = "consensus.minProposalWait"
+	// CfgConsensusMaxProposalTxCollectionTime defines the maximum time (in seconds) spent on collecting txs for a proposal.
+	CfgConsensusMaxProposalTxCollectionTime = "consensus.maxProposalTxCollectionTime"
+	// CfgConsensusMinEmptyBlockInterval defines the minimal interval (in seconds) between two consecutive empty blocks, 0 means no limit.
+	CfgConsensusMinEmptyBlockInterval = "consensus.minEmptyBlockInterval"
 	// CfgConsensusMessageQueueSize defines the capacity of consensus message queue.
 	CfgConsensusMessageQueueSize = "consensus.messageQueueSize"
+	// CfgConsensusSafeModeReorgDepth defines the depth of the tip reorganization that puts the node into safe mode, 0 means never.
+	CfgConsensusSafeModeReorgDepth = "consensus.safeModeReorgDepth"
+
+	// CfgMempoolHeightDrivenExpirySweep indicates whether to sweep the expired txs from the mempool at each block proposal
+	// and application, instead of on the timer of CfgMempoolExpirySweepInterval
+	CfgMempoolHeightDrivenExpirySweep = "mempool.heightDrivenExpirySweep"
+	// CfgMempoolExpirySweepInterval defines the interval (in seconds) of the timer sweeping the expired txs from the mempool.
+	CfgMempoolExpirySweepInterval = "mempool.expirySweepInterval"
+
+	// CfgLedgerParallelTxExecution indicates whether to execute the independent txs of a block in parallel
+	CfgLedgerParallelTxExecution = "ledger.parallelTxExecution"
+	// CfgLedgerBalanceJournalEnabled indicates whether to record the balance changes of each applied block
+	CfgLedgerBalanceJournalEnabled = "ledger.balanceJournalEnabled"
+	// CfgLedgerStateAccessListsEnabled indicates whether to record the state keys read and written by each tx into its receipt
+	CfgLedgerStateAccessListsEnabled = "ledger.stateAccessListsEnabled"
+	// CfgLedgerMaxProposalTxExecutionTime defines the maximum time (in milliseconds) a smart contract tx can take to execute
+	// when proposing a block, the slower txs are left out of the block. 0 means no limit.
+	CfgLedgerMaxProposalTxExecutionTime = "ledger.maxProposalTxExecutionTime"
+	// CfgLedgerDeploymentScreeningGasCap defines the gas the init code of a contract deployment can use in the sandbox
+	// run of the screening, see vm.ScreenDeployment. The init code is not run if 0
+	CfgLedgerDeploymentScreeningGasCap = "ledger.deploymentScreeningGasCap"
+	// CfgLedgerCallCacheSize defines the number of simulated read-only contract calls cached for the latest committed
+	// state, see Ledger.SimulateTx. The calls are not cached if 0
+	CfgLedgerCallCacheSize = "ledger.callCacheSize"
 
 	// CfgStorageStatePruningEnabled indicates whether state pruning is enabled
 	CfgStorageStatePruningEnabled = "storage.statePruningEnabled"
@@ -32,6 +60,19 @@ const (
 	CfgStorageStatePruningInterval = "storage.statePruningInterval"
 	// CfgStorageStatePruningRetainedBlocks indicates the number of blocks prior to the latest finalized block to be retained
 	CfgStorageStatePruningRetainedBlocks = "storage.statePruningRetainedBlocks"
+	// CfgStorageTxIndexEnabled indicates whether to index the txs of the applied blocks by hash
+	CfgStorageTxIndexEnabled = "storage.txIndexEnabled"
+
+	// CfgReproCaptureEnabled indicates whether to capture a repro bundle when applying a block fails unexpectedly
+	CfgReproCaptureEnabled = "repro.captureEnabled"
+	// CfgReproCaptureDir sets the directory of the repro bundles, defaults to the "repro" directory under the data path
+	CfgReproCaptureDir = "repro.captureDir"
+	// CfgReproCaptureMinInterval sets the minimal interval (in seconds) between two captures
+	CfgReproCaptureMinInterval = "repro.captureMinInterval"
+	// CfgReproCaptureMaxBundleSize limits the size (in bytes) of a repro bundle
+	CfgReproCaptureMaxBundleSize = "repro.captureMaxBundleSize"
+	// CfgReproCaptureMaxBundles limits the number of repro bundles kept in the directory
+	CfgReproCaptureMaxBundles = "repro.captureMaxBundles"
 
 	// CfgSyncMessageQueueSize defines the capacity of Sync Manager message queue.
 	CfgSyncMessageQueueSize = "sync.messageQueueSize"
@@ -82,7 +123,26 @@ p2p:
 func init() {
 	viper.SetDefault(CfgConsensusMaxEpochLength, 10)
 	viper.SetDefault(CfgConsensusMinProposalWait, 6)
+	viper.SetDefault(CfgConsensusMaxProposalTxCollectionTime, 2)
+	viper.SetDefault(CfgConsensusMinEmptyBlockInterval, 0)
 	viper.SetDefault(CfgConsensusMessageQueueSize, 512)
+	viper.SetDefault(CfgConsensusSafeModeReorgDepth, 20)
+
+	viper.SetDefault(CfgMempoolHeightDrivenExpirySweep, false)
+	viper.SetDefault(CfgMempoolExpirySweepInterval, 10)
+
+	viper.SetDefault(CfgLedgerParallelTxExecution, false)
+	viper.SetDefault(CfgLedgerBalanceJournalEnabled, false)
+	viper.SetDefault(CfgLedgerStateAccessListsEnabled, false)
+	viper.SetDefault(CfgLedgerMaxProposalTxExecutionTime, 500)
+	viper.SetDefault(CfgLedgerDeploymentScreeningGasCap, 500000)
+	viper.SetDefault(CfgLedgerCallCacheSize, 4096)
+
+	viper.SetDefault(CfgReproCaptureEnabled, false)
+	viper.SetDefault(CfgReproCaptureDir, "")
+	viper.SetDefault(CfgReproCaptureMinInterval, 600)
+	viper.SetDefault(CfgReproCaptureMaxBundleSize, 64*1024*1024)
+	viper.SetDefault(CfgReproCaptureMaxBundles, 10)
 
 	viper.SetDefault(CfgSyncMessageQueueSize, 512)
 	viper.SetDefault(CfgSyncDownloadByHash, false)
@@ -91,6 +151,7 @@ func init() {
 	viper.SetDefault(CfgStorageStatePruningEnabled, true)
 	viper.SetDefault(CfgStorageStatePruningInterval, 16)
 	viper.SetDefault(CfgStorageStatePruningRetainedBlocks, 512)
+	viper.SetDefault(CfgStorageTxIndexEnabled, false)
 
 	viper.SetDefault(CfgRPCEnabled, false)
 	viper.SetDefault(CfgP2PMessageQueueSize, 512)
@@ -0,0 +1,103 @@
+package common
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/thetatoken/theta/common/metrics"
+)
+
+//
+// BoundedFeed delivers the published events to its subscriptions, each through a buffered channel of
+// the event type, see Subscribe(). The publisher never waits for a subscriber: when the buffer of a
+// subscription is full, the new event is dropped for that subscription and counted.
+//
+type BoundedFeed struct {
+	mu             *sync.Mutex
+	subs           map[*FeedSubscription]bool
+	droppedCounter metrics.Counter
+}
+
+// FeedSubscription is a subscription to a BoundedFeed
+type FeedSubscription struct {
+	feed    *BoundedFeed
+	channel reflect.Value
+	dropped uint64
+}
+
+// NewBoundedFeed creates an instance of BoundedFeed. The droppedCounter, if not nil, counts the
+// events dropped by all the subscriptions.
+func NewBoundedFeed(droppedCounter metrics.Counter) *BoundedFeed {
+	return &BoundedFeed{
+		mu:             &sync.Mutex{},
+		subs:           make(map[*FeedSubscription]bool),
+		droppedCounter: droppedCounter,
+	}
+}
+
+// Subscribe adds a subscription delivering the events to the given channel, whose capacity bounds
+// the buffer. The channel must be able to receive the published events, and is closed on Unsubscribe().
+func (feed *BoundedFeed) Subscribe(channel interface{}) *FeedSubscription {
+	ch := reflect.ValueOf(channel)
+	if ch.Kind() != reflect.Chan || ch.Type().ChanDir()&reflect.SendDir == 0 {
+		panic(fmt.Sprintf("BoundedFeed: can not subscribe with %T", channel))
+	}
+
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+
+	sub := &FeedSubscription{
+		feed:    feed,
+		channel: ch,
+	}
+	feed.subs[sub] = true
+	return sub
+}
+
+// HasSubscribers indicates whether there is any subscription, so the publisher can skip building
+// the events nobody receives
+func (feed *BoundedFeed) HasSubscribers() bool {
+	if feed == nil {
+		return false
+	}
+
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+
+	return len(feed.subs) > 0
+}
+
+// Publish delivers the event to the subscriptions without blocking
+func (feed *BoundedFeed) Publish(event interface{}) {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+
+	value := reflect.ValueOf(event)
+	for sub := range feed.subs {
+		if !sub.channel.TrySend(value) {
+			atomic.AddUint64(&sub.dropped, 1)
+			if feed.droppedCounter != nil {
+				feed.droppedCounter.Inc(1)
+			}
+		}
+	}
+}
+
+// NumDropped returns the number of events dropped since the buffer was full
+func (sub *FeedSubscription) NumDropped() uint64 {
+	return atomic.LoadUint64(&sub.dropped)
+}
+
+// Unsubscribe stops the delivery of the events and closes the events channel
+func (sub *FeedSubscription) Unsubscribe() {
+	feed := sub.feed
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+
+	if feed.subs[sub] {
+		delete(feed.subs, sub)
+		sub.channel.Close()
+	}
+}
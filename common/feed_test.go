@@ -0,0 +1,51 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thetatoken/theta/common/metrics"
+)
+
+type testFeedEvent struct {
+	seq int
+}
+
+func TestBoundedFeed(t *testing.T) {
+	assert := assert.New(t)
+
+	var nilFeed *BoundedFeed
+	assert.False(nilFeed.HasSubscribers())
+
+	dropped := &metrics.StandardCounter{}
+	feed := NewBoundedFeed(dropped)
+	assert.False(feed.HasSubscribers())
+
+	events := make(chan *testFeedEvent, 2)
+	sub := feed.Subscribe(events)
+	slowEvents := make(chan *testFeedEvent)
+	slowSub := feed.Subscribe(slowEvents)
+	assert.True(feed.HasSubscribers())
+
+	// The full buffers never block the publisher, the events are dropped instead
+	for seq := 1; seq <= 3; seq++ {
+		feed.Publish(&testFeedEvent{seq: seq})
+	}
+	assert.Equal(1, (<-events).seq)
+	assert.Equal(2, (<-events).seq)
+	assert.Equal(uint64(1), sub.NumDropped())
+	assert.Equal(uint64(3), slowSub.NumDropped())
+	assert.Equal(int64(4), dropped.Count())
+
+	// Unsubscribing closes the channel, and only once
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+	_, ok := <-events
+	assert.False(ok)
+	slowSub.Unsubscribe()
+	assert.False(feed.HasSubscribers())
+	feed.Publish(&testFeedEvent{seq: 4})
+
+	assert.Panics(func() { feed.Subscribe(&testFeedEvent{}) })
+	assert.Panics(func() { feed.Subscribe(make(<-chan *testFeedEvent)) })
+}
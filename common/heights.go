@@ -3,6 +3,195 @@ package common
 // HeightEnableValidatorReward specifies the minimal block height to enable the validtor TFUEL reward
 const HeightEnableValidatorReward uint64 = 4164982 // approximate time: 2pm January 14th, 2020
 
+// HeightEnableCanonicalTxInputOrder specifies the minimal block height to require the inputs of the send
+// transactions to be sorted by address, see types.NormalizeTx
+const HeightEnableCanonicalTxInputOrder uint64 = 8500000
+
+// HeightEnableStructuredSignature specifies the minimal block height to accept the signatures over the
+// structured sign bytes of the transactions, see types.StructuredSignBytes
+const HeightEnableStructuredSignature uint64 = 8500000
+
+// HeightEnableFeePayer specifies the minimal block height to accept the send transactions whose fee is paid
+// by a fee payer instead of the inputs
+const HeightEnableFeePayer uint64 = 8500000
+
+// HeightEnableStakeCommission specifies the minimal block height to accept the stake commission transactions,
+// and to share the validator reward among the stake sources after the commission of the stake holder
+const HeightEnableStakeCommission uint64 = 8500000
+
+// HeightEnableUnbondingQueue specifies the minimal block height to accept the stake deposits from a source
+// whose stake to the holder is withdrawn, the withdrawals are then queued and returned at their own heights
+const HeightEnableUnbondingQueue uint64 = 8500000
+
+// HeightEnableGuardianStaking specifies the minimal block height to accept the stakes deposited to the guardian
+// nodes, and to share the block reward between the validator and the guardian stakes
+const HeightEnableGuardianStaking uint64 = 8500000
+
+// HeightEnableStakeIndex specifies the minimal block height to index the stakes by source and by holder in the
+// state, the index is built from the candidate pools with the first pool update at or above the height
+const HeightEnableStakeIndex uint64 = 8500000
+
+// HeightEnableValidatorMetadata specifies the minimal block height to accept the transactions setting the
+// metadata of the stake holders, see types.UpdateValidatorMetadataTx
+const HeightEnableValidatorMetadata uint64 = 8500000
+
+// HeightEnableValidatorJailing specifies the minimal block height to track the liveness of the validators, and to
+// jail the validators missing too many blocks, see core.ValidatorLivenessTracker
+const HeightEnableValidatorJailing uint64 = 8500000
+
+// HeightEnableVerifiableProposer specifies the minimal block height to select the proposers with a seed derived from
+// the block height and epoch, and to require the proposer of the coinbase transaction to be the selected one, see
+// consensus.SelectProposer
+const HeightEnableVerifiableProposer uint64 = 8500000
+
+// HeightEnableStakingParams specifies the minimal block height to apply the scheduled changes of the minimum
+// validator stake deposit and of the return locking period, see core.StakingParamsSchedule
+const HeightEnableStakingParams uint64 = 8500000
+
+// HeightEnableStakeReturnQueue specifies the minimal block height to queue the withdrawn stakes by return height in
+// the state, so the blocks only look up the stakes due for return. The queue is built from the candidate pools with
+// the first pool update at or above the height.
+const HeightEnableStakeReturnQueue uint64 = 8500000
+
+// HeightEnableStakeEjection specifies the minimal block height to accept the transactions of the stake holders
+// withdrawing the stakes of their sources, see types.EjectStakeTx
+const HeightEnableStakeEjection uint64 = 8500000
+
+// HeightEnableRewardWithholding specifies the minimal block height to track the fullness of the blocks, and to
+// withhold the reward of the proposers leaving their blocks underfilled while there is demand, see
+// core.TxInclusionParams
+const HeightEnableRewardWithholding uint64 = 8500000
+
+// HeightEnableValidatorKeyRotation specifies the minimal block height to accept the transactions of the validators
+// moving their stakes to a new signing key, see types.UpdateValidatorKeyTx
+const HeightEnableValidatorKeyRotation uint64 = 8500000
+
+// HeightEnableStakeHistory specifies the minimal block height to record the changes of the total stake of each
+// validator stake holder in the state
+const HeightEnableStakeHistory uint64 = 8500000
+
+// HeightEnableStakeReturnAddress specifies the minimal block height to accept the stake withdrawals returning the
+// stake to an address other than the source, see types.WithdrawStakeTx
+const HeightEnableStakeReturnAddress uint64 = 8500000
+
+// HeightEnableRewardHistory specifies the minimal block height to record the rewards granted by the coinbase
+// transactions in the state, by epoch and by recipient
+const HeightEnableRewardHistory uint64 = 8500000
+
+// HeightEnableDepositIdempotency specifies the minimal block height to accept the stake deposits carrying an
+// idempotency nonce, and to keep the recent nonces of each source in the state, see types.DepositStakeTx
+const HeightEnableDepositIdempotency uint64 = 8500000
+
+// HeightEnableContractGasRefund specifies the minimal block height to charge the fee for the whole gas limit of
+// the smart contract transactions before their execution, and to refund the fee for the unused gas afterwards
+const HeightEnableContractGasRefund uint64 = 8500000
+
+// HeightEnableLogBloom specifies the minimal block height for the blocks to commit the bloom filter of the
+// addresses and topics of the logs emitted by their transactions, see core.BlockHeader.Bloom
+const HeightEnableLogBloom uint64 = 8500000
+
+// HeightEnableCreate2 specifies the minimal block height to accept the CREATE2 opcode, which deploys a contract at
+// an address derived from the deployer, a salt and the init code, see types.CreateContractAddress2
+const HeightEnableCreate2 uint64 = 8500000
+
+// HeightEnableFeeDistribution specifies the minimal block height for the tx fees to be split according to the
+// fee policy, with the share not burned claimed by the next block proposer through the coinbase transaction.
+// The fees are burned entirely before that, see types.FeePolicy
+const HeightEnableFeeDistribution uint64 = 8500000
+
+// HeightEnableReceiptRoot specifies the minimal block height for the blocks to commit the root hash of the trie of
+// the receipts of their transactions, see core.BlockHeader.ReceiptHash and types.TxReceipt.ConsensusBytes
+const HeightEnableReceiptRoot uint64 = 8500000
+
+// HeightEnableCoinbaseBatching specifies the minimal block height for the outputs of the coinbase transaction to be
+// sorted by address, and capped in size, with the rewards not fitting carried over to the next block, see
+// types.MaxCoinbaseOutputsSize
+const HeightEnableCoinbaseBatching uint64 = 8500000
+
+// HeightEnableEIP1884 specifies the minimal block height for the EVM to accept the SELFBALANCE opcode, and to charge
+// the repriced state access opcodes of EIP-1884 on the main network, see vm.ChainConfig
+const HeightEnableEIP1884 uint64 = 8500000
+
+// HeightEnableStorageSlotDeletion specifies the minimal block height for the storage slots of a contract cleared by
+// the EVM to be deleted from the storage trie of the contract. The cleared slots kept their previous value before.
+const HeightEnableStorageSlotDeletion uint64 = 8500000
+
+// HeightEnableContractStaking specifies the minimal block height for the contracts to deposit and withdraw their
+// own stakes through the stake precompiled contracts, see execution.DepositStakePrecompileAddress
+const HeightEnableContractStaking uint64 = 8500000
+
+// HeightEnableBlockGasBudget specifies the minimal block height to reject the blocks whose txs take up more intrinsic
+// gas than the gas budget of the block in the state, see types.IntrinsicGasSchedule
+const HeightEnableBlockGasBudget uint64 = 8500000
+
+// HeightEnableTxGasLimitCap specifies the minimal block height to reject the smart contract transactions with a
+// gas limit above types.MaximumTxGasLimit
+const HeightEnableTxGasLimitCap uint64 = 8500000
+
+// HeightEnableDustThreshold specifies the minimal block height to reject the SendTx outputs which carry no coins,
+// or a coin amount below the dust threshold, or less than the minimum amount for the account they create
+const HeightEnableDustThreshold uint64 = 8500000
+
+// HeightEnableBlockTxSizeLimit specifies the minimal block height to reject the blocks containing a regular
+// transaction larger than the max tx size in the state
+const HeightEnableBlockTxSizeLimit uint64 = 8500000
+
+// HeightEnableEd25519Signature specifies the minimal block height to accept the Ed25519 input signatures of the
+// transactions, see crypto.SchemeEd25519
+const HeightEnableEd25519Signature uint64 = 8500000
+
+// HeightEnableSmartContract specifies the minimal block height to accept the smart contract transactions in the
+// blocks. The smart contract transactions can be simulated at any height, see execution.Executor.SimulateTx
+const HeightEnableSmartContract uint64 = 8500000
+
+// HeightEnableSendTxData specifies the minimal block height to accept the send transactions carrying data, e.g. a
+// memo attributing a deposit to a user, see types.SendTx.Data
+const HeightEnableSendTxData uint64 = 8500000
+
+// HeightEnableSendTxExpiry specifies the minimal block height to accept the send transactions with a valid-until
+// height, and to reject them once the block height is past it, see types.SendTx.ValidUntilHeight
+const HeightEnableSendTxExpiry uint64 = 8500000
+
+// HeightEnableSendTxInputLimit specifies the minimal block height to reject the send transactions with more than
+// types.MaxSendTxInputs inputs
+const HeightEnableSendTxInputLimit uint64 = 8500000
+
+// HeightEnableMultisig specifies the minimal block height to accept the multisig account updates, and the input
+// signatures of the multisig account owners, see types.UpdateMultisigTx
+const HeightEnableMultisig uint64 = 8500000
+
+// HeightEnablePartialReleaseFund specifies the minimal block height to accept the partial releases of the reserved
+// funds, see types.PartialReleaseFundTx
+const HeightEnablePartialReleaseFund uint64 = 8500000
+
+// HeightEnableExtendSplitRule specifies the minimal block height to accept the extensions of the split rules, see
+// types.ExtendSplitRuleTx
+const HeightEnableExtendSplitRule uint64 = 8500000
+
+// HeightEnableSweepAccount specifies the minimal block height to accept the sweeps of the accounts, see
+// types.SweepAccountTx
+const HeightEnableSweepAccount uint64 = 8500000
+
+// HeightEnableBurn specifies the minimal block height to accept the coin burns, and to reject the sends to the
+// zero address, see types.BurnTx
+const HeightEnableBurn uint64 = 8500000
+
+// HeightEnableDoubleSignSlash specifies the minimal block height to accept the evidences of double signing, which
+// slash the stakes of the offending validators, see types.DoubleSignSlashTx
+const HeightEnableDoubleSignSlash uint64 = 8500000
+
+// HeightEnableTxValidation specifies the minimal block height to reject the malformed transactions in the blocks,
+// see types.Tx.Validate. The mempool rejects them at any height
+const HeightEnableTxValidation uint64 = 8500000
+
+// HeightEnableBlockRegularTxLimit specifies the minimal block height to reject the blocks with more regular
+// transactions than the limit in the state, see state.StoreView.GetMaxNumRegularTxsPerBlock
+const HeightEnableBlockRegularTxLimit uint64 = 8500000
+
+// HeightEnableCanonicalTxEncoding specifies the minimal block height to reject the blocks with transactions in
+// a non-canonical encoding, see types.TxFromCanonicalBytes. The mempool rejects them at any height
+const HeightEnableCanonicalTxEncoding uint64 = 8500000
+
 // CheckpointInterval defines the interval between checkpoints.
 const CheckpointInterval = int64(100)
 
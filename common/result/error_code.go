@@ -5,7 +5,9 @@ type ErrorCode int
 const (
 	CodeOK ErrorCode = 0
 
-	// Common Errors
+	// Common Errors. The transactions are rejected with a specific code, the messages are
+	// only informative and may change. CodeInvalidSequence is superseded by CodeSequenceTooLow
+	// and CodeSequenceTooHigh, and is no longer returned.
 	CodeGenericError             ErrorCode = 100000
 	CodeInvalidSignature         ErrorCode = 100001
 	CodeInvalidSequence          ErrorCode = 100002
@@ -13,6 +15,18 @@ const (
 	CodeEmptyPubKeyWithSequence1 ErrorCode = 100004
 	CodeUnauthorizedTx           ErrorCode = 100005
 	CodeInvalidFee               ErrorCode = 100006
+	CodeBlockGasLimitExceeded    ErrorCode = 100007
+	CodeTxExpired                ErrorCode = 100008
+	CodeWrongChainID             ErrorCode = 100009
+	CodeSequenceTooLow           ErrorCode = 100010
+	CodeSequenceTooHigh          ErrorCode = 100011
+	CodeUnknownAccount           ErrorCode = 100012
+	CodeInvalidAddress           ErrorCode = 100013
+	CodeInvalidCoins             ErrorCode = 100014
+	CodeDuplicatedAddress        ErrorCode = 100015
+	CodeInvalidTxFormat          ErrorCode = 100016
+	CodeTxTooLarge               ErrorCode = 100017
+	CodeSendToZeroAddress        ErrorCode = 100018
 
 	// ReserveFund Errors
 	CodeReserveFundCheckFailed   ErrorCode = 101001
@@ -20,23 +34,132 @@ const (
 	CodeInvalidFundToReserve     ErrorCode = 101003
 
 	// ReleaseFund Errors
-	CodeReleaseFundCheckFailed ErrorCode = 102001
+	CodeReleaseFundCheckFailed        ErrorCode = 102001
+	CodePartialReleaseFundCheckFailed ErrorCode = 102002
+	CodePartialReleaseFundNotEnabled  ErrorCode = 102003
 
 	// ServerPayment Errors
 	CodeCheckTransferReservedFundFailed ErrorCode = 103001
+	CodeInvalidServicePayment           ErrorCode = 103002
+	CodeReservedFundOverdraft           ErrorCode = 103003
 
 	// SplitRule Errors
 	CodeUnauthorizedToUpdateSplitRule ErrorCode = 104001
+	CodeInvalidSplitRule              ErrorCode = 104002
+	CodeSplitRuleNotFound             ErrorCode = 104003
+	CodeSplitRuleExpired              ErrorCode = 104004
+	CodeExtendSplitRuleNotEnabled     ErrorCode = 104005
 
 	// SmartContract Errors
 	CodeEVMError               ErrorCode = 105001
 	CodeInvalidValueToTransfer ErrorCode = 105002
 	CodeInvalidGasPrice        ErrorCode = 105003
 	CodeFeeLimitTooHigh        ErrorCode = 105004
+	CodeGasLimitTooHigh        ErrorCode = 105005
+	// CodeExecutionTimeLimitExceeded depends on the speed of the machine, it is only used to drop the
+	// transactions from the block proposals, and never to reject a block.
+	CodeExecutionTimeLimitExceeded ErrorCode = 105006
+	// CodeExecutionReverted is only used to screen the transactions, a reverted execution is still applied
+	// to the block, with its state changes reverted.
+	CodeExecutionReverted ErrorCode = 105007
+	// The contract deployments bound to fail whatever the state, see vm.ScreenDeployment. Like CodeExecutionReverted,
+	// they are only used to screen the transactions.
+	CodeIntrinsicGasNotCovered  ErrorCode = 105008
+	CodeContractCodeTooLarge    ErrorCode = 105009
+	CodeInitCodeReverted        ErrorCode = 105010
+	CodeInvalidInitCode         ErrorCode = 105011
+	CodeSmartContractNotEnabled ErrorCode = 105012
 
 	// Stake Deposit/Withdrawal Errors
 	CodeInvalidStakePurpose     ErrorCode = 106001
 	CodeInvalidStake            ErrorCode = 106002
 	CodeInsufficientStake       ErrorCode = 106003
 	CodeNotEnoughBalanceToStake ErrorCode = 106004
+	CodeStakeNotFound           ErrorCode = 106005
+	CodeStakeAlreadyWithdrawn   ErrorCode = 106006
+	CodeStakeLocked             ErrorCode = 106007
+	CodeStakingNotSupported     ErrorCode = 106008
+	CodeStakePurposeNotActive   ErrorCode = 106009
+	CodeStakeNotWithdrawn       ErrorCode = 106010
+	CodeStakeReturnDue          ErrorCode = 106011
+	CodeStakeSlashed            ErrorCode = 106012
+	CodeStakeEjectionNotEnabled ErrorCode = 106013
+	CodeStakeEjected            ErrorCode = 106014
+	CodeSelfStakeEjection       ErrorCode = 106015
+	CodeInvalidReturnAddress    ErrorCode = 106016
+	CodeReturnAddressConflict   ErrorCode = 106017
+	CodeInvalidIdempotencyNonce ErrorCode = 106018
+	CodeDuplicateDepositNonce   ErrorCode = 106019
+
+	// Send Errors
+	CodeSendTxDataTooLarge       ErrorCode = 108001
+	CodeSendTxTooManyAccounts    ErrorCode = 108002
+	CodeSendTxUnbalanced         ErrorCode = 108003
+	CodeSendTxZeroOutput         ErrorCode = 108004
+	CodeSendTxDustOutput         ErrorCode = 108005
+	CodeSendTxNewAccountTooSmall ErrorCode = 108006
+	CodeSendTxNonCanonicalOrder  ErrorCode = 108007
+	CodeSendTxInvalidFeePayer    ErrorCode = 108008
+	CodeSendTxDataNotEnabled     ErrorCode = 108009
+	CodeSendTxExpiryNotEnabled   ErrorCode = 108010
+
+	// Multisig Errors
+	CodeInvalidMultisigPolicy  ErrorCode = 109001
+	CodeInsufficientSignatures ErrorCode = 109002
+	CodeMultisigNotEnabled     ErrorCode = 109003
+
+	// SweepAccount Errors
+	CodeSweepIncompleteBalance ErrorCode = 110001
+	CodeSweepAccountInUse      ErrorCode = 110002
+	CodeSweepAccountNotEnabled ErrorCode = 110003
+
+	// DoubleSignSlash Errors
+	CodeInvalidDoubleSignEvidence ErrorCode = 111001
+	CodeDoubleSignEvidenceExpired ErrorCode = 111002
+	CodeDoubleSignAlreadySlashed  ErrorCode = 111003
+	CodeDoubleSignSlashNotEnabled ErrorCode = 111004
+
+	// StakeCommission Errors
+	CodeInvalidStakeCommission    ErrorCode = 112001
+	CodeStakeCommissionNotEnabled ErrorCode = 112002
+
+	// ValidatorMetadata Errors
+	CodeInvalidValidatorMetadata    ErrorCode = 113001
+	CodeValidatorMetadataNotEnabled ErrorCode = 113002
+	CodeNotStakeHolder              ErrorCode = 113003
+
+	// Unjail Errors
+	CodeValidatorNotJailed         ErrorCode = 114001
+	CodeJailCooldownNotPassed      ErrorCode = 114002
+	CodeValidatorJailingNotEnabled ErrorCode = 114003
+
+	// Coinbase Errors
+	CodeUnexpectedProposer ErrorCode = 115001
+
+	// ValidatorKey Errors
+	CodeValidatorKeyRotationNotEnabled ErrorCode = 116001
+	CodeInvalidNewValidatorKey         ErrorCode = 116002
+	CodeValidatorKeyRotated            ErrorCode = 116003
+	CodeJailedValidatorKeyRotation     ErrorCode = 116004
+
+	// Burn Errors
+	CodeBurnNotEnabled ErrorCode = 117001
+
+	// Block Application Errors. Except for CodeInternalStoreError, the block is invalid
+	// and applying it again yields the same error. See also CodeBlockGasLimitExceeded.
+	// CodeBlockVetoedByHook is only as deterministic as the registered pre-block hooks.
+	CodeInvalidTx          ErrorCode = 107001
+	CodeStateRootMismatch  ErrorCode = 107002
+	CodeInvalidCoinbase    ErrorCode = 107003
+	CodeInternalStoreError ErrorCode = 107004
+	CodeTooManyRegularTxs  ErrorCode = 107005
+	CodeBlockVetoedByHook  ErrorCode = 107006
+	CodeDuplicateTx        ErrorCode = 107007
+	CodeLogBloomMismatch   ErrorCode = 107008
+
+	// The receipt root committed by the block does not match its receipts, see common.HeightEnableReceiptRoot
+	CodeReceiptRootMismatch ErrorCode = 107010
+
+	// Raised by the state access verification of an applied block, the block itself is valid
+	CodeStateAccessViolation ErrorCode = 107009
 )
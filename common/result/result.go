@@ -21,6 +21,12 @@ func (res Result) IsError() bool {
 	return res.Code != CodeOK
 }
 
+// IsInternalError indicates if the execution failed due to a local error, e.g. a database error,
+// rather than the invalidity of the input. Such an execution might succeed if retried later.
+func (res Result) IsInternalError() bool {
+	return res.Code == CodeInternalStoreError
+}
+
 // String returns the string representation of the result
 func (res Result) String() string {
 	return fmt.Sprintf("Result{code:%v, message:%v}", res.Code, res.Message)
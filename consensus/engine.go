@@ -2,6 +2,7 @@ package consensus
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 	"sort"
@@ -17,6 +18,7 @@ import (
 	"github.com/thetatoken/theta/core"
 	"github.com/thetatoken/theta/crypto"
 	"github.com/thetatoken/theta/dispatcher"
+	"github.com/thetatoken/theta/ledger/types"
 	"github.com/thetatoken/theta/rlp"
 	"github.com/thetatoken/theta/store"
 )
@@ -24,6 +26,7 @@ import (
 var logger = log.WithFields(log.Fields{"prefix": "consensus"})
 
 var _ core.ConsensusEngine = (*ConsensusEngine)(nil)
+var _ core.ChainRewinder = (*ConsensusEngine)(nil)
 
 // ConsensusEngine is the default implementation of the Engine interface.
 type ConsensusEngine struct {
@@ -49,7 +52,11 @@ type ConsensusEngine struct {
 	epochTimer    *time.Timer
 	proposalTimer *time.Timer
 
-	state *State
+	state    *State
+	safeMode *core.SafeMode
+	lastTip  *core.ExtendedBlock // tip after the last validated block, for the deep-reorg guard
+
+	panicHandler func(r interface{}) // handles the panics of the main loop, nil to crash the process
 }
 
 // NewConsensusEngine creates a instance of ConsensusEngine.
@@ -74,6 +81,8 @@ func NewConsensusEngine(privateKey *crypto.PrivateKey, db store.Store, chain *bl
 	logger = util.GetLoggerForModule("consensus")
 	e.logger = logger
 
+	e.safeMode = core.NewSafeMode(e.CheckIntegrity)
+
 	e.logger.WithFields(log.Fields{"state": e.state}).Info("Starting state")
 
 	return e
@@ -120,11 +129,11 @@ func (e *ConsensusEngine) Start(ctx context.Context) {
 	e.cancel = cancel
 
 	// Verify configurations
-	if viper.GetInt(common.CfgConsensusMaxEpochLength) <= viper.GetInt(common.CfgConsensusMinProposalWait) {
+	if err := verifyConfigs(); err != nil {
 		log.WithFields(log.Fields{
 			"CfgConsensusMaxEpochLength":  viper.GetInt(common.CfgConsensusMaxEpochLength),
 			"CfgConsensusMinProposalWait": viper.GetInt(common.CfgConsensusMinProposalWait),
-		}).Fatal("Invalid configuration: max epoch length must be larger than minimal proposal wait")
+		}).Fatal(err)
 	}
 
 	// Set ledger state pointer to initial state.
@@ -135,6 +144,46 @@ func (e *ConsensusEngine) Start(ctx context.Context) {
 	go e.mainLoop()
 }
 
+func verifyConfigs() error {
+	if viper.GetInt(common.CfgConsensusMaxEpochLength) <= viper.GetInt(common.CfgConsensusMinProposalWait) {
+		return errors.New("Invalid configuration: max epoch length must be larger than minimal proposal wait")
+	}
+	return nil
+}
+
+// SafeMode returns the safe mode controller of the node
+func (e *ConsensusEngine) SafeMode() *core.SafeMode {
+	return e.safeMode
+}
+
+// CheckIntegrity re-runs the startup integrity checks, i.e. verifies the configurations, the finalized
+// blocks against the hardcoded block hashes, and the availability of the last finalized state.
+func (e *ConsensusEngine) CheckIntegrity() error {
+	if err := verifyConfigs(); err != nil {
+		return err
+	}
+
+	lastFinalized := e.state.GetLastFinalizedBlock()
+	for height, hash := range core.HardcodeBlockHashes {
+		if height > lastFinalized.Height {
+			continue
+		}
+		for _, block := range e.chain.FindBlocksByHeight(height) {
+			if block.Status.IsFinalized() && block.Hash().Hex() != hash {
+				return fmt.Errorf("Finalized block %v at height %v does not match the hardcoded hash %v",
+					block.Hash().Hex(), height, hash)
+			}
+		}
+	}
+
+	if e.ledger != nil {
+		if _, err := e.ledger.GetFinalizedValidatorCandidatePool(lastFinalized.Hash(), false); err != nil {
+			return fmt.Errorf("Failed to load the state of the last finalized block %v: %v", lastFinalized.Hash().Hex(), err)
+		}
+	}
+	return nil
+}
+
 func (e *ConsensusEngine) autoRewind(lastCC *core.ExtendedBlock) *core.ExtendedBlock {
 	// check hardcoded block hashes to determine if need to auto rewind
 	heights := make([]uint64, 0, len(core.HardcodeBlockHashes))
@@ -215,6 +264,91 @@ func (e *ConsensusEngine) autoRewind(lastCC *core.ExtendedBlock) *core.ExtendedB
 	return lastCC
 }
 
+// rewindRequest is the message asking the main loop to rewind the chain, see RewindTo()
+type rewindRequest struct {
+	block          *core.ExtendedBlock
+	rollbackLedger func() error
+	done           chan error
+}
+
+// RewindTo moves the chain tip back to the given finalized block, and disposes all its descendants, along
+// with the ledger rolled back by rollbackLedger, e.g. by Ledger.Rollback(). Once the engine is started, the
+// rewind is carried out by the main loop in between the messages, so it does not race with the block
+// processing. The caller must not hold the ledger lock, which the main loop might be waiting for.
+func (e *ConsensusEngine) RewindTo(block *core.ExtendedBlock, rollbackLedger func() error) error {
+	if e.ctx == nil { // not started
+		return e.rewindTo(block, rollbackLedger)
+	}
+
+	req := &rewindRequest{
+		block:          block,
+		rollbackLedger: rollbackLedger,
+		done:           make(chan error, 1),
+	}
+	select {
+	case e.incoming <- req:
+	case <-e.ctx.Done():
+		return errors.New("The consensus engine is stopped")
+	}
+	select {
+	case err := <-req.done:
+		return err
+	case <-e.ctx.Done():
+		return errors.New("The consensus engine is stopped")
+	}
+}
+
+// rewindTo rewinds the chain for RewindTo(). The ledger is rolled back after the checks, and the chain is
+// only rewound if that succeeds, so that either both or neither of them are rolled back.
+func (e *ConsensusEngine) rewindTo(block *core.ExtendedBlock, rollbackLedger func() error) error {
+	if !block.Status.IsFinalized() {
+		return fmt.Errorf("Block %v is not finalized", block.Hash().Hex())
+	}
+	lastFinalized := e.state.GetLastFinalizedBlock()
+	if lastFinalized != nil && block.Height > lastFinalized.Height {
+		return fmt.Errorf("Block height %v is above the last finalized height %v", block.Height, lastFinalized.Height)
+	}
+
+	descendants := []*core.ExtendedBlock{}
+	stack := append([]common.Hash{}, block.Children...)
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		descendant, err := e.chain.FindBlock(hash)
+		if err != nil {
+			return fmt.Errorf("Failed to find descendant block %v: %v", hash.Hex(), err)
+		}
+		stack = append(stack, descendant.Children...)
+		descendants = append(descendants, descendant)
+	}
+
+	if err := rollbackLedger(); err != nil {
+		return err
+	}
+
+	for _, descendant := range descendants {
+		descendant.Status = core.BlockStatusDisposed
+		e.chain.SaveBlock(descendant)
+		e.chain.RemoveVotesByHash(descendant.Hash())
+	}
+
+	e.state.SetLastFinalizedBlock(block)
+	e.state.SetHighestCCBlock(block)
+	e.state.SetLastVote(core.Vote{})
+	e.state.SetLastProposal(core.Proposal{})
+	e.lastTip = nil // the operator-initiated rewind is not a reorg
+
+	e.logger.WithFields(log.Fields{"block": block.Hash().Hex(), "height": block.Height}).Warn("Rewound the chain")
+	return nil
+}
+
+// SetPanicHandler sets the handler of the panics in the main loop, and must be called before Start().
+// Once a panic is handed to the handler, the engine stops. Without a handler, a panic crashes the process.
+func (e *ConsensusEngine) SetPanicHandler(handler func(r interface{})) {
+	e.panicHandler = handler
+}
+
 // Stop notifies all goroutines to stop without blocking.
 func (e *ConsensusEngine) Stop() {
 	e.cancel()
@@ -228,6 +362,16 @@ func (e *ConsensusEngine) Wait() {
 func (e *ConsensusEngine) mainLoop() {
 	defer e.wg.Done()
 
+	if e.panicHandler != nil {
+		defer func() {
+			if r := recover(); r != nil {
+				e.stopped = true
+				e.cancel()
+				e.panicHandler(r)
+			}
+		}()
+	}
+
 	for {
 		e.enterEpoch()
 	Epoch:
@@ -290,6 +434,8 @@ func (e *ConsensusEngine) processMessage(msg interface{}) (endEpoch bool) {
 	case *core.Block:
 		e.logger.WithFields(log.Fields{"block": m}).Debug("Received block")
 		e.handleBlock(m)
+	case *rewindRequest:
+		m.done <- e.rewindTo(m.block, m.rollbackLedger)
 	default:
 		// Should not happen.
 		log.Errorf("Unknown message type: %v", m)
@@ -463,6 +609,7 @@ func (e *ConsensusEngine) handleHardcodeBlock(hash common.Hash) {
 			"error":            result.Message,
 			"parent.StateHash": parent.StateHash,
 		}).Error("Failed to reset state to parent.StateHash")
+		e.checkStateCorruption(block, result)
 		return
 	}
 	result = e.ledger.ApplyBlockTxs(block)
@@ -473,6 +620,7 @@ func (e *ConsensusEngine) handleHardcodeBlock(hash common.Hash) {
 			"block":           block.Hash().Hex(),
 			"block.StateHash": block.StateHash.Hex(),
 		}).Error("Failed to apply block Txs")
+		e.checkStateCorruption(block, result)
 		return
 	}
 
@@ -521,13 +669,18 @@ func (e *ConsensusEngine) handleNormalBlock(eb *core.ExtendedBlock) {
 		e.checkCC(block.HCC.BlockHash)
 	}
 
+	// The local failures, e.g. database errors, say nothing about the validity of the block. The block
+	// is left pending rather than marked invalid in such cases, the pending blocks are resumed on restart.
 	result := e.ledger.ResetState(parent.Height, parent.StateHash)
 	if result.IsError() {
 		e.logger.WithFields(log.Fields{
 			"error":            result.Message,
 			"parent.StateHash": parent.StateHash,
 		}).Error("Failed to reset state to parent.StateHash")
-		e.chain.MarkBlockInvalid(block.Hash())
+		e.checkStateCorruption(block, result)
+		if !result.IsInternalError() {
+			e.chain.MarkBlockInvalid(block.Hash())
+		}
 		return
 	}
 	result = e.ledger.ApplyBlockTxs(block)
@@ -538,7 +691,10 @@ func (e *ConsensusEngine) handleNormalBlock(eb *core.ExtendedBlock) {
 			"block":           block.Hash().Hex(),
 			"block.StateHash": block.StateHash.Hex(),
 		}).Error("Failed to apply block Txs")
-		e.chain.MarkBlockInvalid(block.Hash())
+		e.checkStateCorruption(block, result)
+		if !result.IsInternalError() {
+			e.chain.MarkBlockInvalid(block.Hash())
+		}
 		return
 	}
 
@@ -552,6 +708,11 @@ func (e *ConsensusEngine) handleNormalBlock(eb *core.ExtendedBlock) {
 	}
 
 	e.chain.MarkBlockValid(block.Hash())
+	e.checkReorg(e.GetTipToVote())
+
+	if notifier, ok := e.validatorManager.(validatorSetChangeNotifier); ok {
+		notifier.notifyBlockValidated(block)
+	}
 
 	// Skip voting for block older than current best known epoch.
 	// Allow block with one epoch behind since votes are processed first and might advance epoch
@@ -870,6 +1031,9 @@ func (e *ConsensusEngine) finalizeBlock(block *core.ExtendedBlock) error {
 }
 
 func (e *ConsensusEngine) shouldPropose(tip *core.ExtendedBlock, epoch uint64) bool {
+	if e.safeMode.Enabled() { // proposals are suspended in safe mode
+		return false
+	}
 	if epoch <= tip.Epoch {
 		return false
 	}
@@ -929,8 +1093,18 @@ func (e *ConsensusEngine) createProposal() (core.Proposal, error) {
 	hccValidators := e.validatorManager.GetValidatorSet(block.HCC.BlockHash)
 	block.HCC.Votes = e.chain.FindVotesByHash(block.HCC.BlockHash).UniqueVoter().FilterByValidators(hccValidators)
 
-	// Add Txs.
-	newRoot, txs, result := e.ledger.ProposeBlockTxs(block)
+	// Add Txs. Stop collecting txs in time so the proposal is not delayed by a congested mempool.
+	// Skip the mempool entirely if there is nothing to collect.
+	var newRoot common.Hash
+	var txs []common.Bytes
+	if e.ledger.HasPendingTxs() {
+		maxTxCollectionTime := time.Duration(viper.GetInt(common.CfgConsensusMaxProposalTxCollectionTime)) * time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), maxTxCollectionTime)
+		defer cancel()
+		newRoot, txs, result = e.ledger.ProposeBlockTxsWithDeadline(ctx, block)
+	} else {
+		newRoot, txs, result = e.ledger.ProposeEmptyBlockTxs(block)
+	}
 	if result.IsError() {
 		err := fmt.Errorf("Failed to collect Txs for block proposal: %v", result.String())
 		return core.Proposal{}, err
@@ -979,6 +1153,10 @@ func (e *ConsensusEngine) propose() {
 		proposal = lastProposal
 		e.logger.WithFields(log.Fields{"proposal": proposal}).Info("Repeating proposal")
 	} else {
+		if e.shouldSkipEmptyBlock(tip) {
+			e.logger.WithFields(log.Fields{"tip": tip.Hash().Hex()}).Debug("Skip proposing consecutive empty block")
+			return
+		}
 		proposal, err = e.createProposal()
 		if err != nil {
 			e.logger.WithFields(log.Fields{"error": err}).Error("Failed to create proposal")
@@ -1010,6 +1188,35 @@ func (e *ConsensusEngine) propose() {
 	}()
 }
 
+// shouldSkipEmptyBlock returns true if the proposal would be an empty block following another empty
+// block within the configured minimal interval.
+func (e *ConsensusEngine) shouldSkipEmptyBlock(tip *core.ExtendedBlock) bool {
+	minInterval := int64(viper.GetInt(common.CfgConsensusMinEmptyBlockInterval))
+	if minInterval <= 0 || tip.Height == core.GenesisBlockHeight || tip.Timestamp == nil {
+		return false
+	}
+	if e.ledger.HasPendingTxs() || !isEmptyBlock(tip.Block) {
+		return false
+	}
+	return time.Now().Unix()-tip.Timestamp.Int64() < minInterval
+}
+
+// isEmptyBlock returns true if the block contains only the special transactions, e.g. the CoinbaseTx.
+func isEmptyBlock(block *core.Block) bool {
+	for _, rawTx := range block.Txs {
+		tx, err := types.TxFromBytes(rawTx)
+		if err != nil {
+			return false
+		}
+		switch tx.(type) {
+		case *types.CoinbaseTx, *types.SlashTx:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 func (e *ConsensusEngine) pruneState(currentBlockHeight uint64) {
 	if !viper.GetBool(common.CfgStorageStatePruningEnabled) {
 		return
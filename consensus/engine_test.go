@@ -5,12 +5,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/thetatoken/theta/blockchain"
 	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
 	"github.com/thetatoken/theta/core"
 	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/types"
 	"github.com/thetatoken/theta/store/database/backend"
 	"github.com/thetatoken/theta/store/kvstore"
 )
@@ -742,3 +745,95 @@ func TestTipSelection(t *testing.T) {
 	tip = ce.GetTipToExtend()
 	assert.Equal(a2.Hash(), tip.Hash(), "should not select blocks with validator update that are higher than local HCC")
 }
+
+func TestSafeModeDeepReorgGuard(t *testing.T) {
+	assert := assert.New(t)
+
+	privKey, _, _ := crypto.GenerateKeyPair()
+	validatorManager := MockValidatorManager{PrivKey: privKey}
+
+	core.ResetTestBlocks()
+
+	store := kvstore.NewKVStore(backend.NewMemDatabase())
+	root := core.CreateTestBlock("root", "")
+	chain := blockchain.NewChain("testchain", store, root)
+
+	ce := NewConsensusEngine(nil, store, chain, nil, validatorManager)
+
+	reorgDepth := viper.GetInt(common.CfgConsensusSafeModeReorgDepth)
+	viper.Set(common.CfgConsensusSafeModeReorgDepth, 3)
+	defer viper.Set(common.CfgConsensusSafeModeReorgDepth, reorgDepth)
+
+	addValidBlock := func(name, parent string) {
+		block := core.CreateTestBlock(name, parent)
+		chain.AddBlock(block)
+		chain.MarkBlockValid(block.Hash())
+		ce.checkReorg(ce.GetTipToVote())
+	}
+
+	addValidBlock("a1", "root")
+	addValidBlock("a2", "a1")
+	addValidBlock("b1", "a1")
+	addValidBlock("b2", "b1")
+	assert.False(ce.SafeMode().Enabled(), "should tolerate shallow reorgs")
+
+	addValidBlock("a3", "a2")
+	addValidBlock("c1", "root")
+	addValidBlock("c2", "c1")
+	assert.False(ce.SafeMode().Enabled(), "should ignore the branches not taking over the tip")
+
+	addValidBlock("c3", "c2")
+	addValidBlock("c4", "c3")
+	assert.True(ce.SafeMode().Enabled(), "should enter safe mode on deep reorgs")
+	assert.Contains(ce.SafeMode().Status().Reason, "Deep reorg")
+}
+
+func TestSafeModeStateCorruption(t *testing.T) {
+	assert := assert.New(t)
+
+	privKey, _, _ := crypto.GenerateKeyPair()
+	validatorManager := MockValidatorManager{PrivKey: privKey}
+
+	core.ResetTestBlocks()
+
+	store := kvstore.NewKVStore(backend.NewMemDatabase())
+	root := core.CreateTestBlock("root", "")
+	chain := blockchain.NewChain("testchain", store, root)
+
+	ce := NewConsensusEngine(nil, store, chain, nil, validatorManager)
+
+	block := core.CreateTestBlock("b1", "root")
+	ce.checkStateCorruption(block, result.Error("Invalid block"))
+	assert.False(ce.SafeMode().Enabled(), "should not enter safe mode on invalid blocks")
+
+	ce.checkStateCorruption(block, result.Error("Missing trie node").WithErrorCode(result.CodeInternalStoreError))
+	assert.True(ce.SafeMode().Enabled(), "should enter safe mode on state access failures")
+	assert.Contains(ce.SafeMode().Status().Reason, "Missing trie node")
+}
+
+func TestIsEmptyBlock(t *testing.T) {
+	assert := assert.New(t)
+
+	block := core.NewBlock()
+	assert.True(isEmptyBlock(block))
+
+	coinbaseTx := &types.CoinbaseTx{
+		Proposer:    types.TxInput{Address: common.HexToAddress("0x1")},
+		Outputs:     []types.TxOutput{},
+		BlockHeight: 2,
+	}
+	rawCoinbaseTx, err := types.TxToBytes(coinbaseTx)
+	assert.Nil(err)
+	block.Txs = []common.Bytes{rawCoinbaseTx}
+	assert.True(isEmptyBlock(block))
+
+	sendTx := &types.SendTx{
+		Fee:     types.NewCoins(0, 1000000000000),
+		Inputs:  []types.TxInput{{Address: common.HexToAddress("0x2"), Sequence: 1}},
+		Outputs: []types.TxOutput{{Address: common.HexToAddress("0x3")}},
+	}
+	rawSendTx, err := types.TxToBytes(sendTx)
+	assert.Nil(err)
+	block.Txs = append(block.Txs, rawSendTx)
+	assert.False(isEmptyBlock(block))
+}
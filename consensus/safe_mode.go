@@ -0,0 +1,68 @@
+package consensus
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+)
+
+// checkReorg is the deep-reorg guard. It enters the safe mode if the tip switches to a branch that forks
+// off at least the configured number of blocks below the previous tip, see CfgConsensusSafeModeReorgDepth.
+func (e *ConsensusEngine) checkReorg(tip *core.ExtendedBlock) {
+	prevTip := e.lastTip
+	e.lastTip = tip
+
+	maxDepth := viper.GetInt(common.CfgConsensusSafeModeReorgDepth)
+	if prevTip == nil || maxDepth <= 0 {
+		return
+	}
+
+	ancestor, err := e.findCommonAncestor(prevTip, tip)
+	if err != nil {
+		e.logger.WithFields(log.Fields{"error": err}).Warn("Failed to find the fork point of the tip")
+		return
+	}
+	depth := prevTip.Height - ancestor.Height
+	if depth < uint64(maxDepth) {
+		return
+	}
+
+	reason := fmt.Sprintf("Deep reorg: tip %v switched to %v, forking %v blocks below at height %v",
+		prevTip.Hash().Hex(), tip.Hash().Hex(), depth, ancestor.Height)
+	e.logger.Warnf("Entering safe mode, reason: %v", reason)
+	e.safeMode.Enter(reason)
+}
+
+// findCommonAncestor returns the latest block that both the given blocks descend from, or are
+func (e *ConsensusEngine) findCommonAncestor(b1, b2 *core.ExtendedBlock) (*core.ExtendedBlock, error) {
+	var err error
+	for b1.Hash() != b2.Hash() {
+		if b1.Height >= b2.Height {
+			b1, err = e.chain.FindBlock(b1.Parent)
+		} else {
+			b2, err = e.chain.FindBlock(b2.Parent)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b1, nil
+}
+
+// checkStateCorruption is the corruption auditor of the block application. It enters the safe mode if the
+// ledger failed to access its state, e.g. due to a corrupted database, since the states served by the node
+// can no longer be trusted.
+func (e *ConsensusEngine) checkStateCorruption(block *core.Block, res result.Result) {
+	if !res.IsInternalError() {
+		return
+	}
+
+	reason := fmt.Sprintf("State corruption: failed to process block %v at height %v: %v",
+		block.Hash().Hex(), block.Height, res.Message)
+	e.logger.Warnf("Entering safe mode, reason: %v", reason)
+	e.safeMode.Enter(reason)
+}
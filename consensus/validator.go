@@ -1,15 +1,20 @@
 package consensus
 
 import (
+	"encoding/binary"
 	"math/big"
 	"math/rand"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/thetatoken/theta/blockchain"
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
 )
 
-const MaxValidatorCount int = 31
+// MaxValidatorCount is the max number of validators in the validator set, unless overridden by the chain
+// parameter in the state
+const MaxValidatorCount int = core.DefaultMaxNumValidators
 
 //
 // -------------------------------- FixedValidatorManager ----------------------------------
@@ -18,13 +23,15 @@ var _ core.ValidatorManager = &FixedValidatorManager{}
 
 // FixedValidatorManager is an implementation of ValidatorManager interface that selects a fixed validator as the proposer.
 type FixedValidatorManager struct {
-	consensus core.ConsensusEngine
+	consensus  core.ConsensusEngine
+	changeFeed *common.BoundedFeed
 }
 
 // NewFixedValidatorManager creates an instance of FixedValidatorManager.
 func NewFixedValidatorManager() *FixedValidatorManager {
 	m := &FixedValidatorManager{
-		consensus: nil,
+		consensus:  nil,
+		changeFeed: common.NewBoundedFeed(nil),
 	}
 	return m
 }
@@ -64,20 +71,39 @@ func (m *FixedValidatorManager) GetNextValidatorSet(blockHash common.Hash) *core
 	return valSet
 }
 
+// GetValidatorSetChanges returns the validators that joined or left the validator set from fromBlock to toBlock,
+// with their effective heights.
+func (m *FixedValidatorManager) GetValidatorSetChanges(fromBlock common.Hash, toBlock common.Hash) ([]core.ValidatorSetChange, error) {
+	return getValidatorSetChanges(m.consensus, m, fromBlock, toBlock)
+}
+
+// SubscribeValidatorSetChanges subscribes to the validator set changes of the validated blocks, buffering up to
+// bufferSize events.
+func (m *FixedValidatorManager) SubscribeValidatorSetChanges(bufferSize int) *ValidatorSetChangeSubscription {
+	return subscribeValidatorSetChanges(m.changeFeed, bufferSize)
+}
+
+func (m *FixedValidatorManager) notifyBlockValidated(block *core.Block) {
+	notifyValidatorSetChange(m.changeFeed, m, block)
+}
+
 //
 // -------------------------------- RotatingValidatorManager ----------------------------------
 //
 var _ core.ValidatorManager = &RotatingValidatorManager{}
 
 // RotatingValidatorManager is an implementation of ValidatorManager interface that selects a random validator as
-// the proposer using validator's stake as weight.
+// the proposer using validator's stake as weight, see SelectProposer.
 type RotatingValidatorManager struct {
-	consensus core.ConsensusEngine
+	consensus  core.ConsensusEngine
+	changeFeed *common.BoundedFeed
 }
 
 // NewRotatingValidatorManager creates an instance of RotatingValidatorManager.
 func NewRotatingValidatorManager() *RotatingValidatorManager {
-	m := &RotatingValidatorManager{}
+	m := &RotatingValidatorManager{
+		changeFeed: common.NewBoundedFeed(nil),
+	}
 	return m
 }
 
@@ -86,21 +112,73 @@ func (m *RotatingValidatorManager) SetConsensusEngine(consensus core.ConsensusEn
 	m.consensus = consensus
 }
 
-// GetProposer implements ValidatorManager interface.
+// GetProposer implements ValidatorManager interface. It returns the proposer of the given block at the epoch.
 func (m *RotatingValidatorManager) GetProposer(blockHash common.Hash, epoch uint64) core.Validator {
-	return m.getProposerFromValidators(m.GetValidatorSet(blockHash), epoch)
+	return SelectProposer(m.GetValidatorSet(blockHash), m.getBlockHeight(blockHash), epoch)
 }
 
-// GetNextProposer implements ValidatorManager interface.
+// GetNextProposer implements ValidatorManager interface. It returns the proposer of the child of the given block at
+// the epoch.
 func (m *RotatingValidatorManager) GetNextProposer(blockHash common.Hash, epoch uint64) core.Validator {
-	return m.getProposerFromValidators(m.GetNextValidatorSet(blockHash), epoch)
+	return SelectProposer(m.GetNextValidatorSet(blockHash), m.getBlockHeight(blockHash)+1, epoch)
+}
+
+func (m *RotatingValidatorManager) getBlockHeight(blockHash common.Hash) uint64 {
+	engine, ok := m.consensus.(interface{ Chain() *blockchain.Chain })
+	if !ok {
+		log.Panic("Failed to access the chain of the consensus engine")
+	}
+	block, err := engine.Chain().FindBlock(blockHash)
+	if err != nil {
+		log.Panicf("Failed to find block %v: %v", blockHash.Hex(), err)
+	}
+	return block.Height
 }
 
-func (m *RotatingValidatorManager) getProposerFromValidators(valSet *core.ValidatorSet, epoch uint64) core.Validator {
+// SelectProposer selects the proposer of the block at the height and epoch out of the validator set, with a
+// probability proportional to the stake of each validator. The selection only depends on its arguments, so
+// anyone can verify the proposer of a block given the validator set at its parent: the validators are lined up
+// in the order of their addresses, each covering a range as wide as its stake, and the proposer is the one whose
+// range contains Keccak256(height, epoch) modulo the total stake. The blocks below
+// common.HeightEnableVerifiableProposer use the legacy selection seeded by the epoch only.
+func SelectProposer(valSet *core.ValidatorSet, height uint64, epoch uint64) core.Validator {
 	if valSet.Size() == 0 {
 		log.Panic("No validators have been added")
 	}
+	if height < common.HeightEnableVerifiableProposer {
+		return selectProposerByEpoch(valSet, epoch)
+	}
+
+	validators := valSet.Validators()
+	totalStake := valSet.TotalStake()
+	if totalStake.Sign() == 0 {
+		return validators[0]
+	}
+
+	r := new(big.Int).Mod(proposerSeed(height, epoch), totalStake)
+	curr := new(big.Int)
+	for _, v := range validators {
+		curr.Add(curr, v.Stake)
+		if r.Cmp(curr) < 0 {
+			return v
+		}
+	}
+
+	// Should not reach here.
+	log.Panic("Failed to select a proposer")
+	panic("Should not reach here")
+}
+
+// proposerSeed returns Keccak256 of the big-endian height followed by the big-endian epoch, as an integer
+func proposerSeed(height uint64, epoch uint64) *big.Int {
+	seed := make([]byte, 16)
+	binary.BigEndian.PutUint64(seed[:8], height)
+	binary.BigEndian.PutUint64(seed[8:], epoch)
+	return new(big.Int).SetBytes(crypto.Keccak256(seed))
+}
 
+// selectProposerByEpoch is the proposer selection below common.HeightEnableVerifiableProposer
+func selectProposerByEpoch(valSet *core.ValidatorSet, epoch uint64) core.Validator {
 	totalStake := valSet.TotalStake()
 	scalingFactor := new(big.Int).Div(totalStake, common.BigMaxUint32)
 	scalingFactor = new(big.Int).Add(scalingFactor, common.Big1)
@@ -135,12 +213,36 @@ func (m *RotatingValidatorManager) GetNextValidatorSet(blockHash common.Hash) *c
 	return valSet
 }
 
+// GetValidatorSetChanges returns the validators that joined or left the validator set from fromBlock to toBlock,
+// with their effective heights.
+func (m *RotatingValidatorManager) GetValidatorSetChanges(fromBlock common.Hash, toBlock common.Hash) ([]core.ValidatorSetChange, error) {
+	return getValidatorSetChanges(m.consensus, m, fromBlock, toBlock)
+}
+
+// SubscribeValidatorSetChanges subscribes to the validator set changes of the validated blocks, buffering up to
+// bufferSize events.
+func (m *RotatingValidatorManager) SubscribeValidatorSetChanges(bufferSize int) *ValidatorSetChangeSubscription {
+	return subscribeValidatorSetChanges(m.changeFeed, bufferSize)
+}
+
+func (m *RotatingValidatorManager) notifyBlockValidated(block *core.Block) {
+	notifyValidatorSetChange(m.changeFeed, m, block)
+}
+
 //
 // -------------------------------- Utilities ----------------------------------
 //
 
+// SelectTopStakeHoldersAsValidators selects the validators out of the pool, with the default max number of
+// validators
 func SelectTopStakeHoldersAsValidators(vcp *core.ValidatorCandidatePool) *core.ValidatorSet {
-	maxNumValidators := MaxValidatorCount
+	return SelectTopStakeHoldersAsValidatorsWithLimit(vcp, MaxValidatorCount)
+}
+
+// SelectTopStakeHoldersAsValidatorsWithLimit selects the stake holders with the largest total stakes as the
+// validators, at most maxNumValidators of them. The ties are broken by holder address, so every node picks the
+// same set. The stake holders left out are on standby, see core.ValidatorCandidatePool.GetStandbyStakeHolders.
+func SelectTopStakeHoldersAsValidatorsWithLimit(vcp *core.ValidatorCandidatePool, maxNumValidators int) *core.ValidatorSet {
 	topStakeHolders := vcp.GetTopStakeHolders(maxNumValidators)
 
 	valSet := core.NewValidatorSet()
@@ -165,8 +267,12 @@ func selectTopStakeHoldersAsValidatorsForBlock(consensus core.ConsensusEngine, b
 	if vcp == nil {
 		log.Panic("Failed to retrieve the validator candidate pool")
 	}
+	maxNumValidators, err := consensus.GetLedger().GetFinalizedMaxNumValidators(blockHash, isNext)
+	if err != nil {
+		log.Panicf("Failed to get the max number of validators: %v", err)
+	}
 
-	return SelectTopStakeHoldersAsValidators(vcp)
+	return SelectTopStakeHoldersAsValidatorsWithLimit(vcp, maxNumValidators)
 }
 
 // Generate a random uint64 in [0, max)
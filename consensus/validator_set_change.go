@@ -0,0 +1,102 @@
+package consensus
+
+import (
+	"fmt"
+
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+)
+
+// ValidatorSetChangeEvent is published when the validator set of the child of a block differs from the validator
+// set of the block
+type ValidatorSetChangeEvent struct {
+	BlockHash common.Hash
+	Height    uint64
+	Changes   []core.ValidatorSetChange // effective at Height + 1
+}
+
+// ValidatorSetChangeSubscription receives the ValidatorSetChangeEvents in the order the blocks are validated.
+// Like the BlockAppliedSubscription of the ledger, its buffer is bounded and the consensus engine never waits
+// for the subscriber: when the buffer is full, the new event is dropped and counted.
+type ValidatorSetChangeSubscription struct {
+	*common.FeedSubscription
+	events chan *ValidatorSetChangeEvent
+}
+
+// Events returns the channel of the events, which is closed on Unsubscribe()
+func (sub *ValidatorSetChangeSubscription) Events() <-chan *ValidatorSetChangeEvent {
+	return sub.events
+}
+
+func subscribeValidatorSetChanges(feed *common.BoundedFeed, bufferSize int) *ValidatorSetChangeSubscription {
+	events := make(chan *ValidatorSetChangeEvent, bufferSize)
+	return &ValidatorSetChangeSubscription{
+		FeedSubscription: feed.Subscribe(events),
+		events:           events,
+	}
+}
+
+// validatorSetChangeNotifier is implemented by the validator managers publishing the validator set changes, the
+// consensus engine notifies them of each validated block
+type validatorSetChangeNotifier interface {
+	notifyBlockValidated(block *core.Block)
+}
+
+// notifyValidatorSetChange publishes the changes between the validator set of the block and the validator set of
+// its child, if any
+func notifyValidatorSetChange(feed *common.BoundedFeed, valMgr core.ValidatorManager, block *core.Block) {
+	if !feed.HasSubscribers() {
+		return
+	}
+
+	blockHash := block.Hash()
+	changes := core.DiffValidatorSets(valMgr.GetValidatorSet(blockHash), valMgr.GetNextValidatorSet(blockHash), block.Height+1)
+	if len(changes) == 0 {
+		return
+	}
+	feed.Publish(&ValidatorSetChangeEvent{
+		BlockHash: blockHash,
+		Height:    block.Height,
+		Changes:   changes,
+	})
+}
+
+// getValidatorSetChanges returns the validator set changes from the validator set of fromBlock to the validator set
+// of toBlock, following the chain from toBlock up to fromBlock. Each change is effective at the height of the first
+// block validated by the changed set. It returns an error if fromBlock is not an ancestor of toBlock.
+func getValidatorSetChanges(consensus core.ConsensusEngine, valMgr core.ValidatorManager, fromBlock common.Hash, toBlock common.Hash) ([]core.ValidatorSetChange, error) {
+	engine, ok := consensus.(interface{ Chain() *blockchain.Chain })
+	if !ok {
+		return nil, fmt.Errorf("Failed to access the chain of the consensus engine")
+	}
+	chain := engine.Chain()
+
+	from, err := chain.FindBlock(fromBlock)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find block %v: %v", fromBlock.Hex(), err)
+	}
+
+	// Collect the blocks from toBlock up to, and excluding, fromBlock
+	blocks := []*core.ExtendedBlock{}
+	for blockHash := toBlock; blockHash != fromBlock; {
+		block, err := chain.FindBlock(blockHash)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find block %v: %v", blockHash.Hex(), err)
+		}
+		if block.Height <= from.Height {
+			return nil, fmt.Errorf("Block %v is not an ancestor of block %v", fromBlock.Hex(), toBlock.Hex())
+		}
+		blocks = append(blocks, block)
+		blockHash = block.Parent
+	}
+
+	changes := []core.ValidatorSetChange{}
+	prevValSet := valMgr.GetValidatorSet(fromBlock)
+	for i := len(blocks) - 1; i >= 0; i-- {
+		valSet := valMgr.GetValidatorSet(blocks[i].Hash())
+		changes = append(changes, core.DiffValidatorSets(prevValSet, valSet, blocks[i].Height)...)
+		prevValSet = valSet
+	}
+	return changes, nil
+}
@@ -0,0 +1,104 @@
+package consensus
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+)
+
+func TestSelectProposer(t *testing.T) {
+	assert := assert.New(t)
+
+	valSet := core.NewValidatorSet()
+	for i := int64(1); i <= 4; i++ {
+		addr := common.BigToAddress(big.NewInt(i)).Hex()
+		valSet.AddValidator(core.NewValidator(addr, new(big.Int).Mul(core.MinValidatorStakeDeposit, big.NewInt(i))))
+	}
+	isValidator := func(v core.Validator) bool {
+		_, err := valSet.GetValidator(v.Address)
+		return err == nil
+	}
+
+	// The legacy selection depends on the epoch only
+	height := common.HeightEnableVerifiableProposer - 1
+	assert.True(isValidator(SelectProposer(valSet, height, 7)))
+	assert.Equal(SelectProposer(valSet, height, 7).Address, SelectProposer(valSet, height-100, 7).Address)
+
+	// From the fork on, the selection is deterministic, and proportional to the stakes
+	height = common.HeightEnableVerifiableProposer
+	assert.Equal(SelectProposer(valSet, height, 7).Address, SelectProposer(valSet, height, 7).Address)
+
+	numRounds := 20000
+	counts := make(map[common.Address]int)
+	for epoch := uint64(0); epoch < uint64(numRounds); epoch++ {
+		counts[SelectProposer(valSet, height+epoch%3, epoch).Address]++
+	}
+	for i, v := range valSet.Validators() {
+		expected := float64(numRounds) * float64(i+1) / 10
+		assert.InDelta(expected, float64(counts[v.Address]), 0.02*float64(numRounds), v.Address.Hex())
+	}
+
+	// Without any stake, the first validator proposes
+	zeroStakeSet := core.NewValidatorSet()
+	zeroStakeSet.AddValidator(core.NewValidator(common.BigToAddress(big.NewInt(2)).Hex(), big.NewInt(0)))
+	zeroStakeSet.AddValidator(core.NewValidator(common.BigToAddress(big.NewInt(1)).Hex(), big.NewInt(0)))
+	assert.Equal(zeroStakeSet.Validators()[0].Address, SelectProposer(zeroStakeSet, height, 1).Address)
+}
+
+// nextSetValidatorManager returns a different validator set for the next block
+type nextSetValidatorManager struct {
+	MockValidatorManager
+	valSet     *core.ValidatorSet
+	nextValSet *core.ValidatorSet
+}
+
+func (m *nextSetValidatorManager) GetValidatorSet(_ common.Hash) *core.ValidatorSet {
+	return m.valSet
+}
+
+func (m *nextSetValidatorManager) GetNextValidatorSet(_ common.Hash) *core.ValidatorSet {
+	return m.nextValSet
+}
+
+func TestValidatorSetChangeSubscription(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	stake := new(big.Int).Set(core.MinValidatorStakeDeposit)
+	va1 := core.NewValidator("0x111", stake)
+	va2 := core.NewValidator("0x222", stake)
+	valSet := core.NewValidatorSet()
+	valSet.AddValidator(va1)
+	nextValSet := core.NewValidatorSet()
+	nextValSet.AddValidator(va1)
+	nextValSet.AddValidator(va2)
+	valMgr := &nextSetValidatorManager{valSet: valSet, nextValSet: valSet}
+
+	feed := common.NewBoundedFeed(nil)
+	block := core.NewBlock()
+	block.Height = 10
+	notifyValidatorSetChange(feed, valMgr, block) // no subscribers
+
+	sub := subscribeValidatorSetChanges(feed, 1)
+	notifyValidatorSetChange(feed, valMgr, block) // no changes
+	assert.Equal(0, len(sub.Events()))
+
+	valMgr.nextValSet = nextValSet
+	notifyValidatorSetChange(feed, valMgr, block)
+	notifyValidatorSetChange(feed, valMgr, block) // the buffer is full
+	assert.Equal(uint64(1), sub.NumDropped())
+
+	event := <-sub.Events()
+	require.NotNil(event)
+	assert.Equal(block.Hash(), event.BlockHash)
+	assert.Equal(uint64(10), event.Height)
+	assert.Equal([]core.ValidatorSetChange{{Validator: va2, Joined: true, EffectiveHeight: 11}}, event.Changes)
+
+	sub.Unsubscribe()
+	_, ok := <-sub.Events()
+	assert.False(ok)
+}
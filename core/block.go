@@ -11,11 +11,13 @@ import (
 	"github.com/thetatoken/theta/common/result"
 	"github.com/thetatoken/theta/crypto"
 	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/database"
 	"github.com/thetatoken/theta/store/trie"
 )
 
 const (
-	// MaxNumRegularTxsPerBlock represents the max number of regular transaction can be inclulded in one block
+	// MaxNumRegularTxsPerBlock represents the max number of regular transaction can be inclulded in one block,
+	// unless overridden by the chain parameter in the state
 	MaxNumRegularTxsPerBlock int = 8192
 )
 
@@ -54,7 +56,9 @@ func (b *Block) AddTxs(txs []common.Bytes) {
 // updateTxHash calculate transaction root hash.
 func (b *Block) updateTxHash() {
 	b.TxHash = CalculateRootHash(b.Txs)
-	b.ReceiptHash = EmptyRootHash
+	if b.ReceiptHash.IsEmpty() {
+		b.ReceiptHash = EmptyRootHash // unless set by the ledger, see common.HeightEnableReceiptRoot
+	}
 }
 
 // Validate checks the block is legitimate.
@@ -70,14 +74,43 @@ func (b *Block) Validate(chainID string) result.Result {
 }
 
 func CalculateRootHash(items []common.Bytes) common.Hash {
-	keybuf := new(bytes.Buffer)
+	return newItemTrie(items).Hash()
+}
+
+// ProveItem puts into proofDb the trie nodes proving the item at the given index against the root hash of the
+// items, see CalculateRootHash
+func ProveItem(items []common.Bytes, index int, proofDb database.Putter) error {
+	if index < 0 || index >= len(items) {
+		return fmt.Errorf("Item index %v out of range, %v items", index, len(items))
+	}
+	return newItemTrie(items).Prove(itemKey(index), 0, proofDb)
+}
+
+// VerifyItemProof returns the item at the given index proven against the root hash of the items, see ProveItem
+func VerifyItemProof(rootHash common.Hash, index int, proofDb trie.DatabaseReader) (common.Bytes, error) {
+	item, _, err := trie.VerifyProof(rootHash, itemKey(index), proofDb)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, fmt.Errorf("No item at index %v", index)
+	}
+	return item, nil
+}
+
+// newItemTrie returns the trie of the items, keyed by the RLP encoding of their index
+func newItemTrie(items []common.Bytes) *trie.Trie {
 	trie := new(trie.Trie)
 	for i := 0; i < len(items); i++ {
-		keybuf.Reset()
-		rlp.Encode(keybuf, uint(i))
-		trie.Update(keybuf.Bytes(), items[i])
+		trie.Update(itemKey(i), items[i])
 	}
-	return trie.Hash()
+	return trie
+}
+
+func itemKey(index int) []byte {
+	keybuf := new(bytes.Buffer)
+	rlp.Encode(keybuf, uint(index))
+	return keybuf.Bytes()
 }
 
 // BlockHeader contains the essential information of a block.
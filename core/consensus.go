@@ -17,6 +17,14 @@ type ConsensusEngine interface {
 	GetLastFinalizedBlock() *ExtendedBlock
 }
 
+// ChainRewinder is implemented by the consensus engines able to move the chain tip back to a
+// finalized block, which allows the ledger to roll back its state together with the chain. The
+// engine calls rollbackLedger once the rewind is known to be possible, and only moves the chain
+// tip if it succeeds.
+type ChainRewinder interface {
+	RewindTo(block *ExtendedBlock, rollbackLedger func() error) error
+}
+
 // ValidatorManager is the component for managing validator related logic for consensus engine.
 type ValidatorManager interface {
 	SetConsensusEngine(consensus ConsensusEngine)
@@ -1,9 +1,15 @@
 package core
 
 const (
-	MainnetChainID = "mainnet"
+	MainnetChainID    = "mainnet"
+	TestnetChainID    = "testnet"
+	PrivatenetChainID = "privatenet"
 
 	MainnetGenesisBlockHash = "0xd8836c6cf3c3ccea0b015b4ed0f9efb0ffe6254db793a515843c9d0f68cbab65"
 
 	GenesisBlockHeight = uint64(0)
 )
+
+// KnownChainIDs lists the IDs of the public chains. The transactions signed for one of them are
+// reported as such when they are submitted to another chain.
+var KnownChainIDs = []string{MainnetChainID, TestnetChainID, PrivatenetChainID}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/thetatoken/theta/common"
+)
+
+const (
+	GuardianReturnLockingPeriod uint64 = 14400 // number of blocks, approximately 1 day with 6 second block time
+)
+
+var (
+	MinGuardianStakeDeposit *big.Int
+)
+
+func init() {
+	// Each guardian stake deposit needs to be at least 1,000 Theta
+	MinGuardianStakeDeposit = new(big.Int).Mul(new(big.Int).SetUint64(1000), new(big.Int).SetUint64(1000000000000000000))
+}
+
+//
+// ------- GuardianCandidatePool ------- //
+//
+
+// GuardianCandidatePool keeps track of the stakes deposited to the guardian nodes. It is kept apart from the
+// ValidatorCandidatePool, so the guardian stakes never weigh in the validator set. The guardian stakes share the
+// coinbase reward with the validator stakes, pro-rata to their totals.
+type GuardianCandidatePool struct {
+	SortedGuardians []*StakeHolder
+}
+
+// FindStakeDelegate returns the guardian with the given address, or nil if there is none
+func (gcp *GuardianCandidatePool) FindStakeDelegate(guardianAddr common.Address) *StakeHolder {
+	if gcp == nil {
+		return nil
+	}
+	for _, guardian := range gcp.SortedGuardians {
+		if guardian.Holder == guardianAddr {
+			return guardian
+		}
+	}
+	return nil
+}
+
+// FindStake returns the stake the source deposited to the guardian, or nil if there is none
+func (gcp *GuardianCandidatePool) FindStake(source common.Address, holder common.Address) *Stake {
+	guardian := gcp.FindStakeDelegate(holder)
+	if guardian == nil {
+		return nil
+	}
+	for _, stake := range guardian.Stakes {
+		if stake.Source == source {
+			return stake
+		}
+	}
+	return nil
+}
+
+// FindActiveStake returns the stake the source deposited to the guardian that is not withdrawn, or nil if there
+// is none
+func (gcp *GuardianCandidatePool) FindActiveStake(source common.Address, holder common.Address) *Stake {
+	guardian := gcp.FindStakeDelegate(holder)
+	if guardian == nil {
+		return nil
+	}
+	return guardian.activeStake(source)
+}
+
+// TotalStake returns the total stake of the guardians, not counting the withdrawn stakes
+func (gcp *GuardianCandidatePool) TotalStake() *big.Int {
+	totalStake := new(big.Int)
+	if gcp == nil {
+		return totalStake
+	}
+	for _, guardian := range gcp.SortedGuardians {
+		totalStake.Add(totalStake, guardian.TotalStake())
+	}
+	return totalStake
+}
+
+// DepositStake deposits the stake from the source to the guardian. As for the validators after the unbonding
+// queue, a deposit is merged into the active stake of the source, and the withdrawn stakes return at their own
+// heights.
+func (gcp *GuardianCandidatePool) DepositStake(source common.Address, holder common.Address, amount *big.Int) error {
+	if amount.Cmp(MinGuardianStakeDeposit) < 0 {
+		return fmt.Errorf("Insufficient guardian stake: %v", amount)
+	}
+
+	guardian := gcp.FindStakeDelegate(holder)
+	if guardian == nil {
+		gcp.SortedGuardians = append(gcp.SortedGuardians, newStakeHolder(holder, []*Stake{newStake(source, amount)}))
+	} else if err := guardian.depositActiveStake(source, amount); err != nil {
+		return err
+	}
+	gcp.sortGuardians()
+
+	return nil
+}
+
+// WithdrawStake withdraws the active stake of the source from the guardian, which returns to the source after
+// the GuardianReturnLockingPeriod
+func (gcp *GuardianCandidatePool) WithdrawStake(source common.Address, holder common.Address, currentHeight uint64) error {
+	guardian := gcp.FindStakeDelegate(holder)
+	if guardian == nil {
+		return fmt.Errorf("No matched guardian address found: %v", holder)
+	}
+
+	err := guardian.withdrawStakeUntil(source, currentHeight+GuardianReturnLockingPeriod)
+	if err != nil {
+		return err
+	}
+	gcp.sortGuardians()
+
+	return nil
+}
+
+// PendingStakeReturns returns the withdrawn guardian stakes of the source that are not returned yet, ordered by
+// return height, then by guardian
+func (gcp *GuardianCandidatePool) PendingStakeReturns(source common.Address) []PendingStakeReturn {
+	if gcp == nil {
+		return []PendingStakeReturn{}
+	}
+	return pendingStakeReturns(gcp.SortedGuardians, source)
+}
+
+// ReturnStakes removes and returns the withdrawn guardian stakes due at the current height
+func (gcp *GuardianCandidatePool) ReturnStakes(currentHeight uint64) []*Stake {
+	returnedStakes := []*Stake{}
+	for _, returnedStake := range gcp.ReturnStakesWithHolders(currentHeight) {
+		returnedStakes = append(returnedStakes, returnedStake.Stake)
+	}
+	return returnedStakes
+}
+
+// ReturnStakesWithHolders removes and returns the withdrawn guardian stakes due at the current height like
+// ReturnStakes, along with their guardians
+func (gcp *GuardianCandidatePool) ReturnStakesWithHolders(currentHeight uint64) []*ReturnedStake {
+	returnedStakes := []*ReturnedStake{}
+
+	// need to iterate in the reverse order, since we may delete elements from the slice while iterating through it
+	for gidx := len(gcp.SortedGuardians) - 1; gidx >= 0; gidx-- {
+		guardian := gcp.SortedGuardians[gidx]
+		for sidx := len(guardian.Stakes) - 1; sidx >= 0; sidx-- {
+			stake := guardian.Stakes[sidx]
+			if stake.Withdrawn && currentHeight >= stake.ReturnHeight {
+				logger.Printf("Guardian stake to be returned: source = %v, amount = %v", stake.Source, stake.Amount)
+				guardian.Stakes = append(guardian.Stakes[:sidx], guardian.Stakes[sidx+1:]...)
+				returnedStakes = append(returnedStakes, &ReturnedStake{Stake: stake, Holder: guardian.Holder})
+			}
+		}
+
+		if len(guardian.Stakes) == 0 {
+			gcp.SortedGuardians = append(gcp.SortedGuardians[:gidx], gcp.SortedGuardians[gidx+1:]...)
+		}
+	}
+
+	gcp.sortGuardians()
+
+	return returnedStakes
+}
+
+// sortGuardians sorts the guardians in the same order as the validator candidates
+func (gcp *GuardianCandidatePool) sortGuardians() {
+	sort.Slice(gcp.SortedGuardians[:], func(i, j int) bool { // descending order in (totalStake, holderAddress)
+		stakeCmp := gcp.SortedGuardians[i].TotalStake().Cmp(gcp.SortedGuardians[j].TotalStake())
+		if stakeCmp == 0 {
+			return strings.Compare(gcp.SortedGuardians[i].Holder.Hex(), gcp.SortedGuardians[j].Holder.Hex()) >= 0
+		}
+		return stakeCmp > 0
+	})
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+)
+
+func TestGuardianCandidatePool(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	sourceAddr1 := common.HexToAddress("0x111")
+	sourceAddr2 := common.HexToAddress("0x222")
+	guardianAddr1 := common.HexToAddress("0xf01")
+	guardianAddr2 := common.HexToAddress("0xf02")
+	amount := func(n int64) *big.Int {
+		return new(big.Int).Mul(big.NewInt(n), MinGuardianStakeDeposit)
+	}
+
+	// The guardian minimum is far below the validator minimum
+	assert.True(MinGuardianStakeDeposit.Cmp(MinValidatorStakeDeposit) < 0)
+	gcp := &GuardianCandidatePool{}
+	assert.NotNil(gcp.DepositStake(sourceAddr1, guardianAddr1, new(big.Int).Sub(MinGuardianStakeDeposit, big.NewInt(1))))
+	require.Nil(gcp.DepositStake(sourceAddr1, guardianAddr1, amount(1)))
+	require.Nil(gcp.DepositStake(sourceAddr2, guardianAddr1, amount(2)))
+	require.Nil(gcp.DepositStake(sourceAddr1, guardianAddr2, amount(5)))
+	require.Nil(gcp.DepositStake(sourceAddr1, guardianAddr1, amount(1))) // merged into the active stake
+	assert.Equal(amount(9), gcp.TotalStake())
+	assert.Equal(guardianAddr2, gcp.SortedGuardians[0].Holder)
+	assert.Equal(amount(2), gcp.FindStake(sourceAddr1, guardianAddr1).Amount)
+
+	// The withdrawn stakes stop counting, and return after the guardian locking period
+	withdrawHeight := uint64(1000)
+	returnHeight := withdrawHeight + GuardianReturnLockingPeriod
+	require.Nil(gcp.WithdrawStake(sourceAddr1, guardianAddr2, withdrawHeight))
+	assert.NotNil(gcp.WithdrawStake(sourceAddr1, guardianAddr2, withdrawHeight))
+	assert.NotNil(gcp.WithdrawStake(sourceAddr2, guardianAddr2, withdrawHeight))
+	assert.Nil(gcp.FindActiveStake(sourceAddr1, guardianAddr2))
+	assert.Equal(amount(4), gcp.TotalStake())
+	assert.Equal(guardianAddr1, gcp.SortedGuardians[0].Holder)
+	assert.Equal([]PendingStakeReturn{
+		{Holder: guardianAddr2, Source: sourceAddr1, Amount: amount(5), ReturnHeight: returnHeight},
+	}, gcp.PendingStakeReturns(sourceAddr1))
+
+	assert.Empty(gcp.ReturnStakes(returnHeight - 1))
+	returnedStakes := gcp.ReturnStakes(returnHeight)
+	require.Equal(1, len(returnedStakes))
+	assert.Equal(sourceAddr1, returnedStakes[0].Source)
+	assert.Equal(amount(5), returnedStakes[0].Amount)
+	assert.Nil(gcp.FindStakeDelegate(guardianAddr2))
+	assert.Empty(gcp.PendingStakeReturns(sourceAddr1))
+}
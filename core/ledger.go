@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"math/big"
 
 	"github.com/thetatoken/theta/common"
@@ -22,6 +23,7 @@ type TxInfo struct {
 	EffectiveGasPrice *big.Int
 	Address           common.Address
 	Sequence          uint64
+	ExpirationHeight  uint64 // the tx can only be included in blocks below this height, 0 means it never expires
 }
 
 //
@@ -31,11 +33,16 @@ type Ledger interface {
 	GetCurrentBlock() *Block
 	ScreenTxUnsafe(rawTx common.Bytes) result.Result
 	ScreenTx(rawTx common.Bytes) (priority *TxInfo, res result.Result)
+	MaxTxSize() uint64
 	ProposeBlockTxs(block *Block) (stateRootHash common.Hash, blockRawTxs []common.Bytes, res result.Result)
+	ProposeBlockTxsWithDeadline(ctx context.Context, block *Block) (stateRootHash common.Hash, blockRawTxs []common.Bytes, res result.Result)
+	ProposeEmptyBlockTxs(block *Block) (stateRootHash common.Hash, blockRawTxs []common.Bytes, res result.Result)
+	HasPendingTxs() bool
 	ApplyBlockTxs(block *Block) result.Result
 	ApplyBlockTxsForChainCorrection(block *Block) (common.Hash, result.Result)
 	ResetState(height uint64, rootHash common.Hash) result.Result
 	FinalizeState(height uint64, rootHash common.Hash) result.Result
 	GetFinalizedValidatorCandidatePool(blockHash common.Hash, isNext bool) (*ValidatorCandidatePool, error)
+	GetFinalizedMaxNumValidators(blockHash common.Hash, isNext bool) (int, error)
 	PruneState(endHeight uint64) error
 }
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/thetatoken/theta/common"
+)
+
+const (
+	LivenessWindowSize       uint64 = 1000  // number of blocks, the sliding window the missed blocks are counted over
+	MaxMissedBlocksInWindow  uint64 = 500   // a validator missing more blocks within the window is jailed
+	JailCooldownPeriod       uint64 = 14400 // number of blocks, approximately 1 day with 6 second block time
+	livenessWindowSizeInByte        = (LivenessWindowSize + 7) / 8
+)
+
+//
+// ------- ValidatorLivenessTracker ------- //
+//
+
+// ValidatorLiveness records the blocks a validator missed within the sliding window, and whether it is jailed.
+// A validator missed a block if its vote is not in the commit certificate of the block, i.e. block.HCC.
+type ValidatorLiveness struct {
+	Validator       common.Address
+	MissedBlocks    common.Bytes // one bit per block, indexed by the block height modulo LivenessWindowSize
+	NumMissedBlocks uint64
+	LastHeight      uint64 // the height of the last block recorded
+	Jailed          bool
+	JailedHeight    uint64
+}
+
+func newValidatorLiveness(validator common.Address) *ValidatorLiveness {
+	return &ValidatorLiveness{
+		Validator:    validator,
+		MissedBlocks: make(common.Bytes, livenessWindowSizeInByte),
+	}
+}
+
+// record records whether the validator missed the block at the height. The blocks between the last recorded one
+// and the height, where the validator was not in the validator set, slide out of the window as not missed.
+func (vl *ValidatorLiveness) record(height uint64, missed bool) {
+	if height <= vl.LastHeight {
+		return
+	}
+	if height-vl.LastHeight > LivenessWindowSize {
+		vl.resetWindow()
+	} else {
+		for h := vl.LastHeight + 1; h < height; h++ {
+			vl.setMissed(h, false)
+		}
+	}
+	vl.setMissed(height, missed)
+	vl.LastHeight = height
+}
+
+func (vl *ValidatorLiveness) setMissed(height uint64, missed bool) {
+	idx := height % LivenessWindowSize
+	mask := byte(1) << (idx % 8)
+	wasMissed := vl.MissedBlocks[idx/8]&mask != 0
+	if wasMissed == missed {
+		return
+	}
+	if missed {
+		vl.MissedBlocks[idx/8] |= mask
+		vl.NumMissedBlocks++
+	} else {
+		vl.MissedBlocks[idx/8] &^= mask
+		vl.NumMissedBlocks--
+	}
+}
+
+func (vl *ValidatorLiveness) resetWindow() {
+	vl.MissedBlocks = make(common.Bytes, livenessWindowSizeInByte)
+	vl.NumMissedBlocks = 0
+}
+
+func (vl *ValidatorLiveness) String() string {
+	return fmt.Sprintf("{validator: %v, missed: %v, last height: %v, jailed: %v, jailed height: %v}",
+		vl.Validator, vl.NumMissedBlocks, vl.LastHeight, vl.Jailed, vl.JailedHeight)
+}
+
+// ValidatorLivenessTracker keeps track of the liveness of the validators. Only the validators with missed blocks
+// in the window, or jailed, have a record. A jailed validator keeps its stakes, but it is excluded from the
+// validator set until it is unjailed with an UnjailTx, after the JailCooldownPeriod.
+type ValidatorLivenessTracker struct {
+	SortedRecords []*ValidatorLiveness // sorted by validator address
+}
+
+// Get returns the liveness record of the validator, or nil if there is none
+func (vlt *ValidatorLivenessTracker) Get(validator common.Address) *ValidatorLiveness {
+	if vlt == nil {
+		return nil
+	}
+	for _, record := range vlt.SortedRecords {
+		if record.Validator == validator {
+			return record
+		}
+	}
+	return nil
+}
+
+// IsJailed returns whether the validator is jailed
+func (vlt *ValidatorLivenessTracker) IsJailed(validator common.Address) bool {
+	record := vlt.Get(validator)
+	return record != nil && record.Jailed
+}
+
+// RecordBlock records which validators signed the block at the height, and jails the validators that missed
+// more than MaxMissedBlocksInWindow blocks within the window. The last validator that is not jailed is never
+// jailed, so the chain can still make progress. It returns the newly jailed validators.
+func (vlt *ValidatorLivenessTracker) RecordBlock(height uint64, validators []common.Address, signers map[common.Address]bool) []common.Address {
+	numActive := 0
+	for _, validator := range validators {
+		if !vlt.IsJailed(validator) {
+			numActive++
+		}
+	}
+
+	jailed := []common.Address{}
+	for _, validator := range validators {
+		record := vlt.Get(validator)
+		if record != nil && record.Jailed {
+			continue
+		}
+		missed := !signers[validator]
+		if record == nil {
+			if !missed {
+				continue
+			}
+			record = newValidatorLiveness(validator)
+			vlt.SortedRecords = append(vlt.SortedRecords, record)
+		}
+		record.record(height, missed)
+
+		if record.NumMissedBlocks > MaxMissedBlocksInWindow && numActive > 1 {
+			record.Jailed = true
+			record.JailedHeight = height
+			record.resetWindow()
+			numActive--
+			jailed = append(jailed, validator)
+			logger.Infof("Validator jailed: %v, height = %v", validator, height)
+		}
+	}
+
+	vlt.prune()
+	return jailed
+}
+
+// Unjail releases the jailed validator, once the JailCooldownPeriod since it was jailed has passed. It starts over
+// with an empty window.
+func (vlt *ValidatorLivenessTracker) Unjail(validator common.Address, currentHeight uint64) error {
+	record := vlt.Get(validator)
+	if record == nil || !record.Jailed {
+		return fmt.Errorf("Validator %v is not jailed", validator)
+	}
+	if currentHeight < record.JailedHeight+JailCooldownPeriod {
+		return fmt.Errorf("Validator %v can not be unjailed until height %v", validator, record.JailedHeight+JailCooldownPeriod)
+	}
+
+	record.Jailed = false
+	record.JailedHeight = 0
+	record.resetWindow()
+	vlt.prune()
+	return nil
+}
+
+// ReplaceValidator moves the liveness record of the validator to the new validator address, e.g. when the validator
+// rotates its signing key, so the blocks it missed still count
+func (vlt *ValidatorLivenessTracker) ReplaceValidator(validator common.Address, newValidator common.Address) {
+	record := vlt.Get(validator)
+	if record == nil {
+		return
+	}
+	record.Validator = newValidator
+	vlt.prune()
+}
+
+// ExcludeJailed returns a copy of the pool without the jailed stake holders, the validators are selected out of it
+func (vlt *ValidatorLivenessTracker) ExcludeJailed(vcp *ValidatorCandidatePool) *ValidatorCandidatePool {
+	if vcp == nil {
+		return nil
+	}
+	ret := &ValidatorCandidatePool{SortedCandidates: []*StakeHolder{}}
+	for _, candidate := range vcp.SortedCandidates {
+		if !vlt.IsJailed(candidate.Holder) {
+			ret.SortedCandidates = append(ret.SortedCandidates, candidate)
+		}
+	}
+	return ret
+}
+
+// prune drops the records of the validators that are neither jailed nor missed any block within the window,
+// and keeps the rest sorted
+func (vlt *ValidatorLivenessTracker) prune() {
+	records := []*ValidatorLiveness{}
+	for _, record := range vlt.SortedRecords {
+		if record.Jailed || record.NumMissedBlocks > 0 {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return bytes.Compare(records[i].Validator.Bytes(), records[j].Validator.Bytes()) < 0
+	})
+	vlt.SortedRecords = records
+}
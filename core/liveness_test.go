@@ -0,0 +1,115 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+)
+
+func TestValidatorLivenessTracker(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	val1 := common.HexToAddress("0x111")
+	val2 := common.HexToAddress("0x222")
+	val3 := common.HexToAddress("0x333")
+	validators := []common.Address{val1, val2, val3}
+	allSigned := map[common.Address]bool{val1: true, val2: true, val3: true}
+	val3Offline := map[common.Address]bool{val1: true, val2: true}
+
+	// The validators signing every block have no record
+	vlt := &ValidatorLivenessTracker{}
+	height := uint64(1000)
+	for ; height < 1100; height++ {
+		assert.Empty(vlt.RecordBlock(height, validators, allSigned))
+	}
+	assert.Empty(vlt.SortedRecords)
+
+	// The missed blocks slide out of the window
+	for ; height < 1100+MaxMissedBlocksInWindow; height++ {
+		assert.Empty(vlt.RecordBlock(height, validators, val3Offline))
+	}
+	assert.Equal(MaxMissedBlocksInWindow, vlt.Get(val3).NumMissedBlocks)
+	for ; height < 1100+LivenessWindowSize; height++ {
+		assert.Empty(vlt.RecordBlock(height, validators, allSigned))
+	}
+	assert.Equal(MaxMissedBlocksInWindow, vlt.Get(val3).NumMissedBlocks)
+	assert.Empty(vlt.RecordBlock(height, validators, allSigned))
+	assert.Equal(MaxMissedBlocksInWindow-1, vlt.Get(val3).NumMissedBlocks)
+	height++
+
+	// The blocks out of the validator set count as signed
+	height += LivenessWindowSize / 2
+	assert.Empty(vlt.RecordBlock(height, validators, allSigned))
+	assert.Nil(vlt.Get(val3))
+	height++
+
+	// Missing more than MaxMissedBlocksInWindow blocks gets the validator jailed
+	jailHeight := height + MaxMissedBlocksInWindow
+	for ; height < jailHeight; height++ {
+		assert.Empty(vlt.RecordBlock(height, validators, val3Offline))
+	}
+	assert.Equal([]common.Address{val3}, vlt.RecordBlock(jailHeight, validators, val3Offline))
+	height++
+	assert.True(vlt.IsJailed(val3))
+	assert.False(vlt.IsJailed(val1))
+
+	stake := new(big.Int).Set(MinValidatorStakeDeposit)
+	vcp := &ValidatorCandidatePool{}
+	for _, validator := range validators {
+		require.Nil(vcp.DepositStake(validator, validator, stake))
+	}
+	active := vlt.ExcludeJailed(vcp)
+	require.Equal(2, len(active.SortedCandidates))
+	for _, candidate := range active.SortedCandidates {
+		assert.NotEqual(val3, candidate.Holder)
+	}
+	assert.Equal(3, len(vcp.SortedCandidates)) // the stake is intact
+	assert.Nil(vlt.ExcludeJailed(nil))
+
+	// The last active validator is never jailed
+	for i := uint64(0); i <= MaxMissedBlocksInWindow; i++ {
+		vlt.RecordBlock(height, []common.Address{val1, val2}, map[common.Address]bool{val1: true})
+		height++
+	}
+	assert.True(vlt.IsJailed(val2))
+	for i := uint64(0); i <= MaxMissedBlocksInWindow; i++ {
+		assert.Empty(vlt.RecordBlock(height, []common.Address{val1}, map[common.Address]bool{}))
+		height++
+	}
+	assert.False(vlt.IsJailed(val1))
+
+	// Unjailed after the cooldown, with an empty window
+	assert.NotNil(vlt.Unjail(val1, height))
+	assert.NotNil(vlt.Unjail(val3, jailHeight+JailCooldownPeriod-1))
+	require.Nil(vlt.Unjail(val3, jailHeight+JailCooldownPeriod))
+	assert.False(vlt.IsJailed(val3))
+	assert.Nil(vlt.Get(val3))
+
+}
+
+func TestValidatorLivenessTrackerReplaceValidator(t *testing.T) {
+	assert := assert.New(t)
+
+	val1 := common.HexToAddress("0x111")
+	val2 := common.HexToAddress("0x222")
+	val3 := common.HexToAddress("0x333")
+	validators := []common.Address{val1, val2}
+
+	// The record follows the validator to its new key, so the blocks it missed still count
+	vlt := &ValidatorLivenessTracker{}
+	for height := uint64(1000); height < 1003; height++ {
+		vlt.RecordBlock(height, validators, map[common.Address]bool{val1: true})
+	}
+	vlt.ReplaceValidator(val2, val3)
+	assert.Nil(vlt.Get(val2))
+	assert.Equal(uint64(3), vlt.Get(val3).NumMissedBlocks)
+
+	// Nothing to move without a record
+	vlt.ReplaceValidator(val1, val2)
+	assert.Nil(vlt.Get(val2))
+	assert.Equal(1, len(vlt.SortedRecords))
+}
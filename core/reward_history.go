@@ -0,0 +1,15 @@
+package core
+
+//
+// ------- RewardHistory ------- //
+//
+
+// DefaultRewardHistoryRetention is the default of RewardHistoryRetention, approximately two weeks of epochs with
+// 6 second block time
+const DefaultRewardHistoryRetention uint64 = 201600
+
+// RewardHistoryRetention is the number of the latest epochs whose rewards are kept epoch by epoch in the state,
+// the rewards of the earlier epochs are folded into a running total for each recipient. Zero keeps all the epochs.
+// The reward history is part of the state, so like the parameter schedules, the retention is part of the chain
+// definition and has to be the same on all the nodes.
+var RewardHistoryRetention = DefaultRewardHistoryRetention
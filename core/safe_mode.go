@@ -0,0 +1,103 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/thetatoken/theta/common/metrics"
+)
+
+//
+// SafeMode is the operator-triggered mode for suspected consensus incidents. While in safe mode,
+// the node serves queries from the last finalized state only, keeps the submitted transactions
+// without relaying them, and does not propose blocks. A nil *SafeMode is never in safe mode.
+//
+type SafeMode struct {
+	mu *sync.RWMutex
+
+	enabled bool
+	reason  string
+	since   time.Time
+
+	integrityCheck func() error // re-run before leaving the safe mode
+	gauge          metrics.Gauge
+}
+
+// SafeModeStatus describes the current safe mode state
+type SafeModeStatus struct {
+	Enabled bool
+	Reason  string
+	Since   time.Time
+}
+
+// NewSafeMode creates an instance of SafeMode. The integrityCheck function, if not nil,
+// must pass for the node to leave the safe mode.
+func NewSafeMode(integrityCheck func() error) *SafeMode {
+	return &SafeMode{
+		mu:             &sync.RWMutex{},
+		integrityCheck: integrityCheck,
+		gauge:          metrics.GetOrRegisterGauge("consensus/safemode", nil),
+	}
+}
+
+// Enter puts the node into safe mode. Entering again only updates the reason.
+func (sm *SafeMode) Enter(reason string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if !sm.enabled {
+		sm.since = time.Now()
+	}
+	sm.enabled = true
+	sm.reason = reason
+	sm.gauge.Update(1)
+}
+
+// Exit re-runs the integrity checks, and resumes the normal behavior only if they pass.
+func (sm *SafeMode) Exit() error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if !sm.enabled {
+		return nil
+	}
+	if sm.integrityCheck != nil {
+		if err := sm.integrityCheck(); err != nil {
+			return fmt.Errorf("Integrity check failed, staying in safe mode: %v", err)
+		}
+	}
+	sm.enabled = false
+	sm.reason = ""
+	sm.since = time.Time{}
+	sm.gauge.Update(0)
+	return nil
+}
+
+// Enabled indicates whether the node is in safe mode
+func (sm *SafeMode) Enabled() bool {
+	if sm == nil {
+		return false
+	}
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return sm.enabled
+}
+
+// Status returns the current safe mode state
+func (sm *SafeMode) Status() SafeModeStatus {
+	if sm == nil {
+		return SafeModeStatus{}
+	}
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return SafeModeStatus{
+		Enabled: sm.enabled,
+		Reason:  sm.reason,
+		Since:   sm.since,
+	}
+}
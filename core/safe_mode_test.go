@@ -0,0 +1,71 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSafeModeEnterExit(t *testing.T) {
+	assert := assert.New(t)
+
+	numChecks := 0
+	sm := NewSafeMode(func() error {
+		numChecks++
+		return nil
+	})
+	assert.False(sm.Enabled())
+
+	sm.Enter("deep reorg")
+	assert.True(sm.Enabled())
+	status := sm.Status()
+	assert.True(status.Enabled)
+	assert.Equal("deep reorg", status.Reason)
+	assert.False(status.Since.IsZero())
+
+	// Entering again only updates the reason
+	since := status.Since
+	sm.Enter("state corruption")
+	status = sm.Status()
+	assert.Equal("state corruption", status.Reason)
+	assert.Equal(since, status.Since)
+
+	assert.Nil(sm.Exit())
+	assert.False(sm.Enabled())
+	assert.Equal(SafeModeStatus{}, sm.Status())
+	assert.Equal(1, numChecks)
+
+	// Exiting while not in safe mode does not run the integrity checks
+	assert.Nil(sm.Exit())
+	assert.Equal(1, numChecks)
+}
+
+func TestSafeModeExitIntegrityCheckFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	var checkErr error
+	sm := NewSafeMode(func() error {
+		return checkErr
+	})
+
+	sm.Enter("operator")
+	checkErr = errors.New("state root mismatch")
+	err := sm.Exit()
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "state root mismatch")
+	assert.True(sm.Enabled())
+	assert.Equal("operator", sm.Status().Reason)
+
+	checkErr = nil
+	assert.Nil(sm.Exit())
+	assert.False(sm.Enabled())
+}
+
+func TestNilSafeMode(t *testing.T) {
+	assert := assert.New(t)
+
+	var sm *SafeMode
+	assert.False(sm.Enabled())
+	assert.Equal(SafeModeStatus{}, sm.Status())
+}
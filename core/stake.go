@@ -12,10 +12,15 @@ const (
 	StakeForValidator uint8 = 0
 	StakeForGuardian  uint8 = 1
 
-	ReturnLockingPeriod uint64 = 28800      // number of blocks, approximately 2 days with 6 second block time
+	ReturnLockingPeriod uint64 = 28800      // number of blocks, approximately 2 days with 6 second block time, the default of the chain parameter
 	InvalidReturnHeight uint64 = ^uint64(0) // max uint64
 )
 
+// DepositNonceWindow is the number of blocks the idempotency nonce of a stake deposit stays in the recent-nonce
+// set of its source, approximately a day with 6 second block time. A retry of the deposit with the same nonce is
+// rejected within the window. The set is part of the state, so the window is part of the chain definition.
+var DepositNonceWindow uint64 = 14400
+
 var (
 	Zero *big.Int
 )
@@ -49,6 +54,12 @@ func (s *Stake) String() string {
 		s.Source, s.Amount, s.Withdrawn, s.ReturnHeight)
 }
 
+// ReturnedStake is a withdrawn stake returned at its return height, along with the holder it is withdrawn from
+type ReturnedStake struct {
+	*Stake
+	Holder common.Address
+}
+
 type StakeJSON struct {
 	Source       common.Address  `json:"source"`
 	Amount       *common.JSONBig `json:"amount"`
@@ -114,6 +125,9 @@ func (sh *StakeHolder) TotalStake() *big.Int {
 	return totalAmount
 }
 
+// depositStake adds the amount to the stake of the source, a source holds a single stake record per holder,
+// which a top-up increases rather than adding another record. Starting from common.HeightEnableUnbondingQueue,
+// depositActiveStake is used instead.
 func (sh *StakeHolder) depositStake(source common.Address, amount *big.Int) error {
 	if amount.Cmp(Zero) < 0 {
 		return fmt.Errorf("Invalid stake: %v", amount)
@@ -136,39 +150,148 @@ func (sh *StakeHolder) depositStake(source common.Address, amount *big.Int) erro
 	return nil
 }
 
-func (sh *StakeHolder) withdrawStake(source common.Address, currentHeight uint64) error {
+// activeStake returns the stake of the source that is not withdrawn, or nil if there is none
+func (sh *StakeHolder) activeStake(source common.Address) *Stake {
+	for _, stake := range sh.Stakes {
+		if stake.Source == source && !stake.Withdrawn {
+			return stake
+		}
+	}
+	return nil
+}
+
+// latestWithdrawnStake returns the withdrawn stake of the source with the highest return height, i.e. the
+// latest withdrawal, or nil if there is none
+func (sh *StakeHolder) latestWithdrawnStake(source common.Address) *Stake {
+	var latest *Stake
+	for _, stake := range sh.Stakes {
+		if stake.Source == source && stake.Withdrawn && (latest == nil || stake.ReturnHeight > latest.ReturnHeight) {
+			latest = stake
+		}
+	}
+	return latest
+}
+
+func (sh *StakeHolder) hasStakeFrom(source common.Address) bool {
 	for _, stake := range sh.Stakes {
 		if stake.Source == source {
-			if stake.Withdrawn {
-				return fmt.Errorf("Already withdrawn, cannot withdraw again for source: %v", source)
-			}
-			stake.Withdrawn = true
-			stake.ReturnHeight = currentHeight + ReturnLockingPeriod
-			return nil
+			return true
+		}
+	}
+	return false
+}
+
+// depositActiveStake adds the amount to the active stake of the source, or adds a new record if all the
+// stakes of the source are withdrawn. The withdrawn stakes stay queued for return at their own heights.
+func (sh *StakeHolder) depositActiveStake(source common.Address, amount *big.Int) error {
+	if amount.Cmp(Zero) < 0 {
+		return fmt.Errorf("Invalid stake: %v", amount)
+	}
+
+	if stake := sh.activeStake(source); stake != nil {
+		stake.Amount = new(big.Int).Add(stake.Amount, amount)
+		return nil
+	}
+	sh.Stakes = append(sh.Stakes, newStake(source, amount))
+
+	return nil
+}
+
+// withdrawStake withdraws the active stake of the source, which is queued for return at its own height
+// alongside the earlier withdrawals not returned yet
+func (sh *StakeHolder) withdrawStake(source common.Address, currentHeight uint64) error {
+	return sh.withdrawStakeUntil(source, currentHeight+ReturnLockingPeriod)
+}
+
+// withdrawStakeUntil withdraws the active stake of the source, to be returned at the given height
+func (sh *StakeHolder) withdrawStakeUntil(source common.Address, returnHeight uint64) error {
+	stake := sh.activeStake(source)
+	if stake == nil {
+		if sh.hasStakeFrom(source) {
+			return fmt.Errorf("Already withdrawn, cannot withdraw again for source: %v", source)
 		}
+		return fmt.Errorf("Cannot withdraw, no matched stake source address found: %v", source)
+	}
+	stake.Withdrawn = true
+	stake.ReturnHeight = returnHeight
+	return nil
+}
+
+// cancelWithdrawal turns the latest withdrawn stake of the source back into an active stake, as long as it is
+// not due for return at the current height. It is merged into the active stake of the source if there is one.
+func (sh *StakeHolder) cancelWithdrawal(source common.Address, currentHeight uint64) error {
+	stake := sh.latestWithdrawnStake(source)
+	if stake == nil {
+		if sh.hasStakeFrom(source) {
+			return fmt.Errorf("Cannot cancel, stake not withdrawn for source: %v", source)
+		}
+		return fmt.Errorf("Cannot cancel, no matched stake source address found: %v", source)
+	}
+	if stake.ReturnHeight <= currentHeight {
+		return fmt.Errorf("Cannot cancel, current height: %v, return height: %v",
+			currentHeight, stake.ReturnHeight)
 	}
 
-	return fmt.Errorf("Cannot withdraw, no matched stake source address found: %v", source)
+	if active := sh.activeStake(source); active != nil {
+		active.Amount = new(big.Int).Add(active.Amount, stake.Amount)
+		sh.removeStake(stake)
+		return nil
+	}
+	stake.Withdrawn = false
+	stake.ReturnHeight = InvalidReturnHeight
+	return nil
 }
 
+// returnStake removes and returns the first withdrawn stake of the source that is due at the current height
 func (sh *StakeHolder) returnStake(source common.Address, currentHeight uint64) (*Stake, error) {
-	for idx, stake := range sh.Stakes {
-		if stake.Source == source {
-			if !stake.Withdrawn {
-				return nil, fmt.Errorf("Cannot return, stake not withdrawn yet")
-			}
-			if stake.ReturnHeight > currentHeight {
-				return nil, fmt.Errorf("Cannot return, current height: %v, return height: %v",
-					currentHeight, stake.ReturnHeight)
-			}
-			sh.Stakes = append(sh.Stakes[:idx], sh.Stakes[idx+1:]...)
+	var pending *Stake
+	for _, stake := range sh.Stakes {
+		if stake.Source != source || !stake.Withdrawn {
+			continue
+		}
+		if stake.ReturnHeight <= currentHeight {
+			sh.removeStake(stake)
 			return stake, nil
 		}
+		pending = stake
 	}
 
+	if pending != nil {
+		return nil, fmt.Errorf("Cannot return, current height: %v, return height: %v",
+			currentHeight, pending.ReturnHeight)
+	}
+	if sh.hasStakeFrom(source) {
+		return nil, fmt.Errorf("Cannot return, stake not withdrawn yet")
+	}
 	return nil, fmt.Errorf("Cannot return, no matched stake source address found: %v", source)
 }
 
+func (sh *StakeHolder) removeStake(target *Stake) {
+	for idx, stake := range sh.Stakes {
+		if stake == target {
+			sh.Stakes = append(sh.Stakes[:idx], sh.Stakes[idx+1:]...)
+			return
+		}
+	}
+}
+
+// slashStakes burns the given percentage of each stake, including the withdrawn stakes not returned yet, and
+// withdraws the rest of the stakes to be returned at the given height. It returns the burned amount.
+func (sh *StakeHolder) slashStakes(percentage uint64, returnHeight uint64) *big.Int {
+	slashedAmount := new(big.Int)
+	for _, stake := range sh.Stakes {
+		burned := new(big.Int).Mul(stake.Amount, new(big.Int).SetUint64(percentage))
+		burned.Div(burned, big.NewInt(100))
+		stake.Amount = new(big.Int).Sub(stake.Amount, burned)
+		slashedAmount.Add(slashedAmount, burned)
+		if !stake.Withdrawn {
+			stake.Withdrawn = true
+			stake.ReturnHeight = returnHeight
+		}
+	}
+	return slashedAmount
+}
+
 func (sh *StakeHolder) String() string {
 	return fmt.Sprintf("{holder: %v, stakes :%v}", sh.Holder, sh.Stakes)
 }
@@ -0,0 +1,34 @@
+package core
+
+import (
+	"math/big"
+)
+
+//
+// ------- StakingParamsSchedule ------- //
+//
+
+// StakingParamsUpdate changes the validator staking parameters from the block at the height on. A nil or zero
+// parameter keeps its current value.
+type StakingParamsUpdate struct {
+	Height                   uint64
+	MinValidatorStakeDeposit *big.Int
+	ReturnLockingPeriod      uint64
+}
+
+// StakingParamsSchedule lists the scheduled changes of the staking parameters, ordered by height. The minimum
+// validator stake deposit and the return locking period are chain parameters in the state, set to
+// MinValidatorStakeDeposit and ReturnLockingPeriod at genesis, and the changes are written to the state at the end
+// of the block preceding their heights, so the transactions are validated against the parameters in effect at
+// their heights. Only the heights at or above common.HeightEnableStakingParams are applied.
+var StakingParamsSchedule = []StakingParamsUpdate{}
+
+// GetStakingParamsUpdate returns the staking parameters change scheduled at the height, or nil if there is none
+func GetStakingParamsUpdate(height uint64) *StakingParamsUpdate {
+	for idx := range StakingParamsSchedule {
+		if StakingParamsSchedule[idx].Height == height {
+			return &StakingParamsSchedule[idx]
+		}
+	}
+	return nil
+}
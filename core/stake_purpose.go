@@ -0,0 +1,150 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/thetatoken/theta/common"
+)
+
+//
+// ------- Stake Purpose ------- //
+//
+
+// StakePurposeInfo describes a stake purpose. A purpose introduced by a fork is valid starting from the
+// activation height of the fork, and the stake transactions carrying it are rejected before that.
+type StakePurposeInfo struct {
+	Purpose          uint8
+	Name             string
+	ActivationHeight uint64
+}
+
+var (
+	stakePurposesLock sync.RWMutex
+	stakePurposes     = make(map[uint8]StakePurposeInfo)
+)
+
+func init() {
+	RegisterStakePurpose(StakeForValidator, "validator", 0)
+	RegisterStakePurpose(StakeForGuardian, "guardian", common.HeightEnableGuardianStaking)
+}
+
+// RegisterStakePurpose registers a stake purpose that is valid starting from the given height. It panics
+// if the purpose or the name is already registered, or if the name is a number.
+func RegisterStakePurpose(purpose uint8, name string, activationHeight uint64) {
+	stakePurposesLock.Lock()
+	defer stakePurposesLock.Unlock()
+
+	name = strings.ToLower(name)
+	if _, ok := stakePurposes[purpose]; ok {
+		panic(fmt.Sprintf("Stake purpose %v is already registered", purpose))
+	}
+	if _, err := strconv.ParseUint(name, 10, 64); err == nil || name == "" {
+		panic(fmt.Sprintf("Invalid stake purpose name: %v", name))
+	}
+	for _, info := range stakePurposes {
+		if info.Name == name {
+			panic(fmt.Sprintf("Stake purpose name %v is already registered", name))
+		}
+	}
+	stakePurposes[purpose] = StakePurposeInfo{
+		Purpose:          purpose,
+		Name:             name,
+		ActivationHeight: activationHeight,
+	}
+}
+
+// UnregisterStakePurpose removes a stake purpose from the registry, for testing only
+func UnregisterStakePurpose(purpose uint8) {
+	stakePurposesLock.Lock()
+	defer stakePurposesLock.Unlock()
+
+	delete(stakePurposes, purpose)
+}
+
+// GetStakePurpose returns the registered info of the given purpose
+func GetStakePurpose(purpose uint8) (StakePurposeInfo, bool) {
+	stakePurposesLock.RLock()
+	defer stakePurposesLock.RUnlock()
+
+	info, ok := stakePurposes[purpose]
+	return info, ok
+}
+
+// GetStakePurposes returns the registered purposes, ordered by value
+func GetStakePurposes() []StakePurposeInfo {
+	stakePurposesLock.RLock()
+	defer stakePurposesLock.RUnlock()
+
+	purposes := make([]StakePurposeInfo, 0, len(stakePurposes))
+	for _, info := range stakePurposes {
+		purposes = append(purposes, info)
+	}
+	sort.Slice(purposes, func(i, j int) bool { return purposes[i].Purpose < purposes[j].Purpose })
+	return purposes
+}
+
+// IsKnownStakePurpose returns whether the purpose is registered, regardless of its activation height
+func IsKnownStakePurpose(purpose uint8) bool {
+	_, ok := GetStakePurpose(purpose)
+	return ok
+}
+
+// IsStakePurposeActive returns whether the purpose is valid for the block at the given height
+func IsStakePurposeActive(purpose uint8, blockHeight uint64) bool {
+	info, ok := GetStakePurpose(purpose)
+	return ok && blockHeight >= info.ActivationHeight
+}
+
+// StakePurposeName returns the name of the purpose, or its value for an unknown purpose
+func StakePurposeName(purpose uint8) string {
+	if info, ok := GetStakePurpose(purpose); ok {
+		return info.Name
+	}
+	return strconv.FormatUint(uint64(purpose), 10)
+}
+
+// ParseStakePurpose parses a purpose given either by its name, case insensitive, or by its value. The
+// value of an unknown purpose is accepted, it is up to the validation to reject it.
+func ParseStakePurpose(s string) (uint8, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if value, err := strconv.ParseUint(s, 10, 8); err == nil {
+		return uint8(value), nil
+	}
+	for _, info := range GetStakePurposes() {
+		if info.Name == s {
+			return info.Purpose, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown stake purpose: %v", s)
+}
+
+// StakePurposeJSON is the JSON form of a stake purpose, i.e. its name. Both the name and the value
+// are accepted when decoding.
+type StakePurposeJSON uint8
+
+func (p StakePurposeJSON) MarshalJSON() ([]byte, error) {
+	return json.Marshal(StakePurposeName(uint8(p)))
+}
+
+func (p *StakePurposeJSON) UnmarshalJSON(data []byte) error {
+	var value uint8
+	if err := json.Unmarshal(data, &value); err == nil {
+		*p = StakePurposeJSON(value)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	purpose, err := ParseStakePurpose(s)
+	if err != nil {
+		return err
+	}
+	*p = StakePurposeJSON(purpose)
+	return nil
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+)
+
+func TestStakePurposeRegistry(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("validator", StakePurposeName(StakeForValidator))
+	assert.Equal("guardian", StakePurposeName(StakeForGuardian))
+	assert.Equal("7", StakePurposeName(7))
+	assert.True(IsStakePurposeActive(StakeForValidator, 0))
+	assert.False(IsKnownStakePurpose(7))
+
+	// A purpose introduced by a fork at height 1000
+	RegisterStakePurpose(7, "Edge", 1000)
+	defer UnregisterStakePurpose(7)
+	assert.True(IsKnownStakePurpose(7))
+	assert.False(IsStakePurposeActive(7, 999))
+	assert.True(IsStakePurposeActive(7, 1000))
+	assert.Equal("edge", StakePurposeName(7))
+	assert.Equal([]StakePurposeInfo{
+		{StakeForValidator, "validator", 0}, {StakeForGuardian, "guardian", common.HeightEnableGuardianStaking}, {7, "edge", 1000},
+	}, GetStakePurposes())
+
+	// Neither the value nor the name can be registered twice, and a name can't be a number
+	assert.Panics(func() { RegisterStakePurpose(7, "other", 0) })
+	assert.Panics(func() { RegisterStakePurpose(8, "EDGE", 0) })
+	assert.Panics(func() { RegisterStakePurpose(8, "9", 0) })
+	assert.False(IsKnownStakePurpose(8))
+}
+
+func TestParseStakePurpose(t *testing.T) {
+	assert := assert.New(t)
+
+	for s, expected := range map[string]uint8{"validator": StakeForValidator, " Guardian": StakeForGuardian, "0": 0, "255": 255} {
+		purpose, err := ParseStakePurpose(s)
+		assert.Nil(err, s)
+		assert.Equal(expected, purpose, s)
+	}
+	for _, s := range []string{"", "edge", "256", "-1"} {
+		_, err := ParseStakePurpose(s)
+		assert.NotNil(err, s)
+	}
+}
+
+func TestStakePurposeJSON(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	raw, err := json.Marshal([]StakePurposeJSON{StakePurposeJSON(StakeForGuardian), 7})
+	require.Nil(err)
+	assert.Equal(`["guardian","7"]`, string(raw))
+
+	var decoded []StakePurposeJSON
+	require.Nil(json.Unmarshal(raw, &decoded))
+	assert.Equal([]StakePurposeJSON{StakePurposeJSON(StakeForGuardian), 7}, decoded)
+	require.Nil(json.Unmarshal([]byte(`[1,"VALIDATOR"]`), &decoded))
+	assert.Equal([]StakePurposeJSON{StakePurposeJSON(StakeForGuardian), StakePurposeJSON(StakeForValidator)}, decoded)
+	assert.NotNil(json.Unmarshal([]byte(`["edge"]`), &decoded))
+	assert.NotNil(json.Unmarshal([]byte(`[256]`), &decoded))
+}
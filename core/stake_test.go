@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/thetatoken/theta/common"
 )
 
@@ -146,3 +147,135 @@ func TestStakeReturn(t *testing.T) {
 	assert.Nil(returnedStake) // sourceAddr3 never deposited any stake, so cannot return
 	assert.NotNil(err)
 }
+
+func TestStakeSlash(t *testing.T) {
+	assert := assert.New(t)
+
+	sourceAddr1 := common.HexToAddress("0x111")
+	sourceAddr2 := common.HexToAddress("0x222")
+	holderAddr := common.HexToAddress("0xabc")
+	currentHeight := uint64(10000)
+
+	stakeHolder := newStakeHolder(holderAddr, []*Stake{newStake(sourceAddr1, new(big.Int).SetUint64(1000))})
+	assert.Nil(stakeHolder.depositStake(sourceAddr2, new(big.Int).SetUint64(8005)))
+	assert.Nil(stakeHolder.withdrawStake(sourceAddr1, currentHeight-100))
+
+	// The withdrawn stakes are slashed too, the remaining stakes are withdrawn
+	slashed := stakeHolder.slashStakes(10, currentHeight+ReturnLockingPeriod)
+	assert.True(slashed.Cmp(new(big.Int).SetUint64(900)) == 0) // 100 + 800, rounded down
+	assert.True(stakeHolder.Stakes[0].Amount.Cmp(new(big.Int).SetUint64(900)) == 0)
+	assert.Equal(currentHeight-100+ReturnLockingPeriod, stakeHolder.Stakes[0].ReturnHeight)
+	assert.True(stakeHolder.Stakes[1].Amount.Cmp(new(big.Int).SetUint64(7205)) == 0)
+	assert.True(stakeHolder.Stakes[1].Withdrawn)
+	assert.Equal(currentHeight+ReturnLockingPeriod, stakeHolder.Stakes[1].ReturnHeight)
+	assert.True(stakeHolder.TotalStake().Cmp(big.NewInt(0)) == 0) // no longer selected as a validator
+
+	vcp := &ValidatorCandidatePool{SortedCandidates: []*StakeHolder{stakeHolder}}
+	_, err := vcp.SlashStakeHolder(holderAddr, 101, currentHeight)
+	assert.NotNil(err)
+	_, err = vcp.SlashStakeHolder(sourceAddr1, 10, currentHeight)
+	assert.NotNil(err)
+	slashed, err = vcp.SlashStakeHolder(holderAddr, 100, currentHeight)
+	assert.Nil(err)
+	assert.True(slashed.Cmp(new(big.Int).SetUint64(8105)) == 0)
+
+	// The stakes withdrawn by the slash return after the given locking period
+	stakeHolder = newStakeHolder(holderAddr, []*Stake{newStake(sourceAddr1, new(big.Int).SetUint64(1000))})
+	vcp = &ValidatorCandidatePool{SortedCandidates: []*StakeHolder{stakeHolder}}
+	_, err = vcp.SlashStakeHolderWithLockingPeriod(holderAddr, 10, currentHeight, 100)
+	assert.Nil(err)
+	assert.Equal(currentHeight+100, stakeHolder.Stakes[0].ReturnHeight)
+}
+
+func TestStakeCancelWithdrawal(t *testing.T) {
+	assert := assert.New(t)
+
+	sourceAddr1 := common.HexToAddress("0x111")
+	sourceAddr2 := common.HexToAddress("0x222")
+	holderAddr := common.HexToAddress("0xabc")
+	withdrawHeight := uint64(10000)
+	returnHeight := withdrawHeight + ReturnLockingPeriod
+
+	stakeHolder := newStakeHolder(holderAddr, []*Stake{newStake(sourceAddr1, new(big.Int).SetUint64(1000))})
+	assert.Nil(stakeHolder.depositStake(sourceAddr2, new(big.Int).SetUint64(8000)))
+	assert.NotNil(stakeHolder.cancelWithdrawal(sourceAddr1, withdrawHeight)) // not withdrawn yet
+
+	assert.Nil(stakeHolder.withdrawStake(sourceAddr1, withdrawHeight))
+	assert.NotNil(stakeHolder.cancelWithdrawal(sourceAddr1, returnHeight)) // due for return
+	assert.Nil(stakeHolder.cancelWithdrawal(sourceAddr1, returnHeight-1))
+	assert.True(stakeHolder.TotalStake().Cmp(new(big.Int).SetUint64(9000)) == 0)
+	assert.False(stakeHolder.Stakes[0].Withdrawn)
+	assert.Equal(InvalidReturnHeight, stakeHolder.Stakes[0].ReturnHeight)
+
+	returnedStake, err := stakeHolder.returnStake(sourceAddr1, returnHeight) // no longer returned
+	assert.Nil(returnedStake)
+	assert.NotNil(err)
+	assert.NotNil(stakeHolder.cancelWithdrawal(common.HexToAddress("0x333"), withdrawHeight))
+
+	// The stake can be withdrawn again, the locking period starts over
+	assert.Nil(stakeHolder.withdrawStake(sourceAddr1, returnHeight))
+	assert.Equal(returnHeight+ReturnLockingPeriod, stakeHolder.Stakes[0].ReturnHeight)
+}
+
+func TestStakeUnbondingQueue(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	sourceAddr := common.HexToAddress("0x111")
+	holderAddr := common.HexToAddress("0xabc")
+	firstHeight, secondHeight := uint64(10000), uint64(10500)
+
+	// A deposit while the stake is withdrawn adds another record, each withdrawal is queued with its own height
+	stakeHolder := newStakeHolder(holderAddr, []*Stake{newStake(sourceAddr, new(big.Int).SetUint64(1000))})
+	require.Nil(stakeHolder.withdrawStake(sourceAddr, firstHeight))
+	assert.NotNil(stakeHolder.depositStake(sourceAddr, new(big.Int).SetUint64(2000)))
+	require.Nil(stakeHolder.depositActiveStake(sourceAddr, new(big.Int).SetUint64(2000)))
+	require.Nil(stakeHolder.depositActiveStake(sourceAddr, new(big.Int).SetUint64(500)))
+	require.Equal(2, len(stakeHolder.Stakes))
+	assert.True(stakeHolder.TotalStake().Cmp(new(big.Int).SetUint64(2500)) == 0)
+	require.Nil(stakeHolder.withdrawStake(sourceAddr, secondHeight))
+	assert.NotNil(stakeHolder.withdrawStake(sourceAddr, secondHeight)) // nothing active left
+
+	// The withdrawals are returned in the order of their return heights
+	_, err := stakeHolder.returnStake(sourceAddr, firstHeight+ReturnLockingPeriod-1)
+	assert.NotNil(err)
+	returnedStake, err := stakeHolder.returnStake(sourceAddr, firstHeight+ReturnLockingPeriod)
+	require.Nil(err)
+	assert.True(returnedStake.Amount.Cmp(new(big.Int).SetUint64(1000)) == 0)
+	_, err = stakeHolder.returnStake(sourceAddr, firstHeight+ReturnLockingPeriod)
+	assert.NotNil(err)
+	returnedStake, err = stakeHolder.returnStake(sourceAddr, secondHeight+ReturnLockingPeriod)
+	require.Nil(err)
+	assert.True(returnedStake.Amount.Cmp(new(big.Int).SetUint64(2500)) == 0)
+	assert.Empty(stakeHolder.Stakes)
+}
+
+func TestStakeCancelQueuedWithdrawal(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	sourceAddr := common.HexToAddress("0x111")
+	holderAddr := common.HexToAddress("0xabc")
+	firstHeight, secondHeight := uint64(10000), uint64(10500)
+
+	stakeHolder := newStakeHolder(holderAddr, []*Stake{newStake(sourceAddr, new(big.Int).SetUint64(1000))})
+	require.Nil(stakeHolder.withdrawStake(sourceAddr, firstHeight))
+	require.Nil(stakeHolder.depositActiveStake(sourceAddr, new(big.Int).SetUint64(2000)))
+	require.Nil(stakeHolder.withdrawStake(sourceAddr, secondHeight))
+	require.Nil(stakeHolder.depositActiveStake(sourceAddr, new(big.Int).SetUint64(4000)))
+	require.Equal(3, len(stakeHolder.Stakes))
+
+	// The latest withdrawal is cancelled and merged into the active stake, the earlier one stays queued
+	require.Nil(stakeHolder.cancelWithdrawal(sourceAddr, secondHeight))
+	require.Equal(2, len(stakeHolder.Stakes))
+	assert.True(stakeHolder.TotalStake().Cmp(new(big.Int).SetUint64(6000)) == 0)
+	queued := stakeHolder.latestWithdrawnStake(sourceAddr)
+	require.NotNil(queued)
+	assert.Equal(firstHeight+ReturnLockingPeriod, queued.ReturnHeight)
+
+	// Without an active stake, the cancelled withdrawal becomes the active stake
+	require.Nil(stakeHolder.withdrawStake(sourceAddr, secondHeight))
+	require.Nil(stakeHolder.cancelWithdrawal(sourceAddr, secondHeight))
+	require.Equal(2, len(stakeHolder.Stakes))
+	assert.True(stakeHolder.activeStake(sourceAddr).Amount.Cmp(new(big.Int).SetUint64(6000)) == 0)
+}
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/thetatoken/theta/common"
+)
+
+// TxInclusionDemandWindowSize is the number of the previous blocks whose fullness measures the demand for the
+// block space
+const TxInclusionDemandWindowSize uint64 = 10
+
+//
+// ------- TxInclusionParams ------- //
+//
+
+// TxInclusionParams parameterize the withholding of the reward of the proposers that leave their blocks underfilled
+// while there is demand for the block space. A block is underfilled if its regular txs take fewer than
+// MinFullnessPercent percent of the regular tx slots, and there is demand if the regular txs of the previous
+// TxInclusionDemandWindowSize blocks take more than DemandPercent percent of their slots. WithholdPercent percent of
+// the reward of the proposer is withheld at the next checkpoint for each underfilled block, up to all of it. The
+// zero WithholdPercent disables the withholding.
+type TxInclusionParams struct {
+	MinFullnessPercent uint64
+	DemandPercent      uint64
+	WithholdPercent    uint64
+}
+
+// Enabled returns whether the rewards are withheld for the underfilled blocks
+func (tip *TxInclusionParams) Enabled() bool {
+	return tip != nil && tip.WithholdPercent > 0
+}
+
+func (tip *TxInclusionParams) String() string {
+	return fmt.Sprintf("{min fullness: %v%%, demand: %v%%, withhold: %v%%}",
+		tip.MinFullnessPercent, tip.DemandPercent, tip.WithholdPercent)
+}
+
+// TxInclusionParamsUpdate changes the tx inclusion parameters from the block at the height on
+type TxInclusionParamsUpdate struct {
+	Height uint64
+	Params TxInclusionParams
+}
+
+// TxInclusionParamsSchedule lists the scheduled changes of the tx inclusion parameters, ordered by height. The
+// parameters are in the state, unset (i.e. disabled) at genesis, and the changes are written to the state at the
+// end of the block preceding their heights. Only the heights at or above common.HeightEnableRewardWithholding are
+// applied.
+var TxInclusionParamsSchedule = []TxInclusionParamsUpdate{}
+
+// GetTxInclusionParamsUpdate returns the tx inclusion parameters change scheduled at the height, or nil if there
+// is none
+func GetTxInclusionParamsUpdate(height uint64) *TxInclusionParamsUpdate {
+	for idx := range TxInclusionParamsSchedule {
+		if TxInclusionParamsSchedule[idx].Height == height {
+			return &TxInclusionParamsSchedule[idx]
+		}
+	}
+	return nil
+}
+
+//
+// ------- TxInclusionTracker ------- //
+//
+
+// BlockFullness records the number of regular txs in a block, and the number of regular tx slots of the block
+type BlockFullness struct {
+	NumRegularTxs    uint64
+	MaxNumRegularTxs uint64
+}
+
+// UnderfilledBlocks counts the underfilled blocks of a proposer since the last checkpoint
+type UnderfilledBlocks struct {
+	Proposer  common.Address
+	NumBlocks uint64
+}
+
+// TxInclusionTracker keeps track of the fullness of the recent blocks, and of the underfilled blocks of the
+// proposers since the last checkpoint. Everything is recorded in the state at the end of the blocks, so the
+// reward withheld is derived from the chain state only.
+type TxInclusionTracker struct {
+	RecentBlocks      []*BlockFullness     // the last TxInclusionDemandWindowSize blocks, oldest first
+	SortedUnderfilled []*UnderfilledBlocks // sorted by proposer address
+}
+
+// RecordBlock records the fullness of the block of the proposer, and counts it as underfilled if it is, while the
+// previous blocks exceed the demand level. It returns whether the block is counted as underfilled.
+func (tit *TxInclusionTracker) RecordBlock(proposer common.Address, numRegularTxs, maxNumRegularTxs uint64,
+	params *TxInclusionParams) bool {
+	underfilled := params.Enabled() &&
+		numRegularTxs*100 < params.MinFullnessPercent*maxNumRegularTxs &&
+		tit.demandExceeds(params.DemandPercent)
+
+	if underfilled {
+		record := tit.get(proposer)
+		if record == nil {
+			record = &UnderfilledBlocks{Proposer: proposer}
+			tit.SortedUnderfilled = append(tit.SortedUnderfilled, record)
+			sort.Slice(tit.SortedUnderfilled, func(i, j int) bool {
+				return bytes.Compare(tit.SortedUnderfilled[i].Proposer.Bytes(), tit.SortedUnderfilled[j].Proposer.Bytes()) < 0
+			})
+		}
+		record.NumBlocks++
+	}
+
+	tit.RecentBlocks = append(tit.RecentBlocks, &BlockFullness{
+		NumRegularTxs:    numRegularTxs,
+		MaxNumRegularTxs: maxNumRegularTxs,
+	})
+	if uint64(len(tit.RecentBlocks)) > TxInclusionDemandWindowSize {
+		tit.RecentBlocks = tit.RecentBlocks[uint64(len(tit.RecentBlocks))-TxInclusionDemandWindowSize:]
+	}
+	return underfilled
+}
+
+// NumUnderfilledBlocks returns the number of underfilled blocks of the proposer since the last checkpoint
+func (tit *TxInclusionTracker) NumUnderfilledBlocks(proposer common.Address) uint64 {
+	record := tit.get(proposer)
+	if record == nil {
+		return 0
+	}
+	return record.NumBlocks
+}
+
+// WithheldPercent returns the percentage of the reward withheld from the proposer for its underfilled blocks
+func (tit *TxInclusionTracker) WithheldPercent(proposer common.Address, params *TxInclusionParams) uint64 {
+	if !params.Enabled() {
+		return 0
+	}
+	percent := tit.NumUnderfilledBlocks(proposer) * params.WithholdPercent
+	if percent > 100 {
+		return 100
+	}
+	return percent
+}
+
+// ReplaceProposer moves the underfilled blocks of the proposer to the new proposer address, e.g. when the validator
+// rotates its signing key. They add up with the underfilled blocks of the new address, if any.
+func (tit *TxInclusionTracker) ReplaceProposer(proposer common.Address, newProposer common.Address) {
+	record := tit.get(proposer)
+	if record == nil {
+		return
+	}
+	if newRecord := tit.get(newProposer); newRecord != nil {
+		newRecord.NumBlocks += record.NumBlocks
+		record.NumBlocks = 0
+	}
+	record.Proposer = newProposer
+	underfilled := []*UnderfilledBlocks{}
+	for _, record := range tit.SortedUnderfilled {
+		if record.NumBlocks > 0 {
+			underfilled = append(underfilled, record)
+		}
+	}
+	tit.SortedUnderfilled = underfilled
+	sort.Slice(tit.SortedUnderfilled, func(i, j int) bool {
+		return bytes.Compare(tit.SortedUnderfilled[i].Proposer.Bytes(), tit.SortedUnderfilled[j].Proposer.Bytes()) < 0
+	})
+}
+
+// ResetUnderfilledBlocks clears the underfilled blocks once the reward of the checkpoint is granted
+func (tit *TxInclusionTracker) ResetUnderfilledBlocks() {
+	tit.SortedUnderfilled = []*UnderfilledBlocks{}
+}
+
+// demandExceeds returns whether the regular txs of the recent blocks take more than the percentage of their slots.
+// There is no demand without any block recorded.
+func (tit *TxInclusionTracker) demandExceeds(percent uint64) bool {
+	numRegularTxs, maxNumRegularTxs := uint64(0), uint64(0)
+	for _, block := range tit.RecentBlocks {
+		numRegularTxs += block.NumRegularTxs
+		maxNumRegularTxs += block.MaxNumRegularTxs
+	}
+	return maxNumRegularTxs > 0 && numRegularTxs*100 > percent*maxNumRegularTxs
+}
+
+func (tit *TxInclusionTracker) get(proposer common.Address) *UnderfilledBlocks {
+	for _, record := range tit.SortedUnderfilled {
+		if record.Proposer == proposer {
+			return record
+		}
+	}
+	return nil
+}
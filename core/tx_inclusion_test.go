@@ -0,0 +1,94 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thetatoken/theta/common"
+)
+
+func TestTxInclusionTracker(t *testing.T) {
+	assert := assert.New(t)
+
+	proposer1 := common.HexToAddress("0x111")
+	proposer2 := common.HexToAddress("0x222")
+	params := &TxInclusionParams{MinFullnessPercent: 10, DemandPercent: 50, WithholdPercent: 30}
+	maxNumRegularTxs := uint64(1000)
+
+	// There is no demand before any block is recorded
+	tit := &TxInclusionTracker{}
+	assert.False(tit.RecordBlock(proposer1, 0, maxNumRegularTxs, params))
+
+	// The demand at the level does not exceed it
+	tit = &TxInclusionTracker{}
+	for i := uint64(0); i < TxInclusionDemandWindowSize+1; i++ {
+		assert.False(tit.RecordBlock(proposer2, 500, maxNumRegularTxs, params))
+	}
+	assert.Equal(TxInclusionDemandWindowSize, uint64(len(tit.RecentBlocks)))
+	assert.False(tit.RecordBlock(proposer1, 0, maxNumRegularTxs, params))
+	assert.Equal(uint64(0), tit.NumUnderfilledBlocks(proposer1))
+
+	// The demand exceeds the level with one more tx per block
+	tit = &TxInclusionTracker{}
+	for i := uint64(0); i < TxInclusionDemandWindowSize; i++ {
+		tit.RecordBlock(proposer2, 501, maxNumRegularTxs, params)
+	}
+	assert.True(tit.demandExceeds(params.DemandPercent))
+
+	// A block at the min fullness is not underfilled, one below is
+	assert.False(tit.RecordBlock(proposer1, 100, maxNumRegularTxs, params))
+	assert.Equal(uint64(0), tit.NumUnderfilledBlocks(proposer1))
+	tit.RecordBlock(proposer2, 900, maxNumRegularTxs, params) // keep the demand above the level
+	assert.True(tit.RecordBlock(proposer1, 99, maxNumRegularTxs, params))
+	assert.Equal(uint64(1), tit.NumUnderfilledBlocks(proposer1))
+	assert.Equal(uint64(30), tit.WithheldPercent(proposer1, params))
+	assert.Equal(uint64(0), tit.WithheldPercent(proposer2, params))
+
+	// The percentage withheld adds up per underfilled block, up to all of the reward
+	tit.RecordBlock(proposer2, 1000, maxNumRegularTxs, params)
+	assert.True(tit.RecordBlock(proposer1, 0, maxNumRegularTxs, params))
+	assert.Equal(uint64(60), tit.WithheldPercent(proposer1, params))
+	for i := 0; i < 3; i++ {
+		tit.RecordBlock(proposer2, 1000, maxNumRegularTxs, params)
+		tit.RecordBlock(proposer1, 0, maxNumRegularTxs, params)
+	}
+	assert.Equal(uint64(5), tit.NumUnderfilledBlocks(proposer1))
+	assert.Equal(uint64(100), tit.WithheldPercent(proposer1, params))
+
+	// Nothing is withheld when disabled
+	disabled := &TxInclusionParams{MinFullnessPercent: 10, DemandPercent: 50}
+	assert.Equal(uint64(0), tit.WithheldPercent(proposer1, disabled))
+	numUnderfilled := tit.NumUnderfilledBlocks(proposer1)
+	tit.RecordBlock(proposer2, 1000, maxNumRegularTxs, disabled)
+	assert.False(tit.RecordBlock(proposer1, 0, maxNumRegularTxs, disabled))
+	assert.Equal(numUnderfilled, tit.NumUnderfilledBlocks(proposer1))
+
+	// The underfilled blocks are cleared at the checkpoint, the recent blocks are kept
+	tit.ResetUnderfilledBlocks()
+	assert.Equal(uint64(0), tit.NumUnderfilledBlocks(proposer1))
+	assert.Equal(TxInclusionDemandWindowSize, uint64(len(tit.RecentBlocks)))
+}
+
+func TestTxInclusionTrackerReplaceProposer(t *testing.T) {
+	assert := assert.New(t)
+
+	proposer1 := common.HexToAddress("0x111")
+	proposer2 := common.HexToAddress("0x222")
+	proposer3 := common.HexToAddress("0x333")
+	tit := &TxInclusionTracker{SortedUnderfilled: []*UnderfilledBlocks{
+		{Proposer: proposer1, NumBlocks: 2},
+		{Proposer: proposer2, NumBlocks: 1},
+	}}
+
+	// The records move to the new address, and add up with the existing one
+	tit.ReplaceProposer(proposer1, proposer3)
+	assert.Equal(uint64(0), tit.NumUnderfilledBlocks(proposer1))
+	assert.Equal(uint64(2), tit.NumUnderfilledBlocks(proposer3))
+	assert.Equal(proposer2, tit.SortedUnderfilled[0].Proposer)
+	tit.ReplaceProposer(proposer2, proposer3)
+	assert.Equal(1, len(tit.SortedUnderfilled))
+	assert.Equal(uint64(3), tit.NumUnderfilledBlocks(proposer3))
+
+	tit.ReplaceProposer(proposer1, proposer2)
+	assert.Equal(uint64(0), tit.NumUnderfilledBlocks(proposer2))
+}
@@ -0,0 +1,300 @@
+package core
+
+import (
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/metrics"
+)
+
+const (
+	txLatencyMaxPendingTxs   = 10000     // max number of admitted txs waiting for finalization
+	txLatencyMaxPendingAge   = time.Hour // txs not finalized within this period are no longer tracked
+	txLatencyMaxSamples      = 1000      // max number of recent finalized txs kept for the percentiles
+	txLatencyNumFeeLevels    = 4
+	txLatencyHistogramSize   = 1028
+	txLatencyHistogramAlpha  = 0.015
+	metricTxInclusionLatency = "ledger/tx/inclusion_latency"
+	metricTxFinalityLatency  = "ledger/tx/finality_latency"
+)
+
+type trackedTx struct {
+	gasPrice   *big.Int
+	admittedAt time.Time
+
+	included   bool
+	includedAt time.Time
+	blockHash  common.Hash
+	height     uint64
+}
+
+// TxLatencySample holds the latencies of a finalized transaction
+type TxLatencySample struct {
+	GasPrice         *big.Int
+	InclusionLatency time.Duration // from the mempool admission to the block application
+	FinalityLatency  time.Duration // from the mempool admission to the block finalization
+}
+
+// LatencyPercentiles holds the percentiles of a latency distribution
+type LatencyPercentiles struct {
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+}
+
+// TxLatencyStats summarizes the latencies of the recently finalized transactions
+type TxLatencyStats struct {
+	NumTxs           int
+	InclusionLatency LatencyPercentiles
+	FinalityLatency  LatencyPercentiles
+}
+
+// FeeLevelLatencyStats summarizes the latencies of the recently finalized transactions
+// within a range of gas prices
+type FeeLevelLatencyStats struct {
+	MinGasPrice *big.Int
+	MaxGasPrice *big.Int
+	TxLatencyStats
+}
+
+//
+// TxLatencyTracker measures the inclusion and finality latencies of the transactions admitted by
+// the local mempool, based on the local observations only. The retention is bounded both in the
+// number of tracked transactions and the number of kept samples. A nil *TxLatencyTracker records
+// nothing.
+//
+type TxLatencyTracker struct {
+	mu    *sync.Mutex
+	clock common.Clock
+
+	pending    map[common.Hash]*trackedTx
+	samples    []*TxLatencySample // ring buffer of the recently finalized txs
+	nextSample int
+
+	inclusionHistogram metrics.Histogram
+	finalityHistogram  metrics.Histogram
+}
+
+// NewTxLatencyTracker creates an instance of TxLatencyTracker, which takes the timestamps
+// from the given clock
+func NewTxLatencyTracker(clock common.Clock) *TxLatencyTracker {
+	if clock == nil {
+		clock = common.SystemClock
+	}
+	return &TxLatencyTracker{
+		mu:      &sync.Mutex{},
+		clock:   clock,
+		pending: make(map[common.Hash]*trackedTx),
+		samples: []*TxLatencySample{},
+		inclusionHistogram: metrics.GetOrRegisterHistogram(metricTxInclusionLatency, nil,
+			metrics.NewExpDecaySample(txLatencyHistogramSize, txLatencyHistogramAlpha)),
+		finalityHistogram: metrics.GetOrRegisterHistogram(metricTxFinalityLatency, nil,
+			metrics.NewExpDecaySample(txLatencyHistogramSize, txLatencyHistogramAlpha)),
+	}
+}
+
+// RecordAdmission records the time the given transaction is admitted to the mempool
+func (tt *TxLatencyTracker) RecordAdmission(txHash common.Hash, gasPrice *big.Int) {
+	if tt == nil {
+		return
+	}
+
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	if _, ok := tt.pending[txHash]; ok || len(tt.pending) >= txLatencyMaxPendingTxs {
+		return
+	}
+	if gasPrice == nil {
+		gasPrice = big.NewInt(0)
+	}
+	tt.pending[txHash] = &trackedTx{
+		gasPrice:   new(big.Int).Set(gasPrice),
+		admittedAt: tt.clock.Now(),
+	}
+}
+
+// RecordInclusion records the time the given transactions are applied as part of the given block.
+// Only the first inclusion counts, unless the block is later found to be on an abandoned fork.
+func (tt *TxLatencyTracker) RecordInclusion(blockHash common.Hash, height uint64, txHashes []common.Hash) {
+	if tt == nil {
+		return
+	}
+
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	now := tt.clock.Now()
+	for _, txHash := range txHashes {
+		ttx, ok := tt.pending[txHash]
+		if !ok || ttx.included {
+			continue
+		}
+		ttx.included = true
+		ttx.includedAt = now
+		ttx.blockHash = blockHash
+		ttx.height = height
+	}
+}
+
+// LowestIncludedHeight returns the lowest height of the blocks including a tracked transaction,
+// and false if no tracked transaction has been included yet
+func (tt *TxLatencyTracker) LowestIncludedHeight() (uint64, bool) {
+	if tt == nil {
+		return 0, false
+	}
+
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	found := false
+	lowest := uint64(0)
+	for _, ttx := range tt.pending {
+		if ttx.included && (!found || ttx.height < lowest) {
+			lowest = ttx.height
+			found = true
+		}
+	}
+	return lowest, found
+}
+
+// RecordFinalization records the finalization of the blocks up to the given height. The finalizedBlocks
+// set contains the hashes of the finalized blocks, at least those above the LowestIncludedHeight().
+// The transactions included by the other blocks up to the height are considered as not included yet.
+func (tt *TxLatencyTracker) RecordFinalization(height uint64, finalizedBlocks map[common.Hash]bool) {
+	if tt == nil {
+		return
+	}
+
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	now := tt.clock.Now()
+	for txHash, ttx := range tt.pending {
+		if !ttx.included || ttx.height > height {
+			if now.Sub(ttx.admittedAt) > txLatencyMaxPendingAge {
+				delete(tt.pending, txHash)
+			}
+			continue
+		}
+		if !finalizedBlocks[ttx.blockHash] {
+			ttx.included = false // the block is on an abandoned fork
+			continue
+		}
+
+		sample := &TxLatencySample{
+			GasPrice:         ttx.gasPrice,
+			InclusionLatency: ttx.includedAt.Sub(ttx.admittedAt),
+			FinalityLatency:  now.Sub(ttx.admittedAt),
+		}
+		tt.addSample(sample)
+		delete(tt.pending, txHash)
+	}
+}
+
+func (tt *TxLatencyTracker) addSample(sample *TxLatencySample) {
+	tt.inclusionHistogram.Update(int64(sample.InclusionLatency / time.Millisecond))
+	tt.finalityHistogram.Update(int64(sample.FinalityLatency / time.Millisecond))
+
+	if len(tt.samples) < txLatencyMaxSamples {
+		tt.samples = append(tt.samples, sample)
+		return
+	}
+	tt.samples[tt.nextSample] = sample
+	tt.nextSample = (tt.nextSample + 1) % txLatencyMaxSamples
+}
+
+// NumPending returns the number of the tracked transactions that are not finalized yet
+func (tt *TxLatencyTracker) NumPending() int {
+	if tt == nil {
+		return 0
+	}
+
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	return len(tt.pending)
+}
+
+// Samples returns the latencies of the recently finalized transactions
+func (tt *TxLatencyTracker) Samples() []*TxLatencySample {
+	if tt == nil {
+		return []*TxLatencySample{}
+	}
+
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	samples := make([]*TxLatencySample, len(tt.samples))
+	copy(samples, tt.samples)
+	return samples
+}
+
+// Stats returns the latency percentiles of the recently finalized transactions
+func (tt *TxLatencyTracker) Stats() TxLatencyStats {
+	return calculateTxLatencyStats(tt.Samples())
+}
+
+// FeeLevelStats splits the recently finalized transactions into levels of gas prices with
+// similar number of transactions, and returns the latency percentiles of each level, ordered
+// from the lowest gas price to the highest
+func (tt *TxLatencyTracker) FeeLevelStats() []FeeLevelLatencyStats {
+	samples := tt.Samples()
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].GasPrice.Cmp(samples[j].GasPrice) < 0
+	})
+
+	numLevels := txLatencyNumFeeLevels
+	if len(samples) < numLevels {
+		numLevels = len(samples)
+	}
+	levels := []FeeLevelLatencyStats{}
+	for i := 0; i < numLevels; i++ {
+		levelSamples := samples[i*len(samples)/numLevels : (i+1)*len(samples)/numLevels]
+		levels = append(levels, FeeLevelLatencyStats{
+			MinGasPrice:    levelSamples[0].GasPrice,
+			MaxGasPrice:    levelSamples[len(levelSamples)-1].GasPrice,
+			TxLatencyStats: calculateTxLatencyStats(levelSamples),
+		})
+	}
+	return levels
+}
+
+func calculateTxLatencyStats(samples []*TxLatencySample) TxLatencyStats {
+	inclusionLatencies := make([]time.Duration, len(samples))
+	finalityLatencies := make([]time.Duration, len(samples))
+	for i, sample := range samples {
+		inclusionLatencies[i] = sample.InclusionLatency
+		finalityLatencies[i] = sample.FinalityLatency
+	}
+	return TxLatencyStats{
+		NumTxs:           len(samples),
+		InclusionLatency: calculateLatencyPercentiles(inclusionLatencies),
+		FinalityLatency:  calculateLatencyPercentiles(finalityLatencies),
+	}
+}
+
+func calculateLatencyPercentiles(latencies []time.Duration) LatencyPercentiles {
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return LatencyPercentiles{
+		P50: latencyPercentile(latencies, 50),
+		P90: latencyPercentile(latencies, 90),
+		P99: latencyPercentile(latencies, 99),
+	}
+}
+
+// latencyPercentile returns the p-th percentile of the sorted latencies with the nearest-rank
+// method, i.e. the smallest latency such that at least p percent of the latencies are not greater
+func latencyPercentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100 // ceil(p/100 * n)
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
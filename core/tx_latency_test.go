@@ -0,0 +1,155 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+)
+
+func TestTxLatencyTracker(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	clock := common.NewManualClock(time.Unix(1000, 0))
+	tracker := NewTxLatencyTracker(clock)
+
+	txA := common.BytesToHash([]byte("txA"))
+	txB := common.BytesToHash([]byte("txB"))
+	block1 := common.BytesToHash([]byte("block1"))
+	block2 := common.BytesToHash([]byte("block2"))
+	forkBlock2 := common.BytesToHash([]byte("forkBlock2"))
+
+	tracker.RecordAdmission(txA, big.NewInt(100))
+	clock.Advance(time.Second)
+	tracker.RecordAdmission(txB, big.NewInt(200))
+	_, ok := tracker.LowestIncludedHeight()
+	assert.False(ok)
+
+	clock.Advance(2 * time.Second)
+	tracker.RecordInclusion(block1, 1, []common.Hash{txA, common.BytesToHash([]byte("untracked"))})
+	clock.Advance(time.Second)
+	tracker.RecordInclusion(forkBlock2, 2, []common.Hash{txB})
+	height, ok := tracker.LowestIncludedHeight()
+	assert.True(ok)
+	assert.Equal(uint64(1), height)
+
+	// Only the txs included by the finalized blocks up to the height are finalized
+	clock.Advance(time.Second)
+	tracker.RecordFinalization(1, map[common.Hash]bool{block1: true})
+	samples := tracker.Samples()
+	require.Equal(1, len(samples))
+	assert.Equal(big.NewInt(100), samples[0].GasPrice)
+	assert.Equal(3*time.Second, samples[0].InclusionLatency)
+	assert.Equal(5*time.Second, samples[0].FinalityLatency)
+	assert.Equal(1, tracker.NumPending())
+
+	// The inclusion by an abandoned fork is discarded
+	tracker.RecordFinalization(2, map[common.Hash]bool{block2: true})
+	assert.Equal(1, len(tracker.Samples()))
+	_, ok = tracker.LowestIncludedHeight()
+	assert.False(ok)
+
+	clock.Advance(time.Second)
+	tracker.RecordInclusion(block2, 2, []common.Hash{txB})
+	clock.Advance(time.Second)
+	tracker.RecordFinalization(2, map[common.Hash]bool{block2: true})
+	samples = tracker.Samples()
+	require.Equal(2, len(samples))
+	assert.Equal(5*time.Second, samples[1].InclusionLatency)
+	assert.Equal(6*time.Second, samples[1].FinalityLatency)
+	assert.Equal(0, tracker.NumPending())
+
+	stats := tracker.Stats()
+	assert.Equal(2, stats.NumTxs)
+	assert.Equal(3*time.Second, stats.InclusionLatency.P50)
+	assert.Equal(5*time.Second, stats.InclusionLatency.P90)
+	assert.Equal(5*time.Second, stats.FinalityLatency.P50)
+	assert.Equal(6*time.Second, stats.FinalityLatency.P99)
+}
+
+func TestTxLatencyTrackerRetention(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := common.NewManualClock(time.Unix(1000, 0))
+	tracker := NewTxLatencyTracker(clock)
+
+	// The number of the pending txs is bounded
+	for i := 0; i < txLatencyMaxPendingTxs+10; i++ {
+		tracker.RecordAdmission(common.BigToHash(big.NewInt(int64(i))), big.NewInt(1))
+	}
+	assert.Equal(txLatencyMaxPendingTxs, tracker.NumPending())
+
+	// The stale pending txs are no longer tracked
+	clock.Advance(txLatencyMaxPendingAge + time.Second)
+	tracker.RecordFinalization(1, map[common.Hash]bool{})
+	assert.Equal(0, tracker.NumPending())
+
+	// Only the most recent samples are kept
+	block := common.BytesToHash([]byte("block"))
+	for i := 0; i < txLatencyMaxSamples+10; i++ {
+		txHash := common.BigToHash(big.NewInt(int64(i)))
+		tracker.RecordAdmission(txHash, big.NewInt(1))
+		clock.Advance(time.Millisecond)
+		tracker.RecordInclusion(block, uint64(i), []common.Hash{txHash})
+		tracker.RecordFinalization(uint64(i), map[common.Hash]bool{block: true})
+	}
+	assert.Equal(txLatencyMaxSamples, len(tracker.Samples()))
+	assert.Equal(0, tracker.NumPending())
+
+	var nilTracker *TxLatencyTracker
+	nilTracker.RecordAdmission(block, big.NewInt(1))
+	assert.Equal(0, nilTracker.Stats().NumTxs)
+	assert.Equal(0, len(nilTracker.FeeLevelStats()))
+}
+
+func TestTxLatencyPercentiles(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(LatencyPercentiles{}, calculateLatencyPercentiles([]time.Duration{}))
+	assert.Equal(LatencyPercentiles{P50: 7, P90: 7, P99: 7}, calculateLatencyPercentiles([]time.Duration{7}))
+
+	latencies := []time.Duration{}
+	for i := 100; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(LatencyPercentiles{
+		P50: 50 * time.Millisecond,
+		P90: 90 * time.Millisecond,
+		P99: 99 * time.Millisecond,
+	}, calculateLatencyPercentiles(latencies))
+
+	latencies = []time.Duration{4, 1, 3, 2, 5}
+	assert.Equal(LatencyPercentiles{P50: 3, P90: 5, P99: 5}, calculateLatencyPercentiles(latencies))
+}
+
+func TestTxLatencyFeeLevelStats(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	clock := common.NewManualClock(time.Unix(1000, 0))
+	tracker := NewTxLatencyTracker(clock)
+
+	// The higher the gas price, the lower the latency
+	block := common.BytesToHash([]byte("block"))
+	for i := 1; i <= 8; i++ {
+		txHash := common.BigToHash(big.NewInt(int64(i)))
+		tracker.RecordAdmission(txHash, big.NewInt(int64(i*100)))
+		clock.Advance(time.Duration(10-i) * time.Second)
+		tracker.RecordInclusion(block, 1, []common.Hash{txHash})
+		tracker.RecordFinalization(1, map[common.Hash]bool{block: true})
+	}
+
+	levels := tracker.FeeLevelStats()
+	require.Equal(txLatencyNumFeeLevels, len(levels))
+	for i, level := range levels {
+		assert.Equal(2, level.NumTxs)
+		assert.Equal(big.NewInt(int64(200*i+100)), level.MinGasPrice)
+		assert.Equal(big.NewInt(int64(200*i+200)), level.MaxGasPrice)
+		assert.Equal(time.Duration(8-2*i)*time.Second, level.InclusionLatency.P50)
+		assert.Equal(time.Duration(9-2*i)*time.Second, level.InclusionLatency.P90)
+	}
+}
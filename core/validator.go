@@ -164,6 +164,55 @@ func (s *ValidatorSet) Validators() []Validator {
 	return s.validators
 }
 
+//
+// ------- ValidatorSetChange ------- //
+//
+
+// ValidatorSetUpdateDelay is the number of blocks between a block changing the stakes and the first block
+// validated by the validator set reflecting the change. The validator set of a block is selected out of the
+// state of its grandparent, reached by following the HCC links, and the blocks following a block with validator
+// changes must link their HCC to their parent, so the delay is exact.
+const ValidatorSetUpdateDelay uint64 = 2
+
+// ValidatorSetEffectiveHeight returns the height of the first block validated by the validator set reflecting
+// the stake changes of the block at the given height
+func ValidatorSetEffectiveHeight(stakeChangeHeight uint64) uint64 {
+	return stakeChangeHeight + ValidatorSetUpdateDelay
+}
+
+// ValidatorSetChange is a validator joining or leaving the validator set
+type ValidatorSetChange struct {
+	Validator       Validator
+	Joined          bool   // false if the validator left the set
+	EffectiveHeight uint64 // the height of the first block validated by the changed set
+}
+
+// String represents the string representation of the validator set change
+func (c ValidatorSetChange) String() string {
+	action := "left"
+	if c.Joined {
+		action = "joined"
+	}
+	return fmt.Sprintf("{ID: %v, %v at height %v}", c.Validator.ID(), action, c.EffectiveHeight)
+}
+
+// DiffValidatorSets returns the validators that left the previous set, followed by the validators that joined the
+// next one, each ordered by ID. A validator staying in the set with a different stake is not a change.
+func DiffValidatorSets(prev *ValidatorSet, next *ValidatorSet, effectiveHeight uint64) []ValidatorSetChange {
+	changes := []ValidatorSetChange{}
+	for _, v := range prev.Validators() {
+		if _, err := next.GetValidator(v.ID()); err != nil {
+			changes = append(changes, ValidatorSetChange{Validator: v, Joined: false, EffectiveHeight: effectiveHeight})
+		}
+	}
+	for _, v := range next.Validators() {
+		if _, err := prev.GetValidator(v.ID()); err != nil {
+			changes = append(changes, ValidatorSetChange{Validator: v, Joined: true, EffectiveHeight: effectiveHeight})
+		}
+	}
+	return changes
+}
+
 //
 // ------- ValidatorCandidatePool ------- //
 //
@@ -172,6 +221,11 @@ var (
 	MinValidatorStakeDeposit *big.Int
 )
 
+// DefaultMaxNumValidators is the max number of validators in the validator set, unless overridden by the chain
+// parameter in the state. The stake holders ranked below are on standby, they keep their stakes but neither
+// sign nor earn rewards until they rank among the top ones.
+const DefaultMaxNumValidators int = 31
+
 func init() {
 	// Each stake deposit needs to be at least 2,000,000 Theta
 	MinValidatorStakeDeposit = new(big.Int).Mul(new(big.Int).SetUint64(2000000), new(big.Int).SetUint64(1000000000000000000))
@@ -190,6 +244,107 @@ func (vcp *ValidatorCandidatePool) FindStakeDelegate(delegateAddr common.Address
 	return nil
 }
 
+// FindStake returns the stake the source deposited to the holder, or nil if there is none
+func (vcp *ValidatorCandidatePool) FindStake(source common.Address, holder common.Address) *Stake {
+	if vcp == nil {
+		return nil
+	}
+	candidate := vcp.FindStakeDelegate(holder)
+	if candidate == nil {
+		return nil
+	}
+	for _, stake := range candidate.Stakes {
+		if stake.Source == source {
+			return stake
+		}
+	}
+	return nil
+}
+
+// FindActiveStake returns the stake the source deposited to the holder that is not withdrawn, or nil if there
+// is none
+func (vcp *ValidatorCandidatePool) FindActiveStake(source common.Address, holder common.Address) *Stake {
+	if vcp == nil {
+		return nil
+	}
+	candidate := vcp.FindStakeDelegate(holder)
+	if candidate == nil {
+		return nil
+	}
+	return candidate.activeStake(source)
+}
+
+// FindLatestWithdrawnStake returns the latest stake the source withdrew from the holder that is not returned
+// yet, or nil if there is none
+func (vcp *ValidatorCandidatePool) FindLatestWithdrawnStake(source common.Address, holder common.Address) *Stake {
+	if vcp == nil {
+		return nil
+	}
+	candidate := vcp.FindStakeDelegate(holder)
+	if candidate == nil {
+		return nil
+	}
+	return candidate.latestWithdrawnStake(source)
+}
+
+// HasStakeFrom returns whether the source has any stake in the pool, including the withdrawn stakes
+// that are not returned yet
+func (vcp *ValidatorCandidatePool) HasStakeFrom(source common.Address) bool {
+	if vcp == nil {
+		return false
+	}
+	for _, candidate := range vcp.SortedCandidates {
+		for _, stake := range candidate.Stakes {
+			if stake.Source == source {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PendingStakeReturn is a withdrawn stake waiting in the unbonding queue for its return height
+type PendingStakeReturn struct {
+	Holder       common.Address
+	Source       common.Address
+	Amount       *big.Int
+	ReturnHeight uint64
+}
+
+// PendingStakeReturns returns the withdrawn stakes of the source that are not returned yet, ordered by return
+// height, then by holder
+func (vcp *ValidatorCandidatePool) PendingStakeReturns(source common.Address) []PendingStakeReturn {
+	if vcp == nil {
+		return []PendingStakeReturn{}
+	}
+	return pendingStakeReturns(vcp.SortedCandidates, source)
+}
+
+func pendingStakeReturns(stakeHolders []*StakeHolder, source common.Address) []PendingStakeReturn {
+	pendingReturns := []PendingStakeReturn{}
+	for _, candidate := range stakeHolders {
+		for _, stake := range candidate.Stakes {
+			if stake.Source == source && stake.Withdrawn {
+				pendingReturns = append(pendingReturns, PendingStakeReturn{
+					Holder:       candidate.Holder,
+					Source:       source,
+					Amount:       new(big.Int).Set(stake.Amount),
+					ReturnHeight: stake.ReturnHeight,
+				})
+			}
+		}
+	}
+	sort.SliceStable(pendingReturns, func(i, j int) bool {
+		if pendingReturns[i].ReturnHeight != pendingReturns[j].ReturnHeight {
+			return pendingReturns[i].ReturnHeight < pendingReturns[j].ReturnHeight
+		}
+		return bytes.Compare(pendingReturns[i].Holder.Bytes(), pendingReturns[j].Holder.Bytes()) < 0
+	})
+	return pendingReturns
+}
+
+// GetTopStakeHolders returns the stake holders ranked at the top, i.e. with the largest total stakes, with ties
+// broken by holder address, see sortCandidates
 func (vcp *ValidatorCandidatePool) GetTopStakeHolders(maxNumStakeHolders int) []*StakeHolder {
 	n := len(vcp.SortedCandidates)
 	if n > maxNumStakeHolders {
@@ -198,8 +353,40 @@ func (vcp *ValidatorCandidatePool) GetTopStakeHolders(maxNumStakeHolders int) []
 	return vcp.SortedCandidates[:n]
 }
 
+// GetStandbyStakeHolders returns the stake holders with a non-zero stake ranked below the top ones, which are
+// kept out of the validator set when it holds at most maxNumValidators
+func (vcp *ValidatorCandidatePool) GetStandbyStakeHolders(maxNumValidators int) []*StakeHolder {
+	standbys := []*StakeHolder{}
+	for idx := maxNumValidators; idx < len(vcp.SortedCandidates); idx++ {
+		if vcp.SortedCandidates[idx].TotalStake().Cmp(Zero) > 0 {
+			standbys = append(standbys, vcp.SortedCandidates[idx])
+		}
+	}
+	return standbys
+}
+
+// DepositStake deposits the stake from the source to the holder. A deposit to a holder the source already
+// backs is merged into the existing stake record, so the withdrawal and the return cover the merged amount.
 func (vcp *ValidatorCandidatePool) DepositStake(source common.Address, holder common.Address, amount *big.Int) (err error) {
-	if amount.Cmp(MinValidatorStakeDeposit) < 0 {
+	return vcp.depositStake(source, holder, amount, MinValidatorStakeDeposit, (*StakeHolder).depositStake)
+}
+
+// DepositActiveStake deposits the stake from the source to the holder, merging it into the active stake
+// record of the source. Unlike DepositStake, it is accepted while earlier stakes of the source are withdrawn
+// and not returned yet, in which case a new record is added and each record returns at its own height.
+func (vcp *ValidatorCandidatePool) DepositActiveStake(source common.Address, holder common.Address, amount *big.Int) (err error) {
+	return vcp.DepositActiveStakeWithMinimum(source, holder, amount, MinValidatorStakeDeposit)
+}
+
+// DepositActiveStakeWithMinimum is DepositActiveStake with the minimum deposit in effect, i.e. the chain parameter
+// in the state rather than the default MinValidatorStakeDeposit
+func (vcp *ValidatorCandidatePool) DepositActiveStakeWithMinimum(source common.Address, holder common.Address, amount *big.Int, minAmount *big.Int) (err error) {
+	return vcp.depositStake(source, holder, amount, minAmount, (*StakeHolder).depositActiveStake)
+}
+
+func (vcp *ValidatorCandidatePool) depositStake(source common.Address, holder common.Address, amount *big.Int, minAmount *big.Int,
+	deposit func(sh *StakeHolder, source common.Address, amount *big.Int) error) (err error) {
+	if amount.Cmp(minAmount) < 0 {
 		return fmt.Errorf("Insufficient stake: %v", amount)
 	}
 
@@ -207,7 +394,7 @@ func (vcp *ValidatorCandidatePool) DepositStake(source common.Address, holder co
 	for _, candidate := range vcp.SortedCandidates {
 		if candidate.Holder == holder {
 			matchedHolderFound = true
-			err = candidate.depositStake(source, amount)
+			err = deposit(candidate, source, amount)
 			if err != nil {
 				return err
 			}
@@ -226,11 +413,18 @@ func (vcp *ValidatorCandidatePool) DepositStake(source common.Address, holder co
 }
 
 func (vcp *ValidatorCandidatePool) WithdrawStake(source common.Address, holder common.Address, currentHeight uint64) error {
+	return vcp.WithdrawStakeWithLockingPeriod(source, holder, currentHeight, ReturnLockingPeriod)
+}
+
+// WithdrawStakeWithLockingPeriod withdraws the stake of the source from the holder, to be returned after the given
+// locking period, i.e. the chain parameter in effect rather than the default ReturnLockingPeriod. The return height
+// is fixed at the withdrawal, a later change of the locking period does not affect it.
+func (vcp *ValidatorCandidatePool) WithdrawStakeWithLockingPeriod(source common.Address, holder common.Address, currentHeight uint64, lockingPeriod uint64) error {
 	matchedHolderFound := false
 	for _, candidate := range vcp.SortedCandidates {
 		if candidate.Holder == holder {
 			matchedHolderFound = true
-			err := candidate.withdrawStake(source, currentHeight)
+			err := candidate.withdrawStakeUntil(source, currentHeight+lockingPeriod)
 			if err != nil {
 				return err
 			}
@@ -247,8 +441,80 @@ func (vcp *ValidatorCandidatePool) WithdrawStake(source common.Address, holder c
 	return nil
 }
 
+// CancelWithdrawal turns the stake withdrawn from the holder back into an active stake before it is returned,
+// i.e. while the current height is below its return height
+func (vcp *ValidatorCandidatePool) CancelWithdrawal(source common.Address, holder common.Address, currentHeight uint64) error {
+	candidate := vcp.FindStakeDelegate(holder)
+	if candidate == nil {
+		return fmt.Errorf("No matched stake holder address found: %v", holder)
+	}
+
+	err := candidate.cancelWithdrawal(source, currentHeight)
+	if err != nil {
+		return err
+	}
+	vcp.sortCandidates()
+
+	return nil
+}
+
+// ReplaceStakeHolder re-points the stakes of the holder, the active and the withdrawn ones, to the new holder
+// address, e.g. when the validator rotates its signing key. The new holder must not hold any stake.
+func (vcp *ValidatorCandidatePool) ReplaceStakeHolder(holder common.Address, newHolder common.Address) error {
+	candidate := vcp.FindStakeDelegate(holder)
+	if candidate == nil {
+		return fmt.Errorf("No matched stake holder address found: %v", holder)
+	}
+	if vcp.FindStakeDelegate(newHolder) != nil {
+		return fmt.Errorf("The new stake holder %v already holds stakes", newHolder)
+	}
+
+	candidate.Holder = newHolder
+	vcp.sortCandidates()
+
+	return nil
+}
+
+// SlashStakeHolder burns the given percentage of the stakes backing the holder, and withdraws the rest, so the
+// holder drops out of the validator set the next time it is selected. The withdrawn stakes return to their
+// sources after the ReturnLockingPeriod as usual. It returns the burned amount.
+func (vcp *ValidatorCandidatePool) SlashStakeHolder(holder common.Address, percentage uint64, currentHeight uint64) (*big.Int, error) {
+	return vcp.SlashStakeHolderWithLockingPeriod(holder, percentage, currentHeight, ReturnLockingPeriod)
+}
+
+// SlashStakeHolderWithLockingPeriod is SlashStakeHolder with the locking period in effect for the stakes it
+// withdraws, rather than the default ReturnLockingPeriod
+func (vcp *ValidatorCandidatePool) SlashStakeHolderWithLockingPeriod(holder common.Address, percentage uint64, currentHeight uint64, lockingPeriod uint64) (*big.Int, error) {
+	if percentage > 100 {
+		return nil, fmt.Errorf("Invalid slash percentage: %v", percentage)
+	}
+	candidate := vcp.FindStakeDelegate(holder)
+	if candidate == nil {
+		return nil, fmt.Errorf("No matched stake holder address found: %v", holder)
+	}
+
+	slashedAmount := candidate.slashStakes(percentage, currentHeight+lockingPeriod)
+	vcp.sortCandidates()
+
+	return slashedAmount, nil
+}
+
+// ReturnStakes removes and returns the withdrawn stakes due at the current height. The withdrawn stake records
+// form the unbonding queue, each with its own amount and return height. The pending returns recorded before
+// common.HeightEnableUnbondingQueue are the same records, one per source and holder, so they are returned as
+// queue entries without any migration of the state.
 func (vcp *ValidatorCandidatePool) ReturnStakes(currentHeight uint64) []*Stake {
 	returnedStakes := []*Stake{}
+	for _, returnedStake := range vcp.ReturnStakesWithHolders(currentHeight) {
+		returnedStakes = append(returnedStakes, returnedStake.Stake)
+	}
+	return returnedStakes
+}
+
+// ReturnStakesWithHolders removes and returns the withdrawn stakes due at the current height like ReturnStakes,
+// along with their holders
+func (vcp *ValidatorCandidatePool) ReturnStakesWithHolders(currentHeight uint64) []*ReturnedStake {
+	returnedStakes := []*ReturnedStake{}
 
 	// need to iterate in the reverse order, since we may delete elemements
 	// from the slice while iterating through it
@@ -258,14 +524,10 @@ func (vcp *ValidatorCandidatePool) ReturnStakes(currentHeight uint64) []*Stake {
 		for sidx := numStakeSources - 1; sidx >= 0; sidx-- { // similar to the outer loop, need to iterate in the reversed order
 			stake := candidate.Stakes[sidx]
 			if (stake.Withdrawn) && (currentHeight >= stake.ReturnHeight) {
+				// A source may have several withdrawals queued to the same holder, each is returned at its own height
 				logger.Printf("Stake to be returned: source = %v, amount = %v", stake.Source, stake.Amount)
-				source := stake.Source
-				returnedStake, err := candidate.returnStake(source, currentHeight)
-				if err != nil {
-					logger.Errorf("Failed to return stake: %v, error: %v", source, err)
-					continue
-				}
-				returnedStakes = append(returnedStakes, returnedStake)
+				candidate.Stakes = append(candidate.Stakes[:sidx], candidate.Stakes[sidx+1:]...)
+				returnedStakes = append(returnedStakes, &ReturnedStake{Stake: stake, Holder: candidate.Holder})
 			}
 		}
 
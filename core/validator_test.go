@@ -302,6 +302,105 @@ func TestValidatorCandidatePool(t *testing.T) {
 	checkAndPrintTopCandidates(t, assert, vcp, 3)
 }
 
+func TestValidatorCandidatePoolUnbondingQueue(t *testing.T) {
+	assert := assert.New(t)
+
+	sourceAddr := common.HexToAddress("0x111")
+	holderAddr1 := common.HexToAddress("0xf01")
+	holderAddr2 := common.HexToAddress("0xf02")
+	amount1 := new(big.Int).Mul(new(big.Int).SetUint64(3), MinValidatorStakeDeposit)
+	amount2 := new(big.Int).Mul(new(big.Int).SetUint64(2), MinValidatorStakeDeposit)
+	height1, height2, height3 := uint64(100), uint64(200), uint64(300)
+
+	// The source withdraws from the first holder twice, re-depositing in between, and from the second holder once
+	vcp := &ValidatorCandidatePool{}
+	assert.Nil(vcp.DepositStake(sourceAddr, holderAddr1, amount1))
+	assert.Nil(vcp.DepositStake(sourceAddr, holderAddr2, amount2))
+	assert.Nil(vcp.WithdrawStake(sourceAddr, holderAddr1, height1))
+	assert.NotNil(vcp.DepositStake(sourceAddr, holderAddr1, MinValidatorStakeDeposit))
+	assert.Nil(vcp.DepositActiveStake(sourceAddr, holderAddr1, MinValidatorStakeDeposit))
+	assert.Equal(MinValidatorStakeDeposit, vcp.FindActiveStake(sourceAddr, holderAddr1).Amount)
+	assert.Nil(vcp.WithdrawStake(sourceAddr, holderAddr2, height2))
+	assert.Nil(vcp.WithdrawStake(sourceAddr, holderAddr1, height3))
+	assert.Nil(vcp.FindActiveStake(sourceAddr, holderAddr1))
+	assert.Equal(height3+ReturnLockingPeriod, vcp.FindLatestWithdrawnStake(sourceAddr, holderAddr1).ReturnHeight)
+
+	pendingReturns := vcp.PendingStakeReturns(sourceAddr)
+	assert.Equal([]PendingStakeReturn{
+		{Holder: holderAddr1, Source: sourceAddr, Amount: amount1, ReturnHeight: height1 + ReturnLockingPeriod},
+		{Holder: holderAddr2, Source: sourceAddr, Amount: amount2, ReturnHeight: height2 + ReturnLockingPeriod},
+		{Holder: holderAddr1, Source: sourceAddr, Amount: MinValidatorStakeDeposit, ReturnHeight: height3 + ReturnLockingPeriod},
+	}, pendingReturns)
+	assert.Empty(vcp.PendingStakeReturns(holderAddr1))
+
+	// Each entry is returned once its own return height has passed
+	for i, pending := range pendingReturns {
+		assert.Empty(vcp.ReturnStakes(pending.ReturnHeight - 1))
+		returnedStakes := vcp.ReturnStakes(pending.ReturnHeight)
+		assert.Equal(1, len(returnedStakes))
+		assert.Equal(pending.Amount, returnedStakes[0].Amount)
+		assert.Equal(pendingReturns[i+1:], vcp.PendingStakeReturns(sourceAddr))
+	}
+	assert.Empty(vcp.SortedCandidates)
+}
+
+func TestValidatorCandidatePoolStandby(t *testing.T) {
+	assert := assert.New(t)
+
+	holderAddr1 := common.HexToAddress("0xf01")
+	holderAddr2 := common.HexToAddress("0xf02")
+	holderAddr3 := common.HexToAddress("0xf03")
+	holderAddr4 := common.HexToAddress("0xf04")
+	sourceAddr := common.HexToAddress("0x111")
+	amount := func(n uint64) *big.Int {
+		return new(big.Int).Mul(new(big.Int).SetUint64(n), MinValidatorStakeDeposit)
+	}
+
+	// The ties are broken by holder address, the withdrawn stake holders are not on standby
+	vcp := &ValidatorCandidatePool{}
+	assert.Nil(vcp.DepositStake(sourceAddr, holderAddr1, amount(2)))
+	assert.Nil(vcp.DepositStake(sourceAddr, holderAddr2, amount(2)))
+	assert.Nil(vcp.DepositStake(sourceAddr, holderAddr3, amount(3)))
+	assert.Nil(vcp.DepositStake(sourceAddr, holderAddr4, amount(1)))
+	assert.Nil(vcp.WithdrawStake(sourceAddr, holderAddr4, 100))
+
+	topStakeHolders := vcp.GetTopStakeHolders(2)
+	assert.Equal(2, len(topStakeHolders))
+	assert.Equal(holderAddr3, topStakeHolders[0].Holder)
+	assert.Equal(holderAddr2, topStakeHolders[1].Holder)
+	standbys := vcp.GetStandbyStakeHolders(2)
+	assert.Equal(1, len(standbys))
+	assert.Equal(holderAddr1, standbys[0].Holder)
+	assert.Empty(vcp.GetStandbyStakeHolders(DefaultMaxNumValidators))
+}
+
+func TestValidatorCandidatePoolReplaceStakeHolder(t *testing.T) {
+	assert := assert.New(t)
+
+	sourceAddr1 := common.HexToAddress("0x111")
+	sourceAddr2 := common.HexToAddress("0x222")
+	holderAddr := common.HexToAddress("0xf01")
+	otherHolderAddr := common.HexToAddress("0xf02")
+	newHolderAddr := common.HexToAddress("0xf03")
+
+	vcp := &ValidatorCandidatePool{}
+	assert.Nil(vcp.DepositStake(sourceAddr1, holderAddr, MinValidatorStakeDeposit))
+	assert.Nil(vcp.DepositStake(sourceAddr2, holderAddr, MinValidatorStakeDeposit))
+	assert.Nil(vcp.DepositStake(sourceAddr1, otherHolderAddr, MinValidatorStakeDeposit))
+	assert.Nil(vcp.WithdrawStake(sourceAddr2, holderAddr, 100))
+
+	assert.NotNil(vcp.ReplaceStakeHolder(newHolderAddr, holderAddr))
+	assert.NotNil(vcp.ReplaceStakeHolder(holderAddr, otherHolderAddr))
+
+	// Both the active and the withdrawn stakes move to the new holder
+	assert.Nil(vcp.ReplaceStakeHolder(holderAddr, newHolderAddr))
+	assert.Nil(vcp.FindStakeDelegate(holderAddr))
+	assert.Equal(MinValidatorStakeDeposit, vcp.FindActiveStake(sourceAddr1, newHolderAddr).Amount)
+	assert.True(vcp.FindStake(sourceAddr2, newHolderAddr).Withdrawn)
+	assert.Equal(2, len(vcp.SortedCandidates))
+	checkAndPrintAllSortedCandidates(t, assert, vcp)
+}
+
 func TestValidatorSetUniqueSortedOrder(t *testing.T) {
 	assert := assert.New(t)
 
@@ -384,3 +483,30 @@ func checkAndPrintTopCandidates(t *testing.T, assert *assert.Assertions, vcp *Va
 		prevStake = stake
 	}
 }
+
+func TestDiffValidatorSets(t *testing.T) {
+	assert := assert.New(t)
+
+	stake := new(big.Int).Set(MinValidatorStakeDeposit)
+	va1 := NewValidator("0x111", stake)
+	va2 := NewValidator("0x222", stake)
+	va3 := NewValidator("0x333", stake)
+
+	prev := NewValidatorSet()
+	prev.AddValidator(va1)
+	prev.AddValidator(va2)
+
+	next := NewValidatorSet()
+	next.AddValidator(NewValidator("0x111", new(big.Int).Mul(stake, big.NewInt(2)))) // a stake change only
+	next.AddValidator(va3)
+
+	effectiveHeight := ValidatorSetEffectiveHeight(100)
+	assert.Equal(uint64(102), effectiveHeight)
+
+	changes := DiffValidatorSets(prev, next, effectiveHeight)
+	assert.Equal([]ValidatorSetChange{
+		{Validator: va2, Joined: false, EffectiveHeight: 102},
+		{Validator: va3, Joined: true, EffectiveHeight: 102},
+	}, changes)
+	assert.Empty(DiffValidatorSets(prev, prev.Copy(), effectiveHeight))
+}
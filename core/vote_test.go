@@ -40,6 +40,42 @@ func TestVoteEncoding(t *testing.T) {
 	assert.True(bytes.Equal(v1.Signature.ToBytes(), v2.Signature.ToBytes()))
 }
 
+func TestVoteValidateSignatureSchemes(t *testing.T) {
+	assert := assert.New(t)
+
+	secpPrivKey, _, err := crypto.GenerateKeyPair()
+	assert.Nil(err)
+	edPrivKey, _, err := crypto.GenerateEd25519KeyPair()
+	assert.Nil(err)
+
+	newVote := func(id common.Address, signer *crypto.PrivateKey) Vote {
+		v := Vote{
+			Block: CreateTestBlock("", "").Hash(),
+			ID:    id,
+			Epoch: 1,
+		}
+		sig, err := signer.Sign(v.SignBytes())
+		assert.Nil(err)
+		v.SetSignature(sig)
+		return v
+	}
+
+	// Validators may sign with either scheme
+	assert.True(newVote(secpPrivKey.PublicKey().Address(), secpPrivKey).Validate().IsOK())
+	edVote := newVote(edPrivKey.PublicKey().Address(), edPrivKey)
+	assert.True(edVote.Validate().IsOK())
+
+	v := Vote{}
+	b, err := rlp.EncodeToBytes(edVote)
+	assert.Nil(err)
+	assert.Nil(rlp.DecodeBytes(b, &v))
+	assert.True(v.Validate().IsOK())
+
+	// A signature of one scheme does not validate for an address of the other
+	assert.True(newVote(secpPrivKey.PublicKey().Address(), edPrivKey).Validate().IsError())
+	assert.True(newVote(edPrivKey.PublicKey().Address(), secpPrivKey).Validate().IsError())
+}
+
 func TestVoteSetEncoding(t *testing.T) {
 	assert := assert.New(t)
 
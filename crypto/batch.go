@@ -0,0 +1,41 @@
+package crypto
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/thetatoken/theta/common"
+)
+
+// SignatureVerification is a signature to verify against the address of the signer
+type SignatureVerification struct {
+	Address   common.Address
+	Msg       common.Bytes
+	Signature *Signature
+}
+
+// BatchVerify verifies the signatures and returns whether each of them is valid. The secp256k1 signatures
+// are verified by recovering the public key, which has no batch math, so the cost is amortized by
+// spreading the signatures over one worker per CPU instead. The verified signatures are added to the
+// cache if it is not nil, so that verifying them again later is cheap.
+func BatchVerify(verifications []*SignatureVerification, cache *SignatureCache) []bool {
+	valid := make([]bool, len(verifications))
+	numWorkers := runtime.NumCPU()
+	if numWorkers > len(verifications) {
+		numWorkers = len(verifications)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(verifications); i += numWorkers {
+				v := verifications[i]
+				valid[i] = cache.Verify(v.Msg, v.Signature, v.Address)
+			}
+		}(w)
+	}
+	wg.Wait()
+	return valid
+}
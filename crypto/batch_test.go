@@ -0,0 +1,114 @@
+package crypto
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thetatoken/theta/common"
+)
+
+func makeTestSignatureVerifications(numSigs int) []*SignatureVerification {
+	verifications := []*SignatureVerification{}
+	for i := 0; i < numSigs; i++ {
+		var privKey *PrivateKey
+		if i%4 == 3 {
+			privKey, _ = TEST_GenerateEd25519KeyPairWithSeed(fmt.Sprintf("batch_%v", i))
+		} else {
+			privKey, _, _ = GenerateKeyPair()
+		}
+		msg := common.Bytes(fmt.Sprintf("message %v", i))
+		sig, err := privKey.Sign(msg)
+		if err != nil {
+			panic(err)
+		}
+		verifications = append(verifications, &SignatureVerification{
+			Address:   privKey.PublicKey().Address(),
+			Msg:       msg,
+			Signature: sig,
+		})
+	}
+	return verifications
+}
+
+func TestSignatureCache(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := NewSignatureCache(2)
+	verifications := makeTestSignatureVerifications(3)
+	v0, v1, v2 := verifications[0], verifications[1], verifications[2]
+
+	assert.True(cache.Verify(v0.Msg, v0.Signature, v0.Address))
+	assert.Equal(1, cache.Len())
+	assert.True(cache.Verify(v0.Msg, v0.Signature, v0.Address))
+	assert.Equal(1, cache.Len())
+
+	// A cached signature is still checked against the address and the message
+	assert.False(cache.Verify(v0.Msg, v0.Signature, v1.Address))
+	assert.False(cache.Verify(v1.Msg, v0.Signature, v0.Address)) // recovers another address, which is cached
+	assert.Equal(2, cache.Len())
+	assert.False(cache.Verify(v0.Msg, nil, v0.Address))
+	assert.False(cache.Verify(v0.Msg, &Signature{}, v0.Address))
+
+	// The invalid signatures are not cached
+	assert.False(cache.Verify(v1.Msg, &Signature{data: common.Bytes("invalid")}, v1.Address))
+	assert.Equal(2, cache.Len())
+
+	// The least recently used signatures are evicted
+	assert.True(cache.Verify(v1.Msg, v1.Signature, v1.Address))
+	assert.True(cache.Verify(v2.Msg, v2.Signature, v2.Address))
+	assert.Equal(2, cache.Len())
+
+	// The nil cache verifies without caching
+	var nilCache *SignatureCache
+	assert.True(nilCache.Verify(v0.Msg, v0.Signature, v0.Address))
+	assert.False(nilCache.Verify(v0.Msg, v0.Signature, v1.Address))
+}
+
+func TestBatchVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	verifications := makeTestSignatureVerifications(50)
+	verifications[7].Address = verifications[8].Address
+	verifications[13].Msg = common.Bytes("tampered")
+	verifications[23].Signature = &Signature{}
+
+	for _, cache := range []*SignatureCache{nil, NewSignatureCache(100)} {
+		valid := BatchVerify(verifications, cache)
+		assert.Equal(len(verifications), len(valid))
+		for i, v := range verifications {
+			assert.Equal(v.Signature.Verify(v.Msg, v.Address), valid[i], "signature %v", i)
+		}
+		assert.False(valid[7])
+		assert.False(valid[13])
+		assert.False(valid[23])
+	}
+	assert.Empty(BatchVerify(nil, nil))
+}
+
+func BenchmarkBatchVerify(b *testing.B) {
+	verifications := makeTestSignatureVerifications(1000)
+
+	b.Run("serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, v := range verifications {
+				if !v.Signature.Verify(v.Msg, v.Address) {
+					b.Fatal("invalid signature")
+				}
+			}
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			BatchVerify(verifications, nil)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		cache := NewSignatureCache(len(verifications))
+		BatchVerify(verifications, cache)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			BatchVerify(verifications, cache)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package crypto
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"encoding/json"
 	"io"
 	"math/big"
@@ -32,25 +33,45 @@ func Keccak256Hash(data ...[]byte) (h common.Hash) {
 //
 
 //
-// PrivateKey represents the private key
+// PrivateKey represents the private key, either a secp256k1 or an Ed25519 key
 //
 type PrivateKey struct {
 	privKey *ecdsa.PrivateKey
+	edKey   ed25519.PrivateKey
+}
+
+// Scheme returns the signature scheme of the private key
+func (sk *PrivateKey) Scheme() SignatureScheme {
+	if sk.edKey != nil {
+		return SchemeEd25519
+	}
+	return SchemeSecp256k1
 }
 
 // ToBytes returns the bytes representation of the private key
 func (sk *PrivateKey) ToBytes() common.Bytes {
+	if sk.edKey != nil {
+		return fromEd25519(sk.edKey)
+	}
 	skbytes := fromECDSA(sk.privKey)
 	return skbytes
 }
 
-// D returns the D parameter of the ECDSA private key
+// D returns the D parameter of the ECDSA private key, or nil for an Ed25519 key
 func (sk *PrivateKey) D() *big.Int {
+	if sk.privKey == nil {
+		return nil
+	}
 	return sk.privKey.D
 }
 
 // PublicKey returns the public key corresponding to the private key
 func (sk *PrivateKey) PublicKey() *PublicKey {
+	if sk.edKey != nil {
+		return &PublicKey{
+			edKey: sk.edKey.Public().(ed25519.PublicKey),
+		}
+	}
 	pke := &sk.privKey.PublicKey
 	return &PublicKey{
 		pubKey: pke,
@@ -59,12 +80,18 @@ func (sk *PrivateKey) PublicKey() *PublicKey {
 
 // SaveToFile saves the private key to the designated file
 func (sk *PrivateKey) SaveToFile(filepath string) error {
+	if sk.edKey != nil {
+		return saveEd25519(filepath, sk.edKey)
+	}
 	err := saveECDSA(filepath, sk.privKey)
 	return err
 }
 
 // Sign signs the given message with the private key
 func (sk *PrivateKey) Sign(msg common.Bytes) (*Signature, error) {
+	if sk.edKey != nil {
+		return &Signature{data: signEd25519(msg, sk.edKey)}, nil
+	}
 	msgHash := keccak256(msg)
 	sigBytes, err := sign(msgHash, sk.privKey)
 	sig := &Signature{data: sigBytes}
@@ -72,10 +99,19 @@ func (sk *PrivateKey) Sign(msg common.Bytes) (*Signature, error) {
 }
 
 //
-// PublicKey represents the public key
+// PublicKey represents the public key, either a secp256k1 or an Ed25519 key
 //
 type PublicKey struct {
 	pubKey *ecdsa.PublicKey
+	edKey  ed25519.PublicKey
+}
+
+// Scheme returns the signature scheme of the public key
+func (pk *PublicKey) Scheme() SignatureScheme {
+	if pk.edKey != nil {
+		return SchemeEd25519
+	}
+	return SchemeSecp256k1
 }
 
 var _ rlp.Encoder = (*PublicKey)(nil)
@@ -101,22 +137,29 @@ func (pk *PublicKey) DecodeRLP(stream *rlp.Stream) error {
 	if len(b) == 0 {
 		return nil
 	}
-	pubKey, err := unmarshalPubkey(b)
+	decoded, err := PublicKeyFromBytes(b)
 	if err != nil {
 		return err
 	}
-	pk.pubKey = pubKey
+	*pk = *decoded
 	return nil
 }
 
-// ToBytes returns the bytes representation of the public key
+// ToBytes returns the bytes representation of the public key. Ed25519 keys
+// are prefixed with the scheme byte, secp256k1 keys are uncompressed and unprefixed.
 func (pk *PublicKey) ToBytes() common.Bytes {
+	if pk.edKey != nil {
+		return fromEd25519Pub(pk.edKey)
+	}
 	pkbytes := fromECDSAPub(pk.pubKey)
 	return pkbytes
 }
 
 // Address returns the address corresponding to the public key
 func (pk *PublicKey) Address() common.Address {
+	if pk.edKey != nil {
+		return ed25519Address(pk.edKey)
+	}
 	pubBytes := fromECDSAPub(pk.pubKey)
 	address := common.BytesToAddress(keccak256(pubBytes[1:])[12:])
 	return address
@@ -124,16 +167,27 @@ func (pk *PublicKey) Address() common.Address {
 
 // IsEmpty indicates whether the public key is empty
 func (pk *PublicKey) IsEmpty() bool {
+	if pk.edKey != nil {
+		return len(pk.edKey) != ed25519.PublicKeySize
+	}
 	isEmpty := (pk.pubKey == nil || pk.pubKey.X == nil || pk.pubKey.Y == nil)
 	return isEmpty
 }
 
-// VerifySignature verifies the signature with the public key (using ecrecover)
+// VerifySignature verifies the signature with the public key (using ecrecover
+// for secp256k1). A signature of one scheme never verifies against a key of the other.
 func (pk *PublicKey) VerifySignature(msg common.Bytes, sig *Signature) bool {
 	if sig == nil {
 		return false
 	}
 
+	if pk.edKey != nil {
+		return verifyEd25519WithKey(msg, pk.edKey, sig.ToBytes())
+	}
+	if sig.Scheme() != SchemeSecp256k1 {
+		return false
+	}
+
 	msgHash := keccak256(msg)
 	recoveredUncompressedPubKey, err := ecrecover(msgHash, sig.ToBytes())
 	if err != nil {
@@ -167,12 +221,22 @@ func (pk *PublicKey) VerifySignature(msg common.Bytes, sig *Signature) bool {
 // }
 
 //
-// Signature represents the digital signature
+// Signature represents the digital signature. A secp256k1 signature is the
+// 65-byte [R || S || V] encoding. An Ed25519 signature is encoded as
+// [0xED || pubkey || sig] so that the signer address can be derived from it.
 //
 type Signature struct {
 	data common.Bytes
 }
 
+// Scheme returns the signature scheme of the signature
+func (sig *Signature) Scheme() SignatureScheme {
+	if isEd25519SignatureBytes(sig.data) {
+		return SchemeEd25519
+	}
+	return SchemeSecp256k1
+}
+
 var _ rlp.Encoder = (*Signature)(nil)
 
 // EncodeRLP implements RLP Encoder interface.
@@ -225,6 +289,14 @@ func (sig *Signature) IsEmpty() bool {
 
 // RecoverSignerAddress recovers the address of the signer for the given message
 func (sig *Signature) RecoverSignerAddress(msg common.Bytes) (common.Address, error) {
+	if sig.Scheme() == SchemeEd25519 {
+		pub, err := verifyEd25519(msg, sig.ToBytes())
+		if err != nil {
+			return common.Address{}, err
+		}
+		return ed25519Address(pub), nil
+	}
+
 	msgHash := keccak256(msg)
 	recoveredUncompressedPubKey, err := ecrecover(msgHash, sig.ToBytes())
 	if err != nil {
@@ -264,6 +336,9 @@ func GenerateKeyPair() (*PrivateKey, *PublicKey, error) {
 
 // PrivateKeyFromFile loads the private key from the given file
 func PrivateKeyFromFile(filepath string) (*PrivateKey, error) {
+	if edKey, err := loadEd25519(filepath); err == nil {
+		return &PrivateKey{edKey: edKey}, nil
+	}
 	key, err := loadECDSA(filepath)
 	sk := &PrivateKey{privKey: key}
 	return sk, err
@@ -271,6 +346,10 @@ func PrivateKeyFromFile(filepath string) (*PrivateKey, error) {
 
 // PrivateKeyFromBytes converts the given bytes to a private key
 func PrivateKeyFromBytes(skBytes common.Bytes) (*PrivateKey, error) {
+	if isEd25519PrivateKeyBytes(skBytes) {
+		edKey, err := ed25519PrivateKeyFromBytes(skBytes)
+		return &PrivateKey{edKey: edKey}, err
+	}
 	key, err := toECDSA(skBytes)
 	sk := &PrivateKey{privKey: key}
 	return sk, err
@@ -280,6 +359,10 @@ func PrivateKeyFromBytes(skBytes common.Bytes) (*PrivateKey, error) {
 // should almost never be used unless you are sure the input is valid and want to
 // avoid hitting errors due to bad origin encoding (0 prefixes cut off).
 func PrivateKeyFromBytesUnsafe(skBytes common.Bytes) *PrivateKey {
+	if isEd25519PrivateKeyBytes(skBytes) {
+		edKey, _ := ed25519PrivateKeyFromBytes(skBytes)
+		return &PrivateKey{edKey: edKey}
+	}
 	key := toECDSAUnsafe(skBytes)
 	sk := &PrivateKey{privKey: key}
 	return sk
@@ -287,6 +370,10 @@ func PrivateKeyFromBytesUnsafe(skBytes common.Bytes) *PrivateKey {
 
 // PublicKeyFromBytes converts the given bytes to a public key
 func PublicKeyFromBytes(pkBytes common.Bytes) (*PublicKey, error) {
+	if isEd25519PublicKeyBytes(pkBytes) {
+		edKey, err := ed25519PublicKeyFromBytes(pkBytes)
+		return &PublicKey{edKey: edKey}, err
+	}
 	key, err := unmarshalPubkey(pkBytes)
 	pk := &PublicKey{pubKey: key}
 	return pk, err
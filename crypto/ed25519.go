@@ -0,0 +1,163 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/thetatoken/theta/common"
+)
+
+// SignatureScheme identifies the digital signature scheme of a key or a signature
+type SignatureScheme byte
+
+const (
+	// SchemeSecp256k1 is the legacy scheme. Its keys and signatures carry no
+	// scheme prefix so that their encodings remain unchanged.
+	SchemeSecp256k1 SignatureScheme = 0x00
+
+	// SchemeEd25519 keys and signatures are prefixed with this byte
+	SchemeEd25519 SignatureScheme = 0xED
+)
+
+const (
+	ed25519PrivateKeyLength = 1 + ed25519.SeedSize                              // [prefix || seed]
+	ed25519PublicKeyLength  = 1 + ed25519.PublicKeySize                         // [prefix || pubkey]
+	ed25519SignatureLength  = 1 + ed25519.PublicKeySize + ed25519.SignatureSize // [prefix || pubkey || sig]
+)
+
+var errInvalidEd25519Key = errors.New("invalid ed25519 key")
+
+// String returns the name of the signature scheme
+func (scheme SignatureScheme) String() string {
+	switch scheme {
+	case SchemeSecp256k1:
+		return "secp256k1"
+	case SchemeEd25519:
+		return "ed25519"
+	default:
+		return fmt.Sprintf("unknown(0x%x)", byte(scheme))
+	}
+}
+
+// GenerateEd25519KeyPair generates a random Ed25519 private/public key pair
+func GenerateEd25519KeyPair() (*PrivateKey, *PublicKey, error) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &PrivateKey{edKey: priv}, &PublicKey{edKey: pub}, nil
+}
+
+// NewEd25519Signature assembles a signature from an Ed25519 public key and the raw
+// 64-byte signature it produced over the Keccak256 hash of the message. It allows
+// signatures created outside of this package (e.g. by an HSM) to be submitted.
+func NewEd25519Signature(pubKey *PublicKey, sigBytes common.Bytes) (*Signature, error) {
+	if pubKey == nil || pubKey.Scheme() != SchemeEd25519 || pubKey.IsEmpty() {
+		return nil, errInvalidEd25519Key
+	}
+	if len(sigBytes) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("invalid ed25519 signature length: %v", len(sigBytes))
+	}
+	return &Signature{data: encodeEd25519Signature(pubKey.edKey, sigBytes)}, nil
+}
+
+func isEd25519PrivateKeyBytes(b []byte) bool {
+	return len(b) == ed25519PrivateKeyLength && b[0] == byte(SchemeEd25519)
+}
+
+func isEd25519PublicKeyBytes(b []byte) bool {
+	return len(b) == ed25519PublicKeyLength && b[0] == byte(SchemeEd25519)
+}
+
+func isEd25519SignatureBytes(b []byte) bool {
+	return len(b) == ed25519SignatureLength && b[0] == byte(SchemeEd25519)
+}
+
+func ed25519PrivateKeyFromBytes(b []byte) (ed25519.PrivateKey, error) {
+	if !isEd25519PrivateKeyBytes(b) {
+		return nil, errInvalidEd25519Key
+	}
+	return ed25519.NewKeyFromSeed(b[1:]), nil
+}
+
+func ed25519PublicKeyFromBytes(b []byte) (ed25519.PublicKey, error) {
+	if !isEd25519PublicKeyBytes(b) {
+		return nil, errInvalidEd25519Key
+	}
+	pub := make(ed25519.PublicKey, ed25519.PublicKeySize)
+	copy(pub, b[1:])
+	return pub, nil
+}
+
+func fromEd25519(priv ed25519.PrivateKey) []byte {
+	return append([]byte{byte(SchemeEd25519)}, priv.Seed()...)
+}
+
+func fromEd25519Pub(pub ed25519.PublicKey) []byte {
+	return append([]byte{byte(SchemeEd25519)}, pub...)
+}
+
+// ed25519Address derives the address from the prefixed public key, so that
+// addresses of the two schemes are drawn from disjoint preimages
+func ed25519Address(pub ed25519.PublicKey) common.Address {
+	return common.BytesToAddress(keccak256(fromEd25519Pub(pub))[12:])
+}
+
+func encodeEd25519Signature(pub ed25519.PublicKey, sig []byte) []byte {
+	data := make([]byte, 0, ed25519SignatureLength)
+	data = append(data, byte(SchemeEd25519))
+	data = append(data, pub...)
+	data = append(data, sig...)
+	return data
+}
+
+func signEd25519(msg []byte, priv ed25519.PrivateKey) []byte {
+	msgHash := keccak256(msg)
+	pub := priv.Public().(ed25519.PublicKey)
+	return encodeEd25519Signature(pub, ed25519.Sign(priv, msgHash))
+}
+
+// verifyEd25519 checks an encoded Ed25519 signature and returns the public key embedded in it
+func verifyEd25519(msg []byte, sigBytes []byte) (ed25519.PublicKey, error) {
+	if !isEd25519SignatureBytes(sigBytes) {
+		return nil, errors.New("invalid ed25519 signature")
+	}
+	pub := ed25519.PublicKey(sigBytes[1 : 1+ed25519.PublicKeySize])
+	msgHash := keccak256(msg)
+	if !ed25519.Verify(pub, msgHash, sigBytes[1+ed25519.PublicKeySize:]) {
+		return nil, errors.New("ed25519 signature verification failed")
+	}
+	return pub, nil
+}
+
+func verifyEd25519WithKey(msg []byte, pub ed25519.PublicKey, sigBytes []byte) bool {
+	embeddedPub, err := verifyEd25519(msg, sigBytes)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(embeddedPub, pub)
+}
+
+// loadEd25519 loads an Ed25519 private key saved by saveEd25519. It returns an
+// error if the file does not hold an Ed25519 key.
+func loadEd25519(file string) (ed25519.PrivateKey, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, err
+	}
+	return ed25519PrivateKeyFromBytes(b)
+}
+
+func saveEd25519(file string, priv ed25519.PrivateKey) error {
+	k := hex.EncodeToString(fromEd25519(priv))
+	return ioutil.WriteFile(file, []byte(k), 0600)
+}
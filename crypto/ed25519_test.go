@@ -0,0 +1,190 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/rlp"
+)
+
+func TestEd25519SignAndVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	privKey, pubKey := TEST_GenerateEd25519KeyPairWithSeed("ed25519_seed")
+	assert.Equal(SchemeEd25519, privKey.Scheme())
+	assert.Equal(SchemeEd25519, pubKey.Scheme())
+	assert.False(pubKey.IsEmpty())
+	assert.Equal(pubKey.Address(), privKey.PublicKey().Address())
+
+	msg1 := common.Bytes("Hello world!")
+	msg2 := common.Bytes("Foo bar!")
+	sig, err := privKey.Sign(msg1)
+	assert.Nil(err)
+	assert.Equal(SchemeEd25519, sig.Scheme())
+	assert.Equal(ed25519SignatureLength, len(sig.ToBytes()))
+
+	assert.True(pubKey.VerifySignature(msg1, sig))
+	assert.True(sig.Verify(msg1, pubKey.Address()))
+	assert.False(pubKey.VerifySignature(msg2, sig))
+	assert.False(sig.Verify(msg2, pubKey.Address()))
+
+	address, err := sig.RecoverSignerAddress(msg1)
+	assert.Nil(err)
+	assert.Equal(pubKey.Address(), address)
+	_, err = sig.RecoverSignerAddress(msg2)
+	assert.NotNil(err)
+
+	// Tampered signature
+	tampered := common.Bytes(append([]byte{}, sig.ToBytes()...))
+	tampered[len(tampered)-1] ^= 0x01
+	tamperedSig, _ := SignatureFromBytes(tampered)
+	assert.False(tamperedSig.Verify(msg1, pubKey.Address()))
+
+	// Valid signature by another Ed25519 key, with the embedded public key swapped
+	otherPrivKey, otherPubKey := TEST_GenerateEd25519KeyPairWithSeed("another_ed25519_seed")
+	otherSig, err := otherPrivKey.Sign(msg1)
+	assert.Nil(err)
+	assert.False(otherSig.Verify(msg1, pubKey.Address()))
+	assert.False(pubKey.VerifySignature(msg1, otherSig))
+	swapped := common.Bytes(append([]byte{}, otherSig.ToBytes()...))
+	copy(swapped[1:], pubKey.ToBytes()[1:])
+	swappedSig, _ := SignatureFromBytes(swapped)
+	assert.False(swappedSig.Verify(msg1, pubKey.Address()))
+	assert.False(swappedSig.Verify(msg1, otherPubKey.Address()))
+}
+
+func TestEd25519CrossSchemeVerification(t *testing.T) {
+	assert := assert.New(t)
+
+	edPrivKey, edPubKey := TEST_GenerateEd25519KeyPairWithSeed("ed25519_seed")
+	secpPrivKey, secpPubKey, err := TEST_GenerateKeyPairWithSeed("secp256k1_seed")
+	assert.Nil(err)
+	assert.NotEqual(edPubKey.Address(), secpPubKey.Address())
+
+	msg := common.Bytes("cross scheme")
+	edSig, err := edPrivKey.Sign(msg)
+	assert.Nil(err)
+	secpSig, err := secpPrivKey.Sign(msg)
+	assert.Nil(err)
+
+	// An Ed25519 signature never verifies against a secp256k1 key or address
+	assert.False(secpPubKey.VerifySignature(msg, edSig))
+	assert.False(edSig.Verify(msg, secpPubKey.Address()))
+
+	// A secp256k1 signature never verifies against an Ed25519 key or address
+	assert.False(edPubKey.VerifySignature(msg, secpSig))
+	assert.False(secpSig.Verify(msg, edPubKey.Address()))
+
+	// Ed25519 addresses are not derived like the secp256k1 ones
+	assert.NotEqual(common.BytesToAddress(keccak256(edPubKey.ToBytes()[1:])[12:]), edPubKey.Address())
+}
+
+func TestSecp256k1SignatureUnchanged(t *testing.T) {
+	assert := assert.New(t)
+
+	skBytes, err := hex.DecodeString("93a90ea508331dfdf27fb79757d4250b4e84954927ba0073cd67454ac432c737")
+	assert.Nil(err)
+	privKey, err := PrivateKeyFromBytes(skBytes)
+	assert.Nil(err)
+	pubKey := privKey.PublicKey()
+	assert.Equal(SchemeSecp256k1, privKey.Scheme())
+	assert.Equal(SchemeSecp256k1, pubKey.Scheme())
+	assert.Equal(65, len(pubKey.ToBytes()))
+	assert.Equal(32, len(privKey.ToBytes()))
+	assert.Equal(common.HexToAddress("0x2E833968E5bB786Ae419c4d13189fB081Cc43bab"), pubKey.Address())
+
+	msg := common.Bytes("legacy message")
+	sig, err := privKey.Sign(msg)
+	assert.Nil(err)
+	assert.Equal(SchemeSecp256k1, sig.Scheme())
+	assert.Equal("a0ca395bdd38a5924bbac257ed6c7186ecb9e6b81ae67b8638d25d98330808e0423bfd8b420ae167785bc4a9d40c35889d8eba0c88df7598171740fd049be20b00",
+		hex.EncodeToString(sig.ToBytes()))
+	assert.True(sig.Verify(msg, pubKey.Address()))
+}
+
+func TestEd25519Encoding(t *testing.T) {
+	assert := assert.New(t)
+
+	privKey, pubKey := TEST_GenerateEd25519KeyPairWithSeed("ed25519_seed")
+
+	// Private key bytes
+	skBytes := privKey.ToBytes()
+	assert.Equal(ed25519PrivateKeyLength, len(skBytes))
+	assert.Equal(byte(SchemeEd25519), skBytes[0])
+	decodedPrivKey, err := PrivateKeyFromBytes(skBytes)
+	assert.Nil(err)
+	assert.Equal(pubKey.Address(), decodedPrivKey.PublicKey().Address())
+	assert.Nil(decodedPrivKey.D())
+	assert.Equal(pubKey.Address(), PrivateKeyFromBytesUnsafe(skBytes).PublicKey().Address())
+
+	// Public key bytes and RLP
+	pkBytes := pubKey.ToBytes()
+	assert.Equal(ed25519PublicKeyLength, len(pkBytes))
+	decodedPubKey, err := PublicKeyFromBytes(pkBytes)
+	assert.Nil(err)
+	assert.Equal(pubKey.Address(), decodedPubKey.Address())
+
+	encoded, err := rlp.EncodeToBytes(pubKey)
+	assert.Nil(err)
+	rlpPubKey := &PublicKey{}
+	assert.Nil(rlp.DecodeBytes(encoded, rlpPubKey))
+	assert.Equal(SchemeEd25519, rlpPubKey.Scheme())
+	assert.Equal(pubKey.Address(), rlpPubKey.Address())
+
+	// Signature RLP and JSON
+	msg := common.Bytes("encoding")
+	sig, err := privKey.Sign(msg)
+	assert.Nil(err)
+
+	encoded, err = rlp.EncodeToBytes(sig)
+	assert.Nil(err)
+	rlpSig := &Signature{}
+	assert.Nil(rlp.DecodeBytes(encoded, rlpSig))
+	assert.True(rlpSig.Verify(msg, pubKey.Address()))
+
+	jsonBytes, err := json.Marshal(sig)
+	assert.Nil(err)
+	jsonSig := &Signature{}
+	assert.Nil(json.Unmarshal(jsonBytes, jsonSig))
+	assert.True(jsonSig.Verify(msg, pubKey.Address()))
+
+	// Key file
+	dir, err := ioutil.TempDir("", "ed25519")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key")
+	assert.Nil(privKey.SaveToFile(keyFile))
+	loadedPrivKey, err := PrivateKeyFromFile(keyFile)
+	assert.Nil(err)
+	assert.Equal(pubKey.Address(), loadedPrivKey.PublicKey().Address())
+}
+
+func TestNewEd25519Signature(t *testing.T) {
+	assert := assert.New(t)
+
+	privKey, pubKey := TEST_GenerateEd25519KeyPairWithSeed("hsm_seed")
+	msg := common.Bytes("signed by an HSM")
+	sig, err := privKey.Sign(msg)
+	assert.Nil(err)
+
+	// Reassemble the signature from the raw 64-byte signature, as produced by an external signer
+	rawSig := sig.ToBytes()[ed25519PublicKeyLength:]
+	assembled, err := NewEd25519Signature(pubKey, rawSig)
+	assert.Nil(err)
+	assert.Equal(sig.ToBytes(), assembled.ToBytes())
+	assert.True(assembled.Verify(msg, pubKey.Address()))
+
+	_, err = NewEd25519Signature(pubKey, rawSig[1:])
+	assert.NotNil(err)
+
+	_, secpPubKey, err := TEST_GenerateKeyPairWithSeed("secp256k1_seed")
+	assert.Nil(err)
+	_, err = NewEd25519Signature(secpPubKey, rawSig)
+	assert.NotNil(err)
+}
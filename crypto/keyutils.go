@@ -214,24 +214,24 @@ func zeroBytes(bytes []byte) {
 
 // ----------------------- Crypto Utils for Other Modules ----------------------- //
 
-// PrivKeyToECDSA convert private key to ecdsa.
+// PrivKeyToECDSA convert private key to ecdsa. It returns nil for non-secp256k1 keys.
 func PrivKeyToECDSA(key *PrivateKey) *ecdsa.PrivateKey {
 	return key.privKey
 }
 
-// PubKeyToECDSA convert public key to ecdsa.
+// PubKeyToECDSA convert public key to ecdsa. It returns nil for non-secp256k1 keys.
 func PubKeyToECDSA(key *PublicKey) *ecdsa.PublicKey {
 	return key.pubKey
 }
 
 // ECDSAToPubKey converts given ecdsa public key to pubkey.
 func ECDSAToPubKey(p *ecdsa.PublicKey) *PublicKey {
-	return &PublicKey{p}
+	return &PublicKey{pubKey: p}
 }
 
 // ECDSAToPrivKey converts given ecdsa public key to pubkey.
 func ECDSAToPrivKey(p *ecdsa.PrivateKey) *PrivateKey {
-	return &PrivateKey{p}
+	return &PrivateKey{privKey: p}
 }
 
 // HexToECDSA parses a secp256k1 private key.
@@ -0,0 +1,68 @@
+package crypto
+
+import (
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/thetatoken/theta/common"
+)
+
+// DefaultSignatureCacheSize is the number of verified signatures a signature cache holds by default
+const DefaultSignatureCacheSize = 64 * 1024
+
+// SignatureCache is a concurrency-safe LRU cache of the signer addresses recovered from the signatures.
+// It is keyed by the hash of the signed message and the signature, so that the same transaction
+// verified in the mempool, in the block proposal and in the block application only pays for the
+// signature recovery once. Only the successful recoveries are cached.
+type SignatureCache struct {
+	cache *lru.Cache
+}
+
+// NewSignatureCache creates an instance of SignatureCache holding up to size signatures
+func NewSignatureCache(size int) *SignatureCache {
+	cache, err := lru.New(size)
+	if err != nil {
+		panic(err)
+	}
+	return &SignatureCache{
+		cache: cache,
+	}
+}
+
+// RecoverSignerAddress recovers the address of the signer for the given message, same as
+// Signature.RecoverSignerAddress. A nil cache recovers the address without caching it.
+func (sc *SignatureCache) RecoverSignerAddress(msg common.Bytes, sig *Signature) (common.Address, error) {
+	if sc == nil {
+		return sig.RecoverSignerAddress(msg)
+	}
+
+	key := signatureCacheKey(msg, sig)
+	if address, ok := sc.cache.Get(key); ok {
+		return address.(common.Address), nil
+	}
+	address, err := sig.RecoverSignerAddress(msg)
+	if err != nil {
+		return common.Address{}, err
+	}
+	sc.cache.Add(key, address)
+	return address, nil
+}
+
+// Verify verifies the signature with given raw message and address, same as Signature.Verify
+func (sc *SignatureCache) Verify(msg common.Bytes, sig *Signature, addr common.Address) bool {
+	if sig == nil || sig.IsEmpty() {
+		return false
+	}
+	recoveredAddress, err := sc.RecoverSignerAddress(msg, sig)
+	if err != nil {
+		return false
+	}
+	return recoveredAddress == addr
+}
+
+// Len returns the number of signatures in the cache
+func (sc *SignatureCache) Len() int {
+	return sc.cache.Len()
+}
+
+func signatureCacheKey(msg common.Bytes, sig *Signature) string {
+	return string(keccak256(msg)) + string(sig.ToBytes())
+}
@@ -2,6 +2,7 @@ package crypto
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 
 	"github.com/thetatoken/theta/common"
 )
@@ -34,3 +35,9 @@ func (trr *testRandReader) Read(b []byte) (int, error) {
 	n := copy(b[:], trr.seed)
 	return n, nil
 }
+
+// TEST_GenerateEd25519KeyPairWithSeed generates an Ed25519 private/public key pair deterministically from the given seed string
+func TEST_GenerateEd25519KeyPairWithSeed(seed string) (*PrivateKey, *PublicKey) {
+	edKey := ed25519.NewKeyFromSeed(keccak256([]byte(seed)))
+	return &PrivateKey{edKey: edKey}, &PublicKey{edKey: edKey.Public().(ed25519.PublicKey)}
+}
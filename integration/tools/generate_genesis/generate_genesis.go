@@ -129,6 +129,7 @@ func loadInitialBalances(erc20SnapshotJSONFilePath string) *state.StoreView {
 	}
 
 	json.Unmarshal(erc20BalanceMapByteValue, &erc20BalanceMap)
+	totalSupply := types.NewCoins(0, 0)
 	for key, val := range erc20BalanceMap {
 		if !common.IsHexAddress(key) {
 			panic(fmt.Sprintf("Invalid address: %v", key))
@@ -150,8 +151,10 @@ func loadInitialBalances(erc20SnapshotJSONFilePath string) *state.StoreView {
 			},
 		}
 		sv.SetAccount(acc.Address, acc)
+		totalSupply = totalSupply.Plus(acc.Balance)
 		//logger.Infof("address: %v, theta: %v, tfuel: %v", strings.ToLower(address.String()), theta, tfuel)
 	}
+	sv.UpdateTotalSupply(totalSupply)
 
 	return sv
 }
@@ -258,6 +261,7 @@ func sanityChecks(sv *state.StoreView) error {
 	tfuelWeiTotal := new(big.Int).SetUint64(0)
 
 	vcpAnalyzed := false
+	var totalSupply *types.Coins
 	sv.GetStore().Traverse(nil, func(key, val common.Bytes) bool {
 		if bytes.Compare(key, state.ValidatorCandidatePoolKey()) == 0 {
 			var vcp core.ValidatorCandidatePool
@@ -287,6 +291,12 @@ func sanityChecks(sv *state.StoreView) error {
 			if hl.Heights[0] != uint64(0) {
 				panic(fmt.Sprintf("Only height 0 should be in the genesis height list"))
 			}
+		} else if bytes.Compare(key, state.TotalSupplyKey()) == 0 {
+			totalSupply = &types.Coins{}
+			err := rlp.DecodeBytes(val, totalSupply)
+			if err != nil {
+				panic(fmt.Sprintf("Failed to decode the total supply: %v", err))
+			}
 		} else { // regular account
 			var account types.Account
 			err := rlp.DecodeBytes(val, &account)
@@ -337,5 +347,14 @@ func sanityChecks(sv *state.StoreView) error {
 	logger.Infof("Expected   TFuelWei total = %v", expectedTFuelWeiTotal)
 	logger.Infof("Calculated TFuelWei total = %v", tfuelWeiTotal)
 
+	// Check #4: the total supply tracked in the state matches the sums
+	if totalSupply == nil {
+		return fmt.Errorf("Total supply not detected in the genesis file")
+	}
+	if totalSupply.ThetaWei.Cmp(thetaWeiTotal) != 0 || totalSupply.TFuelWei.Cmp(tfuelWeiTotal) != 0 {
+		return fmt.Errorf("Unmatched total supply: expected = %v, calculated ThetaWei = %v, TFuelWei = %v",
+			totalSupply, thetaWeiTotal, tfuelWeiTotal)
+	}
+
 	return nil
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+func handleError(err error) {
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		printUsage()
+		os.Exit(1)
+	}
+}
+
+func printUsage() {
+	fmt.Println("Usage: reindex_txs -config=<path_to_config_home> -start=<start_height> -end=<end_height>")
+}
+
+func main() {
+	configPathPtr := flag.String("config", "", "path to ukuele config home")
+	startHeightPtr := flag.Uint64("start", 0, "height of the first block to index")
+	endHeightPtr := flag.Uint64("end", 0, "height of the last block to index")
+	flag.Parse()
+
+	configPath := *configPathPtr
+	startHeight := *startHeightPtr
+	endHeight := *endHeightPtr
+	if endHeight < startHeight {
+		printUsage()
+		os.Exit(1)
+	}
+
+	mainDBPath := path.Join(configPath, "db", "main")
+	refDBPath := path.Join(configPath, "db", "ref")
+	db, err := backend.NewLDBDatabase(mainDBPath, refDBPath, 256, 0)
+	handleError(err)
+	defer db.Close()
+
+	root := core.NewBlock()
+	store := kvstore.NewKVStore(db)
+	chain := blockchain.NewChain(root.ChainID, store, root)
+
+	numBlocks, numTxs, err := ledger.ReindexTxs(db, chain, startHeight, endHeight)
+	handleError(err)
+
+	fmt.Printf("Indexed %v txs of %v blocks from height %v to %v\n", numTxs, numBlocks, startHeight, endHeight)
+}
@@ -0,0 +1,120 @@
+package ledger
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+// balanceChangesKey constructs the DB key for the balance changes of the given block hash.
+func balanceChangesKey(blockHash common.Hash) common.Bytes {
+	return append(common.Bytes("bcj/"), blockHash[:]...)
+}
+
+// GetBalanceChanges returns the balance changes of the applied block with the given hash. The balance
+// changes are only recorded if the balance journal is enabled (see common.CfgLedgerBalanceJournalEnabled).
+func (ledger *Ledger) GetBalanceChanges(blockHash common.Hash) (*types.BlockBalanceChanges, error) {
+	store := kvstore.NewKVStore(ledger.state.DB())
+	changes := &types.BlockBalanceChanges{}
+	err := store.Get(balanceChangesKey(blockHash), changes)
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// saveBalanceChanges persists the balance changes of a block. It is called before the state of the block is
+// committed, like saveTxReceipts.
+func (ledger *Ledger) saveBalanceChanges(block *core.Block, journal *st.BalanceJournal) error {
+	changes := &types.BlockBalanceChanges{
+		BlockHash: block.Hash(),
+		Changes:   journal.Changes(),
+		Issuance:  journal.Issuance(),
+	}
+	store := kvstore.NewKVStore(ledger.state.DB())
+	err := store.Put(balanceChangesKey(changes.BlockHash), changes)
+	if err != nil {
+		return fmt.Errorf("Failed to save the balance changes for block %v: %v", changes.BlockHash.Hex(), err)
+	}
+	return nil
+}
+
+// executeTxsWithJournal executes the txs against the view one at a time, so that the balance changes
+// can be attributed to the txs. It stops at the first failed tx, same as executeTxs. The state keys
+// accessed by each tx are also recorded if recordAccess is set.
+func (ledger *Ledger) executeTxsWithJournal(txs []types.Tx, rawTxs []common.Bytes, view *st.StoreView, journal *st.BalanceJournal,
+	recordAccess bool) ([]result.Result, []*types.StateAccessList) {
+	var recorder *st.AccessRecorder
+	if recordAccess {
+		recorder = st.NewAccessRecorder()
+		view.SetAccessRecorder(recorder)
+		defer view.SetAccessRecorder(nil)
+	}
+
+	// The fees are split between burning and the proposer from common.HeightEnableFeeDistribution on, which
+	// is read off the state since the split is not reported by the executor
+	distributeFees := view.Height()+1 >= common.HeightEnableFeeDistribution // the view points to the parent block
+
+	results := []result.Result{}
+	var accessLists []*types.StateAccessList
+	for i, tx := range txs {
+		txHash := crypto.Keccak256Hash(rawTxs[i])
+		journal.SetTxHash(txHash)
+		var burnedFeesBefore, proposerFeesBefore types.Coins
+		if distributeFees {
+			burnedFeesBefore, proposerFeesBefore = view.GetBurnedFees(), view.GetUndistributedFees()
+		}
+		if recorder != nil {
+			recorder.Reset()
+		}
+		start := time.Now()
+		_, res := ledger.executor.ExecuteTxWithView(tx, view)
+		if ledger.instrumentationEnabled() {
+			ledger.instrumentation.ObserveTx(txTypeName(tx), time.Since(start))
+		}
+		results = append(results, res)
+		if recorder != nil {
+			accessLists = append(accessLists, recorder.AccessList())
+		}
+		if res.IsError() {
+			break
+		}
+
+		// The changes not made through the view: the burned fee, the fees set aside for the proposer, the burned
+		// coins and stakes, and the minted coins
+		claimedFees := types.NewCoins(0, 0)
+		if distributeFees {
+			burnedFeesAfter, proposerFeesAfter := view.GetBurnedFees(), view.GetUndistributedFees()
+			journal.RecordBurnedFee(burnedFeesAfter.Minus(burnedFeesBefore))
+			journal.RecordProposerFees(proposerFeesBefore, proposerFeesAfter)
+			if _, ok := tx.(*types.CoinbaseTx); ok {
+				claimedFees = proposerFeesBefore.Minus(proposerFeesAfter)
+			}
+		} else {
+			journal.RecordBurnedFee(newTxReceipt(txHash, tx, res).Fee)
+		}
+		switch tx := tx.(type) {
+		case *types.CoinbaseTx:
+			issued := types.NewCoins(0, 0)
+			for _, output := range tx.Outputs {
+				issued = issued.Plus(output.Coins.NoNil())
+			}
+			journal.RecordIssuance(issued.Minus(claimedFees)) // the claimed fees were issued already
+		case *types.BurnTx:
+			journal.RecordBurn(tx.Source.Coins)
+		case *types.DoubleSignSlashTx:
+			if slashedStake, ok := res.Info["slashedStake"].(types.Coins); ok {
+				journal.RecordBurn(slashedStake)
+			}
+		}
+	}
+	journal.SetTxHash(common.Hash{})
+	return results, accessLists
+}
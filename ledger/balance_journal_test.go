@@ -0,0 +1,237 @@
+package ledger
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+func TestLedgerBalanceJournal(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	viper.Set(common.CfgLedgerBalanceJournalEnabled, true)
+	defer viper.Set(common.CfgLedgerBalanceJournalEnabled, false)
+
+	rewardSchedule := func(blockHeight uint64, epoch uint64, validatorSet *core.ValidatorSet) *big.Int {
+		return big.NewInt(4000)
+	}
+	chainID, ledger, _ := newRewardTestLedger(rewardSchedule)
+	txFee := getMinimumTxFee()
+	minStake := core.MinValidatorStakeDeposit
+	holder := ledger.valMgr.GetValidatorSet(common.Hash{}).Validators()[0].Address
+
+	initBalance := types.Coins{
+		ThetaWei: new(big.Int).Mul(big.NewInt(10), minStake),
+		TFuelWei: big.NewInt(1000 * txFee),
+	}
+	staker := types.MakeAccWithInitBalance("staker", initBalance)
+	sender := types.MakeAccWithInitBalance("sender", initBalance)
+	reserver := types.MakeAccWithInitBalance("reserver", initBalance)
+	recipient := types.MakeAccWithInitBalance("recipient", types.NewCoins(0, 0))
+	view := ledger.state.Delivered()
+	for _, acc := range []types.PrivAccount{staker, sender, reserver, recipient} {
+		view.SetAccount(acc.Address, &acc.Account)
+	}
+	initSupply := types.NewCoins(1000000, 1000000*txFee)
+	view.UpdateTotalSupply(initSupply)
+	ledger.state.Commit()
+
+	checkpointHeight := common.HeightEnableValidatorReward
+	for !common.IsCheckPointHeight(checkpointHeight) {
+		checkpointHeight++
+	}
+	require.True(ledger.ResetState(checkpointHeight-1, ledger.state.Delivered().Hash()).IsOK())
+
+	applyBlock := func(height uint64, rawTxs ...common.Bytes) *core.Block {
+		for _, rawTx := range rawTxs {
+			require.Nil(ledger.mempool.InsertTransaction(rawTx))
+		}
+		parentRoot := ledger.state.Delivered().Hash()
+
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Epoch = 1
+		block.Height = height
+		stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+		require.Equal(len(rawTxs)+1, len(blockRawTxs))
+
+		require.True(ledger.ResetState(height-1, parentRoot).IsOK())
+		block.StateHash = stateRoot
+		block.Txs = blockRawTxs
+		res = ledger.ApplyBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+		return block
+	}
+
+	// Sum of the deltas of the given address, holding and asset, over the given changes
+	sumDeltas := func(changes []*types.BalanceChange, address common.Address, holding, asset string) *big.Int {
+		sum := new(big.Int)
+		for _, change := range changes {
+			if change.Address == address && change.Holding == holding && change.Asset == asset {
+				sum.Add(sum, change.Delta)
+			}
+		}
+		return sum
+	}
+
+	// The invariant: the coins only enter the circulation through the coinbase rewards, and the total supply
+	// tracks the issuance, the burned fees and the burned coins
+	supply := initSupply
+	checkTotalSupply := func(blockChanges *types.BlockBalanceChanges) {
+		for _, change := range blockChanges.Changes {
+			if change.Holding != types.HoldingBurnedFee && change.Holding != types.HoldingBurned {
+				continue
+			}
+			burned := types.NewCoins(0, 0)
+			if change.Asset == types.DenomThetaWei {
+				burned.ThetaWei = change.Delta
+			} else {
+				burned.TFuelWei = change.Delta
+			}
+			supply = supply.Minus(burned)
+		}
+		supply = supply.Plus(blockChanges.Issuance)
+		assert.Equal(supply, *ledger.state.Delivered().GetTotalSupply())
+	}
+	checkBalanceChanges := func(block *core.Block) *types.BlockBalanceChanges {
+		blockChanges, err := ledger.GetBalanceChanges(block.Hash())
+		require.Nil(err)
+		assert.Equal(block.Hash(), blockChanges.BlockHash)
+
+		thetaSum, tfuelSum := new(big.Int), new(big.Int)
+		for _, change := range blockChanges.Changes {
+			switch change.Asset {
+			case types.DenomThetaWei:
+				thetaSum.Add(thetaSum, change.Delta)
+			case types.DenomTFuelWei:
+				tfuelSum.Add(tfuelSum, change.Delta)
+			default:
+				assert.Fail("Unexpected asset", change.Asset)
+			}
+		}
+		assert.Equal(0, thetaSum.Sub(thetaSum, blockChanges.Issuance.ThetaWei).Sign())
+		assert.Equal(0, tfuelSum.Sub(tfuelSum, blockChanges.Issuance.TFuelWei).Sign())
+		checkTotalSupply(blockChanges)
+		return blockChanges
+	}
+
+	// Block #1: stake deposit, coin transfer and fund reservation
+	depositStakeTx := &types.DepositStakeTx{
+		Fee: types.NewCoins(0, txFee),
+		Source: types.TxInput{
+			Address:  staker.Address,
+			Coins:    types.Coins{ThetaWei: minStake, TFuelWei: big.NewInt(0)},
+			Sequence: 1,
+		},
+		Holder:  types.TxOutput{Address: holder},
+		Purpose: core.StakeForValidator,
+	}
+	depositStakeTx.Source.Signature = staker.Sign(depositStakeTx.SignBytes(chainID))
+	rawDepositStakeTx, err := types.TxToBytes(depositStakeTx)
+	require.Nil(err)
+	rawSendTx := newRawSendTx(chainID, 1, true, recipient, sender, false)
+	rawReserveFundTx := newRawReserveFundTx(chainID, 1, reserver, "rid001")
+
+	block1 := applyBlock(checkpointHeight, rawDepositStakeTx, rawSendTx, rawReserveFundTx)
+	changes1 := checkBalanceChanges(block1)
+	assert.Equal(int64(4000), changes1.Issuance.TFuelWei.Int64())
+	assert.Equal(0, changes1.Issuance.ThetaWei.Sign())
+
+	depositTxHash := crypto.Keccak256Hash(rawDepositStakeTx)
+	stakeDeposited := false
+	for _, change := range changes1.Changes {
+		if change.Address == staker.Address && change.Holding == types.HoldingStake {
+			assert.Equal(depositTxHash, change.TxHash)
+			assert.Equal(0, change.Delta.Cmp(minStake))
+			stakeDeposited = true
+		}
+	}
+	assert.True(stakeDeposited)
+	assert.Equal(big.NewInt(3*txFee), sumDeltas(changes1.Changes, common.Address{}, types.HoldingBurnedFee, types.DenomTFuelWei))
+	assert.Equal(big.NewInt(15), sumDeltas(changes1.Changes, recipient.Address, types.HoldingBalance, types.DenomThetaWei))
+	assert.Equal(big.NewInt(21*txFee), sumDeltas(changes1.Changes, reserver.Address, types.HoldingReservedFund, types.DenomTFuelWei))
+	assert.Equal(big.NewInt(-22*txFee), sumDeltas(changes1.Changes, reserver.Address, types.HoldingBalance, types.DenomTFuelWei))
+
+	// Block #2: stake withdrawal, the stake is locked until the return height
+	withdrawStakeTx := &types.WithdrawStakeTx{
+		Fee: types.NewCoins(0, txFee),
+		Source: types.TxInput{
+			Address:  staker.Address,
+			Sequence: 2,
+		},
+		Holder:  types.TxOutput{Address: holder},
+		Purpose: core.StakeForValidator,
+	}
+	withdrawStakeTx.Source.Signature = staker.Sign(withdrawStakeTx.SignBytes(chainID))
+	rawWithdrawStakeTx, err := types.TxToBytes(withdrawStakeTx)
+	require.Nil(err)
+
+	block2 := applyBlock(checkpointHeight+1, rawWithdrawStakeTx)
+	changes2 := checkBalanceChanges(block2)
+	assert.Equal(0, sumDeltas(changes2.Changes, staker.Address, types.HoldingStake, types.DenomThetaWei).Sign())
+	assert.Equal(big.NewInt(-txFee), sumDeltas(changes2.Changes, staker.Address, types.HoldingBalance, types.DenomTFuelWei))
+
+	// Block #3: the stake is returned at the return height, by none of the txs
+	returnHeight := block2.Height + core.ReturnLockingPeriod
+	require.True(ledger.ResetState(returnHeight-1, ledger.state.Delivered().Hash()).IsOK())
+	block3 := applyBlock(returnHeight)
+	changes3 := checkBalanceChanges(block3)
+	assert.Equal(new(big.Int).Neg(minStake), sumDeltas(changes3.Changes, staker.Address, types.HoldingStake, types.DenomThetaWei))
+	assert.Equal(minStake, sumDeltas(changes3.Changes, staker.Address, types.HoldingBalance, types.DenomThetaWei))
+	for _, change := range changes3.Changes {
+		if change.Address == staker.Address {
+			assert.Equal(common.Hash{}, change.TxHash)
+		}
+	}
+
+	// Block #4: a coin burn, from the fork height
+	burnTx := &types.BurnTx{
+		Fee: types.NewCoins(0, txFee),
+		Source: types.TxInput{
+			Address:  sender.Address,
+			Coins:    types.NewCoins(7, 3*txFee),
+			Sequence: 2,
+		},
+	}
+	burnTx.Source.Signature = sender.Sign(burnTx.SignBytes(chainID))
+	rawBurnTx, err := types.TxToBytes(burnTx)
+	require.Nil(err)
+
+	require.True(ledger.ResetState(common.HeightEnableBurn-1, ledger.state.Delivered().Hash()).IsOK())
+	block4 := applyBlock(common.HeightEnableBurn, rawBurnTx)
+	changes4 := checkBalanceChanges(block4)
+	assert.Equal(big.NewInt(7), sumDeltas(changes4.Changes, common.Address{}, types.HoldingBurned, types.DenomThetaWei))
+	assert.Equal(big.NewInt(3*txFee), sumDeltas(changes4.Changes, common.Address{}, types.HoldingBurned, types.DenomTFuelWei))
+	assert.Equal(big.NewInt(-4*txFee), sumDeltas(changes4.Changes, sender.Address, types.HoldingBalance, types.DenomTFuelWei))
+
+	// The balance deltas add up to the balance changes of the accounts
+	for _, acc := range []types.PrivAccount{staker, sender, reserver, recipient} {
+		balance := ledger.state.Delivered().GetAccount(acc.Address).Balance
+		for _, asset := range []string{types.DenomThetaWei, types.DenomTFuelWei} {
+			delta := new(big.Int)
+			for _, blockChanges := range []*types.BlockBalanceChanges{changes1, changes2, changes3, changes4} {
+				delta.Add(delta, sumDeltas(blockChanges.Changes, acc.Address, types.HoldingBalance, asset))
+			}
+			expected := new(big.Int).Sub(balance.ThetaWei, acc.Balance.ThetaWei)
+			if asset == types.DenomTFuelWei {
+				expected = new(big.Int).Sub(balance.TFuelWei, acc.Balance.TFuelWei)
+			}
+			assert.Equal(0, expected.Cmp(delta), "%v %v", acc.Address.Hex(), asset)
+		}
+	}
+
+	// No balance changes are recorded while the journal is disabled
+	viper.Set(common.CfgLedgerBalanceJournalEnabled, false)
+	block5 := applyBlock(block4.Height + 1)
+	_, err = ledger.GetBalanceChanges(block5.Hash())
+	assert.NotNil(err)
+}
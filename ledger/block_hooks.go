@@ -0,0 +1,93 @@
+package ledger
+
+import (
+	"sync"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+// BlockPreHook is invoked before the transactions of a block are applied, with the view of the state the
+// block extends. Returning an error vetoes the block, which is then not applied.
+type BlockPreHook func(view LedgerView, txs []common.Bytes) error
+
+// BlockPostHook is invoked after a block is applied and the resulting state is committed, with the view of
+// the committed state and the receipts of the block transactions
+type BlockPostHook func(view LedgerView, receipts []*types.TxReceipt)
+
+type blockHook struct {
+	pre  BlockPreHook
+	post BlockPostHook
+}
+
+type blockHooks struct {
+	mu    *sync.Mutex
+	hooks []*blockHook
+}
+
+func newBlockHooks() *blockHooks {
+	return &blockHooks{
+		mu:    &sync.Mutex{},
+		hooks: []*blockHook{},
+	}
+}
+
+// RegisterBlockHook registers the callbacks to run at the boundaries of the block application, either of
+// which can be nil. The callbacks are invoked synchronously with the ledger lock held, in the order they
+// are registered, so they must not call back into the methods of the ledger that acquire the lock.
+func (ledger *Ledger) RegisterBlockHook(pre BlockPreHook, post BlockPostHook) {
+	ledger.blockHooks.add(&blockHook{pre: pre, post: post})
+}
+
+func (bh *blockHooks) add(hook *blockHook) {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	bh.hooks = append(bh.hooks, hook)
+}
+
+func (bh *blockHooks) snapshot() []*blockHook {
+	if bh == nil { // e.g. the scratch ledgers
+		return nil
+	}
+
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	return bh.hooks[:len(bh.hooks):len(bh.hooks)]
+}
+
+// runPreBlockHooks runs the pre-hooks against the committed state, and stops at the first veto
+func (ledger *Ledger) runPreBlockHooks(txs []common.Bytes) result.Result {
+	hooks := ledger.blockHooks.snapshot()
+	if len(hooks) == 0 {
+		return result.OK
+	}
+
+	view := ledger.View()
+	for _, hook := range hooks {
+		if hook.pre == nil {
+			continue
+		}
+		if err := hook.pre(view, txs); err != nil {
+			return result.Error("Block vetoed by pre-block hook: %v", err).WithErrorCode(result.CodeBlockVetoedByHook)
+		}
+	}
+	return result.OK
+}
+
+// runPostBlockHooks runs the post-hooks against the committed state
+func (ledger *Ledger) runPostBlockHooks(receipts []*types.TxReceipt) {
+	hooks := ledger.blockHooks.snapshot()
+	if len(hooks) == 0 {
+		return
+	}
+
+	view := ledger.View()
+	for _, hook := range hooks {
+		if hook.post != nil {
+			hook.post(view, receipts)
+		}
+	}
+}
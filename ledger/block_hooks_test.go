@@ -0,0 +1,102 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+func TestLedgerBlockHooks(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, _ := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 3)
+	blacklisted := accIns[1].Address
+
+	calls := []string{}
+	vetoBlacklisted := func(view LedgerView, txs []common.Bytes) error {
+		calls = append(calls, fmt.Sprintf("pre1@%v", view.Height()))
+		for _, rawTx := range txs {
+			tx, err := types.TxFromBytes(rawTx)
+			if err != nil {
+				return err
+			}
+			if sendTx, ok := tx.(*types.SendTx); ok {
+				for _, input := range sendTx.Inputs {
+					if input.Address == blacklisted {
+						return errors.New("blacklisted address")
+					}
+				}
+			}
+		}
+		return nil
+	}
+	var postReceipts []*types.TxReceipt
+	var postBalance types.Coins
+	ledger.RegisterBlockHook(vetoBlacklisted, func(view LedgerView, receipts []*types.TxReceipt) {
+		calls = append(calls, fmt.Sprintf("post1@%v", view.Height()))
+		postReceipts = receipts
+		postBalance = view.GetAccount(accIns[0].Address).Balance
+	})
+	ledger.RegisterBlockHook(func(view LedgerView, txs []common.Bytes) error {
+		calls = append(calls, fmt.Sprintf("pre2@%v", view.Height()))
+		return nil
+	}, nil)
+	ledger.RegisterBlockHook(nil, func(view LedgerView, receipts []*types.TxReceipt) {
+		calls = append(calls, fmt.Sprintf("post3@%v", view.Height()))
+	})
+
+	newBlock := func(rawTxs ...common.Bytes) *core.Block {
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = ledger.state.Height() + 1
+		block.StateHash = simulateBlockStateRoot(t, ledger, rawTxs...)
+		block.Txs = rawTxs
+		return block
+	}
+
+	// The hooks run in the registration order, the post-hooks against the committed state
+	height := ledger.state.Height()
+	rawTx := newRawSendTx(chainID, 1, true, accOut, accIns[0], false)
+	res := ledger.ApplyBlockTxs(newBlock(rawTx))
+	require.True(res.IsOK(), res.Message)
+	assert.Equal([]string{
+		fmt.Sprintf("pre1@%v", height),
+		fmt.Sprintf("pre2@%v", height),
+		fmt.Sprintf("post1@%v", height+1),
+		fmt.Sprintf("post3@%v", height+1),
+	}, calls)
+	require.Equal(1, len(postReceipts))
+	assert.True(postReceipts[0].IsOK())
+	assert.True(postBalance.IsEqual(ledger.state.Delivered().GetAccount(accIns[0].Address).Balance))
+
+	// The block with a tx from the blacklisted address is vetoed before any tx is executed
+	calls = []string{}
+	baseRoot := ledger.state.Delivered().Hash()
+	block := newBlock(newRawSendTx(chainID, 1, true, accOut, accIns[2], false),
+		newRawSendTx(chainID, 1, true, accOut, accIns[1], false))
+	receipts, res := ledger.ApplyBlockTxsWithReceipts(block)
+	assert.Equal(result.CodeBlockVetoedByHook, res.Code)
+	assert.Contains(res.Message, "blacklisted address")
+	assert.Equal(0, len(receipts))
+	assert.Equal([]string{fmt.Sprintf("pre1@%v", height+1)}, calls)
+	assert.Equal(baseRoot, ledger.state.Delivered().Hash())
+	assert.Equal(uint64(0), ledger.state.Delivered().GetAccount(accIns[2].Address).Sequence)
+
+	// The post-hooks do not run if the block fails
+	calls = []string{}
+	block = newBlock(newRawSendTx(chainID, 1, true, accOut, accIns[2], false))
+	block.StateHash = common.Hash{}
+	res = ledger.ApplyBlockTxs(block)
+	assert.Equal(result.CodeStateRootMismatch, res.Code)
+	assert.Equal([]string{fmt.Sprintf("pre1@%v", height+1), fmt.Sprintf("pre2@%v", height+1)}, calls)
+	assert.Equal(baseRoot, ledger.state.Delivered().Hash())
+}
@@ -0,0 +1,102 @@
+package ledger
+
+import (
+	"bytes"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+// callCache is an LRU cache of the outcomes of the simulated read-only contract calls, e.g. the repeated
+// balanceOf queries of the wallets. A call is keyed by the hash of the raw tx, which covers the callee, the input
+// data and the value, as well as the caller, the sequence and the gas the outcome depends on. Since the
+// simulations run against the latest committed state, the cache only holds the calls of a single state root, and
+// is emptied as soon as a call is looked up at another root.
+type callCache struct {
+	mu    *sync.Mutex
+	root  common.Hash
+	cache *lru.Cache // the hash of the raw tx -> *cachedCall
+}
+
+type cachedCall struct {
+	simResult *TxSimulationResult
+	res       result.Result
+}
+
+// newCallCache creates an instance of callCache holding up to size calls, or returns nil if size is not positive
+func newCallCache(size int) *callCache {
+	if size <= 0 {
+		return nil
+	}
+	cache, err := lru.New(size)
+	if err != nil {
+		panic(err)
+	}
+	return &callCache{
+		mu:    &sync.Mutex{},
+		cache: cache,
+	}
+}
+
+// get returns the outcome of the call simulated against the given state root, if cached
+func (cc *callCache) get(root common.Hash, rawTx common.Bytes) (*TxSimulationResult, result.Result, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if root != cc.root {
+		cc.cache.Purge()
+		cc.root = root
+		return nil, result.Result{}, false
+	}
+	call, ok := cc.cache.Get(crypto.Keccak256Hash(rawTx))
+	if !ok {
+		return nil, result.Result{}, false
+	}
+	return call.(*cachedCall).simResult, call.(*cachedCall).res, true
+}
+
+// add caches the outcome of the call simulated against the given state root, unless the cache has moved on to
+// another root meanwhile
+func (cc *callCache) add(root common.Hash, rawTx common.Bytes, simResult *TxSimulationResult, res result.Result) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if root != cc.root {
+		return
+	}
+	cc.cache.Add(crypto.Keccak256Hash(rawTx), &cachedCall{simResult: simResult, res: res})
+}
+
+// len returns the number of calls in the cache
+func (cc *callCache) len() int {
+	return cc.cache.Len()
+}
+
+// isReadOnlyCall returns whether the simulated contract call wrote nothing but the fee and the sequence charged to
+// the caller, according to the keys written during the simulation
+func isReadOnlyCall(tx *types.SmartContractTx, accessList *types.StateAccessList) bool {
+	allowed := []common.Bytes{
+		state.AccountKey(tx.From.Address),
+		state.TotalSupplyKey(),
+		state.BurnedFeesKey(),
+		state.UndistributedFeesKey(),
+	}
+	for _, key := range accessList.Writes {
+		isAllowed := false
+		for _, allowedKey := range allowed {
+			if bytes.Equal(key, allowedKey) {
+				isAllowed = true
+				break
+			}
+		}
+		if !isAllowed {
+			return false
+		}
+	}
+	return true
+}
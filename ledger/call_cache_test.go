@@ -0,0 +1,122 @@
+package ledger
+
+import (
+	"math/big"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+func TestLedgerSimulateCachedCall(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, _ := newTestLedger()
+	_, accIns := prepareInitLedgerState(ledger, 1)
+	caller := accIns[0]
+
+	// ASM:
+	// push 0x0, sload, push 0x0, mstore, push 0x20, push 0x0, return
+	readerAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	ledger.state.Delivered().SetCode(readerAddr, common.Hex2Bytes("60005460005260206000f3"))
+	ledger.state.Delivered().SetState(readerAddr, common.Hash{}, common.BigToHash(big.NewInt(42)))
+
+	// ASM:
+	// push 0x1, push 0x0, sstore, stop
+	writerAddr := common.HexToAddress("0x1000000000000000000000000000000000000002")
+	ledger.state.Delivered().SetCode(writerAddr, common.Hex2Bytes("600160005500"))
+	ledger.state.Commit()
+
+	newRawCallTx := func(to common.Address, value int64) common.Bytes {
+		tx := &types.SmartContractTx{
+			From:     types.TxInput{Address: caller.Address, Coins: types.NewCoins(0, value), Sequence: 1},
+			To:       types.TxOutput{Address: to},
+			GasLimit: 100000,
+			GasPrice: new(big.Int).SetUint64(types.MinimumGasPrice),
+		}
+		tx.From.Signature = caller.Sign(tx.SignBytes(chainID))
+		rawTx, err := types.TxToBytes(tx)
+		require.Nil(err)
+		return rawTx
+	}
+
+	// The read-only calls are cached
+	readTx := newRawCallTx(readerAddr, 0)
+	simResult, res := ledger.SimulateTx(readTx)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(common.BigToHash(big.NewInt(42)).Bytes(), []byte(simResult.VmReturn))
+	assert.Equal(1, ledger.callCache.len())
+
+	cachedResult, cachedRes := ledger.SimulateTx(readTx)
+	assert.True(simResult == cachedResult)
+	assert.Equal(res, cachedRes)
+
+	// Unlike the calls writing the state, including with a transfer of value
+	for _, rawTx := range []common.Bytes{newRawCallTx(writerAddr, 0), newRawCallTx(readerAddr, 1)} {
+		simResult, res := ledger.SimulateTx(rawTx)
+		require.True(res.IsOK(), res.Message)
+		assert.Empty(simResult.Receipt.Message)
+		cachedResult, _ := ledger.SimulateTx(rawTx)
+		assert.False(simResult == cachedResult)
+	}
+	assert.Equal(1, ledger.callCache.len())
+
+	// A new state root busts the cache
+	ledger.state.Delivered().SetState(readerAddr, common.Hash{}, common.BigToHash(big.NewInt(43)))
+	ledger.state.Commit()
+	simResult, res = ledger.SimulateTx(readTx)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(common.BigToHash(big.NewInt(43)).Bytes(), []byte(simResult.VmReturn))
+	assert.Equal(1, ledger.callCache.len())
+
+	// The calls are simulated as usual without the cache
+	ledger.callCache = newCallCache(0)
+	assert.Nil(ledger.callCache)
+	uncachedResult, res := ledger.SimulateTx(readTx)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(simResult, uncachedResult)
+}
+
+func BenchmarkLedgerSimulateCachedCall(b *testing.B) {
+	log.SetLevel(log.WarnLevel)
+	defer log.SetLevel(log.DebugLevel)
+
+	chainID, ledger, _ := newTestLedger()
+	_, accIns := prepareInitLedgerState(ledger, 1)
+	caller := accIns[0]
+
+	// A loop reading the storage, as costly as a token balance lookup
+	// ASM:
+	// push 0x20, jumpdest, push 0x1, swap1, sub, dup1, sload, pop, dup1, push 0x2, jumpi, push 0x0, mstore, push 0x20, push 0x0, return
+	readerAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	ledger.state.Delivered().SetCode(readerAddr, common.Hex2Bytes("60205b600190038054508060025760005260206000f3"))
+	ledger.state.Commit()
+
+	tx := &types.SmartContractTx{
+		From:     types.TxInput{Address: caller.Address, Sequence: 1},
+		To:       types.TxOutput{Address: readerAddr},
+		GasLimit: 100000,
+		GasPrice: new(big.Int).SetUint64(types.MinimumGasPrice),
+	}
+	tx.From.Signature = caller.Sign(tx.SignBytes(chainID))
+	rawTx, err := types.TxToBytes(tx)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	run := func(b *testing.B, cache *callCache) {
+		ledger.callCache = cache
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, res := ledger.SimulateTx(rawTx); res.IsError() {
+				b.Fatal(res.Message)
+			}
+		}
+	}
+	b.Run("uncached", func(b *testing.B) { run(b, nil) })
+	b.Run("cached", func(b *testing.B) { run(b, newCallCache(16)) })
+}
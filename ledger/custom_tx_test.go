@@ -0,0 +1,218 @@
+package ledger
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	exec "github.com/thetatoken/theta/ledger/execution"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+// TxRegistryUpdate is the type of registryUpdateTx, an example of the custom txs an embedder can register
+const TxRegistryUpdate = types.CustomTxTypeBase + 1
+
+// registryUpdateTx sets the value of a name in an on-chain registry. A name belongs to the account which
+// sets it first, and only its owner can update it afterwards.
+type registryUpdateTx struct {
+	Fee   types.Coins
+	Owner types.TxInput
+	Name  string
+	Value common.Bytes
+}
+
+// registryEntry is the value of a name in the registry
+type registryEntry struct {
+	Owner common.Address
+	Value common.Bytes
+}
+
+func (tx *registryUpdateTx) AssertIsTx() {}
+
+func (tx *registryUpdateTx) SignBytes(chainID string) []byte {
+	return types.CustomTxSignBytes(chainID, tx)
+}
+
+func (tx *registryUpdateTx) Hash() common.Hash {
+	return types.CustomTxHash(tx)
+}
+
+func (tx *registryUpdateTx) Validate() result.Result {
+	if len(tx.Name) == 0 {
+		return result.Error("The name needs to be set").WithErrorCode(result.CodeInvalidTxFormat)
+	}
+	return types.ValidateCustomTx(tx)
+}
+
+func (tx *registryUpdateTx) GetInput() *types.TxInput {
+	return &tx.Owner
+}
+
+func (tx *registryUpdateTx) GetFee() *types.Coins {
+	return &tx.Fee
+}
+
+func getRegistryEntry(state exec.TxStateReader, name string) *registryEntry {
+	data := state.Get(common.Bytes(name))
+	if data == nil {
+		return nil
+	}
+	entry := &registryEntry{}
+	if err := types.FromBytes(data, entry); err != nil {
+		panic(err)
+	}
+	return entry
+}
+
+func screenRegistryUpdateTx(chainID string, state exec.TxStateReader, transaction types.CustomTx) result.Result {
+	tx := transaction.(*registryUpdateTx)
+	if entry := getRegistryEntry(state, tx.Name); entry != nil && entry.Owner != tx.Owner.Address {
+		return result.Error("Name %v is owned by %v", tx.Name, entry.Owner.Hex()).WithErrorCode(result.CodeUnauthorizedTx)
+	}
+	return result.OK
+}
+
+func executeRegistryUpdateTx(chainID string, state exec.TxState, transaction types.CustomTx) result.Result {
+	tx := transaction.(*registryUpdateTx)
+	if res := screenRegistryUpdateTx(chainID, state, tx); res.IsError() {
+		return res
+	}
+	data, err := types.ToBytes(&registryEntry{Owner: tx.Owner.Address, Value: tx.Value})
+	if err != nil {
+		return result.Error("Failed to encode the registry entry: %v", err)
+	}
+	state.Set(common.Bytes(tx.Name), data)
+	return result.OK
+}
+
+func init() {
+	types.RegisterTxType(TxRegistryUpdate, func() types.CustomTx { return &registryUpdateTx{} })
+	exec.RegisterTxExecutor(TxRegistryUpdate, screenRegistryUpdateTx, executeRegistryUpdateTx)
+}
+
+func newRawRegistryUpdateTx(chainID string, owner types.PrivAccount, sequence uint64, name string, value string) common.Bytes {
+	tx := &registryUpdateTx{
+		Fee:   types.NewCoins(0, getMinimumTxFee()),
+		Owner: types.TxInput{Address: owner.Address, Sequence: sequence},
+		Name:  name,
+		Value: common.Bytes(value),
+	}
+	tx.Owner.Signature = owner.Sign(tx.SignBytes(chainID))
+	rawTx, err := types.TxToBytes(tx)
+	if err != nil {
+		panic(err)
+	}
+	return rawTx
+}
+
+func TestLedgerCustomTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, mempool := newTestLedger()
+	_, accIns := prepareInitLedgerState(ledger, 2)
+	owner, other := accIns[0], accIns[1]
+
+	// The core checks are applied before the screener, e.g. the signature
+	forgedTx := newRawRegistryUpdateTx(chainID, other, 1, "theta", "v1")
+	forged, err := types.TxFromBytes(forgedTx)
+	require.Nil(err)
+	forged.(*registryUpdateTx).Owner.Address = owner.Address
+	forgedTx, err = types.TxToBytes(forged)
+	require.Nil(err)
+	_, res := ledger.ScreenTx(forgedTx)
+	assert.Equal(result.CodeInvalidSignature, res.Code)
+
+	// The custom txs are ordered in the mempool by their input
+	registerTx := newRawRegistryUpdateTx(chainID, owner, 1, "theta", "v1")
+	decoded, err := types.TxFromBytes(registerTx)
+	require.Nil(err)
+	txInfo, res := ledger.executor.GetTxInfo(decoded)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(owner.Address, txInfo.Address)
+	assert.Equal(uint64(1), txInfo.Sequence)
+
+	// Propose and apply a block with the custom tx, screened by the registered screener
+	require.Nil(mempool.InsertTransaction(registerTx))
+	stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	require.Equal(1, len(blockRawTxs))
+	assert.True(bytes.Equal(registerTx, blockRawTxs[0]))
+
+	block := &core.Block{BlockHeader: &core.BlockHeader{StateHash: stateRoot}, Txs: blockRawTxs}
+	receipts, res := ledger.ApplyBlockTxsWithReceipts(block)
+	require.True(res.IsOK(), res.Message)
+	require.Equal(1, len(receipts))
+	assert.True(receipts[0].IsOK())
+	assert.True(types.NewCoins(0, getMinimumTxFee()).IsEqual(receipts[0].Fee))
+
+	// The entry is stored in the key space of the tx type, and the fee is charged to the owner
+	view := ledger.state.Delivered()
+	data := view.Get(state.CustomTxDataKey(TxRegistryUpdate, common.Bytes("theta")))
+	require.NotNil(data)
+	entry := &registryEntry{}
+	require.Nil(types.FromBytes(data, entry))
+	assert.Equal(owner.Address, entry.Owner)
+	assert.Equal(common.Bytes("v1"), entry.Value)
+	assert.Nil(view.Get(common.Bytes("theta")))
+	ownerAccount := view.GetAccount(owner.Address)
+	assert.Equal(uint64(1), ownerAccount.Sequence)
+	assert.True(owner.Balance.Minus(types.NewCoins(0, getMinimumTxFee())).IsEqual(ownerAccount.Balance))
+
+	// The screener rejects the update of the name by another account, the owner can update it
+	ledger.state.Screened().Set(state.CustomTxDataKey(TxRegistryUpdate, common.Bytes("theta")), data)
+	_, res = ledger.ScreenTx(newRawRegistryUpdateTx(chainID, other, 1, "theta", "v2"))
+	assert.Equal(result.CodeUnauthorizedTx, res.Code)
+
+	// The block including an update rejected by the executor is invalid
+	block = &core.Block{BlockHeader: &core.BlockHeader{}, Txs: []common.Bytes{
+		newRawRegistryUpdateTx(chainID, owner, 2, "theta", "v2"),
+		newRawRegistryUpdateTx(chainID, other, 1, "theta", "v3"),
+	}}
+	receipts, res = ledger.ApplyBlockTxsWithReceipts(block)
+	require.True(res.IsError())
+	require.Equal(2, len(receipts))
+	assert.True(receipts[0].IsOK())
+	assert.Equal(uint64(result.CodeUnauthorizedTx), receipts[1].Code)
+}
+
+func TestRegisterCustomTxType(t *testing.T) {
+	assert := assert.New(t)
+
+	// The core tx types can not be overridden
+	assert.Panics(func() {
+		types.RegisterTxType(types.TxSend, func() types.CustomTx { return &registryUpdateTx{} })
+	})
+	assert.Panics(func() {
+		exec.RegisterTxExecutor(types.TxSend, screenRegistryUpdateTx, executeRegistryUpdateTx)
+	})
+
+	// Neither can the registered ones
+	assert.Panics(func() {
+		types.RegisterTxType(TxRegistryUpdate, func() types.CustomTx { return &registryUpdateTx{} })
+	})
+	assert.Panics(func() {
+		exec.RegisterTxExecutor(TxRegistryUpdate, screenRegistryUpdateTx, executeRegistryUpdateTx)
+	})
+
+	// The executors are only registered for the registered tx types
+	assert.Panics(func() {
+		exec.RegisterTxExecutor(TxRegistryUpdate+1, screenRegistryUpdateTx, executeRegistryUpdateTx)
+	})
+
+	// The txs of the unregistered custom types can not be decoded
+	raw, err := types.TxToBytes(&registryUpdateTx{Fee: types.NewCoins(0, 1), Name: "theta"})
+	assert.Nil(err)
+	raw[2]++ // the low byte of the tx type
+	_, err = types.TxFromBytes(raw)
+	assert.NotNil(err)
+
+	txType, err := types.PeekTxType(raw)
+	assert.Nil(err)
+	assert.Equal(TxRegistryUpdate+1, txType)
+}
@@ -0,0 +1,107 @@
+package ledger
+
+import (
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/metrics"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+const metricDroppedBlockAppliedEvents = "ledger/events/dropped"
+
+// BalanceChange describes how the block changes the balance of an account
+type BalanceChange struct {
+	Address common.Address
+	Before  types.Coins
+	After   types.Coins
+}
+
+// BlockAppliedEvent is published after a block is successfully applied and committed
+type BlockAppliedEvent struct {
+	BlockHash      common.Hash
+	Height         uint64
+	StateRoot      common.Hash
+	Txs            []common.Bytes
+	Receipts       []*types.TxReceipt
+	BalanceChanges []*BalanceChange // of the accounts touched by the txs, only those actually changed
+}
+
+//
+// BlockAppliedSubscription receives the BlockAppliedEvents in the order the blocks are applied.
+// Its buffer is bounded, and the block application never waits for the subscriber: when the
+// buffer is full, the new event is dropped and counted. A gap in the heights of the received
+// events indicates dropped events.
+//
+type BlockAppliedSubscription struct {
+	*common.FeedSubscription
+	events chan *BlockAppliedEvent
+}
+
+// Events returns the channel of the events, which is closed on Unsubscribe()
+func (sub *BlockAppliedSubscription) Events() <-chan *BlockAppliedEvent {
+	return sub.events
+}
+
+func newBlockAppliedFeed() *common.BoundedFeed {
+	return common.NewBoundedFeed(metrics.GetOrRegisterCounter(metricDroppedBlockAppliedEvents, nil))
+}
+
+// SubscribeBlockApplied subscribes to the events of the successfully applied blocks, buffering up
+// to bufferSize events. The blocks failing the execution or the state root check are not published.
+func (ledger *Ledger) SubscribeBlockApplied(bufferSize int) *BlockAppliedSubscription {
+	events := make(chan *BlockAppliedEvent, bufferSize)
+	return &BlockAppliedSubscription{
+		FeedSubscription: ledger.blockAppliedFeed.Subscribe(events),
+		events:           events,
+	}
+}
+
+// publishBlockApplied publishes the event of the block just committed on top of the given state
+func (ledger *Ledger) publishBlockApplied(block *core.Block, receipts []*types.TxReceipt, parentHeight uint64, parentStateRoot common.Hash) {
+	if !ledger.blockAppliedFeed.HasSubscribers() {
+		return
+	}
+
+	before := st.NewStoreView(parentHeight, parentStateRoot, ledger.state.DB())
+	after := ledger.state.Delivered()
+
+	balanceChanges := []*BalanceChange{}
+	seen := make(map[common.Address]bool)
+	for _, rawTx := range block.Txs {
+		tx, err := types.TxFromBytes(rawTx)
+		if err != nil {
+			continue
+		}
+		for _, address := range getTxAddresses(after.GetSplitRule, tx) {
+			if seen[address] {
+				continue
+			}
+			seen[address] = true
+
+			change := &BalanceChange{
+				Address: address,
+				Before:  types.NewCoins(0, 0),
+				After:   types.NewCoins(0, 0),
+			}
+			if account := before.GetAccount(address); account != nil {
+				change.Before = account.Balance
+			}
+			if account := after.GetAccount(address); account != nil {
+				change.After = account.Balance
+			}
+			if !change.Before.IsEqual(change.After) {
+				balanceChanges = append(balanceChanges, change)
+			}
+		}
+	}
+
+	ledger.blockAppliedFeed.Publish(&BlockAppliedEvent{
+		BlockHash:      block.Hash(),
+		Height:         block.Height,
+		StateRoot:      block.StateHash,
+		Txs:            block.Txs,
+		Receipts:       receipts,
+		BalanceChanges: balanceChanges,
+	})
+}
@@ -0,0 +1,82 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+func TestLedgerBlockAppliedEvents(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 3)
+
+	sub := ledger.SubscribeBlockApplied(1)
+	slowSub := ledger.SubscribeBlockApplied(0)
+
+	applyNextBlock := func(accIn types.PrivAccount, corruptStateRoot bool) *core.Block {
+		require.Nil(mempool.InsertTransaction(newRawSendTx(chainID, 1, true, accOut, accIn, false)))
+		stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+		require.True(res.IsOK(), res.Message)
+
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = ledger.state.Height()
+		block.StateHash = stateRoot
+		if corruptStateRoot {
+			block.StateHash[0]++
+		}
+		block.Txs = blockRawTxs
+		res = ledger.ApplyBlockTxs(block)
+		require.Equal(!corruptStateRoot, res.IsOK(), res.Message)
+		return block
+	}
+
+	accOutBalance := ledger.View().GetAccount(accOut.Address).Balance
+	accInBalance := ledger.View().GetAccount(accIns[0].Address).Balance
+	block := applyNextBlock(accIns[0], false)
+
+	event := <-sub.Events()
+	assert.Equal(block.Hash(), event.BlockHash)
+	assert.Equal(block.Height, event.Height)
+	assert.Equal(block.StateHash, event.StateRoot)
+	assert.Equal(block.Txs, event.Txs)
+	require.Equal(1, len(event.Receipts))
+	assert.True(event.Receipts[0].IsOK())
+
+	require.Equal(2, len(event.BalanceChanges))
+	changes := make(map[common.Address]*BalanceChange)
+	for _, change := range event.BalanceChanges {
+		changes[change.Address] = change
+	}
+	assert.Equal(accInBalance, changes[accIns[0].Address].Before)
+	assert.True(changes[accIns[0].Address].Before.Minus(changes[accIns[0].Address].After).IsEqual(types.NewCoins(15, getMinimumTxFee())))
+	assert.Equal(accOutBalance, changes[accOut.Address].Before)
+	assert.True(changes[accOut.Address].After.Minus(changes[accOut.Address].Before).IsEqual(types.NewCoins(15, 0)))
+
+	// No events for the blocks failing the state root check
+	applyNextBlock(accIns[1], true)
+	select {
+	case event := <-sub.Events():
+		assert.Fail("Unexpected event", "height %v", event.Height)
+	default:
+	}
+
+	// The slow subscribers do not block the block application, the events are dropped instead
+	block = applyNextBlock(accIns[2], false)
+	assert.Equal(uint64(0), sub.NumDropped())
+	assert.Equal(uint64(2), slowSub.NumDropped())
+	event = <-sub.Events()
+	assert.Equal(block.Hash(), event.BlockHash)
+
+	sub.Unsubscribe()
+	_, ok := <-sub.Events()
+	assert.False(ok)
+	slowSub.Unsubscribe()
+}
@@ -0,0 +1,200 @@
+package execution
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/crypto"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/ledger/vm"
+)
+
+//
+// The stake precompiled contracts let a contract, e.g. a staking pool, deposit and withdraw its own stake, with the
+// same checks and stake transitions as the DepositStakeTx and the WithdrawStakeTx. The source of the stake is the
+// contract calling the precompiled contract, and the stake is paid out of its ThetaWei balance, then returned to it
+// after the locking period like any withdrawn stake. The inputs are ABI encoded words, i.e. abi.encode(holder,
+// purpose, amount) for a deposit, and abi.encode(holder, purpose) for a withdrawal.
+//
+// A failed operation reverts the call to the precompiled contract with an Error(string) reason, leaving the state
+// untouched and the remaining gas to the caller, who typically reverts as well, e.g. require(success) in Solidity.
+// The operations run no contract code, so the caller can not be reentered. Since they act for the caller, they can
+// not be delegated (i.e. the DELEGATECALL and CALLCODE fail, see vm.StatefulPrecompiledContract), nor made within
+// a STATICCALL, nor carry TFuel.
+//
+
+// DepositStakePrecompileAddress is the reserved address of the precompiled contract depositing the stake of its
+// caller. It returns true as an ABI encoded word.
+var DepositStakePrecompileAddress = common.BytesToAddress([]byte{0x02, 0x00})
+
+// WithdrawStakePrecompileAddress is the reserved address of the precompiled contract withdrawing the stake of its
+// caller. It returns the height the stake returns at as an ABI encoded word.
+var WithdrawStakePrecompileAddress = common.BytesToAddress([]byte{0x02, 0x01})
+
+var (
+	// stakeDepositedEventID is the topic of the StakeDeposited(address indexed source, address indexed holder,
+	// uint8 purpose, uint256 amount) event logged by a deposit
+	stakeDepositedEventID = crypto.Keccak256Hash([]byte("StakeDeposited(address,address,uint8,uint256)"))
+
+	// stakeWithdrawnEventID is the topic of the StakeWithdrawn(address indexed source, address indexed holder,
+	// uint8 purpose, uint256 returnHeight) event logged by a withdrawal
+	stakeWithdrawnEventID = crypto.Keccak256Hash([]byte("StakeWithdrawn(address,address,uint8,uint256)"))
+
+	errStakePrecompileNoEVM = errors.New("the stake precompiled contracts only run in the EVM")
+)
+
+func init() {
+	vm.RegisterPrecompiledContract(DepositStakePrecompileAddress, common.HeightEnableContractStaking, &depositStakePrecompile{})
+	vm.RegisterPrecompiledContract(WithdrawStakePrecompileAddress, common.HeightEnableContractStaking, &withdrawStakePrecompile{})
+}
+
+var _ vm.StatefulPrecompiledContract = (*depositStakePrecompile)(nil)
+
+// depositStakePrecompile implements the precompiled contract at DepositStakePrecompileAddress
+type depositStakePrecompile struct{}
+
+func (p *depositStakePrecompile) RequiredGas(input []byte) uint64 {
+	return types.GasDepositStakeTx
+}
+
+func (p *depositStakePrecompile) Run(input []byte) ([]byte, error) {
+	return nil, errStakePrecompileNoEVM
+}
+
+func (p *depositStakePrecompile) RunWithEVM(evm *vm.EVM, contract *vm.Contract, input []byte, readOnly bool) ([]byte, error) {
+	view, res := stakePrecompileView(evm, contract, readOnly)
+	if res.IsError() {
+		return revertStakePrecompile(res)
+	}
+	words, ok := unpackStakePrecompileInput(input, 3)
+	if !ok {
+		return revertStakePrecompile(result.Error("Invalid input, expected abi.encode(address holder, uint8 purpose, uint256 amount)"))
+	}
+	holder, purpose, amount := common.BytesToAddress(words[0].Bytes()), uint8(words[1].Uint64()), words[2]
+
+	source := contract.Caller()
+	stake := types.Coins{ThetaWei: amount, TFuelWei: big.NewInt(0)}
+	if res := sanityCheckForStakePurpose(view, purpose); res.IsError() {
+		return revertStakePrecompile(res)
+	}
+	if res := sanityCheckForStakeDeposit(view, source, holder, purpose, stake); res.IsError() {
+		return revertStakePrecompile(res)
+	}
+	sourceAccount := view.GetAccount(source)
+	if sourceAccount == nil || !sourceAccount.Balance.IsGTE(stake) {
+		return revertStakePrecompile(result.Error("Not enough balance to stake").WithErrorCode(result.CodeNotEnoughBalanceToStake))
+	}
+	if res := depositStake(view, source, sourceAccount, holder, purpose, stake); res.IsError() {
+		return revertStakePrecompile(res)
+	}
+	view.SetAccount(source, sourceAccount)
+	recordStakeTransaction(view)
+
+	logStakePrecompileEvent(evm, DepositStakePrecompileAddress, stakeDepositedEventID, source, holder, purpose, amount)
+	return common.LeftPadBytes([]byte{1}, 32), nil
+}
+
+var _ vm.StatefulPrecompiledContract = (*withdrawStakePrecompile)(nil)
+
+// withdrawStakePrecompile implements the precompiled contract at WithdrawStakePrecompileAddress
+type withdrawStakePrecompile struct{}
+
+func (p *withdrawStakePrecompile) RequiredGas(input []byte) uint64 {
+	return types.GasWidthdrawStakeTx
+}
+
+func (p *withdrawStakePrecompile) Run(input []byte) ([]byte, error) {
+	return nil, errStakePrecompileNoEVM
+}
+
+func (p *withdrawStakePrecompile) RunWithEVM(evm *vm.EVM, contract *vm.Contract, input []byte, readOnly bool) ([]byte, error) {
+	view, res := stakePrecompileView(evm, contract, readOnly)
+	if res.IsError() {
+		return revertStakePrecompile(res)
+	}
+	words, ok := unpackStakePrecompileInput(input, 2)
+	if !ok {
+		return revertStakePrecompile(result.Error("Invalid input, expected abi.encode(address holder, uint8 purpose)"))
+	}
+	holder, purpose := common.BytesToAddress(words[0].Bytes()), uint8(words[1].Uint64())
+
+	// The stake returns to the source, there is no return address
+	source := contract.Caller()
+	currentHeight := view.Height()
+	if res := sanityCheckForStakePurpose(view, purpose); res.IsError() {
+		return revertStakePrecompile(res)
+	}
+	if res := sanityCheckForStakeWithdrawal(view, source, holder, purpose); res.IsError() {
+		return revertStakePrecompile(res)
+	}
+	if res := sanityCheckForStakeReturnAddress(view, source, holder, purpose, source, currentHeight); res.IsError() {
+		return revertStakePrecompile(res)
+	}
+	if res := withdrawStake(view, source, holder, purpose, currentHeight); res.IsError() {
+		return revertStakePrecompile(res)
+	}
+	recordStakeTransaction(view)
+
+	returnHeight := new(big.Int).SetUint64(stakeReturnHeight(view, purpose, currentHeight))
+	logStakePrecompileEvent(evm, WithdrawStakePrecompileAddress, stakeWithdrawnEventID, source, holder, purpose, returnHeight)
+	return common.BigToHash(returnHeight).Bytes(), nil
+}
+
+// isStakePrecompileLog returns whether the log is an event of the stake precompiled contracts, i.e. whether the
+// contract execution logging it updated the stakes. The logs of the reverted calls are reverted with their stake
+// updates, see StoreView.RevertToSnapshot()
+func isStakePrecompileLog(log *types.Log) bool {
+	return log.Address == DepositStakePrecompileAddress || log.Address == WithdrawStakePrecompileAddress
+}
+
+// stakePrecompileView returns the view the stake precompiled contract updates for the given call
+func stakePrecompileView(evm *vm.EVM, contract *vm.Contract, readOnly bool) (*st.StoreView, result.Result) {
+	view, ok := evm.StateDB.(*st.StoreView)
+	if !ok {
+		return nil, result.Error("The stakes are not available to the EVM")
+	}
+	if readOnly {
+		return nil, result.Error("The stakes can not be updated within a static call")
+	}
+	if contract.Value().Sign() != 0 {
+		return nil, result.Error("The stake operations do not accept TFuel")
+	}
+	return view, result.OK
+}
+
+// unpackStakePrecompileInput splits the input into the given number of ABI encoded words. The first word is an
+// address, and the second a uint8 stake purpose.
+func unpackStakePrecompileInput(input []byte, numWords int) ([]*big.Int, bool) {
+	if len(input) != 32*numWords {
+		return nil, false
+	}
+	words := make([]*big.Int, numWords)
+	for i := range words {
+		words[i] = new(big.Int).SetBytes(input[32*i : 32*(i+1)])
+	}
+	if words[0].BitLen() > 8*common.AddressLength || words[1].BitLen() > 8 {
+		return nil, false
+	}
+	return words, true
+}
+
+// revertStakePrecompile reverts the call to the stake precompiled contract with the message of the result
+func revertStakePrecompile(res result.Result) ([]byte, error) {
+	return vm.PackRevertReason(res.Message), vm.ErrExecutionReverted
+}
+
+// logStakePrecompileEvent logs the event of a stake operation, with the source and the holder as the indexed topics
+func logStakePrecompileEvent(evm *vm.EVM, address common.Address, eventID common.Hash, source common.Address,
+	holder common.Address, purpose uint8, value *big.Int) {
+	data := common.LeftPadBytes([]byte{purpose}, 32)
+	data = append(data, common.BigToHash(value).Bytes()...)
+	evm.StateDB.AddLog(&types.Log{
+		Address:     address,
+		Topics:      []common.Hash{eventID, common.BytesToHash(source.Bytes()), common.BytesToHash(holder.Bytes())},
+		Data:        data,
+		BlockNumber: evm.BlockNumber.Uint64(),
+	})
+}
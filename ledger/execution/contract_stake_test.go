@@ -0,0 +1,152 @@
+package execution
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/ledger/vm"
+)
+
+func TestContractStake(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	et := NewExecTest()
+	callerPrivAcc := types.MakeAccWithInitBalance("stake_pool_caller", types.NewCoins(0, int64(10*types.MaximumTxGasLimit*types.MinimumGasPrice)))
+	et.acc2State(callerPrivAcc)
+	holderAddr := types.PrivAccountFromSecret("stake_pool_holder").Address
+
+	// The pool forwards its calldata to the deposit precompile, or to the withdrawal precompile if it is two words
+	// long, and reverts with the return data if the call fails. ASM:
+	// calldatasize, push 0x0, push 0x0, calldatacopy,
+	// push 0x0, push 0x0, calldatasize, push 0x0, push 0x0, calldatasize, push 0x40, eq, push2 0x0200, add, gas, call,
+	// returndatasize, push 0x0, push 0x0, returndatacopy, push 0x26, jumpi,
+	// returndatasize, push 0x0, revert, jumpdest, returndatasize, push 0x0, return
+	poolAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	// The same, with a delegatecall instead, which carries no value
+	delegatingAddr := common.HexToAddress("0x1000000000000000000000000000000000000002")
+	// The caller of the pool, which reverts whatever the pool returns. ASM:
+	// calldatasize, push 0x0, push 0x0, calldatacopy,
+	// push 0x0, push 0x0, calldatasize, push 0x0, push 0x0, push20 poolAddr, gas, call, pop,
+	// push 0x0, push 0x0, revert
+	revertingAddr := common.HexToAddress("0x1000000000000000000000000000000000000003")
+	// The caller of the reverting contract, which succeeds whatever the reverting contract returns. ASM:
+	// calldatasize, push 0x0, push 0x0, calldatacopy,
+	// push 0x0, push 0x0, calldatasize, push 0x0, push 0x0, push20 revertingAddr, gas, call, pop, stop
+	wrappingAddr := common.HexToAddress("0x1000000000000000000000000000000000000004")
+	view := et.state().Delivered()
+	view.SetCode(revertingAddr, common.Hex2Bytes("366000600037"+"600060003660006000"+"73"+hex.EncodeToString(poolAddr.Bytes())+
+		"5af150"+"60006000fd"))
+	view.SetCode(wrappingAddr, common.Hex2Bytes("366000600037"+"600060003660006000"+"73"+hex.EncodeToString(revertingAddr.Bytes())+
+		"5af150"+"00"))
+	view.SetCode(poolAddr, common.Hex2Bytes("366000600037"+"6000600036600060003660401461020001"+"5af1"+
+		"3d600060003e602657"+"3d6000fd"+"5b3d6000f3"))
+	view.SetCode(delegatingAddr, common.Hex2Bytes("366000600037"+"60006000366000610200"+"5af4"+
+		"3d600060003e601f57"+"3d6000fd"+"5b3d6000f3"))
+	for _, addr := range []common.Address{poolAddr, delegatingAddr} {
+		account := view.GetAccount(addr)
+		account.Balance = types.Coins{ThetaWei: new(big.Int).Mul(core.MinValidatorStakeDeposit, big.NewInt(2)), TFuelWei: big.NewInt(0)}
+		view.SetAccount(addr, account)
+	}
+	view.UpdateValidatorCandidatePool(&core.ValidatorCandidatePool{})
+	poolBalance := view.GetAccount(poolAddr).Balance
+	et.state().Commit()
+
+	scTxExec := NewSmartContractTxExecutor(et.state())
+	sequence := uint64(0)
+	callPool := func(contractAddr common.Address, words ...*big.Int) result.Info {
+		data := []byte{}
+		for _, word := range words {
+			data = append(data, common.BigToHash(word).Bytes()...)
+		}
+		sequence++
+		tx := &types.SmartContractTx{
+			From:     types.TxInput{Address: callerPrivAcc.Address, Sequence: sequence},
+			To:       types.TxOutput{Address: contractAddr},
+			GasLimit: 200000,
+			GasPrice: new(big.Int).SetUint64(types.MinimumGasPrice),
+			Data:     data,
+		}
+		tx.From.Signature = callerPrivAcc.Sign(tx.SignBytes(et.chainID))
+		view := et.state().Delivered()
+		res := scTxExec.sanityCheck(et.chainID, view, tx)
+		require.True(res.IsOK(), res.Message)
+		_, res = scTxExec.process(et.chainID, view, tx)
+		require.True(res.IsOK(), res.Message)
+		return res.Info
+	}
+	holderWord := new(big.Int).SetBytes(holderAddr.Bytes())
+	purposeWord := big.NewInt(int64(core.StakeForValidator))
+	findStake := func() *core.Stake {
+		return et.state().Delivered().GetValidatorCandidatePool().FindStake(poolAddr, holderAddr)
+	}
+
+	// Not available before the fork, the call to the reserved address is a no-op
+	res := callPool(poolAddr, holderWord, purposeWord, core.MinValidatorStakeDeposit)
+	assert.Nil(res["vmError"])
+	assert.Equal(0, len(res["vmReturn"].(common.Bytes)))
+	assert.Nil(res["validatorSetEffectiveHeight"])
+	assert.Nil(findStake())
+
+	// A failed deposit reverts with the reason, and leaves the state untouched
+	et.fastforwardTo(common.HeightEnableContractStaking)
+	res = callPool(poolAddr, holderWord, purposeWord, big.NewInt(1))
+	assert.Equal(vm.ErrExecutionReverted.Error(), res["vmError"])
+	reason, ok := vm.UnpackRevertReason(res["revertData"].(common.Bytes))
+	require.True(ok)
+	assert.Contains(reason, "Insufficient amount of stake")
+	assert.Nil(findStake())
+	assert.Equal(poolBalance, et.state().Delivered().GetAccount(poolAddr).Balance)
+
+	// The deposit can not be delegated
+	res = callPool(delegatingAddr, holderWord, purposeWord, core.MinValidatorStakeDeposit)
+	assert.NotNil(res["vmError"])
+	assert.Nil(et.state().Delivered().GetValidatorCandidatePool().FindStake(delegatingAddr, holderAddr))
+
+	// A deposit in a reverted call is rolled back along with its event, so the validator set does not change
+	res = callPool(wrappingAddr, holderWord, purposeWord, core.MinValidatorStakeDeposit)
+	assert.Nil(res["vmError"])
+	assert.Equal(0, len(res["logs"].([]*types.Log)))
+	assert.Nil(res["validatorSetEffectiveHeight"])
+	assert.Nil(findStake())
+	assert.Equal(poolBalance, et.state().Delivered().GetAccount(poolAddr).Balance)
+
+	// The pool stakes out of its own balance
+	res = callPool(poolAddr, holderWord, purposeWord, core.MinValidatorStakeDeposit)
+	require.Nil(res["vmError"])
+	assert.Equal(common.LeftPadBytes([]byte{1}, 32), []byte(res["vmReturn"].(common.Bytes)))
+	assert.NotNil(res["validatorSetEffectiveHeight"])
+	stake := findStake()
+	require.NotNil(stake)
+	assert.Equal(0, stake.Amount.Cmp(core.MinValidatorStakeDeposit))
+	assert.Equal(poolBalance.Minus(types.Coins{ThetaWei: core.MinValidatorStakeDeposit, TFuelWei: big.NewInt(0)}),
+		et.state().Delivered().GetAccount(poolAddr).Balance)
+	logs := res["logs"].([]*types.Log)
+	require.Equal(1, len(logs))
+	assert.Equal(DepositStakePrecompileAddress, logs[0].Address)
+	assert.Equal([]common.Hash{stakeDepositedEventID, common.BytesToHash(poolAddr.Bytes()), common.BytesToHash(holderAddr.Bytes())},
+		logs[0].Topics)
+
+	// The withdrawn stake returns to the pool after the locking period
+	res = callPool(poolAddr, holderWord, purposeWord)
+	require.Nil(res["vmError"])
+	assert.NotNil(res["validatorSetEffectiveHeight"])
+	returnHeight := new(big.Int).SetBytes(res["vmReturn"].(common.Bytes)).Uint64()
+	assert.Equal([]core.PendingStakeReturn{{
+		Holder:       holderAddr,
+		Source:       poolAddr,
+		Amount:       core.MinValidatorStakeDeposit,
+		ReturnHeight: returnHeight,
+	}}, et.state().Delivered().GetValidatorCandidatePool().PendingStakeReturns(poolAddr))
+
+	// Withdrawn already
+	res = callPool(poolAddr, holderWord, purposeWord)
+	assert.Equal(vm.ErrExecutionReverted.Error(), res["vmError"])
+}
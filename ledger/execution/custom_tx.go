@@ -0,0 +1,194 @@
+package execution
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+// TxStateReader is the read-only view of the ledger state given to the screeners of the registered tx types. It
+// exposes the accounts, and the key-value store of the tx type, see TxState.
+type TxStateReader interface {
+	// Height returns the height of the parent of the block the tx is executed in
+	Height() uint64
+
+	// GetAccount returns the account of the given address, or nil if there is none
+	GetAccount(addr common.Address) *types.Account
+
+	// Get returns the value of the given key in the store of the tx type, or nil if it is not set
+	Get(key common.Bytes) common.Bytes
+}
+
+// TxState is the view of the ledger state given to the executors of the registered tx types. The accounts are
+// read-only, and the writes go to a key-value store of the tx type's own, so that the registered executors can
+// neither mint nor move coins, nor alter the state the core txs depend on.
+type TxState interface {
+	TxStateReader
+
+	// Set sets the value of the given key in the store of the tx type
+	Set(key common.Bytes, value common.Bytes)
+
+	// Delete deletes the given key from the store of the tx type
+	Delete(key common.Bytes)
+}
+
+// TxScreenerFunc checks a registered tx against the state, before it is accepted into the mempool or into a
+// block. The input and the fee of the tx are already checked, see RegisterTxExecutor.
+type TxScreenerFunc func(chainID string, state TxStateReader, tx types.CustomTx) result.Result
+
+// TxExecutorFunc applies a registered tx to the state. Its writes are reverted if it fails.
+type TxExecutorFunc func(chainID string, state TxState, tx types.CustomTx) result.Result
+
+// customTxExecutors contains the executors of the registered tx types, indexed by tx type
+var customTxExecutors = map[types.TxType]*CustomTxExecutor{}
+
+// RegisterTxExecutor registers the screener and the executor of a custom tx type, which the screening, the
+// block proposal and the block execution consult for the txs of that type. The tx type needs to be registered
+// with types.RegisterTxType first, so the core tx types can not be overridden. The core execution checks the
+// signature and the sequence of the input, and that it covers the fee, before the screener. It charges the fee
+// and increments the sequence of the input after the executor. It is not thread safe, and should only be called
+// on initialization, e.g. from an init() function. It panics if the tx type is not registered, or already has an
+// executor.
+func RegisterTxExecutor(txType types.TxType, screener TxScreenerFunc, executor TxExecutorFunc) {
+	if !types.IsRegisteredTxType(txType) {
+		panic(fmt.Sprintf("Tx type %v is not registered", txType))
+	}
+	if _, ok := customTxExecutors[txType]; ok {
+		panic(fmt.Sprintf("Tx type %v already has an executor", txType))
+	}
+	customTxExecutors[txType] = &CustomTxExecutor{
+		txType:   txType,
+		screener: screener,
+		executor: executor,
+	}
+}
+
+// getCustomTxExecutor returns the executor registered for the type of the given tx, or nil if there is none
+func getCustomTxExecutor(tx types.Tx) *CustomTxExecutor {
+	if _, ok := tx.(types.CustomTx); !ok {
+		return nil
+	}
+	txType, err := types.GetTxType(tx)
+	if err != nil {
+		return nil
+	}
+	return customTxExecutors[txType]
+}
+
+// CustomTxExecutor implements the TxExecutor interface for a registered tx type
+type CustomTxExecutor struct {
+	txType   types.TxType
+	screener TxScreenerFunc
+	executor TxExecutorFunc
+}
+
+func (exec *CustomTxExecutor) sanityCheck(chainID string, view *st.StoreView, transaction types.Tx) result.Result {
+	tx := transaction.(types.CustomTx)
+
+	if res := types.ValidateCustomTx(tx); res.IsError() {
+		return res
+	}
+
+	input := *tx.GetInput()
+	account, res := getInput(view, input)
+	if res.IsError() {
+		return res
+	}
+
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(account, signTargets, input)
+	if res.IsError() {
+		return res
+	}
+
+	fee := *tx.GetFee()
+	res = sanityCheckForFee(view, tx, fee)
+	if res.IsError() {
+		return res
+	}
+
+	if !account.Balance.IsGTE(fee) {
+		return result.Error("Insufficient fund: balance is %v, fee is %v", account.Balance, fee).
+			WithErrorCode(result.CodeInsufficientFund)
+	}
+
+	return exec.screener(chainID, &customTxState{view: view, txType: exec.txType}, tx)
+}
+
+func (exec *CustomTxExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
+	tx := transaction.(types.CustomTx)
+
+	snapshot := view.Snapshot()
+	if res := exec.executor(chainID, &customTxState{view: view, txType: exec.txType}, tx); res.IsError() {
+		view.RevertToSnapshot(snapshot)
+		return common.Hash{}, res
+	}
+
+	input := *tx.GetInput()
+	account, res := getInput(view, input)
+	if res.IsError() {
+		view.RevertToSnapshot(snapshot)
+		return common.Hash{}, res
+	}
+
+	if !chargeFee(view, account, *tx.GetFee()) {
+		view.RevertToSnapshot(snapshot)
+		return common.Hash{}, result.Error("Failed to charge transaction fee")
+	}
+
+	account.Sequence++
+	view.SetAccount(input.Address, account)
+
+	txHash := types.TxID(chainID, tx)
+	return txHash, result.OK
+}
+
+func (exec *CustomTxExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
+	tx := transaction.(types.CustomTx)
+	input := tx.GetInput()
+	return &core.TxInfo{
+		Address:           input.Address,
+		Sequence:          input.Sequence,
+		EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction),
+	}
+}
+
+func (exec *CustomTxExecutor) calculateEffectiveGasPrice(transaction types.Tx) *big.Int {
+	tx := transaction.(types.CustomTx)
+	fee := tx.GetFee().NoNil()
+	gas := new(big.Int).SetUint64(types.GasCustomTx)
+	effectiveGasPrice := new(big.Int).Div(fee.TFuelWei, gas)
+	return effectiveGasPrice
+}
+
+// customTxState implements the TxState interface on top of a store view, the keys of the tx type are stored
+// under state.CustomTxDataKey
+type customTxState struct {
+	view   *st.StoreView
+	txType types.TxType
+}
+
+func (s *customTxState) Height() uint64 {
+	return s.view.Height()
+}
+
+func (s *customTxState) GetAccount(addr common.Address) *types.Account {
+	return s.view.GetAccount(addr) // decoded on each read, the changes to it are not written back
+}
+
+func (s *customTxState) Get(key common.Bytes) common.Bytes {
+	return s.view.Get(st.CustomTxDataKey(s.txType, key))
+}
+
+func (s *customTxState) Set(key common.Bytes, value common.Bytes) {
+	s.view.Set(st.CustomTxDataKey(s.txType, key), value)
+}
+
+func (s *customTxState) Delete(key common.Bytes) {
+	s.view.Delete(st.CustomTxDataKey(s.txType, key))
+}
@@ -2,17 +2,23 @@ package execution
 
 import (
 	"encoding/hex"
+	"math"
 	"math/big"
 
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/common/result"
 	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
 	"github.com/thetatoken/theta/ledger/state"
 	"github.com/thetatoken/theta/ledger/types"
 )
 
 // --------------------------------- Execution Utilities -------------------------------------
 
+// signatureCache holds the verified tx input signatures, so that a tx verified when it is screened by the
+// mempool is not verified again when it is proposed or applied
+var signatureCache = crypto.NewSignatureCache(crypto.DefaultSignatureCacheSize)
+
 // TODO: need to implement the following two functions
 // // Read genesis file.
 // func ReadGenesisFile() (genDoc *ttypes.GenesisDoc, err error) {
@@ -78,12 +84,12 @@ func getInputs(view *state.StoreView, ins []types.TxInput) (map[string]*types.Ac
 	for _, in := range ins {
 		// Account shouldn't be duplicated
 		if _, ok := accounts[string(in.Address[:])]; ok {
-			return nil, result.Error("getInputs - Duplicated address: %v", in.Address)
+			return nil, result.Error("getInputs - Duplicated address: %v", in.Address).WithErrorCode(result.CodeDuplicatedAddress)
 		}
 
 		acc, success := getAccount(view, in.Address)
 		if success.IsError() {
-			return nil, result.Error("getInputs - Unknown address: %v", in.Address)
+			return nil, result.Error("getInputs - Unknown address: %v", in.Address).WithErrorCode(result.CodeUnknownAccount)
 		}
 
 		accounts[string(in.Address[:])] = acc
@@ -103,7 +109,7 @@ func getOrMakeInput(view *state.StoreView, in types.TxInput) (*types.Account, re
 func getOrMakeInputImpl(view *state.StoreView, in types.TxInput, makeNewAccount bool) (*types.Account, result.Result) {
 	acc, success := getOrMakeAccountImpl(view, in.Address, makeNewAccount)
 	if success.IsError() {
-		return nil, result.Error("getOrMakeInputImpl - Unknown address: %v", in.Address)
+		return nil, result.Error("getOrMakeInputImpl - Unknown address: %v", in.Address).WithErrorCode(result.CodeUnknownAccount)
 	}
 
 	return acc, result.OK
@@ -123,9 +129,9 @@ func getOrMakeAccountImpl(view *state.StoreView, address common.Address, makeNew
 	acc := view.GetAccount(address)
 	if acc == nil {
 		if !makeNewAccount {
-			return nil, result.Error("getOrMakeAccountImpl - Unknown address: %v", address)
+			return nil, result.Error("getOrMakeAccountImpl - Unknown address: %v", address).WithErrorCode(result.CodeUnknownAccount)
 		}
-		acc = types.NewAccount(address)
+		acc = view.NewAccount(address)
 		acc.LastUpdatedBlockHeight = view.Height()
 	}
 	acc.UpdateToHeight(view.Height())
@@ -141,7 +147,7 @@ func getOrMakeOutputs(view *state.StoreView, accounts map[string]*types.Account,
 	for _, out := range outs {
 		// Account shouldn't be duplicated
 		if _, ok := accounts[string(out.Address[:])]; ok {
-			return nil, result.Error("getOrMakeOutputs - Duplicated address: %v", out.Address)
+			return nil, result.Error("getOrMakeOutputs - Duplicated address: %v", out.Address).WithErrorCode(result.CodeDuplicatedAddress)
 		}
 
 		acc := getOrMakeAccount(view, out.Address)
@@ -162,14 +168,14 @@ func validateInputsBasic(ins []types.TxInput) result.Result {
 }
 
 // Validate inputs and compute total amount of coins
-func validateInputsAdvanced(accounts map[string]*types.Account, signBytes []byte, ins []types.TxInput) (total types.Coins, res result.Result) {
+func validateInputsAdvanced(accounts map[string]*types.Account, signTargets [][]byte, ins []types.TxInput) (total types.Coins, res result.Result) {
 	total = types.NewCoins(0, 0)
 	for _, in := range ins {
 		acc := accounts[string(in.Address[:])]
 		if acc == nil {
 			panic("validateInputsAdvanced() expects account in accounts")
 		}
-		res = validateInputAdvanced(acc, signBytes, in)
+		res = validateInputAdvanced(acc, signTargets, in)
 		if res.IsError() {
 			return
 		}
@@ -179,12 +185,16 @@ func validateInputsAdvanced(accounts map[string]*types.Account, signBytes []byte
 	return total, result.OK
 }
 
-func validateInputAdvanced(acc *types.Account, signBytes []byte, in types.TxInput) result.Result {
+func validateInputAdvanced(acc *types.Account, signTargets [][]byte, in types.TxInput) result.Result {
 	// Check sequence/coins
 	seq, balance := acc.Sequence, acc.Balance
-	if seq+1 != in.Sequence {
+	if in.Sequence <= seq {
+		return result.Error("ValidateInputAdvanced: Got %v, expected %v. (acc.seq=%v)",
+			in.Sequence, seq+1, acc.Sequence).WithErrorCode(result.CodeSequenceTooLow)
+	}
+	if in.Sequence > seq+1 {
 		return result.Error("ValidateInputAdvanced: Got %v, expected %v. (acc.seq=%v)",
-			in.Sequence, seq+1, acc.Sequence).WithErrorCode(result.CodeInvalidSequence)
+			in.Sequence, seq+1, acc.Sequence).WithErrorCode(result.CodeSequenceTooHigh)
 	}
 
 	// Check amount
@@ -194,14 +204,201 @@ func validateInputAdvanced(acc *types.Account, signBytes []byte, in types.TxInpu
 	}
 
 	// Check signatures
-	if !in.Signature.Verify(signBytes, acc.Address) {
+	return validateInputSignatures(acc, signTargets, in)
+}
+
+// validateInputSignatures checks that the input is signed by the account, or by at least the threshold
+// number of its owners if it is a multisig account. The signatures are accepted over any of the sign
+// targets, see txSignTargets(), but the owners of a multisig account all need to sign the same one.
+func validateInputSignatures(acc *types.Account, signTargets [][]byte, in types.TxInput) result.Result {
+	if acc.Multisig == nil {
+		for _, signBytes := range signTargets {
+			if signatureCache.Verify(signBytes, in.Signature, acc.Address) {
+				return result.OK
+			}
+		}
 		return result.Error("Signature verification failed, SignBytes: %v",
-			hex.EncodeToString(signBytes)).WithErrorCode(result.CodeInvalidSignature)
+			hex.EncodeToString(signTargets[0])).WithErrorCode(result.CodeInvalidSignature)
+	}
+
+	if in.Signature != nil && !in.Signature.IsEmpty() {
+		return result.Error("%v is a multisig account, only the signatures of its owners are accepted",
+			acc.Address.Hex()).WithErrorCode(result.CodeInvalidSignature)
+	}
+	var signers []common.Address
+	var err error
+	for _, signBytes := range signTargets {
+		signers, err = acc.Multisig.Signers(signBytes, in.Signatures)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return result.Error("Multisig verification failed for %v: %v, SignBytes: %v", acc.Address.Hex(), err,
+			hex.EncodeToString(signTargets[0])).WithErrorCode(result.CodeInvalidSignature)
+	}
+	if uint64(len(signers)) < acc.Multisig.Threshold {
+		return result.Error("Insufficient signatures for %v: %v of the %v required owners signed",
+			acc.Address.Hex(), len(signers), acc.Multisig.Threshold).WithErrorCode(result.CodeInsufficientSignatures)
+	}
+	return result.OK
+}
+
+// txSignTargets returns the messages the input signatures of the tx are accepted over: its SignBytes, and
+// from the fork height on, its structured sign bytes if the tx type has a structured form, which hardware
+// wallets can render to the user
+func txSignTargets(chainID string, view *state.StoreView, tx types.Tx) [][]byte {
+	signTargets := [][]byte{tx.SignBytes(chainID)}
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight < common.HeightEnableStructuredSignature {
+		return signTargets
+	}
+	if structuredSignBytes, err := types.StructuredSignBytes(chainID, tx); err == nil {
+		signTargets = append(signTargets, structuredSignBytes)
+	}
+	return signTargets
+}
+
+// prefetchTxSignatures verifies the input signatures of the txs in a batch, so that executing the txs one
+// by one finds them in the signature cache. The invalid signatures are left for the execution to report.
+func prefetchTxSignatures(chainID string, txs []types.Tx) {
+	verifications := []*crypto.SignatureVerification{}
+	for _, tx := range txs {
+		verifications = append(verifications, getTxSignatures(chainID, tx)...)
+	}
+	crypto.BatchVerify(verifications, signatureCache)
+}
+
+// sanityCheckForTxFormat rejects the malformed transactions, see types.Tx.Validate, from
+// common.HeightEnableTxValidation. Before that, they are only kept out of the mempool, see Executor.GetTxInfo
+func sanityCheckForTxFormat(view *state.StoreView, tx types.Tx) result.Result {
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight < common.HeightEnableTxValidation {
+		return result.OK
+	}
+	return tx.Validate()
+}
+
+// sanityCheckForSignatureScheme rejects the Ed25519 input signatures, including the ones of the owners of a
+// multisig account, before common.HeightEnableEd25519Signature
+func sanityCheckForSignatureScheme(view *state.StoreView, tx types.Tx) result.Result {
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight >= common.HeightEnableEd25519Signature {
+		return result.OK
+	}
+	for _, in := range getTxInputs(tx) {
+		signatures := append([]*crypto.Signature{in.Signature}, in.Signatures...)
+		for _, sig := range signatures {
+			if sig != nil && !sig.IsEmpty() && sig.Scheme() == crypto.SchemeEd25519 {
+				return result.Error("Ed25519 signatures are not supported until height %v",
+					common.HeightEnableEd25519Signature).WithErrorCode(result.CodeInvalidSignature)
+			}
+		}
+	}
+	return result.OK
+}
+
+// sanityCheckForMultisig rejects the input signatures of the multisig account owners before
+// common.HeightEnableMultisig
+func sanityCheckForMultisig(view *state.StoreView, tx types.Tx) result.Result {
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight >= common.HeightEnableMultisig {
+		return result.OK
+	}
+	for _, in := range getTxInputs(tx) {
+		if len(in.Signatures) > 0 {
+			return result.Error("The multisig signatures are not supported until height %v",
+				common.HeightEnableMultisig).WithErrorCode(result.CodeMultisigNotEnabled)
+		}
 	}
+	return result.OK
+}
 
+// sanityCheckForSmartContract rejects the smart contract transactions in the blocks below
+// common.HeightEnableSmartContract
+func sanityCheckForSmartContract(view *state.StoreView, tx types.Tx) result.Result {
+	if _, ok := tx.(*types.SmartContractTx); !ok {
+		return result.OK
+	}
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight < common.HeightEnableSmartContract {
+		return result.Error("Smart contract transactions are not supported until height %v",
+			common.HeightEnableSmartContract).WithErrorCode(result.CodeSmartContractNotEnabled)
+	}
 	return result.OK
 }
 
+// getTxSignatures returns the input signatures of the tx which are verified against the tx sign bytes. The
+// signatures over the structured sign bytes are left for the execution to verify.
+func getTxSignatures(chainID string, tx types.Tx) []*crypto.SignatureVerification {
+	ins := getTxInputs(tx)
+	if ins == nil {
+		return nil
+	}
+
+	signBytes := tx.SignBytes(chainID)
+	verifications := []*crypto.SignatureVerification{}
+	for _, in := range ins {
+		if in.Signature == nil || in.Signature.IsEmpty() {
+			continue // e.g. the input of a multisig account
+		}
+		verifications = append(verifications, &crypto.SignatureVerification{
+			Address:   in.Address,
+			Msg:       signBytes,
+			Signature: in.Signature,
+		})
+	}
+	return verifications
+}
+
+// getTxInputs returns the signed inputs of the tx, or nil for the tx types without signed inputs
+func getTxInputs(tx types.Tx) []types.TxInput {
+	var ins []types.TxInput
+	switch tx := tx.(type) {
+	case *types.SendTx:
+		ins = tx.PayingInputs()
+	case *types.ReserveFundTx:
+		ins = []types.TxInput{tx.Source}
+	case *types.ReleaseFundTx:
+		ins = []types.TxInput{tx.Source}
+	case *types.PartialReleaseFundTx:
+		ins = []types.TxInput{tx.Source}
+	case *types.SplitRuleTx:
+		ins = []types.TxInput{tx.Initiator}
+	case *types.ExtendSplitRuleTx:
+		ins = []types.TxInput{tx.Initiator}
+	case *types.SmartContractTx:
+		ins = []types.TxInput{tx.From}
+	case *types.DepositStakeTx:
+		ins = []types.TxInput{tx.Source}
+	case *types.WithdrawStakeTx:
+		ins = []types.TxInput{tx.Source}
+	case *types.UpdateMultisigTx:
+		ins = []types.TxInput{tx.Account}
+	case *types.SweepAccountTx:
+		ins = []types.TxInput{tx.Source}
+	case *types.BurnTx:
+		ins = []types.TxInput{tx.Source}
+	case *types.DoubleSignSlashTx:
+		ins = []types.TxInput{tx.Reporter}
+	case *types.StakeCommissionTx:
+		ins = []types.TxInput{tx.Holder}
+	case *types.CancelWithdrawTx:
+		ins = []types.TxInput{tx.Source}
+	case *types.UpdateValidatorMetadataTx:
+		ins = []types.TxInput{tx.Holder}
+	case *types.UnjailTx:
+		ins = []types.TxInput{tx.Holder}
+	case *types.EjectStakeTx:
+		ins = []types.TxInput{tx.Holder}
+	case *types.UpdateValidatorKeyTx:
+		ins = []types.TxInput{tx.Holder, tx.NewHolder}
+	case types.CustomTx:
+		ins = []types.TxInput{*tx.GetInput()}
+	}
+	return ins
+}
+
 func validateOutputsBasic(outs []types.TxOutput) result.Result {
 	for _, out := range outs {
 		// Check TxOutput basic
@@ -261,17 +458,87 @@ func sanityCheckForGasPrice(gasPrice *big.Int) bool {
 	return true
 }
 
-func sanityCheckForFee(fee types.Coins) bool {
+// sanityCheckForFee checks that the fee of the transaction is paid in TFuel, and meets the minimum fee of the
+// fee schedule in the state, or its intrinsic gas times the minimum gas price once the intrinsic gas schedule
+// sets one. The raw size of the transaction is that of its encoding, which is canonical.
+func sanityCheckForFee(view *state.StoreView, tx types.Tx, fee types.Coins) result.Result {
 	fee = fee.NoNil()
-	minimumFee := new(big.Int).SetUint64(types.MinimumTransactionFeeTFuelWei)
-	return fee.ThetaWei.Cmp(types.Zero) == 0 && fee.TFuelWei.Cmp(minimumFee) >= 0
+	minimumFee, err := view.GetIntrinsicGasSchedule().TxMinimumFee(view.GetFeeSchedule(), tx)
+	if err != nil {
+		return result.Error("Failed to encode the transaction: %v", err).WithErrorCode(result.CodeInvalidFee)
+	}
+	if fee.ThetaWei.Cmp(types.Zero) != 0 || fee.TFuelWei.Cmp(minimumFee) < 0 {
+		return result.Error("Insufficient fee. Transaction fee needs to be at least %v TFuelWei", minimumFee).
+			WithErrorCode(result.CodeInvalidFee)
+	}
+	return result.OK
 }
 
-func chargeFee(account *types.Account, fee types.Coins) bool {
+// sanityCheckForStakePurpose checks that the stake purpose is registered and active at the height of the
+// block being executed, the purposes introduced by a fork are rejected before the fork height
+func sanityCheckForStakePurpose(view *state.StoreView, purpose uint8) result.Result {
+	info, ok := core.GetStakePurpose(purpose)
+	if !ok {
+		return result.Error("Invalid stake purpose: %v", purpose).WithErrorCode(result.CodeInvalidStakePurpose)
+	}
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight < info.ActivationHeight {
+		return result.Error("Stake purpose %v is not active until height %v", info.Name, info.ActivationHeight).
+			WithErrorCode(result.CodeStakePurposeNotActive)
+	}
+	return result.OK
+}
+
+// recordStakeTransaction records the current block among the blocks with stake transactions, and returns the
+// height the validator set reflects the stake change from, see core.ValidatorSetEffectiveHeight
+func recordStakeTransaction(view *state.StoreView) uint64 {
+	hl := view.GetStakeTransactionHeightList()
+	if hl == nil {
+		hl = &types.HeightList{}
+	}
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	hl.Append(blockHeight)
+	view.UpdateStakeTransactionHeightList(hl)
+
+	return core.ValidatorSetEffectiveHeight(blockHeight)
+}
+
+// chargeFee charges the fee to the account, and disposes of it according to the fee policy, see disposeFee
+func chargeFee(view *state.StoreView, account *types.Account, fee types.Coins) bool {
 	if !account.Balance.IsGTE(fee) {
 		return false
 	}
 
 	account.Balance = account.Balance.Minus(fee)
+	disposeFee(view, fee)
 	return true
 }
+
+// disposeFee disposes of the fee charged to a tx. Starting from common.HeightEnableFeeDistribution, the fee is
+// split according to the fee policy of the state: the burned share is taken out of the total supply and added
+// to the burned fees, and the rest is set aside for the proposer of the next block, which claims it with the
+// coinbase transaction. Before that, the fee is burned entirely.
+func disposeFee(view *state.StoreView, fee types.Coins) {
+	if view.Height()+1 < common.HeightEnableFeeDistribution { // the view points to the parent of the current block
+		view.DecreaseTotalSupply(fee)
+		return
+	}
+
+	burned, distributed := view.GetFeePolicy().Split(fee)
+	if !burned.IsZero() {
+		view.DecreaseTotalSupply(burned)
+		view.AddBurnedFees(burned)
+	}
+	if !distributed.IsZero() {
+		view.AddUndistributedFees(distributed)
+	}
+}
+
+// expirationHeight converts the last height a tx can be included at into the TxInfo.ExpirationHeight,
+// i.e. the first height the tx can no longer be included at. 0 means the tx never expires.
+func expirationHeight(validUntilHeight uint64) uint64 {
+	if validUntilHeight == 0 || validUntilHeight == math.MaxUint64 {
+		return 0
+	}
+	return validUntilHeight + 1
+}
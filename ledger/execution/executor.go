@@ -1,6 +1,8 @@
 package execution
 
 import (
+	"time"
+
 	log "github.com/sirupsen/logrus"
 
 	"github.com/thetatoken/theta/common"
@@ -8,6 +10,7 @@ import (
 	"github.com/thetatoken/theta/core"
 	st "github.com/thetatoken/theta/ledger/state"
 	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/ledger/vm"
 )
 
 var logger *log.Entry = log.WithFields(log.Fields{"prefix": "ledger"})
@@ -21,6 +24,14 @@ type TxExecutor interface {
 	getTxInfo(transaction types.Tx) *core.TxInfo
 }
 
+//
+// timeLimitedTxExecutor is implemented by the transaction executors whose execution can be aborted after
+// a time limit, i.e. the one running the smart contracts
+//
+type timeLimitedTxExecutor interface {
+	processWithTimeLimit(chainID string, view *st.StoreView, transaction types.Tx, timeLimit time.Duration) (common.Hash, result.Result)
+}
+
 //
 // Executor executes the transactions
 //
@@ -31,35 +42,70 @@ type Executor struct {
 
 	coinbaseTxExec *CoinbaseTxExecutor
 	// slashTxExec          *SlashTxExecutor
-	sendTxExec           *SendTxExecutor
-	reserveFundTxExec    *ReserveFundTxExecutor
-	releaseFundTxExec    *ReleaseFundTxExecutor
-	servicePaymentTxExec *ServicePaymentTxExecutor
-	splitRuleTxExec      *SplitRuleTxExecutor
-	// smartContractTxExec *SmartContractTxExecutor
-	depositStakeTxExec  *DepositStakeExecutor
-	withdrawStakeTxExec *WithdrawStakeExecutor
+	sendTxExec               *SendTxExecutor
+	reserveFundTxExec        *ReserveFundTxExecutor
+	releaseFundTxExec        *ReleaseFundTxExecutor
+	servicePaymentTxExec     *ServicePaymentTxExecutor
+	splitRuleTxExec          *SplitRuleTxExecutor
+	smartContractTxExec      *SmartContractTxExecutor
+	depositStakeTxExec       *DepositStakeExecutor
+	withdrawStakeTxExec      *WithdrawStakeExecutor
+	updateMultisigTxExec     *UpdateMultisigTxExecutor
+	partialReleaseFundTxExec *PartialReleaseFundTxExecutor
+	extendSplitRuleTxExec    *ExtendSplitRuleTxExecutor
+	sweepAccountTxExec       *SweepAccountTxExecutor
+	burnTxExec               *BurnTxExecutor
+	doubleSignSlashTxExec    *DoubleSignSlashTxExecutor
+	stakeCommissionTxExec    *StakeCommissionTxExecutor
+	cancelWithdrawExec       *CancelWithdrawExecutor
+	validatorMetadataExec    *UpdateValidatorMetadataTxExecutor
+	unjailTxExec             *UnjailTxExecutor
+	ejectStakeTxExec         *EjectStakeTxExecutor
+	updateValidatorKeyTxExec *UpdateValidatorKeyTxExecutor
 
+	chainConfig     *vm.ChainConfig // schedules the forks of the EVM
 	skipSanityCheck bool
 }
 
-// NewExecutor creates a new instance of Executor
+// NewExecutor creates a new instance of Executor with the default reward schedule
 func NewExecutor(state *st.LedgerState, consensus core.ConsensusEngine, valMgr core.ValidatorManager) *Executor {
+	return NewExecutorWithRewardSchedule(state, consensus, valMgr, DefaultRewardSchedule)
+}
+
+// NewExecutorWithRewardSchedule creates a new instance of Executor, which validates the coinbase transactions
+// with the given reward schedule. The DefaultRewardSchedule is used if rewardSchedule is nil.
+func NewExecutorWithRewardSchedule(state *st.LedgerState, consensus core.ConsensusEngine, valMgr core.ValidatorManager, rewardSchedule RewardSchedule) *Executor {
+	if rewardSchedule == nil {
+		rewardSchedule = DefaultRewardSchedule
+	}
 	executor := &Executor{
 		state:          state,
 		consensus:      consensus,
 		valMgr:         valMgr,
-		coinbaseTxExec: NewCoinbaseTxExecutor(state, consensus, valMgr),
+		coinbaseTxExec: NewCoinbaseTxExecutor(state, consensus, valMgr, rewardSchedule),
 		// slashTxExec:          NewSlashTxExecutor(consensus, valMgr),
-		sendTxExec:           NewSendTxExecutor(),
-		reserveFundTxExec:    NewReserveFundTxExecutor(state),
-		releaseFundTxExec:    NewReleaseFundTxExecutor(state),
-		servicePaymentTxExec: NewServicePaymentTxExecutor(state),
-		splitRuleTxExec:      NewSplitRuleTxExecutor(state),
-		//smartContractTxExec:  NewSmartContractTxExecutor(state),
-		depositStakeTxExec:  NewDepositStakeExecutor(),
-		withdrawStakeTxExec: NewWithdrawStakeExecutor(state),
-		skipSanityCheck:     false,
+		sendTxExec:               NewSendTxExecutor(),
+		reserveFundTxExec:        NewReserveFundTxExecutor(state),
+		releaseFundTxExec:        NewReleaseFundTxExecutor(state),
+		servicePaymentTxExec:     NewServicePaymentTxExecutor(state),
+		splitRuleTxExec:          NewSplitRuleTxExecutor(state),
+		smartContractTxExec:      NewSmartContractTxExecutor(state),
+		depositStakeTxExec:       NewDepositStakeExecutor(),
+		withdrawStakeTxExec:      NewWithdrawStakeExecutor(state),
+		updateMultisigTxExec:     NewUpdateMultisigTxExecutor(),
+		partialReleaseFundTxExec: NewPartialReleaseFundTxExecutor(state),
+		extendSplitRuleTxExec:    NewExtendSplitRuleTxExecutor(state),
+		sweepAccountTxExec:       NewSweepAccountTxExecutor(),
+		burnTxExec:               NewBurnTxExecutor(),
+		doubleSignSlashTxExec:    NewDoubleSignSlashTxExecutor(),
+		stakeCommissionTxExec:    NewStakeCommissionTxExecutor(),
+		cancelWithdrawExec:       NewCancelWithdrawExecutor(),
+		validatorMetadataExec:    NewUpdateValidatorMetadataTxExecutor(),
+		unjailTxExec:             NewUnjailTxExecutor(),
+		ejectStakeTxExec:         NewEjectStakeTxExecutor(state),
+		updateValidatorKeyTxExec: NewUpdateValidatorKeyTxExecutor(),
+		chainConfig:              vm.ChainConfigForChainID(state.GetChainID()),
+		skipSanityCheck:          false,
 	}
 
 	return executor
@@ -71,35 +117,173 @@ func (exec *Executor) SetSkipSanityCheck(skip bool) {
 	exec.skipSanityCheck = skip
 }
 
+// ChainConfig returns the EVM configuration the smart contract transactions are executed with, which is the one of
+// the chain of the ledger state unless set, see vm.ChainConfigForChainID
+func (exec *Executor) ChainConfig() *vm.ChainConfig {
+	return exec.chainConfig
+}
+
+// SetChainConfig sets the EVM configuration the smart contract transactions are executed with. It should only be
+// called on initialization, before any transaction is executed.
+func (exec *Executor) SetChainConfig(chainConfig *vm.ChainConfig) error {
+	if err := chainConfig.Validate(); err != nil {
+		return err
+	}
+	exec.chainConfig = chainConfig
+	exec.smartContractTxExec.chainConfig = chainConfig
+	return nil
+}
+
+// RewardSchedule returns the reward schedule of the coinbase transactions
+func (exec *Executor) RewardSchedule() RewardSchedule {
+	return exec.coinbaseTxExec.rewardSchedule
+}
+
+// CalculateReward calculates the block reward for each account with the reward schedule of the executor, including
+// the fees claimed by the given proposer
+func (exec *Executor) CalculateReward(view *st.StoreView, validatorSet *core.ValidatorSet, epoch uint64,
+	proposer common.Address) map[string]types.Coins {
+	return CalculateReward(view, validatorSet, epoch, proposer, exec.coinbaseTxExec.rewardSchedule)
+}
+
+// CoinbaseOutputs returns the outputs of the coinbase transaction of the block with the reward schedule of the
+// executor, and the rewards carried over to the next block, see CoinbaseOutputs
+func (exec *Executor) CoinbaseOutputs(view *st.StoreView, validatorSet *core.ValidatorSet, epoch uint64,
+	proposer common.Address) (outputs []types.TxOutput, overflow []types.TxOutput) {
+	return CoinbaseOutputs(view, validatorSet, epoch, proposer, exec.coinbaseTxExec.rewardSchedule)
+}
+
 // ExecuteTx executes the given transaction
 func (exec *Executor) ExecuteTx(tx types.Tx) (common.Hash, result.Result) {
 	return exec.processTx(tx, core.DeliveredView)
 }
 
+// ExecuteTxWithView executes the given transaction against the given view, e.g. a copy of the
+// delivered view that is committed only if the block turns out to be valid
+func (exec *Executor) ExecuteTxWithView(tx types.Tx, view *st.StoreView) (common.Hash, result.Result) {
+	return exec.processTxWithView(tx, view)
+}
+
 // CheckTx checks the validity of the given transaction
 func (exec *Executor) CheckTx(tx types.Tx) (common.Hash, result.Result) {
 	return exec.processTx(tx, core.CheckedView)
 }
 
+// CheckTxWithTimeLimit is similar to CheckTx, but fails the transaction with CodeExecutionTimeLimitExceeded
+// if its execution takes longer than the time limit, which is only enforced for the smart contract
+// transactions. Since the outcome depends on the speed of the machine, it is meant for the block proposer
+// to leave out the slow transactions, and not for validating blocks. A failed transaction leaves the checked
+// view untouched, including the writes made before it failed, e.g. the fee charged up front, since the
+// proposer leaves it out of the block and the validators never execute it.
+func (exec *Executor) CheckTxWithTimeLimit(tx types.Tx, timeLimit time.Duration) (common.Hash, result.Result) {
+	view := exec.state.Checked()
+	snapshot := view.Snapshot()
+	txHash, res := exec.processTxWithTimeLimit(tx, view, timeLimit)
+	if res.IsError() && !res.IsInternalError() { // the view is unusable after a store error anyway
+		view.RevertToSnapshot(snapshot)
+	}
+	return txHash, res
+}
+
 // ScreenTx checks the validity of the given transaction
 func (exec *Executor) ScreenTx(tx types.Tx) (common.Hash, result.Result) {
 	return exec.processTx(tx, core.ScreenedView)
 }
 
-// GetTxInfo extracts tx information used by mempool to sort Txs.
+// SimulateTx checks and executes the given transaction against the given view. The caller
+// is responsible for providing a view that can be discarded afterwards. Unlike ExecuteTx, it also
+// executes the smart contract transactions before common.HeightEnableSmartContract, since a simulation
+// does not affect the blocks.
+func (exec *Executor) SimulateTx(tx types.Tx, view *st.StoreView) (common.Hash, result.Result) {
+	return exec.SimulateTxWithTimeLimit(tx, view, 0)
+}
+
+// SimulateTxWithTimeLimit is similar to SimulateTx, but fails the smart contract transactions with
+// CodeExecutionTimeLimitExceeded if their execution takes longer than the time limit.
+func (exec *Executor) SimulateTxWithTimeLimit(tx types.Tx, view *st.StoreView, timeLimit time.Duration) (common.Hash, result.Result) {
+	if _, ok := tx.(*types.SmartContractTx); ok {
+		return exec.executeContractTx(tx, view, timeLimit, nil)
+	}
+	return exec.processTxWithView(tx, view)
+}
+
+// TraceTx checks and executes the given smart contract transaction against the given view like SimulateTx, and
+// reports the contract execution to the tracer. The caller is responsible for providing a view that can be
+// discarded afterwards.
+func (exec *Executor) TraceTx(tx types.Tx, view *st.StoreView, tracer vm.Tracer) (common.Hash, result.Result) {
+	if _, ok := tx.(*types.SmartContractTx); !ok {
+		return common.Hash{}, result.Error("Only the smart contract transactions can be traced").
+			WithErrorCode(result.CodeInvalidTxFormat)
+	}
+	return exec.executeContractTx(tx, view, 0, tracer)
+}
+
+// executeContractTx checks and executes the given smart contract transaction against the given view, whatever
+// the height of the view
+func (exec *Executor) executeContractTx(tx types.Tx, view *st.StoreView, timeLimit time.Duration, tracer vm.Tracer) (common.Hash, result.Result) {
+	chainID := exec.state.GetChainID()
+	txExecutor := exec.smartContractTxExec
+
+	if !exec.skipSanityCheck {
+		if res := tx.Validate(); res.IsError() {
+			return common.Hash{}, res
+		}
+		sanityCheckResult := txExecutor.sanityCheck(chainID, view, tx)
+		if res := checkStoreError(view); res.IsError() {
+			return common.Hash{}, res
+		}
+		if sanityCheckResult.IsError() {
+			return common.Hash{}, sanityCheckResult
+		}
+	}
+
+	txHash, processResult := txExecutor.execute(chainID, view, tx, timeLimit, tracer)
+	if res := checkStoreError(view); res.IsError() {
+		return common.Hash{}, res
+	}
+	return txHash, processResult
+}
+
+// ScreenTxWithView screens the given transaction against the given view. If apply is true, the
+// transaction is also executed against the view, so that the later transactions see its effects.
+func (exec *Executor) ScreenTxWithView(tx types.Tx, view *st.StoreView, apply bool) (common.Hash, result.Result) {
+	if apply {
+		return exec.processTxWithView(tx, view)
+	}
+	return common.Hash{}, exec.sanityCheck(exec.state.GetChainID(), view, tx)
+}
+
+// GetTxInfo extracts tx information used by mempool to sort Txs, under the intrinsic gas schedule of the latest
+// committed state. The malformed transactions are rejected whatever the height, see types.Tx.Validate.
 func (exec *Executor) GetTxInfo(tx types.Tx) (*core.TxInfo, result.Result) {
+	return exec.GetTxInfoWithView(tx, exec.state.Committed())
+}
+
+// GetTxInfoWithView is similar to GetTxInfo, but the effective gas price of a regular transaction is its fee per
+// unit of its intrinsic gas under the intrinsic gas schedule of the given view, so it compares with the gas price
+// of the smart contract transactions in the mempool
+func (exec *Executor) GetTxInfoWithView(tx types.Tx, view *st.StoreView) (*core.TxInfo, result.Result) {
+	if res := tx.Validate(); res.IsError() {
+		return nil, res
+	}
 	txExecutor := exec.getTxExecutor(tx)
 	if txExecutor == nil {
-		return nil, result.Error("Unknown tx type")
+		return nil, result.Error("Unknown tx type").WithErrorCode(result.CodeInvalidTxFormat)
 	}
 
 	txInfo := txExecutor.getTxInfo(tx)
+	gasSchedule := types.DefaultIntrinsicGasSchedule()
+	if view != nil {
+		gasSchedule = view.GetIntrinsicGasSchedule()
+	}
+	if effectiveGasPrice := gasSchedule.EffectiveGasPrice(tx); effectiveGasPrice != nil {
+		txInfo.EffectiveGasPrice = effectiveGasPrice
+	}
 	return txInfo, result.OK
 }
 
 // processTx contains the main logic to process the transaction. If the tx is invalid, a TMSP error will be returned.
 func (exec *Executor) processTx(tx types.Tx, viewSel core.ViewSelector) (common.Hash, result.Result) {
-	chainID := exec.state.GetChainID()
 	var view *st.StoreView
 	switch viewSel {
 	case core.DeliveredView:
@@ -110,42 +294,110 @@ func (exec *Executor) processTx(tx types.Tx, viewSel core.ViewSelector) (common.
 		view = exec.state.Screened()
 	}
 
+	return exec.processTxWithView(tx, view)
+}
+
+func (exec *Executor) processTxWithView(tx types.Tx, view *st.StoreView) (common.Hash, result.Result) {
+	return exec.processTxWithTimeLimit(tx, view, 0)
+}
+
+func (exec *Executor) processTxWithTimeLimit(tx types.Tx, view *st.StoreView, timeLimit time.Duration) (common.Hash, result.Result) {
+	chainID := exec.state.GetChainID()
+
 	sanityCheckResult := exec.sanityCheck(chainID, view, tx)
+	if res := checkStoreError(view); res.IsError() {
+		return common.Hash{}, res
+	}
 	if sanityCheckResult.IsError() {
 		return common.Hash{}, sanityCheckResult
 	}
 
-	txHash, processResult := exec.process(chainID, view, tx)
+	txHash, processResult := exec.process(chainID, view, tx, timeLimit)
+	if res := checkStoreError(view); res.IsError() {
+		return common.Hash{}, res
+	}
 	return txHash, processResult
 }
 
+// checkStoreError returns an internal error if the view failed to access the store, in which case
+// the outcome of the tx does not reflect its validity, e.g. a missing account might just be unreadable
+func checkStoreError(view *st.StoreView) result.Result {
+	if err := view.StoreError(); err != nil {
+		return result.Error("Failed to access the state: %v", err).WithErrorCode(result.CodeInternalStoreError)
+	}
+	return result.OK
+}
+
 func (exec *Executor) sanityCheck(chainID string, view *st.StoreView, tx types.Tx) result.Result {
 	if exec.skipSanityCheck { // Skip checks, e.g. while replaying commmitted blocks.
 		return result.OK
 	}
 
+	// The malformed transactions are rejected before the executors get to them
+	if res := sanityCheckForTxFormat(view, tx); res.IsError() {
+		return res
+	}
+	if res := sanityCheckForSignatureScheme(view, tx); res.IsError() {
+		return res
+	}
+	if res := sanityCheckForMultisig(view, tx); res.IsError() {
+		return res
+	}
+	if res := sanityCheckForSmartContract(view, tx); res.IsError() {
+		return res
+	}
+
 	var sanityCheckResult result.Result
 	txExecutor := exec.getTxExecutor(tx)
 	if txExecutor != nil {
 		sanityCheckResult = txExecutor.sanityCheck(chainID, view, tx)
+		if isSignatureError(sanityCheckResult) {
+			if otherChainID, ok := signedForOtherChain(txExecutor, chainID, view, tx); ok {
+				return result.Error("The transaction is signed for chain %v, not for chain %v", otherChainID, chainID).
+					WithErrorCode(result.CodeWrongChainID)
+			}
+		}
 	} else {
-		sanityCheckResult = result.Error("Unknown tx type")
+		sanityCheckResult = result.Error("Unknown tx type").WithErrorCode(result.CodeInvalidTxFormat)
 	}
 
 	return sanityCheckResult
 }
 
-func (exec *Executor) process(chainID string, view *st.StoreView, tx types.Tx) (common.Hash, result.Result) {
+func isSignatureError(res result.Result) bool {
+	return res.Code == result.CodeInvalidSignature || res.Code == result.CodeInsufficientSignatures
+}
+
+// signedForOtherChain returns the known chain the signatures of the transaction are valid for, if
+// they failed the verification on the given chain. The signatures are verified against the sign
+// bytes of the other chains by running the sanity check again, which leaves the view unchanged.
+func signedForOtherChain(txExecutor TxExecutor, chainID string, view *st.StoreView, tx types.Tx) (string, bool) {
+	for _, otherChainID := range core.KnownChainIDs {
+		if otherChainID == chainID {
+			continue
+		}
+		if !isSignatureError(txExecutor.sanityCheck(otherChainID, view, tx)) {
+			return otherChainID, true
+		}
+	}
+	return "", false
+}
+
+func (exec *Executor) process(chainID string, view *st.StoreView, tx types.Tx, timeLimit time.Duration) (common.Hash, result.Result) {
 	var processResult result.Result
 	var txHash common.Hash
 	txExecutor := exec.getTxExecutor(tx)
 	if txExecutor != nil {
-		txHash, processResult = txExecutor.process(chainID, view, tx)
+		if timeLimitedExecutor, ok := txExecutor.(timeLimitedTxExecutor); ok && timeLimit > 0 {
+			txHash, processResult = timeLimitedExecutor.processWithTimeLimit(chainID, view, tx, timeLimit)
+		} else {
+			txHash, processResult = txExecutor.process(chainID, view, tx)
+		}
 		if processResult.IsError() {
 			logger.Warnf("Tx processing error: %v", processResult.Message)
 		}
 	} else {
-		processResult = result.Error("Unknown tx type")
+		processResult = result.Error("Unknown tx type").WithErrorCode(result.CodeInvalidTxFormat)
 	}
 
 	return txHash, processResult
@@ -168,14 +420,41 @@ func (exec *Executor) getTxExecutor(tx types.Tx) TxExecutor {
 		txExecutor = exec.servicePaymentTxExec
 	case *types.SplitRuleTx:
 		txExecutor = exec.splitRuleTxExec
-	// case *types.SmartContractTx:
-	// 	txExecutor = exec.smartContractTxExec
+	case *types.SmartContractTx:
+		txExecutor = exec.smartContractTxExec
 	case *types.DepositStakeTx:
 		txExecutor = exec.depositStakeTxExec
 	case *types.WithdrawStakeTx:
 		txExecutor = exec.withdrawStakeTxExec
+	case *types.UpdateMultisigTx:
+		txExecutor = exec.updateMultisigTxExec
+	case *types.PartialReleaseFundTx:
+		txExecutor = exec.partialReleaseFundTxExec
+	case *types.ExtendSplitRuleTx:
+		txExecutor = exec.extendSplitRuleTxExec
+	case *types.SweepAccountTx:
+		txExecutor = exec.sweepAccountTxExec
+	case *types.BurnTx:
+		txExecutor = exec.burnTxExec
+	case *types.DoubleSignSlashTx:
+		txExecutor = exec.doubleSignSlashTxExec
+	case *types.StakeCommissionTx:
+		txExecutor = exec.stakeCommissionTxExec
+	case *types.CancelWithdrawTx:
+		txExecutor = exec.cancelWithdrawExec
+	case *types.UpdateValidatorMetadataTx:
+		txExecutor = exec.validatorMetadataExec
+	case *types.UnjailTx:
+		txExecutor = exec.unjailTxExec
+	case *types.EjectStakeTx:
+		txExecutor = exec.ejectStakeTxExec
+	case *types.UpdateValidatorKeyTx:
+		txExecutor = exec.updateValidatorKeyTxExec
 	default:
 		txExecutor = nil
+		if customTxExec := getCustomTxExecutor(tx); customTxExec != nil {
+			txExecutor = customTxExec // the custom tx types are only consulted after the core ones
+		}
 	}
 	return txExecutor
 }
@@ -1,15 +1,24 @@
 package execution
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"math/big"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	st "github.com/thetatoken/theta/ledger/state"
 	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database/backend"
 )
 
 func TestGetInputs(t *testing.T) {
@@ -131,15 +140,15 @@ func TestValidateInputsAdvanced(t *testing.T) {
 	et.acc2State(accIn1, accIn2, accIn3, et.accOut)
 	accMap, res := getInputs(et.state().Delivered(), tx.Inputs)
 	assert.True(res.IsOK(), "validateInputsAdvanced: error retrieving accMap. Error: %v", res.Message)
-	signBytes := tx.SignBytes(et.chainID)
+	signTargets := [][]byte{tx.SignBytes(et.chainID)}
 
 	//test bad case, unsigned
-	totalCoins, res := validateInputsAdvanced(accMap, signBytes, tx.Inputs)
+	totalCoins, res := validateInputsAdvanced(accMap, signTargets, tx.Inputs)
 	assert.True(res.IsError(), "validateInputsAdvanced: expected an error on an unsigned tx input")
 
 	//test good case sgined
 	et.signSendTx(tx, accIn1, accIn2, accIn3, et.accOut)
-	totalCoins, res = validateInputsAdvanced(accMap, signBytes, tx.Inputs)
+	totalCoins, res = validateInputsAdvanced(accMap, signTargets, tx.Inputs)
 	assert.True(res.IsOK(), "validateInputsAdvanced: expected no error on good tx input. Error: %v", res.Message)
 
 	txTotalCoins := tx.Inputs[0].Coins.
@@ -158,28 +167,28 @@ func TestValidateInputAdvanced(t *testing.T) {
 	tx := types.MakeSendTx(1, et.accOut, et.accIn)
 
 	et.acc2State(et.accIn, et.accOut)
-	signBytes := tx.SignBytes(et.chainID)
+	signTargets := [][]byte{tx.SignBytes(et.chainID)}
 
 	//unsigned case
-	res := validateInputAdvanced(&et.accIn.Account, signBytes, tx.Inputs[0])
+	res := validateInputAdvanced(&et.accIn.Account, signTargets, tx.Inputs[0])
 	assert.True(res.IsError(), "validateInputAdvanced: expected error on tx input without signature")
 
 	//good signed case
 	et.signSendTx(tx, et.accIn, et.accOut)
-	res = validateInputAdvanced(&et.accIn.Account, signBytes, tx.Inputs[0])
+	res = validateInputAdvanced(&et.accIn.Account, signTargets, tx.Inputs[0])
 	assert.True(res.IsOK(), "validateInputAdvanced: expected no error on good tx input. Error: %v", res.Message)
 
 	//bad sequence case
 	et.accIn.Sequence = 1
 	et.signSendTx(tx, et.accIn, et.accOut)
-	res = validateInputAdvanced(&et.accIn.Account, signBytes, tx.Inputs[0])
-	assert.Equal(result.CodeInvalidSequence, res.Code, "validateInputAdvanced: expected error on tx input with bad sequence")
+	res = validateInputAdvanced(&et.accIn.Account, signTargets, tx.Inputs[0])
+	assert.Equal(result.CodeSequenceTooLow, res.Code, "validateInputAdvanced: expected error on tx input with bad sequence")
 	et.accIn.Sequence = 0 //restore sequence
 
 	//bad balance case
 	et.accIn.Balance = types.NewCoins(2, 0)
 	et.signSendTx(tx, et.accIn, et.accOut)
-	res = validateInputAdvanced(&et.accIn.Account, signBytes, tx.Inputs[0])
+	res = validateInputAdvanced(&et.accIn.Account, signTargets, tx.Inputs[0])
 	assert.Equal(result.CodeInsufficientFund, res.Code,
 		"validateInputAdvanced: expected error on tx input with insufficient funds %v", et.accIn.Sequence)
 }
@@ -281,6 +290,508 @@ func TestSendTx(t *testing.T) {
 		"ExecTx/good DeliverTx: unexpected change in output balance, got: %v, expected: %v", balOut, balOutExp)
 }
 
+func TestSendTxEd25519(t *testing.T) {
+	assert := assert.New(t)
+	et := NewExecTest()
+
+	secpAcc := et.accIn
+	edAcc := types.PrivAccountFromEd25519Secret("ed25519_foo")
+	edAcc.Balance = types.NewCoins(700000, 50*getMinimumTxFee())
+	et.accIn = edAcc
+	et.acc2State(secpAcc)
+	et.acc2State(et.accIn)
+	et.acc2State(et.accOut)
+
+	// Not accepted before the fork
+	tx := types.MakeSendTx(1, et.accOut, et.accIn)
+	et.signSendTx(tx, et.accIn)
+	_, res := et.executor.ScreenTx(tx)
+	assert.Equal(result.CodeInvalidSignature, res.Code)
+	assert.Contains(res.Message, "not supported")
+	et.fastforwardTo(common.HeightEnableEd25519Signature)
+
+	// A secp256k1 signature is rejected for the Ed25519 account
+	et.signSendTx(tx, secpAcc)
+	_, res = et.executor.ScreenTx(tx)
+	assert.Equal(result.CodeInvalidSignature, res.Code)
+
+	// An Ed25519 signature is rejected for the secp256k1 account
+	secpTx := types.MakeSendTx(1, et.accOut, secpAcc)
+	et.signSendTx(secpTx, edAcc)
+	_, res = et.executor.ScreenTx(secpTx)
+	assert.Equal(result.CodeInvalidSignature, res.Code)
+
+	et.signSendTx(tx, et.accIn)
+	_, res = et.executor.ScreenTx(tx)
+	assert.True(res.IsOK(), res.Message)
+	res, balIn, balInExp, balOut, balOutExp := et.execSendTx(tx, false)
+	assert.True(res.IsOK(), res.Message)
+	assert.True(balIn.IsEqual(balInExp), "got %v, expected: %v", balIn, balInExp)
+	assert.True(balOut.IsEqual(balOutExp), "got %v, expected: %v", balOut, balOutExp)
+}
+
+func TestSendTxData(t *testing.T) {
+	assert := assert.New(t)
+	et := NewExecTest()
+	et.acc2State(et.accIn)
+	et.acc2State(et.accOut)
+
+	newSendTx := func(seq, dataSize int, fee int64) *types.SendTx {
+		tx := types.MakeSendTx(seq, et.accOut, et.accIn)
+		tx.Data = make(common.Bytes, dataSize)
+		tx.Fee = types.NewCoins(0, fee)
+		tx.Inputs[0].Coins = tx.Outputs[0].Coins.Plus(tx.Fee)
+		et.signSendTx(tx, et.accIn)
+		return tx
+	}
+	dataFee := func(dataSize int) int64 {
+		return int64(dataSize) * int64(types.SendTxDataFeePerByteTFuelWei)
+	}
+
+	// Not accepted before the fork
+	_, res := et.executor.ScreenTx(newSendTx(1, 8, getMinimumTxFee()+dataFee(8)))
+	assert.Equal(result.CodeSendTxDataNotEnabled, res.Code)
+	et.fastforwardTo(common.HeightEnableSendTxData)
+
+	// The memo is limited in size
+	_, res = et.executor.ScreenTx(newSendTx(1, types.MaxSendTxDataSize+1, getMinimumTxFee()+dataFee(types.MaxSendTxDataSize+1)))
+	assert.Equal(result.CodeSendTxDataTooLarge, res.Code)
+
+	// The memo is charged per byte
+	_, res = et.executor.ScreenTx(newSendTx(1, types.MaxSendTxDataSize, getMinimumTxFee()))
+	assert.Equal(result.CodeInvalidFee, res.Code)
+	_, res = et.executor.ScreenTx(newSendTx(1, types.MaxSendTxDataSize, getMinimumTxFee()+dataFee(types.MaxSendTxDataSize)-1))
+	assert.Equal(result.CodeInvalidFee, res.Code)
+
+	tx := newSendTx(1, types.MaxSendTxDataSize, getMinimumTxFee()+dataFee(types.MaxSendTxDataSize))
+	_, res = et.executor.ScreenTx(tx)
+	assert.True(res.IsOK(), res.Message)
+	res, balIn, balInExp, balOut, balOutExp := et.execSendTx(tx, false)
+	assert.True(res.IsOK(), res.Message)
+	assert.True(balIn.IsEqual(balInExp), "got %v, expected: %v", balIn, balInExp)
+	assert.True(balOut.IsEqual(balOutExp), "got %v, expected: %v", balOut, balOutExp)
+
+	// The memo is covered by the signature
+	tx = newSendTx(2, 8, getMinimumTxFee()+dataFee(8))
+	tx.Data[0] = 1
+	_, res = et.executor.ScreenTx(tx)
+	assert.True(res.IsError())
+	assert.Equal(result.CodeInvalidSignature, res.Code)
+}
+
+func TestSendTxValidUntilHeight(t *testing.T) {
+	assert := assert.New(t)
+	et := NewExecTest()
+	et.acc2State(et.accIn)
+	et.acc2State(et.accOut)
+
+	newSendTx := func(seq int, validUntilHeight uint64) *types.SendTx {
+		tx := types.MakeSendTx(seq, et.accOut, et.accIn)
+		tx.ValidUntilHeight = validUntilHeight
+		et.signSendTx(tx, et.accIn)
+		return tx
+	}
+
+	// Not accepted before the fork
+	blockHeight := et.state().Screened().Height() + 1
+	_, res := et.executor.ScreenTx(newSendTx(1, blockHeight))
+	assert.Equal(result.CodeSendTxExpiryNotEnabled, res.Code)
+	et.fastforwardTo(common.HeightEnableSendTxExpiry)
+
+	// The view points to the parent of the block the tx is executed in
+	blockHeight = et.state().Screened().Height() + 1
+
+	tx := newSendTx(1, blockHeight-1)
+	_, res = et.executor.ScreenTx(tx)
+	assert.Equal(result.CodeTxExpired, res.Code)
+	res, _, _, _, _ = et.execSendTx(tx, false)
+	assert.Equal(result.CodeTxExpired, res.Code)
+
+	// Valid until and including the block height
+	tx = newSendTx(1, blockHeight)
+	_, res = et.executor.ScreenTx(tx)
+	assert.True(res.IsOK(), res.Message)
+	txInfo, res := et.executor.GetTxInfo(tx)
+	assert.True(res.IsOK(), res.Message)
+	assert.Equal(blockHeight+1, txInfo.ExpirationHeight)
+
+	tx = newSendTx(2, 0)
+	_, res = et.executor.ScreenTx(tx)
+	assert.True(res.IsOK(), res.Message)
+	txInfo, _ = et.executor.GetTxInfo(tx)
+	assert.Equal(uint64(0), txInfo.ExpirationHeight)
+
+	// The valid-until height is covered by the signature
+	tx = newSendTx(3, blockHeight)
+	tx.ValidUntilHeight = 0
+	_, res = et.executor.ScreenTx(tx)
+	assert.Equal(result.CodeInvalidSignature, res.Code)
+}
+
+func TestSendTxMultipleInputsOutputs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	et := NewExecTest()
+
+	txFee := getMinimumTxFee()
+	accIns := []types.PrivAccount{
+		types.MakeAccWithInitBalance("in1", types.NewCoins(100, 10*txFee)),
+		types.MakeAccWithInitBalance("in2", types.NewCoins(100, 10*txFee)),
+		types.MakeAccWithInitBalance("in3", types.NewCoins(100, 10*txFee)),
+	}
+	accIns[1].Account.Sequence = 4
+	accIns[2].Account.Sequence = 9
+	et.acc2State(accIns...)
+	et.acc2State(et.accOut)
+	newOut := types.MakeAcc("new_output")
+
+	// Each input has its own sequence and amount, and the fee is paid jointly
+	newSendTx := func() *types.SendTx {
+		return &types.SendTx{
+			Fee: types.NewCoins(0, txFee),
+			Inputs: []types.TxInput{
+				types.NewTxInput(accIns[0].Address, types.NewCoins(10, 0), 1),
+				types.NewTxInput(accIns[1].Address, types.NewCoins(5, txFee), 5),
+				types.NewTxInput(accIns[2].Address, types.NewCoins(0, 100), 10),
+			},
+			Outputs: []types.TxOutput{
+				{Address: et.accOut.Address, Coins: types.NewCoins(12, 60)},
+				{Address: newOut.Address, Coins: types.NewCoins(3, 40)},
+			},
+		}
+	}
+
+	// Any failing input invalidates the whole tx, leaving every account untouched
+	rootHash := et.state().Delivered().Hash()
+	checkRejected := func(tx *types.SendTx, code result.ErrorCode) {
+		_, res := et.executor.ExecuteTx(tx)
+		assert.Equal(code, res.Code, res.Message)
+		assert.Equal(rootHash, et.state().Delivered().Hash())
+	}
+
+	tx := newSendTx()
+	tx.Inputs[2].Sequence = 9
+	et.signSendTx(tx, accIns...)
+	checkRejected(tx, result.CodeSequenceTooLow)
+
+	tx = newSendTx()
+	et.signSendTx(tx, accIns[0], accIns[1], accIns[1])
+	checkRejected(tx, result.CodeInvalidSignature)
+
+	tx = newSendTx()
+	et.signSendTx(tx, accIns...)
+	tx.Inputs[2].Signature = nil
+	checkRejected(tx, result.CodeInvalidSignature)
+
+	tx = newSendTx()
+	tx.Inputs[2].Coins = types.NewCoins(101, 100)
+	tx.Outputs[1].Coins = types.NewCoins(104, 40)
+	et.signSendTx(tx, accIns...)
+	checkRejected(tx, result.CodeInsufficientFund)
+
+	// The inputs must exactly equal the outputs plus the fee
+	for _, delta := range []types.Coins{types.NewCoins(1, 0), types.NewCoins(-1, 0), types.NewCoins(0, 1), types.NewCoins(0, -1)} {
+		tx = newSendTx()
+		tx.Outputs[0].Coins = tx.Outputs[0].Coins.Plus(delta)
+		et.signSendTx(tx, accIns...)
+		checkRejected(tx, result.CodeSendTxUnbalanced)
+	}
+	tx = newSendTx()
+	tx.Fee = types.NewCoins(0, txFee+1)
+	et.signSendTx(tx, accIns...)
+	checkRejected(tx, result.CodeSendTxUnbalanced)
+
+	tx = newSendTx()
+	et.signSendTx(tx, accIns...)
+	_, res := et.executor.ExecuteTx(tx)
+	require.True(res.IsOK(), res.Message)
+
+	view := et.state().Delivered()
+	for i, accIn := range accIns {
+		acc := view.GetAccount(accIn.Address)
+		assert.Equal(accIn.Account.Sequence+1, acc.Sequence)
+		assert.True(accIn.Account.Balance.Minus(tx.Inputs[i].Coins).IsEqual(acc.Balance), "input %v got %v", i, acc.Balance)
+	}
+	assert.True(et.accOut.Account.Balance.Plus(types.NewCoins(12, 60)).IsEqual(view.GetAccount(et.accOut.Address).Balance))
+	assert.True(types.NewCoins(3, 40).IsEqual(view.GetAccount(newOut.Address).Balance))
+}
+
+func TestSendTxDustPolicy(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	et := NewExecTest()
+
+	// Restore the default thresholds, the accounts are committed to all the views along with them
+	thetaDust := int64(types.DefaultDustThresholdThetaWei)
+	dust := int64(types.DefaultDustThresholdTFuelWei)
+	minNewAccount := int64(types.DefaultMinNewAccountTFuelWei)
+	et.state().Delivered().UpdateDustThreshold(types.NewCoins(thetaDust, dust))
+	et.state().Delivered().UpdateMinNewAccountAmount(
+		types.NewCoins(int64(types.DefaultMinNewAccountThetaWei), int64(types.DefaultMinNewAccountTFuelWei)))
+
+	txFee := getMinimumTxFee()
+	accIn := types.MakeAccWithInitBalance("dust_in", types.NewCoins(thetaDust, 10*minNewAccount))
+	accOut1 := types.MakeAccWithInitBalance("dust_out1", types.NewCoins(0, minNewAccount))
+	accOut2 := types.MakeAccWithInitBalance("dust_out2", types.NewCoins(0, minNewAccount))
+	// Below the thresholds, e.g. created before they were raised
+	accSmall := types.MakeAccWithInitBalance("dust_small", types.NewCoins(5, dust-1))
+	et.acc2State(accIn, accOut1, accOut2, accSmall)
+	newOut := types.MakeAcc("dust_new")
+
+	newSendTx := func(outputs ...types.TxOutput) *types.SendTx {
+		tx := &types.SendTx{
+			Fee:     types.NewCoins(0, txFee),
+			Inputs:  []types.TxInput{types.NewTxInput(accIn.Address, sumOutputs(outputs).Plus(types.NewCoins(0, txFee)), 1)},
+			Outputs: outputs,
+		}
+		et.signSendTx(tx, accIn)
+		return tx
+	}
+
+	// The outputs are not subject to the thresholds before the fork
+	tx := newSendTx(types.TxOutput{Address: newOut.Address, Coins: types.NewCoins(0, 1)})
+	_, res := et.executor.ScreenTx(tx)
+	assert.True(res.IsOK(), res.Message)
+	et.fastforwardTo(common.HeightEnableDustThreshold)
+
+	// Only one output is dust, the whole tx is rejected at screening and block validation
+	rootHash := et.state().Delivered().Hash()
+	checkRejected := func(tx *types.SendTx, code result.ErrorCode) {
+		_, res := et.executor.ScreenTx(tx)
+		assert.Equal(code, res.Code, res.Message)
+		_, res = et.executor.ExecuteTx(tx)
+		assert.Equal(code, res.Code, res.Message)
+		assert.Equal(rootHash, et.state().Delivered().Hash())
+	}
+
+	tx = newSendTx(
+		types.TxOutput{Address: accOut1.Address, Coins: types.NewCoins(0, dust)},
+		types.TxOutput{Address: accOut2.Address, Coins: types.NewCoins(0, dust-1)},
+		types.TxOutput{Address: accSmall.Address, Coins: types.NewCoins(0, 2*dust)},
+	)
+	checkRejected(tx, result.CodeSendTxDustOutput)
+
+	// Each non-zero coin amount needs to meet its threshold
+	tx = newSendTx(types.TxOutput{Address: accOut1.Address, Coins: types.NewCoins(1, dust)})
+	checkRejected(tx, result.CodeSendTxDustOutput)
+
+	// The zero outputs are rejected outright
+	tx = newSendTx(
+		types.TxOutput{Address: accOut1.Address, Coins: types.NewCoins(0, dust)},
+		types.TxOutput{Address: accOut2.Address, Coins: types.NewCoins(0, 0)},
+	)
+	checkRejected(tx, result.CodeSendTxZeroOutput)
+
+	// Creating a new account costs at least the minimum
+	tx = newSendTx(types.TxOutput{Address: newOut.Address, Coins: types.NewCoins(0, minNewAccount-1)})
+	checkRejected(tx, result.CodeSendTxNewAccountTooSmall)
+
+	tx = newSendTx(
+		types.TxOutput{Address: accOut1.Address, Coins: types.NewCoins(0, dust)},
+		types.TxOutput{Address: accOut2.Address, Coins: types.NewCoins(0, dust+1)},
+		types.TxOutput{Address: newOut.Address, Coins: types.NewCoins(0, minNewAccount)},
+	)
+	_, res = et.executor.ExecuteTx(tx)
+	require.True(res.IsOK(), res.Message)
+	assert.True(types.NewCoins(0, minNewAccount).IsEqual(et.state().Delivered().GetAccount(newOut.Address).Balance))
+
+	// The accounts below the thresholds remain spendable, the inputs are not subject to them
+	tx = &types.SendTx{
+		Fee: types.NewCoins(0, txFee),
+		Inputs: []types.TxInput{
+			types.NewTxInput(accSmall.Address, types.NewCoins(5, dust-1), 1),
+			types.NewTxInput(accIn.Address, types.NewCoins(thetaDust, txFee+1), 2),
+		},
+		Outputs: []types.TxOutput{
+			{Address: accOut1.Address, Coins: types.NewCoins(thetaDust+5, dust)},
+		},
+	}
+	signers := []types.PrivAccount{accSmall, accIn}
+	if types.NormalizeTx(tx) { // the inputs are sorted by address past the fork
+		signers = []types.PrivAccount{accIn, accSmall}
+	}
+	et.signSendTx(tx, signers...)
+	_, res = et.executor.ExecuteTx(tx)
+	require.True(res.IsOK(), res.Message)
+	assert.True(types.NewCoins(0, 0).IsEqual(et.state().Delivered().GetAccount(accSmall.Address).Balance))
+}
+
+func TestSendTxNumAccountsLimit(t *testing.T) {
+	assert := assert.New(t)
+	et := NewExecTest()
+	et.acc2State(et.accIn)
+
+	txFee := getMinimumTxFee()
+	newSendTx := func(numInputs, numOutputs int) *types.SendTx {
+		tx := &types.SendTx{Fee: types.NewCoins(0, txFee)}
+		for i := 0; i < numInputs; i++ {
+			tx.Inputs = append(tx.Inputs, types.NewTxInput(common.BytesToAddress([]byte(fmt.Sprintf("in_%v", i))), types.NewCoins(1, 0), 1))
+		}
+		tx.Inputs[0] = types.NewTxInput(et.accIn.Address, types.NewCoins(1, txFee), 1)
+		for i := 0; i < numOutputs; i++ {
+			tx.Outputs = append(tx.Outputs, types.TxOutput{Address: common.BytesToAddress([]byte(fmt.Sprintf("out_%v", i))), Coins: types.NewCoins(0, 0)})
+		}
+		return tx
+	}
+
+	// The number of inputs is not limited on its own before the fork
+	_, res := et.executor.ScreenTx(newSendTx(types.MaxSendTxInputs+1, 1))
+	assert.NotEqual(result.CodeSendTxTooManyAccounts, res.Code)
+	et.fastforwardTo(common.HeightEnableSendTxInputLimit)
+
+	_, res = et.executor.ScreenTx(newSendTx(types.MaxSendTxInputs+1, 1))
+	assert.Equal(result.CodeSendTxTooManyAccounts, res.Code)
+	_, res = et.executor.ScreenTx(newSendTx(1, types.MaxAccountsAffectedPerTx))
+	assert.Equal(result.CodeSendTxTooManyAccounts, res.Code)
+
+	// Within the limits, the tx gets to the other checks
+	_, res = et.executor.ScreenTx(newSendTx(types.MaxSendTxInputs, 1))
+	assert.NotEqual(result.CodeSendTxTooManyAccounts, res.Code)
+	_, res = et.executor.ScreenTx(newSendTx(1, types.MaxAccountsAffectedPerTx-1))
+	assert.NotEqual(result.CodeSendTxTooManyAccounts, res.Code)
+
+	// The tx without inputs is rejected rather than crashing the tx info extraction
+	tx := &types.SendTx{Fee: types.NewCoins(0, txFee), Outputs: []types.TxOutput{{Address: et.accOut.Address, Coins: types.NewCoins(0, 0)}}}
+	txInfo, res := et.executor.GetTxInfo(tx)
+	assert.True(res.IsOK(), res.Message)
+	assert.NotNil(txInfo)
+	_, res = et.executor.ScreenTx(tx)
+	assert.True(res.IsError())
+}
+
+func TestMultisigAccount(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	et := NewExecTest()
+	et.acc2State(et.accIn)
+	et.acc2State(et.accOut)
+
+	owner1, owner2, owner3 := types.MakeAcc("owner1"), types.MakeAcc("owner2"), types.MakeAcc("owner3")
+	owners := []common.Address{owner1.Address, owner2.Address, owner3.Address}
+	fee := types.NewCoins(0, getMinimumTxFee())
+
+	newUpdateTx := func(seq int, owners []common.Address, threshold uint64) *types.UpdateMultisigTx {
+		return &types.UpdateMultisigTx{
+			Fee:       fee,
+			Account:   types.NewTxInput(et.accIn.Address, types.NewCoins(0, 0), seq),
+			Owners:    owners,
+			Threshold: threshold,
+		}
+	}
+	newSendTx := func(seq int) *types.SendTx {
+		return types.MakeSendTx(seq, et.accOut, et.accIn)
+	}
+	coSign := func(tx types.Tx, in *types.TxInput, signers ...types.PrivAccount) {
+		signBytes := tx.SignBytes(et.chainID)
+		for _, signer := range signers {
+			in.Signatures = append(in.Signatures, signer.Sign(signBytes))
+		}
+	}
+	sequence := func() uint64 {
+		return et.state().Delivered().GetAccount(et.accIn.Address).Sequence
+	}
+
+	// The multisig accounts are not enabled before the fork, neither are the signatures of their owners
+	updateTx := newUpdateTx(1, owners, 2)
+	updateTx.Account.Signature = et.accIn.Sign(updateTx.SignBytes(et.chainID))
+	_, res := et.executor.ExecuteTx(updateTx)
+	assert.Equal(result.CodeMultisigNotEnabled, res.Code)
+	sendTx := newSendTx(1)
+	coSign(sendTx, &sendTx.Inputs[0], owner1, owner2)
+	_, res = et.executor.ExecuteTx(sendTx)
+	assert.Equal(result.CodeMultisigNotEnabled, res.Code)
+	et.fastforwardTo(common.HeightEnableMultisig)
+
+	// The account key turns the account into a 2 of 3 multisig account
+	updateTx = newUpdateTx(1, owners, 4)
+	updateTx.Account.Signature = et.accIn.Sign(updateTx.SignBytes(et.chainID))
+	_, res = et.executor.ExecuteTx(updateTx)
+	assert.Equal(result.CodeInvalidMultisigPolicy, res.Code)
+
+	updateTx = newUpdateTx(1, owners, 2)
+	updateTx.Account.Signature = et.accIn.Sign(updateTx.SignBytes(et.chainID))
+	_, res = et.executor.ExecuteTx(updateTx)
+	require.True(res.IsOK(), res.Message)
+	acc := et.state().Delivered().GetAccount(et.accIn.Address)
+	assert.Equal(&types.MultisigPolicy{Owners: owners, Threshold: 2}, acc.Multisig)
+	assert.Equal(uint64(1), acc.Sequence)
+
+	// The account key is no longer accepted
+	sendTx = newSendTx(2)
+	et.signSendTx(sendTx, et.accIn)
+	_, res = et.executor.ExecuteTx(sendTx)
+	assert.Equal(result.CodeInvalidSignature, res.Code)
+
+	// Missing signatures
+	sendTx = newSendTx(2)
+	coSign(sendTx, &sendTx.Inputs[0], owner1)
+	_, res = et.executor.ExecuteTx(sendTx)
+	assert.Equal(result.CodeInsufficientSignatures, res.Code)
+
+	// Duplicate signers
+	sendTx = newSendTx(2)
+	coSign(sendTx, &sendTx.Inputs[0], owner1, owner1)
+	_, res = et.executor.ExecuteTx(sendTx)
+	assert.Equal(result.CodeInvalidSignature, res.Code)
+
+	// Non-owner signers
+	sendTx = newSendTx(2)
+	coSign(sendTx, &sendTx.Inputs[0], owner1, et.accIn)
+	_, res = et.executor.ExecuteTx(sendTx)
+	assert.Equal(result.CodeInvalidSignature, res.Code)
+
+	// Any two owners share the sequence of the account
+	sendTx = newSendTx(2)
+	coSign(sendTx, &sendTx.Inputs[0], owner3, owner1)
+	_, res = et.executor.ExecuteTx(sendTx)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(uint64(2), sequence())
+
+	sendTx = newSendTx(2)
+	coSign(sendTx, &sendTx.Inputs[0], owner1, owner2)
+	_, res = et.executor.ExecuteTx(sendTx)
+	assert.Equal(result.CodeSequenceTooLow, res.Code)
+
+	// The threshold is raised while a transaction signed by two owners is in flight
+	pendingTx := newSendTx(4)
+	coSign(pendingTx, &pendingTx.Inputs[0], owner1, owner2)
+
+	updateTx = newUpdateTx(3, owners, 3)
+	updateTx.Account.Signature = et.accIn.Sign(updateTx.SignBytes(et.chainID))
+	_, res = et.executor.ExecuteTx(updateTx)
+	assert.Equal(result.CodeInvalidSignature, res.Code)
+
+	updateTx = newUpdateTx(3, owners, 3)
+	coSign(updateTx, &updateTx.Account, owner2, owner3)
+	_, res = et.executor.ExecuteTx(updateTx)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(uint64(3), sequence())
+
+	_, res = et.executor.ExecuteTx(pendingTx)
+	assert.Equal(result.CodeInsufficientSignatures, res.Code)
+	coSign(pendingTx, &pendingTx.Inputs[0], owner3)
+	_, res = et.executor.ExecuteTx(pendingTx)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(uint64(4), sequence())
+
+	// The owners turn the account back into a regular one
+	updateTx = newUpdateTx(5, nil, 0)
+	coSign(updateTx, &updateTx.Account, owner1, owner2, owner3)
+	_, res = et.executor.ExecuteTx(updateTx)
+	require.True(res.IsOK(), res.Message)
+	assert.Nil(et.state().Delivered().GetAccount(et.accIn.Address).Multisig)
+
+	sendTx = newSendTx(6)
+	et.signSendTx(sendTx, et.accIn)
+	_, res = et.executor.ExecuteTx(sendTx)
+	require.True(res.IsOK(), res.Message)
+
+	updateTx = newUpdateTx(7, nil, 0)
+	updateTx.Account.Signature = et.accIn.Sign(updateTx.SignBytes(et.chainID))
+	_, res = et.executor.ExecuteTx(updateTx)
+	assert.Equal(result.CodeInvalidMultisigPolicy, res.Code)
+}
+
 func TestSendDuplicatedInputOutput(t *testing.T) {
 	assert := assert.New(t)
 	et := NewExecTest()
@@ -789,18 +1300,146 @@ func TestServicePaymentTxNormalExecutionAndSlash(t *testing.T) {
 	retrievedCarolAcc3 := et.state().Delivered().GetAccount(carol.Address)
 	assert.Equal(carolInitBalance.Plus(types.Coins{TFuelWei: big.NewInt(payAmount3 - txFee)}), retrievedCarolAcc3.Balance) // payAmount3 - txFee: need to account for tx fee
 
-	// Simulate micropayment #4 between Alice and Carol. This is an overspend, alice should get slashed.
+	// Simulate micropayment #4 between Alice and Carol. This is an overspend, which is rejected.
 	payAmount4 := int64(2000 * txFee)
 	srcSeq, tgtSeq, paymentSeq, reserveSeq = 1, 2, 4, 1
 	_ = createServicePaymentTx(et.chainID, &alice, &carol, 70000*txFee, srcSeq, tgtSeq, paymentSeq, reserveSeq, resourceID)
 	servicePaymentTx4 := createServicePaymentTx(et.chainID, &alice, &carol, payAmount4, srcSeq, tgtSeq, paymentSeq, reserveSeq, resourceID)
 	res = et.executor.getTxExecutor(servicePaymentTx4).sanityCheck(et.chainID, et.state().Delivered(), servicePaymentTx4)
-	assert.True(res.IsOK(), res.Message) // the following process() call will create an SlashIntent
+	assert.Equal(result.CodeReservedFundOverdraft, res.Code, res.Message)
 
+	// An overspend in a committed block does not transfer any fund
 	assert.Equal(0, len(et.state().Delivered().GetSlashIntents()))
 	_, res = et.executor.getTxExecutor(servicePaymentTx4).process(et.chainID, et.state().Delivered(), servicePaymentTx4)
 	assert.True(res.IsOK(), res.Message)
 	//assert.Equal(1, len(et.state().Delivered().GetSlashIntents()))
+	retrievedAliceAcc4 := et.state().Delivered().GetAccount(alice.Address)
+	assert.Equal(retrievedAliceAcc3.ReservedFunds[0].UsedFund, retrievedAliceAcc4.ReservedFunds[0].UsedFund)
+}
+
+func TestServicePaymentTxConcurrentOverdraft(t *testing.T) {
+	assert := assert.New(t)
+	et, resourceID, alice, bob, carol, _, bobInitBalance, carolInitBalance := setupForServicePayment(assert)
+	et.state().Commit()
+
+	txFee := getMinimumTxFee()
+
+	// Alice reserved 1000*txFee. Each settlement is covered by the reserved fund on its own, but
+	// not together with the other one in the same block.
+	payAmountBob, payAmountCarol := int64(600*txFee), int64(500*txFee)
+	servicePaymentTxBob := createServicePaymentTx(et.chainID, &alice, &bob, payAmountBob, 1, 1, 1, 1, resourceID)
+	servicePaymentTxCarol := createServicePaymentTx(et.chainID, &alice, &carol, payAmountCarol, 1, 1, 1, 1, resourceID)
+
+	// Both pass the sanity check against the last committed state
+	res := et.executor.getTxExecutor(servicePaymentTxBob).sanityCheck(et.chainID, et.state().Delivered(), servicePaymentTxBob)
+	assert.True(res.IsOK(), res.Message)
+	res = et.executor.getTxExecutor(servicePaymentTxCarol).sanityCheck(et.chainID, et.state().Delivered(), servicePaymentTxCarol)
+	assert.True(res.IsOK(), res.Message)
+
+	// In the block, the second settlement sees the fund used by the first one
+	_, res = et.executor.ExecuteTx(servicePaymentTxBob)
+	assert.True(res.IsOK(), res.Message)
+	_, res = et.executor.ExecuteTx(servicePaymentTxCarol)
+	assert.Equal(result.CodeReservedFundOverdraft, res.Code, res.Message)
+
+	et.state().Commit()
+
+	retrievedAliceAcc := et.state().Delivered().GetAccount(alice.Address)
+	assert.Equal(types.NewCoins(0, payAmountBob), retrievedAliceAcc.ReservedFunds[0].UsedFund)
+	retrievedBobAcc := et.state().Delivered().GetAccount(bob.Address)
+	assert.Equal(bobInitBalance.Plus(types.NewCoins(0, payAmountBob-txFee)), retrievedBobAcc.Balance)
+	retrievedCarolAcc := et.state().Delivered().GetAccount(carol.Address)
+	assert.Equal(carolInitBalance, retrievedCarolAcc.Balance)
+
+	// Settling the remaining fund still succeeds
+	servicePaymentTxCarol = createServicePaymentTx(et.chainID, &alice, &carol, 400*txFee, 1, 1, 1, 1, resourceID)
+	_, res = et.executor.ExecuteTx(servicePaymentTxCarol)
+	assert.True(res.IsOK(), res.Message)
+	servicePaymentTxBob = createServicePaymentTx(et.chainID, &alice, &bob, 1, 1, 2, 2, 1, resourceID)
+	_, res = et.executor.ExecuteTx(servicePaymentTxBob)
+	assert.Equal(result.CodeReservedFundOverdraft, res.Code, res.Message)
+}
+
+func TestPartialReleaseFundTx(t *testing.T) {
+	assert := assert.New(t)
+
+	// The fund is reserved in the block right before the fork
+	setupHeight := common.HeightEnablePartialReleaseFund - 2
+	et, resourceID, alice, bob, carol, _, _, _ := setupForServicePaymentAt(assert, setupHeight)
+
+	txFee := getMinimumTxFee()
+
+	createPartialReleaseFundTx := func(source, target *types.PrivAccount, amount int64, srcSeq int) *types.PartialReleaseFundTx {
+		tx := &types.PartialReleaseFundTx{
+			Fee: types.NewCoins(0, txFee),
+			Source: types.TxInput{
+				Address:  source.Address,
+				Sequence: uint64(srcSeq),
+			},
+			Target: types.TxInput{
+				Address: target.Address,
+			},
+			ReserveSequence: 1,
+			Amount:          types.NewCoins(0, amount),
+		}
+		signBytes := tx.SignBytes(et.chainID)
+		tx.Source.Signature = source.Sign(signBytes)
+		tx.Target.Signature = target.Sign(signBytes)
+		return tx
+	}
+
+	// The partial releases are not enabled before the fork
+	_, res := et.executor.ScreenTx(createPartialReleaseFundTx(&alice, &bob, 200*txFee, 2))
+	assert.Equal(result.CodePartialReleaseFundNotEnabled, res.Code, res.Message)
+	et.state().Commit()
+
+	// Bob settles part of the fund
+	servicePaymentTx := createServicePaymentTx(et.chainID, &alice, &bob, 300*txFee, 1, 1, 1, 1, resourceID)
+	_, res = et.executor.ExecuteTx(servicePaymentTx)
+	assert.True(res.IsOK(), res.Message)
+	et.state().Commit()
+
+	// Signed by the source only
+	partialReleaseTx := createPartialReleaseFundTx(&alice, &bob, 200*txFee, 2)
+	partialReleaseTx.Target.Signature = nil
+	_, res = et.executor.ScreenTx(partialReleaseTx)
+	assert.Equal(result.CodeInvalidSignature, res.Code, res.Message)
+
+	// Beyond the remaining fund
+	partialReleaseTx = createPartialReleaseFundTx(&alice, &bob, 701*txFee, 2)
+	_, res = et.executor.ScreenTx(partialReleaseTx)
+	assert.Equal(result.CodeReservedFundOverdraft, res.Code, res.Message)
+
+	// The reserved fund has paid Bob, Carol cannot agree to the release
+	partialReleaseTx = createPartialReleaseFundTx(&alice, &carol, 200*txFee, 2)
+	_, res = et.executor.ScreenTx(partialReleaseTx)
+	assert.Equal(result.CodePartialReleaseFundCheckFailed, res.Code, res.Message)
+
+	aliceBalance := et.state().Delivered().GetAccount(alice.Address).Balance
+	partialReleaseTx = createPartialReleaseFundTx(&alice, &bob, 600*txFee, 2)
+	_, res = et.executor.ExecuteTx(partialReleaseTx)
+	assert.True(res.IsOK(), res.Message)
+	et.state().Commit()
+
+	retrievedAliceAcc := et.state().Delivered().GetAccount(alice.Address)
+	assert.Equal(aliceBalance.Plus(types.NewCoins(0, 600*txFee-txFee)), retrievedAliceAcc.Balance)
+	assert.Equal(1, len(retrievedAliceAcc.ReservedFunds))
+	assert.Equal(types.NewCoins(0, 400*txFee), retrievedAliceAcc.ReservedFunds[0].InitialFund)
+	assert.Equal(types.NewCoins(0, 300*txFee), retrievedAliceAcc.ReservedFunds[0].UsedFund)
+
+	// The released fund can no longer be settled
+	servicePaymentTx = createServicePaymentTx(et.chainID, &alice, &bob, 101*txFee, 1, 2, 2, 1, resourceID)
+	_, res = et.executor.ExecuteTx(servicePaymentTx)
+	assert.Equal(result.CodeReservedFundOverdraft, res.Code, res.Message)
+	servicePaymentTx = createServicePaymentTx(et.chainID, &alice, &bob, 100*txFee, 1, 2, 2, 1, resourceID)
+	_, res = et.executor.ExecuteTx(servicePaymentTx)
+	assert.True(res.IsOK(), res.Message)
+
+	// Expired reserved fund, which is released by ReleaseFundTx instead
+	et.fastforwardTo(setupHeight + 1001)
+	partialReleaseTx = createPartialReleaseFundTx(&alice, &bob, txFee, 3)
+	_, res = et.executor.ScreenTx(partialReleaseTx)
+	assert.Equal(result.CodePartialReleaseFundCheckFailed, res.Code, res.Message)
 }
 
 func TestServicePaymentTxExpiration(t *testing.T) {
@@ -961,82 +1600,1509 @@ func TestSplitRuleTxNormalExecution(t *testing.T) {
 	_, res = et.executor.getTxExecutor(servicePaymentTx).process(et.chainID, et.state().Delivered(), servicePaymentTx)
 	assert.True(res.IsOK(), res.Message)
 
-	et.state().Commit()
+	et.state().Commit()
+
+	bobFinalBalance := et.state().Delivered().GetAccount(bob.Address).Balance
+	carolFinalBalance := et.state().Delivered().GetAccount(carol.Address).Balance
+	log.Infof("Bob's final balance:   %v", bobFinalBalance)
+	log.Infof("Carol's final balance: %v", carolFinalBalance)
+
+	// Check the balances of the relevant accounts
+	bobSplitCoins := types.Coins{TFuelWei: big.NewInt(payAmount * 70 / 100), ThetaWei: big.NewInt(0)}
+	servicePaymentTxFee := types.NewCoins(0, txFee)
+	carolSplitCoins := types.Coins{TFuelWei: big.NewInt(payAmount * 30 / 100), ThetaWei: big.NewInt(0)}
+	assert.Equal(bobInitBalance.Plus(bobSplitCoins).Minus(servicePaymentTxFee), bobFinalBalance)
+	assert.Equal(carolInitBalance.Plus(carolSplitCoins), carolFinalBalance)
+}
+
+func TestSplitRuleTxExpiration(t *testing.T) {
+	assert := assert.New(t)
+	et, resourceID, alice, bob, carol, _, bobInitBalance, carolInitBalance := setupForServicePayment(assert)
+	log.Infof("Bob's initial balance:   %v", bobInitBalance)
+	log.Infof("Carol's initial balance: %v", carolInitBalance)
+
+	txFee := getMinimumTxFee()
+
+	initiator := types.MakeAcc("User David")
+	initiator.Balance = types.Coins{TFuelWei: big.NewInt(10000 * txFee), ThetaWei: big.NewInt(0)}
+	et.acc2State(initiator)
+
+	splitCarol := types.Split{
+		Address:    carol.Address,
+		Percentage: 30,
+	}
+	splitRuleTx := &types.SplitRuleTx{
+		Fee:        types.NewCoins(0, txFee),
+		ResourceID: resourceID,
+		Initiator: types.TxInput{
+			Address:  initiator.Address,
+			Sequence: 1,
+		},
+		Splits:   []types.Split{splitCarol},
+		Duration: uint64(100),
+	}
+	signBytes := splitRuleTx.SignBytes(et.chainID)
+	splitRuleTx.Initiator.Signature = initiator.Sign(signBytes)
+
+	res := et.executor.getTxExecutor(splitRuleTx).sanityCheck(et.chainID, et.state().Delivered(), splitRuleTx)
+	assert.True(res.IsOK(), res.Message)
+	_, res = et.executor.getTxExecutor(splitRuleTx).process(et.chainID, et.state().Delivered(), splitRuleTx)
+	assert.True(res.IsOK(), res.Message)
+
+	et.fastforwardBy(105) // The split rule should expire after the fastforward
+
+	// Simulate micropayment #1 between Alice and Bob, Carol should NOT get a cut
+	payAmount := int64(1000 * txFee)
+	srcSeq, tgtSeq, paymentSeq, reserveSeq := 1, 1, 1, 1
+	_ = createServicePaymentTx(et.chainID, &alice, &bob, 100, srcSeq, tgtSeq, paymentSeq, reserveSeq, resourceID)
+	_ = createServicePaymentTx(et.chainID, &alice, &bob, 500, srcSeq, tgtSeq, paymentSeq, reserveSeq, resourceID)
+	servicePaymentTx := createServicePaymentTx(et.chainID, &alice, &bob, payAmount, srcSeq, tgtSeq, paymentSeq, reserveSeq, resourceID)
+	res = et.executor.getTxExecutor(servicePaymentTx).sanityCheck(et.chainID, et.state().Delivered(), servicePaymentTx)
+	assert.True(res.IsOK(), res.Message)
+
+	assert.Equal(0, len(et.state().Delivered().GetSlashIntents()))
+	_, res = et.executor.getTxExecutor(servicePaymentTx).process(et.chainID, et.state().Delivered(), servicePaymentTx)
+	assert.True(res.IsOK(), res.Message)
+
+	et.state().Commit()
+
+	bobFinalBalance := et.state().Delivered().GetAccount(bob.Address).Balance
+	carolFinalBalance := et.state().Delivered().GetAccount(carol.Address).Balance
+	log.Infof("Bob's final balance:   %v", bobFinalBalance)
+	log.Infof("Carol's final balance: %v", carolFinalBalance)
+
+	// Check the balances of the relevant accounts
+	bobSplitCoins := types.Coins{TFuelWei: big.NewInt(payAmount), ThetaWei: big.NewInt(0)}
+	servicePaymentTxFee := types.NewCoins(0, txFee)
+	assert.Equal(bobInitBalance.Plus(bobSplitCoins).Minus(servicePaymentTxFee), bobFinalBalance)
+	assert.Equal(carolInitBalance, carolFinalBalance) // Carol gets no cut since the split rule has expired
+}
+
+func TestSplitRuleTxPercentageValidation(t *testing.T) {
+	assert := assert.New(t)
+	et := NewExecTest()
+
+	txFee := getMinimumTxFee()
+	initiator := types.MakeAcc("User David")
+	initiator.Balance = types.NewCoins(0, 10000*txFee)
+	et.acc2State(initiator)
+
+	newSplitRuleTx := func(splits ...types.Split) *types.SplitRuleTx {
+		tx := &types.SplitRuleTx{
+			Fee:        types.NewCoins(0, txFee),
+			ResourceID: "rid001",
+			Initiator:  types.TxInput{Address: initiator.Address, Sequence: 1},
+			Splits:     splits,
+			Duration:   100,
+		}
+		tx.Initiator.Signature = initiator.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+	sanityCheck := func(tx types.Tx) result.Result {
+		return et.executor.getTxExecutor(tx).sanityCheck(et.chainID, et.state().Delivered(), tx)
+	}
+
+	res := sanityCheck(newSplitRuleTx(types.Split{Address: et.accIn.Address, Percentage: 60},
+		types.Split{Address: et.accOut.Address, Percentage: 41}))
+	assert.Equal(result.CodeInvalidSplitRule, res.Code)
+	assert.Contains(res.Message, "101")
+
+	res = sanityCheck(newSplitRuleTx(types.Split{Address: et.accIn.Address, Percentage: 101}))
+	assert.Equal(result.CodeInvalidSplitRule, res.Code)
+
+	res = sanityCheck(newSplitRuleTx(types.Split{Address: et.accIn.Address, Percentage: 60},
+		types.Split{Address: et.accOut.Address, Percentage: 40}))
+	assert.True(res.IsOK(), res.Message)
+}
+
+func TestExtendSplitRuleTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	et, resourceID, alice, bob, carol, _, bobInitBalance, carolInitBalance :=
+		setupForServicePaymentAt(assert, common.HeightEnableExtendSplitRule-2)
+
+	txFee := getMinimumTxFee()
+	initiator := types.MakeAcc("User David")
+	initiator.Balance = types.NewCoins(0, 10000*txFee)
+	et.acc2State(initiator)
+
+	sanityCheck := func(tx types.Tx) result.Result {
+		return et.executor.getTxExecutor(tx).sanityCheck(et.chainID, et.state().Delivered(), tx)
+	}
+	execTx := func(tx types.Tx) result.Result {
+		if res := sanityCheck(tx); res.IsError() {
+			return res
+		}
+		_, res := et.executor.getTxExecutor(tx).process(et.chainID, et.state().Delivered(), tx)
+		return res
+	}
+	newExtendSplitRuleTx := func(signer types.PrivAccount, seq uint64, resourceID string, duration uint64) *types.ExtendSplitRuleTx {
+		tx := &types.ExtendSplitRuleTx{
+			Fee:        types.NewCoins(0, txFee),
+			ResourceID: resourceID,
+			Initiator:  types.TxInput{Address: signer.Address, Sequence: seq},
+			Duration:   duration,
+		}
+		tx.Initiator.Signature = signer.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+
+	splits := []types.Split{{Address: carol.Address, Percentage: 30}}
+	splitRuleTx := &types.SplitRuleTx{
+		Fee:        types.NewCoins(0, txFee),
+		ResourceID: resourceID,
+		Initiator:  types.TxInput{Address: initiator.Address, Sequence: 1},
+		Splits:     splits,
+		Duration:   100,
+	}
+	splitRuleTx.Initiator.Signature = initiator.Sign(splitRuleTx.SignBytes(et.chainID))
+	res := execTx(splitRuleTx)
+	require.True(res.IsOK(), res.Message)
+	endBlockHeight := et.state().Height() + 100
+	require.Equal(endBlockHeight, et.state().Delivered().GetSplitRule(resourceID).EndBlockHeight)
+
+	// The split rules can not be extended before the fork
+	assert.Equal(result.CodeExtendSplitRuleNotEnabled, sanityCheck(newExtendSplitRuleTx(initiator, 2, resourceID, 50)).Code)
+	et.state().Commit()
+
+	// Only the initiator can extend the split rule, by at least one block
+	assert.Equal(result.CodeUnauthorizedToUpdateSplitRule, sanityCheck(newExtendSplitRuleTx(alice, 2, resourceID, 50)).Code)
+	assert.Equal(result.CodeSplitRuleNotFound, sanityCheck(newExtendSplitRuleTx(initiator, 2, "rid002", 50)).Code)
+	assert.Equal(result.CodeInvalidSplitRule, sanityCheck(newExtendSplitRuleTx(initiator, 2, resourceID, 0)).Code)
+
+	// The split rule is still active at its end block height, where it can be extended
+	et.fastforwardTo(endBlockHeight)
+	res = execTx(newExtendSplitRuleTx(initiator, 2, resourceID, 50))
+	require.True(res.IsOK(), res.Message)
+	splitRule := et.state().Delivered().GetSplitRule(resourceID)
+	assert.Equal(endBlockHeight+50, splitRule.EndBlockHeight)
+	assert.Equal(splits, splitRule.Splits)
+	assert.Equal(initiator.Address, splitRule.InitiatorAddress)
+	endBlockHeight += 50
+
+	// The payment at the end block height is split
+	et.fastforwardTo(endBlockHeight)
+	payAmount := 100 * txFee
+	servicePaymentTx := createServicePaymentTx(et.chainID, &alice, &bob, payAmount, 1, 1, 1, 1, resourceID)
+	res = execTx(servicePaymentTx)
+	require.True(res.IsOK(), res.Message)
+	carolCut := payAmount * 30 / 100
+	bobBalance := bobInitBalance.Plus(types.NewCoins(0, payAmount-carolCut-txFee))
+	assert.Equal(bobBalance, et.state().Delivered().GetAccount(bob.Address).Balance)
+	assert.Equal(carolInitBalance.Plus(types.NewCoins(0, carolCut)), et.state().Delivered().GetAccount(carol.Address).Balance)
+
+	// The next block, the split rule has expired. It can no longer be extended, and the payment
+	// is not rejected but goes in full to the target
+	et.fastforwardTo(endBlockHeight + 1)
+	assert.Equal(result.CodeSplitRuleExpired, sanityCheck(newExtendSplitRuleTx(initiator, 3, resourceID, 50)).Code)
+	servicePaymentTx = createServicePaymentTx(et.chainID, &alice, &bob, payAmount, 1, 2, 2, 1, resourceID)
+	res = execTx(servicePaymentTx)
+	require.True(res.IsOK(), res.Message)
+	bobBalance = bobBalance.Plus(types.NewCoins(0, payAmount-txFee))
+	assert.Equal(bobBalance, et.state().Delivered().GetAccount(bob.Address).Balance)
+	assert.Equal(carolInitBalance.Plus(types.NewCoins(0, carolCut)), et.state().Delivered().GetAccount(carol.Address).Balance)
+	assert.Nil(et.state().Delivered().GetSplitRule(resourceID))
+}
+
+func TestSweepAccountTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	et := NewExecTest()
+
+	txFee := getMinimumTxFee()
+	fee := types.NewCoins(0, txFee)
+	et.acc2State(et.accIn)
+
+	newSweepAccountTx := func(signer types.PrivAccount, coins types.Coins, seq int, target common.Address) *types.SweepAccountTx {
+		tx := &types.SweepAccountTx{
+			Fee:    fee,
+			Source: types.NewTxInput(signer.Address, coins, seq),
+			Target: target,
+		}
+		tx.Source.Signature = signer.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+	newSendTx := func(signer types.PrivAccount, seq int, target common.Address, coins types.Coins) *types.SendTx {
+		tx := &types.SendTx{
+			Fee:     fee,
+			Inputs:  []types.TxInput{types.NewTxInput(signer.Address, coins.Plus(fee), seq)},
+			Outputs: []types.TxOutput{{Address: target, Coins: coins}},
+		}
+		et.signSendTx(tx, signer)
+		return tx
+	}
+
+	source := types.MakeAccWithInitBalance("sweep_source", types.NewCoins(1000, 10*txFee))
+	target := types.MakeAccWithInitBalance("sweep_target", types.NewCoins(0, txFee))
+	et.acc2State(source, target)
+	balance := source.Balance
+
+	// The accounts can not be swept before the fork
+	_, res := et.executor.ExecuteTx(newSweepAccountTx(source, balance, 1, target.Address))
+	assert.Equal(result.CodeSweepAccountNotEnabled, res.Code, res.Message)
+	et.fastforwardToForks(common.HeightEnableSweepAccount, common.HeightEnableMultisig)
+
+	// The whole balance needs to be swept, to another account
+	_, res = et.executor.ExecuteTx(newSweepAccountTx(source, balance.Minus(types.NewCoins(0, 1)), 1, target.Address))
+	assert.Equal(result.CodeSweepIncompleteBalance, res.Code, res.Message)
+	_, res = et.executor.ExecuteTx(newSweepAccountTx(source, balance, 1, source.Address))
+	assert.Equal(result.CodeDuplicatedAddress, res.Code, res.Message)
+
+	// The account is deleted, and the target gets the balance minus the fee
+	_, res = et.executor.ExecuteTx(newSendTx(source, 1, target.Address, types.NewCoins(0, txFee)))
+	require.True(res.IsOK(), res.Message)
+	balance = balance.Minus(types.NewCoins(0, 2*txFee))
+	sweepTx := newSweepAccountTx(source, balance, 2, target.Address)
+	_, res = et.executor.ExecuteTx(sweepTx)
+	require.True(res.IsOK(), res.Message)
+	view := et.state().Delivered()
+	assert.Nil(view.GetAccount(source.Address))
+	assert.Equal(uint64(2), view.GetAccountSequenceFloor(source.Address))
+	assert.Equal(types.NewCoins(1000, 9*txFee), view.GetAccount(target.Address).Balance)
+
+	// The sweep can not be replayed on the deleted account
+	_, res = et.executor.ExecuteTx(sweepTx)
+	assert.Equal(result.CodeUnknownAccount, res.Code, res.Message)
+
+	// Once funded again, the account starts at the sequence floor, thus its old txs can not be replayed
+	_, res = et.executor.ExecuteTx(newSendTx(et.accIn, 1, source.Address, types.NewCoins(0, 5*txFee)))
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(uint64(2), et.state().Delivered().GetAccount(source.Address).Sequence)
+	_, res = et.executor.ExecuteTx(newSendTx(source, 1, target.Address, types.NewCoins(0, txFee)))
+	assert.Equal(result.CodeSequenceTooLow, res.Code, res.Message)
+	_, res = et.executor.ExecuteTx(newSweepAccountTx(source, types.NewCoins(0, 5*txFee), 2, target.Address))
+	assert.Equal(result.CodeSequenceTooLow, res.Code, res.Message)
+	_, res = et.executor.ExecuteTx(newSendTx(source, 3, target.Address, types.NewCoins(0, txFee)))
+	require.True(res.IsOK(), res.Message)
+
+	// The floor rises with the sequence of each deletion
+	_, res = et.executor.ExecuteTx(newSweepAccountTx(source, types.NewCoins(0, 3*txFee), 4, target.Address))
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(uint64(4), et.state().Delivered().GetAccountSequenceFloor(source.Address))
+
+	// The accounts still referred to can not be deleted
+	reserved := types.MakeAccWithInitBalance("sweep_reserved", types.NewCoins(0, 10*txFee))
+	reserved.ReservedFunds = []types.ReservedFund{{Collateral: types.NewCoins(0, 1), InitialFund: types.NewCoins(0, 1),
+		UsedFund: types.NewCoins(0, 0), ReserveSequence: 1, EndBlockHeight: 100}}
+	multisig := types.MakeAccWithInitBalance("sweep_multisig", types.NewCoins(0, 10*txFee))
+	multisig.Multisig = &types.MultisigPolicy{Owners: []common.Address{multisig.Address}, Threshold: 1}
+	staker := types.MakeAccWithInitBalance("sweep_staker", types.NewCoins(0, 10*txFee))
+	et.acc2State(reserved, multisig, staker)
+
+	vcp := &core.ValidatorCandidatePool{}
+	require.Nil(vcp.DepositStake(staker.Address, et.accProposer.Address, core.MinValidatorStakeDeposit))
+	et.state().Delivered().UpdateValidatorCandidatePool(vcp)
+
+	for _, acc := range []types.PrivAccount{reserved, multisig, staker} {
+		tx := newSweepAccountTx(acc, acc.Balance, 1, target.Address)
+		if acc.Multisig != nil {
+			tx.Source.Signatures, tx.Source.Signature = []*crypto.Signature{tx.Source.Signature}, nil
+		}
+		_, res = et.executor.ExecuteTx(tx)
+		assert.Equal(result.CodeSweepAccountInUse, res.Code, res.Message)
+		assert.NotNil(et.state().Delivered().GetAccount(acc.Address))
+	}
+}
+
+func TestBurnTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	et := NewExecTest()
+
+	txFee := getMinimumTxFee()
+	fee := types.NewCoins(0, txFee)
+
+	newBurnTx := func(signer types.PrivAccount, coins types.Coins, seq int) *types.BurnTx {
+		tx := &types.BurnTx{
+			Fee:    fee,
+			Source: types.NewTxInput(signer.Address, coins, seq),
+		}
+		tx.Source.Signature = signer.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+
+	source := types.MakeAccWithInitBalance("burn_source", types.NewCoins(1000, 10*txFee))
+	et.acc2State(source)
+
+	// Before the fork, the coins can not be burned, but can be sent to the zero address
+	_, res := et.executor.ExecuteTx(newBurnTx(source, types.NewCoins(10, 0), 1))
+	assert.Equal(result.CodeBurnNotEnabled, res.Code, res.Message)
+	zeroAddressTx := &types.SendTx{
+		Fee:     fee,
+		Inputs:  []types.TxInput{types.NewTxInput(source.Address, types.NewCoins(5, txFee), 1)},
+		Outputs: []types.TxOutput{{Address: common.Address{}, Coins: types.NewCoins(5, 0)}},
+	}
+	et.signSendTx(zeroAddressTx, source)
+	res = et.executor.sanityCheck(et.chainID, et.state().Delivered(), zeroAddressTx)
+	assert.True(res.IsOK(), res.Message)
+	et.fastforwardTo(common.HeightEnableBurn)
+
+	// The total supply is not tracked unless set at genesis
+	_, res = et.executor.ExecuteTx(newBurnTx(source, types.NewCoins(10, 0), 1))
+	require.True(res.IsOK(), res.Message)
+	assert.Nil(et.state().Delivered().GetTotalSupply())
+
+	supply := types.NewCoins(1000000, 1000000*txFee)
+	et.state().Delivered().UpdateTotalSupply(supply)
+	et.state().Commit()
+
+	// Something needs to be burned, and the fee is charged on top of it
+	_, res = et.executor.ExecuteTx(newBurnTx(source, types.NewCoins(0, 0), 2))
+	assert.Equal(result.CodeInvalidCoins, res.Code, res.Message)
+	_, res = et.executor.ExecuteTx(newBurnTx(source, types.NewCoins(0, 9*txFee), 2))
+	assert.Equal(result.CodeInsufficientFund, res.Code, res.Message)
+
+	_, res = et.executor.ExecuteTx(newBurnTx(source, types.NewCoins(20, 3*txFee), 2))
+	require.True(res.IsOK(), res.Message)
+	sourceAccount := et.state().Delivered().GetAccount(source.Address)
+	assert.Equal(types.NewCoins(970, 5*txFee), sourceAccount.Balance)
+	assert.Equal(uint64(2), sourceAccount.Sequence)
+	supply = supply.Minus(types.NewCoins(20, 4*txFee))
+	assert.Equal(supply, *et.state().Delivered().GetTotalSupply())
+
+	// The fees of the other transactions are burned too
+	target := types.MakeAccWithInitBalance("burn_target", types.NewCoins(0, txFee))
+	et.acc2State(target)
+	sendTx := &types.SendTx{
+		Fee:     fee,
+		Inputs:  []types.TxInput{types.NewTxInput(source.Address, types.NewCoins(5, txFee), 3)},
+		Outputs: []types.TxOutput{{Address: target.Address, Coins: types.NewCoins(5, 0)}},
+	}
+	et.signSendTx(sendTx, source)
+	_, res = et.executor.ExecuteTx(sendTx)
+	require.True(res.IsOK(), res.Message)
+	supply = supply.Minus(fee)
+	assert.Equal(supply, *et.state().Delivered().GetTotalSupply())
+
+	// The coins can not be sent to the zero address instead
+	sendTx = &types.SendTx{
+		Fee:     fee,
+		Inputs:  []types.TxInput{types.NewTxInput(source.Address, types.NewCoins(5, txFee), 4)},
+		Outputs: []types.TxOutput{{Address: common.Address{}, Coins: types.NewCoins(5, 0)}},
+	}
+	et.signSendTx(sendTx, source)
+	_, res = et.executor.ExecuteTx(sendTx)
+	assert.Equal(result.CodeSendToZeroAddress, res.Code, res.Message)
+	sweepTx := &types.SweepAccountTx{
+		Fee:    fee,
+		Source: types.NewTxInput(target.Address, types.NewCoins(5, txFee), 1),
+		Target: common.Address{},
+	}
+	sweepTx.Source.Signature = target.Sign(sweepTx.SignBytes(et.chainID))
+	_, res = et.executor.ExecuteTx(sweepTx)
+	assert.Equal(result.CodeSendToZeroAddress, res.Code, res.Message)
+	assert.Nil(et.state().Delivered().GetAccount(common.Address{}))
+}
+
+func TestDoubleSignSlashTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	et := NewExecTest()
+
+	txFee := getMinimumTxFee()
+	fee := types.NewCoins(0, txFee)
+
+	reporter := types.MakeAccWithInitBalance("double_sign_reporter", types.NewCoins(0, 10*txFee))
+	et.acc2State(reporter)
+	validator, honest := types.PrivAccountFromSecret("double_sign_validator"), types.PrivAccountFromSecret("honest_validator")
+	stakerA, stakerB := types.PrivAccountFromSecret("double_sign_staker_a"), types.PrivAccountFromSecret("double_sign_staker_b")
+	stakeA := new(big.Int).Mul(big.NewInt(10), core.MinValidatorStakeDeposit)
+	stakeB := new(big.Int).Mul(big.NewInt(2), core.MinValidatorStakeDeposit)
+	vcp := &core.ValidatorCandidatePool{}
+	require.Nil(vcp.DepositStake(stakerA.Address, validator.Address, stakeA))
+	require.Nil(vcp.DepositStake(stakerB.Address, validator.Address, stakeB))
+	require.Nil(vcp.DepositStake(stakerA.Address, honest.Address, core.MinValidatorStakeDeposit))
+	et.state().Delivered().UpdateValidatorCandidatePool(vcp)
+	supply := types.NewCoins(1000000, 1000000*txFee)
+	supply.ThetaWei.Add(supply.ThetaWei, stakeA).Add(supply.ThetaWei, stakeB)
+	et.state().Delivered().UpdateTotalSupply(supply)
+	blockHeight := common.HeightEnableDoubleSignSlash
+	et.fastforwardTo(blockHeight - 2)
+
+	seq := 1
+	newDoubleSignSlashTx := func(evidence common.Bytes) *types.DoubleSignSlashTx {
+		tx := &types.DoubleSignSlashTx{
+			Fee:      fee,
+			Reporter: types.NewTxInput(reporter.Address, types.Coins{}, seq),
+			Evidence: evidence,
+		}
+		tx.Reporter.Signature = reporter.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+	evidenceAt := func(signer types.PrivAccount, height uint64) common.Bytes {
+		return types.MakeDoubleSignEvidence(et.chainID, signer, height, height+10)
+	}
+
+	// The double signing can not be slashed before the fork
+	_, res := et.executor.ExecuteTx(newDoubleSignSlashTx(evidenceAt(validator, blockHeight-11)))
+	assert.Equal(result.CodeDoubleSignSlashNotEnabled, res.Code, res.Message)
+	et.fastforwardTo(blockHeight - 1)
+
+	// The evidence needs to be verifiable, about past blocks within the window, and against a stake holder
+	testCases := []struct {
+		name     string
+		evidence common.Bytes
+		code     result.ErrorCode
+	}{
+		{"malformed", common.Bytes("evidence"), result.CodeInvalidDoubleSignEvidence},
+		{"other chain", types.MakeDoubleSignEvidence("other_chain", validator, blockHeight-11, blockHeight-1),
+			result.CodeInvalidDoubleSignEvidence},
+		{"future block", evidenceAt(validator, blockHeight), result.CodeInvalidDoubleSignEvidence},
+		{"expired", evidenceAt(validator, blockHeight-types.DoubleSignEvidenceWindow-1), result.CodeDoubleSignEvidenceExpired},
+		{"no stake", evidenceAt(types.PrivAccountFromSecret("no_stake"), blockHeight-11), result.CodeStakeNotFound},
+	}
+	for _, tc := range testCases {
+		_, res := et.executor.ExecuteTx(newDoubleSignSlashTx(tc.evidence))
+		assert.Equal(tc.code, res.Code, "%v: %v", tc.name, res.Message)
+	}
+
+	// The oldest evidence accepted burns 10% of each stake and withdraws the rest
+	evidence := evidenceAt(validator, blockHeight-types.DoubleSignEvidenceWindow)
+	_, res = et.executor.ExecuteTx(newDoubleSignSlashTx(evidence))
+	require.True(res.IsOK(), res.Message)
+	seq++
+	slashed := new(big.Int).Div(new(big.Int).Add(stakeA, stakeB), big.NewInt(10))
+	assert.Equal(types.Coins{ThetaWei: slashed, TFuelWei: big.NewInt(0)}, res.Info["slashedStake"])
+
+	view := et.state().Delivered()
+	delegate := view.GetValidatorCandidatePool().FindStakeDelegate(validator.Address)
+	require.NotNil(delegate)
+	require.Equal(2, len(delegate.Stakes))
+	for _, stake := range delegate.Stakes {
+		assert.True(stake.Withdrawn)
+		assert.Equal(blockHeight-1+core.ReturnLockingPeriod, stake.ReturnHeight)
+	}
+	assert.Equal(new(big.Int).Mul(big.NewInt(9), core.MinValidatorStakeDeposit), delegate.Stakes[0].Amount)
+	assert.Equal(new(big.Int).Div(new(big.Int).Mul(big.NewInt(9), stakeB), big.NewInt(10)), delegate.Stakes[1].Amount)
+	assert.False(view.GetValidatorCandidatePool().FindStakeDelegate(honest.Address).Stakes[0].Withdrawn)
+	assert.Equal(blockHeight-1, view.GetStakeHolderSlashHeight(validator.Address))
+	supply = supply.Minus(types.Coins{ThetaWei: slashed, TFuelWei: big.NewInt(txFee)})
+	assert.Equal(supply, *view.GetTotalSupply())
+	assert.Equal(types.NewCoins(0, 9*txFee), view.GetAccount(reporter.Address).Balance)
+
+	// The same double signing is slashed once, whatever the conflicting blocks
+	_, res = et.executor.ExecuteTx(newDoubleSignSlashTx(evidence))
+	assert.Equal(result.CodeDoubleSignAlreadySlashed, res.Code, res.Message)
+	_, res = et.executor.ExecuteTx(newDoubleSignSlashTx(types.MakeDoubleSignEvidence(et.chainID, validator,
+		blockHeight-types.DoubleSignEvidenceWindow, 1)))
+	assert.Equal(result.CodeDoubleSignAlreadySlashed, res.Code, res.Message)
+}
+
+func TestStakeCommissionTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	et := NewExecTest()
+
+	txFee := getMinimumTxFee()
+	holder := types.MakeAccWithInitBalance("commission_holder", types.NewCoins(0, 10*txFee))
+	et.acc2State(holder)
+
+	newStakeCommissionTx := func(commission uint8, seq int) *types.StakeCommissionTx {
+		tx := &types.StakeCommissionTx{
+			Fee:        types.NewCoins(0, txFee),
+			Holder:     types.NewTxInput(holder.Address, types.Coins{}, seq),
+			Commission: commission,
+		}
+		tx.Holder.Signature = holder.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+
+	// Not accepted before the fork
+	_, res := et.executor.ExecuteTx(newStakeCommissionTx(10, 1))
+	assert.Equal(result.CodeStakeCommissionNotEnabled, res.Code, res.Message)
+
+	et.fastforwardTo(common.HeightEnableStakeCommission - 1)
+	_, res = et.executor.ExecuteTx(newStakeCommissionTx(types.MaxStakeCommission+1, 1))
+	assert.Equal(result.CodeInvalidStakeCommission, res.Code, res.Message)
+	assert.Equal(uint8(0), et.state().Delivered().GetStakeCommission(holder.Address))
+
+	_, res = et.executor.ExecuteTx(newStakeCommissionTx(10, 1))
+	require.True(res.IsOK(), res.Message)
+	_, res = et.executor.ExecuteTx(newStakeCommissionTx(types.MaxStakeCommission, 2))
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(types.MaxStakeCommission, et.state().Delivered().GetStakeCommission(holder.Address))
+	holderAccount := et.state().Delivered().GetAccount(holder.Address)
+	assert.Equal(types.NewCoins(0, 8*txFee), holderAccount.Balance)
+	assert.Equal(uint64(2), holderAccount.Sequence)
+}
+
+func TestUpdateValidatorMetadataTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	et := NewExecTest()
+
+	txFee := getMinimumTxFee()
+	holder := types.MakeAccWithInitBalance("metadata_holder", types.NewCoins(0, 10*txFee))
+	nonHolder := types.MakeAccWithInitBalance("metadata_non_holder", types.NewCoins(0, 10*txFee))
+	et.acc2State(holder)
+	et.acc2State(nonHolder)
+	vcp := &core.ValidatorCandidatePool{}
+	require.Nil(vcp.DepositStake(et.accOut.Address, holder.Address, core.MinValidatorStakeDeposit))
+	et.state().Delivered().UpdateValidatorCandidatePool(vcp)
+
+	metadata := types.ValidatorMetadata{Name: "Validator One", Website: "https://one.example", SecurityContact: "sec@one.example"}
+	newUpdateValidatorMetadataTx := func(signer types.PrivAccount, holderAddr common.Address, metadata types.ValidatorMetadata, seq int) *types.UpdateValidatorMetadataTx {
+		tx := &types.UpdateValidatorMetadataTx{
+			Fee:      types.NewCoins(0, txFee),
+			Holder:   types.NewTxInput(holderAddr, types.Coins{}, seq),
+			Metadata: metadata,
+		}
+		tx.Holder.Signature = signer.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+
+	// Not accepted before the fork
+	_, res := et.executor.ExecuteTx(newUpdateValidatorMetadataTx(holder, holder.Address, metadata, 1))
+	assert.Equal(result.CodeValidatorMetadataNotEnabled, res.Code, res.Message)
+
+	// Only the stake holder sets its metadata
+	et.fastforwardTo(common.HeightEnableValidatorMetadata - 1)
+	_, res = et.executor.ExecuteTx(newUpdateValidatorMetadataTx(nonHolder, nonHolder.Address, metadata, 1))
+	assert.Equal(result.CodeNotStakeHolder, res.Code, res.Message)
+	_, res = et.executor.ExecuteTx(newUpdateValidatorMetadataTx(nonHolder, holder.Address, metadata, 1))
+	assert.Equal(result.CodeInvalidSignature, res.Code, res.Message)
+	assert.Nil(et.state().Delivered().GetValidatorMetadata(holder.Address))
+
+	tooLong := metadata
+	tooLong.Name = strings.Repeat("n", types.MaxValidatorNameLength+1)
+	_, res = et.executor.ExecuteTx(newUpdateValidatorMetadataTx(holder, holder.Address, tooLong, 1))
+	assert.Equal(result.CodeInvalidValidatorMetadata, res.Code, res.Message)
+
+	// The update replaces the metadata, the empty metadata clears it
+	_, res = et.executor.ExecuteTx(newUpdateValidatorMetadataTx(holder, holder.Address, metadata, 1))
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(&metadata, et.state().Delivered().GetValidatorMetadata(holder.Address))
+	renamed := types.ValidatorMetadata{Name: "Validator Uno"}
+	_, res = et.executor.ExecuteTx(newUpdateValidatorMetadataTx(holder, holder.Address, renamed, 2))
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(&renamed, et.state().Delivered().GetValidatorMetadata(holder.Address))
+	_, res = et.executor.ExecuteTx(newUpdateValidatorMetadataTx(holder, holder.Address, types.ValidatorMetadata{}, 3))
+	require.True(res.IsOK(), res.Message)
+	assert.Nil(et.state().Delivered().GetValidatorMetadata(holder.Address))
+
+	holderAccount := et.state().Delivered().GetAccount(holder.Address)
+	assert.Equal(types.NewCoins(0, 7*txFee), holderAccount.Balance)
+	assert.Equal(uint64(3), holderAccount.Sequence)
+}
+
+func TestUnjailTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	et := NewExecTest()
+
+	txFee := getMinimumTxFee()
+	offline := types.MakeAccWithInitBalance("offline_validator", types.NewCoins(0, 10*txFee))
+	online := types.MakeAccWithInitBalance("online_validator", types.NewCoins(0, 10*txFee))
+	et.acc2State(offline)
+	et.acc2State(online)
+
+	// The offline validator misses more than MaxMissedBlocksInWindow blocks in a row
+	validators := []common.Address{offline.Address, online.Address}
+	signers := map[common.Address]bool{online.Address: true}
+	vlt := &core.ValidatorLivenessTracker{}
+	jailHeight := common.HeightEnableValidatorJailing - 1
+	for height := jailHeight - core.MaxMissedBlocksInWindow; height <= jailHeight; height++ {
+		vlt.RecordBlock(height, validators, signers)
+	}
+	require.True(vlt.IsJailed(offline.Address))
+	et.state().Delivered().UpdateValidatorLivenessTracker(vlt)
+
+	newUnjailTx := func(signer types.PrivAccount, seq int) *types.UnjailTx {
+		tx := &types.UnjailTx{
+			Fee:    types.NewCoins(0, txFee),
+			Holder: types.NewTxInput(signer.Address, types.Coins{}, seq),
+		}
+		tx.Holder.Signature = signer.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+
+	// Not accepted before the fork
+	_, res := et.executor.ExecuteTx(newUnjailTx(offline, 1))
+	assert.Equal(result.CodeValidatorJailingNotEnabled, res.Code, res.Message)
+
+	// Only the jailed validator is unjailed, after the cooldown
+	et.fastforwardTo(common.HeightEnableValidatorJailing - 1)
+	_, res = et.executor.ExecuteTx(newUnjailTx(online, 1))
+	assert.Equal(result.CodeValidatorNotJailed, res.Code, res.Message)
+	_, res = et.executor.ExecuteTx(newUnjailTx(offline, 1))
+	assert.Equal(result.CodeJailCooldownNotPassed, res.Code, res.Message)
+	assert.True(et.state().Delivered().GetValidatorLivenessTracker().IsJailed(offline.Address))
+
+	et.fastforwardTo(jailHeight + core.JailCooldownPeriod - 1)
+	_, res = et.executor.ExecuteTx(newUnjailTx(offline, 1))
+	require.True(res.IsOK(), res.Message)
+	assert.False(et.state().Delivered().GetValidatorLivenessTracker().IsJailed(offline.Address))
+	_, res = et.executor.ExecuteTx(newUnjailTx(offline, 2))
+	assert.Equal(result.CodeValidatorNotJailed, res.Code, res.Message)
+
+	offlineAccount := et.state().Delivered().GetAccount(offline.Address)
+	assert.Equal(types.NewCoins(0, 9*txFee), offlineAccount.Balance)
+	assert.Equal(uint64(1), offlineAccount.Sequence)
+}
+
+func TestEjectStakeTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	txFee := getMinimumTxFee()
+	staker := types.MakeAccWithInitBalance("ejected_staker", types.Coins{
+		ThetaWei: new(big.Int).Set(core.MinValidatorStakeDeposit), // for the second deposit
+		TFuelWei: big.NewInt(10 * txFee),
+	})
+	holder := types.MakeAccWithInitBalance("ejecting_holder", types.NewCoins(0, 10*txFee))
+	otherHolder := types.MakeAccWithInitBalance("other_holder", types.NewCoins(0, 10*txFee))
+
+	et := NewExecTest()
+	et.acc2State(staker)
+	et.acc2State(holder)
+	et.acc2State(otherHolder)
+	vcp := &core.ValidatorCandidatePool{}
+	require.Nil(vcp.DepositStake(staker.Address, holder.Address, core.MinValidatorStakeDeposit))
+	et.state().Delivered().UpdateValidatorCandidatePool(vcp)
+
+	newEjectStakeTx := func(signer types.PrivAccount, seq int) *types.EjectStakeTx {
+		tx := &types.EjectStakeTx{
+			Fee:     types.NewCoins(0, txFee),
+			Holder:  types.NewTxInput(signer.Address, types.Coins{}, seq),
+			Source:  types.TxOutput{Address: staker.Address},
+			Purpose: core.StakeForValidator,
+		}
+		tx.Holder.Signature = signer.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+	newStakerTx := func(tx types.Tx, in *types.TxInput, seq int) types.Tx {
+		in.Address = staker.Address
+		in.Sequence = uint64(seq)
+		in.Signature = staker.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+
+	// Not accepted before the fork
+	_, res := et.executor.ExecuteTx(newEjectStakeTx(holder, 1))
+	assert.Equal(result.CodeStakeEjectionNotEnabled, res.Code, res.Message)
+
+	// Only the holder of the stake can eject it
+	ejectHeight := common.HeightEnableStakeEjection - 1
+	et.fastforwardTo(ejectHeight)
+	_, res = et.executor.ExecuteTx(newEjectStakeTx(otherHolder, 1))
+	assert.Equal(result.CodeStakeNotFound, res.Code, res.Message)
+
+	// The ejected stake is withdrawn as by the source, the holder pays the fee
+	_, res = et.executor.ExecuteTx(newEjectStakeTx(holder, 1))
+	require.True(res.IsOK(), res.Message)
+	view := et.state().Delivered()
+	assert.Equal(types.NewCoins(0, 9*txFee), view.GetAccount(holder.Address).Balance)
+	assert.Equal(staker.Balance, view.GetAccount(staker.Address).Balance)
+	assert.Equal(0, view.GetValidatorCandidatePool().FindStakeDelegate(holder.Address).TotalStake().Sign())
+	assert.Equal([]core.PendingStakeReturn{{
+		Holder:       holder.Address,
+		Source:       staker.Address,
+		Amount:       core.MinValidatorStakeDeposit,
+		ReturnHeight: ejectHeight + core.ReturnLockingPeriod,
+	}}, view.GetValidatorCandidatePool().PendingStakeReturns(staker.Address))
+
+	// The withdrawal is pending, there is nothing left to eject, or to withdraw
+	_, res = et.executor.ExecuteTx(newEjectStakeTx(holder, 2))
+	assert.Equal(result.CodeStakeAlreadyWithdrawn, res.Code, res.Message)
+	withdrawTx := &types.WithdrawStakeTx{Fee: types.NewCoins(0, txFee), Holder: types.TxOutput{Address: holder.Address},
+		Purpose: core.StakeForValidator}
+	_, res = et.executor.ExecuteTx(newStakerTx(withdrawTx, &withdrawTx.Source, 1))
+	assert.Equal(result.CodeStakeAlreadyWithdrawn, res.Code, res.Message)
+
+	// The source can not cancel the ejection
+	cancelTx := &types.CancelWithdrawTx{Fee: types.NewCoins(0, txFee), Holder: types.TxOutput{Address: holder.Address}}
+	_, res = et.executor.ExecuteTx(newStakerTx(cancelTx, &cancelTx.Source, 1))
+	assert.Equal(result.CodeStakeEjected, res.Code, res.Message)
+
+	// A new deposit of the source is ejected too, and queued after the pending withdrawal
+	et.fastforwardTo(ejectHeight + 10)
+	depositTx := &types.DepositStakeTx{Fee: types.NewCoins(0, txFee), Holder: types.TxOutput{Address: holder.Address},
+		Purpose: core.StakeForValidator}
+	depositTx.Source.Coins = types.Coins{ThetaWei: core.MinValidatorStakeDeposit, TFuelWei: big.NewInt(0)}
+	_, res = et.executor.ExecuteTx(newStakerTx(depositTx, &depositTx.Source, 1))
+	require.True(res.IsOK(), res.Message)
+	_, res = et.executor.ExecuteTx(newEjectStakeTx(holder, 2))
+	require.True(res.IsOK(), res.Message)
+	pendingReturns := et.state().Delivered().GetValidatorCandidatePool().PendingStakeReturns(staker.Address)
+	require.Equal(2, len(pendingReturns))
+	assert.Equal(ejectHeight+core.ReturnLockingPeriod, pendingReturns[0].ReturnHeight)
+	assert.Equal(ejectHeight+10+core.ReturnLockingPeriod, pendingReturns[1].ReturnHeight)
+}
+
+func TestUpdateValidatorKeyTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	txFee := getMinimumTxFee()
+	staker := types.MakeAccWithInitBalance("rotated_staker", types.Coins{
+		ThetaWei: new(big.Int).Set(core.MinValidatorStakeDeposit), // for the deposit after the rotation
+		TFuelWei: big.NewInt(10 * txFee),
+	})
+	holder := types.MakeAccWithInitBalance("rotating_holder", types.NewCoins(0, 10*txFee))
+	jailedHolder := types.MakeAccWithInitBalance("jailed_rotating_holder", types.NewCoins(0, 10*txFee))
+	newKey := types.MakeAccWithInitBalance("new_validator_key", types.NewCoins(0, 10*txFee))
+	otherKey := types.PrivAccountFromSecret("other_validator_key")
+
+	et := NewExecTest()
+	et.acc2State(staker)
+	et.acc2State(holder)
+	et.acc2State(jailedHolder)
+	et.acc2State(newKey)
+	vcp := &core.ValidatorCandidatePool{}
+	require.Nil(vcp.DepositStake(staker.Address, holder.Address, core.MinValidatorStakeDeposit))
+	require.Nil(vcp.DepositStake(staker.Address, jailedHolder.Address, core.MinValidatorStakeDeposit))
+	view := et.state().Delivered()
+	view.UpdateValidatorCandidatePool(vcp)
+	view.SetStakeCommission(holder.Address, 10)
+	metadata := types.ValidatorMetadata{Name: "rotating validator"}
+	view.SetValidatorMetadata(holder.Address, metadata)
+	coldAddress := types.PrivAccountFromSecret("rotated_staker_cold").Address
+	view.SetStakeReturnAddress(core.StakeForValidator, holder.Address, staker.Address, 100, coldAddress)
+
+	vlt := &core.ValidatorLivenessTracker{}
+	validators := []common.Address{holder.Address, jailedHolder.Address}
+	for height := uint64(1); height <= core.MaxMissedBlocksInWindow+1; height++ {
+		vlt.RecordBlock(height, validators, map[common.Address]bool{holder.Address: true})
+	}
+	require.True(vlt.IsJailed(jailedHolder.Address))
+	view.UpdateValidatorLivenessTracker(vlt)
+
+	newUpdateValidatorKeyTx := func(signer types.PrivAccount, newHolder types.PrivAccount, seq int) *types.UpdateValidatorKeyTx {
+		tx := &types.UpdateValidatorKeyTx{
+			Fee:       types.NewCoins(0, txFee),
+			Holder:    types.NewTxInput(signer.Address, types.Coins{}, seq),
+			NewHolder: types.TxInput{Address: newHolder.Address},
+		}
+		signBytes := tx.SignBytes(et.chainID)
+		tx.Holder.Signature = signer.Sign(signBytes)
+		tx.NewHolder.Signature = newHolder.Sign(signBytes)
+		return tx
+	}
+
+	// Not accepted before the fork
+	_, res := et.executor.ExecuteTx(newUpdateValidatorKeyTx(holder, newKey, 1))
+	assert.Equal(result.CodeValidatorKeyRotationNotEnabled, res.Code, res.Message)
+
+	rotationHeight := common.HeightEnableValidatorKeyRotation - 1
+	et.fastforwardTo(rotationHeight)
+
+	// The new key has to sign the tx too
+	tx := newUpdateValidatorKeyTx(holder, newKey, 1)
+	tx.NewHolder.Signature = otherKey.Sign(tx.SignBytes(et.chainID))
+	_, res = et.executor.ExecuteTx(tx)
+	assert.Equal(result.CodeInvalidSignature, res.Code, res.Message)
+
+	// Only a validator stake holder out of jail rotates its key, to a key without stakes
+	_, res = et.executor.ExecuteTx(newUpdateValidatorKeyTx(staker, newKey, 1))
+	assert.Equal(result.CodeNotStakeHolder, res.Code, res.Message)
+	_, res = et.executor.ExecuteTx(newUpdateValidatorKeyTx(holder, jailedHolder, 1))
+	assert.Equal(result.CodeInvalidNewValidatorKey, res.Code, res.Message)
+	_, res = et.executor.ExecuteTx(newUpdateValidatorKeyTx(jailedHolder, newKey, 1))
+	assert.Equal(result.CodeJailedValidatorKeyRotation, res.Code, res.Message)
+
+	// The stakes, the commission, the metadata and the return addresses move to the new key, the holder pays the fee
+	_, res = et.executor.ExecuteTx(newUpdateValidatorKeyTx(holder, newKey, 1))
+	require.True(res.IsOK(), res.Message)
+	view = et.state().Delivered()
+	assert.Nil(view.GetValidatorCandidatePool().FindStakeDelegate(holder.Address))
+	assert.Equal(core.MinValidatorStakeDeposit, view.GetValidatorCandidatePool().FindActiveStake(staker.Address, newKey.Address).Amount)
+	assert.Equal(uint8(10), view.GetStakeCommission(newKey.Address))
+	assert.Equal(uint8(0), view.GetStakeCommission(holder.Address))
+	assert.Equal(&metadata, view.GetValidatorMetadata(newKey.Address))
+	assert.Nil(view.GetValidatorMetadata(holder.Address))
+	returnAddress, ok := view.GetStakeReturnAddress(core.StakeForValidator, newKey.Address, staker.Address, 100)
+	assert.True(ok)
+	assert.Equal(coldAddress, returnAddress)
+	_, ok = view.GetStakeReturnAddress(core.StakeForValidator, holder.Address, staker.Address, 100)
+	assert.False(ok)
+	rotatedTo, rotated := view.GetRotatedValidatorKey(holder.Address)
+	assert.True(rotated)
+	assert.Equal(newKey.Address, rotatedTo)
+	assert.Equal(types.NewCoins(0, 9*txFee), view.GetAccount(holder.Address).Balance)
+
+	// The rotated out key holds nothing, takes no deposit, and is not a rotation target anymore
+	_, res = et.executor.ExecuteTx(newUpdateValidatorKeyTx(holder, otherKey, 2))
+	assert.Equal(result.CodeNotStakeHolder, res.Code, res.Message)
+	depositTx := &types.DepositStakeTx{Fee: types.NewCoins(0, txFee), Holder: types.TxOutput{Address: holder.Address},
+		Purpose: core.StakeForValidator}
+	depositTx.Source = types.NewTxInput(staker.Address, types.Coins{ThetaWei: core.MinValidatorStakeDeposit, TFuelWei: big.NewInt(0)}, 1)
+	depositTx.Source.Signature = staker.Sign(depositTx.SignBytes(et.chainID))
+	_, res = et.executor.ExecuteTx(depositTx)
+	assert.Equal(result.CodeValidatorKeyRotated, res.Code, res.Message)
+	_, res = et.executor.ExecuteTx(newUpdateValidatorKeyTx(newKey, holder, 1))
+	assert.Equal(result.CodeValidatorKeyRotated, res.Code, res.Message)
+}
+
+func TestDivideProportionally(t *testing.T) {
+	assert := assert.New(t)
+
+	a, b, c := common.HexToAddress("0xa"), common.HexToAddress("0xb"), common.HexToAddress("0xc")
+	sum := func(shares map[common.Address]*big.Int) *big.Int {
+		total := big.NewInt(0)
+		for _, share := range shares {
+			total.Add(total, share)
+		}
+		return total
+	}
+
+	// Equal remainders, the left over wei goes to the smaller address
+	shares := divideProportionally(big.NewInt(100), map[common.Address]*big.Int{c: big.NewInt(1), b: big.NewInt(1), a: big.NewInt(1)})
+	assert.Equal(map[common.Address]*big.Int{a: big.NewInt(34), b: big.NewInt(33), c: big.NewInt(33)}, shares)
+
+	// The largest remainders first
+	shares = divideProportionally(big.NewInt(10), map[common.Address]*big.Int{a: big.NewInt(1), b: big.NewInt(2), c: big.NewInt(4)})
+	assert.Equal(map[common.Address]*big.Int{a: big.NewInt(1), b: big.NewInt(3), c: big.NewInt(6)}, shares)
+
+	for _, total := range []int64{0, 1, 7, 999999999999} {
+		shares = divideProportionally(big.NewInt(total), map[common.Address]*big.Int{a: big.NewInt(3), b: big.NewInt(5), c: big.NewInt(11)})
+		assert.Equal(big.NewInt(total), sum(shares), "%v", total)
+	}
+	assert.Empty(divideProportionally(big.NewInt(100), map[common.Address]*big.Int{}))
+}
+
+func TestCoinbaseOutputs(t *testing.T) {
+	assert := assert.New(t)
+
+	a, b, c := common.HexToAddress("0xa"), common.HexToAddress("0xb"), common.HexToAddress("0xc")
+	newView := func(height uint64) *st.StoreView {
+		view := st.NewStoreView(height, common.Hash{}, backend.NewMemDatabase())
+		view.AddUndistributedFees(types.NewCoins(0, 30)) // claimed by the proposer
+		return view
+	}
+	validatorSet := core.NewValidatorSet()
+
+	// Nothing is carried over before the fork
+	view := newView(common.HeightEnableCoinbaseBatching - 2)
+	view.UpdateCoinbaseOverflow([]types.TxOutput{{Address: a, Coins: types.NewCoins(0, 10)}})
+	outputs, overflow := CoinbaseOutputs(view, validatorSet, 1, b, DefaultRewardSchedule)
+	assert.Empty(outputs)
+	assert.Nil(overflow)
+
+	// The rewards carried over are paid along with the block reward, the ones of the proposer added up
+	view = newView(common.HeightEnableCoinbaseBatching)
+	view.UpdateCoinbaseOverflow([]types.TxOutput{
+		{Address: a, Coins: types.NewCoins(0, 10)},
+		{Address: c, Coins: types.NewCoins(0, 20)},
+	})
+	outputs, overflow = CoinbaseOutputs(view, validatorSet, 1, b, DefaultRewardSchedule)
+	assert.Equal([]types.TxOutput{
+		{Address: a, Coins: types.NewCoins(0, 10)},
+		{Address: b, Coins: types.NewCoins(0, 30)},
+		{Address: c, Coins: types.NewCoins(0, 20)},
+	}, outputs)
+	assert.Nil(overflow)
+	outputs, _ = CoinbaseOutputs(view, validatorSet, 1, c, DefaultRewardSchedule)
+	assert.Equal([]types.TxOutput{
+		{Address: a, Coins: types.NewCoins(0, 10)},
+		{Address: c, Coins: types.NewCoins(0, 50)},
+	}, outputs)
+
+	// Capped, the rewards carried over are paid first
+	defer SetMaxCoinbaseOutputsSize(2 * coinbaseOutputSize(&types.TxOutput{Address: a, Coins: types.NewCoins(0, 10)}))() // a single byte amount
+	outputs, overflow = CoinbaseOutputs(view, validatorSet, 1, b, DefaultRewardSchedule)
+	assert.Equal([]types.TxOutput{
+		{Address: a, Coins: types.NewCoins(0, 10)},
+		{Address: c, Coins: types.NewCoins(0, 20)},
+	}, outputs)
+	assert.Equal([]types.TxOutput{{Address: b, Coins: types.NewCoins(0, 30)}}, overflow)
+
+	// Then the others in address order, until one does not fit
+	view.UpdateCoinbaseOverflow([]types.TxOutput{{Address: c, Coins: types.NewCoins(0, 20)}})
+	view.AddUndistributedFees(types.NewCoins(0, 1000000000)) // takes more bytes than the others
+	outputs, overflow = CoinbaseOutputs(view, validatorSet, 1, a, DefaultRewardSchedule)
+	assert.Equal([]types.TxOutput{{Address: c, Coins: types.NewCoins(0, 20)}}, outputs)
+	assert.Equal([]types.TxOutput{{Address: a, Coins: types.NewCoins(0, 1000000030)}}, overflow)
+
+	// The overflow is cleared once paid
+	view.UpdateCoinbaseOverflow(overflow)
+	assert.Equal(overflow, view.GetCoinbaseOverflow())
+	view.UpdateCoinbaseOverflow(nil)
+	assert.Nil(view.GetCoinbaseOverflow())
+}
+
+func TestCancelWithdrawTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	txFee := getMinimumTxFee()
+	staker := types.MakeAccWithInitBalance("cancel_withdraw_staker", types.NewCoins(0, 10*txFee))
+	holder := types.PrivAccountFromSecret("cancel_withdraw_holder")
+	withdrawHeight := uint64(1)
+	returnHeight := withdrawHeight + core.ReturnLockingPeriod
+
+	setupWithdrawnAt := func(withdrawHeight uint64) *execTest {
+		et := NewExecTest()
+		et.acc2State(staker)
+		vcp := &core.ValidatorCandidatePool{}
+		require.Nil(vcp.DepositStake(staker.Address, holder.Address, core.MinValidatorStakeDeposit))
+		require.Nil(vcp.WithdrawStake(staker.Address, holder.Address, withdrawHeight))
+		et.state().Delivered().UpdateValidatorCandidatePool(vcp)
+		return et
+	}
+	setup := func() *execTest {
+		return setupWithdrawnAt(withdrawHeight)
+	}
+	newCancelWithdrawTx := func(et *execTest, seq int) *types.CancelWithdrawTx {
+		tx := &types.CancelWithdrawTx{
+			Fee:    types.NewCoins(0, txFee),
+			Source: types.NewTxInput(staker.Address, types.Coins{}, seq),
+			Holder: types.TxOutput{Address: holder.Address},
+		}
+		tx.Source.Signature = staker.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+
+	// The withdrawal can be cancelled anywhere in the locking period, up to the block before the return
+	for _, height := range []uint64{withdrawHeight + 1, withdrawHeight + core.ReturnLockingPeriod/2, returnHeight - 1} {
+		et := setup()
+		et.fastforwardTo(height)
+		_, res := et.executor.ExecuteTx(newCancelWithdrawTx(et, 1))
+		require.True(res.IsOK(), "%v: %v", height, res.Message)
+
+		view := et.state().Delivered()
+		stake := view.GetValidatorCandidatePool().FindStake(staker.Address, holder.Address)
+		require.NotNil(stake)
+		assert.False(stake.Withdrawn, "%v", height)
+		assert.Equal(core.InvalidReturnHeight, stake.ReturnHeight, "%v", height)
+		assert.Equal(core.MinValidatorStakeDeposit, view.GetValidatorCandidatePool().FindStakeDelegate(holder.Address).TotalStake())
+		assert.Equal(types.NewCoins(0, 9*txFee), view.GetAccount(staker.Address).Balance)
+
+		// The stake is active, and is no longer returned
+		_, res = et.executor.ExecuteTx(newCancelWithdrawTx(et, 2))
+		assert.Equal(result.CodeStakeNotWithdrawn, res.Code, res.Message)
+		assert.Empty(view.GetValidatorCandidatePool().ReturnStakes(returnHeight))
+	}
+
+	// Too late once the stake is returned in the block
+	et := setup()
+	et.fastforwardTo(returnHeight)
+	_, res := et.executor.ExecuteTx(newCancelWithdrawTx(et, 1))
+	assert.Equal(result.CodeStakeReturnDue, res.Code, res.Message)
+
+	// The withdrawals forced by a slash stand, the later ones can be cancelled
+	et = setup()
+	et.state().Delivered().SetStakeHolderSlashHeight(holder.Address, withdrawHeight)
+	et.fastforwardTo(withdrawHeight + 10)
+	_, res = et.executor.ExecuteTx(newCancelWithdrawTx(et, 1))
+	assert.Equal(result.CodeStakeSlashed, res.Code, res.Message)
+	et = setupWithdrawnAt(withdrawHeight + 5)
+	et.state().Delivered().SetStakeHolderSlashHeight(holder.Address, withdrawHeight)
+	et.fastforwardTo(withdrawHeight + 10)
+	_, res = et.executor.ExecuteTx(newCancelWithdrawTx(et, 1))
+	assert.True(res.IsOK(), res.Message)
+
+	// A slash recording the return height of the withdrawals it forced, under a locking period shorter than the
+	// default, does not hold the later withdrawals
+	et = setupWithdrawnAt(withdrawHeight + 5)
+	et.state().Delivered().SetStakeHolderSlashHeight(holder.Address, withdrawHeight)
+	et.state().Delivered().SetStakeHolderSlashReturnHeight(holder.Address, withdrawHeight+core.ReturnLockingPeriod+4)
+	et.fastforwardTo(withdrawHeight + 10)
+	_, res = et.executor.ExecuteTx(newCancelWithdrawTx(et, 1))
+	assert.True(res.IsOK(), res.Message)
+	et = setupWithdrawnAt(withdrawHeight + 5)
+	et.state().Delivered().SetStakeHolderSlashHeight(holder.Address, withdrawHeight)
+	et.state().Delivered().SetStakeHolderSlashReturnHeight(holder.Address, withdrawHeight+core.ReturnLockingPeriod+5)
+	et.fastforwardTo(withdrawHeight + 10)
+	_, res = et.executor.ExecuteTx(newCancelWithdrawTx(et, 1))
+	assert.Equal(result.CodeStakeSlashed, res.Code, res.Message)
+
+	// Only a withdrawn stake of the source can be cancelled
+	et = setup()
+	tx := newCancelWithdrawTx(et, 1)
+	tx.Holder.Address = staker.Address
+	tx.Source.Signature = staker.Sign(tx.SignBytes(et.chainID))
+	_, res = et.executor.ExecuteTx(tx)
+	assert.Equal(result.CodeStakeNotFound, res.Code, res.Message)
+}
+
+func TestWithdrawStakeTxReturnAddress(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	txFee := getMinimumTxFee()
+	staker := types.MakeAccWithInitBalance("return_address_staker", types.Coins{
+		ThetaWei: new(big.Int).Set(core.MinValidatorStakeDeposit), // for the deposit withdrawn within the same block
+		TFuelWei: big.NewInt(10 * txFee),
+	})
+	holder := types.PrivAccountFromSecret("return_address_holder")
+	coldAddress := types.PrivAccountFromSecret("return_address_cold").Address
+	otherAddress := types.PrivAccountFromSecret("return_address_other").Address
+
+	et := NewExecTest()
+	et.acc2State(staker)
+	vcp := &core.ValidatorCandidatePool{}
+	require.Nil(vcp.DepositStake(staker.Address, holder.Address, core.MinValidatorStakeDeposit))
+	et.state().Delivered().UpdateValidatorCandidatePool(vcp)
+
+	newWithdrawStakeTx := func(returnAddress *common.Address, seq int) *types.WithdrawStakeTx {
+		tx := &types.WithdrawStakeTx{
+			Fee:           types.NewCoins(0, txFee),
+			Source:        types.NewTxInput(staker.Address, types.Coins{}, seq),
+			Holder:        types.TxOutput{Address: holder.Address},
+			Purpose:       core.StakeForValidator,
+			ReturnAddress: returnAddress,
+		}
+		tx.Source.Signature = staker.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+	newCancelWithdrawTx := func(seq int) *types.CancelWithdrawTx {
+		tx := &types.CancelWithdrawTx{
+			Fee:    types.NewCoins(0, txFee),
+			Source: types.NewTxInput(staker.Address, types.Coins{}, seq),
+			Holder: types.TxOutput{Address: holder.Address},
+		}
+		tx.Source.Signature = staker.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+
+	// Not accepted before the fork, nor to the zero address
+	_, res := et.executor.ExecuteTx(newWithdrawStakeTx(&coldAddress, 1))
+	assert.Equal(result.CodeInvalidReturnAddress, res.Code, res.Message)
+	et.fastforwardTo(common.HeightEnableStakeReturnAddress - 1)
+	_, res = et.executor.ExecuteTx(newWithdrawStakeTx(&common.Address{}, 1))
+	assert.Equal(result.CodeInvalidReturnAddress, res.Code, res.Message)
+
+	// The return address is recorded for the return height, the account is only created by the return. The
+	// source pays the fee, and the stake stays in the pool until then.
+	_, res = et.executor.ExecuteTx(newWithdrawStakeTx(&coldAddress, 1))
+	require.True(res.IsOK(), res.Message)
+	view := et.state().Delivered()
+	pendingReturns := view.GetValidatorCandidatePool().PendingStakeReturns(staker.Address)
+	require.Equal(1, len(pendingReturns))
+	returnHeight := pendingReturns[0].ReturnHeight
+	returnAddress, ok := view.GetStakeReturnAddress(core.StakeForValidator, holder.Address, staker.Address, returnHeight)
+	assert.True(ok)
+	assert.Equal(coldAddress, returnAddress)
+	assert.Nil(view.GetAccount(coldAddress))
+	assert.Equal(types.Coins{ThetaWei: core.MinValidatorStakeDeposit, TFuelWei: big.NewInt(9 * txFee)},
+		view.GetAccount(staker.Address).Balance)
+	assert.Equal(core.MinValidatorStakeDeposit, pendingReturns[0].Amount)
+
+	// Another withdrawal of the pair due at the same height returns to the same address
+	depositTx := &types.DepositStakeTx{Fee: types.NewCoins(0, txFee), Holder: types.TxOutput{Address: holder.Address},
+		Purpose: core.StakeForValidator}
+	depositTx.Source = types.NewTxInput(staker.Address, types.Coins{ThetaWei: core.MinValidatorStakeDeposit, TFuelWei: big.NewInt(0)}, 2)
+	depositTx.Source.Signature = staker.Sign(depositTx.SignBytes(et.chainID))
+	_, res = et.executor.ExecuteTx(depositTx)
+	require.True(res.IsOK(), res.Message)
+	_, res = et.executor.ExecuteTx(newWithdrawStakeTx(&otherAddress, 3))
+	assert.Equal(result.CodeReturnAddressConflict, res.Code, res.Message)
+	_, res = et.executor.ExecuteTx(newWithdrawStakeTx(nil, 3))
+	assert.Equal(result.CodeReturnAddressConflict, res.Code, res.Message)
+	_, res = et.executor.ExecuteTx(newWithdrawStakeTx(&coldAddress, 3))
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(2, len(view.GetValidatorCandidatePool().PendingStakeReturns(staker.Address)))
+
+	// The return address is kept until the last of the withdrawals due at the height is cancelled
+	_, res = et.executor.ExecuteTx(newCancelWithdrawTx(4))
+	require.True(res.IsOK(), res.Message)
+	_, ok = view.GetStakeReturnAddress(core.StakeForValidator, holder.Address, staker.Address, returnHeight)
+	assert.True(ok)
+	_, res = et.executor.ExecuteTx(newCancelWithdrawTx(5))
+	require.True(res.IsOK(), res.Message)
+	_, ok = view.GetStakeReturnAddress(core.StakeForValidator, holder.Address, staker.Address, returnHeight)
+	assert.False(ok)
+	assert.Empty(view.GetValidatorCandidatePool().PendingStakeReturns(staker.Address))
+	assert.Equal(new(big.Int).Mul(big.NewInt(2), core.MinValidatorStakeDeposit),
+		view.GetValidatorCandidatePool().FindStakeDelegate(holder.Address).TotalStake())
+	assert.Equal(types.Coins{ThetaWei: big.NewInt(0), TFuelWei: big.NewInt(5 * txFee)}, view.GetAccount(staker.Address).Balance)
+}
+
+func TestDepositStakeTxIdempotencyNonce(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	txFee := getMinimumTxFee()
+	staker := types.MakeAccWithInitBalance("idempotency_staker", types.Coins{
+		ThetaWei: new(big.Int).Mul(core.MinValidatorStakeDeposit, big.NewInt(10)),
+		TFuelWei: big.NewInt(10 * txFee),
+	})
+	holder := types.PrivAccountFromSecret("idempotency_holder")
+
+	et := NewExecTest()
+	et.acc2State(staker)
+	et.state().Delivered().UpdateValidatorCandidatePool(&core.ValidatorCandidatePool{})
+
+	newDepositStakeTx := func(nonce uint64, seq int) *types.DepositStakeTx {
+		tx := &types.DepositStakeTx{
+			Fee:              types.NewCoins(0, txFee),
+			Source:           types.NewTxInput(staker.Address, types.Coins{ThetaWei: core.MinValidatorStakeDeposit, TFuelWei: big.NewInt(0)}, seq),
+			Holder:           types.TxOutput{Address: holder.Address},
+			Purpose:          core.StakeForValidator,
+			IdempotencyNonce: nonce,
+		}
+		tx.Source.Signature = staker.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+	totalStake := func() *big.Int {
+		delegate := et.state().Delivered().GetValidatorCandidatePool().FindStakeDelegate(holder.Address)
+		if delegate == nil {
+			return big.NewInt(0)
+		}
+		return delegate.TotalStake()
+	}
+
+	// Not accepted before the fork
+	_, res := et.executor.ExecuteTx(newDepositStakeTx(42, 1))
+	assert.Equal(result.CodeInvalidIdempotencyNonce, res.Code, res.Message)
+	et.fastforwardTo(common.HeightEnableDepositIdempotency - 1)
+
+	// The retry of a deposit with the same nonce is rejected, even with a new sequence, in the same block or later
+	_, res = et.executor.ExecuteTx(newDepositStakeTx(42, 1))
+	require.True(res.IsOK(), res.Message)
+	recordHeight := et.state().Delivered().Height() + 1
+	_, res = et.executor.ExecuteTx(newDepositStakeTx(42, 2))
+	assert.Equal(result.CodeDuplicateDepositNonce, res.Code, res.Message)
+	et.fastforwardTo(recordHeight + 10)
+	_, res = et.executor.ExecuteTx(newDepositStakeTx(42, 2))
+	assert.Equal(result.CodeDuplicateDepositNonce, res.Code, res.Message)
+	assert.Equal(core.MinValidatorStakeDeposit, totalStake())
+
+	// The second deposits with a distinct nonce, or without a nonce, are accepted
+	_, res = et.executor.ExecuteTx(newDepositStakeTx(43, 2))
+	require.True(res.IsOK(), res.Message)
+	_, res = et.executor.ExecuteTx(newDepositStakeTx(0, 3))
+	require.True(res.IsOK(), res.Message)
+	_, res = et.executor.ExecuteTx(newDepositStakeTx(0, 4))
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(new(big.Int).Mul(core.MinValidatorStakeDeposit, big.NewInt(4)), totalStake())
+
+	// The nonce is used again once it leaves the window
+	view := et.state().Delivered()
+	usedHeight, used := view.GetDepositNonceHeight(staker.Address, 42)
+	require.True(used)
+	assert.Equal(recordHeight, usedHeight)
+	assert.Equal(1, view.PruneDepositNonces(recordHeight+core.DepositNonceWindow))
+	_, res = et.executor.ExecuteTx(newDepositStakeTx(42, 5))
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(new(big.Int).Mul(core.MinValidatorStakeDeposit, big.NewInt(5)), totalStake())
+	assert.Equal(types.Coins{ThetaWei: new(big.Int).Mul(core.MinValidatorStakeDeposit, big.NewInt(5)), TFuelWei: big.NewInt(5 * txFee)},
+		view.GetAccount(staker.Address).Balance)
+}
+
+func TestDepositStakeTxUnbondingQueue(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	txFee := getMinimumTxFee()
+	staker := types.MakeAccWithInitBalance("unbonding_queue_staker", types.Coins{
+		ThetaWei: new(big.Int).Mul(core.MinValidatorStakeDeposit, big.NewInt(2)),
+		TFuelWei: big.NewInt(10 * txFee),
+	})
+	holder := types.PrivAccountFromSecret("unbonding_queue_holder")
+	withdrawHeight := uint64(1)
 
-	bobFinalBalance := et.state().Delivered().GetAccount(bob.Address).Balance
-	carolFinalBalance := et.state().Delivered().GetAccount(carol.Address).Balance
-	log.Infof("Bob's final balance:   %v", bobFinalBalance)
-	log.Infof("Carol's final balance: %v", carolFinalBalance)
+	et := NewExecTest()
+	et.acc2State(staker)
+	vcp := &core.ValidatorCandidatePool{}
+	require.Nil(vcp.DepositStake(staker.Address, holder.Address, core.MinValidatorStakeDeposit))
+	require.Nil(vcp.WithdrawStake(staker.Address, holder.Address, withdrawHeight))
+	et.state().Delivered().UpdateValidatorCandidatePool(vcp)
+
+	sign := func(tx types.Tx, in *types.TxInput, seq uint64) types.Tx {
+		in.Sequence = seq
+		in.Signature = staker.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+	newDepositStakeTx := func(seq uint64) types.Tx {
+		tx := &types.DepositStakeTx{
+			Fee:     types.NewCoins(0, txFee),
+			Source:  types.TxInput{Address: staker.Address, Coins: types.Coins{ThetaWei: core.MinValidatorStakeDeposit, TFuelWei: big.NewInt(0)}},
+			Holder:  types.TxOutput{Address: holder.Address},
+			Purpose: core.StakeForValidator,
+		}
+		return sign(tx, &tx.Source, seq)
+	}
 
-	// Check the balances of the relevant accounts
-	bobSplitCoins := types.Coins{TFuelWei: big.NewInt(payAmount * 70 / 100), ThetaWei: big.NewInt(0)}
-	servicePaymentTxFee := types.NewCoins(0, txFee)
-	carolSplitCoins := types.Coins{TFuelWei: big.NewInt(payAmount * 30 / 100), ThetaWei: big.NewInt(0)}
-	assert.Equal(bobInitBalance.Plus(bobSplitCoins).Minus(servicePaymentTxFee), bobFinalBalance)
-	assert.Equal(carolInitBalance.Plus(carolSplitCoins), carolFinalBalance)
+	// Before the fork, the stake can't be topped up during the withdrawal locking period
+	et.fastforwardTo(common.HeightEnableUnbondingQueue - 2)
+	_, res := et.executor.ExecuteTx(newDepositStakeTx(1))
+	assert.Equal(result.CodeStakeLocked, res.Code, res.Message)
+
+	// After the fork, the deposit adds an active stake, and its withdrawal is queued after the first one
+	et.fastforwardTo(common.HeightEnableUnbondingQueue - 1)
+	_, res = et.executor.ExecuteTx(newDepositStakeTx(1))
+	require.True(res.IsOK(), res.Message)
+	view := et.state().Delivered()
+	require.NotNil(view.GetValidatorCandidatePool().FindActiveStake(staker.Address, holder.Address))
+	assert.Equal(core.MinValidatorStakeDeposit, view.GetValidatorCandidatePool().FindStakeDelegate(holder.Address).TotalStake())
+
+	withdrawTx := &types.WithdrawStakeTx{
+		Fee:     types.NewCoins(0, txFee),
+		Source:  types.TxInput{Address: staker.Address},
+		Holder:  types.TxOutput{Address: holder.Address},
+		Purpose: core.StakeForValidator,
+	}
+	_, res = et.executor.ExecuteTx(sign(withdrawTx, &withdrawTx.Source, 2))
+	require.True(res.IsOK(), res.Message)
+	pendingReturns := et.state().Delivered().GetValidatorCandidatePool().PendingStakeReturns(staker.Address)
+	require.Equal(2, len(pendingReturns))
+	assert.Equal(withdrawHeight+core.ReturnLockingPeriod, pendingReturns[0].ReturnHeight)
+	assert.Equal(common.HeightEnableUnbondingQueue-1+core.ReturnLockingPeriod, pendingReturns[1].ReturnHeight)
+
+	// The cancellation applies to the latest withdrawal only
+	cancelTx := &types.CancelWithdrawTx{
+		Fee:    types.NewCoins(0, txFee),
+		Source: types.TxInput{Address: staker.Address},
+		Holder: types.TxOutput{Address: holder.Address},
+	}
+	_, res = et.executor.ExecuteTx(sign(cancelTx, &cancelTx.Source, 3))
+	require.True(res.IsOK(), res.Message)
+	vcp = et.state().Delivered().GetValidatorCandidatePool()
+	assert.Equal(pendingReturns[:1], vcp.PendingStakeReturns(staker.Address))
+	assert.Equal(core.MinValidatorStakeDeposit, vcp.FindStakeDelegate(holder.Address).TotalStake())
 }
 
-func TestSplitRuleTxExpiration(t *testing.T) {
+func TestStakingParamsTx(t *testing.T) {
 	assert := assert.New(t)
-	et, resourceID, alice, bob, carol, _, bobInitBalance, carolInitBalance := setupForServicePayment(assert)
-	log.Infof("Bob's initial balance:   %v", bobInitBalance)
-	log.Infof("Carol's initial balance: %v", carolInitBalance)
+	require := require.New(t)
 
 	txFee := getMinimumTxFee()
+	minStake := core.MinValidatorStakeDeposit
+	raisedMinStake := new(big.Int).Mul(minStake, big.NewInt(2))
+	lockingPeriod := uint64(100)
+	staker := types.MakeAccWithInitBalance("staking_params_staker", types.Coins{
+		ThetaWei: new(big.Int).Mul(minStake, big.NewInt(4)),
+		TFuelWei: big.NewInt(10 * txFee),
+	})
+	holder := types.PrivAccountFromSecret("staking_params_holder")
+	otherHolder := types.PrivAccountFromSecret("staking_params_other_holder")
 
-	initiator := types.MakeAcc("User David")
-	initiator.Balance = types.Coins{TFuelWei: big.NewInt(10000 * txFee), ThetaWei: big.NewInt(0)}
-	et.acc2State(initiator)
-
-	splitCarol := types.Split{
-		Address:    carol.Address,
-		Percentage: 30,
+	et := NewExecTest()
+	et.acc2State(staker)
+	et.state().Delivered().UpdateValidatorCandidatePool(&core.ValidatorCandidatePool{})
+	et.state().Delivered().UpdateMinValidatorStakeDeposit(raisedMinStake)
+	et.state().Delivered().UpdateReturnLockingPeriod(lockingPeriod)
+
+	sign := func(tx types.Tx, in *types.TxInput, seq uint64) types.Tx {
+		in.Sequence = seq
+		in.Signature = staker.Sign(tx.SignBytes(et.chainID))
+		return tx
 	}
-	splitRuleTx := &types.SplitRuleTx{
-		Fee:        types.NewCoins(0, txFee),
-		ResourceID: resourceID,
-		Initiator: types.TxInput{
-			Address:  initiator.Address,
-			Sequence: 1,
-		},
-		Splits:   []types.Split{splitCarol},
-		Duration: uint64(100),
+	newDepositStakeTx := func(holder common.Address, amount *big.Int, seq uint64) types.Tx {
+		tx := &types.DepositStakeTx{
+			Fee:     types.NewCoins(0, txFee),
+			Source:  types.TxInput{Address: staker.Address, Coins: types.Coins{ThetaWei: amount, TFuelWei: big.NewInt(0)}},
+			Holder:  types.TxOutput{Address: holder},
+			Purpose: core.StakeForValidator,
+		}
+		return sign(tx, &tx.Source, seq)
+	}
+	newWithdrawStakeTx := func(seq uint64) types.Tx {
+		tx := &types.WithdrawStakeTx{
+			Fee:     types.NewCoins(0, txFee),
+			Source:  types.TxInput{Address: staker.Address},
+			Holder:  types.TxOutput{Address: holder.Address},
+			Purpose: core.StakeForValidator,
+		}
+		return sign(tx, &tx.Source, seq)
 	}
-	signBytes := splitRuleTx.SignBytes(et.chainID)
-	splitRuleTx.Initiator.Signature = initiator.Sign(signBytes)
 
-	res := et.executor.getTxExecutor(splitRuleTx).sanityCheck(et.chainID, et.state().Delivered(), splitRuleTx)
-	assert.True(res.IsOK(), res.Message)
-	_, res = et.executor.getTxExecutor(splitRuleTx).process(et.chainID, et.state().Delivered(), splitRuleTx)
-	assert.True(res.IsOK(), res.Message)
+	// Before the fork, the defaults apply whatever the parameters in the state
+	withdrawHeight := common.HeightEnableStakingParams - 2
+	et.fastforwardTo(withdrawHeight)
+	_, res := et.executor.ExecuteTx(newDepositStakeTx(holder.Address, minStake, 1))
+	require.True(res.IsOK(), res.Message)
+	_, res = et.executor.ExecuteTx(newWithdrawStakeTx(2))
+	require.True(res.IsOK(), res.Message)
+	_, res = et.executor.ExecuteTx(newDepositStakeTx(otherHolder.Address, minStake, 3))
+	require.True(res.IsOK(), res.Message)
+
+	// From the fork on, the deposits below the raised minimum are rejected, the stake deposited under the old
+	// minimum stays
+	et.fastforwardTo(common.HeightEnableStakingParams - 1)
+	_, res = et.executor.ExecuteTx(newDepositStakeTx(holder.Address, minStake, 4))
+	assert.Equal(result.CodeInsufficientStake, res.Code, res.Message)
+	_, res = et.executor.ExecuteTx(newDepositStakeTx(holder.Address, raisedMinStake, 4))
+	require.True(res.IsOK(), res.Message)
+	vcp := et.state().Delivered().GetValidatorCandidatePool()
+	assert.Equal(raisedMinStake, vcp.FindStakeDelegate(holder.Address).TotalStake())
+	assert.Equal(minStake, vcp.FindStakeDelegate(otherHolder.Address).TotalStake())
+
+	// The withdrawal before the fork keeps its return height, the new one uses the new locking period
+	_, res = et.executor.ExecuteTx(newWithdrawStakeTx(5))
+	require.True(res.IsOK(), res.Message)
+	pendingReturns := et.state().Delivered().GetValidatorCandidatePool().PendingStakeReturns(staker.Address)
+	require.Equal(2, len(pendingReturns))
+	assert.Equal(common.HeightEnableStakingParams-1+lockingPeriod, pendingReturns[0].ReturnHeight) // returns first
+	assert.Equal(withdrawHeight+core.ReturnLockingPeriod, pendingReturns[1].ReturnHeight)
+}
 
-	et.fastforwardBy(105) // The split rule should expire after the fastforward
+func TestStakeSourceHolderCombinations(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
 
-	// Simulate micropayment #1 between Alice and Bob, Carol should NOT get a cut
-	payAmount := int64(1000 * txFee)
-	srcSeq, tgtSeq, paymentSeq, reserveSeq := 1, 1, 1, 1
-	_ = createServicePaymentTx(et.chainID, &alice, &bob, 100, srcSeq, tgtSeq, paymentSeq, reserveSeq, resourceID)
-	_ = createServicePaymentTx(et.chainID, &alice, &bob, 500, srcSeq, tgtSeq, paymentSeq, reserveSeq, resourceID)
-	servicePaymentTx := createServicePaymentTx(et.chainID, &alice, &bob, payAmount, srcSeq, tgtSeq, paymentSeq, reserveSeq, resourceID)
-	res = et.executor.getTxExecutor(servicePaymentTx).sanityCheck(et.chainID, et.state().Delivered(), servicePaymentTx)
-	assert.True(res.IsOK(), res.Message)
+	txFee := getMinimumTxFee()
+	minStake := core.MinValidatorStakeDeposit
+	newStaker := func(secret string, numMinStakes int64, tfuel int64) types.PrivAccount {
+		return types.MakeAccWithInitBalance(secret, types.Coins{
+			ThetaWei: new(big.Int).Mul(minStake, big.NewInt(numMinStakes)),
+			TFuelWei: big.NewInt(tfuel),
+		})
+	}
+	alice := newStaker("self_staking_alice", 2, 10*txFee)
+	bob := newStaker("self_staking_bob", 1, 10*txFee)
+	carol := newStaker("self_staking_carol", 1, 10*txFee)
+	broke := newStaker("self_staking_broke", 1, 0)
 
-	assert.Equal(0, len(et.state().Delivered().GetSlashIntents()))
-	_, res = et.executor.getTxExecutor(servicePaymentTx).process(et.chainID, et.state().Delivered(), servicePaymentTx)
-	assert.True(res.IsOK(), res.Message)
+	et := NewExecTest()
+	et.acc2State(alice, bob, carol, broke)
+	et.state().Delivered().UpdateValidatorCandidatePool(&core.ValidatorCandidatePool{})
+	et.fastforwardTo(common.HeightEnableStakeEjection - 1)
+
+	sequences := map[common.Address]uint64{}
+	sign := func(tx types.Tx, in *types.TxInput, signer types.PrivAccount) types.Tx {
+		in.Address = signer.Address
+		in.Sequence = sequences[signer.Address] + 1
+		in.Signature = signer.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+	execute := func(tx types.Tx, signer types.PrivAccount) result.Result {
+		_, res := et.executor.ExecuteTx(tx)
+		if res.IsOK() {
+			sequences[signer.Address]++
+		}
+		return res
+	}
+	deposit := func(source types.PrivAccount, holder common.Address, amount *big.Int) result.Result {
+		tx := &types.DepositStakeTx{
+			Fee:     types.NewCoins(0, txFee),
+			Holder:  types.TxOutput{Address: holder},
+			Purpose: core.StakeForValidator,
+		}
+		tx.Source.Coins = types.Coins{ThetaWei: amount, TFuelWei: big.NewInt(0)}
+		return execute(sign(tx, &tx.Source, source), source)
+	}
+	withdraw := func(source types.PrivAccount, holder common.Address) result.Result {
+		tx := &types.WithdrawStakeTx{
+			Fee:     types.NewCoins(0, txFee),
+			Holder:  types.TxOutput{Address: holder},
+			Purpose: core.StakeForValidator,
+		}
+		return execute(sign(tx, &tx.Source, source), source)
+	}
+	eject := func(holder types.PrivAccount, source common.Address) result.Result {
+		tx := &types.EjectStakeTx{
+			Fee:     types.NewCoins(0, txFee),
+			Source:  types.TxOutput{Address: source},
+			Purpose: core.StakeForValidator,
+		}
+		return execute(sign(tx, &tx.Holder, holder), holder)
+	}
+	totalStake := func(holder common.Address) *big.Int {
+		candidate := et.state().Delivered().GetValidatorCandidatePool().FindStakeDelegate(holder)
+		if candidate == nil {
+			return big.NewInt(0)
+		}
+		return candidate.TotalStake()
+	}
 
-	et.state().Commit()
+	// The self stake has the same minimum as any other deposit, and the balance of the source covers the fee too
+	res := deposit(alice, alice.Address, new(big.Int).Sub(minStake, big.NewInt(1)))
+	assert.Equal(result.CodeInsufficientStake, res.Code, res.Message)
+	res = deposit(broke, broke.Address, minStake)
+	assert.Equal(result.CodeInsufficientFund, res.Code, res.Message)
+
+	// The self stake counts toward the stake of the holder like the stake of another source
+	require.True(deposit(alice, alice.Address, minStake).IsOK())
+	assert.Equal(minStake, totalStake(alice.Address))
+	require.True(deposit(carol, alice.Address, minStake).IsOK())
+	assert.Equal(new(big.Int).Mul(minStake, big.NewInt(2)), totalStake(alice.Address))
+
+	// The staked coins leave the balance, the holder can not spend them
+	aliceBalance := et.state().Delivered().GetAccount(alice.Address).Balance
+	assert.Equal(minStake, aliceBalance.ThetaWei)
+	assert.Equal(big.NewInt(9*txFee), aliceBalance.TFuelWei)
+
+	// The holders staking to each other hold independent stakes
+	require.True(deposit(alice, bob.Address, minStake).IsOK())
+	require.True(deposit(bob, alice.Address, minStake).IsOK())
+	assert.Equal(new(big.Int).Mul(minStake, big.NewInt(3)), totalStake(alice.Address))
+	assert.Equal(minStake, totalStake(bob.Address))
+	res = deposit(alice, alice.Address, minStake)
+	assert.Equal(result.CodeInsufficientFund, res.Code, res.Message)
+
+	require.True(withdraw(bob, alice.Address).IsOK())
+	assert.Equal(new(big.Int).Mul(minStake, big.NewInt(2)), totalStake(alice.Address))
+	assert.Equal(minStake, totalStake(bob.Address))
+	require.True(eject(bob, alice.Address).IsOK())
+	assert.Equal(big.NewInt(0), totalStake(bob.Address))
+	assert.NotNil(et.state().Delivered().GetValidatorCandidatePool().FindActiveStake(alice.Address, alice.Address))
+
+	// The holder withdraws its self stake rather than ejecting it
+	res = eject(alice, alice.Address)
+	assert.Equal(result.CodeSelfStakeEjection, res.Code, res.Message)
+	require.True(withdraw(alice, alice.Address).IsOK())
+	assert.Equal(minStake, totalStake(alice.Address))
+}
 
-	bobFinalBalance := et.state().Delivered().GetAccount(bob.Address).Balance
-	carolFinalBalance := et.state().Delivered().GetAccount(carol.Address).Balance
-	log.Infof("Bob's final balance:   %v", bobFinalBalance)
-	log.Infof("Carol's final balance: %v", carolFinalBalance)
+func TestGuardianStakeTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
 
-	// Check the balances of the relevant accounts
-	bobSplitCoins := types.Coins{TFuelWei: big.NewInt(payAmount), ThetaWei: big.NewInt(0)}
-	servicePaymentTxFee := types.NewCoins(0, txFee)
-	assert.Equal(bobInitBalance.Plus(bobSplitCoins).Minus(servicePaymentTxFee), bobFinalBalance)
-	assert.Equal(carolInitBalance, carolFinalBalance) // Carol gets no cut since the split rule has expired
+	txFee := getMinimumTxFee()
+	staker := types.MakeAccWithInitBalance("guardian_staker", types.Coins{
+		ThetaWei: new(big.Int).Mul(core.MinGuardianStakeDeposit, big.NewInt(10)),
+		TFuelWei: big.NewInt(10 * txFee),
+	})
+	guardian := types.PrivAccountFromSecret("guardian_holder")
+
+	et := NewExecTest()
+	et.acc2State(staker)
+
+	newDepositStakeTx := func(amount *big.Int, seq uint64) types.Tx {
+		tx := &types.DepositStakeTx{
+			Fee:     types.NewCoins(0, txFee),
+			Source:  types.TxInput{Address: staker.Address, Coins: types.Coins{ThetaWei: amount, TFuelWei: big.NewInt(0)}, Sequence: seq},
+			Holder:  types.TxOutput{Address: guardian.Address},
+			Purpose: core.StakeForGuardian,
+		}
+		tx.Source.Signature = staker.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+	newWithdrawStakeTx := func(seq uint64) types.Tx {
+		tx := &types.WithdrawStakeTx{
+			Fee:     types.NewCoins(0, txFee),
+			Source:  types.TxInput{Address: staker.Address, Sequence: seq},
+			Holder:  types.TxOutput{Address: guardian.Address},
+			Purpose: core.StakeForGuardian,
+		}
+		tx.Source.Signature = staker.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+	stake := new(big.Int).Mul(core.MinGuardianStakeDeposit, big.NewInt(2))
+
+	// Rejected before the fork height
+	_, res := et.executor.ExecuteTx(newDepositStakeTx(stake, 1))
+	assert.Equal(result.CodeStakePurposeNotActive, res.Code, res.Message)
+
+	// The guardian minimum applies, which is below the validator minimum
+	et.fastforwardTo(common.HeightEnableGuardianStaking - 1)
+	_, res = et.executor.ExecuteTx(newDepositStakeTx(new(big.Int).Sub(core.MinGuardianStakeDeposit, big.NewInt(1)), 1))
+	assert.Equal(result.CodeInsufficientStake, res.Code, res.Message)
+	_, res = et.executor.ExecuteTx(newWithdrawStakeTx(1))
+	assert.Equal(result.CodeStakeNotFound, res.Code, res.Message)
+	_, res = et.executor.ExecuteTx(newDepositStakeTx(stake, 1))
+	require.True(res.IsOK(), res.Message)
+
+	// The guardian stake is kept apart from the validator candidates
+	view := et.state().Delivered()
+	assert.Equal(stake, view.GetGuardianCandidatePool().FindStakeDelegate(guardian.Address).TotalStake())
+	assert.Nil(view.GetValidatorCandidatePool())
+	stakerAcc := view.GetAccount(staker.Address)
+	assert.Equal(new(big.Int).Mul(core.MinGuardianStakeDeposit, big.NewInt(8)), stakerAcc.Balance.ThetaWei)
+
+	// The withdrawn stake returns after the guardian locking period
+	_, res = et.executor.ExecuteTx(newWithdrawStakeTx(2))
+	require.True(res.IsOK(), res.Message)
+	_, res = et.executor.ExecuteTx(newWithdrawStakeTx(3))
+	assert.Equal(result.CodeStakeAlreadyWithdrawn, res.Code, res.Message)
+	assert.Equal([]core.PendingStakeReturn{{
+		Holder:       guardian.Address,
+		Source:       staker.Address,
+		Amount:       stake,
+		ReturnHeight: common.HeightEnableGuardianStaking - 1 + core.GuardianReturnLockingPeriod,
+	}}, et.state().Delivered().GetGuardianCandidatePool().PendingStakeReturns(staker.Address))
 }
 
 func TestSplitRuleTxUpdate(t *testing.T) {
@@ -2251,3 +4317,812 @@ func TestSplitRuleZeroDuration(t *testing.T) {
 	retrievedSplitRule2ndTime := et.state().Delivered().GetSplitRule(resourceID)
 	assert.Nil(retrievedSplitRule2ndTime) // Should be expired and got deleted
 }
+
+func TestTxSignedForOtherChain(t *testing.T) {
+	assert := assert.New(t)
+	et := NewExecTest()
+
+	txFee := getMinimumTxFee()
+	fee := types.NewCoins(0, txFee)
+	signedChainID, otherChainID := core.TestnetChainID, core.MainnetChainID
+
+	// The transaction types enabled by a fork are checked past the fork
+	et.fastforwardToForks(common.HeightEnableMultisig, common.HeightEnablePartialReleaseFund,
+		common.HeightEnableExtendSplitRule, common.HeightEnableSweepAccount, common.HeightEnableBurn)
+
+	// Each transaction is signed for the testnet by a newly created account
+	newSigner := func(secret string) (types.PrivAccount, types.TxInput) {
+		acc := types.MakeAcc(secret)
+		et.acc2State(acc)
+		return acc, types.TxInput{Address: acc.Address, Sequence: 1}
+	}
+	sign := func(tx types.Tx, acc types.PrivAccount, in *types.TxInput) types.Tx {
+		in.Signature = acc.Sign(tx.SignBytes(signedChainID))
+		return tx
+	}
+	txs := map[string]func() types.Tx{
+		"SendTx": func() types.Tx {
+			acc, _ := newSigner("send")
+			tx := types.MakeSendTx(1, et.accOut, acc)
+			return sign(tx, acc, &tx.Inputs[0])
+		},
+		"ReserveFundTx": func() types.Tx {
+			acc, in := newSigner("reserve")
+			in.Coins = types.NewCoins(0, 10*txFee)
+			tx := &types.ReserveFundTx{Fee: fee, Source: in, Collateral: types.NewCoins(0, 11*txFee),
+				ResourceIDs: []string{"rid001"}, Duration: 1000}
+			return sign(tx, acc, &tx.Source)
+		},
+		"ReleaseFundTx": func() types.Tx {
+			acc, in := newSigner("release")
+			tx := &types.ReleaseFundTx{Fee: fee, Source: in, ReserveSequence: 1}
+			return sign(tx, acc, &tx.Source)
+		},
+		"ServicePaymentTx": func() types.Tx {
+			source, _ := newSigner("payment source")
+			target, _ := newSigner("payment target")
+			return createServicePaymentTx(signedChainID, &source, &target, 100*txFee, 1, 1, 1, 1, "rid001")
+		},
+		"SplitRuleTx": func() types.Tx {
+			acc, in := newSigner("split rule")
+			tx := &types.SplitRuleTx{Fee: fee, ResourceID: "rid001", Initiator: in,
+				Splits: []types.Split{{Address: et.accOut.Address, Percentage: 30}}, Duration: 1000}
+			return sign(tx, acc, &tx.Initiator)
+		},
+		"DepositStakeTx": func() types.Tx {
+			acc, in := newSigner("deposit stake")
+			in.Coins = types.Coins{ThetaWei: core.MinValidatorStakeDeposit, TFuelWei: big.NewInt(0)}
+			acc.Balance = in.Coins.Plus(acc.Balance)
+			et.acc2State(acc)
+			tx := &types.DepositStakeTx{Fee: fee, Source: in, Holder: types.TxOutput{Address: et.accOut.Address},
+				Purpose: core.StakeForValidator}
+			return sign(tx, acc, &tx.Source)
+		},
+		"WithdrawStakeTx": func() types.Tx {
+			acc, in := newSigner("withdraw stake")
+			tx := &types.WithdrawStakeTx{Fee: fee, Source: in, Holder: types.TxOutput{Address: et.accOut.Address},
+				Purpose: core.StakeForValidator}
+			return sign(tx, acc, &tx.Source)
+		},
+		"UpdateMultisigTx": func() types.Tx {
+			acc, in := newSigner("update multisig")
+			tx := &types.UpdateMultisigTx{Fee: fee, Account: in, Owners: []common.Address{et.accOut.Address}, Threshold: 1}
+			return sign(tx, acc, &tx.Account)
+		},
+		"PartialReleaseFundTx": func() types.Tx {
+			source, in := newSigner("partial release source")
+			target, _ := newSigner("partial release target")
+			tx := &types.PartialReleaseFundTx{Fee: fee, Source: in, Target: types.TxInput{Address: target.Address},
+				ReserveSequence: 1, Amount: types.NewCoins(0, txFee)}
+			sign(tx, target, &tx.Target)
+			return sign(tx, source, &tx.Source)
+		},
+		"ExtendSplitRuleTx": func() types.Tx {
+			acc, in := newSigner("extend split rule")
+			tx := &types.ExtendSplitRuleTx{Fee: fee, ResourceID: "rid001", Initiator: in, Duration: 1000}
+			return sign(tx, acc, &tx.Initiator)
+		},
+		"SweepAccountTx": func() types.Tx {
+			acc, in := newSigner("sweep account")
+			in.Coins = acc.Balance
+			tx := &types.SweepAccountTx{Fee: fee, Source: in, Target: et.accOut.Address}
+			return sign(tx, acc, &tx.Source)
+		},
+		"BurnTx": func() types.Tx {
+			acc, in := newSigner("burn")
+			in.Coins = types.NewCoins(0, txFee)
+			tx := &types.BurnTx{Fee: fee, Source: in}
+			return sign(tx, acc, &tx.Source)
+		},
+	}
+
+	for name, newTx := range txs {
+		tx := newTx()
+		view := et.state().Delivered()
+
+		// The signatures pass on the chain the transaction is signed for
+		res := et.executor.sanityCheck(signedChainID, view, tx)
+		assert.NotEqual(result.CodeInvalidSignature, res.Code, "%v: %v", name, res.Message)
+		assert.NotEqual(result.CodeWrongChainID, res.Code, "%v: %v", name, res.Message)
+
+		// But are rejected as signed for another chain everywhere else
+		res = et.executor.sanityCheck(otherChainID, view, tx)
+		assert.Equal(result.CodeWrongChainID, res.Code, "%v: %v", name, res.Message)
+		res = et.executor.sanityCheck(et.chainID, view, tx)
+		assert.Equal(result.CodeWrongChainID, res.Code, "%v: %v", name, res.Message)
+	}
+
+	// The signatures made for an unknown chain, or by another key, are just invalid
+	acc := types.MakeAcc("unknown chain")
+	et.acc2State(acc)
+	tx := types.MakeSendTx(1, et.accOut, acc)
+	tx.Inputs[0].Signature = acc.Sign(tx.SignBytes("unknown_chain_id"))
+	_, res := et.executor.ExecuteTx(tx)
+	assert.Equal(result.CodeInvalidSignature, res.Code)
+
+	tx = types.MakeSendTx(1, et.accOut, acc)
+	tx.Inputs[0].Signature = et.accIn.Sign(tx.SignBytes(et.chainID))
+	_, res = et.executor.ExecuteTx(tx)
+	assert.Equal(result.CodeInvalidSignature, res.Code)
+
+	// Submitted through the executor
+	tx = types.MakeSendTx(1, et.accOut, acc)
+	tx.Inputs[0].Signature = acc.Sign(tx.SignBytes(core.PrivatenetChainID))
+	_, res = et.executor.ExecuteTx(tx)
+	assert.Equal(result.CodeWrongChainID, res.Code)
+}
+
+func TestMalformedTxsDoNotPanic(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	et := NewExecTest()
+
+	// Constructed programmatically, the tx would have panicked on the nil fee
+	nilFeeTx := &types.SendTx{
+		Inputs:  []types.TxInput{types.NewTxInput(et.accIn.Address, types.NewCoins(0, 10), 1)},
+		Outputs: []types.TxOutput{{Address: et.accOut.Address, Coins: types.NewCoins(0, 10)}},
+	}
+	et.acc2State(et.accIn)
+	_, res := et.executor.GetTxInfo(nilFeeTx)
+	assert.Equal(result.CodeInvalidFee, res.Code)
+
+	// The mempool rejects the malformed txs at any height, the blocks from the fork height
+	et.fastforwardTo(common.HeightEnableTxValidation)
+	_, res = et.executor.ScreenTx(nilFeeTx)
+	assert.Equal(result.CodeInvalidFee, res.Code)
+	_, res = et.executor.ExecuteTx(nilFeeTx)
+	assert.Equal(result.CodeInvalidFee, res.Code)
+
+	// The unset amounts are taken as zero
+	paymentTx := &types.ServicePaymentTx{
+		Fee:    types.NewCoins(0, getMinimumTxFee()),
+		Source: types.TxInput{Address: et.accOut.Address},
+		Target: types.TxInput{Address: et.accIn.Address, Sequence: 1},
+	}
+	assert.NotPanics(func() { et.executor.ScreenTx(paymentTx) })
+
+	// The accounts signing the canonical txs of the types package, see goldenPrivAccount
+	for _, secret := range []string{"alice", "bob"} {
+		privKey, err := crypto.PrivateKeyFromBytes(crypto.Keccak256Hash([]byte(secret)).Bytes())
+		require.Nil(err)
+		acc := types.MakeAccWithInitBalance(secret, types.NewCoins(1000000, 1000000000000000000))
+		acc.Address = privKey.PublicKey().Address()
+		et.acc2State(acc)
+	}
+
+	// Whatever the corpus txs are mutated into, the decoded txs are rejected or executed without a panic
+	corpusDir := filepath.Join("..", "types", "testdata", "fuzz", "corpus")
+	files, err := ioutil.ReadDir(corpusDir)
+	require.Nil(err)
+	numDecoded := 0
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Join(corpusDir, file.Name()))
+		require.Nil(err)
+		if len(data) == 0 || data[0]%3 != 1 { // see types.Fuzz
+			continue
+		}
+		raw := data[1:]
+		for i := range raw {
+			for _, b := range []byte{0x00, 0xff, raw[i] ^ 0x01} {
+				mutated := append([]byte{}, raw...)
+				mutated[i] = b
+				tx, err := types.TxFromBytes(mutated)
+				if err != nil {
+					continue
+				}
+				if _, ok := tx.(*types.CoinbaseTx); ok { // checked against the ledger, which the test executor lacks
+					continue
+				}
+				numDecoded++
+				assert.NotPanics(func() {
+					et.executor.GetTxInfo(tx)
+					et.executor.ScreenTx(tx)
+				}, "%v: %x", file.Name(), mutated)
+			}
+		}
+	}
+	assert.True(numDecoded > 0)
+}
+
+func TestTxValidationErrorCodes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	et := NewExecTest()
+
+	txFee := getMinimumTxFee()
+	fee := types.NewCoins(0, txFee)
+
+	// The user has sent 5 transactions, the staker has withdrawn its stake from the withdrawn holder
+	user := et.accIn
+	user.Sequence = 5
+	staker := types.MakeAccWithInitBalance("staker", types.Coins{
+		ThetaWei: new(big.Int).Mul(core.MinValidatorStakeDeposit, big.NewInt(3)),
+		TFuelWei: big.NewInt(50 * txFee),
+	})
+	withdrawnHolder, otherHolder := types.MakeAcc("withdrawn holder").Address, types.MakeAcc("other holder").Address
+	vcp := &core.ValidatorCandidatePool{}
+	require.Nil(vcp.DepositStake(staker.Address, withdrawnHolder, core.MinValidatorStakeDeposit))
+	require.Nil(vcp.WithdrawStake(staker.Address, withdrawnHolder, 1))
+	et.state().Delivered().UpdateValidatorCandidatePool(vcp)
+	et.acc2State(user, et.accOut, staker)
+
+	signSend := func(tx *types.SendTx, signer types.PrivAccount, chainID string) types.Tx {
+		signBytes := tx.SignBytes(chainID)
+		for i := range tx.Inputs {
+			tx.Inputs[i].Signature = signer.Sign(signBytes)
+		}
+		return tx
+	}
+	newSendTx := func(from types.PrivAccount, seq uint64, theta int64) *types.SendTx {
+		return &types.SendTx{
+			Fee:     fee,
+			Inputs:  []types.TxInput{{Address: from.Address, Coins: types.NewCoins(theta, txFee), Sequence: seq}},
+			Outputs: []types.TxOutput{{Address: et.accOut.Address, Coins: types.NewCoins(theta, 0)}},
+		}
+	}
+	newStakeInput := func(seq uint64, theta *big.Int) types.TxInput {
+		return types.TxInput{Address: staker.Address, Coins: types.Coins{ThetaWei: theta, TFuelWei: big.NewInt(0)}, Sequence: seq}
+	}
+	sign := func(tx types.Tx, signer types.PrivAccount, in *types.TxInput) types.Tx {
+		in.Signature = signer.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+
+	testCases := []struct {
+		name string
+		tx   func() types.Tx
+		code result.ErrorCode
+	}{
+		{"insufficient balance", func() types.Tx {
+			return signSend(newSendTx(user, 6, 800000), user, et.chainID)
+		}, result.CodeInsufficientFund},
+		{"sequence too low", func() types.Tx {
+			return signSend(newSendTx(user, 5, 10), user, et.chainID)
+		}, result.CodeSequenceTooLow},
+		{"sequence too high", func() types.Tx {
+			return signSend(newSendTx(user, 7, 10), user, et.chainID)
+		}, result.CodeSequenceTooHigh},
+		{"fee below minimum", func() types.Tx {
+			tx := newSendTx(user, 6, 10)
+			tx.Fee, tx.Inputs[0].Coins = types.NewCoins(0, 1), types.NewCoins(10, 1)
+			return signSend(tx, user, et.chainID)
+		}, result.CodeInvalidFee},
+		{"unknown source account", func() types.Tx {
+			unknown := types.MakeAcc("unknown")
+			return signSend(newSendTx(unknown, 1, 10), unknown, et.chainID)
+		}, result.CodeUnknownAccount},
+		{"invalid signature", func() types.Tx {
+			return signSend(newSendTx(user, 6, 10), et.accOut, et.chainID)
+		}, result.CodeInvalidSignature},
+		{"signed for another chain", func() types.Tx {
+			return signSend(newSendTx(user, 6, 10), user, core.MainnetChainID)
+		}, result.CodeWrongChainID},
+		{"invalid coins", func() types.Tx {
+			tx := newSendTx(user, 6, 10)
+			tx.Inputs[0].Coins = types.NewCoins(-10, txFee)
+			return signSend(tx, user, et.chainID)
+		}, result.CodeInvalidCoins},
+		{"duplicated input", func() types.Tx {
+			tx := newSendTx(user, 6, 10)
+			tx.Inputs = append(tx.Inputs, tx.Inputs[0])
+			return signSend(tx, user, et.chainID)
+		}, result.CodeDuplicatedAddress},
+		{"no outputs", func() types.Tx {
+			tx := newSendTx(user, 6, 0)
+			tx.Outputs = nil
+			return signSend(tx, user, et.chainID)
+		}, result.CodeInvalidTxFormat},
+		{"valid-until height before the fork", func() types.Tx {
+			tx := newSendTx(user, 6, 10)
+			tx.ValidUntilHeight = 1
+			return signSend(tx, user, et.chainID)
+		}, result.CodeSendTxExpiryNotEnabled},
+		{"stake below minimum", func() types.Tx {
+			tx := &types.DepositStakeTx{Fee: fee, Holder: types.TxOutput{Address: otherHolder}, Purpose: core.StakeForValidator,
+				Source: newStakeInput(1, new(big.Int).Sub(core.MinValidatorStakeDeposit, big.NewInt(1)))}
+			return sign(tx, staker, &tx.Source)
+		}, result.CodeInsufficientStake},
+		{"invalid stake purpose", func() types.Tx {
+			tx := &types.DepositStakeTx{Fee: fee, Holder: types.TxOutput{Address: otherHolder}, Purpose: 255,
+				Source: newStakeInput(1, core.MinValidatorStakeDeposit)}
+			return sign(tx, staker, &tx.Source)
+		}, result.CodeInvalidStakePurpose},
+		{"deposit during the locking period", func() types.Tx {
+			tx := &types.DepositStakeTx{Fee: fee, Holder: types.TxOutput{Address: withdrawnHolder}, Purpose: core.StakeForValidator,
+				Source: newStakeInput(1, core.MinValidatorStakeDeposit)}
+			return sign(tx, staker, &tx.Source)
+		}, result.CodeStakeLocked},
+		{"no stake to withdraw", func() types.Tx {
+			tx := &types.WithdrawStakeTx{Fee: fee, Holder: types.TxOutput{Address: otherHolder}, Purpose: core.StakeForValidator,
+				Source: newStakeInput(1, big.NewInt(0))}
+			return sign(tx, staker, &tx.Source)
+		}, result.CodeStakeNotFound},
+		{"stake already withdrawn", func() types.Tx {
+			tx := &types.WithdrawStakeTx{Fee: fee, Holder: types.TxOutput{Address: withdrawnHolder}, Purpose: core.StakeForValidator,
+				Source: newStakeInput(1, big.NewInt(0))}
+			return sign(tx, staker, &tx.Source)
+		}, result.CodeStakeAlreadyWithdrawn},
+		{"reserved fund not specified", func() types.Tx {
+			tx := &types.ReserveFundTx{Fee: fee, Source: types.TxInput{Address: user.Address, Sequence: 6},
+				Collateral: types.NewCoins(0, 2*txFee), ResourceIDs: []string{"rid001"}, Duration: 1000}
+			return sign(tx, user, &tx.Source)
+		}, result.CodeReservedFundNotSpecified},
+		{"invalid split rule", func() types.Tx {
+			tx := &types.SplitRuleTx{Fee: fee, ResourceID: "rid001", Initiator: types.TxInput{Address: user.Address, Sequence: 6},
+				Splits: []types.Split{{Address: et.accOut.Address, Percentage: 101}}, Duration: 1000}
+			return sign(tx, user, &tx.Initiator)
+		}, result.CodeInvalidSplitRule},
+		{"multisig update before the fork", func() types.Tx {
+			tx := &types.UpdateMultisigTx{Fee: fee, Account: types.TxInput{Address: user.Address, Sequence: 6},
+				Owners: []common.Address{et.accOut.Address}, Threshold: 1}
+			return sign(tx, user, &tx.Account)
+		}, result.CodeMultisigNotEnabled},
+	}
+
+	for _, tc := range testCases {
+		_, res := et.executor.ScreenTx(tc.tx())
+		assert.Equal(tc.code, res.Code, "%v: %v", tc.name, res.Message)
+	}
+}
+
+func TestTxFeeSchedule(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	et := NewExecTest()
+
+	// The base fees differ by the tx type, and the size is charged for
+	txFee := getMinimumTxFee()
+	feeSchedule := types.DefaultFeeSchedule()
+	for txType := range feeSchedule.BaseFeesTFuelWei {
+		feeSchedule.BaseFeesTFuelWei[txType] = big.NewInt(int64(txType+1) * txFee / 2)
+	}
+	feeSchedule.PerByteFeeTFuelWei = big.NewInt(1e9)
+	et.state().Delivered().UpdateFeeSchedule(feeSchedule)
+	et.state().Delivered().UpdateValidatorCandidatePool(&core.ValidatorCandidatePool{})
+	et.state().Commit()
+
+	// The transactions enabled by a fork, e.g. the send transactions with a memo, are checked past the fork
+	et.fastforwardToForks(common.HeightEnableSendTxData, common.HeightEnableMultisig,
+		common.HeightEnablePartialReleaseFund, common.HeightEnableExtendSplitRule, common.HeightEnableSweepAccount,
+		common.HeightEnableBurn)
+
+	// Each transaction comes with a function which sets its fee and signs it again
+	type feeTestTx struct {
+		tx     types.Tx
+		setFee func(fee *big.Int)
+	}
+	newFeeTestTx := func(tx types.Tx, fee *types.Coins, sign func()) feeTestTx {
+		return feeTestTx{tx, func(amount *big.Int) {
+			*fee = types.Coins{ThetaWei: big.NewInt(0), TFuelWei: amount}
+			sign()
+		}}
+	}
+	newSigner := func(secret string) (types.PrivAccount, types.TxInput) {
+		acc := types.MakeAcc(secret)
+		et.acc2State(acc)
+		return acc, types.TxInput{Address: acc.Address, Sequence: 1}
+	}
+	newSendTx := func(secret string, data common.Bytes) feeTestTx {
+		acc, in := newSigner(secret)
+		output := types.TxOutput{Address: et.accOut.Address, Coins: types.NewCoins(0, txFee)}
+		tx := &types.SendTx{Inputs: []types.TxInput{in}, Outputs: []types.TxOutput{output}, Data: data}
+		return newFeeTestTx(tx, &tx.Fee, func() {
+			tx.Inputs[0].Coins = output.Coins.Plus(tx.Fee)
+			tx.Inputs[0].Signature = acc.Sign(tx.SignBytes(et.chainID))
+		})
+	}
+	txs := map[string]func() feeTestTx{
+		"SendTx": func() feeTestTx {
+			return newSendTx("send", nil)
+		},
+		"SendTx with memo": func() feeTestTx {
+			return newSendTx("send memo", common.Bytes("a memo of the send transaction"))
+		},
+		"ReserveFundTx": func() feeTestTx {
+			acc, in := newSigner("reserve")
+			in.Coins = types.NewCoins(0, 10*txFee)
+			tx := &types.ReserveFundTx{Source: in, Collateral: types.NewCoins(0, 11*txFee),
+				ResourceIDs: []string{"rid001"}, Duration: 1000}
+			return newFeeTestTx(tx, &tx.Fee, func() { tx.Source.Signature = acc.Sign(tx.SignBytes(et.chainID)) })
+		},
+		"ReleaseFundTx": func() feeTestTx {
+			acc, in := newSigner("release")
+			tx := &types.ReleaseFundTx{Source: in, ReserveSequence: 1}
+			return newFeeTestTx(tx, &tx.Fee, func() { tx.Source.Signature = acc.Sign(tx.SignBytes(et.chainID)) })
+		},
+		"ServicePaymentTx": func() feeTestTx {
+			source, _ := newSigner("payment source")
+			target, _ := newSigner("payment target")
+			tx := createServicePaymentTx(et.chainID, &source, &target, 10*txFee, 1, 1, 1, 1, "rid001")
+			return newFeeTestTx(tx, &tx.Fee, func() {
+				tx.Source.Signature = source.Sign(tx.SourceSignBytes(et.chainID))
+				tx.Target.Signature = target.Sign(tx.TargetSignBytes(et.chainID))
+			})
+		},
+		"SplitRuleTx": func() feeTestTx {
+			acc, in := newSigner("split rule")
+			tx := &types.SplitRuleTx{ResourceID: "rid001", Initiator: in,
+				Splits: []types.Split{{Address: et.accOut.Address, Percentage: 30}}, Duration: 1000}
+			return newFeeTestTx(tx, &tx.Fee, func() { tx.Initiator.Signature = acc.Sign(tx.SignBytes(et.chainID)) })
+		},
+		"DepositStakeTx": func() feeTestTx {
+			acc, in := newSigner("deposit stake")
+			in.Coins = types.Coins{ThetaWei: core.MinValidatorStakeDeposit, TFuelWei: big.NewInt(0)}
+			acc.Balance = in.Coins.Plus(acc.Balance)
+			et.acc2State(acc)
+			tx := &types.DepositStakeTx{Source: in, Holder: types.TxOutput{Address: et.accOut.Address},
+				Purpose: core.StakeForValidator}
+			return newFeeTestTx(tx, &tx.Fee, func() { tx.Source.Signature = acc.Sign(tx.SignBytes(et.chainID)) })
+		},
+		"WithdrawStakeTx": func() feeTestTx {
+			acc, in := newSigner("withdraw stake")
+			tx := &types.WithdrawStakeTx{Source: in, Holder: types.TxOutput{Address: et.accOut.Address},
+				Purpose: core.StakeForValidator}
+			return newFeeTestTx(tx, &tx.Fee, func() { tx.Source.Signature = acc.Sign(tx.SignBytes(et.chainID)) })
+		},
+		"UpdateMultisigTx": func() feeTestTx {
+			acc, in := newSigner("update multisig")
+			tx := &types.UpdateMultisigTx{Account: in, Owners: []common.Address{et.accOut.Address}, Threshold: 1}
+			return newFeeTestTx(tx, &tx.Fee, func() { tx.Account.Signature = acc.Sign(tx.SignBytes(et.chainID)) })
+		},
+		"PartialReleaseFundTx": func() feeTestTx {
+			source, in := newSigner("partial release source")
+			target, _ := newSigner("partial release target")
+			tx := &types.PartialReleaseFundTx{Source: in, Target: types.TxInput{Address: target.Address},
+				ReserveSequence: 1, Amount: types.NewCoins(0, txFee)}
+			return newFeeTestTx(tx, &tx.Fee, func() {
+				tx.Target.Signature = target.Sign(tx.SignBytes(et.chainID))
+				tx.Source.Signature = source.Sign(tx.SignBytes(et.chainID))
+			})
+		},
+		"ExtendSplitRuleTx": func() feeTestTx {
+			acc, in := newSigner("extend split rule")
+			tx := &types.ExtendSplitRuleTx{ResourceID: "rid001", Initiator: in, Duration: 1000}
+			return newFeeTestTx(tx, &tx.Fee, func() { tx.Initiator.Signature = acc.Sign(tx.SignBytes(et.chainID)) })
+		},
+		"SweepAccountTx": func() feeTestTx {
+			acc, in := newSigner("sweep account")
+			in.Coins = acc.Balance
+			tx := &types.SweepAccountTx{Source: in, Target: et.accOut.Address}
+			return newFeeTestTx(tx, &tx.Fee, func() { tx.Source.Signature = acc.Sign(tx.SignBytes(et.chainID)) })
+		},
+		"BurnTx": func() feeTestTx {
+			acc, in := newSigner("burn")
+			in.Coins = types.NewCoins(0, txFee)
+			tx := &types.BurnTx{Source: in}
+			return newFeeTestTx(tx, &tx.Fee, func() { tx.Source.Signature = acc.Sign(tx.SignBytes(et.chainID)) })
+		},
+	}
+
+	// The fee takes up more bytes as it grows, so the minimum fee is found by raising the fee until it is met
+	setMinimumFee := func(tc feeTestTx) *big.Int {
+		fee := big.NewInt(0)
+		for {
+			tc.setFee(fee)
+			minimumFee, err := feeSchedule.TxMinimumFee(tc.tx)
+			require.Nil(err)
+			if minimumFee.Cmp(fee) == 0 {
+				return fee
+			}
+			fee = minimumFee
+		}
+	}
+	screen := func(tx types.Tx) result.Result {
+		_, res := et.executor.ScreenTx(tx)
+		return res
+	}
+	validate := func(tx types.Tx) result.Result {
+		return et.executor.sanityCheck(et.chainID, et.state().Delivered(), tx)
+	}
+
+	for name, newTx := range txs {
+		tc := newTx()
+		minimumFee := setMinimumFee(tc)
+		raw, err := types.TxToBytes(tc.tx)
+		require.Nil(err)
+		assert.True(minimumFee.Cmp(feeSchedule.TxBaseFee(tc.tx)) > 0, name)
+		assert.Equal(feeSchedule.MinimumFee(tc.tx, len(raw)), minimumFee, name)
+
+		// A wei short of the minimum fee, the transaction is rejected at screening and block validation alike
+		tc.setFee(new(big.Int).Sub(minimumFee, big.NewInt(1)))
+		shortMinimumFee, err := feeSchedule.TxMinimumFee(tc.tx)
+		require.Nil(err)
+		require.Equal(minimumFee, shortMinimumFee, "%v: the size is expected to remain the same", name)
+		res := validate(tc.tx)
+		assert.Equal(result.CodeInvalidFee, res.Code, "%v: %v", name, res.Message)
+		res = screen(tc.tx)
+		assert.Equal(result.CodeInvalidFee, res.Code, "%v: %v", name, res.Message)
+
+		// The fee check is passed with the minimum fee
+		tc.setFee(minimumFee)
+		res = validate(tc.tx)
+		assert.NotEqual(result.CodeInvalidFee, res.Code, "%v: %v", name, res.Message)
+		res = screen(tc.tx)
+		assert.NotEqual(result.CodeInvalidFee, res.Code, "%v: %v", name, res.Message)
+	}
+
+	// The memo is charged for on top of the size
+	tc := newSendTx("send memo fee", common.Bytes("memo"))
+	minimumFee := setMinimumFee(tc)
+	raw, err := types.TxToBytes(tc.tx)
+	require.Nil(err)
+	expected := new(big.Int).Mul(feeSchedule.PerByteFeeTFuelWei, big.NewInt(int64(len(raw))))
+	expected.Add(expected, feeSchedule.BaseFee(types.TxSend))
+	expected.Add(expected, big.NewInt(int64(4*types.SendTxDataFeePerByteTFuelWei)))
+	assert.Equal(expected, minimumFee)
+}
+
+func TestTxIntrinsicGasFee(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	et := NewExecTest()
+
+	txFee := getMinimumTxFee()
+	sender := types.MakeAcc("intrinsic gas sender")
+	et.acc2State(sender)
+	et.state().Commit()
+
+	newSendTx := func(fee int64) types.Tx {
+		output := types.TxOutput{Address: et.accOut.Address, Coins: types.NewCoins(0, txFee)}
+		tx := &types.SendTx{
+			Fee:     types.NewCoins(0, fee),
+			Inputs:  []types.TxInput{{Address: sender.Address, Coins: output.Coins.Plus(types.NewCoins(0, fee)), Sequence: 1}},
+			Outputs: []types.TxOutput{output},
+		}
+		tx.Inputs[0].Signature = sender.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+	screen := func(tx types.Tx) result.Result {
+		_, res := et.executor.ScreenTx(tx)
+		return res
+	}
+
+	// The defaults keep the flat fee, and the effective gas price of the fee divided by the intrinsic gas
+	tx := newSendTx(txFee)
+	assert.True(screen(tx).IsOK())
+	txInfo, res := et.executor.GetTxInfo(tx)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(big.NewInt(txFee/int64(2*types.GasSendTxPerAccount)), txInfo.EffectiveGasPrice)
+
+	// Once the minimum gas price is set, the intrinsic gas is charged for instead
+	gasSchedule := types.DefaultIntrinsicGasSchedule()
+	gasSchedule.GasPerSendTxAccount = 10000
+	gasSchedule.MinGasPriceTFuelWei = new(big.Int).SetUint64(2 * types.MinimumGasPrice)
+	et.state().Delivered().UpdateIntrinsicGasSchedule(gasSchedule)
+	et.state().Commit()
+
+	minimumFee := int64(20000 * 2 * types.MinimumGasPrice)
+	res = screen(newSendTx(txFee))
+	assert.Equal(result.CodeInvalidFee, res.Code, res.Message)
+	res = screen(newSendTx(minimumFee - 1))
+	assert.Equal(result.CodeInvalidFee, res.Code, res.Message)
+	res = et.executor.sanityCheck(et.chainID, et.state().Delivered(), newSendTx(minimumFee-1))
+	assert.Equal(result.CodeInvalidFee, res.Code, res.Message)
+	res = screen(newSendTx(minimumFee))
+	assert.True(res.IsOK(), res.Message)
+
+	// And the mempool orders the transaction by the fee per unit of its intrinsic gas in the committed state
+	txInfo, res = et.executor.GetTxInfo(newSendTx(minimumFee))
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(new(big.Int).SetUint64(2*types.MinimumGasPrice), txInfo.EffectiveGasPrice)
+}
+
+func TestStakePurposeActivatedAtForkHeight(t *testing.T) {
+	assert := assert.New(t)
+	et := NewExecTest()
+
+	// A purpose introduced by a fork
+	forkPurpose := uint8(2)
+	forkHeight := et.state().Height() + 10
+	core.RegisterStakePurpose(forkPurpose, "edge", forkHeight)
+	defer core.UnregisterStakePurpose(forkPurpose)
+
+	txFee := getMinimumTxFee()
+	staker := types.MakeAccWithInitBalance("staker", types.Coins{
+		ThetaWei: new(big.Int).Mul(core.MinValidatorStakeDeposit, big.NewInt(2)),
+		TFuelWei: big.NewInt(10 * txFee),
+	})
+	et.acc2State(staker)
+
+	newDepositStakeTx := func(purpose uint8) types.Tx {
+		tx := &types.DepositStakeTx{
+			Fee:     types.NewCoins(0, txFee),
+			Source:  types.TxInput{Address: staker.Address, Coins: types.Coins{ThetaWei: core.MinValidatorStakeDeposit, TFuelWei: big.NewInt(0)}, Sequence: 1},
+			Holder:  types.TxOutput{Address: et.accOut.Address},
+			Purpose: purpose,
+		}
+		tx.Source.Signature = staker.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+
+	// Rejected before the fork height
+	_, res := et.executor.ScreenTx(newDepositStakeTx(forkPurpose))
+	assert.Equal(result.CodeStakePurposeNotActive, res.Code, res.Message)
+	_, res = et.executor.ScreenTx(newDepositStakeTx(3))
+	assert.Equal(result.CodeInvalidStakePurpose, res.Code, res.Message)
+
+	// Valid for the block at the fork height, there is no stake pool for it in this test though
+	et.fastforwardTo(forkHeight - 1)
+	_, res = et.executor.ScreenTx(newDepositStakeTx(forkPurpose))
+	assert.Equal(result.CodeStakingNotSupported, res.Code, res.Message)
+	_, res = et.executor.ScreenTx(newDepositStakeTx(3))
+	assert.Equal(result.CodeInvalidStakePurpose, res.Code, res.Message)
+}
+
+func TestSendTxCanonicalInputOrder(t *testing.T) {
+	assert := assert.New(t)
+	et := NewExecTest()
+
+	txFee := getMinimumTxFee()
+	alice := types.MakeAccWithInitBalance("alice", types.NewCoins(100, 10*txFee))
+	bob := types.MakeAccWithInitBalance("bob", types.NewCoins(100, 10*txFee))
+	if bytes.Compare(alice.Address[:], bob.Address[:]) < 0 {
+		alice, bob = bob, alice // alice sorts after bob
+	}
+	et.acc2State(alice, bob)
+
+	// Signed before the change, with the inputs not sorted by address
+	tx := &types.SendTx{
+		Fee: types.NewCoins(0, txFee),
+		Inputs: []types.TxInput{
+			{Address: alice.Address, Coins: types.NewCoins(10, txFee), Sequence: 1},
+			{Address: bob.Address, Coins: types.NewCoins(20, 0), Sequence: 1},
+		},
+		Outputs: []types.TxOutput{{Address: et.accOut.Address, Coins: types.NewCoins(30, 0)}},
+	}
+	et.signSendTx(tx, alice, bob)
+	assert.False(tx.HasCanonicalInputOrder())
+
+	// Still valid before the fork height
+	et.fastforwardTo(common.HeightEnableCanonicalTxInputOrder - 2)
+	_, res := et.executor.ScreenTx(tx)
+	assert.True(res.IsOK(), res.Message)
+
+	// Rejected from the fork height on, until normalized and signed again
+	et.fastforwardTo(common.HeightEnableCanonicalTxInputOrder - 1)
+	_, res = et.executor.ScreenTx(tx)
+	assert.Equal(result.CodeSendTxNonCanonicalOrder, res.Code, res.Message)
+
+	assert.True(types.NormalizeTx(tx))
+	assert.Equal(bob.Address, tx.Inputs[0].Address)
+	_, res = et.executor.ScreenTx(tx)
+	assert.Equal(result.CodeInvalidSignature, res.Code, res.Message)
+	et.signSendTx(tx, bob, alice)
+	_, res = et.executor.ScreenTx(tx)
+	assert.True(res.IsOK(), res.Message)
+}
+
+func TestStructuredSignatureAcceptedFromForkHeight(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	et := NewExecTest()
+
+	txFee := getMinimumTxFee()
+	hardwareWallet := types.MakeAccWithInitBalance("hardware wallet", types.NewCoins(100, 10*txFee))
+	softwareWallet := types.MakeAccWithInitBalance("software wallet", types.NewCoins(100, 10*txFee))
+	et.acc2State(hardwareWallet, softwareWallet)
+
+	newSendTx := func(from types.PrivAccount) *types.SendTx {
+		return &types.SendTx{
+			Fee:     types.NewCoins(0, txFee),
+			Inputs:  []types.TxInput{{Address: from.Address, Coins: types.NewCoins(10, txFee), Sequence: 1}},
+			Outputs: []types.TxOutput{{Address: et.accOut.Address, Coins: types.NewCoins(10, 0)}},
+		}
+	}
+	structuredTx := newSendTx(hardwareWallet)
+	structuredSignBytes, err := types.StructuredSignBytes(et.chainID, structuredTx)
+	require.Nil(err)
+	structuredTx.Inputs[0].Signature = hardwareWallet.Sign(structuredSignBytes)
+	legacyTx := newSendTx(softwareWallet)
+	et.signSendTx(legacyTx, softwareWallet)
+
+	// Only the signatures over the SignBytes are accepted before the fork height
+	et.fastforwardTo(common.HeightEnableStructuredSignature - 2)
+	_, res := et.executor.ScreenTx(structuredTx)
+	assert.Equal(result.CodeInvalidSignature, res.Code, res.Message)
+	_, res = et.executor.ScreenTx(legacyTx)
+	assert.True(res.IsOK(), res.Message)
+
+	// Either from the fork height on
+	et.fastforwardTo(common.HeightEnableStructuredSignature - 1)
+	_, res = et.executor.ScreenTx(structuredTx)
+	assert.True(res.IsOK(), res.Message)
+	_, res = et.executor.ScreenTx(legacyTx)
+	assert.True(res.IsOK(), res.Message)
+
+	// The structured signature binds the same fields
+	structuredTx.Inputs[0].Sequence = 2
+	structuredTx.Outputs[0].Address = types.MakeAcc("other").Address
+	_, res = et.executor.ScreenTx(structuredTx)
+	assert.Equal(result.CodeInvalidSignature, res.Code, res.Message)
+}
+
+func TestSendTxFeePayer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	et := NewExecTest()
+
+	txFee := getMinimumTxFee()
+	user := types.MakeAccWithInitBalance("user", types.NewCoins(100, 0)) // no TFuel to pay the fee
+	sponsor := types.MakeAccWithInitBalance("sponsor", types.NewCoins(0, 10*txFee))
+	poorSponsor := types.MakeAccWithInitBalance("poor sponsor", types.NewCoins(100, txFee-1))
+	merchant := types.MakeAccWithInitBalance("merchant", types.NewCoins(0, 0))
+	et.acc2State(user, sponsor, poorSponsor, merchant)
+
+	newSponsoredTx := func(payer types.PrivAccount) *types.SendTx {
+		tx := &types.SendTx{
+			Fee:      types.NewCoins(0, txFee),
+			Inputs:   []types.TxInput{{Address: user.Address, Coins: types.NewCoins(10, 0), Sequence: 1}},
+			Outputs:  []types.TxOutput{{Address: merchant.Address, Coins: types.NewCoins(10, 0)}},
+			FeePayer: &types.TxInput{Address: payer.Address, Coins: types.NewCoins(0, txFee), Sequence: 1},
+		}
+		return tx
+	}
+	sign := func(tx *types.SendTx, payer types.PrivAccount) *types.SendTx {
+		et.signSendTx(tx, user)
+		tx.FeePayer.Signature = payer.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+
+	// The fee payers are rejected before the fork height
+	et.fastforwardTo(common.HeightEnableFeePayer - 2)
+	_, res := et.executor.ScreenTx(sign(newSponsoredTx(sponsor), sponsor))
+	assert.Equal(result.CodeSendTxInvalidFeePayer, res.Code, res.Message)
+
+	et.fastforwardTo(common.HeightEnableFeePayer - 1)
+
+	// The fee payer pays exactly the fee
+	tx := newSponsoredTx(sponsor)
+	tx.FeePayer.Coins = types.NewCoins(0, txFee+1)
+	_, res = et.executor.ScreenTx(sign(tx, sponsor))
+	assert.Equal(result.CodeSendTxInvalidFeePayer, res.Code, res.Message)
+
+	// Both signatures are required
+	tx = newSponsoredTx(sponsor)
+	et.signSendTx(tx, user)
+	_, res = et.executor.ScreenTx(tx)
+	assert.Equal(result.CodeInvalidSignature, res.Code, res.Message)
+	tx = newSponsoredTx(sponsor)
+	tx.FeePayer.Signature = sponsor.Sign(tx.SignBytes(et.chainID))
+	_, res = et.executor.ScreenTx(tx)
+	assert.Equal(result.CodeInvalidSignature, res.Code, res.Message)
+
+	// The fee payer needs to afford the fee
+	_, res = et.executor.ScreenTx(sign(newSponsoredTx(poorSponsor), poorSponsor))
+	assert.Equal(result.CodeInsufficientFund, res.Code, res.Message)
+
+	// The fee payer can't be an input or an output as well
+	tx = newSponsoredTx(user)
+	_, res = et.executor.ScreenTx(sign(tx, user))
+	assert.Equal(result.CodeDuplicatedAddress, res.Code, res.Message)
+
+	// The fee is charged to the fee payer, and the transferred amount to the input
+	tx = sign(newSponsoredTx(sponsor), sponsor)
+	_, res = et.executor.ExecuteTx(tx)
+	require.True(res.IsOK(), res.Message)
+
+	view := et.state().Delivered()
+	userAcc, sponsorAcc := view.GetAccount(user.Address), view.GetAccount(sponsor.Address)
+	assert.Equal(uint64(1), userAcc.Sequence)
+	assert.Equal(uint64(1), sponsorAcc.Sequence)
+	assert.True(types.NewCoins(90, 0).IsEqual(userAcc.Balance), userAcc.Balance.String())
+	assert.True(types.NewCoins(0, 9*txFee).IsEqual(sponsorAcc.Balance), sponsorAcc.Balance.String())
+	assert.True(types.NewCoins(10, 0).IsEqual(view.GetAccount(merchant.Address).Balance))
+
+	// The sequences advance independently, the sponsor pays for another account
+	tx = &types.SendTx{
+		Fee:      types.NewCoins(0, txFee),
+		Inputs:   []types.TxInput{{Address: merchant.Address, Coins: types.NewCoins(5, 0), Sequence: 1}},
+		Outputs:  []types.TxOutput{{Address: user.Address, Coins: types.NewCoins(5, 0)}},
+		FeePayer: &types.TxInput{Address: sponsor.Address, Coins: types.NewCoins(0, txFee), Sequence: 2},
+	}
+	et.signSendTx(tx, merchant)
+	tx.FeePayer.Signature = sponsor.Sign(tx.SignBytes(et.chainID))
+	_, res = et.executor.ExecuteTx(tx)
+	require.True(res.IsOK(), res.Message)
+
+	view = et.state().Delivered()
+	assert.Equal(uint64(1), view.GetAccount(merchant.Address).Sequence)
+	assert.Equal(uint64(2), view.GetAccount(sponsor.Address).Sequence)
+	assert.True(types.NewCoins(0, 8*txFee).IsEqual(view.GetAccount(sponsor.Address).Balance))
+}
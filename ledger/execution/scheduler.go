@@ -0,0 +1,351 @@
+package execution
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+const minParallelSegmentSize = 8 // shorter runs of independent txs are not worth the view copies
+
+//
+// TxScheduler executes the transactions of a block with the same outcome as executing them one by one.
+// The consecutive txs whose accounts are statically known (i.e. the SendTxs) are grouped by the accounts
+// they touch, and the groups not sharing any account are executed in parallel on copies of the view,
+// then merged back. The other txs are executed serially. The input signatures of all the txs are verified
+// upfront in a batch.
+//
+type TxScheduler struct {
+	executor   *Executor
+	numWorkers int
+	txObserver func(tx types.Tx, elapsed time.Duration)
+}
+
+// NewTxScheduler creates an instance of TxScheduler. If numWorkers is not positive, the number of CPUs is used.
+func NewTxScheduler(executor *Executor, numWorkers int) *TxScheduler {
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU()
+	}
+	return &TxScheduler{
+		executor:   executor,
+		numWorkers: numWorkers,
+	}
+}
+
+// SetTxObserver sets the function receiving the execution time of each tx. It is invoked from the
+// parallel workers as well, so it must be concurrency-safe.
+func (ts *TxScheduler) SetTxObserver(txObserver func(tx types.Tx, elapsed time.Duration)) {
+	ts.txObserver = txObserver
+}
+
+// ExecuteTxs executes the given txs against the view. Same as the serial execution, it stops at the
+// first failed tx, and returns the results of the txs up to and including the failed one.
+func (ts *TxScheduler) ExecuteTxs(txs []types.Tx, view *st.StoreView) []result.Result {
+	chainID := ts.executor.state.GetChainID() // caches the chain ID before it is read concurrently
+	prefetchTxSignatures(chainID, txs)
+
+	results := make([]result.Result, 0, len(txs))
+	for start := 0; start < len(txs); {
+		end := start
+		for end < len(txs) && getTxAccounts(txs[end]) != nil {
+			end++
+		}
+
+		if end-start < minParallelSegmentSize || ts.numWorkers < 2 {
+			if end == start {
+				end++ // the non-analyzable tx
+			}
+			for _, tx := range txs[start:end] {
+				res := ts.processTx(tx, view)
+				results = append(results, res)
+				if res.IsError() {
+					return results
+				}
+			}
+		} else {
+			segmentResults := ts.executeSegment(txs[start:end], view)
+			results = append(results, segmentResults...)
+			if len(segmentResults) < end-start || segmentResults[len(segmentResults)-1].IsError() {
+				return results
+			}
+		}
+		start = end
+	}
+	return results
+}
+
+// ExecuteTxsWithAccessLists executes the given txs against the view one at a time, and records the state keys
+// each of them accessed. Same as ExecuteTxs, it stops at the first failed tx.
+func (ts *TxScheduler) ExecuteTxsWithAccessLists(txs []types.Tx, view *st.StoreView) ([]result.Result, []*types.StateAccessList) {
+	recorder := st.NewAccessRecorder()
+	view.SetAccessRecorder(recorder)
+	defer view.SetAccessRecorder(nil)
+
+	results := make([]result.Result, 0, len(txs))
+	accessLists := make([]*types.StateAccessList, 0, len(txs))
+	for _, tx := range txs {
+		recorder.Reset()
+		res := ts.processTx(tx, view)
+		results = append(results, res)
+		accessLists = append(accessLists, recorder.AccessList())
+		if res.IsError() {
+			break
+		}
+	}
+	return results, accessLists
+}
+
+func (ts *TxScheduler) processTx(tx types.Tx, view *st.StoreView) result.Result {
+	if ts.txObserver == nil {
+		_, res := ts.executor.processTxWithView(tx, view)
+		return res
+	}
+	start := time.Now()
+	_, res := ts.executor.processTxWithView(tx, view)
+	ts.txObserver(tx, time.Since(start))
+	return res
+}
+
+// txGroup is a set of txs sharing accounts, which are executed serially in the block order
+type txGroup struct {
+	indices  []int
+	accounts []common.Address
+	view     *st.StoreView
+	recorder *st.AccessRecorder
+	results  []result.Result
+}
+
+// accumulatorKeys are the state keys every tx might update by a delta, e.g. the total supply reduced by the
+// burned fees. The groups write them concurrently, so their deltas are merged rather than their values.
+var accumulatorKeys = []common.Bytes{st.TotalSupplyKey(), st.BurnedFeesKey(), st.UndistributedFeesKey()}
+
+// executeSegment executes the txs whose accounts are all known in parallel groups
+func (ts *TxScheduler) executeSegment(txs []types.Tx, view *st.StoreView) []result.Result {
+	groups := groupTxsByAccounts(txs)
+	if len(groups) < 2 {
+		return ts.executeSerially(txs, view)
+	}
+
+	for _, group := range groups {
+		groupView, err := view.Copy()
+		if err != nil {
+			// The block fails, the view is discarded by the caller
+			return []result.Result{result.Error("Failed to copy the view: %v", err).
+				WithErrorCode(result.CodeInternalStoreError)}
+		}
+		group.recorder = st.NewAccessRecorder()
+		groupView.SetAccessRecorder(group.recorder)
+		group.view = groupView
+	}
+
+	groupCh := make(chan *txGroup, len(groups))
+	for _, group := range groups {
+		groupCh <- group
+	}
+	close(groupCh)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < ts.numWorkers && i < len(groups); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range groupCh {
+				for _, idx := range group.indices {
+					res := ts.processTx(txs[idx], group.view)
+					group.results = append(group.results, res)
+					if res.IsError() {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The outcome of the serial execution: the results up to the first failed tx in the block order
+	results := make([]result.Result, len(txs))
+	executed := make([]bool, len(txs))
+	for _, group := range groups {
+		for i, res := range group.results {
+			results[group.indices[i]] = res
+			executed[group.indices[i]] = true
+		}
+	}
+	for idx := range txs {
+		if !executed[idx] || results[idx].IsError() {
+			// The block fails, the view is discarded by the caller
+			return results[:idx+1]
+		}
+	}
+
+	otherKeys, ok := collectGroupWrites(groups)
+	if !ok {
+		// The groups wrote the same key, e.g. a tx type updating a shared record, which only the serial
+		// execution orders. The view is still untouched.
+		return ts.executeSerially(txs, view)
+	}
+
+	supply := view.GetTotalSupply()
+	burnedFees := view.GetBurnedFees()
+	undistributedFees := view.GetUndistributedFees()
+	for _, group := range groups {
+		group.view.SetAccessRecorder(nil)
+		for _, address := range group.accounts {
+			if account := group.view.GetAccount(address); account != nil {
+				view.SetAccount(address, account)
+			}
+		}
+		for _, key := range otherKeys[group] {
+			if value := group.view.Get(key); value != nil {
+				view.Set(key, value)
+			} else {
+				view.Delete(key)
+			}
+		}
+		mergeAccumulators(view, group, supply, burnedFees, undistributedFees)
+		// e.g. an account which looks missing to the merge above, so the view is not trusted either
+		view.RecordStoreError(group.view.StoreError())
+	}
+	return results
+}
+
+// executeSerially executes the txs one by one in the block order, up to the first failed tx
+func (ts *TxScheduler) executeSerially(txs []types.Tx, view *st.StoreView) []result.Result {
+	results := []result.Result{}
+	for _, tx := range txs {
+		res := ts.processTx(tx, view)
+		results = append(results, res)
+		if res.IsError() {
+			break
+		}
+	}
+	return results
+}
+
+// collectGroupWrites returns the keys written by each group other than the accounts of the group and the
+// accumulator keys. It returns false if two groups wrote the same key, in which case the outcome of the
+// parallel execution might differ from the serial one.
+func collectGroupWrites(groups []*txGroup) (map[*txGroup][]common.Bytes, bool) {
+	otherKeys := make(map[*txGroup][]common.Bytes)
+	writers := make(map[string]*txGroup)
+	for _, group := range groups {
+		accountKeys := make(map[string]bool)
+		for _, address := range group.accounts {
+			accountKeys[string(st.AccountKey(address))] = true
+		}
+		for _, key := range group.recorder.AccessList().Writes {
+			if accountKeys[string(key)] || isAccumulatorKey(key) {
+				continue
+			}
+			if writer, ok := writers[string(key)]; ok && writer != group {
+				return nil, false
+			}
+			writers[string(key)] = group
+			otherKeys[group] = append(otherKeys[group], key)
+		}
+	}
+	return otherKeys, true
+}
+
+func isAccumulatorKey(key common.Bytes) bool {
+	for _, accumulatorKey := range accumulatorKeys {
+		if bytes.Equal(key, accumulatorKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeAccumulators applies the changes the group made to the accumulator keys, relative to their values
+// in the view before the merge. The keys the group did not write are left as is, so that the merged view
+// matches the serial execution key by key.
+func mergeAccumulators(view *st.StoreView, group *txGroup, supply *types.Coins, burnedFees, undistributedFees types.Coins) {
+	writes := group.recorder.AccessList().Writes
+	if containsKey(writes, st.TotalSupplyKey()) && supply != nil {
+		if groupSupply := group.view.GetTotalSupply(); groupSupply != nil {
+			view.DecreaseTotalSupply(supply.Minus(*groupSupply))
+		}
+	}
+	if containsKey(writes, st.BurnedFeesKey()) {
+		view.AddBurnedFees(group.view.GetBurnedFees().Minus(burnedFees))
+	}
+	if containsKey(writes, st.UndistributedFeesKey()) {
+		view.AddUndistributedFees(group.view.GetUndistributedFees().Minus(undistributedFees))
+	}
+}
+
+func containsKey(keys []common.Bytes, key common.Bytes) bool {
+	for _, k := range keys {
+		if bytes.Equal(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// groupTxsByAccounts groups the txs into the connected components of the accounts they touch
+func groupTxsByAccounts(txs []types.Tx) []*txGroup {
+	parent := make([]int, len(txs))
+	var find func(i int) int
+	find = func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+
+	owners := make(map[common.Address]int) // account -> index of a tx touching it
+	for idx, tx := range txs {
+		parent[idx] = idx
+		for _, address := range getTxAccounts(tx) {
+			if owner, ok := owners[address]; ok {
+				parent[find(idx)] = find(owner)
+			} else {
+				owners[address] = idx
+			}
+		}
+	}
+
+	groups := []*txGroup{}
+	groupOf := make(map[int]*txGroup)
+	for idx := range txs {
+		root := find(idx)
+		group, ok := groupOf[root]
+		if !ok {
+			group = &txGroup{}
+			groupOf[root] = group
+			groups = append(groups, group)
+		}
+		group.indices = append(group.indices, idx)
+	}
+
+	for address, owner := range owners {
+		group := groupOf[find(owner)]
+		group.accounts = append(group.accounts, address)
+	}
+	return groups
+}
+
+// getTxAccounts returns the accounts read or written by the tx, or nil if they can not be determined
+// without executing the tx
+func getTxAccounts(tx types.Tx) []common.Address {
+	sendTx, ok := tx.(*types.SendTx)
+	if !ok {
+		return nil
+	}
+	accounts := []common.Address{}
+	for _, input := range sendTx.PayingInputs() {
+		accounts = append(accounts, input.Address)
+	}
+	for _, output := range sendTx.Outputs {
+		accounts = append(accounts, output.Address)
+	}
+	return accounts
+}
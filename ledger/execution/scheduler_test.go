@@ -0,0 +1,367 @@
+package execution
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/crypto"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+func TestTxSchedulerMatchesSerialExecution(t *testing.T) {
+	t.Run("fees burned", func(t *testing.T) {
+		testTxSchedulerMatchesSerialExecution(t, 1e2, false)
+	})
+	// The fees also update the total supply, the burned fees and the undistributed fees, which every group writes
+	t.Run("fees distributed", func(t *testing.T) {
+		testTxSchedulerMatchesSerialExecution(t, common.HeightEnableFeeDistribution, true)
+	})
+}
+
+func testTxSchedulerMatchesSerialExecution(t *testing.T, height uint64, trackSupply bool) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	et := NewExecTest()
+	accs := makeSchedulerTestAccounts(et, 24)
+	if trackSupply {
+		et.state().Delivered().UpdateTotalSupply(types.NewCoins(1e18, 1e18))
+		et.state().Delivered().UpdateFeePolicy(&types.FeePolicy{BurnPercentage: 30})
+	}
+	et.fastforwardTo(height)
+
+	rnd := rand.New(rand.NewSource(1))
+	sequences := make(map[common.Address]uint64)
+	numFailedBlocks := 0
+	for round := 0; round < 60; round++ {
+		blockSequences := make(map[common.Address]uint64)
+		for address, seq := range sequences {
+			blockSequences[address] = seq
+		}
+
+		numTxs := 10 + rnd.Intn(60)
+		invalidTxIndex := -1 // the tx with an invalid sequence, failing the block
+		if rnd.Intn(4) == 0 {
+			invalidTxIndex = rnd.Intn(numTxs)
+		}
+		txs := []types.Tx{}
+		for i := 0; i < numTxs; i++ {
+			sender := accs[rnd.Intn(len(accs))]
+			blockSequences[sender.Address]++
+			seq := blockSequences[sender.Address]
+
+			switch {
+			case i == invalidTxIndex:
+				txs = append(txs, makeSchedulerTestSendTx(et, sender, seq+1, makeSchedulerTestRecipient(rnd, accs, sender)))
+			case rnd.Intn(20) == 0: // not analyzable, executed serially
+				txs = append(txs, makeSchedulerTestReserveFundTx(et, sender, seq, fmt.Sprintf("rid_%v_%v", round, i)))
+			default:
+				txs = append(txs, makeSchedulerTestSendTx(et, sender, seq, makeSchedulerTestRecipient(rnd, accs, sender)))
+			}
+		}
+
+		serialView, err := et.state().Delivered().Copy()
+		require.Nil(err)
+		parallelView, err := et.state().Delivered().Copy()
+		require.Nil(err)
+
+		serialResults := NewTxScheduler(et.executor, 1).ExecuteTxs(txs, serialView)
+		parallelResults := NewTxScheduler(et.executor, 4).ExecuteTxs(txs, parallelView)
+
+		require.Equal(len(serialResults), len(parallelResults), "round %v", round)
+		for i := range serialResults {
+			assert.Equal(serialResults[i].Code, parallelResults[i].Code, "round %v, tx %v", round, i)
+			assert.Equal(serialResults[i].Message, parallelResults[i].Message, "round %v, tx %v", round, i)
+		}
+
+		if len(serialResults) < len(txs) || serialResults[len(serialResults)-1].IsError() {
+			numFailedBlocks++
+			continue
+		}
+		require.Equal(serialView.Hash(), parallelView.Hash(), "round %v", round)
+		if trackSupply {
+			require.Equal(*serialView.GetTotalSupply(), *parallelView.GetTotalSupply(), "round %v", round)
+			require.Equal(serialView.GetUndistributedFees(), parallelView.GetUndistributedFees(), "round %v", round)
+		}
+
+		et.state().CommitView(parallelView)
+		sequences = blockSequences
+	}
+
+	assert.True(numFailedBlocks > 0)
+	assert.True(numFailedBlocks < 60)
+}
+
+func TestTxSchedulerDistributesFees(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	et := NewExecTest()
+	accs := makeSchedulerTestAccounts(et, 32)
+	initSupply := types.NewCoins(1e18, 1e18)
+	feePolicy := &types.FeePolicy{BurnPercentage: 30}
+	et.state().Delivered().UpdateTotalSupply(initSupply)
+	et.state().Delivered().UpdateFeePolicy(feePolicy)
+	et.fastforwardTo(common.HeightEnableFeeDistribution)
+
+	// The independent txs, each in a group of its own, all executed in parallel
+	txs := []types.Tx{}
+	for i := 0; i < len(accs); i += 2 {
+		txs = append(txs, makeSchedulerTestSendTx(et, accs[i], 1, accs[i+1].Address))
+	}
+	require.Equal(len(txs), len(groupTxsByAccounts(txs)))
+
+	view, err := et.state().Delivered().Copy()
+	require.Nil(err)
+	results := NewTxScheduler(et.executor, 4).ExecuteTxs(txs, view)
+	require.Equal(len(txs), len(results))
+	for _, res := range results {
+		require.True(res.IsOK(), res.Message)
+	}
+
+	burned, distributed := feePolicy.Split(types.NewCoins(0, getMinimumTxFee()))
+	totalBurned, totalDistributed := types.NewCoins(0, 0), types.NewCoins(0, 0)
+	for range txs {
+		totalBurned = totalBurned.Plus(burned)
+		totalDistributed = totalDistributed.Plus(distributed)
+	}
+	assert.True(totalBurned.IsPositive())
+	assert.True(totalDistributed.IsPositive())
+	assert.True(totalBurned.IsEqual(view.GetBurnedFees()), "%v vs %v", totalBurned, view.GetBurnedFees())
+	assert.True(totalDistributed.IsEqual(view.GetUndistributedFees()), "%v vs %v", totalDistributed, view.GetUndistributedFees())
+	assert.True(initSupply.Minus(totalBurned).IsEqual(*view.GetTotalSupply()))
+}
+
+func TestGroupTxsByAccounts(t *testing.T) {
+	assert := assert.New(t)
+
+	et := NewExecTest()
+	accs := makeSchedulerTestAccounts(et, 6)
+
+	txs := []types.Tx{
+		makeSchedulerTestSendTx(et, accs[0], 1, accs[1].Address),
+		makeSchedulerTestSendTx(et, accs[2], 1, accs[3].Address),
+		makeSchedulerTestSendTx(et, accs[1], 1, accs[4].Address),
+		makeSchedulerTestSendTx(et, accs[5], 1, accs[0].Address),
+	}
+	groups := groupTxsByAccounts(txs)
+
+	assert.Equal(2, len(groups))
+	assert.Equal([]int{0, 2, 3}, groups[0].indices)
+	assert.Equal(4, len(groups[0].accounts))
+	assert.Equal([]int{1}, groups[1].indices)
+	assert.Equal(2, len(groups[1].accounts))
+}
+
+func BenchmarkTxSchedulerIndependentSendTxs(b *testing.B) {
+	for _, numWorkers := range []int{1, 0} {
+		b.Run(fmt.Sprintf("workers=%v", numWorkers), func(b *testing.B) {
+			et := NewExecTest()
+			accs := makeSchedulerTestAccounts(et, 400)
+			et.fastforwardTo(1e2)
+
+			txs := []types.Tx{}
+			for i := 0; i < len(accs); i += 2 {
+				txs = append(txs, makeSchedulerTestSendTx(et, accs[i], 1, accs[i+1].Address))
+			}
+			scheduler := NewTxScheduler(et.executor, numWorkers)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				view, err := et.state().Delivered().Copy()
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				results := scheduler.ExecuteTxs(txs, view)
+				if len(results) != len(txs) || results[len(results)-1].IsError() {
+					b.Fatal("unexpected tx failure")
+				}
+				view.Hash()
+			}
+		})
+	}
+}
+
+func TestTxSchedulerPrefetchesSignatures(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	defer func(cache *crypto.SignatureCache) { signatureCache = cache }(signatureCache)
+	signatureCache = crypto.NewSignatureCache(crypto.DefaultSignatureCacheSize)
+
+	et := NewExecTest()
+	accs := makeSchedulerTestAccounts(et, 12)
+	et.fastforwardTo(1e2)
+
+	txs := []types.Tx{}
+	for i := 0; i < len(accs); i += 2 {
+		txs = append(txs, makeSchedulerTestSendTx(et, accs[i], 1, accs[i+1].Address))
+	}
+	view, err := et.state().Delivered().Copy()
+	require.Nil(err)
+	results := NewTxScheduler(et.executor, 1).ExecuteTxs(txs, view)
+	require.Equal(len(txs), len(results))
+	for _, res := range results {
+		assert.True(res.IsOK(), res.Message)
+	}
+	assert.Equal(len(txs), signatureCache.Len())
+
+	// The signature recovers to another address, which is cached but still fails the tx
+	invalidTx := makeSchedulerTestSendTx(et, accs[1], 1, accs[0].Address)
+	invalidTx.Inputs[0].Address = accs[3].Address
+	view, err = et.state().Delivered().Copy()
+	require.Nil(err)
+	results = NewTxScheduler(et.executor, 1).ExecuteTxs([]types.Tx{txs[0], invalidTx}, view)
+	require.Equal(2, len(results))
+	assert.True(results[0].IsOK(), results[0].Message)
+	assert.Equal(result.CodeInvalidSignature, results[1].Code)
+}
+
+func BenchmarkTxSchedulerBlockSendTxSignatures(b *testing.B) {
+	for _, warm := range []bool{false, true} {
+		b.Run(fmt.Sprintf("warm=%v", warm), func(b *testing.B) {
+			defer func(cache *crypto.SignatureCache) { signatureCache = cache }(signatureCache)
+
+			et := NewExecTest()
+			accs := makeSchedulerTestAccounts(et, 2000)
+			et.fastforwardTo(1e2)
+
+			txs := []types.Tx{}
+			for i := 0; i < len(accs); i += 2 {
+				txs = append(txs, makeSchedulerTestSendTx(et, accs[i], 1, accs[i+1].Address))
+			}
+			scheduler := NewTxScheduler(et.executor, 1)
+
+			// The warm cache holds the signatures verified when the txs were screened by the mempool
+			signatureCache = crypto.NewSignatureCache(crypto.DefaultSignatureCacheSize)
+			prefetchTxSignatures(et.chainID, txs)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				if !warm {
+					signatureCache = crypto.NewSignatureCache(crypto.DefaultSignatureCacheSize)
+				}
+				view, err := et.state().Delivered().Copy()
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				results := scheduler.ExecuteTxs(txs, view)
+				if len(results) != len(txs) || results[len(results)-1].IsError() {
+					b.Fatal("unexpected tx failure")
+				}
+			}
+		})
+	}
+}
+
+func TestTxSchedulerAccessLists(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	et := NewExecTest()
+	accs := makeSchedulerTestAccounts(et, 4)
+	et.fastforwardTo(1e2)
+
+	txs := []types.Tx{
+		makeSchedulerTestSendTx(et, accs[0], 1, accs[1].Address),
+		makeSchedulerTestSendTx(et, accs[2], 1, accs[3].Address),
+		makeSchedulerTestSendTx(et, accs[0], 3, accs[1].Address), // invalid sequence
+		makeSchedulerTestSendTx(et, accs[2], 2, accs[3].Address),
+	}
+	view, err := et.state().Delivered().Copy()
+	require.Nil(err)
+	results, accessLists := NewTxScheduler(et.executor, 4).ExecuteTxsWithAccessLists(txs, view)
+	require.Equal(3, len(results))
+	require.Equal(3, len(accessLists))
+	assert.True(results[1].IsOK(), results[1].Message)
+	assert.True(results[2].IsError())
+
+	// The keys written by each send tx are the ones of its declared accounts
+	for i, accessList := range accessLists[:2] {
+		declared := []common.Bytes{}
+		for _, address := range getTxAccounts(txs[i]) {
+			declared = append(declared, st.AccountKey(address))
+		}
+		assert.ElementsMatch(declared, accessList.Writes)
+		for _, key := range declared {
+			assert.Contains(accessList.Reads, key)
+		}
+	}
+	assert.Equal(0, len(accessLists[2].Writes))
+}
+
+func makeSchedulerTestAccounts(et *execTest, numAccounts int) []types.PrivAccount {
+	accs := []types.PrivAccount{}
+	for i := 0; i < numAccounts; i++ {
+		accs = append(accs, types.MakeAccWithInitBalance(fmt.Sprintf("scheduler_%v", i),
+			types.NewCoins(1e15, 100000*getMinimumTxFee())))
+	}
+	et.acc2State(accs...)
+	return accs
+}
+
+// makeSchedulerTestRecipient returns either an existing account other than the sender, or a new one
+func makeSchedulerTestRecipient(rnd *rand.Rand, accs []types.PrivAccount, sender types.PrivAccount) common.Address {
+	if rnd.Intn(10) == 0 {
+		return common.BytesToAddress([]byte(fmt.Sprintf("new_account_%v", rnd.Int63())))
+	}
+	for {
+		recipient := accs[rnd.Intn(len(accs))]
+		if recipient.Address != sender.Address {
+			return recipient.Address
+		}
+	}
+}
+
+func makeSchedulerTestSendTx(et *execTest, sender types.PrivAccount, seq uint64, recipient common.Address) *types.SendTx {
+	fee := types.NewCoins(0, getMinimumTxFee())
+	coins := types.NewCoins(10, 0)
+	tx := &types.SendTx{
+		Fee: fee,
+		Inputs: []types.TxInput{
+			{
+				Address:  sender.Address,
+				Coins:    coins.Plus(fee),
+				Sequence: seq,
+			},
+		},
+		Outputs: []types.TxOutput{
+			{
+				Address: recipient,
+				Coins:   coins,
+			},
+		},
+	}
+	et.signSendTx(tx, sender)
+	return tx
+}
+
+func makeSchedulerTestReserveFundTx(et *execTest, source types.PrivAccount, seq uint64, resourceID string) *types.ReserveFundTx {
+	txFee := getMinimumTxFee()
+	tx := &types.ReserveFundTx{
+		Fee: types.NewCoins(0, txFee),
+		Source: types.TxInput{
+			Address:  source.Address,
+			Coins:    types.Coins{TFuelWei: big.NewInt(10 * txFee), ThetaWei: big.NewInt(0)},
+			Sequence: seq,
+		},
+		Collateral:  types.Coins{TFuelWei: big.NewInt(11 * txFee), ThetaWei: big.NewInt(0)},
+		ResourceIDs: []string{resourceID},
+		Duration:    1000,
+	}
+	tx.Source.Signature = source.Sign(tx.SignBytes(et.chainID))
+	return tx
+}
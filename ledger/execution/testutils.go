@@ -103,6 +103,7 @@ func (et *execTest) reset() {
 	db := backend.NewMemDatabase()
 	ledgerState := st.NewLedgerState(chainID, db)
 	ledgerState.ResetState(initHeight, initRootHash)
+	LowerDustThresholds(ledgerState.Delivered(), ledgerState.Checked(), ledgerState.Screened())
 
 	consensus := NewTestConsensusEngine("localseed")
 
@@ -136,6 +137,18 @@ func (et *execTest) fastforwardTo(targetHeight uint64) bool {
 	return true
 }
 
+// fastforwardToForks fast-forwards to the highest of the given fork heights, so that the features enabled
+// by the forks are all in effect
+func (et *execTest) fastforwardToForks(forkHeights ...uint64) bool {
+	targetHeight := uint64(0)
+	for _, forkHeight := range forkHeights {
+		if forkHeight > targetHeight {
+			targetHeight = forkHeight
+		}
+	}
+	return et.fastforwardTo(targetHeight)
+}
+
 func (et *execTest) signSendTx(tx *types.SendTx, accsIn ...types.PrivAccount) {
 	types.SignSendTx(et.chainID, tx, accsIn...)
 }
@@ -183,6 +196,23 @@ func (et *execTest) SetAcc(accs ...types.PrivAccount) {
 	et.acc2State(accs...)
 }
 
+// LowerDustThresholds lowers the dust thresholds and the minimum new account amount to a single wei in the
+// given views, since the test fixtures move a few wei around. The zero outputs are still rejected.
+func LowerDustThresholds(views ...*st.StoreView) {
+	for _, view := range views {
+		view.UpdateDustThreshold(types.NewCoins(1, 1))
+		view.UpdateMinNewAccountAmount(types.NewCoins(1, 1))
+	}
+}
+
+// SetMaxCoinbaseOutputsSize overrides the cap on the encoded outputs of a coinbase transaction, and returns the
+// function restoring it
+func SetMaxCoinbaseOutputsSize(size uint64) (restore func()) {
+	saved := maxCoinbaseOutputsSize
+	maxCoinbaseOutputsSize = size
+	return func() { maxCoinbaseOutputsSize = saved }
+}
+
 func getMinimumTxFee() int64 {
 	return int64(types.MinimumTransactionFeeTFuelWei)
 }
@@ -221,6 +251,12 @@ func createServicePaymentTx(chainID string, source, target *types.PrivAccount, a
 }
 
 func setupForServicePayment(ast *assert.Assertions) (et *execTest, resourceID string,
+	alice, bob, carol types.PrivAccount, aliceInitBalance, bobInitBalance, carolInitBalance types.Coins) {
+	return setupForServicePaymentAt(ast, 1e2)
+}
+
+// setupForServicePaymentAt is setupForServicePayment with the fund reserved in the block above the given height
+func setupForServicePaymentAt(ast *assert.Assertions, height uint64) (et *execTest, resourceID string,
 	alice, bob, carol types.PrivAccount, aliceInitBalance, bobInitBalance, carolInitBalance types.Coins) {
 	et = NewExecTest()
 
@@ -242,7 +278,7 @@ func setupForServicePayment(ast *assert.Assertions) (et *execTest, resourceID st
 	et.acc2State(carol)
 	log.Infof("Carol's Address: %v", carol.Address.Hex())
 
-	et.fastforwardTo(1e2)
+	et.fastforwardTo(height)
 
 	resourceID = "rid001"
 	reserveFundTx := &types.ReserveFundTx{
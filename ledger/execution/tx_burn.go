@@ -0,0 +1,106 @@
+package execution
+
+import (
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+var _ TxExecutor = (*BurnTxExecutor)(nil)
+
+// ------------------------------- Burn Transaction -----------------------------------
+
+// BurnTxExecutor implements the TxExecutor interface
+type BurnTxExecutor struct {
+}
+
+// NewBurnTxExecutor creates a new instance of BurnTxExecutor
+func NewBurnTxExecutor() *BurnTxExecutor {
+	return &BurnTxExecutor{}
+}
+
+func (exec *BurnTxExecutor) sanityCheck(chainID string, view *st.StoreView, transaction types.Tx) result.Result {
+	tx := transaction.(*types.BurnTx)
+
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight < common.HeightEnableBurn {
+		return result.Error("The coin burns are not enabled until height %v", common.HeightEnableBurn).
+			WithErrorCode(result.CodeBurnNotEnabled)
+	}
+
+	res := tx.Source.ValidateBasic()
+	if res.IsError() {
+		return res
+	}
+
+	if !tx.Source.Coins.IsPositive() {
+		return result.Error("Nothing to burn: %v", tx.Source.Coins).WithErrorCode(result.CodeInvalidCoins)
+	}
+
+	sourceAccount, res := getInput(view, tx.Source)
+	if res.IsError() {
+		return res
+	}
+
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(sourceAccount, signTargets, tx.Source)
+	if res.IsError() {
+		return res
+	}
+
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
+	}
+
+	minimalBalance := tx.Source.Coins.Plus(tx.Fee)
+	if !sourceAccount.Balance.IsGTE(minimalBalance) {
+		return result.Error("Insufficient fund: balance is %v, tried to burn %v with fee %v",
+			sourceAccount.Balance, tx.Source.Coins, tx.Fee).WithErrorCode(result.CodeInsufficientFund)
+	}
+
+	return result.OK
+}
+
+func (exec *BurnTxExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
+	tx := transaction.(*types.BurnTx)
+
+	sourceAccount, res := getInput(view, tx.Source)
+	if res.IsError() {
+		return common.Hash{}, res
+	}
+
+	if !chargeFee(view, sourceAccount, tx.Fee) {
+		return common.Hash{}, result.Error("Failed to charge transaction fee")
+	}
+
+	sourceAccount.Balance = sourceAccount.Balance.Minus(tx.Source.Coins)
+	view.DecreaseTotalSupply(tx.Source.Coins)
+
+	sourceAccount.Sequence++
+	view.SetAccount(tx.Source.Address, sourceAccount)
+
+	txHash := types.TxID(chainID, tx)
+	return txHash, result.OK
+}
+
+func (exec *BurnTxExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
+	tx := transaction.(*types.BurnTx)
+	return &core.TxInfo{
+		Address:           tx.Source.Address,
+		Sequence:          tx.Source.Sequence,
+		EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction),
+	}
+}
+
+func (exec *BurnTxExecutor) calculateEffectiveGasPrice(transaction types.Tx) *big.Int {
+	tx := transaction.(*types.BurnTx)
+	fee := tx.Fee
+	gas := new(big.Int).SetUint64(types.GasBurnTx)
+	effectiveGasPrice := new(big.Int).Div(fee.TFuelWei, gas)
+	return effectiveGasPrice
+}
@@ -0,0 +1,144 @@
+package execution
+
+import (
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+var _ TxExecutor = (*CancelWithdrawExecutor)(nil)
+
+// ------------------------------- CancelWithdraw Transaction -----------------------------------
+
+// CancelWithdrawExecutor implements the TxExecutor interface
+type CancelWithdrawExecutor struct {
+}
+
+// NewCancelWithdrawExecutor creates a new instance of CancelWithdrawExecutor
+func NewCancelWithdrawExecutor() *CancelWithdrawExecutor {
+	return &CancelWithdrawExecutor{}
+}
+
+func (exec *CancelWithdrawExecutor) sanityCheck(chainID string, view *st.StoreView, transaction types.Tx) result.Result {
+	tx := transaction.(*types.CancelWithdrawTx)
+
+	res := tx.Source.ValidateBasic()
+	if res.IsError() {
+		return res
+	}
+
+	sourceAccount, success := getInput(view, tx.Source)
+	if success.IsError() {
+		return result.Error("Failed to get the source account: %v", tx.Source.Address).WithErrorCode(result.CodeUnknownAccount)
+	}
+
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(sourceAccount, signTargets, tx.Source)
+	if res.IsError() {
+		logger.Warnf("validateSourceAdvanced failed on %v: %v", tx.Source.Address.Hex(), res)
+		return res
+	}
+
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
+	}
+
+	minimalBalance := tx.Fee
+	if !sourceAccount.Balance.IsGTE(minimalBalance) {
+		return result.Error("CancelWithdraw: Source balance is %v, but required minimal balance is %v",
+			sourceAccount.Balance, minimalBalance).WithErrorCode(result.CodeInsufficientFund)
+	}
+
+	// The latest withdrawal is cancelled, the earlier ones stay queued for return
+	vcp := view.GetValidatorCandidatePool()
+	if vcp.FindStake(tx.Source.Address, tx.Holder.Address) == nil {
+		return result.Error("No stake deposited by %v to %v", tx.Source.Address.Hex(), tx.Holder.Address.Hex()).
+			WithErrorCode(result.CodeStakeNotFound)
+	}
+	stake := vcp.FindLatestWithdrawnStake(tx.Source.Address, tx.Holder.Address)
+	if stake == nil {
+		return result.Error("The stake is not withdrawn").WithErrorCode(result.CodeStakeNotWithdrawn)
+	}
+
+	// The stake is returned at the end of the first block whose parent is at or above the return height
+	currentHeight := view.Height()
+	if stake.ReturnHeight <= currentHeight {
+		return result.Error("The stake is returned in this block, its return height is %v", stake.ReturnHeight).
+			WithErrorCode(result.CodeStakeReturnDue)
+	}
+
+	// The withdrawal forced by a double signing slash stands
+	slashHeight := view.GetStakeHolderSlashHeight(tx.Holder.Address)
+	slashReturnHeight := view.GetStakeHolderSlashReturnHeight(tx.Holder.Address)
+	if slashReturnHeight == 0 {
+		slashReturnHeight = slashHeight + core.ReturnLockingPeriod
+	}
+	if slashHeight != 0 && stake.ReturnHeight <= slashReturnHeight {
+		return result.Error("The stake was slashed at height %v", slashHeight).WithErrorCode(result.CodeStakeSlashed)
+	}
+
+	// So do the withdrawals forced by the holder
+	if stake.ReturnHeight <= view.GetStakeEjectionReturnHeight(tx.Holder.Address, tx.Source.Address) {
+		return result.Error("The stake was ejected by %v", tx.Holder.Address.Hex()).WithErrorCode(result.CodeStakeEjected)
+	}
+
+	return result.OK
+}
+
+func (exec *CancelWithdrawExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
+	tx := transaction.(*types.CancelWithdrawTx)
+
+	sourceAccount, success := getInput(view, tx.Source)
+	if success.IsError() {
+		return common.Hash{}, result.Error("Failed to get the source account")
+	}
+
+	if !chargeFee(view, sourceAccount, tx.Fee) {
+		return common.Hash{}, result.Error("Failed to charge transaction fee")
+	}
+
+	// The stake is active again and no longer pending return, so it is not returned to the source later
+	vcp := view.GetValidatorCandidatePool()
+	cancelledReturnHeight := vcp.FindLatestWithdrawnStake(tx.Source.Address, tx.Holder.Address).ReturnHeight
+	err := vcp.CancelWithdrawal(tx.Source.Address, tx.Holder.Address, view.Height())
+	if err != nil {
+		return common.Hash{}, result.Error("Failed to cancel the withdrawal, err: %v", err).WithErrorCode(result.CodeStakeNotWithdrawn)
+	}
+	view.UpdateValidatorCandidatePool(vcp)
+
+	// The return address stays for another withdrawal of the pair due at the same height, if any
+	if latest := vcp.FindLatestWithdrawnStake(tx.Source.Address, tx.Holder.Address); latest == nil ||
+		latest.ReturnHeight != cancelledReturnHeight {
+		view.DeleteStakeReturnAddress(core.StakeForValidator, tx.Holder.Address, tx.Source.Address, cancelledReturnHeight)
+	}
+
+	effectiveHeight := recordStakeTransaction(view)
+
+	sourceAccount.Sequence++
+	view.SetAccount(tx.Source.Address, sourceAccount)
+
+	txHash := types.TxID(chainID, tx)
+	return txHash, result.OKWith(result.Info{"validatorSetEffectiveHeight": effectiveHeight})
+}
+
+func (exec *CancelWithdrawExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
+	tx := transaction.(*types.CancelWithdrawTx)
+	return &core.TxInfo{
+		Address:           tx.Source.Address,
+		Sequence:          tx.Source.Sequence,
+		EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction),
+	}
+}
+
+func (exec *CancelWithdrawExecutor) calculateEffectiveGasPrice(transaction types.Tx) *big.Int {
+	tx := transaction.(*types.CancelWithdrawTx)
+	fee := tx.Fee
+	gas := new(big.Int).SetUint64(types.GasCancelWithdrawTx)
+	effectiveGasPrice := new(big.Int).Div(fee.TFuelWei, gas)
+	return effectiveGasPrice
+}
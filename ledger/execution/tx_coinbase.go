@@ -1,9 +1,11 @@
 package execution
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
 	"math/big"
+	"sort"
 
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/common/result"
@@ -16,23 +18,42 @@ var weiMultiplier = big.NewInt(1e18)
 var tfuelRewardPerBlock = big.NewInt(1).Mul(big.NewInt(48), weiMultiplier) // 48 TFUEL per block, corresponds to about 5% *initial* annual inflation rate. The inflation rate naturally approaches 0 as the chain grows.
 var checkpointInterval = int64(100)                                        // TODO: use the guarding checkpoint
 
+// maxCoinbaseOutputsSize caps the encoded outputs of a coinbase transaction, see CoinbaseOutputs
+var maxCoinbaseOutputsSize = types.MaxCoinbaseOutputsSize
+
+// withheldRewardAddress takes the share of the reward withheld when the reward is divided, it is not granted
+var withheldRewardAddress = common.Address{}
+
 var _ TxExecutor = (*CoinbaseTxExecutor)(nil)
 
+// RewardSchedule returns the total TFuel reward (in wei) granted at the given checkpoint block, which is divided
+// among the stake sources of the validators proportional to their stakes, after the commissions of the validators
+// starting from common.HeightEnableStakeCommission. Starting from common.HeightEnableGuardianStaking, the guardian
+// stakes take their share of the reward too, see grantGuardianReward. A nil or zero reward grants nothing.
+type RewardSchedule func(blockHeight uint64, epoch uint64, validatorSet *core.ValidatorSet) *big.Int
+
+// DefaultRewardSchedule grants the fixed reward per block for all the blocks of the checkpoint interval
+func DefaultRewardSchedule(blockHeight uint64, epoch uint64, validatorSet *core.ValidatorSet) *big.Int {
+	return big.NewInt(1).Mul(tfuelRewardPerBlock, big.NewInt(checkpointInterval))
+}
+
 // ------------------------------- Coinbase Transaction -----------------------------------
 
 // CoinbaseTxExecutor implements the TxExecutor interface
 type CoinbaseTxExecutor struct {
-	state     *st.LedgerState
-	consensus core.ConsensusEngine
-	valMgr    core.ValidatorManager
+	state          *st.LedgerState
+	consensus      core.ConsensusEngine
+	valMgr         core.ValidatorManager
+	rewardSchedule RewardSchedule
 }
 
 // NewCoinbaseTxExecutor creates a new instance of CoinbaseTxExecutor
-func NewCoinbaseTxExecutor(state *st.LedgerState, consensus core.ConsensusEngine, valMgr core.ValidatorManager) *CoinbaseTxExecutor {
+func NewCoinbaseTxExecutor(state *st.LedgerState, consensus core.ConsensusEngine, valMgr core.ValidatorManager, rewardSchedule RewardSchedule) *CoinbaseTxExecutor {
 	return &CoinbaseTxExecutor{
-		state:     state,
-		consensus: consensus,
-		valMgr:    valMgr,
+		state:          state,
+		consensus:      consensus,
+		valMgr:         valMgr,
+		rewardSchedule: rewardSchedule,
 	}
 }
 
@@ -58,6 +79,17 @@ func (exec *CoinbaseTxExecutor) sanityCheck(chainID string, view *st.StoreView,
 		return res
 	}
 
+	// verify the proposer is the one selected for the block, see consensus.SelectProposer
+	currentBlock := exec.consensus.GetLedger().GetCurrentBlock()
+	if currentBlock.Height >= common.HeightEnableVerifiableProposer {
+		proposer := exec.valMgr.GetNextProposer(currentBlock.Parent, currentBlock.Epoch)
+		if tx.Proposer.Address != proposer.Address {
+			return result.Error("Unexpected proposer %v, the proposer for height %v and epoch %v is %v",
+				tx.Proposer.Address.Hex(), currentBlock.Height, currentBlock.Epoch, proposer.Address.Hex()).
+				WithErrorCode(result.CodeUnexpectedProposer)
+		}
+	}
+
 	proposerAccount, res := getOrMakeInput(view, tx.Proposer)
 	if res.IsError() {
 		return res
@@ -66,7 +98,7 @@ func (exec *CoinbaseTxExecutor) sanityCheck(chainID string, view *st.StoreView,
 	// verify the proposer's signature
 	signBytes := tx.SignBytes(chainID)
 	if !tx.Proposer.Signature.Verify(signBytes, proposerAccount.Address) {
-		return result.Error("SignBytes: %X", signBytes)
+		return result.Error("SignBytes: %X", signBytes).WithErrorCode(result.CodeInvalidSignature)
 	}
 
 	outputAccounts := map[string]*types.Account{}
@@ -80,8 +112,25 @@ func (exec *CoinbaseTxExecutor) sanityCheck(chainID string, view *st.StoreView,
 			tx.BlockHeight, exec.state.Height())
 	}
 
-	// check the reward amount
-	expectedRewards := CalculateReward(view, validatorSet)
+	// check the reward amount, with the same reward schedule used by the proposer, which includes the fees
+	// claimed by the proposer
+	epoch := exec.consensus.GetLedger().GetCurrentBlock().Epoch
+	if view.Height()+1 >= common.HeightEnableCoinbaseBatching { // view points to the parent block
+		// The outputs are in the canonical order, so they are compared with the expected ones in a single pass
+		expectedOutputs, _ := CoinbaseOutputs(view, validatorSet, epoch, tx.Proposer.Address, exec.rewardSchedule)
+		if len(expectedOutputs) != len(tx.Outputs) {
+			return result.Error("Number of rewarded account is incorrect")
+		}
+		for i, output := range tx.Outputs {
+			exp := expectedOutputs[i]
+			if output.Address != exp.Address || !exp.Coins.IsEqual(output.Coins) {
+				return result.Error("Invalid rewards, output #%v expecting %v for address %v, but is %v for address %v",
+					i, exp.Coins, exp.Address, output.Coins, output.Address)
+			}
+		}
+		return result.OK
+	}
+	expectedRewards := CalculateReward(view, validatorSet, epoch, tx.Proposer.Address, exec.rewardSchedule)
 	if len(expectedRewards) != len(tx.Outputs) {
 		return result.Error("Number of rewarded account is incorrect")
 	}
@@ -108,12 +157,59 @@ func (exec *CoinbaseTxExecutor) process(chainID string, view *st.StoreView, tran
 		return common.Hash{}, res
 	}
 
+	blockHeight := view.Height() + 1 // view points to the parent block
+	recordRewards := blockHeight >= common.HeightEnableRewardHistory
+	var epoch uint64
+	if recordRewards {
+		epoch = exec.consensus.GetLedger().GetCurrentBlock().Epoch
+	}
+
+	// The rewards carried over are calculated before the fees are claimed, since they include the fees
+	batching := blockHeight >= common.HeightEnableCoinbaseBatching
+	var carried, overflow []types.TxOutput
+	if batching {
+		validatorSet := getValidatorSet(exec.consensus.GetLedger(), exec.valMgr)
+		carried = view.GetCoinbaseOverflow()
+		_, overflow = CoinbaseOutputs(view, validatorSet, exec.consensus.GetLedger().GetCurrentBlock().Epoch,
+			tx.Proposer.Address, exec.rewardSchedule)
+	}
+
+	// The fees claimed by the proposer were never taken out of the total supply, see disposeFee
+	claimedFees := types.NewCoins(0, 0)
+	if blockHeight >= common.HeightEnableFeeDistribution {
+		claimedFees = view.GetUndistributedFees()
+		if !claimedFees.IsZero() {
+			view.ClearUndistributedFees()
+		}
+	}
+
+	issued := types.NewCoins(0, 0)
 	for _, output := range tx.Outputs {
 		addr := string(output.Address[:])
 		if account, exists := accounts[addr]; exists {
 			account.Balance = account.Balance.Plus(output.Coins)
 			view.SetAccount(output.Address, account)
 		}
+		issued = issued.Plus(output.Coins.NoNil())
+		if recordRewards && !output.Coins.IsZero() {
+			view.RecordReward(output.Address, epoch, output.Coins, core.RewardHistoryRetention)
+		}
+	}
+
+	// The rewards are issued by the block granting them, so the total supply includes the rewards carried over,
+	// which were issued by the earlier blocks
+	if batching {
+		issued = issued.Plus(sumOutputCoins(overflow)).Minus(sumOutputCoins(carried))
+		view.UpdateCoinbaseOverflow(overflow)
+	}
+	view.IncreaseTotalSupply(issued.Minus(claimedFees))
+
+	// The underfilled blocks are settled with the reward of the checkpoint, see grantStakerRewardWithCommission
+	if blockHeight >= common.HeightEnableRewardWithholding && common.IsCheckPointHeight(blockHeight) {
+		if tit := view.GetTxInclusionTracker(); len(tit.SortedUnderfilled) > 0 {
+			tit.ResetUnderfilledBlocks()
+			view.UpdateTxInclusionTracker(tit)
+		}
 	}
 
 	view.SetCoinbaseTransactionProcessed(true)
@@ -122,19 +218,128 @@ func (exec *CoinbaseTxExecutor) process(chainID string, view *st.StoreView, tran
 	return txHash, result.OK
 }
 
-// CalculateReward calculates the block reward for each account
-func CalculateReward(view *st.StoreView, validatorSet *core.ValidatorSet) map[string]types.Coins {
+// CalculateReward calculates the block reward for each account, according to the given reward schedule. Starting
+// from common.HeightEnableFeeDistribution, the proposer also claims the tx fees set aside for it, see disposeFee.
+func CalculateReward(view *st.StoreView, validatorSet *core.ValidatorSet, epoch uint64, proposer common.Address,
+	rewardSchedule RewardSchedule) map[string]types.Coins {
 	accountReward := map[string]types.Coins{}
 	blockHeight := view.Height() + 1 // view points to the parent block
 	if blockHeight < common.HeightEnableValidatorReward {
 		grantValidatorsWithZeroReward(validatorSet, &accountReward)
 	} else {
-		grantStakerReward(view, validatorSet, &accountReward, blockHeight)
+		grantStakerReward(view, validatorSet, &accountReward, blockHeight, epoch, rewardSchedule)
 	} // TODO: calculate reward for the guardian nodes' stakers
 
+	if blockHeight >= common.HeightEnableFeeDistribution {
+		grantProposerFees(view, proposer, &accountReward)
+	}
+
 	return accountReward
 }
 
+// CoinbaseOutputs returns the outputs of the coinbase transaction of the block, i.e. the rewards calculated by
+// CalculateReward, sorted by address. Starting from common.HeightEnableCoinbaseBatching, the rewards carried over
+// from the previous blocks are added, and the outputs are capped at maxCoinbaseOutputsSize encoded bytes: the
+// rewards carried over are paid first, then the others in address order, until one does not fit. The rewards
+// not paid are returned as the overflow, sorted by address, to be carried over to the next block.
+func CoinbaseOutputs(view *st.StoreView, validatorSet *core.ValidatorSet, epoch uint64, proposer common.Address,
+	rewardSchedule RewardSchedule) (outputs []types.TxOutput, overflow []types.TxOutput) {
+	accountReward := CalculateReward(view, validatorSet, epoch, proposer, rewardSchedule)
+	blockHeight := view.Height() + 1 // view points to the parent block
+	if blockHeight < common.HeightEnableCoinbaseBatching {
+		return sortRewardOutputs(accountReward), nil
+	}
+
+	carried := map[string]bool{}
+	for _, output := range view.GetCoinbaseOverflow() {
+		addr := string(output.Address[:])
+		reward := output.Coins.NoNil()
+		if existing, exists := accountReward[addr]; exists {
+			reward = existing.NoNil().Plus(reward)
+		}
+		accountReward[addr] = reward
+		carried[addr] = true
+	}
+	sorted := sortRewardOutputs(accountReward)
+
+	// The rewards carried over take precedence, so that they are not carried over again and again
+	paid := make([]bool, len(sorted))
+	remaining := maxCoinbaseOutputsSize
+	full := false
+	for _, carriedFirst := range []bool{true, false} {
+		for i := 0; i < len(sorted) && !full; i++ {
+			if carried[string(sorted[i].Address[:])] != carriedFirst {
+				continue
+			}
+			size := coinbaseOutputSize(&sorted[i])
+			if full = size > remaining; !full {
+				remaining -= size
+				paid[i] = true
+			}
+		}
+	}
+
+	outputs = make([]types.TxOutput, 0, len(sorted))
+	for i, output := range sorted {
+		if paid[i] {
+			outputs = append(outputs, output)
+		} else {
+			overflow = append(overflow, output)
+		}
+	}
+	if len(overflow) > 0 {
+		logger.Infof("Coinbase rewards carried over to the next block: %v accounts", len(overflow))
+	}
+	return outputs, overflow
+}
+
+// sortRewardOutputs turns the rewards into coinbase outputs, in the canonical order, i.e. sorted by address
+func sortRewardOutputs(accountReward map[string]types.Coins) []types.TxOutput {
+	outputs := make([]types.TxOutput, 0, len(accountReward))
+	for addr, reward := range accountReward {
+		output := types.TxOutput{Coins: reward}
+		copy(output.Address[:], addr)
+		outputs = append(outputs, output)
+	}
+	sort.Slice(outputs, func(i, j int) bool {
+		return bytes.Compare(outputs[i].Address[:], outputs[j].Address[:]) < 0
+	})
+	return outputs
+}
+
+// coinbaseOutputSize returns the size of the encoded output
+func coinbaseOutputSize(output *types.TxOutput) uint64 {
+	encoded, err := types.ToBytes(output)
+	if err != nil { // should not happen
+		panic(fmt.Sprintf("Failed to encode coinbase output %v: %v", output, err))
+	}
+	return uint64(len(encoded))
+}
+
+func sumOutputCoins(outputs []types.TxOutput) types.Coins {
+	sum := types.NewCoins(0, 0)
+	for _, output := range outputs {
+		sum = sum.Plus(output.Coins.NoNil())
+	}
+	return sum
+}
+
+// grantProposerFees adds the tx fees set aside since the previous coinbase transaction to the reward of the
+// proposer. Since the coinbase transaction is executed first, the fees of a block are claimed by the proposer
+// of the next block.
+func grantProposerFees(view *st.StoreView, proposer common.Address, accountReward *map[string]types.Coins) {
+	fees := view.GetUndistributedFees()
+	if fees.IsZero() {
+		return
+	}
+	if existing, exists := (*accountReward)[string(proposer[:])]; exists {
+		fees = existing.NoNil().Plus(fees)
+	}
+	(*accountReward)[string(proposer[:])] = fees
+
+	logger.Infof("Tx fees claimed by proposer %v : %v", hex.EncodeToString(proposer[:]), fees)
+}
+
 func grantValidatorsWithZeroReward(validatorSet *core.ValidatorSet, accountReward *map[string]types.Coins) {
 	// Initial Mainnet release should not reward the validators until the guardians ready to deploy
 	zeroReward := types.Coins{}.NoNil()
@@ -143,11 +348,28 @@ func grantValidatorsWithZeroReward(validatorSet *core.ValidatorSet, accountRewar
 	}
 }
 
-func grantStakerReward(view *st.StoreView, validatorSet *core.ValidatorSet, accountReward *map[string]types.Coins, blockHeight uint64) {
+func grantStakerReward(view *st.StoreView, validatorSet *core.ValidatorSet, accountReward *map[string]types.Coins, blockHeight uint64,
+	epoch uint64, rewardSchedule RewardSchedule) {
 	if !common.IsCheckPointHeight(blockHeight) {
 		return
 	}
 
+	totalReward := rewardSchedule(blockHeight, epoch, validatorSet)
+	if totalReward == nil || totalReward.Sign() <= 0 {
+		return
+	}
+
+	if blockHeight >= common.HeightEnableGuardianStaking {
+		guardianReward := guardianRewardShare(view, validatorSet, totalReward)
+		totalReward = new(big.Int).Sub(totalReward, guardianReward)
+		defer grantGuardianReward(view, accountReward, guardianReward) // adds to the validator stake rewards
+	}
+
+	if blockHeight >= common.HeightEnableStakeCommission {
+		grantStakerRewardWithCommission(view, validatorSet, accountReward, totalReward)
+		return
+	}
+
 	totalStake := validatorSet.TotalStake()
 	if totalStake.Cmp(big.NewInt(0)) != 0 {
 
@@ -179,7 +401,6 @@ func grantStakerReward(view *st.StoreView, validatorSet *core.ValidatorSet, acco
 		}
 
 		// the source of the stake divides the block reward proportional to their stake
-		totalReward := big.NewInt(1).Mul(tfuelRewardPerBlock, big.NewInt(checkpointInterval))
 		for stakeSourceAddr, stakeAmountSum := range stakeSourceMap {
 			tmp := big.NewInt(1).Mul(totalReward, stakeAmountSum)
 			rewardAmount := tmp.Div(tmp, totalStake)
@@ -195,6 +416,155 @@ func grantStakerReward(view *st.StoreView, validatorSet *core.ValidatorSet, acco
 	}
 }
 
+// grantStakerRewardWithCommission divides the reward among the validators proportional to their stakes. Each
+// validator takes its commission out of its share, and the rest is shared among the sources of the stakes it
+// holds, proportional to their stakes. Starting from common.HeightEnableRewardWithholding, the share of a validator
+// is reduced by the percentage withheld for the underfilled blocks it proposed since the last checkpoint, see
+// core.TxInclusionParams, and the reward withheld is not granted. The rewards and the reward withheld add up to
+// the total reward exactly.
+func grantStakerRewardWithCommission(view *st.StoreView, validatorSet *core.ValidatorSet, accountReward *map[string]types.Coins,
+	totalReward *big.Int) {
+	// The weights are in stake times percent times percent, the weights of a validator add up to 10000 times its
+	// stake, including the weight of its reward withheld
+	weights := map[common.Address]*big.Int{}
+	addWeight := func(address common.Address, stakeAmount *big.Int, percentage int64, keptPercentage int64) {
+		weight := new(big.Int).Mul(stakeAmount, big.NewInt(percentage*keptPercentage))
+		if weight.Sign() <= 0 {
+			return
+		}
+		if sum, exists := weights[address]; exists {
+			weight.Add(weight, sum)
+		}
+		weights[address] = weight
+	}
+
+	tit, tip := &core.TxInclusionTracker{}, &core.TxInclusionParams{}
+	if view.Height()+1 >= common.HeightEnableRewardWithholding { // view points to the parent block
+		tit, tip = view.GetTxInclusionTracker(), view.GetTxInclusionParams()
+	}
+
+	vcp := view.GetValidatorCandidatePool()
+	for _, v := range validatorSet.Validators() {
+		validatorAddr := v.Address
+		stakeDelegate := vcp.FindStakeDelegate(validatorAddr)
+		if stakeDelegate == nil { // should not happen
+			panic(fmt.Sprintf("Failed to find stake delegate in the VCP: %v", hex.EncodeToString(validatorAddr[:])))
+		}
+
+		withheld := int64(tit.WithheldPercent(validatorAddr, tip))
+		if withheld > 0 {
+			addWeight(withheldRewardAddress, stakeDelegate.TotalStake(), 100, withheld)
+			logger.Infof("Block reward withheld for validator %v : %v%%", hex.EncodeToString(validatorAddr[:]), withheld)
+		}
+
+		commission := int64(view.GetStakeCommission(validatorAddr))
+		addWeight(validatorAddr, stakeDelegate.TotalStake(), commission, 100-withheld)
+		for _, stake := range stakeDelegate.Stakes {
+			if stake.Withdrawn {
+				continue
+			}
+			addWeight(stake.Source, stake.Amount, 100-commission, 100-withheld)
+		}
+	}
+
+	shares := divideProportionally(totalReward, weights)
+	delete(shares, withheldRewardAddress)
+	for addr, rewardAmount := range shares {
+		reward := types.Coins{
+			ThetaWei: big.NewInt(0),
+			TFuelWei: rewardAmount,
+		}
+		(*accountReward)[string(addr[:])] = reward
+
+		logger.Infof("Block reward for staker %v : %v", hex.EncodeToString(addr[:]), reward)
+	}
+}
+
+// guardianRewardShare returns the share of the reward for the guardian stakes, i.e. the reward split between the
+// validator stakes and the guardian stakes pro-rata to their totals. The withdrawn stakes and the stakes of the
+// standby validators earn nothing.
+func guardianRewardShare(view *st.StoreView, validatorSet *core.ValidatorSet, totalReward *big.Int) *big.Int {
+	guardianStake := view.GetGuardianCandidatePool().TotalStake()
+	totalStake := new(big.Int).Add(validatorSet.TotalStake(), guardianStake)
+	if totalStake.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+	share := new(big.Int).Mul(totalReward, guardianStake)
+	return share.Div(share, totalStake)
+}
+
+// grantGuardianReward divides the guardian reward among the sources of the guardian stakes proportional to their
+// stakes, adding to the rewards they earn from the validator stakes
+func grantGuardianReward(view *st.StoreView, accountReward *map[string]types.Coins, guardianReward *big.Int) {
+	if guardianReward.Sign() <= 0 {
+		return
+	}
+
+	weights := map[common.Address]*big.Int{}
+	for _, guardian := range view.GetGuardianCandidatePool().SortedGuardians {
+		for _, stake := range guardian.Stakes {
+			if stake.Withdrawn || stake.Amount.Sign() <= 0 {
+				continue
+			}
+			weight := new(big.Int).Set(stake.Amount)
+			if sum, exists := weights[stake.Source]; exists {
+				weight.Add(weight, sum)
+			}
+			weights[stake.Source] = weight
+		}
+	}
+
+	for addr, rewardAmount := range divideProportionally(guardianReward, weights) {
+		reward := types.Coins{
+			ThetaWei: big.NewInt(0),
+			TFuelWei: rewardAmount,
+		}
+		if existing, exists := (*accountReward)[string(addr[:])]; exists {
+			reward = existing.NoNil().Plus(reward)
+		}
+		(*accountReward)[string(addr[:])] = reward
+
+		logger.Infof("Block reward for guardian staker %v : %v", hex.EncodeToString(addr[:]), reward)
+	}
+}
+
+// divideProportionally divides the total among the addresses proportional to their weights. The shares are
+// rounded down, and the remaining wei are handed out one each, to the largest remainders first, then to the
+// smaller addresses, so that the shares add up to the total exactly.
+func divideProportionally(total *big.Int, weights map[common.Address]*big.Int) map[common.Address]*big.Int {
+	totalWeight := big.NewInt(0)
+	addresses := []common.Address{}
+	for addr, weight := range weights {
+		totalWeight.Add(totalWeight, weight)
+		addresses = append(addresses, addr)
+	}
+	shares := map[common.Address]*big.Int{}
+	if totalWeight.Sign() <= 0 {
+		return shares
+	}
+
+	remainders := map[common.Address]*big.Int{}
+	leftover := new(big.Int).Set(total)
+	for _, addr := range addresses {
+		share, remainder := new(big.Int).QuoRem(new(big.Int).Mul(total, weights[addr]), totalWeight, new(big.Int))
+		shares[addr] = share
+		remainders[addr] = remainder
+		leftover.Sub(leftover, share)
+	}
+
+	sort.Slice(addresses, func(i, j int) bool {
+		if c := remainders[addresses[i]].Cmp(remainders[addresses[j]]); c != 0 {
+			return c > 0
+		}
+		return bytes.Compare(addresses[i][:], addresses[j][:]) < 0
+	})
+	for i := 0; leftover.Sign() > 0; i++ { // less than one wei per address is left over
+		shares[addresses[i]].Add(shares[addresses[i]], big.NewInt(1))
+		leftover.Sub(leftover, big.NewInt(1))
+	}
+	return shares
+}
+
 func (exec *CoinbaseTxExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
 	return &core.TxInfo{
 		EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction),
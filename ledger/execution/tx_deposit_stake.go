@@ -34,27 +34,60 @@ func (exec *DepositStakeExecutor) sanityCheck(chainID string, view *st.StoreView
 
 	sourceAccount, success := getInput(view, tx.Source)
 	if success.IsError() {
-		return result.Error("Failed to get the source account: %v", tx.Source.Address)
+		return result.Error("Failed to get the source account: %v", tx.Source.Address).WithErrorCode(result.CodeUnknownAccount)
 	}
 
-	signBytes := tx.SignBytes(chainID)
-	res = validateInputAdvanced(sourceAccount, signBytes, tx.Source)
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(sourceAccount, signTargets, tx.Source)
 	if res.IsError() {
 		logger.Warnf(fmt.Sprintf("validateSourceAdvanced failed on %v: %v", tx.Source.Address.Hex(), res))
 		return res
 	}
 
-	if !sanityCheckForFee(tx.Fee) {
-		return result.Error("Insufficient fee. Transaction fee needs to be at least %v TFuelWei",
-			types.MinimumTransactionFeeTFuelWei).WithErrorCode(result.CodeInvalidFee)
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
 	}
 
-	if !(tx.Purpose == core.StakeForValidator || tx.Purpose == core.StakeForGuardian) {
-		return result.Error("Invalid stake purpose!").
-			WithErrorCode(result.CodeInvalidStakePurpose)
+	res = sanityCheckForStakePurpose(view, tx.Purpose)
+	if res.IsError() {
+		return res
+	}
+
+	// A deposit retried with the same idempotency nonce is rejected instead of adding a second stake
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if tx.IdempotencyNonce != 0 {
+		if blockHeight < common.HeightEnableDepositIdempotency {
+			return result.Error("Deposit idempotency nonces are not enabled until height %v",
+				common.HeightEnableDepositIdempotency).WithErrorCode(result.CodeInvalidIdempotencyNonce)
+		}
+		if usedHeight, used := view.GetDepositNonceHeight(tx.Source.Address, tx.IdempotencyNonce); used {
+			return result.Error("The idempotency nonce %v is already used by %v at height %v",
+				tx.IdempotencyNonce, tx.Source.Address.Hex(), usedHeight).WithErrorCode(result.CodeDuplicateDepositNonce)
+		}
 	}
 
 	stake := tx.Source.Coins.NoNil()
+	res = sanityCheckForStakeDeposit(view, tx.Source.Address, tx.Holder.Address, tx.Purpose, stake)
+	if res.IsError() {
+		return res
+	}
+
+	// The stake and the fee are both paid out of the balance of the source, the balance of the holder never
+	// backs the stake even for a self stake
+	minimalBalance := stake.Plus(tx.Fee)
+	if !sourceAccount.Balance.IsGTE(minimalBalance) {
+		logger.Infof(fmt.Sprintf("DepositStake: Source did not have enough balance %v", tx.Source.Address.Hex()))
+		return result.Error("DepositStake: Source balance is %v, but required minimal balance is %v",
+			sourceAccount.Balance, minimalBalance).WithErrorCode(result.CodeInsufficientFund)
+	}
+
+	return result.OK
+}
+
+// sanityCheckForStakeDeposit checks the stake deposited by the source to the holder for the purpose, whether by a
+// DepositStakeTx or by a contract, see depositStakePrecompile. The balance of the source is checked by the callers.
+func sanityCheckForStakeDeposit(view *st.StoreView, source common.Address, holder common.Address, purpose uint8, stake types.Coins) result.Result {
 	if !stake.IsValid() || !stake.IsNonnegative() {
 		return result.Error("Invalid stake for stake deposit!").
 			WithErrorCode(result.CodeInvalidStake)
@@ -65,17 +98,35 @@ func (exec *DepositStakeExecutor) sanityCheck(chainID string, view *st.StoreView
 			WithErrorCode(result.CodeInvalidStake)
 	}
 
-	// Minimum stake deposit requirement to avoid spamming
-	if stake.ThetaWei.Cmp(core.MinValidatorStakeDeposit) < 0 {
-		return result.Error("Insufficient amount of stake, at least %v ThetaWei is required for each deposit", core.MinValidatorStakeDeposit).
+	// Minimum stake deposit requirement to avoid spamming, the guardian stakes have a lower minimum
+	minStakeDeposit := core.MinValidatorStakeDeposit
+	if view.Height()+1 >= common.HeightEnableStakingParams {
+		minStakeDeposit = view.GetMinValidatorStakeDeposit()
+	}
+	if purpose == core.StakeForGuardian {
+		minStakeDeposit = core.MinGuardianStakeDeposit
+	}
+	if stake.ThetaWei.Cmp(minStakeDeposit) < 0 {
+		return result.Error("Insufficient amount of stake, at least %v ThetaWei is required for each deposit", minStakeDeposit).
 			WithErrorCode(result.CodeInsufficientStake)
 	}
 
-	minimalBalance := stake.Plus(tx.Fee)
-	if !sourceAccount.Balance.IsGTE(minimalBalance) {
-		logger.Infof(fmt.Sprintf("DepositStake: Source did not have enough balance %v", tx.Source.Address.Hex()))
-		return result.Error("DepositStake: Source balance is %v, but required minimal balance is %v",
-			sourceAccount.Balance, minimalBalance).WithErrorCode(result.CodeInsufficientStake)
+	// The withdrawn stake can't be topped up until it is returned. Starting from the unbonding queue, the
+	// deposit adds a new stake instead, and the withdrawn stake returns at its own height.
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	existingStake := view.GetValidatorCandidatePool().FindStake(source, holder)
+	if purpose == core.StakeForValidator && blockHeight < common.HeightEnableUnbondingQueue &&
+		existingStake != nil && existingStake.Withdrawn {
+		return result.Error("Cannot deposit during the withdrawal locking period, the stake returns at height %v",
+			existingStake.ReturnHeight).WithErrorCode(result.CodeStakeLocked)
+	}
+
+	// A rotated out validator key can no longer sign for the stakes
+	if purpose == core.StakeForValidator && blockHeight >= common.HeightEnableValidatorKeyRotation {
+		if newHolder, rotated := view.GetRotatedValidatorKey(holder); rotated {
+			return result.Error("The validator key %v is rotated out, deposit to %v instead",
+				holder.Hex(), newHolder.Hex()).WithErrorCode(result.CodeValidatorKeyRotated)
+		}
 	}
 
 	return result.OK
@@ -89,46 +140,69 @@ func (exec *DepositStakeExecutor) process(chainID string, view *st.StoreView, tr
 		return common.Hash{}, result.Error("Failed to get the source account")
 	}
 
-	if !chargeFee(sourceAccount, tx.Fee) {
+	if !chargeFee(view, sourceAccount, tx.Fee) {
 		return common.Hash{}, result.Error("Failed to charge transaction fee")
 	}
 
-	stake := tx.Source.Coins.NoNil()
+	stake := tx.Source.Coins.Copy() // the stake keeps the amount, which must not alias the tx
 	if !sourceAccount.Balance.IsGTE(stake) {
 		return common.Hash{}, result.Error("Not enough balance to stake").WithErrorCode(result.CodeNotEnoughBalanceToStake)
 	}
 
 	sourceAddress := tx.Source.Address
-	holderAddress := tx.Holder.Address
+	res := depositStake(view, sourceAddress, sourceAccount, tx.Holder.Address, tx.Purpose, stake)
+	if res.IsError() {
+		return common.Hash{}, res
+	}
+
+	if tx.IdempotencyNonce != 0 {
+		blockHeight := view.Height() + 1 // the view points to the parent of the current block
+		view.RecordDepositNonce(sourceAddress, tx.IdempotencyNonce, blockHeight, blockHeight+core.DepositNonceWindow)
+	}
+
+	effectiveHeight := recordStakeTransaction(view)
+
+	sourceAccount.Sequence++
+	view.SetAccount(sourceAddress, sourceAccount)
+
+	txHash := types.TxID(chainID, tx)
+	return txHash, result.OKWith(result.Info{"validatorSetEffectiveHeight": effectiveHeight})
+}
 
-	if tx.Purpose == core.StakeForValidator {
+// depositStake moves the stake from the balance of the source account to the stake pool of the purpose, whether
+// deposited by a DepositStakeTx or by a contract. The caller saves the source account.
+func depositStake(view *st.StoreView, sourceAddress common.Address, sourceAccount *types.Account, holderAddress common.Address,
+	purpose uint8, stake types.Coins) result.Result {
+	if purpose == core.StakeForValidator {
 		sourceAccount.Balance = sourceAccount.Balance.Minus(stake)
 		stakeAmount := stake.ThetaWei
 		vcp := view.GetValidatorCandidatePool()
-		err := vcp.DepositStake(sourceAddress, holderAddress, stakeAmount)
+		var err error
+		if view.Height()+1 >= common.HeightEnableStakingParams {
+			err = vcp.DepositActiveStakeWithMinimum(sourceAddress, holderAddress, stakeAmount, view.GetMinValidatorStakeDeposit())
+		} else if view.Height()+1 >= common.HeightEnableUnbondingQueue {
+			err = vcp.DepositActiveStake(sourceAddress, holderAddress, stakeAmount)
+		} else {
+			err = vcp.DepositStake(sourceAddress, holderAddress, stakeAmount)
+		}
 		if err != nil {
-			return common.Hash{}, result.Error("Failed to deposit stake, err: %v", err)
+			return result.Error("Failed to deposit stake, err: %v", err).WithErrorCode(result.CodeInvalidStake)
 		}
 		view.UpdateValidatorCandidatePool(vcp)
-	} else if tx.Purpose == core.StakeForGuardian {
-		return common.Hash{}, result.Error("Staking for guardian not supported yet")
+	} else if purpose == core.StakeForGuardian {
+		sourceAccount.Balance = sourceAccount.Balance.Minus(stake)
+		gcp := view.GetGuardianCandidatePool()
+		err := gcp.DepositStake(sourceAddress, holderAddress, stake.ThetaWei)
+		if err != nil {
+			return result.Error("Failed to deposit guardian stake, err: %v", err).WithErrorCode(result.CodeInvalidStake)
+		}
+		view.UpdateGuardianCandidatePool(gcp)
 	} else {
-		return common.Hash{}, result.Error("Invalid staking purpose").WithErrorCode(result.CodeInvalidStakePurpose)
-	}
-
-	hl := view.GetStakeTransactionHeightList()
-	if hl == nil {
-		hl = &types.HeightList{}
+		// A purpose registered for a fork without a stake pool to handle it
+		return result.Error("Staking for %v not supported", core.StakePurposeName(purpose)).
+			WithErrorCode(result.CodeStakingNotSupported)
 	}
-	blockHeight := view.Height() + 1 // the view points to the parent of the current block
-	hl.Append(blockHeight)
-	view.UpdateStakeTransactionHeightList(hl)
-
-	sourceAccount.Sequence++
-	view.SetAccount(sourceAddress, sourceAccount)
-
-	txHash := types.TxID(chainID, tx)
-	return txHash, result.OK
+	return result.OK
 }
 
 func (exec *DepositStakeExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
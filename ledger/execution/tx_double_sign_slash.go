@@ -0,0 +1,168 @@
+package execution
+
+import (
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+var _ TxExecutor = (*DoubleSignSlashTxExecutor)(nil)
+
+// ------------------------------- DoubleSignSlash Transaction -----------------------------------
+
+// DoubleSignSlashTxExecutor implements the TxExecutor interface
+type DoubleSignSlashTxExecutor struct {
+}
+
+// NewDoubleSignSlashTxExecutor creates a new instance of DoubleSignSlashTxExecutor
+func NewDoubleSignSlashTxExecutor() *DoubleSignSlashTxExecutor {
+	return &DoubleSignSlashTxExecutor{}
+}
+
+func (exec *DoubleSignSlashTxExecutor) sanityCheck(chainID string, view *st.StoreView, transaction types.Tx) result.Result {
+	tx := transaction.(*types.DoubleSignSlashTx)
+
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight < common.HeightEnableDoubleSignSlash {
+		return result.Error("The double signing slashes are not enabled until height %v",
+			common.HeightEnableDoubleSignSlash).WithErrorCode(result.CodeDoubleSignSlashNotEnabled)
+	}
+
+	res := tx.Reporter.ValidateBasic()
+	if res.IsError() {
+		return res
+	}
+
+	reporterAccount, res := getInput(view, tx.Reporter)
+	if res.IsError() {
+		return res
+	}
+
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(reporterAccount, signTargets, tx.Reporter)
+	if res.IsError() {
+		return res
+	}
+
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
+	}
+
+	if !reporterAccount.Balance.IsGTE(tx.Fee) {
+		return result.Error("Insufficient fund: balance is %v, the fee is %v", reporterAccount.Balance, tx.Fee).
+			WithErrorCode(result.CodeInsufficientFund)
+	}
+
+	evidence, res := getDoubleSignEvidence(chainID, tx)
+	if res.IsError() {
+		return res
+	}
+
+	// The evidence is accepted for a bounded number of blocks, while the withdrawn stakes are still locked
+	if evidence.Height() >= blockHeight {
+		return result.Error("The conflicting blocks at height %v are not below the current block at height %v",
+			evidence.Height(), blockHeight).WithErrorCode(result.CodeInvalidDoubleSignEvidence)
+	}
+	if blockHeight-evidence.Height() > types.DoubleSignEvidenceWindow {
+		return result.Error("The evidence at height %v expired at height %v", evidence.Height(),
+			evidence.Height()+types.DoubleSignEvidenceWindow).WithErrorCode(result.CodeDoubleSignEvidenceExpired)
+	}
+
+	offender := evidence.Offender()
+	if view.DoubleSignSlashed(offender, evidence.Height()) {
+		return result.Error("%v was already slashed for double signing at height %v", offender.Hex(), evidence.Height()).
+			WithErrorCode(result.CodeDoubleSignAlreadySlashed)
+	}
+
+	if view.GetValidatorCandidatePool().FindStakeDelegate(offender) == nil {
+		return result.Error("No stake deposited to %v", offender.Hex()).WithErrorCode(result.CodeStakeNotFound)
+	}
+
+	return result.OK
+}
+
+func (exec *DoubleSignSlashTxExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
+	tx := transaction.(*types.DoubleSignSlashTx)
+
+	reporterAccount, res := getInput(view, tx.Reporter)
+	if res.IsError() {
+		return common.Hash{}, res
+	}
+
+	evidence, res := getDoubleSignEvidence(chainID, tx)
+	if res.IsError() {
+		return common.Hash{}, res
+	}
+
+	if !chargeFee(view, reporterAccount, tx.Fee) {
+		return common.Hash{}, result.Error("Failed to charge transaction fee")
+	}
+
+	offender := evidence.Offender()
+	vcp := view.GetValidatorCandidatePool()
+	lockingPeriod := core.ReturnLockingPeriod
+	if view.Height()+1 >= common.HeightEnableStakingParams {
+		lockingPeriod = view.GetReturnLockingPeriod()
+	}
+	slashedAmount, err := vcp.SlashStakeHolderWithLockingPeriod(offender, view.GetDoubleSignSlashPercentage(), view.Height(), lockingPeriod)
+	if err != nil {
+		return common.Hash{}, result.Error("Failed to slash stake, err: %v", err).WithErrorCode(result.CodeStakeNotFound)
+	}
+	view.UpdateValidatorCandidatePool(vcp)
+	slashedStake := types.Coins{ThetaWei: slashedAmount, TFuelWei: big.NewInt(0)}
+	view.DecreaseTotalSupply(slashedStake) // the slashed stake is burned
+	view.MarkDoubleSignSlashed(offender, evidence.Height())
+	view.SetStakeHolderSlashHeight(offender, view.Height()) // the withdrawals it forced can not be cancelled
+	if view.Height()+1 >= common.HeightEnableStakingParams {
+		view.SetStakeHolderSlashReturnHeight(offender, view.Height()+lockingPeriod)
+	}
+
+	hl := view.GetStakeTransactionHeightList()
+	if hl == nil {
+		hl = &types.HeightList{}
+	}
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	hl.Append(blockHeight)
+	view.UpdateStakeTransactionHeightList(hl)
+
+	reporterAccount.Sequence++
+	view.SetAccount(tx.Reporter.Address, reporterAccount)
+
+	txHash := types.TxID(chainID, tx)
+	return txHash, result.OKWith(result.Info{"slashedStake": slashedStake})
+}
+
+// getDoubleSignEvidence decodes and verifies the evidence carried by the transaction
+func getDoubleSignEvidence(chainID string, tx *types.DoubleSignSlashTx) (*types.DoubleSignEvidence, result.Result) {
+	evidence, err := types.DoubleSignEvidenceFromBytes(tx.Evidence)
+	if err != nil {
+		return nil, result.Error("Failed to decode the double sign evidence: %v", err).
+			WithErrorCode(result.CodeInvalidDoubleSignEvidence)
+	}
+	if res := evidence.Verify(chainID); res.IsError() {
+		return nil, res
+	}
+	return evidence, result.OK
+}
+
+func (exec *DoubleSignSlashTxExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
+	tx := transaction.(*types.DoubleSignSlashTx)
+	return &core.TxInfo{
+		Address:           tx.Reporter.Address,
+		Sequence:          tx.Reporter.Sequence,
+		EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction),
+	}
+}
+
+func (exec *DoubleSignSlashTxExecutor) calculateEffectiveGasPrice(transaction types.Tx) *big.Int {
+	tx := transaction.(*types.DoubleSignSlashTx)
+	fee := tx.Fee
+	gas := new(big.Int).SetUint64(types.GasDoubleSignSlashTx)
+	effectiveGasPrice := new(big.Int).Div(fee.TFuelWei, gas)
+	return effectiveGasPrice
+}
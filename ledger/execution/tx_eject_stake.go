@@ -0,0 +1,127 @@
+package execution
+
+import (
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+var _ TxExecutor = (*EjectStakeTxExecutor)(nil)
+
+// ------------------------------- EjectStake Transaction -----------------------------------
+
+// EjectStakeTxExecutor implements the TxExecutor interface
+type EjectStakeTxExecutor struct {
+	state *st.LedgerState
+}
+
+// NewEjectStakeTxExecutor creates a new instance of EjectStakeTxExecutor
+func NewEjectStakeTxExecutor(state *st.LedgerState) *EjectStakeTxExecutor {
+	return &EjectStakeTxExecutor{
+		state: state,
+	}
+}
+
+func (exec *EjectStakeTxExecutor) sanityCheck(chainID string, view *st.StoreView, transaction types.Tx) result.Result {
+	tx := transaction.(*types.EjectStakeTx)
+
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight < common.HeightEnableStakeEjection {
+		return result.Error("The stake ejection is not enabled until height %v", common.HeightEnableStakeEjection).
+			WithErrorCode(result.CodeStakeEjectionNotEnabled)
+	}
+
+	res := tx.Holder.ValidateBasic()
+	if res.IsError() {
+		return res
+	}
+
+	holderAccount, res := getInput(view, tx.Holder)
+	if res.IsError() {
+		return res
+	}
+
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(holderAccount, signTargets, tx.Holder)
+	if res.IsError() {
+		return res
+	}
+
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
+	}
+
+	res = sanityCheckForStakePurpose(view, tx.Purpose)
+	if res.IsError() {
+		return res
+	}
+
+	if !holderAccount.Balance.IsGTE(tx.Fee) {
+		return result.Error("Insufficient fund: balance is %v, the fee is %v", holderAccount.Balance, tx.Fee).
+			WithErrorCode(result.CodeInsufficientFund)
+	}
+
+	// The ejection would keep the holder from cancelling the withdrawal of its own stake
+	if tx.Source.Address == tx.Holder.Address {
+		return result.Error("%v can not eject its self stake, it needs to withdraw it instead", tx.Holder.Address.Hex()).
+			WithErrorCode(result.CodeSelfStakeEjection)
+	}
+
+	return sanityCheckForStakeWithdrawal(view, tx.Source.Address, tx.Holder.Address, tx.Purpose)
+}
+
+// NOTE: like WithdrawStakeExecutor.process(), EjectStakeTxExecutor.process() does NOT return the stake to the
+// source, the withdrawn stake is returned to the source when the block height reaches its return height
+func (exec *EjectStakeTxExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
+	tx := transaction.(*types.EjectStakeTx)
+
+	holderAccount, res := getInput(view, tx.Holder)
+	if res.IsError() {
+		return common.Hash{}, res
+	}
+
+	if !chargeFee(view, holderAccount, tx.Fee) {
+		return common.Hash{}, result.Error("Failed to charge transaction fee")
+	}
+
+	res = withdrawStake(view, tx.Source.Address, tx.Holder.Address, tx.Purpose, exec.state.Height())
+	if res.IsError() {
+		return common.Hash{}, res
+	}
+
+	// The source can not cancel the withdrawal the holder forced
+	if tx.Purpose == core.StakeForValidator {
+		stake := view.GetValidatorCandidatePool().FindLatestWithdrawnStake(tx.Source.Address, tx.Holder.Address)
+		view.SetStakeEjectionReturnHeight(tx.Holder.Address, tx.Source.Address, stake.ReturnHeight)
+	}
+
+	effectiveHeight := recordStakeTransaction(view)
+
+	holderAccount.Sequence++
+	view.SetAccount(tx.Holder.Address, holderAccount)
+
+	txHash := types.TxID(chainID, tx)
+	return txHash, result.OKWith(result.Info{"validatorSetEffectiveHeight": effectiveHeight})
+}
+
+func (exec *EjectStakeTxExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
+	tx := transaction.(*types.EjectStakeTx)
+	return &core.TxInfo{
+		Address:           tx.Holder.Address,
+		Sequence:          tx.Holder.Sequence,
+		EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction),
+	}
+}
+
+func (exec *EjectStakeTxExecutor) calculateEffectiveGasPrice(transaction types.Tx) *big.Int {
+	tx := transaction.(*types.EjectStakeTx)
+	fee := tx.Fee
+	gas := new(big.Int).SetUint64(types.GasEjectStakeTx)
+	effectiveGasPrice := new(big.Int).Div(fee.TFuelWei, gas)
+	return effectiveGasPrice
+}
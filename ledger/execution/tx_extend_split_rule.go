@@ -0,0 +1,135 @@
+package execution
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+var _ TxExecutor = (*ExtendSplitRuleTxExecutor)(nil)
+
+// ------------------------------- ExtendSplitRule Transaction -----------------------------------
+
+// ExtendSplitRuleTxExecutor implements the TxExecutor interface
+type ExtendSplitRuleTxExecutor struct {
+	state *st.LedgerState
+}
+
+// NewExtendSplitRuleTxExecutor creates a new instance of ExtendSplitRuleTxExecutor
+func NewExtendSplitRuleTxExecutor(state *st.LedgerState) *ExtendSplitRuleTxExecutor {
+	return &ExtendSplitRuleTxExecutor{
+		state: state,
+	}
+}
+
+func (exec *ExtendSplitRuleTxExecutor) sanityCheck(chainID string, view *st.StoreView, transaction types.Tx) result.Result {
+	tx := transaction.(*types.ExtendSplitRuleTx)
+
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight < common.HeightEnableExtendSplitRule {
+		return result.Error("The split rule extensions are not enabled until height %v",
+			common.HeightEnableExtendSplitRule).WithErrorCode(result.CodeExtendSplitRuleNotEnabled)
+	}
+
+	res := tx.Initiator.ValidateBasic()
+	if res.IsError() {
+		return res
+	}
+
+	initiatorAccount, res := getInput(view, tx.Initiator)
+	if res.IsError() {
+		return res
+	}
+
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(initiatorAccount, signTargets, tx.Initiator)
+	if res.IsError() {
+		return res
+	}
+
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
+	}
+
+	minimalBalance := tx.Fee
+	if !initiatorAccount.Balance.IsGTE(minimalBalance) {
+		logger.Infof("the split rule initiator did not have enough to cover the fee %v", tx.Initiator.Address.Hex())
+		return result.Error("the split rule initiator account balance is %v, but required minimal balance is %v",
+			initiatorAccount.Balance, minimalBalance).WithErrorCode(result.CodeInsufficientFund)
+	}
+
+	if tx.Duration == 0 {
+		return result.Error("The split rule needs to be extended by at least one block").
+			WithErrorCode(result.CodeInvalidSplitRule)
+	}
+
+	splitRule := view.GetSplitRule(tx.ResourceID)
+	if splitRule == nil {
+		return result.Error("No split rule found for resourceID %v", tx.ResourceID).
+			WithErrorCode(result.CodeSplitRuleNotFound)
+	}
+	if splitRule.InitiatorAddress != tx.Initiator.Address {
+		return result.Error("Only the initiator of the split rule can extend it").
+			WithErrorCode(result.CodeUnauthorizedToUpdateSplitRule)
+	}
+	if splitRule.IsExpiredAt(view.Height()) {
+		return result.Error("The split rule for resourceID %v expired at block height %v, it needs to be recreated",
+			tx.ResourceID, splitRule.EndBlockHeight).WithErrorCode(result.CodeSplitRuleExpired)
+	}
+	if splitRule.EndBlockHeight > math.MaxUint64-tx.Duration {
+		return result.Error("Duration %v is too large", tx.Duration).WithErrorCode(result.CodeInvalidSplitRule)
+	}
+
+	return result.OK
+}
+
+func (exec *ExtendSplitRuleTxExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
+	tx := transaction.(*types.ExtendSplitRuleTx)
+
+	initiatorAccount, res := getInput(view, tx.Initiator)
+	if res.IsError() {
+		return common.Hash{}, res
+	}
+
+	if !chargeFee(view, initiatorAccount, tx.Fee) {
+		return common.Hash{}, result.Error("failed to charge transaction fee")
+	}
+
+	splitRule := view.GetSplitRule(tx.ResourceID)
+	if splitRule == nil {
+		return common.Hash{}, result.Error("failed to find the split rule").WithErrorCode(result.CodeSplitRuleNotFound)
+	}
+	splitRule.EndBlockHeight += tx.Duration
+	if !view.UpdateSplitRule(splitRule) {
+		return common.Hash{}, result.Error("failed to update split rule")
+	}
+
+	initiatorAccount.Sequence++
+	view.SetAccount(tx.Initiator.Address, initiatorAccount)
+
+	txHash := types.TxID(chainID, tx)
+	return txHash, result.OK
+}
+
+func (exec *ExtendSplitRuleTxExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
+	tx := transaction.(*types.ExtendSplitRuleTx)
+	return &core.TxInfo{
+		Address:           tx.Initiator.Address,
+		Sequence:          tx.Initiator.Sequence,
+		EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction),
+	}
+}
+
+func (exec *ExtendSplitRuleTxExecutor) calculateEffectiveGasPrice(transaction types.Tx) *big.Int {
+	tx := transaction.(*types.ExtendSplitRuleTx)
+	fee := tx.Fee
+	gas := new(big.Int).SetUint64(types.GasExtendSplitRuleTx)
+	effectiveGasPrice := new(big.Int).Div(fee.TFuelWei, gas)
+	return effectiveGasPrice
+}
@@ -0,0 +1,154 @@
+package execution
+
+import (
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+var _ TxExecutor = (*PartialReleaseFundTxExecutor)(nil)
+
+// ------------------------------- PartialReleaseFundTx Transaction -----------------------------------
+
+// PartialReleaseFundTxExecutor implements the TxExecutor interface
+type PartialReleaseFundTxExecutor struct {
+	state *st.LedgerState
+}
+
+// NewPartialReleaseFundTxExecutor creates a new instance of PartialReleaseFundTxExecutor
+func NewPartialReleaseFundTxExecutor(state *st.LedgerState) *PartialReleaseFundTxExecutor {
+	return &PartialReleaseFundTxExecutor{
+		state: state,
+	}
+}
+
+func (exec *PartialReleaseFundTxExecutor) sanityCheck(chainID string, view *st.StoreView, transaction types.Tx) result.Result {
+	tx := transaction.(*types.PartialReleaseFundTx)
+
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight < common.HeightEnablePartialReleaseFund {
+		return result.Error("The partial fund releases are not enabled until height %v",
+			common.HeightEnablePartialReleaseFund).WithErrorCode(result.CodePartialReleaseFundNotEnabled)
+	}
+
+	res := tx.Source.ValidateBasic()
+	if res.IsError() {
+		return res
+	}
+
+	res = tx.Target.ValidateBasic()
+	if res.IsError() {
+		return res
+	}
+
+	sourceAddress := tx.Source.Address
+	targetAddress := tx.Target.Address
+
+	if sourceAddress == targetAddress {
+		return result.Error("Source and target address for the partial release cannot be identical: %v", sourceAddress).
+			WithErrorCode(result.CodeDuplicatedAddress)
+	}
+
+	if !tx.Source.Coins.NoNil().IsZero() || !tx.Target.Coins.NoNil().IsZero() {
+		return result.Error("The amount to release is specified by the transaction, not by the inputs").
+			WithErrorCode(result.CodeInvalidCoins)
+	}
+
+	sourceAccount, success := getInput(view, tx.Source)
+	if success.IsError() {
+		return result.Error("Unknown address: %v", sourceAddress).WithErrorCode(result.CodeUnknownAccount)
+	}
+
+	targetAccount, res := getOrMakeInput(view, tx.Target)
+	if res.IsError() {
+		return res
+	}
+
+	// Both the source and the target sign the same sign bytes
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(sourceAccount, signTargets, tx.Source)
+	if res.IsError() {
+		logger.Warnf("validateSourceAdvanced failed on %v: %v", sourceAddress.Hex(), res)
+		return res
+	}
+
+	res = validateInputSignatures(targetAccount, signTargets, tx.Target)
+	if res.IsError() {
+		logger.Infof("PartialReleaseFundTx failed on target signature, addr: %v", targetAddress.Hex())
+		return res
+	}
+
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
+	}
+
+	minimalBalance := tx.Fee
+	if !sourceAccount.Balance.IsGTE(minimalBalance) {
+		logger.Infof("Source did not have enough balance %v", sourceAddress.Hex())
+		return result.Error("Source balance is %v, but required minimal balance is %v",
+			sourceAccount.Balance, minimalBalance).WithErrorCode(result.CodeInsufficientFund)
+	}
+
+	amount := tx.Amount.NoNil()
+	if !amount.IsValid() || !amount.IsPositive() || amount.ThetaWei.Cmp(types.Zero) != 0 {
+		return result.Error("Invalid amount to release: %v", tx.Amount).WithErrorCode(result.CodeInvalidCoins)
+	}
+
+	currentBlockHeight := view.Height()
+	reserveSequence := tx.ReserveSequence
+	err := sourceAccount.CheckPartialReleaseFund(targetAddress, currentBlockHeight, reserveSequence)
+	if err != nil {
+		return result.Error("%v", err).WithErrorCode(result.CodePartialReleaseFundCheckFailed)
+	}
+
+	remainingFund, _ := sourceAccount.RemainingReservedFund(reserveSequence)
+	if !remainingFund.IsGTE(amount) {
+		return result.Error("Amount to release %v exceeds the remaining reserved fund %v", amount, remainingFund).
+			WithErrorCode(result.CodeReservedFundOverdraft)
+	}
+
+	return result.OK
+}
+
+func (exec *PartialReleaseFundTxExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
+	tx := transaction.(*types.PartialReleaseFundTx)
+
+	sourceAddress := tx.Source.Address
+	sourceAccount, success := getInput(view, tx.Source)
+	if success.IsError() {
+		return common.Hash{}, result.Error("Failed to get the source account")
+	}
+
+	sourceAccount.PartialReleaseFund(tx.Amount.NoNil(), tx.ReserveSequence)
+	if !chargeFee(view, sourceAccount, tx.Fee) {
+		return common.Hash{}, result.Error("failed to charge transaction fee")
+	}
+
+	sourceAccount.Sequence++
+	view.SetAccount(sourceAddress, sourceAccount)
+
+	txHash := types.TxID(chainID, tx)
+	return txHash, result.OK
+}
+
+func (exec *PartialReleaseFundTxExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
+	tx := transaction.(*types.PartialReleaseFundTx)
+	return &core.TxInfo{
+		Address:           tx.Source.Address,
+		Sequence:          tx.Source.Sequence,
+		EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction),
+	}
+}
+
+func (exec *PartialReleaseFundTxExecutor) calculateEffectiveGasPrice(transaction types.Tx) *big.Int {
+	tx := transaction.(*types.PartialReleaseFundTx)
+	fee := tx.Fee
+	gas := new(big.Int).SetUint64(types.GasPartialReleaseFundTx)
+	effectiveGasPrice := new(big.Int).Div(fee.TFuelWei, gas)
+	return effectiveGasPrice
+}
@@ -39,20 +39,20 @@ func (exec *ReleaseFundTxExecutor) sanityCheck(chainID string, view *st.StoreVie
 	// Get input account
 	sourceAccount, success := getInput(view, tx.Source)
 	if success.IsError() {
-		return result.Error("Unknown address: %v", tx.Source.Address)
+		return result.Error("Unknown address: %v", tx.Source.Address).WithErrorCode(result.CodeUnknownAccount)
 	}
 
 	// Validate input, advanced
-	signBytes := tx.SignBytes(chainID)
-	res = validateInputAdvanced(sourceAccount, signBytes, tx.Source)
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(sourceAccount, signTargets, tx.Source)
 	if res.IsError() {
 		logger.Warnf(fmt.Sprintf("validateSourceAdvanced failed on %v: %v", tx.Source.Address.Hex(), res))
 		return res
 	}
 
-	if !sanityCheckForFee(tx.Fee) {
-		return result.Error("Insufficient fee. Transaction fee needs to be at least %v TFuelWei",
-			types.MinimumTransactionFeeTFuelWei).WithErrorCode(result.CodeInvalidFee)
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
 	}
 
 	minimalBalance := tx.Fee
@@ -88,7 +88,7 @@ func (exec *ReleaseFundTxExecutor) process(chainID string, view *st.StoreView, t
 
 	currentBlockHeight := exec.state.Height()
 	sourceAccount.ReleaseFund(currentBlockHeight, reserveSequence)
-	if !chargeFee(sourceAccount, tx.Fee) {
+	if !chargeFee(view, sourceAccount, tx.Fee) {
 		return common.Hash{}, result.Error("failed to charge transaction fee")
 	}
 
@@ -25,9 +25,22 @@ func NewSendTxExecutor() *SendTxExecutor {
 
 func (exec *SendTxExecutor) sanityCheck(chainID string, view *st.StoreView, transaction types.Tx) result.Result {
 	tx := transaction.(*types.SendTx)
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+
+	// Bound the number of signatures to verify and accounts to update before anything else
+	if blockHeight >= common.HeightEnableSendTxInputLimit && len(tx.Inputs) > types.MaxSendTxInputs {
+		return result.Error("Transaction has too many inputs. At most %v inputs are allowed per transaction",
+			types.MaxSendTxInputs).WithErrorCode(result.CodeSendTxTooManyAccounts)
+	}
+	ins := tx.PayingInputs() // the inputs, and the fee payer if any
+	numAccountsAffected := uint64(len(ins) + len(tx.Outputs))
+	if numAccountsAffected > types.MaxAccountsAffectedPerTx {
+		return result.Error("Trasaction modifying too many accounts. At most %v accounts are allowed per transaction",
+			types.MaxAccountsAffectedPerTx).WithErrorCode(result.CodeSendTxTooManyAccounts)
+	}
 
 	// Validate inputs and outputs, basic
-	res := validateInputsBasic(tx.Inputs)
+	res := validateInputsBasic(ins)
 	if res.IsError() {
 		return res
 	}
@@ -35,19 +48,47 @@ func (exec *SendTxExecutor) sanityCheck(chainID string, view *st.StoreView, tran
 	if res.IsError() {
 		return res
 	}
+	res = sanityCheckForZeroAddress(blockHeight, tx)
+	if res.IsError() {
+		return res
+	}
 
 	if len(tx.Inputs) == 0 || len(tx.Outputs) == 0 {
-		return result.Error("Invalid sendTx, Inputs and/or Outputs are empty")
+		return result.Error("Invalid sendTx, Inputs and/or Outputs are empty").WithErrorCode(result.CodeInvalidTxFormat)
 	}
 
-	numAccountsAffected := uint64(len(tx.Inputs) + len(tx.Outputs))
-	if numAccountsAffected > types.MaxAccountsAffectedPerTx {
-		return result.Error("Trasaction modifying too many accounts. At most %v accounts are allowed per transaction",
-			types.MaxAccountsAffectedPerTx)
+	res = sanityCheckForExpiry(blockHeight, tx)
+	if res.IsError() {
+		return res
 	}
 
-	// Get inputs
-	accounts, res := getInputs(view, tx.Inputs)
+	res = sanityCheckForFeePayer(blockHeight, tx)
+	if res.IsError() {
+		return res
+	}
+
+	// The inputs listed in a different order would give the same transfer a different hash
+	if blockHeight >= common.HeightEnableCanonicalTxInputOrder && !tx.HasCanonicalInputOrder() {
+		return result.Error("The inputs need to be sorted by address, see types.NormalizeTx").
+			WithErrorCode(result.CodeSendTxNonCanonicalOrder)
+	}
+
+	res = sanityCheckForData(blockHeight, tx)
+	if res.IsError() {
+		return res
+	}
+
+	// Reject the zero and dust outputs. The inputs are not subject to the thresholds, so that the existing
+	// accounts below them remain spendable.
+	if blockHeight >= common.HeightEnableDustThreshold {
+		res = validateOutputsAmount(view, tx.Outputs)
+		if res.IsError() {
+			return res
+		}
+	}
+
+	// Get inputs, the fee payer can't be one of them
+	accounts, res := getInputs(view, ins)
 	if res.IsError() {
 		return res
 	}
@@ -59,22 +100,23 @@ func (exec *SendTxExecutor) sanityCheck(chainID string, view *st.StoreView, tran
 	}
 
 	// Validate inputs and outputs, advanced
-	signBytes := tx.SignBytes(chainID)
-	inTotal, res := validateInputsAdvanced(accounts, signBytes, tx.Inputs)
+	signTargets := txSignTargets(chainID, view, tx)
+	inTotal, res := validateInputsAdvanced(accounts, signTargets, ins)
 	if res.IsError() {
 		return res
 	}
 
-	if !sanityCheckForFee(tx.Fee) {
-		return result.Error("Insufficient fee. Transaction fee needs to be at least %v TFuelWei",
-			types.MinimumTransactionFeeTFuelWei).WithErrorCode(result.CodeInvalidFee)
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
 	}
 
+	// The fee is paid jointly by the inputs, or by the fee payer alone, nothing is minted or burnt besides
 	outTotal := sumOutputs(tx.Outputs)
-	outPlusFees := outTotal
-	outPlusFees = outTotal.Plus(tx.Fee)
+	outPlusFees := outTotal.Plus(tx.Fee)
 	if !inTotal.IsEqual(outPlusFees) {
-		return result.Error("Input total (%v) != output total + fees (%v)", inTotal, outPlusFees)
+		return result.Error("Input total (%v) != output total + fees (%v)", inTotal, outPlusFees).
+			WithErrorCode(result.CodeSendTxUnbalanced)
 	}
 
 	return result.OK
@@ -83,7 +125,8 @@ func (exec *SendTxExecutor) sanityCheck(chainID string, view *st.StoreView, tran
 func (exec *SendTxExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
 	tx := transaction.(*types.SendTx)
 
-	accounts, res := getInputs(view, tx.Inputs)
+	ins := tx.PayingInputs()
+	accounts, res := getInputs(view, ins)
 	if res.IsError() {
 		return common.Hash{}, res
 	}
@@ -93,8 +136,9 @@ func (exec *SendTxExecutor) process(chainID string, view *st.StoreView, transact
 		return common.Hash{}, res
 	}
 
-	adjustByInputs(view, accounts, tx.Inputs)
+	adjustByInputs(view, accounts, ins)
 	adjustByOutputs(view, accounts, tx.Outputs)
+	disposeFee(view, tx.Fee) // the fee is charged by adjustByInputs()
 
 	txHash := types.TxID(chainID, tx)
 	return txHash, result.OK
@@ -102,22 +146,117 @@ func (exec *SendTxExecutor) process(chainID string, view *st.StoreView, transact
 
 func (exec *SendTxExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
 	tx := transaction.(*types.SendTx)
+	if len(tx.Inputs) == 0 { // invalid, but the info is extracted before the tx is screened
+		return &core.TxInfo{EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction)}
+	}
 	return &core.TxInfo{
 		Address:           tx.Inputs[0].Address,
 		Sequence:          tx.Inputs[0].Sequence,
 		EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction),
+		ExpirationHeight:  expirationHeight(tx.ValidUntilHeight),
 	}
 }
 
 func (exec *SendTxExecutor) calculateEffectiveGasPrice(transaction types.Tx) *big.Int {
 	tx := transaction.(*types.SendTx)
-	fee := tx.Fee
-	numAccountsAffected := uint64(len(tx.Inputs) + len(tx.Outputs))
-	gasUint64 := types.GasSendTxPerAccount * numAccountsAffected
-	if gasUint64 < 2*types.GasSendTxPerAccount {
-		gasUint64 = 2 * types.GasSendTxPerAccount // to prevent spamming with invalid transactions, e.g. empty inputs/outputs
-	}
-	gas := new(big.Int).SetUint64(gasUint64)
+	fee := tx.Fee.NoNil()
+	gas := new(big.Int).SetUint64(types.EstimateTxGas(tx))
 	effectiveGasPrice := new(big.Int).Div(fee.TFuelWei, gas)
 	return effectiveGasPrice
 }
+
+// sanityCheckForExpiry checks that the valid-until height of the transaction, if any, is enabled at the block height
+// and not below it
+func sanityCheckForExpiry(blockHeight uint64, tx *types.SendTx) result.Result {
+	if tx.ValidUntilHeight == 0 {
+		return result.OK
+	}
+	if blockHeight < common.HeightEnableSendTxExpiry {
+		return result.Error("Valid-until heights are not supported until height %v", common.HeightEnableSendTxExpiry).
+			WithErrorCode(result.CodeSendTxExpiryNotEnabled)
+	}
+	if tx.IsExpiredAt(blockHeight) {
+		return result.Error("Transaction expired: valid until height %v, the block height is %v", tx.ValidUntilHeight, blockHeight).
+			WithErrorCode(result.CodeTxExpired)
+	}
+	return result.OK
+}
+
+// sanityCheckForZeroAddress rejects the outputs to the zero address from common.HeightEnableBurn. No one holds
+// the key of the zero address, the coins are destroyed with a BurnTx instead
+func sanityCheckForZeroAddress(blockHeight uint64, tx *types.SendTx) result.Result {
+	if blockHeight < common.HeightEnableBurn {
+		return result.OK
+	}
+	for _, out := range tx.Outputs {
+		if out.Address == (common.Address{}) {
+			return result.Error("Cannot send to the zero address, use a BurnTx to burn coins").
+				WithErrorCode(result.CodeSendToZeroAddress)
+		}
+	}
+	return result.OK
+}
+
+// sanityCheckForFeePayer checks that the fee payer, if any, is enabled at the block height and pays exactly the
+// fee. The fee payer is otherwise validated as one more input, with its own balance, sequence and signature.
+func sanityCheckForFeePayer(blockHeight uint64, tx *types.SendTx) result.Result {
+	if tx.FeePayer == nil {
+		return result.OK
+	}
+	if blockHeight < common.HeightEnableFeePayer {
+		return result.Error("Fee payers are not supported until height %v", common.HeightEnableFeePayer).
+			WithErrorCode(result.CodeSendTxInvalidFeePayer)
+	}
+	if !tx.FeePayer.Coins.IsEqual(tx.Fee) {
+		return result.Error("The fee payer needs to pay exactly the fee %v, not %v", tx.Fee, tx.FeePayer.Coins).
+			WithErrorCode(result.CodeSendTxInvalidFeePayer)
+	}
+	return result.OK
+}
+
+// sanityCheckForData checks that the data of the transaction, if any, is enabled at the block height and fits
+// in the size limit
+func sanityCheckForData(blockHeight uint64, tx *types.SendTx) result.Result {
+	if len(tx.Data) == 0 {
+		return result.OK
+	}
+	if blockHeight < common.HeightEnableSendTxData {
+		return result.Error("Transaction data is not supported until height %v", common.HeightEnableSendTxData).
+			WithErrorCode(result.CodeSendTxDataNotEnabled)
+	}
+	if len(tx.Data) > types.MaxSendTxDataSize {
+		return result.Error("Transaction data too large, at most %v bytes are allowed", types.MaxSendTxDataSize).
+			WithErrorCode(result.CodeSendTxDataTooLarge)
+	}
+	return result.OK
+}
+
+// validateOutputsAmount checks the outputs against the dust policy: the zero outputs are rejected, each
+// non-zero coin amount needs to meet the dust threshold, and an output creating a new account needs to meet
+// the minimum new account amount of either coin.
+func validateOutputsAmount(view *st.StoreView, outs []types.TxOutput) result.Result {
+	dustThreshold := view.GetDustThreshold()
+	minNewAccountAmount := view.GetMinNewAccountAmount()
+	for _, out := range outs {
+		coins := out.Coins.NoNil()
+		if coins.IsZero() {
+			return result.Error("Output to %v carries no coins", out.Address.Hex()).
+				WithErrorCode(result.CodeSendTxZeroOutput)
+		}
+		if isDust(coins.ThetaWei, dustThreshold.ThetaWei) || isDust(coins.TFuelWei, dustThreshold.TFuelWei) {
+			return result.Error("Output to %v is dust: %v, the non-zero amounts need to be at least %v",
+				out.Address.Hex(), coins, dustThreshold).WithErrorCode(result.CodeSendTxDustOutput)
+		}
+		if view.GetAccount(out.Address) == nil &&
+			coins.ThetaWei.Cmp(minNewAccountAmount.ThetaWei) < 0 && coins.TFuelWei.Cmp(minNewAccountAmount.TFuelWei) < 0 {
+			return result.Error("Output to %v creates a new account, it needs at least %v %v or %v %v",
+				out.Address.Hex(), minNewAccountAmount.ThetaWei, types.DenomThetaWei,
+				minNewAccountAmount.TFuelWei, types.DenomTFuelWei).WithErrorCode(result.CodeSendTxNewAccountTooSmall)
+		}
+	}
+	return result.OK
+}
+
+func isDust(amount, threshold *big.Int) bool {
+	return amount.Sign() > 0 && amount.Cmp(threshold) < 0
+}
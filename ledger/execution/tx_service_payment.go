@@ -44,7 +44,7 @@ func (exec *ServicePaymentTxExecutor) sanityCheck(chainID string, view *st.Store
 	targetAddress := tx.Target.Address
 
 	if sourceAddress == targetAddress {
-		return result.Error("Source and target address for the service payment cannot be identical: %v", sourceAddress)
+		return result.Error("Source and target address for the service payment cannot be identical: %v", sourceAddress).WithErrorCode(result.CodeInvalidServicePayment)
 	}
 
 	sourceAccount, res := getInput(view, tx.Source)
@@ -58,28 +58,34 @@ func (exec *ServicePaymentTxExecutor) sanityCheck(chainID string, view *st.Store
 		return res
 	}
 
-	if tx.Source.Coins.ThetaWei.Cmp(types.Zero) != 0 {
-		return result.Error("Cannot send ThetaWei as service payment!")
+	if tx.Source.Coins.NoNil().ThetaWei.Cmp(types.Zero) != 0 {
+		return result.Error("Cannot send ThetaWei as service payment!").WithErrorCode(result.CodeInvalidServicePayment)
+	}
+
+	// The service payments are signed off-chain by a single key
+	if sourceAccount.Multisig != nil || targetAccount.Multisig != nil {
+		return result.Error("Service payments are not supported for multisig accounts").
+			WithErrorCode(result.CodeUnauthorizedTx)
 	}
 
 	// Verify source
 	sourceSignBytes := tx.SourceSignBytes(chainID)
-	if !tx.Source.Signature.Verify(sourceSignBytes, sourceAccount.Address) {
+	if !signatureCache.Verify(sourceSignBytes, tx.Source.Signature, sourceAccount.Address) {
 		errMsg := fmt.Sprintf("sanityCheckForServicePaymentTx failed on source signature, addr: %v", sourceAddress.Hex())
 		logger.Infof(errMsg)
-		return result.Error(errMsg)
+		return result.Error(errMsg).WithErrorCode(result.CodeInvalidSignature)
 	}
 
 	targetSignBytes := tx.TargetSignBytes(chainID)
-	if !tx.Target.Signature.Verify(targetSignBytes, targetAccount.Address) {
+	if !signatureCache.Verify(targetSignBytes, tx.Target.Signature, targetAccount.Address) {
 		errMsg := fmt.Sprintf("sanityCheckForServicePaymentTx failed on target signature, addr: %v", targetAddress.Hex())
 		logger.Infof(errMsg)
-		return result.Error(errMsg)
+		return result.Error(errMsg).WithErrorCode(result.CodeInvalidSignature)
 	}
 
-	if !sanityCheckForFee(tx.Fee) {
-		return result.Error("Insufficient fee. Transaction fee needs to be at least %v TFuelWei",
-			types.MinimumTransactionFeeTFuelWei).WithErrorCode(result.CodeInvalidFee)
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
 	}
 
 	transferAmount := tx.Source.Coins
@@ -87,14 +93,19 @@ func (exec *ServicePaymentTxExecutor) sanityCheck(chainID string, view *st.Store
 	reserveSequence := tx.ReserveSequence
 	paymentSequence := tx.PaymentSequence
 
-	// Note: No need to check whether the source account has enough reserved fund to cover the
-	//       transaction. If the source account does not have sufficient reserved fund,
-	//       the source account will be slashed by the process() function
 	err := sourceAccount.CheckTransferReservedFund(targetAccount, transferAmount, paymentSequence, currentBlockHeight, reserveSequence)
 	if err != nil {
 		return result.Error(err.Error()).WithErrorCode(result.CodeCheckTransferReservedFundFailed)
 	}
 
+	// The settlements against the reserved fund, to any of the targets, can never exceed it in total.
+	// The used fund accumulates in the view, so the settlements in the same block are accounted for.
+	remainingFund, _ := sourceAccount.RemainingReservedFund(reserveSequence)
+	if !remainingFund.IsGTE(transferAmount) {
+		return result.Error("Service payment %v exceeds the remaining reserved fund %v", transferAmount, remainingFund).
+			WithErrorCode(result.CodeReservedFundOverdraft)
+	}
+
 	return result.OK
 }
 
@@ -142,7 +153,7 @@ func (exec *ServicePaymentTxExecutor) process(chainID string, view *st.StoreView
 	if shouldSlash {
 		//view.AddSlashIntent(slashIntent)
 	}
-	if !chargeFee(targetAccount, tx.Fee) {
+	if !chargeFee(view, targetAccount, tx.Fee) {
 		// should charge after transfer the fund, so an empty address has some fund to pay the tx fee
 		return common.Hash{}, result.Error("failed to charge transaction fee")
 	}
@@ -168,7 +179,7 @@ func (exec *ServicePaymentTxExecutor) splitPayment(view *st.StoreView, splitRule
 	}
 
 	// the splitRule has expired, full payment goes to the target account. also delete the splitRule
-	if exec.state.Height() > splitRule.EndBlockHeight {
+	if splitRule.IsExpiredAt(view.Height()) {
 		addressCoinsMap[targetAddress] = fullAmount
 		view.DeleteSplitRule(resourceID)
 		return true, addressCoinsMap
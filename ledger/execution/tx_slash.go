@@ -53,7 +53,7 @@ func (exec *SlashTxExecutor) sanityCheck(chainID string, view *st.StoreView, tra
 	// verify the proposer's signature
 	signBytes := tx.SignBytes(chainID)
 	if !tx.Proposer.Signature.Verify(signBytes, proposerAccount.Address) {
-		return result.Error("SignBytes: %X", signBytes)
+		return result.Error("SignBytes: %X", signBytes).WithErrorCode(result.CodeInvalidSignature)
 	}
 
 	slashedAddress := tx.SlashedAddress
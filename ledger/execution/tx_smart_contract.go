@@ -3,6 +3,7 @@ package execution
 import (
 	"fmt"
 	"math/big"
+	"time"
 
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/common/result"
@@ -18,13 +19,16 @@ var _ TxExecutor = (*SmartContractTxExecutor)(nil)
 
 // SmartContractTxExecutor implements the TxExecutor interface
 type SmartContractTxExecutor struct {
-	state *st.LedgerState
+	state       *st.LedgerState
+	chainConfig *vm.ChainConfig
 }
 
-// NewSmartContractTxExecutor creates a new instance of SmartContractTxExecutor
+// NewSmartContractTxExecutor creates a new instance of SmartContractTxExecutor, which executes the contracts with the
+// EVM configuration of the chain of the state, see vm.ChainConfigForChainID
 func NewSmartContractTxExecutor(state *st.LedgerState) *SmartContractTxExecutor {
 	return &SmartContractTxExecutor{
-		state: state,
+		state:       state,
+		chainConfig: vm.ChainConfigForChainID(state.GetChainID()),
 	}
 }
 
@@ -40,12 +44,12 @@ func (exec *SmartContractTxExecutor) sanityCheck(chainID string, view *st.StoreV
 	// Get input account
 	fromAccount, success := getInput(view, tx.From)
 	if success.IsError() {
-		return result.Error("Failed to get the from account")
+		return result.Error("Failed to get the from account").WithErrorCode(result.CodeUnknownAccount)
 	}
 
 	// Validate input, advanced
-	signBytes := tx.SignBytes(chainID)
-	res = validateInputAdvanced(fromAccount, signBytes, tx.From)
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(fromAccount, signTargets, tx.From)
 	if res.IsError() {
 		logger.Warnf(fmt.Sprintf("validateSourceAdvanced failed on %v: %v", tx.From.Address.Hex(), res))
 		return res
@@ -57,6 +61,12 @@ func (exec *SmartContractTxExecutor) sanityCheck(chainID string, view *st.StoreV
 			WithErrorCode(result.CodeInvalidValueToTransfer)
 	}
 
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight >= common.HeightEnableTxGasLimitCap && tx.GasLimit > types.MaximumTxGasLimit {
+		return result.Error("Gas limit too high, the gas limit can be at most %v", types.MaximumTxGasLimit).
+			WithErrorCode(result.CodeGasLimitTooHigh)
+	}
+
 	if !sanityCheckForGasPrice(tx.GasPrice) {
 		return result.Error("Insufficient gas price. Gas price needs to be at least %v TFuelWei", types.MinimumGasPrice).
 			WithErrorCode(result.CodeInvalidGasPrice)
@@ -86,17 +96,68 @@ func (exec *SmartContractTxExecutor) sanityCheck(chainID string, view *st.StoreV
 }
 
 func (exec *SmartContractTxExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
+	return exec.processWithTimeLimit(chainID, view, transaction, 0)
+}
+
+// processWithTimeLimit is similar to process, but fails the transaction if the execution takes longer than the
+// time limit, in which case the view is left untouched and no fee is charged
+func (exec *SmartContractTxExecutor) processWithTimeLimit(chainID string, view *st.StoreView, transaction types.Tx, timeLimit time.Duration) (common.Hash, result.Result) {
+	return exec.execute(chainID, view, transaction, timeLimit, nil)
+}
+
+// execute is similar to processWithTimeLimit, but also reports the contract execution to the tracer if not nil
+func (exec *SmartContractTxExecutor) execute(chainID string, view *st.StoreView, transaction types.Tx, timeLimit time.Duration,
+	tracer vm.Tracer) (common.Hash, result.Result) {
 	tx := transaction.(*types.SmartContractTx)
 
+	var snapshot int
+	if timeLimit > 0 {
+		snapshot = view.Snapshot()
+	}
+
+	// Starting from the gas refund, the fee for the whole gas limit is charged up front, so the execution only
+	// sees the balance left after it, and the fee for the unused gas is refunded after the execution
+	fromAddress := tx.From.Address
+	gasRefundEnabled := view.Height()+1 >= common.HeightEnableContractGasRefund
+	maxFee := types.Coins{
+		ThetaWei: big.NewInt(0),
+		TFuelWei: new(big.Int).Mul(tx.GasPrice, new(big.Int).SetUint64(tx.GasLimit)),
+	}
+	if gasRefundEnabled {
+		fromAccount, success := getInput(view, tx.From)
+		if success.IsError() {
+			return common.Hash{}, result.Error("Failed to get the from account").WithErrorCode(result.CodeUnknownAccount)
+		}
+		if !fromAccount.Balance.IsGTE(maxFee) {
+			return common.Hash{}, result.Error("Source balance is %v, but the fee limit is %v",
+				fromAccount.Balance, maxFee).WithErrorCode(result.CodeInsufficientFund)
+		}
+		fromAccount.Balance = fromAccount.Balance.Minus(maxFee)
+		view.SetAccount(fromAddress, fromAccount)
+	}
+
 	// Note: for contract deployment, vm.Execute() might transfer coins from the fromAccount to the
 	//       deployed smart contract. Thus, we should call vm.Execute() before calling getInput().
 	//       Otherwise, the fromAccount returned by getInput() will have incorrect balance.
-	_, _, gasUsed, _ := vm.Execute(tx, view)
+	vmRet, _, gasUsed, transfers, evmErr := vm.ExecuteWithChainConfig(tx, view, exec.chainConfig, timeLimit, tracer)
+	logs := view.PopLogs()
+	if evmErr == vm.ErrExecutionAborted {
+		view.RevertToSnapshot(snapshot) // e.g. vm.create() increments the sequence of the from account
+		return common.Hash{}, result.Error("Execution time limit of %v exceeded", timeLimit).
+			WithErrorCode(result.CodeExecutionTimeLimitExceeded)
+	}
+	if evmErr != nil {
+		logs = nil // the state changes were reverted, so should the logs
+	}
+	if gasRefundEnabled && evmErr == vm.ErrOutOfGas {
+		// Running out of gas uses all the gas, including when the gas limit does not even cover the
+		// intrinsic gas, which the VM reports as no gas used
+		gasUsed = tx.GasLimit
+	}
 
-	fromAddress := tx.From.Address
 	fromAccount, success := getInput(view, tx.From)
 	if success.IsError() {
-		return common.Hash{}, result.Error("Failed to get the from account")
+		return common.Hash{}, result.Error("Failed to get the from account").WithErrorCode(result.CodeUnknownAccount)
 	}
 
 	feeAmount := new(big.Int).Mul(tx.GasPrice, new(big.Int).SetUint64(gasUsed))
@@ -104,18 +165,53 @@ func (exec *SmartContractTxExecutor) process(chainID string, view *st.StoreView,
 		ThetaWei: big.NewInt(int64(0)),
 		TFuelWei: feeAmount,
 	}
-	if !chargeFee(fromAccount, fee) {
-		return common.Hash{}, result.Error("failed to charge transaction fee")
+	if gasRefundEnabled {
+		fromAccount.Balance = fromAccount.Balance.Plus(maxFee.Minus(fee))
+		disposeFee(view, fee)
+
+		// The sequence is consumed whatever the outcome, vm.create() only increments it once it gets to
+		// deploy the contract
+		fromAccount.Sequence = tx.From.Sequence
+	} else {
+		if !chargeFee(view, fromAccount, fee) {
+			return common.Hash{}, result.Error("failed to charge transaction fee")
+		}
+
+		createContract := (tx.To.Address == common.Address{})
+		if !createContract { // vm.create() increments the sequence of the from account
+			fromAccount.Sequence++
+		}
 	}
+	view.SetAccount(fromAddress, fromAccount)
 
-	createContract := (tx.To.Address == common.Address{})
-	if !createContract { // vm.create() increments the sequence of the from account
-		fromAccount.Sequence++
+	info := result.Info{
+		"fee":      fee,
+		"gasUsed":  gasUsed,
+		"logs":     logs,
+		"vmReturn": vmRet,
+	}
+	if evmErr != nil {
+		info["vmError"] = evmErr.Error() // the transaction is still applied, only its state changes are reverted
+	}
+	if evmErr == vm.ErrExecutionReverted {
+		info["revertData"] = vmRet // e.g. an ABI encoded Error(string), see vm.UnpackRevertReason()
+	}
+	if len(transfers.Transfers) > 0 {
+		info["internalTransfers"] = transfers.Transfers // including the reverted ones, see types.InternalTransfer
+	}
+	if transfers.Truncated {
+		info["internalTransfersTruncated"] = true
+	}
+	for _, log := range logs {
+		if isStakePrecompileLog(log) { // the contract updated its stakes, see DepositStakePrecompileAddress
+			blockHeight := view.Height() + 1 // the view points to the parent of the current block
+			info["validatorSetEffectiveHeight"] = core.ValidatorSetEffectiveHeight(blockHeight)
+			break
+		}
 	}
-	view.SetAccount(fromAddress, fromAccount)
 
 	txHash := types.TxID(chainID, tx)
-	return txHash, result.OK
+	return txHash, result.OKWith(info)
 }
 
 func (exec *SmartContractTxExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
@@ -129,5 +225,5 @@ func (exec *SmartContractTxExecutor) getTxInfo(transaction types.Tx) *core.TxInf
 
 func (exec *SmartContractTxExecutor) calculateEffectiveGasPrice(transaction types.Tx) *big.Int {
 	tx := transaction.(*types.SmartContractTx)
-	return tx.GasPrice
+	return new(big.Int).Set(tx.GasPrice) // the fee per unit of gas, same as the regular txs, and not aliasing the tx
 }
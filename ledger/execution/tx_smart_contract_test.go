@@ -0,0 +1,470 @@
+package execution
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/ledger/vm"
+)
+
+func TestSmartContractTxExecutionLimits(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	et := NewExecTest()
+	callerPrivAcc := types.MakeAccWithInitBalance("caller", types.NewCoins(0, int64(2*types.MaximumTxGasLimit*types.MinimumGasPrice)))
+	et.acc2State(callerPrivAcc)
+
+	// ASM:
+	// jumpdest
+	// push 0x0
+	// jump
+	contractAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	et.state().Delivered().SetCode(contractAddr, common.Hex2Bytes("5b600056"))
+	et.state().Commit()
+
+	newCallTx := func(gasLimit uint64) *types.SmartContractTx {
+		tx := &types.SmartContractTx{
+			From: types.TxInput{
+				Address:  callerPrivAcc.Address,
+				Sequence: 1,
+			},
+			To:       types.TxOutput{Address: contractAddr},
+			GasLimit: gasLimit,
+			GasPrice: new(big.Int).SetUint64(types.MinimumGasPrice),
+		}
+		tx.From.Signature = callerPrivAcc.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+	scTxExec := NewSmartContractTxExecutor(et.state())
+
+	// The gas limit is capped, starting from the fork
+	res := scTxExec.sanityCheck(et.chainID, et.state().Checked(), newCallTx(types.MaximumTxGasLimit+1))
+	assert.True(res.IsOK(), res.Message)
+	et.fastforwardTo(common.HeightEnableTxGasLimitCap)
+	res = scTxExec.sanityCheck(et.chainID, et.state().Checked(), newCallTx(types.MaximumTxGasLimit+1))
+	assert.Equal(result.CodeGasLimitTooHigh, res.Code)
+	res = scTxExec.sanityCheck(et.chainID, et.state().Checked(), newCallTx(types.MaximumTxGasLimit))
+	assert.True(res.IsOK(), res.Message)
+
+	// The infinite loop exceeding the time limit fails without touching the state
+	view := et.state().Checked()
+	rootBefore := view.Hash()
+	_, res = scTxExec.processWithTimeLimit(et.chainID, view, newCallTx(types.MaximumTxGasLimit), time.Millisecond)
+	assert.Equal(result.CodeExecutionTimeLimitExceeded, res.Code)
+	assert.Equal(rootBefore, view.Hash())
+	assert.Equal(uint64(0), view.GetAccount(callerPrivAcc.Address).Sequence)
+
+	// Without the time limit, it runs out of gas and is charged for all the gas
+	view = et.state().Delivered()
+	balanceBefore := view.GetAccount(callerPrivAcc.Address).Balance
+	_, res = scTxExec.process(et.chainID, view, newCallTx(types.MaximumTxGasLimit))
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(types.MaximumTxGasLimit, res.Info["gasUsed"])
+	fee := new(big.Int).SetUint64(types.MaximumTxGasLimit * types.MinimumGasPrice)
+	callerAcc := view.GetAccount(callerPrivAcc.Address)
+	assert.Equal(uint64(1), callerAcc.Sequence)
+	assert.Equal(0, new(big.Int).Sub(balanceBefore.TFuelWei, callerAcc.Balance.TFuelWei).Cmp(fee))
+}
+
+func TestSmartContractTxGasRefund(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	et := NewExecTest()
+	callerPrivAcc := types.MakeAccWithInitBalance("gas_refund_caller", types.NewCoins(0, int64(100*types.MaximumTxGasLimit*types.MinimumGasPrice)))
+	et.acc2State(callerPrivAcc)
+
+	// ASM:
+	// caller
+	// balance
+	// push 0x0
+	// mstore
+	// push 0x20
+	// push 0x0
+	// return
+	balanceContractAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	et.state().Delivered().SetCode(balanceContractAddr, common.Hex2Bytes("333160005260206000f3"))
+
+	// ASM:
+	// push 0x1
+	// push 0x0
+	// sstore
+	// stop
+	storeContractAddrs := []common.Address{
+		common.HexToAddress("0x1000000000000000000000000000000000000002"),
+		common.HexToAddress("0x1000000000000000000000000000000000000003"),
+	}
+	for _, addr := range storeContractAddrs {
+		et.state().Delivered().SetCode(addr, common.Hex2Bytes("600160005500"))
+	}
+	et.state().Delivered().UpdateTotalSupply(types.NewCoins(0, int64(1000*types.MaximumTxGasLimit*types.MinimumGasPrice)))
+	et.state().Commit()
+	et.fastforwardTo(common.HeightEnableContractGasRefund - 1)
+
+	gasPrice := new(big.Int).SetUint64(types.MinimumGasPrice)
+	sequence := uint64(0)
+	newTx := func(to common.Address, gasLimit uint64, data common.Bytes) *types.SmartContractTx {
+		sequence++
+		tx := &types.SmartContractTx{
+			From:     types.TxInput{Address: callerPrivAcc.Address, Sequence: sequence},
+			To:       types.TxOutput{Address: to},
+			GasLimit: gasLimit,
+			GasPrice: gasPrice,
+			Data:     data,
+		}
+		tx.From.Signature = callerPrivAcc.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+	view := et.state().Delivered()
+	scTxExec := NewSmartContractTxExecutor(et.state())
+	balance := func() *big.Int {
+		return view.GetAccount(callerPrivAcc.Address).Balance.TFuelWei
+	}
+	feeOf := func(gas uint64) *big.Int {
+		return new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gas))
+	}
+	execute := func(tx *types.SmartContractTx) (result.Result, *big.Int) {
+		balanceBefore := balance()
+		supplyBefore := new(big.Int).Set(view.GetTotalSupply().TFuelWei)
+		res := scTxExec.sanityCheck(et.chainID, view, tx)
+		require.True(res.IsOK(), res.Message)
+		_, res = scTxExec.process(et.chainID, view, tx)
+		require.True(res.IsOK(), res.Message)
+		assert.Equal(tx.From.Sequence, view.GetAccount(callerPrivAcc.Address).Sequence)
+		charged := new(big.Int).Sub(balanceBefore, balance())
+		assert.Equal(charged, new(big.Int).Sub(supplyBefore, view.GetTotalSupply().TFuelWei)) // the fee is burnt
+		return res, charged
+	}
+
+	// The fee for the whole gas limit is charged up front, the execution only sees the balance left after it. The
+	// fee for the unused gas is refunded afterwards.
+	gasLimit := uint64(100000)
+	balanceBefore := balance()
+	res, charged := execute(newTx(balanceContractAddr, gasLimit, nil))
+	assert.Nil(res.Info["vmError"])
+	gasUsed := res.Info["gasUsed"].(uint64)
+	assert.True(gasUsed < gasLimit)
+	assert.Equal(feeOf(gasUsed), charged)
+	assert.Equal(feeOf(gasUsed), res.Info["fee"].(types.Coins).TFuelWei)
+	seenBalance := new(big.Int).SetBytes(res.Info["vmReturn"].(common.Bytes))
+	assert.Equal(new(big.Int).Sub(balanceBefore, feeOf(gasLimit)), seenBalance)
+
+	// The exact gas is enough
+	res, _ = execute(newTx(storeContractAddrs[0], gasLimit, nil))
+	exactGas := res.Info["gasUsed"].(uint64)
+	res, charged = execute(newTx(storeContractAddrs[1], exactGas, nil))
+	assert.Nil(res.Info["vmError"])
+	assert.Equal(exactGas, res.Info["gasUsed"])
+	assert.Equal(feeOf(exactGas), charged)
+	assert.Equal(common.BigToHash(big.NewInt(1)), view.GetState(storeContractAddrs[1], common.Hash{}))
+
+	// Out of gas by one, the state changes are reverted, but all the gas is charged and the sequence is consumed
+	storeContractAddr := common.HexToAddress("0x1000000000000000000000000000000000000004")
+	view.SetCode(storeContractAddr, common.Hex2Bytes("600160005500"))
+	res, charged = execute(newTx(storeContractAddr, exactGas-1, nil))
+	assert.Equal(vm.ErrOutOfGas.Error(), res.Info["vmError"])
+	assert.Equal(exactGas-1, res.Info["gasUsed"])
+	assert.Equal(feeOf(exactGas-1), charged)
+	assert.Equal(common.Hash{}, view.GetState(storeContractAddr, common.Hash{}))
+
+	// So is a gas limit below the intrinsic gas, for a call as well as for a deployment
+	res, charged = execute(newTx(storeContractAddr, 20000, nil))
+	assert.Equal(vm.ErrOutOfGas.Error(), res.Info["vmError"])
+	assert.Equal(uint64(20000), res.Info["gasUsed"])
+	assert.Equal(feeOf(20000), charged)
+	res, charged = execute(newTx(common.Address{}, 50000, common.Hex2Bytes("600160005500")))
+	assert.Equal(vm.ErrOutOfGas.Error(), res.Info["vmError"])
+	assert.Equal(feeOf(50000), charged)
+
+	// A reverted call consumes the sequence and pays for the gas used as well, so the next tx of the sender
+	// follows it. ASM: push 0x1, push 0x0, sstore, push 0x0, push 0x0, revert
+	revertContractAddr := common.HexToAddress("0x1000000000000000000000000000000000000005")
+	view.SetCode(revertContractAddr, common.Hex2Bytes("600160005560006000fd"))
+	res, charged = execute(newTx(revertContractAddr, gasLimit, nil))
+	assert.Equal(vm.ErrExecutionReverted.Error(), res.Info["vmError"])
+	assert.Equal(feeOf(res.Info["gasUsed"].(uint64)), charged)
+	assert.Equal(common.Hash{}, view.GetState(revertContractAddr, common.Hash{}))
+	res, _ = execute(newTx(balanceContractAddr, gasLimit, nil))
+	assert.Nil(res.Info["vmError"])
+}
+
+func TestSmartContractTxEffectiveGasPrice(t *testing.T) {
+	assert := assert.New(t)
+
+	et := NewExecTest()
+	from := types.TxInput{Address: common.HexToAddress("0x1000000000000000000000000000000000000001"), Sequence: 1}
+	to := types.TxOutput{Address: common.HexToAddress("0x1000000000000000000000000000000000000002")}
+
+	// The smart contract txs are ordered by their gas price, the regular txs by their fee per unit of gas
+	gasPrice := new(big.Int).SetUint64(2 * types.MinimumGasPrice)
+	scTx := &types.SmartContractTx{From: from, To: to, GasLimit: 100000, GasPrice: gasPrice}
+	scTxInfo := NewSmartContractTxExecutor(et.state()).getTxInfo(scTx)
+	assert.Equal(gasPrice, scTxInfo.EffectiveGasPrice)
+	scTxInfo.EffectiveGasPrice.SetUint64(0)
+	assert.Equal(new(big.Int).SetUint64(2*types.MinimumGasPrice), scTx.GasPrice)
+
+	sendTx := &types.SendTx{Inputs: []types.TxInput{from}, Outputs: []types.TxOutput{to}}
+	sendTx.Fee = types.NewCoins(0, int64(types.EstimateTxGas(sendTx)*2*types.MinimumGasPrice))
+	sendTxInfo, res := et.executor.GetTxInfo(sendTx)
+	assert.True(res.IsOK(), res.Message)
+	assert.Equal(gasPrice, sendTxInfo.EffectiveGasPrice)
+}
+
+func TestSmartContractTxRevertData(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	et := NewExecTest()
+	callerPrivAcc := types.MakeAccWithInitBalance("revert_caller", types.NewCoins(0, int64(10*types.MaximumTxGasLimit*types.MinimumGasPrice)))
+	et.acc2State(callerPrivAcc)
+
+	// ASM:
+	// push2 len(revertData), push 0xe, push 0x0, codecopy
+	// push2 len(revertData), push 0x0, revert
+	// revertData
+	revertingCode := func(revertData common.Bytes) common.Bytes {
+		size := fmt.Sprintf("%04x", len(revertData))
+		return append(common.Hex2Bytes("61"+size+"600e600039"+"61"+size+"6000fd"), revertData...)
+	}
+	reasonData := common.Bytes(common.Hex2Bytes("08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000014" +
+		"696e73756666696369656e742062616c616e6365000000000000000000000000")) // Error("insufficient balance")
+	customData := common.Bytes(common.Hex2Bytes("deadbeef000000000000000000000000000000000000000000000000000000000000002a"))
+	reasonContractAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	customContractAddr := common.HexToAddress("0x1000000000000000000000000000000000000002")
+	storeContractAddr := common.HexToAddress("0x1000000000000000000000000000000000000003")
+	et.state().Delivered().SetCode(reasonContractAddr, revertingCode(reasonData))
+	et.state().Delivered().SetCode(customContractAddr, revertingCode(customData))
+	et.state().Delivered().SetCode(storeContractAddr, common.Hex2Bytes("600160005500"))
+	et.state().Commit()
+
+	newTx := func(to common.Address) *types.SmartContractTx {
+		tx := &types.SmartContractTx{
+			From:     types.TxInput{Address: callerPrivAcc.Address, Sequence: 1},
+			To:       types.TxOutput{Address: to},
+			GasLimit: 100000,
+			GasPrice: new(big.Int).SetUint64(types.MinimumGasPrice),
+		}
+		tx.From.Signature = callerPrivAcc.Sign(tx.SignBytes(et.chainID))
+		return tx
+	}
+	simulate := func(to common.Address) result.Result {
+		view, err := et.state().Delivered().Copy()
+		require.Nil(err)
+		_, res := et.executor.SimulateTx(newTx(to), view)
+		require.True(res.IsOK(), res.Message)
+		assert.Equal(uint64(1), view.GetAccount(callerPrivAcc.Address).Sequence) // the reverted tx is still applied
+		return res
+	}
+
+	// The data returned by the reverted executions is recorded as is
+	res := simulate(reasonContractAddr)
+	assert.Equal(vm.ErrExecutionReverted.Error(), res.Info["vmError"])
+	assert.Equal(reasonData, res.Info["revertData"])
+	assert.Equal(reasonData, res.Info["vmReturn"])
+	reason, ok := vm.UnpackRevertReason(res.Info["revertData"].(common.Bytes))
+	assert.True(ok)
+	assert.Equal("insufficient balance", reason)
+
+	res = simulate(customContractAddr)
+	assert.Equal(customData, res.Info["revertData"])
+	_, ok = vm.UnpackRevertReason(res.Info["revertData"].(common.Bytes))
+	assert.False(ok)
+
+	// Not set for the other executions
+	res = simulate(storeContractAddr)
+	assert.Nil(res.Info["vmError"])
+	assert.Nil(res.Info["revertData"])
+
+	// The simulation is bounded by the time limit, if any
+	view, err := et.state().Delivered().Copy()
+	require.Nil(err)
+	_, res = et.executor.SimulateTxWithTimeLimit(newTx(reasonContractAddr), view, time.Second)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(reasonData, res.Info["revertData"])
+}
+
+func TestSmartContractTxInternalTransfers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	et := NewExecTest()
+	callerPrivAcc := types.MakeAccWithInitBalance("transfers_caller", types.NewCoins(0, int64(10*types.MaximumTxGasLimit*types.MinimumGasPrice)))
+	et.acc2State(callerPrivAcc)
+
+	// ASM:
+	// push 0x0, push 0x0, push 0x0, push 0x0, push value, push20 addr, gas, call, pop
+	callCode := func(addr common.Address, value int) string {
+		return fmt.Sprintf("6000600060006000"+"61%04x"+"73%x"+"5af150", value, addr.Bytes())
+	}
+	contractAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	revertingContractAddr := common.HexToAddress("0x1000000000000000000000000000000000000002")
+	recipientAddr := common.HexToAddress("0x2000000000000000000000000000000000000001")
+	view := et.state().Delivered()
+	view.SetCode(contractAddr, common.Hex2Bytes(callCode(recipientAddr, 100)+callCode(revertingContractAddr, 5)+"00"))
+	view.SetCode(revertingContractAddr, common.Hex2Bytes("60006000fd"))
+	et.state().Commit()
+
+	tx := &types.SmartContractTx{
+		From:     types.TxInput{Address: callerPrivAcc.Address, Coins: types.NewCoins(0, 1000), Sequence: 1},
+		To:       types.TxOutput{Address: contractAddr},
+		GasLimit: 200000,
+		GasPrice: new(big.Int).SetUint64(types.MinimumGasPrice),
+	}
+	tx.From.Signature = callerPrivAcc.Sign(tx.SignBytes(et.chainID))
+
+	addresses := []common.Address{callerPrivAcc.Address, contractAddr, revertingContractAddr, recipientAddr}
+	balances := func() []*big.Int {
+		balances := []*big.Int{}
+		for _, addr := range addresses {
+			balance := big.NewInt(0)
+			if account := view.GetAccount(addr); account != nil {
+				balance = account.Balance.TFuelWei
+			}
+			balances = append(balances, balance)
+		}
+		return balances
+	}
+
+	before := balances()
+	scTxExec := NewSmartContractTxExecutor(et.state())
+	res := scTxExec.sanityCheck(et.chainID, view, tx)
+	require.True(res.IsOK(), res.Message)
+	_, res = scTxExec.process(et.chainID, view, tx)
+	require.True(res.IsOK(), res.Message)
+	assert.Nil(res.Info["vmError"])
+	assert.Nil(res.Info["internalTransfersTruncated"])
+	transfers := res.Info["internalTransfers"].([]*types.InternalTransfer)
+	require.Equal(2, len(transfers))
+	assert.Equal(recipientAddr, transfers[0].To)
+	assert.True(transfers[0].Success)
+	assert.Equal(revertingContractAddr, transfers[1].To)
+	assert.False(transfers[1].Success)
+
+	// The fee, the top-level transfer and the successful internal transfers explain the balance changes
+	deltas := map[common.Address]*big.Int{
+		callerPrivAcc.Address: new(big.Int).Neg(new(big.Int).Add(big.NewInt(1000), res.Info["fee"].(types.Coins).TFuelWei)),
+		contractAddr:          big.NewInt(1000),
+	}
+	for _, transfer := range transfers {
+		if !transfer.Success {
+			continue
+		}
+		for addr, amount := range map[common.Address]*big.Int{transfer.From: new(big.Int).Neg(transfer.Amount.TFuelWei), transfer.To: transfer.Amount.TFuelWei} {
+			if deltas[addr] == nil {
+				deltas[addr] = big.NewInt(0)
+			}
+			deltas[addr].Add(deltas[addr], amount)
+		}
+	}
+	after := balances()
+	for i, addr := range addresses {
+		expected := deltas[addr]
+		if expected == nil {
+			expected = big.NewInt(0)
+		}
+		assert.Equal(0, new(big.Int).Sub(after[i], before[i]).Cmp(expected), addr.Hex())
+	}
+}
+
+func TestSmartContractTxStateAccess(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	et := NewExecTest()
+	callerPrivAcc := types.MakeAccWithInitBalance("access_caller", types.NewCoins(0, int64(10*types.MaximumTxGasLimit*types.MinimumGasPrice)))
+	et.acc2State(callerPrivAcc)
+
+	// ASM:
+	// push 0x0, sload, push 0x1, add, push 0x1, sstore, stop
+	contractAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	et.state().Delivered().SetCode(contractAddr, common.Hex2Bytes("60005460010160015500"))
+	et.state().Commit()
+
+	tx := &types.SmartContractTx{
+		From:     types.TxInput{Address: callerPrivAcc.Address, Sequence: 1},
+		To:       types.TxOutput{Address: contractAddr},
+		GasLimit: 100000,
+		GasPrice: new(big.Int).SetUint64(types.MinimumGasPrice),
+	}
+	tx.From.Signature = callerPrivAcc.Sign(tx.SignBytes(et.chainID))
+
+	view, err := et.state().Delivered().Copy()
+	require.Nil(err)
+	recorder := st.NewAccessRecorder()
+	view.SetAccessRecorder(recorder)
+	_, res := et.executor.SimulateTx(tx, view)
+	require.True(res.IsOK(), res.Message)
+	assert.Nil(res.Info["vmError"])
+
+	// The storage slots are recorded along with the state keys
+	slot0 := st.ContractStorageAccessKey(contractAddr, common.BigToHash(big.NewInt(0)))
+	slot1 := st.ContractStorageAccessKey(contractAddr, common.BigToHash(big.NewInt(1)))
+	accessList := recorder.AccessList()
+	assert.Contains(accessList.Reads, slot0)
+	assert.NotContains(accessList.Writes, slot0)
+	assert.Contains(accessList.Writes, slot1)
+	assert.Contains(accessList.Writes, st.AccountKey(callerPrivAcc.Address))
+	assert.Contains(accessList.Writes, st.AccountKey(contractAddr))
+	assert.Contains(accessList.Reads, st.CodeKey(view.GetCodeHash(contractAddr).Bytes()))
+
+	// Only the accesses made while the recorder is attached are recorded
+	recorder.Reset()
+	view.SetAccessRecorder(nil)
+	view.GetState(contractAddr, common.Hash{})
+	assert.Equal(0, len(recorder.AccessList().Reads))
+}
+
+func TestSmartContractTxChainConfig(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	et := NewExecTest()
+	callerPrivAcc := types.MakeAccWithInitBalance("fork_caller", types.NewCoins(0, int64(10*types.MaximumTxGasLimit*types.MinimumGasPrice)))
+	et.acc2State(callerPrivAcc)
+
+	// ASM:
+	// selfbalance, push 0x0, sstore, stop
+	contractAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	et.state().Delivered().SetCode(contractAddr, common.Hex2Bytes("4760005500"))
+	et.state().Delivered().AddBalance(contractAddr, big.NewInt(1234))
+	et.state().Commit()
+
+	forkHeight := et.state().Delivered().Height() + 1
+	assert.Equal(vm.MainnetChainConfig, et.executor.ChainConfig())
+	assert.NotNil(et.executor.SetChainConfig(&vm.ChainConfig{Create2Height: forkHeight + 1, EIP1884Height: forkHeight}))
+	require.Nil(et.executor.SetChainConfig(&vm.ChainConfig{EIP1884Height: forkHeight}))
+
+	tx := &types.SmartContractTx{
+		From:     types.TxInput{Address: callerPrivAcc.Address, Sequence: 1},
+		To:       types.TxOutput{Address: contractAddr},
+		GasLimit: 100000,
+		GasPrice: new(big.Int).SetUint64(types.MinimumGasPrice),
+	}
+	tx.From.Signature = callerPrivAcc.Sign(tx.SignBytes(et.chainID))
+
+	// The tx is executed with the rules at the height of the view, not of the tip
+	view, err := et.state().Delivered().Copy()
+	require.Nil(err)
+	_, res := et.executor.SimulateTx(tx, view)
+	require.True(res.IsOK(), res.Message)
+	assert.NotNil(res.Info["vmError"])
+
+	view, err = et.state().Delivered().Copy()
+	require.Nil(err)
+	view.IncrementHeight()
+	_, res = et.executor.SimulateTx(tx, view)
+	require.True(res.IsOK(), res.Message)
+	assert.Nil(res.Info["vmError"])
+	assert.Equal(common.BigToHash(big.NewInt(1234)), view.GetState(contractAddr, common.Hash{}))
+}
@@ -42,43 +42,31 @@ func (exec *SplitRuleTxExecutor) sanityCheck(chainID string, view *st.StoreView,
 	}
 
 	// Validate inputs and outputs, advanced
-	signBytes := tx.SignBytes(chainID)
-	res = validateInputAdvanced(initiatorAccount, signBytes, tx.Initiator)
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(initiatorAccount, signTargets, tx.Initiator)
 	if res.IsError() {
 		return res
 	}
 
-	if !sanityCheckForFee(tx.Fee) {
-		return result.Error("Insufficient fee. Transaction fee needs to be at least %v TFuelWei",
-			types.MinimumTransactionFeeTFuelWei).WithErrorCode(result.CodeInvalidFee)
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
 	}
 
 	minimalBalance := tx.Fee
 	if !initiatorAccount.Balance.IsGTE(minimalBalance) {
 		logger.Infof(fmt.Sprintf("the contract initiator did not have enough to cover the fee %X", tx.Initiator.Address))
-		return result.Error("the contract initiator account balance is %v, but required minimal balance is %v", initiatorAccount.Balance, minimalBalance)
+		return result.Error("the contract initiator account balance is %v, but required minimal balance is %v", initiatorAccount.Balance, minimalBalance).WithErrorCode(result.CodeInsufficientFund)
 	}
 
 	numAccountsAffected := len(tx.Splits) + 1
 	if numAccountsAffected > types.MaxAccountsAffectedPerTx {
 		return result.Error("This allows one trasaction to modify many accounts. At most %v accounts are allowed per transaction.",
-			types.MaxAccountsAffectedPerTx)
-	}
-
-	totalPercentage := uint(0)
-	for _, split := range tx.Splits {
-		percentage := split.Percentage
-		if percentage < 0 {
-			return result.Error("Percentage needs to be positive")
-		}
-		if percentage > 100 {
-			return result.Error("Percentage needs to be less than 100")
-		}
-		totalPercentage += percentage
+			types.MaxAccountsAffectedPerTx).WithErrorCode(result.CodeInvalidSplitRule)
 	}
 
-	if totalPercentage > 100 {
-		return result.Error("Sum of the percentages should be at most 100")
+	if err := types.ValidateSplits(tx.Splits); err != nil {
+		return result.Error("%v", err).WithErrorCode(result.CodeInvalidSplitRule)
 	}
 
 	resourceID := tx.ResourceID
@@ -101,7 +89,7 @@ func (exec *SplitRuleTxExecutor) process(chainID string, view *st.StoreView, tra
 		return common.Hash{}, res
 	}
 
-	if !chargeFee(initiatorAccount, tx.Fee) {
+	if !chargeFee(view, initiatorAccount, tx.Fee) {
 		return common.Hash{}, result.Error("failed to charge transaction fee")
 	}
 
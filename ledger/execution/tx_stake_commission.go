@@ -0,0 +1,105 @@
+package execution
+
+import (
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+var _ TxExecutor = (*StakeCommissionTxExecutor)(nil)
+
+// ------------------------------- StakeCommission Transaction -----------------------------------
+
+// StakeCommissionTxExecutor implements the TxExecutor interface
+type StakeCommissionTxExecutor struct {
+}
+
+// NewStakeCommissionTxExecutor creates a new instance of StakeCommissionTxExecutor
+func NewStakeCommissionTxExecutor() *StakeCommissionTxExecutor {
+	return &StakeCommissionTxExecutor{}
+}
+
+func (exec *StakeCommissionTxExecutor) sanityCheck(chainID string, view *st.StoreView, transaction types.Tx) result.Result {
+	tx := transaction.(*types.StakeCommissionTx)
+
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight < common.HeightEnableStakeCommission {
+		return result.Error("The stake commission is not enabled until height %v", common.HeightEnableStakeCommission).
+			WithErrorCode(result.CodeStakeCommissionNotEnabled)
+	}
+
+	res := tx.Holder.ValidateBasic()
+	if res.IsError() {
+		return res
+	}
+
+	if tx.Commission > types.MaxStakeCommission {
+		return result.Error("The commission %v%% exceeds %v%%", tx.Commission, types.MaxStakeCommission).
+			WithErrorCode(result.CodeInvalidStakeCommission)
+	}
+
+	holderAccount, res := getInput(view, tx.Holder)
+	if res.IsError() {
+		return res
+	}
+
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(holderAccount, signTargets, tx.Holder)
+	if res.IsError() {
+		return res
+	}
+
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
+	}
+
+	if !holderAccount.Balance.IsGTE(tx.Fee) {
+		return result.Error("Insufficient fund: balance is %v, the fee is %v", holderAccount.Balance, tx.Fee).
+			WithErrorCode(result.CodeInsufficientFund)
+	}
+
+	return result.OK
+}
+
+func (exec *StakeCommissionTxExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
+	tx := transaction.(*types.StakeCommissionTx)
+
+	holderAccount, res := getInput(view, tx.Holder)
+	if res.IsError() {
+		return common.Hash{}, res
+	}
+
+	if !chargeFee(view, holderAccount, tx.Fee) {
+		return common.Hash{}, result.Error("Failed to charge transaction fee")
+	}
+
+	view.SetStakeCommission(tx.Holder.Address, tx.Commission)
+
+	holderAccount.Sequence++
+	view.SetAccount(tx.Holder.Address, holderAccount)
+
+	txHash := types.TxID(chainID, tx)
+	return txHash, result.OK
+}
+
+func (exec *StakeCommissionTxExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
+	tx := transaction.(*types.StakeCommissionTx)
+	return &core.TxInfo{
+		Address:           tx.Holder.Address,
+		Sequence:          tx.Holder.Sequence,
+		EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction),
+	}
+}
+
+func (exec *StakeCommissionTxExecutor) calculateEffectiveGasPrice(transaction types.Tx) *big.Int {
+	tx := transaction.(*types.StakeCommissionTx)
+	fee := tx.Fee
+	gas := new(big.Int).SetUint64(types.GasStakeCommissionTx)
+	effectiveGasPrice := new(big.Int).Div(fee.TFuelWei, gas)
+	return effectiveGasPrice
+}
@@ -0,0 +1,138 @@
+package execution
+
+import (
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+var _ TxExecutor = (*SweepAccountTxExecutor)(nil)
+
+// ------------------------------- SweepAccount Transaction -----------------------------------
+
+// SweepAccountTxExecutor implements the TxExecutor interface
+type SweepAccountTxExecutor struct {
+}
+
+// NewSweepAccountTxExecutor creates a new instance of SweepAccountTxExecutor
+func NewSweepAccountTxExecutor() *SweepAccountTxExecutor {
+	return &SweepAccountTxExecutor{}
+}
+
+func (exec *SweepAccountTxExecutor) sanityCheck(chainID string, view *st.StoreView, transaction types.Tx) result.Result {
+	tx := transaction.(*types.SweepAccountTx)
+
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight < common.HeightEnableSweepAccount {
+		return result.Error("The account sweeps are not enabled until height %v", common.HeightEnableSweepAccount).
+			WithErrorCode(result.CodeSweepAccountNotEnabled)
+	}
+
+	res := tx.Source.ValidateBasic()
+	if res.IsError() {
+		return res
+	}
+
+	if tx.Target == (common.Address{}) {
+		return result.Error("Cannot sweep to the zero address, use a BurnTx to burn coins").
+			WithErrorCode(result.CodeSendToZeroAddress)
+	}
+	if tx.Source.Address == tx.Target {
+		return result.Error("The target of the sweep needs to be another account").
+			WithErrorCode(result.CodeDuplicatedAddress)
+	}
+
+	sourceAccount, res := getInput(view, tx.Source)
+	if res.IsError() {
+		return res
+	}
+
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(sourceAccount, signTargets, tx.Source)
+	if res.IsError() {
+		return res
+	}
+
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
+	}
+
+	if !tx.Source.Coins.IsEqual(sourceAccount.Balance) {
+		return result.Error("The whole balance needs to be swept: balance is %v, tried to sweep %v",
+			sourceAccount.Balance, tx.Source.Coins).WithErrorCode(result.CodeSweepIncompleteBalance)
+	}
+	if !tx.Source.Coins.IsGTE(tx.Fee) {
+		return result.Error("Insufficient fund: balance is %v, the fee is %v", sourceAccount.Balance, tx.Fee).
+			WithErrorCode(result.CodeInsufficientFund)
+	}
+
+	// The account can only be deleted if nothing else refers to it
+	if len(sourceAccount.ReservedFunds) > 0 {
+		return result.Error("%v has reserved funds", tx.Source.Address.Hex()).
+			WithErrorCode(result.CodeSweepAccountInUse)
+	}
+	if sourceAccount.CodeHash != types.EmptyCodeHash && sourceAccount.CodeHash != (common.Hash{}) {
+		return result.Error("%v is a smart contract", tx.Source.Address.Hex()).
+			WithErrorCode(result.CodeSweepAccountInUse)
+	}
+	if sourceAccount.Multisig != nil {
+		return result.Error("%v is a multisig account, its policy needs to be removed first", tx.Source.Address.Hex()).
+			WithErrorCode(result.CodeSweepAccountInUse)
+	}
+	if view.GetValidatorCandidatePool().HasStakeFrom(tx.Source.Address) {
+		return result.Error("%v has stakes to be returned to it", tx.Source.Address.Hex()).
+			WithErrorCode(result.CodeSweepAccountInUse)
+	}
+
+	// The dust policy of the SendTx does not apply to the target, since the sweep deletes an account for
+	// the one it may create
+
+	return result.OK
+}
+
+func (exec *SweepAccountTxExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
+	tx := transaction.(*types.SweepAccountTx)
+
+	sourceAccount, res := getInput(view, tx.Source)
+	if res.IsError() {
+		return common.Hash{}, res
+	}
+
+	if !chargeFee(view, sourceAccount, tx.Fee) {
+		return common.Hash{}, result.Error("Failed to charge transaction fee")
+	}
+
+	// The deleted account leaves its sequence behind, so that its txs can not be replayed if the
+	// account is created again by a later transfer
+	view.DeleteAccountWithTombstone(tx.Source.Address, tx.Source.Sequence)
+	if !sourceAccount.Balance.IsZero() {
+		targetAccount := getOrMakeAccount(view, tx.Target)
+		targetAccount.Balance = targetAccount.Balance.Plus(sourceAccount.Balance)
+		view.SetAccount(tx.Target, targetAccount)
+	}
+
+	txHash := types.TxID(chainID, tx)
+	return txHash, result.OK
+}
+
+func (exec *SweepAccountTxExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
+	tx := transaction.(*types.SweepAccountTx)
+	return &core.TxInfo{
+		Address:           tx.Source.Address,
+		Sequence:          tx.Source.Sequence,
+		EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction),
+	}
+}
+
+func (exec *SweepAccountTxExecutor) calculateEffectiveGasPrice(transaction types.Tx) *big.Int {
+	tx := transaction.(*types.SweepAccountTx)
+	fee := tx.Fee
+	gas := new(big.Int).SetUint64(types.GasSweepAccountTx)
+	effectiveGasPrice := new(big.Int).Div(fee.TFuelWei, gas)
+	return effectiveGasPrice
+}
@@ -0,0 +1,115 @@
+package execution
+
+import (
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+var _ TxExecutor = (*UnjailTxExecutor)(nil)
+
+// ------------------------------- Unjail Transaction -----------------------------------
+
+// UnjailTxExecutor implements the TxExecutor interface
+type UnjailTxExecutor struct {
+}
+
+// NewUnjailTxExecutor creates a new instance of UnjailTxExecutor
+func NewUnjailTxExecutor() *UnjailTxExecutor {
+	return &UnjailTxExecutor{}
+}
+
+func (exec *UnjailTxExecutor) sanityCheck(chainID string, view *st.StoreView, transaction types.Tx) result.Result {
+	tx := transaction.(*types.UnjailTx)
+
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight < common.HeightEnableValidatorJailing {
+		return result.Error("The validator jailing is not enabled until height %v", common.HeightEnableValidatorJailing).
+			WithErrorCode(result.CodeValidatorJailingNotEnabled)
+	}
+
+	res := tx.Holder.ValidateBasic()
+	if res.IsError() {
+		return res
+	}
+
+	holderAccount, res := getInput(view, tx.Holder)
+	if res.IsError() {
+		return res
+	}
+
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(holderAccount, signTargets, tx.Holder)
+	if res.IsError() {
+		return res
+	}
+
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
+	}
+
+	if !holderAccount.Balance.IsGTE(tx.Fee) {
+		return result.Error("Insufficient fund: balance is %v, the fee is %v", holderAccount.Balance, tx.Fee).
+			WithErrorCode(result.CodeInsufficientFund)
+	}
+
+	record := view.GetValidatorLivenessTracker().Get(tx.Holder.Address)
+	if record == nil || !record.Jailed {
+		return result.Error("%v is not jailed", tx.Holder.Address.Hex()).WithErrorCode(result.CodeValidatorNotJailed)
+	}
+	if releaseHeight := record.JailedHeight + core.JailCooldownPeriod; blockHeight < releaseHeight {
+		return result.Error("%v can not be unjailed until height %v", tx.Holder.Address.Hex(), releaseHeight).
+			WithErrorCode(result.CodeJailCooldownNotPassed)
+	}
+
+	return result.OK
+}
+
+func (exec *UnjailTxExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
+	tx := transaction.(*types.UnjailTx)
+
+	holderAccount, res := getInput(view, tx.Holder)
+	if res.IsError() {
+		return common.Hash{}, res
+	}
+
+	vlt := view.GetValidatorLivenessTracker()
+	blockHeight := view.Height() + 1
+	if err := vlt.Unjail(tx.Holder.Address, blockHeight); err != nil {
+		return common.Hash{}, result.Error("Failed to unjail: %v", err).WithErrorCode(result.CodeValidatorNotJailed)
+	}
+
+	if !chargeFee(view, holderAccount, tx.Fee) {
+		return common.Hash{}, result.Error("Failed to charge transaction fee")
+	}
+
+	view.UpdateValidatorLivenessTracker(vlt)
+
+	holderAccount.Sequence++
+	view.SetAccount(tx.Holder.Address, holderAccount)
+
+	txHash := types.TxID(chainID, tx)
+	return txHash, result.OK
+}
+
+func (exec *UnjailTxExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
+	tx := transaction.(*types.UnjailTx)
+	return &core.TxInfo{
+		Address:           tx.Holder.Address,
+		Sequence:          tx.Holder.Sequence,
+		EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction),
+	}
+}
+
+func (exec *UnjailTxExecutor) calculateEffectiveGasPrice(transaction types.Tx) *big.Int {
+	tx := transaction.(*types.UnjailTx)
+	fee := tx.Fee
+	gas := new(big.Int).SetUint64(types.GasUnjailTx)
+	effectiveGasPrice := new(big.Int).Div(fee.TFuelWei, gas)
+	return effectiveGasPrice
+}
@@ -0,0 +1,109 @@
+package execution
+
+import (
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+var _ TxExecutor = (*UpdateMultisigTxExecutor)(nil)
+
+// ------------------------------- UpdateMultisig Transaction -----------------------------------
+
+// UpdateMultisigTxExecutor implements the TxExecutor interface
+type UpdateMultisigTxExecutor struct {
+}
+
+// NewUpdateMultisigTxExecutor creates a new instance of UpdateMultisigTxExecutor
+func NewUpdateMultisigTxExecutor() *UpdateMultisigTxExecutor {
+	return &UpdateMultisigTxExecutor{}
+}
+
+func (exec *UpdateMultisigTxExecutor) sanityCheck(chainID string, view *st.StoreView, transaction types.Tx) result.Result {
+	tx := transaction.(*types.UpdateMultisigTx)
+
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight < common.HeightEnableMultisig {
+		return result.Error("The multisig accounts are not enabled until height %v", common.HeightEnableMultisig).
+			WithErrorCode(result.CodeMultisigNotEnabled)
+	}
+
+	res := tx.Account.ValidateBasic()
+	if res.IsError() {
+		return res
+	}
+
+	account, res := getInput(view, tx.Account)
+	if res.IsError() {
+		return res
+	}
+
+	// Signed by the account itself, or by the current owners if it is already a multisig account
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(account, signTargets, tx.Account)
+	if res.IsError() {
+		return res
+	}
+
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
+	}
+
+	if policy := tx.Policy(); policy != nil {
+		if err := policy.Validate(); err != nil {
+			return result.Error("Invalid multisig policy: %v", err).WithErrorCode(result.CodeInvalidMultisigPolicy)
+		}
+	} else if account.Multisig == nil {
+		return result.Error("%v is not a multisig account", tx.Account.Address.Hex()).
+			WithErrorCode(result.CodeInvalidMultisigPolicy)
+	}
+
+	if !account.Balance.IsGTE(tx.Fee) {
+		return result.Error("Insufficient fund: balance is %v, the fee is %v", account.Balance, tx.Fee).
+			WithErrorCode(result.CodeInsufficientFund)
+	}
+
+	return result.OK
+}
+
+func (exec *UpdateMultisigTxExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
+	tx := transaction.(*types.UpdateMultisigTx)
+
+	account, res := getInput(view, tx.Account)
+	if res.IsError() {
+		return common.Hash{}, res
+	}
+
+	if !chargeFee(view, account, tx.Fee) {
+		return common.Hash{}, result.Error("Failed to charge transaction fee")
+	}
+
+	account.Multisig = tx.Policy()
+	account.Sequence++
+	view.SetAccount(tx.Account.Address, account)
+
+	txHash := types.TxID(chainID, tx)
+	return txHash, result.OK
+}
+
+func (exec *UpdateMultisigTxExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
+	tx := transaction.(*types.UpdateMultisigTx)
+	return &core.TxInfo{
+		Address:           tx.Account.Address,
+		Sequence:          tx.Account.Sequence,
+		EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction),
+	}
+}
+
+func (exec *UpdateMultisigTxExecutor) calculateEffectiveGasPrice(transaction types.Tx) *big.Int {
+	tx := transaction.(*types.UpdateMultisigTx)
+	fee := tx.Fee
+	gas := new(big.Int).SetUint64(types.GasUpdateMultisigTx)
+	effectiveGasPrice := new(big.Int).Div(fee.TFuelWei, gas)
+	return effectiveGasPrice
+}
@@ -0,0 +1,159 @@
+package execution
+
+import (
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+var _ TxExecutor = (*UpdateValidatorKeyTxExecutor)(nil)
+
+// ------------------------------- UpdateValidatorKey Transaction -----------------------------------
+
+// UpdateValidatorKeyTxExecutor implements the TxExecutor interface
+type UpdateValidatorKeyTxExecutor struct {
+}
+
+// NewUpdateValidatorKeyTxExecutor creates a new instance of UpdateValidatorKeyTxExecutor
+func NewUpdateValidatorKeyTxExecutor() *UpdateValidatorKeyTxExecutor {
+	return &UpdateValidatorKeyTxExecutor{}
+}
+
+func (exec *UpdateValidatorKeyTxExecutor) sanityCheck(chainID string, view *st.StoreView, transaction types.Tx) result.Result {
+	tx := transaction.(*types.UpdateValidatorKeyTx)
+
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight < common.HeightEnableValidatorKeyRotation {
+		return result.Error("The validator key rotation is not enabled until height %v", common.HeightEnableValidatorKeyRotation).
+			WithErrorCode(result.CodeValidatorKeyRotationNotEnabled)
+	}
+
+	res := tx.Holder.ValidateBasic()
+	if res.IsError() {
+		return res
+	}
+	res = tx.NewHolder.ValidateBasic()
+	if res.IsError() {
+		return res
+	}
+
+	holderAccount, res := getInput(view, tx.Holder)
+	if res.IsError() {
+		return res
+	}
+
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(holderAccount, signTargets, tx.Holder)
+	if res.IsError() {
+		return res
+	}
+
+	// The new key signs the blocks and the votes, so it proves its possession with a plain signature
+	if tx.NewHolder.Signature == nil || tx.NewHolder.Signature.IsEmpty() ||
+		!signatureCache.Verify(tx.SignBytes(chainID), tx.NewHolder.Signature, tx.NewHolder.Address) {
+		return result.Error("Signature verification failed for the new holder %v", tx.NewHolder.Address.Hex()).
+			WithErrorCode(result.CodeInvalidSignature)
+	}
+
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
+	}
+
+	if !holderAccount.Balance.IsGTE(tx.Fee) {
+		return result.Error("Insufficient fund: balance is %v, the fee is %v", holderAccount.Balance, tx.Fee).
+			WithErrorCode(result.CodeInsufficientFund)
+	}
+
+	vcp := view.GetValidatorCandidatePool()
+	if vcp == nil || vcp.FindStakeDelegate(tx.Holder.Address) == nil {
+		return result.Error("%v does not hold any validator stake", tx.Holder.Address.Hex()).
+			WithErrorCode(result.CodeNotStakeHolder)
+	}
+	if vcp.FindStakeDelegate(tx.NewHolder.Address) != nil {
+		return result.Error("The new holder %v already holds validator stakes", tx.NewHolder.Address.Hex()).
+			WithErrorCode(result.CodeInvalidNewValidatorKey)
+	}
+	if _, rotated := view.GetRotatedValidatorKey(tx.NewHolder.Address); rotated {
+		return result.Error("The new holder %v is a rotated out validator key", tx.NewHolder.Address.Hex()).
+			WithErrorCode(result.CodeValidatorKeyRotated)
+	}
+
+	// A jailed validator can not get out of jail with a new key, and the new key starts with a clean record
+	vlt := view.GetValidatorLivenessTracker()
+	if vlt.IsJailed(tx.Holder.Address) {
+		return result.Error("%v is jailed, it needs to be unjailed first", tx.Holder.Address.Hex()).
+			WithErrorCode(result.CodeJailedValidatorKeyRotation)
+	}
+	if vlt.Get(tx.NewHolder.Address) != nil {
+		return result.Error("The new holder %v has a liveness record", tx.NewHolder.Address.Hex()).
+			WithErrorCode(result.CodeInvalidNewValidatorKey)
+	}
+
+	return result.OK
+}
+
+// NOTE: the validator set reflects the new key from the effective height of the stake change on, the blocks
+// and the votes signed by the current key are accepted until then
+func (exec *UpdateValidatorKeyTxExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
+	tx := transaction.(*types.UpdateValidatorKeyTx)
+	holder, newHolder := tx.Holder.Address, tx.NewHolder.Address
+
+	holderAccount, res := getInput(view, tx.Holder)
+	if res.IsError() {
+		return common.Hash{}, res
+	}
+
+	if !chargeFee(view, holderAccount, tx.Fee) {
+		return common.Hash{}, result.Error("Failed to charge transaction fee")
+	}
+
+	vcp := view.GetValidatorCandidatePool()
+	sources := []common.Address{}
+	for _, stake := range vcp.FindStakeDelegate(holder).Stakes {
+		sources = append(sources, stake.Source)
+	}
+	if err := vcp.ReplaceStakeHolder(holder, newHolder); err != nil {
+		return common.Hash{}, result.Error("Failed to replace the stake holder: %v", err).
+			WithErrorCode(result.CodeInvalidNewValidatorKey)
+	}
+	view.UpdateValidatorCandidatePool(vcp)
+	view.RotateValidatorKey(holder, newHolder, sources)
+
+	vlt := view.GetValidatorLivenessTracker()
+	vlt.ReplaceValidator(holder, newHolder)
+	view.UpdateValidatorLivenessTracker(vlt)
+	if tit := view.GetTxInclusionTracker(); tit.NumUnderfilledBlocks(holder) > 0 {
+		tit.ReplaceProposer(holder, newHolder)
+		view.UpdateTxInclusionTracker(tit)
+	}
+
+	effectiveHeight := recordStakeTransaction(view)
+
+	holderAccount.Sequence++
+	view.SetAccount(holder, holderAccount)
+
+	txHash := types.TxID(chainID, tx)
+	return txHash, result.OKWith(result.Info{"validatorSetEffectiveHeight": effectiveHeight})
+}
+
+func (exec *UpdateValidatorKeyTxExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
+	tx := transaction.(*types.UpdateValidatorKeyTx)
+	return &core.TxInfo{
+		Address:           tx.Holder.Address,
+		Sequence:          tx.Holder.Sequence,
+		EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction),
+	}
+}
+
+func (exec *UpdateValidatorKeyTxExecutor) calculateEffectiveGasPrice(transaction types.Tx) *big.Int {
+	tx := transaction.(*types.UpdateValidatorKeyTx)
+	fee := tx.Fee
+	gas := new(big.Int).SetUint64(types.GasUpdateValidatorKeyTx)
+	effectiveGasPrice := new(big.Int).Div(fee.TFuelWei, gas)
+	return effectiveGasPrice
+}
@@ -0,0 +1,112 @@
+package execution
+
+import (
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+var _ TxExecutor = (*UpdateValidatorMetadataTxExecutor)(nil)
+
+// ------------------------------- UpdateValidatorMetadata Transaction -----------------------------------
+
+// UpdateValidatorMetadataTxExecutor implements the TxExecutor interface
+type UpdateValidatorMetadataTxExecutor struct {
+}
+
+// NewUpdateValidatorMetadataTxExecutor creates a new instance of UpdateValidatorMetadataTxExecutor
+func NewUpdateValidatorMetadataTxExecutor() *UpdateValidatorMetadataTxExecutor {
+	return &UpdateValidatorMetadataTxExecutor{}
+}
+
+func (exec *UpdateValidatorMetadataTxExecutor) sanityCheck(chainID string, view *st.StoreView, transaction types.Tx) result.Result {
+	tx := transaction.(*types.UpdateValidatorMetadataTx)
+
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight < common.HeightEnableValidatorMetadata {
+		return result.Error("The validator metadata is not enabled until height %v", common.HeightEnableValidatorMetadata).
+			WithErrorCode(result.CodeValidatorMetadataNotEnabled)
+	}
+
+	res := tx.Holder.ValidateBasic()
+	if res.IsError() {
+		return res
+	}
+
+	res = tx.Metadata.Validate()
+	if res.IsError() {
+		return res
+	}
+
+	holderAccount, res := getInput(view, tx.Holder)
+	if res.IsError() {
+		return res
+	}
+
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(holderAccount, signTargets, tx.Holder)
+	if res.IsError() {
+		return res
+	}
+
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
+	}
+
+	if !holderAccount.Balance.IsGTE(tx.Fee) {
+		return result.Error("Insufficient fund: balance is %v, the fee is %v", holderAccount.Balance, tx.Fee).
+			WithErrorCode(result.CodeInsufficientFund)
+	}
+
+	// Only the addresses holding a validator or a guardian stake have metadata
+	vcp := view.GetValidatorCandidatePool()
+	if (vcp == nil || vcp.FindStakeDelegate(tx.Holder.Address) == nil) &&
+		view.GetGuardianCandidatePool().FindStakeDelegate(tx.Holder.Address) == nil {
+		return result.Error("%v does not hold any stake", tx.Holder.Address.Hex()).WithErrorCode(result.CodeNotStakeHolder)
+	}
+
+	return result.OK
+}
+
+func (exec *UpdateValidatorMetadataTxExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
+	tx := transaction.(*types.UpdateValidatorMetadataTx)
+
+	holderAccount, res := getInput(view, tx.Holder)
+	if res.IsError() {
+		return common.Hash{}, res
+	}
+
+	if !chargeFee(view, holderAccount, tx.Fee) {
+		return common.Hash{}, result.Error("Failed to charge transaction fee")
+	}
+
+	view.SetValidatorMetadata(tx.Holder.Address, tx.Metadata)
+
+	holderAccount.Sequence++
+	view.SetAccount(tx.Holder.Address, holderAccount)
+
+	txHash := types.TxID(chainID, tx)
+	return txHash, result.OK
+}
+
+func (exec *UpdateValidatorMetadataTxExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
+	tx := transaction.(*types.UpdateValidatorMetadataTx)
+	return &core.TxInfo{
+		Address:           tx.Holder.Address,
+		Sequence:          tx.Holder.Sequence,
+		EffectiveGasPrice: exec.calculateEffectiveGasPrice(transaction),
+	}
+}
+
+func (exec *UpdateValidatorMetadataTxExecutor) calculateEffectiveGasPrice(transaction types.Tx) *big.Int {
+	tx := transaction.(*types.UpdateValidatorMetadataTx)
+	fee := tx.Fee
+	gas := new(big.Int).SetUint64(types.GasUpdateValidatorMetadataTx)
+	effectiveGasPrice := new(big.Int).Div(fee.TFuelWei, gas)
+	return effectiveGasPrice
+}
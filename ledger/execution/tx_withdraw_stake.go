@@ -37,39 +37,113 @@ func (exec *WithdrawStakeExecutor) sanityCheck(chainID string, view *st.StoreVie
 
 	sourceAccount, success := getInput(view, tx.Source)
 	if success.IsError() {
-		return result.Error("Failed to get the source account: %v", tx.Source.Address)
+		return result.Error("Failed to get the source account: %v", tx.Source.Address).WithErrorCode(result.CodeUnknownAccount)
 	}
 
-	signBytes := tx.SignBytes(chainID)
-	res = validateInputAdvanced(sourceAccount, signBytes, tx.Source)
+	signTargets := txSignTargets(chainID, view, tx)
+	res = validateInputAdvanced(sourceAccount, signTargets, tx.Source)
 	if res.IsError() {
 		logger.Warnf(fmt.Sprintf("validateSourceAdvanced failed on %v: %v", tx.Source.Address.Hex(), res))
 		return res
 	}
 
-	if !sanityCheckForFee(tx.Fee) {
-		return result.Error("Insufficient fee. Transaction fee needs to be at least %v TFuelWei",
-			types.MinimumTransactionFeeTFuelWei).WithErrorCode(result.CodeInvalidFee)
+	res = sanityCheckForFee(view, tx, tx.Fee)
+	if res.IsError() {
+		return res
 	}
 
-	if !(tx.Purpose == core.StakeForValidator || tx.Purpose == core.StakeForGuardian) {
-		return result.Error("Invalid stake purpose!").
-			WithErrorCode(result.CodeInvalidStakePurpose)
+	res = sanityCheckForStakePurpose(view, tx.Purpose)
+	if res.IsError() {
+		return res
 	}
 
 	minimalBalance := tx.Fee
 	if !sourceAccount.Balance.IsGTE(minimalBalance) {
 		logger.Infof(fmt.Sprintf("WithdrawStake: Source did not have enough balance %v", tx.Source.Address.Hex()))
 		return result.Error("WithdrawStake: Source balance is %v, but required minimal balance is %v",
-			sourceAccount.Balance, minimalBalance)
+			sourceAccount.Balance, minimalBalance).WithErrorCode(result.CodeInsufficientFund)
+	}
+
+	res = sanityCheckForStakeWithdrawal(view, tx.Source.Address, tx.Holder.Address, tx.Purpose)
+	if res.IsError() {
+		return res
+	}
+
+	if tx.ReturnAddress != nil {
+		if view.Height()+1 < common.HeightEnableStakeReturnAddress {
+			return result.Error("The stake return address is not enabled until height %v", common.HeightEnableStakeReturnAddress).
+				WithErrorCode(result.CodeInvalidReturnAddress)
+		}
+		if *tx.ReturnAddress == (common.Address{}) {
+			return result.Error("The stake can not be returned to the zero address").
+				WithErrorCode(result.CodeInvalidReturnAddress)
+		}
+	}
+
+	return sanityCheckForStakeReturnAddress(view, tx.Source.Address, tx.Holder.Address, tx.Purpose, tx.ReturnTo(), exec.state.Height())
+}
+
+// sanityCheckForStakeReturnAddress checks that the stake withdrawn at the current height returns to the same address
+// as the other withdrawals of the pair due at the same height, e.g. after a deposit and a withdrawal within the block
+func sanityCheckForStakeReturnAddress(view *st.StoreView, source common.Address, holder common.Address, purpose uint8,
+	returnTo common.Address, currentHeight uint64) result.Result {
+	returnHeight := stakeReturnHeight(view, purpose, currentHeight)
+	var pendingReturns []core.PendingStakeReturn
+	if purpose == core.StakeForValidator {
+		pendingReturns = view.GetValidatorCandidatePool().PendingStakeReturns(source)
+	} else {
+		pendingReturns = view.GetGuardianCandidatePool().PendingStakeReturns(source)
+	}
+	for _, pendingReturn := range pendingReturns {
+		if pendingReturn.Holder != holder || pendingReturn.ReturnHeight != returnHeight {
+			continue
+		}
+		returnAddress, ok := view.GetStakeReturnAddress(purpose, holder, source, returnHeight)
+		if !ok {
+			returnAddress = source
+		}
+		if returnAddress != returnTo {
+			return result.Error("Another withdrawal returns the stake at height %v to %v", returnHeight, returnAddress.Hex()).
+				WithErrorCode(result.CodeReturnAddressConflict)
+		}
+	}
+
+	return result.OK
+}
+
+// sanityCheckForStakeWithdrawal checks that the source has an active stake deposited to the holder for the
+// purpose, whether the withdrawal is initiated by the source or by the holder
+func sanityCheckForStakeWithdrawal(view *st.StoreView, source common.Address, holder common.Address, purpose uint8) result.Result {
+	if purpose == core.StakeForValidator {
+		vcp := view.GetValidatorCandidatePool()
+		stake := vcp.FindStake(source, holder)
+		if stake == nil {
+			return result.Error("No stake deposited by %v to %v", source.Hex(), holder.Hex()).
+				WithErrorCode(result.CodeStakeNotFound)
+		}
+		if vcp.FindActiveStake(source, holder) == nil {
+			return result.Error("The stake is already withdrawn, it returns at height %v", stake.ReturnHeight).
+				WithErrorCode(result.CodeStakeAlreadyWithdrawn)
+		}
+	} else if purpose == core.StakeForGuardian {
+		gcp := view.GetGuardianCandidatePool()
+		stake := gcp.FindStake(source, holder)
+		if stake == nil {
+			return result.Error("No guardian stake deposited by %v to %v", source.Hex(), holder.Hex()).
+				WithErrorCode(result.CodeStakeNotFound)
+		}
+		if gcp.FindActiveStake(source, holder) == nil {
+			return result.Error("The guardian stake is already withdrawn, it returns at height %v", stake.ReturnHeight).
+				WithErrorCode(result.CodeStakeAlreadyWithdrawn)
+		}
 	}
 
 	return result.OK
 }
 
 // NOTE: WithdrawStakeExecutor.process() does NOT return the stake to the source. Instead, it updates
-//       the ReturnHeight of the withdrawn stake. The stake will be returned to the source when
-//       the block height reaches the ReturnHeigth
+//       the ReturnHeight of the withdrawn stake. The stake will be returned to the source, or to the
+//       return address of the tx, when the block height reaches the ReturnHeigth
 func (exec *WithdrawStakeExecutor) process(chainID string, view *st.StoreView, transaction types.Tx) (common.Hash, result.Result) {
 	tx := transaction.(*types.WithdrawStakeTx)
 
@@ -78,40 +152,69 @@ func (exec *WithdrawStakeExecutor) process(chainID string, view *st.StoreView, t
 		return common.Hash{}, result.Error("Failed to get the source account")
 	}
 
-	if !chargeFee(sourceAccount, tx.Fee) {
+	if !chargeFee(view, sourceAccount, tx.Fee) {
 		return common.Hash{}, result.Error("Failed to charge transaction fee")
 	}
 
 	sourceAddress := tx.Source.Address
-	holderAddress := tx.Holder.Address
+	res := withdrawStake(view, sourceAddress, tx.Holder.Address, tx.Purpose, exec.state.Height())
+	if res.IsError() {
+		return common.Hash{}, res
+	}
+
+	if returnAddress := tx.ReturnTo(); returnAddress != sourceAddress {
+		returnHeight := stakeReturnHeight(view, tx.Purpose, exec.state.Height())
+		view.SetStakeReturnAddress(tx.Purpose, tx.Holder.Address, sourceAddress, returnHeight, returnAddress)
+	}
+
+	effectiveHeight := recordStakeTransaction(view)
+
+	sourceAccount.Sequence++
+	view.SetAccount(sourceAddress, sourceAccount)
+
+	txHash := types.TxID(chainID, tx)
+	return txHash, result.OKWith(result.Info{"validatorSetEffectiveHeight": effectiveHeight})
+}
 
-	if tx.Purpose == core.StakeForValidator {
+// withdrawStake withdraws the active stake of the source from the holder, to be returned to the source after the
+// locking period of the purpose. It is the same whether the withdrawal is initiated by the source or by the holder.
+func withdrawStake(view *st.StoreView, source common.Address, holder common.Address, purpose uint8, currentHeight uint64) result.Result {
+	if purpose == core.StakeForValidator {
 		vcp := view.GetValidatorCandidatePool()
-		currentHeight := exec.state.Height()
-		err := vcp.WithdrawStake(sourceAddress, holderAddress, currentHeight)
+		var err error
+		if view.Height()+1 >= common.HeightEnableStakingParams {
+			err = vcp.WithdrawStakeWithLockingPeriod(source, holder, currentHeight, view.GetReturnLockingPeriod())
+		} else {
+			err = vcp.WithdrawStake(source, holder, currentHeight)
+		}
 		if err != nil {
-			return common.Hash{}, result.Error("Failed to withdraw stake, err: %v", err)
+			return result.Error("Failed to withdraw stake, err: %v", err).WithErrorCode(result.CodeStakeNotFound)
 		}
 		view.UpdateValidatorCandidatePool(vcp)
-	} else if tx.Purpose == core.StakeForGuardian {
-		return common.Hash{}, result.Error("Withdraw stake for guardian not supported yet")
+	} else if purpose == core.StakeForGuardian {
+		gcp := view.GetGuardianCandidatePool()
+		err := gcp.WithdrawStake(source, holder, currentHeight)
+		if err != nil {
+			return result.Error("Failed to withdraw guardian stake, err: %v", err).WithErrorCode(result.CodeStakeNotFound)
+		}
+		view.UpdateGuardianCandidatePool(gcp)
 	} else {
-		return common.Hash{}, result.Error("Invalid staking purpose").WithErrorCode(result.CodeInvalidStakePurpose)
+		// A purpose registered for a fork without a stake pool to handle it
+		return result.Error("Withdraw stake for %v not supported", core.StakePurposeName(purpose)).
+			WithErrorCode(result.CodeStakingNotSupported)
 	}
+	return result.OK
+}
 
-	hl := view.GetStakeTransactionHeightList()
-	if hl == nil {
-		hl = &types.HeightList{}
+// stakeReturnHeight returns the height the stake withdrawn for the purpose at the current height is returned at
+func stakeReturnHeight(view *st.StoreView, purpose uint8, currentHeight uint64) uint64 {
+	if purpose == core.StakeForGuardian {
+		return currentHeight + core.GuardianReturnLockingPeriod
 	}
-	blockHeight := view.Height() + 1 // the view points to the parent of the current block
-	hl.Append(blockHeight)
-	view.UpdateStakeTransactionHeightList(hl)
-
-	sourceAccount.Sequence++
-	view.SetAccount(sourceAddress, sourceAccount)
-
-	txHash := types.TxID(chainID, tx)
-	return txHash, result.OK
+	if view.Height()+1 >= common.HeightEnableStakingParams {
+		return currentHeight + view.GetReturnLockingPeriod()
+	}
+	return currentHeight + core.ReturnLockingPeriod
 }
 
 func (exec *WithdrawStakeExecutor) getTxInfo(transaction types.Tx) *core.TxInfo {
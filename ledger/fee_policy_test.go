@@ -0,0 +1,198 @@
+package ledger
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+func TestLedgerFeeDistribution(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	viper.Set(common.CfgLedgerBalanceJournalEnabled, true)
+	defer viper.Set(common.CfgLedgerBalanceJournalEnabled, false)
+
+	rewardSchedule := func(blockHeight uint64, epoch uint64, validatorSet *core.ValidatorSet) *big.Int {
+		return big.NewInt(4000)
+	}
+	chainID, ledger, _ := newRewardTestLedger(rewardSchedule)
+	txFee := getMinimumTxFee()
+
+	initBalance := types.NewCoins(1000, 1000*txFee)
+	recipient := types.MakeAccWithInitBalance("recipient", types.NewCoins(0, 0))
+	senders := []types.PrivAccount{}
+	view := ledger.state.Delivered()
+	for _, name := range []string{"sender1", "sender2", "sender3"} {
+		sender := types.MakeAccWithInitBalance(name, initBalance)
+		view.SetAccount(sender.Address, &sender.Account)
+		senders = append(senders, sender)
+	}
+	view.SetAccount(recipient.Address, &recipient.Account)
+	view.UpdateTotalSupply(types.NewCoins(1000000, 1000000*txFee))
+	view.UpdateFeePolicy(&types.FeePolicy{BurnPercentage: 30})
+	ledger.state.Commit()
+
+	// No block reward is granted at the heights other than the checkpoints, so that the coinbase tx only
+	// pays out the fees claimed by the proposer
+	height := common.HeightEnableFeeDistribution
+	for common.IsCheckPointHeight(height) || common.IsCheckPointHeight(height+1) || common.IsCheckPointHeight(height+2) {
+		height++
+	}
+	require.True(ledger.ResetState(height-1, ledger.state.Delivered().Hash()).IsOK())
+
+	proposeBlock := func(height uint64, rawTxs ...common.Bytes) (*core.Block, common.Hash) {
+		for _, rawTx := range rawTxs {
+			require.Nil(ledger.mempool.InsertTransaction(rawTx))
+		}
+		parentRoot := ledger.state.Delivered().Hash()
+
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Epoch = 1
+		block.Height = height
+		stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+		require.Equal(len(rawTxs)+1, len(blockRawTxs))
+		block.StateHash = stateRoot
+		block.Txs = blockRawTxs
+		return block, parentRoot
+	}
+
+	// The invariant: the fees charged by the txs of a block are either burned or set aside for the proposer,
+	// and the fees claimed by the coinbase tx are the ones set aside by the previous blocks
+	applyBlock := func(height uint64, rawTxs ...common.Bytes) (charged, burned, distributed types.Coins) {
+		block, parentRoot := proposeBlock(height, rawTxs...)
+		require.True(ledger.ResetState(height-1, parentRoot).IsOK())
+
+		parent := ledger.state.Delivered()
+		burnedBefore, undistributedBefore := parent.GetBurnedFees(), parent.GetUndistributedFees()
+		supplyBefore := *parent.GetTotalSupply()
+
+		coinbaseTx, err := types.TxFromBytes(block.Txs[0])
+		require.Nil(err)
+		coinbase := coinbaseTx.(*types.CoinbaseTx)
+		proposer := coinbase.Proposer.Address
+		proposerBalanceBefore := parent.GetAccount(proposer).Balance
+
+		receipts, res := ledger.ApplyBlockTxsWithReceipts(block)
+		require.True(res.IsOK(), res.Message)
+
+		charged = types.NewCoins(0, 0)
+		for _, receipt := range receipts {
+			charged = charged.Plus(receipt.Fee)
+		}
+		claimed := types.NewCoins(0, 0)
+		for _, output := range coinbase.Outputs {
+			claimed = claimed.Plus(output.Coins)
+		}
+
+		view := ledger.state.Delivered()
+		burned = view.GetBurnedFees().Minus(burnedBefore)
+		distributed = view.GetUndistributedFees().Minus(undistributedBefore).Plus(claimed)
+		assert.True(charged.IsEqual(burned.Plus(distributed)), "charged %v, burned %v, distributed %v", charged, burned, distributed)
+
+		// The proposer claims exactly the fees set aside, which were never taken out of the total supply
+		assert.True(claimed.IsEqual(undistributedBefore))
+		assert.True(view.GetAccount(proposer).Balance.IsEqual(proposerBalanceBefore.Plus(claimed)))
+		assert.True(view.GetTotalSupply().IsEqual(supplyBefore.Minus(burned)))
+
+		// The balance changes add up to the issuance, with the fees set aside held by the zero address
+		blockChanges, err := ledger.GetBalanceChanges(block.Hash())
+		require.Nil(err)
+		tfuelSum := new(big.Int)
+		for _, change := range blockChanges.Changes {
+			if change.Asset == types.DenomTFuelWei && change.Holding != types.HoldingBurnedFee {
+				tfuelSum.Add(tfuelSum, change.Delta)
+			}
+		}
+		assert.Equal(0, tfuelSum.Add(tfuelSum, burned.TFuelWei).Cmp(blockChanges.Issuance.TFuelWei))
+		assert.Equal(0, blockChanges.Issuance.TFuelWei.Sign())
+		return charged, burned, distributed
+	}
+
+	// Block #1: the fees are split, 30% burned and 70% set aside for the proposer of the next block
+	charged, burned, distributed := applyBlock(height,
+		newRawSendTx(chainID, 1, true, recipient, senders[0], false),
+		newRawSendTx(chainID, 1, true, recipient, senders[1], false),
+		newRawSendTx(chainID, 1, true, recipient, senders[2], false))
+	assert.True(charged.IsEqual(types.NewCoins(0, 3*txFee)))
+	expectedBurned, expectedDistributed := (&types.FeePolicy{BurnPercentage: 30}).Split(charged)
+	assert.True(burned.IsEqual(expectedBurned))
+	assert.True(distributed.IsEqual(expectedDistributed))
+	assert.True(ledger.state.Delivered().GetUndistributedFees().IsEqual(expectedDistributed))
+	assert.True(ledger.state.Delivered().GetBurnedFees().IsEqual(expectedBurned))
+
+	// Block #2: the proposer claims the fees of block #1
+	charged, burned, distributed = applyBlock(height+1, newRawSendTx(chainID, 2, true, recipient, senders[0], false))
+	assert.True(charged.IsEqual(types.NewCoins(0, txFee)))
+	assert.True(ledger.state.Delivered().GetBurnedFees().IsEqual(expectedBurned.Plus(burned)))
+
+	// The coinbase tx claiming more or less than the fees set aside is rejected
+	block, parentRoot := proposeBlock(height + 2)
+	require.True(ledger.ResetState(height+1, parentRoot).IsOK())
+	ledger.state.Delivered().AddUndistributedFees(types.NewCoins(0, 1))
+	receipts, res := ledger.ApplyBlockTxsWithReceipts(block)
+	assert.True(res.IsError())
+	require.Equal(1, len(receipts))
+	assert.NotEqual(uint64(0), receipts[0].Code)
+
+	// Block #3: the proposer claims the fees of block #2, and no fee is charged
+	require.True(ledger.ResetState(height+1, parentRoot).IsOK())
+	charged, burned, distributed = applyBlock(height + 2)
+	assert.True(charged.IsZero())
+	assert.True(burned.IsZero())
+	assert.True(distributed.IsZero())
+	assert.True(ledger.state.Delivered().GetUndistributedFees().IsZero())
+}
+
+func TestLedgerFeeBurningBeforeFork(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	rewardSchedule := func(blockHeight uint64, epoch uint64, validatorSet *core.ValidatorSet) *big.Int {
+		return big.NewInt(4000)
+	}
+	chainID, ledger, _ := newRewardTestLedger(rewardSchedule)
+	txFee := getMinimumTxFee()
+
+	sender := types.MakeAccWithInitBalance("sender", types.NewCoins(1000, 1000*txFee))
+	recipient := types.MakeAccWithInitBalance("recipient", types.NewCoins(0, 0))
+	view := ledger.state.Delivered()
+	view.SetAccount(sender.Address, &sender.Account)
+	view.SetAccount(recipient.Address, &recipient.Account)
+	supply := types.NewCoins(1000000, 1000000*txFee)
+	view.UpdateTotalSupply(supply)
+	view.UpdateFeePolicy(&types.FeePolicy{BurnPercentage: 30})
+	ledger.state.Commit()
+
+	// The fees are burned entirely before the fork, regardless of the fee policy
+	height := common.HeightEnableFeeDistribution - 1
+	for common.IsCheckPointHeight(height) {
+		height--
+	}
+	require.True(ledger.ResetState(height-1, ledger.state.Delivered().Hash()).IsOK())
+	require.Nil(ledger.mempool.InsertTransaction(newRawSendTx(chainID, 1, true, recipient, sender, false)))
+	parentRoot := ledger.state.Delivered().Hash()
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Epoch = 1
+	block.Height = height
+	stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(block)
+	require.True(res.IsOK(), res.Message)
+	require.True(ledger.ResetState(height-1, parentRoot).IsOK())
+	block.StateHash = stateRoot
+	block.Txs = blockRawTxs
+	require.True(ledger.ApplyBlockTxs(block).IsOK())
+
+	view = ledger.state.Delivered()
+	assert.True(view.GetTotalSupply().IsEqual(supply.Minus(types.NewCoins(0, txFee))))
+	assert.True(view.GetUndistributedFees().IsZero())
+	assert.True(view.GetBurnedFees().IsZero())
+}
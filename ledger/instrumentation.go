@@ -0,0 +1,176 @@
+package ledger
+
+import (
+	"time"
+
+	"github.com/thetatoken/theta/common/metrics"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+// Phases of the block proposal and application reported to the Instrumentation
+const (
+	PhaseProposeReap      = "propose/reap"       // peeking and reaping the candidate txs from the mempool
+	PhaseProposeExecute   = "propose/execute"    // checking and executing the special and the candidate txs
+	PhaseProposeStateRoot = "propose/state_root" // computing the state root of the proposal
+	PhaseApplyExecute     = "apply/execute"      // executing the block txs
+	PhaseApplyStateRoot   = "apply/state_root"   // computing the state root to compare with the block's
+	PhaseApplyCommit      = "apply/commit"       // committing the state to the persistent storage
+)
+
+//
+// Instrumentation receives the timings of the block proposal and application. The methods are
+// invoked with the ledger lock held, and ObserveTx also from the parallel tx execution workers, so
+// the implementations must be concurrency-safe and return quickly.
+//
+type Instrumentation interface {
+	// ObservePhase records the time a block proposal or application spent in the given phase
+	ObservePhase(phase string, elapsed time.Duration)
+
+	// ObserveTx records the execution time of a block tx of the given type during the block application
+	ObserveTx(txType string, elapsed time.Duration)
+
+	// CountDroppedTx counts a proposal candidate tx of the given type dropped since it failed the execution
+	CountDroppedTx(txType string)
+}
+
+// noopInstrumentation is the default Instrumentation. The ledger does not take the timings at all
+// when it is in use.
+type noopInstrumentation struct{}
+
+func (noopInstrumentation) ObservePhase(phase string, elapsed time.Duration) {}
+func (noopInstrumentation) ObserveTx(txType string, elapsed time.Duration)   {}
+func (noopInstrumentation) CountDroppedTx(txType string)                     {}
+
+// SetInstrumentation sets the receiver of the block proposal and application timings. A nil
+// instrumentation disables the measurements.
+func (ledger *Ledger) SetInstrumentation(instrumentation Instrumentation) {
+	if instrumentation == nil {
+		instrumentation = noopInstrumentation{}
+	}
+	ledger.instrumentation = instrumentation
+}
+
+func (ledger *Ledger) instrumentationEnabled() bool {
+	if ledger.instrumentation == nil { // e.g. the scratch ledgers
+		return false
+	}
+	_, noop := ledger.instrumentation.(noopInstrumentation)
+	return !noop
+}
+
+// span measures the time spent in a phase, e.g. defer ledger.startSpan(PhaseApplyCommit).end()
+type span struct {
+	instrumentation Instrumentation
+	phase           string
+	start           time.Time
+}
+
+// startSpan returns the span of the given phase starting now, or nil if the instrumentation is disabled
+func (ledger *Ledger) startSpan(phase string) *span {
+	if !ledger.instrumentationEnabled() {
+		return nil
+	}
+	return &span{
+		instrumentation: ledger.instrumentation,
+		phase:           phase,
+		start:           time.Now(),
+	}
+}
+
+func (s *span) end() {
+	if s == nil {
+		return
+	}
+	s.instrumentation.ObservePhase(s.phase, time.Since(s.start))
+}
+
+func (ledger *Ledger) countDroppedTx(tx types.Tx) {
+	if ledger.instrumentationEnabled() {
+		ledger.instrumentation.CountDroppedTx(txTypeName(tx))
+	}
+}
+
+// txTypeName returns the name of the tx type used in the metric names
+func txTypeName(tx types.Tx) string {
+	switch tx.(type) {
+	case *types.CoinbaseTx:
+		return "coinbase"
+	case *types.SlashTx:
+		return "slash"
+	case *types.SendTx:
+		return "send"
+	case *types.ReserveFundTx:
+		return "reserve_fund"
+	case *types.ReleaseFundTx:
+		return "release_fund"
+	case *types.ServicePaymentTx:
+		return "service_payment"
+	case *types.SplitRuleTx:
+		return "split_rule"
+	case *types.SmartContractTx:
+		return "smart_contract"
+	case *types.DepositStakeTx:
+		return "deposit_stake"
+	case *types.WithdrawStakeTx:
+		return "withdraw_stake"
+	case *types.PartialReleaseFundTx:
+		return "partial_release_fund"
+	case *types.ExtendSplitRuleTx:
+		return "extend_split_rule"
+	case *types.SweepAccountTx:
+		return "sweep_account"
+	case *types.BurnTx:
+		return "burn"
+	case *types.DoubleSignSlashTx:
+		return "double_sign_slash"
+	case *types.StakeCommissionTx:
+		return "stake_commission"
+	case *types.CancelWithdrawTx:
+		return "cancel_withdraw"
+	case *types.UpdateValidatorMetadataTx:
+		return "update_validator_metadata"
+	case *types.UnjailTx:
+		return "unjail"
+	case *types.EjectStakeTx:
+		return "eject_stake"
+	case *types.UpdateValidatorKeyTx:
+		return "update_validator_key"
+	case types.CustomTx:
+		return "custom"
+	}
+	return "unknown"
+}
+
+// metricsInstrumentation reports the timings as metrics, which are no-ops unless metrics.Enabled
+type metricsInstrumentation struct {
+	registry metrics.Registry
+}
+
+// NewMetricsInstrumentation creates an Instrumentation registering the metrics below in the given
+// registry, or in metrics.DefaultRegistry if it is nil:
+//
+//	ledger/<phase>                 timer of each phase, e.g. ledger/propose/reap
+//	ledger/apply/tx/<tx type>      timer of the block tx execution, e.g. ledger/apply/tx/send
+//	ledger/propose/dropped         counter of the proposal candidate txs failing the execution
+//	ledger/propose/dropped/<tx type>
+func NewMetricsInstrumentation(registry metrics.Registry) Instrumentation {
+	if registry == nil {
+		registry = metrics.DefaultRegistry
+	}
+	return &metricsInstrumentation{
+		registry: registry,
+	}
+}
+
+func (mi *metricsInstrumentation) ObservePhase(phase string, elapsed time.Duration) {
+	metrics.GetOrRegisterTimer("ledger/"+phase, mi.registry).Update(elapsed)
+}
+
+func (mi *metricsInstrumentation) ObserveTx(txType string, elapsed time.Duration) {
+	metrics.GetOrRegisterTimer("ledger/apply/tx/"+txType, mi.registry).Update(elapsed)
+}
+
+func (mi *metricsInstrumentation) CountDroppedTx(txType string) {
+	metrics.GetOrRegisterCounter("ledger/propose/dropped", mi.registry).Inc(1)
+	metrics.GetOrRegisterCounter("ledger/propose/dropped/"+txType, mi.registry).Inc(1)
+}
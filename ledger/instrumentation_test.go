@@ -0,0 +1,132 @@
+package ledger
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common/metrics"
+	"github.com/thetatoken/theta/core"
+)
+
+type recordingInstrumentation struct {
+	mu      *sync.Mutex
+	phases  map[string]int
+	txs     map[string]int
+	dropped map[string]int
+}
+
+func newRecordingInstrumentation() *recordingInstrumentation {
+	return &recordingInstrumentation{
+		mu:      &sync.Mutex{},
+		phases:  make(map[string]int),
+		txs:     make(map[string]int),
+		dropped: make(map[string]int),
+	}
+}
+
+func (ri *recordingInstrumentation) ObservePhase(phase string, elapsed time.Duration) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	ri.phases[phase]++
+}
+
+func (ri *recordingInstrumentation) ObserveTx(txType string, elapsed time.Duration) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	ri.txs[txType]++
+}
+
+func (ri *recordingInstrumentation) CountDroppedTx(txType string) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	ri.dropped[txType]++
+}
+
+func TestLedgerInstrumentation(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, mempool := newTestLedger()
+	assert.False(ledger.instrumentationEnabled())
+	instrumentation := newRecordingInstrumentation()
+	ledger.SetInstrumentation(instrumentation)
+	assert.True(ledger.instrumentationEnabled())
+
+	accOut, accIns := prepareInitLedgerState(ledger, 3)
+	for _, accIn := range accIns {
+		require.Nil(mempool.InsertTransaction(newRawSendTx(chainID, 1, true, accOut, accIn, false)))
+	}
+
+	// The tx of the last account fails the execution once its sequence has been used up
+	account := ledger.state.Delivered().GetAccount(accIns[2].Address)
+	account.Sequence = 1
+	ledger.state.Delivered().SetAccount(accIns[2].Address, account)
+	ledger.state.Commit()
+
+	_, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(2, len(blockRawTxs))
+	assert.Equal(map[string]int{"send": 1}, instrumentation.dropped)
+	assert.Equal(map[string]int{
+		PhaseProposeReap:      1,
+		PhaseProposeExecute:   1,
+		PhaseProposeStateRoot: 1,
+	}, instrumentation.phases)
+	assert.Equal(0, len(instrumentation.txs))
+
+	// The block application is timed per tx type
+	instrumentation.phases = make(map[string]int)
+	ledger.proposalResult = nil // executes the txs again
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Height = ledger.state.Height() + 1
+	block.StateHash = simulateBlockStateRoot(t, ledger, blockRawTxs...)
+	block.Txs = blockRawTxs
+	res = ledger.ApplyBlockTxs(block)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(map[string]int{
+		PhaseApplyExecute:   1,
+		PhaseApplyStateRoot: 1,
+		PhaseApplyCommit:    1,
+	}, instrumentation.phases)
+	assert.Equal(map[string]int{"send": 2}, instrumentation.txs)
+
+	// Nothing is measured once disabled
+	ledger.SetInstrumentation(nil)
+	assert.False(ledger.instrumentationEnabled())
+	instrumentation.phases = make(map[string]int)
+	_, _, res = ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(0, len(instrumentation.phases))
+}
+
+func TestMetricsInstrumentation(t *testing.T) {
+	assert := assert.New(t)
+
+	metrics.Enabled = true
+	defer func() { metrics.Enabled = false }()
+
+	registry := metrics.NewRegistry()
+	instrumentation := NewMetricsInstrumentation(registry)
+	instrumentation.ObservePhase(PhaseProposeReap, time.Millisecond)
+	instrumentation.ObservePhase(PhaseProposeReap, 3*time.Millisecond)
+	instrumentation.ObserveTx("send", time.Millisecond)
+	instrumentation.CountDroppedTx("send")
+	instrumentation.CountDroppedTx("reserve_fund")
+
+	reapTimer, ok := registry.Get("ledger/propose/reap").(metrics.Timer)
+	if assert.True(ok) {
+		assert.Equal(int64(2), reapTimer.Count())
+		assert.Equal(int64(4*time.Millisecond), reapTimer.Sum())
+	}
+	txTimer, ok := registry.Get("ledger/apply/tx/send").(metrics.Timer)
+	if assert.True(ok) {
+		assert.Equal(int64(1), txTimer.Count())
+	}
+	assert.Equal(int64(2), registry.Get("ledger/propose/dropped").(metrics.Counter).Count())
+	assert.Equal(int64(1), registry.Get("ledger/propose/dropped/send").(metrics.Counter).Count())
+	assert.Nil(registry.Get("ledger/apply/tx/deposit_stake"))
+}
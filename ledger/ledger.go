@@ -1,10 +1,13 @@
 package ledger
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
+	"math/big"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/spf13/viper"
 	"github.com/thetatoken/theta/store"
@@ -15,12 +18,14 @@ import (
 	"github.com/thetatoken/theta/blockchain"
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/consensus"
 	"github.com/thetatoken/theta/core"
 	"github.com/thetatoken/theta/crypto"
 	exec "github.com/thetatoken/theta/ledger/execution"
 	"github.com/thetatoken/theta/ledger/state"
 	st "github.com/thetatoken/theta/ledger/state"
 	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/ledger/vm"
 	mp "github.com/thetatoken/theta/mempool"
 	"github.com/thetatoken/theta/store/database"
 )
@@ -42,12 +47,33 @@ type Ledger struct {
 	mu       *sync.RWMutex // Lock for accessing ledger state.
 	state    *st.LedgerState
 	executor *exec.Executor
+
+	latencyTracker *core.TxLatencyTracker // measures the inclusion and finality latencies of the local txs
+	reproCapturer  *reproCapturer         // captures the repro bundles of the unexpected block application failures
+	proposalResult *proposalResult        // execution result of the latest proposed block txs
+	callCache      *callCache             // outcomes of the simulated read-only contract calls, nil if disabled
+
+	blockAppliedFeed *common.BoundedFeed // publishes the BlockAppliedEvents of the applied blocks
+	blockHooks       *blockHooks         // callbacks run before and after the block application
+
+	proposalTxHook   func(tx types.Tx) // invoked before checking each proposal candidate tx, for testing only
+	proposalTxSource proposalTxSource  // provides the proposal candidate txs instead of the mempool, for testing only
+
+	instrumentation Instrumentation // receives the timings of the block proposal and application
+	clock           common.Clock    // measures the time left before the proposal deadline
 }
 
-// NewLedger creates an instance of Ledger
+// NewLedger creates an instance of Ledger with the default coinbase reward schedule
 func NewLedger(chainID string, db database.Database, chain *blockchain.Chain, consensus core.ConsensusEngine, valMgr core.ValidatorManager, mempool *mp.Mempool) *Ledger {
+	return NewLedgerWithRewardSchedule(chainID, db, chain, consensus, valMgr, mempool, exec.DefaultRewardSchedule)
+}
+
+// NewLedgerWithRewardSchedule creates an instance of Ledger, which uses the given reward schedule both to propose
+// and to validate the coinbase transactions. The DefaultRewardSchedule is used if rewardSchedule is nil.
+func NewLedgerWithRewardSchedule(chainID string, db database.Database, chain *blockchain.Chain, consensus core.ConsensusEngine,
+	valMgr core.ValidatorManager, mempool *mp.Mempool, rewardSchedule exec.RewardSchedule) *Ledger {
 	state := st.NewLedgerState(chainID, db)
-	executor := exec.NewExecutor(state, consensus, valMgr)
+	executor := exec.NewExecutorWithRewardSchedule(state, consensus, valMgr, rewardSchedule)
 	ledger := &Ledger{
 		chain:     chain,
 		consensus: consensus,
@@ -56,6 +82,13 @@ func NewLedger(chainID string, db database.Database, chain *blockchain.Chain, co
 		mu:        &sync.RWMutex{},
 		state:     state,
 		executor:  executor,
+
+		reproCapturer:    newReproCapturer(),
+		callCache:        newCallCache(viper.GetInt(common.CfgLedgerCallCacheSize)),
+		blockAppliedFeed: newBlockAppliedFeed(),
+		blockHooks:       newBlockHooks(),
+		instrumentation:  noopInstrumentation{},
+		clock:            common.SystemClock,
 	}
 	return ledger
 }
@@ -65,11 +98,33 @@ func (ledger *Ledger) State() *st.LedgerState {
 	return ledger.state
 }
 
+// SetTxLatencyTracker sets the tracker measuring the inclusion and finality latencies of the local txs
+func (ledger *Ledger) SetTxLatencyTracker(latencyTracker *core.TxLatencyTracker) {
+	ledger.latencyTracker = latencyTracker
+}
+
+// TxLatencyTracker returns the tracker measuring the inclusion and finality latencies of the local txs
+func (ledger *Ledger) TxLatencyTracker() *core.TxLatencyTracker {
+	return ledger.latencyTracker
+}
+
+// SetEVMChainConfig sets the fork schedule of the EVM the smart contract txs are executed with. It should only be
+// called on initialization, before any block is applied.
+func (ledger *Ledger) SetEVMChainConfig(chainConfig *vm.ChainConfig) error {
+	return ledger.executor.SetChainConfig(chainConfig)
+}
+
 // GetCurrentBlock returns the block currently being processed
 func (ledger *Ledger) GetCurrentBlock() *core.Block {
 	return ledger.currentBlock
 }
 
+// NextBlockHeight returns the height of the block to be applied on top of the latest committed state. The
+// mempool sweeps the txs ineligible for it on a timer, unless CfgMempoolHeightDrivenExpirySweep is set.
+func (ledger *Ledger) NextBlockHeight() uint64 {
+	return ledger.state.Committed().Height() + 1
+}
+
 // GetScreenedSnapshot returns a snapshot of screened ledger state to query about accounts, etc.
 func (ledger *Ledger) GetScreenedSnapshot() (*st.StoreView, error) {
 	ledger.mu.Lock()
@@ -94,16 +149,34 @@ func (ledger *Ledger) GetFinalizedSnapshot() (*st.StoreView, error) {
 	return ledger.state.Finalized().Copy()
 }
 
-// GetFinalizedValidatorCandidatePool returns the validator candidate pool of the latest DIRECTLY finalized block
+// GetFinalizedValidatorCandidatePool returns the validator candidate pool of the latest DIRECTLY finalized block,
+// without the jailed stake holders
 func (ledger *Ledger) GetFinalizedValidatorCandidatePool(blockHash common.Hash, isNext bool) (*core.ValidatorCandidatePool, error) {
+	storeView, err := ledger.getFinalizedStoreView(blockHash, isNext)
+	if err != nil {
+		return nil, err
+	}
+	return storeView.GetValidatorLivenessTracker().ExcludeJailed(storeView.GetValidatorCandidatePool()), nil
+}
+
+// GetFinalizedMaxNumValidators returns the max number of validators in the validator set, as of the latest
+// DIRECTLY finalized block, the same block GetFinalizedValidatorCandidatePool reads the pool from
+func (ledger *Ledger) GetFinalizedMaxNumValidators(blockHash common.Hash, isNext bool) (int, error) {
+	storeView, err := ledger.getFinalizedStoreView(blockHash, isNext)
+	if err != nil {
+		return 0, err
+	}
+	return storeView.GetMaxNumValidators(), nil
+}
+
+func (ledger *Ledger) getFinalizedStoreView(blockHash common.Hash, isNext bool) (*st.StoreView, error) {
 	db := ledger.state.DB()
 	store := kvstore.NewKVStore(db)
 
-	var i int
+	// The validator set of a block reflects the state ValidatorSetUpdateDelay HCC links up
+	i := int(core.ValidatorSetUpdateDelay)
 	if isNext {
-		i = 1
-	} else {
-		i = 2
+		i--
 	}
 	for ; ; i-- {
 		block, err := findBlock(store, blockHash)
@@ -118,8 +191,10 @@ func (ledger *Ledger) GetFinalizedValidatorCandidatePool(blockHash common.Hash,
 		if i == 0 || block.HCC.BlockHash.IsEmpty() || block.Status.IsTrusted() {
 			stateRoot := block.BlockHeader.StateHash
 			storeView := st.NewStoreView(block.Height, stateRoot, db)
-			vcp := storeView.GetValidatorCandidatePool()
-			return vcp, nil
+			if storeView == nil { // might have been pruned
+				return nil, fmt.Errorf("Failed to load the state of block %v", blockHash.Hex())
+			}
+			return storeView, nil
 		}
 		blockHash = block.HCC.BlockHash
 	}
@@ -127,6 +202,46 @@ func (ledger *Ledger) GetFinalizedValidatorCandidatePool(blockHash common.Hash,
 	return nil, fmt.Errorf("Failed to find a directly finalized ancestor block for %v", blockHash)
 }
 
+// GetRewards returns the rewards granted to the address by the coinbase transactions in the epochs from fromEpoch
+// to toEpoch inclusively, as of the finalized state. The rewards are recorded from common.HeightEnableRewardHistory
+// on, and the epochs older than core.RewardHistoryRetention are only known as a whole, see StoreView.GetRewards.
+func (ledger *Ledger) GetRewards(address common.Address, fromEpoch, toEpoch uint64) (types.Coins, error) {
+	view, err := ledger.GetFinalizedSnapshot()
+	if err != nil {
+		return types.Coins{}, err
+	}
+	return view.GetRewards(address, fromEpoch, toEpoch)
+}
+
+// GetAccountAtHeight returns the account as of the finalized block at the given height, or nil if the
+// account does not exist at that height. It returns an error if there is no finalized block at the
+// height, or if the state of the height has been pruned.
+func (ledger *Ledger) GetAccountAtHeight(address common.Address, height uint64) (*types.Account, error) {
+	block := ledger.findFinalizedBlock(height)
+	if block == nil {
+		return nil, fmt.Errorf("No finalized block found at height %v", height)
+	}
+
+	db := ledger.state.DB()
+	var prunedHeight uint64
+	err := kvstore.NewKVStore(db).Get(state.StatePruningProgressKey(), &prunedHeight)
+	if err == nil && height <= prunedHeight {
+		return nil, fmt.Errorf("The state at height %v has been pruned", height)
+	}
+
+	storeView := st.NewStoreView(height, block.StateHash, db)
+	if storeView == nil {
+		return nil, fmt.Errorf("The state at height %v is not available, it might have been pruned", height)
+	}
+
+	account := storeView.GetAccount(address)
+	if account == nil {
+		return nil, nil
+	}
+	account.UpdateToHeight(height)
+	return account, nil
+}
+
 func findBlock(store store.Store, blockHash common.Hash) (*core.ExtendedBlock, error) {
 	var block core.ExtendedBlock
 	err := store.Get(blockHash[:], &block)
@@ -136,24 +251,47 @@ func findBlock(store store.Store, blockHash common.Hash) (*core.ExtendedBlock, e
 	return &block, nil
 }
 
+// MaxTxSize returns the max size of a raw regular transaction in the last committed state
+func (ledger *Ledger) MaxTxSize() uint64 {
+	return ledger.View().GetMaxTxSize()
+}
+
+// checkTxSize checks the size of the raw transaction against the limit, before it is decoded
+func checkTxSize(rawTx common.Bytes, maxTxSize uint64) result.Result {
+	if size := uint64(len(rawTx)); size > maxTxSize {
+		return result.Error("Transaction too large: %v bytes, at most %v bytes are allowed", size, maxTxSize).
+			WithErrorCode(result.CodeTxTooLarge)
+	}
+	return result.OK
+}
+
 // ScreenTxUnsafe screens the given transaction without locking.
 func (ledger *Ledger) ScreenTxUnsafe(rawTx common.Bytes) (res result.Result) {
+	if res := checkTxSize(rawTx, ledger.MaxTxSize()); res.IsError() {
+		return res
+	}
+
 	var tx types.Tx
-	tx, err := types.TxFromBytes(rawTx)
+	tx, err := types.TxFromCanonicalBytes(rawTx)
 	if err != nil {
-		return result.Error("Error decoding tx: %v", err)
+		return result.Error("Error decoding tx: %v", err).WithErrorCode(result.CodeInvalidTxFormat)
 	}
 
 	_, res = ledger.executor.ScreenTx(tx)
 	return res
 }
 
-// ScreenTx screens the given transaction
+// ScreenTx screens the given transaction. The smart contract transactions are also simulated, and rejected
+// with the revert reason if their execution reverts.
 func (ledger *Ledger) ScreenTx(rawTx common.Bytes) (txInfo *core.TxInfo, res result.Result) {
+	if res := checkTxSize(rawTx, ledger.MaxTxSize()); res.IsError() {
+		return nil, res
+	}
+
 	var tx types.Tx
-	tx, err := types.TxFromBytes(rawTx)
+	tx, err := types.TxFromCanonicalBytes(rawTx)
 	if err != nil {
-		return nil, result.Error("Error decoding tx: %v", err)
+		return nil, result.Error("Error decoding tx: %v", err).WithErrorCode(result.CodeInvalidTxFormat)
 	}
 
 	if ledger.shouldSkipCheckTx(tx) {
@@ -161,6 +299,28 @@ func (ledger *Ledger) ScreenTx(rawTx common.Bytes) (txInfo *core.TxInfo, res res
 			WithErrorCode(result.CodeUnauthorizedTx)
 	}
 
+	if res := ledger.screenContractTx(tx); res.IsError() {
+		return nil, res
+	}
+
+	txInfo, res = ledger.executor.GetTxInfo(tx)
+	if res.IsError() {
+		return nil, res
+	}
+
+	// The txs already committed are rejected without waiting for the ledger lock, which is held
+	// during the block application
+	view := ledger.View()
+	account := view.GetAccount(txInfo.Address)
+	if account != nil && txInfo.Sequence <= account.Sequence {
+		return nil, result.Error("Stale sequence: got %v, the committed sequence is %v", txInfo.Sequence, account.Sequence).
+			WithErrorCode(result.CodeSequenceTooLow)
+	}
+	if gas, gasBudget := view.GetIntrinsicGasSchedule().TxGas(tx), view.GetBlockGasLimit(); gas > gasBudget {
+		return nil, result.Error("Tx gas exceeds the block gas budget: %v > %v", gas, gasBudget).
+			WithErrorCode(result.CodeBlockGasLimitExceeded)
+	}
+
 	ledger.mu.RLock()
 	defer ledger.mu.RUnlock()
 
@@ -169,17 +329,81 @@ func (ledger *Ledger) ScreenTx(rawTx common.Bytes) (txInfo *core.TxInfo, res res
 		return nil, res
 	}
 
-	txInfo, res = ledger.executor.GetTxInfo(tx)
+	return txInfo, res
+}
+
+// ScreenTxResult holds the screening outcome of a transaction in a batch
+type ScreenTxResult struct {
+	TxInfo *core.TxInfo
+	Result result.Result
+}
+
+// ScreenTxs screens a batch of transactions against one checkout of the screened state, which
+// avoids the per-call setup cost of ScreenTx. If sequential is true, each valid transaction is
+// applied to the checkout, so the later transactions (e.g. from the same account) see its effects.
+// Otherwise all the transactions are screened independently against the same state. Unlike
+// ScreenTx, the screened state itself is not modified.
+func (ledger *Ledger) ScreenTxs(rawTxs []common.Bytes, sequential bool) []*ScreenTxResult {
+	results := make([]*ScreenTxResult, len(rawTxs))
+
+	ledger.mu.RLock()
+	view, err := ledger.state.Screened().Copy()
+	ledger.mu.RUnlock()
+
+	if err != nil {
+		res := result.Error("Failed to checkout the screened state: %v", err)
+		for i := range results {
+			results[i] = &ScreenTxResult{Result: res}
+		}
+		return results
+	}
+
+	for i, rawTx := range rawTxs {
+		results[i] = ledger.screenTxWithView(rawTx, view, sequential)
+	}
+	return results
+}
+
+func (ledger *Ledger) screenTxWithView(rawTx common.Bytes, view *st.StoreView, apply bool) *ScreenTxResult {
+	if res := checkTxSize(rawTx, view.GetMaxTxSize()); res.IsError() {
+		return &ScreenTxResult{Result: res}
+	}
+
+	tx, err := types.TxFromCanonicalBytes(rawTx)
+	if err != nil {
+		return &ScreenTxResult{Result: result.Error("Error decoding tx: %v", err).WithErrorCode(result.CodeInvalidTxFormat)}
+	}
+
+	if ledger.shouldSkipCheckTx(tx) {
+		return &ScreenTxResult{Result: result.Error("Unauthorized transaction, should skip").
+			WithErrorCode(result.CodeUnauthorizedTx)}
+	}
+
+	_, res := ledger.executor.ScreenTxWithView(tx, view, apply)
 	if res.IsError() {
-		return nil, res
+		return &ScreenTxResult{Result: res}
 	}
 
-	return txInfo, res
+	txInfo, res := ledger.executor.GetTxInfoWithView(tx, view)
+	if res.IsError() {
+		return &ScreenTxResult{Result: res}
+	}
+	return &ScreenTxResult{TxInfo: txInfo, Result: res}
 }
 
 // ProposeBlockTxs collects and executes a list of transactions, which will be used to assemble the next blockl
 // It also clears these transactions from the mempool.
 func (ledger *Ledger) ProposeBlockTxs(block *core.Block) (stateRootHash common.Hash, blockRawTxs []common.Bytes, res result.Result) {
+	return ledger.ProposeBlockTxsWithDeadline(context.Background(), block)
+}
+
+// ProposeBlockTxsWithDeadline is similar to ProposeBlockTxs, but stops reaping and executing the regular
+// transactions when the context is done or its deadline approaches, and returns the valid transactions
+// assembled so far. The special transactions (e.g. the CoinbaseTx) are always included. The transactions
+// not yet reaped stay in the mempool for the later blocks.
+// From common.HeightEnableLogBloom, it also sets the bloom filter of the logs of the block, and from
+// common.HeightEnableReceiptRoot the root hash of its receipts.
+func (ledger *Ledger) ProposeBlockTxsWithDeadline(ctx context.Context, block *core.Block) (stateRootHash common.Hash, blockRawTxs []common.Bytes, res result.Result) {
 	// Must always acquire locks in following order to avoid deadlock: mempool, ledger.
 	// Otherwise, could cause deadlock since mempool.InsertTransaction() also first acquires the mempool, and then the ledger lock
 	ledger.mempool.Lock()
@@ -193,41 +417,274 @@ func (ledger *Ledger) ProposeBlockTxs(block *core.Block) (stateRootHash common.H
 
 	view := ledger.state.Checked()
 
-	// Add special transactions
-	rawTxCandidates := []common.Bytes{}
-	ledger.addSpecialTransactions(block, view, &rawTxCandidates)
+	// The execution result is cached only if the proposal starts from the delivered state
+	delivered := ledger.state.Delivered()
+	baseHeight, baseRoot := delivered.Height(), delivered.Hash()
+	cacheable := view.Height() == baseHeight && view.Hash() == baseRoot
+	ledger.proposalResult = nil
 
-	// Add regular transactions submitted by the clients
-	regularRawTxs := ledger.mempool.ReapUnsafe(core.MaxNumRegularTxsPerBlock)
-	for _, regularRawTx := range regularRawTxs {
-		rawTxCandidates = append(rawTxCandidates, regularRawTx)
+	// Drop the txs that expire at the proposal height, so they do not take up the block capacity
+	if viper.GetBool(common.CfgMempoolHeightDrivenExpirySweep) {
+		ledger.mempool.SweepExpiredUnsafe(view.Height() + 1)
 	}
 
+	// Add special transactions
+	specialRawTxs := []common.Bytes{}
+	ledger.addSpecialTransactions(block, view, &specialRawTxs)
+
 	blockRawTxs = []common.Bytes{}
-	for _, rawTxCandidate := range rawTxCandidates {
-		tx, err := types.TxFromBytes(rawTxCandidate)
-		if err != nil {
+	receipts := []*types.TxReceipt{}
+	hasValidatorUpdate := false
+	includedTxHashes := make(map[common.Hash]bool)
+	addTx := func(rawTx common.Bytes) bool {
+		// A tx reaped twice, e.g. inserted again while the mempool lost track of it, would invalidate the block
+		txHash := crypto.Keccak256Hash(rawTx)
+		if includedTxHashes[txHash] {
+			logger.Warnf("Skip duplicate tx in block proposal: %v", txHash.Hex())
+			return false
+		}
+		tx, res := ledger.checkProposalTx(rawTx)
+		if res.IsError() {
+			ledger.countDroppedTx(tx)
+			return false
+		}
+		includedTxHashes[txHash] = true
+		blockRawTxs = append(blockRawTxs, rawTx)
+		receipts = append(receipts, newTxReceipt(txHash, tx, res))
+		hasValidatorUpdate = hasValidatorUpdate || isValidatorUpdateTx(tx, res)
+		return true
+	}
+
+	// The regular txs are reaped and executed one at a time, so the time spent on each is accumulated
+	instrumented := ledger.instrumentationEnabled()
+	var phaseStart time.Time
+	var txExecutionTime time.Duration
+	if instrumented {
+		phaseStart = time.Now()
+	}
+
+	for _, rawTxCandidate := range specialRawTxs {
+		addTx(rawTxCandidate)
+	}
+	numSpecialTxs := len(blockRawTxs)
+
+	if instrumented {
+		txExecutionTime = time.Since(phaseStart)
+		phaseStart = time.Now()
+	}
+
+	// Add regular transactions submitted by the clients, one at a time so the transactions
+	// left out due to the deadline or the block gas budget remain in the mempool
+	deadline, hasDeadline := ctx.Deadline()
+	var maxTxCheckTime time.Duration
+	var regularTxExecutionTime time.Duration
+	var txSource proposalTxSource = ledger.mempool
+	if ledger.proposalTxSource != nil {
+		txSource = ledger.proposalTxSource
+	}
+	gasBudget := view.GetBlockGasLimit()
+	gasSchedule := view.GetIntrinsicGasSchedule()
+	gasUsed := uint64(0)
+	maxTxSize := view.GetMaxTxSize()
+	proposalHeight := view.Height() + 1
+	if block != nil {
+		proposalHeight = block.Height
+	}
+	maxNumRegularTxs := view.GetMaxNumRegularTxsPerBlock(proposalHeight)
+	for i := 0; i < maxNumRegularTxs; i++ {
+		if ctx.Err() != nil {
+			logger.Warnf("Stop collecting txs for block proposal: %v, number of regular txs collected: %v", ctx.Err(), i)
+			break
+		}
+		if hasDeadline && deadline.Sub(ledger.clock.Now()) < maxTxCheckTime {
+			logger.Warnf("Stop collecting txs for block proposal: deadline approaching, number of regular txs collected: %v", i)
+			break
+		}
+
+		rawTx := txSource.PeekUnsafe()
+		if rawTx == nil {
+			break
+		}
+		gas := estimateRawTxGas(rawTx, gasSchedule)
+		if gas <= gasBudget && gasUsed+gas > gasBudget {
+			logger.Infof("Stop collecting txs for block proposal: gas budget reached, number of regular txs collected: %v, gas: %v", i, gasUsed)
+			break
+		}
+		txSource.ReapUnsafe(1)
+		if uint64(len(rawTx)) > maxTxSize {
+			// Admitted before the max tx size got lowered
+			logger.Warnf("Drop tx exceeding the max tx size: size = %v, max = %v", len(rawTx), maxTxSize)
+			continue
+		}
+		if gas > gasBudget {
+			// Can not be included in any block, e.g. admitted before the budget got lowered
+			logger.Warnf("Drop tx exceeding the block gas budget: gas = %v, budget = %v", gas, gasBudget)
 			continue
 		}
-		_, res := ledger.executor.CheckTx(tx)
+
+		start := ledger.clock.Now()
+		if addTx(rawTx) {
+			gasUsed += gas
+		}
+		elapsed := ledger.clock.Now().Sub(start)
+		if elapsed > maxTxCheckTime {
+			maxTxCheckTime = elapsed
+		}
+		regularTxExecutionTime += elapsed
+	}
+
+	if instrumented {
+		ledger.instrumentation.ObservePhase(PhaseProposeReap, time.Since(phaseStart)-regularTxExecutionTime)
+		phaseStart = time.Now()
+	}
+
+	hasValidatorUpdate = ledger.handleDelayedStateUpdates(view, len(blockRawTxs)-numSpecialTxs) || hasValidatorUpdate
+
+	if instrumented {
+		txExecutionTime += regularTxExecutionTime + time.Since(phaseStart)
+		ledger.instrumentation.ObservePhase(PhaseProposeExecute, txExecutionTime)
+	}
+
+	if res := withStoreError(view, result.OK); res.IsError() {
+		// The state root might not reflect the actual state, the next proposal starts over from the delivered state
+		ledger.resetState(baseHeight, baseRoot)
+		return common.Hash{}, nil, res
+	}
+
+	stateRootSpan := ledger.startSpan(PhaseProposeStateRoot)
+	stateRootHash = view.Hash()
+	stateRootSpan.end()
+
+	setProposalBloom(block, receipts)
+	setProposalReceiptRoot(block, receipts)
+
+	if cacheable {
+		ledger.proposalResult = &proposalResult{
+			txListHash:         core.CalculateRootHash(blockRawTxs),
+			baseHeight:         baseHeight,
+			baseRoot:           baseRoot,
+			stateRoot:          stateRootHash,
+			view:               view,
+			receipts:           receipts,
+			hasValidatorUpdate: hasValidatorUpdate,
+		}
+	}
+
+	return stateRootHash, blockRawTxs, result.OK
+}
+
+// HasPendingTxs returns whether the mempool has transactions waiting to be included in a block
+func (ledger *Ledger) HasPendingTxs() bool {
+	return ledger.mempool.Size() > 0
+}
+
+// ProposeEmptyBlockTxs assembles the next block with only the special transactions (e.g. the CoinbaseTx).
+// Unlike ProposeBlockTxs, it does not acquire the mempool lock or reap the mempool, so the proposer can
+// use it when the mempool has no pending transactions. The resulting state root is the same as what
+// ProposeBlockTxs returns with an empty mempool.
+// Same as ProposeBlockTxs, it also sets the bloom filter of the logs of the block from common.HeightEnableLogBloom,
+// and the root hash of its receipts from common.HeightEnableReceiptRoot.
+func (ledger *Ledger) ProposeEmptyBlockTxs(block *core.Block) (stateRootHash common.Hash, blockRawTxs []common.Bytes, res result.Result) {
+	ledger.mu.Lock()
+	defer ledger.mu.Unlock()
+
+	ledger.currentBlock = block
+	defer func() { ledger.currentBlock = nil }()
+
+	view := ledger.state.Checked()
+
+	delivered := ledger.state.Delivered()
+	baseHeight, baseRoot := delivered.Height(), delivered.Hash()
+	cacheable := view.Height() == baseHeight && view.Hash() == baseRoot
+	ledger.proposalResult = nil
+
+	specialRawTxs := []common.Bytes{}
+	ledger.addSpecialTransactions(block, view, &specialRawTxs)
+
+	blockRawTxs = []common.Bytes{}
+	receipts := []*types.TxReceipt{}
+	hasValidatorUpdate := false
+	for _, rawTx := range specialRawTxs {
+		tx, res := ledger.checkProposalTx(rawTx)
 		if res.IsError() {
-			logger.Errorf("Transaction check failed: errMsg = %v, tx = %v", res.Message, tx)
 			continue
 		}
-		blockRawTxs = append(blockRawTxs, rawTxCandidate)
+		blockRawTxs = append(blockRawTxs, rawTx)
+		receipts = append(receipts, newTxReceipt(crypto.Keccak256Hash(rawTx), tx, res))
+		hasValidatorUpdate = hasValidatorUpdate || isValidatorUpdateTx(tx, res)
 	}
 
-	ledger.handleDelayedStateUpdates(view)
+	hasValidatorUpdate = ledger.handleDelayedStateUpdates(view, 0) || hasValidatorUpdate
+
+	if res := withStoreError(view, result.OK); res.IsError() {
+		ledger.resetState(baseHeight, baseRoot)
+		return common.Hash{}, nil, res
+	}
 
 	stateRootHash = view.Hash()
+	setProposalBloom(block, receipts)
+	setProposalReceiptRoot(block, receipts)
+
+	if cacheable {
+		ledger.proposalResult = &proposalResult{
+			txListHash:         core.CalculateRootHash(blockRawTxs),
+			baseHeight:         baseHeight,
+			baseRoot:           baseRoot,
+			stateRoot:          stateRootHash,
+			view:               view,
+			receipts:           receipts,
+			hasValidatorUpdate: hasValidatorUpdate,
+		}
+	}
 
 	return stateRootHash, blockRawTxs, result.OK
 }
 
+// checkProposalTx checks the candidate transaction against the checked view. The transaction
+// should be included in the proposed block only if the returned result is OK. A failed transaction
+// leaves the checked view untouched, so the later transactions of its sender fail on their sequence
+// and are dropped as well, the same way the validators would reject them, see ApplyBlockTxs.
+func (ledger *Ledger) checkProposalTx(rawTx common.Bytes) (types.Tx, result.Result) {
+	tx, err := types.TxFromBytes(rawTx)
+	if err != nil {
+		return nil, result.Error("Failed to parse transaction: %v", hex.EncodeToString(rawTx))
+	}
+	if ledger.proposalTxHook != nil {
+		ledger.proposalTxHook(tx)
+	}
+	// The time limit only applies to the proposal, the validators reject a block based on the gas instead
+	timeLimit := time.Duration(viper.GetInt(common.CfgLedgerMaxProposalTxExecutionTime)) * time.Millisecond
+	_, res := ledger.executor.CheckTxWithTimeLimit(tx, timeLimit)
+	if res.IsError() {
+		logger.Errorf("Transaction check failed: errMsg = %v, tx = %v", res.Message, tx)
+	}
+	return tx, res
+}
+
 // ApplyBlockTxs applies the given block transactions. If any of the transactions failed, it returns
 // an error immediately. If all the transactions execute successfully, it then validates the state
 // root hash. If the states root hash matches the expected value, it clears the transactions from the mempool
+//
+// A transaction is either applied or makes the block invalid. A smart contract transaction whose execution
+// fails in the VM, e.g. reverts or runs out of gas, is applied with its state changes reverted, and still
+// consumes the sequence of the sender and pays the fee, see common.HeightEnableContractGasRefund. Any other
+// failure, from a malformed transaction to one not passing the checks against the state, makes it
+// un-includable, along with the later transactions of its sender, as it does not consume the sequence.
+// ProposeBlockTxs drops such transactions instead.
 func (ledger *Ledger) ApplyBlockTxs(block *core.Block) result.Result {
+	_, res := ledger.ApplyBlockTxsWithReceipts(block)
+	return res
+}
+
+// ApplyBlockTxsWithReceipts is similar to ApplyBlockTxs, but also returns the receipts of the executed
+// transactions. The block is still applied in an all-or-nothing manner: the transactions are executed
+// against a copy of the delivered state, which is committed only if the resulting state root matches the
+// one of the block, so a failed block leaves the delivered state untouched. In case of failure, the returned
+// receipts cover the transactions executed so far, and the last receipt corresponds to the failed
+// transaction. The receipts are persisted only if the block is valid, before its state is committed. From
+// common.HeightEnableLogBloom, the block is also rejected if its bloom filter does not match the logs, and from
+// common.HeightEnableReceiptRoot if its receipt root does not match the receipts.
+func (ledger *Ledger) ApplyBlockTxsWithReceipts(block *core.Block) ([]*types.TxReceipt, result.Result) {
 	// Must always acquire locks in following order to avoid deadlock: mempool, ledger.
 	// Otherwise, could cause deadlock since mempool.InsertTransaction() also first acquires the mempool, and then the ledger lock
 	ledger.mempool.Lock()
@@ -240,47 +697,337 @@ func (ledger *Ledger) ApplyBlockTxs(block *core.Block) result.Result {
 	defer func() { ledger.currentBlock = nil }()
 
 	blockRawTxs := ledger.currentBlock.Txs
-	expectedStateRoot := ledger.currentBlock.StateHash
 
 	view := ledger.state.Delivered()
 
 	currHeight := view.Height()
 	currStateRoot := view.Hash()
 
+	defer func() {
+		if r := recover(); r != nil {
+			ledger.captureReproBundle(block, currHeight, currStateRoot, panicFailure(r))
+			panic(r)
+		}
+	}()
+
+	if res := ledger.runPreBlockHooks(blockRawTxs); res.IsError() {
+		return nil, res
+	}
+
+	var journal *st.BalanceJournal
+	if viper.GetBool(common.CfgLedgerBalanceJournalEnabled) {
+		journal = st.NewBalanceJournal()
+	}
+	recordAccess := viper.GetBool(common.CfgLedgerStateAccessListsEnabled)
+
+	var receipts []*types.TxReceipt
+	var blockView *st.StoreView
 	hasValidatorUpdate := false
-	for _, rawTx := range blockRawTxs {
-		tx, err := types.TxFromBytes(rawTx)
-		if err != nil {
+	if cached := ledger.takeProposalResult(block, currHeight, currStateRoot); cached != nil && journal == nil && !recordAccess {
+		// The txs of the proposer's own block have been executed by ProposeBlockTxs already
+		receipts, blockView, hasValidatorUpdate = cached.receipts, cached.view, cached.hasValidatorUpdate
+	} else {
+		var res result.Result
+		receipts, blockView, hasValidatorUpdate, res = ledger.deliverBlockTxs(block, currHeight, currStateRoot, journal, recordAccess)
+		if res.IsError() {
+			// The delivered state is intact, but the checked and screened views might still reflect the discarded proposal
 			ledger.resetState(currHeight, currStateRoot)
-			return result.Error("Failed to parse transaction: %v", hex.EncodeToString(rawTx))
+			return receipts, res
 		}
-		if _, ok := tx.(*types.DepositStakeTx); ok {
-			hasValidatorUpdate = true
-		} else if _, ok := tx.(*types.WithdrawStakeTx); ok {
-			hasValidatorUpdate = true
+	}
+	if res := checkBlockBloom(block, receipts); res.IsError() {
+		ledger.resetState(currHeight, currStateRoot)
+		return receipts, res
+	}
+	if res := checkBlockReceiptRoot(block, receipts); res.IsError() {
+		ledger.resetState(currHeight, currStateRoot)
+		return receipts, res
+	}
+
+	// The receipts, the logs, the balance changes and the tx index are saved ahead of the state, so that a block
+	// whose records could not be saved is not committed, and can be applied again
+	if err := ledger.saveTxReceipts(receipts); err != nil {
+		ledger.resetState(currHeight, currStateRoot)
+		return receipts, result.Error("Failed to save the receipts: %v", err).WithErrorCode(result.CodeInternalStoreError)
+	}
+	if err := ledger.saveBlockLogs(block, receipts); err != nil {
+		ledger.resetState(currHeight, currStateRoot)
+		return receipts, result.Error("%v", err).WithErrorCode(result.CodeInternalStoreError)
+	}
+	if journal != nil {
+		if err := ledger.saveBalanceChanges(block, journal); err != nil {
+			ledger.resetState(currHeight, currStateRoot)
+			return receipts, result.Error("%v", err).WithErrorCode(result.CodeInternalStoreError)
 		}
-		_, res := ledger.executor.ExecuteTx(tx)
+	}
+	if err := ledger.indexBlockTxs(block); err != nil {
+		ledger.resetState(currHeight, currStateRoot)
+		return receipts, result.Error("%v", err).WithErrorCode(result.CodeInternalStoreError)
+	}
+
+	commitSpan := ledger.startSpan(PhaseApplyCommit)
+	ledger.state.CommitView(blockView) // commit to persistent storage
+	commitSpan.end()
+
+	txHashes := make([]common.Hash, len(receipts))
+	for i, receipt := range receipts {
+		txHashes[i] = receipt.TxHash
+	}
+
+	ledger.latencyTracker.RecordInclusion(block.Hash(), block.Height, txHashes)
+
+	ledger.mempool.UpdateUnsafe(blockRawTxs) // clear txs from the mempool
+
+	if viper.GetBool(common.CfgMempoolHeightDrivenExpirySweep) {
+		ledger.mempool.SweepExpiredUnsafe(ledger.state.Height() + 1) // clear txs ineligible for the next block
+	}
+
+	ledger.publishBlockApplied(block, receipts, currHeight, currStateRoot)
+
+	ledger.runPostBlockHooks(receipts)
+
+	return receipts, result.OKWith(result.Info{"hasValidatorUpdate": hasValidatorUpdate})
+}
+
+// deliverBlockTxs executes the txs of the given block against a copy of the delivered view and verifies the
+// resulting state root. The copy is returned to be committed if the block is valid, otherwise the delivered
+// state is left untouched. The balance changes are recorded into the journal if it is not nil, and the state keys
+// accessed by each tx into its receipt if recordAccess is set.
+func (ledger *Ledger) deliverBlockTxs(block *core.Block, currHeight uint64, currStateRoot common.Hash, journal *st.BalanceJournal,
+	recordAccess bool) ([]*types.TxReceipt, *st.StoreView, bool, result.Result) {
+	if res := checkDuplicateTxs(block.Txs); res.IsError() {
+		return nil, nil, false, res
+	}
+
+	view, err := ledger.state.Delivered().Copy()
+	if err != nil {
+		return nil, nil, false, result.Error("Failed to copy the delivered view: %v", err).WithErrorCode(result.CodeInternalStoreError)
+	}
+
+	if res := checkBlockTxSizes(block.Txs, view); res.IsError() {
+		return nil, nil, false, withStoreError(view, res)
+	}
+
+	txs := []types.Tx{}
+	for _, rawTx := range block.Txs {
+		tx, err := decodeBlockTx(rawTx, block.Height)
+		if err != nil {
+			break // the txs before it are still executed, same as the serial execution
+		}
+		txs = append(txs, tx)
+	}
+
+	if res := checkBlockGasBudget(txs, view); res.IsError() {
+		return nil, nil, false, withStoreError(view, res)
+	}
+	if res := checkBlockRegularTxCount(block, txs, view); res.IsError() {
+		return nil, nil, false, withStoreError(view, res)
+	}
+
+	executeSpan := ledger.startSpan(PhaseApplyExecute)
+	var results []result.Result
+	var accessLists []*types.StateAccessList
+	if journal != nil {
+		view.SetBalanceJournal(journal)
+		defer view.SetBalanceJournal(nil)
+		results, accessLists = ledger.executeTxsWithJournal(txs, block.Txs, view, journal, recordAccess)
+	} else {
+		results, accessLists = ledger.executeTxs(txs, view, recordAccess)
+	}
+
+	receipts := []*types.TxReceipt{}
+	hasValidatorUpdate := false
+	for i, res := range results {
+		tx := txs[i]
+		hasValidatorUpdate = hasValidatorUpdate || isValidatorUpdateTx(tx, res)
+		receipt := newTxReceipt(crypto.Keccak256Hash(block.Txs[i]), tx, res)
+		if i < len(accessLists) {
+			receipt.StateAccess = accessLists[i]
+		}
+		receipts = append(receipts, receipt)
 		if res.IsError() {
-			ledger.resetState(currHeight, currStateRoot)
-			return res
+			return receipts, nil, false, withStoreError(view, blockTxError(tx, res))
 		}
 	}
 
-	ledger.handleDelayedStateUpdates(view)
+	if len(txs) < len(block.Txs) {
+		rawTx := block.Txs[len(txs)]
+		res := result.Error("Failed to parse transaction: %v", hex.EncodeToString(rawTx))
+		receipts = append(receipts, newTxReceipt(crypto.Keccak256Hash(rawTx), nil, res))
+		return receipts, nil, false, blockTxError(nil, res)
+	}
+
+	hasValidatorUpdate = ledger.handleDelayedStateUpdates(view, countRegularTxs(txs)) || hasValidatorUpdate
+	executeSpan.end()
+
+	if res := withStoreError(view, result.OK); res.IsError() {
+		return receipts, nil, false, res
+	}
 
+	stateRootSpan := ledger.startSpan(PhaseApplyStateRoot)
 	newStateRoot := view.Hash()
-	if newStateRoot != expectedStateRoot {
-		ledger.resetState(currHeight, currStateRoot)
-		return result.Error("State root mismatch! root: %v, exptected: %v",
-			hex.EncodeToString(newStateRoot[:]),
-			hex.EncodeToString(expectedStateRoot[:]))
+	stateRootSpan.end()
+	if newStateRoot != block.StateHash {
+		res := stateRootMismatchError(newStateRoot, block.StateHash)
+		ledger.captureReproBundle(block, currHeight, currStateRoot, res.Message)
+		return receipts, nil, false, res
 	}
 
-	ledger.state.Commit() // commit to persistent storage
+	return receipts, view, hasValidatorUpdate, result.OK
+}
 
-	ledger.mempool.UpdateUnsafe(blockRawTxs) // clear txs from the mempool
+// withStoreError returns an internal error in place of the given result if the view failed to access the store, as
+// the outcome of the execution or of a check against the view might only reflect a failed lookup, e.g. an account
+// which looks missing. The block is then neither valid nor invalid, and is worth retrying.
+func withStoreError(view *st.StoreView, res result.Result) result.Result {
+	if err := view.StoreError(); err != nil {
+		return result.Error("Failed to access the state: %v", err).WithErrorCode(result.CodeInternalStoreError)
+	}
+	return res
+}
+
+// blockTxError classifies the failure of a block tx, so that the consensus engine can tell the invalid
+// blocks apart from the local failures worth retrying. The receipt of the tx keeps the original result.
+func blockTxError(tx types.Tx, res result.Result) result.Result {
+	if res.IsInternalError() {
+		return res
+	}
+	if _, ok := tx.(*types.CoinbaseTx); ok {
+		return res.WithErrorCode(result.CodeInvalidCoinbase)
+	}
+	return res.WithErrorCode(result.CodeInvalidTx)
+}
 
-	return result.OKWith(result.Info{"hasValidatorUpdate": hasValidatorUpdate})
+// checkDuplicateTxs checks that no tx appears more than once in the block. The second copy would fail
+// anyway, but the block is rejected before any tx is executed.
+func checkDuplicateTxs(rawTxs []common.Bytes) result.Result {
+	txHashes := make(map[common.Hash]int, len(rawTxs))
+	for i, rawTx := range rawTxs {
+		txHash := crypto.Keccak256Hash(rawTx)
+		if j, ok := txHashes[txHash]; ok {
+			return result.Error("Duplicate transaction %v at index %v and %v", txHash.Hex(), j, i).
+				WithErrorCode(result.CodeDuplicateTx)
+		}
+		txHashes[txHash] = i
+	}
+	return result.OK
+}
+
+// decodeBlockTx decodes a raw tx of the block at the given height. Only the canonical encodings are accepted
+// starting from common.HeightEnableCanonicalTxEncoding, see types.TxFromCanonicalBytes.
+func decodeBlockTx(rawTx common.Bytes, blockHeight uint64) (types.Tx, error) {
+	if blockHeight < common.HeightEnableCanonicalTxEncoding {
+		return types.TxFromBytes(rawTx)
+	}
+	return types.TxFromCanonicalBytes(rawTx)
+}
+
+// checkBlockTxSizes checks the size of the raw regular txs of the block against the limit, before any of
+// them is decoded, so that a proposer can not sneak in a tx the mempool would reject. The limit applies to
+// the blocks starting from common.HeightEnableBlockTxSizeLimit.
+func checkBlockTxSizes(rawTxs []common.Bytes, view *st.StoreView) result.Result {
+	if view.Height()+1 < common.HeightEnableBlockTxSizeLimit { // the view points to the parent of the current block
+		return result.OK
+	}
+	maxTxSize := view.GetMaxTxSize()
+	for i, rawTx := range rawTxs {
+		if uint64(len(rawTx)) <= maxTxSize {
+			continue
+		}
+		txType, err := types.PeekTxType(rawTx)
+		if err == nil && (txType == types.TxCoinbase || txType == types.TxSlash) {
+			continue
+		}
+		res := checkTxSize(rawTx, maxTxSize)
+		return result.Error("Transaction %v: %v", i, res.Message).WithErrorCode(res.Code)
+	}
+	return result.OK
+}
+
+// checkBlockGasBudget checks the total gas of the block txs against the gas budget of the block, starting from
+// common.HeightEnableBlockGasBudget
+func checkBlockGasBudget(txs []types.Tx, view *st.StoreView) result.Result {
+	if view.Height()+1 < common.HeightEnableBlockGasBudget { // the view points to the parent of the current block
+		return result.OK
+	}
+	gasBudget := view.GetBlockGasLimit()
+	gasSchedule := view.GetIntrinsicGasSchedule()
+	gas := uint64(0)
+	for _, tx := range txs {
+		gas += gasSchedule.TxGas(tx)
+		if gas > gasBudget {
+			return result.Error("Block gas exceeds the budget: %v > %v", gas, gasBudget).
+				WithErrorCode(result.CodeBlockGasLimitExceeded)
+		}
+	}
+	return result.OK
+}
+
+// checkBlockRegularTxCount checks the number of the regular txs against the limit for the block height, starting
+// from common.HeightEnableBlockRegularTxLimit. The limit is read from the state of the parent block, same as in the
+// block proposal.
+func checkBlockRegularTxCount(block *core.Block, txs []types.Tx, view *st.StoreView) result.Result {
+	if block.Height < common.HeightEnableBlockRegularTxLimit {
+		return result.OK
+	}
+	numRegularTxs := countRegularTxs(txs)
+	if maxNumRegularTxs := view.GetMaxNumRegularTxsPerBlock(block.Height); numRegularTxs > maxNumRegularTxs {
+		return result.Error("Too many regular transactions in block: %v > %v", numRegularTxs, maxNumRegularTxs).
+			WithErrorCode(result.CodeTooManyRegularTxs)
+	}
+	return result.OK
+}
+
+// countRegularTxs returns the number of the regular txs, i.e. the txs other than the special ones
+func countRegularTxs(txs []types.Tx) int {
+	numRegularTxs := 0
+	for _, tx := range txs {
+		if !isSpecialTx(tx) {
+			numRegularTxs++
+		}
+	}
+	return numRegularTxs
+}
+
+// isSpecialTx returns whether the tx is added by the proposer, i.e. not counted against the regular tx limit
+func isSpecialTx(tx types.Tx) bool {
+	switch tx.(type) {
+	case *types.CoinbaseTx, *types.SlashTx:
+		return true
+	default:
+		return false
+	}
+}
+
+// estimateRawTxGas returns the gas of the raw tx under the given intrinsic gas schedule, or 0 if it can not be
+// parsed
+func estimateRawTxGas(rawTx common.Bytes, gasSchedule *types.IntrinsicGasSchedule) uint64 {
+	tx, err := types.TxFromBytes(rawTx)
+	if err != nil {
+		return 0
+	}
+	return gasSchedule.TxGas(tx)
+}
+
+// executeTxs executes the txs against the view, in parallel groups of independent txs if enabled. It
+// stops at the first failed tx, and returns the results up to and including the failed one. If recordAccess
+// is set, the txs are executed serially instead, and the state keys accessed by each tx are returned as well.
+func (ledger *Ledger) executeTxs(txs []types.Tx, view *st.StoreView, recordAccess bool) ([]result.Result, []*types.StateAccessList) {
+	numWorkers := 1
+	if viper.GetBool(common.CfgLedgerParallelTxExecution) {
+		numWorkers = 0 // one per CPU
+	}
+	scheduler := exec.NewTxScheduler(ledger.executor, numWorkers)
+	if ledger.instrumentationEnabled() {
+		instrumentation := ledger.instrumentation
+		scheduler.SetTxObserver(func(tx types.Tx, elapsed time.Duration) {
+			instrumentation.ObserveTx(txTypeName(tx), elapsed)
+		})
+	}
+	if recordAccess {
+		return scheduler.ExecuteTxsWithAccessLists(txs, view)
+	}
+	return scheduler.ExecuteTxs(txs, view), nil
 }
 
 // ApplyBlockTxsForChainCorrection applies all block's txs and re-calculate root hash
@@ -295,6 +1042,7 @@ func (ledger *Ledger) ApplyBlockTxsForChainCorrection(block *core.Block) (common
 	defer func() { ledger.currentBlock = nil }()
 
 	blockRawTxs := ledger.currentBlock.Txs
+	ledger.proposalResult = nil
 
 	view := ledger.state.Delivered()
 
@@ -302,25 +1050,32 @@ func (ledger *Ledger) ApplyBlockTxsForChainCorrection(block *core.Block) (common
 	currStateRoot := view.Hash()
 
 	hasValidatorUpdate := false
+	numRegularTxs := 0
 	for _, rawTx := range blockRawTxs {
-		tx, err := types.TxFromBytes(rawTx)
+		tx, err := decodeBlockTx(rawTx, currHeight+1)
 		if err != nil {
 			ledger.resetState(currHeight, currStateRoot)
 			return common.Hash{}, result.Error("Failed to parse transaction: %v", hex.EncodeToString(rawTx))
 		}
-		if _, ok := tx.(*types.DepositStakeTx); ok {
-			hasValidatorUpdate = true
-		} else if _, ok := tx.(*types.WithdrawStakeTx); ok {
-			hasValidatorUpdate = true
+		if !isSpecialTx(tx) {
+			numRegularTxs++
 		}
 		_, res := ledger.executor.ExecuteTx(tx)
 		if res.IsError() {
 			ledger.resetState(currHeight, currStateRoot)
 			return common.Hash{}, res
 		}
+		if isValidatorUpdateTx(tx, res) {
+			hasValidatorUpdate = true
+		}
 	}
 
-	ledger.handleDelayedStateUpdates(view)
+	ledger.handleDelayedStateUpdates(view, numRegularTxs)
+
+	if res := withStoreError(view, result.OK); res.IsError() {
+		ledger.resetState(currHeight, currStateRoot)
+		return common.Hash{}, res
+	}
 
 	ledger.state.Commit() // commit to persistent storage
 
@@ -460,6 +1215,97 @@ func (ledger *Ledger) FinalizeState(height uint64, rootHash common.Hash) result.
 	if res.IsError() {
 		return result.Error("Failed to finalize state root: %v", hex.EncodeToString(rootHash[:]))
 	}
+
+	ledger.recordTxFinalization(height, rootHash)
+
+	return result.OK
+}
+
+// recordTxFinalization reports the finalized blocks that could include the tracked txs to the latency tracker
+func (ledger *Ledger) recordTxFinalization(height uint64, rootHash common.Hash) {
+	lowestHeight, ok := ledger.latencyTracker.LowestIncludedHeight()
+	if !ok || lowestHeight > height {
+		return
+	}
+
+	finalizedBlocks := make(map[common.Hash]bool)
+	for _, block := range ledger.chain.FindBlocksByHeight(height) {
+		if block.StateHash != rootHash {
+			continue
+		}
+		for block != nil && block.Height >= lowestHeight {
+			finalizedBlocks[block.Hash()] = true
+			parent, err := ledger.chain.FindBlock(block.Parent)
+			if err != nil {
+				break
+			}
+			block = parent
+		}
+	}
+	ledger.latencyTracker.RecordFinalization(height, finalizedBlocks)
+}
+
+// Rollback discards the current state, and checks out the state of the finalized block at the given
+// height. The consensus engine rewinds the chain tip to the block together with the ledger, so either
+// both or neither of them are rolled back. It refuses to roll back to the heights whose states might
+// have been pruned.
+func (ledger *Ledger) Rollback(targetHeight uint64) result.Result {
+	rewinder, ok := ledger.consensus.(core.ChainRewinder)
+	if !ok {
+		return result.Error("The consensus engine does not support rewinding the chain")
+	}
+
+	var target *core.ExtendedBlock
+	for _, block := range ledger.chain.FindBlocksByHeight(targetHeight) {
+		if block.Status.IsFinalized() {
+			target = block
+			break
+		}
+	}
+	if target == nil {
+		return result.Error("No finalized block found at height %v", targetHeight)
+	}
+
+	var prunedHeight uint64
+	err := kvstore.NewKVStore(ledger.state.DB()).Get(state.StatePruningProgressKey(), &prunedHeight)
+	if err == nil && targetHeight <= prunedHeight {
+		return result.Error("Can't roll back to height %v, the states are pruned up to height %v", targetHeight, prunedHeight)
+	}
+	if has, err := ledger.state.DB().Has(target.StateHash[:]); err != nil || !has {
+		return result.Error("State root %v of height %v not found", target.StateHash.Hex(), targetHeight)
+	}
+
+	// The ledger lock is taken by the callback, since the consensus engine might be waiting for it
+	// before it gets to the rewind
+	rollbackLedger := func() error {
+		ledger.mempool.Lock()
+		defer ledger.mempool.Unlock()
+
+		ledger.mu.Lock()
+		defer ledger.mu.Unlock()
+
+		committed := ledger.state.Committed()
+		finalized := ledger.state.Finalized()
+
+		// Also resets the checked and screened views
+		ledger.proposalResult = nil
+		if res := ledger.resetState(target.Height, target.StateHash); res.IsError() {
+			ledger.resetState(committed.Height(), committed.Hash())
+			return fmt.Errorf("%v", res.Message)
+		}
+		if res := ledger.state.Finalize(target.Height, target.StateHash); res.IsError() {
+			ledger.resetState(committed.Height(), committed.Hash())
+			ledger.state.Finalize(finalized.Height(), finalized.Hash())
+			return fmt.Errorf("%v", res.Message)
+		}
+		return nil
+	}
+
+	if err := rewinder.RewindTo(target, rollbackLedger); err != nil {
+		return result.Error("Failed to roll back: %v", err)
+	}
+
+	logger.WithFields(log.Fields{"height": targetHeight, "stateRoot": target.StateHash.Hex()}).Warn("Rolled back the ledger state")
 	return result.OK
 }
 
@@ -469,7 +1315,8 @@ func (ledger *Ledger) resetState(height uint64, rootHash common.Hash) result.Res
 
 	res := ledger.state.ResetState(height, rootHash)
 	if res.IsError() {
-		return result.Error("Failed to set state root: %v", hex.EncodeToString(rootHash[:]))
+		return result.Error("Failed to set state root: %v", hex.EncodeToString(rootHash[:])).
+			WithErrorCode(result.CodeInternalStoreError)
 	}
 	return result.OK
 }
@@ -489,38 +1336,181 @@ func (ledger *Ledger) shouldSkipCheckTx(tx types.Tx) bool {
 }
 
 // handleDelayedStateUpdates handles delayed state updates, e.g. stake return, where the stake
-// is returned only after X blocks of its corresponding StakeWithdraw transaction
-func (ledger *Ledger) handleDelayedStateUpdates(view *st.StoreView) {
+// is returned only after X blocks of its corresponding StakeWithdraw transaction. The number of
+// regular txs is the one of the current block. It returns whether the updates changed the
+// validator set, i.e. jailed a validator.
+func (ledger *Ledger) handleDelayedStateUpdates(view *st.StoreView, numRegularTxs int) bool {
 	ledger.handleStakeReturn(view)
+	ledger.handleDepositNonceExpiry(view)
+	ledger.handleTxInclusion(view, numRegularTxs)
+	ledger.handleStakingParamsUpdates(view)
+	ledger.handleTxInclusionParamsUpdates(view)
+	return ledger.handleValidatorLiveness(view)
+}
+
+// handleDepositNonceExpiry removes the idempotency nonces of the stake deposits expiring with the current block
+// from the recent-nonce sets of their sources, so the sets only hold the nonces of the last
+// core.DepositNonceWindow blocks
+func (ledger *Ledger) handleDepositNonceExpiry(view *st.StoreView) {
+	blockHeight := view.Height() + 1 // the view points to the parent of the current block
+	if blockHeight < common.HeightEnableDepositIdempotency {
+		return
+	}
+	view.PruneDepositNonces(blockHeight)
+}
+
+// handleTxInclusion records the fullness of the current block, and counts it against its proposer if it is
+// underfilled while there is demand, see core.TxInclusionParams. The reward withheld is settled with the coinbase
+// transaction of the next checkpoint.
+func (ledger *Ledger) handleTxInclusion(view *st.StoreView, numRegularTxs int) {
+	block := ledger.currentBlock
+	if block == nil || block.Height < common.HeightEnableRewardWithholding {
+		return
+	}
+
+	maxNumRegularTxs := view.GetMaxNumRegularTxsPerBlock(block.Height)
+	tit := view.GetTxInclusionTracker()
+	if tit.RecordBlock(block.Proposer, uint64(numRegularTxs), uint64(maxNumRegularTxs), view.GetTxInclusionParams()) {
+		logger.WithFields(log.Fields{"height": block.Height, "proposer": block.Proposer.Hex(),
+			"numRegularTxs": numRegularTxs, "maxNumRegularTxs": maxNumRegularTxs}).Info("Underfilled block")
+	}
+	view.UpdateTxInclusionTracker(tit)
 }
 
+// handleTxInclusionParamsUpdates writes the tx inclusion parameters change scheduled for the next block, if any,
+// to the state
+func (ledger *Ledger) handleTxInclusionParamsUpdates(view *st.StoreView) {
+	nextHeight := view.Height() + 2 // the view points to the parent of the current block
+	if nextHeight < common.HeightEnableRewardWithholding {
+		return
+	}
+	update := core.GetTxInclusionParamsUpdate(nextHeight)
+	if update == nil {
+		return
+	}
+	params := update.Params
+	view.UpdateTxInclusionParams(&params)
+	logger.WithFields(log.Fields{"height": nextHeight, "params": params.String()}).Info("Updated the tx inclusion parameters")
+}
+
+// handleStakingParamsUpdates writes the staking parameters change scheduled for the next block, if any, to the
+// state, so the transactions of the next block are validated against the new parameters
+func (ledger *Ledger) handleStakingParamsUpdates(view *st.StoreView) {
+	nextHeight := view.Height() + 2 // the view points to the parent of the current block
+	if nextHeight < common.HeightEnableStakingParams {
+		return
+	}
+	update := core.GetStakingParamsUpdate(nextHeight)
+	if update == nil {
+		return
+	}
+	if update.MinValidatorStakeDeposit != nil {
+		view.UpdateMinValidatorStakeDeposit(update.MinValidatorStakeDeposit)
+	}
+	if update.ReturnLockingPeriod != 0 {
+		view.UpdateReturnLockingPeriod(update.ReturnLockingPeriod)
+	}
+	logger.WithFields(log.Fields{"height": nextHeight, "minValidatorStakeDeposit": view.GetMinValidatorStakeDeposit(),
+		"returnLockingPeriod": view.GetReturnLockingPeriod()}).Info("Updated the staking parameters")
+}
+
+// handleValidatorLiveness records which validators signed the current block, i.e. have their votes in the
+// commit certificate of the block, and jails the validators missing too many blocks. The validators are
+// selected out of the pool in the view the same way as the validator set, so every node records the same
+// liveness. The blocks without votes in their commit certificate are skipped.
+func (ledger *Ledger) handleValidatorLiveness(view *st.StoreView) bool {
+	block := ledger.currentBlock
+	if block == nil || block.Height < common.HeightEnableValidatorJailing {
+		return false
+	}
+	if block.HCC.Votes == nil || block.HCC.Votes.IsEmpty() {
+		return false
+	}
+
+	vcp := view.GetValidatorCandidatePool()
+	if vcp == nil {
+		return false
+	}
+	vlt := view.GetValidatorLivenessTracker()
+	validatorSet := consensus.SelectTopStakeHoldersAsValidatorsWithLimit(vlt.ExcludeJailed(vcp), view.GetMaxNumValidators())
+
+	validators := []common.Address{}
+	for _, v := range validatorSet.Validators() {
+		validators = append(validators, v.Address)
+	}
+	signers := make(map[common.Address]bool)
+	for _, vote := range block.HCC.Votes.Votes() {
+		signers[vote.ID] = true
+	}
+
+	jailed := vlt.RecordBlock(block.Height, validators, signers)
+	view.UpdateValidatorLivenessTracker(vlt)
+	return len(jailed) > 0
+}
+
+// handleStakeReturn returns the withdrawn stakes due at the height of the view to their sources. Once the
+// withdrawn stakes are queued by return height, the blocks without any stake due skip the candidate pools, so
+// the cost of a block no longer grows with the number of pending returns.
 func (ledger *Ledger) handleStakeReturn(view *st.StoreView) {
+	currentHeight := view.Height()
+
+	if view.StakeReturnQueueBuilt() && len(view.GetQueuedStakeReturns(currentHeight)) == 0 {
+		return
+	}
+
+	// The guardian pool is only written when a stake is returned, it is not in the state until the first
+	// guardian stake
+	gcp := view.GetGuardianCandidatePool()
+	if returnedStakes := gcp.ReturnStakesWithHolders(currentHeight); len(returnedStakes) > 0 {
+		returnStakesToSources(view, core.StakeForGuardian, returnedStakes, currentHeight)
+		view.UpdateGuardianCandidatePool(gcp)
+	}
+
 	vcp := view.GetValidatorCandidatePool()
 	if vcp == nil {
 		return
 	}
 
-	currentHeight := view.Height()
-	returnedStakes := vcp.ReturnStakes(currentHeight)
+	returnedStakes := vcp.ReturnStakesWithHolders(currentHeight)
+	returnStakesToSources(view, core.StakeForValidator, returnedStakes, currentHeight)
+	view.UpdateValidatorCandidatePool(vcp)
+}
 
+// returnStakesToSources credits the returned stakes to their sources, or to the return addresses set by their
+// withdrawals, whose accounts are created if they do not exist
+func returnStakesToSources(view *st.StoreView, purpose uint8, returnedStakes []*core.ReturnedStake, currentHeight uint64) {
 	for _, returnedStake := range returnedStakes {
 		if !returnedStake.Withdrawn || currentHeight < returnedStake.ReturnHeight {
 			log.Panicf("Cannot return stake: withdrawn = %v, returnHeight = %v, currentHeight = %v",
 				returnedStake.Withdrawn, returnedStake.ReturnHeight, currentHeight)
 		}
-		sourceAddress := returnedStake.Source
-		sourceAccount := view.GetAccount(sourceAddress)
-		if sourceAccount == nil {
-			log.Panicf("Failed to retrieve source account for stake return: %v", sourceAddress)
+		returnAddress, hasReturnAddress := view.GetStakeReturnAddress(purpose, returnedStake.Holder,
+			returnedStake.Source, returnedStake.ReturnHeight)
+		var returnAccount *types.Account
+		if hasReturnAddress {
+			returnAccount = view.GetAccount(returnAddress)
+			if returnAccount == nil {
+				returnAccount = view.NewAccount(returnAddress)
+			}
+		} else {
+			returnAddress = returnedStake.Source
+			returnAccount = view.GetAccount(returnAddress)
+			if returnAccount == nil {
+				log.Panicf("Failed to retrieve source account for stake return: %v", returnAddress)
+			}
 		}
 		returnedCoins := types.Coins{
 			ThetaWei: returnedStake.Amount,
-			TFuelWei: types.Zero,
+			TFuelWei: new(big.Int),
 		}
-		sourceAccount.Balance = sourceAccount.Balance.Plus(returnedCoins)
-		view.SetAccount(sourceAddress, sourceAccount)
+		returnAccount.Balance = returnAccount.Balance.Plus(returnedCoins)
+		view.SetAccount(returnAddress, returnAccount)
+	}
+
+	// Deleted once all the stakes are returned, the withdrawals of a pair due at the same height share the address
+	for _, returnedStake := range returnedStakes {
+		view.DeleteStakeReturnAddress(purpose, returnedStake.Holder, returnedStake.Source, returnedStake.ReturnHeight)
 	}
-	view.UpdateValidatorCandidatePool(vcp)
 }
 
 // addSpecialTransactions adds special transactions (e.g. coinbase transaction, slash transaction) to the block
@@ -537,28 +1527,19 @@ func (ledger *Ledger) addSpecialTransactions(block *core.Block, view *st.StoreVi
 	proposer := ledger.valMgr.GetNextProposer(parentBlkHash, block.Epoch)
 	validatorSet := ledger.valMgr.GetNextValidatorSet(parentBlkHash)
 
-	ledger.addCoinbaseTx(view, &proposer, validatorSet, rawTxs)
+	ledger.addCoinbaseTx(view, &proposer, validatorSet, block.Epoch, rawTxs)
 	//ledger.addSlashTxs(view, &proposer, &validators, rawTxs)
 }
 
 // addCoinbaseTx adds a Coinbase transaction
-func (ledger *Ledger) addCoinbaseTx(view *st.StoreView, proposer *core.Validator, validatorSet *core.ValidatorSet, rawTxs *[]common.Bytes) {
+func (ledger *Ledger) addCoinbaseTx(view *st.StoreView, proposer *core.Validator, validatorSet *core.ValidatorSet, epoch uint64, rawTxs *[]common.Bytes) {
 	proposerAddress := proposer.Address
 	proposerTxIn := types.TxInput{
 		Address: proposerAddress,
 	}
 
-	accountRewardMap := exec.CalculateReward(view, validatorSet)
-
-	coinbaseTxOutputs := []types.TxOutput{}
-	for accountAddressStr, accountReward := range accountRewardMap {
-		var accountAddress common.Address
-		copy(accountAddress[:], accountAddressStr)
-		coinbaseTxOutputs = append(coinbaseTxOutputs, types.TxOutput{
-			Address: accountAddress,
-			Coins:   accountReward,
-		})
-	}
+	// The rewards not fitting in the transaction are carried over by the executor, see execution.CoinbaseOutputs
+	coinbaseTxOutputs, _ := ledger.executor.CoinbaseOutputs(view, validatorSet, epoch, proposerAddress)
 
 	coinbaseTx := &types.CoinbaseTx{
 		Proposer:    proposerTxIn,
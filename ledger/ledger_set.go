@@ -0,0 +1,292 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common/metrics"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/consensus"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	dp "github.com/thetatoken/theta/dispatcher"
+	exec "github.com/thetatoken/theta/ledger/execution"
+	mp "github.com/thetatoken/theta/mempool"
+	"github.com/thetatoken/theta/p2p"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+const (
+	chainMetricsPrefix = "chain/"
+
+	metricLedgerHeight = "ledger/height"
+	metricMempoolSize  = "mempool/size"
+	metricChainHalted  = "halted"
+)
+
+// ChainParams specifies a logical chain hosted by a LedgerSet
+type ChainParams struct {
+	ChainID    string
+	PrivateKey *crypto.PrivateKey
+	Root       *core.Block // the state of the root block must have been written to the chain namespace, see LedgerSet.NamespaceDB()
+	Network    p2p.Network // the network of the chain, must not be shared with other chains
+
+	ValidatorManager core.ValidatorManager // optional, uses the FixedValidatorManager if not specified
+	RewardSchedule   exec.RewardSchedule   // optional, uses the DefaultRewardSchedule if not specified
+	RunConsensus     bool                  // whether to start the consensus engine, i.e. produce and vote for blocks
+}
+
+//
+// ChainInstance holds the components of a logical chain hosted by a LedgerSet
+//
+type ChainInstance struct {
+	ChainID    string
+	DB         database.Database
+	Chain      *blockchain.Chain
+	Consensus  *consensus.ConsensusEngine
+	Dispatcher *dp.Dispatcher
+	Ledger     *Ledger
+	Mempool    *mp.Mempool
+	Metrics    metrics.Registry // metrics of the chain, labeled with the chainID
+
+	runConsensus bool
+	ctx          context.Context
+	cancel       context.CancelFunc
+
+	mu     *sync.RWMutex
+	halted error
+}
+
+// Halted returns the reason the chain was halted, or nil if the chain is running
+func (ci *ChainInstance) Halted() error {
+	ci.mu.RLock()
+	defer ci.mu.RUnlock()
+
+	return ci.halted
+}
+
+func (ci *ChainInstance) halt(reason error) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	if ci.halted == nil {
+		ci.halted = reason
+	}
+	metrics.GetOrRegisterGauge(metricChainHalted, ci.Metrics).Update(1)
+}
+
+func (ci *ChainInstance) updateMetrics() {
+	metrics.GetOrRegisterGauge(metricLedgerHeight, ci.Metrics).Update(int64(ci.Ledger.State().Height()))
+	metrics.GetOrRegisterGauge(metricMempoolSize, ci.Metrics).Update(int64(ci.Mempool.Size()))
+}
+
+//
+// LedgerSet runs several independent logical chains in one process. The chains share the host database,
+// where each chain only accesses the keys in its own namespace, and the metrics registry, where the metrics
+// of each chain are prefixed with its chainID. The requests are routed to the chains by chainID.
+//
+type LedgerSet struct {
+	mu     *sync.RWMutex
+	db     database.Database
+	chains map[string]*ChainInstance
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewLedgerSet creates an instance of LedgerSet on top of the given host database
+func NewLedgerSet(ctx context.Context, db database.Database) *LedgerSet {
+	c, cancel := context.WithCancel(ctx)
+	return &LedgerSet{
+		mu:     &sync.RWMutex{},
+		db:     db,
+		chains: make(map[string]*ChainInstance),
+		ctx:    c,
+		cancel: cancel,
+	}
+}
+
+// NamespaceDB returns the database namespace of the given chain, which can be used to
+// write the genesis state before adding the chain
+func (ls *LedgerSet) NamespaceDB(chainID string) (database.Database, error) {
+	return backend.NewNamespacedDatabase(ls.db, chainID)
+}
+
+// AddChain constructs and starts the components of a new chain
+func (ls *LedgerSet) AddChain(params *ChainParams) (*ChainInstance, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	chainID := params.ChainID
+	if _, exists := ls.chains[chainID]; exists {
+		return nil, fmt.Errorf("Chain %v already exists", chainID)
+	}
+	if params.Root == nil || params.Network == nil {
+		return nil, fmt.Errorf("Root block and network must be specified for chain %v", chainID)
+	}
+
+	db, err := ls.NamespaceDB(chainID)
+	if err != nil {
+		return nil, err
+	}
+	store := kvstore.NewKVStore(db)
+	chain := blockchain.NewChain(chainID, store, params.Root)
+
+	valMgr := params.ValidatorManager
+	if valMgr == nil {
+		valMgr = consensus.NewFixedValidatorManager()
+	}
+	dispatcher := dp.NewDispatcher(params.Network)
+	ce := consensus.NewConsensusEngine(params.PrivateKey, store, chain, dispatcher, valMgr)
+	mempool := mp.CreateMempool(dispatcher)
+	ledger := NewLedgerWithRewardSchedule(chainID, db, chain, ce, valMgr, mempool, params.RewardSchedule)
+
+	valMgr.SetConsensusEngine(ce)
+	ce.SetLedger(ledger)
+	mempool.SetLedger(ledger)
+	mempool.SetSafeMode(ce.SafeMode())
+	params.Network.RegisterMessageHandler(mp.CreateMempoolMessageHandler(mempool))
+
+	lastFinalized := ce.GetLastFinalizedBlock()
+	if res := ledger.ResetState(lastFinalized.Height, lastFinalized.StateHash); res.IsError() {
+		return nil, fmt.Errorf("Failed to load the state of chain %v: %v", chainID, res.Message)
+	}
+	if res := ledger.FinalizeState(lastFinalized.Height, lastFinalized.StateHash); res.IsError() {
+		return nil, fmt.Errorf("Failed to load the state of chain %v: %v", chainID, res.Message)
+	}
+
+	ctx, cancel := context.WithCancel(ls.ctx)
+	instance := &ChainInstance{
+		ChainID:      chainID,
+		DB:           db,
+		Chain:        chain,
+		Consensus:    ce,
+		Dispatcher:   dispatcher,
+		Ledger:       ledger,
+		Mempool:      mempool,
+		Metrics:      metrics.NewPrefixedChildRegistry(metrics.DefaultRegistry, chainMetricsPrefix+chainID+"/"),
+		runConsensus: params.RunConsensus,
+		ctx:          ctx,
+		cancel:       cancel,
+		mu:           &sync.RWMutex{},
+	}
+	metrics.GetOrRegisterGauge(metricChainHalted, instance.Metrics).Update(0)
+	instance.updateMetrics()
+
+	// Like the block application through the ledger set, a panic of the consensus engine only halts the chain
+	ce.SetPanicHandler(func(r interface{}) {
+		err := fmt.Errorf("%v", r)
+		logger.WithFields(log.Fields{"chainID": chainID, "error": err}).Error("Chain halted")
+		instance.halt(err)
+	})
+
+	if err := dispatcher.Start(ctx); err != nil {
+		cancel()
+		return nil, fmt.Errorf("Failed to start the network of chain %v: %v", chainID, err)
+	}
+	mempool.Start(ctx)
+	if params.RunConsensus {
+		ce.Start(ctx)
+	}
+
+	ls.chains[chainID] = instance
+
+	logger.WithFields(log.Fields{"chainID": chainID, "height": lastFinalized.Height}).Info("Added chain to the ledger set")
+
+	return instance, nil
+}
+
+// RemoveChain stops the components of the given chain and releases its resources. The data
+// of the chain is kept in its namespace, so the chain can be added back later.
+func (ls *LedgerSet) RemoveChain(chainID string) error {
+	ls.mu.Lock()
+	instance, exists := ls.chains[chainID]
+	delete(ls.chains, chainID)
+	ls.mu.Unlock()
+
+	if !exists {
+		return fmt.Errorf("Chain %v does not exist", chainID)
+	}
+
+	instance.cancel()
+	instance.Mempool.Stop()
+	if instance.runConsensus {
+		instance.Consensus.Wait()
+	}
+	instance.Mempool.Wait()
+	instance.Dispatcher.Wait()
+
+	instance.Metrics.Unregister(metricLedgerHeight)
+	instance.Metrics.Unregister(metricMempoolSize)
+	instance.Metrics.Unregister(metricChainHalted)
+
+	logger.WithFields(log.Fields{"chainID": chainID}).Info("Removed chain from the ledger set")
+
+	return nil
+}
+
+// GetChain returns the chain with the given chainID. It returns an error if the chain does
+// not exist, or has been halted.
+func (ls *LedgerSet) GetChain(chainID string) (*ChainInstance, error) {
+	ls.mu.RLock()
+	instance, exists := ls.chains[chainID]
+	ls.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("Chain %v does not exist", chainID)
+	}
+	if err := instance.Halted(); err != nil {
+		return nil, fmt.Errorf("Chain %v has been halted: %v", chainID, err)
+	}
+	return instance, nil
+}
+
+// ChainIDs returns the sorted chainIDs of the chains in the set
+func (ls *LedgerSet) ChainIDs() []string {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	chainIDs := make([]string, 0, len(ls.chains))
+	for chainID := range ls.chains {
+		chainIDs = append(chainIDs, chainID)
+	}
+	sort.Strings(chainIDs)
+	return chainIDs
+}
+
+// ApplyBlockTxs applies the transactions of the given block to the ledger of the given chain.
+// If the ledger panics, e.g. due to corrupted data, only the given chain is halted.
+func (ls *LedgerSet) ApplyBlockTxs(chainID string, block *core.Block) (res result.Result) {
+	instance, err := ls.GetChain(chainID)
+	if err != nil {
+		return result.Error("%v", err)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err := fmt.Errorf("%v", r)
+			logger.WithFields(log.Fields{"chainID": chainID, "error": err}).Error("Chain halted")
+			instance.halt(err)
+			res = result.Error("Chain %v halted: %v", chainID, err)
+		}
+	}()
+
+	res = instance.Ledger.ApplyBlockTxs(block)
+	instance.updateMetrics()
+	return res
+}
+
+// Stop stops all the chains in the set
+func (ls *LedgerSet) Stop() {
+	for _, chainID := range ls.ChainIDs() {
+		ls.RemoveChain(chainID)
+	}
+	ls.cancel()
+}
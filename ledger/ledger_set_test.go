@@ -0,0 +1,234 @@
+package ledger
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/metrics"
+	"github.com/thetatoken/theta/consensus"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	exec "github.com/thetatoken/theta/ledger/execution"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	p2psim "github.com/thetatoken/theta/p2p/simulation"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+type testChain struct {
+	instance *ChainInstance
+	tip      *core.ExtendedBlock
+	accOut   types.PrivAccount
+	accIn    types.PrivAccount
+	sequence int
+}
+
+func addTestChain(t *testing.T, ls *LedgerSet, chainID string) *testChain {
+	return addTestChainWithParams(t, ls, &ChainParams{ChainID: chainID})
+}
+
+// addTestChainWithParams adds a chain with the given params, where the root block, the
+// network, and the private key are filled in
+func addTestChainWithParams(t *testing.T, ls *LedgerSet, params *ChainParams) *testChain {
+	require := require.New(t)
+
+	chainID := params.ChainID
+
+	db, err := ls.NamespaceDB(chainID)
+	require.Nil(err)
+
+	accOut := types.MakeAccWithInitBalance("accOut", types.NewCoins(700000, 3))
+	accIn := types.MakeAccWithInitBalance("accIn", types.NewCoins(900000, 50000*getMinimumTxFee()))
+	view := state.NewStoreView(1, common.Hash{}, db)
+	exec.LowerDustThresholds(view)
+	view.SetAccount(accOut.Address, &accOut.Account)
+	view.SetAccount(accIn.Address, &accIn.Account)
+
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = 1
+	root.StateHash = view.Save()
+	root.Timestamp = big.NewInt(time.Now().Unix())
+
+	if params.PrivateKey == nil {
+		params.PrivateKey, _, _ = crypto.GenerateKeyPair()
+	}
+	params.Root = root
+	params.Network = p2psim.NewSimnetWithHandler(nil).AddEndpoint("peer_" + chainID)
+	instance, err := ls.AddChain(params)
+	require.Nil(err)
+
+	return &testChain{
+		instance: instance,
+		tip:      instance.Chain.Root(),
+		accOut:   accOut,
+		accIn:    accIn,
+	}
+}
+
+// applyNextBlock proposes a block with one send transaction, and applies it through the ledger set
+func (tc *testChain) applyNextBlock(t *testing.T, ls *LedgerSet) {
+	require := require.New(t)
+
+	tc.sequence++
+	sendTx := newRawSendTx(tc.instance.ChainID, tc.sequence, true, tc.accOut, tc.accIn, false)
+	require.Nil(tc.instance.Mempool.InsertTransaction(sendTx))
+	stateRoot, blockRawTxs, res := tc.instance.Ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	require.Equal(1, len(blockRawTxs))
+
+	block := core.NewBlock()
+	block.ChainID = tc.instance.ChainID
+	block.Height = tc.tip.Height + 1
+	block.Parent = tc.tip.Hash()
+	block.StateHash = stateRoot
+	block.Txs = blockRawTxs
+	res = ls.ApplyBlockTxs(tc.instance.ChainID, block)
+	require.True(res.IsOK(), res.Message)
+
+	tip, err := tc.instance.Chain.AddBlock(block)
+	require.Nil(err)
+	require.Nil(tc.instance.Chain.FinalizePreviousBlocks(tip.Hash()))
+	tc.tip = tip
+}
+
+func TestLedgerSetChainIsolation(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	host := backend.NewMemDatabase()
+	ls := NewLedgerSet(context.Background(), host)
+	defer ls.Stop()
+
+	chain1 := addTestChain(t, ls, "chain1")
+	chain2 := addTestChain(t, ls, "chain2")
+	assert.Equal([]string{"chain1", "chain2"}, ls.ChainIDs())
+
+	for i := 0; i < 2; i++ {
+		chain1.applyNextBlock(t, ls)
+		chain2.applyNextBlock(t, ls)
+	}
+	assert.Equal(uint64(2), chain1.instance.Ledger.State().Delivered().GetAccount(chain1.accIn.Address).Sequence)
+	assert.Equal(uint64(2), chain2.instance.Ledger.State().Delivered().GetAccount(chain2.accIn.Address).Sequence)
+
+	// Corrupt all the data of chain1
+	chain1Prefix := database.NamespacePrefix("chain1")
+	for _, key := range host.Keys() {
+		if bytes.HasPrefix(key, chain1Prefix) {
+			require.Nil(host.Put(key, []byte("corrupted")))
+		}
+	}
+
+	// A block that crashes the ledger of chain1 only halts chain1
+	res := ls.ApplyBlockTxs("chain1", &core.Block{})
+	assert.True(res.IsError())
+	assert.NotNil(chain1.instance.Halted())
+	_, err := ls.GetChain("chain1")
+	assert.NotNil(err)
+	res = ls.ApplyBlockTxs("chain1", &core.Block{BlockHeader: &core.BlockHeader{}})
+	assert.True(res.IsError())
+
+	// The sibling chain keeps applying blocks
+	for i := 0; i < 3; i++ {
+		chain2.applyNextBlock(t, ls)
+	}
+	assert.Nil(chain2.instance.Halted())
+	assert.Equal(uint64(5), chain2.instance.Ledger.State().Delivered().GetAccount(chain2.accIn.Address).Sequence)
+	account, err := chain2.instance.Ledger.GetAccountAtHeight(chain2.accIn.Address, chain2.tip.Height)
+	require.Nil(err)
+	assert.Equal(uint64(5), account.Sequence)
+}
+
+// panickingValidatorManager panics on the validator set lookups of the vote processing
+type panickingValidatorManager struct {
+	*consensus.FixedValidatorManager
+}
+
+func (m panickingValidatorManager) GetNextValidatorSet(blockHash common.Hash) *core.ValidatorSet {
+	panic("corrupted validator set")
+}
+
+func TestLedgerSetConsensusIsolation(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ls := NewLedgerSet(context.Background(), backend.NewMemDatabase())
+	defer ls.Stop()
+
+	privKey, _, _ := crypto.GenerateKeyPair()
+	chain1 := addTestChainWithParams(t, ls, &ChainParams{
+		ChainID:          "chain1",
+		PrivateKey:       privKey,
+		ValidatorManager: panickingValidatorManager{consensus.NewFixedValidatorManager()},
+		RunConsensus:     true,
+	})
+	chain2 := addTestChain(t, ls, "chain2")
+
+	// A vote that crashes the consensus engine of chain1 only halts chain1
+	vote := core.Vote{Block: chain1.tip.Hash(), ID: privKey.PublicKey().Address(), Epoch: 1}
+	vote.Sign(privKey)
+	chain1.instance.Consensus.AddMessage(vote)
+	chain1.instance.Consensus.Wait()
+	assert.NotNil(chain1.instance.Halted())
+	_, err := ls.GetChain("chain1")
+	assert.NotNil(err)
+
+	// The sibling chain keeps applying blocks
+	chain2.applyNextBlock(t, ls)
+	assert.Nil(chain2.instance.Halted())
+
+	// All the routines of the halted chain are stopped
+	require.Nil(ls.RemoveChain("chain1"))
+}
+
+func TestLedgerSetLifecycle(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ls := NewLedgerSet(context.Background(), backend.NewMemDatabase())
+	defer ls.Stop()
+
+	chain1 := addTestChain(t, ls, "chain1")
+	_, err := ls.AddChain(&ChainParams{ChainID: "chain1", Root: chain1.tip.Block, Network: p2psim.NewSimnetWithHandler(nil).AddEndpoint("peer")})
+	assert.NotNil(err, "Should not add a chain twice")
+	_, err = ls.NamespaceDB("chain1/sub")
+	assert.NotNil(err, "Should not allow overlapping namespaces")
+
+	chain1.applyNextBlock(t, ls)
+
+	// The metrics of the chain are labeled with the chainID
+	assert.NotNil(metrics.DefaultRegistry.Get("chain/chain1/ledger/height"))
+	assert.NotNil(metrics.DefaultRegistry.Get("chain/chain1/mempool/size"))
+	assert.NotNil(metrics.DefaultRegistry.Get("chain/chain1/halted"))
+
+	instance, err := ls.GetChain("chain1")
+	require.Nil(err)
+	assert.Equal(chain1.instance, instance)
+
+	require.Nil(ls.RemoveChain("chain1"))
+	assert.NotNil(ls.RemoveChain("chain1"))
+	assert.Equal(0, len(ls.ChainIDs()))
+	_, err = ls.GetChain("chain1")
+	assert.NotNil(err)
+	res := ls.ApplyBlockTxs("chain1", &core.Block{BlockHeader: &core.BlockHeader{}})
+	assert.True(res.IsError())
+	assert.Nil(metrics.DefaultRegistry.Get("chain/chain1/ledger/height"))
+	assert.Nil(metrics.DefaultRegistry.Get("chain/chain1/halted"))
+
+	// The data is kept in the namespace, so the chain can be added back
+	db, err := ls.NamespaceDB("chain1")
+	require.Nil(err)
+	has, err := db.Has(chain1.tip.Hash().Bytes())
+	require.Nil(err)
+	assert.True(has)
+	chain1Again := addTestChain(t, ls, "chain1")
+	assert.Equal([]string{"chain1"}, ls.ChainIDs())
+	assert.NotEqual(chain1.instance, chain1Again.instance)
+}
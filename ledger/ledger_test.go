@@ -1,20 +1,33 @@
 package ledger
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
 	"fmt"
 	"math/big"
 	"testing"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/blockchain"
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/consensus"
 	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	exec "github.com/thetatoken/theta/ledger/execution"
+	"github.com/thetatoken/theta/ledger/state"
 	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/ledger/vm"
+	mp "github.com/thetatoken/theta/mempool"
+	p2psim "github.com/thetatoken/theta/p2p/simulation"
 	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
 )
 
 func TestLedgerSetup(t *testing.T) {
@@ -41,6 +54,96 @@ func TestLedgerScreenTx(t *testing.T) {
 	assert.Equal(result.CodeUnauthorizedTx, res.Code, res.Message)
 }
 
+func TestLedgerScreenTxs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, _ := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 2)
+
+	rawTxs := []common.Bytes{
+		newRawSendTx(chainID, 1, true, accOut, accIns[0], false),
+		newRawSendTx(chainID, 2, true, accOut, accIns[0], false),
+		newRawSendTx(chainID, 1, true, accOut, accIns[1], false),
+		newRawCoinbaseTx(chainID, ledger, 1),
+		common.Bytes("invalid tx"),
+	}
+
+	// Screened independently, the second tx from accIns[0] has an invalid sequence
+	results := ledger.ScreenTxs(rawTxs, false)
+	require.Equal(len(rawTxs), len(results))
+	assert.True(results[0].Result.IsOK(), results[0].Result.Message)
+	assert.NotNil(results[0].TxInfo)
+	assert.Equal(accIns[0].Address, results[0].TxInfo.Address)
+	assert.True(results[1].Result.IsError())
+	assert.Nil(results[1].TxInfo)
+	assert.True(results[2].Result.IsOK(), results[2].Result.Message)
+	assert.Equal(result.CodeUnauthorizedTx, results[3].Result.Code, results[3].Result.Message)
+	assert.True(results[4].Result.IsError())
+
+	// Screened sequentially, the second tx sees the effects of the first one
+	results = ledger.ScreenTxs(rawTxs, true)
+	require.Equal(len(rawTxs), len(results))
+	assert.True(results[0].Result.IsOK(), results[0].Result.Message)
+	assert.True(results[1].Result.IsOK(), results[1].Result.Message)
+	assert.Equal(uint64(2), results[1].TxInfo.Sequence)
+	assert.True(results[2].Result.IsOK(), results[2].Result.Message)
+	assert.Equal(result.CodeUnauthorizedTx, results[3].Result.Code, results[3].Result.Message)
+	assert.True(results[4].Result.IsError())
+
+	// The batch does not modify the screened state
+	_, res := ledger.ScreenTx(rawTxs[0])
+	assert.True(res.IsOK(), res.Message)
+}
+
+// newBenchmarkScreenTxs prepares numAccs*numTxsPerAcc send transactions
+func newBenchmarkScreenTxs(numAccs, numTxsPerAcc int) (*Ledger, []common.Bytes) {
+	chainID, ledger, _ := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, numAccs)
+
+	rawTxs := []common.Bytes{}
+	for seq := 1; seq <= numTxsPerAcc; seq++ {
+		for _, accIn := range accIns {
+			rawTxs = append(rawTxs, newRawSendTx(chainID, seq, true, accOut, accIn, false))
+		}
+	}
+	return ledger, rawTxs
+}
+
+func BenchmarkLedgerScreenTx(b *testing.B) {
+	log.SetLevel(log.WarnLevel)
+	defer log.SetLevel(log.DebugLevel)
+
+	ledger, rawTxs := newBenchmarkScreenTxs(100, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, rawTx := range rawTxs {
+			if _, res := ledger.ScreenTx(rawTx); res.IsError() {
+				b.Fatal(res.Message)
+			}
+		}
+
+		b.StopTimer()
+		ledger.state.Commit() // resets the screened view
+		b.StartTimer()
+	}
+}
+
+func BenchmarkLedgerScreenTxs(b *testing.B) {
+	log.SetLevel(log.WarnLevel)
+	defer log.SetLevel(log.DebugLevel)
+
+	ledger, rawTxs := newBenchmarkScreenTxs(100, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, res := range ledger.ScreenTxs(rawTxs, true) {
+			if res.Result.IsError() {
+				b.Fatal(res.Result.Message)
+			}
+		}
+	}
+}
+
 func TestLedgerProposerBlockTxs(t *testing.T) {
 	assert := assert.New(t)
 
@@ -102,6 +205,148 @@ func TestLedgerProposerBlockTxs(t *testing.T) {
 	}
 }
 
+func TestLedgerProposeBlockTxsWithDeadline(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID := "test_chain_001"
+	db := backend.NewMemDatabase()
+
+	snapshot, srcPrivAccs, valPrivAccs := genSimSnapshot(chainID, db)
+
+	// Run as the proposer so the CoinbaseTx can be signed
+	proposerAddress := consensus.SelectTopStakeHoldersAsValidators(snapshot.vcp).Validators()[0].Address
+	var proposerPrivAcc *types.PrivAccount
+	for _, valPrivAcc := range valPrivAccs {
+		if valPrivAcc.Address == proposerAddress {
+			proposerPrivAcc = valPrivAcc
+		}
+	}
+	require.NotNil(proposerPrivAcc)
+
+	es := newExecSim(chainID, db, snapshot, proposerPrivAcc)
+	ledger := es.consensus.GetLedger().(*Ledger)
+	mempool := ledger.mempool
+	mempool.SetLedger(ledger)
+
+	accOut := srcPrivAccs[0]
+	numTxs := len(srcPrivAccs) - 1
+	for idx := 1; idx <= numTxs; idx++ {
+		sendTxBytes := newRawSendTx(chainID, 1, true, *accOut, *srcPrivAccs[idx], false)
+		require.Nil(mempool.InsertTransaction(sendTxBytes))
+	}
+
+	// Artificially slow down the tx execution
+	txCheckTime := 20 * time.Millisecond
+	deadline := time.Now().Add(time.Hour)
+	clock := common.NewManualClock(deadline.Add(-4 * txCheckTime))
+	ledger.clock = clock
+	ledger.proposalTxHook = func(tx types.Tx) { clock.Advance(txCheckTime) }
+
+	b0 := es.getTipBlock()
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Height = b0.Height + 1
+	block.Parent = b0.Hash()
+	block.HCC.BlockHash = block.Parent
+	block.Epoch = 1
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	stateRoot, blockRawTxs, res := ledger.ProposeBlockTxsWithDeadline(ctx, block)
+	assert.False(clock.Now().After(deadline))
+	require.True(res.IsOK(), res.Message)
+
+	// The CoinbaseTx is always included, followed by a valid prefix of the regular txs
+	require.True(len(blockRawTxs) > 1)
+	numRegularTxs := len(blockRawTxs) - 1
+	assert.True(numRegularTxs < numTxs)
+	assert.True(numRegularTxs < core.MaxNumRegularTxsPerBlock)
+	coinbaseTx, err := types.TxFromBytes(blockRawTxs[0])
+	require.Nil(err)
+	_, ok := coinbaseTx.(*types.CoinbaseTx)
+	assert.True(ok)
+
+	// The txs not reaped should remain in the mempool
+	assert.Equal(numTxs-numRegularTxs, mempool.Size())
+
+	// The partial block should produce a consistent state hash
+	ledger.proposalTxHook = nil
+	block.StateHash = stateRoot
+	block.Txs = blockRawTxs
+	res = ledger.ApplyBlockTxs(block)
+	assert.True(res.IsOK(), res.Message)
+}
+
+func TestLedgerProposeEmptyBlockTxs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	es, block := newTestProposerExecSim(t, "test_chain_001")
+	ledger := es.consensus.GetLedger().(*Ledger)
+	mempool := ledger.mempool
+	assert.False(ledger.HasPendingTxs())
+	b0 := es.getTipBlock()
+
+	// The mempool lock is not needed
+	mempool.Lock()
+	emptyRoot, emptyRawTxs, res := ledger.ProposeEmptyBlockTxs(block)
+	mempool.Unlock()
+	require.True(res.IsOK(), res.Message)
+	require.Equal(1, len(emptyRawTxs))
+	coinbaseTx, err := types.TxFromBytes(emptyRawTxs[0])
+	require.Nil(err)
+	_, ok := coinbaseTx.(*types.CoinbaseTx)
+	assert.True(ok)
+
+	// Same as the normal path with an empty mempool
+	res = ledger.ResetState(b0.Height, b0.StateHash)
+	require.True(res.IsOK(), res.Message)
+	stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(block)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(stateRoot, emptyRoot)
+	assert.Equal(len(blockRawTxs), len(emptyRawTxs)) // the order of the coinbase outputs may vary
+
+	res = ledger.ResetState(b0.Height, b0.StateHash)
+	require.True(res.IsOK(), res.Message)
+	emptyRoot, emptyRawTxs, res = ledger.ProposeEmptyBlockTxs(block)
+	require.True(res.IsOK(), res.Message)
+	block.StateHash = emptyRoot
+	block.Txs = emptyRawTxs
+	res = ledger.ApplyBlockTxs(block)
+	assert.True(res.IsOK(), res.Message)
+	assert.Equal(emptyRoot, ledger.state.Delivered().Hash())
+}
+
+// newTestProposerExecSim returns an execSim running as the proposer of the next block, so the CoinbaseTx can be
+// signed, and the next block to be proposed
+func newTestProposerExecSim(t *testing.T, chainID string) (*execSim, *core.Block) {
+	db := backend.NewMemDatabase()
+	snapshot, _, valPrivAccs := genSimSnapshot(chainID, db)
+
+	proposerAddress := consensus.SelectTopStakeHoldersAsValidators(snapshot.vcp).Validators()[0].Address
+	var proposerPrivAcc *types.PrivAccount
+	for _, valPrivAcc := range valPrivAccs {
+		if valPrivAcc.Address == proposerAddress {
+			proposerPrivAcc = valPrivAcc
+		}
+	}
+	require.NotNil(t, proposerPrivAcc)
+
+	es := newExecSim(chainID, db, snapshot, proposerPrivAcc)
+	ledger := es.consensus.GetLedger().(*Ledger)
+	ledger.mempool.SetLedger(ledger)
+
+	b0 := es.getTipBlock()
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Height = b0.Height + 1
+	block.Parent = b0.Hash()
+	block.HCC.BlockHash = block.Parent
+	block.Epoch = 1
+	return es, block
+}
+
 func TestLedgerApplyBlockTxs(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -160,172 +405,994 @@ func TestLedgerApplyBlockTxs(t *testing.T) {
 	}
 }
 
-// Test case for validator stake deposit, withdrawal, and return
-func TestValidatorStakeUpdate(t *testing.T) {
+func TestLedgerApplyBlockTxsWithReceipts(t *testing.T) {
 	assert := assert.New(t)
+	require := require.New(t)
 
-	// ----------------- Stake Deposit ----------------- //
+	chainID, ledger, mempool := newTestLedger()
+	numInAccs := 3
+	accOut, accIns := prepareInitLedgerState(ledger, numInAccs)
 
-	chainID := "test_chain_001"
-	db := backend.NewMemDatabase()
+	sendTx1Bytes := newRawSendTx(chainID, 1, true, accOut, accIns[0], false)
+	sendTx2Bytes := newRawSendTx(chainID, 1, true, accOut, accIns[1], false)
+	require.Nil(mempool.InsertTransaction(sendTx1Bytes))
+	require.Nil(mempool.InsertTransaction(sendTx2Bytes))
 
-	snapshot, srcPrivAccs, valPrivAccs := genSimSnapshot(chainID, db)
-	assert.Equal(6, len(srcPrivAccs))
-	assert.Equal(6, len(valPrivAccs))
+	stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	require.Equal(2, len(blockRawTxs))
 
-	es := newExecSim(chainID, db, snapshot, valPrivAccs[0])
-	b0 := es.getTipBlock()
+	block := &core.Block{BlockHeader: &core.BlockHeader{StateHash: stateRoot}, Txs: blockRawTxs}
+	receipts, res := ledger.ApplyBlockTxsWithReceipts(block)
+	require.True(res.IsOK(), res.Message)
+	require.Equal(2, len(receipts))
 
-	// Add block #1 with a DepositStakeTx transaction
-	b1 := core.NewBlock()
-	b1.ChainID = chainID
-	b1.Height = b0.Height + 1
-	b1.Epoch = 1
-	b1.Parent = b0.Hash()
-	b1.HCC.BlockHash = b1.Parent
+	txFee := types.NewCoins(0, getMinimumTxFee())
+	for idx, receipt := range receipts {
+		txHash := crypto.Keccak256Hash(blockRawTxs[idx])
+		assert.Equal(txHash, receipt.TxHash)
+		assert.True(receipt.IsOK())
+		assert.Equal(txFee, receipt.Fee)
 
-	txFee := getMinimumTxFee()
-	depositSourcePrivAcc := srcPrivAccs[4]
-	depoistHolderPrivAcc := valPrivAccs[4]
-	depositStakeTx := &types.DepositStakeTx{
-		Fee: types.NewCoins(0, txFee),
-		Source: types.TxInput{
-			Address: depositSourcePrivAcc.Address,
-			Coins: types.Coins{
-				ThetaWei: new(big.Int).Mul(new(big.Int).SetUint64(10), core.MinValidatorStakeDeposit),
-				TFuelWei: new(big.Int).SetUint64(0),
-			},
-			Sequence: 1,
-		},
-		Holder: types.TxOutput{
-			Address: depoistHolderPrivAcc.Address,
-		},
-		Purpose: core.StakeForValidator,
+		storedReceipt, err := ledger.GetTxReceipt(txHash)
+		require.Nil(err)
+		assert.Equal(receipt.TxHash, storedReceipt.TxHash)
+		assert.Equal(receipt.Code, storedReceipt.Code)
+		assert.True(receipt.Fee.IsEqual(storedReceipt.Fee))
 	}
-	signBytes := depositStakeTx.SignBytes(es.chainID)
-	depositStakeTx.Source.Signature = depositSourcePrivAcc.Sign(signBytes)
 
-	_, res := es.executor.ExecuteTx(depositStakeTx)
-	assert.True(res.IsOK(), res.Message)
+	// The block fails since two transactions of the account have the same
+	// sequence, the last receipt should point to the failed transaction
+	sendTx3Bytes := newRawSendTx(chainID, 1, true, accOut, accIns[2], false)
+	sendTx4Bytes := newRawSendTx(chainID, 1, true, accOut, accIns[2], true)
+	block = &core.Block{BlockHeader: &core.BlockHeader{}, Txs: []common.Bytes{sendTx3Bytes, sendTx4Bytes}}
+	receipts, res = ledger.ApplyBlockTxsWithReceipts(block)
+	require.True(res.IsError())
+	require.Equal(2, len(receipts))
+	assert.True(receipts[0].IsOK())
+	assert.Equal(uint64(result.CodeSequenceTooLow), receipts[1].Code)
 
-	b1.StateHash = es.state.Commit()
-	es.addBlock(b1)
+	// Receipts of a failed block should not be persisted
+	_, err := ledger.GetTxReceipt(crypto.Keccak256Hash(sendTx3Bytes))
+	assert.NotNil(err)
+}
 
-	// Add more blocks
-	b2 := core.NewBlock()
-	b2.ChainID = chainID
-	b2.Height = b1.Height + 1
-	b2.Epoch = 2
-	b2.Parent = b1.Hash()
-	b2.StateHash = es.state.Commit()
-	b2.HCC.BlockHash = b2.Parent
-	es.addBlock(b2)
+func TestNewTxReceiptVmError(t *testing.T) {
+	assert := assert.New(t)
 
-	b3 := core.NewBlock()
-	b3.ChainID = chainID
-	b3.Height = b2.Height + 1
-	b3.Epoch = 3
-	b3.Parent = b2.Hash()
-	b3.HCC.BlockHash = b3.Parent
-	b3.StateHash = es.state.Commit()
-	es.addBlock(b3)
+	// A smart contract tx running out of gas is applied with its state changes reverted, and charged for the gas
+	fee := types.NewCoins(0, 1000)
+	res := result.OKWith(result.Info{"fee": fee, "gasUsed": uint64(21000), "logs": []*types.Log(nil), "vmError": "out of gas"})
+	receipt := newTxReceipt(common.Hash{}, nil, res)
+	assert.True(receipt.IsOK())
+	assert.Equal("out of gas", receipt.Message)
+	assert.Equal(uint64(21000), receipt.GasUsed)
+	assert.Equal(fee, receipt.Fee)
+}
 
-	// ----------------- Stake Withdrawal ----------------- //
+func TestLedgerGetInternalTransfers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
 
-	withdrawSourcePrivAcc := srcPrivAccs[0]
-	withdrawHolderPrivAcc := valPrivAccs[0]
+	chainID, ledger, accs := newContractTestLedger(2)
+	caller := accs[0]
 
-	srcAcc := es.state.Delivered().GetAccount(withdrawSourcePrivAcc.Address)
-	balance0 := srcAcc.Balance
-	log.Infof("Source account balance before withdrawal : %v", balance0)
+	// ASM:
+	// push 0x0, push 0x0, push 0x0, push 0x0, push 0x64, push20 recipient, gas, call
+	contractAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	recipientAddr := common.HexToAddress("0x2000000000000000000000000000000000000001")
+	ledger.state.Delivered().SetCode(contractAddr, common.Hex2Bytes("60006000600060006064"+"73"+hex.EncodeToString(recipientAddr.Bytes())+"5af1"))
+	ledger.state.Commit()
 
-	// Add block #4 with a WithdrawStakeTx transaction
-	b4 := core.NewBlock()
-	b4.ChainID = chainID
-	b4.Height = b3.Height + 1
-	b4.Epoch = 4
-	b4.Parent = b3.Hash()
-	b4.HCC.BlockHash = b4.Parent
+	contractTx := newRawContractTx(chainID, 1, caller, contractAddr, 1000, 100000, nil)
+	sendTx := newRawSendTx(chainID, 1, true, caller, accs[1], false)
+	block, receipts := proposeAndApplyBlock(t, ledger, common.Hash{}, contractTx, sendTx)
+	require.Equal(3, len(block.Txs))
+	require.Equal(1, len(receipts[1].InternalTransfers))
 
-	widthrawStakeTx := &types.WithdrawStakeTx{
-		Fee: types.NewCoins(0, txFee),
-		Source: types.TxInput{
-			Address:  withdrawSourcePrivAcc.Address,
-			Sequence: 1,
-		},
-		Holder: types.TxOutput{
-			Address: withdrawHolderPrivAcc.Address,
-		},
-		Purpose: core.StakeForValidator,
+	// The internal transfers are applied with the block, and recorded in the receipt of the tx
+	transfers, truncated, err := ledger.GetInternalTransfers(crypto.Keccak256Hash(contractTx))
+	require.Nil(err)
+	assert.False(truncated)
+	require.Equal(1, len(transfers))
+	assert.Equal("CALL", transfers[0].Type)
+	assert.Equal(contractAddr, transfers[0].From)
+	assert.Equal(recipientAddr, transfers[0].To)
+	assert.True(types.NewCoins(0, 100).IsEqual(transfers[0].Amount))
+	assert.Equal(uint64(1), transfers[0].Depth)
+	assert.True(transfers[0].Success)
+	assert.Equal(big.NewInt(100), ledger.state.Delivered().GetAccount(recipientAddr).Balance.TFuelWei)
+	assert.Equal(big.NewInt(900), ledger.state.Delivered().GetAccount(contractAddr).Balance.TFuelWei)
+
+	// The transfers are committed by the receipt root of the block
+	receipts[1].InternalTransfers[0].Amount = types.NewCoins(0, 200)
+	assert.Equal(result.CodeReceiptRootMismatch, checkBlockReceiptRoot(block, receipts).Code)
+
+	// The transactions without any internal transfers
+	transfers, truncated, err = ledger.GetInternalTransfers(crypto.Keccak256Hash(sendTx))
+	require.Nil(err)
+	assert.False(truncated)
+	assert.Equal(0, len(transfers))
+
+	_, _, err = ledger.GetInternalTransfers(common.BytesToHash([]byte("unknown tx")))
+	assert.NotNil(err)
+}
+
+func TestLedgerApplyBlockTxsErrorCodes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	newBlock := func(ledger *Ledger, stateRoot common.Hash, rawTxs ...common.Bytes) *core.Block {
+		block := core.NewBlock()
+		block.ChainID = ledger.state.GetChainID()
+		block.Height = ledger.state.Height()
+		block.StateHash = stateRoot
+		block.Txs = rawTxs
+		return block
 	}
-	signBytes = widthrawStakeTx.SignBytes(es.chainID)
-	widthrawStakeTx.Source.Signature = withdrawSourcePrivAcc.Sign(signBytes)
 
-	_, res = es.executor.ExecuteTx(widthrawStakeTx)
-	assert.True(res.IsOK(), res.Message)
+	// Invalid txs
+	chainID, ledger, _ := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 2)
+	baseRoot := ledger.state.Delivered().Hash()
+	sendTxBytes := newRawSendTx(chainID, 1, true, accOut, accIns[0], false)
+	sameSeqSendTxBytes := newRawSendTx(chainID, 1, true, accOut, accIns[0], true)
+	receipts, res := ledger.ApplyBlockTxsWithReceipts(newBlock(ledger, common.Hash{}, sendTxBytes, sameSeqSendTxBytes))
+	assert.Equal(result.CodeInvalidTx, res.Code, res.Message)
+	assert.False(res.IsInternalError())
+	require.Equal(2, len(receipts))
+	assert.Equal(uint64(result.CodeSequenceTooLow), receipts[1].Code)
 
-	b4.StateHash = es.state.Commit()
-	es.addBlock(b4)
+	res = ledger.ApplyBlockTxs(newBlock(ledger, common.Hash{}, sendTxBytes, common.Bytes("not a tx")))
+	assert.Equal(result.CodeInvalidTx, res.Code, res.Message)
 
-	b5 := core.NewBlock()
-	b5.ChainID = chainID
-	b5.Height = b4.Height + 1
-	b5.Epoch = 5
-	b5.Parent = b4.Hash()
-	b5.HCC.BlockHash = b5.Parent
-	b5.StateHash = es.state.Commit()
+	res = ledger.ApplyBlockTxs(newBlock(ledger, common.BytesToHash([]byte("bad root")), sendTxBytes))
+	assert.Equal(result.CodeStateRootMismatch, res.Code, res.Message)
+	assert.Equal(baseRoot, ledger.state.Delivered().Hash())
 
-	es.addBlock(b5)
+	// The state can not be loaded
+	res = ledger.ResetState(ledger.state.Height(), common.BytesToHash([]byte("unknown root")))
+	assert.Equal(result.CodeInternalStoreError, res.Code, res.Message)
+	assert.True(res.IsInternalError())
 
-	b6 := core.NewBlock()
-	b6.ChainID = chainID
-	b6.Height = b5.Height + 1
-	b6.Epoch = 6
-	b6.Parent = b5.Hash()
-	b6.HCC.BlockHash = b6.Parent
-	b6.StateHash = es.state.Commit()
-	es.addBlock(b6)
+	// The trie nodes below the root are missing, e.g. due to a database failure. The
+	// block is not reported invalid, since the accounts only look missing.
+	res = ledger.ResetState(ledger.state.Height(), baseRoot)
+	require.True(res.IsOK(), res.Message)
+	db := ledger.state.DB().(*backend.MemDatabase)
+	for _, key := range db.Keys() {
+		if len(key) == len(baseRoot) && common.BytesToHash(key) != baseRoot {
+			require.Nil(db.Delete(key))
+		}
+	}
+	res = ledger.ResetState(ledger.state.Height(), baseRoot)
+	require.True(res.IsOK(), res.Message)
+	stateRoot := simulateBlockStateRoot(t, ledger)
+	res = ledger.ApplyBlockTxs(newBlock(ledger, stateRoot, sendTxBytes))
+	assert.Equal(result.CodeInternalStoreError, res.Code, res.Message)
+	assert.True(res.IsInternalError())
+	assert.Equal(baseRoot, ledger.state.Delivered().Hash())
 
-	// -------------- Check the ValidatorSets -------------- //
+	// Invalid coinbase txs
+	es, block := newTestProposerExecSim(t, "test_chain_001")
+	ledger = es.consensus.GetLedger().(*Ledger)
+	b0 := es.getTipBlock()
+	_, blockRawTxs, res := ledger.ProposeEmptyBlockTxs(block)
+	require.True(res.IsOK(), res.Message)
+	require.Equal(1, len(blockRawTxs))
+	res = ledger.ResetState(b0.Height, b0.StateHash)
+	require.True(res.IsOK(), res.Message)
+	tx, err := types.TxFromBytes(blockRawTxs[0])
+	require.Nil(err)
+	coinbaseTx := tx.(*types.CoinbaseTx)
+	coinbaseTx.BlockHeight++
+	anotherCoinbaseTxBytes, err := types.TxToBytes(coinbaseTx)
+	require.Nil(err)
+	block.Txs = []common.Bytes{blockRawTxs[0], anotherCoinbaseTxBytes}
+	receipts, res = ledger.ApplyBlockTxsWithReceipts(block)
+	assert.Equal(result.CodeInvalidCoinbase, res.Code, res.Message)
+	require.Equal(2, len(receipts))
+	assert.Contains(receipts[1].Message, "Another coinbase transaction")
+}
 
-	// valSet0 := es.consensus.GetValidatorManager().GetValidatorSet(b0.Hash())
-	// log.Infof("valSet for block #0: %v", valSet0)
-	// assert.Equal(4, len(valSet0.Validators()))
+func TestLedgerApplyBlockTxsStoreFaults(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
 
-	// valSet1 := es.consensus.GetValidatorManager().GetValidatorSet(b1.Hash())
-	// log.Infof("valSet for block #1: %v", valSet1)
-	// assert.Equal(4, len(valSet1.Validators()))
+	// The block has two independent txs, which are executed in parallel if enabled
+	newFaultyLedger := func() (*Ledger, *backend.FaultyDatabase, *core.Block) {
+		db := backend.NewFaultyDatabase(backend.NewMemDatabase())
+		chainID, ledger, _ := newTestLedgerWithDB(db)
+		accOut, accIns := prepareInitLedgerState(ledger, 3)
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = ledger.state.Height()
+		block.Txs = []common.Bytes{
+			newRawSendTx(chainID, 1, true, accOut, accIns[0], false),
+			newRawSendTx(chainID, 1, true, accIns[2], accIns[1], false),
+		}
+		block.StateHash = simulateBlockStateRoot(t, ledger, block.Txs...)
+		return ledger, db, block
+	}
 
-	valSet2 := es.consensus.GetValidatorManager().GetValidatorSet(b2.Hash())
-	log.Infof("valSet for block #2: %v", valSet2)
-	assert.Equal(4, len(valSet2.Validators()))
+	// Each read in turn fails, until the block applies without a fault. A failed read either does not affect
+	// the state, or fails the block with an internal error, and the block applies once the fault is cleared.
+	for _, parallel := range []bool{false, true} {
+		viper.Set(common.CfgLedgerParallelTxExecution, parallel)
+		for n := 1; ; n++ {
+			ledger, db, block := newFaultyLedger()
+			baseRoot := ledger.state.Delivered().Hash()
+			numReads := 0
+			db.FailReads(func(key []byte) bool {
+				numReads++
+				return numReads == n
+			})
+			res := ledger.ApplyBlockTxs(block)
+			db.FailReads(nil)
+			if db.NumFaults() == 0 {
+				require.True(res.IsOK(), res.Message)
+				assert.Equal(block.StateHash, ledger.state.Delivered().Hash())
+				assert.True(n > 1, "no state read")
+				break
+			}
 
-	valSet3 := es.consensus.GetValidatorManager().GetValidatorSet(b3.Hash())
-	log.Infof("valSet for block #3: %v", valSet3)
-	assert.Equal(5, len(valSet3.Validators()))
+			if res.IsError() {
+				require.True(res.IsInternalError(), "read %v: %v", n, res.String())
+				require.Equal(baseRoot, ledger.state.Delivered().Hash())
+				res = ledger.ApplyBlockTxs(block)
+				require.True(res.IsOK(), res.Message)
+			}
+			require.Equal(block.StateHash, ledger.state.Delivered().Hash(), "read %v", n)
+		}
+	}
+	viper.Set(common.CfgLedgerParallelTxExecution, false)
+}
 
-	valSet4 := es.consensus.GetValidatorManager().GetValidatorSet(b4.Hash())
-	log.Infof("valSet for block #4: %v", valSet4)
-	assert.Equal(5, len(valSet4.Validators()))
+func TestLedgerApplyBlockTxsWrongStateRoot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
 
-	valSet5 := es.consensus.GetValidatorManager().GetValidatorSet(b5.Hash())
-	log.Infof("valSet for block #5: %v", valSet5)
-	assert.Equal(5, len(valSet5.Validators()))
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 3)
 
-	valSet6 := es.consensus.GetValidatorManager().GetValidatorSet(b6.Hash())
-	log.Infof("valSet for block #6: %v", valSet6)
-	assert.Equal(4, len(valSet6.Validators()))
+	pendingTxBytes := newRawSendTx(chainID, 1, true, accOut, accIns[2], false)
+	require.Nil(mempool.InsertTransaction(pendingTxBytes))
 
-	// ----------------- Stake Return ----------------- //
+	baseHeight := ledger.state.Height()
+	baseRoot := ledger.state.Delivered().Hash()
+	rawTxs := []common.Bytes{
+		newRawSendTx(chainID, 1, true, accOut, accIns[0], false),
+		newRawSendTx(chainID, 1, true, accOut, accIns[1], false),
+	}
+	expectedStateRoot := simulateBlockStateRoot(t, ledger, rawTxs...)
 
-	srcAcc = es.state.Delivered().GetAccount(withdrawSourcePrivAcc.Address)
-	balance1 := srcAcc.Balance
-	log.Infof("Source account balance after withdrawal  : %v", balance1)
-	assert.Equal(balance0, balance1.Plus(types.NewCoins(0, txFee)))
+	newBlock := func(stateRoot common.Hash) *core.Block {
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = baseHeight + 1
+		block.StateHash = stateRoot
+		block.Txs = rawTxs
+		return block
+	}
 
-	heightDelta1 := core.ReturnLockingPeriod / 10
-	for h := uint64(0); h < heightDelta1; h++ {
-		es.state.Commit() // increment height
+	// The block with a wrong state root leaves the ledger untouched
+	receipts, res := ledger.ApplyBlockTxsWithReceipts(newBlock(common.BytesToHash([]byte("wrong root"))))
+	assert.Equal(result.CodeStateRootMismatch, res.Code, res.Message)
+	assert.Equal(2, len(receipts))
+	assert.Equal(baseHeight, ledger.state.Height())
+	assert.Equal(baseRoot, ledger.state.Delivered().Hash())
+	assert.Equal(baseRoot, ledger.state.Committed().Hash())
+	for _, accIn := range accIns {
+		assert.Equal(uint64(0), ledger.state.Delivered().GetAccount(accIn.Address).Sequence)
+	}
+	assert.Equal(1, mempool.Size())
+
+	// So does the block with a failed tx, the txs before it included
+	failingBlock := newBlock(expectedStateRoot)
+	failingBlock.Txs = []common.Bytes{rawTxs[0], newRawSendTx(chainID, 2, true, accOut, accIns[1], false)}
+	res = ledger.ApplyBlockTxs(failingBlock)
+	assert.Equal(result.CodeInvalidTx, res.Code, res.Message)
+	assert.Equal(baseRoot, ledger.state.Delivered().Hash())
+	assert.Equal(uint64(0), ledger.state.Delivered().GetAccount(accIns[0].Address).Sequence)
+
+	// The correct block is then applied on top of the intact state
+	res = ledger.ApplyBlockTxs(newBlock(expectedStateRoot))
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(baseHeight+1, ledger.state.Height())
+	assert.Equal(expectedStateRoot, ledger.state.Committed().Hash())
+	assert.Equal(uint64(1), ledger.state.Delivered().GetAccount(accIns[0].Address).Sequence)
+	assert.Equal(uint64(1), ledger.state.Delivered().GetAccount(accIns[1].Address).Sequence)
+	assert.Equal(uint64(0), ledger.state.Delivered().GetAccount(accIns[2].Address).Sequence)
+}
+
+func TestLedgerSimulateTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, mempool := newTestLedger()
+	numInAccs := 2
+	accOut, accIns := prepareInitLedgerState(ledger, numInAccs)
+
+	deliveredRoot := ledger.state.Delivered().Hash()
+	sendTxBytes := newRawSendTx(chainID, 1, true, accOut, accIns[0], false)
+
+	simResult, res := ledger.SimulateTx(sendTxBytes)
+	require.True(res.IsOK(), res.Message)
+	assert.True(simResult.Receipt.IsOK())
+	assert.Equal(crypto.Keccak256Hash(sendTxBytes), simResult.Receipt.TxHash)
+	assert.Equal(types.NewCoins(0, getMinimumTxFee()), simResult.Receipt.Fee)
+	assert.Nil(simResult.ValidatorCandidatePool)
+
+	require.Equal(2, len(simResult.Accounts))
+	inDelta := simResult.Accounts[0]
+	assert.Equal(accIns[0].Address, inDelta.Address)
+	assert.Equal(uint64(0), inDelta.Before.Sequence)
+	assert.Equal(uint64(1), inDelta.After.Sequence)
+	assert.True(inDelta.Before.Balance.Minus(inDelta.After.Balance).IsEqual(types.NewCoins(15, getMinimumTxFee())))
+	outDelta := simResult.Accounts[1]
+	assert.Equal(accOut.Address, outDelta.Address)
+	assert.True(outDelta.After.Balance.Minus(outDelta.Before.Balance).IsEqual(types.NewCoins(15, 0)))
+
+	// The simulation should not affect the ledger state or the mempool
+	assert.Equal(deliveredRoot, ledger.state.Delivered().Hash())
+	assert.Equal(uint64(0), ledger.state.Delivered().GetAccount(accIns[0].Address).Sequence)
+	assert.Equal(0, mempool.Size())
+	simResult, res = ledger.SimulateTx(sendTxBytes)
+	assert.True(res.IsOK(), res.Message)
+
+	// Invalid transactions are reported with the receipt
+	invalidTxBytes := newRawSendTx(chainID, 5, true, accOut, accIns[1], false)
+	simResult, res = ledger.SimulateTx(invalidTxBytes)
+	assert.True(res.IsError())
+	assert.Equal(uint64(result.CodeSequenceTooHigh), simResult.Receipt.Code)
+	assert.Equal(0, len(simResult.Accounts))
+
+	// Simulations should not wait for the block being applied
+	ledger.mu.Lock()
+	done := make(chan result.Result)
+	go func() {
+		_, res := ledger.SimulateTx(sendTxBytes)
+		done <- res
+	}()
+	select {
+	case res = <-done:
+		assert.True(res.IsOK(), res.Message)
+	case <-time.After(5 * time.Second):
+		assert.Fail("SimulateTx blocked by the ledger lock")
+	}
+	ledger.mu.Unlock()
+}
+
+func TestLedgerSimulateTxs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 2)
+	contractAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	ledger.state.Delivered().SetCode(contractAddr, common.Hex2Bytes("600160005500")) // PUSH1 1 PUSH1 0 SSTORE STOP
+	deliveredRoot := ledger.state.Commit()
+
+	contractTx := &types.SmartContractTx{
+		From:     types.TxInput{Address: accIns[0].Address, Sequence: 2},
+		To:       types.TxOutput{Address: contractAddr},
+		GasLimit: 100000,
+		GasPrice: new(big.Int).SetUint64(types.MinimumGasPrice),
+	}
+	contractTx.From.Signature = accIns[0].Sign(contractTx.SignBytes(chainID))
+	rawContractTx, err := types.TxToBytes(contractTx)
+	require.Nil(err)
+
+	// Each tx sees the effects of the previous ones, native and contract txs alike
+	sendTx := newRawSendTx(chainID, 1, true, accOut, accIns[0], false)
+	rawTxs := []common.Bytes{
+		sendTx,
+		rawContractTx,
+		newRawSendTx(chainID, 3, true, accOut, accIns[0], false),
+		newRawSendTx(chainID, 5, true, accOut, accIns[1], false), // fails, and leaves the state untouched
+		newRawSendTx(chainID, 1, true, accOut, accIns[1], false),
+	}
+	bundleResult, res := ledger.SimulateTxs(rawTxs)
+	require.NotNil(bundleResult)
+	assert.Equal(result.CodeSequenceTooHigh, res.Code)
+	assert.Contains(res.Message, "Tx #3: ")
+	require.Equal(len(rawTxs), len(bundleResult.Results))
+	for i, simResult := range bundleResult.Results {
+		assert.Equal(crypto.Keccak256Hash(rawTxs[i]), simResult.Receipt.TxHash)
+		assert.Equal(i != 3, simResult.Receipt.IsOK(), "%v: %v", i, simResult.Receipt.Message)
+	}
+	contractGas := bundleResult.Results[1].Receipt.GasUsed
+	assert.True(contractGas > 0)
+	sendGas := types.EstimateTxGas(&types.SendTx{Inputs: []types.TxInput{{}}, Outputs: []types.TxOutput{{}}})
+	assert.Equal(3*sendGas+contractGas, bundleResult.GasUsed)
+
+	// The scratch view holds the state at the end of the bundle
+	view := bundleResult.View
+	assert.Equal(bundleResult.StateRoot, view.Hash())
+	assert.Equal(uint64(3), view.GetAccount(accIns[0].Address).Sequence)
+	assert.Equal(uint64(1), view.GetAccount(accIns[1].Address).Sequence)
+	assert.Equal(common.BigToHash(big.NewInt(1)), view.GetState(contractAddr, common.Hash{}))
+	before := ledger.state.Delivered().GetAccount(accOut.Address).Balance
+	assert.True(view.GetAccount(accOut.Address).Balance.Minus(before).IsEqual(types.NewCoins(45, 0)))
+
+	// The hypothetical state root is the one of the same txs applied
+	applied := ledger.state.Delivered()
+	for i, rawTx := range rawTxs {
+		if i == 3 {
+			continue
+		}
+		tx, err := types.TxFromBytes(rawTx)
+		require.Nil(err)
+		_, res := ledger.executor.SimulateTx(tx, applied)
+		require.True(res.IsOK(), res.Message)
+	}
+	assert.Equal(applied.Hash(), bundleResult.StateRoot)
+	require.True(ledger.ResetState(ledger.state.Height(), deliveredRoot).IsOK())
+
+	// The simulation does not affect the ledger state or the mempool
+	bundleResult, res = ledger.SimulateTxs(rawTxs[:3])
+	assert.True(res.IsOK(), res.Message)
+	assert.Equal(deliveredRoot, ledger.state.Delivered().Hash())
+	assert.Equal(uint64(0), ledger.state.Delivered().GetAccount(accIns[0].Address).Sequence)
+	assert.Equal(0, mempool.Size())
+
+	// A single tx is simulated as by SimulateTx
+	simResult, res := ledger.SimulateTx(sendTx)
+	require.True(res.IsOK(), res.Message)
+	bundleResult, res = ledger.SimulateTxs([]common.Bytes{sendTx})
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(simResult, bundleResult.Results[0])
+
+	// Nothing is executed if any tx is malformed
+	bundleResult, res = ledger.SimulateTxs([]common.Bytes{sendTx, common.Bytes("malformed")})
+	assert.True(res.IsError())
+	assert.Nil(bundleResult)
+	_, res = ledger.SimulateTxs(nil)
+	assert.True(res.IsError())
+}
+
+func TestLedgerSimulateRevertedTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, _ := newTestLedger()
+	_, accIns := prepareInitLedgerState(ledger, 1)
+
+	// ASM:
+	// push2 len(revertData), push 0xe, push 0x0, codecopy
+	// push2 len(revertData), push 0x0, revert
+	// revertData
+	revertingCode := func(revertData common.Bytes) common.Bytes {
+		size := fmt.Sprintf("%04x", len(revertData))
+		return append(common.Hex2Bytes("61"+size+"600e600039"+"61"+size+"6000fd"), revertData...)
+	}
+	reasonData := common.Bytes(common.Hex2Bytes("08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000014" +
+		"696e73756666696369656e742062616c616e6365000000000000000000000000")) // Error("insufficient balance")
+	customData := common.Bytes(common.Hex2Bytes("deadbeef000000000000000000000000000000000000000000000000000000000000002a"))
+	reasonContractAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	customContractAddr := common.HexToAddress("0x1000000000000000000000000000000000000002")
+	emptyContractAddr := common.HexToAddress("0x1000000000000000000000000000000000000003")
+	ledger.state.Delivered().SetCode(reasonContractAddr, revertingCode(reasonData))
+	ledger.state.Delivered().SetCode(customContractAddr, revertingCode(customData))
+	ledger.state.Delivered().SetCode(emptyContractAddr, revertingCode(nil))
+	ledger.state.Commit()
+
+	newRawContractTx := func(to common.Address) common.Bytes {
+		tx := &types.SmartContractTx{
+			From:     types.TxInput{Address: accIns[0].Address, Sequence: 1},
+			To:       types.TxOutput{Address: to},
+			GasLimit: 100000,
+			GasPrice: new(big.Int).SetUint64(types.MinimumGasPrice),
+		}
+		tx.From.Signature = accIns[0].Sign(tx.SignBytes(chainID))
+		rawTx, err := types.TxToBytes(tx)
+		require.Nil(err)
+		return rawTx
+	}
+
+	// The simulation decodes the revert reason, the receipt records the raw revert data
+	simResult, res := ledger.SimulateTx(newRawContractTx(reasonContractAddr))
+	require.True(res.IsOK(), res.Message)
+	assert.Equal("insufficient balance", simResult.RevertReason)
+	assert.Equal(reasonData, simResult.Receipt.RevertData)
+	assert.Equal("evm: execution reverted", simResult.Receipt.Message)
+	assert.Equal(reasonData, simResult.VmReturn)
+
+	simResult, res = ledger.SimulateTx(newRawContractTx(customContractAddr))
+	require.True(res.IsOK(), res.Message)
+	assert.Equal("", simResult.RevertReason)
+	assert.Equal(customData, simResult.Receipt.RevertData)
+
+	// The reverting transactions are rejected by the screening, with the revert reason or the raw revert data
+	_, res = ledger.ScreenTx(newRawContractTx(reasonContractAddr))
+	assert.Equal(result.CodeExecutionReverted, res.Code)
+	assert.Equal("Execution reverted: insufficient balance", res.Message)
+	assert.Equal(reasonData, res.Info["revertData"])
+
+	_, res = ledger.ScreenTx(newRawContractTx(customContractAddr))
+	assert.Equal(result.CodeExecutionReverted, res.Code)
+	assert.Equal(fmt.Sprintf("Execution reverted with data 0x%x", []byte(customData)), res.Message)
+
+	_, res = ledger.ScreenTx(newRawContractTx(emptyContractAddr))
+	assert.Equal(result.CodeExecutionReverted, res.Code)
+	assert.Equal("Execution reverted", res.Message)
+
+	// The screening does not change the screened state
+	assert.Equal(uint64(0), ledger.state.Screened().GetAccount(accIns[0].Address).Sequence)
+}
+
+func TestLedgerScreenContractDeployment(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, _ := newTestLedger()
+	_, accIns := prepareInitLedgerState(ledger, 1)
+
+	newRawDeploymentTx := func(code string, gasLimit uint64) common.Bytes {
+		tx := &types.SmartContractTx{
+			From:     types.TxInput{Address: accIns[0].Address, Sequence: 1},
+			GasLimit: gasLimit,
+			GasPrice: new(big.Int).SetUint64(types.MinimumGasPrice),
+			Data:     common.Hex2Bytes(code),
+		}
+		tx.From.Signature = accIns[0].Sign(tx.SignBytes(chainID))
+		rawTx, err := types.TxToBytes(tx)
+		require.Nil(err)
+		return rawTx
+	}
+
+	// The deployments bound to fail are rejected with distinct error codes
+	_, res := ledger.ScreenTx(newRawDeploymentTx("00", 50000))
+	assert.Equal(result.CodeIntrinsicGasNotCovered, res.Code)
+
+	_, res = ledger.ScreenTx(newRawDeploymentTx("620060016000f3", 10000000)) // PUSH3 24577 PUSH1 0 RETURN
+	assert.Equal(result.CodeContractCodeTooLarge, res.Code)
+
+	_, res = ledger.ScreenTx(newRawDeploymentTx("60006000fd", 100000)) // PUSH1 0 PUSH1 0 REVERT
+	assert.Equal(result.CodeInitCodeReverted, res.Code)
+	assert.Equal("Init code reverted", res.Message)
+
+	_, res = ledger.ScreenTx(newRawDeploymentTx("600556", 100000)) // PUSH1 5 JUMP
+	assert.Equal(result.CodeInvalidInitCode, res.Code)
+
+	// The init code depending on the state is left to the simulation, which reverts here as well
+	_, res = ledger.ScreenTx(newRawDeploymentTx("3031600d57600060006000fd5b00", 100000)) // reverts if the balance is zero
+	assert.Equal(result.CodeExecutionReverted, res.Code)
+
+	// A valid deployment, the last byte of which is a truncated PUSH, passes the contract screening
+	_, res = ledger.ScreenTx(newRawDeploymentTx("60016000556001", 100000)) // PUSH1 1 PUSH1 0 SSTORE PUSH1 <missing>
+	assert.NotEqual(result.CodeInvalidInitCode, res.Code)
+	assert.NotEqual(result.CodeExecutionReverted, res.Code)
+}
+
+func TestLedgerSimulateStakeTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID := "test_chain_001"
+	db := backend.NewMemDatabase()
+
+	snapshot, srcPrivAccs, valPrivAccs := genSimSnapshot(chainID, db)
+	es := newExecSim(chainID, db, snapshot, valPrivAccs[0])
+	ledger := es.consensus.GetLedger().(*Ledger)
+
+	depositSourcePrivAcc := srcPrivAccs[4]
+	depositStakeTx := &types.DepositStakeTx{
+		Fee: types.NewCoins(0, getMinimumTxFee()),
+		Source: types.TxInput{
+			Address: depositSourcePrivAcc.Address,
+			Coins: types.Coins{
+				ThetaWei: core.MinValidatorStakeDeposit,
+				TFuelWei: new(big.Int).SetUint64(0),
+			},
+			Sequence: 1,
+		},
+		Holder: types.TxOutput{
+			Address: valPrivAccs[4].Address,
+		},
+		Purpose: core.StakeForValidator,
+	}
+	depositStakeTx.Source.Signature = depositSourcePrivAcc.Sign(depositStakeTx.SignBytes(chainID))
+	rawTx, err := types.TxToBytes(depositStakeTx)
+	require.Nil(err)
+
+	vcpBefore := es.state.Delivered().GetValidatorCandidatePool()
+	simResult, res := ledger.SimulateTx(rawTx)
+	require.True(res.IsOK(), res.Message)
+	require.NotNil(simResult.ValidatorCandidatePool)
+	assert.NotNil(simResult.ValidatorCandidatePool.FindStakeDelegate(valPrivAccs[4].Address))
+	assert.Equal(vcpBefore, es.state.Delivered().GetValidatorCandidatePool())
+	assert.Nil(es.state.Delivered().GetValidatorCandidatePool().FindStakeDelegate(valPrivAccs[4].Address))
+
+	// The stakes at the end of a bundle are queried from its scratch view
+	bundleResult, res := ledger.SimulateTxs([]common.Bytes{rawTx})
+	require.True(res.IsOK(), res.Message)
+	stakes := bundleResult.View.GetStakesBySource(depositSourcePrivAcc.Address)
+	require.Equal(1, len(stakes))
+	assert.Equal(valPrivAccs[4].Address, stakes[0].Holder)
+	assert.Equal(core.MinValidatorStakeDeposit, stakes[0].Amount)
+	assert.Empty(es.state.Delivered().GetStakesBySource(depositSourcePrivAcc.Address))
+}
+
+func TestLedgerTxLatencyTracking(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 3)
+
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = ledger.state.Height() - 1
+	root.StateHash = ledger.state.Delivered().Hash()
+	ledger.chain = blockchain.NewChain(chainID, kvstore.NewKVStore(ledger.state.DB()), root)
+
+	clock := common.NewManualClock(time.Unix(1000, 0))
+	tracker := core.NewTxLatencyTracker(clock)
+	mempool.SetTxLatencyTracker(tracker)
+	ledger.SetTxLatencyTracker(tracker)
+
+	parent := ledger.chain.Root()
+	applyNextBlock := func() *core.ExtendedBlock {
+		stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+		require.True(res.IsOK(), res.Message)
+
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = parent.Height + 1
+		block.Parent = parent.Hash()
+		block.StateHash = stateRoot
+		block.Txs = blockRawTxs
+		res = ledger.ApplyBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+
+		var err error
+		parent, err = ledger.chain.AddBlock(block)
+		require.Nil(err)
+		return parent
+	}
+
+	// admission -> inclusion -> finalization of one block
+	require.Nil(mempool.InsertTransaction(newRawSendTx(chainID, 1, true, accOut, accIns[0], false)))
+	clock.Advance(2 * time.Second)
+	block := applyNextBlock()
+	assert.Equal(1, tracker.NumPending())
+	clock.Advance(3 * time.Second)
+	require.True(ledger.FinalizeState(block.Height, block.StateHash).IsOK())
+
+	samples := tracker.Samples()
+	require.Equal(1, len(samples))
+	assert.Equal(2*time.Second, samples[0].InclusionLatency)
+	assert.Equal(5*time.Second, samples[0].FinalityLatency)
+
+	// Finalizing a block also finalizes the txs included by its ancestors
+	require.Nil(mempool.InsertTransaction(newRawSendTx(chainID, 1, true, accOut, accIns[1], false)))
+	clock.Advance(time.Second)
+	applyNextBlock()
+	clock.Advance(time.Second)
+	require.Nil(mempool.InsertTransaction(newRawSendTx(chainID, 1, true, accOut, accIns[2], false)))
+	clock.Advance(time.Second)
+	block = applyNextBlock()
+	assert.Equal(2, tracker.NumPending())
+	clock.Advance(4 * time.Second)
+	require.True(ledger.FinalizeState(block.Height, block.StateHash).IsOK())
+
+	samples = tracker.Samples()
+	require.Equal(3, len(samples))
+	assert.Equal(0, tracker.NumPending())
+
+	stats := tracker.Stats()
+	assert.Equal(3, stats.NumTxs)
+	assert.Equal(core.LatencyPercentiles{P50: time.Second, P90: 2 * time.Second, P99: 2 * time.Second}, stats.InclusionLatency)
+	assert.Equal(core.LatencyPercentiles{P50: 5 * time.Second, P90: 7 * time.Second, P99: 7 * time.Second}, stats.FinalityLatency)
+}
+
+func TestLedgerGetAccountAtHeight(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 2)
+
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = ledger.state.Height() - 1
+	root.StateHash = ledger.state.Delivered().Hash()
+	store := kvstore.NewKVStore(ledger.state.DB())
+	ledger.chain = blockchain.NewChain(chainID, store, root)
+
+	txFee := getMinimumTxFee()
+	reserveFundTx := &types.ReserveFundTx{
+		Fee: types.NewCoins(0, txFee),
+		Source: types.TxInput{
+			Address:  accIns[0].Address,
+			Coins:    types.NewCoins(0, 1000*txFee),
+			Sequence: 2,
+		},
+		Collateral:  types.NewCoins(0, 1001*txFee),
+		ResourceIDs: []string{"rid001"},
+		Duration:    1000,
+	}
+	reserveFundTx.Source.Signature = accIns[0].Sign(reserveFundTx.SignBytes(chainID))
+	reserveFundTxBytes, err := types.TxToBytes(reserveFundTx)
+	require.Nil(err)
+
+	blocksTxs := [][]common.Bytes{
+		{newRawSendTx(chainID, 1, true, accOut, accIns[0], false)},
+		{reserveFundTxBytes},
+		{newRawSendTx(chainID, 3, true, accOut, accIns[0], false), newRawSendTx(chainID, 1, true, accOut, accIns[1], false)},
+	}
+
+	// Apply and finalize the blocks, and record the accounts after each block
+	expected := map[uint64][]*types.Account{
+		root.Height: {ledger.state.Delivered().GetAccount(accIns[0].Address), ledger.state.Delivered().GetAccount(accIns[1].Address)},
+	}
+	parent := ledger.chain.Root()
+	for _, txs := range blocksTxs {
+		for _, tx := range txs {
+			require.Nil(mempool.InsertTransaction(tx))
+		}
+		stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+		require.True(res.IsOK(), res.Message)
+		require.Equal(len(txs), len(blockRawTxs))
+
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = parent.Height + 1
+		block.Parent = parent.Hash()
+		block.StateHash = stateRoot
+		block.Txs = blockRawTxs
+		res = ledger.ApplyBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+
+		parent, err = ledger.chain.AddBlock(block)
+		require.Nil(err)
+		require.Nil(ledger.chain.FinalizePreviousBlocks(parent.Hash()))
+
+		expected[block.Height] = []*types.Account{
+			ledger.state.Delivered().GetAccount(accIns[0].Address),
+			ledger.state.Delivered().GetAccount(accIns[1].Address),
+		}
+	}
+	tipHeight := parent.Height
+
+	for height := root.Height; height <= tipHeight; height++ {
+		for idx, accIn := range accIns {
+			account, err := ledger.GetAccountAtHeight(accIn.Address, height)
+			require.Nil(err)
+			require.NotNil(account)
+			assert.Equal(expected[height][idx].Sequence, account.Sequence, "height %v", height)
+			assert.True(expected[height][idx].Balance.IsEqual(account.Balance), "height %v", height)
+			assert.Equal(len(expected[height][idx].ReservedFunds), len(account.ReservedFunds), "height %v", height)
+		}
+	}
+
+	account, err := ledger.GetAccountAtHeight(accIns[0].Address, root.Height)
+	require.Nil(err)
+	assert.Equal(uint64(0), account.Sequence)
+	assert.Equal(0, len(account.ReservedFunds))
+
+	account, err = ledger.GetAccountAtHeight(accIns[0].Address, tipHeight)
+	require.Nil(err)
+	assert.Equal(uint64(3), account.Sequence)
+	require.Equal(1, len(account.ReservedFunds))
+	assert.Equal([]string{"rid001"}, account.ReservedFunds[0].ResourceIDs)
+	assert.True(types.NewCoins(0, 1001*txFee).IsEqual(account.ReservedFunds[0].Collateral))
+
+	// Accounts that do not exist at the height
+	account, err = ledger.GetAccountAtHeight(types.MakeAcc("unknown").Address, tipHeight)
+	assert.Nil(err)
+	assert.Nil(account)
+
+	// Heights without a finalized block
+	unfinalized := core.NewBlock()
+	unfinalized.ChainID = chainID
+	unfinalized.Height = tipHeight + 1
+	unfinalized.Parent = parent.Hash()
+	_, err = ledger.chain.AddBlock(unfinalized)
+	require.Nil(err)
+	_, err = ledger.GetAccountAtHeight(accIns[0].Address, tipHeight+1)
+	assert.NotNil(err)
+	_, err = ledger.GetAccountAtHeight(accIns[0].Address, tipHeight+2)
+	assert.NotNil(err)
+
+	// Pruned heights
+	require.Nil(store.Put(state.StatePruningProgressKey(), root.Height+1))
+	_, err = ledger.GetAccountAtHeight(accIns[0].Address, root.Height+1)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "pruned")
+	account, err = ledger.GetAccountAtHeight(accIns[0].Address, root.Height+2)
+	assert.Nil(err)
+	assert.NotNil(account)
+}
+
+// Test case for validator stake deposit, withdrawal, and return
+func TestValidatorStakeUpdate(t *testing.T) {
+	assert := assert.New(t)
+
+	// ----------------- Stake Deposit ----------------- //
+
+	chainID := "test_chain_001"
+	db := backend.NewMemDatabase()
+
+	snapshot, srcPrivAccs, valPrivAccs := genSimSnapshot(chainID, db)
+	assert.Equal(6, len(srcPrivAccs))
+	assert.Equal(6, len(valPrivAccs))
+
+	es := newExecSim(chainID, db, snapshot, valPrivAccs[0])
+	b0 := es.getTipBlock()
+
+	// Add block #1 with a DepositStakeTx transaction
+	b1 := core.NewBlock()
+	b1.ChainID = chainID
+	b1.Height = b0.Height + 1
+	b1.Epoch = 1
+	b1.Parent = b0.Hash()
+	b1.HCC.BlockHash = b1.Parent
+
+	txFee := getMinimumTxFee()
+	depositSourcePrivAcc := srcPrivAccs[4]
+	depoistHolderPrivAcc := valPrivAccs[4]
+	depositStakeTx := &types.DepositStakeTx{
+		Fee: types.NewCoins(0, txFee),
+		Source: types.TxInput{
+			Address: depositSourcePrivAcc.Address,
+			Coins: types.Coins{
+				ThetaWei: new(big.Int).Mul(new(big.Int).SetUint64(10), core.MinValidatorStakeDeposit),
+				TFuelWei: new(big.Int).SetUint64(0),
+			},
+			Sequence: 1,
+		},
+		Holder: types.TxOutput{
+			Address: depoistHolderPrivAcc.Address,
+		},
+		Purpose: core.StakeForValidator,
+	}
+	signBytes := depositStakeTx.SignBytes(es.chainID)
+	depositStakeTx.Source.Signature = depositSourcePrivAcc.Sign(signBytes)
+
+	_, res := es.executor.ExecuteTx(depositStakeTx)
+	assert.True(res.IsOK(), res.Message)
+	assert.Equal(b1.Height+2, res.Info["validatorSetEffectiveHeight"]) // the validator joins at block #3
+
+	b1.StateHash = es.state.Commit()
+	es.addBlock(b1)
+
+	// Add more blocks
+	b2 := core.NewBlock()
+	b2.ChainID = chainID
+	b2.Height = b1.Height + 1
+	b2.Epoch = 2
+	b2.Parent = b1.Hash()
+	b2.StateHash = es.state.Commit()
+	b2.HCC.BlockHash = b2.Parent
+	es.addBlock(b2)
+
+	b3 := core.NewBlock()
+	b3.ChainID = chainID
+	b3.Height = b2.Height + 1
+	b3.Epoch = 3
+	b3.Parent = b2.Hash()
+	b3.HCC.BlockHash = b3.Parent
+	b3.StateHash = es.state.Commit()
+	es.addBlock(b3)
+
+	// ----------------- Stake Withdrawal ----------------- //
+
+	withdrawSourcePrivAcc := srcPrivAccs[0]
+	withdrawHolderPrivAcc := valPrivAccs[0]
+
+	srcAcc := es.state.Delivered().GetAccount(withdrawSourcePrivAcc.Address)
+	balance0 := srcAcc.Balance
+	log.Infof("Source account balance before withdrawal : %v", balance0)
+
+	// Add block #4 with a WithdrawStakeTx transaction
+	b4 := core.NewBlock()
+	b4.ChainID = chainID
+	b4.Height = b3.Height + 1
+	b4.Epoch = 4
+	b4.Parent = b3.Hash()
+	b4.HCC.BlockHash = b4.Parent
+
+	widthrawStakeTx := &types.WithdrawStakeTx{
+		Fee: types.NewCoins(0, txFee),
+		Source: types.TxInput{
+			Address:  withdrawSourcePrivAcc.Address,
+			Sequence: 1,
+		},
+		Holder: types.TxOutput{
+			Address: withdrawHolderPrivAcc.Address,
+		},
+		Purpose: core.StakeForValidator,
+	}
+	signBytes = widthrawStakeTx.SignBytes(es.chainID)
+	widthrawStakeTx.Source.Signature = withdrawSourcePrivAcc.Sign(signBytes)
+
+	_, res = es.executor.ExecuteTx(widthrawStakeTx)
+	assert.True(res.IsOK(), res.Message)
+	assert.Equal(b4.Height+2, res.Info["validatorSetEffectiveHeight"]) // the validator leaves at block #6
+
+	b4.StateHash = es.state.Commit()
+	es.addBlock(b4)
+
+	b5 := core.NewBlock()
+	b5.ChainID = chainID
+	b5.Height = b4.Height + 1
+	b5.Epoch = 5
+	b5.Parent = b4.Hash()
+	b5.HCC.BlockHash = b5.Parent
+	b5.StateHash = es.state.Commit()
+
+	es.addBlock(b5)
+
+	b6 := core.NewBlock()
+	b6.ChainID = chainID
+	b6.Height = b5.Height + 1
+	b6.Epoch = 6
+	b6.Parent = b5.Hash()
+	b6.HCC.BlockHash = b6.Parent
+	b6.StateHash = es.state.Commit()
+	es.addBlock(b6)
+
+	// -------------- Check the ValidatorSets -------------- //
+
+	// valSet0 := es.consensus.GetValidatorManager().GetValidatorSet(b0.Hash())
+	// log.Infof("valSet for block #0: %v", valSet0)
+	// assert.Equal(4, len(valSet0.Validators()))
+
+	// valSet1 := es.consensus.GetValidatorManager().GetValidatorSet(b1.Hash())
+	// log.Infof("valSet for block #1: %v", valSet1)
+	// assert.Equal(4, len(valSet1.Validators()))
+
+	valSet2 := es.consensus.GetValidatorManager().GetValidatorSet(b2.Hash())
+	log.Infof("valSet for block #2: %v", valSet2)
+	assert.Equal(4, len(valSet2.Validators()))
+
+	valSet3 := es.consensus.GetValidatorManager().GetValidatorSet(b3.Hash())
+	log.Infof("valSet for block #3: %v", valSet3)
+	assert.Equal(5, len(valSet3.Validators()))
+
+	valSet4 := es.consensus.GetValidatorManager().GetValidatorSet(b4.Hash())
+	log.Infof("valSet for block #4: %v", valSet4)
+	assert.Equal(5, len(valSet4.Validators()))
+
+	valSet5 := es.consensus.GetValidatorManager().GetValidatorSet(b5.Hash())
+	log.Infof("valSet for block #5: %v", valSet5)
+	assert.Equal(5, len(valSet5.Validators()))
+
+	valSet6 := es.consensus.GetValidatorManager().GetValidatorSet(b6.Hash())
+	log.Infof("valSet for block #6: %v", valSet6)
+	assert.Equal(4, len(valSet6.Validators()))
+
+	valMgr := es.consensus.GetValidatorManager().(*consensus.FixedValidatorManager)
+	changes, err := valMgr.GetValidatorSetChanges(b2.Hash(), b6.Hash())
+	assert.Nil(err)
+	if assert.Equal(2, len(changes)) {
+		assert.Equal(depoistHolderPrivAcc.Address, changes[0].Validator.Address)
+		assert.True(changes[0].Joined)
+		assert.Equal(b3.Height, changes[0].EffectiveHeight)
+		assert.Equal(withdrawHolderPrivAcc.Address, changes[1].Validator.Address)
+		assert.False(changes[1].Joined)
+		assert.Equal(b6.Height, changes[1].EffectiveHeight)
+	}
+	changes, err = valMgr.GetValidatorSetChanges(b3.Hash(), b5.Hash())
+	assert.Nil(err)
+	assert.Empty(changes)
+	_, err = valMgr.GetValidatorSetChanges(b6.Hash(), b2.Hash())
+	assert.NotNil(err)
+
+	// ----------------- Stake Return ----------------- //
+
+	srcAcc = es.state.Delivered().GetAccount(withdrawSourcePrivAcc.Address)
+	balance1 := srcAcc.Balance
+	log.Infof("Source account balance after withdrawal  : %v", balance1)
+	assert.Equal(balance0, balance1.Plus(types.NewCoins(0, txFee)))
+
+	heightDelta1 := core.ReturnLockingPeriod / 10
+	for h := uint64(0); h < heightDelta1; h++ {
+		es.state.Commit() // increment height
 	}
 	expectedStateHash, _, res := es.consensus.GetLedger().ProposeBlockTxs(nil) // nil skips adding the CoinbaseTx, but it is OK for our test
 	blockX := &core.Block{BlockHeader: &core.BlockHeader{
@@ -335,30 +1402,2736 @@ func TestValidatorStakeUpdate(t *testing.T) {
 	res = es.consensus.GetLedger().ApplyBlockTxs(blockX)
 	assert.True(res.IsOK())
 
-	srcAcc = es.state.Delivered().GetAccount(withdrawSourcePrivAcc.Address)
-	balance2 := srcAcc.Balance
-	log.Infof("Source account balance after %v blocks : %v", heightDelta1, balance2)
+	srcAcc = es.state.Delivered().GetAccount(withdrawSourcePrivAcc.Address)
+	balance2 := srcAcc.Balance
+	log.Infof("Source account balance after %v blocks : %v", heightDelta1, balance2)
+
+	assert.Equal(balance1, balance2) // still in the locking period, should not return stake
+
+	heightDelta2 := core.ReturnLockingPeriod
+	for h := uint64(0); h < heightDelta2; h++ {
+		es.state.Commit() // increment height
+	}
+	expectedStateHash, _, res = es.consensus.GetLedger().ProposeBlockTxs(nil) // nil skips adding the CoinbaseTx, but it is OK for our test
+	blockY := &core.Block{BlockHeader: &core.BlockHeader{
+		Height:    es.state.Height() + 1,
+		StateHash: expectedStateHash,
+	}, Txs: []common.Bytes{}}
+	res = es.consensus.GetLedger().ApplyBlockTxs(blockY)
+	assert.True(res.IsOK())
+
+	srcAcc = es.state.Delivered().GetAccount(withdrawSourcePrivAcc.Address)
+	balance3 := srcAcc.Balance
+	log.Infof("Source account balance after %v blocks: %v", heightDelta2, balance3)
+
+	returnedCoins := balance3.Minus(balance2)
+	assert.True(returnedCoins.ThetaWei.Cmp(new(big.Int).Mul(new(big.Int).SetUint64(5), core.MinValidatorStakeDeposit)) == 0)
+	assert.True(returnedCoins.TFuelWei.Cmp(core.Zero) == 0)
+	log.Infof("Returned coins: %v", returnedCoins)
+}
+
+func TestGuardianStakeUpdate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID := "test_chain_001"
+	db := backend.NewMemDatabase()
+
+	snapshot, srcPrivAccs, valPrivAccs := genSimSnapshot(chainID, db)
+	es := newExecSim(chainID, db, snapshot, valPrivAccs[0])
+
+	addBlock := func(parent *core.Block, txs ...types.Tx) *core.Block {
+		for _, tx := range txs {
+			_, res := es.executor.ExecuteTx(tx)
+			require.True(res.IsOK(), res.Message)
+		}
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = parent.Height + 1
+		block.Epoch = parent.Epoch + 1
+		block.Parent = parent.Hash()
+		block.HCC.BlockHash = block.Parent
+		block.StateHash = es.state.Commit()
+		es.addBlock(block)
+		return block
+	}
+	applyEmptyBlock := func() {
+		expectedStateHash, _, res := es.consensus.GetLedger().ProposeBlockTxs(nil)
+		require.True(res.IsOK(), res.Message)
+		block := &core.Block{BlockHeader: &core.BlockHeader{
+			Height:      es.state.Height() + 1,
+			StateHash:   expectedStateHash,
+			ReceiptHash: core.EmptyRootHash,
+		}, Txs: []common.Bytes{}}
+		res = es.consensus.GetLedger().ApplyBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+	}
+
+	// The guardian stakes are accepted from the fork height on
+	require.True(es.state.ResetState(common.HeightEnableGuardianStaking-1, es.state.Commit()).IsOK())
+
+	txFee := getMinimumTxFee()
+	source, guardian := srcPrivAccs[4], valPrivAccs[4]
+	stake := new(big.Int).Mul(big.NewInt(3), core.MinGuardianStakeDeposit)
+	depositStakeTx := &types.DepositStakeTx{
+		Fee:     types.NewCoins(0, txFee),
+		Source:  types.TxInput{Address: source.Address, Coins: types.Coins{ThetaWei: stake, TFuelWei: big.NewInt(0)}, Sequence: 1},
+		Holder:  types.TxOutput{Address: guardian.Address},
+		Purpose: core.StakeForGuardian,
+	}
+	depositStakeTx.Source.Signature = source.Sign(depositStakeTx.SignBytes(chainID))
+	withdrawStakeTx := &types.WithdrawStakeTx{
+		Fee:     types.NewCoins(0, txFee),
+		Source:  types.TxInput{Address: source.Address, Sequence: 2},
+		Holder:  types.TxOutput{Address: guardian.Address},
+		Purpose: core.StakeForGuardian,
+	}
+	withdrawStakeTx.Source.Signature = source.Sign(withdrawStakeTx.SignBytes(chainID))
+
+	// The guardian stake never weighs in the validator set
+	b0 := es.getTipBlock().Block
+	b1 := addBlock(b0, depositStakeTx)
+	b2 := addBlock(b1)
+	b3 := addBlock(b2)
+	valSet0 := es.consensus.GetValidatorManager().GetValidatorSet(b0.Hash())
+	valSet3 := es.consensus.GetValidatorManager().GetValidatorSet(b3.Hash())
+	assert.ElementsMatch(valSet0.Validators(), valSet3.Validators())
+	gcp := es.state.Delivered().GetGuardianCandidatePool()
+	assert.Equal(stake, gcp.TotalStake())
+	assert.Equal(stake, gcp.FindStakeDelegate(guardian.Address).TotalStake())
+
+	// ----------------- Stake Return ----------------- //
+
+	addBlock(b3, withdrawStakeTx)
+	balance0 := es.state.Delivered().GetAccount(source.Address).Balance
+	pendingReturns := es.state.Delivered().GetGuardianCandidatePool().PendingStakeReturns(source.Address)
+	require.Equal(1, len(pendingReturns))
+	assert.Equal(stake, pendingReturns[0].Amount)
+	assert.Equal(core.GuardianReturnLockingPeriod, pendingReturns[0].ReturnHeight-(es.state.Height()-1))
+
+	for es.state.Height() < pendingReturns[0].ReturnHeight-1 {
+		es.state.Commit() // increment height
+	}
+	applyEmptyBlock()
+	assert.Equal(balance0, es.state.Delivered().GetAccount(source.Address).Balance) // still in the locking period
+
+	applyEmptyBlock()
+	returnedCoins := es.state.Delivered().GetAccount(source.Address).Balance.Minus(balance0)
+	assert.Equal(0, returnedCoins.ThetaWei.Cmp(stake), returnedCoins.String())
+	assert.Equal(0, returnedCoins.TFuelWei.Cmp(core.Zero), returnedCoins.String())
+	assert.Empty(es.state.Delivered().GetGuardianCandidatePool().SortedGuardians)
+}
+
+func TestValidatorStakeEjection(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID := "test_chain_001"
+	db := backend.NewMemDatabase()
+
+	snapshot, srcPrivAccs, valPrivAccs := genSimSnapshot(chainID, db)
+	es := newExecSim(chainID, db, snapshot, valPrivAccs[0])
+
+	addBlock := func(parent *core.Block, txs ...types.Tx) *core.Block {
+		for _, tx := range txs {
+			_, res := es.executor.ExecuteTx(tx)
+			require.True(res.IsOK(), res.Message)
+		}
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = parent.Height + 1
+		block.Epoch = parent.Epoch + 1
+		block.Parent = parent.Hash()
+		block.HCC.BlockHash = block.Parent
+		block.StateHash = es.state.Commit()
+		es.addBlock(block)
+		return block
+	}
+	require.True(es.state.ResetState(common.HeightEnableStakeEjection-1, es.state.Commit()).IsOK())
+
+	// The holder ejects its only source
+	txFee := getMinimumTxFee()
+	source, holder := srcPrivAccs[0], valPrivAccs[0]
+	ejectStakeTx := &types.EjectStakeTx{
+		Fee:     types.NewCoins(0, txFee),
+		Holder:  types.TxInput{Address: holder.Address, Sequence: 1},
+		Source:  types.TxOutput{Address: source.Address},
+		Purpose: core.StakeForValidator,
+	}
+	ejectStakeTx.Holder.Signature = holder.Sign(ejectStakeTx.SignBytes(chainID))
+	sourceBalance := es.state.Delivered().GetAccount(source.Address).Balance
+
+	b0 := es.getTipBlock().Block
+	_, res := es.executor.ExecuteTx(ejectStakeTx)
+	require.True(res.IsOK(), res.Message)
+	blockHeight := common.HeightEnableStakeEjection
+	assert.Equal(blockHeight+2, res.Info["validatorSetEffectiveHeight"]) // like a withdrawal of the source
+	b1 := addBlock(b0)
+	b2 := addBlock(b1)
+	b3 := addBlock(b2)
+
+	// The validator drops out once the stake change is effective
+	valMgr := es.consensus.GetValidatorManager()
+	_, err := valMgr.GetValidatorSet(b1.Hash()).GetValidator(holder.Address)
+	assert.Nil(err)
+	_, err = valMgr.GetValidatorSet(b3.Hash()).GetValidator(holder.Address)
+	assert.NotNil(err)
+	assert.Equal(len(valMgr.GetValidatorSet(b0.Hash()).Validators())-1, len(valMgr.GetValidatorSet(b3.Hash()).Validators()))
+
+	// The stake returns to the source after the locking period, the holder paid the fee
+	pendingReturns := es.state.Delivered().GetValidatorCandidatePool().PendingStakeReturns(source.Address)
+	require.Equal(1, len(pendingReturns))
+	assert.Equal(new(big.Int).Mul(big.NewInt(5), core.MinValidatorStakeDeposit), pendingReturns[0].Amount)
+	assert.Equal(blockHeight-1+core.ReturnLockingPeriod, pendingReturns[0].ReturnHeight)
+	assert.Equal(sourceBalance, es.state.Delivered().GetAccount(source.Address).Balance)
+	assert.Equal(uint64(1), es.state.Delivered().GetAccount(holder.Address).Sequence)
+}
+
+func TestValidatorKeyRotation(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID := "test_chain_001"
+	db := backend.NewMemDatabase()
+
+	snapshot, _, valPrivAccs := genSimSnapshot(chainID, db)
+	es := newExecSim(chainID, db, snapshot, valPrivAccs[0])
+
+	addBlock := func(parent *core.Block, txs ...types.Tx) *core.Block {
+		for _, tx := range txs {
+			_, res := es.executor.ExecuteTx(tx)
+			require.True(res.IsOK(), res.Message)
+		}
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = parent.Height + 1
+		block.Epoch = parent.Epoch + 1
+		block.Parent = parent.Hash()
+		block.HCC.BlockHash = block.Parent
+		block.StateHash = es.state.Commit()
+		es.addBlock(block)
+		return block
+	}
+	require.True(es.state.ResetState(common.HeightEnableValidatorKeyRotation-1, es.state.Commit()).IsOK())
+
+	// The validator rotates its signing key
+	txFee := getMinimumTxFee()
+	holder := valPrivAccs[0]
+	newKey := types.MakeAcc("rotated_validator_key")
+	updateValidatorKeyTx := &types.UpdateValidatorKeyTx{
+		Fee:       types.NewCoins(0, txFee),
+		Holder:    types.TxInput{Address: holder.Address, Sequence: 1},
+		NewHolder: types.TxInput{Address: newKey.Address},
+	}
+	signBytes := updateValidatorKeyTx.SignBytes(chainID)
+	updateValidatorKeyTx.Holder.Signature = holder.Sign(signBytes)
+	updateValidatorKeyTx.NewHolder.Signature = newKey.Sign(signBytes)
+
+	b0 := es.getTipBlock().Block
+	_, res := es.executor.ExecuteTx(updateValidatorKeyTx)
+	require.True(res.IsOK(), res.Message)
+	blockHeight := common.HeightEnableValidatorKeyRotation
+	assert.Equal(blockHeight+2, res.Info["validatorSetEffectiveHeight"])
+	b1 := addBlock(b0)
+	b2 := addBlock(b1)
+	b3 := addBlock(b2)
+
+	// The current key signs up to the effective height, the new key from it on, with the same stake
+	valMgr := es.consensus.GetValidatorManager()
+	oldValidator, err := valMgr.GetValidatorSet(b2.Hash()).GetValidator(holder.Address)
+	assert.Nil(err)
+	_, err = valMgr.GetValidatorSet(b2.Hash()).GetValidator(newKey.Address)
+	assert.NotNil(err)
+	_, err = valMgr.GetValidatorSet(b3.Hash()).GetValidator(holder.Address)
+	assert.NotNil(err)
+	newValidator, err := valMgr.GetValidatorSet(b3.Hash()).GetValidator(newKey.Address)
+	assert.Nil(err)
+	assert.Equal(oldValidator.Stake, newValidator.Stake)
+	assert.Equal(valMgr.GetValidatorSet(b2.Hash()).Size(), valMgr.GetValidatorSet(b3.Hash()).Size())
+}
+
+func TestLedgerRollback(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 5)
+
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = ledger.state.Height() - 1
+	root.StateHash = ledger.state.Delivered().Hash()
+	store := kvstore.NewKVStore(ledger.state.DB())
+	ledger.chain = blockchain.NewChain(chainID, store, root)
+	ce := consensus.NewConsensusEngine(nil, store, ledger.chain, nil, ledger.valMgr)
+	ledger.consensus = ce
+
+	applyBlock := func(parent *core.ExtendedBlock, epoch uint64, accIn types.PrivAccount) *core.ExtendedBlock {
+		require.Nil(mempool.InsertTransaction(newRawSendTx(chainID, 1, true, accOut, accIn, false)))
+		stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+		require.True(res.IsOK(), res.Message)
+
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Epoch = epoch
+		block.Height = parent.Height + 1
+		block.Parent = parent.Hash()
+		block.StateHash = stateRoot
+		block.Txs = blockRawTxs
+		eb, err := ledger.chain.AddBlock(block)
+		require.Nil(err)
+		res = ledger.ApplyBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+		return ledger.chain.MarkBlockValid(eb.Hash())
+	}
+	getBalance := func(acc types.PrivAccount) types.Coins {
+		return ledger.View().GetAccount(acc.Address).Balance
+	}
+	initAccOutBalance := getBalance(accOut)
+
+	// Apply and finalize three blocks
+	b1 := applyBlock(ledger.chain.Root(), 1, accIns[0])
+	b2 := applyBlock(b1, 2, accIns[1])
+	b3 := applyBlock(b2, 3, accIns[2])
+	require.Nil(ledger.chain.FinalizePreviousBlocks(b3.Hash()))
+	b3, _ = ledger.chain.FindBlock(b3.Hash())
+	ce.State().SetLastFinalizedBlock(b3)
+	ce.State().SetHighestCCBlock(b3)
+	require.True(ledger.FinalizeState(b3.Height, b3.StateHash).IsOK())
+	assert.Equal(initAccOutBalance.Plus(types.NewCoins(45, 0)), getBalance(accOut))
+	assert.Equal(b3.Hash(), ce.GetTipToExtend().Hash())
+
+	// Blocks not finalized, or states already pruned, can't be rolled back to
+	assert.True(ledger.Rollback(b3.Height + 1).IsError())
+	require.Nil(store.Put(state.StatePruningProgressKey(), b1.Height))
+	assert.True(ledger.Rollback(b1.Height).IsError())
+	require.Nil(store.Delete(state.StatePruningProgressKey()))
+
+	// Roll back to the first block
+	res := ledger.Rollback(b1.Height)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(b1.StateHash, ledger.state.Delivered().Hash())
+	assert.Equal(b1.StateHash, ledger.state.Screened().Hash())
+	assert.Equal(b1.Hash(), ce.GetLastFinalizedBlock().Hash())
+	assert.Equal(b1.Hash(), ce.GetTipToExtend().Hash())
+	assert.Equal(initAccOutBalance.Plus(types.NewCoins(15, 0)), getBalance(accOut))
+	assert.Equal(uint64(1), ledger.View().GetAccount(accIns[0].Address).Sequence)
+	assert.Equal(uint64(0), ledger.View().GetAccount(accIns[1].Address).Sequence)
+	disposed, err := ledger.chain.FindBlock(b2.Hash())
+	require.Nil(err)
+	assert.Equal(core.BlockStatusDisposed, disposed.Status)
+
+	// Re-apply different blocks on top of the first block
+	b2a := applyBlock(b1, 4, accIns[3])
+	b3a := applyBlock(b2a, 5, accIns[4])
+	assert.NotEqual(b2.Hash(), b2a.Hash())
+	assert.Equal(b3a.Hash(), ce.GetTipToExtend().Hash())
+	assert.Equal(initAccOutBalance.Plus(types.NewCoins(45, 0)), getBalance(accOut))
+	assert.Equal(uint64(0), ledger.View().GetAccount(accIns[1].Address).Sequence)
+	assert.Equal(uint64(0), ledger.View().GetAccount(accIns[2].Address).Sequence)
+	assert.Equal(uint64(1), ledger.View().GetAccount(accIns[3].Address).Sequence)
+	assert.Equal(uint64(1), ledger.View().GetAccount(accIns[4].Address).Sequence)
+}
+
+func TestLedgerProposalResultCache(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 4)
+
+	baseHeight := ledger.state.Height()
+	baseRoot := ledger.state.Delivered().Hash()
+	newBlock := func(stateRoot common.Hash, rawTxs []common.Bytes) *core.Block {
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = baseHeight
+		block.StateHash = stateRoot
+		block.Txs = rawTxs
+		return block
+	}
+
+	// The proposer's own block is committed from the cached execution result
+	require.Nil(mempool.InsertTransaction(newRawSendTx(chainID, 1, true, accOut, accIns[0], false)))
+	stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	cached := ledger.proposalResult
+	require.NotNil(cached)
+	require.True(ledger.ResetState(baseHeight, baseRoot).IsOK()) // as the consensus engine does before applying
+	receipts, res := ledger.ApplyBlockTxsWithReceipts(newBlock(stateRoot, blockRawTxs))
+	require.True(res.IsOK(), res.Message)
+	require.Equal(1, len(receipts))
+	assert.True(cached.receipts[0] == receipts[0])
+	assert.Equal(crypto.Keccak256Hash(blockRawTxs[0]), receipts[0].TxHash)
+	assert.Equal(stateRoot, ledger.state.Delivered().Hash())
+	assert.Equal(baseHeight+1, ledger.state.Height())
+	assert.Equal(uint64(1), ledger.state.Delivered().GetAccount(accIns[0].Address).Sequence)
+	assert.Nil(ledger.proposalResult)
+
+	// The cache is invalidated when another block is applied in between
+	baseHeight = ledger.state.Height()
+	baseRoot = ledger.state.Delivered().Hash()
+	require.Nil(mempool.InsertTransaction(newRawSendTx(chainID, 1, true, accOut, accIns[1], false)))
+	stateRoot, blockRawTxs, res = ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	require.NotNil(ledger.proposalResult)
+
+	require.True(ledger.ResetState(baseHeight, baseRoot).IsOK())
+	otherRawTx := newRawSendTx(chainID, 1, true, accOut, accIns[2], false)
+	otherStateRoot := simulateBlockStateRoot(t, ledger, otherRawTx)
+	require.True(ledger.ApplyBlockTxs(newBlock(otherStateRoot, []common.Bytes{otherRawTx})).IsOK())
+	assert.Nil(ledger.proposalResult)
+
+	// The proposed block applied on its base again is executed as usual
+	require.True(ledger.ResetState(baseHeight, baseRoot).IsOK())
+	res = ledger.ApplyBlockTxs(newBlock(stateRoot, blockRawTxs))
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(stateRoot, ledger.state.Delivered().Hash())
+
+	// A cached result does not apply to a block with different txs
+	baseHeight = ledger.state.Height()
+	baseRoot = ledger.state.Delivered().Hash()
+	require.Nil(mempool.InsertTransaction(newRawSendTx(chainID, 1, true, accOut, accIns[3], false)))
+	stateRoot, _, res = ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	require.NotNil(ledger.proposalResult)
+	require.True(ledger.ResetState(baseHeight, baseRoot).IsOK())
+	res = ledger.ApplyBlockTxs(newBlock(stateRoot, []common.Bytes{}))
+	assert.True(res.IsError())
+	assert.Equal(baseRoot, ledger.state.Delivered().Hash())
+}
+
+// simulateBlockStateRoot returns the state root after applying a block with the given txs
+// on top of the delivered state
+func simulateBlockStateRoot(t *testing.T, ledger *Ledger, rawTxs ...common.Bytes) common.Hash {
+	view, err := ledger.state.Delivered().Copy()
+	require.Nil(t, err)
+	for _, rawTx := range rawTxs {
+		tx, err := types.TxFromBytes(rawTx)
+		require.Nil(t, err)
+		_, res := ledger.executor.SimulateTx(tx, view)
+		require.True(t, res.IsOK(), res.Message)
+	}
+	ledger.handleDelayedStateUpdates(view, 0)
+	return view.Hash()
+}
+
+func BenchmarkLedgerApplyProposedBlock(b *testing.B) {
+	log.SetLevel(log.WarnLevel)
+	defer log.SetLevel(log.DebugLevel)
+
+	for _, useCache := range []bool{false, true} {
+		name := "uncached"
+		if useCache {
+			name = "cached"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				chainID, ledger, mempool := newTestLedger()
+				accOut, accIns := prepareInitLedgerState(ledger, 200)
+				for _, accIn := range accIns {
+					if err := mempool.InsertTransaction(newRawSendTx(chainID, 1, true, accOut, accIn, false)); err != nil {
+						b.Fatal(err)
+					}
+				}
+				baseHeight := ledger.state.Height()
+				baseRoot := ledger.state.Delivered().Hash()
+				stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+				if res.IsError() {
+					b.Fatal(res.Message)
+				}
+				ledger.ResetState(baseHeight, baseRoot)
+				if !useCache {
+					ledger.proposalResult = nil
+				}
+				block := core.NewBlock()
+				block.ChainID = chainID
+				block.Height = baseHeight
+				block.StateHash = stateRoot
+				block.Txs = blockRawTxs
+				b.StartTimer()
+
+				if res := ledger.ApplyBlockTxs(block); res.IsError() {
+					b.Fatal(res.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestLedgerCustomRewardSchedule(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Declines with the epochs, and drops to zero from epoch 10 on
+	rewardSchedule := func(blockHeight uint64, epoch uint64, validatorSet *core.ValidatorSet) *big.Int {
+		if epoch >= 10 {
+			return big.NewInt(0)
+		}
+		return big.NewInt(int64(4000 * (10 - epoch)))
+	}
+	chainID, ledger, stakeSources := newRewardTestLedger(rewardSchedule)
+
+	checkpointHeight := common.HeightEnableValidatorReward
+	for !common.IsCheckPointHeight(checkpointHeight) {
+		checkpointHeight++
+	}
+	baseRoot := ledger.state.Delivered().Hash()
+	require.True(ledger.ResetState(checkpointHeight-1, baseRoot).IsOK())
+
+	proposeAndApply := func(epoch uint64) (*types.CoinbaseTx, result.Result) {
+		defer ledger.ResetState(checkpointHeight-1, baseRoot)
+
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Epoch = epoch
+		block.Height = checkpointHeight
+		stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+		require.Equal(1, len(blockRawTxs))
+		tx, err := types.TxFromBytes(blockRawTxs[0])
+		require.Nil(err)
+		coinbaseTx, ok := tx.(*types.CoinbaseTx)
+		require.True(ok)
+
+		// The block is validated with the same reward schedule
+		require.True(ledger.ResetState(checkpointHeight-1, baseRoot).IsOK())
+		block.StateHash = stateRoot
+		block.Txs = blockRawTxs
+		return coinbaseTx, ledger.ApplyBlockTxs(block)
+	}
+
+	getReward := func(coinbaseTx *types.CoinbaseTx, address common.Address) int64 {
+		for _, output := range coinbaseTx.Outputs {
+			if output.Address == address {
+				return output.Coins.TFuelWei.Int64()
+			}
+		}
+		return 0
+	}
+
+	// The reward is divided proportional to the stakes, 1:3
+	coinbaseTx, res := proposeAndApply(1)
+	assert.True(res.IsOK(), res.Message)
+	assert.Equal(2, len(coinbaseTx.Outputs))
+	assert.Equal(int64(9000), getReward(coinbaseTx, stakeSources[0]))
+	assert.Equal(int64(27000), getReward(coinbaseTx, stakeSources[1]))
+
+	// The last epoch with a reward
+	coinbaseTx, res = proposeAndApply(9)
+	assert.True(res.IsOK(), res.Message)
+	assert.Equal(int64(1000), getReward(coinbaseTx, stakeSources[0]))
+	assert.Equal(int64(3000), getReward(coinbaseTx, stakeSources[1]))
+
+	// No reward from epoch 10 on
+	coinbaseTx, res = proposeAndApply(10)
+	assert.True(res.IsOK(), res.Message)
+	assert.Equal(0, len(coinbaseTx.Outputs))
+
+	// The reward of an earlier epoch is rejected once the reward drops to zero
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Epoch = 9
+	block.Height = checkpointHeight
+	_, blockRawTxs, res := ledger.ProposeBlockTxs(block)
+	require.True(res.IsOK(), res.Message)
+	require.True(ledger.ResetState(checkpointHeight-1, baseRoot).IsOK())
+	block.Epoch = 10
+	block.Txs = blockRawTxs
+	res = ledger.ApplyBlockTxs(block)
+	assert.True(res.IsError())
+	assert.Contains(res.Message, "Number of rewarded account is incorrect")
+}
+
+// rewardTestConsensusEngine provides the ledger to the coinbase tx executor
+type rewardTestConsensusEngine struct {
+	*exec.TestConsensusEngine
+	ledger *Ledger
+}
+
+func (rce *rewardTestConsensusEngine) GetLedger() core.Ledger { return rce.ledger }
+
+// newRewardTestLedger creates a ledger with the given reward schedule, whose two validators are staked 1:3 by the
+// returned stake sources
+func newRewardTestLedger(rewardSchedule exec.RewardSchedule) (chainID string, ledger *Ledger, stakeSources []common.Address) {
+	chainID = "test_chain_id"
+	db := backend.NewMemDatabase()
+	chain := &blockchain.Chain{ChainID: chainID}
+	consensus := &rewardTestConsensusEngine{TestConsensusEngine: exec.NewTestConsensusEngine("proposer")}
+
+	minStake := core.MinValidatorStakeDeposit
+	proposer := core.NewValidator(consensus.PrivateKey().PublicKey().Address().String(), minStake)
+	_, val2PubKey, err := crypto.TEST_GenerateKeyPairWithSeed("val2")
+	if err != nil {
+		panic(err)
+	}
+	val2 := core.NewValidator(val2PubKey.Address().String(), new(big.Int).Mul(minStake, big.NewInt(3)))
+	valSet := core.NewValidatorSet()
+	valSet.AddValidator(proposer)
+	valSet.AddValidator(val2)
+	valMgr := exec.NewTestValidatorManager(proposer, valSet)
+
+	p2psimnet := p2psim.NewSimnetWithHandler(nil)
+	mempool := newTestMempool("peer0", p2psimnet.AddEndpoint("peer0"))
+	ledger = NewLedgerWithRewardSchedule(chainID, db, chain, consensus, valMgr, mempool, rewardSchedule)
+	consensus.ledger = ledger
+	mempool.SetLedger(ledger)
+	ledger.ResetState(1, common.Hash{})
+
+	stakeSources = []common.Address{
+		common.HexToAddress("0x1000000000000000000000000000000000000001"),
+		common.HexToAddress("0x1000000000000000000000000000000000000002"),
+	}
+	vcp := &core.ValidatorCandidatePool{}
+	for i, val := range []core.Validator{proposer, val2} {
+		if err := vcp.DepositStake(stakeSources[i], val.Address, val.Stake); err != nil {
+			panic(err)
+		}
+	}
+	view := ledger.state.Delivered()
+	for _, val := range valSet.Validators() {
+		view.SetAccount(val.Address, &types.Account{
+			Address: val.Address,
+			Balance: types.NewCoins(0, 0),
+		})
+	}
+	view.UpdateValidatorCandidatePool(vcp)
+	exec.LowerDustThresholds(view)
+	ledger.state.Commit()
+
+	return chainID, ledger, stakeSources
+}
+
+func TestLedgerStakeCommissionReward(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	rewardSchedule := func(blockHeight uint64, epoch uint64, validatorSet *core.ValidatorSet) *big.Int {
+		return big.NewInt(1001)
+	}
+	chainID, ledger, stakeSources := newRewardTestLedger(rewardSchedule)
+	var val2 common.Address
+	for _, candidate := range ledger.state.Delivered().GetValidatorCandidatePool().SortedCandidates {
+		if candidate.Stakes[0].Source == stakeSources[1] {
+			val2 = candidate.Holder
+		}
+	}
+	ledger.state.Delivered().SetStakeCommission(val2, 10)
+	ledger.state.Commit()
+
+	checkpointHeight := common.HeightEnableStakeCommission
+	for !common.IsCheckPointHeight(checkpointHeight) {
+		checkpointHeight++
+	}
+	baseRoot := ledger.state.Delivered().Hash()
+	require.True(ledger.ResetState(checkpointHeight-1, baseRoot).IsOK())
+
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Epoch = 1
+	block.Height = checkpointHeight
+	stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(block)
+	require.True(res.IsOK(), res.Message)
+	require.Equal(1, len(blockRawTxs))
+	tx, err := types.TxFromBytes(blockRawTxs[0])
+	require.Nil(err)
+	coinbaseTx, ok := tx.(*types.CoinbaseTx)
+	require.True(ok)
+
+	// The validators are staked 1:3, the second one takes 10% of its share. The shares are 250.25 for the
+	// source of the first validator, 75.075 for the second validator and 675.675 for its source, and the wei
+	// left over by the rounding goes to the largest remainder.
+	rewards := map[common.Address]int64{}
+	total := int64(0)
+	for _, output := range coinbaseTx.Outputs {
+		rewards[output.Address] = output.Coins.TFuelWei.Int64()
+		total += output.Coins.TFuelWei.Int64()
+	}
+	assert.Equal(map[common.Address]int64{stakeSources[0]: 250, val2: 75, stakeSources[1]: 676}, rewards)
+	assert.Equal(int64(1001), total)
+
+	// The block is validated with the same commissions
+	require.True(ledger.ResetState(checkpointHeight-1, baseRoot).IsOK())
+	block.StateHash = stateRoot
+	block.Txs = blockRawTxs
+	res = ledger.ApplyBlockTxs(block)
+	assert.True(res.IsOK(), res.Message)
+	assert.Equal(big.NewInt(75), ledger.state.Delivered().GetAccount(val2).Balance.TFuelWei)
+}
+
+func TestLedgerRewardWithholding(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	rewardSchedule := func(blockHeight uint64, epoch uint64, validatorSet *core.ValidatorSet) *big.Int {
+		return big.NewInt(1000)
+	}
+	chainID, ledger, stakeSources := newRewardTestLedger(rewardSchedule)
+	var proposer, val2 common.Address
+	for _, candidate := range ledger.state.Delivered().GetValidatorCandidatePool().SortedCandidates {
+		if candidate.Stakes[0].Source == stakeSources[0] {
+			proposer = candidate.Holder
+		} else {
+			val2 = candidate.Holder
+		}
+	}
+	view := ledger.state.Delivered()
+	view.ScheduleMaxNumRegularTxsPerBlock(1000, 1)
+	view.UpdateTxInclusionParams(&core.TxInclusionParams{MinFullnessPercent: 10, DemandPercent: 50, WithholdPercent: 20})
+	ledger.state.Commit()
+
+	checkpointHeight := common.HeightEnableRewardWithholding + core.TxInclusionDemandWindowSize + 2
+	for !common.IsCheckPointHeight(checkpointHeight) {
+		checkpointHeight++
+	}
+	recordBlock := func(height uint64, blockProposer common.Address, numRegularTxs int) {
+		ledger.currentBlock = &core.Block{BlockHeader: &core.BlockHeader{Height: height, Proposer: blockProposer}}
+		defer func() { ledger.currentBlock = nil }()
+		ledger.handleDelayedStateUpdates(ledger.state.Delivered(), numRegularTxs)
+	}
+	proposeCheckpoint := func(baseRoot common.Hash) *core.Block {
+		require.True(ledger.ResetState(checkpointHeight-1, baseRoot).IsOK())
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Epoch = 1
+		block.Height = checkpointHeight
+		block.Proposer = proposer
+		stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+		block.StateHash = stateRoot
+		block.Txs = blockRawTxs
+		return block
+	}
+	rewardsOf := func(block *core.Block) map[common.Address]int64 {
+		tx, err := types.TxFromBytes(block.Txs[0])
+		require.Nil(err)
+		rewards := map[common.Address]int64{}
+		for _, output := range tx.(*types.CoinbaseTx).Outputs {
+			rewards[output.Address] = output.Coins.TFuelWei.Int64()
+		}
+		return rewards
+	}
+
+	// The blocks above the demand level, then the blocks of the proposer at and just below the min fullness
+	height := checkpointHeight - core.TxInclusionDemandWindowSize - 2
+	for ; height < checkpointHeight-2; height++ {
+		recordBlock(height, val2, 700)
+	}
+	recordBlock(height, proposer, 100)
+	assert.Equal(uint64(0), ledger.state.Delivered().GetTxInclusionTracker().NumUnderfilledBlocks(proposer))
+	notWithheldRoot := ledger.state.Commit()
+	recordBlock(height+1, proposer, 99)
+	assert.Equal(uint64(1), ledger.state.Delivered().GetTxInclusionTracker().NumUnderfilledBlocks(proposer))
+	withheldRoot := ledger.state.Commit()
+
+	// The validators are staked 1:3, 20% of the share of the proposer is withheld
+	fullRewardBlock := proposeCheckpoint(notWithheldRoot)
+	assert.Equal(map[common.Address]int64{stakeSources[0]: 250, stakeSources[1]: 750}, rewardsOf(fullRewardBlock))
+	block := proposeCheckpoint(withheldRoot)
+	assert.Equal(map[common.Address]int64{stakeSources[0]: 200, stakeSources[1]: 750}, rewardsOf(block))
+
+	// The coinbase tx granting the full reward is rejected once the proposer has an underfilled block
+	require.True(ledger.ResetState(checkpointHeight-1, withheldRoot).IsOK())
+	ledger.proposalResult = nil
+	res := ledger.ApplyBlockTxs(fullRewardBlock)
+	assert.True(res.IsError())
+	assert.Contains(res.Message, "Invalid rewards")
+
+	// The underfilled blocks are settled at the checkpoint, the empty checkpoint block counts for the next one
+	require.True(ledger.ResetState(checkpointHeight-1, withheldRoot).IsOK())
+	res = ledger.ApplyBlockTxs(block)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(uint64(1), ledger.state.Delivered().GetTxInclusionTracker().NumUnderfilledBlocks(proposer))
+	assert.Equal(big.NewInt(200), ledger.state.Delivered().GetAccount(stakeSources[0]).Balance.TFuelWei)
+}
+
+func TestLedgerRewardHistory(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	rewardSchedule := func(blockHeight uint64, epoch uint64, validatorSet *core.ValidatorSet) *big.Int {
+		return big.NewInt(int64(1000 + epoch))
+	}
+	chainID, ledger, stakeSources := newRewardTestLedger(rewardSchedule)
+	validators := []common.Address{}
+	for _, candidate := range ledger.state.Delivered().GetValidatorCandidatePool().SortedCandidates {
+		validators = append(validators, candidate.Holder)
+		ledger.state.Delivered().SetStakeCommission(candidate.Holder, 10)
+	}
+	ledger.state.Commit()
+
+	// The checkpoints of several epochs, proposed in turn by the validators
+	checkpointHeight := common.HeightEnableRewardHistory
+	for !common.IsCheckPointHeight(checkpointHeight) {
+		checkpointHeight++
+	}
+	stateRoot := ledger.state.Delivered().Hash()
+	epochs := []uint64{10, 11, 11, 15}
+	granted := map[uint64]map[common.Address]types.Coins{} // by epoch
+	for i, epoch := range epochs {
+		height := checkpointHeight + uint64(i)*uint64(common.CheckpointInterval)
+		require.True(ledger.ResetState(height-1, stateRoot).IsOK())
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Epoch = epoch
+		block.Height = height
+		block.Proposer = validators[i%len(validators)]
+		var res result.Result
+		block.StateHash, block.Txs, res = ledger.ProposeBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+
+		require.True(ledger.ResetState(height-1, stateRoot).IsOK())
+		ledger.proposalResult = nil
+		res = ledger.ApplyBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+		stateRoot = ledger.state.Commit()
+		require.True(ledger.FinalizeState(height, stateRoot).IsOK())
+
+		tx, err := types.TxFromBytes(block.Txs[0])
+		require.Nil(err)
+		if granted[epoch] == nil {
+			granted[epoch] = map[common.Address]types.Coins{}
+		}
+		for _, output := range tx.(*types.CoinbaseTx).Outputs {
+			granted[epoch][output.Address] = granted[epoch][output.Address].NoNil().Plus(output.Coins)
+		}
+	}
+
+	// The rewards of each recipient over any range of epochs add up to the coinbase outputs exactly
+	recipients := append(append([]common.Address{}, validators...), stakeSources...)
+	for _, recipient := range recipients {
+		for _, epochRange := range [][2]uint64{{0, 100}, {10, 10}, {11, 11}, {11, 15}, {12, 14}, {16, 20}} {
+			expected := types.NewCoins(0, 0)
+			for epoch, outputs := range granted {
+				if epoch >= epochRange[0] && epoch <= epochRange[1] {
+					expected = expected.Plus(outputs[recipient].NoNil())
+				}
+			}
+			rewards, err := ledger.GetRewards(recipient, epochRange[0], epochRange[1])
+			require.Nil(err)
+			assert.True(expected.IsEqual(rewards), "%v %v: %v vs %v", recipient.Hex(), epochRange, expected, rewards)
+		}
+		rewards, err := ledger.GetRewards(recipient, 0, 100)
+		require.Nil(err)
+		assert.True(rewards.IsPositive(), recipient.Hex())
+	}
+	total := types.NewCoins(0, 0)
+	for _, recipient := range recipients {
+		rewards, err := ledger.GetRewards(recipient, 0, 100)
+		require.Nil(err)
+		total = total.Plus(rewards)
+	}
+	assert.Equal(int64(1010+1011+1011+1015), total.TFuelWei.Int64())
+
+	_, err := ledger.GetRewards(recipients[0], 11, 10)
+	assert.NotNil(err)
+}
+
+func TestLedgerGuardianReward(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	rewardSchedule := func(blockHeight uint64, epoch uint64, validatorSet *core.ValidatorSet) *big.Int {
+		return big.NewInt(1001)
+	}
+	chainID, ledger, stakeSources := newRewardTestLedger(rewardSchedule)
+
+	// The guardian stakes add up to the validator stakes, the source of the first validator stakes a guardian too
+	guardianSource := common.HexToAddress("0x1000000000000000000000000000000000000003")
+	guardian := common.HexToAddress("0x2000000000000000000000000000000000000001")
+	minStake := core.MinValidatorStakeDeposit
+	gcp := &core.GuardianCandidatePool{}
+	require.Nil(gcp.DepositStake(stakeSources[0], guardian, minStake))
+	require.Nil(gcp.DepositStake(guardianSource, guardian, new(big.Int).Mul(minStake, big.NewInt(3))))
+	ledger.state.Delivered().UpdateGuardianCandidatePool(gcp)
+	ledger.state.Commit()
+
+	checkpointHeight := common.HeightEnableGuardianStaking
+	for !common.IsCheckPointHeight(checkpointHeight) {
+		checkpointHeight++
+	}
+	baseRoot := ledger.state.Delivered().Hash()
+	require.True(ledger.ResetState(checkpointHeight-1, baseRoot).IsOK())
+
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Epoch = 1
+	block.Height = checkpointHeight
+	stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(block)
+	require.True(res.IsOK(), res.Message)
+	require.Equal(1, len(blockRawTxs))
+	tx, err := types.TxFromBytes(blockRawTxs[0])
+	require.Nil(err)
+	coinbaseTx, ok := tx.(*types.CoinbaseTx)
+	require.True(ok)
+
+	// The guardians take 500 of the reward, pro-rata to the total stakes, split 1:3 among their sources. The
+	// validators take the other 501, split 1:3 as well, 125.25 and 375.75 rounded by the largest remainder.
+	rewards := map[common.Address]int64{}
+	total := int64(0)
+	for _, output := range coinbaseTx.Outputs {
+		rewards[output.Address] = output.Coins.TFuelWei.Int64()
+		total += output.Coins.TFuelWei.Int64()
+	}
+	assert.Equal(map[common.Address]int64{stakeSources[0]: 250, stakeSources[1]: 376, guardianSource: 375}, rewards)
+	assert.Equal(int64(1001), total)
+
+	// The block is validated with the same guardian stakes
+	require.True(ledger.ResetState(checkpointHeight-1, baseRoot).IsOK())
+	block.StateHash = stateRoot
+	block.Txs = blockRawTxs
+	res = ledger.ApplyBlockTxs(block)
+	assert.True(res.IsOK(), res.Message)
+	assert.Equal(big.NewInt(375), ledger.state.Delivered().GetAccount(guardianSource).Balance.TFuelWei)
+}
+
+func TestLedgerBlockGasBudget(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	txFee := getMinimumTxFee()
+	newLedgerWithTxs := func(gasBudget uint64) (string, *Ledger, []common.Bytes) {
+		chainID, ledger, mempool := newTestLedger()
+		accOut, accIns := prepareInitLedgerState(ledger, 4)
+		ledger.state.Delivered().UpdateBlockGasLimit(gasBudget)
+		ledger.state.Commit()
+
+		// Mixed tx types: the SendTx with 3 outputs takes up 20000 gas and pays the highest fee, the
+		// others take up 10000 gas each
+		rawTxs := []common.Bytes{
+			newRawMultiSendTx(chainID, 1, accIns[0], 3, 10*txFee),
+			newRawSendTx(chainID, 1, true, accOut, accIns[1], false),
+			newRawReserveFundTx(chainID, 1, accIns[2], "rid001"),
+			newRawSendTx(chainID, 1, true, accOut, accIns[3], false),
+		}
+		for _, rawTx := range rawTxs {
+			require.Nil(mempool.InsertTransaction(rawTx))
+		}
+		return chainID, ledger, rawTxs
+	}
+	totalGas := uint64(20000 + 3*10000)
+
+	// The budget fits all the txs exactly
+	chainID, ledger, rawTxs := newLedgerWithTxs(totalGas)
+	_, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(len(rawTxs), len(blockRawTxs))
+	assert.Equal(0, ledger.mempool.Size())
+
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Height = ledger.state.Height()
+	block.StateHash = simulateBlockStateRoot(t, ledger, rawTxs...)
+	block.Txs = rawTxs
+	res = ledger.ApplyBlockTxs(block)
+	require.True(res.IsOK(), res.Message)
+
+	// One gas short of the budget, the proposal stops before the tx that does not fit
+	chainID, ledger, rawTxs = newLedgerWithTxs(totalGas - 1)
+	_, blockRawTxs, res = ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	require.Equal(len(rawTxs)-1, len(blockRawTxs))
+	gasUsed := uint64(0)
+	for _, rawTx := range blockRawTxs {
+		gasUsed += estimateRawTxGas(rawTx, types.DefaultIntrinsicGasSchedule())
+	}
+	assert.Equal(totalGas-10000, gasUsed)
+	assert.Equal(1, ledger.mempool.Size())
+	require.NotNil(ledger.mempool.PeekUnsafe())
+	assert.Equal(uint64(10000), estimateRawTxGas(ledger.mempool.PeekUnsafe(), types.DefaultIntrinsicGasSchedule()))
+
+	// The block exceeding the budget is rejected before any tx is executed, starting from the fork
+	baseRoot := ledger.state.Delivered().Hash()
+	block = core.NewBlock()
+	block.ChainID = chainID
+	block.Height = ledger.state.Height()
+	block.StateHash = simulateBlockStateRoot(t, ledger, rawTxs...)
+	block.Txs = rawTxs
+	txs := []types.Tx{}
+	for _, rawTx := range rawTxs {
+		tx, err := types.TxFromBytes(rawTx)
+		require.Nil(err)
+		txs = append(txs, tx)
+	}
+	assert.True(checkBlockGasBudget(txs, ledger.state.Delivered()).IsOK())
+
+	require.True(ledger.ResetState(common.HeightEnableBlockGasBudget-1, baseRoot).IsOK())
+	block.Height = ledger.state.Height()
+	res = ledger.ApplyBlockTxs(block)
+	assert.True(res.IsError())
+	assert.Equal(result.CodeBlockGasLimitExceeded, res.Code)
+	assert.Equal(baseRoot, ledger.state.Delivered().Hash())
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = ledger.state.Height()
+	root.StateHash = baseRoot
+	ledger.chain = blockchain.NewChain(chainID, kvstore.NewKVStore(ledger.state.DB()), root)
+	_, res = ledger.VerifyBlockTxs(rawTxs, block.StateHash)
+	assert.Equal(result.CodeBlockGasLimitExceeded, res.Code)
+
+	// The tx that can not fit in any block is not admitted to the mempool
+	chainID, ledger, _ = newLedgerWithTxs(totalGas)
+	accIn := types.MakeAccWithInitBalance("in_secret_big", types.NewCoins(900000, 50000*txFee))
+	ledger.state.Delivered().SetAccount(accIn.Address, &accIn.Account)
+	ledger.state.Commit()
+	_, res = ledger.ScreenTx(newRawMultiSendTx(chainID, 1, accIn, 10, txFee)) // 55000 gas
+	assert.True(res.IsError())
+	assert.Equal(result.CodeBlockGasLimitExceeded, res.Code)
+
+	// Nor proposed, if admitted before the budget got lowered
+	ledger.state.Delivered().UpdateBlockGasLimit(19999)
+	ledger.state.Commit()
+	_, blockRawTxs, res = ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(1, len(blockRawTxs))
+	assert.Equal(2, ledger.mempool.Size()) // the 20000 gas SendTx is dropped
+}
+
+func TestLedgerBlockGasBudgetIntrinsicGas(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// The ReserveFundTx takes up 30000 gas instead of 10000 per the intrinsic gas schedule in the state
+	txFee := getMinimumTxFee()
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 4)
+	gasSchedule := types.DefaultIntrinsicGasSchedule()
+	gasSchedule.BaseGas[types.TxReserveFund] = 30000
+	ledger.state.Delivered().UpdateIntrinsicGasSchedule(gasSchedule)
+	ledger.state.Delivered().UpdateBlockGasLimit(50000)
+	ledger.state.Commit()
+
+	reserveFundTx := newRawReserveFundTx(chainID, 1, accIns[2], "rid001")
+	rawTxs := []common.Bytes{
+		newRawMultiSendTx(chainID, 1, accIns[0], 3, 10*txFee),
+		newRawSendTx(chainID, 1, true, accOut, accIns[1], false),
+		reserveFundTx,
+		newRawSendTx(chainID, 1, true, accOut, accIns[3], false),
+	}
+	for _, rawTx := range rawTxs {
+		require.Nil(mempool.InsertTransaction(rawTx))
+	}
+
+	// It pays the same fee as a SendTx for more gas, so it comes last in the mempool, and does not fit
+	tx, err := types.TxFromBytes(reserveFundTx)
+	require.Nil(err)
+	txInfo, res := ledger.executor.GetTxInfo(tx)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(big.NewInt(txFee/30000), txInfo.EffectiveGasPrice)
+
+	_, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(3, len(blockRawTxs))
+	assert.NotContains(blockRawTxs, reserveFundTx)
+	assert.Equal(1, ledger.mempool.Size())
+	assert.Equal(uint64(30000), estimateRawTxGas(ledger.mempool.PeekUnsafe(), gasSchedule))
+
+	// The block with all the txs exceeds the budget, starting from the fork
+	txs := []types.Tx{}
+	for _, rawTx := range rawTxs {
+		tx, err := types.TxFromBytes(rawTx)
+		require.Nil(err)
+		txs = append(txs, tx)
+	}
+	assert.True(checkBlockGasBudget(txs, ledger.state.Delivered()).IsOK())
+	require.True(ledger.ResetState(common.HeightEnableBlockGasBudget-1, ledger.state.Delivered().Hash()).IsOK())
+	res = checkBlockGasBudget(txs, ledger.state.Delivered())
+	assert.Equal(result.CodeBlockGasLimitExceeded, res.Code)
+	res = checkBlockGasBudget(txs[:2], ledger.state.Delivered())
+	assert.True(res.IsOK(), res.Message)
+}
+
+func TestLedgerTxExpiration(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	heightDrivenExpirySweep := viper.GetBool(common.CfgMempoolHeightDrivenExpirySweep)
+	viper.Set(common.CfgMempoolHeightDrivenExpirySweep, true)
+	defer viper.Set(common.CfgMempoolHeightDrivenExpirySweep, heightDrivenExpirySweep)
+
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 3)
+	require.True(ledger.ResetState(common.HeightEnableSendTxExpiry-1, ledger.state.Delivered().Hash()).IsOK())
+	newRawTx := func(accIn types.PrivAccount, validUntilHeight uint64) common.Bytes {
+		tx := types.MakeSendTx(1, accOut, accIn)
+		tx.ValidUntilHeight = validUntilHeight
+		types.SignSendTx(chainID, tx, accIn)
+		rawTx, err := types.TxToBytes(tx)
+		require.Nil(err)
+		return rawTx
+	}
+	proposalHeight := ledger.state.Height() + 1
+
+	// The tx that can not be included in the next block is not admitted to the mempool
+	_, res := ledger.ScreenTx(newRawTx(accIns[0], proposalHeight-1))
+	assert.Equal(result.CodeTxExpired, res.Code)
+	assert.NotNil(mempool.InsertTransaction(newRawTx(accIns[0], proposalHeight-1)))
+
+	// The tx expiring exactly at the proposal height is included
+	expiring := newRawTx(accIns[0], proposalHeight)
+	require.Nil(mempool.InsertTransaction(expiring))
+	_, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal([]common.Bytes{expiring}, blockRawTxs)
+	assert.Equal(0, mempool.Size())
+
+	// Once the chain advances past its expiry, the tx is evicted from the mempool instead of proposed
+	require.Nil(mempool.InsertTransaction(newRawTx(accIns[1], proposalHeight)))
+	expiringNext := newRawTx(accIns[2], proposalHeight+1)
+	require.Nil(mempool.InsertTransaction(expiringNext))
+	assert.Equal(2, mempool.Size())
+	ledger.state.Commit()
+
+	_, blockRawTxs, res = ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal([]common.Bytes{expiringNext}, blockRawTxs)
+	assert.Equal(0, mempool.Size())
+}
+
+func TestLedgerMaxNumRegularTxsPerBlock(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 7)
+
+	// The limit is 3 for the next block, and drops to 2 from the block after it on
+	height := ledger.state.Height() + 2 // height of the next block, once the parameter change is committed
+	view := ledger.state.Delivered()
+	assert.Equal(core.MaxNumRegularTxsPerBlock, view.GetMaxNumRegularTxsPerBlock(height))
+	view.ScheduleMaxNumRegularTxsPerBlock(3, 1)
+	view.ScheduleMaxNumRegularTxsPerBlock(2, height+1)
+	ledger.state.Commit()
+	require.Equal(height, ledger.state.Height()+1)
+	assert.Equal(3, ledger.state.Delivered().GetMaxNumRegularTxsPerBlock(height))
+	assert.Equal(2, ledger.state.Delivered().GetMaxNumRegularTxsPerBlock(height+1))
+
+	for i := 0; i < 4; i++ {
+		require.Nil(mempool.InsertTransaction(newRawSendTx(chainID, 1, true, accOut, accIns[i], false)))
+	}
+	_, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	require.Equal(3, len(blockRawTxs))
+	assert.Equal(1, mempool.Size())
+
+	// The block proposed under the old limit is valid, even though the new limit is already in the state
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Height = height
+	block.StateHash = simulateBlockStateRoot(t, ledger, blockRawTxs...)
+	block.Txs = blockRawTxs
+	res = ledger.ApplyBlockTxs(block)
+	require.True(res.IsOK(), res.Message)
+
+	// The new limit applies to the proposal of the next block
+	require.Nil(mempool.InsertTransaction(newRawSendTx(chainID, 1, true, accOut, accIns[4], false)))
+	require.Nil(mempool.InsertTransaction(newRawSendTx(chainID, 1, true, accOut, accIns[5], false)))
+	_, blockRawTxs, res = ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(2, len(blockRawTxs))
+	assert.Equal(1, mempool.Size())
+
+	// And to its validation from the fork height, a block with as many regular txs as the old limit is rejected
+	rawTxs := []common.Bytes{
+		newRawSendTx(chainID, 1, true, accOut, accIns[4], false),
+		newRawSendTx(chainID, 1, true, accOut, accIns[5], false),
+		newRawSendTx(chainID, 1, true, accOut, accIns[6], false),
+	}
+	txs := []types.Tx{}
+	for _, rawTx := range rawTxs {
+		tx, err := types.TxFromBytes(rawTx)
+		require.Nil(err)
+		txs = append(txs, tx)
+	}
+	block = core.NewBlock()
+	block.ChainID = chainID
+	block.Height = height + 1
+	assert.True(checkBlockRegularTxCount(block, txs, ledger.state.Delivered()).IsOK())
+
+	require.True(ledger.ResetState(common.HeightEnableBlockRegularTxLimit-1, ledger.state.Delivered().Hash()).IsOK())
+	baseRoot := ledger.state.Delivered().Hash()
+	block.Height = common.HeightEnableBlockRegularTxLimit
+	block.StateHash = simulateBlockStateRoot(t, ledger, rawTxs...)
+	block.Txs = rawTxs
+	res = ledger.ApplyBlockTxs(block)
+	assert.True(res.IsError())
+	assert.Equal(result.CodeTooManyRegularTxs, res.Code)
+	assert.Equal(baseRoot, ledger.state.Delivered().Hash())
+
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = ledger.state.Height()
+	root.StateHash = baseRoot
+	ledger.chain = blockchain.NewChain(chainID, kvstore.NewKVStore(ledger.state.DB()), root)
+	_, res = ledger.VerifyBlockTxs(rawTxs, block.StateHash)
+	assert.Equal(result.CodeTooManyRegularTxs, res.Code)
+	assert.True(checkBlockRegularTxCount(block, txs[:2], ledger.state.Delivered()).IsOK())
+}
+
+func TestLedgerMaxTxSize(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 2)
+
+	// The default limit, checked before decoding
+	_, res := ledger.ScreenTx(make(common.Bytes, types.DefaultMaxTxSize))
+	assert.Equal(result.CodeInvalidTxFormat, res.Code)
+	_, res = ledger.ScreenTx(make(common.Bytes, types.DefaultMaxTxSize+1))
+	assert.Equal(result.CodeTxTooLarge, res.Code)
+	assert.Equal(result.CodeTxTooLarge, ledger.ScreenTxUnsafe(make(common.Bytes, types.DefaultMaxTxSize+1)).Code)
+
+	// The tx is one byte over the limit
+	rawTx := newRawSendTx(chainID, 1, true, accOut, accIns[0], false)
+	ledger.state.Delivered().UpdateMaxTxSize(uint64(len(rawTx)) - 1)
+	ledger.state.Commit()
+	assert.Equal(uint64(len(rawTx))-1, ledger.MaxTxSize())
+
+	_, res = ledger.ScreenTx(rawTx)
+	assert.Equal(result.CodeTxTooLarge, res.Code)
+	assert.Equal(result.CodeTxTooLarge, ledger.ScreenTxs([]common.Bytes{rawTx}, true)[0].Result.Code)
+	assert.NotNil(mempool.InsertTransaction(rawTx))
+	assert.Equal(0, mempool.Size())
+
+	// The block containing it is rejected before any tx is executed, starting from the fork
+	assert.True(checkBlockTxSizes([]common.Bytes{rawTx}, ledger.state.Delivered()).IsOK())
+	require.True(ledger.ResetState(common.HeightEnableBlockTxSizeLimit-1, ledger.state.Delivered().Hash()).IsOK())
+	baseRoot := ledger.state.Delivered().Hash()
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Height = ledger.state.Height() + 1
+	block.StateHash = simulateBlockStateRoot(t, ledger, rawTx)
+	block.Txs = []common.Bytes{rawTx}
+	res = ledger.ApplyBlockTxs(block)
+	assert.Equal(result.CodeTxTooLarge, res.Code)
+	assert.Equal(baseRoot, ledger.state.Delivered().Hash())
+
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = ledger.state.Height()
+	root.StateHash = baseRoot
+	ledger.chain = blockchain.NewChain(chainID, kvstore.NewKVStore(ledger.state.DB()), root)
+	_, res = ledger.VerifyBlockTxs(block.Txs, block.StateHash)
+	assert.Equal(result.CodeTxTooLarge, res.Code)
+
+	// The proposer assembles the special txs, which are exempt
+	coinbaseTx := newRawCoinbaseTx(chainID, ledger, 1)
+	require.True(uint64(len(coinbaseTx)) > ledger.MaxTxSize())
+	assert.True(checkBlockTxSizes([]common.Bytes{coinbaseTx}, ledger.state.Delivered()).IsOK())
+
+	// Exactly at the limit
+	ledger.state.Delivered().UpdateMaxTxSize(uint64(len(rawTx)))
+	ledger.state.Commit()
+	require.Nil(mempool.InsertTransaction(rawTx))
+	_, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal([]common.Bytes{rawTx}, blockRawTxs)
+
+	block.Height = ledger.state.Height() + 1
+	block.StateHash = simulateBlockStateRoot(t, ledger, rawTx)
+	res = ledger.ApplyBlockTxs(block)
+	assert.True(res.IsOK(), res.Message)
+
+	// The tx admitted before the limit got lowered is not proposed
+	rawTx = newRawSendTx(chainID, 1, true, accOut, accIns[1], false)
+	require.Nil(mempool.InsertTransaction(rawTx))
+	ledger.state.Delivered().UpdateMaxTxSize(uint64(len(rawTx)) - 1)
+	ledger.state.Commit()
+	_, blockRawTxs, res = ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(0, len(blockRawTxs))
+	assert.Equal(0, mempool.Size())
+}
+
+// duplicatingTxSource yields the first tx reaped from the mempool once more, as if the tx were inserted
+// again while the mempool lost track of it
+type duplicatingTxSource struct {
+	*mp.Mempool
+	duplicate  common.Bytes
+	duplicated bool
+}
+
+func (s *duplicatingTxSource) PeekUnsafe() common.Bytes {
+	if s.duplicate != nil {
+		return s.duplicate
+	}
+	return s.Mempool.PeekUnsafe()
+}
+
+func (s *duplicatingTxSource) ReapUnsafe(maxNumTxs int) []common.Bytes {
+	if s.duplicate != nil {
+		rawTx := s.duplicate
+		s.duplicate = nil
+		return []common.Bytes{rawTx}
+	}
+	rawTxs := s.Mempool.ReapUnsafe(maxNumTxs)
+	if !s.duplicated && len(rawTxs) > 0 {
+		s.duplicate, s.duplicated = rawTxs[0], true
+	}
+	return rawTxs
+}
+
+func TestLedgerDuplicateTxs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// The block with a duplicate tx is rejected before any tx is executed
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 2)
+	rawTx1 := newRawSendTx(chainID, 1, true, accOut, accIns[0], false)
+	rawTx2 := newRawSendTx(chainID, 1, true, accOut, accIns[1], false)
+	baseRoot := ledger.state.Delivered().Hash()
+
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Height = ledger.state.Height() + 1
+	block.StateHash = simulateBlockStateRoot(t, ledger, rawTx1, rawTx2)
+	block.Txs = []common.Bytes{rawTx1, rawTx2, rawTx1}
+	receipts, res := ledger.ApplyBlockTxsWithReceipts(block)
+	assert.Equal(result.CodeDuplicateTx, res.Code)
+	assert.Contains(res.Message, "at index 0 and 2")
+	assert.Equal(0, len(receipts))
+	assert.Equal(baseRoot, ledger.state.Delivered().Hash())
+	assert.Equal(uint64(0), ledger.state.Delivered().GetAccount(accIns[0].Address).Sequence)
+
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = ledger.state.Height()
+	root.StateHash = baseRoot
+	ledger.chain = blockchain.NewChain(chainID, kvstore.NewKVStore(ledger.state.DB()), root)
+	verification, res := ledger.VerifyBlockTxs(block.Txs, block.StateHash)
+	assert.Equal(result.CodeDuplicateTx, res.Code)
+	assert.Equal(0, len(verification.Receipts))
+
+	// The proposal skips the second copy of a tx, without checking it again
+	require.Nil(mempool.InsertTransaction(rawTx1))
+	require.Nil(mempool.InsertTransaction(rawTx2))
+	ledger.proposalTxSource = &duplicatingTxSource{Mempool: mempool}
+	numTxsChecked := 0
+	ledger.proposalTxHook = func(tx types.Tx) { numTxsChecked++ }
+	stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(2, len(blockRawTxs))
+	assert.NotEqual(string(blockRawTxs[0]), string(blockRawTxs[1]))
+	assert.Equal(2, numTxsChecked)
+	assert.Equal(0, mempool.Size())
+
+	block.StateHash = stateRoot
+	block.Txs = blockRawTxs
+	res = ledger.ApplyBlockTxs(block)
+	assert.True(res.IsOK(), res.Message)
+}
+
+// fixedTxSource provides the given txs as the proposal candidates, without the screening of the mempool
+type fixedTxSource struct {
+	rawTxs []common.Bytes
+}
+
+func (s *fixedTxSource) PeekUnsafe() common.Bytes {
+	if len(s.rawTxs) == 0 {
+		return nil
+	}
+	return s.rawTxs[0]
+}
+
+func (s *fixedTxSource) ReapUnsafe(maxNumTxs int) []common.Bytes {
+	if maxNumTxs > len(s.rawTxs) {
+		maxNumTxs = len(s.rawTxs)
+	}
+	rawTxs := s.rawTxs[:maxNumTxs]
+	s.rawTxs = s.rawTxs[maxNumTxs:]
+	return rawTxs
+}
+
+func TestLedgerFailedTxSequence(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, _ := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 2)
+	sender, other := accIns[0], accIns[1]
+
+	// The first tx of the sender fails against the state, it spends more than the balance of the sender
+	txFee := getMinimumTxFee()
+	sendTx := &types.SendTx{
+		Fee:     types.NewCoins(0, txFee),
+		Inputs:  []types.TxInput{{Address: sender.Address, Sequence: 1, Coins: types.NewCoins(1000000, txFee)}},
+		Outputs: []types.TxOutput{{Address: accOut.Address, Coins: types.NewCoins(1000000, 0)}},
+	}
+	sendTx.SetSignature(sender.Address, sender.Sign(sendTx.SignBytes(chainID)))
+	failedTx, err := types.TxToBytes(sendTx)
+	require.Nil(err)
+	nextTx := newRawSendTx(chainID, 2, true, accOut, sender, false)
+	otherTx := newRawSendTx(chainID, 1, true, accOut, other, false)
+	malformedTx := common.Bytes("malformed")
+
+	newBlock := func(stateRoot common.Hash, rawTxs ...common.Bytes) *core.Block {
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = ledger.state.Height() + 1
+		block.StateHash = stateRoot
+		block.Txs = rawTxs
+		return block
+	}
+
+	// The block including the failed tx, the next tx of the sender without it, or a malformed tx is invalid
+	baseRoot := ledger.state.Delivered().Hash()
+	for _, rawTxs := range [][]common.Bytes{{failedTx, nextTx}, {nextTx}, {otherTx, malformedTx}} {
+		receipts, res := ledger.ApplyBlockTxsWithReceipts(newBlock(baseRoot, rawTxs...))
+		assert.Equal(result.CodeInvalidTx, res.Code)
+		require.True(len(receipts) > 0)
+		assert.False(receipts[len(receipts)-1].IsOK())
+		assert.Equal(baseRoot, ledger.state.Delivered().Hash())
+	}
+
+	// The proposal drops them, the failed tx leaving no trace in the checked view
+	ledger.proposalTxSource = &fixedTxSource{rawTxs: []common.Bytes{malformedTx, failedTx, nextTx, otherTx}}
+	stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	require.Equal([]common.Bytes{otherTx}, blockRawTxs)
+	assert.Equal(simulateBlockStateRoot(t, ledger, otherTx), stateRoot)
+
+	// So the validators agree with the proposer
+	res = ledger.ApplyBlockTxs(newBlock(stateRoot, blockRawTxs...))
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(uint64(0), ledger.state.Delivered().GetAccount(sender.Address).Sequence)
+	assert.Equal(uint64(1), ledger.state.Delivered().GetAccount(other.Address).Sequence)
+
+	// The sequence of the failed tx is still available to the sender
+	retryTx := newRawSendTx(chainID, 1, true, accOut, sender, false)
+	ledger.proposalTxSource = &fixedTxSource{rawTxs: []common.Bytes{retryTx, nextTx}}
+	stateRoot, blockRawTxs, res = ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	require.Equal([]common.Bytes{retryTx, nextTx}, blockRawTxs)
+	res = ledger.ApplyBlockTxs(newBlock(stateRoot, blockRawTxs...))
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(uint64(2), ledger.state.Delivered().GetAccount(sender.Address).Sequence)
+}
+
+// newContractTestLedger creates a ledger with the given number of funded accounts, whose next block is at or above
+// common.HeightEnableSmartContract. Its blocks are proposed with a CoinbaseTx, see proposeAndApplyBlock.
+func newContractTestLedger(numAccs int) (chainID string, ledger *Ledger, accs []types.PrivAccount) {
+	chainID, ledger, _ = newRewardTestLedger(nil)
+	_, accs = prepareInitLedgerState(ledger, numAccs)
+
+	height := common.HeightEnableSmartContract
+	for common.IsCheckPointHeight(height) || common.IsCheckPointHeight(height+1) { // no reward in the first blocks
+		height++
+	}
+	if res := ledger.ResetState(height-1, ledger.state.Delivered().Hash()); res.IsError() {
+		panic(res.Message)
+	}
+	return chainID, ledger, accs
+}
+
+// proposeAndApplyBlock proposes the next block on top of the given parent with the given candidate txs, the ones
+// failing the proposal being left out, and then applies the block the way the validators do, executing its txs again
+func proposeAndApplyBlock(t *testing.T, ledger *Ledger, parent common.Hash, rawTxs ...common.Bytes) (*core.Block, []*types.TxReceipt) {
+	require := require.New(t)
+
+	baseHeight, baseRoot := ledger.state.Height(), ledger.state.Delivered().Hash()
+	block := core.NewBlock()
+	block.ChainID = ledger.state.GetChainID()
+	block.Epoch = 1
+	block.Height = baseHeight + 1
+	block.Parent = parent
+	ledger.proposalTxSource = &fixedTxSource{rawTxs: rawTxs}
+	defer func() { ledger.proposalTxSource = nil }()
+	stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(block)
+	require.True(res.IsOK(), res.Message)
+
+	require.True(ledger.ResetState(baseHeight, baseRoot).IsOK())
+	ledger.proposalResult = nil // the txs are executed again
+	block.StateHash = stateRoot
+	block.Txs = blockRawTxs
+	receipts, res := ledger.ApplyBlockTxsWithReceipts(block)
+	require.True(res.IsOK(), res.Message)
+	require.Equal(len(blockRawTxs), len(receipts))
+	return block, receipts
+}
+
+func TestLedgerProposeContractTxTimeLimit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	maxProposalTxExecutionTime := viper.GetInt(common.CfgLedgerMaxProposalTxExecutionTime)
+	viper.Set(common.CfgLedgerMaxProposalTxExecutionTime, 1)
+	defer viper.Set(common.CfgLedgerMaxProposalTxExecutionTime, maxProposalTxExecutionTime)
+
+	chainID, ledger, accs := newContractTestLedger(2)
+
+	// ASM:
+	// jumpdest
+	// push 0x0
+	// jump
+	contractAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	ledger.state.Delivered().SetCode(contractAddr, common.Hex2Bytes("5b600056"))
+	baseRoot := ledger.state.Commit()
+	baseHeight := ledger.state.Height()
+	loopTx := newRawContractTx(chainID, 1, accs[0], contractAddr, 0, types.MaximumTxGasLimit, nil)
+	sendTx := newRawSendTx(chainID, 1, true, accs[0], accs[1], false)
+
+	// The smart contract txs are rejected from the blocks before the fork
+	require.True(ledger.ResetState(common.HeightEnableSmartContract-2, baseRoot).IsOK())
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Height = common.HeightEnableSmartContract - 1
+	block.StateHash = baseRoot
+	block.Txs = []common.Bytes{loopTx}
+	receipts, res := ledger.ApplyBlockTxsWithReceipts(block)
+	assert.Equal(result.CodeInvalidTx, res.Code)
+	require.Equal(1, len(receipts))
+	assert.Equal(uint64(result.CodeSmartContractNotEnabled), receipts[0].Code)
+	require.True(ledger.ResetState(baseHeight, baseRoot).IsOK())
+
+	// From the fork, the infinite loop exceeding the execution time limit is dropped from the proposal, and
+	// leaves no trace in the state
+	block, _ = proposeAndApplyBlock(t, ledger, common.Hash{}, loopTx, sendTx)
+	require.Equal(2, len(block.Txs)) // the CoinbaseTx and the SendTx
+	assert.Equal(sendTx, block.Txs[1])
+	assert.Equal(uint64(0), ledger.state.Delivered().GetAccount(accs[0].Address).Sequence)
+	assert.Equal(uint64(1), ledger.state.Delivered().GetAccount(accs[1].Address).Sequence)
+
+	// Without the time limit, it is included, runs out of gas and is charged for all the gas
+	viper.Set(common.CfgLedgerMaxProposalTxExecutionTime, 0)
+	block, receipts = proposeAndApplyBlock(t, ledger, common.Hash{}, loopTx)
+	require.Equal(2, len(block.Txs))
+	assert.Equal(loopTx, block.Txs[1])
+	assert.Equal(uint64(result.CodeOK), receipts[1].Code)
+	assert.Equal(types.MaximumTxGasLimit, receipts[1].GasUsed)
+	assert.Equal(uint64(1), ledger.state.Delivered().GetAccount(accs[0].Address).Sequence)
+}
+
+func TestLedgerContractTxGasRefund(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, accs := newContractTestLedger(1)
+	caller := accs[0]
+
+	// ASM:
+	// push 0x1
+	// push 0x0
+	// sstore
+	// stop
+	storeContractAddrs := []common.Address{
+		common.HexToAddress("0x1000000000000000000000000000000000000001"),
+		common.HexToAddress("0x1000000000000000000000000000000000000002"),
+		common.HexToAddress("0x1000000000000000000000000000000000000003"),
+	}
+	for _, addr := range storeContractAddrs {
+		ledger.state.Delivered().SetCode(addr, common.Hex2Bytes("600160005500"))
+	}
+	gasLimit := uint64(100000)
+	ledger.state.Delivered().UpdateBlockGasLimit(5 * gasLimit / 2)
+	ledger.state.Commit()
+
+	sequence := uint64(0)
+	newContractTxs := func() []common.Bytes {
+		rawTxs := []common.Bytes{}
+		for _, addr := range storeContractAddrs {
+			sequence++
+			rawTxs = append(rawTxs, newRawContractTx(chainID, sequence, caller, addr, 0, gasLimit, nil))
+		}
+		return rawTxs
+	}
+	feeOf := func(gas uint64) *big.Int {
+		return new(big.Int).Mul(new(big.Int).SetUint64(types.MinimumGasPrice), new(big.Int).SetUint64(gas))
+	}
+	balance := func() *big.Int {
+		return ledger.state.Delivered().GetAccount(caller.Address).Balance.TFuelWei
+	}
+
+	// The gas limits of the txs add up against the gas budget of the block, the third tx does not fit
+	balanceBefore := balance()
+	contractTxs := newContractTxs()
+	block, receipts := proposeAndApplyBlock(t, ledger, common.Hash{}, contractTxs...)
+	require.Equal(3, len(block.Txs)) // the CoinbaseTx and two contract txs
+	assert.Equal(contractTxs[:2], block.Txs[1:])
+
+	// Each tx is charged for the gas it used, the fee for the unused gas is refunded
+	charged := big.NewInt(0)
+	for _, receipt := range receipts[1:] {
+		assert.Equal(uint64(result.CodeOK), receipt.Code)
+		assert.True(receipt.GasUsed > 0 && receipt.GasUsed < gasLimit)
+		assert.Equal(feeOf(receipt.GasUsed), receipt.Fee.TFuelWei)
+		charged.Add(charged, receipt.Fee.TFuelWei)
+	}
+	assert.Equal(charged, new(big.Int).Sub(balanceBefore, balance()))
+	assert.Equal(uint64(2), ledger.state.Delivered().GetAccount(caller.Address).Sequence)
+	assert.Equal(common.BigToHash(big.NewInt(1)), ledger.state.Delivered().GetState(storeContractAddrs[1], common.Hash{}))
+	assert.Equal(common.Hash{}, ledger.state.Delivered().GetState(storeContractAddrs[2], common.Hash{}))
+
+	// The block budget counts the gas limits rather than the gas used, a block with all three txs is rejected
+	sequence = 2
+	block = core.NewBlock()
+	block.ChainID = chainID
+	block.Height = ledger.state.Height() + 1
+	block.Txs = newContractTxs()
+	_, res := ledger.ApplyBlockTxsWithReceipts(block)
+	assert.Equal(result.CodeBlockGasLimitExceeded, res.Code)
+	assert.Equal(uint64(2), ledger.state.Delivered().GetAccount(caller.Address).Sequence)
+}
+
+func TestLedgerContractRevertData(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, accs := newContractTestLedger(1)
+	caller := accs[0]
+
+	// ASM:
+	// push2 len(revertData), push 0xe, push 0x0, codecopy
+	// push2 len(revertData), push 0x0, revert
+	// revertData
+	revertingCode := func(revertData common.Bytes) common.Bytes {
+		size := fmt.Sprintf("%04x", len(revertData))
+		return append(common.Hex2Bytes("61"+size+"600e600039"+"61"+size+"6000fd"), revertData...)
+	}
+	reasonData := common.Bytes(common.Hex2Bytes("08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000014" +
+		"696e73756666696369656e742062616c616e6365000000000000000000000000")) // Error("insufficient balance")
+	customData := common.Bytes(common.Hex2Bytes("deadbeef000000000000000000000000000000000000000000000000000000000000002a"))
+	reasonContractAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	customContractAddr := common.HexToAddress("0x1000000000000000000000000000000000000002")
+	storeContractAddr := common.HexToAddress("0x1000000000000000000000000000000000000003")
+	ledger.state.Delivered().SetCode(reasonContractAddr, revertingCode(reasonData))
+	ledger.state.Delivered().SetCode(customContractAddr, revertingCode(customData))
+	ledger.state.Delivered().SetCode(storeContractAddr, common.Hex2Bytes("600160005500"))
+	ledger.state.Commit()
+
+	// The reverted txs are applied, with the data returned by the reverted executions recorded in their receipts
+	reasonTx := newRawContractTx(chainID, 1, caller, reasonContractAddr, 0, 100000, nil)
+	customTx := newRawContractTx(chainID, 2, caller, customContractAddr, 0, 100000, nil)
+	storeTx := newRawContractTx(chainID, 3, caller, storeContractAddr, 0, 100000, nil)
+	block, receipts := proposeAndApplyBlock(t, ledger, common.Hash{}, reasonTx, customTx, storeTx)
+	require.Equal(4, len(block.Txs))
+	assert.Equal(uint64(3), ledger.state.Delivered().GetAccount(caller.Address).Sequence)
+
+	assert.Equal(uint64(result.CodeOK), receipts[1].Code)
+	assert.Equal(vm.ErrExecutionReverted.Error(), receipts[1].Message)
+	assert.Equal(reasonData, receipts[1].RevertData)
+	reason, ok := vm.UnpackRevertReason(receipts[1].RevertData)
+	assert.True(ok)
+	assert.Equal("insufficient balance", reason)
+
+	assert.Equal(customData, receipts[2].RevertData)
+	_, ok = vm.UnpackRevertReason(receipts[2].RevertData)
+	assert.False(ok)
+
+	assert.Equal("", receipts[3].Message)
+	assert.Equal(0, len(receipts[3].RevertData))
+
+	// The revert data is persisted with the receipts, and committed by the receipt root of the block
+	receipt, err := ledger.GetTxReceipt(crypto.Keccak256Hash(customTx))
+	require.Nil(err)
+	assert.Equal(customData, receipt.RevertData)
+	assert.True(checkBlockReceiptRoot(block, receipts).IsOK())
+	receipts[2].RevertData = reasonData
+	assert.Equal(result.CodeReceiptRootMismatch, checkBlockReceiptRoot(block, receipts).Code)
+}
+
+func TestLedgerContractStake(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, accs := newContractTestLedger(1)
+	caller := accs[0]
+	txFee := getMinimumTxFee()
+	holder := types.MakeAccWithInitBalance("contract_stake_holder", types.NewCoins(0, 50000*txFee))
+	ledger.state.Delivered().SetAccount(holder.Address, &holder.Account)
+
+	// The pool forwards its calldata to the deposit precompile, or to the withdrawal precompile if it is two words
+	// long, and reverts with the return data if the call fails, see execution.TestContractStake
+	poolAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	ledger.state.Delivered().SetCode(poolAddr, common.Hex2Bytes("366000600037"+"6000600036600060003660401461020001"+"5af1"+
+		"3d600060003e602657"+"3d6000fd"+"5b3d6000f3"))
+	poolAccount := ledger.state.Delivered().GetAccount(poolAddr)
+	poolAccount.Balance = types.Coins{ThetaWei: new(big.Int).Mul(core.MinValidatorStakeDeposit, big.NewInt(2)), TFuelWei: big.NewInt(0)}
+	ledger.state.Delivered().SetAccount(poolAddr, poolAccount)
+	poolBalance := poolAccount.Balance
+	ledger.state.Commit()
+
+	poolBalanceNow := func() types.Coins {
+		return ledger.state.Delivered().GetAccount(poolAddr).Balance
+	}
+	findStake := func() *core.Stake {
+		return ledger.state.Delivered().GetValidatorCandidatePool().FindStake(poolAddr, holder.Address)
+	}
+
+	// The pool stakes out of its own balance in a block
+	data := append(common.LeftPadBytes(holder.Address.Bytes(), 32), common.BigToHash(big.NewInt(int64(core.StakeForValidator))).Bytes()...)
+	data = append(data, common.BigToHash(core.MinValidatorStakeDeposit).Bytes()...)
+	depositTx := newRawContractTx(chainID, 1, caller, poolAddr, 0, 200000, data)
+	block, receipts := proposeAndApplyBlock(t, ledger, common.Hash{}, depositTx)
+	require.Equal(2, len(block.Txs))
+	assert.Equal(uint64(result.CodeOK), receipts[1].Code)
+	assert.Equal("", receipts[1].Message)
+	stake := findStake()
+	require.NotNil(stake)
+	assert.Equal(0, stake.Amount.Cmp(core.MinValidatorStakeDeposit))
+	assert.Equal(poolBalance.Minus(types.Coins{ThetaWei: core.MinValidatorStakeDeposit, TFuelWei: big.NewInt(0)}), poolBalanceNow())
+
+	// The holder ejects the pool, which gets its stake back after the locking period
+	ejectStakeTx := &types.EjectStakeTx{
+		Fee:     types.NewCoins(0, txFee),
+		Holder:  types.TxInput{Address: holder.Address, Sequence: 1},
+		Source:  types.TxOutput{Address: poolAddr},
+		Purpose: core.StakeForValidator,
+	}
+	ejectStakeTx.Holder.Signature = holder.Sign(ejectStakeTx.SignBytes(chainID))
+	rawEjectStakeTx, err := types.TxToBytes(ejectStakeTx)
+	require.Nil(err)
+	block, _ = proposeAndApplyBlock(t, ledger, common.Hash{}, rawEjectStakeTx)
+	require.Equal(2, len(block.Txs))
+	assert.Nil(ledger.state.Delivered().GetValidatorCandidatePool().FindActiveStake(poolAddr, holder.Address))
+	pendingReturns := ledger.state.Delivered().GetValidatorCandidatePool().PendingStakeReturns(poolAddr)
+	require.Equal(1, len(pendingReturns))
+	assert.Equal(0, pendingReturns[0].Amount.Cmp(core.MinValidatorStakeDeposit))
+	assert.Equal(block.Height-1+core.ReturnLockingPeriod, pendingReturns[0].ReturnHeight)
+
+	// Not returned before the return height
+	returnHeight := pendingReturns[0].ReturnHeight
+	require.True(ledger.ResetState(returnHeight-2, ledger.state.Delivered().Hash()).IsOK())
+	proposeAndApplyBlock(t, ledger, common.Hash{})
+	assert.Equal(1, len(ledger.state.Delivered().GetValidatorCandidatePool().PendingStakeReturns(poolAddr)))
+	assert.Equal(poolBalance.Minus(types.Coins{ThetaWei: core.MinValidatorStakeDeposit, TFuelWei: big.NewInt(0)}), poolBalanceNow())
+
+	block, _ = proposeAndApplyBlock(t, ledger, common.Hash{})
+	assert.Equal(returnHeight, block.Height)
+	assert.Equal(0, len(ledger.state.Delivered().GetValidatorCandidatePool().PendingStakeReturns(poolAddr)))
+	assert.Equal(poolBalance, poolBalanceNow())
+}
+
+// newRawMultiSendTx creates a SendTx from the account to the given number of new accounts
+func newRawMultiSendTx(chainID string, sequence int, accIn types.PrivAccount, numOutputs int, txFee int64) common.Bytes {
+	sendTx := &types.SendTx{
+		Fee: types.NewCoins(0, txFee),
+		Inputs: []types.TxInput{
+			{
+				Sequence: uint64(sequence),
+				Address:  accIn.Address,
+				Coins:    types.NewCoins(int64(15*numOutputs), txFee),
+			},
+		},
+	}
+	for i := 0; i < numOutputs; i++ {
+		sendTx.Outputs = append(sendTx.Outputs, types.TxOutput{
+			Address: common.BytesToAddress([]byte(fmt.Sprintf("multi_send_out_%v", i))),
+			Coins:   types.NewCoins(15, 0),
+		})
+	}
+	sig, err := accIn.PrivKey.Sign(sendTx.SignBytes(chainID))
+	if err != nil {
+		panic(err)
+	}
+	sendTx.SetSignature(accIn.Address, sig)
+
+	sendTxBytes, err := types.TxToBytes(sendTx)
+	if err != nil {
+		panic(err)
+	}
+	return sendTxBytes
+}
+
+func newRawReserveFundTx(chainID string, sequence int, source types.PrivAccount, resourceID string) common.Bytes {
+	txFee := getMinimumTxFee()
+	tx := &types.ReserveFundTx{
+		Fee: types.NewCoins(0, txFee),
+		Source: types.TxInput{
+			Address:  source.Address,
+			Coins:    types.NewCoins(0, 10*txFee),
+			Sequence: uint64(sequence),
+		},
+		Collateral:  types.NewCoins(0, 11*txFee),
+		ResourceIDs: []string{resourceID},
+		Duration:    1000,
+	}
+	tx.Source.Signature = source.Sign(tx.SignBytes(chainID))
+
+	txBytes, err := types.TxToBytes(tx)
+	if err != nil {
+		panic(err)
+	}
+	return txBytes
+}
+
+func TestLedgerNonCanonicalTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 1)
+
+	rawTx := newRawSendTx(chainID, 1, true, accOut, accIns[0], false)
+	nonCanonicalTxs := []common.Bytes{
+		append(append(common.Bytes{}, rawTx...), 0x80),           // trailing bytes
+		append(common.Bytes{0x82, 0x00, rawTx[0]}, rawTx[1:]...), // non-minimal tx type
+	}
+
+	baseRoot := ledger.state.Delivered().Hash()
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = ledger.state.Height()
+	root.StateHash = baseRoot
+	ledger.chain = blockchain.NewChain(chainID, kvstore.NewKVStore(ledger.state.DB()), root)
+
+	for _, nonCanonicalTx := range nonCanonicalTxs {
+		// Rejected at screening
+		_, res := ledger.ScreenTx(nonCanonicalTx)
+		assert.Equal(result.CodeInvalidTxFormat, res.Code)
+		assert.Equal(result.CodeInvalidTxFormat, ledger.ScreenTxs([]common.Bytes{nonCanonicalTx}, true)[0].Result.Code)
+		assert.NotNil(mempool.InsertTransaction(nonCanonicalTx))
+		assert.Equal(0, mempool.Size())
+
+		// Rejected at block validation, even though the decoded tx is valid
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = ledger.state.Height() + 1
+		block.StateHash = simulateBlockStateRoot(t, ledger, rawTx)
+		block.Txs = []common.Bytes{nonCanonicalTx}
+		_, res = ledger.VerifyBlockTxs(block.Txs, block.StateHash)
+		assert.True(res.IsError())
+		res = ledger.ApplyBlockTxs(block)
+		assert.True(res.IsError())
+		assert.Equal(baseRoot, ledger.state.Delivered().Hash())
+	}
+
+	// The canonical encoding is accepted
+	require.Nil(mempool.InsertTransaction(rawTx))
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Height = ledger.state.Height() + 1
+	block.StateHash = simulateBlockStateRoot(t, ledger, rawTx)
+	block.Txs = []common.Bytes{rawTx}
+	res := ledger.ApplyBlockTxs(block)
+	assert.True(res.IsOK(), res.Message)
+}
+
+func TestValidatorStakeTopUp(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID := "test_chain_001"
+	db := backend.NewMemDatabase()
+
+	snapshot, srcPrivAccs, valPrivAccs := genSimSnapshot(chainID, db)
+	es := newExecSim(chainID, db, snapshot, valPrivAccs[0])
+
+	addBlock := func(parent *core.Block, txs ...types.Tx) *core.Block {
+		for _, tx := range txs {
+			_, res := es.executor.ExecuteTx(tx)
+			require.True(res.IsOK(), res.Message)
+		}
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = parent.Height + 1
+		block.Epoch = parent.Epoch + 1
+		block.Parent = parent.Hash()
+		block.HCC.BlockHash = block.Parent
+		block.StateHash = es.state.Commit()
+		es.addBlock(block)
+		return block
+	}
+	stakeOf := func(blockHash common.Hash, holder common.Address) *big.Int {
+		validator, err := es.consensus.GetValidatorManager().GetValidatorSet(blockHash).GetValidator(holder)
+		require.Nil(err)
+		return validator.Stake
+	}
+	minStakeDeposits := func(n int64) *big.Int {
+		return new(big.Int).Mul(big.NewInt(n), core.MinValidatorStakeDeposit)
+	}
+
+	// The source already backs the holder with 4 minimum deposits in the genesis
+	txFee := getMinimumTxFee()
+	source, holder := srcPrivAccs[3], valPrivAccs[3]
+	topUpTx := &types.DepositStakeTx{
+		Fee:     types.NewCoins(0, txFee),
+		Source:  types.TxInput{Address: source.Address, Coins: types.Coins{ThetaWei: minStakeDeposits(3), TFuelWei: big.NewInt(0)}, Sequence: 1},
+		Holder:  types.TxOutput{Address: holder.Address},
+		Purpose: core.StakeForValidator,
+	}
+	topUpTx.Source.Signature = source.Sign(topUpTx.SignBytes(chainID))
 
-	assert.Equal(balance1, balance2) // still in the locking period, should not return stake
+	b0 := es.getTipBlock().Block
+	b1 := addBlock(b0, topUpTx)
+	b2 := addBlock(b1)
+	b3 := addBlock(b2)
 
-	heightDelta2 := core.ReturnLockingPeriod
-	for h := uint64(0); h < heightDelta2; h++ {
+	// The top-up is merged into the existing stake record
+	stakeHolder := es.state.Delivered().GetValidatorCandidatePool().FindStakeDelegate(holder.Address)
+	require.NotNil(stakeHolder)
+	require.Equal(1, len(stakeHolder.Stakes))
+	assert.Equal(source.Address, stakeHolder.Stakes[0].Source)
+	assert.Equal(minStakeDeposits(7), stakeHolder.Stakes[0].Amount)
+
+	// The validator weight reflects the merged total once the deposit is effective
+	assert.Equal(minStakeDeposits(4), stakeOf(b2.Hash(), holder.Address))
+	assert.Equal(minStakeDeposits(7), stakeOf(b3.Hash(), holder.Address))
+
+	// The withdrawal covers the merged stake
+	withdrawStakeTx := &types.WithdrawStakeTx{
+		Fee:     types.NewCoins(0, txFee),
+		Source:  types.TxInput{Address: source.Address, Sequence: 2},
+		Holder:  types.TxOutput{Address: holder.Address},
+		Purpose: core.StakeForValidator,
+	}
+	withdrawStakeTx.Source.Signature = source.Sign(withdrawStakeTx.SignBytes(chainID))
+	addBlock(b3, withdrawStakeTx)
+	stake := es.state.Delivered().GetValidatorCandidatePool().FindStake(source.Address, holder.Address)
+	require.NotNil(stake)
+	assert.True(stake.Withdrawn)
+
+	// The full merged amount returns after the locking period
+	balance := es.state.Delivered().GetAccount(source.Address).Balance
+	for h := uint64(0); h < core.ReturnLockingPeriod; h++ {
 		es.state.Commit() // increment height
 	}
-	expectedStateHash, _, res = es.consensus.GetLedger().ProposeBlockTxs(nil) // nil skips adding the CoinbaseTx, but it is OK for our test
-	blockY := &core.Block{BlockHeader: &core.BlockHeader{
+	expectedStateHash, _, res := es.consensus.GetLedger().ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	block := &core.Block{BlockHeader: &core.BlockHeader{
 		Height:    es.state.Height() + 1,
 		StateHash: expectedStateHash,
 	}, Txs: []common.Bytes{}}
-	res = es.consensus.GetLedger().ApplyBlockTxs(blockY)
-	assert.True(res.IsOK())
+	res = es.consensus.GetLedger().ApplyBlockTxs(block)
+	require.True(res.IsOK(), res.Message)
 
-	srcAcc = es.state.Delivered().GetAccount(withdrawSourcePrivAcc.Address)
-	balance3 := srcAcc.Balance
-	log.Infof("Source account balance after %v blocks: %v", heightDelta2, balance3)
+	returnedCoins := es.state.Delivered().GetAccount(source.Address).Balance.Minus(balance)
+	assert.Equal(0, returnedCoins.ThetaWei.Cmp(minStakeDeposits(7)), returnedCoins.String())
+	assert.Equal(0, returnedCoins.TFuelWei.Cmp(core.Zero), returnedCoins.String())
+	assert.Nil(es.state.Delivered().GetValidatorCandidatePool().FindStakeDelegate(holder.Address))
+}
 
-	returnedCoins := balance3.Minus(balance2)
-	assert.True(returnedCoins.ThetaWei.Cmp(new(big.Int).Mul(new(big.Int).SetUint64(5), core.MinValidatorStakeDeposit)) == 0)
-	assert.True(returnedCoins.TFuelWei.Cmp(core.Zero) == 0)
-	log.Infof("Returned coins: %v", returnedCoins)
+func TestValidatorStakeCancelWithdrawal(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID := "test_chain_001"
+	db := backend.NewMemDatabase()
+
+	snapshot, srcPrivAccs, valPrivAccs := genSimSnapshot(chainID, db)
+	es := newExecSim(chainID, db, snapshot, valPrivAccs[0])
+
+	addBlock := func(parent *core.Block, txs ...types.Tx) *core.Block {
+		for _, tx := range txs {
+			_, res := es.executor.ExecuteTx(tx)
+			require.True(res.IsOK(), res.Message)
+		}
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = parent.Height + 1
+		block.Epoch = parent.Epoch + 1
+		block.Parent = parent.Hash()
+		block.HCC.BlockHash = block.Parent
+		block.StateHash = es.state.Commit()
+		es.addBlock(block)
+		return block
+	}
+	inValidatorSet := func(blockHash common.Hash, holder common.Address) bool {
+		_, err := es.consensus.GetValidatorManager().GetValidatorSet(blockHash).GetValidator(holder)
+		return err == nil
+	}
+
+	// The source backs the holder with 4 minimum deposits in the genesis
+	txFee := getMinimumTxFee()
+	source, holder := srcPrivAccs[3], valPrivAccs[3]
+	seq := uint64(0)
+	newWithdrawStakeTx := func() types.Tx {
+		seq++
+		tx := &types.WithdrawStakeTx{
+			Fee:     types.NewCoins(0, txFee),
+			Source:  types.TxInput{Address: source.Address, Sequence: seq},
+			Holder:  types.TxOutput{Address: holder.Address},
+			Purpose: core.StakeForValidator,
+		}
+		tx.Source.Signature = source.Sign(tx.SignBytes(chainID))
+		return tx
+	}
+	newCancelWithdrawTx := func() types.Tx {
+		seq++
+		tx := &types.CancelWithdrawTx{
+			Fee:    types.NewCoins(0, txFee),
+			Source: types.TxInput{Address: source.Address, Sequence: seq},
+			Holder: types.TxOutput{Address: holder.Address},
+		}
+		tx.Source.Signature = source.Sign(tx.SignBytes(chainID))
+		return tx
+	}
+
+	// The validator drops out of the set after the withdrawal, and is back after the cancellation, each
+	// effective from the block after next
+	b0 := es.getTipBlock().Block
+	b1 := addBlock(b0, newWithdrawStakeTx())
+	b2 := addBlock(b1, newCancelWithdrawTx())
+	b3 := addBlock(b2)
+	b4 := addBlock(b3)
+	assert.True(inValidatorSet(b2.Hash(), holder.Address))
+	assert.False(inValidatorSet(b3.Hash(), holder.Address))
+	assert.True(inValidatorSet(b4.Hash(), holder.Address))
+
+	// Cancelled in the last block before the return, the stake is not returned
+	addBlock(b4, newWithdrawStakeTx())
+	stake := es.state.Delivered().GetValidatorCandidatePool().FindStake(source.Address, holder.Address)
+	require.NotNil(stake)
+	require.True(stake.Withdrawn)
+	for es.state.Height() < stake.ReturnHeight-1 {
+		es.state.Commit() // increment height
+	}
+	_, res := es.executor.ExecuteTx(newCancelWithdrawTx())
+	require.True(res.IsOK(), res.Message)
+	es.state.Commit()
+	balance := es.state.Delivered().GetAccount(source.Address).Balance
+
+	for i := 0; i < 2; i++ {
+		expectedStateHash, _, res := es.consensus.GetLedger().ProposeBlockTxs(nil)
+		require.True(res.IsOK(), res.Message)
+		block := &core.Block{BlockHeader: &core.BlockHeader{
+			Height:    es.state.Height() + 1,
+			StateHash: expectedStateHash,
+		}, Txs: []common.Bytes{}}
+		res = es.consensus.GetLedger().ApplyBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+	}
+
+	assert.Equal(balance, es.state.Delivered().GetAccount(source.Address).Balance)
+	stake = es.state.Delivered().GetValidatorCandidatePool().FindStake(source.Address, holder.Address)
+	require.NotNil(stake)
+	assert.False(stake.Withdrawn)
+	assert.Equal(new(big.Int).Mul(big.NewInt(4), core.MinValidatorStakeDeposit), stake.Amount)
+}
+
+func TestValidatorStakeOverlappingWithdrawals(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID := "test_chain_001"
+	db := backend.NewMemDatabase()
+
+	snapshot, srcPrivAccs, valPrivAccs := genSimSnapshot(chainID, db)
+	es := newExecSim(chainID, db, snapshot, valPrivAccs[0])
+
+	addBlock := func(parent *core.Block, txs ...types.Tx) *core.Block {
+		for _, tx := range txs {
+			_, res := es.executor.ExecuteTx(tx)
+			require.True(res.IsOK(), res.Message)
+		}
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = parent.Height + 1
+		block.Epoch = parent.Epoch + 1
+		block.Parent = parent.Hash()
+		block.HCC.BlockHash = block.Parent
+		block.StateHash = es.state.Commit()
+		es.addBlock(block)
+		return block
+	}
+	applyEmptyBlock := func() {
+		expectedStateHash, _, res := es.consensus.GetLedger().ProposeBlockTxs(nil)
+		require.True(res.IsOK(), res.Message)
+		block := &core.Block{BlockHeader: &core.BlockHeader{
+			Height:      es.state.Height() + 1,
+			StateHash:   expectedStateHash,
+			ReceiptHash: core.EmptyRootHash,
+		}, Txs: []common.Bytes{}}
+		res = es.consensus.GetLedger().ApplyBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+	}
+	minStakeDeposits := func(n int64) *big.Int {
+		return new(big.Int).Mul(big.NewInt(n), core.MinValidatorStakeDeposit)
+	}
+
+	// The source backs the first holder with 4 minimum deposits in the genesis, and backs the second holder too
+	txFee := getMinimumTxFee()
+	source, holder1, holder2 := srcPrivAccs[3], valPrivAccs[3], valPrivAccs[2]
+	depositStakeTx := &types.DepositStakeTx{
+		Fee:     types.NewCoins(0, txFee),
+		Source:  types.TxInput{Address: source.Address, Coins: types.Coins{ThetaWei: minStakeDeposits(2), TFuelWei: big.NewInt(0)}, Sequence: 1},
+		Holder:  types.TxOutput{Address: holder2.Address},
+		Purpose: core.StakeForValidator,
+	}
+	depositStakeTx.Source.Signature = source.Sign(depositStakeTx.SignBytes(chainID))
+	newWithdrawStakeTx := func(holder common.Address, seq uint64) types.Tx {
+		tx := &types.WithdrawStakeTx{
+			Fee:     types.NewCoins(0, txFee),
+			Source:  types.TxInput{Address: source.Address, Sequence: seq},
+			Holder:  types.TxOutput{Address: holder},
+			Purpose: core.StakeForValidator,
+		}
+		tx.Source.Signature = source.Sign(tx.SignBytes(chainID))
+		return tx
+	}
+
+	// The withdrawals overlap, each is queued with its own return height
+	b0 := es.getTipBlock().Block
+	b1 := addBlock(b0, depositStakeTx)
+	b2 := addBlock(b1, newWithdrawStakeTx(holder1.Address, 2))
+	b3 := addBlock(b2)
+	b4 := addBlock(b3)
+	addBlock(b4, newWithdrawStakeTx(holder2.Address, 3))
+	pendingReturns := es.state.Delivered().GetValidatorCandidatePool().PendingStakeReturns(source.Address)
+	require.Equal(2, len(pendingReturns))
+	assert.Equal(holder1.Address, pendingReturns[0].Holder)
+	assert.Equal(minStakeDeposits(4), pendingReturns[0].Amount)
+	assert.Equal(holder2.Address, pendingReturns[1].Holder)
+	assert.Equal(minStakeDeposits(2), pendingReturns[1].Amount)
+	assert.Equal(pendingReturns[0].ReturnHeight+3, pendingReturns[1].ReturnHeight)
+
+	// Each stake returns once its own return height has passed, and not before
+	for i, pending := range pendingReturns {
+		for es.state.Height() < pending.ReturnHeight-1 {
+			es.state.Commit() // increment height
+		}
+		balance := es.state.Delivered().GetAccount(source.Address).Balance
+		applyEmptyBlock()
+		assert.Equal(balance, es.state.Delivered().GetAccount(source.Address).Balance)
+		assert.Equal(pendingReturns[i:], es.state.Delivered().GetValidatorCandidatePool().PendingStakeReturns(source.Address))
+
+		applyEmptyBlock()
+		returnedCoins := es.state.Delivered().GetAccount(source.Address).Balance.Minus(balance)
+		assert.Equal(0, returnedCoins.ThetaWei.Cmp(pending.Amount), returnedCoins.String())
+		assert.Equal(pendingReturns[i+1:], es.state.Delivered().GetValidatorCandidatePool().PendingStakeReturns(source.Address))
+	}
+}
+
+func TestValidatorSetSizeCap(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID := "test_chain_001"
+	db := backend.NewMemDatabase()
+
+	snapshot, srcPrivAccs, valPrivAccs := genSimSnapshot(chainID, db)
+	es := newExecSim(chainID, db, snapshot, valPrivAccs[0])
+
+	addBlock := func(parent *core.Block, txs ...types.Tx) *core.Block {
+		for _, tx := range txs {
+			_, res := es.executor.ExecuteTx(tx)
+			require.True(res.IsOK(), res.Message)
+		}
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = parent.Height + 1
+		block.Epoch = parent.Epoch + 1
+		block.Parent = parent.Hash()
+		block.HCC.BlockHash = block.Parent
+		block.StateHash = es.state.Commit()
+		es.addBlock(block)
+		return block
+	}
+	validatorsOf := func(blockHash common.Hash) []common.Address {
+		addresses := []common.Address{}
+		for _, v := range es.consensus.GetValidatorManager().GetValidatorSet(blockHash).Validators() {
+			addresses = append(addresses, v.Address)
+		}
+		return addresses
+	}
+	minStakeDeposits := func(n int64) *big.Int {
+		return new(big.Int).Mul(big.NewInt(n), core.MinValidatorStakeDeposit)
+	}
+	txFee := getMinimumTxFee()
+	newDepositStakeTx := func(source *types.PrivAccount, holder common.Address, stake *big.Int) types.Tx {
+		tx := &types.DepositStakeTx{
+			Fee:     types.NewCoins(0, txFee),
+			Source:  types.TxInput{Address: source.Address, Coins: types.Coins{ThetaWei: stake, TFuelWei: big.NewInt(0)}, Sequence: 1},
+			Holder:  types.TxOutput{Address: holder},
+			Purpose: core.StakeForValidator,
+		}
+		tx.Source.Signature = source.Sign(tx.SignBytes(chainID))
+		return tx
+	}
+
+	// The genesis validators fill the set, the smallest one has 4 minimum deposits
+	val1, val2, val3, val4 := valPrivAccs[0].Address, valPrivAccs[1].Address, valPrivAccs[2].Address, valPrivAccs[3].Address
+	bigHolder, smallHolder := valPrivAccs[4].Address, valPrivAccs[5].Address
+	es.state.Delivered().UpdateMaxNumValidators(4)
+
+	// A deposit below the smallest validator stays on standby, a bigger one displaces the smallest validator
+	b0 := es.getTipBlock().Block
+	b1 := addBlock(b0, newDepositStakeTx(srcPrivAccs[4], bigHolder, minStakeDeposits(8)),
+		newDepositStakeTx(srcPrivAccs[5], smallHolder, minStakeDeposits(3)))
+	b2 := addBlock(b1)
+	b3 := addBlock(b2)
+	assert.ElementsMatch([]common.Address{val1, val2, val3, val4}, validatorsOf(b2.Hash()))
+	assert.ElementsMatch([]common.Address{bigHolder, val3, val2, val1}, validatorsOf(b3.Hash()))
+
+	vcp := es.state.Delivered().GetValidatorCandidatePool()
+	standbys := vcp.GetStandbyStakeHolders(es.state.Delivered().GetMaxNumValidators())
+	require.Equal(2, len(standbys))
+	assert.Equal(val4, standbys[0].Holder)
+	assert.Equal(minStakeDeposits(4), standbys[0].TotalStake()) // the stake is intact
+	assert.Equal(smallHolder, standbys[1].Holder)
+
+	// Once the big stake is withdrawn, the displaced validator is back
+	withdrawStakeTx := &types.WithdrawStakeTx{
+		Fee:     types.NewCoins(0, txFee),
+		Source:  types.TxInput{Address: srcPrivAccs[4].Address, Sequence: 2},
+		Holder:  types.TxOutput{Address: bigHolder},
+		Purpose: core.StakeForValidator,
+	}
+	withdrawStakeTx.Source.Signature = srcPrivAccs[4].Sign(withdrawStakeTx.SignBytes(chainID))
+	b4 := addBlock(b3, withdrawStakeTx)
+	b5 := addBlock(b4)
+	b6 := addBlock(b5)
+	assert.ElementsMatch([]common.Address{bigHolder, val3, val2, val1}, validatorsOf(b5.Hash()))
+	assert.ElementsMatch([]common.Address{val3, val2, val1, val4}, validatorsOf(b6.Hash()))
+}
+
+func TestValidatorJailing(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID := "test_chain_001"
+	db := backend.NewMemDatabase()
+
+	snapshot, _, valPrivAccs := genSimSnapshot(chainID, db)
+	es := newExecSim(chainID, db, snapshot, valPrivAccs[0])
+	ledger := es.consensus.GetLedger().(*Ledger)
+
+	addBlock := func(parent *core.Block, txs ...types.Tx) *core.Block {
+		for _, tx := range txs {
+			_, res := es.executor.ExecuteTx(tx)
+			require.True(res.IsOK(), res.Message)
+		}
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = parent.Height + 1
+		block.Epoch = parent.Epoch + 1
+		block.Parent = parent.Hash()
+		block.HCC.BlockHash = block.Parent
+		block.StateHash = es.state.Commit()
+		es.addBlock(block)
+		return block
+	}
+	validatorsOf := func(blockHash common.Hash) []common.Address {
+		addresses := []common.Address{}
+		for _, v := range es.consensus.GetValidatorManager().GetValidatorSet(blockHash).Validators() {
+			addresses = append(addresses, v.Address)
+		}
+		return addresses
+	}
+	// The delayed state updates record the votes in the commit certificate of the current block
+	recordBlock := func(height uint64, voters ...common.Address) bool {
+		votes := core.NewVoteSet()
+		for _, voter := range voters {
+			votes.AddVote(core.Vote{ID: voter, Height: height - 1})
+		}
+		ledger.currentBlock = &core.Block{BlockHeader: &core.BlockHeader{Height: height, HCC: core.CommitCertificate{Votes: votes}}}
+		defer func() { ledger.currentBlock = nil }()
+		return ledger.handleDelayedStateUpdates(es.state.Delivered(), 0)
+	}
+
+	val1, val2, val3, val4 := valPrivAccs[0].Address, valPrivAccs[1].Address, valPrivAccs[2].Address, valPrivAccs[3].Address
+	require.True(es.state.ResetState(common.HeightEnableValidatorJailing-1, es.state.Commit()).IsOK())
+
+	// The blocks before the fork and the blocks without votes are not tracked
+	assert.False(recordBlock(common.HeightEnableValidatorJailing-1, val1, val2, val3))
+	assert.False(recordBlock(common.HeightEnableValidatorJailing))
+	assert.Nil(es.state.Delivered().GetValidatorLivenessTracker().Get(val4))
+
+	// The offline validator is jailed once it misses more than MaxMissedBlocksInWindow blocks in the window
+	height := common.HeightEnableValidatorJailing
+	for i := uint64(0); i < core.MaxMissedBlocksInWindow; i++ {
+		assert.False(recordBlock(height, val1, val2, val3))
+		height++
+	}
+	vlt := es.state.Delivered().GetValidatorLivenessTracker()
+	assert.Equal(core.MaxMissedBlocksInWindow, vlt.Get(val4).NumMissedBlocks)
+	assert.Nil(vlt.Get(val1))
+	jailHeight := height
+	assert.True(recordBlock(jailHeight, val1, val2, val3))
+	assert.True(es.state.Delivered().GetValidatorLivenessTracker().IsJailed(val4))
+
+	// It is left out of the validator set, with its stake intact
+	b0 := es.getTipBlock().Block
+	b1 := addBlock(b0)
+	b2 := addBlock(b1)
+	b3 := addBlock(b2)
+	assert.ElementsMatch([]common.Address{val1, val2, val3, val4}, validatorsOf(b2.Hash()))
+	assert.ElementsMatch([]common.Address{val1, val2, val3}, validatorsOf(b3.Hash()))
+	vcp := es.state.Delivered().GetValidatorCandidatePool()
+	assert.Equal(new(big.Int).Mul(big.NewInt(4), core.MinValidatorStakeDeposit), vcp.FindStakeDelegate(val4).TotalStake())
+
+	// The jailed validator no longer counts, the others stay active
+	assert.False(recordBlock(es.state.Height()+1, val1, val2, val3))
+
+	// Back in the validator set with an UnjailTx after the cooldown
+	txFee := getMinimumTxFee()
+	val4Acc := es.state.Delivered().GetAccount(val4)
+	val4Acc.Balance = types.NewCoins(0, 10*txFee)
+	es.state.Delivered().SetAccount(val4, val4Acc)
+	unjailTx := &types.UnjailTx{
+		Fee:    types.NewCoins(0, txFee),
+		Holder: types.TxInput{Address: val4, Sequence: 1},
+	}
+	unjailTx.Holder.Signature = valPrivAccs[3].Sign(unjailTx.SignBytes(chainID))
+	_, res := es.executor.ExecuteTx(unjailTx)
+	assert.Equal(result.CodeJailCooldownNotPassed, res.Code, res.Message)
+
+	require.True(es.state.ResetState(jailHeight+core.JailCooldownPeriod-1, es.state.Commit()).IsOK())
+	b4 := addBlock(b3, unjailTx)
+	b5 := addBlock(b4)
+	b6 := addBlock(b5)
+	assert.ElementsMatch([]common.Address{val1, val2, val3}, validatorsOf(b5.Hash()))
+	assert.ElementsMatch([]common.Address{val1, val2, val3, val4}, validatorsOf(b6.Hash()))
+	assert.Nil(es.state.Delivered().GetValidatorLivenessTracker().Get(val4))
+}
+
+// otherProposerValidatorManager selects another validator than the wrapped validator manager as the next proposer
+type otherProposerValidatorManager struct {
+	core.ValidatorManager
+}
+
+func (m *otherProposerValidatorManager) GetNextProposer(blockHash common.Hash, epoch uint64) core.Validator {
+	proposer := m.ValidatorManager.GetNextProposer(blockHash, epoch)
+	for _, v := range m.GetNextValidatorSet(blockHash).Validators() {
+		if v.Address != proposer.Address {
+			return v
+		}
+	}
+	return proposer
+}
+
+func TestLedgerCoinbaseProposer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	rewardSchedule := func(blockHeight uint64, epoch uint64, validatorSet *core.ValidatorSet) *big.Int {
+		return big.NewInt(1000)
+	}
+	chainID, ledger, _ := newRewardTestLedger(rewardSchedule)
+	baseRoot := ledger.state.Delivered().Hash()
+
+	// The blocks are validated as if the other validator was selected to propose them
+	proposingExecutor := ledger.executor
+	validatingExecutor := exec.NewExecutorWithRewardSchedule(ledger.state, ledger.consensus,
+		&otherProposerValidatorManager{ledger.valMgr}, rewardSchedule)
+	applyBlock := func(height uint64) []*types.TxReceipt {
+		require.True(ledger.ResetState(height-1, baseRoot).IsOK())
+		ledger.executor = proposingExecutor
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Epoch = 1
+		block.Height = height
+		stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+		require.Equal(1, len(blockRawTxs))
+
+		require.True(ledger.ResetState(height-1, baseRoot).IsOK())
+		ledger.proposalResult = nil // the txs are executed again
+		ledger.executor = validatingExecutor
+		block.StateHash = stateRoot
+		block.Txs = blockRawTxs
+		receipts, _ := ledger.ApplyBlockTxsWithReceipts(block)
+		require.Equal(1, len(receipts))
+		return receipts
+	}
+
+	// Any validator could sign the coinbase tx before the fork
+	receipts := applyBlock(common.HeightEnableVerifiableProposer - 1)
+	assert.Equal(uint64(result.CodeOK), receipts[0].Code, receipts[0].Message)
+
+	// From the fork on, only the proposer selected for the block
+	receipts = applyBlock(common.HeightEnableVerifiableProposer)
+	assert.Equal(uint64(result.CodeUnexpectedProposer), receipts[0].Code, receipts[0].Message)
+}
+
+func TestLedgerCoinbaseOverflow(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	rewardSchedule := func(blockHeight uint64, epoch uint64, validatorSet *core.ValidatorSet) *big.Int {
+		return big.NewInt(100000)
+	}
+	chainID, ledger, _ := newRewardTestLedger(rewardSchedule)
+	for _, candidate := range ledger.state.Delivered().GetValidatorCandidatePool().SortedCandidates {
+		ledger.state.Delivered().SetStakeCommission(candidate.Holder, 10)
+	}
+	ledger.state.Delivered().UpdateTotalSupply(types.NewCoins(0, 1000000))
+	ledger.state.Commit()
+
+	checkpointHeight := common.HeightEnableCoinbaseBatching
+	for !common.IsCheckPointHeight(checkpointHeight) {
+		checkpointHeight++
+	}
+	stateRoot := ledger.state.Delivered().Hash()
+	proposeBlock := func(height uint64) *core.Block {
+		require.True(ledger.ResetState(height-1, stateRoot).IsOK())
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Epoch = 1
+		block.Height = height
+		var res result.Result
+		block.StateHash, block.Txs, res = ledger.ProposeBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+		require.Equal(1, len(block.Txs))
+		require.True(ledger.ResetState(height-1, stateRoot).IsOK())
+		ledger.proposalResult = nil // the txs are executed again
+		return block
+	}
+	coinbaseOutputs := func(block *core.Block) []types.TxOutput {
+		tx, err := types.TxFromBytes(block.Txs[0])
+		require.Nil(err)
+		return tx.(*types.CoinbaseTx).Outputs
+	}
+
+	// The outputs are sorted by address, and rejected in any other order
+	block := proposeBlock(checkpointHeight)
+	outputs := coinbaseOutputs(block)
+	require.Equal(4, len(outputs)) // the validators and the stake sources
+	for i := 1; i < len(outputs); i++ {
+		assert.True(bytes.Compare(outputs[i-1].Address[:], outputs[i].Address[:]) < 0)
+	}
+	reordered := &types.CoinbaseTx{
+		Proposer:    types.TxInput{Address: ledger.valMgr.GetNextProposer(block.Parent, block.Epoch).Address},
+		Outputs:     []types.TxOutput{outputs[1], outputs[0], outputs[2], outputs[3]},
+		BlockHeight: checkpointHeight - 1,
+	}
+	signature, err := ledger.signTransaction(reordered)
+	require.Nil(err)
+	reordered.SetSignature(reordered.Proposer.Address, signature)
+	rawTx, err := types.TxToBytes(reordered)
+	require.Nil(err)
+	block.Txs = []common.Bytes{rawTx}
+	res := ledger.ApplyBlockTxs(block)
+	assert.True(res.IsError())
+	assert.Contains(res.Message, "Invalid rewards")
+
+	// Capped at two outputs, the others are carried over, and paid first by the next blocks
+	maxOutputSize := 0
+	for _, output := range outputs {
+		if size := len(rlpEncode(t, output)); size > maxOutputSize {
+			maxOutputSize = size
+		}
+	}
+	defer exec.SetMaxCoinbaseOutputsSize(uint64(2 * maxOutputSize))()
+	paid := types.NewCoins(0, 0)
+	numPaid := []int{}
+	for height := checkpointHeight; ; height++ {
+		block := proposeBlock(height)
+		res := ledger.ApplyBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+		stateRoot = ledger.state.Commit()
+
+		outputs := coinbaseOutputs(block)
+		numPaid = append(numPaid, len(outputs))
+		for _, output := range outputs {
+			paid = paid.Plus(output.Coins)
+		}
+
+		// The total supply includes the rewards carried over
+		view := ledger.state.Delivered()
+		assert.Equal(int64(1100000), view.GetTotalSupply().TFuelWei.Int64())
+		carried := types.NewCoins(0, 0)
+		for _, output := range view.GetCoinbaseOverflow() {
+			carried = carried.Plus(output.Coins)
+		}
+		assert.Equal(int64(100000), paid.Plus(carried).TFuelWei.Int64())
+		if len(view.GetCoinbaseOverflow()) == 0 {
+			break
+		}
+	}
+	assert.Equal(2, len(numPaid), "%v", numPaid)
+	assert.Equal(4, numPaid[0]+numPaid[1])
+}
+
+// rlpEncode encodes the value for the tests, failing the test on error
+func rlpEncode(t *testing.T, val interface{}) []byte {
+	encoded, err := types.ToBytes(val)
+	require.Nil(t, err)
+	return encoded
+}
+
+func BenchmarkLedgerCoinbaseTx(b *testing.B) {
+	log.SetLevel(log.WarnLevel)
+	defer log.SetLevel(log.DebugLevel)
+
+	// 10000 stake sources of the second validator, each rewarded
+	rewardSchedule := func(blockHeight uint64, epoch uint64, validatorSet *core.ValidatorSet) *big.Int {
+		return new(big.Int).Mul(big.NewInt(4800), big.NewInt(1e18))
+	}
+	chainID, ledger, _ := newRewardTestLedger(rewardSchedule)
+	view := ledger.state.Delivered()
+	vcp := view.GetValidatorCandidatePool()
+	holder := vcp.SortedCandidates[1].Holder
+	for i := 0; i < 10000; i++ {
+		source := common.BigToAddress(big.NewInt(int64(0x20000000 + i)))
+		if err := vcp.DepositStake(source, holder, core.MinValidatorStakeDeposit); err != nil {
+			b.Fatal(err)
+		}
+	}
+	view.UpdateValidatorCandidatePool(vcp)
+	stateRoot := ledger.state.Commit()
+
+	height := common.HeightEnableCoinbaseBatching
+	for !common.IsCheckPointHeight(height) {
+		height++
+	}
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Epoch = 1
+	block.Height = height
+
+	b.Run("propose", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			ledger.ResetState(height-1, stateRoot)
+			b.StartTimer()
+
+			var res result.Result
+			block.StateHash, block.Txs, res = ledger.ProposeBlockTxs(block)
+			if res.IsError() {
+				b.Fatal(res.Message)
+			}
+		}
+	})
+
+	b.Run("validate", func(b *testing.B) {
+		ledger.ResetState(height-1, stateRoot)
+		var res result.Result
+		block.StateHash, block.Txs, res = ledger.ProposeBlockTxs(block)
+		if res.IsError() {
+			b.Fatal(res.Message)
+		}
+		tx, err := types.TxFromBytes(block.Txs[0])
+		if err != nil || len(tx.(*types.CoinbaseTx).Outputs) < 10000 {
+			b.Fatalf("Unexpected coinbase tx: %v", err)
+		}
+
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			ledger.ResetState(height-1, stateRoot)
+			ledger.proposalResult = nil
+			b.StartTimer()
+
+			if res := ledger.ApplyBlockTxs(block); res.IsError() {
+				b.Fatal(res.Message)
+			}
+		}
+	})
+}
+
+func TestLedgerStakingParamsSchedule(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, ledger, _ := newTestLedger()
+
+	raisedMinStake := new(big.Int).Mul(core.MinValidatorStakeDeposit, big.NewInt(2))
+	updateHeight := common.HeightEnableStakingParams + 10
+	schedule := core.StakingParamsSchedule
+	core.StakingParamsSchedule = []core.StakingParamsUpdate{
+		{Height: common.HeightEnableStakingParams - 5, ReturnLockingPeriod: 50}, // before the fork, not applied
+		{Height: updateHeight, MinValidatorStakeDeposit: raisedMinStake},
+		{Height: updateHeight + 10, ReturnLockingPeriod: 100},
+	}
+	defer func() { core.StakingParamsSchedule = schedule }()
+
+	baseRoot := ledger.state.Commit()
+	endOfBlock := func(blockHeight uint64) *state.StoreView {
+		require.True(ledger.ResetState(blockHeight-1, baseRoot).IsOK())
+		view := ledger.state.Delivered()
+		ledger.handleStakingParamsUpdates(view)
+		return view
+	}
+
+	view := endOfBlock(common.HeightEnableStakingParams - 6)
+	assert.Equal(core.ReturnLockingPeriod, view.GetReturnLockingPeriod())
+
+	// The update is written at the end of the preceding block, and keeps the parameters it does not set
+	view = endOfBlock(updateHeight - 2)
+	assert.Equal(core.MinValidatorStakeDeposit, view.GetMinValidatorStakeDeposit())
+	view = endOfBlock(updateHeight - 1)
+	assert.Equal(raisedMinStake, view.GetMinValidatorStakeDeposit())
+	assert.Equal(core.ReturnLockingPeriod, view.GetReturnLockingPeriod())
+
+	// The later updates apply on top of it
+	require.True(ledger.ResetState(updateHeight+8, view.Save()).IsOK())
+	view = ledger.state.Delivered()
+	ledger.handleStakingParamsUpdates(view)
+	assert.Equal(raisedMinStake, view.GetMinValidatorStakeDeposit())
+	assert.Equal(uint64(100), view.GetReturnLockingPeriod())
+}
+
+// newPendingReturnsView returns a view at the height, whose validator candidate pool holds numReturns withdrawn
+// stakes, from numReturns sources to 100 holders, one stake of each holder due at each height above the view
+func newPendingReturnsView(height uint64, numReturns int) *state.StoreView {
+	db := backend.NewMemDatabase()
+	vcp := &core.ValidatorCandidatePool{}
+	for h := 0; h < 100; h++ {
+		vcp.SortedCandidates = append(vcp.SortedCandidates, &core.StakeHolder{Holder: common.BigToAddress(big.NewInt(int64(1000000 + h)))})
+	}
+	for i := 0; i < numReturns; i++ {
+		source := common.BigToAddress(big.NewInt(int64(i + 1)))
+		candidate := vcp.SortedCandidates[i%len(vcp.SortedCandidates)]
+		candidate.Stakes = append(candidate.Stakes, &core.Stake{
+			Source:       source,
+			Amount:       new(big.Int).Set(core.MinValidatorStakeDeposit),
+			Withdrawn:    true,
+			ReturnHeight: height + 1 + uint64(i/len(vcp.SortedCandidates)),
+		})
+	}
+
+	view := state.NewStoreView(height, common.Hash{}, db)
+	for i := 0; i < numReturns; i++ {
+		view.SetAccount(common.BigToAddress(big.NewInt(int64(i+1))), types.NewAccount(common.BigToAddress(big.NewInt(int64(i+1)))))
+	}
+	view.UpdateValidatorCandidatePool(vcp)
+	return state.NewStoreView(height, view.Save(), db)
+}
+
+func TestLedgerStakeReturnQueue(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, ledger, _ := newTestLedger()
+
+	height := common.HeightEnableStakeReturnQueue
+	view := newPendingReturnsView(height, 300)
+	require.True(view.StakeReturnQueueBuilt())
+	source := common.BigToAddress(big.NewInt(1)) // due at height+1, with the sources up to 100
+	require.Equal(100, len(view.GetQueuedStakeReturns(height+1)))
+
+	// Nothing is due at the height of the view, the pool is not touched
+	poolBytes := view.Get(state.ValidatorCandidatePoolKey())
+	ledger.handleStakeReturn(view)
+	assert.Equal(poolBytes, view.Get(state.ValidatorCandidatePoolKey()))
+
+	// The stakes due are returned, and leave the queue
+	view = state.NewStoreView(height+1, view.Save(), view.GetDB())
+	ledger.handleStakeReturn(view)
+	assert.Equal(core.MinValidatorStakeDeposit, view.GetAccount(source).Balance.ThetaWei)
+	assert.Empty(view.GetQueuedStakeReturns(height + 1))
+	assert.Empty(view.GetPendingStakeReturns(source))
+	numPending := 0
+	for _, candidate := range view.GetValidatorCandidatePool().SortedCandidates {
+		numPending += len(candidate.Stakes)
+	}
+	assert.Equal(200, numPending)
+}
+
+func TestLedgerDepositNonceExpiry(t *testing.T) {
+	assert := assert.New(t)
+
+	_, ledger, _ := newTestLedger()
+
+	source := common.BigToAddress(big.NewInt(1))
+	height := common.HeightEnableDepositIdempotency
+	expiryHeight := height + core.DepositNonceWindow
+	db := backend.NewMemDatabase()
+	view := state.NewStoreView(height, common.Hash{}, db)
+	view.RecordDepositNonce(source, 42, height, expiryHeight)
+
+	// The nonce stays in the set until the block of its expiry height, the view points to the parent block
+	view = state.NewStoreView(expiryHeight-2, view.Save(), db)
+	ledger.handleDepositNonceExpiry(view)
+	_, used := view.GetDepositNonceHeight(source, 42)
+	assert.True(used)
+
+	view = state.NewStoreView(expiryHeight-1, view.Save(), db)
+	ledger.handleDepositNonceExpiry(view)
+	_, used = view.GetDepositNonceHeight(source, 42)
+	assert.False(used)
+	assert.Nil(view.Get(state.DepositNonceExpiryKey(expiryHeight)))
+}
+
+func TestLedgerStakeReturnAddress(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, ledger, _ := newTestLedger()
+
+	height := common.HeightEnableStakeReturnAddress
+	returnHeight := height + 1
+	source1, source2 := common.BigToAddress(big.NewInt(1)), common.BigToAddress(big.NewInt(2))
+	cold1, cold2 := common.BigToAddress(big.NewInt(11)), common.BigToAddress(big.NewInt(12))
+	holder, guardian := common.BigToAddress(big.NewInt(1000)), common.BigToAddress(big.NewInt(2000))
+	amount := func(n int64) *big.Int {
+		return new(big.Int).Mul(big.NewInt(n), core.MinValidatorStakeDeposit)
+	}
+	withdrawn := func(source common.Address, n int64) *core.Stake {
+		return &core.Stake{Source: source, Amount: amount(n), Withdrawn: true, ReturnHeight: returnHeight}
+	}
+
+	// The first source returns its validator stakes to a fresh address and its guardian stake to an existing one,
+	// the second source gets its stake back. The active stake stays.
+	db := backend.NewMemDatabase()
+	view := state.NewStoreView(height, common.Hash{}, db)
+	view.UpdateValidatorCandidatePool(&core.ValidatorCandidatePool{SortedCandidates: []*core.StakeHolder{{
+		Holder: holder,
+		Stakes: []*core.Stake{withdrawn(source1, 1), withdrawn(source1, 2), withdrawn(source2, 3),
+			{Source: source2, Amount: amount(4), ReturnHeight: core.InvalidReturnHeight}},
+	}}})
+	view.UpdateGuardianCandidatePool(&core.GuardianCandidatePool{SortedGuardians: []*core.StakeHolder{{
+		Holder: guardian,
+		Stakes: []*core.Stake{withdrawn(source1, 5)},
+	}}})
+	view.SetStakeReturnAddress(core.StakeForValidator, holder, source1, returnHeight, cold1)
+	view.SetStakeReturnAddress(core.StakeForGuardian, guardian, source1, returnHeight, cold2)
+	for _, address := range []common.Address{source1, source2, cold2} {
+		account := types.NewAccount(address)
+		account.Balance = types.NewCoins(7, 8)
+		view.SetAccount(address, account)
+	}
+	view = state.NewStoreView(returnHeight, view.Save(), db)
+
+	accounts := []common.Address{source1, source2, cold1, cold2}
+	totalHeld := func() *big.Int {
+		total := new(big.Int)
+		for _, address := range accounts {
+			if account := view.GetAccount(address); account != nil {
+				total.Add(total, account.Balance.ThetaWei)
+			}
+		}
+		stakeHolders := append(view.GetValidatorCandidatePool().SortedCandidates, view.GetGuardianCandidatePool().SortedGuardians...)
+		for _, stakeHolder := range stakeHolders {
+			for _, stake := range stakeHolder.Stakes { // withdrawn or not
+				total.Add(total, stake.Amount)
+			}
+		}
+		return total
+	}
+	before := totalHeld()
+
+	ledger.handleStakeReturn(view)
+
+	// The stakes are credited to the return addresses, the fresh one is created, and nothing is lost or minted
+	assert.Equal(big.NewInt(7), view.GetAccount(source1).Balance.ThetaWei)
+	require.NotNil(view.GetAccount(cold1))
+	assert.Equal(amount(3), view.GetAccount(cold1).Balance.ThetaWei)
+	assert.Equal(0, view.GetAccount(cold1).Balance.TFuelWei.Sign())
+	assert.Equal(new(big.Int).Add(amount(5), big.NewInt(7)), view.GetAccount(cold2).Balance.ThetaWei)
+	assert.Equal(new(big.Int).Add(amount(3), big.NewInt(7)), view.GetAccount(source2).Balance.ThetaWei)
+	assert.Equal(amount(4), view.GetValidatorCandidatePool().FindStakeDelegate(holder).TotalStake())
+	assert.Equal(before, totalHeld())
+
+	// The return addresses are cleared with the returns
+	_, ok := view.GetStakeReturnAddress(core.StakeForValidator, holder, source1, returnHeight)
+	assert.False(ok)
+	_, ok = view.GetStakeReturnAddress(core.StakeForGuardian, guardian, source1, returnHeight)
+	assert.False(ok)
+}
+
+// BenchmarkLedgerStakeReturn measures the stake return handling of the blocks without any stake due, which
+// scans all the pending returns before the queue, and reads a single bucket of the queue after
+func BenchmarkLedgerStakeReturn(b *testing.B) {
+	_, ledger, _ := newTestLedger()
+	for _, numReturns := range []int{10000, 100000} {
+		for _, queued := range []bool{false, true} {
+			height := common.HeightEnableStakeReturnQueue - 2 // the pools are updated without the queue
+			name := fmt.Sprintf("scan-%v", numReturns)
+			if queued {
+				height = common.HeightEnableStakeReturnQueue
+				name = fmt.Sprintf("queue-%v", numReturns)
+			}
+			view := newPendingReturnsView(height, numReturns)
+			b.Run(name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					ledger.handleStakeReturn(view)
+				}
+			})
+		}
+	}
 }
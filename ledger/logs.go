@@ -0,0 +1,217 @@
+package ledger
+
+import (
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+// MaxLogFilterBlocks is the maximum number of blocks a single GetLogs query can cover
+const MaxLogFilterBlocks uint64 = 10000
+
+// LogFilter selects the logs returned by GetLogs
+type LogFilter struct {
+	FromHeight uint64
+	ToHeight   uint64           // inclusive
+	Addresses  []common.Address // the logs emitted by any of the addresses, or by any contract if empty
+	Topics     [][]common.Hash  // the topics by position, each matching any of its hashes, or any topic if empty
+}
+
+// blockTxLogs is the value stored under a blockLogsKey, i.e. the logs of the transactions of a block which
+// emitted any, in the order of the transactions
+type blockTxLogs struct {
+	TxIndex uint64
+	TxHash  common.Hash
+	Logs    []*types.Log
+}
+
+// blockLogsKey constructs the DB key for the logs of the transactions of the given block.
+func blockLogsKey(blockHash common.Hash) common.Bytes {
+	return append(common.Bytes("ledger/logs/"), blockHash[:]...)
+}
+
+// saveBlockLogs persists the logs in the receipts of a block, keyed by the block. It is called before the state of
+// the block is committed, like saveTxReceipts. The blocks without any logs are not recorded.
+func (ledger *Ledger) saveBlockLogs(block *core.Block, receipts []*types.TxReceipt) error {
+	txLogs := []blockTxLogs{}
+	for i, receipt := range receipts {
+		if len(receipt.Logs) == 0 {
+			continue
+		}
+		txLogs = append(txLogs, blockTxLogs{
+			TxIndex: uint64(i),
+			TxHash:  receipt.TxHash,
+			Logs:    receipt.Logs,
+		})
+	}
+	if len(txLogs) == 0 {
+		return nil
+	}
+	store := kvstore.NewKVStore(ledger.state.DB())
+	if err := store.Put(blockLogsKey(block.Hash()), txLogs); err != nil {
+		return fmt.Errorf("Failed to save the logs of block %v: %v", block.Hash().Hex(), err)
+	}
+	return nil
+}
+
+// GetBlockLogs returns the logs emitted by the transactions of the block with the given hash, with the fields
+// derived from the block filled in. It returns no logs for the blocks not applied by this node.
+func (ledger *Ledger) GetBlockLogs(blockHash common.Hash) ([]*types.Log, error) {
+	block, err := ledger.chain.FindBlock(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	return ledger.getBlockLogs(block)
+}
+
+func (ledger *Ledger) getBlockLogs(block *core.ExtendedBlock) ([]*types.Log, error) {
+	txLogs := []blockTxLogs{}
+	err := kvstore.NewKVStore(ledger.state.DB()).Get(blockLogsKey(block.Hash()), &txLogs)
+	if err == store.ErrKeyNotFound {
+		return []*types.Log{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logs := []*types.Log{}
+	for _, entry := range txLogs {
+		for _, log := range entry.Logs {
+			log.BlockNumber = block.Height
+			log.BlockHash = block.Hash()
+			log.TxHash = entry.TxHash
+			log.TxIndex = uint(entry.TxIndex)
+			log.Index = uint(len(logs))
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
+
+// GetLogs returns the logs emitted by the transactions of the finalized blocks in the height range of the
+// filter, which match its addresses and topics. From common.HeightEnableLogBloom, the blocks whose bloom
+// filter rules out a match are skipped without loading their logs.
+func (ledger *Ledger) GetLogs(filter *LogFilter) ([]*types.Log, error) {
+	if ledger.chain == nil {
+		return nil, fmt.Errorf("The blocks are not available")
+	}
+	if filter.ToHeight < filter.FromHeight {
+		return nil, fmt.Errorf("Invalid height range: %v to %v", filter.FromHeight, filter.ToHeight)
+	}
+	if filter.ToHeight-filter.FromHeight >= MaxLogFilterBlocks {
+		return nil, fmt.Errorf("The height range can cover at most %v blocks", MaxLogFilterBlocks)
+	}
+
+	logs := []*types.Log{}
+	for height := filter.FromHeight; height <= filter.ToHeight; height++ {
+		block := ledger.findFinalizedBlock(height)
+		if block == nil {
+			continue
+		}
+		if height >= common.HeightEnableLogBloom && !filter.bloomMatches(block.Bloom) {
+			continue
+		}
+		blockLogs, err := ledger.getBlockLogs(block)
+		if err != nil {
+			return nil, err
+		}
+		for _, log := range blockLogs {
+			if filter.matches(log) {
+				logs = append(logs, log)
+			}
+		}
+	}
+	return logs, nil
+}
+
+// bloomMatches returns false if the bloom filter rules out any log matching the filter
+func (filter *LogFilter) bloomMatches(bloom core.Bloom) bool {
+	if len(filter.Addresses) > 0 {
+		included := false
+		for _, address := range filter.Addresses {
+			if core.BloomLookup(bloom, address) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, topics := range filter.Topics {
+		if len(topics) == 0 {
+			continue
+		}
+		included := false
+		for _, topic := range topics {
+			if core.BloomLookup(bloom, topic) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	return true
+}
+
+// matches returns true if the log matches the addresses and topics of the filter
+func (filter *LogFilter) matches(log *types.Log) bool {
+	if len(filter.Addresses) > 0 {
+		included := false
+		for _, address := range filter.Addresses {
+			if log.Address == address {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	if len(filter.Topics) > len(log.Topics) {
+		return false
+	}
+	for i, topics := range filter.Topics {
+		if len(topics) == 0 {
+			continue
+		}
+		included := false
+		for _, topic := range topics {
+			if log.Topics[i] == topic {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	return true
+}
+
+// setProposalBloom sets the bloom filter of the logs of the proposed block from common.HeightEnableLogBloom
+func setProposalBloom(block *core.Block, receipts []*types.TxReceipt) {
+	if block == nil || block.Height < common.HeightEnableLogBloom {
+		return
+	}
+	block.Bloom = types.CreateBloom(receipts)
+}
+
+// checkBlockBloom verifies the bloom filter of the logs committed by the block from common.HeightEnableLogBloom
+func checkBlockBloom(block *core.Block, receipts []*types.TxReceipt) result.Result {
+	if block.Height < common.HeightEnableLogBloom {
+		return result.OK
+	}
+	if bloom := types.CreateBloom(receipts); bloom != block.Bloom {
+		return result.Error("Log bloom mismatch! bloom: %v, expected: %v", bloom.Big().Text(16), block.Bloom.Big().Text(16)).
+			WithErrorCode(result.CodeLogBloomMismatch)
+	}
+	return result.OK
+}
@@ -0,0 +1,170 @@
+package ledger
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+func TestLedgerGetLogs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, accs := newContractTestLedger(2)
+	caller, sender := accs[0], accs[1]
+	topicA := common.BytesToHash([]byte("topic A"))
+	topicB := common.BytesToHash([]byte("topic B"))
+	topicC := common.BytesToHash([]byte("topic C"))
+
+	// ASM:
+	// push 0x2a, push 0x0, mstore
+	// push32 topicA, push 0x20, push 0x0, log1
+	// push32 topicC, push32 topicB, push 0x20, push 0x0, log2
+	// stop
+	code := common.Hex2Bytes("602a600052" + "7f" + common.Bytes2Hex(topicA[:]) + "60206000a1" +
+		"7f" + common.Bytes2Hex(topicC[:]) + "7f" + common.Bytes2Hex(topicB[:]) + "60206000a200")
+	contract1 := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	contract2 := common.HexToAddress("0x1000000000000000000000000000000000000002")
+	ledger.state.Delivered().SetCode(contract1, code)
+	ledger.state.Delivered().SetCode(contract2, code)
+	ledger.state.Commit()
+
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = ledger.state.Height()
+	store := kvstore.NewKVStore(ledger.state.DB())
+	ledger.chain = blockchain.NewChain(chainID, store, root)
+
+	// Each contract call emits two logs. The blocks start with their CoinbaseTx.
+	sequence := uint64(0)
+	newContractTx := func(contractAddr common.Address) common.Bytes {
+		sequence++
+		return newRawContractTx(chainID, sequence, caller, contractAddr, 0, 100000, nil)
+	}
+	tx1, tx2, tx3, tx4, tx5 := newContractTx(contract1), newContractTx(contract2), newContractTx(contract1),
+		newContractTx(contract2), newContractTx(contract1)
+	noLogsTx := newRawSendTx(chainID, 1, true, caller, sender, false)
+	blocksTxs := [][]common.Bytes{{tx1}, {noLogsTx, tx2}, {tx3, tx4}, {tx5}}
+
+	parent := ledger.chain.Root()
+	blockHashes := []common.Hash{}
+	for _, txs := range blocksTxs {
+		block, receipts := proposeAndApplyBlock(t, ledger, parent.Hash(), txs...)
+		require.Equal(len(txs)+1, len(block.Txs))
+		assert.NotEqual(core.Bloom{}, block.Bloom)
+
+		var err error
+		parent, err = ledger.chain.AddBlock(block)
+		require.Nil(err)
+		require.Nil(ledger.chain.FinalizePreviousBlocks(parent.Hash()))
+		blockHashes = append(blockHashes, block.Hash())
+		require.Equal(2, len(receipts[len(receipts)-1].Logs))
+	}
+
+	// The logs are stored by block, with the fields derived from the block
+	logs, err := ledger.GetBlockLogs(blockHashes[1])
+	require.Nil(err)
+	require.Equal(2, len(logs))
+	assert.Equal(contract2, logs[0].Address)
+	assert.Equal([]common.Hash{topicA}, logs[0].Topics)
+	assert.Equal(common.BigToHash(big.NewInt(42)).Bytes(), logs[0].Data)
+	assert.Equal([]common.Hash{topicB, topicC}, logs[1].Topics)
+	assert.Equal(root.Height+2, logs[1].BlockNumber)
+	assert.Equal(blockHashes[1], logs[1].BlockHash)
+	assert.Equal(crypto.Keccak256Hash(tx2), logs[1].TxHash)
+	assert.Equal(uint(2), logs[1].TxIndex)
+	assert.Equal(uint(1), logs[1].Index)
+
+	logs, err = ledger.GetBlockLogs(blockHashes[2])
+	require.Nil(err)
+	require.Equal(4, len(logs))
+	assert.Equal(uint(2), logs[3].TxIndex)
+	assert.Equal(uint(3), logs[3].Index)
+
+	// The filters select subsets of the logs
+	getLogs := func(filter *LogFilter) []*types.Log {
+		logs, err := ledger.GetLogs(filter)
+		require.Nil(err)
+		return logs
+	}
+	fromHeight, toHeight := root.Height+1, root.Height+4
+	assert.Equal(10, len(getLogs(&LogFilter{FromHeight: fromHeight, ToHeight: toHeight})))
+	assert.Equal(2, len(getLogs(&LogFilter{FromHeight: fromHeight, ToHeight: fromHeight})))
+	assert.Equal(8, len(getLogs(&LogFilter{FromHeight: fromHeight + 1, ToHeight: toHeight + 10})))
+
+	logs = getLogs(&LogFilter{FromHeight: fromHeight, ToHeight: toHeight, Addresses: []common.Address{contract1}})
+	require.Equal(6, len(logs))
+	assert.Equal(root.Height+1, logs[0].BlockNumber)
+	assert.Equal(root.Height+3, logs[2].BlockNumber)
+	assert.Equal(crypto.Keccak256Hash(tx3), logs[2].TxHash)
+	assert.Equal(root.Height+4, logs[4].BlockNumber)
+
+	logs = getLogs(&LogFilter{FromHeight: fromHeight, ToHeight: toHeight, Topics: [][]common.Hash{{topicB}}})
+	require.Equal(5, len(logs))
+	for _, log := range logs {
+		assert.Equal([]common.Hash{topicB, topicC}, log.Topics)
+	}
+	assert.Equal(10, len(getLogs(&LogFilter{FromHeight: fromHeight, ToHeight: toHeight, Topics: [][]common.Hash{{topicA, topicB}}})))
+	assert.Equal(5, len(getLogs(&LogFilter{FromHeight: fromHeight, ToHeight: toHeight, Topics: [][]common.Hash{{}, {topicC}}})))
+	assert.Equal(0, len(getLogs(&LogFilter{FromHeight: fromHeight, ToHeight: toHeight, Topics: [][]common.Hash{{topicB}, {topicA}}})))
+
+	logs = getLogs(&LogFilter{FromHeight: fromHeight, ToHeight: toHeight, Addresses: []common.Address{contract2},
+		Topics: [][]common.Hash{{topicA}}})
+	require.Equal(2, len(logs))
+	assert.Equal(root.Height+2, logs[0].BlockNumber)
+	assert.Equal(root.Height+3, logs[1].BlockNumber)
+
+	otherContract := common.HexToAddress("0x1000000000000000000000000000000000000003")
+	assert.Equal(0, len(getLogs(&LogFilter{FromHeight: fromHeight, ToHeight: toHeight, Addresses: []common.Address{otherContract}})))
+
+	// Invalid ranges
+	_, err = ledger.GetLogs(&LogFilter{FromHeight: toHeight, ToHeight: fromHeight})
+	assert.NotNil(err)
+	_, err = ledger.GetLogs(&LogFilter{FromHeight: fromHeight, ToHeight: fromHeight + MaxLogFilterBlocks})
+	assert.NotNil(err)
+}
+
+func TestLedgerLogBloom(t *testing.T) {
+	assert := assert.New(t)
+
+	address := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	topic := common.BytesToHash([]byte("topic"))
+	receipts := []*types.TxReceipt{
+		{},
+		{Logs: []*types.Log{{Address: address, Topics: []common.Hash{topic}}}},
+	}
+	bloom := types.CreateBloom(receipts)
+	assert.True(core.BloomLookup(bloom, address))
+	assert.True(core.BloomLookup(bloom, topic))
+	assert.False(core.BloomLookup(bloom, common.HexToAddress("0x1000000000000000000000000000000000000002")))
+	assert.Equal(core.Bloom{}, types.CreateBloom(receipts[:1]))
+
+	// Before the fork, the bloom is neither set nor verified
+	block := core.NewBlock()
+	block.Height = common.HeightEnableLogBloom - 1
+	setProposalBloom(block, receipts)
+	assert.Equal(core.Bloom{}, block.Bloom)
+	assert.True(checkBlockBloom(block, receipts).IsOK())
+
+	// From the fork, the bloom is committed by the block
+	block.Height = common.HeightEnableLogBloom
+	setProposalBloom(block, receipts)
+	assert.Equal(bloom, block.Bloom)
+	assert.True(checkBlockBloom(block, receipts).IsOK())
+	assert.Equal(result.CodeLogBloomMismatch, checkBlockBloom(block, receipts[:1]).Code)
+
+	// The bloom is part of the signed header
+	hash := block.Hash()
+	block.Bloom = core.Bloom{}
+	assert.NotEqual(hash, block.UpdateHash())
+	setProposalBloom(nil, receipts)
+}
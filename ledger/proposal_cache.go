@@ -0,0 +1,60 @@
+package ledger
+
+import (
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+//
+// proposalResult is the execution result of the latest proposed block txs. When the proposer's own
+// block comes back for application, the already computed state is committed instead of executing
+// the txs again.
+//
+type proposalResult struct {
+	txListHash common.Hash // hash of the ordered tx list, i.e. the TxHash of the proposed block
+	baseHeight uint64      // height and root of the state the txs were executed on
+	baseRoot   common.Hash
+	stateRoot  common.Hash
+
+	view               *st.StoreView
+	receipts           []*types.TxReceipt // per-tx outcomes, in the block order
+	hasValidatorUpdate bool
+}
+
+// takeProposalResult returns the cached proposal result if it applies to the given block on top of
+// the state of the given height and root. The cache is cleared either way, since it is invalidated
+// by any block application.
+func (ledger *Ledger) takeProposalResult(block *core.Block, height uint64, stateRoot common.Hash) *proposalResult {
+	cached := ledger.proposalResult
+	ledger.proposalResult = nil
+
+	if cached == nil || cached.baseHeight != height || cached.baseRoot != stateRoot ||
+		cached.stateRoot != block.StateHash || cached.txListHash != core.CalculateRootHash(block.Txs) {
+		return nil
+	}
+	return cached
+}
+
+// proposalTxSource provides the candidate regular txs of the block proposal. It is implemented by the mempool,
+// and the caller must hold the mempool lock.
+type proposalTxSource interface {
+	PeekUnsafe() common.Bytes
+	ReapUnsafe(maxNumTxs int) []common.Bytes
+}
+
+// isValidatorUpdateTx returns whether the given tx could update the validator set, given the result of its
+// execution, e.g. a smart contract tx depositing or withdrawing the stake of a contract
+func isValidatorUpdateTx(tx types.Tx, res result.Result) bool {
+	switch tx.(type) {
+	case *types.DepositStakeTx, *types.WithdrawStakeTx, *types.DoubleSignSlashTx, *types.CancelWithdrawTx, *types.UnjailTx,
+		*types.EjectStakeTx, *types.UpdateValidatorKeyTx:
+		return true
+	case *types.SmartContractTx:
+		_, ok := res.Info["validatorSetEffectiveHeight"]
+		return ok
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package ledger
+
+import (
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+// txReceiptKey constructs the DB key for the receipt of the given transaction hash.
+func txReceiptKey(hash common.Hash) common.Bytes {
+	return append(common.Bytes("txr/"), hash[:]...)
+}
+
+// GetTxReceipt returns the receipt of the transaction with the given hash. The hash is the
+// Keccak256 hash of the raw transaction bytes, i.e. the same hash used by the transaction index.
+func (ledger *Ledger) GetTxReceipt(hash common.Hash) (*types.TxReceipt, error) {
+	store := kvstore.NewKVStore(ledger.state.DB())
+	receipt := &types.TxReceipt{}
+	err := store.Get(txReceiptKey(hash), receipt)
+	if err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// GetInternalTransfers returns the value transfers made by the contracts during the execution of the smart
+// contract transaction with the given hash, and whether the transfers beyond types.MaxInternalTransfersPerTx
+// were dropped. The reverted transfers are included, with Success set to false.
+func (ledger *Ledger) GetInternalTransfers(hash common.Hash) ([]*types.InternalTransfer, bool, error) {
+	receipt, err := ledger.GetTxReceipt(hash)
+	if err != nil {
+		return nil, false, err
+	}
+	transfers := receipt.InternalTransfers
+	if transfers == nil {
+		transfers = []*types.InternalTransfer{}
+	}
+	return transfers, receipt.InternalTransfersTruncated, nil
+}
+
+// saveTxReceipts persists the receipts of a block in a single batch. It is called before the state of the block
+// is committed, so that a committed block always has its receipts, and a failure leaves the block to be retried.
+func (ledger *Ledger) saveTxReceipts(receipts []*types.TxReceipt) error {
+	batch := ledger.state.DB().NewBatch()
+	for _, receipt := range receipts {
+		encodedReceipt, err := rlp.EncodeToBytes(receipt)
+		if err != nil {
+			return fmt.Errorf("Failed to encode the receipt of tx %v: %v", receipt.TxHash.Hex(), err)
+		}
+		if err := batch.Put(txReceiptKey(receipt.TxHash), encodedReceipt); err != nil {
+			return fmt.Errorf("Failed to save the receipt of tx %v: %v", receipt.TxHash.Hex(), err)
+		}
+	}
+	return batch.Write()
+}
+
+// setProposalReceiptRoot sets the root hash of the receipts of the proposed block from common.HeightEnableReceiptRoot
+func setProposalReceiptRoot(block *core.Block, receipts []*types.TxReceipt) {
+	if block == nil || block.Height < common.HeightEnableReceiptRoot {
+		return
+	}
+	receiptRoot, err := types.DeriveReceiptRoot(receipts)
+	if err != nil {
+		logger.Errorf("Failed to derive the receipt root of the proposed block: %v", err)
+		return
+	}
+	block.ReceiptHash = receiptRoot
+}
+
+// checkBlockReceiptRoot verifies the root hash of the receipts committed by the block from
+// common.HeightEnableReceiptRoot
+func checkBlockReceiptRoot(block *core.Block, receipts []*types.TxReceipt) result.Result {
+	if block.Height < common.HeightEnableReceiptRoot {
+		return result.OK
+	}
+	receiptRoot, err := types.DeriveReceiptRoot(receipts)
+	if err != nil {
+		return result.Error("Failed to derive the receipt root: %v", err).WithErrorCode(result.CodeReceiptRootMismatch)
+	}
+	if receiptRoot != block.ReceiptHash {
+		return result.Error("Receipt root mismatch! root: %v, expected: %v", receiptRoot.Hex(), block.ReceiptHash.Hex()).
+			WithErrorCode(result.CodeReceiptRootMismatch)
+	}
+	return result.OK
+}
+
+// newTxReceipt creates the receipt for a transaction from its execution result
+func newTxReceipt(txHash common.Hash, tx types.Tx, res result.Result) *types.TxReceipt {
+	receipt := &types.TxReceipt{
+		TxHash:  txHash,
+		Code:    uint64(res.Code),
+		Message: res.Message,
+		Fee:     types.NewCoins(0, 0),
+	}
+	if res.IsError() {
+		return receipt
+	}
+
+	if fee, ok := res.Info["fee"]; ok {
+		receipt.Fee = fee.(types.Coins)
+	} else if tx != nil {
+		receipt.Fee = getTxFee(tx)
+	}
+	if gasUsed, ok := res.Info["gasUsed"]; ok {
+		receipt.GasUsed = gasUsed.(uint64)
+	}
+	if logs, ok := res.Info["logs"]; ok {
+		receipt.Logs = logs.([]*types.Log)
+	}
+	if vmError, ok := res.Info["vmError"]; ok {
+		receipt.Message = vmError.(string) // e.g. out of gas, the tx is applied with its state changes reverted
+	}
+	if revertData, ok := res.Info["revertData"]; ok {
+		receipt.RevertData = revertData.(common.Bytes)
+	}
+	if transfers, ok := res.Info["internalTransfers"]; ok {
+		receipt.InternalTransfers = transfers.([]*types.InternalTransfer)
+	}
+	if truncated, ok := res.Info["internalTransfersTruncated"]; ok {
+		receipt.InternalTransfersTruncated = truncated.(bool)
+	}
+	return receipt
+}
+
+// getTxFee returns the fee specified by the transaction. Transactions without a fee field
+// (e.g. CoinbaseTx) are charged zero
+func getTxFee(tx types.Tx) types.Coins {
+	var fee types.Coins
+	switch tx := tx.(type) {
+	case *types.SendTx:
+		fee = tx.Fee
+	case *types.ReserveFundTx:
+		fee = tx.Fee
+	case *types.ReleaseFundTx:
+		fee = tx.Fee
+	case *types.ServicePaymentTx:
+		fee = tx.Fee
+	case *types.SplitRuleTx:
+		fee = tx.Fee
+	case *types.DepositStakeTx:
+		fee = tx.Fee
+	case *types.WithdrawStakeTx:
+		fee = tx.Fee
+	case *types.PartialReleaseFundTx:
+		fee = tx.Fee
+	case *types.ExtendSplitRuleTx:
+		fee = tx.Fee
+	case *types.SweepAccountTx:
+		fee = tx.Fee
+	case *types.BurnTx:
+		fee = tx.Fee
+	case *types.DoubleSignSlashTx:
+		fee = tx.Fee
+	case *types.StakeCommissionTx:
+		fee = tx.Fee
+	case *types.CancelWithdrawTx:
+		fee = tx.Fee
+	case *types.UpdateValidatorMetadataTx:
+		fee = tx.Fee
+	case *types.UnjailTx:
+		fee = tx.Fee
+	case *types.EjectStakeTx:
+		fee = tx.Fee
+	case *types.UpdateValidatorKeyTx:
+		fee = tx.Fee
+	case types.CustomTx:
+		fee = *tx.GetFee()
+	}
+	return fee.NoNil()
+}
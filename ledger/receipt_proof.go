@@ -0,0 +1,93 @@
+package ledger
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+// ReceiptProof proves the receipt of a transaction against the receipt root committed by its block, see
+// core.BlockHeader.ReceiptHash. The receipt is encoded with types.TxReceipt.ConsensusBytes, the version of
+// which it carries.
+type ReceiptProof struct {
+	BlockHash   common.Hash
+	BlockHeight uint64
+	ReceiptRoot common.Hash
+	Index       uint64        // index of the transaction in the block
+	Proof       core.VCPProof // the trie nodes on the path to the receipt
+}
+
+// GetReceiptProof returns the receipt of the transaction with the given hash, and the proof of it against the
+// receipt root of its block. It requires the tx index, see GetTxByHash, and returns an error if the block is not
+// finalized, or does not commit its receipts, see common.HeightEnableReceiptRoot.
+func (ledger *Ledger) GetReceiptProof(txHash common.Hash) (*types.TxReceipt, *ReceiptProof, error) {
+	if ledger.chain == nil {
+		return nil, nil, fmt.Errorf("The blocks are not available")
+	}
+	_, location, err := ledger.GetTxByHash(txHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := ledger.chain.FindBlock(location.BlockHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !block.Status.IsFinalized() {
+		return nil, nil, fmt.Errorf("Block %v is not finalized", location.BlockHash.Hex())
+	}
+	if block.Height < common.HeightEnableReceiptRoot {
+		return nil, nil, fmt.Errorf("Block %v does not commit its receipts", location.BlockHash.Hex())
+	}
+
+	receipts := make([]*types.TxReceipt, len(block.Txs))
+	for i, rawTx := range block.Txs {
+		receipts[i], err = ledger.GetTxReceipt(crypto.Keccak256Hash(rawTx))
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to load the receipt of tx #%v of block %v: %v", i, location.BlockHash.Hex(), err)
+		}
+	}
+
+	// The stored receipts might have been overwritten, e.g. by a block on a fork including the same tx
+	receiptRoot, err := types.DeriveReceiptRoot(receipts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if receiptRoot != block.ReceiptHash {
+		return nil, nil, fmt.Errorf("The stored receipts of block %v do not match its receipt root", location.BlockHash.Hex())
+	}
+
+	proof := &ReceiptProof{
+		BlockHash:   location.BlockHash,
+		BlockHeight: block.Height,
+		ReceiptRoot: receiptRoot,
+		Index:       location.Index,
+	}
+	if err := types.ProveReceipt(receipts, int(location.Index), &proof.Proof); err != nil {
+		return nil, nil, err
+	}
+	return receipts[location.Index], proof, nil
+}
+
+// VerifyReceiptProof checks that the receipt is the one proven against the receipt root, which the caller gets
+// from the block header it trusts
+func VerifyReceiptProof(receipt *types.TxReceipt, proof *ReceiptProof, receiptRoot common.Hash) error {
+	if proof.ReceiptRoot != receiptRoot {
+		return fmt.Errorf("The proof is for receipt root %v, not %v", proof.ReceiptRoot.Hex(), receiptRoot.Hex())
+	}
+	proven, err := core.VerifyItemProof(receiptRoot, int(proof.Index), &proof.Proof)
+	if err != nil {
+		return fmt.Errorf("Invalid receipt proof: %v", err)
+	}
+	encoded, err := receipt.ConsensusBytes()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(proven, encoded) {
+		return fmt.Errorf("The receipt does not match the one proven at index %v", proof.Index)
+	}
+	return nil
+}
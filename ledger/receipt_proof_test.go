@@ -0,0 +1,145 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+func TestLedgerReceiptRoot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	receipts := []*types.TxReceipt{
+		{TxHash: common.BytesToHash([]byte("tx1")), Fee: types.NewCoins(0, 0)},
+		{TxHash: common.BytesToHash([]byte("tx2")), Fee: types.NewCoins(0, 1000), GasUsed: 21000},
+	}
+	receiptRoot, err := types.DeriveReceiptRoot(receipts)
+	require.Nil(err)
+
+	// Before the fork, the receipt root is neither set nor verified
+	block := core.NewBlock()
+	block.Height = common.HeightEnableReceiptRoot - 1
+	setProposalReceiptRoot(block, receipts)
+	block.AddTxs([]common.Bytes{common.Bytes("tx1"), common.Bytes("tx2")})
+	assert.Equal(core.EmptyRootHash, block.ReceiptHash)
+	assert.True(checkBlockReceiptRoot(block, receipts[:1]).IsOK())
+
+	// From the fork, the receipt root is committed by the block, and kept when the txs are added
+	block = core.NewBlock()
+	block.Height = common.HeightEnableReceiptRoot
+	setProposalReceiptRoot(block, receipts)
+	block.AddTxs([]common.Bytes{common.Bytes("tx1"), common.Bytes("tx2")})
+	assert.Equal(receiptRoot, block.ReceiptHash)
+	assert.True(checkBlockReceiptRoot(block, receipts).IsOK())
+	assert.Equal(result.CodeReceiptRootMismatch, checkBlockReceiptRoot(block, receipts[:1]).Code)
+
+	// Any change to the consensus fields of a receipt is caught
+	tampered := *receipts[1]
+	tampered.GasUsed++
+	assert.Equal(result.CodeReceiptRootMismatch, checkBlockReceiptRoot(block, []*types.TxReceipt{receipts[0], &tampered}).Code)
+
+	// The receipt root is part of the signed header
+	hash := block.Hash()
+	block.ReceiptHash = core.EmptyRootHash
+	assert.NotEqual(hash, block.UpdateHash())
+	setProposalReceiptRoot(nil, receipts)
+}
+
+func TestLedgerReceiptProof(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	viper.Set(common.CfgStorageTxIndexEnabled, true)
+	defer viper.Set(common.CfgStorageTxIndexEnabled, false)
+
+	chainID, ledger, _ := newTestLedger()
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = common.HeightEnableReceiptRoot - 2
+	ledger.chain = blockchain.NewChain(chainID, kvstore.NewKVStore(ledger.state.DB()), root)
+
+	// The blocks straddle the receipt root fork
+	parent := ledger.chain.Root()
+	blocks := []*core.Block{}
+	blocksReceipts := [][]*types.TxReceipt{}
+	for i := 0; i < 2; i++ {
+		rawTxs := []common.Bytes{}
+		receipts := []*types.TxReceipt{}
+		for j := 0; j < 3; j++ {
+			rawTx := common.Bytes(string(rune('a'+i)) + string(rune('0'+j)))
+			rawTxs = append(rawTxs, rawTx)
+			receipts = append(receipts, &types.TxReceipt{
+				TxHash:  crypto.Keccak256Hash(rawTx),
+				Fee:     types.NewCoins(0, int64(1000*j)),
+				GasUsed: uint64(21000 + j),
+			})
+		}
+
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = parent.Height + 1
+		block.Parent = parent.Hash()
+		setProposalReceiptRoot(block, receipts)
+		block.AddTxs(rawTxs)
+
+		var err error
+		parent, err = ledger.chain.AddBlock(block)
+		require.Nil(err)
+		require.Nil(ledger.chain.FinalizePreviousBlocks(parent.Hash()))
+		ledger.saveTxReceipts(receipts)
+		ledger.indexBlockTxs(block)
+		blocks = append(blocks, block)
+		blocksReceipts = append(blocksReceipts, receipts)
+	}
+
+	// The receipts of the blocks before the fork are not provable
+	_, _, err := ledger.GetReceiptProof(blocksReceipts[0][1].TxHash)
+	assert.NotNil(err)
+
+	// Each receipt is proven against the receipt root of its block
+	receiptRoot := blocks[1].ReceiptHash
+	for i, expected := range blocksReceipts[1] {
+		receipt, proof, err := ledger.GetReceiptProof(expected.TxHash)
+		require.Nil(err)
+		assert.Equal(expected.TxHash, receipt.TxHash)
+		assert.Equal(blocks[1].Hash(), proof.BlockHash)
+		assert.Equal(blocks[1].Height, proof.BlockHeight)
+		assert.Equal(uint64(i), proof.Index)
+		assert.Nil(VerifyReceiptProof(receipt, proof, receiptRoot))
+
+		// The proof survives the round trip
+		encoded, err := rlp.EncodeToBytes(proof)
+		require.Nil(err)
+		decoded := &ReceiptProof{}
+		require.Nil(rlp.DecodeBytes(encoded, decoded))
+		assert.Nil(VerifyReceiptProof(receipt, decoded, receiptRoot))
+	}
+
+	receipt, proof, err := ledger.GetReceiptProof(blocksReceipts[1][2].TxHash)
+	require.Nil(err)
+
+	// A tampered receipt, a wrong index or a wrong root are rejected
+	tampered := *receipt
+	tampered.GasUsed++
+	assert.NotNil(VerifyReceiptProof(&tampered, proof, receiptRoot))
+	wrongIndex := *proof
+	wrongIndex.Index = 1
+	assert.NotNil(VerifyReceiptProof(receipt, &wrongIndex, receiptRoot))
+	assert.NotNil(VerifyReceiptProof(receipt, proof, blocks[0].ReceiptHash))
+
+	// The stored receipts not matching the receipt root of the block are not proven
+	ledger.saveTxReceipts([]*types.TxReceipt{&tampered})
+	_, _, err = ledger.GetReceiptProof(receipt.TxHash)
+	assert.NotNil(err)
+}
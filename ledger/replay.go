@@ -0,0 +1,111 @@
+package ledger
+
+import (
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+// BlockReplayDivergence describes the first replayed block that does not reproduce its recorded state root
+type BlockReplayDivergence struct {
+	Height            uint64
+	BlockHash         common.Hash
+	ExpectedStateRoot common.Hash      // the state root recorded in the block
+	StateRoot         common.Hash      // the state root of the replay, empty if a transaction failed
+	Code              result.ErrorCode // the code of the failure
+	Failure           string           // the message of the failure
+}
+
+// ReplayBlocks re-executes the transactions of the finalized blocks from startHeight to endHeight inclusively
+// on top of the state of the finalized block at startHeight-1, and checks the resulting state after each block
+// against the state root recorded in it. It returns the first block that diverges, or nil if all of them are
+// reproduced. The progress function, if not nil, is invoked with the height of each reproduced block.
+//
+// The blocks are replayed against a scratch checkout whose changes are never saved, so the live state is not
+// disturbed. It returns an error if the blocks are not available, or if the state at startHeight-1 has been
+// pruned.
+func (ledger *Ledger) ReplayBlocks(startHeight, endHeight uint64, progress func(height uint64)) (*BlockReplayDivergence, error) {
+	if startHeight == 0 {
+		return nil, fmt.Errorf("Can not replay from height 0, there is no state to start with")
+	}
+	if endHeight < startHeight {
+		return nil, fmt.Errorf("Invalid replay range: %v to %v", startHeight, endHeight)
+	}
+	if ledger.chain == nil {
+		return nil, fmt.Errorf("The blocks are not available")
+	}
+
+	baseHeight := startHeight - 1
+	base := ledger.findFinalizedBlock(baseHeight)
+	if base == nil {
+		return nil, fmt.Errorf("No finalized block found at height %v", baseHeight)
+	}
+
+	db := ledger.state.DB()
+	var prunedHeight uint64
+	err := kvstore.NewKVStore(db).Get(state.StatePruningProgressKey(), &prunedHeight)
+	if err == nil && baseHeight <= prunedHeight {
+		return nil, fmt.Errorf("The state at height %v has been pruned", baseHeight)
+	}
+
+	consensus := &reproConsensusEngine{}
+	scratch, err := newScratchLedger(ledger.state.GetChainID(), db, baseHeight, base.StateHash, consensus, ledger.valMgr,
+		ledger.executor.RewardSchedule())
+	if err != nil {
+		return nil, fmt.Errorf("The state at height %v is not available, it might have been pruned: %v", baseHeight, err)
+	}
+	consensus.ledger = scratch
+
+	parentHash := base.Hash()
+	for height := startHeight; height <= endHeight; height++ {
+		extBlock := ledger.findFinalizedBlock(height)
+		if extBlock == nil {
+			return nil, fmt.Errorf("No finalized block found at height %v", height)
+		}
+		if extBlock.Parent != parentHash {
+			return nil, fmt.Errorf("The finalized block at height %v does not extend the one at height %v", height, height-1)
+		}
+		block := extBlock.Block
+
+		consensus.block = block
+		scratch.currentBlock = block
+		res := scratch.executeBlockTxs(block)
+		if res.IsError() {
+			divergence := &BlockReplayDivergence{
+				Height:            height,
+				BlockHash:         extBlock.Hash(),
+				ExpectedStateRoot: block.StateHash,
+				Code:              res.Code,
+				Failure:           res.Message,
+			}
+			if res.Code == result.CodeStateRootMismatch {
+				divergence.StateRoot = scratch.state.Delivered().Hash()
+			}
+			return divergence, nil
+		}
+
+		// Continue with the in-memory state, same as the delivered state is committed after each block
+		scratch.state.Delivered().IncrementHeight()
+		parentHash = extBlock.Hash()
+
+		if progress != nil {
+			progress(height)
+		}
+	}
+
+	return nil, nil
+}
+
+// findFinalizedBlock returns the finalized block at the given height, or nil if there is none
+func (ledger *Ledger) findFinalizedBlock(height uint64) *core.ExtendedBlock {
+	for _, block := range ledger.chain.FindBlocksByHeight(height) {
+		if block.Status.IsFinalized() {
+			return block
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package ledger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+func TestLedgerReplayBlocks(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 2)
+
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = ledger.state.Height()
+	root.StateHash = ledger.state.Delivered().Hash()
+	store := kvstore.NewKVStore(ledger.state.DB())
+	ledger.chain = blockchain.NewChain(chainID, store, root)
+
+	txFee := getMinimumTxFee()
+	reserveFundTx := &types.ReserveFundTx{
+		Fee: types.NewCoins(0, txFee),
+		Source: types.TxInput{
+			Address:  accIns[0].Address,
+			Coins:    types.NewCoins(0, 1000*txFee),
+			Sequence: 2,
+		},
+		Collateral:  types.NewCoins(0, 1001*txFee),
+		ResourceIDs: []string{"rid001"},
+		Duration:    1000,
+	}
+	reserveFundTx.Source.Signature = accIns[0].Sign(reserveFundTx.SignBytes(chainID))
+	reserveFundTxBytes, err := types.TxToBytes(reserveFundTx)
+	require.Nil(err)
+
+	blocksTxs := [][]common.Bytes{
+		{newRawSendTx(chainID, 1, true, accOut, accIns[0], false)},
+		{reserveFundTxBytes},
+		{newRawSendTx(chainID, 3, true, accOut, accIns[0], false), newRawSendTx(chainID, 1, true, accOut, accIns[1], false)},
+		{newRawSendTx(chainID, 2, true, accOut, accIns[1], false)},
+	}
+
+	// Apply and finalize the blocks. The state root recorded in the last block is corrupted.
+	parent := ledger.chain.Root()
+	for i, txs := range blocksTxs {
+		for _, tx := range txs {
+			require.Nil(mempool.InsertTransaction(tx))
+		}
+		stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+		require.True(res.IsOK(), res.Message)
+		require.Equal(len(txs), len(blockRawTxs))
+
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = parent.Height + 1
+		block.Parent = parent.Hash()
+		block.StateHash = stateRoot
+		block.Txs = blockRawTxs
+		res = ledger.ApplyBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+
+		if i == len(blocksTxs)-1 {
+			block.StateHash = common.BytesToHash([]byte("corrupted root"))
+			block.UpdateHash()
+		}
+		parent, err = ledger.chain.AddBlock(block)
+		require.Nil(err)
+		require.Nil(ledger.chain.FinalizePreviousBlocks(parent.Hash()))
+	}
+	tipHeight := parent.Height
+	liveHeight, liveRoot := ledger.state.Height(), ledger.state.Delivered().Hash()
+
+	// The blocks reproduce their recorded state roots
+	replayed := []uint64{}
+	divergence, err := ledger.ReplayBlocks(root.Height+1, tipHeight-1, func(height uint64) {
+		replayed = append(replayed, height)
+	})
+	require.Nil(err)
+	assert.Nil(divergence)
+	assert.Equal([]uint64{root.Height + 1, root.Height + 2, root.Height + 3}, replayed)
+
+	divergence, err = ledger.ReplayBlocks(root.Height+2, root.Height+2, nil)
+	require.Nil(err)
+	assert.Nil(divergence)
+
+	// The first divergence is reported
+	replayed = []uint64{}
+	divergence, err = ledger.ReplayBlocks(root.Height+2, tipHeight, func(height uint64) {
+		replayed = append(replayed, height)
+	})
+	require.Nil(err)
+	require.NotNil(divergence)
+	assert.Equal([]uint64{root.Height + 2, root.Height + 3}, replayed)
+	assert.Equal(tipHeight, divergence.Height)
+	assert.Equal(parent.Hash(), divergence.BlockHash)
+	assert.Equal(common.BytesToHash([]byte("corrupted root")), divergence.ExpectedStateRoot)
+	assert.Equal(liveRoot, divergence.StateRoot)
+	assert.Equal(result.CodeStateRootMismatch, divergence.Code)
+
+	// The live state is not disturbed
+	assert.Equal(liveHeight, ledger.state.Height())
+	assert.Equal(liveRoot, ledger.state.Delivered().Hash())
+
+	// Invalid ranges and missing blocks
+	_, err = ledger.ReplayBlocks(0, tipHeight, nil)
+	assert.NotNil(err)
+	_, err = ledger.ReplayBlocks(root.Height+2, root.Height+1, nil)
+	assert.NotNil(err)
+	_, err = ledger.ReplayBlocks(tipHeight+2, tipHeight+2, nil)
+	assert.EqualError(err, fmt.Sprintf("No finalized block found at height %v", tipHeight+1))
+
+	// The state to start with has been pruned
+	require.Nil(store.Put(state.StatePruningProgressKey(), root.Height+1))
+	_, err = ledger.ReplayBlocks(root.Height+2, tipHeight, nil)
+	assert.EqualError(err, fmt.Sprintf("The state at height %v has been pruned", root.Height+1))
+	_, err = ledger.ReplayBlocks(root.Height+3, tipHeight-1, nil)
+	assert.Nil(err)
+}
@@ -0,0 +1,413 @@
+package ledger
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/hexutil"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	exec "github.com/thetatoken/theta/ledger/execution"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/version"
+)
+
+const reproBundleIndexFile = "index.json"
+
+// the config keys captured in the repro bundles, i.e. those that could affect the block application
+var reproConfigPrefixes = []string{"genesis.", "consensus.", "storage.", "sync."}
+
+// ReproStateNode is a key-value pair of the state database
+type ReproStateNode struct {
+	Key   hexutil.Bytes `json:"key"`
+	Value hexutil.Bytes `json:"value"`
+}
+
+//
+// ReproBundle holds everything needed to reproduce a failed block application locally. Only the
+// state actually read while applying the block is included.
+//
+type ReproBundle struct {
+	CapturedAt time.Time         `json:"captured_at"`
+	Failure    string            `json:"failure"`
+	Version    string            `json:"version"`
+	GitHash    string            `json:"git_hash"`
+	Config     map[string]string `json:"config"`
+
+	ChainID         string           `json:"chain_id"`
+	Height          uint64           `json:"height"`
+	BlockHash       common.Hash      `json:"block_hash"`
+	Block           hexutil.Bytes    `json:"block"`         // RLP encoded
+	ParentHeader    hexutil.Bytes    `json:"parent_header"` // RLP encoded, empty if not available
+	ParentHeight    uint64           `json:"parent_height"`
+	ParentStateRoot common.Hash      `json:"parent_state_root"`
+	Validators      []core.Validator `json:"validators"` // the validator set the block is applied with
+	StateNodes      []ReproStateNode `json:"state_nodes"`
+}
+
+// ReproBundleIndexEntry describes a repro bundle in the index of the capture directory
+type ReproBundleIndexEntry struct {
+	File       string      `json:"file"`
+	CapturedAt time.Time   `json:"captured_at"`
+	ChainID    string      `json:"chain_id"`
+	Height     uint64      `json:"height"`
+	BlockHash  common.Hash `json:"block_hash"`
+	Failure    string      `json:"failure"`
+}
+
+// reproCapturer rate-limits the repro bundle captures
+type reproCapturer struct {
+	mu          *sync.Mutex
+	lastCapture time.Time
+}
+
+func newReproCapturer() *reproCapturer {
+	return &reproCapturer{
+		mu: &sync.Mutex{},
+	}
+}
+
+func (rc *reproCapturer) allow(now time.Time) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	minInterval := time.Duration(viper.GetInt(common.CfgReproCaptureMinInterval)) * time.Second
+	if !rc.lastCapture.IsZero() && now.Sub(rc.lastCapture) < minInterval {
+		return false
+	}
+	rc.lastCapture = now
+	return true
+}
+
+// captureReproBundle captures a repro bundle for the failure of applying the given block on top of the
+// state of the given height and root, if the capture is enabled and not rate-limited. The capture never
+// affects the block application, the errors are only logged.
+func (ledger *Ledger) captureReproBundle(block *core.Block, parentHeight uint64, parentStateRoot common.Hash, failure string) {
+	if !viper.GetBool(common.CfgReproCaptureEnabled) || !ledger.reproCapturer.allow(time.Now()) {
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("Failed to capture the repro bundle: %v", panicMessage(r))
+		}
+	}()
+
+	bundle, err := ledger.newReproBundle(block, parentHeight, parentStateRoot, failure)
+	if err != nil {
+		logger.Errorf("Failed to capture the repro bundle: %v", err)
+		return
+	}
+	path, err := writeReproBundle(getReproCaptureDir(), bundle)
+	if err != nil {
+		logger.Errorf("Failed to write the repro bundle: %v", err)
+		return
+	}
+
+	logger.WithFields(log.Fields{"height": block.Height, "block": block.Hash().Hex(), "path": path}).Warn("Captured repro bundle")
+}
+
+func (ledger *Ledger) newReproBundle(block *core.Block, parentHeight uint64, parentStateRoot common.Hash, failure string) (*ReproBundle, error) {
+	chainID := ledger.state.GetChainID()
+
+	// Re-execute the block against the parent state to trace the state it reads
+	tracingDB := backend.NewTracingDatabase(ledger.state.DB())
+	scratch, err := newScratchLedger(chainID, tracingDB, parentHeight, parentStateRoot, ledger.consensus, ledger.valMgr,
+		ledger.executor.RewardSchedule())
+	if err != nil {
+		return nil, err
+	}
+	scratch.currentBlock = block
+	if res := scratch.executeBlockTxs(block); res.Message != failure {
+		logger.Warnf("Re-executed block with a different result: %v", res.Message)
+	}
+
+	blockBytes, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return nil, err
+	}
+	var parentHeaderBytes []byte
+	if parent, err := ledger.chain.FindBlock(block.Parent); err == nil {
+		if parentHeaderBytes, err = rlp.EncodeToBytes(parent.BlockHeader); err != nil {
+			return nil, err
+		}
+	}
+
+	stateNodes := []ReproStateNode{}
+	for key, value := range tracingDB.ReadSet() {
+		stateNodes = append(stateNodes, ReproStateNode{Key: []byte(key), Value: value})
+	}
+	sort.Slice(stateNodes, func(i, j int) bool {
+		return string(stateNodes[i].Key) < string(stateNodes[j].Key)
+	})
+
+	return &ReproBundle{
+		CapturedAt:      time.Now(),
+		Failure:         failure,
+		Version:         version.Version,
+		GitHash:         version.GitHash,
+		Config:          getReproConfig(),
+		ChainID:         chainID,
+		Height:          block.Height,
+		BlockHash:       block.Hash(),
+		Block:           blockBytes,
+		ParentHeader:    parentHeaderBytes,
+		ParentHeight:    parentHeight,
+		ParentStateRoot: parentStateRoot,
+		Validators:      ledger.valMgr.GetNextValidatorSet(block.Parent).Validators(),
+		StateNodes:      stateNodes,
+	}, nil
+}
+
+func getReproCaptureDir() string {
+	dir := viper.GetString(common.CfgReproCaptureDir)
+	if dir == "" {
+		dir = filepath.Join(viper.GetString(common.CfgDataPath), "repro")
+	}
+	return dir
+}
+
+func getReproConfig() map[string]string {
+	config := make(map[string]string)
+	for _, key := range viper.AllKeys() {
+		for _, prefix := range reproConfigPrefixes {
+			if strings.HasPrefix(key, strings.ToLower(prefix)) {
+				config[key] = fmt.Sprintf("%v", viper.Get(key))
+				break
+			}
+		}
+	}
+	return config
+}
+
+// writeReproBundle writes the bundle into the given directory and adds it to the index
+func writeReproBundle(dir string, bundle *ReproBundle) (string, error) {
+	index, err := LoadReproBundleIndex(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(index) >= viper.GetInt(common.CfgReproCaptureMaxBundles) {
+		return "", fmt.Errorf("Too many repro bundles in %v", dir)
+	}
+
+	bundleBytes, err := json.Marshal(bundle)
+	if err != nil {
+		return "", err
+	}
+	if len(bundleBytes) > viper.GetInt(common.CfgReproCaptureMaxBundleSize) {
+		return "", fmt.Errorf("Repro bundle size %v exceeds the limit", len(bundleBytes))
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	fileName := fmt.Sprintf("repro_%v_%v_%v.json", bundle.Height, hex.EncodeToString(bundle.BlockHash[:4]), bundle.CapturedAt.UnixNano())
+	path := filepath.Join(dir, fileName)
+	if err := common.WriteFileAtomic(path, bundleBytes, 0600); err != nil {
+		return "", err
+	}
+
+	index = append(index, &ReproBundleIndexEntry{
+		File:       fileName,
+		CapturedAt: bundle.CapturedAt,
+		ChainID:    bundle.ChainID,
+		Height:     bundle.Height,
+		BlockHash:  bundle.BlockHash,
+		Failure:    bundle.Failure,
+	})
+	indexBytes, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := common.WriteFileAtomic(filepath.Join(dir, reproBundleIndexFile), indexBytes, 0600); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// LoadReproBundleIndex loads the index of the repro bundles in the given directory
+func LoadReproBundleIndex(dir string) ([]*ReproBundleIndexEntry, error) {
+	index := []*ReproBundleIndexEntry{}
+	indexBytes, err := ioutil.ReadFile(filepath.Join(dir, reproBundleIndexFile))
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(indexBytes, &index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// LoadReproBundle loads the repro bundle at the given path
+func LoadReproBundle(path string) (*ReproBundle, error) {
+	bundleBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &ReproBundle{}
+	if err := json.Unmarshal(bundleBytes, bundle); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// Replay reconstructs a scratch ledger from the bundle, and re-runs the block against it deterministically.
+// It returns the result of the block application, which is expected to reproduce the captured failure.
+func (bundle *ReproBundle) Replay() result.Result {
+	return bundle.ReplayWithRewardSchedule(exec.DefaultRewardSchedule)
+}
+
+// ReplayWithRewardSchedule is similar to Replay, for the bundles captured on chains with a custom reward schedule
+func (bundle *ReproBundle) ReplayWithRewardSchedule(rewardSchedule exec.RewardSchedule) result.Result {
+	block := &core.Block{}
+	if err := rlp.DecodeBytes(bundle.Block, block); err != nil {
+		return result.Error("Failed to decode the block: %v", err)
+	}
+
+	db := backend.NewMemDatabase()
+	for _, node := range bundle.StateNodes {
+		db.Put(node.Key, node.Value)
+	}
+
+	valSet := core.NewValidatorSet()
+	valSet.SetValidators(bundle.Validators)
+	consensus := &reproConsensusEngine{block: block}
+	scratch, err := newScratchLedger(bundle.ChainID, db, bundle.ParentHeight, bundle.ParentStateRoot,
+		consensus, &reproValidatorManager{valSet: valSet}, rewardSchedule)
+	if err != nil {
+		return result.Error("%v", err)
+	}
+	consensus.ledger = scratch
+	scratch.currentBlock = block
+
+	return scratch.executeBlockTxs(block)
+}
+
+// newScratchLedger creates a ledger that only executes transactions on top of the given state
+func newScratchLedger(chainID string, db database.Database, height uint64, stateRoot common.Hash,
+	consensus core.ConsensusEngine, valMgr core.ValidatorManager, rewardSchedule exec.RewardSchedule) (*Ledger, error) {
+	state := st.NewLedgerState(chainID, db)
+	if res := state.ResetState(height, stateRoot); res.IsError() {
+		return nil, errors.New(res.Message)
+	}
+	return &Ledger{
+		consensus: consensus,
+		valMgr:    valMgr,
+		mu:        &sync.RWMutex{},
+		state:     state,
+		executor:  exec.NewExecutorWithRewardSchedule(state, consensus, valMgr, rewardSchedule),
+	}, nil
+}
+
+// executeBlockTxs executes the transactions of the given block against the delivered state, and verifies
+// the resulting state root the same way as ApplyBlockTxs. Unlike ApplyBlockTxs, it neither commits the
+// state nor updates the mempool, so it is used to re-execute blocks on scratch ledgers.
+func (ledger *Ledger) executeBlockTxs(block *core.Block) (res result.Result) {
+	defer func() {
+		if r := recover(); r != nil {
+			res = result.Error("%v", panicFailure(r))
+		}
+	}()
+
+	view := ledger.state.Delivered()
+	txs := []types.Tx{}
+	for _, rawTx := range block.Txs {
+		tx, err := types.TxFromBytes(rawTx)
+		if err != nil {
+			return result.Error("Failed to parse transaction: %v", hex.EncodeToString(rawTx))
+		}
+		if _, res := ledger.executor.ExecuteTx(tx); res.IsError() {
+			return res
+		}
+		txs = append(txs, tx)
+	}
+
+	ledger.handleDelayedStateUpdates(view, countRegularTxs(txs))
+
+	if newStateRoot := view.Hash(); newStateRoot != block.StateHash {
+		return stateRootMismatchError(newStateRoot, block.StateHash)
+	}
+	return result.OK
+}
+
+func stateRootMismatchError(stateRoot, expectedStateRoot common.Hash) result.Result {
+	return result.Error("State root mismatch! root: %v, exptected: %v",
+		hex.EncodeToString(stateRoot[:]),
+		hex.EncodeToString(expectedStateRoot[:])).WithErrorCode(result.CodeStateRootMismatch)
+}
+
+// panicFailure describes a panic while applying a block
+func panicFailure(r interface{}) string {
+	return fmt.Sprintf("Panic while applying the block: %v", panicMessage(r))
+}
+
+func panicMessage(r interface{}) string {
+	if entry, ok := r.(*log.Entry); ok { // raised by log.Panicf()
+		return entry.Message
+	}
+	return fmt.Sprintf("%v", r)
+}
+
+// reproConsensusEngine provides the block being replayed or verified to the transaction executors of a scratch ledger
+type reproConsensusEngine struct {
+	block  *core.Block
+	ledger *Ledger
+}
+
+var _ core.ConsensusEngine = (*reproConsensusEngine)(nil)
+
+func (rce *reproConsensusEngine) ID() string                                 { return "" }
+func (rce *reproConsensusEngine) PrivateKey() *crypto.PrivateKey             { return nil }
+func (rce *reproConsensusEngine) GetTip(bool) *core.ExtendedBlock            { return nil }
+func (rce *reproConsensusEngine) GetEpoch() uint64                           { return rce.block.Epoch }
+func (rce *reproConsensusEngine) GetLedger() core.Ledger                     { return rce.ledger }
+func (rce *reproConsensusEngine) AddMessage(msg interface{})                 {}
+func (rce *reproConsensusEngine) FinalizedBlocks() chan *core.Block          { return nil }
+func (rce *reproConsensusEngine) GetLastFinalizedBlock() *core.ExtendedBlock { return nil }
+
+// reproValidatorManager provides the captured validator set to the transaction executors
+type reproValidatorManager struct {
+	valSet *core.ValidatorSet
+}
+
+var _ core.ValidatorManager = (*reproValidatorManager)(nil)
+
+func (rvm *reproValidatorManager) SetConsensusEngine(consensus core.ConsensusEngine) {}
+
+func (rvm *reproValidatorManager) GetProposer(blockHash common.Hash, epoch uint64) core.Validator {
+	return core.Validator{}
+}
+
+func (rvm *reproValidatorManager) GetNextProposer(blockHash common.Hash, epoch uint64) core.Validator {
+	return core.Validator{}
+}
+
+func (rvm *reproValidatorManager) GetValidatorSet(blockHash common.Hash) *core.ValidatorSet {
+	return rvm.valSet
+}
+
+func (rvm *reproValidatorManager) GetNextValidatorSet(blockHash common.Hash) *core.ValidatorSet {
+	return rvm.valSet
+}
@@ -0,0 +1,105 @@
+package ledger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+func TestLedgerReproBundleCapture(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "repro")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	viper.Set(common.CfgReproCaptureDir, dir)
+	viper.Set(common.CfgReproCaptureMinInterval, 0)
+	defer viper.Set(common.CfgReproCaptureDir, "")
+	defer viper.Set(common.CfgReproCaptureMinInterval, 600)
+
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 5)
+
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = ledger.state.Height() - 1
+	root.StateHash = ledger.state.Delivered().Hash()
+	ledger.chain = blockchain.NewChain(chainID, kvstore.NewKVStore(ledger.state.DB()), root)
+
+	require.Nil(mempool.InsertTransaction(newRawSendTx(chainID, 1, true, accOut, accIns[0], false)))
+	stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+
+	// Force a state root mismatch
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Height = root.Height + 1
+	block.Parent = root.Hash()
+	wrongStateRoot := stateRoot
+	wrongStateRoot[31]++
+	block.StateHash = wrongStateRoot
+	block.Txs = blockRawTxs
+
+	// The capture is off by default
+	res = ledger.ApplyBlockTxs(block)
+	require.True(res.IsError())
+	index, err := LoadReproBundleIndex(dir)
+	require.Nil(err)
+	assert.Equal(0, len(index))
+
+	viper.Set(common.CfgReproCaptureEnabled, true)
+	defer viper.Set(common.CfgReproCaptureEnabled, false)
+
+	res = ledger.ApplyBlockTxs(block)
+	require.True(res.IsError())
+	index, err = LoadReproBundleIndex(dir)
+	require.Nil(err)
+	require.Equal(1, len(index))
+	assert.Equal(block.Hash(), index[0].BlockHash)
+	assert.Equal(res.Message, index[0].Failure)
+
+	// The captures are rate-limited
+	viper.Set(common.CfgReproCaptureMinInterval, 600)
+	assert.True(ledger.ApplyBlockTxs(block).IsError())
+	index, err = LoadReproBundleIndex(dir)
+	require.Nil(err)
+	assert.Equal(1, len(index))
+
+	bundle, err := LoadReproBundle(filepath.Join(dir, index[0].File))
+	require.Nil(err)
+	assert.Equal(chainID, bundle.ChainID)
+	assert.Equal(block.Height, bundle.Height)
+	parentHeader := &core.BlockHeader{}
+	require.Nil(rlp.DecodeBytes(bundle.ParentHeader, parentHeader))
+	assert.Equal(root.Hash(), parentHeader.Hash())
+	assert.Equal(viper.GetString(common.CfgConsensusMaxEpochLength), bundle.Config["consensus.maxepochlength"])
+
+	// Only the touched state is included, i.e. not the accounts of the other senders
+	assert.True(len(bundle.StateNodes) > 0)
+	assert.True(len(bundle.StateNodes) < len(ledger.state.DB().(*backend.MemDatabase).Keys()))
+
+	// The bundle alone reproduces the identical failure
+	replayRes := bundle.Replay()
+	assert.True(replayRes.IsError())
+	assert.Equal(res.Message, replayRes.Message)
+
+	// The block with the correct state root passes the replay
+	block.StateHash = stateRoot
+	bundle.Block, err = rlp.EncodeToBytes(block)
+	require.Nil(err)
+	replayRes = bundle.Replay()
+	assert.True(replayRes.IsOK(), replayRes.Message)
+}
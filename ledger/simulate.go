@@ -0,0 +1,344 @@
+package ledger
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/ledger/vm"
+	"github.com/thetatoken/theta/ledger/vm/params"
+)
+
+// AccountDelta describes how a simulated transaction changes an account
+type AccountDelta struct {
+	Address common.Address
+	Before  *types.Account // nil if the account does not exist before the transaction
+	After   *types.Account // nil if the account does not exist after the transaction
+}
+
+// TxSimulationResult holds the outcome of a simulated transaction
+type TxSimulationResult struct {
+	Height   uint64           // Height of the committed state the transaction was simulated against
+	Receipt  *types.TxReceipt // Execution result, fee, gas used and logs of the transaction
+	VmReturn common.Bytes     // Return value of the smart contract call, if applicable
+	Accounts []*AccountDelta  // Changes of the accounts involved in the transaction
+
+	// The message of the standard Error(string) revert reason of a reverted smart contract call. The raw
+	// revert data, e.g. of a custom error, is in the receipt.
+	RevertReason string
+
+	// The validator candidate pool after the transaction, only set if the transaction changes it
+	ValidatorCandidatePool *core.ValidatorCandidatePool
+}
+
+// SimulateTx executes the given transaction against a throwaway copy of the latest committed
+// state, and reports what the transaction would do without broadcasting it. It never modifies the
+// Delivered() view or the mempool, and does not acquire the ledger lock, so simulations can run
+// while a block is being applied. The outcomes of the read-only contract calls are cached until
+// the next state is committed, see common.CfgLedgerCallCacheSize, and are then shared by the
+// callers, which must not modify them.
+func (ledger *Ledger) SimulateTx(rawTx common.Bytes) (*TxSimulationResult, result.Result) {
+	view := ledger.state.Committed()
+	if view == nil {
+		return nil, result.Error("Failed to load the committed state")
+	}
+
+	var stateRoot common.Hash
+	if ledger.callCache != nil {
+		stateRoot = view.Hash()
+		if simResult, res, ok := ledger.callCache.get(stateRoot, rawTx); ok {
+			return simResult, res
+		}
+	}
+
+	tx, err := types.TxFromBytes(rawTx)
+	if err != nil {
+		return nil, result.Error("Error decoding tx: %v", err)
+	}
+
+	contractTx, ok := tx.(*types.SmartContractTx)
+	if !ok || ledger.callCache == nil {
+		return ledger.simulateTxWithView(rawTx, tx, view)
+	}
+	recorder := state.NewAccessRecorder()
+	view.SetAccessRecorder(recorder)
+	simResult, res := ledger.simulateTxWithView(rawTx, tx, view)
+	if !res.IsInternalError() && isReadOnlyCall(contractTx, recorder.AccessList()) {
+		ledger.callCache.add(stateRoot, rawTx, simResult, res)
+	}
+	return simResult, res
+}
+
+// TxBundleSimulationResult holds the outcome of a simulated sequence of transactions
+type TxBundleSimulationResult struct {
+	Height    uint64                // Height of the committed state the bundle was simulated against
+	Results   []*TxSimulationResult // Outcome of each transaction, in order
+	GasUsed   uint64                // Cumulative gas of the successful transactions, see simulatedGasUsed
+	StateRoot common.Hash           // Root hash of the hypothetical state at the end of the bundle
+
+	// The scratch view at the end of the bundle, e.g. to query the balances and the stakes of any address. It
+	// is not backed by the ledger, and can be modified and discarded freely.
+	View *state.StoreView
+}
+
+// SimulateTxs executes the given transactions in order against a single throwaway copy of the latest committed
+// state, each transaction seeing the effects of the previous ones, e.g. a funding followed by the action relying
+// on it. Like SimulateTx, it never modifies the Delivered() view or the mempool, and does not acquire the ledger
+// lock. A failed transaction leaves the state untouched and the simulation carries on with the next ones, the
+// result is then the error of the first failed transaction.
+func (ledger *Ledger) SimulateTxs(rawTxs []common.Bytes) (*TxBundleSimulationResult, result.Result) {
+	if len(rawTxs) == 0 {
+		return nil, result.Error("No tx to simulate")
+	}
+	txs := make([]types.Tx, len(rawTxs))
+	for i, rawTx := range rawTxs {
+		tx, err := types.TxFromBytes(rawTx)
+		if err != nil {
+			return nil, result.Error("Error decoding tx #%v: %v", i, err)
+		}
+		txs[i] = tx
+	}
+
+	view := ledger.state.Committed()
+	if view == nil {
+		return nil, result.Error("Failed to load the committed state")
+	}
+
+	bundleResult := &TxBundleSimulationResult{
+		Height:  view.Height(),
+		Results: make([]*TxSimulationResult, 0, len(txs)),
+		View:    view,
+	}
+	bundleRes := result.OK
+	gasSchedule := view.GetIntrinsicGasSchedule()
+	for i, tx := range txs {
+		snapshot := view.Snapshot()
+		simResult, res := ledger.simulateTxWithView(rawTxs[i], tx, view)
+		bundleResult.Results = append(bundleResult.Results, simResult)
+		if res.IsInternalError() { // the view is unusable after a store error
+			return bundleResult, res
+		}
+		if res.IsError() {
+			view.RevertToSnapshot(snapshot)
+			if bundleRes.IsOK() {
+				bundleRes = res
+				bundleRes.Message = fmt.Sprintf("Tx #%v: %v", i, res.Message)
+			}
+			continue
+		}
+		bundleResult.GasUsed += simulatedGasUsed(tx, simResult.Receipt, gasSchedule)
+	}
+	bundleResult.StateRoot = view.Hash()
+
+	return bundleResult, bundleRes
+}
+
+// simulatedGasUsed returns the gas a simulated transaction takes up in the block gas budget, i.e. the gas metered
+// by the execution of a smart contract transaction, or the intrinsic gas of the others
+func simulatedGasUsed(tx types.Tx, receipt *types.TxReceipt, gasSchedule *types.IntrinsicGasSchedule) uint64 {
+	if _, ok := tx.(*types.SmartContractTx); ok {
+		return receipt.GasUsed
+	}
+	return gasSchedule.TxGas(tx)
+}
+
+// simulateTxWithView executes the given transaction against the given view, which it modifies, and reports
+// what the transaction does
+func (ledger *Ledger) simulateTxWithView(rawTx common.Bytes, tx types.Tx, view *state.StoreView) (*TxSimulationResult, result.Result) {
+	addresses := getTxAddresses(view.GetSplitRule, tx)
+	before := make([]*types.Account, len(addresses))
+	for i, address := range addresses {
+		before[i] = view.GetAccount(address)
+	}
+	vcpBytesBefore := view.Get(state.ValidatorCandidatePoolKey())
+
+	_, res := ledger.executor.SimulateTx(tx, view)
+
+	simResult := &TxSimulationResult{
+		Height:   view.Height(),
+		Receipt:  newTxReceipt(crypto.Keccak256Hash(rawTx), tx, res),
+		Accounts: []*AccountDelta{},
+	}
+	if vmRet, ok := res.Info["vmReturn"]; ok {
+		simResult.VmReturn = vmRet.(common.Bytes)
+	}
+	if reason, ok := vm.UnpackRevertReason(simResult.Receipt.RevertData); ok {
+		simResult.RevertReason = reason
+	}
+	if res.IsError() {
+		return simResult, res
+	}
+
+	for i, address := range addresses {
+		simResult.Accounts = append(simResult.Accounts, &AccountDelta{
+			Address: address,
+			Before:  before[i],
+			After:   view.GetAccount(address),
+		})
+	}
+
+	if !bytes.Equal(vcpBytesBefore, view.Get(state.ValidatorCandidatePoolKey())) {
+		simResult.ValidatorCandidatePool = view.GetValidatorCandidatePool()
+	}
+
+	return simResult, res
+}
+
+// screenContractTx simulates the given smart contract transaction against a copy of the screened state,
+// bounded by the gas limit of the transaction and by the time limit of the block proposals. If the execution
+// reverts, the transaction is rejected with the revert reason, so that the wallets can show it before
+// broadcasting the transaction. The other outcomes are left to the screening itself. The contract deployments
+// bound to fail whatever the state are rejected before the simulation, see screenContractDeployment.
+func (ledger *Ledger) screenContractTx(tx types.Tx) result.Result {
+	contractTx, ok := tx.(*types.SmartContractTx)
+	if !ok {
+		return result.OK
+	}
+
+	ledger.mu.RLock()
+	view, err := ledger.state.Screened().Copy()
+	ledger.mu.RUnlock()
+	if err != nil {
+		return result.Error("Failed to checkout the screened state: %v", err)
+	}
+
+	if res := screenContractDeployment(contractTx, ledger.executor.ChainConfig(), view.Height()); res.IsError() {
+		return res
+	}
+
+	timeLimit := time.Duration(viper.GetInt(common.CfgLedgerMaxProposalTxExecutionTime)) * time.Millisecond
+	_, res := ledger.executor.SimulateTxWithTimeLimit(tx, view, timeLimit)
+	revertData, ok := res.Info["revertData"]
+	if !ok {
+		return result.OK
+	}
+	return executionRevertedError(revertData.(common.Bytes))
+}
+
+// screenContractDeployment rejects the contract deployment if its execution is bound to fail whatever the state,
+// i.e. if its gas limit does not cover the intrinsic gas, or if its init code fails unconditionally in the sandbox
+// run, see vm.ScreenDeployment. The deployments are only rejected if the actual execution fails as well.
+func screenContractDeployment(tx *types.SmartContractTx, chainConfig *vm.ChainConfig, height uint64) result.Result {
+	if (tx.To.Address != common.Address{}) {
+		return result.OK
+	}
+
+	gasCap := viper.GetUint64(common.CfgLedgerDeploymentScreeningGasCap)
+	revertData, err := vm.ScreenDeployment(tx, chainConfig, height, gasCap)
+	switch err {
+	case nil:
+		return result.OK
+	case vm.ErrIntrinsicGasNotCovered:
+		return result.Error("Gas limit %v does not cover the intrinsic gas of the deployment", tx.GasLimit).
+			WithErrorCode(result.CodeIntrinsicGasNotCovered)
+	case vm.ErrMaxCodeSizeExceeded:
+		return result.Error("The deployed code would exceed the max code size of %v bytes", params.MaxCodeSize).
+			WithErrorCode(result.CodeContractCodeTooLarge)
+	case vm.ErrExecutionReverted:
+		res := executionRevertedError(revertData)
+		res.Message = "Init code reverted" + strings.TrimPrefix(res.Message, "Execution reverted")
+		return res.WithErrorCode(result.CodeInitCodeReverted)
+	default:
+		return result.Error("Init code fails unconditionally: %v", err).WithErrorCode(result.CodeInvalidInitCode)
+	}
+}
+
+// executionRevertedError describes a reverted execution with its revert reason, or with its raw revert data
+// if it is not a standard Error(string)
+func executionRevertedError(revertData common.Bytes) result.Result {
+	var res result.Result
+	if reason, ok := vm.UnpackRevertReason(revertData); ok {
+		res = result.Error("Execution reverted: %v", reason)
+	} else if len(revertData) > 0 {
+		res = result.Error("Execution reverted with data 0x%x", []byte(revertData))
+	} else {
+		res = result.Error("Execution reverted")
+	}
+	res = res.WithErrorCode(result.CodeExecutionReverted)
+	res.Info = result.Info{"revertData": revertData}
+	return res
+}
+
+// getTxAddresses returns the distinct addresses of the accounts the given transaction could touch
+func getTxAddresses(getSplitRule func(resourceID string) *types.SplitRule, tx types.Tx) []common.Address {
+	addresses := []common.Address{}
+	switch tx := tx.(type) {
+	case *types.CoinbaseTx:
+		addresses = append(addresses, tx.Proposer.Address)
+		for _, output := range tx.Outputs {
+			addresses = append(addresses, output.Address)
+		}
+	case *types.SlashTx:
+		addresses = append(addresses, tx.Proposer.Address, tx.SlashedAddress)
+	case *types.SendTx:
+		for _, input := range tx.PayingInputs() {
+			addresses = append(addresses, input.Address)
+		}
+		for _, output := range tx.Outputs {
+			addresses = append(addresses, output.Address)
+		}
+	case *types.ReserveFundTx:
+		addresses = append(addresses, tx.Source.Address)
+	case *types.ReleaseFundTx:
+		addresses = append(addresses, tx.Source.Address)
+	case *types.ServicePaymentTx:
+		addresses = append(addresses, tx.Source.Address, tx.Target.Address)
+		if splitRule := getSplitRule(tx.ResourceID); splitRule != nil {
+			for _, split := range splitRule.Splits {
+				addresses = append(addresses, split.Address)
+			}
+		}
+	case *types.SplitRuleTx:
+		addresses = append(addresses, tx.Initiator.Address)
+	case *types.SmartContractTx:
+		addresses = append(addresses, tx.From.Address, tx.To.Address)
+	case *types.DepositStakeTx:
+		addresses = append(addresses, tx.Source.Address, tx.Holder.Address)
+	case *types.WithdrawStakeTx:
+		addresses = append(addresses, tx.Source.Address, tx.Holder.Address)
+	case *types.PartialReleaseFundTx:
+		addresses = append(addresses, tx.Source.Address, tx.Target.Address)
+	case *types.ExtendSplitRuleTx:
+		addresses = append(addresses, tx.Initiator.Address)
+	case *types.SweepAccountTx:
+		addresses = append(addresses, tx.Source.Address, tx.Target)
+	case *types.BurnTx:
+		addresses = append(addresses, tx.Source.Address)
+	case *types.DoubleSignSlashTx:
+		addresses = append(addresses, tx.Reporter.Address)
+	case *types.StakeCommissionTx:
+		addresses = append(addresses, tx.Holder.Address)
+	case *types.CancelWithdrawTx:
+		addresses = append(addresses, tx.Source.Address)
+	case *types.UpdateValidatorMetadataTx:
+		addresses = append(addresses, tx.Holder.Address)
+	case *types.UnjailTx:
+		addresses = append(addresses, tx.Holder.Address)
+	case *types.EjectStakeTx:
+		addresses = append(addresses, tx.Holder.Address, tx.Source.Address)
+	case *types.UpdateValidatorKeyTx:
+		addresses = append(addresses, tx.Holder.Address, tx.NewHolder.Address)
+	case types.CustomTx:
+		addresses = append(addresses, tx.GetInput().Address)
+	}
+
+	distinct := []common.Address{}
+	seen := make(map[common.Address]bool)
+	for _, address := range addresses {
+		if seen[address] {
+			continue
+		}
+		seen[address] = true
+		distinct = append(distinct, address)
+	}
+	return distinct
+}
@@ -0,0 +1,323 @@
+package ledger
+
+import (
+	"bufio"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto/sha3"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+const stakeSnapshotVersion = uint64(1)
+
+const stakeSnapshotColumns = "source,holder,purpose,amount,withdrawn,return_height"
+
+// StakeSnapshotHeader describes the state a stake snapshot file is derived from, and commits to its records
+type StakeSnapshotHeader struct {
+	Version    uint64
+	ChainID    string
+	Height     uint64
+	BlockHash  common.Hash // the finalized block the state belongs to
+	StateRoot  common.Hash
+	NumRecords uint64
+	Commitment common.Hash // see stakeSnapshotCommitment
+}
+
+//
+// A stake snapshot file is a CSV file, for the off-chain tools to consume as is. It starts with a comment line
+// describing the state, followed by the column names, then one line per stake ordered by source, holder and
+// purpose, and ends with a comment line carrying the number of stakes and the commitment over the file:
+//
+//   # version=1,chain_id=...,height=...,block_hash=0x...,state_root=0x...
+//   source,holder,purpose,amount,withdrawn,return_height
+//   0x...,0x...,validator,2000000000000000000000000,false,0
+//   # records=1,commitment=0x...
+//
+// The commitment is the Keccak256 hash of all the lines above the last one, including their line breaks, so it
+// binds the stakes to the state root they are derived from.
+//
+
+// stakeSnapshotCommitment computes the commitment over the lines of a stake snapshot as they are written
+type stakeSnapshotCommitment struct {
+	hasher     hash.Hash
+	numRecords uint64
+}
+
+func newStakeSnapshotCommitment() *stakeSnapshotCommitment {
+	return &stakeSnapshotCommitment{hasher: sha3.NewKeccak256()}
+}
+
+func (c *stakeSnapshotCommitment) add(line string) {
+	c.hasher.Write([]byte(line))
+	c.hasher.Write([]byte{'\n'})
+}
+
+func (c *stakeSnapshotCommitment) sum() common.Hash {
+	return common.BytesToHash(c.hasher.Sum(nil))
+}
+
+// ExportStakeSnapshot writes all the validator and guardian stakes as of the finalized block at the given height
+// to the file. The stakes are streamed from the state trie to the file, and the commitment over the file is
+// returned in the header. It refuses to export the heights whose states might have been pruned.
+func (ledger *Ledger) ExportStakeSnapshot(height uint64, filePath string) (*StakeSnapshotHeader, error) {
+	block := ledger.findFinalizedBlock(height)
+	if block == nil {
+		return nil, fmt.Errorf("No finalized block found at height %v", height)
+	}
+
+	db := ledger.state.DB()
+	var prunedHeight uint64
+	err := kvstore.NewKVStore(db).Get(state.StatePruningProgressKey(), &prunedHeight)
+	if err == nil && height <= prunedHeight {
+		return nil, fmt.Errorf("Can't export height %v, the states are pruned up to height %v", height, prunedHeight)
+	}
+	sv := state.NewStoreView(height, block.StateHash, db)
+	if sv == nil {
+		return nil, fmt.Errorf("Failed to load the state of height %v", height)
+	}
+
+	header := &StakeSnapshotHeader{
+		Version:   stakeSnapshotVersion,
+		ChainID:   ledger.state.GetChainID(),
+		Height:    height,
+		BlockHash: block.Hash(),
+		StateRoot: block.StateHash,
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	commitment := newStakeSnapshotCommitment()
+	writeLine := func(line string) error {
+		commitment.add(line)
+		_, err := writer.WriteString(line + "\n")
+		return err
+	}
+
+	if err := writeLine(formatStakeSnapshotHeader(header)); err != nil {
+		return nil, err
+	}
+	if err := writeLine(stakeSnapshotColumns); err != nil {
+		return nil, err
+	}
+	sv.TraverseStakes(func(record *state.StakeRecord) bool {
+		err = writeLine(formatStakeSnapshotRecord(record))
+		commitment.numRecords++
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	header.NumRecords = commitment.numRecords
+	header.Commitment = commitment.sum()
+	if _, err := writer.WriteString(formatStakeSnapshotTrailer(header) + "\n"); err != nil {
+		return nil, err
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+	if err := file.Sync(); err != nil {
+		return nil, err
+	}
+
+	logger.WithFields(log.Fields{"height": height, "stateRoot": header.StateRoot.Hex(), "records": header.NumRecords}).Info("Exported the stake snapshot")
+	return header, nil
+}
+
+// VerifyStakeSnapshot checks a stake snapshot written by ExportStakeSnapshot: the commitment recomputed over the
+// file must match the one it carries, and the one recomputed over the stakes in the state at its state root.
+func (ledger *Ledger) VerifyStakeSnapshot(reader io.Reader) (*StakeSnapshotHeader, error) {
+	header, err := ReadStakeSnapshot(reader, nil)
+	if err != nil {
+		return nil, err
+	}
+	if header.ChainID != ledger.state.GetChainID() {
+		return nil, fmt.Errorf("Stake snapshot chain ID mismatch, expected: %v, snapshot: %v", ledger.state.GetChainID(), header.ChainID)
+	}
+
+	sv := state.NewStoreView(header.Height, header.StateRoot, ledger.state.DB())
+	if sv == nil {
+		return nil, fmt.Errorf("State root %v of height %v not found", header.StateRoot.Hex(), header.Height)
+	}
+	commitment := newStakeSnapshotCommitment()
+	commitment.add(formatStakeSnapshotHeader(header))
+	commitment.add(stakeSnapshotColumns)
+	sv.TraverseStakes(func(record *state.StakeRecord) bool {
+		commitment.add(formatStakeSnapshotRecord(record))
+		commitment.numRecords++
+		return true
+	})
+	if commitment.numRecords != header.NumRecords || commitment.sum() != header.Commitment {
+		return nil, fmt.Errorf("Stake snapshot does not match the stakes at state root %v, %v records in the state, %v in the snapshot",
+			header.StateRoot.Hex(), commitment.numRecords, header.NumRecords)
+	}
+
+	return header, nil
+}
+
+// ReadStakeSnapshot reads a stake snapshot, calling the callback on each stake if not nil, and checks the
+// commitment recomputed over the file against the one it carries. It does not need the state, so the off-chain
+// tools can check the integrity of a file on their own.
+func ReadStakeSnapshot(reader io.Reader, cb func(record *state.StakeRecord) error) (*StakeSnapshotHeader, error) {
+	scanner := bufio.NewScanner(reader)
+	commitment := newStakeSnapshotCommitment()
+
+	var header *StakeSnapshotHeader
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		switch {
+		case lineNum == 1:
+			h, err := parseStakeSnapshotHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			header = h
+		case lineNum == 2:
+			if line != stakeSnapshotColumns {
+				return nil, fmt.Errorf("Unexpected stake snapshot columns: %v", line)
+			}
+		case strings.HasPrefix(line, "#"):
+			if err := parseStakeSnapshotTrailer(line, header); err != nil {
+				return nil, err
+			}
+			if scanner.Scan() {
+				return nil, fmt.Errorf("Unexpected line %v after the stake snapshot trailer", lineNum+1)
+			}
+			if commitment.numRecords != header.NumRecords {
+				return nil, fmt.Errorf("Stake snapshot record count mismatch, expected: %v, read: %v", header.NumRecords, commitment.numRecords)
+			}
+			if computed := commitment.sum(); computed != header.Commitment {
+				return nil, fmt.Errorf("Stake snapshot commitment mismatch, expected: %v, computed: %v", header.Commitment.Hex(), computed.Hex())
+			}
+			return header, nil
+		default:
+			record, err := parseStakeSnapshotRecord(line)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid stake snapshot record at line %v: %v", lineNum, err)
+			}
+			if cb != nil {
+				if err := cb(record); err != nil {
+					return nil, err
+				}
+			}
+			commitment.numRecords++
+		}
+		commitment.add(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("Incomplete stake snapshot, %v records read", commitment.numRecords)
+}
+
+func formatStakeSnapshotHeader(header *StakeSnapshotHeader) string {
+	return fmt.Sprintf("# version=%v,chain_id=%v,height=%v,block_hash=%v,state_root=%v",
+		header.Version, header.ChainID, header.Height, header.BlockHash.Hex(), header.StateRoot.Hex())
+}
+
+func formatStakeSnapshotTrailer(header *StakeSnapshotHeader) string {
+	return fmt.Sprintf("# records=%v,commitment=%v", header.NumRecords, header.Commitment.Hex())
+}
+
+func formatStakeSnapshotRecord(record *state.StakeRecord) string {
+	return fmt.Sprintf("%v,%v,%v,%v,%v,%v", record.Source.Hex(), record.Holder.Hex(), core.StakePurposeName(record.Purpose),
+		record.Amount, record.Withdrawn, record.ReturnHeight)
+}
+
+// parseStakeSnapshotFields parses a comment line of comma separated key=value fields
+func parseStakeSnapshotFields(line string) (map[string]string, error) {
+	if !strings.HasPrefix(line, "# ") {
+		return nil, fmt.Errorf("Invalid stake snapshot comment line: %v", line)
+	}
+	fields := make(map[string]string)
+	for _, field := range strings.Split(strings.TrimPrefix(line, "# "), ",") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid stake snapshot field: %v", field)
+		}
+		fields[kv[0]] = kv[1]
+	}
+	return fields, nil
+}
+
+func parseStakeSnapshotHeader(line string) (*StakeSnapshotHeader, error) {
+	fields, err := parseStakeSnapshotFields(line)
+	if err != nil {
+		return nil, err
+	}
+	version, err := strconv.ParseUint(fields["version"], 10, 64)
+	if err != nil || version != stakeSnapshotVersion {
+		return nil, fmt.Errorf("Unsupported stake snapshot version %v", fields["version"])
+	}
+	height, err := strconv.ParseUint(fields["height"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid stake snapshot height %v", fields["height"])
+	}
+	return &StakeSnapshotHeader{
+		Version:   version,
+		ChainID:   fields["chain_id"],
+		Height:    height,
+		BlockHash: common.HexToHash(fields["block_hash"]),
+		StateRoot: common.HexToHash(fields["state_root"]),
+	}, nil
+}
+
+func parseStakeSnapshotTrailer(line string, header *StakeSnapshotHeader) error {
+	fields, err := parseStakeSnapshotFields(line)
+	if err != nil {
+		return err
+	}
+	numRecords, err := strconv.ParseUint(fields["records"], 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid stake snapshot record count %v", fields["records"])
+	}
+	header.NumRecords = numRecords
+	header.Commitment = common.HexToHash(fields["commitment"])
+	return nil
+}
+
+func parseStakeSnapshotRecord(line string) (*state.StakeRecord, error) {
+	fields := strings.Split(line, ",")
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("expected 6 fields, got %v", len(fields))
+	}
+	purpose, err := core.ParseStakePurpose(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	amount, ok := new(big.Int).SetString(fields[3], 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %v", fields[3])
+	}
+	withdrawn, err := strconv.ParseBool(fields[4])
+	if err != nil {
+		return nil, err
+	}
+	returnHeight, err := strconv.ParseUint(fields[5], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &state.StakeRecord{
+		Source:       common.HexToAddress(fields[0]),
+		Holder:       common.HexToAddress(fields[1]),
+		Purpose:      purpose,
+		Amount:       amount,
+		Withdrawn:    withdrawn,
+		ReturnHeight: returnHeight,
+	}, nil
+}
@@ -0,0 +1,129 @@
+package ledger
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+func TestLedgerExportStakeSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, _ := newTestLedger()
+
+	minStake := core.MinValidatorStakeDeposit
+	holders := []common.Address{common.HexToAddress("0xa2"), common.HexToAddress("0xa1")}
+	vcp := &core.ValidatorCandidatePool{}
+	for i := 20; i > 0; i-- {
+		source := common.BigToAddress(big.NewInt(int64(i)))
+		require.Nil(vcp.DepositStake(source, holders[i%2], new(big.Int).Mul(minStake, big.NewInt(int64(i)))))
+	}
+	require.Nil(vcp.WithdrawStake(common.BigToAddress(big.NewInt(3)), holders[1], 100))
+
+	dir, err := ioutil.TempDir("", "stake_snapshot")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// exportAt exports the stakes in the pool as of the given height, with or without the stake index
+	exportAt := func(height uint64, filePath string) *StakeSnapshotHeader {
+		require.True(ledger.state.ResetState(height-1, common.Hash{}).IsOK())
+		ledger.state.Delivered().UpdateValidatorCandidatePool(vcp)
+		stateRoot := ledger.state.Commit()
+
+		root := core.NewBlock()
+		root.ChainID = chainID
+		root.Height = height
+		root.StateHash = stateRoot
+		ledger.chain = blockchain.NewChain(chainID, kvstore.NewKVStore(ledger.state.DB()), root)
+
+		_, err := ledger.ExportStakeSnapshot(height+1, filePath)
+		assert.NotNil(err)
+
+		header, err := ledger.ExportStakeSnapshot(height, filePath)
+		require.Nil(err)
+		assert.Equal(chainID, header.ChainID)
+		assert.Equal(height, header.Height)
+		assert.Equal(stateRoot, header.StateRoot)
+		assert.Equal(root.Hash(), header.BlockHash)
+		assert.Equal(uint64(20), header.NumRecords)
+		return header
+	}
+
+	scannedPath := filepath.Join(dir, "scanned.csv")
+	exportAt(10, scannedPath)
+	indexedPath := filepath.Join(dir, "indexed.csv")
+	header := exportAt(common.HeightEnableStakeIndex, indexedPath)
+	require.NotNil(ledger.state.Delivered().Get(state.StakeIndexKey()))
+
+	// The same stakes are listed whether they are read off the index or the pool
+	scanned, err := ioutil.ReadFile(scannedPath)
+	require.Nil(err)
+	indexed, err := ioutil.ReadFile(indexedPath)
+	require.Nil(err)
+	scannedLines := strings.Split(string(scanned), "\n")
+	indexedLines := strings.Split(string(indexed), "\n")
+	require.Equal(len(scannedLines), len(indexedLines))
+	assert.Equal(scannedLines[1:len(scannedLines)-2], indexedLines[1:len(indexedLines)-2])
+
+	// The records are sorted, and complete
+	records := []*state.StakeRecord{}
+	readHeader, err := ReadStakeSnapshot(bytes.NewReader(indexed), func(record *state.StakeRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	require.Nil(err)
+	assert.Equal(header, readHeader)
+	require.Equal(20, len(records))
+	for i, record := range records {
+		assert.Equal(common.BigToAddress(big.NewInt(int64(i+1))), record.Source)
+		assert.Equal(holders[(i+1)%2], record.Holder)
+		assert.Equal(core.StakeForValidator, record.Purpose)
+		assert.Equal(new(big.Int).Mul(minStake, big.NewInt(int64(i+1))), record.Amount)
+		assert.Equal(i+1 == 3, record.Withdrawn)
+	}
+	assert.Equal(100+core.ReturnLockingPeriod, records[2].ReturnHeight)
+	assert.Equal(records[2].Source.Hex()+","+records[2].Holder.Hex()+",validator,6000000000000000000000000,true,"+
+		strconv.FormatUint(records[2].ReturnHeight, 10), indexedLines[4])
+
+	verified, err := ledger.VerifyStakeSnapshot(bytes.NewReader(indexed))
+	require.Nil(err)
+	assert.Equal(header, verified)
+
+	// A tampered record breaks the commitment
+	tampered := []byte(strings.Replace(string(indexed), ",6000000000000000000000000,", ",7000000000000000000000000,", 1))
+	_, err = ReadStakeSnapshot(bytes.NewReader(tampered), nil)
+	assert.NotNil(err)
+
+	// Even with the commitment recomputed, the tampered records don't match the state
+	lines := strings.Split(string(tampered), "\n")
+	commitment := newStakeSnapshotCommitment()
+	for _, line := range lines[:len(lines)-2] {
+		commitment.add(line)
+	}
+	forged := *header
+	forged.Commitment = commitment.sum()
+	lines[len(lines)-2] = formatStakeSnapshotTrailer(&forged)
+	tampered = []byte(strings.Join(lines, "\n"))
+	_, err = ReadStakeSnapshot(bytes.NewReader(tampered), nil)
+	require.Nil(err)
+	_, err = ledger.VerifyStakeSnapshot(bytes.NewReader(tampered))
+	assert.NotNil(err)
+
+	// A truncated snapshot is incomplete
+	_, err = ReadStakeSnapshot(bytes.NewReader(indexed[:len(indexed)/2]), nil)
+	assert.NotNil(err)
+}
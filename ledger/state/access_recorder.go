@@ -0,0 +1,44 @@
+package state
+
+import (
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+// AccessRecorder records the state keys read and written through the StoreView it is attached to.
+type AccessRecorder struct {
+	reads     map[string]bool
+	writes    map[string]bool
+	traversed map[string]bool
+}
+
+// NewAccessRecorder creates an empty AccessRecorder
+func NewAccessRecorder() *AccessRecorder {
+	r := &AccessRecorder{}
+	r.Reset()
+	return r
+}
+
+// Reset clears the keys recorded so far, e.g. before executing the next tx
+func (r *AccessRecorder) Reset() {
+	r.reads = make(map[string]bool)
+	r.writes = make(map[string]bool)
+	r.traversed = make(map[string]bool)
+}
+
+// AccessList returns the keys recorded so far
+func (r *AccessRecorder) AccessList() *types.StateAccessList {
+	return types.NewStateAccessList(r.reads, r.writes, r.traversed)
+}
+
+func (r *AccessRecorder) recordRead(key common.Bytes) {
+	r.reads[string(key)] = true
+}
+
+func (r *AccessRecorder) recordWrite(key common.Bytes) {
+	r.writes[string(key)] = true
+}
+
+func (r *AccessRecorder) recordTraversal(prefix common.Bytes) {
+	r.traversed[string(prefix)] = true
+}
@@ -0,0 +1,181 @@
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+//
+// BalanceJournal records the changes of the coins held by each address, as the accounts and the
+// validator candidate pool are written through the StoreView it is attached to.
+//
+type BalanceJournal struct {
+	txHash   common.Hash
+	changes  []*types.BalanceChange
+	issuance types.Coins
+}
+
+// NewBalanceJournal creates an empty BalanceJournal
+func NewBalanceJournal() *BalanceJournal {
+	return &BalanceJournal{
+		changes:  []*types.BalanceChange{},
+		issuance: types.NewCoins(0, 0),
+	}
+}
+
+// SetTxHash sets the hash of the tx causing the subsequent changes
+func (j *BalanceJournal) SetTxHash(txHash common.Hash) {
+	j.txHash = txHash
+}
+
+// RecordBurnedFee records the fee charged by the current tx
+func (j *BalanceJournal) RecordBurnedFee(fee types.Coins) {
+	j.record(common.Address{}, types.HoldingBurnedFee, types.NewCoins(0, 0), fee)
+}
+
+// RecordProposerFees records the change of the tx fees set aside for the next block proposer by the current tx
+func (j *BalanceJournal) RecordProposerFees(before, after types.Coins) {
+	j.record(common.Address{}, types.HoldingProposerFee, before, after)
+}
+
+// RecordBurn records the coins destroyed by the current tx
+func (j *BalanceJournal) RecordBurn(coins types.Coins) {
+	j.record(common.Address{}, types.HoldingBurned, types.NewCoins(0, 0), coins)
+}
+
+// RecordIssuance records the coins minted by the current tx
+func (j *BalanceJournal) RecordIssuance(coins types.Coins) {
+	j.issuance = j.issuance.Plus(coins.NoNil())
+}
+
+// Changes returns the changes recorded so far
+func (j *BalanceJournal) Changes() []*types.BalanceChange {
+	return j.changes
+}
+
+// Issuance returns the coins minted so far
+func (j *BalanceJournal) Issuance() types.Coins {
+	return j.issuance
+}
+
+func (j *BalanceJournal) recordAccount(address common.Address, before, after *types.Account) {
+	j.record(address, types.HoldingBalance, accountBalance(before), accountBalance(after))
+	j.record(address, types.HoldingReservedFund, accountReservedFund(before), accountReservedFund(after))
+}
+
+func (j *BalanceJournal) recordValidatorCandidatePool(before, after *core.ValidatorCandidatePool) {
+	var candidatesBefore, candidatesAfter []*core.StakeHolder
+	if before != nil {
+		candidatesBefore = before.SortedCandidates
+	}
+	if after != nil {
+		candidatesAfter = after.SortedCandidates
+	}
+	j.recordStakes(stakesBySource(candidatesBefore), stakesBySource(candidatesAfter))
+}
+
+// recordGuardianCandidatePool records the changes of the guardian stakes, which are held as stakes as well
+func (j *BalanceJournal) recordGuardianCandidatePool(before, after *core.GuardianCandidatePool) {
+	var guardiansBefore, guardiansAfter []*core.StakeHolder
+	if before != nil {
+		guardiansBefore = before.SortedGuardians
+	}
+	if after != nil {
+		guardiansAfter = after.SortedGuardians
+	}
+	j.recordStakes(stakesBySource(guardiansBefore), stakesBySource(guardiansAfter))
+}
+
+func (j *BalanceJournal) recordStakes(stakesBefore, stakesAfter map[common.Address]*big.Int) {
+	sources := []common.Address{}
+	for source := range stakesAfter {
+		sources = append(sources, source)
+	}
+	for source := range stakesBefore {
+		if _, ok := stakesAfter[source]; !ok {
+			sources = append(sources, source)
+		}
+	}
+	sortAddresses(sources)
+	for _, source := range sources {
+		j.record(source, types.HoldingStake, stakeCoins(stakesBefore[source]), stakeCoins(stakesAfter[source]))
+	}
+}
+
+func (j *BalanceJournal) record(address common.Address, holding string, before, after types.Coins) {
+	before, after = before.NoNil(), after.NoNil()
+	assets := []struct {
+		denom         string
+		before, after *big.Int
+	}{
+		{types.DenomThetaWei, before.ThetaWei, after.ThetaWei},
+		{types.DenomTFuelWei, before.TFuelWei, after.TFuelWei},
+	}
+	for _, asset := range assets {
+		delta := new(big.Int).Sub(asset.after, asset.before)
+		if delta.Sign() == 0 {
+			continue
+		}
+		j.changes = append(j.changes, &types.BalanceChange{
+			Address: address,
+			Asset:   asset.denom,
+			Holding: holding,
+			Delta:   delta,
+			TxHash:  j.txHash,
+		})
+	}
+}
+
+func accountBalance(account *types.Account) types.Coins {
+	if account == nil {
+		return types.NewCoins(0, 0)
+	}
+	return account.Balance
+}
+
+// accountReservedFund returns the coins to be returned to the account when the reserved funds are released
+func accountReservedFund(account *types.Account) types.Coins {
+	total := types.NewCoins(0, 0)
+	if account == nil {
+		return total
+	}
+	for _, reservedFund := range account.ReservedFunds {
+		remainingFund := reservedFund.InitialFund.Minus(reservedFund.UsedFund)
+		if !remainingFund.IsNonnegative() {
+			remainingFund = types.NewCoins(0, 0)
+		}
+		total = total.Plus(remainingFund).Plus(reservedFund.Collateral)
+	}
+	return total
+}
+
+func stakesBySource(stakeHolders []*core.StakeHolder) map[common.Address]*big.Int {
+	stakes := make(map[common.Address]*big.Int)
+	for _, candidate := range stakeHolders {
+		for _, stake := range candidate.Stakes {
+			if _, ok := stakes[stake.Source]; !ok {
+				stakes[stake.Source] = new(big.Int)
+			}
+			stakes[stake.Source].Add(stakes[stake.Source], stake.Amount)
+		}
+	}
+	return stakes
+}
+
+func stakeCoins(amount *big.Int) types.Coins {
+	if amount == nil {
+		return types.NewCoins(0, 0)
+	}
+	return types.Coins{ThetaWei: new(big.Int).Set(amount), TFuelWei: new(big.Int)}
+}
+
+func sortAddresses(addresses []common.Address) {
+	sort.Slice(addresses, func(i, k int) bool {
+		return bytes.Compare(addresses[i][:], addresses[k][:]) < 0
+	})
+}
@@ -0,0 +1,84 @@
+package state
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+//
+// ------------------------- Deposit Nonces -------------------------
+//
+
+// depositNonce identifies an idempotency nonce used by a source
+type depositNonce struct {
+	Source common.Address
+	Nonce  uint64
+}
+
+// depositNonceExpiryBucket is the value stored under a DepositNonceExpiryKey, i.e. the nonces leaving the
+// recent-nonce sets at the height, in the order they are recorded
+type depositNonceExpiryBucket struct {
+	Nonces []depositNonce
+}
+
+// RecordDepositNonce adds the idempotency nonce to the recent-nonce set of the source at the height. The nonce
+// leaves the set with PruneDepositNonces at the expiry height.
+func (sv *StoreView) RecordDepositNonce(source common.Address, nonce uint64, height uint64, expiryHeight uint64) {
+	sv.Set(DepositNonceKey(source, nonce), encodeDepositNonceHeight(height))
+
+	bucket := sv.getDepositNonceExpiryBucket(expiryHeight)
+	bucket.Nonces = append(bucket.Nonces, depositNonce{Source: source, Nonce: nonce})
+	data, err := types.ToBytes(bucket)
+	if err != nil {
+		log.Panicf("Error writing the deposit nonce expiry bucket %v, error: %v", bucket, err.Error())
+	}
+	sv.Set(DepositNonceExpiryKey(expiryHeight), data)
+}
+
+// GetDepositNonceHeight returns the height the source used the idempotency nonce at, and whether the nonce is in
+// the recent-nonce set of the source
+func (sv *StoreView) GetDepositNonceHeight(source common.Address, nonce uint64) (uint64, bool) {
+	data := sv.Get(DepositNonceKey(source, nonce))
+	if len(data) == 0 {
+		return 0, false
+	}
+	var height uint64
+	if err := types.FromBytes(data, &height); err != nil {
+		log.Panicf("Error reading the deposit nonce height %X, error: %v", data, err.Error())
+	}
+	return height, true
+}
+
+// PruneDepositNonces removes the idempotency nonces expiring at the height from the recent-nonce sets, and returns
+// the number of nonces removed. The state keeps the nonces of the last core.DepositNonceWindow blocks only.
+func (sv *StoreView) PruneDepositNonces(height uint64) int {
+	bucket := sv.getDepositNonceExpiryBucket(height)
+	for _, entry := range bucket.Nonces {
+		sv.Delete(DepositNonceKey(entry.Source, entry.Nonce))
+	}
+	if len(bucket.Nonces) > 0 {
+		sv.Delete(DepositNonceExpiryKey(height))
+	}
+	return len(bucket.Nonces)
+}
+
+func (sv *StoreView) getDepositNonceExpiryBucket(height uint64) *depositNonceExpiryBucket {
+	bucket := &depositNonceExpiryBucket{}
+	data := sv.Get(DepositNonceExpiryKey(height))
+	if len(data) == 0 {
+		return bucket
+	}
+	if err := types.FromBytes(data, bucket); err != nil {
+		log.Panicf("Error reading the deposit nonce expiry bucket %X, error: %v", data, err.Error())
+	}
+	return bucket
+}
+
+func encodeDepositNonceHeight(height uint64) common.Bytes {
+	data, err := types.ToBytes(height)
+	if err != nil {
+		log.Panicf("Error writing the deposit nonce height %v, error: %v", height, err.Error())
+	}
+	return data
+}
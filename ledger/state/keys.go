@@ -1,6 +1,11 @@
 package state
 
-import "github.com/thetatoken/theta/common"
+import (
+	"encoding/binary"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/ledger/types"
+)
 
 //
 // ------------------------- Ledger State Keys -------------------------
@@ -11,9 +16,19 @@ func ChainIDKey() common.Bytes {
 	return common.Bytes("chainid")
 }
 
+// AccountKeyPrefix returns the prefix for the account keys
+func AccountKeyPrefix() common.Bytes {
+	return common.Bytes("ls/a/")
+}
+
 // AccountKey constructs the state key for the given address
 func AccountKey(addr common.Address) common.Bytes {
-	return append(common.Bytes("ls/a/"), addr[:]...)
+	return append(AccountKeyPrefix(), addr[:]...)
+}
+
+// AccountTombstoneKey constructs the state key for the sequence floor of the deleted account of the given address
+func AccountTombstoneKey(addr common.Address) common.Bytes {
+	return append(common.Bytes("ls/at/"), addr[:]...)
 }
 
 // SplitRuleKeyPrefix returns the prefix for the split rule key
@@ -37,13 +52,284 @@ func ValidatorCandidatePoolKey() common.Bytes {
 	return common.Bytes("ls/vcp")
 }
 
+// GuardianCandidatePoolKey returns the state key for the guardian stakes
+func GuardianCandidatePoolKey() common.Bytes {
+	return common.Bytes("ls/gcp")
+}
+
+// ValidatorLivenessKey returns the state key for the liveness records of the validators
+func ValidatorLivenessKey() common.Bytes {
+	return common.Bytes("ls/vlv")
+}
+
+// TxInclusionParamsKey returns the state key for the parameters of the reward withholding for the underfilled blocks
+func TxInclusionParamsKey() common.Bytes {
+	return common.Bytes("ls/tip")
+}
+
+// TxInclusionTrackerKey returns the state key for the fullness of the recent blocks and the underfilled blocks
+// of the proposers
+func TxInclusionTrackerKey() common.Bytes {
+	return common.Bytes("ls/tit")
+}
+
+// StakeIndexKey returns the state key marking that the stakes are indexed by source and by holder
+func StakeIndexKey() common.Bytes {
+	return common.Bytes("ls/si")
+}
+
+// AllStakesBySourceKeyPrefix returns the prefix for the keys of all the stakes, indexed by source
+func AllStakesBySourceKeyPrefix() common.Bytes {
+	return common.Bytes("ls/sbs/")
+}
+
+// StakeBySourceKeyPrefix returns the prefix for the keys of the stakes deposited by the source
+func StakeBySourceKeyPrefix(source common.Address) common.Bytes {
+	return append(AllStakesBySourceKeyPrefix(), source[:]...)
+}
+
+// StakeBySourceKey constructs the state key for the stakes deposited by the source to the holder for the purpose
+func StakeBySourceKey(source common.Address, holder common.Address, purpose uint8) common.Bytes {
+	return append(append(StakeBySourceKeyPrefix(source), holder[:]...), purpose)
+}
+
+// StakeByHolderKeyPrefix returns the prefix for the keys of the stakes deposited to the holder
+func StakeByHolderKeyPrefix(holder common.Address) common.Bytes {
+	return append(common.Bytes("ls/sbh/"), holder[:]...)
+}
+
+// StakeByHolderKey constructs the state key indexing the stakes deposited by the source to the holder for the
+// purpose, which are stored under the StakeBySourceKey
+func StakeByHolderKey(holder common.Address, source common.Address, purpose uint8) common.Bytes {
+	return append(append(StakeByHolderKeyPrefix(holder), source[:]...), purpose)
+}
+
+// StakeReturnQueueBuiltKey returns the state key marking that the withdrawn stakes are queued by return height
+func StakeReturnQueueBuiltKey() common.Bytes {
+	return common.Bytes("ls/srqb")
+}
+
+// StakeReturnQueueKey constructs the state key for the stakes to be returned at the given height
+func StakeReturnQueueKey(height uint64) common.Bytes {
+	heightBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(heightBytes, height)
+	return append(common.Bytes("ls/srq/"), heightBytes...)
+}
+
+// StakeHistoryBuiltKey returns the state key marking that the changes of the validator stakes are recorded
+func StakeHistoryBuiltKey() common.Bytes {
+	return common.Bytes("ls/shb")
+}
+
+// StakeHistoryKeyPrefix returns the prefix for the keys of the total stake changes of the holder
+func StakeHistoryKeyPrefix(holder common.Address) common.Bytes {
+	return append(common.Bytes("ls/sh/"), holder[:]...)
+}
+
+// StakeHistoryKey constructs the state key for the total stake of the holder as of the end of the block at the
+// given height. The height is big endian so the entries of a holder are traversed in height order.
+func StakeHistoryKey(holder common.Address, height uint64) common.Bytes {
+	heightBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(heightBytes, height)
+	return append(StakeHistoryKeyPrefix(holder), heightBytes...)
+}
+
+// RewardHistoryKeyPrefix returns the prefix for the keys of the rewards granted to the address by epoch
+func RewardHistoryKeyPrefix(addr common.Address) common.Bytes {
+	return append(common.Bytes("ls/rh/"), addr[:]...)
+}
+
+// RewardHistoryKey constructs the state key for the rewards granted to the address in the epoch. The epoch is big
+// endian so the entries of an address are traversed in epoch order.
+func RewardHistoryKey(addr common.Address, epoch uint64) common.Bytes {
+	epochBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(epochBytes, epoch)
+	return append(RewardHistoryKeyPrefix(addr), epochBytes...)
+}
+
+// RewardHistoryTotalKey constructs the state key for the running total of the rewards granted to the address in
+// the epochs pruned out of the reward history
+func RewardHistoryTotalKey(addr common.Address) common.Bytes {
+	return append(common.Bytes("ls/rht/"), addr[:]...)
+}
+
 // StakeTransactionHeightListKey returns the state key the heights of blocks
 // that contain stake related transactions (i.e. StakeDeposit, StakeWithdraw, etc)
 func StakeTransactionHeightListKey() common.Bytes {
 	return common.Bytes("ls/sthl")
 }
 
+// BlockGasLimitKey returns the state key for the gas budget of a block
+func BlockGasLimitKey() common.Bytes {
+	return common.Bytes("ls/bgl")
+}
+
+// MaxTxSizeKey returns the state key for the max size of a raw regular transaction
+func MaxTxSizeKey() common.Bytes {
+	return common.Bytes("ls/mts")
+}
+
+// DustThresholdKey returns the state key for the minimum non-zero coin amounts of a send transaction output
+func DustThresholdKey() common.Bytes {
+	return common.Bytes("ls/dt")
+}
+
+// MinNewAccountAmountKey returns the state key for the minimum coin amounts of an output creating a new account
+func MinNewAccountAmountKey() common.Bytes {
+	return common.Bytes("ls/mna")
+}
+
+// FeeScheduleKey returns the state key for the minimum fees of the regular transactions
+func FeeScheduleKey() common.Bytes {
+	return common.Bytes("ls/fs")
+}
+
+// IntrinsicGasScheduleKey returns the state key for the intrinsic gas of the regular transactions
+func IntrinsicGasScheduleKey() common.Bytes {
+	return common.Bytes("ls/igs")
+}
+
+// TotalSupplyKey returns the state key for the total coin supply
+func TotalSupplyKey() common.Bytes {
+	return common.Bytes("ls/ts")
+}
+
+// FeePolicyKey returns the state key for the split of the tx fees between burning and the block proposer
+func FeePolicyKey() common.Bytes {
+	return common.Bytes("ls/fp")
+}
+
+// BurnedFeesKey returns the state key for the cumulative tx fees burned
+func BurnedFeesKey() common.Bytes {
+	return common.Bytes("ls/bf")
+}
+
+// UndistributedFeesKey returns the state key for the tx fees to be claimed by the next block proposer
+func UndistributedFeesKey() common.Bytes {
+	return common.Bytes("ls/udf")
+}
+
+// CoinbaseOverflowKey returns the state key for the rewards carried over to the next coinbase transaction
+func CoinbaseOverflowKey() common.Bytes {
+	return common.Bytes("ls/cbo")
+}
+
+// RegularTxLimitKey returns the state key for the max number of regular transactions in a block
+func RegularTxLimitKey() common.Bytes {
+	return common.Bytes("ls/rtl")
+}
+
+// DoubleSignSlashPercentageKey returns the state key for the percentage of the stake burned for a double signing
+func DoubleSignSlashPercentageKey() common.Bytes {
+	return common.Bytes("ls/dssp")
+}
+
+// DoubleSignSlashKey constructs the state key recording that the validator was slashed for double signing at the
+// given height
+func DoubleSignSlashKey(offender common.Address, height uint64) common.Bytes {
+	heightBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(heightBytes, height)
+	return append(append(common.Bytes("ls/dss/"), offender[:]...), heightBytes...)
+}
+
+// StakeHolderSlashHeightKey constructs the state key for the height the stake holder was last slashed at
+func StakeHolderSlashHeightKey(holder common.Address) common.Bytes {
+	return append(common.Bytes("ls/dssh/"), holder[:]...)
+}
+
+// StakeHolderSlashReturnHeightKey constructs the state key for the return height of the stakes withdrawn by the
+// last slash of the stake holder
+func StakeHolderSlashReturnHeightKey(holder common.Address) common.Bytes {
+	return append(common.Bytes("ls/dssr/"), holder[:]...)
+}
+
+// StakeEjectionReturnHeightKey constructs the state key for the return height of the stake of the source last
+// ejected by the holder
+func StakeEjectionReturnHeightKey(holder common.Address, source common.Address) common.Bytes {
+	return append(append(common.Bytes("ls/ser/"), holder[:]...), source[:]...)
+}
+
+// StakeReturnAddressKeyPrefix constructs the state key prefix for the return addresses of the stakes withdrawn from
+// the holder for the purpose
+func StakeReturnAddressKeyPrefix(purpose uint8, holder common.Address) common.Bytes {
+	return append(append(common.Bytes("ls/sra/"), purpose), holder[:]...)
+}
+
+// StakeReturnAddressKey constructs the state key for the address the stakes of the source withdrawn from the
+// holder for the purpose are returned to at the return height, if not the source
+func StakeReturnAddressKey(purpose uint8, holder common.Address, source common.Address, returnHeight uint64) common.Bytes {
+	heightBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(heightBytes, returnHeight)
+	return append(append(StakeReturnAddressKeyPrefix(purpose, holder), source[:]...), heightBytes...)
+}
+
+// DepositNonceKey constructs the state key for the height the source used the idempotency nonce at, while the
+// nonce is in its recent-nonce set
+func DepositNonceKey(source common.Address, nonce uint64) common.Bytes {
+	nonceBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(nonceBytes, nonce)
+	return append(append(common.Bytes("ls/dn/"), source[:]...), nonceBytes...)
+}
+
+// DepositNonceExpiryKey constructs the state key for the idempotency nonces leaving the recent-nonce sets at the
+// given height
+func DepositNonceExpiryKey(height uint64) common.Bytes {
+	heightBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(heightBytes, height)
+	return append(common.Bytes("ls/dne/"), heightBytes...)
+}
+
+// RotatedValidatorKeyKey constructs the state key for the new address of the stake holder that rotated its key
+func RotatedValidatorKeyKey(holder common.Address) common.Bytes {
+	return append(common.Bytes("ls/rvk/"), holder[:]...)
+}
+
+// StakeCommissionKey constructs the state key for the commission of the stake holder
+func StakeCommissionKey(holder common.Address) common.Bytes {
+	return append(common.Bytes("ls/scm/"), holder[:]...)
+}
+
+// ValidatorMetadataKey constructs the state key for the metadata of the stake holder
+func ValidatorMetadataKey(holder common.Address) common.Bytes {
+	return append(common.Bytes("ls/vmd/"), holder[:]...)
+}
+
+// MaxNumValidatorsKey returns the state key for the max number of validators in the validator set
+func MaxNumValidatorsKey() common.Bytes {
+	return common.Bytes("ls/mnv")
+}
+
+// MinValidatorStakeDepositKey returns the state key for the minimum amount of a validator stake deposit
+func MinValidatorStakeDepositKey() common.Bytes {
+	return common.Bytes("ls/mvsd")
+}
+
+// ReturnLockingPeriodKey returns the state key for the number of blocks a withdrawn validator stake is locked for
+func ReturnLockingPeriodKey() common.Bytes {
+	return common.Bytes("ls/rlp")
+}
+
 // StatePruningProgressKey returns the key for the state pruning progress
 func StatePruningProgressKey() common.Bytes {
 	return common.Bytes("ls/spp")
 }
+
+// ContractStorageAccessKey constructs the key recording an access to the storage slot of the contract in the
+// state access lists. The slots are stored in the storage tree of the contract account, not under this key.
+func ContractStorageAccessKey(addr common.Address, slot common.Hash) common.Bytes {
+	return append(ContractStorageAccessKeyPrefix(addr), slot[:]...)
+}
+
+// ContractStorageAccessKeyPrefix returns the prefix of the keys recording the accesses to the storage slots of the
+// contract, recorded as traversed when the storage is traversed
+func ContractStorageAccessKeyPrefix(addr common.Address) common.Bytes {
+	return append(common.Bytes("ls/cs/"), addr[:]...)
+}
+
+// CustomTxDataKey constructs the state key for the given key of the data stored by the executor of the given
+// custom tx type, each type has its own key space
+func CustomTxDataKey(txType types.TxType, key common.Bytes) common.Bytes {
+	typeBytes := make([]byte, 2)
+	binary.BigEndian.PutUint16(typeBytes, uint16(txType))
+	return append(append(common.Bytes("ls/ctd/"), typeBytes...), key...)
+}
@@ -0,0 +1,127 @@
+package state
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+//
+// ------------------------- Reward History -------------------------
+//
+
+// rewardHistoryTotal is the value stored under a RewardHistoryTotalKey, i.e. the rewards granted to the address in
+// the epochs before PrunedBefore, whose entries are pruned out of the reward history
+type rewardHistoryTotal struct {
+	PrunedBefore uint64
+	Amount       types.Coins
+}
+
+// RecordReward adds the reward granted to the address to the entry of the epoch in the reward history, and folds
+// the entries of the address older than the retention window of the epoch into its running total. A zero
+// retention keeps all the entries. The epochs of the rewards only increase, so an address whose entries are
+// pruned is never granted a reward in a pruned epoch again.
+func (sv *StoreView) RecordReward(addr common.Address, epoch uint64, reward types.Coins, retention uint64) {
+	key := RewardHistoryKey(addr, epoch)
+	amount := reward.NoNil()
+	if data := sv.Get(key); len(data) > 0 {
+		amount = decodeRewardHistoryEntry(data).Plus(amount)
+	}
+	sv.Set(key, encodeRewardHistoryEntry(amount))
+
+	if retention == 0 || epoch < retention {
+		return
+	}
+	prunedBefore := epoch - retention + 1
+	total := sv.getRewardHistoryTotal(addr)
+	if total.PrunedBefore >= prunedBefore {
+		return
+	}
+
+	prefix := RewardHistoryKeyPrefix(addr)
+	prunedKeys := []common.Bytes{}
+	sv.traverse(prefix, func(key, value common.Bytes) bool {
+		if binary.BigEndian.Uint64(key[len(prefix):]) >= prunedBefore {
+			return false
+		}
+		total.Amount = total.Amount.Plus(decodeRewardHistoryEntry(value))
+		prunedKeys = append(prunedKeys, common.CopyBytes(key))
+		return true
+	})
+	for _, key := range prunedKeys {
+		sv.Delete(key)
+	}
+	total.PrunedBefore = prunedBefore
+	sv.Set(RewardHistoryTotalKey(addr), encodeRewardHistoryTotal(total))
+}
+
+// GetRewards returns the rewards granted to the address in the epochs from fromEpoch to toEpoch inclusively. The
+// rewards of the pruned epochs are only known as a whole, so the range has to start after them, or from epoch
+// zero to include them all. Nothing is recorded before common.HeightEnableRewardHistory.
+func (sv *StoreView) GetRewards(addr common.Address, fromEpoch, toEpoch uint64) (types.Coins, error) {
+	if fromEpoch > toEpoch {
+		return types.Coins{}, fmt.Errorf("Invalid epoch range: %v to %v", fromEpoch, toEpoch)
+	}
+	rewards := types.NewCoins(0, 0)
+	if total := sv.getRewardHistoryTotal(addr); total.PrunedBefore > fromEpoch {
+		if fromEpoch != 0 || toEpoch < total.PrunedBefore-1 {
+			return types.Coins{}, fmt.Errorf("The rewards of the epochs before %v are pruned, only their total is kept",
+				total.PrunedBefore)
+		}
+		rewards = rewards.Plus(total.Amount)
+	}
+
+	prefix := RewardHistoryKeyPrefix(addr)
+	sv.traverse(prefix, func(key, value common.Bytes) bool {
+		epoch := binary.BigEndian.Uint64(key[len(prefix):])
+		if epoch < fromEpoch {
+			return true
+		}
+		if epoch > toEpoch {
+			return false
+		}
+		rewards = rewards.Plus(decodeRewardHistoryEntry(value))
+		return true
+	})
+	return rewards, nil
+}
+
+func (sv *StoreView) getRewardHistoryTotal(addr common.Address) *rewardHistoryTotal {
+	total := &rewardHistoryTotal{Amount: types.NewCoins(0, 0)}
+	data := sv.Get(RewardHistoryTotalKey(addr))
+	if len(data) == 0 {
+		return total
+	}
+	if err := types.FromBytes(data, total); err != nil {
+		log.Panicf("Error reading the reward history total %X, error: %v", data, err.Error())
+	}
+	total.Amount = total.Amount.NoNil()
+	return total
+}
+
+func encodeRewardHistoryTotal(total *rewardHistoryTotal) common.Bytes {
+	data, err := types.ToBytes(total)
+	if err != nil {
+		log.Panicf("Error writing the reward history total %v, error: %v", total, err.Error())
+	}
+	return data
+}
+
+func encodeRewardHistoryEntry(amount types.Coins) common.Bytes {
+	data, err := types.ToBytes(amount)
+	if err != nil {
+		log.Panicf("Error writing the reward history entry %v, error: %v", amount, err.Error())
+	}
+	return data
+}
+
+func decodeRewardHistoryEntry(data common.Bytes) types.Coins {
+	var amount types.Coins
+	if err := types.FromBytes(data, &amount); err != nil {
+		log.Panicf("Error reading the reward history entry %X, error: %v", data, err.Error())
+	}
+	return amount.NoNil()
+}
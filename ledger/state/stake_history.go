@@ -0,0 +1,106 @@
+package state
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+//
+// ------------------------- Stake History -------------------------
+//
+
+// StakeHistoryEntry is the total active stake of a validator stake holder as of the end of the block at the height
+type StakeHistoryEntry struct {
+	Height     uint64
+	TotalStake *big.Int
+}
+
+// GetStakeHistory returns the changes of the total stake of the validator stake holder in the blocks from
+// fromHeight to toHeight inclusively, in height order, at most limit of them if limit is positive. The stake is
+// unchanged between two entries, so a page is resumed from the height above its last entry. Nothing is recorded
+// before the first candidate pool update at or above common.HeightEnableStakeHistory, whose entries list the total
+// stakes of all the holders at the time.
+func (sv *StoreView) GetStakeHistory(holder common.Address, fromHeight, toHeight uint64, limit int) []*StakeHistoryEntry {
+	entries := []*StakeHistoryEntry{}
+	prefix := StakeHistoryKeyPrefix(holder)
+	sv.traverse(prefix, func(key, value common.Bytes) bool {
+		height := binary.BigEndian.Uint64(key[len(prefix):])
+		if height < fromHeight {
+			return true
+		}
+		if height > toHeight || (limit > 0 && len(entries) >= limit) {
+			return false
+		}
+		entries = append(entries, &StakeHistoryEntry{Height: height, TotalStake: decodeStakeHistoryEntry(value)})
+		return true
+	})
+	return entries
+}
+
+// StakeHistoryBuilt returns whether the changes of the validator stakes are recorded, which is the case from the
+// first candidate pool update at or above common.HeightEnableStakeHistory
+func (sv *StoreView) StakeHistoryBuilt() bool {
+	return len(sv.Get(StakeHistoryBuiltKey())) > 0
+}
+
+// stakeHistoryEnabled returns whether the validator candidate pool updates are recorded, the block being executed
+// is one above the height of the view
+func (sv *StoreView) stakeHistoryEnabled() bool {
+	return sv.Height()+1 >= common.HeightEnableStakeHistory
+}
+
+// updateStakeHistory records the total stakes of the holders changed by a validator candidate pool update under
+// the height of the block being executed, a holder dropping out of the pool is recorded with the zero stake. The
+// first update from common.HeightEnableStakeHistory records the total stakes of all the holders of the pool.
+func (sv *StoreView) updateStakeHistory(before, after []*core.StakeHolder) {
+	height := sv.Height() + 1
+	if !sv.StakeHistoryBuilt() {
+		for _, stakeHolder := range after {
+			sv.Set(StakeHistoryKey(stakeHolder.Holder, height), encodeStakeHistoryEntry(stakeHolder.TotalStake()))
+		}
+		sv.Set(StakeHistoryBuiltKey(), []byte{1})
+		return
+	}
+
+	beforeTotals := map[common.Address]*big.Int{}
+	for _, stakeHolder := range before {
+		beforeTotals[stakeHolder.Holder] = stakeHolder.TotalStake()
+	}
+	for _, stakeHolder := range after {
+		beforeTotal, exists := beforeTotals[stakeHolder.Holder]
+		if !exists {
+			beforeTotal = big.NewInt(0)
+		}
+		if total := stakeHolder.TotalStake(); beforeTotal.Cmp(total) != 0 {
+			sv.Set(StakeHistoryKey(stakeHolder.Holder, height), encodeStakeHistoryEntry(total))
+		}
+		delete(beforeTotals, stakeHolder.Holder)
+	}
+	for holder, beforeTotal := range beforeTotals {
+		if beforeTotal.Sign() != 0 {
+			sv.Set(StakeHistoryKey(holder, height), encodeStakeHistoryEntry(big.NewInt(0)))
+		}
+	}
+}
+
+func encodeStakeHistoryEntry(totalStake *big.Int) common.Bytes {
+	data, err := types.ToBytes(totalStake)
+	if err != nil {
+		log.Panicf("Error writing stake history entry %v, error: %v", totalStake, err.Error())
+	}
+	return data
+}
+
+func decodeStakeHistoryEntry(data common.Bytes) *big.Int {
+	totalStake := new(big.Int)
+	err := types.FromBytes(data, totalStake)
+	if err != nil {
+		log.Panicf("Error reading stake history entry %X, error: %v", data, err.Error())
+	}
+	return totalStake
+}
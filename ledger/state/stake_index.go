@@ -0,0 +1,258 @@
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+//
+// ------------------------- Stake Index -------------------------
+//
+
+// StakeRecord is a stake deposited by the source to the holder for the purpose
+type StakeRecord struct {
+	Source       common.Address
+	Holder       common.Address
+	Purpose      uint8
+	Amount       *big.Int
+	Withdrawn    bool
+	ReturnHeight uint64
+}
+
+// indexedStakes is the value stored under a StakeBySourceKey, i.e. the stakes of a source to a holder for a
+// purpose, one active stake and the queued withdrawals
+type indexedStakes struct {
+	Stakes []*core.Stake
+}
+
+// stakePair identifies the stakes of a source to a holder for a purpose
+type stakePair struct {
+	source  common.Address
+	holder  common.Address
+	purpose uint8
+}
+
+// GetStakesBySource returns the validator and guardian stakes deposited by the source, ordered by holder, then
+// by purpose
+func (sv *StoreView) GetStakesBySource(source common.Address) []*StakeRecord {
+	if !sv.stakeIndexBuilt() {
+		return sv.scanStakes(func(pair stakePair) bool { return pair.source == source })
+	}
+
+	records := []*StakeRecord{}
+	prefix := StakeBySourceKeyPrefix(source)
+	sv.traverse(prefix, func(key, value common.Bytes) bool {
+		var holder common.Address
+		copy(holder[:], key[len(prefix):])
+		purpose := key[len(key)-1]
+		records = append(records, newStakeRecords(stakePair{source, holder, purpose}, decodeIndexedStakes(value))...)
+		return true
+	})
+	return records
+}
+
+// GetStakesByHolder returns the validator and guardian stakes deposited to the holder, ordered by source, then
+// by purpose
+func (sv *StoreView) GetStakesByHolder(holder common.Address) []*StakeRecord {
+	if !sv.stakeIndexBuilt() {
+		return sv.scanStakes(func(pair stakePair) bool { return pair.holder == holder })
+	}
+
+	pairs := []stakePair{}
+	prefix := StakeByHolderKeyPrefix(holder)
+	sv.traverse(prefix, func(key, value common.Bytes) bool {
+		var source common.Address
+		copy(source[:], key[len(prefix):])
+		pairs = append(pairs, stakePair{source, holder, key[len(key)-1]})
+		return true
+	})
+
+	records := []*StakeRecord{}
+	for _, pair := range pairs {
+		data := sv.Get(StakeBySourceKey(pair.source, pair.holder, pair.purpose))
+		records = append(records, newStakeRecords(pair, decodeIndexedStakes(data))...)
+	}
+	return records
+}
+
+// GetPendingStakeReturns returns the withdrawn stakes of the source that are not returned yet, ordered by return
+// height, then by holder and purpose
+func (sv *StoreView) GetPendingStakeReturns(source common.Address) []*StakeRecord {
+	pendingReturns := []*StakeRecord{}
+	for _, record := range sv.GetStakesBySource(source) {
+		if record.Withdrawn {
+			pendingReturns = append(pendingReturns, record)
+		}
+	}
+	sort.SliceStable(pendingReturns, func(i, j int) bool {
+		return pendingReturns[i].ReturnHeight < pendingReturns[j].ReturnHeight
+	})
+	return pendingReturns
+}
+
+// TraverseStakes calls the callback on each validator and guardian stake, ordered by source, then by holder and
+// purpose, until it returns false. The index entries are streamed out of the state trie, so the stakes are never
+// all held in memory, except at the heights before the index is built, where they are read off the candidate pools.
+func (sv *StoreView) TraverseStakes(cb func(record *StakeRecord) bool) {
+	if !sv.stakeIndexBuilt() {
+		for _, record := range sv.scanStakes(func(pair stakePair) bool { return true }) {
+			if !cb(record) {
+				return
+			}
+		}
+		return
+	}
+
+	prefix := AllStakesBySourceKeyPrefix()
+	stopped := false
+	sv.traverse(prefix, func(key, value common.Bytes) bool {
+		if stopped {
+			return false
+		}
+		var source, holder common.Address
+		copy(source[:], key[len(prefix):])
+		copy(holder[:], key[len(prefix)+common.AddressLength:])
+		purpose := key[len(key)-1]
+		for _, record := range newStakeRecords(stakePair{source, holder, purpose}, decodeIndexedStakes(value)) {
+			if !cb(record) {
+				stopped = true
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// stakeIndexEnabled returns whether the candidate pool updates are indexed, the block being executed is one
+// above the height of the view
+func (sv *StoreView) stakeIndexEnabled() bool {
+	return sv.Height()+1 >= common.HeightEnableStakeIndex
+}
+
+func (sv *StoreView) stakeIndexBuilt() bool {
+	return len(sv.Get(StakeIndexKey())) > 0
+}
+
+// scanStakes returns the stakes of the matched pairs from the candidate pools, in the order of the index. It
+// answers the queries at the heights before the index is built.
+func (sv *StoreView) scanStakes(match func(pair stakePair) bool) []*StakeRecord {
+	groups := sv.groupPoolStakes()
+	pairs := []stakePair{}
+	for pair := range groups {
+		if match(pair) {
+			pairs = append(pairs, pair)
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return bytes.Compare(pairKey(pairs[i]), pairKey(pairs[j])) < 0
+	})
+
+	records := []*StakeRecord{}
+	for _, pair := range pairs {
+		records = append(records, newStakeRecords(pair, groups[pair])...)
+	}
+	return records
+}
+
+// groupPoolStakes groups the stakes of both candidate pools by pair
+func (sv *StoreView) groupPoolStakes() map[stakePair][]*core.Stake {
+	groups := map[stakePair][]*core.Stake{}
+	groupStakes(core.StakeForValidator, validatorStakeHolders(sv.GetValidatorCandidatePool()), groups)
+	groupStakes(core.StakeForGuardian, sv.GetGuardianCandidatePool().SortedGuardians, groups)
+	return groups
+}
+
+// updateStakeIndex updates the index entries of the pairs whose stakes changed with a candidate pool update, it is
+// called after the updated pool is written. The index is built from both pools with the first update from
+// common.HeightEnableStakeIndex.
+func (sv *StoreView) updateStakeIndex(purpose uint8, before, after []*core.StakeHolder) {
+	if !sv.stakeIndexBuilt() {
+		for pair, stakes := range sv.groupPoolStakes() {
+			sv.setIndexedStakes(pair, stakes)
+		}
+		sv.Set(StakeIndexKey(), []byte{1})
+		return
+	}
+
+	beforeGroups := map[stakePair][]*core.Stake{}
+	groupStakes(purpose, before, beforeGroups)
+	afterGroups := map[stakePair][]*core.Stake{}
+	groupStakes(purpose, after, afterGroups)
+	for pair, stakes := range afterGroups {
+		if beforeStakes, exists := beforeGroups[pair]; !exists || !bytes.Equal(encodeIndexedStakes(beforeStakes), encodeIndexedStakes(stakes)) {
+			sv.setIndexedStakes(pair, stakes)
+		}
+	}
+	for pair := range beforeGroups {
+		if _, exists := afterGroups[pair]; !exists {
+			sv.Delete(StakeBySourceKey(pair.source, pair.holder, pair.purpose))
+			sv.Delete(StakeByHolderKey(pair.holder, pair.source, pair.purpose))
+		}
+	}
+}
+
+func (sv *StoreView) setIndexedStakes(pair stakePair, stakes []*core.Stake) {
+	sv.Set(StakeBySourceKey(pair.source, pair.holder, pair.purpose), encodeIndexedStakes(stakes))
+	sv.Set(StakeByHolderKey(pair.holder, pair.source, pair.purpose), []byte{1})
+}
+
+func groupStakes(purpose uint8, stakeHolders []*core.StakeHolder, groups map[stakePair][]*core.Stake) {
+	for _, stakeHolder := range stakeHolders {
+		for _, stake := range stakeHolder.Stakes {
+			pair := stakePair{stake.Source, stakeHolder.Holder, purpose}
+			groups[pair] = append(groups[pair], stake)
+		}
+	}
+}
+
+func validatorStakeHolders(vcp *core.ValidatorCandidatePool) []*core.StakeHolder {
+	if vcp == nil {
+		return nil
+	}
+	return vcp.SortedCandidates
+}
+
+func pairKey(pair stakePair) common.Bytes {
+	return StakeBySourceKey(pair.source, pair.holder, pair.purpose)
+}
+
+func newStakeRecords(pair stakePair, stakes []*core.Stake) []*StakeRecord {
+	records := []*StakeRecord{}
+	for _, stake := range stakes {
+		records = append(records, &StakeRecord{
+			Source:       pair.source,
+			Holder:       pair.holder,
+			Purpose:      pair.purpose,
+			Amount:       new(big.Int).Set(stake.Amount),
+			Withdrawn:    stake.Withdrawn,
+			ReturnHeight: stake.ReturnHeight,
+		})
+	}
+	return records
+}
+
+func encodeIndexedStakes(stakes []*core.Stake) common.Bytes {
+	data, err := types.ToBytes(&indexedStakes{Stakes: stakes})
+	if err != nil {
+		log.Panicf("Error writing indexed stakes %v, error: %v", stakes, err.Error())
+	}
+	return data
+}
+
+func decodeIndexedStakes(data common.Bytes) []*core.Stake {
+	if len(data) == 0 {
+		return nil
+	}
+	entry := &indexedStakes{}
+	err := types.FromBytes(data, entry)
+	if err != nil {
+		log.Panicf("Error reading indexed stakes %X, error: %v", data, err.Error())
+	}
+	return entry.Stakes
+}
@@ -0,0 +1,165 @@
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+//
+// ------------------------- Stake Return Queue -------------------------
+//
+
+// stakeReturnBucket is the value stored under a StakeReturnQueueKey, i.e. the stakes to be returned at the
+// height, one record per pair ordered like the stake index, with the amounts of its withdrawals due at the height
+type stakeReturnBucket struct {
+	Records []*StakeRecord
+}
+
+// pendingReturnKey identifies the withdrawals of a pair due at a height
+type pendingReturnKey struct {
+	pair         stakePair
+	returnHeight uint64
+}
+
+// GetQueuedStakeReturns returns the withdrawn stakes queued for return at the height, ordered by source, then by
+// holder and purpose. It reads a single entry of the state, whatever the number of pending returns.
+func (sv *StoreView) GetQueuedStakeReturns(height uint64) []*StakeRecord {
+	return decodeStakeReturnBucket(sv.Get(StakeReturnQueueKey(height)))
+}
+
+// StakeReturnQueueBuilt returns whether the withdrawn stakes are queued by return height, which is the case from
+// the first candidate pool update at or above common.HeightEnableStakeReturnQueue
+func (sv *StoreView) StakeReturnQueueBuilt() bool {
+	return len(sv.Get(StakeReturnQueueBuiltKey())) > 0
+}
+
+// stakeReturnQueueEnabled returns whether the candidate pool updates are queued, the block being executed is one
+// above the height of the view
+func (sv *StoreView) stakeReturnQueueEnabled() bool {
+	return sv.Height()+1 >= common.HeightEnableStakeReturnQueue
+}
+
+// updateStakeReturnQueue updates the buckets of the return heights whose withdrawals changed with a candidate pool
+// update, it is called after the updated pool is written. The queue is built from the withdrawn stakes of both
+// pools with the first update from common.HeightEnableStakeReturnQueue, which migrates the pending returns kept
+// in the pools only.
+func (sv *StoreView) updateStakeReturnQueue(purpose uint8, before, after []*core.StakeHolder) {
+	if !sv.StakeReturnQueueBuilt() {
+		groups := sv.groupPoolStakes()
+		pending := map[pendingReturnKey]*big.Int{}
+		for pair, stakes := range groups {
+			addPendingReturns(pair, stakes, pending)
+		}
+		sv.applyPendingReturnChanges(map[pendingReturnKey]*big.Int{}, pending)
+		sv.Set(StakeReturnQueueBuiltKey(), []byte{1})
+		return
+	}
+
+	beforeGroups := map[stakePair][]*core.Stake{}
+	groupStakes(purpose, before, beforeGroups)
+	beforePending := map[pendingReturnKey]*big.Int{}
+	for pair, stakes := range beforeGroups {
+		addPendingReturns(pair, stakes, beforePending)
+	}
+	afterGroups := map[stakePair][]*core.Stake{}
+	groupStakes(purpose, after, afterGroups)
+	afterPending := map[pendingReturnKey]*big.Int{}
+	for pair, stakes := range afterGroups {
+		addPendingReturns(pair, stakes, afterPending)
+	}
+	sv.applyPendingReturnChanges(beforePending, afterPending)
+}
+
+// applyPendingReturnChanges rewrites the buckets of the return heights with added, removed or changed withdrawals
+func (sv *StoreView) applyPendingReturnChanges(before, after map[pendingReturnKey]*big.Int) {
+	changed := map[uint64]map[stakePair]*big.Int{} // return height -> pair -> amount, nil if removed
+	for key, amount := range after {
+		if beforeAmount, exists := before[key]; !exists || beforeAmount.Cmp(amount) != 0 {
+			if changed[key.returnHeight] == nil {
+				changed[key.returnHeight] = map[stakePair]*big.Int{}
+			}
+			changed[key.returnHeight][key.pair] = amount
+		}
+	}
+	for key := range before {
+		if _, exists := after[key]; !exists {
+			if changed[key.returnHeight] == nil {
+				changed[key.returnHeight] = map[stakePair]*big.Int{}
+			}
+			changed[key.returnHeight][key.pair] = nil
+		}
+	}
+
+	for returnHeight, pairs := range changed {
+		records := []*StakeRecord{}
+		for _, record := range sv.GetQueuedStakeReturns(returnHeight) {
+			pair := stakePair{record.Source, record.Holder, record.Purpose}
+			if _, exists := pairs[pair]; !exists {
+				records = append(records, record)
+			}
+		}
+		for pair, amount := range pairs {
+			if amount == nil {
+				continue
+			}
+			records = append(records, &StakeRecord{
+				Source:       pair.source,
+				Holder:       pair.holder,
+				Purpose:      pair.purpose,
+				Amount:       amount,
+				Withdrawn:    true,
+				ReturnHeight: returnHeight,
+			})
+		}
+
+		if len(records) == 0 {
+			sv.Delete(StakeReturnQueueKey(returnHeight))
+			continue
+		}
+		sort.Slice(records, func(i, j int) bool {
+			return bytes.Compare(pairKey(stakePair{records[i].Source, records[i].Holder, records[i].Purpose}),
+				pairKey(stakePair{records[j].Source, records[j].Holder, records[j].Purpose})) < 0
+		})
+		sv.Set(StakeReturnQueueKey(returnHeight), encodeStakeReturnBucket(records))
+	}
+}
+
+// addPendingReturns adds up the withdrawals of the pair by return height
+func addPendingReturns(pair stakePair, stakes []*core.Stake, pending map[pendingReturnKey]*big.Int) {
+	for _, stake := range stakes {
+		if !stake.Withdrawn {
+			continue
+		}
+		key := pendingReturnKey{pair, stake.ReturnHeight}
+		if pending[key] == nil {
+			pending[key] = new(big.Int)
+		}
+		pending[key].Add(pending[key], stake.Amount)
+	}
+}
+
+func encodeStakeReturnBucket(records []*StakeRecord) common.Bytes {
+	data, err := types.ToBytes(&stakeReturnBucket{Records: records})
+	if err != nil {
+		log.Panicf("Error writing stake return bucket %v, error: %v", records, err.Error())
+	}
+	return data
+}
+
+func decodeStakeReturnBucket(data common.Bytes) []*StakeRecord {
+	if len(data) == 0 {
+		return nil
+	}
+	bucket := &stakeReturnBucket{}
+	err := types.FromBytes(data, bucket)
+	if err != nil {
+		log.Panicf("Error reading stake return bucket %X, error: %v", data, err.Error())
+	}
+	return bucket.Records
+}
@@ -3,6 +3,7 @@ package state
 import (
 	"fmt"
 	"log"
+	"sync"
 
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/common/result"
@@ -21,6 +22,12 @@ type LedgerState struct {
 	delivered *StoreView // for actually applying the transactions
 	checked   *StoreView // for block proposal check
 	screened  *StoreView // for mempool screening
+
+	// The height and root of the latest committed delivered view, which can be read
+	// without waiting for the block currently being applied
+	committedMu     *sync.RWMutex
+	committedHeight uint64
+	committedRoot   common.Hash
 }
 
 // NewLedgerState creates a new Leger State with given store.
@@ -28,8 +35,9 @@ type LedgerState struct {
 //       the proper height and stateRootHash
 func NewLedgerState(chainID string, db database.Database) *LedgerState {
 	s := &LedgerState{
-		chainID: chainID,
-		db:      db,
+		chainID:     chainID,
+		db:          db,
+		committedMu: &sync.RWMutex{},
 	}
 	s.ResetState(uint64(0), common.Hash{})
 	s.Finalize(uint64(0), common.Hash{})
@@ -54,6 +62,8 @@ func (s *LedgerState) ResetState(height uint64, stateRootHash common.Hash) resul
 		return result.Error(fmt.Sprintf("Failed to copy to the screened view: %v", err))
 	}
 
+	s.setCommitted(height, stateRootHash)
+
 	return result.OK
 }
 
@@ -110,17 +120,49 @@ func (s *LedgerState) Finalized() *StoreView {
 // Commit stores the current delivered view as committed, starts new delivered/checked state and
 // returns the hash for the commit.
 func (s *LedgerState) Commit() common.Hash {
-	hash := s.delivered.Save()
-	s.delivered.IncrementHeight()
-
-	var err error
-	s.checked, err = s.delivered.Copy()
+	// The views are copied before the delivered view is flushed to the database, so that they are loaded from the
+	// trie nodes still in memory, and a database failure can not leave a saved state without the views on top of it
+	checked, err := s.delivered.Copy()
 	if err != nil {
 		log.Panicf("Commit: failed to copy to the checked view: %v", err)
 	}
-	s.screened, err = s.delivered.Copy()
+	screened, err := s.delivered.Copy()
 	if err != nil {
 		log.Panicf("Commit: failed to copy to the screened view: %v", err)
 	}
+
+	hash := s.delivered.Save()
+	s.delivered.IncrementHeight()
+	checked.IncrementHeight()
+	screened.IncrementHeight()
+	s.checked, s.screened = checked, screened
+
+	s.setCommitted(s.delivered.Height(), hash)
+
 	return hash
 }
+
+// CommitView replaces the delivered view with the given view, which must be derived from the delivered
+// view (e.g. the checked view used for the block proposal), and commits it.
+func (s *LedgerState) CommitView(view *StoreView) common.Hash {
+	s.delivered = view
+	return s.Commit()
+}
+
+// Committed returns a fresh view of the latest committed state. Unlike Delivered(), it never
+// reflects the transactions of a block that is being applied, and it is safe to call
+// concurrently with the block application.
+func (s *LedgerState) Committed() *StoreView {
+	s.committedMu.RLock()
+	defer s.committedMu.RUnlock()
+
+	return NewStoreView(s.committedHeight, s.committedRoot, s.db)
+}
+
+func (s *LedgerState) setCommitted(height uint64, stateRootHash common.Hash) {
+	s.committedMu.Lock()
+	defer s.committedMu.Unlock()
+
+	s.committedHeight = height
+	s.committedRoot = stateRootHash
+}
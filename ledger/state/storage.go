@@ -0,0 +1,112 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/trie"
+)
+
+// StorageProof proves the value of a storage slot of a contract against a state root: the account of the contract
+// is proven against the state root, and the slot against the storage root of the account, see types.Account.Root.
+// It proves the slot is empty as well, if the account does not exist or the slot is not set.
+type StorageProof struct {
+	Address common.Address
+	Key     common.Hash
+	Account core.VCPProof // the state trie nodes on the path to the account
+	Storage core.VCPProof // the storage trie nodes of the account on the path to the slot
+}
+
+// ProveStorage returns the proof of the storage slot of the contract against the state root of the view
+func (sv *StoreView) ProveStorage(addr common.Address, key common.Hash) (*StorageProof, error) {
+	proof := &StorageProof{
+		Address: addr,
+		Key:     key,
+	}
+	if err := sv.store.ProveVCP(AccountKey(addr), &proof.Account); err != nil {
+		return nil, err
+	}
+	account := sv.GetAccount(addr)
+	if account == nil || isEmptyStorageRoot(account.Root) {
+		return proof, nil
+	}
+	storage := sv.getAccountStorage(account)
+	if storage == nil {
+		return nil, fmt.Errorf("Failed to load the storage of %v", addr.Hex())
+	}
+	if err := storage.Prove(key[:], 0, &proof.Storage); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// VerifyStorageProof returns the value of the storage slot proven against the state root, which the caller gets
+// from the block header it trusts, see core.BlockHeader.StateHash
+func VerifyStorageProof(stateRoot common.Hash, proof *StorageProof) (common.Hash, error) {
+	accountBytes, _, err := trie.VerifyProof(stateRoot, AccountKey(proof.Address), &proof.Account)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("Invalid account proof: %v", err)
+	}
+	if len(accountBytes) == 0 {
+		return common.Hash{}, nil
+	}
+	account := &types.Account{}
+	if err := types.FromBytes(accountBytes, account); err != nil {
+		return common.Hash{}, err
+	}
+	if isEmptyStorageRoot(account.Root) {
+		return common.Hash{}, nil
+	}
+	enc, _, err := trie.VerifyProof(account.Root, proof.Key[:], &proof.Storage)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("Invalid storage proof: %v", err)
+	}
+	return decodeStorageValue(enc)
+}
+
+// TraverseStorage visits the non-empty storage slots of the contract in the order of their keys until the callback
+// returns false, e.g. to index or to dump the storage
+func (sv *StoreView) TraverseStorage(addr common.Address, cb func(key, value common.Hash) bool) error {
+	if sv.accessRecorder != nil {
+		sv.accessRecorder.recordTraversal(ContractStorageAccessKeyPrefix(addr))
+	}
+	account := sv.GetAccount(addr)
+	if account == nil || isEmptyStorageRoot(account.Root) {
+		return nil
+	}
+	storage := sv.getAccountStorage(account)
+	if storage == nil {
+		return fmt.Errorf("Failed to load the storage of %v", addr.Hex())
+	}
+	it := trie.NewIterator(storage.NodeIterator(nil))
+	for it.Next() {
+		value, err := decodeStorageValue(it.Value)
+		if err != nil {
+			return err
+		}
+		if !cb(common.BytesToHash(it.Key), value) {
+			return nil
+		}
+	}
+	return it.Err
+}
+
+// decodeStorageValue decodes the value of a storage slot, stored as the RLP encoding of the value without its
+// leading zeros
+func decodeStorageValue(enc common.Bytes) (common.Hash, error) {
+	if len(enc) == 0 {
+		return common.Hash{}, nil
+	}
+	_, content, _, err := rlp.Split(enc)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(content), nil
+}
+
+func isEmptyStorageRoot(root common.Hash) bool {
+	return root == common.Hash{} || root == core.EmptyRootHash
+}
@@ -0,0 +1,145 @@
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestStoreViewStorageSlotDeletion(t *testing.T) {
+	assert := assert.New(t)
+
+	contract := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	slot1, slot2 := common.BigToHash(big.NewInt(1)), common.BigToHash(big.NewInt(2))
+	value := common.BigToHash(big.NewInt(0x2a))
+
+	newView := func(height uint64) *StoreView {
+		sv := NewStoreView(height, common.Hash{}, backend.NewMemDatabase())
+		sv.SetState(contract, slot1, value)
+		sv.SetState(contract, slot2, value)
+		return sv
+	}
+
+	// Before the fork, a cleared slot keeps its previous value, so the blocks replay to the same state roots
+	sv := newView(common.HeightEnableStorageSlotDeletion - 2)
+	root := sv.Hash()
+	sv.SetState(contract, slot1, common.Hash{})
+	assert.Equal(value, sv.GetState(contract, slot1))
+	assert.Equal(root, sv.Hash())
+
+	// From the fork, it is deleted from the storage trie of the contract
+	sv = newView(common.HeightEnableStorageSlotDeletion - 1)
+	sv.SetState(contract, slot1, common.Hash{})
+	assert.Equal(common.Hash{}, sv.GetState(contract, slot1))
+	assert.Equal(value, sv.GetState(contract, slot2))
+	assert.NotEqual(root, sv.Hash())
+
+	expected := NewStoreView(common.HeightEnableStorageSlotDeletion-1, common.Hash{}, backend.NewMemDatabase())
+	expected.SetState(contract, slot2, value)
+	assert.Equal(expected.Hash(), sv.Hash())
+
+	// Clearing an empty slot, or the last slot, leaves no storage
+	storageRoot := sv.GetAccount(contract).Root
+	sv.SetState(contract, slot1, common.Hash{})
+	assert.Equal(storageRoot, sv.GetAccount(contract).Root)
+	sv.SetState(contract, slot2, common.Hash{})
+	assert.Equal(core.EmptyRootHash, sv.GetAccount(contract).Root)
+}
+
+func TestStoreViewTraverseStorage(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	sv := NewStoreView(common.HeightEnableStorageSlotDeletion, common.Hash{}, backend.NewMemDatabase())
+	contract := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	other := common.HexToAddress("0x1000000000000000000000000000000000000002")
+	for i := int64(5); i > 0; i-- {
+		sv.SetState(contract, common.BigToHash(big.NewInt(i)), common.BigToHash(big.NewInt(10*i)))
+	}
+	sv.SetState(contract, common.BigToHash(big.NewInt(3)), common.Hash{})
+	sv.SetState(other, common.BigToHash(big.NewInt(1)), common.BigToHash(big.NewInt(1)))
+
+	// The slots are visited in the order of their keys, without the cleared ones
+	keys := []int64{}
+	err := sv.TraverseStorage(contract, func(key, value common.Hash) bool {
+		assert.Equal(10*key.Big().Int64(), value.Big().Int64())
+		keys = append(keys, key.Big().Int64())
+		return true
+	})
+	require.Nil(err)
+	assert.Equal([]int64{1, 2, 4, 5}, keys)
+
+	// Until the callback returns false
+	keys = []int64{}
+	err = sv.TraverseStorage(contract, func(key, value common.Hash) bool {
+		keys = append(keys, key.Big().Int64())
+		return len(keys) < 2
+	})
+	require.Nil(err)
+	assert.Equal([]int64{1, 2}, keys)
+
+	// Nothing to visit for an account without storage
+	err = sv.TraverseStorage(common.HexToAddress("0x1000000000000000000000000000000000000003"), func(key, value common.Hash) bool {
+		assert.Fail("no storage expected")
+		return true
+	})
+	assert.Nil(err)
+
+	// The traversal is recorded by the access recorder
+	recorder := NewAccessRecorder()
+	sv.SetAccessRecorder(recorder)
+	require.Nil(sv.TraverseStorage(contract, func(key, value common.Hash) bool { return true }))
+	assert.Contains(recorder.AccessList().Traversed, ContractStorageAccessKeyPrefix(contract))
+}
+
+func TestStoreViewStorageProof(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db := backend.NewMemDatabase()
+	sv := NewStoreView(common.HeightEnableStorageSlotDeletion, common.Hash{}, db)
+	contract := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	for i := int64(1); i <= 20; i++ {
+		sv.SetState(contract, common.BigToHash(big.NewInt(i)), common.BigToHash(big.NewInt(100+i)))
+	}
+	sv.SetState(contract, common.BigToHash(big.NewInt(7)), common.Hash{})
+	stateRoot := sv.Save()
+
+	// The proofs are checked against the state root only, from a view loaded from the database
+	sv = NewStoreView(common.HeightEnableStorageSlotDeletion, stateRoot, db)
+	require.NotNil(sv)
+	verify := func(addr common.Address, key common.Hash) common.Hash {
+		proof, err := sv.ProveStorage(addr, key)
+		require.Nil(err)
+
+		// The proof survives the encoding
+		encoded, err := rlp.EncodeToBytes(proof)
+		require.Nil(err)
+		decoded := &StorageProof{}
+		require.Nil(rlp.DecodeBytes(encoded, decoded))
+
+		value, err := VerifyStorageProof(stateRoot, decoded)
+		require.Nil(err)
+		return value
+	}
+	assert.Equal(common.BigToHash(big.NewInt(105)), verify(contract, common.BigToHash(big.NewInt(5))))
+	assert.Equal(common.BigToHash(big.NewInt(120)), verify(contract, common.BigToHash(big.NewInt(20))))
+
+	// As well as the empty slots, the cleared slots, and the slots of the missing accounts
+	assert.Equal(common.Hash{}, verify(contract, common.BigToHash(big.NewInt(7))))
+	assert.Equal(common.Hash{}, verify(contract, common.BigToHash(big.NewInt(21))))
+	assert.Equal(common.Hash{}, verify(common.HexToAddress("0x1000000000000000000000000000000000000002"), common.BigToHash(big.NewInt(1))))
+
+	// A proof does not verify against another state root
+	proof, err := sv.ProveStorage(contract, common.BigToHash(big.NewInt(5)))
+	require.Nil(err)
+	sv.SetState(contract, common.BigToHash(big.NewInt(5)), common.BigToHash(big.NewInt(1)))
+	_, err = VerifyStorageProof(sv.Hash(), proof)
+	assert.NotNil(err)
+}
@@ -27,7 +27,18 @@ type StoreView struct {
 
 	coinbaseTransactinProcessed bool
 	slashIntents                []types.SlashIntent
-	refund                      uint64 // Gas refund during smart contract execution
+	refund                      uint64          // Gas refund during smart contract execution
+	logs                        []*types.Log    // Temporary store of events during smart contract execution
+	snapshots                   []storeSnapshot // Taken by Snapshot(), indexed by the snapshot id
+
+	balanceJournal *BalanceJournal // records the balance changes if set, not carried over to the copies
+	accessRecorder *AccessRecorder // records the keys accessed if set, not carried over to the copies
+}
+
+// storeSnapshot is the state and the number of logs emitted at the time of a snapshot
+type storeSnapshot struct {
+	root    common.Hash
+	numLogs int
 }
 
 // NewStoreView creates an instance of the StoreView
@@ -71,6 +82,18 @@ func (sv *StoreView) Hash() common.Hash {
 	return sv.store.Hash()
 }
 
+// StoreError returns the first error encountered while accessing the underlying store, e.g. a missing
+// trie node. Once it is set, the view might not reflect the actual state and should be discarded.
+func (sv *StoreView) StoreError() error {
+	return sv.store.Err()
+}
+
+// RecordStoreError records an error accessing the underlying store on behalf of the view, e.g. by the storage
+// trie of a contract, or by a copy of the view whose changes are merged back, see StoreError()
+func (sv *StoreView) RecordStoreError(err error) {
+	sv.store.SetErr(err)
+}
+
 // Height returns the block height corresponding to the stored state
 func (sv *StoreView) Height() uint64 {
 	return sv.height
@@ -95,6 +118,9 @@ func (sv *StoreView) Save() common.Hash {
 
 // Get returns the value corresponding to the key
 func (sv *StoreView) Get(key common.Bytes) common.Bytes {
+	if sv.accessRecorder != nil {
+		sv.accessRecorder.recordRead(key)
+	}
 	value := sv.store.Get(key)
 	return value
 }
@@ -105,14 +131,33 @@ func (sv *StoreView) ProveVCP(vcpKey []byte, vp *core.VCPProof) error {
 
 // Delete removes the value corresponding to the key
 func (sv *StoreView) Delete(key common.Bytes) {
-	sv.store.Delete(key)
+	sv.deleteKey(key)
 }
 
 // Set returns the value corresponding to the key
 func (sv *StoreView) Set(key common.Bytes, value common.Bytes) {
+	if sv.accessRecorder != nil {
+		sv.accessRecorder.recordWrite(key)
+	}
 	sv.store.Set(key, value)
 }
 
+// deleteKey removes the value corresponding to the key, and returns whether it existed
+func (sv *StoreView) deleteKey(key common.Bytes) bool {
+	if sv.accessRecorder != nil {
+		sv.accessRecorder.recordWrite(key)
+	}
+	return sv.store.Delete(key)
+}
+
+// traverse visits the keys with the given prefix in order until the callback returns false
+func (sv *StoreView) traverse(prefix common.Bytes, cb func(key, value common.Bytes) bool) {
+	if sv.accessRecorder != nil {
+		sv.accessRecorder.recordTraversal(prefix)
+	}
+	sv.store.Traverse(prefix, cb)
+}
+
 // AddSlashIntent adds slashIntent
 func (sv *StoreView) AddSlashIntent(slashIntent types.SlashIntent) {
 	sv.slashIntents = append(sv.slashIntents, slashIntent)
@@ -160,14 +205,68 @@ func (sv *StoreView) SetAccount(addr common.Address, acc *types.Account) {
 		log.Panicf("Error writing account %v error: %v",
 			acc, err.Error())
 	}
+	if sv.balanceJournal != nil {
+		sv.balanceJournal.recordAccount(addr, sv.GetAccount(addr), acc)
+	}
 	sv.Set(AccountKey(addr), accBytes)
 }
 
 // DeleteAccount deletes an account.
 func (sv *StoreView) DeleteAccount(addr common.Address) {
+	if sv.balanceJournal != nil {
+		sv.balanceJournal.recordAccount(addr, sv.GetAccount(addr), nil)
+	}
 	sv.Delete(AccountKey(addr))
 }
 
+// NewAccount returns a new account for the address. If an account of the address was deleted before, the
+// new account starts from the sequence of the deleted one, so that its old transactions can not be replayed.
+func (sv *StoreView) NewAccount(addr common.Address) *types.Account {
+	account := types.NewAccount(addr)
+	account.Sequence = sv.GetAccountSequenceFloor(addr)
+	return account
+}
+
+// DeleteAccountWithTombstone deletes an account, and records its sequence as the sequence floor of the
+// account of the address if it is ever created again
+func (sv *StoreView) DeleteAccountWithTombstone(addr common.Address, sequence uint64) {
+	sequenceBytes, err := types.ToBytes(sequence)
+	if err != nil {
+		log.Panicf("Error writing account tombstone %v, error: %v",
+			sequence, err.Error())
+	}
+	sv.DeleteAccount(addr)
+	sv.Set(AccountTombstoneKey(addr), sequenceBytes)
+}
+
+// GetAccountSequenceFloor gets the sequence of the deleted account of the address, or 0 if there is none
+func (sv *StoreView) GetAccountSequenceFloor(addr common.Address) uint64 {
+	data := sv.Get(AccountTombstoneKey(addr))
+	if data == nil || len(data) == 0 {
+		return 0
+	}
+
+	var sequence uint64
+	err := types.FromBytes(data, &sequence)
+	if err != nil {
+		log.Panicf("Error reading account tombstone %X, error: %v",
+			data, err.Error())
+	}
+	return sequence
+}
+
+// SetBalanceJournal attaches the journal to record the subsequent balance changes, or detaches the
+// current journal if nil.
+func (sv *StoreView) SetBalanceJournal(journal *BalanceJournal) {
+	sv.balanceJournal = journal
+}
+
+// SetAccessRecorder attaches the recorder to record the subsequent key accesses, or detaches the
+// current recorder if nil.
+func (sv *StoreView) SetAccessRecorder(recorder *AccessRecorder) {
+	sv.accessRecorder = recorder
+}
+
 // SplitRuleExists checks if a split rule associated with the given resourceID already exists
 func (sv *StoreView) SplitRuleExists(resourceID string) bool {
 	return sv.GetSplitRule(resourceID) != nil
@@ -221,7 +320,7 @@ func (sv *StoreView) SetSplitRule(resourceID string, splitRule *types.SplitRule)
 // DeleteSplitRule deletes a split rule.
 func (sv *StoreView) DeleteSplitRule(resourceID string) bool {
 	key := SplitRuleKey(resourceID)
-	deleted := sv.store.Delete(key)
+	deleted := sv.deleteKey(key)
 	return deleted
 }
 
@@ -230,14 +329,14 @@ func (sv *StoreView) DeleteExpiredSplitRules(currentBlockHeight uint64) bool {
 	prefix := SplitRuleKeyPrefix()
 
 	expiredKeys := []common.Bytes{}
-	sv.store.Traverse(prefix, func(key, value common.Bytes) bool {
+	sv.traverse(prefix, func(key, value common.Bytes) bool {
 		var splitRule types.SplitRule
 		err := types.FromBytes(value, &splitRule)
 		if err != nil {
 			log.Panicf("Error reading splitRule %X error: %v", value, err.Error())
 		}
 
-		expired := (splitRule.EndBlockHeight < currentBlockHeight)
+		expired := splitRule.IsExpiredAt(currentBlockHeight)
 		if expired {
 			expiredKeys = append(expiredKeys, key)
 		}
@@ -245,7 +344,7 @@ func (sv *StoreView) DeleteExpiredSplitRules(currentBlockHeight uint64) bool {
 	})
 
 	for _, key := range expiredKeys {
-		deleted := sv.store.Delete(key)
+		deleted := sv.deleteKey(key)
 		if !deleted {
 			logger.Errorf("Failed to delete expired split rules")
 			return false
@@ -277,7 +376,136 @@ func (sv *StoreView) UpdateValidatorCandidatePool(vcp *core.ValidatorCandidatePo
 		log.Panicf("Error writing validator candidate pool %v, error: %v",
 			vcp, err.Error())
 	}
+	if sv.balanceJournal == nil && !sv.stakeIndexEnabled() && !sv.stakeReturnQueueEnabled() && !sv.stakeHistoryEnabled() {
+		sv.Set(ValidatorCandidatePoolKey(), vcpBytes)
+		return
+	}
+
+	before := sv.GetValidatorCandidatePool()
+	if sv.balanceJournal != nil {
+		sv.balanceJournal.recordValidatorCandidatePool(before, vcp)
+	}
 	sv.Set(ValidatorCandidatePoolKey(), vcpBytes)
+	if sv.stakeIndexEnabled() {
+		sv.updateStakeIndex(core.StakeForValidator, validatorStakeHolders(before), validatorStakeHolders(vcp))
+	}
+	if sv.stakeReturnQueueEnabled() {
+		sv.updateStakeReturnQueue(core.StakeForValidator, validatorStakeHolders(before), validatorStakeHolders(vcp))
+	}
+	if sv.stakeHistoryEnabled() {
+		sv.updateStakeHistory(validatorStakeHolders(before), validatorStakeHolders(vcp))
+	}
+}
+
+// GetGuardianCandidatePool gets the guardian candidate pool, which is empty until the first guardian stake
+func (sv *StoreView) GetGuardianCandidatePool() *core.GuardianCandidatePool {
+	gcp := &core.GuardianCandidatePool{}
+	data := sv.Get(GuardianCandidatePoolKey())
+	if data == nil || len(data) == 0 {
+		return gcp
+	}
+	err := types.FromBytes(data, gcp)
+	if err != nil {
+		log.Panicf("Error reading guardian candidate pool %X, error: %v",
+			data, err.Error())
+	}
+	return gcp
+}
+
+// UpdateGuardianCandidatePool updates the guardian candidate pool.
+func (sv *StoreView) UpdateGuardianCandidatePool(gcp *core.GuardianCandidatePool) {
+	gcpBytes, err := types.ToBytes(gcp)
+	if err != nil {
+		log.Panicf("Error writing guardian candidate pool %v, error: %v",
+			gcp, err.Error())
+	}
+	before := sv.GetGuardianCandidatePool()
+	if sv.balanceJournal != nil {
+		sv.balanceJournal.recordGuardianCandidatePool(before, gcp)
+	}
+	sv.Set(GuardianCandidatePoolKey(), gcpBytes)
+	if sv.stakeIndexEnabled() {
+		sv.updateStakeIndex(core.StakeForGuardian, before.SortedGuardians, gcp.SortedGuardians)
+	}
+	if sv.stakeReturnQueueEnabled() {
+		sv.updateStakeReturnQueue(core.StakeForGuardian, before.SortedGuardians, gcp.SortedGuardians)
+	}
+}
+
+// GetValidatorLivenessTracker gets the liveness records of the validators, which are empty until a validator
+// misses a block
+func (sv *StoreView) GetValidatorLivenessTracker() *core.ValidatorLivenessTracker {
+	vlt := &core.ValidatorLivenessTracker{}
+	data := sv.Get(ValidatorLivenessKey())
+	if len(data) == 0 {
+		return vlt
+	}
+	err := types.FromBytes(data, vlt)
+	if err != nil {
+		log.Panicf("Error reading validator liveness tracker %X, error: %v", data, err.Error())
+	}
+	return vlt
+}
+
+// UpdateValidatorLivenessTracker updates the liveness records of the validators
+func (sv *StoreView) UpdateValidatorLivenessTracker(vlt *core.ValidatorLivenessTracker) {
+	if len(vlt.SortedRecords) == 0 {
+		sv.Delete(ValidatorLivenessKey())
+		return
+	}
+	vltBytes, err := types.ToBytes(vlt)
+	if err != nil {
+		log.Panicf("Error writing validator liveness tracker %v, error: %v", vlt, err.Error())
+	}
+	sv.Set(ValidatorLivenessKey(), vltBytes)
+}
+
+// GetTxInclusionParams gets the parameters of the reward withholding for the underfilled blocks, which disable the
+// withholding unless set
+func (sv *StoreView) GetTxInclusionParams() *core.TxInclusionParams {
+	tip := &core.TxInclusionParams{}
+	data := sv.Get(TxInclusionParamsKey())
+	if len(data) == 0 {
+		return tip
+	}
+	err := types.FromBytes(data, tip)
+	if err != nil {
+		log.Panicf("Error reading tx inclusion params %X, error: %v", data, err.Error())
+	}
+	return tip
+}
+
+// UpdateTxInclusionParams updates the parameters of the reward withholding for the underfilled blocks
+func (sv *StoreView) UpdateTxInclusionParams(tip *core.TxInclusionParams) {
+	tipBytes, err := types.ToBytes(tip)
+	if err != nil {
+		log.Panicf("Error writing tx inclusion params %v, error: %v", tip, err.Error())
+	}
+	sv.Set(TxInclusionParamsKey(), tipBytes)
+}
+
+// GetTxInclusionTracker gets the fullness of the recent blocks and the underfilled blocks of the proposers, which
+// are empty until the first block at or above common.HeightEnableRewardWithholding
+func (sv *StoreView) GetTxInclusionTracker() *core.TxInclusionTracker {
+	tit := &core.TxInclusionTracker{}
+	data := sv.Get(TxInclusionTrackerKey())
+	if len(data) == 0 {
+		return tit
+	}
+	err := types.FromBytes(data, tit)
+	if err != nil {
+		log.Panicf("Error reading tx inclusion tracker %X, error: %v", data, err.Error())
+	}
+	return tit
+}
+
+// UpdateTxInclusionTracker updates the fullness of the recent blocks and the underfilled blocks of the proposers
+func (sv *StoreView) UpdateTxInclusionTracker(tit *core.TxInclusionTracker) {
+	titBytes, err := types.ToBytes(tit)
+	if err != nil {
+		log.Panicf("Error writing tx inclusion tracker %v, error: %v", tit, err.Error())
+	}
+	sv.Set(TxInclusionTrackerKey(), titBytes)
 }
 
 // GetStakeTransactionHeightList gets the heights of blocks that contain stake related transactions
@@ -306,6 +534,663 @@ func (sv *StoreView) UpdateStakeTransactionHeightList(hl *types.HeightList) {
 	sv.Set(StakeTransactionHeightListKey(), hlBytes)
 }
 
+// GetBlockGasLimit gets the gas budget of a block, which is types.DefaultBlockGasLimit unless set
+func (sv *StoreView) GetBlockGasLimit() uint64 {
+	data := sv.Get(BlockGasLimitKey())
+	if data == nil || len(data) == 0 {
+		return types.DefaultBlockGasLimit
+	}
+
+	var limit uint64
+	err := types.FromBytes(data, &limit)
+	if err != nil {
+		log.Panicf("Error reading block gas limit %X, error: %v",
+			data, err.Error())
+	}
+	return limit
+}
+
+// UpdateBlockGasLimit updates the gas budget of a block
+func (sv *StoreView) UpdateBlockGasLimit(limit uint64) {
+	limitBytes, err := types.ToBytes(limit)
+	if err != nil {
+		log.Panicf("Error writing block gas limit %v, error: %v",
+			limit, err.Error())
+	}
+	sv.Set(BlockGasLimitKey(), limitBytes)
+}
+
+// GetMaxTxSize gets the max size of a raw regular transaction, which is types.DefaultMaxTxSize unless set
+func (sv *StoreView) GetMaxTxSize() uint64 {
+	data := sv.Get(MaxTxSizeKey())
+	if data == nil || len(data) == 0 {
+		return types.DefaultMaxTxSize
+	}
+
+	var size uint64
+	err := types.FromBytes(data, &size)
+	if err != nil {
+		log.Panicf("Error reading max tx size %X, error: %v",
+			data, err.Error())
+	}
+	return size
+}
+
+// UpdateMaxTxSize updates the max size of a raw regular transaction
+func (sv *StoreView) UpdateMaxTxSize(size uint64) {
+	sizeBytes, err := types.ToBytes(size)
+	if err != nil {
+		log.Panicf("Error writing max tx size %v, error: %v",
+			size, err.Error())
+	}
+	sv.Set(MaxTxSizeKey(), sizeBytes)
+}
+
+// GetDustThreshold gets the minimum non-zero coin amounts of a send transaction output, which are
+// types.DefaultDustThresholdThetaWei and types.DefaultDustThresholdTFuelWei unless set
+func (sv *StoreView) GetDustThreshold() types.Coins {
+	return sv.getCoinsParam(DustThresholdKey(),
+		types.DefaultDustThresholdThetaWei, types.DefaultDustThresholdTFuelWei)
+}
+
+// UpdateDustThreshold updates the minimum non-zero coin amounts of a send transaction output
+func (sv *StoreView) UpdateDustThreshold(threshold types.Coins) {
+	sv.setCoinsParam(DustThresholdKey(), threshold)
+}
+
+// GetMinNewAccountAmount gets the minimum coin amounts of a send transaction output creating a new account,
+// which are types.DefaultMinNewAccountThetaWei and types.DefaultMinNewAccountTFuelWei unless set
+func (sv *StoreView) GetMinNewAccountAmount() types.Coins {
+	return sv.getCoinsParam(MinNewAccountAmountKey(),
+		types.DefaultMinNewAccountThetaWei, types.DefaultMinNewAccountTFuelWei)
+}
+
+// UpdateMinNewAccountAmount updates the minimum coin amounts of a send transaction output creating a new account
+func (sv *StoreView) UpdateMinNewAccountAmount(amount types.Coins) {
+	sv.setCoinsParam(MinNewAccountAmountKey(), amount)
+}
+
+// GetFeeSchedule gets the minimum fees of the regular transactions, which is types.DefaultFeeSchedule() unless set
+func (sv *StoreView) GetFeeSchedule() *types.FeeSchedule {
+	data := sv.Get(FeeScheduleKey())
+	if data == nil || len(data) == 0 {
+		return types.DefaultFeeSchedule()
+	}
+
+	fs := &types.FeeSchedule{}
+	err := types.FromBytes(data, fs)
+	if err != nil {
+		log.Panicf("Error reading fee schedule %X, error: %v",
+			data, err.Error())
+	}
+	return fs
+}
+
+// UpdateFeeSchedule updates the minimum fees of the regular transactions
+func (sv *StoreView) UpdateFeeSchedule(fs *types.FeeSchedule) {
+	fsBytes, err := types.ToBytes(fs)
+	if err != nil {
+		log.Panicf("Error writing fee schedule %v, error: %v",
+			fs, err.Error())
+	}
+	sv.Set(FeeScheduleKey(), fsBytes)
+}
+
+// GetIntrinsicGasSchedule gets the intrinsic gas of the regular transactions, which is
+// types.DefaultIntrinsicGasSchedule() unless set
+func (sv *StoreView) GetIntrinsicGasSchedule() *types.IntrinsicGasSchedule {
+	data := sv.Get(IntrinsicGasScheduleKey())
+	if data == nil || len(data) == 0 {
+		return types.DefaultIntrinsicGasSchedule()
+	}
+
+	gs := &types.IntrinsicGasSchedule{}
+	err := types.FromBytes(data, gs)
+	if err != nil {
+		log.Panicf("Error reading intrinsic gas schedule %X, error: %v",
+			data, err.Error())
+	}
+	return gs
+}
+
+// UpdateIntrinsicGasSchedule updates the intrinsic gas of the regular transactions
+func (sv *StoreView) UpdateIntrinsicGasSchedule(gs *types.IntrinsicGasSchedule) {
+	gsBytes, err := types.ToBytes(gs)
+	if err != nil {
+		log.Panicf("Error writing intrinsic gas schedule %v, error: %v",
+			gs, err.Error())
+	}
+	sv.Set(IntrinsicGasScheduleKey(), gsBytes)
+}
+
+// GetTotalSupply gets the total coin supply, i.e. the coins issued at genesis and by the coinbase transactions,
+// less the burned fees and the coins destroyed by the BurnTxs. It returns nil if the total supply is not
+// tracked, i.e. it was not set at genesis.
+func (sv *StoreView) GetTotalSupply() *types.Coins {
+	data := sv.Get(TotalSupplyKey())
+	if data == nil || len(data) == 0 {
+		return nil
+	}
+
+	var supply types.Coins
+	err := types.FromBytes(data, &supply)
+	if err != nil {
+		log.Panicf("Error reading total supply %X, error: %v",
+			data, err.Error())
+	}
+	supply = supply.NoNil()
+	return &supply
+}
+
+// UpdateTotalSupply sets the total coin supply, which starts the tracking of the total supply
+func (sv *StoreView) UpdateTotalSupply(supply types.Coins) {
+	supplyBytes, err := types.ToBytes(supply.NoNil())
+	if err != nil {
+		log.Panicf("Error writing total supply %v, error: %v",
+			supply, err.Error())
+	}
+	sv.Set(TotalSupplyKey(), supplyBytes)
+}
+
+// IncreaseTotalSupply adds the issued coins to the total supply, if it is tracked
+func (sv *StoreView) IncreaseTotalSupply(coins types.Coins) {
+	supply := sv.GetTotalSupply()
+	if supply == nil {
+		return
+	}
+	sv.UpdateTotalSupply(supply.Plus(coins.NoNil()))
+}
+
+// DecreaseTotalSupply takes the destroyed coins out of the total supply, if it is tracked
+func (sv *StoreView) DecreaseTotalSupply(coins types.Coins) {
+	supply := sv.GetTotalSupply()
+	if supply == nil {
+		return
+	}
+	sv.UpdateTotalSupply(supply.Minus(coins.NoNil()))
+}
+
+// GetFeePolicy gets the split of the tx fees between burning and the block proposer, which is
+// types.DefaultFeePolicy() unless set
+func (sv *StoreView) GetFeePolicy() *types.FeePolicy {
+	data := sv.Get(FeePolicyKey())
+	if data == nil || len(data) == 0 {
+		return types.DefaultFeePolicy()
+	}
+
+	fp := &types.FeePolicy{}
+	err := types.FromBytes(data, fp)
+	if err != nil {
+		log.Panicf("Error reading fee policy %X, error: %v",
+			data, err.Error())
+	}
+	return fp
+}
+
+// UpdateFeePolicy updates the split of the tx fees between burning and the block proposer
+func (sv *StoreView) UpdateFeePolicy(fp *types.FeePolicy) {
+	fpBytes, err := types.ToBytes(fp)
+	if err != nil {
+		log.Panicf("Error writing fee policy %v, error: %v",
+			fp, err.Error())
+	}
+	sv.Set(FeePolicyKey(), fpBytes)
+}
+
+// GetBurnedFees gets the cumulative tx fees burned since common.HeightEnableFeeDistribution
+func (sv *StoreView) GetBurnedFees() types.Coins {
+	return sv.getCoinsParam(BurnedFeesKey(), 0, 0)
+}
+
+// AddBurnedFees adds the burned share of a tx fee to the cumulative burned fees
+func (sv *StoreView) AddBurnedFees(fee types.Coins) {
+	sv.setCoinsParam(BurnedFeesKey(), sv.GetBurnedFees().Plus(fee.NoNil()))
+}
+
+// GetUndistributedFees gets the shares of the tx fees set aside for the proposer of the next block, which
+// claims them with the coinbase transaction
+func (sv *StoreView) GetUndistributedFees() types.Coins {
+	return sv.getCoinsParam(UndistributedFeesKey(), 0, 0)
+}
+
+// AddUndistributedFees sets aside the distributed share of a tx fee for the proposer of the next block
+func (sv *StoreView) AddUndistributedFees(fee types.Coins) {
+	sv.setCoinsParam(UndistributedFeesKey(), sv.GetUndistributedFees().Plus(fee.NoNil()))
+}
+
+// ClearUndistributedFees clears the tx fees set aside, once claimed by the coinbase transaction
+func (sv *StoreView) ClearUndistributedFees() {
+	sv.deleteKey(UndistributedFeesKey())
+}
+
+// GetCoinbaseOverflow gets the rewards which did not fit in the previous coinbase transactions, sorted by address,
+// to be paid by the next coinbase transaction
+func (sv *StoreView) GetCoinbaseOverflow() []types.TxOutput {
+	data := sv.Get(CoinbaseOverflowKey())
+	if data == nil || len(data) == 0 {
+		return nil
+	}
+
+	overflow := []types.TxOutput{}
+	err := types.FromBytes(data, &overflow)
+	if err != nil {
+		log.Panicf("Error reading coinbase overflow %X, error: %v",
+			data, err.Error())
+	}
+	return overflow
+}
+
+// UpdateCoinbaseOverflow updates the rewards carried over to the next coinbase transaction, clearing them if empty
+func (sv *StoreView) UpdateCoinbaseOverflow(overflow []types.TxOutput) {
+	if len(overflow) == 0 {
+		sv.deleteKey(CoinbaseOverflowKey())
+		return
+	}
+	overflowBytes, err := types.ToBytes(overflow)
+	if err != nil {
+		log.Panicf("Error writing coinbase overflow %v, error: %v",
+			overflow, err.Error())
+	}
+	sv.Set(CoinbaseOverflowKey(), overflowBytes)
+}
+
+// GetDoubleSignSlashPercentage gets the percentage of the stake backing a double signing validator that is
+// burned, which is types.DefaultDoubleSignSlashPercentage unless set
+func (sv *StoreView) GetDoubleSignSlashPercentage() uint64 {
+	data := sv.Get(DoubleSignSlashPercentageKey())
+	if data == nil || len(data) == 0 {
+		return types.DefaultDoubleSignSlashPercentage
+	}
+
+	var percentage uint64
+	err := types.FromBytes(data, &percentage)
+	if err != nil {
+		log.Panicf("Error reading double sign slash percentage %X, error: %v",
+			data, err.Error())
+	}
+	return percentage
+}
+
+// UpdateDoubleSignSlashPercentage updates the percentage of the stake backing a double signing validator that
+// is burned, which is capped at 100
+func (sv *StoreView) UpdateDoubleSignSlashPercentage(percentage uint64) {
+	if percentage > 100 {
+		percentage = 100
+	}
+	percentageBytes, err := types.ToBytes(percentage)
+	if err != nil {
+		log.Panicf("Error writing double sign slash percentage %v, error: %v",
+			percentage, err.Error())
+	}
+	sv.Set(DoubleSignSlashPercentageKey(), percentageBytes)
+}
+
+// DoubleSignSlashed returns whether the validator was already slashed for double signing at the given height
+func (sv *StoreView) DoubleSignSlashed(offender common.Address, height uint64) bool {
+	data := sv.Get(DoubleSignSlashKey(offender, height))
+	return len(data) > 0
+}
+
+// MarkDoubleSignSlashed records that the validator was slashed for double signing at the given height, so that
+// the same offense is not slashed twice
+func (sv *StoreView) MarkDoubleSignSlashed(offender common.Address, height uint64) {
+	sv.Set(DoubleSignSlashKey(offender, height), common.Bytes{0x01})
+}
+
+// GetStakeHolderSlashHeight gets the height the stake holder was last slashed at for double signing, which is
+// zero if it was never slashed
+func (sv *StoreView) GetStakeHolderSlashHeight(holder common.Address) uint64 {
+	data := sv.Get(StakeHolderSlashHeightKey(holder))
+	if data == nil || len(data) == 0 {
+		return 0
+	}
+
+	var height uint64
+	err := types.FromBytes(data, &height)
+	if err != nil {
+		log.Panicf("Error reading stake holder slash height %X, error: %v",
+			data, err.Error())
+	}
+	return height
+}
+
+// SetStakeHolderSlashHeight sets the height the stake holder was last slashed at for double signing
+func (sv *StoreView) SetStakeHolderSlashHeight(holder common.Address, height uint64) {
+	heightBytes, err := types.ToBytes(height)
+	if err != nil {
+		log.Panicf("Error writing stake holder slash height %v, error: %v",
+			height, err.Error())
+	}
+	sv.Set(StakeHolderSlashHeightKey(holder), heightBytes)
+}
+
+// GetStakeHolderSlashReturnHeight gets the return height of the stakes withdrawn by the last slash of the stake
+// holder, which is zero if it is not recorded, i.e. the holder was never slashed, or only slashed before
+// common.HeightEnableStakingParams
+func (sv *StoreView) GetStakeHolderSlashReturnHeight(holder common.Address) uint64 {
+	data := sv.Get(StakeHolderSlashReturnHeightKey(holder))
+	if data == nil || len(data) == 0 {
+		return 0
+	}
+
+	var height uint64
+	err := types.FromBytes(data, &height)
+	if err != nil {
+		log.Panicf("Error reading stake holder slash return height %X, error: %v",
+			data, err.Error())
+	}
+	return height
+}
+
+// SetStakeHolderSlashReturnHeight sets the return height of the stakes withdrawn by the last slash of the stake
+// holder
+func (sv *StoreView) SetStakeHolderSlashReturnHeight(holder common.Address, height uint64) {
+	heightBytes, err := types.ToBytes(height)
+	if err != nil {
+		log.Panicf("Error writing stake holder slash return height %v, error: %v",
+			height, err.Error())
+	}
+	sv.Set(StakeHolderSlashReturnHeightKey(holder), heightBytes)
+}
+
+// GetStakeEjectionReturnHeight gets the return height of the stake of the source last ejected by the holder, which
+// is zero if the holder never ejected the source
+func (sv *StoreView) GetStakeEjectionReturnHeight(holder common.Address, source common.Address) uint64 {
+	data := sv.Get(StakeEjectionReturnHeightKey(holder, source))
+	if data == nil || len(data) == 0 {
+		return 0
+	}
+
+	var height uint64
+	err := types.FromBytes(data, &height)
+	if err != nil {
+		log.Panicf("Error reading stake ejection return height %X, error: %v",
+			data, err.Error())
+	}
+	return height
+}
+
+// SetStakeEjectionReturnHeight sets the return height of the stake of the source last ejected by the holder
+func (sv *StoreView) SetStakeEjectionReturnHeight(holder common.Address, source common.Address, height uint64) {
+	heightBytes, err := types.ToBytes(height)
+	if err != nil {
+		log.Panicf("Error writing stake ejection return height %v, error: %v",
+			height, err.Error())
+	}
+	sv.Set(StakeEjectionReturnHeightKey(holder, source), heightBytes)
+}
+
+// GetStakeReturnAddress gets the address the stakes of the source withdrawn from the holder for the purpose are
+// returned to at the return height, and whether it is set. The stakes are returned to the source if not.
+func (sv *StoreView) GetStakeReturnAddress(purpose uint8, holder common.Address, source common.Address, returnHeight uint64) (common.Address, bool) {
+	data := sv.Get(StakeReturnAddressKey(purpose, holder, source, returnHeight))
+	if len(data) == 0 {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(data), true
+}
+
+// SetStakeReturnAddress sets the address the stakes of the source withdrawn from the holder for the purpose are
+// returned to at the return height
+func (sv *StoreView) SetStakeReturnAddress(purpose uint8, holder common.Address, source common.Address, returnHeight uint64, returnAddress common.Address) {
+	sv.Set(StakeReturnAddressKey(purpose, holder, source, returnHeight), returnAddress.Bytes())
+}
+
+// DeleteStakeReturnAddress deletes the return address of the stakes of the source withdrawn from the holder for
+// the purpose at the return height, once they are returned or their withdrawal is cancelled
+func (sv *StoreView) DeleteStakeReturnAddress(purpose uint8, holder common.Address, source common.Address, returnHeight uint64) {
+	sv.Delete(StakeReturnAddressKey(purpose, holder, source, returnHeight))
+}
+
+// RotateValidatorKey moves the records the stake holder keeps by address, i.e. its commission, its metadata, the
+// slash and ejection return heights of its stakes from the sources and the return addresses of its withdrawn
+// validator stakes, to the new holder address, and records the rotation. The stakes themselves are re-pointed in the candidate pool by the caller.
+func (sv *StoreView) RotateValidatorKey(holder common.Address, newHolder common.Address, sources []common.Address) {
+	moveRecord := func(key common.Bytes, newKey common.Bytes) {
+		data := sv.Get(key)
+		if len(data) == 0 {
+			return
+		}
+		sv.Set(newKey, data)
+		sv.Delete(key)
+	}
+
+	moveRecord(StakeCommissionKey(holder), StakeCommissionKey(newHolder))
+	moveRecord(ValidatorMetadataKey(holder), ValidatorMetadataKey(newHolder))
+	moveRecord(StakeHolderSlashReturnHeightKey(holder), StakeHolderSlashReturnHeightKey(newHolder))
+	for _, source := range sources {
+		moveRecord(StakeEjectionReturnHeightKey(holder, source), StakeEjectionReturnHeightKey(newHolder, source))
+	}
+	prefix := StakeReturnAddressKeyPrefix(core.StakeForValidator, holder)
+	newPrefix := StakeReturnAddressKeyPrefix(core.StakeForValidator, newHolder)
+	returnAddressKeys := []common.Bytes{}
+	sv.traverse(prefix, func(key, value common.Bytes) bool {
+		returnAddressKeys = append(returnAddressKeys, common.CopyBytes(key))
+		return true
+	})
+	for _, key := range returnAddressKeys {
+		moveRecord(key, append(common.CopyBytes(newPrefix), key[len(prefix):]...))
+	}
+	sv.Set(RotatedValidatorKeyKey(holder), newHolder.Bytes())
+}
+
+// GetRotatedValidatorKey gets the address the stake holder rotated its key to, and whether it rotated its key
+func (sv *StoreView) GetRotatedValidatorKey(holder common.Address) (common.Address, bool) {
+	data := sv.Get(RotatedValidatorKeyKey(holder))
+	if len(data) == 0 {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(data), true
+}
+
+// GetStakeCommission gets the commission of the stake holder in percent, which is zero unless set
+func (sv *StoreView) GetStakeCommission(holder common.Address) uint8 {
+	data := sv.Get(StakeCommissionKey(holder))
+	if data == nil || len(data) == 0 {
+		return 0
+	}
+
+	var commission uint8
+	err := types.FromBytes(data, &commission)
+	if err != nil {
+		log.Panicf("Error reading stake commission %X, error: %v",
+			data, err.Error())
+	}
+	return commission
+}
+
+// SetStakeCommission sets the commission of the stake holder in percent, which is capped at
+// types.MaxStakeCommission
+func (sv *StoreView) SetStakeCommission(holder common.Address, commission uint8) {
+	if commission > types.MaxStakeCommission {
+		commission = types.MaxStakeCommission
+	}
+	commissionBytes, err := types.ToBytes(commission)
+	if err != nil {
+		log.Panicf("Error writing stake commission %v, error: %v",
+			commission, err.Error())
+	}
+	sv.Set(StakeCommissionKey(holder), commissionBytes)
+}
+
+// GetValidatorMetadata gets the metadata of the stake holder, or nil if it is not set
+func (sv *StoreView) GetValidatorMetadata(holder common.Address) *types.ValidatorMetadata {
+	data := sv.Get(ValidatorMetadataKey(holder))
+	if data == nil || len(data) == 0 {
+		return nil
+	}
+
+	metadata := &types.ValidatorMetadata{}
+	err := types.FromBytes(data, metadata)
+	if err != nil {
+		log.Panicf("Error reading validator metadata %X, error: %v",
+			data, err.Error())
+	}
+	return metadata
+}
+
+// SetValidatorMetadata sets the metadata of the stake holder, the empty metadata is deleted
+func (sv *StoreView) SetValidatorMetadata(holder common.Address, metadata types.ValidatorMetadata) {
+	if metadata.IsEmpty() {
+		sv.Delete(ValidatorMetadataKey(holder))
+		return
+	}
+	metadataBytes, err := types.ToBytes(&metadata)
+	if err != nil {
+		log.Panicf("Error writing validator metadata %v, error: %v",
+			metadata, err.Error())
+	}
+	sv.Set(ValidatorMetadataKey(holder), metadataBytes)
+}
+
+// GetMaxNumValidators gets the max number of validators in the validator set, which is
+// core.DefaultMaxNumValidators unless set
+func (sv *StoreView) GetMaxNumValidators() int {
+	data := sv.Get(MaxNumValidatorsKey())
+	if data == nil || len(data) == 0 {
+		return core.DefaultMaxNumValidators
+	}
+
+	var maxNumValidators uint64
+	err := types.FromBytes(data, &maxNumValidators)
+	if err != nil {
+		log.Panicf("Error reading max number of validators %X, error: %v",
+			data, err.Error())
+	}
+	return int(maxNumValidators)
+}
+
+// UpdateMaxNumValidators updates the max number of validators in the validator set, which is at least one. The
+// change takes effect with the validator set derived from the state, i.e. two blocks later.
+func (sv *StoreView) UpdateMaxNumValidators(maxNumValidators int) {
+	if maxNumValidators < 1 {
+		maxNumValidators = 1
+	}
+	maxNumValidatorsBytes, err := types.ToBytes(uint64(maxNumValidators))
+	if err != nil {
+		log.Panicf("Error writing max number of validators %v, error: %v",
+			maxNumValidators, err.Error())
+	}
+	sv.Set(MaxNumValidatorsKey(), maxNumValidatorsBytes)
+}
+
+// GetMinValidatorStakeDeposit gets the minimum amount of a validator stake deposit, which is
+// core.MinValidatorStakeDeposit unless set
+func (sv *StoreView) GetMinValidatorStakeDeposit() *big.Int {
+	data := sv.Get(MinValidatorStakeDepositKey())
+	if data == nil || len(data) == 0 {
+		return new(big.Int).Set(core.MinValidatorStakeDeposit)
+	}
+
+	minStake := new(big.Int)
+	err := types.FromBytes(data, minStake)
+	if err != nil {
+		log.Panicf("Error reading min validator stake deposit %X, error: %v",
+			data, err.Error())
+	}
+	return minStake
+}
+
+// UpdateMinValidatorStakeDeposit updates the minimum amount of a validator stake deposit. It only applies to the
+// new deposits, the stakes deposited under a different minimum stay as they are.
+func (sv *StoreView) UpdateMinValidatorStakeDeposit(minStake *big.Int) {
+	minStakeBytes, err := types.ToBytes(minStake)
+	if err != nil {
+		log.Panicf("Error writing min validator stake deposit %v, error: %v",
+			minStake, err.Error())
+	}
+	sv.Set(MinValidatorStakeDepositKey(), minStakeBytes)
+}
+
+// GetReturnLockingPeriod gets the number of blocks a withdrawn validator stake is locked for before it returns to
+// its source, which is core.ReturnLockingPeriod unless set
+func (sv *StoreView) GetReturnLockingPeriod() uint64 {
+	data := sv.Get(ReturnLockingPeriodKey())
+	if data == nil || len(data) == 0 {
+		return core.ReturnLockingPeriod
+	}
+
+	var period uint64
+	err := types.FromBytes(data, &period)
+	if err != nil {
+		log.Panicf("Error reading return locking period %X, error: %v",
+			data, err.Error())
+	}
+	return period
+}
+
+// UpdateReturnLockingPeriod updates the number of blocks a withdrawn validator stake is locked for. It only applies
+// to the new withdrawals, the stakes already withdrawn keep their return heights.
+func (sv *StoreView) UpdateReturnLockingPeriod(period uint64) {
+	periodBytes, err := types.ToBytes(period)
+	if err != nil {
+		log.Panicf("Error writing return locking period %v, error: %v",
+			period, err.Error())
+	}
+	sv.Set(ReturnLockingPeriodKey(), periodBytes)
+}
+
+func (sv *StoreView) getCoinsParam(key common.Bytes, defaultThetaWei, defaultTFuelWei uint64) types.Coins {
+	data := sv.Get(key)
+	if data == nil || len(data) == 0 {
+		return types.Coins{
+			ThetaWei: new(big.Int).SetUint64(defaultThetaWei),
+			TFuelWei: new(big.Int).SetUint64(defaultTFuelWei),
+		}
+	}
+
+	var coins types.Coins
+	err := types.FromBytes(data, &coins)
+	if err != nil {
+		log.Panicf("Error reading chain parameter %v %X, error: %v",
+			string(key), data, err.Error())
+	}
+	return coins.NoNil()
+}
+
+func (sv *StoreView) setCoinsParam(key common.Bytes, coins types.Coins) {
+	coinsBytes, err := types.ToBytes(coins.NoNil())
+	if err != nil {
+		log.Panicf("Error writing chain parameter %v %v, error: %v",
+			string(key), coins, err.Error())
+	}
+	sv.Set(key, coinsBytes)
+}
+
+// GetMaxNumRegularTxsPerBlock gets the max number of regular transactions in the block at the given height,
+// which is core.MaxNumRegularTxsPerBlock unless set
+func (sv *StoreView) GetMaxNumRegularTxsPerBlock(height uint64) int {
+	return int(sv.getRegularTxLimit().LimitAt(height))
+}
+
+// ScheduleMaxNumRegularTxsPerBlock changes the max number of regular transactions in a block, from the block
+// at the given height on
+func (sv *StoreView) ScheduleMaxNumRegularTxsPerBlock(limit int, height uint64) {
+	rtl := sv.getRegularTxLimit()
+	rtl.Schedule(uint64(limit), height)
+	rtlBytes, err := types.ToBytes(rtl)
+	if err != nil {
+		log.Panicf("Error writing regular tx limit %v, error: %v",
+			rtl, err.Error())
+	}
+	sv.Set(RegularTxLimitKey(), rtlBytes)
+}
+
+func (sv *StoreView) getRegularTxLimit() *types.RegularTxLimit {
+	rtl := &types.RegularTxLimit{Limit: uint64(core.MaxNumRegularTxsPerBlock)}
+	data := sv.Get(RegularTxLimitKey())
+	if data == nil || len(data) == 0 {
+		return rtl
+	}
+
+	err := types.FromBytes(data, rtl)
+	if err != nil {
+		log.Panicf("Error reading regular tx limit %X, error: %v",
+			data, err.Error())
+	}
+	return rtl
+}
+
 func (sv *StoreView) GetStore() *treestore.TreeStore {
 	return sv.store
 }
@@ -314,8 +1199,13 @@ func (sv *StoreView) GetStore() *treestore.TreeStore {
 // ---------- Implement vm.StateDB interface -----------
 //
 
+// CreateAccount creates the account of a new contract. The coins sent to the contract address before the
+// contract is deployed are kept, same as in Ethereum, rather than silently lost.
 func (sv *StoreView) CreateAccount(addr common.Address) {
-	account := types.NewAccount(addr)
+	account := sv.NewAccount(addr)
+	if existing := sv.GetAccount(addr); existing != nil {
+		account.Balance = existing.Balance
+	}
 	sv.SetAccount(addr, account)
 }
 
@@ -324,7 +1214,7 @@ func (sv *StoreView) GetOrCreateAccount(addr common.Address) *types.Account {
 	if account != nil {
 		return account
 	}
-	return types.NewAccount(addr)
+	return sv.NewAccount(addr)
 }
 
 func (sv *StoreView) SubBalance(addr common.Address, amount *big.Int) {
@@ -332,8 +1222,7 @@ func (sv *StoreView) SubBalance(addr common.Address, amount *big.Int) {
 		return
 	}
 	account := sv.GetAccount(addr)
-	account.Balance = account.Balance.NoNil()
-	account.Balance.TFuelWei.Sub(account.Balance.TFuelWei, amount)
+	account.Balance = account.Balance.Minus(types.Coins{TFuelWei: amount})
 	sv.SetAccount(addr, account)
 }
 
@@ -342,8 +1231,7 @@ func (sv *StoreView) AddBalance(addr common.Address, amount *big.Int) {
 		return
 	}
 	account := sv.GetAccount(addr)
-	account.Balance = account.Balance.NoNil()
-	account.Balance.TFuelWei.Add(account.Balance.TFuelWei, amount)
+	account.Balance = account.Balance.Plus(types.Coins{TFuelWei: amount})
 	sv.SetAccount(addr, account)
 }
 
@@ -429,42 +1317,80 @@ func (sv *StoreView) GetState(addr common.Address, key common.Hash) common.Hash
 	if account == nil {
 		return common.Hash{}
 	}
-	enc, err := sv.getAccountStorage(account).TryGet(key[:])
+	if sv.accessRecorder != nil {
+		sv.accessRecorder.recordRead(ContractStorageAccessKey(addr, key))
+	}
+	storage := sv.getAccountStorage(account)
+	if storage == nil {
+		sv.RecordStoreError(fmt.Errorf("Failed to load the storage of %v", addr.Hex()))
+		return common.Hash{}
+	}
+	enc, err := storage.TryGet(key[:])
 	if err != nil {
-		log.Panic(err)
+		sv.RecordStoreError(err) // not an empty slot, see StoreError()
+		return common.Hash{}
 	}
-	if len(enc) > 0 {
-		_, content, _, err := rlp.Split(enc)
-		if err != nil {
-			log.Panic(err)
-		}
-		return common.BytesToHash(content)
+	value, err := decodeStorageValue(enc)
+	if err != nil {
+		log.Panic(err)
 	}
-	return common.Hash{}
+	return value
 }
 
 func (sv *StoreView) SetState(addr common.Address, key, val common.Hash) {
 	account := sv.GetAccount(addr)
 	if account == nil {
-		account = types.NewAccount(addr)
+		account = sv.NewAccount(addr)
+	}
+	if sv.accessRecorder != nil {
+		sv.accessRecorder.recordWrite(ContractStorageAccessKey(addr, key))
 	}
 	tree := sv.getAccountStorage(account)
-	if (val == common.Hash{}) {
-		tree.TryDelete(key[:])
+	if tree == nil {
+		sv.RecordStoreError(fmt.Errorf("Failed to load the storage of %v", addr.Hex()))
 		return
 	}
-	// Encoding []byte cannot fail, ok to ignore the error.
-	v, _ := rlp.EncodeToBytes(bytes.TrimLeft(val[:], "\x00"))
-	tree.TryUpdate(key[:], v)
+	if (val == common.Hash{}) {
+		if !sv.storageSlotDeletionEnabled() {
+			tree.TryDelete(key[:]) // dropped with the tree, the slot keeps its previous value
+			return
+		}
+		enc, err := tree.TryGet(key[:])
+		if err != nil {
+			sv.RecordStoreError(err)
+			return
+		}
+		if len(enc) == 0 {
+			return
+		}
+		if err := tree.TryDelete(key[:]); err != nil {
+			sv.RecordStoreError(err)
+			return
+		}
+	} else {
+		// Encoding []byte cannot fail, ok to ignore the error.
+		v, _ := rlp.EncodeToBytes(bytes.TrimLeft(val[:], "\x00"))
+		if err := tree.TryUpdate(key[:], v); err != nil {
+			sv.RecordStoreError(err)
+			return
+		}
+	}
 	root, err := tree.Commit()
 	if err != nil {
-		log.Panic(err)
+		sv.RecordStoreError(err)
+		return
 	}
 
 	account.Root = root
 	sv.SetAccount(addr, account)
 }
 
+// storageSlotDeletionEnabled returns whether the cleared storage slots are deleted from the storage trie, see
+// common.HeightEnableStorageSlotDeletion
+func (sv *StoreView) storageSlotDeletionEnabled() bool {
+	return sv.Height()+1 >= common.HeightEnableStorageSlotDeletion
+}
+
 func (sv *StoreView) Suicide(addr common.Address) bool {
 	if sv.GetAccount(addr) == nil {
 		return false
@@ -497,17 +1423,29 @@ func (sv *StoreView) Empty(addr common.Address) bool {
 		account.Balance.IsZero()
 }
 
-func (sv *StoreView) RevertToSnapshot(root common.Hash) {
+// RevertToSnapshot reverts the state and the logs to the given snapshot, taken by Snapshot(). The snapshots
+// taken after it are discarded.
+func (sv *StoreView) RevertToSnapshot(id int) {
+	snapshot := sv.snapshots[id]
 	var err error
-	sv.store, err = sv.store.Revert(root) // revert to one of the previous roots
+	sv.store, err = sv.store.Revert(snapshot.root) // revert to one of the previous roots
 	if err != nil {
 		log.Panic(err)
 	}
+	if snapshot.numLogs < len(sv.logs) {
+		sv.logs = sv.logs[:snapshot.numLogs] // e.g. the logs emitted by a reverted call
+	}
+	sv.snapshots = sv.snapshots[:id+1]
 }
 
-func (sv *StoreView) Snapshot() common.Hash {
+// Snapshot records the current state and logs, and returns the id to revert to them with RevertToSnapshot()
+func (sv *StoreView) Snapshot() int {
 	sv.store.Trie.Commit(nil) // Needs to commit to the in-memory trie DB
-	return sv.store.Hash()
+	sv.snapshots = append(sv.snapshots, storeSnapshot{
+		root:    sv.store.Hash(),
+		numLogs: len(sv.logs),
+	})
+	return len(sv.snapshots) - 1
 }
 
 func (sv *StoreView) Prune() error {
@@ -534,6 +1472,13 @@ func (sv *StoreView) Prune() error {
 	return nil
 }
 
-func (sv *StoreView) AddLog(*types.Log) {
-	// TODO
+func (sv *StoreView) AddLog(l *types.Log) {
+	sv.logs = append(sv.logs, l)
+}
+
+// PopLogs returns the logs emitted since the last call, and clears them from the StoreView
+func (sv *StoreView) PopLogs() []*types.Log {
+	logs := sv.logs
+	sv.logs = nil
+	return logs
 }
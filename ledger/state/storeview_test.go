@@ -1,12 +1,14 @@
 package state
 
 import (
+	"math"
 	"math/big"
 	"testing"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/core"
 	"github.com/thetatoken/theta/crypto"
@@ -74,6 +76,68 @@ func TestStoreViewBasics(t *testing.T) {
 	assert.NotEqual(sv2RootHashCalculated, sv2RootHashCalculatedAfterInsertion)
 }
 
+func TestStoreViewStoreError(t *testing.T) {
+	assert := assert.New(t)
+
+	db := backend.NewMemDatabase()
+	sv1 := NewStoreView(uint64(1), common.Hash{}, db)
+	for i := 0; i < 20; i++ {
+		sv1.Set(common.Bytes{byte(i)}, common.Bytes("value"))
+	}
+	root := sv1.Save()
+	assert.Nil(sv1.StoreError())
+
+	// The missing keys are not errors
+	sv2 := NewStoreView(uint64(1), root, db)
+	assert.Equal(common.Bytes("value"), sv2.Get(common.Bytes{byte(1)}))
+	assert.Nil(sv2.Get(common.Bytes("missing")))
+	assert.Nil(sv2.StoreError())
+
+	// The missing trie nodes are
+	for _, key := range db.Keys() {
+		if common.BytesToHash(key) != root {
+			db.Delete(key)
+		}
+	}
+	sv3 := NewStoreView(uint64(1), root, db)
+	assert.Nil(sv3.Get(common.Bytes{byte(1)}))
+	assert.NotNil(sv3.StoreError())
+	sv3.Set(common.Bytes{byte(2)}, common.Bytes("value2"))
+	assert.NotNil(sv3.StoreError())
+}
+
+func TestStoreViewStorageStoreError(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	db := backend.NewFaultyDatabase(backend.NewMemDatabase())
+	addr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	key, value := common.BytesToHash([]byte{1}), common.BytesToHash([]byte{2})
+	sv1 := NewStoreView(uint64(1), common.Hash{}, db)
+	sv1.SetState(addr, key, value)
+	root := sv1.Save()
+
+	sv2 := NewStoreView(uint64(1), root, db)
+	snapshot := sv2.Snapshot()
+	assert.Equal(value, sv2.GetState(addr, key))
+	assert.Nil(sv2.StoreError())
+
+	// The storage which can not be read is not empty
+	db.FailReads(func(key []byte) bool { return true })
+	assert.Equal(common.Hash{}, sv2.GetState(addr, key))
+	sv2.SetState(addr, key, common.BytesToHash([]byte{3}))
+	db.FailReads(nil)
+	assert.NotNil(sv2.StoreError())
+
+	// Neither a copy nor a revert clears the error
+	sv3, err := sv2.Copy()
+	require.Nil(err)
+	assert.NotNil(sv3.StoreError())
+	sv2.RevertToSnapshot(snapshot)
+	assert.NotNil(sv2.StoreError())
+	assert.Equal(value, sv2.GetState(addr, key))
+}
+
 func TestStoreViewAccountAccess(t *testing.T) {
 	assert := assert.New(t)
 
@@ -339,6 +403,302 @@ func TestGetAndUpdateValidatorCandidatePool(t *testing.T) {
 	log.Infof("")
 }
 
+func TestStoreViewStakeIndex(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	source1 := common.HexToAddress("0x111")
+	source2 := common.HexToAddress("0x222")
+	holder1 := common.HexToAddress("0xf01")
+	holder2 := common.HexToAddress("0xf02")
+	amount := func(n int64) *big.Int {
+		return new(big.Int).Mul(big.NewInt(n), core.MinValidatorStakeDeposit)
+	}
+
+	vcp := &core.ValidatorCandidatePool{}
+	require.Nil(vcp.DepositStake(source1, holder1, amount(1)))
+	require.Nil(vcp.DepositStake(source2, holder1, amount(2)))
+	require.Nil(vcp.DepositStake(source1, holder2, amount(3)))
+
+	// Before the fork height, the stakes are read from the candidate pools
+	db := backend.NewMemDatabase()
+	sv := NewStoreView(uint64(1), common.Hash{}, db)
+	sv.UpdateValidatorCandidatePool(vcp)
+	assert.False(sv.stakeIndexBuilt())
+	assert.Equal([]*StakeRecord{
+		{Source: source1, Holder: holder1, Purpose: core.StakeForValidator, Amount: amount(1), ReturnHeight: core.InvalidReturnHeight},
+		{Source: source1, Holder: holder2, Purpose: core.StakeForValidator, Amount: amount(3), ReturnHeight: core.InvalidReturnHeight},
+	}, sv.GetStakesBySource(source1))
+	assert.Equal([]*StakeRecord{
+		{Source: source1, Holder: holder1, Purpose: core.StakeForValidator, Amount: amount(1), ReturnHeight: core.InvalidReturnHeight},
+		{Source: source2, Holder: holder1, Purpose: core.StakeForValidator, Amount: amount(2), ReturnHeight: core.InvalidReturnHeight},
+	}, sv.GetStakesByHolder(holder1))
+	unindexedSourceStakes := sv.GetStakesBySource(source1)
+	unindexedHolderStakes := sv.GetStakesByHolder(holder1)
+
+	// The index is built with the first pool update from the fork height, and answers the same
+	unindexedRoot := sv.Save()
+	sv = NewStoreView(common.HeightEnableStakeIndex-1, unindexedRoot, db)
+	sv.UpdateValidatorCandidatePool(vcp)
+	assert.True(sv.stakeIndexBuilt())
+	assert.Equal(unindexedSourceStakes, sv.GetStakesBySource(source1))
+	assert.Equal(unindexedHolderStakes, sv.GetStakesByHolder(holder1))
+
+	// The index follows the withdrawals, the guardian stakes and the stake returns
+	height := common.HeightEnableStakeIndex
+	require.Nil(vcp.WithdrawStake(source1, holder2, height))
+	sv.UpdateValidatorCandidatePool(vcp)
+	gcp := sv.GetGuardianCandidatePool()
+	require.Nil(gcp.DepositStake(source1, holder1, core.MinGuardianStakeDeposit))
+	require.Nil(gcp.WithdrawStake(source1, holder1, height+1))
+	sv.UpdateGuardianCandidatePool(gcp)
+	for _, holder := range []common.Address{holder1, holder2} {
+		assert.Equal(sv.scanStakes(func(pair stakePair) bool { return pair.holder == holder }), sv.GetStakesByHolder(holder))
+	}
+	assert.Equal(sv.scanStakes(func(pair stakePair) bool { return pair.source == source1 }), sv.GetStakesBySource(source1))
+	assert.Equal([]*StakeRecord{
+		{Source: source1, Holder: holder1, Purpose: core.StakeForGuardian, Amount: core.MinGuardianStakeDeposit, Withdrawn: true,
+			ReturnHeight: height + 1 + core.GuardianReturnLockingPeriod},
+		{Source: source1, Holder: holder2, Purpose: core.StakeForValidator, Amount: amount(3), Withdrawn: true,
+			ReturnHeight: height + core.ReturnLockingPeriod},
+	}, sv.GetPendingStakeReturns(source1))
+	withdrawnRoot := sv.Save()
+
+	vcp.ReturnStakes(height + core.ReturnLockingPeriod)
+	sv.UpdateValidatorCandidatePool(vcp)
+	assert.Empty(sv.GetStakesByHolder(holder2))
+	assert.Nil(sv.Get(StakeBySourceKey(source1, holder2, core.StakeForValidator)))
+	assert.Equal(1, len(sv.GetPendingStakeReturns(source1)))
+	assert.Empty(sv.GetPendingStakeReturns(source2))
+
+	// The stakes are readable at the earlier roots
+	assert.Equal(2, len(NewStoreView(height, withdrawnRoot, db).GetPendingStakeReturns(source1)))
+	assert.Equal(unindexedSourceStakes, NewStoreView(uint64(1), unindexedRoot, db).GetStakesBySource(source1))
+}
+
+func TestStoreViewStakeHistory(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	source1 := common.HexToAddress("0x111")
+	source2 := common.HexToAddress("0x222")
+	holder1 := common.HexToAddress("0xf01")
+	holder2 := common.HexToAddress("0xf02")
+	amount := func(n int64) *big.Int {
+		return new(big.Int).Mul(big.NewInt(n), core.MinValidatorStakeDeposit)
+	}
+	entry := func(height uint64, total *big.Int) *StakeHistoryEntry {
+		return &StakeHistoryEntry{Height: height, TotalStake: total}
+	}
+
+	vcp := &core.ValidatorCandidatePool{}
+	require.Nil(vcp.DepositStake(source1, holder1, amount(1)))
+	require.Nil(vcp.DepositStake(source1, holder2, amount(3)))
+
+	// Nothing is recorded before the fork height
+	db := backend.NewMemDatabase()
+	sv := NewStoreView(uint64(1), common.Hash{}, db)
+	sv.UpdateValidatorCandidatePool(vcp)
+	assert.False(sv.StakeHistoryBuilt())
+	assert.Empty(sv.GetStakeHistory(holder1, 0, math.MaxUint64, 0))
+
+	// The first update from the fork height records the total stakes of all the holders
+	height := common.HeightEnableStakeHistory
+	sv = NewStoreView(height-1, sv.Save(), db)
+	require.Nil(vcp.DepositStake(source2, holder1, amount(2)))
+	sv.UpdateValidatorCandidatePool(vcp)
+	assert.True(sv.StakeHistoryBuilt())
+	assert.Equal([]*StakeHistoryEntry{entry(height, amount(3))}, sv.GetStakeHistory(holder1, 0, math.MaxUint64, 0))
+	assert.Equal([]*StakeHistoryEntry{entry(height, amount(3))}, sv.GetStakeHistory(holder2, 0, math.MaxUint64, 0))
+
+	// Only the changes are recorded, the last update of a block wins
+	sv.IncrementHeight()
+	sv.UpdateValidatorCandidatePool(vcp)
+	require.Nil(vcp.WithdrawStake(source1, holder1, height+1))
+	sv.UpdateValidatorCandidatePool(vcp)
+	require.Nil(vcp.DepositStake(source1, holder2, amount(1)))
+	sv.UpdateValidatorCandidatePool(vcp)
+	sv.IncrementHeight()
+	require.Nil(vcp.DepositStake(source1, holder2, amount(1)))
+	sv.UpdateValidatorCandidatePool(vcp)
+	assert.Equal([]*StakeHistoryEntry{entry(height, amount(3)), entry(height+1, amount(2))},
+		sv.GetStakeHistory(holder1, 0, math.MaxUint64, 0))
+	assert.Equal([]*StakeHistoryEntry{entry(height, amount(3)), entry(height+1, amount(4)), entry(height+2, amount(5))},
+		sv.GetStakeHistory(holder2, 0, math.MaxUint64, 0))
+
+	// The stake return does not change the total, the holder dropping out of the pool is recorded with zero
+	sv.IncrementHeight()
+	vcp.ReturnStakes(height + 1 + core.ReturnLockingPeriod)
+	sv.UpdateValidatorCandidatePool(vcp)
+	require.Nil(vcp.WithdrawStake(source2, holder1, height+3))
+	vcp.ReturnStakes(height + 3 + core.ReturnLockingPeriod)
+	require.Nil(vcp.FindStakeDelegate(holder1))
+	sv.UpdateValidatorCandidatePool(vcp)
+	assert.Equal([]*StakeHistoryEntry{entry(height, amount(3)), entry(height+1, amount(2)), entry(height+3, big.NewInt(0))},
+		sv.GetStakeHistory(holder1, 0, math.MaxUint64, 0))
+
+	// The entries are paged by height range and limit
+	assert.Equal([]*StakeHistoryEntry{entry(height+1, amount(4))}, sv.GetStakeHistory(holder2, height+1, height+1, 0))
+	assert.Equal([]*StakeHistoryEntry{entry(height, amount(3)), entry(height+1, amount(4))},
+		sv.GetStakeHistory(holder2, 0, math.MaxUint64, 2))
+	assert.Equal([]*StakeHistoryEntry{entry(height+2, amount(5))}, sv.GetStakeHistory(holder2, height+2, math.MaxUint64, 2))
+}
+
+func TestStoreViewRewardHistory(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	addr1 := common.HexToAddress("0x111")
+	addr2 := common.HexToAddress("0x222")
+	rewards := func(sv *StoreView, addr common.Address, fromEpoch, toEpoch uint64) int64 {
+		coins, err := sv.GetRewards(addr, fromEpoch, toEpoch)
+		require.Nil(err)
+		return coins.TFuelWei.Int64()
+	}
+
+	// The rewards of an epoch add up, by recipient
+	sv := NewStoreView(uint64(1), common.Hash{}, backend.NewMemDatabase())
+	retention := uint64(3)
+	sv.RecordReward(addr1, 10, types.NewCoins(0, 1), retention)
+	sv.RecordReward(addr1, 10, types.NewCoins(0, 2), retention)
+	sv.RecordReward(addr2, 10, types.NewCoins(0, 4), retention)
+	sv.RecordReward(addr1, 11, types.NewCoins(0, 8), retention)
+	sv.RecordReward(addr1, 12, types.NewCoins(0, 16), retention)
+	assert.Equal(int64(3), rewards(sv, addr1, 10, 10))
+	assert.Equal(int64(27), rewards(sv, addr1, 0, 12))
+	assert.Equal(int64(24), rewards(sv, addr1, 11, math.MaxUint64))
+	assert.Equal(int64(4), rewards(sv, addr2, 0, math.MaxUint64))
+	assert.Equal(int64(0), rewards(sv, addr2, 11, 12))
+	_, err := sv.GetRewards(addr1, 12, 11)
+	assert.NotNil(err)
+
+	// The epochs out of the retention window are folded into the running total, which only covers the ranges
+	// from epoch zero
+	sv.RecordReward(addr1, 14, types.NewCoins(0, 32), retention)
+	assert.Equal(int64(59), rewards(sv, addr1, 0, math.MaxUint64))
+	assert.Equal(int64(11), rewards(sv, addr1, 0, 11))
+	assert.Equal(int64(48), rewards(sv, addr1, 12, 14))
+	assert.Equal(int64(32), rewards(sv, addr1, 13, 14))
+	_, err = sv.GetRewards(addr1, 11, 14)
+	assert.NotNil(err)
+	_, err = sv.GetRewards(addr1, 0, 10)
+	assert.NotNil(err)
+	assert.Nil(sv.Get(RewardHistoryKey(addr1, 10)))
+	assert.Nil(sv.Get(RewardHistoryKey(addr1, 11)))
+	assert.NotNil(sv.Get(RewardHistoryKey(addr1, 12)))
+
+	// Only the entries of the recipient are pruned
+	assert.Equal(int64(4), rewards(sv, addr2, 10, 10))
+
+	// The zero retention keeps all the epochs
+	sv.RecordReward(addr2, 100, types.NewCoins(0, 64), 0)
+	assert.Equal(int64(4), rewards(sv, addr2, 10, 10))
+}
+
+func TestStoreViewDepositNonces(t *testing.T) {
+	assert := assert.New(t)
+
+	source1 := common.HexToAddress("0x111")
+	source2 := common.HexToAddress("0x222")
+
+	// The nonces are recorded by source
+	sv := NewStoreView(uint64(1), common.Hash{}, backend.NewMemDatabase())
+	sv.RecordDepositNonce(source1, 7, 100, 110)
+	sv.RecordDepositNonce(source1, 8, 100, 110)
+	sv.RecordDepositNonce(source2, 7, 105, 115)
+	height, used := sv.GetDepositNonceHeight(source1, 7)
+	assert.True(used)
+	assert.Equal(uint64(100), height)
+	height, used = sv.GetDepositNonceHeight(source2, 7)
+	assert.True(used)
+	assert.Equal(uint64(105), height)
+	_, used = sv.GetDepositNonceHeight(source2, 8)
+	assert.False(used)
+
+	// The nonces leave the sets at their expiry height, along with the bucket
+	assert.Equal(0, sv.PruneDepositNonces(109))
+	assert.Equal(2, sv.PruneDepositNonces(110))
+	_, used = sv.GetDepositNonceHeight(source1, 7)
+	assert.False(used)
+	_, used = sv.GetDepositNonceHeight(source1, 8)
+	assert.False(used)
+	_, used = sv.GetDepositNonceHeight(source2, 7)
+	assert.True(used)
+	assert.Nil(sv.Get(DepositNonceExpiryKey(110)))
+	assert.Equal(0, sv.PruneDepositNonces(110))
+
+	// A pruned nonce can be used again
+	sv.RecordDepositNonce(source1, 7, 111, 121)
+	height, used = sv.GetDepositNonceHeight(source1, 7)
+	assert.True(used)
+	assert.Equal(uint64(111), height)
+	assert.Equal(1, sv.PruneDepositNonces(115))
+	assert.Equal(1, sv.PruneDepositNonces(121))
+	_, used = sv.GetDepositNonceHeight(source1, 7)
+	assert.False(used)
+}
+
+func TestStoreViewStakeReturnQueue(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	source1 := common.HexToAddress("0x111")
+	source2 := common.HexToAddress("0x222")
+	holder := common.HexToAddress("0xf01")
+	amount := func(n int64) *big.Int {
+		return new(big.Int).Mul(big.NewInt(n), core.MinValidatorStakeDeposit)
+	}
+
+	// Before the fork height, the pending returns are only kept in the pools
+	withdrawHeight := uint64(10)
+	returnHeight := withdrawHeight + core.ReturnLockingPeriod
+	vcp := &core.ValidatorCandidatePool{}
+	require.Nil(vcp.DepositStake(source1, holder, amount(1)))
+	require.Nil(vcp.DepositStake(source2, holder, amount(2)))
+	require.Nil(vcp.WithdrawStake(source1, holder, withdrawHeight))
+	db := backend.NewMemDatabase()
+	sv := NewStoreView(withdrawHeight, common.Hash{}, db)
+	sv.UpdateValidatorCandidatePool(vcp)
+	assert.False(sv.StakeReturnQueueBuilt())
+	assert.Empty(sv.GetQueuedStakeReturns(returnHeight))
+
+	// The pending returns are migrated to the queue with the first pool update from the fork height
+	sv = NewStoreView(common.HeightEnableStakeReturnQueue-1, sv.Save(), db)
+	sv.UpdateValidatorCandidatePool(vcp)
+	assert.True(sv.StakeReturnQueueBuilt())
+	assert.Equal([]*StakeRecord{
+		{Source: source1, Holder: holder, Purpose: core.StakeForValidator, Amount: amount(1), Withdrawn: true, ReturnHeight: returnHeight},
+	}, sv.GetQueuedStakeReturns(returnHeight))
+
+	// The queue follows the withdrawals, the cancellations and the returns
+	height := common.HeightEnableStakeReturnQueue
+	require.Nil(vcp.WithdrawStake(source2, holder, height))
+	sv.UpdateValidatorCandidatePool(vcp)
+	assert.Equal([]*StakeRecord{
+		{Source: source2, Holder: holder, Purpose: core.StakeForValidator, Amount: amount(2), Withdrawn: true,
+			ReturnHeight: height + core.ReturnLockingPeriod},
+	}, sv.GetQueuedStakeReturns(height+core.ReturnLockingPeriod))
+	require.Nil(vcp.CancelWithdrawal(source2, holder, height+1))
+	sv.UpdateValidatorCandidatePool(vcp)
+	assert.Empty(sv.GetQueuedStakeReturns(height + core.ReturnLockingPeriod))
+	assert.Nil(sv.Get(StakeReturnQueueKey(height + core.ReturnLockingPeriod)))
+
+	gcp := sv.GetGuardianCandidatePool()
+	require.Nil(gcp.DepositStake(source2, holder, core.MinGuardianStakeDeposit))
+	require.Nil(gcp.WithdrawStake(source2, holder, returnHeight-core.GuardianReturnLockingPeriod))
+	sv.UpdateGuardianCandidatePool(gcp)
+	assert.Equal([]*StakeRecord{
+		{Source: source1, Holder: holder, Purpose: core.StakeForValidator, Amount: amount(1), Withdrawn: true, ReturnHeight: returnHeight},
+		{Source: source2, Holder: holder, Purpose: core.StakeForGuardian, Amount: core.MinGuardianStakeDeposit, Withdrawn: true, ReturnHeight: returnHeight},
+	}, sv.GetQueuedStakeReturns(returnHeight))
+
+	vcp.ReturnStakes(returnHeight)
+	sv.UpdateValidatorCandidatePool(vcp)
+	gcp.ReturnStakes(returnHeight)
+	sv.UpdateGuardianCandidatePool(gcp)
+	assert.Nil(sv.Get(StakeReturnQueueKey(returnHeight)))
+}
+
 func TestGetAndUpdateHeightList(t *testing.T) {
 	assert := assert.New(t)
 
@@ -388,6 +748,178 @@ func TestGetAndUpdateHeightList(t *testing.T) {
 
 // ------------------------ Utilities ------------------------ //
 
+func TestGetAndUpdateDustPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	db := backend.NewMemDatabase()
+	sv := NewStoreView(uint64(1), common.Hash{}, db)
+
+	// Unless set, the defaults apply
+	assert.True(types.NewCoins(int64(types.DefaultDustThresholdThetaWei), int64(types.DefaultDustThresholdTFuelWei)).
+		IsEqual(sv.GetDustThreshold()))
+	assert.True(types.NewCoins(int64(types.DefaultMinNewAccountThetaWei), int64(types.DefaultMinNewAccountTFuelWei)).
+		IsEqual(sv.GetMinNewAccountAmount()))
+
+	sv.UpdateDustThreshold(types.NewCoins(10, 20))
+	sv.UpdateMinNewAccountAmount(types.Coins{ThetaWei: big.NewInt(30)})
+	root := sv.Save()
+
+	sv1 := NewStoreView(uint64(1), root, db)
+	assert.True(types.NewCoins(10, 20).IsEqual(sv1.GetDustThreshold()))
+	minNewAccountAmount := sv1.GetMinNewAccountAmount()
+	assert.True(types.NewCoins(30, 0).IsEqual(minNewAccountAmount))
+	assert.NotNil(minNewAccountAmount.TFuelWei)
+}
+
+func TestGetAndUpdateFeeSchedule(t *testing.T) {
+	assert := assert.New(t)
+
+	db := backend.NewMemDatabase()
+	sv := NewStoreView(uint64(1), common.Hash{}, db)
+
+	// Unless set, the default applies
+	assert.Equal(types.DefaultFeeSchedule(), sv.GetFeeSchedule())
+
+	fs := types.DefaultFeeSchedule()
+	fs.BaseFeesTFuelWei[types.TxSend] = big.NewInt(100)
+	fs.PerByteFeeTFuelWei = big.NewInt(10)
+	sv.UpdateFeeSchedule(fs)
+	root := sv.Save()
+
+	sv1 := NewStoreView(uint64(1), root, db)
+	assert.Equal(big.NewInt(100), sv1.GetFeeSchedule().BaseFee(types.TxSend))
+	assert.Equal(big.NewInt(10), sv1.GetFeeSchedule().PerByteFee())
+}
+
+func TestGetAndUpdateIntrinsicGasSchedule(t *testing.T) {
+	assert := assert.New(t)
+
+	db := backend.NewMemDatabase()
+	sv := NewStoreView(uint64(1), common.Hash{}, db)
+
+	// Unless set, the default applies
+	assert.Equal(types.DefaultIntrinsicGasSchedule(), sv.GetIntrinsicGasSchedule())
+
+	gs := types.DefaultIntrinsicGasSchedule()
+	gs.BaseGas[types.TxDepositStake] = 30000
+	gs.MinGasPriceTFuelWei = big.NewInt(1e9)
+	sv.UpdateIntrinsicGasSchedule(gs)
+	root := sv.Save()
+
+	sv1 := NewStoreView(uint64(1), root, db)
+	assert.Equal(uint64(30000), sv1.GetIntrinsicGasSchedule().TxGas(&types.DepositStakeTx{}))
+	assert.Equal(big.NewInt(1e9), sv1.GetIntrinsicGasSchedule().MinGasPrice())
+}
+
+func TestStoreViewAccountTombstone(t *testing.T) {
+	assert := assert.New(t)
+
+	_, pubKey, err := crypto.TEST_GenerateKeyPairWithSeed("account1")
+	assert.Nil(err)
+	addr := pubKey.Address()
+
+	db := backend.NewMemDatabase()
+	sv := NewStoreView(uint64(1), common.Hash{}, db)
+	assert.Equal(uint64(0), sv.GetAccountSequenceFloor(addr))
+	assert.Equal(uint64(0), sv.GetOrCreateAccount(addr).Sequence)
+
+	sv.SetAccount(addr, &types.Account{Address: addr, Sequence: 172, Balance: types.NewCoins(786, 0)})
+	sv.DeleteAccountWithTombstone(addr, 173)
+	root := sv.Save()
+
+	// The account is created again from the sequence of the deleted one
+	sv1 := NewStoreView(uint64(1), root, db)
+	assert.Nil(sv1.GetAccount(addr))
+	assert.Equal(uint64(173), sv1.GetAccountSequenceFloor(addr))
+	acc := sv1.GetOrCreateAccount(addr)
+	assert.Equal(uint64(173), acc.Sequence)
+	assert.True(acc.Balance.IsZero())
+}
+
+func TestStoreViewTotalSupply(t *testing.T) {
+	assert := assert.New(t)
+
+	db := backend.NewMemDatabase()
+	sv := NewStoreView(uint64(1), common.Hash{}, db)
+
+	// Not tracked unless set
+	sv.IncreaseTotalSupply(types.NewCoins(1, 2))
+	assert.Nil(sv.GetTotalSupply())
+
+	sv.UpdateTotalSupply(types.NewCoins(1000, 5000))
+	sv.IncreaseTotalSupply(types.NewCoins(0, 30))
+	sv.DecreaseTotalSupply(types.NewCoins(10, 20))
+	root := sv.Save()
+
+	sv1 := NewStoreView(uint64(1), root, db)
+	assert.Equal(types.NewCoins(990, 5010), *sv1.GetTotalSupply())
+}
+
+func TestStoreViewCreateAccountKeepsBalance(t *testing.T) {
+	assert := assert.New(t)
+
+	_, pubKey, err := crypto.TEST_GenerateKeyPairWithSeed("contract")
+	assert.Nil(err)
+	addr := pubKey.Address()
+
+	db := backend.NewMemDatabase()
+	sv := NewStoreView(uint64(1), common.Hash{}, db)
+
+	// The coins sent to the address before the contract is deployed are kept
+	sv.SetAccount(addr, &types.Account{Address: addr, Balance: types.NewCoins(0, 786)})
+	sv.CreateAccount(addr)
+	acc := sv.GetAccount(addr)
+	assert.Equal(types.NewCoins(0, 786), acc.Balance)
+	assert.Equal(types.EmptyCodeHash, acc.CodeHash)
+
+	other := common.HexToAddress("0x2ab1a4e6c1e1c1e62b1a4e6c1e1c1e62b1a4e6c1")
+	sv.CreateAccount(other)
+	assert.True(sv.GetAccount(other).Balance.IsZero())
+}
+
+func TestStoreViewAccessRecorder(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	addr := common.HexToAddress("0x2ab1a4e6c1e1c1e62b1a4e6c1e1c1e62b1a4e6c1")
+	db := backend.NewMemDatabase()
+	sv := NewStoreView(uint64(1), common.Hash{}, db)
+	sv.SetAccount(addr, &types.Account{Address: addr, Balance: types.NewCoins(0, 786)})
+	sv.AddSplitRule(&types.SplitRule{ResourceID: "rid001", EndBlockHeight: 10})
+
+	recorder := NewAccessRecorder()
+	sv.SetAccessRecorder(recorder)
+	sv.GetAccount(addr)
+	sv.SetState(addr, common.BytesToHash([]byte{1}), common.BytesToHash([]byte{2}))
+	sv.GetState(addr, common.BytesToHash([]byte{3}))
+	assert.True(sv.DeleteExpiredSplitRules(20))
+
+	accessList := recorder.AccessList()
+	assert.Contains(accessList.Reads, AccountKey(addr))
+	assert.Contains(accessList.Reads, ContractStorageAccessKey(addr, common.BytesToHash([]byte{3})))
+	assert.Equal([]common.Bytes{AccountKey(addr), ContractStorageAccessKey(addr, common.BytesToHash([]byte{1})),
+		SplitRuleKey("rid001")}, accessList.Writes)
+	assert.Equal([]common.Bytes{SplitRuleKeyPrefix()}, accessList.Traversed)
+
+	// The keys under a traversed prefix are covered without being listed
+	observed := &types.StateAccessList{Reads: []common.Bytes{SplitRuleKey("rid002")}}
+	reads, writes, traversed := accessList.Uncovered(observed)
+	assert.Equal(0, len(reads)+len(writes)+len(traversed))
+	observed = &types.StateAccessList{Reads: []common.Bytes{AccountKey(common.Address{})}, Writes: accessList.Reads}
+	reads, writes, _ = accessList.Uncovered(observed)
+	assert.Equal([]common.Bytes{AccountKey(common.Address{})}, reads)
+	assert.Equal([]common.Bytes{ContractStorageAccessKey(addr, common.BytesToHash([]byte{3}))}, writes)
+
+	// Neither the copies nor the detached view record the accesses
+	recorder.Reset()
+	copied, err := sv.Copy()
+	require.Nil(err)
+	copied.GetAccount(addr)
+	sv.SetAccessRecorder(nil)
+	sv.GetAccount(addr)
+	assert.Equal(0, len(recorder.AccessList().Reads))
+}
+
 func compareValidatorCandidatePools(vcp1, vcp2 *core.ValidatorCandidatePool) bool {
 	if len(vcp1.SortedCandidates) != len(vcp2.SortedCandidates) {
 		return false
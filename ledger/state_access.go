@@ -0,0 +1,128 @@
+package ledger
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+// VerifyBlockStateAccess re-executes the transactions of the applied block with the given hash against the
+// state of its parent block, recording the state keys accessed by each transaction, and checks them against
+//   - the access list in the stored receipt of the transaction, if it was recorded when the block was applied
+//     (see common.CfgLedgerStateAccessListsEnabled), and
+//   - the accounts declared by the transaction, for the transactions whose accounts are statically known,
+//     i.e. the accounts the parallel scheduler relies on.
+//
+// Any key outside of them is logged, and the verification fails with CodeStateAccessViolation. The access lists
+// of the re-execution are returned either way. Same as TraceTx, the transactions are re-executed against a
+// scratch checkout whose changes are never saved.
+func (ledger *Ledger) VerifyBlockStateAccess(blockHash common.Hash) (accessLists []*types.StateAccessList, res result.Result) {
+	if ledger.chain == nil {
+		return nil, result.Error("The blocks are not available")
+	}
+	block, err := ledger.chain.FindBlock(blockHash)
+	if err != nil {
+		return nil, result.Error("Block %v not found: %v", blockHash.Hex(), err)
+	}
+	parent, err := ledger.chain.FindBlock(block.Parent)
+	if err != nil {
+		return nil, result.Error("Parent block %v not found: %v", block.Parent.Hex(), err)
+	}
+
+	db := ledger.state.DB()
+	var prunedHeight uint64
+	err = kvstore.NewKVStore(db).Get(state.StatePruningProgressKey(), &prunedHeight)
+	if err == nil && parent.Height <= prunedHeight {
+		return nil, result.Error("The state at height %v has been pruned", parent.Height)
+	}
+
+	consensus := &reproConsensusEngine{}
+	scratch, err := newScratchLedger(ledger.state.GetChainID(), db, parent.Height, parent.StateHash, consensus, ledger.valMgr,
+		ledger.executor.RewardSchedule())
+	if err != nil {
+		return nil, result.Error("The state at height %v is not available, it might have been pruned: %v", parent.Height, err).
+			WithErrorCode(result.CodeInternalStoreError)
+	}
+	consensus.ledger = scratch
+	consensus.block = block.Block
+	scratch.currentBlock = block.Block
+
+	defer func() {
+		if r := recover(); r != nil {
+			res = result.Error("Panic while re-executing the block: %v", panicMessage(r))
+		}
+	}()
+
+	view := scratch.state.Delivered()
+	recorder := state.NewAccessRecorder()
+	view.SetAccessRecorder(recorder)
+	defer view.SetAccessRecorder(nil)
+
+	accessLists = []*types.StateAccessList{}
+	violations := []string{}
+	for i, rawTx := range block.Txs {
+		tx, err := types.TxFromBytes(rawTx)
+		if err != nil {
+			return accessLists, result.Error("Failed to parse transaction %v: %v", i, err)
+		}
+		recorder.Reset()
+		if _, txRes := scratch.executor.ExecuteTxWithView(tx, view); txRes.IsError() {
+			return accessLists, result.Error("Failed to re-execute transaction %v: %v", i, txRes.Message)
+		}
+		accessList := recorder.AccessList()
+		accessLists = append(accessLists, accessList)
+
+		txHash := crypto.Keccak256Hash(rawTx)
+		if receipt, err := ledger.GetTxReceipt(txHash); err == nil && receipt.StateAccess != nil {
+			reads, writes, traversed := receipt.StateAccess.Uncovered(accessList)
+			for _, key := range reads {
+				violations = append(violations, fmt.Sprintf("tx %v read unrecorded key %v", txHash.Hex(), common.Bytes2Hex(key)))
+			}
+			for _, key := range writes {
+				violations = append(violations, fmt.Sprintf("tx %v wrote unrecorded key %v", txHash.Hex(), common.Bytes2Hex(key)))
+			}
+			for _, prefix := range traversed {
+				violations = append(violations, fmt.Sprintf("tx %v traversed unrecorded prefix %v", txHash.Hex(), common.Bytes2Hex(prefix)))
+			}
+		}
+		if declared := declaredAccountKeys(tx); declared != nil {
+			for _, key := range append(accessList.Reads, accessList.Writes...) {
+				if bytes.HasPrefix(key, state.AccountKeyPrefix()) && !declared[string(key)] {
+					violations = append(violations, fmt.Sprintf("tx %v accessed undeclared account key %v", txHash.Hex(), common.Bytes2Hex(key)))
+				}
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		for _, violation := range violations {
+			logger.Errorf("State access violation in block %v: %v", blockHash.Hex(), violation)
+		}
+		return accessLists, result.Error("%v state access violations in block %v, the first: %v", len(violations),
+			blockHash.Hex(), violations[0]).WithErrorCode(result.CodeStateAccessViolation)
+	}
+	return accessLists, result.OK
+}
+
+// declaredAccountKeys returns the state keys of the accounts declared by the tx, or nil if its accounts are not
+// statically known
+func declaredAccountKeys(tx types.Tx) map[string]bool {
+	sendTx, ok := tx.(*types.SendTx)
+	if !ok {
+		return nil
+	}
+	keys := make(map[string]bool)
+	for _, input := range sendTx.Inputs {
+		keys[string(state.AccountKey(input.Address))] = true
+	}
+	for _, output := range sendTx.Outputs {
+		keys[string(state.AccountKey(output.Address))] = true
+	}
+	return keys
+}
@@ -0,0 +1,98 @@
+package ledger
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+func TestLedgerStateAccessLists(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	viper.Set(common.CfgLedgerStateAccessListsEnabled, true)
+	defer viper.Set(common.CfgLedgerStateAccessListsEnabled, false)
+
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 2)
+
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = ledger.state.Height()
+	root.StateHash = ledger.state.Delivered().Hash()
+	store := kvstore.NewKVStore(ledger.state.DB())
+	ledger.chain = blockchain.NewChain(chainID, store, root)
+
+	txs := []common.Bytes{
+		newRawSendTx(chainID, 1, true, accOut, accIns[0], false),
+		newRawSendTx(chainID, 1, true, accOut, accIns[1], false),
+	}
+	for _, tx := range txs {
+		require.Nil(mempool.InsertTransaction(tx))
+	}
+	stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	require.Equal(len(txs), len(blockRawTxs))
+
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Height = root.Height + 1
+	block.Parent = root.Hash()
+	block.StateHash = stateRoot
+	block.Txs = blockRawTxs
+	receipts, res := ledger.ApplyBlockTxsWithReceipts(block)
+	require.True(res.IsOK(), res.Message)
+	_, err := ledger.chain.AddBlock(block)
+	require.Nil(err)
+
+	// Each receipt records the keys of the accounts the send tx touches
+	require.Equal(2, len(receipts))
+	touched := []common.Bytes{}
+	for _, receipt := range receipts {
+		require.NotNil(receipt.StateAccess)
+		require.Equal(2, len(receipt.StateAccess.Writes))
+		assert.Contains(receipt.StateAccess.Writes, state.AccountKey(accOut.Address))
+		for _, key := range receipt.StateAccess.Writes {
+			assert.Contains(receipt.StateAccess.Reads, key)
+			if !bytes.Equal(key, state.AccountKey(accOut.Address)) {
+				touched = append(touched, key)
+			}
+		}
+
+		stored, err := ledger.GetTxReceipt(receipt.TxHash)
+		require.Nil(err)
+		assert.Equal(receipt.StateAccess.Writes, stored.StateAccess.Writes)
+	}
+	assert.ElementsMatch([]common.Bytes{state.AccountKey(accIns[0].Address), state.AccountKey(accIns[1].Address)}, touched)
+
+	// The re-execution stays within the recorded and declared keys
+	accessLists, res := ledger.VerifyBlockStateAccess(block.Hash())
+	require.True(res.IsOK(), res.Message)
+	require.Equal(2, len(accessLists))
+	assert.Equal(receipts[1].StateAccess.Writes, accessLists[1].Writes)
+
+	// A key missing from the recorded access list is a violation
+	tampered := *receipts[1]
+	tampered.StateAccess = &types.StateAccessList{
+		Reads:     receipts[1].StateAccess.Reads,
+		Writes:    []common.Bytes{state.AccountKey(accOut.Address)},
+		Traversed: receipts[1].StateAccess.Traversed,
+	}
+	ledger.saveTxReceipts([]*types.TxReceipt{&tampered})
+	_, res = ledger.VerifyBlockStateAccess(block.Hash())
+	assert.Equal(result.CodeStateAccessViolation, res.Code)
+	assert.Contains(res.Message, "wrote unrecorded key")
+
+	_, res = ledger.VerifyBlockStateAccess(common.BytesToHash([]byte("unknown block")))
+	assert.True(res.IsError())
+}
@@ -0,0 +1,431 @@
+package ledger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/kvstore"
+	"github.com/thetatoken/theta/store/treestore"
+	"github.com/thetatoken/theta/store/trie"
+)
+
+const stateSnapshotVersion = uint64(1)
+
+const maxStateSnapshotRecordSize = 64 * 1024 * 1024
+
+const stateSnapshotCommitInterval = 100000 // number of imported entries between the trie commits, bounds the memory usage
+
+const (
+	stateSnapshotRecordHeader  = uint64(iota)
+	stateSnapshotRecordState   // a key/value pair of the state trie, e.g. an account or the validator candidate pool
+	stateSnapshotRecordStorage // a key/value pair of the storage trie of the preceding account
+	stateSnapshotRecordEnd
+)
+
+// StateSnapshotHeader describes the state a snapshot file is exported from
+type StateSnapshotHeader struct {
+	Version   uint64
+	ChainID   string
+	Height    uint64
+	BlockHash common.Hash // the finalized block the state belongs to
+	StateRoot common.Hash
+}
+
+//
+// A state snapshot file is a sequence of records, each encoded as its length (8 bytes, little endian)
+// followed by the RLP encoded stateSnapshotRecord. The header comes first, then all the key/value pairs
+// of the state trie in the key order, with the storage of each contract account right after the account.
+// The end record carries the number of the key/value pairs, and marks the export as complete.
+//
+type stateSnapshotRecord struct {
+	Type uint64
+	K    common.Bytes
+	V    common.Bytes
+}
+
+// stateSnapshotProgress is the position an interrupted export resumes from
+type stateSnapshotProgress struct {
+	offset     int64        // size of the complete records
+	numEntries uint64       // number of the key/value pairs written
+	stateKey   common.Bytes // last state key written, nil if none
+	account    *types.Account
+	storageKey common.Bytes // last storage key written for the account, nil if none
+	completed  bool
+}
+
+// ExportSnapshot writes the state of the finalized block at the given height to the file. The export is
+// resumable: if the file holds a partial snapshot of the same state, e.g. the previous export got
+// interrupted, the complete records are kept and the export continues after the last one. It refuses to
+// export the heights whose states might have been pruned.
+func (ledger *Ledger) ExportSnapshot(height uint64, filePath string) (*StateSnapshotHeader, error) {
+	var block *core.ExtendedBlock
+	for _, b := range ledger.chain.FindBlocksByHeight(height) {
+		if b.Status.IsFinalized() {
+			block = b
+			break
+		}
+	}
+	if block == nil {
+		return nil, fmt.Errorf("No finalized block found at height %v", height)
+	}
+
+	db := ledger.state.DB()
+	var prunedHeight uint64
+	err := kvstore.NewKVStore(db).Get(state.StatePruningProgressKey(), &prunedHeight)
+	if err == nil && height <= prunedHeight {
+		return nil, fmt.Errorf("Can't export height %v, the states are pruned up to height %v", height, prunedHeight)
+	}
+	if has, err := db.Has(block.StateHash[:]); err != nil || !has {
+		return nil, fmt.Errorf("State root %v of height %v not found", block.StateHash.Hex(), height)
+	}
+
+	header := &StateSnapshotHeader{
+		Version:   stateSnapshotVersion,
+		ChainID:   ledger.state.GetChainID(),
+		Height:    height,
+		BlockHash: block.Hash(),
+		StateRoot: block.StateHash,
+	}
+
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	progress, err := scanStateSnapshot(file, header)
+	if err != nil {
+		return nil, err
+	}
+	if progress.completed {
+		return header, nil
+	}
+	if err := file.Truncate(progress.offset); err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(progress.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if progress.offset > 0 {
+		logger.WithFields(log.Fields{"height": height, "offset": progress.offset, "entries": progress.numEntries}).Info("Resuming the state snapshot export")
+	}
+
+	writer := bufio.NewWriter(file)
+	if progress.offset == 0 {
+		raw, err := rlp.EncodeToBytes(header)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeStateSnapshotRecord(writer, stateSnapshotRecordHeader, nil, raw); err != nil {
+			return nil, err
+		}
+	}
+
+	numEntries := progress.numEntries
+	writeStorage := func(account *types.Account, start common.Bytes) error {
+		if account == nil || account.Root == (common.Hash{}) {
+			return nil
+		}
+		storage := treestore.NewTreeStore(account.Root, db)
+		if storage == nil {
+			return fmt.Errorf("Storage root %v not found", account.Root.Hex())
+		}
+		it := trie.NewIterator(storage.NodeIterator(start))
+		for it.Next() {
+			if bytes.Compare(it.Key, start) < 0 {
+				continue // the seek might stop short of the start key
+			}
+			if err := writeStateSnapshotRecord(writer, stateSnapshotRecordStorage, it.Key, it.Value); err != nil {
+				return err
+			}
+			numEntries++
+		}
+		return it.Err
+	}
+
+	// Finishes the storage of the account the previous export stopped at
+	if progress.account != nil {
+		if err := writeStorage(progress.account, nextTrieKey(progress.storageKey)); err != nil {
+			return nil, err
+		}
+	}
+
+	sv := state.NewStoreView(height, block.StateHash, db)
+	if sv == nil {
+		return nil, fmt.Errorf("Failed to load the state of height %v", height)
+	}
+	start := nextTrieKey(progress.stateKey)
+	it := trie.NewIterator(sv.GetStore().NodeIterator(start))
+	for it.Next() {
+		if bytes.Compare(it.Key, start) < 0 {
+			continue
+		}
+		if err := writeStateSnapshotRecord(writer, stateSnapshotRecordState, it.Key, it.Value); err != nil {
+			return nil, err
+		}
+		numEntries++
+
+		account, err := parseSnapshotAccount(it.Key, it.Value)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeStorage(account, nil); err != nil {
+			return nil, err
+		}
+	}
+	if it.Err != nil {
+		return nil, fmt.Errorf("Failed to traverse the state trie: %v", it.Err)
+	}
+
+	if err := writeStateSnapshotRecord(writer, stateSnapshotRecordEnd, nil, core.Itobytes(numEntries)); err != nil {
+		return nil, err
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+	if err := file.Sync(); err != nil {
+		return nil, err
+	}
+
+	logger.WithFields(log.Fields{"height": height, "stateRoot": header.StateRoot.Hex(), "entries": numEntries}).Info("Exported the state snapshot")
+	return header, nil
+}
+
+// ImportSnapshot rebuilds the state from a snapshot written by ExportSnapshot, and checks out the state
+// so that the ledger continues with the block at the next height. The snapshot is rejected if the
+// recomputed state root or any account storage root does not match.
+func (ledger *Ledger) ImportSnapshot(reader io.Reader) (*StateSnapshotHeader, error) {
+	r := bufio.NewReader(reader)
+
+	record, _, err := readStateSnapshotRecord(r)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read the snapshot header: %v", err)
+	}
+	header, err := decodeStateSnapshotHeader(record)
+	if err != nil {
+		return nil, err
+	}
+	if header.ChainID != ledger.state.GetChainID() {
+		return nil, fmt.Errorf("Snapshot chain ID mismatch, expected: %v, snapshot: %v", ledger.state.GetChainID(), header.ChainID)
+	}
+
+	db := ledger.state.DB()
+	sv := state.NewStoreView(header.Height, common.Hash{}, db)
+
+	var storage *state.StoreView
+	var account *types.Account
+	finishStorage := func() error {
+		if storage == nil {
+			return nil
+		}
+		if root := storage.Save(); root != account.Root {
+			return fmt.Errorf("Account storage root mismatch, expected: %v, computed: %v", account.Root.Hex(), root.Hex())
+		}
+		storage, account = nil, nil
+		return nil
+	}
+
+	numEntries := uint64(0)
+	for completed := false; !completed; {
+		record, _, err := readStateSnapshotRecord(r)
+		if err == io.EOF {
+			return nil, fmt.Errorf("Incomplete snapshot, %v entries read", numEntries)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read the snapshot record: %v", err)
+		}
+
+		switch record.Type {
+		case stateSnapshotRecordState:
+			if err := finishStorage(); err != nil {
+				return nil, err
+			}
+			sv.Set(record.K, record.V)
+			if account, err = parseSnapshotAccount(record.K, record.V); err != nil {
+				return nil, err
+			}
+			if account != nil && account.Root != (common.Hash{}) {
+				storage = state.NewStoreView(header.Height, common.Hash{}, db)
+			} else {
+				account = nil
+			}
+		case stateSnapshotRecordStorage:
+			if storage == nil {
+				return nil, fmt.Errorf("Storage entry %v without a contract account", record.K)
+			}
+			storage.Set(record.K, record.V)
+		case stateSnapshotRecordEnd:
+			if err := finishStorage(); err != nil {
+				return nil, err
+			}
+			if count := core.Bytestoi(record.V); count != numEntries {
+				return nil, fmt.Errorf("Snapshot entry count mismatch, expected: %v, read: %v", count, numEntries)
+			}
+			completed = true
+			continue
+		default:
+			return nil, fmt.Errorf("Unexpected snapshot record type %v", record.Type)
+		}
+
+		numEntries++
+		if numEntries%stateSnapshotCommitInterval == 0 {
+			sv.Save()
+		}
+	}
+
+	if root := sv.Save(); root != header.StateRoot {
+		return nil, fmt.Errorf("Snapshot state root mismatch, expected: %v, computed: %v", header.StateRoot.Hex(), root.Hex())
+	}
+
+	ledger.mempool.Lock()
+	defer ledger.mempool.Unlock()
+
+	ledger.mu.Lock()
+	defer ledger.mu.Unlock()
+
+	// Also resets the checked and screened views
+	ledger.proposalResult = nil
+	if res := ledger.resetState(header.Height, header.StateRoot); res.IsError() {
+		return nil, fmt.Errorf("%v", res.Message)
+	}
+	if res := ledger.state.Finalize(header.Height, header.StateRoot); res.IsError() {
+		return nil, fmt.Errorf("%v", res.Message)
+	}
+
+	logger.WithFields(log.Fields{"height": header.Height, "stateRoot": header.StateRoot.Hex(), "entries": numEntries}).Info("Imported the state snapshot")
+	return header, nil
+}
+
+// scanStateSnapshot reads the complete records of a partially exported snapshot, to find where the
+// export resumes. The file must be empty, or hold a snapshot of the given state.
+func scanStateSnapshot(file *os.File, header *StateSnapshotHeader) (*stateSnapshotProgress, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(file)
+	progress := &stateSnapshotProgress{}
+	for {
+		record, size, err := readStateSnapshotRecord(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return progress, nil // the partial record at the tail is rewritten
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read the existing snapshot: %v", err)
+		}
+
+		if progress.offset == 0 {
+			existing, err := decodeStateSnapshotHeader(record)
+			if err != nil {
+				return nil, err
+			}
+			if *existing != *header {
+				return nil, fmt.Errorf("The existing snapshot is exported from a different state, height: %v, stateRoot: %v",
+					existing.Height, existing.StateRoot.Hex())
+			}
+			progress.offset += size
+			continue
+		}
+
+		switch record.Type {
+		case stateSnapshotRecordState:
+			account, err := parseSnapshotAccount(record.K, record.V)
+			if err != nil {
+				return nil, err
+			}
+			progress.stateKey = record.K
+			progress.account = account
+			progress.storageKey = nil
+		case stateSnapshotRecordStorage:
+			progress.storageKey = record.K
+		case stateSnapshotRecordEnd:
+			progress.completed = true
+		default:
+			return nil, fmt.Errorf("Unexpected snapshot record type %v", record.Type)
+		}
+		if record.Type != stateSnapshotRecordEnd {
+			progress.numEntries++
+		}
+		progress.offset += size
+	}
+}
+
+func writeStateSnapshotRecord(writer *bufio.Writer, recordType uint64, k, v common.Bytes) error {
+	raw, err := rlp.EncodeToBytes(stateSnapshotRecord{Type: recordType, K: k, V: v})
+	if err != nil {
+		return fmt.Errorf("Failed to encode snapshot record, %v", err)
+	}
+	if _, err := writer.Write(core.Itobytes(uint64(len(raw)))); err != nil {
+		return err
+	}
+	_, err = writer.Write(raw)
+	return err
+}
+
+// readStateSnapshotRecord returns the next record and its size in the file. A record cut short by the
+// end of the file results in io.ErrUnexpectedEOF.
+func readStateSnapshotRecord(r io.Reader) (*stateSnapshotRecord, int64, error) {
+	lenBytes := make([]byte, 8)
+	if _, err := io.ReadFull(r, lenBytes); err != nil {
+		return nil, 0, err
+	}
+	size := binary.LittleEndian.Uint64(lenBytes)
+	if size > maxStateSnapshotRecordSize {
+		return nil, 0, fmt.Errorf("Snapshot record too large: %v bytes", size)
+	}
+	raw := make([]byte, size)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+	record := &stateSnapshotRecord{}
+	if err := rlp.DecodeBytes(raw, record); err != nil {
+		return nil, 0, fmt.Errorf("Failed to decode snapshot record, %v", err)
+	}
+	return record, int64(len(lenBytes)) + int64(size), nil
+}
+
+func decodeStateSnapshotHeader(record *stateSnapshotRecord) (*StateSnapshotHeader, error) {
+	if record.Type != stateSnapshotRecordHeader {
+		return nil, fmt.Errorf("Missing the snapshot header")
+	}
+	header := &StateSnapshotHeader{}
+	if err := rlp.DecodeBytes(record.V, header); err != nil {
+		return nil, fmt.Errorf("Failed to decode the snapshot header, %v", err)
+	}
+	if header.Version != stateSnapshotVersion {
+		return nil, fmt.Errorf("Unsupported snapshot version %v", header.Version)
+	}
+	return header, nil
+}
+
+// parseSnapshotAccount returns the account if the state entry is one, or nil otherwise
+func parseSnapshotAccount(k, v common.Bytes) (*types.Account, error) {
+	if !bytes.HasPrefix(k, state.AccountKeyPrefix()) {
+		return nil, nil
+	}
+	account := &types.Account{}
+	if err := types.FromBytes(v, account); err != nil {
+		return nil, fmt.Errorf("Failed to parse account %v, %v", k, err)
+	}
+	return account, nil
+}
+
+// nextTrieKey returns the smallest key after the given one, or nil to iterate from the beginning
+func nextTrieKey(key common.Bytes) common.Bytes {
+	if key == nil {
+		return nil
+	}
+	return append(common.CopyBytes(key), 0)
+}
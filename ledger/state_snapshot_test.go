@@ -0,0 +1,233 @@
+package ledger
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+func TestLedgerExportImportSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, _ := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 20)
+
+	// A contract account with storage
+	contract := accIns[0].Address
+	for i := 1; i <= 30; i++ {
+		ledger.state.Delivered().SetState(contract, common.BytesToHash([]byte{byte(i)}), common.BytesToHash([]byte{byte(i * 7)}))
+	}
+	ledger.state.Commit()
+
+	height := ledger.state.Height()
+	stateRoot := ledger.state.Delivered().Hash()
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = height
+	root.StateHash = stateRoot
+	ledger.chain = blockchain.NewChain(chainID, kvstore.NewKVStore(ledger.state.DB()), root)
+
+	dir, err := ioutil.TempDir("", "state_snapshot")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "state.snapshot")
+
+	_, err = ledger.ExportSnapshot(height+1, filePath)
+	assert.NotNil(err)
+
+	header, err := ledger.ExportSnapshot(height, filePath)
+	require.Nil(err)
+	assert.Equal(chainID, header.ChainID)
+	assert.Equal(height, header.Height)
+	assert.Equal(stateRoot, header.StateRoot)
+	assert.Equal(root.Hash(), header.BlockHash)
+
+	snapshot, err := ioutil.ReadFile(filePath)
+	require.Nil(err)
+
+	// Exporting a complete snapshot again leaves it as is
+	_, err = ledger.ExportSnapshot(height, filePath)
+	require.Nil(err)
+	exported, err := ioutil.ReadFile(filePath)
+	require.Nil(err)
+	assert.Equal(snapshot, exported)
+
+	// The interrupted exports resume from the last complete record
+	for i := 1; i < 16; i++ {
+		cut := len(snapshot) * i / 16
+		require.Nil(ioutil.WriteFile(filePath, snapshot[:cut], 0600))
+		_, err = ledger.ExportSnapshot(height, filePath)
+		require.Nil(err)
+		exported, err := ioutil.ReadFile(filePath)
+		require.Nil(err)
+		assert.Equal(snapshot, exported, "cut at %v", cut)
+	}
+
+	// A snapshot of another state is not resumed
+	otherHeader := *header
+	otherHeader.StateRoot = common.BytesToHash([]byte("other root"))
+	buf := &bytes.Buffer{}
+	writer := bufio.NewWriter(buf)
+	record := testStateSnapshotHeaderRecord(t, &otherHeader)
+	require.Nil(writeStateSnapshotRecord(writer, record.Type, record.K, record.V))
+	require.Nil(writer.Flush())
+	require.Nil(ioutil.WriteFile(filePath, buf.Bytes(), 0600))
+	_, err = ledger.ExportSnapshot(height, filePath)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "exported from a different state")
+
+	// Import into a fresh ledger, which continues with the next block
+	_, imported, mempool := newTestLedger()
+	header, err = imported.ImportSnapshot(bytes.NewReader(snapshot))
+	require.Nil(err)
+	assert.Equal(height, header.Height)
+	assert.Equal(height, imported.state.Height())
+	assert.Equal(stateRoot, imported.state.Delivered().Hash())
+	assert.Equal(stateRoot, imported.state.Finalized().Hash())
+	for _, acc := range append(accIns, accOut) {
+		expected := ledger.View().GetAccount(acc.Address)
+		assert.Equal(expected, imported.View().GetAccount(acc.Address))
+	}
+	for i := 1; i <= 30; i++ {
+		assert.Equal(common.BytesToHash([]byte{byte(i * 7)}), imported.View().GetState(contract, common.BytesToHash([]byte{byte(i)})))
+	}
+
+	require.Nil(mempool.InsertTransaction(newRawSendTx(chainID, 1, true, accOut, accIns[1], false)))
+	nextRoot, blockRawTxs, res := imported.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Height = height + 1
+	block.StateHash = nextRoot
+	block.Txs = blockRawTxs
+	res = imported.ApplyBlockTxs(block)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(uint64(1), imported.View().GetAccount(accIns[1].Address).Sequence)
+}
+
+func TestLedgerImportSnapshotRejectsUnverifiedState(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, _ := newTestLedger()
+	_, accIns := prepareInitLedgerState(ledger, 4)
+	contract := accIns[0].Address
+	for i := 1; i <= 5; i++ {
+		ledger.state.Delivered().SetState(contract, common.BytesToHash([]byte{byte(i)}), common.BytesToHash([]byte{byte(i)}))
+	}
+	ledger.state.Commit()
+
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = ledger.state.Height()
+	root.StateHash = ledger.state.Delivered().Hash()
+	ledger.chain = blockchain.NewChain(chainID, kvstore.NewKVStore(ledger.state.DB()), root)
+
+	dir, err := ioutil.TempDir("", "state_snapshot")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "state.snapshot")
+	_, err = ledger.ExportSnapshot(root.Height, filePath)
+	require.Nil(err)
+	snapshot, err := ioutil.ReadFile(filePath)
+	require.Nil(err)
+
+	records := readTestStateSnapshot(t, snapshot)
+	tamper := func(modify func(records []*stateSnapshotRecord)) []byte {
+		tampered := readTestStateSnapshot(t, snapshot)
+		modify(tampered)
+		buf := &bytes.Buffer{}
+		writer := bufio.NewWriter(buf)
+		for _, record := range tampered {
+			require.Nil(writeStateSnapshotRecord(writer, record.Type, record.K, record.V))
+		}
+		require.Nil(writer.Flush())
+		return buf.Bytes()
+	}
+	findRecord := func(recordType uint64, k common.Bytes) int {
+		for i, record := range records {
+			if record.Type == recordType && (k == nil || bytes.Equal(record.K, k)) {
+				return i
+			}
+		}
+		require.FailNow("record not found")
+		return -1
+	}
+
+	testCases := []struct {
+		name     string
+		snapshot []byte
+		err      string
+	}{
+		{"truncated", snapshot[:len(snapshot)-3], "Failed to read the snapshot record"},
+		{"missing end", tamper(func(records []*stateSnapshotRecord) {
+			records[len(records)-1] = records[len(records)-2]
+		}), "Incomplete snapshot"},
+		{"state root", tamper(func(records []*stateSnapshotRecord) {
+			header, err := decodeStateSnapshotHeader(records[0])
+			require.Nil(err)
+			header.StateRoot = common.BytesToHash([]byte("bad root"))
+			records[0] = testStateSnapshotHeaderRecord(t, header)
+		}), "Snapshot state root mismatch"},
+		{"chain ID", tamper(func(records []*stateSnapshotRecord) {
+			header, err := decodeStateSnapshotHeader(records[0])
+			require.Nil(err)
+			header.ChainID = "other_chain"
+			records[0] = testStateSnapshotHeaderRecord(t, header)
+		}), "Snapshot chain ID mismatch"},
+		{"account", tamper(func(records []*stateSnapshotRecord) {
+			idx := findRecord(stateSnapshotRecordState, state.AccountKey(accIns[2].Address))
+			account := &types.Account{}
+			require.Nil(types.FromBytes(records[idx].V, account))
+			account.Balance = account.Balance.Plus(types.NewCoins(1, 0))
+			raw, err := types.ToBytes(account)
+			require.Nil(err)
+			records[idx].V = raw
+		}), "Snapshot state root mismatch"},
+		{"storage", tamper(func(records []*stateSnapshotRecord) {
+			idx := findRecord(stateSnapshotRecordStorage, nil)
+			records[idx].V = append(common.CopyBytes(records[idx].V), 0)
+		}), "Account storage root mismatch"},
+	}
+	for _, tc := range testCases {
+		_, imported, _ := newTestLedger()
+		initRoot := imported.state.Delivered().Hash()
+		_, err := imported.ImportSnapshot(bytes.NewReader(tc.snapshot))
+		if assert.NotNil(err, tc.name) {
+			assert.Contains(err.Error(), tc.err, tc.name)
+		}
+		assert.Equal(uint64(1), imported.state.Height(), tc.name)
+		assert.Equal(initRoot, imported.state.Delivered().Hash(), tc.name)
+	}
+}
+
+func readTestStateSnapshot(t *testing.T, snapshot []byte) []*stateSnapshotRecord {
+	records := []*stateSnapshotRecord{}
+	r := bytes.NewReader(snapshot)
+	for r.Len() > 0 {
+		record, _, err := readStateSnapshotRecord(r)
+		require.Nil(t, err)
+		records = append(records, record)
+	}
+	return records
+}
+
+func testStateSnapshotHeaderRecord(t *testing.T, header *StateSnapshotHeader) *stateSnapshotRecord {
+	raw, err := rlp.EncodeToBytes(header)
+	require.Nil(t, err)
+	return &stateSnapshotRecord{Type: stateSnapshotRecordHeader, V: raw}
+}
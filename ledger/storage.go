@@ -0,0 +1,48 @@
+package ledger
+
+import (
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	st "github.com/thetatoken/theta/ledger/state"
+)
+
+// GetStorageAt returns the value of the storage slot of the contract in the state with the given root, e.g. the
+// state root of a block, see core.BlockHeader.StateHash
+func (ledger *Ledger) GetStorageAt(address common.Address, key common.Hash, stateRoot common.Hash) (common.Hash, error) {
+	storeView, err := ledger.getStoreViewAt(stateRoot)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return storeView.GetState(address, key), nil
+}
+
+// GetStorageProof returns the proof of the storage slot of the contract against the given state root, to be checked
+// with state.VerifyStorageProof
+func (ledger *Ledger) GetStorageProof(address common.Address, key common.Hash, stateRoot common.Hash) (*st.StorageProof, error) {
+	storeView, err := ledger.getStoreViewAt(stateRoot)
+	if err != nil {
+		return nil, err
+	}
+	return storeView.ProveStorage(address, key)
+}
+
+// TraverseStorageAt visits the non-empty storage slots of the contract in the state with the given root, in the
+// order of their keys until the callback returns false
+func (ledger *Ledger) TraverseStorageAt(address common.Address, stateRoot common.Hash, cb func(key, value common.Hash) bool) error {
+	storeView, err := ledger.getStoreViewAt(stateRoot)
+	if err != nil {
+		return err
+	}
+	return storeView.TraverseStorage(address, cb)
+}
+
+// getStoreViewAt returns a read-only view of the state with the given root. The height of the view is irrelevant
+// for the reads.
+func (ledger *Ledger) getStoreViewAt(stateRoot common.Hash) (*st.StoreView, error) {
+	storeView := st.NewStoreView(0, stateRoot, ledger.state.DB())
+	if storeView == nil {
+		return nil, fmt.Errorf("The state %v is not available, it might have been pruned", stateRoot.Hex())
+	}
+	return storeView, nil
+}
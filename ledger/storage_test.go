@@ -0,0 +1,60 @@
+package ledger
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	st "github.com/thetatoken/theta/ledger/state"
+)
+
+func TestLedgerStorageAt(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, ledger, _ := newTestLedger()
+	contract := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	slot := func(i int64) common.Hash { return common.BigToHash(big.NewInt(i)) }
+
+	ledger.state.Delivered().SetState(contract, slot(1), slot(10))
+	ledger.state.Delivered().SetState(contract, slot(2), slot(20))
+	root1 := ledger.state.Commit()
+	ledger.state.Delivered().SetState(contract, slot(1), slot(11))
+	ledger.state.Delivered().SetState(contract, slot(3), slot(30))
+	root2 := ledger.state.Commit()
+
+	// Each slot is read as of the given state root
+	value, err := ledger.GetStorageAt(contract, slot(1), root1)
+	require.Nil(err)
+	assert.Equal(slot(10), value)
+	value, err = ledger.GetStorageAt(contract, slot(1), root2)
+	require.Nil(err)
+	assert.Equal(slot(11), value)
+	value, err = ledger.GetStorageAt(contract, slot(3), root1)
+	require.Nil(err)
+	assert.Equal(common.Hash{}, value)
+
+	// And proven against it
+	proof, err := ledger.GetStorageProof(contract, slot(1), root1)
+	require.Nil(err)
+	value, err = st.VerifyStorageProof(root1, proof)
+	require.Nil(err)
+	assert.Equal(slot(10), value)
+	_, err = st.VerifyStorageProof(root2, proof)
+	assert.NotNil(err)
+
+	// The storage is enumerated as of the state root as well
+	storage := map[common.Hash]common.Hash{}
+	err = ledger.TraverseStorageAt(contract, root1, func(key, value common.Hash) bool {
+		storage[key] = value
+		return true
+	})
+	require.Nil(err)
+	assert.Equal(map[common.Hash]common.Hash{slot(1): slot(10), slot(2): slot(20)}, storage)
+
+	// The unknown states are reported
+	_, err = ledger.GetStorageAt(contract, slot(1), common.BytesToHash([]byte("unknown")))
+	assert.NotNil(err)
+}
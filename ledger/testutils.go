@@ -70,6 +70,7 @@ func newExecSim(chainID string, db database.Database, snapshot mockSnapshot, val
 		mu:        &sync.RWMutex{},
 		state:     ledgerState,
 		executor:  executor,
+		clock:     common.SystemClock,
 	}
 	consensus.SetLedger(ledger)
 
@@ -154,6 +155,7 @@ func genSimSnapshot(chainID string, db database.Database) (snapshot mockSnapshot
 
 	sv := state.NewStoreView(initHeight, common.Hash{}, db)
 	sv.UpdateValidatorCandidatePool(vcp)
+	exec.LowerDustThresholds(sv)
 
 	sv.SetAccount(src1Acc.Address, &src1Acc.Account)
 	sv.SetAccount(src2Acc.Address, &src2Acc.Account)
@@ -186,11 +188,16 @@ func genSimSnapshot(chainID string, db database.Database) (snapshot mockSnapshot
 }
 
 func newTestLedger() (chainID string, ledger *Ledger, mempool *mp.Mempool) {
+	return newTestLedgerWithDB(backend.NewMemDatabase())
+}
+
+// newTestLedgerWithDB is similar to newTestLedger, but the state is stored in the given database, e.g. to inject
+// faults into its reads
+func newTestLedgerWithDB(db database.Database) (chainID string, ledger *Ledger, mempool *mp.Mempool) {
 	chainID = "test_chain_id"
 	peerID := "peer0"
 	proposerSeed := "proposer"
 
-	db := backend.NewMemDatabase()
 	chain := &blockchain.Chain{ChainID: chainID}
 	consensus := exec.NewTestConsensusEngine(proposerSeed)
 	valMgr := newTesetValidatorManager(consensus)
@@ -207,6 +214,7 @@ func newTestLedger() (chainID string, ledger *Ledger, mempool *mp.Mempool) {
 	initHeight := uint64(1)
 	initRootHash := common.Hash{}
 	ledger.ResetState(initHeight, initRootHash)
+	exec.LowerDustThresholds(ledger.state.Delivered(), ledger.state.Checked(), ledger.state.Screened())
 
 	return chainID, ledger, mempool
 }
@@ -350,6 +358,25 @@ func newRawSendTx(chainID string, sequence int, addPubKey bool, accOut, accIn ty
 	return sendTxBytes
 }
 
+// newRawContractTx creates a SmartContractTx calling the contract at the given address, or deploying the data as the
+// init code if the address is empty
+func newRawContractTx(chainID string, sequence uint64, accFrom types.PrivAccount, to common.Address, value int64,
+	gasLimit uint64, data common.Bytes) common.Bytes {
+	tx := &types.SmartContractTx{
+		From:     types.TxInput{Address: accFrom.Address, Coins: types.NewCoins(0, value), Sequence: sequence},
+		To:       types.TxOutput{Address: to},
+		GasLimit: gasLimit,
+		GasPrice: new(big.Int).SetUint64(types.MinimumGasPrice),
+		Data:     data,
+	}
+	tx.From.Signature = accFrom.Sign(tx.SignBytes(chainID))
+	rawTx, err := types.TxToBytes(tx)
+	if err != nil {
+		panic(err)
+	}
+	return rawTx
+}
+
 func getMinimumTxFee() int64 {
 	return int64(types.MinimumTransactionFeeTFuelWei)
 }
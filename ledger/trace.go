@@ -0,0 +1,98 @@
+package ledger
+
+import (
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/hexutil"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/ledger/vm"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+// TxTrace is the outcome of tracing a transaction with TraceTx. The trace itself is captured by the tracer.
+type TxTrace struct {
+	BlockHash   common.Hash      `json:"block_hash"`
+	BlockHeight uint64           `json:"block_height"`
+	TxIndex     int              `json:"tx_index"`
+	Receipt     *types.TxReceipt `json:"receipt"`   // the receipt of the re-execution
+	VmReturn    hexutil.Bytes    `json:"vm_return"` // the value returned by the contract
+}
+
+// TraceTx re-executes the smart contract transaction at the given index of the block with the given hash, and
+// reports its execution to the tracer, e.g. a vm.StructLogger or a vm.CallTracer. The transaction is executed
+// against the state of the parent block, after the transactions preceding it in the block.
+//
+// Same as ReplayBlocks, the transactions are re-executed against a scratch checkout whose changes are never
+// saved, so the live state is not disturbed. It returns an error if the block is not available, if the state
+// of its parent has been pruned, or if a preceding transaction fails.
+func (ledger *Ledger) TraceTx(blockHash common.Hash, txIndex int, tracer vm.Tracer) (trace *TxTrace, err error) {
+	if ledger.chain == nil {
+		return nil, fmt.Errorf("The blocks are not available")
+	}
+	block, err := ledger.chain.FindBlock(blockHash)
+	if err != nil {
+		return nil, fmt.Errorf("Block %v not found: %v", blockHash.Hex(), err)
+	}
+	if txIndex < 0 || txIndex >= len(block.Txs) {
+		return nil, fmt.Errorf("Invalid tx index %v, block %v has %v transactions", txIndex, blockHash.Hex(), len(block.Txs))
+	}
+	tx, err := types.TxFromBytes(block.Txs[txIndex])
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse the transaction: %v", err)
+	}
+	if _, ok := tx.(*types.SmartContractTx); !ok {
+		return nil, fmt.Errorf("Only the smart contract transactions can be traced, not %T", tx)
+	}
+	parent, err := ledger.chain.FindBlock(block.Parent)
+	if err != nil {
+		return nil, fmt.Errorf("Parent block %v not found: %v", block.Parent.Hex(), err)
+	}
+
+	db := ledger.state.DB()
+	var prunedHeight uint64
+	err = kvstore.NewKVStore(db).Get(state.StatePruningProgressKey(), &prunedHeight)
+	if err == nil && parent.Height <= prunedHeight {
+		return nil, fmt.Errorf("The state at height %v has been pruned", parent.Height)
+	}
+
+	consensus := &reproConsensusEngine{}
+	scratch, err := newScratchLedger(ledger.state.GetChainID(), db, parent.Height, parent.StateHash, consensus, ledger.valMgr,
+		ledger.executor.RewardSchedule())
+	if err != nil {
+		return nil, fmt.Errorf("The state at height %v is not available, it might have been pruned: %v", parent.Height, err)
+	}
+	consensus.ledger = scratch
+	consensus.block = block.Block
+	scratch.currentBlock = block.Block
+
+	defer func() {
+		if r := recover(); r != nil {
+			trace, err = nil, fmt.Errorf("Panic while tracing the transaction: %v", panicMessage(r))
+		}
+	}()
+
+	for i := 0; i < txIndex; i++ {
+		precedingTx, err := types.TxFromBytes(block.Txs[i])
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse transaction %v: %v", i, err)
+		}
+		if _, res := scratch.executor.ExecuteTx(precedingTx); res.IsError() {
+			return nil, fmt.Errorf("Failed to re-execute transaction %v: %v", i, res.Message)
+		}
+	}
+
+	_, res := scratch.executor.TraceTx(tx, scratch.state.Delivered(), tracer)
+	trace = &TxTrace{
+		BlockHash:   blockHash,
+		BlockHeight: block.Height,
+		TxIndex:     txIndex,
+		Receipt:     newTxReceipt(crypto.Keccak256Hash(block.Txs[txIndex]), tx, res),
+	}
+	if vmReturn, ok := res.Info["vmReturn"]; ok {
+		trace.VmReturn = hexutil.Bytes(vmReturn.(common.Bytes))
+	}
+	return trace, nil
+}
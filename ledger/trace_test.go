@@ -0,0 +1,106 @@
+package ledger
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/ledger/vm"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+func TestLedgerTraceTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, _ := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 1)
+
+	// The contract calls the callee, which stores 1 at slot 0
+	calleeAddr := common.HexToAddress("0x1000000000000000000000000000000000000002")
+	contractAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	ledger.state.Delivered().SetCode(calleeAddr, common.Hex2Bytes("600160005500"))
+	ledger.state.Delivered().SetCode(contractAddr,
+		common.Hex2Bytes("6000600060006000600073"+hex.EncodeToString(calleeAddr.Bytes())+"5af100"))
+	ledger.state.Commit()
+
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = ledger.state.Height()
+	root.StateHash = ledger.state.Delivered().Hash()
+	store := kvstore.NewKVStore(ledger.state.DB())
+	ledger.chain = blockchain.NewChain(chainID, store, root)
+
+	// The contract transaction only passes the sanity check after the send transaction preceding it
+	contractTx := &types.SmartContractTx{
+		From:     types.TxInput{Address: accIns[0].Address, Sequence: 2},
+		To:       types.TxOutput{Address: contractAddr},
+		GasLimit: 100000,
+		GasPrice: new(big.Int).SetUint64(types.MinimumGasPrice),
+	}
+	contractTx.From.Signature = accIns[0].Sign(contractTx.SignBytes(chainID))
+	contractTxBytes, err := types.TxToBytes(contractTx)
+	require.Nil(err)
+
+	// The block is not applied, since the executor does not dispatch the smart contract transactions
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Height = root.Height + 1
+	block.Parent = root.Hash()
+	block.StateHash = root.StateHash
+	block.Txs = []common.Bytes{newRawSendTx(chainID, 1, true, accOut, accIns[0], false), contractTxBytes}
+	extBlock, err := ledger.chain.AddBlock(block)
+	require.Nil(err)
+	liveHeight, liveRoot := ledger.state.Height(), ledger.state.Delivered().Hash()
+
+	callTracer := vm.NewCallTracer()
+	trace, err := ledger.TraceTx(extBlock.Hash(), 1, callTracer)
+	require.Nil(err)
+	assert.Equal(extBlock.Hash(), trace.BlockHash)
+	assert.Equal(block.Height, trace.BlockHeight)
+	assert.Equal(1, trace.TxIndex)
+	require.True(trace.Receipt.IsOK(), trace.Receipt.Message)
+	assert.Equal("", trace.Receipt.Message)
+	assert.True(trace.Receipt.GasUsed > 0)
+
+	frame := callTracer.Result()
+	require.NotNil(frame)
+	assert.Equal(accIns[0].Address, frame.From)
+	assert.Equal(contractAddr, frame.To)
+	assert.Equal(trace.Receipt.GasUsed, uint64(frame.GasUsed)+21000)
+	require.Equal(1, len(frame.Calls))
+	assert.Equal("CALL", frame.Calls[0].Type)
+	assert.Equal(calleeAddr, frame.Calls[0].To)
+
+	logger := vm.NewStructLogger(nil)
+	_, err = ledger.TraceTx(extBlock.Hash(), 1, logger)
+	require.Nil(err)
+	assert.Equal(13, len(logger.StructLogs()))
+
+	// The live state is not disturbed
+	assert.Equal(liveHeight, ledger.state.Height())
+	assert.Equal(liveRoot, ledger.state.Delivered().Hash())
+	assert.Equal(common.Hash{}, ledger.state.Delivered().GetState(calleeAddr, common.Hash{}))
+	assert.Equal(uint64(0), ledger.state.Delivered().GetAccount(accIns[0].Address).Sequence)
+
+	// Only the smart contract transactions of the known blocks can be traced
+	_, err = ledger.TraceTx(extBlock.Hash(), 0, callTracer)
+	assert.EqualError(err, "Only the smart contract transactions can be traced, not *types.SendTx")
+	_, err = ledger.TraceTx(extBlock.Hash(), 2, callTracer)
+	assert.EqualError(err, fmt.Sprintf("Invalid tx index 2, block %v has 2 transactions", extBlock.Hash().Hex()))
+	_, err = ledger.TraceTx(common.BytesToHash([]byte("unknown block")), 0, callTracer)
+	assert.NotNil(err)
+
+	// The state of the parent block has been pruned
+	require.Nil(store.Put(state.StatePruningProgressKey(), root.Height))
+	_, err = ledger.TraceTx(extBlock.Hash(), 1, callTracer)
+	assert.EqualError(err, fmt.Sprintf("The state at height %v has been pruned", root.Height))
+}
@@ -0,0 +1,129 @@
+package ledger
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/viper"
+
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/database"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+// TxLocation locates a transaction within the chain
+type TxLocation struct {
+	BlockHash   common.Hash
+	BlockHeight uint64
+	Index       uint64
+}
+
+// txLocationKey constructs the DB key for the location of the given transaction hash.
+func txLocationKey(hash common.Hash) common.Bytes {
+	return append(common.Bytes("ledger/txidx/"), hash[:]...)
+}
+
+// txIndexedBlockKey constructs the DB key marking the transactions of the given block as indexed.
+func txIndexedBlockKey(blockHash common.Hash) common.Bytes {
+	return append(common.Bytes("ledger/txidxb/"), blockHash[:]...)
+}
+
+// GetTxByHash returns the raw bytes and the location of the transaction with the given hash. It
+// requires the tx index, see common.CfgStorageTxIndexEnabled and ReindexTxs().
+func (ledger *Ledger) GetTxByHash(hash common.Hash) (common.Bytes, *TxLocation, error) {
+	store := kvstore.NewKVStore(ledger.state.DB())
+	location := &TxLocation{}
+	err := store.Get(txLocationKey(hash), location)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, err := ledger.chain.FindBlock(location.BlockHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	if location.Index >= uint64(len(block.Txs)) {
+		return nil, nil, fmt.Errorf("Tx index %v out of range for block %v", location.Index, location.BlockHash.Hex())
+	}
+	return block.Txs[location.Index], location, nil
+}
+
+// indexBlockTxs indexes the transactions of a block being applied, if the tx index is enabled. It is called
+// before the state of the block is committed, so that a committed block is always indexed, and a failure
+// leaves the block to be applied again.
+func (ledger *Ledger) indexBlockTxs(block *core.Block) error {
+	if !viper.GetBool(common.CfgStorageTxIndexEnabled) {
+		return nil
+	}
+	if err := IndexBlockTxs(ledger.state.DB(), block); err != nil {
+		return fmt.Errorf("Failed to index the txs of block %v: %v", block.Hash().Hex(), err)
+	}
+	return nil
+}
+
+// IndexBlockTxs maps the hashes of the transactions of the given block to their locations. The
+// entries and the marker of the block are written in a single batch, so that a block is either
+// fully indexed or not indexed at all.
+func IndexBlockTxs(db database.Database, block *core.Block) error {
+	blockHash := block.Hash()
+	batch := db.NewBatch()
+	for idx, rawTx := range block.Txs {
+		location := &TxLocation{
+			BlockHash:   blockHash,
+			BlockHeight: block.Height,
+			Index:       uint64(idx),
+		}
+		encodedLocation, err := rlp.EncodeToBytes(location)
+		if err != nil {
+			return err
+		}
+		if err := batch.Put(txLocationKey(types.RawTxHash(rawTx)), encodedLocation); err != nil {
+			return err
+		}
+	}
+	if err := batch.Put(txIndexedBlockKey(blockHash), []byte{1}); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// IsBlockTxsIndexed returns whether the transactions of the given block have been indexed
+func IsBlockTxsIndexed(db database.Database, blockHash common.Hash) bool {
+	has, err := db.Has(txIndexedBlockKey(blockHash))
+	return err == nil && has
+}
+
+// ReindexTxs rebuilds the tx index from the valid blocks of the chain within the given range of
+// heights. At each height, the finalized blocks are indexed last, so the transactions also included
+// by the blocks of abandoned forks are located in the finalized ones. It returns the number of the
+// indexed blocks and transactions.
+func ReindexTxs(db database.Database, chain *blockchain.Chain, startHeight, endHeight uint64) (numBlocks int, numTxs int, err error) {
+	for height := startHeight; height <= endHeight; height++ {
+		blocks := []*core.ExtendedBlock{}
+		for _, block := range chain.FindBlocksByHeight(height) {
+			if block.Status.IsValid() {
+				blocks = append(blocks, block)
+			}
+		}
+		sort.SliceStable(blocks, func(i, j int) bool {
+			return !blocks[i].Status.IsFinalized() && blocks[j].Status.IsFinalized()
+		})
+
+		for _, block := range blocks {
+			if err := IndexBlockTxs(db, block.Block); err != nil {
+				return numBlocks, numTxs, err
+			}
+			numBlocks++
+			numTxs += len(block.Txs)
+		}
+
+		if height == endHeight { // avoid the overflow
+			break
+		}
+	}
+	return numBlocks, numTxs, nil
+}
@@ -0,0 +1,105 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/store"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+func TestLedgerTxIndex(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 2)
+
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = ledger.state.Height() - 1
+	root.StateHash = ledger.state.Delivered().Hash()
+	ledger.chain = blockchain.NewChain(chainID, kvstore.NewKVStore(ledger.state.DB()), root)
+
+	parent := ledger.chain.Root()
+	applyNextBlock := func() *core.ExtendedBlock {
+		stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+		require.True(res.IsOK(), res.Message)
+
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = parent.Height + 1
+		block.Parent = parent.Hash()
+		block.StateHash = stateRoot
+		block.Txs = blockRawTxs
+
+		var err error
+		parent, err = ledger.chain.AddBlock(block)
+		require.Nil(err)
+		res = ledger.ApplyBlockTxs(block)
+		require.True(res.IsOK(), res.Message)
+		return parent
+	}
+
+	// The index is disabled by default
+	rawTx1 := newRawSendTx(chainID, 1, true, accOut, accIns[0], false)
+	require.Nil(mempool.InsertTransaction(rawTx1))
+	block1 := applyNextBlock()
+	_, _, err := ledger.GetTxByHash(crypto.Keccak256Hash(rawTx1))
+	assert.Equal(store.ErrKeyNotFound, err)
+	assert.False(IsBlockTxsIndexed(ledger.state.DB(), block1.Hash()))
+
+	viper.Set(common.CfgStorageTxIndexEnabled, true)
+	defer viper.Set(common.CfgStorageTxIndexEnabled, false)
+
+	rawTx2 := newRawSendTx(chainID, 1, true, accOut, accIns[1], false)
+	require.Nil(mempool.InsertTransaction(rawTx2))
+	block2 := applyNextBlock()
+	assert.True(IsBlockTxsIndexed(ledger.state.DB(), block2.Hash()))
+
+	raw, location, err := ledger.GetTxByHash(crypto.Keccak256Hash(rawTx2))
+	require.Nil(err)
+	assert.Equal(rawTx2, raw)
+	assert.Equal(block2.Hash(), location.BlockHash)
+	assert.Equal(block2.Height, location.BlockHeight)
+	assert.Equal(block2.Txs[location.Index], rawTx2)
+
+	// A block of an abandoned fork also including the tx
+	fork := core.NewBlock()
+	fork.ChainID = chainID
+	fork.Height = block2.Height
+	fork.Parent = block2.Parent
+	fork.Epoch = block2.Epoch + 1
+	fork.Txs = []common.Bytes{rawTx2}
+	_, err = ledger.chain.AddBlock(fork)
+	require.Nil(err)
+	ledger.chain.MarkBlockValid(fork.Hash())
+	require.Nil(IndexBlockTxs(ledger.state.DB(), fork))
+	_, location, err = ledger.GetTxByHash(crypto.Keccak256Hash(rawTx2))
+	require.Nil(err)
+	assert.Equal(fork.Hash(), location.BlockHash)
+
+	// The re-index locates the txs in the finalized blocks
+	ledger.chain.MarkBlockValid(block1.Hash())
+	ledger.chain.MarkBlockValid(block2.Hash())
+	require.Nil(ledger.chain.FinalizePreviousBlocks(block2.Hash()))
+	numBlocks, numTxs, err := ReindexTxs(ledger.state.DB(), ledger.chain, block1.Height, block2.Height)
+	require.Nil(err)
+	assert.Equal(3, numBlocks)
+	assert.Equal(len(block1.Txs)+len(block2.Txs)+len(fork.Txs), numTxs)
+
+	raw, location, err = ledger.GetTxByHash(crypto.Keccak256Hash(rawTx1))
+	require.Nil(err)
+	assert.Equal(rawTx1, raw)
+	assert.Equal(block1.Hash(), location.BlockHash)
+	_, location, err = ledger.GetTxByHash(crypto.Keccak256Hash(rawTx2))
+	require.Nil(err)
+	assert.Equal(block2.Hash(), location.BlockHash)
+	assert.True(IsBlockTxsIndexed(ledger.state.DB(), block1.Hash()))
+}
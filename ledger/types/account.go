@@ -3,10 +3,12 @@ package types
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 
 	"github.com/pkg/errors"
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/rlp"
 )
 
 var EmptyCodeHash = common.BytesToHash(crypto.Keccak256(nil))
@@ -21,6 +23,63 @@ type Account struct {
 	// Smart contract
 	Root     common.Hash `json:"root"`      // merkle root of the storage trie
 	CodeHash common.Hash `json:"code_hash"` // hash of the smart contract code
+
+	// Multi-signature, nil for a regular account
+	Multisig *MultisigPolicy `json:"multisig,omitempty"`
+}
+
+// accountRLP is the RLP encoding of Account. The multisig policy is only appended if present, so that the
+// encoding, and thus the state root, of the regular accounts remain the same.
+type accountRLP struct {
+	Address                common.Address
+	Sequence               uint64
+	Balance                Coins
+	ReservedFunds          []ReservedFund
+	LastUpdatedBlockHeight uint64
+	Root                   common.Hash
+	CodeHash               common.Hash
+	Multisig               []*MultisigPolicy `rlp:"tail"`
+}
+
+// EncodeRLP implements rlp.Encoder.
+func (acc *Account) EncodeRLP(w io.Writer) error {
+	enc := accountRLP{
+		Address:                acc.Address,
+		Sequence:               acc.Sequence,
+		Balance:                acc.Balance,
+		ReservedFunds:          acc.ReservedFunds,
+		LastUpdatedBlockHeight: acc.LastUpdatedBlockHeight,
+		Root:                   acc.Root,
+		CodeHash:               acc.CodeHash,
+	}
+	if acc.Multisig != nil {
+		enc.Multisig = []*MultisigPolicy{acc.Multisig}
+	}
+	return rlp.Encode(w, enc)
+}
+
+// DecodeRLP implements rlp.Decoder.
+func (acc *Account) DecodeRLP(s *rlp.Stream) error {
+	var dec accountRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	if len(dec.Multisig) > 1 {
+		return fmt.Errorf("rlp: too many elements for Account")
+	}
+	*acc = Account{
+		Address:                dec.Address,
+		Sequence:               dec.Sequence,
+		Balance:                dec.Balance,
+		ReservedFunds:          dec.ReservedFunds,
+		LastUpdatedBlockHeight: dec.LastUpdatedBlockHeight,
+		Root:                   dec.Root,
+		CodeHash:               dec.CodeHash,
+	}
+	if len(dec.Multisig) == 1 {
+		acc.Multisig = dec.Multisig[0]
+	}
+	return nil
 }
 
 type AccountJSON struct {
@@ -30,6 +89,7 @@ type AccountJSON struct {
 	LastUpdatedBlockHeight common.JSONUint64 `json:"last_updated_block_height"`
 	Root                   common.Hash       `json:"root"`
 	CodeHash               common.Hash       `json:"code"`
+	Multisig               *MultisigPolicy   `json:"multisig,omitempty"`
 }
 
 func NewAccountJSON(acc Account) AccountJSON {
@@ -38,8 +98,9 @@ func NewAccountJSON(acc Account) AccountJSON {
 		Balance:                acc.Balance,
 		ReservedFunds:          acc.ReservedFunds,
 		LastUpdatedBlockHeight: common.JSONUint64(acc.LastUpdatedBlockHeight),
-		Root:     acc.Root,
-		CodeHash: acc.CodeHash,
+		Root:                   acc.Root,
+		CodeHash:               acc.CodeHash,
+		Multisig:               acc.Multisig,
 	}
 }
 
@@ -49,8 +110,9 @@ func (acc AccountJSON) Account() Account {
 		Balance:                acc.Balance,
 		ReservedFunds:          acc.ReservedFunds,
 		LastUpdatedBlockHeight: uint64(acc.LastUpdatedBlockHeight),
-		Root:     acc.Root,
-		CodeHash: acc.CodeHash,
+		Root:                   acc.Root,
+		CodeHash:               acc.CodeHash,
+		Multisig:               acc.Multisig,
 	}
 }
 
@@ -81,6 +143,7 @@ func (acc *Account) Copy() *Account {
 		return nil
 	}
 	accCopy := *acc
+	accCopy.Balance = acc.Balance.Copy()
 	return &accCopy
 }
 
@@ -127,8 +190,8 @@ func (acc *Account) CheckReserveFund(collateral Coins, fund Coins, duration uint
 // ReserveFund reserves the given amount of fund for subsequence service payments
 func (acc *Account) ReserveFund(collateral Coins, fund Coins, resourceIDs []string, endBlockHeight uint64, reserveSequence uint64) {
 	newReservedFund := ReservedFund{
-		Collateral:      collateral.NoNil(),
-		InitialFund:     fund.NoNil(),
+		Collateral:      collateral.Copy(),
+		InitialFund:     fund.Copy(),
 		UsedFund:        NewCoins(0, 0),
 		ResourceIDs:     resourceIDs,
 		EndBlockHeight:  endBlockHeight,
@@ -197,6 +260,57 @@ func (acc *Account) ReleaseFund(currentBlockHeight uint64, reserveSequence uint6
 	}
 }
 
+// RemainingReservedFund returns the part of the reserved fund not yet transferred, i.e. the maximum amount
+// the subsequent service payments can settle
+func (acc *Account) RemainingReservedFund(reserveSequence uint64) (Coins, bool) {
+	for _, reservedFund := range acc.ReservedFunds {
+		if reservedFund.ReserveSequence != reserveSequence {
+			continue
+		}
+		return reservedFund.InitialFund.Minus(reservedFund.UsedFund), true
+	}
+	return Coins{}, false
+}
+
+// CheckPartialReleaseFund verifies inputs for PartialReleaseFund. The amount is checked against the
+// remaining fund separately, see RemainingReservedFund
+func (acc *Account) CheckPartialReleaseFund(targetAddress common.Address, currentBlockHeight uint64, reserveSequence uint64) error {
+	for _, reservedFund := range acc.ReservedFunds {
+		if reservedFund.ReserveSequence != reserveSequence {
+			continue
+		}
+
+		if reservedFund.EndBlockHeight < currentBlockHeight {
+			return errors.New("Already expired, use ReleaseFundTx instead")
+		}
+
+		// Only the target the fund has paid can agree to the release
+		for _, transferRecord := range reservedFund.TransferRecords {
+			if transferRecord.ServicePayment.Target.Address != targetAddress {
+				return errors.Errorf("The reserved fund has paid other target %v", transferRecord.ServicePayment.Target.Address)
+			}
+		}
+		return nil // at most one matching reserveSequence
+	}
+
+	return errors.Errorf("No matching ReserveSequence")
+}
+
+// PartialReleaseFund returns the given amount of the reserved fund to the balance. The reservation
+// itself, including its collateral, is kept until it is released
+func (acc *Account) PartialReleaseFund(amount Coins, reserveSequence uint64) {
+	for idx := range acc.ReservedFunds {
+		reservedFund := &acc.ReservedFunds[idx]
+		if reservedFund.ReserveSequence != reserveSequence {
+			continue
+		}
+
+		reservedFund.InitialFund = reservedFund.InitialFund.Minus(amount)
+		acc.Balance = acc.Balance.Plus(amount)
+		return // at most one matching reserveSequence
+	}
+}
+
 // CheckTransferReservedFund verifies inputs for SplitReservedFund
 func (acc *Account) CheckTransferReservedFund(tgtAcc *Account, transferAmount Coins, paymentSequence uint64, currentBlockHeight uint64, reserveSequence uint64) error {
 	for _, reservedFund := range acc.ReservedFunds {
@@ -0,0 +1,78 @@
+package types
+
+import (
+	"io"
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/rlp"
+)
+
+// The holdings of the coins tracked by the balance change journal
+const (
+	HoldingBalance      string = "balance"       // Account.Balance
+	HoldingReservedFund string = "reserved_fund" // collateral and the unused fund of the reserved funds of the account
+	HoldingStake        string = "stake"         // stakes deposited by the address, until they are returned
+	HoldingBurnedFee    string = "burned_fee"    // tx fees, which are taken out of circulation
+	HoldingBurned       string = "burned"        // coins destroyed by the BurnTxs, and the slashed stakes
+	HoldingProposerFee  string = "proposer_fee"  // tx fees set aside for the next block proposer, see FeePolicy
+)
+
+// BalanceChange records the change of the coins of one asset held by an address
+type BalanceChange struct {
+	Address common.Address // the zero address for HoldingBurnedFee, HoldingBurned and HoldingProposerFee
+	Asset   string         // DenomThetaWei or DenomTFuelWei
+	Holding string
+	Delta   *big.Int    // negative for the decreases
+	TxHash  common.Hash // hash of the raw tx causing the change, empty for the delayed state updates, e.g. stake returns
+}
+
+type rlpBalanceChange struct {
+	Address  common.Address
+	Asset    string
+	Holding  string
+	Amount   *big.Int
+	Negative bool
+	TxHash   common.Hash
+}
+
+// EncodeRLP implements rlp.Encoder, RLP does not support negative integers.
+func (bc *BalanceChange) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, rlpBalanceChange{
+		Address:  bc.Address,
+		Asset:    bc.Asset,
+		Holding:  bc.Holding,
+		Amount:   new(big.Int).Abs(bc.Delta),
+		Negative: bc.Delta.Sign() < 0,
+		TxHash:   bc.TxHash,
+	})
+}
+
+// DecodeRLP implements rlp.Decoder.
+func (bc *BalanceChange) DecodeRLP(s *rlp.Stream) error {
+	var dec rlpBalanceChange
+	err := s.Decode(&dec)
+	if err != nil {
+		return err
+	}
+	delta := dec.Amount
+	if dec.Negative {
+		delta = new(big.Int).Neg(delta)
+	}
+	*bc = BalanceChange{
+		Address: dec.Address,
+		Asset:   dec.Asset,
+		Holding: dec.Holding,
+		Delta:   delta,
+		TxHash:  dec.TxHash,
+	}
+	return nil
+}
+
+// BlockBalanceChanges is the balance change journal of an applied block. The coins only enter the
+// circulation through the coinbase rewards, so the deltas of each asset sum up to the issuance.
+type BlockBalanceChanges struct {
+	BlockHash common.Hash
+	Changes   []*BalanceChange
+	Issuance  Coins // coins minted by the block, i.e. the coinbase rewards
+}
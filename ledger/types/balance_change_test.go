@@ -0,0 +1,52 @@
+package types
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/rlp"
+)
+
+func TestBlockBalanceChangesRLP(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	changes := &BlockBalanceChanges{
+		BlockHash: common.BytesToHash([]byte("block")),
+		Changes: []*BalanceChange{
+			{
+				Address: common.HexToAddress("0x1000000000000000000000000000000000000001"),
+				Asset:   DenomThetaWei,
+				Holding: HoldingBalance,
+				Delta:   big.NewInt(-1000),
+				TxHash:  common.BytesToHash([]byte("tx")),
+			},
+			{
+				Address: common.HexToAddress("0x1000000000000000000000000000000000000001"),
+				Asset:   DenomThetaWei,
+				Holding: HoldingStake,
+				Delta:   big.NewInt(1000),
+			},
+		},
+		Issuance: NewCoins(0, 400),
+	}
+
+	raw, err := rlp.EncodeToBytes(changes)
+	require.Nil(err)
+	decoded := &BlockBalanceChanges{}
+	require.Nil(rlp.DecodeBytes(raw, decoded))
+
+	assert.Equal(changes.BlockHash, decoded.BlockHash)
+	assert.True(changes.Issuance.IsEqual(decoded.Issuance))
+	require.Equal(2, len(decoded.Changes))
+	for i, change := range changes.Changes {
+		assert.Equal(change.Address, decoded.Changes[i].Address)
+		assert.Equal(change.Asset, decoded.Changes[i].Asset)
+		assert.Equal(change.Holding, decoded.Changes[i].Holding)
+		assert.Equal(0, change.Delta.Cmp(decoded.Changes[i].Delta))
+		assert.Equal(change.TxHash, decoded.Changes[i].TxHash)
+	}
+}
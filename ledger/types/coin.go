@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"strconv"
 	"strings"
+	"unicode"
 
+	"github.com/pkg/errors"
 	"github.com/thetatoken/theta/common"
 )
 
@@ -43,8 +46,9 @@ func (c CoinsJSON) Coins() Coins {
 	}
 }
 
+// MarshalJSON encodes the unset components as zero, so that all the amounts are decimal strings
 func (c Coins) MarshalJSON() ([]byte, error) {
-	return json.Marshal(NewCoinsJSON(c))
+	return json.Marshal(NewCoinsJSON(c.NoNil()))
 }
 
 func (c *Coins) UnmarshalJSON(data []byte) error {
@@ -68,10 +72,13 @@ func (coins Coins) String() string {
 	return fmt.Sprintf("%v %v, %v %v", coins.ThetaWei, DenomThetaWei, coins.TFuelWei, DenomTFuelWei)
 }
 
+// IsValid returns whether both of the components are set and nonnegative
 func (coins Coins) IsValid() bool {
-	return coins.IsNonnegative()
+	return coins.ThetaWei != nil && coins.TFuelWei != nil && coins.IsNonnegative()
 }
 
+// NoNil returns the coins with the nil components replaced by zero. The other components are shared
+// with the receiver, so the result must not be modified in place. Use Copy for that.
 func (coins Coins) NoNil() Coins {
 	theta := coins.ThetaWei
 	if theta == nil {
@@ -88,6 +95,16 @@ func (coins Coins) NoNil() Coins {
 	}
 }
 
+// Copy returns a deep copy of the coins with the nil components replaced by zero. Modifying it in place
+// never affects the receiver.
+func (coins Coins) Copy() Coins {
+	c := coins.NoNil()
+	return Coins{
+		ThetaWei: new(big.Int).Set(c.ThetaWei),
+		TFuelWei: new(big.Int).Set(c.TFuelWei),
+	}
+}
+
 // CalculatePercentage function calculates amount of coins for the given the percentage
 func (coins Coins) CalculatePercentage(percentage uint) Coins {
 	c := coins.NoNil()
@@ -144,6 +161,51 @@ func (coinsA Coins) Minus(coinsB Coins) Coins {
 	return coinsA.Plus(coinsB.Negative())
 }
 
+// CheckedPlus returns the sum of the coins, or an error if any of them is negative. The nil components
+// are taken as zero.
+func (coinsA Coins) CheckedPlus(coinsB Coins) (Coins, error) {
+	if !coinsA.IsNonnegative() || !coinsB.IsNonnegative() {
+		return Coins{}, fmt.Errorf("Can not add negative coins: %v + %v", coinsA, coinsB)
+	}
+	return coinsA.Plus(coinsB), nil
+}
+
+// CheckedMinus returns the difference of the coins, or an error if any of them is negative, or if the
+// difference would be negative. The nil components are taken as zero.
+func (coinsA Coins) CheckedMinus(coinsB Coins) (Coins, error) {
+	if !coinsA.IsNonnegative() || !coinsB.IsNonnegative() {
+		return Coins{}, fmt.Errorf("Can not subtract negative coins: %v - %v", coinsA, coinsB)
+	}
+	if !coinsA.IsGTE(coinsB) {
+		return Coins{}, fmt.Errorf("Insufficient coins: %v - %v", coinsA, coinsB)
+	}
+	return coinsA.Minus(coinsB), nil
+}
+
+// MulInt returns the coins multiplied by the given integer. The result never shares the big.Ints of
+// the receiver or the multiplier.
+func (coins Coins) MulInt(multiplier *big.Int) Coins {
+	c := coins.NoNil()
+	return Coins{
+		ThetaWei: new(big.Int).Mul(c.ThetaWei, multiplier),
+		TFuelWei: new(big.Int).Mul(c.TFuelWei, multiplier),
+	}
+}
+
+// DivInt returns the coins divided by the given integer, with the same rounding as CalculatePercentage.
+// The result never shares the big.Ints of the receiver or the divisor. It returns an error if the divisor
+// is nil or zero.
+func (coins Coins) DivInt(divisor *big.Int) (Coins, error) {
+	if divisor == nil || divisor.Sign() == 0 {
+		return Coins{}, errors.New("Division by zero")
+	}
+	c := coins.NoNil()
+	return Coins{
+		ThetaWei: new(big.Int).Div(c.ThetaWei, divisor),
+		TFuelWei: new(big.Int).Div(c.TFuelWei, divisor),
+	}, nil
+}
+
 func (coinsA Coins) IsGTE(coinsB Coins) bool {
 	diff := coinsA.Minus(coinsB)
 	return diff.IsNonnegative()
@@ -171,24 +233,157 @@ func (coins Coins) IsNonnegative() bool {
 	return c.ThetaWei.Cmp(Zero) >= 0 && c.TFuelWei.Cmp(Zero) >= 0
 }
 
-// ParseCoinAmount parses a string representation of coin amount.
+// ParseCoinAmount parses a string representation of coin amount. The amount is in Theta or TFuel unless
+// suffixed by "wei", and can have up to 18 decimal places or use the scientific notation, e.g. "12.5",
+// "1e3" or "100000wei". Amounts with a fraction of a wei are rejected rather than rounded.
 func ParseCoinAmount(in string) (*big.Int, bool) {
-	inWei := false
+	decimals := CoinDecimals
 	if len(in) > 3 && strings.EqualFold("wei", in[len(in)-3:]) {
-		inWei = true
+		decimals = 0
 		in = in[:len(in)-3]
 	}
 
-	f, ok := new(big.Float).SetPrec(1024).SetString(in)
-	if !ok || f.Sign() < 0 {
-		return nil, false
+	ret, err := parseDecimal(in, decimals)
+	return ret, err == nil
+}
+
+// ParseCoins parses coins denominated in Theta, ThetaWei, TFuel or TFuelWei (case insensitive), e.g.
+// "12.5 Theta" or "3000000000000 TFuelWei". Multiple amounts are separated by commas, with each coin
+// specified at most once, so the output of Coins.String() parses back into the same coins.
+func ParseCoins(in string) (Coins, error) {
+	coins := NewCoins(0, 0)
+	seenTheta, seenTFuel := false, false
+	for _, part := range strings.Split(in, ",") {
+		part = strings.TrimSpace(part)
+		i := strings.LastIndexFunc(part, func(r rune) bool { return !unicode.IsLetter(r) }) + 1
+		amountStr, denom := strings.TrimSpace(part[:i]), part[i:]
+
+		unit, ok := coinUnits[strings.ToLower(denom)]
+		if !ok {
+			return Coins{}, fmt.Errorf("Invalid denomination %q in %q", denom, part)
+		}
+		amount, err := parseDecimal(amountStr, unit.decimals)
+		if err != nil {
+			return Coins{}, err
+		}
+
+		if unit.isTheta {
+			if seenTheta {
+				return Coins{}, fmt.Errorf("Theta is specified more than once in %q", in)
+			}
+			coins.ThetaWei, seenTheta = amount, true
+		} else {
+			if seenTFuel {
+				return Coins{}, fmt.Errorf("TFuel is specified more than once in %q", in)
+			}
+			coins.TFuelWei, seenTFuel = amount, true
+		}
+	}
+	return coins, nil
+}
+
+// Format formats the Theta or TFuel of the coins in the given denomination, rounded half away from zero
+// to at most the given number of decimal places, and with the trailing zeros removed. For example, 12.345
+// Theta is formatted as "12.35 Theta" with 2 decimals. The wei denominations are always integers.
+func (coins Coins) Format(denom string, decimals int) (string, error) {
+	unit, ok := coinUnits[strings.ToLower(denom)]
+	if !ok {
+		return "", fmt.Errorf("Invalid denomination %q", denom)
+	}
+	if decimals < 0 {
+		return "", fmt.Errorf("Invalid number of decimals: %v", decimals)
+	}
+	if decimals > unit.decimals {
+		decimals = unit.decimals
+	}
+
+	c := coins.NoNil()
+	amount := c.TFuelWei
+	if unit.isTheta {
+		amount = c.ThetaWei
+	}
+
+	scale := pow10(unit.decimals - decimals)
+	quo, rem := new(big.Int).QuoRem(new(big.Int).Abs(amount), scale, new(big.Int))
+	if rem.Lsh(rem, 1).Cmp(scale) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+
+	digits := quo.String()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	ret := digits[:len(digits)-decimals]
+	if frac := strings.TrimRight(digits[len(digits)-decimals:], "0"); frac != "" {
+		ret += "." + frac
+	}
+	if amount.Sign() < 0 && quo.Sign() != 0 {
+		ret = "-" + ret
+	}
+	return ret + " " + unit.name, nil
+}
+
+type coinUnit struct {
+	name     string
+	isTheta  bool
+	decimals int
+}
+
+// coinUnits maps the lower case denominations to their units. Gamma is the former name of TFuel.
+var coinUnits = map[string]coinUnit{
+	"theta":    {DenomTheta, true, CoinDecimals},
+	"thetawei": {DenomThetaWei, true, 0},
+	"tfuel":    {DenomTFuel, false, CoinDecimals},
+	"tfuelwei": {DenomTFuelWei, false, 0},
+	"gamma":    {DenomTFuel, false, CoinDecimals},
+	"gammawei": {DenomTFuelWei, false, 0},
+}
+
+// maxCoinAmountExponent bounds the exponent of the scientific notation, so that a short
+// input cannot make the parser allocate a huge number
+const maxCoinAmountExponent = 1000
+
+// parseDecimal parses a nonnegative decimal number, optionally in the scientific notation, and
+// scales it up by 10^decimals. It fails if the scaled number is not an integer.
+func parseDecimal(in string, decimals int) (*big.Int, error) {
+	mantissa, exp := in, 0
+	if i := strings.IndexAny(in, "eE"); i >= 0 {
+		e, err := strconv.Atoi(in[i+1:])
+		if err != nil || e > maxCoinAmountExponent || e < -maxCoinAmountExponent {
+			return nil, fmt.Errorf("Invalid exponent in amount %q", in)
+		}
+		mantissa, exp = in[:i], e
 	}
 
-	if !inWei {
-		f = f.Mul(f, new(big.Float).SetPrec(1024).SetUint64(1e18))
+	intPart, fracPart := mantissa, ""
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		intPart, fracPart = mantissa[:i], mantissa[i+1:]
+	}
+	if len(intPart)+len(fracPart) == 0 || !isDigits(intPart) || !isDigits(fracPart) {
+		return nil, fmt.Errorf("Invalid amount %q", in)
 	}
 
-	ret, _ := f.Int(nil)
+	ret, _ := new(big.Int).SetString(intPart+fracPart, 10)
+	shift := exp + decimals - len(fracPart)
+	if shift >= 0 {
+		return ret.Mul(ret, pow10(shift)), nil
+	}
+	quo, rem := new(big.Int).QuoRem(ret, pow10(-shift), new(big.Int))
+	if rem.Sign() != 0 {
+		return nil, fmt.Errorf("Amount %q is more precise than %v decimal places", in, decimals)
+	}
+	return quo, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
 
-	return ret, true
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
 }
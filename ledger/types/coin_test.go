@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"strings"
 	"testing"
+	"testing/quick"
 
 	"github.com/thetatoken/theta/rlp"
 
@@ -126,7 +128,9 @@ func TestNoNilException(t *testing.T) {
 	// Should not have nil pointer exception.
 	assert.True(coinsB.IsEqual(coinsC))
 	assert.True(coinsB.IsNonnegative())
-	assert.True(coinsB.IsValid())
+	assert.False(coinsB.IsValid())
+	assert.True(coinsB.NoNil().IsValid())
+	assert.False(Coins{ThetaWei: big.NewInt(1)}.IsValid())
 	assert.True(coinsB.IsZero())
 
 	assert.True(coinsA.Plus(coinsB).IsEqual(coinsB.Plus(coinsA)))
@@ -185,6 +189,131 @@ func TestParseCoinAmount(t *testing.T) {
 	assert.True(big.NewInt(1000).Cmp(ret) == 0)
 }
 
+func TestParseCoinAmountPrecision(t *testing.T) {
+	assert := assert.New(t)
+
+	parse := func(in string) string {
+		ret, ok := ParseCoinAmount(in)
+		if !ok {
+			return "error"
+		}
+		return ret.String()
+	}
+
+	// Exactly 18 decimal places are supported, and more precision is rejected rather than rounded
+	assert.Equal("1", parse("0.000000000000000001"))
+	assert.Equal("1", parse("0.0000000000000000010"))
+	assert.Equal("error", parse("0.0000000000000000001"))
+	assert.Equal("error", parse("0.0000000000000000015"))
+	assert.Equal("error", parse("0.9999999999999999999"))
+	assert.Equal("999999999999999999", parse("0.999999999999999999"))
+	assert.Equal("12500000000000000000", parse("12.5"))
+	assert.Equal("500000000000000000", parse(".5"))
+	assert.Equal("5000000000000000000", parse("5."))
+	assert.Equal("1", parse("1e-18"))
+	assert.Equal("error", parse("1e-19"))
+	assert.Equal("10000", parse("0.0000000000000001e2"))
+	assert.Equal("1", parse("1E0wei"))
+	assert.Equal("error", parse("0.5wei"))
+	assert.Equal("error", parse("1e-1wei"))
+	assert.Equal("5", parse("0.5e1wei"))
+
+	// Beyond int64 and float64 precision
+	assert.Equal("123456789012345678901234567890", parse("123456789012345678901234567890wei"))
+	assert.Equal("123456789012345678901234567890123456789", parse("123456789012345678901.234567890123456789"))
+	assert.Equal("1"+strings.Repeat("0", 118), parse("1e100"))
+
+	for _, in := range []string{"", ".", "wei", "-1", "+1", "1.2.3", "1,000", " 1", "1 ", "0x10", "1e", "1e1.5",
+		"Inf", "NaN", "1e1001", "1e-1001", "1_000"} {
+		assert.Equal("error", parse(in), in)
+	}
+}
+
+func TestParseCoins(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	theta := new(big.Int).Mul(big.NewInt(125), big.NewInt(1e17))
+	coins, err := ParseCoins("12.5 THETA")
+	require.Nil(err)
+	assert.True(coins.IsEqual(Coins{ThetaWei: theta, TFuelWei: big.NewInt(0)}))
+
+	coins, err = ParseCoins("3000000000000 TFuelWei")
+	require.Nil(err)
+	assert.True(coins.IsEqual(NewCoins(0, 3000000000000)))
+
+	coins, err = ParseCoins("3000000000000 GammaWei")
+	require.Nil(err)
+	assert.True(coins.IsEqual(NewCoins(0, 3000000000000)))
+
+	coins, err = ParseCoins("12.5theta, 0.000000000000000007 tfuel")
+	require.Nil(err)
+	assert.True(coins.IsEqual(Coins{ThetaWei: theta, TFuelWei: big.NewInt(7)}))
+
+	huge, _ := new(big.Int).SetString("98765432109876543210987654321", 10)
+	expected := Coins{ThetaWei: huge, TFuelWei: big.NewInt(42)}
+	coins, err = ParseCoins(expected.String())
+	require.Nil(err)
+	assert.True(coins.IsEqual(expected))
+
+	for _, in := range []string{"", "12.5", "THETA", "12.5 BTC", "12.5 Theta Theta", "1 Theta, 2 ThetaWei",
+		"1 TFuel, 1 TFuel", "0.0000000000000000001 Theta", "0.5 ThetaWei", "-1 Theta", "1 Theta,", "1,5 Theta"} {
+		_, err = ParseCoins(in)
+		assert.NotNil(err, in)
+	}
+}
+
+func TestCoinsFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	format := func(coins Coins, denom string, decimals int) string {
+		ret, err := coins.Format(denom, decimals)
+		if err != nil {
+			return "error"
+		}
+		return ret
+	}
+	theta := func(wei string) Coins {
+		amount, _ := new(big.Int).SetString(wei, 10)
+		return Coins{ThetaWei: amount, TFuelWei: big.NewInt(0)}
+	}
+
+	assert.Equal("12.5 Theta", format(theta("12500000000000000000"), DenomTheta, 18))
+	assert.Equal("12.5 Theta", format(theta("12500000000000000000"), "THETA", 1))
+	assert.Equal("13 Theta", format(theta("12500000000000000000"), DenomTheta, 0))
+	assert.Equal("12 Theta", format(theta("12499999999999999999"), DenomTheta, 0))
+	assert.Equal("12.35 Theta", format(theta("12345000000000000000"), DenomTheta, 2))
+	assert.Equal("12.34 Theta", format(theta("12344999999999999999"), DenomTheta, 2))
+	assert.Equal("1 Theta", format(theta("999999999999999999"), DenomTheta, 17))
+	assert.Equal("0.999999999999999999 Theta", format(theta("999999999999999999"), DenomTheta, 18))
+	assert.Equal("0.000000000000000001 Theta", format(theta("1"), DenomTheta, 18))
+	assert.Equal("0.000000000000000001 Theta", format(theta("1"), DenomTheta, 100))
+	assert.Equal("0 Theta", format(theta("1"), DenomTheta, 17))
+	assert.Equal("0 Theta", format(theta("0"), DenomTheta, 18))
+	assert.Equal("0 Theta", format(Coins{}, DenomTheta, 18))
+	assert.Equal("-1.5 Theta", format(theta("-1500000000000000000"), DenomTheta, 1))
+	assert.Equal("-2 Theta", format(theta("-1500000000000000000"), DenomTheta, 0))
+	assert.Equal("0 Theta", format(theta("-1"), DenomTheta, 0))
+	assert.Equal("12500000000000000000 ThetaWei", format(theta("12500000000000000000"), "thetawei", 5))
+	assert.Equal("0 TFuel", format(theta("12500000000000000000"), DenomTFuel, 18))
+	assert.Equal("7 TFuelWei", format(NewCoins(0, 7), "GammaWei", 18))
+	assert.Equal("98765432109.876543210987654321 Theta", format(theta("98765432109876543210987654321"), DenomTheta, 18))
+	assert.Equal("98765432109.88 Theta", format(theta("98765432109876543210987654321"), DenomTheta, 2))
+	assert.Equal("error", format(theta("1"), "BTC", 18))
+	assert.Equal("error", format(theta("1"), DenomTheta, -1))
+
+	// Formatting with the full precision round-trips through the parser
+	for _, wei := range []string{"0", "1", "10", "999999999999999999", "1000000000000000000", "1000000000000000001",
+		"9223372036854775808", "18446744073709551616123", "123456789012345678901234567890123456789"} {
+		for _, denom := range []string{DenomTheta, DenomThetaWei} {
+			s := format(theta(wei), denom, CoinDecimals)
+			coins, err := ParseCoins(s)
+			assert.Nil(err, s)
+			assert.True(coins.IsEqual(theta(wei)), s)
+		}
+	}
+}
+
 func TestJSON(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -198,8 +327,142 @@ func TestJSON(t *testing.T) {
 	s, err := json.Marshal(c)
 	require.Nil(err)
 
+	assert.Equal(`{"thetawei":"12313123123123123131123123313212312312312312123","tfuelwei":"0"}`, string(s))
+
 	var d Coins
 	err = json.Unmarshal(s, &d)
 	assert.Equal(0, num.Cmp(d.ThetaWei))
-	assert.Nil(d.TFuelWei)
+	assert.Equal(0, d.TFuelWei.Sign())
+}
+
+func TestCoinsCheckedArithmetic(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	a := NewCoins(3, 10)
+	b := NewCoins(5, 15)
+
+	sum, err := a.CheckedPlus(b)
+	require.Nil(err)
+	assert.True(NewCoins(8, 25).IsEqual(sum))
+	sum, err = a.CheckedPlus(Coins{})
+	require.Nil(err)
+	assert.True(a.IsEqual(sum))
+	_, err = a.CheckedPlus(NewCoins(0, -1))
+	assert.NotNil(err)
+
+	diff, err := b.CheckedMinus(a)
+	require.Nil(err)
+	assert.True(NewCoins(2, 5).IsEqual(diff))
+	diff, err = a.CheckedMinus(a)
+	require.Nil(err)
+	assert.True(diff.IsZero())
+	_, err = a.CheckedMinus(b)
+	assert.NotNil(err)
+	_, err = a.CheckedMinus(NewCoins(1, 11))
+	assert.NotNil(err)
+	_, err = a.CheckedMinus(NewCoins(-1, 0))
+	assert.NotNil(err)
+	_, err = NewCoins(-1, 0).CheckedMinus(Coins{})
+	assert.NotNil(err)
+}
+
+func TestCoinsMulDivInt(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	a := NewCoins(3, 10)
+	multiplier := big.NewInt(4)
+	product := a.MulInt(multiplier)
+	assert.True(NewCoins(12, 40).IsEqual(product))
+	assert.True(NewCoins(0, 0).IsEqual(Coins{}.MulInt(multiplier)))
+
+	quotient, err := product.DivInt(big.NewInt(3))
+	require.Nil(err)
+	assert.True(NewCoins(4, 13).IsEqual(quotient))
+	_, err = a.DivInt(big.NewInt(0))
+	assert.NotNil(err)
+	_, err = a.DivInt(nil)
+	assert.NotNil(err)
+
+	// The results never alias the operands
+	product.ThetaWei.SetInt64(100)
+	quotient.TFuelWei.SetInt64(100)
+	identity, err := a.DivInt(big.NewInt(1))
+	require.Nil(err)
+	identity.ThetaWei.SetInt64(100)
+	assert.True(NewCoins(3, 10).IsEqual(a))
+	assert.Equal(int64(4), multiplier.Int64())
+}
+
+func TestCoinsCopy(t *testing.T) {
+	assert := assert.New(t)
+
+	a := NewCoins(3, 10)
+	c := a.Copy()
+	c.ThetaWei.SetInt64(100)
+	c.TFuelWei.Add(c.TFuelWei, big.NewInt(1))
+	assert.True(NewCoins(3, 10).IsEqual(a))
+	assert.True(NewCoins(100, 11).IsEqual(c))
+
+	c = Coins{}.Copy()
+	assert.True(c.IsValid())
+	assert.True(c.IsZero())
+
+	// Mutating the balance of a copied account leaves the original intact
+	acc := makeAccount("account", NewCoins(3, 10))
+	accCopy := acc.Copy()
+	accCopy.Balance.ThetaWei.SetInt64(100)
+	assert.True(NewCoins(3, 10).IsEqual(acc.Balance))
+}
+
+func TestCoinsProperties(t *testing.T) {
+	newCoins := func(theta, tfuel int64) Coins {
+		return NewCoins(theta, tfuel)
+	}
+	abs := func(x int64) int64 {
+		if x < 0 {
+			return -(x + 1)
+		}
+		return x
+	}
+
+	commutative := func(a1, a2, b1, b2 int64) bool {
+		a, b := newCoins(a1, a2), newCoins(b1, b2)
+		return a.Plus(b).IsEqual(b.Plus(a))
+	}
+	inverse := func(a1, a2, b1, b2 int64) bool {
+		a, b := newCoins(a1, a2), newCoins(b1, b2)
+		return a.Plus(b).Minus(b).IsEqual(a) && a.Minus(a).IsZero()
+	}
+	checkedNonnegative := func(a1, a2, b1, b2 int64) bool {
+		a, b := newCoins(a1, a2), newCoins(b1, b2)
+		sum, errSum := a.CheckedPlus(b)
+		diff, errDiff := a.CheckedMinus(b)
+		if errSum == nil && !(sum.IsValid() && a.IsNonnegative() && b.IsNonnegative()) {
+			return false
+		}
+		if errDiff == nil && !(diff.IsValid() && a.IsGTE(b)) {
+			return false
+		}
+		// Both succeed for nonnegative operands, except for the subtraction of larger coins
+		a, b = newCoins(abs(a1), abs(a2)), newCoins(abs(b1), abs(b2))
+		_, errSum = a.CheckedPlus(b)
+		_, errDiff = a.CheckedMinus(b)
+		return errSum == nil && (errDiff == nil) == a.IsGTE(b)
+	}
+	mulDiv := func(a1, a2 int64, m int32) bool {
+		a := newCoins(a1, a2)
+		if m == 0 {
+			return a.MulInt(big.NewInt(0)).IsZero()
+		}
+		quotient, err := a.MulInt(big.NewInt(int64(m))).DivInt(big.NewInt(int64(m)))
+		return err == nil && quotient.IsEqual(a)
+	}
+
+	for _, property := range []interface{}{commutative, inverse, checkedNonnegative, mulDiv} {
+		if err := quick.Check(property, nil); err != nil {
+			t.Error(err)
+		}
+	}
 }
@@ -7,12 +7,51 @@ const (
 	// DenomTFuelWei is the basic unit of theta, 1 Theta = 10^18 ThetaWei
 	DenomTFuelWei string = "TFuelWei"
 
+	// DenomTheta is the display unit of theta, 1 Theta = 10^18 ThetaWei
+	DenomTheta string = "Theta"
+
+	// DenomTFuel is the display unit of tfuel, 1 TFuel = 10^18 TFuelWei
+	DenomTFuel string = "TFuel"
+
+	// CoinDecimals is the number of decimal places of Theta and TFuel in their wei units
+	CoinDecimals int = 18
+
 	// MinimumGasPrice is the minimum gas price for a smart contract transaction
 	MinimumGasPrice uint64 = 1e8
 
 	// MinimumTransactionFeeTFuelWei specifies the minimum fee for a regular transaction
 	MinimumTransactionFeeTFuelWei uint64 = 1e12
 
+	// SendTxDataFeePerByteTFuelWei specifies the additional fee per byte of the memo of a send transaction
+	SendTxDataFeePerByteTFuelWei uint64 = 1e10
+
+	// DefaultDustThresholdThetaWei is the minimum non-zero ThetaWei amount of a send transaction output, unless
+	// overridden by the chain parameter in the state. The smaller outputs would bloat the account trie with dust.
+	DefaultDustThresholdThetaWei uint64 = 1e9
+
+	// DefaultDustThresholdTFuelWei is the minimum non-zero TFuelWei amount of a send transaction output, unless
+	// overridden by the chain parameter in the state
+	DefaultDustThresholdTFuelWei uint64 = 1e9
+
+	// DefaultMinNewAccountThetaWei is the minimum ThetaWei amount of a send transaction output that creates a
+	// new account, unless overridden by the chain parameter in the state. The output needs to meet either this
+	// or the TFuelWei minimum, so that the state growth has a cost.
+	DefaultMinNewAccountThetaWei uint64 = 1e15
+
+	// DefaultMinNewAccountTFuelWei is the minimum TFuelWei amount of a send transaction output that creates a
+	// new account, unless overridden by the chain parameter in the state
+	DefaultMinNewAccountTFuelWei uint64 = 1e15
+
+	// MaxSendTxDataSize specifies the max size (in bytes) of the memo of a send transaction
+	MaxSendTxDataSize = 256
+
+	// MaxMultisigOwners specifies the max number of owners of a multi-signature account
+	MaxMultisigOwners = 16
+
+	// MaxSendTxInputs specifies the max number of inputs of a send transaction, which bounds the number of
+	// signatures to verify
+	MaxSendTxInputs = 32
+
 	// MaxAccountsAffectedPerTx specifies the max number of accounts one transaction is allowed to modify to avoid spamming
 	MaxAccountsAffectedPerTx = 512
 )
@@ -68,3 +107,32 @@ const (
 	// ReservedFundFreezePeriodDuration indicates the freeze duration (in terms of number of blocks) of the reserved fund
 	ReservedFundFreezePeriodDuration uint64 = 5
 )
+
+const (
+
+	// DoubleSignEvidenceWindow indicates the number of blocks (after the height of the conflicting blocks) the
+	// evidence of a double signing is accepted for. It is shorter than core.ReturnLockingPeriod, so the stake
+	// withdrawn right after the offense is still locked, and can be slashed, until the evidence expires.
+	DoubleSignEvidenceWindow uint64 = 14400
+
+	// DefaultDoubleSignSlashPercentage is the percentage of the stake backing a double signing validator that
+	// is burned, unless overridden by the chain parameter in the state
+	DefaultDoubleSignSlashPercentage uint64 = 10
+)
+
+const (
+	// MaxStakeCommission is the maximum commission, in percent, a stake holder takes from the reward of the
+	// stakes it holds, see StakeCommissionTx
+	MaxStakeCommission uint8 = 100
+)
+
+const (
+	// MaxValidatorNameLength is the maximum length in bytes of the name of a validator, see ValidatorMetadata
+	MaxValidatorNameLength = 64
+
+	// MaxValidatorWebsiteLength is the maximum length in bytes of the website of a validator
+	MaxValidatorWebsiteLength = 128
+
+	// MaxValidatorSecurityContactLength is the maximum length in bytes of the security contact of a validator
+	MaxValidatorSecurityContactLength = 128
+)
@@ -0,0 +1,24 @@
+package types
+
+import (
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/crypto"
+)
+
+// CreateContractAddress returns the address of the contract deployed by a smart contract transaction, or by the
+// CREATE opcode of a contract, given the deployer address and its sequence at the time of the deployment.
+func CreateContractAddress(deployer common.Address, sequence uint64) common.Address {
+	return crypto.CreateAddress(deployer, sequence)
+}
+
+// CreateContractAddress2 returns the address of the contract deployed by the CREATE2 opcode of the deployer
+// contract with the given salt and init code, i.e. keccak256(0xff ++ deployer ++ salt ++ keccak256(initCode))[12:].
+// It does not depend on the state, so the address can be computed before the deployment.
+func CreateContractAddress2(deployer common.Address, salt common.Hash, initCode []byte) common.Address {
+	return CreateContractAddress2WithHash(deployer, salt, crypto.Keccak256Hash(initCode))
+}
+
+// CreateContractAddress2WithHash is the same as CreateContractAddress2, given the hash of the init code
+func CreateContractAddress2WithHash(deployer common.Address, salt common.Hash, initCodeHash common.Hash) common.Address {
+	return crypto.CreateAddress2(deployer, salt, initCodeHash.Bytes())
+}
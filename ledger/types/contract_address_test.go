@@ -0,0 +1,32 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/crypto"
+)
+
+func TestCreateContractAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	deployer := common.HexToAddress("0x970e8128ab834e8eac17ab8e3812f010678cf791")
+	assert.Equal(common.HexToAddress("0x333c3310824b7c685133f2bedb2ca4b8b4df633d"), CreateContractAddress(deployer, 0))
+	assert.Equal(common.HexToAddress("0x8bda78331c916a08481428e4b07c96d3e916d165"), CreateContractAddress(deployer, 1))
+}
+
+func TestCreateContractAddress2(t *testing.T) {
+	assert := assert.New(t)
+
+	// The examples of EIP-1014
+	deployer := common.HexToAddress("0x00000000000000000000000000000000deadbeef")
+	salt := common.HexToHash("0x00000000000000000000000000000000000000000000000000000000cafebabe")
+	initCode := common.FromHex("0xdeadbeef")
+	expected := common.HexToAddress("0x60f3f640a8508fC6a86d45DF051962668E1e8AC7")
+	assert.Equal(expected, CreateContractAddress2(deployer, salt, initCode))
+	assert.Equal(expected, CreateContractAddress2WithHash(deployer, salt, crypto.Keccak256Hash(initCode)))
+
+	assert.Equal(common.HexToAddress("0x4D1A2e2bB4F88F0250f26Ffff098B0b30B26BF38"),
+		CreateContractAddress2(common.Address{}, common.Hash{}, common.FromHex("0x00")))
+}
@@ -0,0 +1,89 @@
+package types
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+)
+
+// CustomTxTypeBase is the first of the tx types reserved for the txs registered by the embedders of the ledger.
+// The types below it are reserved for the core txs, including the ones added by the future forks, so that the
+// registered txs never override a core tx.
+const CustomTxTypeBase TxType = 0x8000
+
+// GasCustomTx is the gas of a registered tx, in the block gas budget and for its effective gas price
+const GasCustomTx uint64 = 10000
+
+// CustomTx is implemented by the tx types registered by the embedders of the ledger. Its encoding is the RLP
+// encoding of the Go value, which must be canonical, see TxFromCanonicalBytes. It is signed by a single input, the
+// sequence of which orders the txs of the account in the mempool, and which pays the fee.
+type CustomTx interface {
+	Tx
+
+	// GetInput returns the input signing the tx. Its coins are not spent by the core execution.
+	GetInput() *TxInput
+
+	// GetFee returns the fee of the tx, charged to the input
+	GetFee() *Coins
+}
+
+// customTxTypes contains the constructors of the registered tx types, indexed by tx type
+var customTxTypes = map[TxType]func() CustomTx{}
+
+// customTxTypesByGoType contains the registered tx types, indexed by the Go type of their txs
+var customTxTypesByGoType = map[reflect.Type]TxType{}
+
+// RegisterTxType registers a custom tx type, the txs of which are created by newTx when decoded. The type must
+// be at least CustomTxTypeBase. It is not thread safe, and should only be called on initialization, e.g. from
+// an init() function. It panics if the tx type, or the Go type of its txs, is already registered.
+func RegisterTxType(txType TxType, newTx func() CustomTx) {
+	if txType < CustomTxTypeBase {
+		panic(fmt.Sprintf("Tx type %v is reserved for the core txs", txType))
+	}
+	if _, ok := customTxTypes[txType]; ok {
+		panic(fmt.Sprintf("Tx type %v is already registered", txType))
+	}
+	goType := reflect.TypeOf(newTx())
+	if _, ok := customTxTypesByGoType[goType]; ok {
+		panic(fmt.Sprintf("%v is already registered", goType))
+	}
+	customTxTypes[txType] = newTx
+	customTxTypesByGoType[goType] = txType
+}
+
+// IsRegisteredTxType returns whether the given custom tx type is registered
+func IsRegisteredTxType(txType TxType) bool {
+	_, ok := customTxTypes[txType]
+	return ok
+}
+
+// GetTxType returns the type of the given tx
+func GetTxType(tx Tx) (TxType, error) {
+	return getTxType(tx)
+}
+
+// CustomTxHash returns the canonical hash of the given custom tx, see Tx.Hash()
+func CustomTxHash(tx CustomTx) common.Hash {
+	return txHash(tx)
+}
+
+// CustomTxSignBytes returns the bytes the input of the given custom tx signs, see Tx.SignBytes()
+func CustomTxSignBytes(chainID string, tx CustomTx) []byte {
+	input := tx.GetInput()
+	sig, sigs := input.Signature, input.Signatures
+	input.Signature, input.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
+	input.Signature, input.Signatures = sig, sigs
+	return signBytes
+}
+
+// ValidateCustomTx checks the invariants the core execution relies on, i.e. the input and the fee of the
+// given custom tx. The registered tx types check the rest in their Validate().
+func ValidateCustomTx(tx CustomTx) result.Result {
+	if res := validateFee(*tx.GetFee()); res.IsError() {
+		return res
+	}
+	return validateSignerInput(*tx.GetInput())
+}
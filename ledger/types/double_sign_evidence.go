@@ -0,0 +1,71 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+)
+
+// DoubleSignEvidence proves that a validator signed two conflicting blocks, i.e. two different block headers at
+// the same height and epoch. The signature of a header covers its chain ID, height and epoch, so the evidence
+// is verified without access to the chain.
+type DoubleSignEvidence struct {
+	HeaderA *core.BlockHeader
+	HeaderB *core.BlockHeader
+}
+
+// DoubleSignEvidenceFromBytes decodes the RLP encoded evidence
+func DoubleSignEvidenceFromBytes(raw common.Bytes) (*DoubleSignEvidence, error) {
+	evidence := &DoubleSignEvidence{}
+	if err := FromBytes(raw, evidence); err != nil {
+		return nil, err
+	}
+	return evidence, nil
+}
+
+// Offender returns the validator that signed the conflicting blocks
+func (e *DoubleSignEvidence) Offender() common.Address {
+	return e.HeaderA.Proposer
+}
+
+// Height returns the height of the conflicting blocks
+func (e *DoubleSignEvidence) Height() uint64 {
+	return e.HeaderA.Height
+}
+
+// Verify checks that both headers are signed by the same validator for the given chain, at the same height and
+// epoch, and that they differ
+func (e *DoubleSignEvidence) Verify(chainID string) result.Result {
+	if e.HeaderA == nil || e.HeaderB == nil {
+		return result.Error("Two block headers are required").WithErrorCode(result.CodeInvalidDoubleSignEvidence)
+	}
+	for _, header := range []*core.BlockHeader{e.HeaderA, e.HeaderB} {
+		if res := header.Validate(chainID); res.IsError() {
+			return result.Error("Invalid block header %v: %v", header.Hash().Hex(), res.Message).
+				WithErrorCode(result.CodeInvalidDoubleSignEvidence)
+		}
+	}
+	if e.HeaderA.Proposer != e.HeaderB.Proposer {
+		return result.Error("The blocks are signed by different validators: %v, %v", e.HeaderA.Proposer, e.HeaderB.Proposer).
+			WithErrorCode(result.CodeInvalidDoubleSignEvidence)
+	}
+	if e.HeaderA.Height != e.HeaderB.Height || e.HeaderA.Epoch != e.HeaderB.Epoch {
+		return result.Error("The blocks are not at the same height and epoch").
+			WithErrorCode(result.CodeInvalidDoubleSignEvidence)
+	}
+	// Not the hashes, which differ for two signatures of the same header
+	if crypto.Keccak256Hash(e.HeaderA.SignBytes()) == crypto.Keccak256Hash(e.HeaderB.SignBytes()) {
+		return result.Error("The blocks do not conflict").WithErrorCode(result.CodeInvalidDoubleSignEvidence)
+	}
+	return result.OK
+}
+
+func (e *DoubleSignEvidence) String() string {
+	if e == nil {
+		return "nil-DoubleSignEvidence"
+	}
+	return fmt.Sprintf("DoubleSignEvidence{%v %v}", e.HeaderA, e.HeaderB)
+}
@@ -0,0 +1,53 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+)
+
+func TestDoubleSignEvidence(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	validator, other := PrivAccountFromSecret("validator"), PrivAccountFromSecret("other")
+	raw := MakeDoubleSignEvidence(chainID, validator, 100, 120)
+	evidence, err := DoubleSignEvidenceFromBytes(raw)
+	require.Nil(err)
+	assert.Equal(validator.Address, evidence.Offender())
+	assert.Equal(uint64(100), evidence.Height())
+	assert.True(evidence.Verify(chainID).IsOK())
+
+	// The evidence is bound to the chain
+	assert.Equal(result.CodeInvalidDoubleSignEvidence, evidence.Verify("other_chain").Code)
+
+	_, err = DoubleSignEvidenceFromBytes(common.Bytes("evidence"))
+	assert.NotNil(err)
+
+	header := func(proposer PrivAccount, height, epoch uint64, parent string) *core.BlockHeader {
+		return MakeConflictingBlockHeader(chainID, proposer, height, epoch, parent)
+	}
+	forged := header(validator, 100, 120, "parentB")
+	forged.Proposer = other.Address
+	resigned := header(validator, 100, 120, "parentA")
+	resigned.SetSignature(validator.Sign(resigned.SignBytes())) // a different signature of the same header
+
+	testCases := []struct {
+		name     string
+		evidence *DoubleSignEvidence
+	}{
+		{"missing header", &DoubleSignEvidence{HeaderA: header(validator, 100, 120, "parentA")}},
+		{"forged signature", &DoubleSignEvidence{HeaderA: header(validator, 100, 120, "parentA"), HeaderB: forged}},
+		{"different proposers", &DoubleSignEvidence{HeaderA: header(validator, 100, 120, "parentA"), HeaderB: header(other, 100, 120, "parentB")}},
+		{"different heights", &DoubleSignEvidence{HeaderA: header(validator, 100, 120, "parentA"), HeaderB: header(validator, 101, 120, "parentB")}},
+		{"different epochs", &DoubleSignEvidence{HeaderA: header(validator, 100, 120, "parentA"), HeaderB: header(validator, 100, 121, "parentB")}},
+		{"same block", &DoubleSignEvidence{HeaderA: header(validator, 100, 120, "parentA"), HeaderB: resigned}},
+	}
+	for _, tc := range testCases {
+		assert.Equal(result.CodeInvalidDoubleSignEvidence, tc.evidence.Verify(chainID).Code, tc.name)
+	}
+}
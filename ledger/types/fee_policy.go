@@ -0,0 +1,43 @@
+package types
+
+import (
+	"math/big"
+)
+
+// DefaultFeeBurnPercentage is the percentage of the tx fees burned unless the fee policy is set in the state,
+// i.e. all the fees are burned
+const DefaultFeeBurnPercentage uint64 = 100
+
+// FeePolicy is the chain parameter for the disposition of the fees charged to the transactions. The burned
+// share of a fee is taken out of the total supply, and the rest is distributed to the block proposer with
+// the coinbase transaction.
+type FeePolicy struct {
+	BurnPercentage uint64 // at most 100
+}
+
+// DefaultFeePolicy returns the fee policy in effect unless set in the state, which burns all the fees
+func DefaultFeePolicy() *FeePolicy {
+	return &FeePolicy{
+		BurnPercentage: DefaultFeeBurnPercentage,
+	}
+}
+
+// Split splits the fee into the burned and the distributed shares. The distributed share is rounded down,
+// so that the shares add up to the fee exactly.
+func (fp *FeePolicy) Split(fee Coins) (burned Coins, distributed Coins) {
+	fee = fee.NoNil()
+	distributedPercentage := big.NewInt(0)
+	if fp.BurnPercentage < 100 {
+		distributedPercentage.SetUint64(100 - fp.BurnPercentage)
+	}
+	share := func(amount *big.Int) *big.Int {
+		s := new(big.Int).Mul(amount, distributedPercentage)
+		return s.Div(s, big.NewInt(100))
+	}
+	distributed = Coins{
+		ThetaWei: share(fee.ThetaWei),
+		TFuelWei: share(fee.TFuelWei),
+	}
+	burned = fee.Minus(distributed)
+	return burned, distributed
+}
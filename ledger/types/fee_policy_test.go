@@ -0,0 +1,46 @@
+package types
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeePolicySplit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// All the fees are burned by default
+	fee := NewCoins(3, 1001)
+	burned, distributed := DefaultFeePolicy().Split(fee)
+	assert.True(burned.IsEqual(fee))
+	assert.True(distributed.IsZero())
+
+	// The distributed share is rounded down
+	fp := &FeePolicy{BurnPercentage: 30}
+	burned, distributed = fp.Split(fee)
+	assert.True(distributed.IsEqual(NewCoins(2, 700)))
+	assert.True(burned.IsEqual(NewCoins(1, 301)))
+	assert.True(burned.Plus(distributed).IsEqual(fee))
+
+	// Nothing is burned
+	fp = &FeePolicy{BurnPercentage: 0}
+	burned, distributed = fp.Split(fee)
+	assert.True(burned.IsZero())
+	assert.True(distributed.IsEqual(fee))
+
+	// The nil amounts are zero
+	burned, distributed = fp.Split(Coins{TFuelWei: big.NewInt(10)})
+	assert.True(burned.IsZero())
+	assert.Equal(big.NewInt(10), distributed.TFuelWei)
+
+	// Encoding
+	fp = &FeePolicy{BurnPercentage: 40}
+	raw, err := ToBytes(fp)
+	require.Nil(err)
+	decoded := &FeePolicy{}
+	require.Nil(FromBytes(raw, decoded))
+	assert.Equal(fp, decoded)
+}
@@ -0,0 +1,243 @@
+package types
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"math/big"
+
+	"github.com/thetatoken/theta/crypto"
+)
+
+// FeeSchedule is the chain parameter for the minimum fee of the regular transactions other than the smart
+// contract transactions, which pay for their gas instead. The minimum fee of a transaction is the base fee
+// of its type plus the fee per byte of its raw encoding, plus the fee per byte of the memo of a SendTx.
+type FeeSchedule struct {
+	BaseFeesTFuelWei   []*big.Int // indexed by TxType, the types without an entry pay MinimumTransactionFeeTFuelWei
+	PerByteFeeTFuelWei *big.Int
+}
+
+// DefaultFeeSchedule returns the fee schedule in effect unless set in the state, i.e. a flat
+// MinimumTransactionFeeTFuelWei for all the transaction types, regardless of their size
+func DefaultFeeSchedule() *FeeSchedule {
+	baseFees := []*big.Int{}
+	for txType := TxCoinbase; txType <= TxUpdateValidatorKey; txType++ {
+		baseFees = append(baseFees, new(big.Int).SetUint64(MinimumTransactionFeeTFuelWei))
+	}
+	return &FeeSchedule{
+		BaseFeesTFuelWei:   baseFees,
+		PerByteFeeTFuelWei: big.NewInt(0),
+	}
+}
+
+// BaseFee returns the base fee of the given transaction type
+func (fs *FeeSchedule) BaseFee(txType TxType) *big.Int {
+	if int(txType) < len(fs.BaseFeesTFuelWei) && fs.BaseFeesTFuelWei[txType] != nil {
+		return new(big.Int).Set(fs.BaseFeesTFuelWei[txType])
+	}
+	return new(big.Int).SetUint64(MinimumTransactionFeeTFuelWei)
+}
+
+// PerByteFee returns the fee per byte of the raw encoding of a transaction
+func (fs *FeeSchedule) PerByteFee() *big.Int {
+	if fs.PerByteFeeTFuelWei == nil {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Set(fs.PerByteFeeTFuelWei)
+}
+
+// TxBaseFee returns the base fee of the type of the given transaction
+func (fs *FeeSchedule) TxBaseFee(tx Tx) *big.Int {
+	txType, err := getTxType(tx)
+	if err != nil {
+		return new(big.Int).SetUint64(MinimumTransactionFeeTFuelWei)
+	}
+	return fs.BaseFee(txType)
+}
+
+// MinimumFee returns the minimum fee of the given transaction, whose raw encoding is txSize bytes long
+func (fs *FeeSchedule) MinimumFee(tx Tx, txSize int) *big.Int {
+	fee := fs.PerByteFee()
+	fee.Mul(fee, big.NewInt(int64(txSize)))
+	fee.Add(fee, fs.TxBaseFee(tx))
+	if sendTx, ok := tx.(*SendTx); ok {
+		dataFee := new(big.Int).SetUint64(SendTxDataFeePerByteTFuelWei)
+		fee.Add(fee, dataFee.Mul(dataFee, big.NewInt(int64(len(sendTx.Data)))))
+	}
+	return fee
+}
+
+// TxMinimumFee returns the minimum fee of the given signed transaction
+func (fs *FeeSchedule) TxMinimumFee(tx Tx) (*big.Int, error) {
+	if fs.PerByteFee().Sign() == 0 {
+		return fs.MinimumFee(tx, 0), nil
+	}
+	raw, err := TxToBytes(tx)
+	if err != nil {
+		return nil, err
+	}
+	return fs.MinimumFee(tx, len(raw)), nil
+}
+
+// placeholderSignature stands in for the signatures missing from a transaction being estimated. It has the
+// length of the longest signature, i.e. an Ed25519 one, so the estimate suffices for any signer.
+var placeholderSignature, _ = crypto.SignatureFromBytes(
+	append([]byte{byte(crypto.SchemeEd25519)}, make([]byte, ed25519.PublicKeySize+ed25519.SignatureSize)...))
+
+// EstimateMinimumFee returns the minimum fee of the given transaction, which does not need to be signed yet.
+// The inputs without a signature are assumed to be signed by a single key, thus the inputs of a multisig
+// account need placeholders for the signatures of its owners. Setting the returned fee as the fee of the
+// transaction before signing it meets the fee schedule and the intrinsic gas schedule, where the first input of a SendTx is expected to
+// pay for the fee on top of what it already covers, or its fee payer to pay exactly the fee if it has one.
+// The transaction itself is not modified.
+func EstimateMinimumFee(fs *FeeSchedule, gs *IntrinsicGasSchedule, tx Tx) (*big.Int, error) {
+	if txFee(tx) == nil {
+		return nil, errors.New("the transaction does not pay a fee")
+	}
+	if fs.PerByteFee().Sign() == 0 {
+		return gs.MinimumFee(fs, tx, 0), nil
+	}
+
+	raw, err := TxToBytes(tx)
+	if err != nil {
+		return nil, err
+	}
+	estimated, err := TxFromBytes(raw)
+	if err != nil {
+		return nil, err
+	}
+	for _, input := range txInputs(estimated) {
+		if (input.Signature == nil || input.Signature.IsEmpty()) && len(input.Signatures) == 0 {
+			input.Signature = placeholderSignature
+		}
+	}
+
+	// The fee is part of the encoding, so a larger fee can take up more bytes. It converges since the fee
+	// only grows, and its encoding only grows with it.
+	fee := txFee(estimated)
+	for {
+		minimumFee, err := gs.TxMinimumFee(fs, estimated)
+		if err != nil {
+			return nil, err
+		}
+		currentFee := fee.NoNil().TFuelWei
+		if currentFee.Cmp(minimumFee) >= 0 {
+			return minimumFee, nil
+		}
+		if sendTx, ok := estimated.(*SendTx); ok && sendTx.FeePayer != nil {
+			sendTx.FeePayer.Coins = Coins{ThetaWei: big.NewInt(0), TFuelWei: minimumFee}
+		} else if ok && len(sendTx.Inputs) > 0 {
+			delta := new(big.Int).Sub(minimumFee, currentFee)
+			sendTx.Inputs[0].Coins = sendTx.Inputs[0].Coins.Plus(Coins{ThetaWei: big.NewInt(0), TFuelWei: delta})
+		}
+		fee.TFuelWei = minimumFee
+	}
+}
+
+// txFee returns the fee of the transaction, or nil for the transactions that do not have one
+func txFee(tx Tx) *Coins {
+	switch tx := tx.(type) {
+	case *SendTx:
+		return &tx.Fee
+	case *ReserveFundTx:
+		return &tx.Fee
+	case *ReleaseFundTx:
+		return &tx.Fee
+	case *ServicePaymentTx:
+		return &tx.Fee
+	case *SplitRuleTx:
+		return &tx.Fee
+	case *DepositStakeTx:
+		return &tx.Fee
+	case *WithdrawStakeTx:
+		return &tx.Fee
+	case *UpdateMultisigTx:
+		return &tx.Fee
+	case *PartialReleaseFundTx:
+		return &tx.Fee
+	case *ExtendSplitRuleTx:
+		return &tx.Fee
+	case *SweepAccountTx:
+		return &tx.Fee
+	case *BurnTx:
+		return &tx.Fee
+	case *DoubleSignSlashTx:
+		return &tx.Fee
+	case *StakeCommissionTx:
+		return &tx.Fee
+	case *CancelWithdrawTx:
+		return &tx.Fee
+	case *UpdateValidatorMetadataTx:
+		return &tx.Fee
+	case *UnjailTx:
+		return &tx.Fee
+	case *EjectStakeTx:
+		return &tx.Fee
+	case *UpdateValidatorKeyTx:
+		return &tx.Fee
+	case CustomTx:
+		return tx.GetFee()
+	default:
+		return nil
+	}
+}
+
+// txInputs returns the signed inputs of the transaction
+func txInputs(tx Tx) []*TxInput {
+	switch tx := tx.(type) {
+	case *CoinbaseTx:
+		return []*TxInput{&tx.Proposer}
+	case *SlashTx:
+		return []*TxInput{&tx.Proposer}
+	case *SendTx:
+		inputs := []*TxInput{}
+		for i := range tx.Inputs {
+			inputs = append(inputs, &tx.Inputs[i])
+		}
+		if tx.FeePayer != nil {
+			inputs = append(inputs, tx.FeePayer)
+		}
+		return inputs
+	case *ReserveFundTx:
+		return []*TxInput{&tx.Source}
+	case *ReleaseFundTx:
+		return []*TxInput{&tx.Source}
+	case *ServicePaymentTx:
+		return []*TxInput{&tx.Source, &tx.Target}
+	case *SplitRuleTx:
+		return []*TxInput{&tx.Initiator}
+	case *SmartContractTx:
+		return []*TxInput{&tx.From}
+	case *DepositStakeTx:
+		return []*TxInput{&tx.Source}
+	case *WithdrawStakeTx:
+		return []*TxInput{&tx.Source}
+	case *UpdateMultisigTx:
+		return []*TxInput{&tx.Account}
+	case *PartialReleaseFundTx:
+		return []*TxInput{&tx.Source, &tx.Target}
+	case *ExtendSplitRuleTx:
+		return []*TxInput{&tx.Initiator}
+	case *SweepAccountTx:
+		return []*TxInput{&tx.Source}
+	case *BurnTx:
+		return []*TxInput{&tx.Source}
+	case *DoubleSignSlashTx:
+		return []*TxInput{&tx.Reporter}
+	case *StakeCommissionTx:
+		return []*TxInput{&tx.Holder}
+	case *CancelWithdrawTx:
+		return []*TxInput{&tx.Source}
+	case *UpdateValidatorMetadataTx:
+		return []*TxInput{&tx.Holder}
+	case *UnjailTx:
+		return []*TxInput{&tx.Holder}
+	case *EjectStakeTx:
+		return []*TxInput{&tx.Holder}
+	case *UpdateValidatorKeyTx:
+		return []*TxInput{&tx.Holder, &tx.NewHolder}
+	case CustomTx:
+		return []*TxInput{tx.GetInput()}
+	default:
+		return nil
+	}
+}
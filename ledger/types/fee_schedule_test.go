@@ -0,0 +1,140 @@
+package types
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/crypto"
+)
+
+func TestDefaultFeeSchedule(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// The flat minimum fee, regardless of the size
+	fs := DefaultFeeSchedule()
+	minimumFee := new(big.Int).SetUint64(MinimumTransactionFeeTFuelWei)
+	tx := &ReleaseFundTx{Source: TxInput{Address: getTestAddress("source"), Sequence: 1}, ReserveSequence: 1}
+	assert.Equal(minimumFee, fs.MinimumFee(tx, 100000))
+	fee, err := fs.TxMinimumFee(tx)
+	require.Nil(err)
+	assert.Equal(minimumFee, fee)
+
+	// Plus the fee for the memo of a SendTx
+	sendTx := &SendTx{Data: common.Bytes("memo")}
+	expected := new(big.Int).SetUint64(MinimumTransactionFeeTFuelWei + 4*SendTxDataFeePerByteTFuelWei)
+	assert.Equal(expected, fs.MinimumFee(sendTx, 100000))
+
+	// The types added later pay the minimum fee until they are given a base fee
+	fs.BaseFeesTFuelWei = fs.BaseFeesTFuelWei[:TxSend]
+	assert.Equal(minimumFee, fs.BaseFee(TxReleaseFund))
+
+	// Encoding
+	fs = DefaultFeeSchedule()
+	fs.BaseFeesTFuelWei[TxSend] = big.NewInt(123)
+	fs.PerByteFeeTFuelWei = big.NewInt(456)
+	raw, err := ToBytes(fs)
+	require.Nil(err)
+	decoded := &FeeSchedule{}
+	require.Nil(FromBytes(raw, decoded))
+	assert.Equal(big.NewInt(123), decoded.BaseFee(TxSend))
+	assert.Equal(big.NewInt(456), decoded.PerByteFee())
+	assert.Equal(minimumFee, decoded.BaseFee(TxSweepAccount))
+}
+
+func TestEstimateMinimumFee(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID := "test_chain_id"
+	fs := DefaultFeeSchedule()
+	fs.PerByteFeeTFuelWei = big.NewInt(1e9)
+	perByteFee := fs.PerByteFee().Int64()
+	gs := DefaultIntrinsicGasSchedule()
+
+	// The unsigned transaction with no fee yet, as built by a wallet
+	newSendTx := func(from PrivAccount) *SendTx {
+		output := TxOutput{Address: getTestAddress("output"), Coins: NewCoins(10, 2000)}
+		return &SendTx{
+			Fee:     NewCoins(0, 0),
+			Inputs:  []TxInput{{Address: from.Address, Coins: output.Coins, Sequence: 1}},
+			Outputs: []TxOutput{output},
+			Data:    common.Bytes("memo"),
+		}
+	}
+	setFeeAndSign := func(tx *SendTx, from PrivAccount, fee *big.Int) {
+		tx.Fee = Coins{ThetaWei: big.NewInt(0), TFuelWei: fee}
+		tx.Inputs[0].Coins = tx.Outputs[0].Coins.Plus(tx.Fee)
+		tx.Inputs[0].Signature = from.Sign(tx.SignBytes(chainID))
+	}
+
+	// The estimate meets the fee schedule once the fee is set and the transaction signed. It suffices for the
+	// Ed25519 signatures, the longest ones, exactly.
+	for _, from := range []PrivAccount{PrivAccountFromEd25519Secret("alice"), PrivAccountFromSecret("bob")} {
+		tx := newSendTx(from)
+		unsignedBytes, err := TxToBytes(tx)
+		require.Nil(err)
+		fee, err := EstimateMinimumFee(fs, gs, tx)
+		require.Nil(err)
+		assert.True(fee.Cmp(fs.MinimumFee(tx, len(unsignedBytes))) > 0)
+
+		// The transaction itself is not modified
+		txBytes, err := TxToBytes(tx)
+		require.Nil(err)
+		assert.Equal(unsignedBytes, txBytes)
+
+		setFeeAndSign(tx, from, fee)
+		minimumFee, err := fs.TxMinimumFee(tx)
+		require.Nil(err)
+		assert.True(fee.Cmp(minimumFee) >= 0)
+		if from.PrivKey.Scheme() == crypto.SchemeEd25519 {
+			assert.Equal(minimumFee, fee)
+		} else {
+			overestimate := new(big.Int).Sub(fee, minimumFee)
+			assert.True(overestimate.Cmp(big.NewInt(32*perByteFee)) <= 0, "%v", overestimate)
+		}
+	}
+
+	// Without a per byte fee, the size does not matter
+	tx := newSendTx(PrivAccountFromSecret("carol"))
+	fee, err := EstimateMinimumFee(DefaultFeeSchedule(), gs, tx)
+	require.Nil(err)
+	assert.Equal(new(big.Int).SetUint64(MinimumTransactionFeeTFuelWei+4*SendTxDataFeePerByteTFuelWei), fee)
+
+	// A fee payer pays the whole fee and signs as well, the inputs only cover the outputs
+	sender, sponsor := PrivAccountFromEd25519Secret("dave"), PrivAccountFromEd25519Secret("erin")
+	tx = newSendTx(sender)
+	tx.FeePayer = &TxInput{Address: sponsor.Address, Coins: NewCoins(0, 0), Sequence: 1}
+	fee, err = EstimateMinimumFee(fs, gs, tx)
+	require.Nil(err)
+	tx.Fee = Coins{ThetaWei: big.NewInt(0), TFuelWei: fee}
+	tx.FeePayer.Coins = tx.Fee
+	tx.Inputs[0].Signature = sender.Sign(tx.SignBytes(chainID))
+	tx.FeePayer.Signature = sponsor.Sign(tx.SignBytes(chainID))
+	minimumFee, err := fs.TxMinimumFee(tx)
+	require.Nil(err)
+	assert.Equal(minimumFee, fee)
+
+	// With a minimum gas price, the intrinsic gas is charged for instead of the base fee
+	gs.MinGasPriceTFuelWei = new(big.Int).SetUint64(2 * MinimumGasPrice)
+	fee, err = EstimateMinimumFee(fs, gs, tx)
+	require.Nil(err)
+	tx.Fee = Coins{ThetaWei: big.NewInt(0), TFuelWei: fee}
+	tx.FeePayer.Coins = tx.Fee
+	minimumFee, err = gs.TxMinimumFee(fs, tx)
+	require.Nil(err)
+	assert.Equal(minimumFee, fee)
+	txBytes, err := TxToBytes(tx)
+	require.Nil(err)
+	gasFee := int64(gs.TxGas(tx) * 2 * MinimumGasPrice)
+	assert.Equal(big.NewInt(gasFee+int64(len(txBytes))*perByteFee), fee)
+
+	// The transactions paying no fee can not be estimated
+	_, err = EstimateMinimumFee(fs, gs, &CoinbaseTx{})
+	assert.NotNil(err)
+	_, err = EstimateMinimumFee(fs, gs, &SmartContractTx{})
+	assert.NotNil(err)
+}
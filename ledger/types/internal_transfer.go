@@ -0,0 +1,67 @@
+package types
+
+import (
+	"encoding/json"
+
+	"github.com/thetatoken/theta/common"
+)
+
+// MaxInternalTransfersPerTx is the maximum number of internal transfers recorded for a smart contract
+// transaction. The transfers beyond it are dropped, and the receipt is flagged as truncated.
+const MaxInternalTransfersPerTx = 256
+
+// InternalTransfer is a value transfer made by a contract during the execution of a smart contract transaction,
+// i.e. by an internal call, a contract creation or a self-destruct. The top-level transfer of the transaction
+// itself is not an internal transfer.
+type InternalTransfer struct {
+	Type    string // CALL, CREATE, CREATE2 or SELFDESTRUCT
+	From    common.Address
+	To      common.Address
+	Amount  Coins  // Only TFuel can be transferred by the contracts
+	Depth   uint64 // Depth of the contract making the transfer, 1 for the contract called by the transaction
+	Success bool   // False if the transfer was reverted with its call frame, or with any of the enclosing frames
+}
+
+type InternalTransferJSON struct {
+	Type    string            `json:"type"`
+	From    common.Address    `json:"from"`
+	To      common.Address    `json:"to"`
+	Amount  Coins             `json:"amount"`
+	Depth   common.JSONUint64 `json:"depth"`
+	Success bool              `json:"success"`
+}
+
+func NewInternalTransferJSON(a InternalTransfer) InternalTransferJSON {
+	return InternalTransferJSON{
+		Type:    a.Type,
+		From:    a.From,
+		To:      a.To,
+		Amount:  a.Amount,
+		Depth:   common.JSONUint64(a.Depth),
+		Success: a.Success,
+	}
+}
+
+func (a InternalTransferJSON) InternalTransfer() InternalTransfer {
+	return InternalTransfer{
+		Type:    a.Type,
+		From:    a.From,
+		To:      a.To,
+		Amount:  a.Amount,
+		Depth:   uint64(a.Depth),
+		Success: a.Success,
+	}
+}
+
+func (a InternalTransfer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewInternalTransferJSON(a))
+}
+
+func (a *InternalTransfer) UnmarshalJSON(data []byte) error {
+	var b InternalTransferJSON
+	if err := json.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	*a = b.InternalTransfer()
+	return nil
+}
@@ -0,0 +1,141 @@
+package types
+
+import (
+	"math/big"
+)
+
+// IntrinsicGasSchedule is the chain parameter for the intrinsic gas of the regular transactions other than the
+// smart contract transactions, i.e. the gas they take up in the block gas budget and which their fee is divided
+// by for the mempool ordering, so they compare with the gas of the smart contract transactions. Once the minimum
+// gas price is set, it also sets the minimum fee of a transaction to its intrinsic gas times the minimum gas price,
+// plus the fee per byte of the fee schedule, instead of the base fee of the fee schedule.
+type IntrinsicGasSchedule struct {
+	BaseGas              []uint64 // indexed by TxType, the types without an entry (e.g. the registered txs) take GasCustomTx
+	GasPerSendTxAccount  uint64
+	GasPerSendTxDataByte uint64
+	MinGasPriceTFuelWei  *big.Int // the fee schedule sets the minimum fees unless positive
+}
+
+// DefaultIntrinsicGasSchedule returns the intrinsic gas schedule in effect unless set in the state, i.e. the gas
+// constants of the transaction types, without a minimum gas price so the fee schedule sets the minimum fees
+func DefaultIntrinsicGasSchedule() *IntrinsicGasSchedule {
+	return &IntrinsicGasSchedule{
+		BaseGas: []uint64{
+			TxCoinbase:                0,
+			TxSlash:                   0,
+			TxSend:                    0, // see GasPerSendTxAccount and GasPerSendTxDataByte
+			TxReserveFund:             GasReserveFundTx,
+			TxReleaseFund:             GasReleaseFundTx,
+			TxServicePayment:          GasServicePaymentTx,
+			TxSplitRule:               GasSplitRuleTx,
+			TxSmartContract:           0, // see SmartContractTx.GasLimit
+			TxDepositStake:            GasDepositStakeTx,
+			TxWithdrawStake:           GasWidthdrawStakeTx,
+			TxUpdateMultisig:          GasUpdateMultisigTx,
+			TxPartialReleaseFund:      GasPartialReleaseFundTx,
+			TxExtendSplitRule:         GasExtendSplitRuleTx,
+			TxSweepAccount:            GasSweepAccountTx,
+			TxBurn:                    GasBurnTx,
+			TxDoubleSignSlash:         GasDoubleSignSlashTx,
+			TxStakeCommission:         GasStakeCommissionTx,
+			TxCancelWithdraw:          GasCancelWithdrawTx,
+			TxUpdateValidatorMetadata: GasUpdateValidatorMetadataTx,
+			TxUnjail:                  GasUnjailTx,
+			TxEjectStake:              GasEjectStakeTx,
+			TxUpdateValidatorKey:      GasUpdateValidatorKeyTx,
+		},
+		GasPerSendTxAccount:  GasSendTxPerAccount,
+		GasPerSendTxDataByte: GasSendTxDataPerByte,
+		MinGasPriceTFuelWei:  big.NewInt(0),
+	}
+}
+
+// defaultIntrinsicGasSchedule backs EstimateTxGas, it must not be modified
+var defaultIntrinsicGasSchedule = DefaultIntrinsicGasSchedule()
+
+// TxGas returns the gas the given transaction takes up in the block gas budget, i.e. the intrinsic gas of a
+// regular transaction, or the declared gas limit of a smart contract transaction, which bounds the gas metered
+// by its execution, so the cumulative gas used by a block never exceeds its budget. The special transactions
+// (i.e. the CoinbaseTx and the SlashTx) take up no gas.
+func (gs *IntrinsicGasSchedule) TxGas(tx Tx) uint64 {
+	switch tx := tx.(type) {
+	case *CoinbaseTx, *SlashTx:
+		return 0
+	case *SmartContractTx:
+		return tx.GasLimit
+	case *SendTx:
+		gas := gs.GasPerSendTxAccount * uint64(len(tx.PayingInputs())+len(tx.Outputs))
+		if gas < 2*gs.GasPerSendTxAccount {
+			gas = 2 * gs.GasPerSendTxAccount // to prevent spamming with invalid transactions, e.g. empty inputs/outputs
+		}
+		return gas + gs.GasPerSendTxDataByte*uint64(len(tx.Data))
+	}
+
+	txType, err := getTxType(tx)
+	if err != nil {
+		return 0
+	}
+	if int(txType) < len(gs.BaseGas) {
+		return gs.BaseGas[txType]
+	}
+	return GasCustomTx
+}
+
+// MinGasPrice returns the minimum gas price of the regular transactions, zero if the fee schedule sets their
+// minimum fees instead
+func (gs *IntrinsicGasSchedule) MinGasPrice() *big.Int {
+	if gs.MinGasPriceTFuelWei == nil || gs.MinGasPriceTFuelWei.Sign() < 0 {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Set(gs.MinGasPriceTFuelWei)
+}
+
+// MinimumFee returns the minimum fee of the given transaction, whose raw encoding is txSize bytes long. It is
+// the minimum fee of the fee schedule, unless the minimum gas price is set.
+func (gs *IntrinsicGasSchedule) MinimumFee(fs *FeeSchedule, tx Tx, txSize int) *big.Int {
+	if gs.MinGasPrice().Sign() == 0 {
+		return fs.MinimumFee(tx, txSize)
+	}
+	fee := fs.PerByteFee()
+	fee.Mul(fee, big.NewInt(int64(txSize)))
+	return fee.Add(fee, gs.TxBaseFee(fs, tx))
+}
+
+// TxBaseFee returns the part of the minimum fee of the given transaction which does not depend on its size, i.e.
+// its intrinsic gas times the minimum gas price, or the base fee of its type in the fee schedule if the minimum
+// gas price is not set
+func (gs *IntrinsicGasSchedule) TxBaseFee(fs *FeeSchedule, tx Tx) *big.Int {
+	minGasPrice := gs.MinGasPrice()
+	if minGasPrice.Sign() == 0 {
+		return fs.TxBaseFee(tx)
+	}
+	gasFee := new(big.Int).SetUint64(gs.TxGas(tx))
+	return gasFee.Mul(gasFee, minGasPrice)
+}
+
+// TxMinimumFee returns the minimum fee of the given signed transaction
+func (gs *IntrinsicGasSchedule) TxMinimumFee(fs *FeeSchedule, tx Tx) (*big.Int, error) {
+	if fs.PerByteFee().Sign() == 0 {
+		return gs.MinimumFee(fs, tx, 0), nil
+	}
+	raw, err := TxToBytes(tx)
+	if err != nil {
+		return nil, err
+	}
+	return gs.MinimumFee(fs, tx, len(raw)), nil
+}
+
+// EffectiveGasPrice returns the fee of the given transaction per unit of its intrinsic gas, which orders it in
+// the mempool against the gas price of the smart contract transactions. It returns nil for the transactions
+// without a fee, or without intrinsic gas.
+func (gs *IntrinsicGasSchedule) EffectiveGasPrice(tx Tx) *big.Int {
+	fee := txFee(tx)
+	if fee == nil {
+		return nil
+	}
+	gas := gs.TxGas(tx)
+	if gas == 0 {
+		return nil
+	}
+	return new(big.Int).Div(fee.NoNil().TFuelWei, new(big.Int).SetUint64(gas))
+}
@@ -0,0 +1,76 @@
+package types
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thetatoken/theta/common"
+)
+
+func TestDefaultIntrinsicGasSchedule(t *testing.T) {
+	assert := assert.New(t)
+
+	gs := DefaultIntrinsicGasSchedule()
+	fs := DefaultFeeSchedule()
+	input := TxInput{Address: getTestAddress("input")}
+	output := TxOutput{Address: getTestAddress("output")}
+	txs := []Tx{
+		&CoinbaseTx{},
+		&SlashTx{},
+		&SendTx{Inputs: []TxInput{input}, Outputs: []TxOutput{output}},
+		&SendTx{Inputs: []TxInput{input, input}, Outputs: []TxOutput{output, output}, Data: common.Bytes("memo")},
+		&ReserveFundTx{},
+		&SmartContractTx{GasLimit: 50000},
+		&DepositStakeTx{},
+		&SweepAccountTx{},
+		&UpdateValidatorKeyTx{},
+	}
+
+	// The defaults preserve the gas and the flat fees of the transactions
+	for _, tx := range txs {
+		assert.Equal(EstimateTxGas(tx), gs.TxGas(tx), "%T", tx)
+		assert.Equal(fs.MinimumFee(tx, 100), gs.MinimumFee(fs, tx, 100), "%T", tx)
+	}
+	assert.Equal(uint64(0), gs.TxGas(&CoinbaseTx{}))
+	assert.Equal(uint64(50000), gs.TxGas(&SmartContractTx{GasLimit: 50000}))
+	assert.Equal(GasDepositStakeTx, gs.TxGas(&DepositStakeTx{}))
+	assert.Equal(4*GasSendTxPerAccount+4*GasSendTxDataPerByte, gs.TxGas(txs[3]))
+
+	// As well as the effective gas price of the regular transactions
+	stakeTx := &DepositStakeTx{Fee: NewCoins(0, int64(3*MinimumTransactionFeeTFuelWei))}
+	assert.Equal(new(big.Int).SetUint64(3*MinimumTransactionFeeTFuelWei/GasDepositStakeTx), gs.EffectiveGasPrice(stakeTx))
+	assert.Nil(gs.EffectiveGasPrice(&CoinbaseTx{}))
+	assert.Nil(gs.EffectiveGasPrice(&SmartContractTx{GasLimit: 50000}))
+}
+
+func TestIntrinsicGasScheduleMinGasPrice(t *testing.T) {
+	assert := assert.New(t)
+
+	gs := DefaultIntrinsicGasSchedule()
+	gs.BaseGas[TxDepositStake] = 30000
+	gs.GasPerSendTxAccount = 2000
+	gs.MinGasPriceTFuelWei = big.NewInt(1e9)
+	fs := DefaultFeeSchedule()
+	fs.PerByteFeeTFuelWei = big.NewInt(10)
+
+	// The minimum fee is the intrinsic gas times the minimum gas price, plus the fee per byte
+	stakeTx := &DepositStakeTx{Fee: NewCoins(0, 6e13)}
+	assert.Equal(uint64(30000), gs.TxGas(stakeTx))
+	assert.Equal(big.NewInt(30000*1e9), gs.TxBaseFee(fs, stakeTx))
+	assert.Equal(big.NewInt(30000*1e9+100*10), gs.MinimumFee(fs, stakeTx, 100))
+	assert.Equal(big.NewInt(2e9), gs.EffectiveGasPrice(stakeTx))
+
+	sendTx := &SendTx{Inputs: []TxInput{{}}, Outputs: []TxOutput{{}, {}, {}}, Data: common.Bytes("memo")}
+	assert.Equal(uint64(4*2000+4*GasSendTxDataPerByte), gs.TxGas(sendTx))
+	assert.Equal(big.NewInt((4*2000+4*int64(GasSendTxDataPerByte))*1e9), gs.MinimumFee(fs, sendTx, 0))
+
+	// The types without an entry take the gas of the registered txs
+	gs.BaseGas = gs.BaseGas[:TxDepositStake]
+	assert.Equal(GasCustomTx, gs.TxGas(stakeTx))
+
+	// Without a minimum gas price, the fee schedule applies
+	gs.MinGasPriceTFuelWei = nil
+	assert.Equal(fs.MinimumFee(stakeTx, 100), gs.MinimumFee(fs, stakeTx, 100))
+	assert.Equal(fs.TxBaseFee(stakeTx), gs.TxBaseFee(fs, stakeTx))
+}
@@ -0,0 +1,81 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/crypto"
+)
+
+// MultisigPolicy turns an account into a multi-signature account. The transactions spending from it need
+// to carry the signatures of at least Threshold distinct owners in the Signatures of the input, and the
+// signature of the account key itself is no longer accepted. The owners are identified by their addresses,
+// which are recovered from the signatures.
+type MultisigPolicy struct {
+	Owners    []common.Address `json:"owners"`
+	Threshold uint64           `json:"threshold"`
+}
+
+// Validate checks that the threshold can be met by the owners
+func (mp *MultisigPolicy) Validate() error {
+	if len(mp.Owners) == 0 {
+		return errors.New("No owners specified")
+	}
+	if len(mp.Owners) > MaxMultisigOwners {
+		return fmt.Errorf("Too many owners, at most %v owners are allowed", MaxMultisigOwners)
+	}
+	if mp.Threshold == 0 || mp.Threshold > uint64(len(mp.Owners)) {
+		return fmt.Errorf("Invalid threshold %v for %v owners", mp.Threshold, len(mp.Owners))
+	}
+	for i, owner := range mp.Owners {
+		for _, other := range mp.Owners[:i] {
+			if owner == other {
+				return fmt.Errorf("Duplicated owner: %v", owner.Hex())
+			}
+		}
+	}
+	return nil
+}
+
+// IsOwner returns whether the given address is one of the owners
+func (mp *MultisigPolicy) IsOwner(addr common.Address) bool {
+	for _, owner := range mp.Owners {
+		if owner == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// Signers returns the owners who signed the sign bytes. It returns an error if any of the signatures
+// is invalid, is not signed by an owner, or is signed by an owner who already signed.
+func (mp *MultisigPolicy) Signers(signBytes common.Bytes, sigs []*crypto.Signature) ([]common.Address, error) {
+	signers := []common.Address{}
+	for _, sig := range sigs {
+		if sig == nil || sig.IsEmpty() {
+			return nil, errors.New("Empty signature")
+		}
+		signer, err := sig.RecoverSignerAddress(signBytes)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid signature: %v", err)
+		}
+		if !mp.IsOwner(signer) {
+			return nil, fmt.Errorf("%v is not an owner", signer.Hex())
+		}
+		for _, prev := range signers {
+			if prev == signer {
+				return nil, fmt.Errorf("Duplicated signature of owner %v", signer.Hex())
+			}
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+func (mp *MultisigPolicy) String() string {
+	if mp == nil {
+		return "nil-MultisigPolicy"
+	}
+	return fmt.Sprintf("MultisigPolicy{%v of %v}", mp.Threshold, mp.Owners)
+}
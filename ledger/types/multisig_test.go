@@ -0,0 +1,135 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/rlp"
+)
+
+func TestMultisigPolicyValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	owner1, owner2 := getTestAddress("owner1"), getTestAddress("owner2")
+	assert.Nil((&MultisigPolicy{Owners: []common.Address{owner1, owner2}, Threshold: 2}).Validate())
+	assert.Nil((&MultisigPolicy{Owners: []common.Address{owner1, owner2}, Threshold: 1}).Validate())
+
+	assert.NotNil((&MultisigPolicy{Owners: []common.Address{}, Threshold: 1}).Validate())
+	assert.NotNil((&MultisigPolicy{Owners: []common.Address{owner1, owner2}, Threshold: 0}).Validate())
+	assert.NotNil((&MultisigPolicy{Owners: []common.Address{owner1, owner2}, Threshold: 3}).Validate())
+	assert.NotNil((&MultisigPolicy{Owners: []common.Address{owner1, owner1}, Threshold: 1}).Validate())
+
+	owners := []common.Address{}
+	for i := 0; i <= MaxMultisigOwners; i++ {
+		owners = append(owners, common.BytesToAddress([]byte{byte(i + 1)}))
+	}
+	assert.NotNil((&MultisigPolicy{Owners: owners, Threshold: 1}).Validate())
+	assert.Nil((&MultisigPolicy{Owners: owners[:MaxMultisigOwners], Threshold: 1}).Validate())
+}
+
+func TestMultisigPolicySigners(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	owner1, owner2, other := PrivAccountFromSecret("owner1"), PrivAccountFromSecret("owner2"), PrivAccountFromSecret("other")
+	policy := &MultisigPolicy{Owners: []common.Address{owner1.Address, owner2.Address}, Threshold: 2}
+	signBytes := common.Bytes("sign bytes")
+
+	signers, err := policy.Signers(signBytes, []*crypto.Signature{owner2.Sign(signBytes), owner1.Sign(signBytes)})
+	require.Nil(err)
+	assert.Equal([]common.Address{owner2.Address, owner1.Address}, signers)
+
+	signers, err = policy.Signers(signBytes, nil)
+	require.Nil(err)
+	assert.Empty(signers)
+
+	_, err = policy.Signers(signBytes, []*crypto.Signature{owner1.Sign(signBytes), owner1.Sign(signBytes)})
+	assert.NotNil(err)
+	_, err = policy.Signers(signBytes, []*crypto.Signature{owner1.Sign(signBytes), other.Sign(signBytes)})
+	assert.NotNil(err)
+	_, err = policy.Signers(signBytes, []*crypto.Signature{owner1.Sign(signBytes), nil})
+	assert.NotNil(err)
+
+	// Signed different bytes, thus recovers another address
+	_, err = policy.Signers(signBytes, []*crypto.Signature{owner1.Sign(common.Bytes("other bytes"))})
+	assert.NotNil(err)
+}
+
+func TestMultisigAccountRLP(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// The encoding of the regular accounts is unchanged
+	acc := makeAccount("regular", NewCoins(123, 456))
+	legacy := struct {
+		Address                common.Address
+		Sequence               uint64
+		Balance                Coins
+		ReservedFunds          []ReservedFund
+		LastUpdatedBlockHeight uint64
+		Root                   common.Hash
+		CodeHash               common.Hash
+	}{acc.Address, acc.Sequence, acc.Balance, acc.ReservedFunds, acc.LastUpdatedBlockHeight, acc.Root, acc.CodeHash}
+	legacyBytes, err := rlp.EncodeToBytes(legacy)
+	require.Nil(err)
+	accBytes, err := ToBytes(&acc)
+	require.Nil(err)
+	assert.Equal(legacyBytes, accBytes)
+
+	var decoded Account
+	require.Nil(FromBytes(legacyBytes, &decoded))
+	assert.Nil(decoded.Multisig)
+	assert.Equal(acc.Address, decoded.Address)
+
+	// The multisig policy is preserved
+	acc.Multisig = &MultisigPolicy{Owners: []common.Address{getTestAddress("owner1"), getTestAddress("owner2")}, Threshold: 1}
+	accBytes, err = ToBytes(&acc)
+	require.Nil(err)
+	require.Nil(FromBytes(accBytes, &decoded))
+	assert.Equal(acc.Multisig, decoded.Multisig)
+	assert.Equal(acc.Balance, decoded.Balance)
+}
+
+func TestMultisigTxInput(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	owner1, owner2 := PrivAccountFromSecret("owner1"), PrivAccountFromSecret("owner2")
+	tx := &SendTx{
+		Fee:     NewCoins(0, 123),
+		Inputs:  []TxInput{{Address: getTestAddress("multisig"), Coins: NewCoins(0, 579), Sequence: 1}},
+		Outputs: []TxOutput{{Address: getTestAddress("output1"), Coins: NewCoins(0, 456)}},
+	}
+	signBytes := tx.SignBytes(chainID)
+	tx.Inputs[0].Signatures = []*crypto.Signature{owner1.Sign(signBytes)}
+
+	// The co-signers sign the same bytes regardless of the collected signatures
+	assert.Equal(signBytes, tx.SignBytes(chainID))
+	tx.Inputs[0].Signatures = append(tx.Inputs[0].Signatures, owner2.Sign(tx.SignBytes(chainID)))
+	assert.Equal(signBytes, tx.SignBytes(chainID))
+
+	raw, err := TxToBytes(tx)
+	require.Nil(err)
+	decoded, err := TxFromBytes(raw)
+	require.Nil(err)
+	assert.Equal(tx.Inputs[0].Signatures, decoded.(*SendTx).Inputs[0].Signatures)
+
+	updateTx := &UpdateMultisigTx{
+		Fee:       NewCoins(0, 123),
+		Account:   TxInput{Address: getTestAddress("multisig"), Sequence: 2},
+		Owners:    []common.Address{owner1.Address, owner2.Address},
+		Threshold: 2,
+	}
+	updateTx.Account.Signatures = []*crypto.Signature{owner1.Sign(updateTx.SignBytes(chainID))}
+	raw, err = TxToBytes(updateTx)
+	require.Nil(err)
+	decoded, err = TxFromBytes(raw)
+	require.Nil(err)
+	assert.Equal(updateTx.Owners, decoded.(*UpdateMultisigTx).Owners)
+	assert.Equal(updateTx.Account.Signatures, decoded.(*UpdateMultisigTx).Account.Signatures)
+	assert.Equal(&MultisigPolicy{Owners: updateTx.Owners, Threshold: 2}, decoded.(*UpdateMultisigTx).Policy())
+	assert.Nil((&UpdateMultisigTx{}).Policy())
+}
@@ -0,0 +1,292 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/hexutil"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/database"
+)
+
+// TxReceipt records the outcome of a transaction applied as part of a block
+type TxReceipt struct {
+	TxHash     common.Hash  // Hash of the raw transaction bytes
+	Code       uint64       // Result code of the execution, 0 indicates success
+	Message    string       // Error message if the execution failed, or the VM error of an applied smart contract transaction
+	Fee        Coins        // Fee charged for the transaction
+	GasUsed    uint64       // Gas used, only applicable to smart contract transactions
+	Logs       []*Log       // Logs emitted, only applicable to smart contract transactions
+	RevertData common.Bytes // Data returned by a reverted smart contract execution, e.g. an ABI encoded Error(string)
+
+	// Value transfers made by the contracts during the execution of a smart contract transaction, capped at
+	// MaxInternalTransfersPerTx
+	InternalTransfers          []*InternalTransfer
+	InternalTransfersTruncated bool // True if the transfers beyond MaxInternalTransfersPerTx were dropped
+
+	StateAccess *StateAccessList // State keys accessed, only recorded if the state access lists are enabled
+}
+
+type TxReceiptJSON struct {
+	TxHash     common.Hash       `json:"tx_hash"`
+	Code       common.JSONUint64 `json:"code"`
+	Message    string            `json:"message"`
+	Fee        Coins             `json:"fee"`
+	GasUsed    common.JSONUint64 `json:"gas_used"`
+	Logs       []*Log            `json:"logs"`
+	RevertData hexutil.Bytes     `json:"revert_data,omitempty"`
+
+	InternalTransfers          []*InternalTransfer `json:"internal_transfers,omitempty"`
+	InternalTransfersTruncated bool                `json:"internal_transfers_truncated,omitempty"`
+
+	StateAccess *StateAccessList `json:"state_access,omitempty"`
+}
+
+func NewTxReceiptJSON(a TxReceipt) TxReceiptJSON {
+	return TxReceiptJSON{
+		TxHash:     a.TxHash,
+		Code:       common.JSONUint64(a.Code),
+		Message:    a.Message,
+		Fee:        a.Fee,
+		GasUsed:    common.JSONUint64(a.GasUsed),
+		Logs:       a.Logs,
+		RevertData: hexutil.Bytes(a.RevertData),
+
+		InternalTransfers:          a.InternalTransfers,
+		InternalTransfersTruncated: a.InternalTransfersTruncated,
+
+		StateAccess: a.StateAccess,
+	}
+}
+
+func (a TxReceiptJSON) TxReceipt() TxReceipt {
+	return TxReceipt{
+		TxHash:     a.TxHash,
+		Code:       uint64(a.Code),
+		Message:    a.Message,
+		Fee:        a.Fee,
+		GasUsed:    uint64(a.GasUsed),
+		Logs:       a.Logs,
+		RevertData: common.Bytes(a.RevertData),
+
+		InternalTransfers:          a.InternalTransfers,
+		InternalTransfersTruncated: a.InternalTransfersTruncated,
+
+		StateAccess: a.StateAccess,
+	}
+}
+
+func (a TxReceipt) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewTxReceiptJSON(a))
+}
+
+func (a *TxReceipt) UnmarshalJSON(data []byte) error {
+	var b TxReceiptJSON
+	if err := json.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	*a = b.TxReceipt()
+	return nil
+}
+
+// txReceiptRLP is the RLP encoding of TxReceipt. The fields introduced later, i.e. the revert data, the
+// internal transfers and then the state access list, are only appended up to the last one set, so that the receipts persisted before they
+// were introduced still decode.
+type txReceiptRLP struct {
+	TxHash  common.Hash
+	Code    uint64
+	Message string
+	Fee     Coins
+	GasUsed uint64
+	Logs    []*Log
+	Tail    []rlp.RawValue `rlp:"tail"`
+}
+
+// EncodeRLP implements rlp.Encoder.
+func (a *TxReceipt) EncodeRLP(w io.Writer) error {
+	enc := txReceiptRLP{
+		TxHash:  a.TxHash,
+		Code:    a.Code,
+		Message: a.Message,
+		Fee:     a.Fee,
+		GasUsed: a.GasUsed,
+		Logs:    a.Logs,
+	}
+	tail := []interface{}{a.RevertData, a.InternalTransfers, a.InternalTransfersTruncated, a.StateAccess}
+	numTailFields := 0
+	if a.StateAccess != nil {
+		numTailFields = 4
+	} else if len(a.InternalTransfers) > 0 || a.InternalTransfersTruncated {
+		numTailFields = 3
+	} else if len(a.RevertData) > 0 {
+		numTailFields = 1
+	}
+	for _, field := range tail[:numTailFields] {
+		raw, err := rlp.EncodeToBytes(field)
+		if err != nil {
+			return err
+		}
+		enc.Tail = append(enc.Tail, raw)
+	}
+	return rlp.Encode(w, enc)
+}
+
+// DecodeRLP implements rlp.Decoder.
+func (a *TxReceipt) DecodeRLP(s *rlp.Stream) error {
+	var dec txReceiptRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	if len(dec.Tail) > 4 {
+		return fmt.Errorf("rlp: too many elements for TxReceipt")
+	}
+	*a = TxReceipt{
+		TxHash:  dec.TxHash,
+		Code:    dec.Code,
+		Message: dec.Message,
+		Fee:     dec.Fee,
+		GasUsed: dec.GasUsed,
+		Logs:    dec.Logs,
+	}
+	tail := []interface{}{&a.RevertData, &a.InternalTransfers, &a.InternalTransfersTruncated, &a.StateAccess}
+	for i, raw := range dec.Tail {
+		if err := rlp.DecodeBytes(raw, tail[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsOK indicates if the transaction was executed successfully
+func (a *TxReceipt) IsOK() bool {
+	return result.ErrorCode(a.Code) == result.CodeOK
+}
+
+func (a *TxReceipt) String() string {
+	return fmt.Sprintf("TxReceipt{tx_hash: %v, code: %v, message: %v, fee: %v, gas_used: %v, logs: %v}",
+		a.TxHash.Hex(), a.Code, a.Message, a.Fee, a.GasUsed, len(a.Logs))
+}
+
+// ReceiptEncodingVersion is the version of the encoding of the receipts committed by the blocks, see
+// ConsensusBytes. A change to the encoding bumps the version, and takes effect at a fork height.
+const ReceiptEncodingVersion uint64 = 1
+
+// receiptConsensusRLP is the encoding of the consensus fields of a TxReceipt, see ConsensusBytes
+type receiptConsensusRLP struct {
+	Version                    uint64
+	TxHash                     common.Hash
+	Code                       uint64
+	VMFailed                   bool
+	Fee                        Coins
+	GasUsed                    uint64
+	Logs                       []receiptLogRLP
+	RevertData                 common.Bytes
+	InternalTransfers          []receiptTransferRLP
+	InternalTransfersTruncated bool
+}
+
+type receiptLogRLP struct {
+	Address common.Address
+	Topics  []common.Hash
+	Data    common.Bytes
+}
+
+type receiptTransferRLP struct {
+	Type    string
+	From    common.Address
+	To      common.Address
+	Amount  Coins
+	Depth   uint64
+	Success bool
+}
+
+// ConsensusBytes returns the canonical encoding of the receipt committed by the blocks from
+// common.HeightEnableReceiptRoot. It is prefixed by the ReceiptEncodingVersion, and leaves out the fields which
+// are not secured by consensus: the message, of which only whether the VM failed is kept, the derived fields of
+// the logs, and the state access list, which is only recorded by the nodes enabling it.
+func (a *TxReceipt) ConsensusBytes() (common.Bytes, error) {
+	enc := receiptConsensusRLP{
+		Version:                    ReceiptEncodingVersion,
+		TxHash:                     a.TxHash,
+		Code:                       a.Code,
+		VMFailed:                   a.IsOK() && a.Message != "",
+		Fee:                        a.Fee.NoNil(),
+		GasUsed:                    a.GasUsed,
+		Logs:                       []receiptLogRLP{},
+		RevertData:                 a.RevertData,
+		InternalTransfers:          []receiptTransferRLP{},
+		InternalTransfersTruncated: a.InternalTransfersTruncated,
+	}
+	for _, log := range a.Logs {
+		enc.Logs = append(enc.Logs, receiptLogRLP{Address: log.Address, Topics: log.Topics, Data: log.Data})
+	}
+	for _, transfer := range a.InternalTransfers {
+		enc.InternalTransfers = append(enc.InternalTransfers, receiptTransferRLP{
+			Type:    transfer.Type,
+			From:    transfer.From,
+			To:      transfer.To,
+			Amount:  transfer.Amount.NoNil(),
+			Depth:   transfer.Depth,
+			Success: transfer.Success,
+		})
+	}
+	return rlp.EncodeToBytes(enc)
+}
+
+// DeriveReceiptRoot returns the root hash of the trie of the consensus encodings of the receipts, keyed by their
+// index like the txs of a block, see core.CalculateRootHash
+func DeriveReceiptRoot(receipts []*TxReceipt) (common.Hash, error) {
+	items, err := receiptConsensusItems(receipts)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return core.CalculateRootHash(items), nil
+}
+
+// ProveReceipt puts into proofDb the trie nodes proving the receipt at the given index against the root hash of
+// the receipts, see DeriveReceiptRoot
+func ProveReceipt(receipts []*TxReceipt, index int, proofDb database.Putter) error {
+	items, err := receiptConsensusItems(receipts)
+	if err != nil {
+		return err
+	}
+	return core.ProveItem(items, index, proofDb)
+}
+
+func receiptConsensusItems(receipts []*TxReceipt) ([]common.Bytes, error) {
+	items := make([]common.Bytes, len(receipts))
+	for i, receipt := range receipts {
+		item, err := receipt.ConsensusBytes()
+		if err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+// CreateBloom returns the bloom filter of the addresses and topics of the logs of the receipts
+func CreateBloom(receipts []*TxReceipt) core.Bloom {
+	bin := new(big.Int)
+	for _, receipt := range receipts {
+		bin.Or(bin, LogsBloom(receipt.Logs))
+	}
+	return core.BytesToBloom(bin.Bytes())
+}
+
+// LogsBloom returns the bloom filter bits of the addresses and topics of the logs
+func LogsBloom(logs []*Log) *big.Int {
+	bin := new(big.Int)
+	for _, log := range logs {
+		bin.Or(bin, core.Bloom9(log.Address.Bytes()))
+		for _, topic := range log.Topics {
+			bin.Or(bin, core.Bloom9(topic[:]))
+		}
+	}
+	return bin
+}
@@ -0,0 +1,181 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/rlp"
+)
+
+func TestTxReceiptOptionalFields(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	receipt := &TxReceipt{
+		TxHash:  common.BytesToHash([]byte("tx")),
+		Message: "evm: execution reverted",
+		Fee:     NewCoins(0, 1000),
+		GasUsed: 21500,
+		Logs:    []*Log{},
+	}
+
+	// Without the revert data, the encoding is the same as before the revert data was introduced
+	legacy, err := rlp.EncodeToBytes(txReceiptRLP{
+		TxHash:  receipt.TxHash,
+		Message: receipt.Message,
+		Fee:     receipt.Fee,
+		GasUsed: receipt.GasUsed,
+		Logs:    receipt.Logs,
+	})
+	require.Nil(err)
+	encoded, err := rlp.EncodeToBytes(receipt)
+	require.Nil(err)
+	assert.Equal(legacy, encoded)
+
+	var decoded TxReceipt
+	require.Nil(rlp.DecodeBytes(legacy, &decoded))
+	assert.Equal(*receipt, decoded)
+
+	// With the revert data
+	receipt.RevertData = common.Hex2Bytes("deadbeef000000000000000000000000000000000000000000000000000000000000002a")
+	encoded, err = rlp.EncodeToBytes(receipt)
+	require.Nil(err)
+	assert.NotEqual(legacy, encoded)
+	decoded = TxReceipt{}
+	require.Nil(rlp.DecodeBytes(encoded, &decoded))
+	assert.Equal(*receipt, decoded)
+
+	// With the internal transfers, with or without the revert data
+	receipt.InternalTransfers = []*InternalTransfer{
+		{Type: "CALL", From: common.HexToAddress("0x1"), To: common.HexToAddress("0x2"), Amount: NewCoins(0, 100), Depth: 1, Success: true},
+		{Type: "SELFDESTRUCT", From: common.HexToAddress("0x2"), To: common.HexToAddress("0x3"), Amount: NewCoins(0, 7), Depth: 2},
+	}
+	receipt.InternalTransfersTruncated = true
+	encoded, err = rlp.EncodeToBytes(receipt)
+	require.Nil(err)
+	decoded = TxReceipt{}
+	require.Nil(rlp.DecodeBytes(encoded, &decoded))
+	assert.Equal(*receipt, decoded)
+
+	revertData := receipt.RevertData
+	receipt.RevertData = nil
+	encoded, err = rlp.EncodeToBytes(receipt)
+	require.Nil(err)
+	decoded = TxReceipt{}
+	require.Nil(rlp.DecodeBytes(encoded, &decoded))
+	assert.Equal(0, len(decoded.RevertData))
+	assert.Equal(receipt.InternalTransfers, decoded.InternalTransfers)
+	assert.True(decoded.InternalTransfersTruncated)
+	receipt.RevertData = revertData
+
+	// With the state access list
+	receipt.StateAccess = NewStateAccessList(map[string]bool{"ls/a/1": true, "ls/a/0": true}, map[string]bool{"ls/a/1": true},
+		map[string]bool{})
+	encoded, err = rlp.EncodeToBytes(receipt)
+	require.Nil(err)
+	decoded = TxReceipt{}
+	require.Nil(rlp.DecodeBytes(encoded, &decoded))
+	require.NotNil(decoded.StateAccess)
+	assert.Equal([]common.Bytes{common.Bytes("ls/a/0"), common.Bytes("ls/a/1")}, decoded.StateAccess.Reads)
+	assert.Equal([]common.Bytes{common.Bytes("ls/a/1")}, decoded.StateAccess.Writes)
+	assert.Equal(0, len(decoded.StateAccess.Traversed))
+
+	// The unknown trailing fields are rejected
+	rawRevertData, err := rlp.EncodeToBytes(receipt.RevertData)
+	require.Nil(err)
+	rawTransfers, err := rlp.EncodeToBytes(receipt.InternalTransfers)
+	require.Nil(err)
+	rawTruncated, err := rlp.EncodeToBytes(true)
+	require.Nil(err)
+	rawStateAccess, err := rlp.EncodeToBytes(receipt.StateAccess)
+	require.Nil(err)
+	tooLong, err := rlp.EncodeToBytes(txReceiptRLP{
+		TxHash: receipt.TxHash,
+		Logs:   receipt.Logs,
+		Tail:   []rlp.RawValue{rawRevertData, rawTransfers, rawTruncated, rawStateAccess, rawStateAccess},
+	})
+	require.Nil(err)
+	assert.NotNil(rlp.DecodeBytes(tooLong, &decoded))
+
+	// JSON
+	receiptJSON, err := json.Marshal(receipt)
+	require.Nil(err)
+	assert.Contains(string(receiptJSON), `"revert_data":"0xdeadbeef`)
+	decoded = TxReceipt{}
+	require.Nil(json.Unmarshal(receiptJSON, &decoded))
+	assert.Equal(receipt.RevertData, decoded.RevertData)
+	assert.Contains(string(receiptJSON), `"internal_transfers_truncated":true`)
+	assert.Contains(string(receiptJSON), `"depth":"2"`)
+	assert.Equal(receipt.InternalTransfers, decoded.InternalTransfers)
+	assert.Contains(string(receiptJSON), `"writes":["0x6c732f612f31"]`)
+	assert.Equal(receipt.StateAccess.Reads, decoded.StateAccess.Reads)
+
+	receipt.RevertData = nil
+	receipt.InternalTransfers = nil
+	receipt.InternalTransfersTruncated = false
+	receipt.StateAccess = nil
+	receiptJSON, err = json.Marshal(receipt)
+	require.Nil(err)
+	assert.NotContains(string(receiptJSON), "revert_data")
+	assert.NotContains(string(receiptJSON), "internal_transfers")
+	assert.NotContains(string(receiptJSON), "state_access")
+}
+
+func TestTxReceiptConsensusBytes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	address := common.HexToAddress("0x1")
+	receipt := &TxReceipt{
+		TxHash:  common.BytesToHash([]byte("tx")),
+		Message: "evm: execution reverted",
+		Fee:     NewCoins(0, 1000),
+		GasUsed: 21500,
+		Logs:    []*Log{{Address: address, Topics: []common.Hash{common.BytesToHash([]byte("topic"))}, Data: []byte{1}}},
+	}
+	encoded, err := receipt.ConsensusBytes()
+	require.Nil(err)
+
+	// The encoding is versioned
+	var dec receiptConsensusRLP
+	require.Nil(rlp.DecodeBytes(encoded, &dec))
+	assert.Equal(ReceiptEncodingVersion, dec.Version)
+	assert.True(dec.VMFailed)
+
+	// The fields not secured by consensus are left out
+	other := *receipt
+	other.Message = "out of gas"
+	other.Fee = Coins{TFuelWei: receipt.Fee.TFuelWei}
+	other.Logs = []*Log{{Address: address, Topics: receipt.Logs[0].Topics, Data: []byte{1}, BlockNumber: 7, TxIndex: 2, Index: 3}}
+	other.StateAccess = &StateAccessList{}
+	otherEncoded, err := other.ConsensusBytes()
+	require.Nil(err)
+	assert.Equal(encoded, otherEncoded)
+
+	// The consensus fields are not
+	other = *receipt
+	other.Message = ""
+	otherEncoded, err = other.ConsensusBytes()
+	require.Nil(err)
+	assert.NotEqual(encoded, otherEncoded)
+	other = *receipt
+	other.InternalTransfersTruncated = true
+	otherEncoded, err = other.ConsensusBytes()
+	require.Nil(err)
+	assert.NotEqual(encoded, otherEncoded)
+
+	// The receipt root depends on the order of the receipts
+	receipts := []*TxReceipt{receipt, {TxHash: common.BytesToHash([]byte("tx2"))}}
+	root, err := DeriveReceiptRoot(receipts)
+	require.Nil(err)
+	reversed, err := DeriveReceiptRoot([]*TxReceipt{receipts[1], receipts[0]})
+	require.Nil(err)
+	assert.NotEqual(root, reversed)
+	empty, err := DeriveReceiptRoot(nil)
+	require.Nil(err)
+	assert.Equal(core.EmptyRootHash, empty)
+}
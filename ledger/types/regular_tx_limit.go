@@ -0,0 +1,27 @@
+package types
+
+// RegularTxLimit is the chain parameter for the max number of regular transactions in a block. A change of the
+// limit takes effect from the block at a given height on, so that all the validators switch at the same block.
+type RegularTxLimit struct {
+	Limit          uint64
+	NewLimit       uint64
+	NewLimitHeight uint64 // the height of the first block under NewLimit, 0 if no change is scheduled
+}
+
+// LimitAt returns the limit in effect for the block at the given height
+func (l *RegularTxLimit) LimitAt(height uint64) uint64 {
+	if l.NewLimitHeight != 0 && height >= l.NewLimitHeight {
+		return l.NewLimit
+	}
+	return l.Limit
+}
+
+// Schedule changes the limit to the given one, from the block at the given height on. A change scheduled
+// earlier replaces the current limit if it takes effect before the new one, and is dropped otherwise.
+func (l *RegularTxLimit) Schedule(limit uint64, height uint64) {
+	if l.NewLimitHeight != 0 && l.NewLimitHeight <= height {
+		l.Limit = l.NewLimit
+	}
+	l.NewLimit = limit
+	l.NewLimitHeight = height
+}
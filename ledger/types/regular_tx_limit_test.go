@@ -0,0 +1,31 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegularTxLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	rtl := &RegularTxLimit{Limit: 100}
+	assert.Equal(uint64(100), rtl.LimitAt(1))
+
+	rtl.Schedule(50, 10)
+	assert.Equal(uint64(100), rtl.LimitAt(9))
+	assert.Equal(uint64(50), rtl.LimitAt(10))
+	assert.Equal(uint64(50), rtl.LimitAt(11))
+
+	// The earlier change takes effect before the new one
+	rtl.Schedule(20, 15)
+	assert.Equal(uint64(50), rtl.LimitAt(9))
+	assert.Equal(uint64(50), rtl.LimitAt(14))
+	assert.Equal(uint64(20), rtl.LimitAt(15))
+
+	// The earlier change is dropped if the new one takes effect first
+	rtl.Schedule(30, 12)
+	assert.Equal(uint64(50), rtl.LimitAt(11))
+	assert.Equal(uint64(30), rtl.LimitAt(12))
+	assert.Equal(uint64(30), rtl.LimitAt(15))
+}
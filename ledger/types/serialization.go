@@ -2,7 +2,9 @@ package types
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"reflect"
 
 	"github.com/pkg/errors"
 	"github.com/thetatoken/theta/rlp"
@@ -35,6 +37,18 @@ const (
 	TxSmartContract
 	TxDepositStake
 	TxWithdrawStake
+	TxUpdateMultisig
+	TxPartialReleaseFund
+	TxExtendSplitRule
+	TxSweepAccount
+	TxBurn
+	TxDoubleSignSlash
+	TxStakeCommission
+	TxCancelWithdraw
+	TxUpdateValidatorMetadata
+	TxUnjail
+	TxEjectStake
+	TxUpdateValidatorKey
 )
 
 func Fuzz(data []byte) int {
@@ -48,14 +62,24 @@ func Fuzz(data []byte) int {
 		return 0
 	}
 	if data[0]%3 == 1 {
-		if _, err := TxFromBytes(data[1:]); err != nil {
-			return 1
+		tx, err := TxFromCanonicalBytes(data[1:])
+		if err != nil {
+			return 0
 		}
-		return 0
+		// Any accepted tx must be in canonical form
+		canonical, err := TxToBytes(tx)
+		if err != nil || !bytes.Equal(canonical, data[1:]) {
+			panic(fmt.Sprintf("Non-canonical %T accepted: %x", tx, data[1:]))
+		}
+		if tx.Validate().IsError() {
+			return 0
+		}
+		return 1
 	}
 	return -1
 }
 
+// TxFromBytes decodes the raw transaction.
 func TxFromBytes(raw []byte) (Tx, error) {
 	var txType TxType
 	buff := bytes.NewBuffer(raw)
@@ -64,85 +88,209 @@ func TxFromBytes(raw []byte) (Tx, error) {
 	if err != nil {
 		return nil, err
 	}
-	if txType == TxCoinbase {
-		data := &CoinbaseTx{}
-		err = s.Decode(data)
-		return data, err
-	} else if txType == TxSlash {
-		data := &SlashTx{}
-		err = s.Decode(data)
-		return data, err
-	} else if txType == TxSend {
-		data := &SendTx{}
-		err = s.Decode(data)
-		return data, err
-	} else if txType == TxReserveFund {
-		data := &ReserveFundTx{}
-		err = s.Decode(data)
-		return data, err
-	} else if txType == TxReleaseFund {
-		data := &ReleaseFundTx{}
-		err = s.Decode(data)
-		return data, err
-	} else if txType == TxServicePayment {
-		data := &ServicePaymentTx{}
-		err = s.Decode(data)
-		return data, err
-	} else if txType == TxSplitRule {
-		data := &SplitRuleTx{}
-		err = s.Decode(data)
-		return data, err
-	} else if txType == TxSmartContract {
-		data := &SmartContractTx{}
-		err = s.Decode(data)
-		return data, err
-	} else if txType == TxDepositStake {
-		data := &DepositStakeTx{}
-		err = s.Decode(data)
-		return data, err
-	} else if txType == TxWithdrawStake {
-		data := &WithdrawStakeTx{}
-		err = s.Decode(data)
-		return data, err
-	} else {
-		return nil, fmt.Errorf("Unknown TX type: %v", txType)
+	tx, err := newTxOfType(txType)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.Decode(tx); err != nil {
+		return tx, err
+	}
+	if buff.Len() > 0 {
+		return tx, fmt.Errorf("Unexpected %v trailing bytes after the %T", buff.Len(), tx)
+	}
+	return tx, nil
+}
+
+// TxFromCanonicalBytes decodes the raw transaction. Only the canonical serialization is accepted, so
+// that TxToBytes reproduces the raw bytes, and thus the hash of the decoded transaction.
+func TxFromCanonicalBytes(raw []byte) (Tx, error) {
+	tx, err := TxFromBytes(raw)
+	if err != nil {
+		return tx, err
+	}
+
+	// The RLP decoder already rejects most non-canonical encodings, e.g. the integers with leading
+	// zeros. Re-encoding the tx catches the remaining ones, so that each tx has a single encoding.
+	canonical, err := TxToBytes(tx)
+	if err != nil {
+		return tx, err
+	}
+	if !bytes.Equal(canonical, raw) {
+		return tx, fmt.Errorf("Non-canonical encoding of the %T", tx)
 	}
+	return tx, nil
+}
+
+// PeekTxType decodes the type of the raw transaction, without decoding the transaction itself
+func PeekTxType(raw []byte) (TxType, error) {
+	var txType TxType
+	s := rlp.NewStream(bytes.NewReader(raw), uint64(len(raw)))
+	err := s.Decode(&txType)
+	return txType, err
 }
 
 func TxToBytes(t Tx) ([]byte, error) {
 	var buf bytes.Buffer
-	var txType TxType
+	txType, err := getTxType(t)
+	if err != nil {
+		return nil, err
+	}
+	err = rlp.Encode(&buf, txType)
+	if err != nil {
+		return nil, err
+	}
+	err = rlp.Encode(&buf, t)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// TxJSON is the canonical JSON encoding of a transaction, i.e. the transaction tagged with its type.
+// The addresses, signatures and byte strings are 0x-prefixed hex strings, and the amounts, sequences
+// and heights are decimal strings.
+type TxJSON struct {
+	Type TxType          `json:"type"`
+	Tx   json.RawMessage `json:"transaction"`
+}
+
+// TxToJSON encodes the transaction into its canonical JSON encoding
+func TxToJSON(t Tx) ([]byte, error) {
+	txType, err := getTxType(t)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(TxJSON{Type: txType, Tx: raw})
+}
+
+// TxFromJSON decodes the transaction from its canonical JSON encoding. The decoded transaction has the
+// same SignBytes as the encoded one, so the signatures carried in the JSON remain valid.
+func TxFromJSON(data []byte) (Tx, error) {
+	var txJSON TxJSON
+	if err := json.Unmarshal(data, &txJSON); err != nil {
+		return nil, err
+	}
+	if len(txJSON.Tx) == 0 {
+		return nil, errors.New("Missing transaction")
+	}
+	tx, err := newTxOfType(txJSON.Type)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(txJSON.Tx, tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func getTxType(t Tx) (TxType, error) {
 	switch t.(type) {
 	case *CoinbaseTx:
-		txType = TxCoinbase
+		return TxCoinbase, nil
 	case *SlashTx:
-		txType = TxSlash
+		return TxSlash, nil
 	case *SendTx:
-		txType = TxSend
+		return TxSend, nil
 	case *ReserveFundTx:
-		txType = TxReserveFund
+		return TxReserveFund, nil
 	case *ReleaseFundTx:
-		txType = TxReleaseFund
+		return TxReleaseFund, nil
 	case *ServicePaymentTx:
-		txType = TxServicePayment
+		return TxServicePayment, nil
 	case *SplitRuleTx:
-		txType = TxSplitRule
+		return TxSplitRule, nil
 	case *SmartContractTx:
-		txType = TxSmartContract
+		return TxSmartContract, nil
 	case *DepositStakeTx:
-		txType = TxDepositStake
+		return TxDepositStake, nil
 	case *WithdrawStakeTx:
-		txType = TxWithdrawStake
+		return TxWithdrawStake, nil
+	case *UpdateMultisigTx:
+		return TxUpdateMultisig, nil
+	case *PartialReleaseFundTx:
+		return TxPartialReleaseFund, nil
+	case *ExtendSplitRuleTx:
+		return TxExtendSplitRule, nil
+	case *SweepAccountTx:
+		return TxSweepAccount, nil
+	case *BurnTx:
+		return TxBurn, nil
+	case *DoubleSignSlashTx:
+		return TxDoubleSignSlash, nil
+	case *StakeCommissionTx:
+		return TxStakeCommission, nil
+	case *CancelWithdrawTx:
+		return TxCancelWithdraw, nil
+	case *UpdateValidatorMetadataTx:
+		return TxUpdateValidatorMetadata, nil
+	case *UnjailTx:
+		return TxUnjail, nil
+	case *EjectStakeTx:
+		return TxEjectStake, nil
+	case *UpdateValidatorKeyTx:
+		return TxUpdateValidatorKey, nil
 	default:
-		return nil, errors.New("Unsupported message type")
-	}
-	err := rlp.Encode(&buf, txType)
-	if err != nil {
-		return nil, err
+		if txType, ok := customTxTypesByGoType[reflect.TypeOf(t)]; ok {
+			return txType, nil
+		}
+		return 0, errors.New("Unsupported message type")
 	}
-	err = rlp.Encode(&buf, t)
-	if err != nil {
-		return nil, err
+}
+
+func newTxOfType(txType TxType) (Tx, error) {
+	switch txType {
+	case TxCoinbase:
+		return &CoinbaseTx{}, nil
+	case TxSlash:
+		return &SlashTx{}, nil
+	case TxSend:
+		return &SendTx{}, nil
+	case TxReserveFund:
+		return &ReserveFundTx{}, nil
+	case TxReleaseFund:
+		return &ReleaseFundTx{}, nil
+	case TxServicePayment:
+		return &ServicePaymentTx{}, nil
+	case TxSplitRule:
+		return &SplitRuleTx{}, nil
+	case TxSmartContract:
+		return &SmartContractTx{}, nil
+	case TxDepositStake:
+		return &DepositStakeTx{}, nil
+	case TxWithdrawStake:
+		return &WithdrawStakeTx{}, nil
+	case TxUpdateMultisig:
+		return &UpdateMultisigTx{}, nil
+	case TxPartialReleaseFund:
+		return &PartialReleaseFundTx{}, nil
+	case TxExtendSplitRule:
+		return &ExtendSplitRuleTx{}, nil
+	case TxSweepAccount:
+		return &SweepAccountTx{}, nil
+	case TxBurn:
+		return &BurnTx{}, nil
+	case TxDoubleSignSlash:
+		return &DoubleSignSlashTx{}, nil
+	case TxStakeCommission:
+		return &StakeCommissionTx{}, nil
+	case TxCancelWithdraw:
+		return &CancelWithdrawTx{}, nil
+	case TxUpdateValidatorMetadata:
+		return &UpdateValidatorMetadataTx{}, nil
+	case TxUnjail:
+		return &UnjailTx{}, nil
+	case TxEjectStake:
+		return &EjectStakeTx{}, nil
+	case TxUpdateValidatorKey:
+		return &UpdateValidatorKeyTx{}, nil
+	default:
+		if newTx, ok := customTxTypes[txType]; ok {
+			return newTx(), nil
+		}
+		return nil, fmt.Errorf("Unknown TX type: %v", txType)
 	}
-	return buf.Bytes(), nil
 }
@@ -1,7 +1,14 @@
 package types
 
 import (
+	"bytes"
 	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -158,6 +165,408 @@ func TestTx(t *testing.T) {
 	assert.Equal(tx1.(*SplitRuleTx).Duration, tx2.(*SplitRuleTx).Duration)
 }
 
+func TestTxHash(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	sig, err := crypto.SignatureFromBytes([]byte("I am a signature"))
+	require.Nil(err)
+	input := TxInput{Address: getTestAddress("123"), Coins: NewCoins(0, 456), Sequence: 1, Signature: sig}
+	output := TxOutput{Address: getTestAddress("456"), Coins: NewCoins(0, 456)}
+	fee := NewCoins(0, 789)
+
+	// DepositStakeTx and WithdrawStakeTx, as well as the SendTx with and without a memo, have the same fields
+	txs := []Tx{
+		&CoinbaseTx{Proposer: input, Outputs: []TxOutput{output}, BlockHeight: 10},
+		&SlashTx{Proposer: input, SlashedAddress: getTestAddress("456"), ReserveSequence: 1, SlashProof: common.Bytes("789")},
+		&SendTx{Fee: fee, Inputs: []TxInput{input}, Outputs: []TxOutput{output}},
+		&SendTx{Fee: fee, Inputs: []TxInput{input}, Outputs: []TxOutput{output}, Data: common.Bytes("memo")},
+		&ReserveFundTx{Fee: fee, Source: input, Collateral: NewCoins(0, 1), ResourceIDs: []string{"rid"}, Duration: 10},
+		&ReleaseFundTx{Fee: fee, Source: input, ReserveSequence: 1},
+		&ServicePaymentTx{Fee: fee, Source: input, Target: input, PaymentSequence: 1, ReserveSequence: 1, ResourceID: "rid"},
+		&SplitRuleTx{Fee: fee, ResourceID: "rid", Initiator: input, Splits: []Split{{Address: getTestAddress("456"), Percentage: 30}}, Duration: 10},
+		&SmartContractTx{From: input, To: output, GasLimit: 10, GasPrice: fee.TFuelWei, Data: common.Bytes("data")},
+		&DepositStakeTx{Fee: fee, Source: input, Holder: output, Purpose: 1},
+		&WithdrawStakeTx{Fee: fee, Source: input, Holder: output, Purpose: 1},
+	}
+
+	hashes := make(map[common.Hash]Tx)
+	for _, tx := range txs {
+		raw, err := TxToBytes(tx)
+		require.Nil(err)
+		hash := tx.Hash()
+		assert.Equal(crypto.Keccak256Hash(raw), hash)
+		assert.Equal(hash, RawTxHash(raw))
+
+		// The decoded transaction serializes to the identical bytes, thus has the same hash
+		decoded, err := TxFromBytes(raw)
+		require.Nil(err)
+		reencoded, err := TxToBytes(decoded)
+		require.Nil(err)
+		assert.Equal(raw, reencoded)
+		assert.Equal(hash, decoded.Hash())
+
+		hashes[hash] = tx
+	}
+	assert.Equal(len(txs), len(hashes), "colliding transaction hashes")
+
+	// Unlike the TxID, the hash covers the signatures
+	unsigned := &SendTx{Fee: fee, Inputs: []TxInput{{Address: input.Address, Coins: input.Coins, Sequence: 1}}, Outputs: []TxOutput{output}}
+	_, exists := hashes[unsigned.Hash()]
+	assert.False(exists)
+	assert.Equal(TxID(chainID, unsigned), TxID(chainID, txs[2]))
+
+	// Non-canonical serializations are rejected
+	raw, err := TxToBytes(txs[2])
+	require.Nil(err)
+	_, err = TxFromBytes(append(raw, 0x80))
+	assert.NotNil(err)
+	assert.Equal(crypto.Keccak256Hash(append(raw, 0x80)), RawTxHash(append(raw, 0x80)))
+
+	emptyMemo, err := rlp.EncodeToBytes(sendTxRLP{Fee: fee, Inputs: []TxInput{input}, Outputs: []TxOutput{output}, Tail: []rlp.RawValue{{0x80}}}) // an empty memo
+	require.Nil(err)
+	_, err = TxFromBytes(append(raw[:1:1], emptyMemo...))
+	assert.NotNil(err)
+}
+
+var updateGolden = flag.Bool("update", false, "update the golden files")
+
+func TestTxJSON(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	proposer, staker := goldenPrivAccount("proposer"), goldenPrivAccount("staker")
+	sender1, sender2 := goldenPrivAccount("sender1"), goldenPrivAccount("sender2")
+	huge, ok := new(big.Int).SetString("123456789012345678901234567890", 10)
+	require.True(ok)
+
+	sendTx := &SendTx{
+		Fee: NewCoins(0, 1000000000000),
+		Inputs: []TxInput{
+			{Address: sender1.Address, Coins: Coins{ThetaWei: huge, TFuelWei: big.NewInt(1000000000000)}, Sequence: 7},
+			{Address: sender2.Address, Coins: NewCoins(5, 0), Sequence: 1},
+		},
+		Outputs: []TxOutput{
+			{Address: getTestAddress("output1"), Coins: Coins{ThetaWei: new(big.Int).Add(huge, big.NewInt(3)), TFuelWei: big.NewInt(0)}},
+			{Address: getTestAddress("output2"), Coins: NewCoins(2, 0)},
+		},
+		Data:             common.Bytes("destination tag 42"),
+		ValidUntilHeight: 123456,
+	}
+	sendTx.Inputs[0].Signature = sender1.Sign(sendTx.SignBytes(chainID))
+	sendTx.Inputs[1].Signature = sender2.Sign(sendTx.SignBytes(chainID))
+
+	coinbaseTx := &CoinbaseTx{
+		Proposer: TxInput{Address: proposer.Address},
+		Outputs: []TxOutput{
+			{Address: getTestAddress("validator1"), Coins: NewCoins(0, 333)},
+			{Address: getTestAddress("validator2"), Coins: NewCoins(0, 444)},
+		},
+		BlockHeight: 10,
+	}
+	coinbaseTx.Proposer.Signature = proposer.Sign(coinbaseTx.SignBytes(chainID))
+
+	depositStakeTx := &DepositStakeTx{
+		Fee:     NewCoins(0, 1000000000000),
+		Source:  TxInput{Address: staker.Address, Coins: Coins{ThetaWei: huge, TFuelWei: big.NewInt(0)}, Sequence: 3},
+		Holder:  TxOutput{Address: getTestAddress("validator1")},
+		Purpose: 0,
+	}
+	depositStakeTx.Source.Signature = staker.Sign(depositStakeTx.SignBytes(chainID))
+
+	withdrawStakeTx := &WithdrawStakeTx{
+		Fee:     NewCoins(0, 1000000000000),
+		Source:  TxInput{Address: staker.Address, Sequence: 4},
+		Holder:  TxOutput{Address: getTestAddress("validator1")},
+		Purpose: 0,
+	}
+	withdrawStakeTx.Source.Signature = staker.Sign(withdrawStakeTx.SignBytes(chainID))
+
+	for name, tx := range map[string]Tx{
+		"send_tx":           sendTx,
+		"coinbase_tx":       coinbaseTx,
+		"deposit_stake_tx":  depositStakeTx,
+		"withdraw_stake_tx": withdrawStakeTx,
+	} {
+		goldenFile := filepath.Join("testdata", "tx_json", name+".json")
+		encoded, err := TxToJSON(tx)
+		require.Nil(err)
+		var indented bytes.Buffer
+		require.Nil(json.Indent(&indented, encoded, "", "  "))
+		indented.WriteByte('\n')
+		if *updateGolden {
+			require.Nil(ioutil.WriteFile(goldenFile, indented.Bytes(), 0644))
+		}
+		golden, err := ioutil.ReadFile(goldenFile)
+		require.Nil(err)
+		assert.Equal(string(golden), indented.String(), name)
+
+		// Decoded from the JSON, the tx has the same SignBytes and serialization, thus the same signatures
+		decoded, err := TxFromJSON(golden)
+		require.Nil(err, name)
+		assert.Equal(tx.SignBytes(chainID), decoded.SignBytes(chainID), name)
+		raw, err := TxToBytes(tx)
+		require.Nil(err)
+		decodedRaw, err := TxToBytes(decoded)
+		require.Nil(err)
+		assert.Equal(raw, decodedRaw, name)
+		assert.Equal(tx.Hash(), decoded.Hash(), name)
+
+		reencoded, err := TxToJSON(decoded)
+		require.Nil(err)
+		assert.Equal(encoded, reencoded, name)
+	}
+
+	decoded, err := TxFromJSON(mustReadFile(t, filepath.Join("testdata", "tx_json", "send_tx.json")))
+	require.Nil(err)
+	decodedSendTx := decoded.(*SendTx)
+	assert.True(decodedSendTx.Inputs[0].Signature.Verify(decodedSendTx.SignBytes(chainID), sender1.Address))
+	assert.True(decodedSendTx.Inputs[1].Signature.Verify(decodedSendTx.SignBytes(chainID), sender2.Address))
+
+	// The stake purpose is encoded by its name, the value is still accepted
+	numericPurpose := strings.Replace(string(mustReadFile(t, filepath.Join("testdata", "tx_json", "withdraw_stake_tx.json"))),
+		`"purpose": "validator"`, `"purpose": 0`, 1)
+	decoded, err = TxFromJSON([]byte(numericPurpose))
+	require.Nil(err)
+	assert.Equal(withdrawStakeTx.Hash(), decoded.Hash())
+	_, err = TxFromJSON([]byte(`{"type":8,"transaction":{"purpose":"unknown"}}`))
+	assert.NotNil(err)
+
+	_, err = TxFromJSON([]byte(`{"type":99,"transaction":{}}`))
+	assert.NotNil(err)
+	_, err = TxFromJSON([]byte(`{"type":2}`))
+	assert.NotNil(err)
+	_, err = TxFromJSON([]byte(`{"type":2,"transaction":{"fee":{"thetawei":0,"tfuelwei":"1"}}}`))
+	assert.NotNil(err) // the amounts must be decimal strings
+}
+
+// goldenPrivAccount derives the key from the secret, so that the golden files are reproducible
+func goldenPrivAccount(secret string) PrivAccount {
+	privKey, err := crypto.PrivateKeyFromBytes(crypto.Keccak256Hash([]byte(secret)).Bytes())
+	if err != nil {
+		panic(err)
+	}
+	return PrivAccount{PrivKey: privKey, Account: Account{Address: privKey.PublicKey().Address()}}
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	data, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	return data
+}
+
+// canonicalTestTxs returns a tx of each type, signed with the golden keys so that the encodings are reproducible
+func canonicalTestTxs() map[string]Tx {
+	alice, bob := goldenPrivAccount("alice"), goldenPrivAccount("bob")
+	fee := NewCoins(0, 1000000000000)
+	input := func(acc PrivAccount, coins Coins, seq uint64) TxInput {
+		return TxInput{Address: acc.Address, Coins: coins, Sequence: seq}
+	}
+	output := TxOutput{Address: getTestAddress("output"), Coins: NewCoins(3, 4)}
+
+	txs := map[string]Tx{
+		"coinbase_tx":         &CoinbaseTx{Proposer: input(alice, Coins{}, 0), Outputs: []TxOutput{output}, BlockHeight: 10},
+		"slash_tx":            &SlashTx{Proposer: input(alice, Coins{}, 0), SlashedAddress: bob.Address, ReserveSequence: 1, SlashProof: common.Bytes("proof")},
+		"send_tx":             &SendTx{Fee: fee, Inputs: []TxInput{input(alice, NewCoins(3, 1000000000004), 1)}, Outputs: []TxOutput{output}},
+		"send_tx_memo":        &SendTx{Fee: fee, Inputs: []TxInput{input(alice, NewCoins(3, 1000000000004), 1)}, Outputs: []TxOutput{output}, Data: common.Bytes("memo")},
+		"send_tx_valid_until": &SendTx{Fee: fee, Inputs: []TxInput{input(alice, NewCoins(3, 1000000000004), 1)}, Outputs: []TxOutput{output}, ValidUntilHeight: 100},
+		"send_tx_fee_payer":   &SendTx{Fee: fee, Inputs: []TxInput{input(alice, NewCoins(3, 4), 1)}, Outputs: []TxOutput{output}, FeePayer: &TxInput{Address: bob.Address, Coins: fee, Sequence: 1}},
+		"reserve_fund_tx":     &ReserveFundTx{Fee: fee, Source: input(alice, NewCoins(0, 1000), 1), Collateral: NewCoins(0, 1001), ResourceIDs: []string{"rid"}, Duration: 10},
+		"release_fund_tx":     &ReleaseFundTx{Fee: fee, Source: input(alice, Coins{}, 1), ReserveSequence: 1},
+		"service_payment_tx":  &ServicePaymentTx{Fee: fee, Source: input(alice, NewCoins(0, 10), 1), Target: input(bob, Coins{}, 1), PaymentSequence: 1, ReserveSequence: 1, ResourceID: "rid"},
+		"split_rule_tx":       &SplitRuleTx{Fee: fee, ResourceID: "rid", Initiator: input(alice, Coins{}, 1), Splits: []Split{{Address: bob.Address, Percentage: 30}}, Duration: 10},
+		"smart_contract_tx":   &SmartContractTx{From: input(alice, NewCoins(0, 10), 1), To: output, GasLimit: 100000, GasPrice: big.NewInt(1000000000000), Data: common.Bytes("data")},
+		"deposit_stake_tx":    &DepositStakeTx{Fee: fee, Source: input(alice, NewCoins(1000, 0), 1), Holder: output, Purpose: 0},
+		"withdraw_stake_tx":   &WithdrawStakeTx{Fee: fee, Source: input(alice, Coins{}, 1), Holder: output, Purpose: 0},
+		"withdraw_stake_tx_return_address": &WithdrawStakeTx{Fee: fee, Source: input(alice, Coins{}, 1), Holder: output, Purpose: 0,
+			ReturnAddress: &bob.Address},
+		"deposit_stake_tx_idempotency_nonce": &DepositStakeTx{Fee: fee, Source: input(alice, NewCoins(1000, 0), 1), Holder: output, Purpose: 0,
+			IdempotencyNonce: 42},
+		"update_multisig_tx":      &UpdateMultisigTx{Fee: fee, Account: input(alice, Coins{}, 1), Owners: []common.Address{alice.Address, bob.Address}, Threshold: 2},
+		"partial_release_fund_tx": &PartialReleaseFundTx{Fee: fee, Source: input(alice, Coins{}, 1), Target: input(bob, Coins{}, 1), ReserveSequence: 1, Amount: NewCoins(0, 10)},
+		"extend_split_rule_tx":    &ExtendSplitRuleTx{Fee: fee, ResourceID: "rid", Initiator: input(alice, Coins{}, 1), Duration: 10},
+		"sweep_account_tx":        &SweepAccountTx{Fee: fee, Source: input(alice, NewCoins(3, 1000000000004), 1), Target: bob.Address},
+		"burn_tx":                 &BurnTx{Fee: fee, Source: input(alice, NewCoins(3, 4), 1)},
+		"double_sign_slash_tx":    &DoubleSignSlashTx{Fee: fee, Reporter: input(alice, Coins{}, 1), Evidence: common.Bytes("evidence")},
+		"stake_commission_tx":     &StakeCommissionTx{Fee: fee, Holder: input(alice, Coins{}, 1), Commission: 10},
+		"cancel_withdraw_tx":      &CancelWithdrawTx{Fee: fee, Source: input(alice, Coins{}, 1), Holder: output},
+		"update_validator_metadata_tx": &UpdateValidatorMetadataTx{Fee: fee, Holder: input(alice, Coins{}, 1),
+			Metadata: ValidatorMetadata{Name: "Alice Node", Website: "https://alice.example", SecurityContact: "security@alice.example"}},
+		"unjail_tx":               &UnjailTx{Fee: fee, Holder: input(alice, Coins{}, 1)},
+		"eject_stake_tx":          &EjectStakeTx{Fee: fee, Holder: input(alice, Coins{}, 1), Source: TxOutput{Address: bob.Address}, Purpose: 0},
+		"update_validator_key_tx": &UpdateValidatorKeyTx{Fee: fee, Holder: input(alice, Coins{}, 1), NewHolder: input(bob, Coins{}, 0)},
+	}
+
+	for _, tx := range txs {
+		switch tx := tx.(type) {
+		case *CoinbaseTx:
+			tx.Proposer.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *SlashTx:
+			tx.Proposer.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *SendTx:
+			tx.Inputs[0].Signature = alice.Sign(tx.SignBytes(chainID))
+			if tx.FeePayer != nil {
+				tx.FeePayer.Signature = bob.Sign(tx.SignBytes(chainID))
+			}
+		case *ReserveFundTx:
+			tx.Source.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *ReleaseFundTx:
+			tx.Source.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *ServicePaymentTx:
+			tx.Source.Signature = alice.Sign(tx.SourceSignBytes(chainID))
+			tx.Target.Signature = bob.Sign(tx.TargetSignBytes(chainID))
+		case *SplitRuleTx:
+			tx.Initiator.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *SmartContractTx:
+			tx.From.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *DepositStakeTx:
+			tx.Source.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *WithdrawStakeTx:
+			tx.Source.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *UpdateMultisigTx:
+			tx.Account.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *PartialReleaseFundTx:
+			tx.Source.Signature = alice.Sign(tx.SignBytes(chainID))
+			tx.Target.Signature = bob.Sign(tx.SignBytes(chainID))
+		case *ExtendSplitRuleTx:
+			tx.Initiator.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *SweepAccountTx:
+			tx.Source.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *BurnTx:
+			tx.Source.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *DoubleSignSlashTx:
+			tx.Reporter.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *StakeCommissionTx:
+			tx.Holder.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *CancelWithdrawTx:
+			tx.Source.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *UpdateValidatorMetadataTx:
+			tx.Holder.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *UnjailTx:
+			tx.Holder.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *EjectStakeTx:
+			tx.Holder.Signature = alice.Sign(tx.SignBytes(chainID))
+		case *UpdateValidatorKeyTx:
+			tx.Holder.Signature = alice.Sign(tx.SignBytes(chainID))
+			tx.NewHolder.Signature = bob.Sign(tx.SignBytes(chainID))
+		}
+	}
+	return txs
+}
+
+// rlpListElems splits the RLP list into its raw elements
+func rlpListElems(t *testing.T, list []byte) []rlp.RawValue {
+	content, rest, err := rlp.SplitList(list)
+	require.Nil(t, err)
+	require.Empty(t, rest)
+	elems := []rlp.RawValue{}
+	for len(content) > 0 {
+		_, _, rest, err := rlp.Split(content)
+		require.Nil(t, err)
+		elems = append(elems, rlp.RawValue(content[:len(content)-len(rest)]))
+		content = rest
+	}
+	return elems
+}
+
+func mustEncodeRLP(t *testing.T, val interface{}) []byte {
+	b, err := rlp.EncodeToBytes(val)
+	require.Nil(t, err)
+	return b
+}
+
+// TestTxCanonicalEncoding checks that each tx type has a single accepted encoding. The fuzz corpus
+// holds the canonical encodings, prefixed by the byte that makes Fuzz() decode them as txs.
+func TestTxCanonicalEncoding(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	txs := canonicalTestTxs()
+	require.Equal(int(TxUpdateValidatorKey)+1+5, len(txs), "a tx of each type is expected")
+
+	for name, tx := range txs {
+		corpusFile := filepath.Join("testdata", "fuzz", "corpus", name)
+		raw, err := TxToBytes(tx)
+		require.Nil(err)
+		if *updateGolden {
+			require.Nil(ioutil.WriteFile(corpusFile, append([]byte{1}, raw...), 0644))
+		}
+		corpus := mustReadFile(t, corpusFile)
+		assert.Equal(append([]byte{1}, raw...), corpus, name)
+		assert.Equal(1, Fuzz(corpus), name)
+
+		// Decoding and re-encoding reproduces the input exactly
+		decoded, err := TxFromCanonicalBytes(raw)
+		require.Nil(err, name)
+		reencoded, err := TxToBytes(decoded)
+		require.Nil(err)
+		assert.Equal(raw, reencoded, name)
+		assert.Equal(tx.Hash(), decoded.Hash(), name)
+
+		txType, err := getTxType(tx)
+		require.Nil(err)
+		body := raw[1:] // all tx types fit in a single byte
+
+		// Trailing bytes
+		_, err = TxFromCanonicalBytes(append(append([]byte{}, raw...), 0x80))
+		assert.NotNil(err, name)
+
+		// Non-minimal encoding of the tx type
+		nonMinimalType := append([]byte{0x82, 0x00, byte(txType)}, body...)
+		_, err = TxFromCanonicalBytes(nonMinimalType)
+		assert.NotNil(err, name)
+		assert.Equal(0, Fuzz(append([]byte{1}, nonMinimalType...)))
+
+		// Unknown field appended to the tx. The SendTx has optional trailing fields, a field appended
+		// after the memo is the valid-until height, and one appended after it is the fee payer. The one
+		// appended to the WithdrawStakeTx is the return address, which is not a valid address. The one
+		// appended to a DepositStakeTx without an idempotency nonce is the nonce.
+		elems := rlpListElems(t, body)
+		_, isSendTx := tx.(*SendTx)
+		_, isDepositStakeTx := tx.(*DepositStakeTx)
+		if (!isSendTx || len(elems) == 6) && (!isDepositStakeTx || len(elems) == 5) {
+			extraField := append(raw[:1:1], mustEncodeRLP(t, append(elems, rlp.RawValue{0x01}))...)
+			_, err = TxFromCanonicalBytes(extraField)
+			assert.NotNil(err, name)
+		}
+
+		// Non-minimal length prefix of the tx
+		content, _, err := rlp.SplitList(body)
+		require.Nil(err)
+		longHeader := []byte{0xf9, byte(len(content) >> 8), byte(len(content))} // the canonical header is shorter
+		if len(content) >= 256 {
+			longHeader = []byte{0xfa, 0, byte(len(content) >> 8), byte(len(content))}
+		}
+		_, err = TxFromCanonicalBytes(append(append(raw[:1:1], longHeader...), content...))
+		assert.NotNil(err, name)
+	}
+
+	// Non-minimal integer in a field
+	raw, err := TxToBytes(txs["release_fund_tx"])
+	require.Nil(err)
+	elems := rlpListElems(t, raw[1:])
+	elems[len(elems)-1] = rlp.RawValue{0x82, 0x00, 0x01} // the reserve sequence, with a leading zero
+	_, err = TxFromCanonicalBytes(append(raw[:1:1], mustEncodeRLP(t, elems)...))
+	assert.NotNil(err)
+
+	// Non-minimal amount
+	raw, err = TxToBytes(txs["send_tx"])
+	require.Nil(err)
+	elems = rlpListElems(t, raw[1:])
+	feeElems := rlpListElems(t, elems[0])
+	feeElems[1] = append(rlp.RawValue{byte(0x80 + len(feeElems[1]))}, append([]byte{0}, feeElems[1][1:]...)...)
+	elems[0] = mustEncodeRLP(t, feeElems)
+	_, err = TxFromCanonicalBytes(append(raw[:1:1], mustEncodeRLP(t, elems)...))
+	assert.NotNil(err)
+
+	// Explicitly encoded default valid-until height
+	sendTx := txs["send_tx_memo"].(*SendTx)
+	explicitZero := mustEncodeRLP(t, sendTxRLP{Fee: sendTx.Fee, Inputs: sendTx.Inputs, Outputs: sendTx.Outputs,
+		Tail: []rlp.RawValue{mustEncodeRLP(t, sendTx.Data), mustEncodeRLP(t, uint64(0))}})
+	_, err = TxFromCanonicalBytes(append(raw[:1:1], explicitZero...))
+	assert.NotNil(err)
+}
+
 func TestFuzz(t *testing.T) {
 	var input []byte
 
@@ -16,6 +16,26 @@ type Split struct {
 	Percentage uint           // An integer between 0 and 100, representing the percentage of the payment the address should get
 }
 
+// MaxTotalSplitPercentage is the maximal sum of the percentages of the splits of a split rule
+const MaxTotalSplitPercentage = 100
+
+// ValidateSplits checks that the percentages of the splits sum to at most 100
+func ValidateSplits(splits []Split) error {
+	totalPercentage := uint64(0)
+	for _, split := range splits {
+		if split.Percentage > MaxTotalSplitPercentage {
+			return fmt.Errorf("Percentage of the split for %v is %v, it needs to be at most %v",
+				split.Address.Hex(), split.Percentage, MaxTotalSplitPercentage)
+		}
+		totalPercentage += uint64(split.Percentage)
+	}
+	if totalPercentage > MaxTotalSplitPercentage {
+		return fmt.Errorf("Sum of the split percentages is %v, it needs to be at most %v",
+			totalPercentage, MaxTotalSplitPercentage)
+	}
+	return nil
+}
+
 // SplitRule specifies the payment split agreement among differet addresses
 type SplitRule struct {
 	InitiatorAddress common.Address // Address of the initiator
@@ -71,6 +91,12 @@ func (a *SplitRule) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// IsExpiredAt returns whether the split rule no longer applies at the given height. The
+// split rule still applies at its end block height.
+func (sc *SplitRule) IsExpiredAt(height uint64) bool {
+	return sc.EndBlockHeight < height
+}
+
 func (sc *SplitRule) String() string {
 	if sc == nil {
 		return "nil-SplitRule"
@@ -7,6 +7,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
 )
 
 func TestSplitRuleJSON(t *testing.T) {
@@ -25,3 +26,29 @@ func TestSplitRuleJSON(t *testing.T) {
 	require.Nil(err)
 	assert.Equal(uint64(math.MaxUint64), d.EndBlockHeight)
 }
+
+func TestValidateSplits(t *testing.T) {
+	assert := assert.New(t)
+
+	addr1, addr2 := common.HexToAddress("0x1"), common.HexToAddress("0x2")
+	assert.Nil(ValidateSplits(nil))
+	assert.Nil(ValidateSplits([]Split{{Address: addr1, Percentage: 100}}))
+	assert.Nil(ValidateSplits([]Split{{Address: addr1, Percentage: 60}, {Address: addr2, Percentage: 40}}))
+	assert.Nil(ValidateSplits([]Split{{Address: addr1, Percentage: 0}}))
+
+	err := ValidateSplits([]Split{{Address: addr1, Percentage: 60}, {Address: addr2, Percentage: 41}})
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "101")
+	assert.NotNil(ValidateSplits([]Split{{Address: addr1, Percentage: 101}}))
+	// The sum can not wrap around
+	assert.NotNil(ValidateSplits([]Split{{Address: addr1, Percentage: math.MaxUint32}, {Address: addr2, Percentage: 2}}))
+}
+
+func TestSplitRuleIsExpiredAt(t *testing.T) {
+	assert := assert.New(t)
+
+	splitRule := &SplitRule{EndBlockHeight: 100}
+	assert.False(splitRule.IsExpiredAt(99))
+	assert.False(splitRule.IsExpiredAt(100))
+	assert.True(splitRule.IsExpiredAt(101))
+}
@@ -0,0 +1,129 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/hexutil"
+)
+
+// StateAccessList records the state keys a transaction read and wrote during its execution. The keys of the
+// contract storage slots are not keys of the state tree, see state.ContractStorageAccessKey().
+type StateAccessList struct {
+	Reads     []common.Bytes // Keys read, sorted
+	Writes    []common.Bytes // Keys set or deleted, sorted
+	Traversed []common.Bytes // Prefixes whose keys were all read, sorted
+}
+
+// NewStateAccessList creates a StateAccessList from the given sets of keys
+func NewStateAccessList(reads, writes, traversed map[string]bool) *StateAccessList {
+	return &StateAccessList{
+		Reads:     sortedKeys(reads),
+		Writes:    sortedKeys(writes),
+		Traversed: sortedKeys(traversed),
+	}
+}
+
+// Uncovered returns the keys of the given access list which are not in this access list, i.e. the keys read
+// but neither read nor under a traversed prefix, the keys written but not written, and the prefixes traversed
+// but not traversed.
+func (al *StateAccessList) Uncovered(other *StateAccessList) (reads, writes, traversed []common.Bytes) {
+	for _, key := range other.Reads {
+		if !containsKey(al.Reads, key) && !hasPrefix(al.Traversed, key) {
+			reads = append(reads, key)
+		}
+	}
+	for _, key := range other.Writes {
+		if !containsKey(al.Writes, key) {
+			writes = append(writes, key)
+		}
+	}
+	for _, prefix := range other.Traversed {
+		if !hasPrefix(al.Traversed, prefix) {
+			traversed = append(traversed, prefix)
+		}
+	}
+	return reads, writes, traversed
+}
+
+type StateAccessListJSON struct {
+	Reads     []hexutil.Bytes `json:"reads"`
+	Writes    []hexutil.Bytes `json:"writes"`
+	Traversed []hexutil.Bytes `json:"traversed"`
+}
+
+func NewStateAccessListJSON(a StateAccessList) StateAccessListJSON {
+	return StateAccessListJSON{
+		Reads:     toHexutilBytes(a.Reads),
+		Writes:    toHexutilBytes(a.Writes),
+		Traversed: toHexutilBytes(a.Traversed),
+	}
+}
+
+func (a StateAccessListJSON) StateAccessList() StateAccessList {
+	return StateAccessList{
+		Reads:     fromHexutilBytes(a.Reads),
+		Writes:    fromHexutilBytes(a.Writes),
+		Traversed: fromHexutilBytes(a.Traversed),
+	}
+}
+
+func (a StateAccessList) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewStateAccessListJSON(a))
+}
+
+func (a *StateAccessList) UnmarshalJSON(data []byte) error {
+	var b StateAccessListJSON
+	if err := json.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	*a = b.StateAccessList()
+	return nil
+}
+
+func sortedKeys(set map[string]bool) []common.Bytes {
+	keys := make([]common.Bytes, 0, len(set))
+	for key := range set {
+		keys = append(keys, common.Bytes(key))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+	return keys
+}
+
+// containsKey returns whether the sorted keys contain the key
+func containsKey(keys []common.Bytes, key common.Bytes) bool {
+	i := sort.Search(len(keys), func(i int) bool {
+		return bytes.Compare(keys[i], key) >= 0
+	})
+	return i < len(keys) && bytes.Equal(keys[i], key)
+}
+
+// hasPrefix returns whether any of the prefixes is a prefix of the key
+func hasPrefix(prefixes []common.Bytes, key common.Bytes) bool {
+	for _, prefix := range prefixes {
+		if bytes.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func toHexutilBytes(keys []common.Bytes) []hexutil.Bytes {
+	hexKeys := make([]hexutil.Bytes, len(keys))
+	for i, key := range keys {
+		hexKeys[i] = hexutil.Bytes(key)
+	}
+	return hexKeys
+}
+
+func fromHexutilBytes(hexKeys []hexutil.Bytes) []common.Bytes {
+	keys := make([]common.Bytes, len(hexKeys))
+	for i, key := range hexKeys {
+		keys[i] = common.Bytes(key)
+	}
+	return keys
+}
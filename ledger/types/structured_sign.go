@@ -0,0 +1,278 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/hexutil"
+	"github.com/thetatoken/theta/crypto"
+)
+
+/*
+Structured signing lets a hardware wallet show the user what is being signed, instead of the opaque
+SignBytes. A transaction is turned into a flat list of typed fields, e.g. the recipient, the amounts, the
+fee and the sequence, which the wallet renders and hashes in the style of EIP-712:
+
+	typeHash        = keccak256(PrimaryType "(" Type " " Name "," ... ")")
+	structHash      = keccak256(typeHash || encode(field 1) || ... || encode(field n))
+	domainSeparator = keccak256(keccak256(StructuredSignDomainType) || keccak256(StructuredSignDomainName) ||
+	                            keccak256(StructuredSignDomainVersion) || keccak256(chainID))
+	signBytes       = 0x19 0x01 || domainSeparator || structHash
+
+where an address is encoded left-padded to 32 bytes, an unsigned integer as a 32 byte big-endian word, and a
+string or a byte array as its keccak256 hash. The signBytes are signed as any other message, i.e. both a
+secp256k1 and an Ed25519 key sign their keccak256 hash, the EIP-712 digest.
+
+The field list covers every signed field of the transaction, so a signature over the structured sign bytes
+is as binding as one over the SignBytes. Starting from common.HeightEnableStructuredSignature, the signatures
+over either are accepted for the transaction types supported here.
+*/
+
+const (
+	StructuredSignDomainType    = "ThetaDomain(string name,string version,string chainId)"
+	StructuredSignDomainName    = "Theta Ledger"
+	StructuredSignDomainVersion = "1"
+)
+
+// The types of the fields of the structured form
+const (
+	SigningFieldAddress = "address" // 0x prefixed hex, EIP55 checksummed
+	SigningFieldUint256 = "uint256" // decimal
+	SigningFieldUint64  = "uint64"  // decimal
+	SigningFieldUint8   = "uint8"   // decimal
+	SigningFieldString  = "string"  // as is
+	SigningFieldBytes   = "bytes"   // 0x prefixed hex
+)
+
+// ErrStructuredSignNotSupported is returned for the transaction types without a structured form
+var ErrStructuredSignNotSupported = errors.New("structured signing is not supported for the transaction type")
+
+// SigningField is a field of the structured form of a transaction
+type SigningField struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// StructuredSignData is the structured form of a transaction, which a wallet renders to the user
+type StructuredSignData struct {
+	ChainID     string         `json:"chain_id"`
+	PrimaryType string         `json:"primary_type"`
+	Fields      []SigningField `json:"fields"`
+}
+
+// NewStructuredSignData returns the structured form of the transaction for the given chain
+func NewStructuredSignData(chainID string, tx Tx) (*StructuredSignData, error) {
+	fb := &signingFieldBuilder{}
+	var primaryType string
+	switch tx := tx.(type) {
+	case *SendTx:
+		primaryType = "SendTx"
+		fb.coins("fee", tx.Fee)
+		for i, in := range tx.Inputs {
+			fb.input(fmt.Sprintf("inputs[%v]", i), in)
+		}
+		for i, out := range tx.Outputs {
+			fb.output(fmt.Sprintf("outputs[%v]", i), out)
+		}
+		fb.bytes("data", tx.Data)
+		fb.uint64("valid_until_height", tx.ValidUntilHeight)
+		if tx.FeePayer != nil {
+			fb.input("fee_payer", *tx.FeePayer)
+		}
+	case *SmartContractTx:
+		primaryType = "SmartContractTx"
+		fb.input("from", tx.From)
+		fb.output("to", tx.To)
+		fb.uint64("gas_limit", tx.GasLimit)
+		fb.uint256("gas_price", tx.GasPrice)
+		fb.bytes("data", tx.Data)
+	case *DepositStakeTx:
+		primaryType = "DepositStakeTx"
+		fb.coins("fee", tx.Fee)
+		fb.input("source", tx.Source)
+		fb.output("holder", tx.Holder)
+		fb.uint8("purpose", tx.Purpose)
+		if tx.IdempotencyNonce != 0 {
+			fb.uint64("idempotency_nonce", tx.IdempotencyNonce)
+		}
+	case *WithdrawStakeTx:
+		primaryType = "WithdrawStakeTx"
+		fb.coins("fee", tx.Fee)
+		fb.input("source", tx.Source)
+		fb.output("holder", tx.Holder)
+		fb.uint8("purpose", tx.Purpose)
+		if tx.ReturnAddress != nil {
+			fb.address("return_address", *tx.ReturnAddress)
+		}
+	case *SweepAccountTx:
+		primaryType = "SweepAccountTx"
+		fb.coins("fee", tx.Fee)
+		fb.input("source", tx.Source)
+		fb.address("target", tx.Target)
+	case *BurnTx:
+		primaryType = "BurnTx"
+		fb.coins("fee", tx.Fee)
+		fb.input("source", tx.Source)
+	default:
+		return nil, ErrStructuredSignNotSupported
+	}
+	if fb.err != nil {
+		return nil, fb.err
+	}
+	return &StructuredSignData{
+		ChainID:     chainID,
+		PrimaryType: primaryType,
+		Fields:      fb.fields,
+	}, nil
+}
+
+// TypeString returns the type of the structured form, whose hash is the type hash
+func (d *StructuredSignData) TypeString() string {
+	members := make([]string, len(d.Fields))
+	for i, field := range d.Fields {
+		members[i] = field.Type + " " + field.Name
+	}
+	return d.PrimaryType + "(" + strings.Join(members, ",") + ")"
+}
+
+// DomainSeparator returns the hash binding the signature to the ledger and the chain
+func (d *StructuredSignData) DomainSeparator() common.Hash {
+	return crypto.Keccak256Hash(
+		crypto.Keccak256([]byte(StructuredSignDomainType)),
+		crypto.Keccak256([]byte(StructuredSignDomainName)),
+		crypto.Keccak256([]byte(StructuredSignDomainVersion)),
+		crypto.Keccak256([]byte(d.ChainID)),
+	)
+}
+
+// StructHash returns the hash of the fields
+func (d *StructuredSignData) StructHash() (common.Hash, error) {
+	data := [][]byte{crypto.Keccak256([]byte(d.TypeString()))}
+	for _, field := range d.Fields {
+		encoded, err := encodeSigningField(field)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		data = append(data, encoded)
+	}
+	return crypto.Keccak256Hash(data...), nil
+}
+
+// SignBytes returns the message to sign, i.e. 0x19 0x01 || domainSeparator || structHash
+func (d *StructuredSignData) SignBytes() ([]byte, error) {
+	structHash, err := d.StructHash()
+	if err != nil {
+		return nil, err
+	}
+	domainSeparator := d.DomainSeparator()
+	signBytes := append([]byte{0x19, 0x01}, domainSeparator[:]...)
+	return append(signBytes, structHash[:]...), nil
+}
+
+// Digest returns the hash actually signed by either key type, i.e. the keccak256 hash of the sign bytes
+func (d *StructuredSignData) Digest() (common.Hash, error) {
+	signBytes, err := d.SignBytes()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(signBytes), nil
+}
+
+// StructuredSignBytes returns the structured sign bytes of the transaction, an alternative to its SignBytes
+func StructuredSignBytes(chainID string, tx Tx) ([]byte, error) {
+	data, err := NewStructuredSignData(chainID, tx)
+	if err != nil {
+		return nil, err
+	}
+	return data.SignBytes()
+}
+
+// encodeSigningField encodes the value of the field into a 32 byte word
+func encodeSigningField(field SigningField) ([]byte, error) {
+	switch field.Type {
+	case SigningFieldAddress:
+		if !common.IsHexAddress(field.Value) {
+			return nil, fmt.Errorf("invalid address %v: %v", field.Name, field.Value)
+		}
+		address := common.HexToAddress(field.Value)
+		return common.LeftPadBytes(address[:], 32), nil
+	case SigningFieldUint256, SigningFieldUint64, SigningFieldUint8:
+		bitSize := map[string]int{SigningFieldUint256: 256, SigningFieldUint64: 64, SigningFieldUint8: 8}[field.Type]
+		value, ok := new(big.Int).SetString(field.Value, 10)
+		if !ok || value.Sign() < 0 || value.BitLen() > bitSize {
+			return nil, fmt.Errorf("invalid %v %v: %v", field.Type, field.Name, field.Value)
+		}
+		return common.LeftPadBytes(value.Bytes(), 32), nil
+	case SigningFieldString:
+		return crypto.Keccak256([]byte(field.Value)), nil
+	case SigningFieldBytes:
+		value, err := hexutil.Decode(field.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bytes %v: %v", field.Name, err)
+		}
+		return crypto.Keccak256(value), nil
+	default:
+		return nil, fmt.Errorf("unknown type of field %v: %v", field.Name, field.Type)
+	}
+}
+
+// signingFieldBuilder appends the fields of a transaction, keeping the first error
+type signingFieldBuilder struct {
+	fields []SigningField
+	err    error
+}
+
+func (fb *signingFieldBuilder) add(name, fieldType, value string) {
+	fb.fields = append(fb.fields, SigningField{Name: name, Type: fieldType, Value: value})
+}
+
+func (fb *signingFieldBuilder) address(name string, address common.Address) {
+	fb.add(name, SigningFieldAddress, address.Hex())
+}
+
+func (fb *signingFieldBuilder) uint256(name string, value *big.Int) {
+	if value == nil {
+		value = big.NewInt(0)
+	}
+	if value.Sign() < 0 || value.BitLen() > 256 {
+		if fb.err == nil {
+			fb.err = fmt.Errorf("%v is out of the uint256 range: %v", name, value)
+		}
+		return
+	}
+	fb.add(name, SigningFieldUint256, value.String())
+}
+
+func (fb *signingFieldBuilder) uint64(name string, value uint64) {
+	fb.add(name, SigningFieldUint64, strconv.FormatUint(value, 10))
+}
+
+func (fb *signingFieldBuilder) uint8(name string, value uint8) {
+	fb.add(name, SigningFieldUint8, strconv.FormatUint(uint64(value), 10))
+}
+
+func (fb *signingFieldBuilder) bytes(name string, value common.Bytes) {
+	fb.add(name, SigningFieldBytes, hexutil.Encode(value))
+}
+
+func (fb *signingFieldBuilder) coins(name string, coins Coins) {
+	coins = coins.NoNil()
+	fb.uint256(name+".thetawei", coins.ThetaWei)
+	fb.uint256(name+".tfuelwei", coins.TFuelWei)
+}
+
+func (fb *signingFieldBuilder) input(name string, in TxInput) {
+	fb.address(name+".address", in.Address)
+	fb.coins(name+".coins", in.Coins)
+	fb.uint64(name+".sequence", in.Sequence)
+}
+
+func (fb *signingFieldBuilder) output(name string, out TxOutput) {
+	fb.address(name+".address", out.Address)
+	fb.coins(name+".coins", out.Coins)
+}
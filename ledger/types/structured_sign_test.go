@@ -0,0 +1,203 @@
+package types
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/hexutil"
+	"github.com/thetatoken/theta/crypto"
+)
+
+// structuredSignVector is a test vector for the wallets implementing the structured signing
+type structuredSignVector struct {
+	Name            string              `json:"name"`
+	PrivateKey      string              `json:"private_key"`
+	Signer          string              `json:"signer"`
+	UnsignedTx      string              `json:"unsigned_tx"` // the raw transaction, hex encoded
+	Data            *StructuredSignData `json:"data"`
+	TypeString      string              `json:"type_string"`
+	TypeHash        string              `json:"type_hash"`
+	DomainSeparator string              `json:"domain_separator"`
+	StructHash      string              `json:"struct_hash"`
+	SignBytes       string              `json:"sign_bytes"`
+	Digest          string              `json:"digest"`    // keccak256(sign_bytes), signed by both the secp256k1 and the Ed25519 keys
+	Signature       string              `json:"signature"` // over the digest
+}
+
+func TestStructuredSignVectors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	alice, bob := goldenPrivAccount("alice"), goldenPrivAccount("bob")
+	carol := PrivAccountFromEd25519Secret("carol")
+	fee := NewCoins(0, 1000000000000)
+	output := TxOutput{Address: getTestAddress("output"), Coins: NewCoins(3, 4)}
+	sendTx := &SendTx{
+		Fee: fee,
+		Inputs: []TxInput{
+			{Address: alice.Address, Coins: NewCoins(2, 1000000000000), Sequence: 7},
+			{Address: bob.Address, Coins: NewCoins(1, 4), Sequence: 1},
+		},
+		Outputs:          []TxOutput{output},
+		Data:             common.Bytes("destination tag 42"),
+		ValidUntilHeight: 123456,
+	}
+	NormalizeTx(sendTx)
+
+	vectors := []struct {
+		name   string
+		signer PrivAccount
+		tx     Tx
+	}{
+		{"send_tx", alice, sendTx},
+		{"smart_contract_tx", alice, &SmartContractTx{From: TxInput{Address: alice.Address, Coins: NewCoins(0, 10), Sequence: 1},
+			To: output, GasLimit: 100000, GasPrice: big.NewInt(1000000000000), Data: common.Bytes("data")}},
+		{"deposit_stake_tx", alice, &DepositStakeTx{Fee: fee, Source: TxInput{Address: alice.Address, Coins: NewCoins(1000, 0), Sequence: 2},
+			Holder: TxOutput{Address: getTestAddress("validator")}, Purpose: 0}},
+		{"withdraw_stake_tx", alice, &WithdrawStakeTx{Fee: fee, Source: TxInput{Address: alice.Address, Sequence: 3},
+			Holder: TxOutput{Address: getTestAddress("validator")}, Purpose: 0}},
+		{"sweep_account_tx", bob, &SweepAccountTx{Fee: fee, Source: TxInput{Address: bob.Address, Coins: NewCoins(3, 1000000000004), Sequence: 5},
+			Target: alice.Address}},
+		{"burn_tx_ed25519", carol, &BurnTx{Fee: fee, Source: TxInput{Address: carol.Address, Coins: NewCoins(3, 4), Sequence: 1}}},
+	}
+
+	generated := []structuredSignVector{}
+	for _, v := range vectors {
+		data, err := NewStructuredSignData(chainID, v.tx)
+		require.Nil(err, v.name)
+		structHash, err := data.StructHash()
+		require.Nil(err, v.name)
+		signBytes, err := data.SignBytes()
+		require.Nil(err, v.name)
+		digest, err := data.Digest()
+		require.Nil(err, v.name)
+		raw, err := TxToBytes(v.tx)
+		require.Nil(err, v.name)
+		signature := v.signer.Sign(signBytes)
+		assert.True(signature.Verify(signBytes, v.signer.Address), v.name)
+		assert.False(signature.Verify(v.tx.SignBytes(chainID), v.signer.Address), v.name)
+		assert.Equal(crypto.Keccak256Hash(signBytes), digest, v.name)
+
+		domainSeparator := data.DomainSeparator()
+		generated = append(generated, structuredSignVector{
+			Name:            v.name,
+			PrivateKey:      hexutil.Encode(v.signer.PrivKey.ToBytes()),
+			Signer:          v.signer.Address.Hex(),
+			UnsignedTx:      hexutil.Encode(raw),
+			Data:            data,
+			TypeString:      data.TypeString(),
+			TypeHash:        hexutil.Encode(crypto.Keccak256([]byte(data.TypeString()))),
+			DomainSeparator: hexutil.Encode(domainSeparator[:]),
+			StructHash:      hexutil.Encode(structHash[:]),
+			SignBytes:       hexutil.Encode(signBytes),
+			Digest:          hexutil.Encode(digest[:]),
+			Signature:       hexutil.Encode(signature.ToBytes()),
+		})
+	}
+
+	encoded, err := json.MarshalIndent(generated, "", "  ")
+	require.Nil(err)
+	encoded = append(encoded, '\n')
+	goldenFile := filepath.Join("testdata", "structured_sign", "vectors.json")
+	if *updateGolden {
+		require.Nil(ioutil.WriteFile(goldenFile, encoded, 0644))
+	}
+	assert.Equal(string(mustReadFile(t, goldenFile)), string(encoded))
+
+	// The hashes are computed from the field list alone, as a wallet does
+	var decoded []structuredSignVector
+	require.Nil(json.Unmarshal(mustReadFile(t, goldenFile), &decoded))
+	for _, v := range decoded {
+		signBytes, err := v.Data.SignBytes()
+		require.Nil(err, v.Name)
+		assert.Equal(v.SignBytes, hexutil.Encode(signBytes), v.Name)
+		sig, err := crypto.SignatureFromBytes(hexutil.MustDecode(v.Signature))
+		require.Nil(err, v.Name)
+		assert.True(sig.Verify(signBytes, common.HexToAddress(v.Signer)), v.Name)
+	}
+}
+
+func TestStructuredSignData(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	source := TxInput{Address: getTestAddress("source"), Coins: NewCoins(1, 2), Sequence: 3}
+	tx := &SweepAccountTx{Fee: NewCoins(0, 1000000000000), Source: source, Target: getTestAddress("target")}
+	data, err := NewStructuredSignData(chainID, tx)
+	require.Nil(err)
+	assert.Equal("SweepAccountTx(uint256 fee.thetawei,uint256 fee.tfuelwei,address source.address,"+
+		"uint256 source.coins.thetawei,uint256 source.coins.tfuelwei,uint64 source.sequence,address target)", data.TypeString())
+	assert.Equal([]SigningField{
+		{"fee.thetawei", "uint256", "0"},
+		{"fee.tfuelwei", "uint256", "1000000000000"},
+		{"source.address", "address", source.Address.Hex()},
+		{"source.coins.thetawei", "uint256", "1"},
+		{"source.coins.tfuelwei", "uint256", "2"},
+		{"source.sequence", "uint64", "3"},
+		{"target", "address", tx.Target.Hex()},
+	}, data.Fields)
+
+	// Every signed field, as well as the chain, changes the sign bytes
+	signBytes, err := StructuredSignBytes(chainID, tx)
+	require.Nil(err)
+	assert.Len(signBytes, 66)
+	assert.Equal([]byte{0x19, 0x01}, signBytes[:2])
+	for _, mutate := range []func(tx *SweepAccountTx){
+		func(tx *SweepAccountTx) { tx.Fee = NewCoins(0, 1000000000001) },
+		func(tx *SweepAccountTx) { tx.Source.Address = getTestAddress("other") },
+		func(tx *SweepAccountTx) { tx.Source.Coins = NewCoins(2, 2) },
+		func(tx *SweepAccountTx) { tx.Source.Sequence = 4 },
+		func(tx *SweepAccountTx) { tx.Target = getTestAddress("other") },
+	} {
+		mutated := *tx
+		mutate(&mutated)
+		mutatedSignBytes, err := StructuredSignBytes(chainID, &mutated)
+		require.Nil(err)
+		assert.NotEqual(signBytes, mutatedSignBytes)
+	}
+	otherChainSignBytes, err := StructuredSignBytes("other_chain", tx)
+	require.Nil(err)
+	assert.NotEqual(signBytes, otherChainSignBytes)
+
+	// The signatures are not interchangeable between the tx types with the same fields
+	deposit, err := StructuredSignBytes(chainID, &DepositStakeTx{Fee: tx.Fee, Source: source})
+	require.Nil(err)
+	withdraw, err := StructuredSignBytes(chainID, &WithdrawStakeTx{Fee: tx.Fee, Source: source})
+	require.Nil(err)
+	assert.NotEqual(deposit, withdraw)
+
+	// The optional fields are signed when set
+	returnAddress := getTestAddress("return")
+	withdrawWithReturnAddress, err := StructuredSignBytes(chainID, &WithdrawStakeTx{Fee: tx.Fee, Source: source, ReturnAddress: &returnAddress})
+	require.Nil(err)
+	assert.NotEqual(withdraw, withdrawWithReturnAddress)
+	otherReturnAddress := getTestAddress("other")
+	withdrawWithOtherReturnAddress, err := StructuredSignBytes(chainID, &WithdrawStakeTx{Fee: tx.Fee, Source: source, ReturnAddress: &otherReturnAddress})
+	require.Nil(err)
+	assert.NotEqual(withdrawWithReturnAddress, withdrawWithOtherReturnAddress)
+
+	// The negative amounts and the unsupported tx types have no structured form
+	_, err = StructuredSignBytes(chainID, &BurnTx{Fee: tx.Fee, Source: TxInput{Address: source.Address, Coins: NewCoins(-1, 0)}})
+	assert.NotNil(err)
+	_, err = StructuredSignBytes(chainID, &ServicePaymentTx{})
+	assert.Equal(ErrStructuredSignNotSupported, err)
+
+	// The values out of the range of their types are rejected
+	for _, field := range []SigningField{
+		{"purpose", "uint8", "256"},
+		{"sequence", "uint64", "-1"},
+		{"target", "address", "0x1234"},
+		{"data", "bytes", "1234"},
+		{"memo", "bool", "true"},
+	} {
+		data := &StructuredSignData{ChainID: chainID, PrimaryType: "Test", Fields: []SigningField{field}}
+		_, err := data.SignBytes()
+		assert.NotNil(err, field.Name)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"math/big"
 	"math/rand"
 
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
 	"github.com/thetatoken/theta/crypto"
 )
 
@@ -40,6 +42,20 @@ func PrivAccountFromSecret(secret string) PrivAccount {
 	return privAccount
 }
 
+// PrivAccountFromEd25519Secret creates a PrivAccount with an Ed25519 key from secret.
+// The amount is not set.
+func PrivAccountFromEd25519Secret(secret string) PrivAccount {
+	privKey, _ := crypto.TEST_GenerateEd25519KeyPairWithSeed(secret)
+	privAccount := PrivAccount{
+		PrivKey: privKey,
+		Account: Account{
+			Address:                privKey.PublicKey().Address(),
+			LastUpdatedBlockHeight: 1,
+		},
+	}
+	return privAccount
+}
+
 // Make `num` random accounts
 func RandAccounts(num int, minAmount int64, maxAmount int64) []PrivAccount {
 	privAccs := make([]PrivAccount, num)
@@ -122,3 +138,32 @@ func SignSendTx(chainID string, tx *SendTx, accs ...PrivAccount) {
 		tx.Inputs[i].Signature = accs[i].Sign(signBytes)
 	}
 }
+
+// MakeConflictingBlockHeader returns a block header at the given height and epoch signed by the proposer,
+// headers with different parents conflict with each other
+func MakeConflictingBlockHeader(chainID string, proposer PrivAccount, height, epoch uint64, parent string) *core.BlockHeader {
+	header := &core.BlockHeader{
+		ChainID:   chainID,
+		Epoch:     epoch,
+		Height:    height,
+		Parent:    common.BytesToHash([]byte(parent)),
+		HCC:       core.CommitCertificate{BlockHash: common.BytesToHash([]byte(parent))},
+		Timestamp: big.NewInt(int64(epoch)),
+		Proposer:  proposer.Address,
+	}
+	header.SetSignature(proposer.Sign(header.SignBytes()))
+	return header
+}
+
+// MakeDoubleSignEvidence returns the encoded evidence of the proposer signing two conflicting blocks
+func MakeDoubleSignEvidence(chainID string, proposer PrivAccount, height, epoch uint64) common.Bytes {
+	evidence := &DoubleSignEvidence{
+		HeaderA: MakeConflictingBlockHeader(chainID, proposer, height, epoch, "parentA"),
+		HeaderB: MakeConflictingBlockHeader(chainID, proposer, height, epoch, "parentB"),
+	}
+	raw, err := ToBytes(evidence)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to encode the evidence: %v", err))
+	}
+	return raw
+}
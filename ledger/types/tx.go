@@ -4,11 +4,14 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"math/big"
 
 	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/hexutil"
 	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
 	"github.com/thetatoken/theta/crypto"
 	"github.com/thetatoken/theta/rlp"
 )
@@ -24,26 +27,98 @@ Transaction Types:
  - ReleaseFundTx        Release fund reserved for service payments
  - ServicePaymentTx     Payments for service
  - SplitRuleTx          Payment split rule
+ - ExtendSplitRuleTx    Extend the expiry of a payment split rule
  - DepositStakeTx       Deposit stake to a target address (e.g. a validator)
  - WithdrawStakeTx      Withdraw stake from a target address (e.g. a validator)
  - SmartContractTx      Execute smart contract
+ - UpdateMultisigTx     Set or remove the multi-signature policy of an account
+ - PartialReleaseFundTx Release part of a reserved fund before it expires, signed by the source and the target
+ - SweepAccountTx       Transfer the whole balance of an account and delete the account
+ - BurnTx               Destroy coins, taking them out of the total supply
+ - DoubleSignSlashTx    Slash the stake backing a validator that signed two conflicting blocks
+ - StakeCommissionTx    Set the commission a stake holder takes from the reward of the stakes it holds
+ - CancelWithdrawTx     Turn a withdrawn stake back into an active stake before it is returned
+ - UpdateValidatorMetadataTx Set the name, website and security contact of a stake holder
+ - UnjailTx             Bring a jailed validator back into the validator set after the cooldown
+ - EjectStakeTx         Withdraw the stake of a source from a stake holder, signed by the holder
+ - UpdateValidatorKeyTx Move the stakes of a stake holder to a new signing key, signed by both keys
 */
 
 // Gas of regular transactions
 const (
-	GasSendTxPerAccount   uint64 = 5000
-	GasReserveFundTx      uint64 = 10000
-	GasReleaseFundTx      uint64 = 10000
-	GasServicePaymentTx   uint64 = 10000
-	GasSplitRuleTx        uint64 = 10000
-	GasUpdateValidatorsTx uint64 = 10000
-	GasDepositStakeTx     uint64 = 10000
-	GasWidthdrawStakeTx   uint64 = 10000
+	GasSendTxPerAccount          uint64 = 5000
+	GasSendTxDataPerByte         uint64 = 100
+	GasReserveFundTx             uint64 = 10000
+	GasReleaseFundTx             uint64 = 10000
+	GasServicePaymentTx          uint64 = 10000
+	GasSplitRuleTx               uint64 = 10000
+	GasUpdateValidatorsTx        uint64 = 10000
+	GasDepositStakeTx            uint64 = 10000
+	GasWidthdrawStakeTx          uint64 = 10000
+	GasUpdateMultisigTx          uint64 = 10000
+	GasPartialReleaseFundTx      uint64 = 10000
+	GasExtendSplitRuleTx         uint64 = 10000
+	GasSweepAccountTx            uint64 = 10000
+	GasBurnTx                    uint64 = 10000
+	GasDoubleSignSlashTx         uint64 = 10000
+	GasStakeCommissionTx         uint64 = 10000
+	GasCancelWithdrawTx          uint64 = 10000
+	GasUpdateValidatorMetadataTx uint64 = 10000
+	GasUnjailTx                  uint64 = 10000
+	GasEjectStakeTx              uint64 = 10000
+	GasUpdateValidatorKeyTx      uint64 = 10000
 )
 
+// DefaultBlockGasLimit is the gas budget of a block, unless overridden by the chain parameter in the state
+const DefaultBlockGasLimit uint64 = 100000000
+
+// DefaultMaxTxSize is the maximum size in bytes of a raw regular transaction, unless overridden by the chain
+// parameter in the state. The larger transactions are rejected before they are decoded. The special
+// transactions (i.e. the CoinbaseTx and the SlashTx) are exempt, since they are assembled by the proposer.
+const DefaultMaxTxSize uint64 = 128 * 1024
+
+// MaxCoinbaseOutputsSize is the maximum total size in bytes of the encoded outputs of a coinbase transaction,
+// starting from common.HeightEnableCoinbaseBatching. It fits about 20000 outputs, the rewards exceeding it are
+// carried over to the coinbase transaction of the next block.
+const MaxCoinbaseOutputsSize uint64 = 1024 * 1024
+
+// MaximumTxGasLimit is the maximum gas limit of a smart contract transaction. Since the gas is charged for
+// each execution step, it bounds the execution of a transaction deterministically, e.g. an infinite loop.
+const MaximumTxGasLimit uint64 = 10000000
+
+// EstimateTxGas returns the gas a transaction takes up in the block gas budget under the default intrinsic gas
+// schedule, see IntrinsicGasSchedule.TxGas. The gas under the schedule in effect is given by the state.
+func EstimateTxGas(tx Tx) uint64 {
+	return defaultIntrinsicGasSchedule.TxGas(tx)
+}
+
 type Tx interface {
 	AssertIsTx()
 	SignBytes(chainID string) []byte
+	Hash() common.Hash
+	Validate() result.Result // checks the invariants that do not depend on the state, see tx_validation.go
+}
+
+//-----------------------------------------------------------------------------
+
+// txHash returns the canonical hash of the transaction, i.e. the hash of its serialization,
+// signatures included. It equals the hash of the raw bytes the transaction is decoded from.
+func txHash(tx Tx) common.Hash {
+	raw, err := TxToBytes(tx)
+	if err != nil {
+		log.Panicf("Failed to serialize the transaction %v: %v", tx, err)
+	}
+	return crypto.Keccak256Hash(raw)
+}
+
+// RawTxHash returns the canonical hash of the raw transaction, see Tx.Hash()
+func RawTxHash(raw common.Bytes) common.Hash {
+	tx, err := TxFromBytes(raw)
+	if err != nil {
+		// Not a valid transaction, there is no canonical form to hash
+		return crypto.Keccak256Hash(raw)
+	}
+	return tx.Hash()
 }
 
 //-----------------------------------------------------------------------------
@@ -79,6 +154,16 @@ func encodeToBytes(str string) []byte {
 	return encodedBytes
 }
 
+// chainSignBytes returns the bytes to sign for the transaction on the given chain: the encoded chain ID
+// followed by the serialized transaction, wrapped in the Ethereum tx format. Every tx type derives its
+// sign bytes from it, which binds the signatures to the chain so that they can't be replayed on another
+// one. The caller clears the signatures of the transaction beforehand.
+func chainSignBytes(chainID string, tx Tx) []byte {
+	txBytes, _ := TxToBytes(tx) // e.g. negative coins can't be serialized, such a tx fails the basic validation
+	signBytes := append(encodeToBytes(chainID), txBytes...)
+	return addPrefixForSignBytes(signBytes)
+}
+
 //-----------------------------------------------------------------------------
 
 type TxInput struct {
@@ -86,30 +171,52 @@ type TxInput struct {
 	Coins     Coins
 	Sequence  uint64            // Must be 1 greater than the last committed TxInput
 	Signature *crypto.Signature // Depends on the PubKey type and the whole Tx
+
+	// Signatures of the owners of a multisig account, in place of the Signature. Only encoded if present,
+	// so that the encoding of the regular inputs remains the same.
+	Signatures []*crypto.Signature `rlp:"tail"`
+}
+
+// DecodeRLP implements rlp.Decoder. The inputs without the multisig signatures are decoded with nil
+// Signatures, same as they are created.
+func (a *TxInput) DecodeRLP(s *rlp.Stream) error {
+	type txInputRLP TxInput // the same fields, without the decoder
+	var dec txInputRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	if len(dec.Signatures) == 0 {
+		dec.Signatures = nil
+	}
+	*a = TxInput(dec)
+	return nil
 }
 
 type TxInputJSON struct {
-	Address   common.Address    `json:"address"`   // Hash of the PubKey
-	Coins     Coins             `json:"coins"`     //
-	Sequence  common.JSONUint64 `json:"sequence"`  // Must be 1 greater than the last committed TxInput
-	Signature *crypto.Signature `json:"signature"` // Depends on the PubKey type and the whole Tx
+	Address    common.Address      `json:"address"`              // Hash of the PubKey
+	Coins      Coins               `json:"coins"`                //
+	Sequence   common.JSONUint64   `json:"sequence"`             // Must be 1 greater than the last committed TxInput
+	Signature  *crypto.Signature   `json:"signature"`            // Depends on the PubKey type and the whole Tx
+	Signatures []*crypto.Signature `json:"signatures,omitempty"` // Signatures of the owners of a multisig account
 }
 
 func NewTxInputJSON(a TxInput) TxInputJSON {
 	return TxInputJSON{
-		Address:   a.Address,
-		Coins:     a.Coins,
-		Sequence:  common.JSONUint64(a.Sequence),
-		Signature: a.Signature,
+		Address:    a.Address,
+		Coins:      a.Coins,
+		Sequence:   common.JSONUint64(a.Sequence),
+		Signature:  a.Signature,
+		Signatures: a.Signatures,
 	}
 }
 
 func (a TxInputJSON) TxInput() TxInput {
 	return TxInput{
-		Address:   a.Address,
-		Coins:     a.Coins,
-		Sequence:  uint64(a.Sequence),
-		Signature: a.Signature,
+		Address:    a.Address,
+		Coins:      a.Coins,
+		Sequence:   uint64(a.Sequence),
+		Signature:  a.Signature,
+		Signatures: a.Signatures,
 	}
 }
 
@@ -128,10 +235,10 @@ func (a *TxInput) UnmarshalJSON(data []byte) error {
 
 func (txIn TxInput) ValidateBasic() result.Result {
 	if len(txIn.Address) != 20 {
-		return result.Error("Invalid address length")
+		return result.Error("Invalid address length").WithErrorCode(result.CodeInvalidAddress)
 	}
-	if !txIn.Coins.IsValid() {
-		return result.Error("Invalid coins: %v", txIn.Coins)
+	if !txIn.Coins.NoNil().IsValid() { // the unset components are taken as zero
+		return result.Error("Invalid coins: %v", txIn.Coins).WithErrorCode(result.CodeInvalidCoins)
 	}
 	// if txIn.Coins.IsZero() {
 	// 	return result.Error("Coins cannot be zero")
@@ -169,11 +276,11 @@ type TxOutput struct {
 
 func (txOut TxOutput) ValidateBasic() result.Result {
 	if len(txOut.Address) != 20 {
-		return result.Error("Invalid address length")
+		return result.Error("Invalid address length").WithErrorCode(result.CodeInvalidAddress)
 	}
 
-	if !txOut.Coins.IsValid() {
-		return result.Error("Invalid coins: %v", txOut.Coins)
+	if !txOut.Coins.NoNil().IsValid() { // the unset components are taken as zero
+		return result.Error("Invalid coins: %v", txOut.Coins).WithErrorCode(result.CodeInvalidCoins)
 	}
 	// if txOut.Coins.IsZero() {
 	// 	return result.Error("Coins cannot be zero")
@@ -230,13 +337,14 @@ func (a *CoinbaseTx) UnmarshalJSON(data []byte) error {
 
 func (_ *CoinbaseTx) AssertIsTx() {}
 
+func (tx *CoinbaseTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
 func (tx *CoinbaseTx) SignBytes(chainID string) []byte {
-	signBytes := encodeToBytes(chainID)
 	sig := tx.Proposer.Signature
 	tx.Proposer.Signature = nil
-	txBytes, _ := TxToBytes(tx)
-	signBytes = append(signBytes, txBytes...)
-	signBytes = addPrefixForSignBytes(signBytes)
+	signBytes := chainSignBytes(chainID, tx)
 
 	tx.Proposer.Signature = sig
 	return signBytes
@@ -303,13 +411,14 @@ func (a *SlashTx) UnmarshalJSON(data []byte) error {
 
 func (_ *SlashTx) AssertIsTx() {}
 
+func (tx *SlashTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
 func (tx *SlashTx) SignBytes(chainID string) []byte {
-	signBytes := encodeToBytes(chainID)
 	sig := tx.Proposer.Signature
 	tx.Proposer.Signature = nil
-	txBytes, _ := TxToBytes(tx)
-	signBytes = append(signBytes, txBytes...)
-	signBytes = addPrefixForSignBytes(signBytes)
+	signBytes := chainSignBytes(chainID, tx)
 
 	tx.Proposer.Signature = sig
 	return signBytes
@@ -331,27 +440,197 @@ func (tx *SlashTx) String() string {
 
 //-----------------------------------------------------------------------------
 
+// SendTx transfers the coins of one or more inputs to one or more outputs. Each input is signed by its own
+// account, with the sequence of that account. The fee is paid jointly by the inputs, i.e. the total of
+// the inputs must equal the total of the outputs plus the fee. The tx is applied atomically.
 type SendTx struct {
-	Fee     Coins      `json:"fee"` // Fee
-	Inputs  []TxInput  `json:"inputs"`
-	Outputs []TxOutput `json:"outputs"`
+	Fee     Coins // Fee
+	Inputs  []TxInput
+	Outputs []TxOutput
+	Data    common.Bytes // Optional memo, e.g. the destination tag of a deposit
+
+	// The last block height the transaction can be included at, so that an abandoned transaction
+	// cannot resurface later. 0 means it never expires.
+	ValidUntilHeight uint64
+
+	// Optional sponsor paying the fee instead of the inputs, e.g. for a user holding no TFuel yet. Its
+	// coins are the fee, and it signs the same SignBytes as the inputs, see PayingInputs().
+	FeePayer *TxInput
+}
+
+type SendTxJSON struct {
+	Fee              Coins             `json:"fee"` // Fee
+	Inputs           []TxInput         `json:"inputs"`
+	Outputs          []TxOutput        `json:"outputs"`
+	Data             hexutil.Bytes     `json:"data,omitempty"`               // Optional memo
+	ValidUntilHeight common.JSONUint64 `json:"valid_until_height,omitempty"` // 0 means it never expires
+	FeePayer         *TxInput          `json:"fee_payer,omitempty"`          // Optional sponsor of the fee
+}
+
+func NewSendTxJSON(a SendTx) SendTxJSON {
+	return SendTxJSON{
+		Fee:              a.Fee,
+		Inputs:           a.Inputs,
+		Outputs:          a.Outputs,
+		Data:             hexutil.Bytes(a.Data),
+		ValidUntilHeight: common.JSONUint64(a.ValidUntilHeight),
+		FeePayer:         a.FeePayer,
+	}
+}
+
+func (a SendTxJSON) SendTx() SendTx {
+	tx := SendTx{
+		Fee:              a.Fee,
+		Inputs:           a.Inputs,
+		Outputs:          a.Outputs,
+		ValidUntilHeight: uint64(a.ValidUntilHeight),
+		FeePayer:         a.FeePayer,
+	}
+	if len(a.Data) > 0 {
+		tx.Data = common.Bytes(a.Data)
+	}
+	return tx
+}
+
+func (a SendTx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewSendTxJSON(a))
+}
+
+func (a *SendTx) UnmarshalJSON(data []byte) error {
+	var b SendTxJSON
+	if err := json.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	*a = b.SendTx()
+	return nil
+}
+
+// sendTxRLP is the RLP encoding of SendTx. The memo, the valid-until height and the fee payer are only appended
+// if present, so that the encoding, and thus the signatures and the hashes, of the transactions without them
+// remain the same. The Tail holds the memo, followed by the valid-until height if set, followed by the fee
+// payer if set. A trailing field is preceded by all the others, thus an empty memo or a zero valid-until
+// height is only encoded if followed by another field.
+type sendTxRLP struct {
+	Fee     Coins
+	Inputs  []TxInput
+	Outputs []TxOutput
+	Tail    []rlp.RawValue `rlp:"tail"`
+}
+
+// EncodeRLP implements rlp.Encoder.
+func (tx *SendTx) EncodeRLP(w io.Writer) error {
+	enc := sendTxRLP{
+		Fee:     tx.Fee,
+		Inputs:  tx.Inputs,
+		Outputs: tx.Outputs,
+	}
+	if len(tx.Data) > 0 || tx.ValidUntilHeight != 0 || tx.FeePayer != nil {
+		data, err := rlp.EncodeToBytes(tx.Data)
+		if err != nil {
+			return err
+		}
+		enc.Tail = append(enc.Tail, data)
+	}
+	if tx.ValidUntilHeight != 0 || tx.FeePayer != nil {
+		validUntilHeight, err := rlp.EncodeToBytes(tx.ValidUntilHeight)
+		if err != nil {
+			return err
+		}
+		enc.Tail = append(enc.Tail, validUntilHeight)
+	}
+	if tx.FeePayer != nil {
+		feePayer, err := rlp.EncodeToBytes(tx.FeePayer)
+		if err != nil {
+			return err
+		}
+		enc.Tail = append(enc.Tail, feePayer)
+	}
+	return rlp.Encode(w, enc)
+}
+
+// DecodeRLP implements rlp.Decoder.
+func (tx *SendTx) DecodeRLP(s *rlp.Stream) error {
+	var dec sendTxRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	if len(dec.Tail) > 3 {
+		return fmt.Errorf("rlp: too many elements for SendTx")
+	}
+	*tx = SendTx{
+		Fee:     dec.Fee,
+		Inputs:  dec.Inputs,
+		Outputs: dec.Outputs,
+	}
+	if len(dec.Tail) >= 1 {
+		if err := rlp.DecodeBytes(dec.Tail[0], &tx.Data); err != nil {
+			return err
+		}
+		if len(tx.Data) == 0 {
+			tx.Data = nil
+			if len(dec.Tail) == 1 {
+				return fmt.Errorf("rlp: non-canonical empty memo for SendTx") // omitted when encoding
+			}
+		}
+	}
+	if len(dec.Tail) >= 2 {
+		if err := rlp.DecodeBytes(dec.Tail[1], &tx.ValidUntilHeight); err != nil {
+			return err
+		}
+		if tx.ValidUntilHeight == 0 && len(dec.Tail) == 2 {
+			return fmt.Errorf("rlp: non-canonical zero valid-until height for SendTx") // omitted when encoding
+		}
+	}
+	if len(dec.Tail) == 3 {
+		tx.FeePayer = &TxInput{}
+		if err := rlp.DecodeBytes(dec.Tail[2], tx.FeePayer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PayingInputs returns the inputs charged by the transaction, i.e. the inputs followed by the fee payer if any.
+// Each of them is signed and has its sequence incremented independently.
+func (tx *SendTx) PayingInputs() []TxInput {
+	if tx.FeePayer == nil {
+		return tx.Inputs
+	}
+	ins := make([]TxInput, 0, len(tx.Inputs)+1)
+	ins = append(ins, tx.Inputs...)
+	return append(ins, *tx.FeePayer)
+}
+
+// IsExpiredAt returns whether the transaction can no longer be included in a block at the given height
+func (tx *SendTx) IsExpiredAt(height uint64) bool {
+	return tx.ValidUntilHeight != 0 && tx.ValidUntilHeight < height
 }
 
 func (_ *SendTx) AssertIsTx() {}
 
+func (tx *SendTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
 func (tx *SendTx) SignBytes(chainID string) []byte {
-	signBytes := encodeToBytes(chainID)
 	sigz := make([]*crypto.Signature, len(tx.Inputs))
+	multiSigz := make([][]*crypto.Signature, len(tx.Inputs))
 	for i := range tx.Inputs {
-		sigz[i] = tx.Inputs[i].Signature
-		tx.Inputs[i].Signature = nil
+		sigz[i], multiSigz[i] = tx.Inputs[i].Signature, tx.Inputs[i].Signatures
+		tx.Inputs[i].Signature, tx.Inputs[i].Signatures = nil, nil
 	}
-	txBytes, _ := TxToBytes(tx)
-	signBytes = append(signBytes, txBytes...)
-	signBytes = addPrefixForSignBytes(signBytes)
+	var feePayer *TxInput
+	if tx.FeePayer != nil { // the fee payer signs the same SignBytes as the inputs
+		feePayer = tx.FeePayer
+		tx.FeePayer = &TxInput{Address: feePayer.Address, Coins: feePayer.Coins, Sequence: feePayer.Sequence}
+	}
+	signBytes := chainSignBytes(chainID, tx)
 
 	for i := range tx.Inputs {
-		tx.Inputs[i].Signature = sigz[i]
+		tx.Inputs[i].Signature, tx.Inputs[i].Signatures = sigz[i], multiSigz[i]
+	}
+	if feePayer != nil {
+		tx.FeePayer = feePayer
 	}
 	return signBytes
 }
@@ -363,11 +642,25 @@ func (tx *SendTx) SetSignature(addr common.Address, sig *crypto.Signature) bool
 			return true
 		}
 	}
+	if tx.FeePayer != nil && tx.FeePayer.Address == addr {
+		tx.FeePayer.Signature = sig
+		return true
+	}
 	return false
 }
 
 func (tx *SendTx) String() string {
-	return fmt.Sprintf("SendTx{fee: %v, %v->%v}", tx.Fee, tx.Inputs, tx.Outputs)
+	extra := ""
+	if len(tx.Data) > 0 {
+		extra += fmt.Sprintf(", data: %v", tx.Data)
+	}
+	if tx.ValidUntilHeight != 0 {
+		extra += fmt.Sprintf(", valid until: %v", tx.ValidUntilHeight)
+	}
+	if tx.FeePayer != nil {
+		extra += fmt.Sprintf(", fee payer: %v", tx.FeePayer)
+	}
+	return fmt.Sprintf("SendTx{fee: %v, %v->%v%v}", tx.Fee, tx.Inputs, tx.Outputs, extra)
 }
 
 //-----------------------------------------------------------------------------
@@ -423,15 +716,16 @@ func (a *ReserveFundTx) UnmarshalJSON(data []byte) error {
 
 func (_ *ReserveFundTx) AssertIsTx() {}
 
+func (tx *ReserveFundTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
 func (tx *ReserveFundTx) SignBytes(chainID string) []byte {
-	signBytes := encodeToBytes(chainID)
-	sig := tx.Source.Signature
-	tx.Source.Signature = nil
-	txBytes, _ := TxToBytes(tx)
-	signBytes = append(signBytes, txBytes...)
-	signBytes = addPrefixForSignBytes(signBytes)
+	sig, sigs := tx.Source.Signature, tx.Source.Signatures
+	tx.Source.Signature, tx.Source.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
 
-	tx.Source.Signature = sig
+	tx.Source.Signature, tx.Source.Signatures = sig, sigs
 	return signBytes
 }
 
@@ -493,15 +787,16 @@ func (a *ReleaseFundTx) UnmarshalJSON(data []byte) error {
 
 func (_ *ReleaseFundTx) AssertIsTx() {}
 
+func (tx *ReleaseFundTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
 func (tx *ReleaseFundTx) SignBytes(chainID string) []byte {
-	signBytes := encodeToBytes(chainID)
-	sig := tx.Source.Signature
-	tx.Source.Signature = nil
-	txBytes, _ := TxToBytes(tx)
-	signBytes = append(signBytes, txBytes...)
-	signBytes = addPrefixForSignBytes(signBytes)
+	sig, sigs := tx.Source.Signature, tx.Source.Signatures
+	tx.Source.Signature, tx.Source.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
 
-	tx.Source.Signature = sig
+	tx.Source.Signature, tx.Source.Signatures = sig, sigs
 	return signBytes
 }
 
@@ -519,6 +814,95 @@ func (tx *ReleaseFundTx) String() string {
 
 //-----------------------------------------------------------------------------
 
+// PartialReleaseFundTx returns part of a reserved fund to the source before the reservation expires. Since
+// the target may hold service payments not yet settled on-chain, the target co-signs the release, and only
+// the target the reserved fund has paid, if any, can do so. Both sign the same SignBytes.
+type PartialReleaseFundTx struct {
+	Fee             Coins   // Fee, paid by the source
+	Source          TxInput // source account, i.e. the owner of the reserved fund
+	Target          TxInput // target account, i.e. the counterparty of the reserved fund
+	ReserveSequence uint64  // ReserveSequence to locate the ReservedFund
+	Amount          Coins   // amount of the reserved fund to return to the source
+}
+
+type PartialReleaseFundTxJSON struct {
+	Fee             Coins             `json:"fee"`              // Fee, paid by the source
+	Source          TxInput           `json:"source"`           // source account, i.e. the owner of the reserved fund
+	Target          TxInput           `json:"target"`           // target account, i.e. the counterparty of the reserved fund
+	ReserveSequence common.JSONUint64 `json:"reserve_sequence"` // ReserveSequence to locate the ReservedFund
+	Amount          Coins             `json:"amount"`           // amount of the reserved fund to return to the source
+}
+
+func NewPartialReleaseFundTxJSON(a PartialReleaseFundTx) PartialReleaseFundTxJSON {
+	return PartialReleaseFundTxJSON{
+		Fee:             a.Fee,
+		Source:          a.Source,
+		Target:          a.Target,
+		ReserveSequence: common.JSONUint64(a.ReserveSequence),
+		Amount:          a.Amount,
+	}
+}
+
+func (a PartialReleaseFundTxJSON) PartialReleaseFundTx() PartialReleaseFundTx {
+	return PartialReleaseFundTx{
+		Fee:             a.Fee,
+		Source:          a.Source,
+		Target:          a.Target,
+		ReserveSequence: uint64(a.ReserveSequence),
+		Amount:          a.Amount,
+	}
+}
+
+func (a PartialReleaseFundTx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewPartialReleaseFundTxJSON(a))
+}
+
+func (a *PartialReleaseFundTx) UnmarshalJSON(data []byte) error {
+	var b PartialReleaseFundTxJSON
+	if err := json.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	*a = b.PartialReleaseFundTx()
+	return nil
+}
+
+func (_ *PartialReleaseFundTx) AssertIsTx() {}
+
+func (tx *PartialReleaseFundTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
+func (tx *PartialReleaseFundTx) SignBytes(chainID string) []byte {
+	sourceSig, sourceSigs := tx.Source.Signature, tx.Source.Signatures
+	targetSig, targetSigs := tx.Target.Signature, tx.Target.Signatures
+	tx.Source.Signature, tx.Source.Signatures = nil, nil
+	tx.Target.Signature, tx.Target.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
+
+	tx.Source.Signature, tx.Source.Signatures = sourceSig, sourceSigs
+	tx.Target.Signature, tx.Target.Signatures = targetSig, targetSigs
+	return signBytes
+}
+
+func (tx *PartialReleaseFundTx) SetSignature(addr common.Address, sig *crypto.Signature) bool {
+	if tx.Source.Address == addr {
+		tx.Source.Signature = sig
+		return true
+	}
+	if tx.Target.Address == addr {
+		tx.Target.Signature = sig
+		return true
+	}
+	return false
+}
+
+func (tx *PartialReleaseFundTx) String() string {
+	return fmt.Sprintf("PartialReleaseFundTx{fee: %v, source: %v, target: %v, reserve_sequence: %v, amount: %v}",
+		tx.Fee, tx.Source, tx.Target, tx.ReserveSequence, tx.Amount)
+}
+
+//-----------------------------------------------------------------------------
+
 type ServicePaymentTx struct {
 	Fee             Coins   // Fee
 	Source          TxInput // source account
@@ -574,9 +958,11 @@ func (a *ServicePaymentTx) UnmarshalJSON(data []byte) error {
 
 func (_ *ServicePaymentTx) AssertIsTx() {}
 
-func (tx *ServicePaymentTx) SourceSignBytes(chainID string) []byte {
-	signBytes := encodeToBytes(chainID)
+func (tx *ServicePaymentTx) Hash() common.Hash {
+	return txHash(tx)
+}
 
+func (tx *ServicePaymentTx) SourceSignBytes(chainID string) []byte {
 	source := tx.Source
 	target := tx.Target
 	fee := tx.Fee
@@ -585,15 +971,12 @@ func (tx *ServicePaymentTx) SourceSignBytes(chainID string) []byte {
 	tx.Target = TxInput{Address: target.Address}
 	tx.Fee = NewCoins(0, 0)
 
-	txBytes, _ := TxToBytes(tx)
-	signBytes = append(signBytes, txBytes...)
+	signBytes := chainSignBytes(chainID, tx)
 
 	tx.Source = source
 	tx.Target = target
 	tx.Fee = fee
 
-	signBytes = addPrefixForSignBytes(signBytes)
-
 	return signBytes
 }
 
@@ -602,15 +985,11 @@ func (tx *ServicePaymentTx) SetSourceSignature(sig *crypto.Signature) {
 }
 
 func (tx *ServicePaymentTx) TargetSignBytes(chainID string) []byte {
-	// TODO: remove chainID from all Tx sign bytes.
-	signBytes := encodeToBytes(chainID)
 	targetSig := tx.Target.Signature
 
 	tx.Target.Signature = nil
 
-	txBytes, _ := TxToBytes(tx)
-	signBytes = append(signBytes, txBytes...)
-	signBytes = addPrefixForSignBytes(signBytes)
+	signBytes := chainSignBytes(chainID, tx)
 
 	tx.Target.Signature = targetSig
 
@@ -692,15 +1071,16 @@ func (a *SplitRuleTx) UnmarshalJSON(data []byte) error {
 
 func (_ *SplitRuleTx) AssertIsTx() {}
 
+func (tx *SplitRuleTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
 func (tx *SplitRuleTx) SignBytes(chainID string) []byte {
-	signBytes := encodeToBytes(chainID)
-	sig := tx.Initiator.Signature
-	tx.Initiator.Signature = nil
-	txBytes, _ := TxToBytes(tx)
-	signBytes = append(signBytes, txBytes...)
-	signBytes = addPrefixForSignBytes(signBytes)
-
-	tx.Initiator.Signature = sig
+	sig, sigs := tx.Initiator.Signature, tx.Initiator.Signatures
+	tx.Initiator.Signature, tx.Initiator.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
+
+	tx.Initiator.Signature, tx.Initiator.Signatures = sig, sigs
 	return signBytes
 }
 
@@ -719,6 +1099,83 @@ func (tx *SplitRuleTx) String() string {
 
 //-----------------------------------------------------------------------------
 
+// ExtendSplitRuleTx extends the expiry of a split rule that has not expired yet, keeping its splits. Only
+// the initiator of the split rule can extend it.
+type ExtendSplitRuleTx struct {
+	Fee        Coins   // Fee
+	ResourceID string  // ResourceID of the split rule to extend
+	Initiator  TxInput // Initiator of the split rule
+	Duration   uint64  // Number of blocks added to the end block height of the split rule
+}
+
+type ExtendSplitRuleTxJSON struct {
+	Fee        Coins             `json:"fee"`         // Fee
+	ResourceID string            `json:"resource_id"` // ResourceID of the split rule to extend
+	Initiator  TxInput           `json:"initiator"`   // Initiator of the split rule
+	Duration   common.JSONUint64 `json:"duration"`    // Number of blocks added to the end block height of the split rule
+}
+
+func NewExtendSplitRuleTxJSON(a ExtendSplitRuleTx) ExtendSplitRuleTxJSON {
+	return ExtendSplitRuleTxJSON{
+		Fee:        a.Fee,
+		ResourceID: a.ResourceID,
+		Initiator:  a.Initiator,
+		Duration:   common.JSONUint64(a.Duration),
+	}
+}
+
+func (a ExtendSplitRuleTxJSON) ExtendSplitRuleTx() ExtendSplitRuleTx {
+	return ExtendSplitRuleTx{
+		Fee:        a.Fee,
+		ResourceID: a.ResourceID,
+		Initiator:  a.Initiator,
+		Duration:   uint64(a.Duration),
+	}
+}
+
+func (a ExtendSplitRuleTx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewExtendSplitRuleTxJSON(a))
+}
+
+func (a *ExtendSplitRuleTx) UnmarshalJSON(data []byte) error {
+	var b ExtendSplitRuleTxJSON
+	if err := json.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	*a = b.ExtendSplitRuleTx()
+	return nil
+}
+
+func (_ *ExtendSplitRuleTx) AssertIsTx() {}
+
+func (tx *ExtendSplitRuleTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
+func (tx *ExtendSplitRuleTx) SignBytes(chainID string) []byte {
+	sig, sigs := tx.Initiator.Signature, tx.Initiator.Signatures
+	tx.Initiator.Signature, tx.Initiator.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
+
+	tx.Initiator.Signature, tx.Initiator.Signatures = sig, sigs
+	return signBytes
+}
+
+func (tx *ExtendSplitRuleTx) SetSignature(addr common.Address, sig *crypto.Signature) bool {
+	if tx.Initiator.Address == addr {
+		tx.Initiator.Signature = sig
+		return true
+	}
+	return false
+}
+
+func (tx *ExtendSplitRuleTx) String() string {
+	return fmt.Sprintf("ExtendSplitRuleTx{fee: %v, resource_id: %v, initiator: %v, duration: %v}",
+		tx.Fee, tx.ResourceID, tx.Initiator, tx.Duration)
+}
+
+//-----------------------------------------------------------------------------
+
 type SmartContractTx struct {
 	From     TxInput
 	To       TxOutput
@@ -770,15 +1227,16 @@ func (a *SmartContractTx) UnmarshalJSON(data []byte) error {
 
 func (_ *SmartContractTx) AssertIsTx() {}
 
+func (tx *SmartContractTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
 func (tx *SmartContractTx) SignBytes(chainID string) []byte {
-	signBytes := encodeToBytes(chainID)
-	sig := tx.From.Signature
-	tx.From.Signature = nil
-	txBytes, _ := TxToBytes(tx)
-	signBytes = append(signBytes, txBytes...)
-	signBytes = addPrefixForSignBytes(signBytes)
-
-	tx.From.Signature = sig
+	sig, sigs := tx.From.Signature, tx.From.Signatures
+	tx.From.Signature, tx.From.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
+
+	tx.From.Signature, tx.From.Signatures = sig, sigs
 	return signBytes
 }
 
@@ -797,24 +1255,132 @@ func (tx *SmartContractTx) String() string {
 
 //-----------------------------------------------------------------------------
 
+// DepositStakeTx moves the coins of the source into a stake backing the holder. The source may be the holder
+// itself, such a self stake counts toward the stake of the holder like the stakes of the other sources, and
+// has the same minimum deposit. The staked coins leave the balance of the source whether or not it is the
+// holder, so the source has to cover both the stake and the fee out of its balance, and the holder never
+// spends the stakes it holds. The stakes are recorded per source and holder pair, so an address can hold
+// stakes and stake to other holders at the same time, including the holders staking back to it, and each of
+// these stakes is deposited and withdrawn independently.
 type DepositStakeTx struct {
 	Fee     Coins    `json:"fee"`     // Fee
 	Source  TxInput  `json:"source"`  // source staker account
 	Holder  TxOutput `json:"holder"`  // stake holder account
 	Purpose uint8    `json:"purpose"` // purpose e.g. stake for validator/guardian
+
+	// Optional nonce chosen by the client to make the deposit idempotent, e.g. a wallet retrying a deposit after a
+	// timeout signs the retry with the same nonce and a new sequence. A deposit whose nonce the source already used
+	// within the recent blocks is rejected, see core.DepositNonceWindow. 0 means no nonce.
+	IdempotencyNonce uint64
+}
+
+type DepositStakeTxJSON struct {
+	Fee              Coins                 `json:"fee"`
+	Source           TxInput               `json:"source"`
+	Holder           TxOutput              `json:"holder"`
+	Purpose          core.StakePurposeJSON `json:"purpose"`                     // the name of the purpose, the value is accepted too
+	IdempotencyNonce common.JSONUint64     `json:"idempotency_nonce,omitempty"` // 0 means no nonce
+}
+
+func NewDepositStakeTxJSON(a DepositStakeTx) DepositStakeTxJSON {
+	return DepositStakeTxJSON{
+		Fee:              a.Fee,
+		Source:           a.Source,
+		Holder:           a.Holder,
+		Purpose:          core.StakePurposeJSON(a.Purpose),
+		IdempotencyNonce: common.JSONUint64(a.IdempotencyNonce),
+	}
+}
+
+func (a DepositStakeTxJSON) DepositStakeTx() DepositStakeTx {
+	return DepositStakeTx{
+		Fee:              a.Fee,
+		Source:           a.Source,
+		Holder:           a.Holder,
+		Purpose:          uint8(a.Purpose),
+		IdempotencyNonce: uint64(a.IdempotencyNonce),
+	}
+}
+
+func (a DepositStakeTx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewDepositStakeTxJSON(a))
+}
+
+func (a *DepositStakeTx) UnmarshalJSON(data []byte) error {
+	var b DepositStakeTxJSON
+	if err := json.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	*a = b.DepositStakeTx()
+	return nil
+}
+
+// depositStakeTxRLP is the RLP encoding of DepositStakeTx. The idempotency nonce is only appended if set, so that
+// the encoding, and thus the signatures and the hashes, of the deposits without a nonce remain the same.
+type depositStakeTxRLP struct {
+	Fee     Coins
+	Source  TxInput
+	Holder  TxOutput
+	Purpose uint8
+	Tail    []rlp.RawValue `rlp:"tail"`
+}
+
+// EncodeRLP implements rlp.Encoder.
+func (tx *DepositStakeTx) EncodeRLP(w io.Writer) error {
+	enc := depositStakeTxRLP{
+		Fee:     tx.Fee,
+		Source:  tx.Source,
+		Holder:  tx.Holder,
+		Purpose: tx.Purpose,
+	}
+	if tx.IdempotencyNonce != 0 {
+		nonce, err := rlp.EncodeToBytes(tx.IdempotencyNonce)
+		if err != nil {
+			return err
+		}
+		enc.Tail = append(enc.Tail, nonce)
+	}
+	return rlp.Encode(w, enc)
+}
+
+// DecodeRLP implements rlp.Decoder.
+func (tx *DepositStakeTx) DecodeRLP(s *rlp.Stream) error {
+	var dec depositStakeTxRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	if len(dec.Tail) > 1 {
+		return fmt.Errorf("rlp: too many elements for DepositStakeTx")
+	}
+	*tx = DepositStakeTx{
+		Fee:     dec.Fee,
+		Source:  dec.Source,
+		Holder:  dec.Holder,
+		Purpose: dec.Purpose,
+	}
+	if len(dec.Tail) == 1 {
+		if err := rlp.DecodeBytes(dec.Tail[0], &tx.IdempotencyNonce); err != nil {
+			return err
+		}
+		if tx.IdempotencyNonce == 0 {
+			return fmt.Errorf("rlp: non-canonical zero idempotency nonce for DepositStakeTx") // omitted when encoding
+		}
+	}
+	return nil
 }
 
 func (_ *DepositStakeTx) AssertIsTx() {}
 
+func (tx *DepositStakeTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
 func (tx *DepositStakeTx) SignBytes(chainID string) []byte {
-	signBytes := encodeToBytes(chainID)
-	sig := tx.Source.Signature
-	tx.Source.Signature = nil
-	txBytes, _ := TxToBytes(tx)
-	signBytes = append(signBytes, txBytes...)
-	signBytes = addPrefixForSignBytes(signBytes)
+	sig, sigs := tx.Source.Signature, tx.Source.Signatures
+	tx.Source.Signature, tx.Source.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
 
-	tx.Source.Signature = sig
+	tx.Source.Signature, tx.Source.Signatures = sig, sigs
 	return signBytes
 }
 
@@ -827,8 +1393,12 @@ func (tx *DepositStakeTx) SetSignature(addr common.Address, sig *crypto.Signatur
 }
 
 func (tx *DepositStakeTx) String() string {
-	return fmt.Sprintf("DepositStakeTx{%v -> %v, stake: %v, purpose: %v}",
-		tx.Source.Address, tx.Holder.Address, tx.Source.Coins.ThetaWei, tx.Purpose)
+	extra := ""
+	if tx.IdempotencyNonce != 0 {
+		extra = fmt.Sprintf(", idempotency nonce: %v", tx.IdempotencyNonce)
+	}
+	return fmt.Sprintf("DepositStakeTx{%v -> %v, stake: %v, purpose: %v%v}",
+		tx.Source.Address, tx.Holder.Address, tx.Source.Coins.ThetaWei, core.StakePurposeName(tx.Purpose), extra)
 }
 
 //-----------------------------------------------------------------------------
@@ -838,19 +1408,125 @@ type WithdrawStakeTx struct {
 	Source  TxInput  `json:"source"`  // source staker account
 	Holder  TxOutput `json:"holder"`  // stake holder account
 	Purpose uint8    `json:"purpose"` // purpose e.g. stake for validator/guardian
+
+	// Optional address the stake is returned to at the end of the locking period instead of the source, e.g. a
+	// fresh address of a delegator staking from a cold wallet. The account is created if it does not exist.
+	ReturnAddress *common.Address
+}
+
+type WithdrawStakeTxJSON struct {
+	Fee           Coins                 `json:"fee"`
+	Source        TxInput               `json:"source"`
+	Holder        TxOutput              `json:"holder"`
+	Purpose       core.StakePurposeJSON `json:"purpose"`                  // the name of the purpose, the value is accepted too
+	ReturnAddress *common.Address       `json:"return_address,omitempty"` // the source if omitted
+}
+
+func NewWithdrawStakeTxJSON(a WithdrawStakeTx) WithdrawStakeTxJSON {
+	return WithdrawStakeTxJSON{
+		Fee:           a.Fee,
+		Source:        a.Source,
+		Holder:        a.Holder,
+		Purpose:       core.StakePurposeJSON(a.Purpose),
+		ReturnAddress: a.ReturnAddress,
+	}
+}
+
+func (a WithdrawStakeTxJSON) WithdrawStakeTx() WithdrawStakeTx {
+	return WithdrawStakeTx{
+		Fee:           a.Fee,
+		Source:        a.Source,
+		Holder:        a.Holder,
+		Purpose:       uint8(a.Purpose),
+		ReturnAddress: a.ReturnAddress,
+	}
+}
+
+func (a WithdrawStakeTx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewWithdrawStakeTxJSON(a))
+}
+
+func (a *WithdrawStakeTx) UnmarshalJSON(data []byte) error {
+	var b WithdrawStakeTxJSON
+	if err := json.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	*a = b.WithdrawStakeTx()
+	return nil
+}
+
+// withdrawStakeTxRLP is the RLP encoding of WithdrawStakeTx. The return address is only appended if set, so that
+// the encoding, and thus the signatures and the hashes, of the withdrawals to the source remain the same.
+type withdrawStakeTxRLP struct {
+	Fee     Coins
+	Source  TxInput
+	Holder  TxOutput
+	Purpose uint8
+	Tail    []rlp.RawValue `rlp:"tail"`
+}
+
+// EncodeRLP implements rlp.Encoder.
+func (tx *WithdrawStakeTx) EncodeRLP(w io.Writer) error {
+	enc := withdrawStakeTxRLP{
+		Fee:     tx.Fee,
+		Source:  tx.Source,
+		Holder:  tx.Holder,
+		Purpose: tx.Purpose,
+	}
+	if tx.ReturnAddress != nil {
+		returnAddress, err := rlp.EncodeToBytes(tx.ReturnAddress)
+		if err != nil {
+			return err
+		}
+		enc.Tail = append(enc.Tail, returnAddress)
+	}
+	return rlp.Encode(w, enc)
+}
+
+// DecodeRLP implements rlp.Decoder.
+func (tx *WithdrawStakeTx) DecodeRLP(s *rlp.Stream) error {
+	var dec withdrawStakeTxRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	if len(dec.Tail) > 1 {
+		return fmt.Errorf("rlp: too many elements for WithdrawStakeTx")
+	}
+	*tx = WithdrawStakeTx{
+		Fee:     dec.Fee,
+		Source:  dec.Source,
+		Holder:  dec.Holder,
+		Purpose: dec.Purpose,
+	}
+	if len(dec.Tail) == 1 {
+		tx.ReturnAddress = &common.Address{}
+		if err := rlp.DecodeBytes(dec.Tail[0], tx.ReturnAddress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReturnTo returns the address the stake is returned to, i.e. the return address if set, or the source
+func (tx *WithdrawStakeTx) ReturnTo() common.Address {
+	if tx.ReturnAddress != nil {
+		return *tx.ReturnAddress
+	}
+	return tx.Source.Address
 }
 
 func (_ *WithdrawStakeTx) AssertIsTx() {}
 
+func (tx *WithdrawStakeTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
 func (tx *WithdrawStakeTx) SignBytes(chainID string) []byte {
-	signBytes := encodeToBytes(chainID)
-	sig := tx.Source.Signature
-	tx.Source.Signature = nil
-	txBytes, _ := TxToBytes(tx)
-	signBytes = append(signBytes, txBytes...)
-	signBytes = addPrefixForSignBytes(signBytes)
+	sig, sigs := tx.Source.Signature, tx.Source.Signatures
+	tx.Source.Signature, tx.Source.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
 
-	tx.Source.Signature = sig
+	tx.Source.Signature, tx.Source.Signatures = sig, sigs
 	return signBytes
 }
 
@@ -863,8 +1539,432 @@ func (tx *WithdrawStakeTx) SetSignature(addr common.Address, sig *crypto.Signatu
 }
 
 func (tx *WithdrawStakeTx) String() string {
-	return fmt.Sprintf("DepositStakeTx{%v <- %v, stake: %v, purpose: %v}",
-		tx.Source.Address, tx.Holder.Address, tx.Source.Coins.ThetaWei, tx.Purpose)
+	extra := ""
+	if tx.ReturnAddress != nil {
+		extra = fmt.Sprintf(", return address: %v", tx.ReturnAddress)
+	}
+	return fmt.Sprintf("WithdrawStakeTx{%v <- %v, stake: %v, purpose: %v%v}",
+		tx.Source.Address, tx.Holder.Address, tx.Source.Coins.ThetaWei, core.StakePurposeName(tx.Purpose), extra)
+}
+
+//-----------------------------------------------------------------------------
+
+type UpdateMultisigTx struct {
+	Fee       Coins            `json:"fee"`       // Fee
+	Account   TxInput          `json:"account"`   // account to update, signed by its owners if it is already a multisig account
+	Owners    []common.Address `json:"owners"`    // new owners, empty to turn the account back into a regular one
+	Threshold uint64           `json:"threshold"` // number of owners required to sign, zero if there are no owners
+}
+
+func (_ *UpdateMultisigTx) AssertIsTx() {}
+
+func (tx *UpdateMultisigTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
+func (tx *UpdateMultisigTx) SignBytes(chainID string) []byte {
+	sig, sigs := tx.Account.Signature, tx.Account.Signatures
+	tx.Account.Signature, tx.Account.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
+
+	tx.Account.Signature, tx.Account.Signatures = sig, sigs
+	return signBytes
+}
+
+func (tx *UpdateMultisigTx) SetSignature(addr common.Address, sig *crypto.Signature) bool {
+	if tx.Account.Address == addr {
+		tx.Account.Signature = sig
+		return true
+	}
+	return false
+}
+
+// Policy returns the multisig policy to set, or nil if the policy of the account is to be removed
+func (tx *UpdateMultisigTx) Policy() *MultisigPolicy {
+	if len(tx.Owners) == 0 && tx.Threshold == 0 {
+		return nil
+	}
+	return &MultisigPolicy{
+		Owners:    tx.Owners,
+		Threshold: tx.Threshold,
+	}
+}
+
+func (tx *UpdateMultisigTx) String() string {
+	return fmt.Sprintf("UpdateMultisigTx{%v, owners: %v, threshold: %v}",
+		tx.Account.Address, tx.Owners, tx.Threshold)
+}
+
+//-----------------------------------------------------------------------------
+
+// SweepAccountTx transfers the whole balance of the source account, less the fee, to the target and deletes
+// the source account. The sequence of the deleted account is kept as a tombstone, so that the account
+// starts from it if it is ever created again, and its old transactions can not be replayed.
+type SweepAccountTx struct {
+	Fee    Coins          `json:"fee"`    // Fee
+	Source TxInput        `json:"source"` // account to delete, its coins need to be its whole balance
+	Target common.Address `json:"target"` // receives the balance of the source account less the fee
+}
+
+func (_ *SweepAccountTx) AssertIsTx() {}
+
+func (tx *SweepAccountTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
+func (tx *SweepAccountTx) SignBytes(chainID string) []byte {
+	sig, sigs := tx.Source.Signature, tx.Source.Signatures
+	tx.Source.Signature, tx.Source.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
+
+	tx.Source.Signature, tx.Source.Signatures = sig, sigs
+	return signBytes
+}
+
+func (tx *SweepAccountTx) SetSignature(addr common.Address, sig *crypto.Signature) bool {
+	if tx.Source.Address == addr {
+		tx.Source.Signature = sig
+		return true
+	}
+	return false
+}
+
+func (tx *SweepAccountTx) String() string {
+	return fmt.Sprintf("SweepAccountTx{fee: %v, source: %v, target: %v}",
+		tx.Fee, tx.Source, tx.Target.Hex())
+}
+
+// BurnTx destroys the coins of the source account. Unlike the coins sent to an address no one holds the key
+// of, the burned coins are taken out of the total supply tracked in the state.
+type BurnTx struct {
+	Fee    Coins   `json:"fee"`    // Fee
+	Source TxInput `json:"source"` // its coins are burned, the fee is charged on top of them
+}
+
+func (_ *BurnTx) AssertIsTx() {}
+
+func (tx *BurnTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
+func (tx *BurnTx) SignBytes(chainID string) []byte {
+	sig, sigs := tx.Source.Signature, tx.Source.Signatures
+	tx.Source.Signature, tx.Source.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
+
+	tx.Source.Signature, tx.Source.Signatures = sig, sigs
+	return signBytes
+}
+
+func (tx *BurnTx) SetSignature(addr common.Address, sig *crypto.Signature) bool {
+	if tx.Source.Address == addr {
+		tx.Source.Signature = sig
+		return true
+	}
+	return false
+}
+
+func (tx *BurnTx) String() string {
+	return fmt.Sprintf("BurnTx{fee: %v, source: %v}", tx.Fee, tx.Source)
+}
+
+// DoubleSignSlashTx reports the evidence of a validator signing two conflicting blocks. A portion of the stake
+// backing the validator is burned, and the rest is withdrawn, which removes the validator from the validator
+// set. Anyone can report the evidence, paying the fee.
+type DoubleSignSlashTx struct {
+	Fee      Coins        `json:"fee"`      // Fee
+	Reporter TxInput      `json:"reporter"` // pays the fee, its coins are ignored
+	Evidence common.Bytes `json:"evidence"` // the RLP encoded DoubleSignEvidence
+}
+
+func (_ *DoubleSignSlashTx) AssertIsTx() {}
+
+func (tx *DoubleSignSlashTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
+func (tx *DoubleSignSlashTx) SignBytes(chainID string) []byte {
+	sig, sigs := tx.Reporter.Signature, tx.Reporter.Signatures
+	tx.Reporter.Signature, tx.Reporter.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
+
+	tx.Reporter.Signature, tx.Reporter.Signatures = sig, sigs
+	return signBytes
+}
+
+func (tx *DoubleSignSlashTx) SetSignature(addr common.Address, sig *crypto.Signature) bool {
+	if tx.Reporter.Address == addr {
+		tx.Reporter.Signature = sig
+		return true
+	}
+	return false
+}
+
+func (tx *DoubleSignSlashTx) String() string {
+	return fmt.Sprintf("DoubleSignSlashTx{fee: %v, reporter: %v, evidence: %v}",
+		tx.Fee, tx.Reporter, hex.EncodeToString(tx.Evidence))
+}
+
+// StakeCommissionTx sets the commission of a stake holder, i.e. the percentage of the reward earned by the
+// stakes it holds that the holder takes before the rest is shared among the stake sources. It is signed by
+// the holder.
+type StakeCommissionTx struct {
+	Fee        Coins   `json:"fee"`        // Fee
+	Holder     TxInput `json:"holder"`     // pays the fee, its coins are ignored
+	Commission uint8   `json:"commission"` // percentage, at most MaxStakeCommission
+}
+
+func (_ *StakeCommissionTx) AssertIsTx() {}
+
+func (tx *StakeCommissionTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
+func (tx *StakeCommissionTx) SignBytes(chainID string) []byte {
+	sig, sigs := tx.Holder.Signature, tx.Holder.Signatures
+	tx.Holder.Signature, tx.Holder.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
+
+	tx.Holder.Signature, tx.Holder.Signatures = sig, sigs
+	return signBytes
+}
+
+func (tx *StakeCommissionTx) SetSignature(addr common.Address, sig *crypto.Signature) bool {
+	if tx.Holder.Address == addr {
+		tx.Holder.Signature = sig
+		return true
+	}
+	return false
+}
+
+func (tx *StakeCommissionTx) String() string {
+	return fmt.Sprintf("StakeCommissionTx{fee: %v, holder: %v, commission: %v%%}", tx.Fee, tx.Holder, tx.Commission)
+}
+
+// CancelWithdrawTx cancels the withdrawal of a validator stake before the stake is returned, i.e. before its
+// return height. The stake is active again, and counts towards the stake of the holder, from the next block.
+type CancelWithdrawTx struct {
+	Fee    Coins    `json:"fee"`    // Fee
+	Source TxInput  `json:"source"` // source staker account, its coins are ignored
+	Holder TxOutput `json:"holder"` // stake holder account
+}
+
+func (_ *CancelWithdrawTx) AssertIsTx() {}
+
+func (tx *CancelWithdrawTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
+func (tx *CancelWithdrawTx) SignBytes(chainID string) []byte {
+	sig, sigs := tx.Source.Signature, tx.Source.Signatures
+	tx.Source.Signature, tx.Source.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
+
+	tx.Source.Signature, tx.Source.Signatures = sig, sigs
+	return signBytes
+}
+
+func (tx *CancelWithdrawTx) SetSignature(addr common.Address, sig *crypto.Signature) bool {
+	if tx.Source.Address == addr {
+		tx.Source.Signature = sig
+		return true
+	}
+	return false
+}
+
+func (tx *CancelWithdrawTx) String() string {
+	return fmt.Sprintf("CancelWithdrawTx{fee: %v, source: %v, holder: %v}", tx.Fee, tx.Source, tx.Holder)
+}
+
+// UpdateValidatorMetadataTx sets the metadata of a stake holder, i.e. its name, website and security contact. It
+// is signed by the holder, and the empty metadata clears it.
+type UpdateValidatorMetadataTx struct {
+	Fee      Coins             `json:"fee"`      // Fee
+	Holder   TxInput           `json:"holder"`   // pays the fee, its coins are ignored
+	Metadata ValidatorMetadata `json:"metadata"` // replaces the current metadata of the holder
+}
+
+func (_ *UpdateValidatorMetadataTx) AssertIsTx() {}
+
+func (tx *UpdateValidatorMetadataTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
+func (tx *UpdateValidatorMetadataTx) SignBytes(chainID string) []byte {
+	sig, sigs := tx.Holder.Signature, tx.Holder.Signatures
+	tx.Holder.Signature, tx.Holder.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
+
+	tx.Holder.Signature, tx.Holder.Signatures = sig, sigs
+	return signBytes
+}
+
+func (tx *UpdateValidatorMetadataTx) SetSignature(addr common.Address, sig *crypto.Signature) bool {
+	if tx.Holder.Address == addr {
+		tx.Holder.Signature = sig
+		return true
+	}
+	return false
+}
+
+func (tx *UpdateValidatorMetadataTx) String() string {
+	return fmt.Sprintf("UpdateValidatorMetadataTx{fee: %v, holder: %v, name: %q, website: %q, security_contact: %q}",
+		tx.Fee, tx.Holder, tx.Metadata.Name, tx.Metadata.Website, tx.Metadata.SecurityContact)
+}
+
+// UnjailTx brings the holder back into the validator set after it is jailed for missing too many blocks, once
+// core.JailCooldownPeriod has passed. It is signed by the holder.
+type UnjailTx struct {
+	Fee    Coins   `json:"fee"`    // Fee
+	Holder TxInput `json:"holder"` // the jailed stake holder, pays the fee, its coins are ignored
+}
+
+func (_ *UnjailTx) AssertIsTx() {}
+
+func (tx *UnjailTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
+func (tx *UnjailTx) SignBytes(chainID string) []byte {
+	sig, sigs := tx.Holder.Signature, tx.Holder.Signatures
+	tx.Holder.Signature, tx.Holder.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
+
+	tx.Holder.Signature, tx.Holder.Signatures = sig, sigs
+	return signBytes
+}
+
+func (tx *UnjailTx) SetSignature(addr common.Address, sig *crypto.Signature) bool {
+	if tx.Holder.Address == addr {
+		tx.Holder.Signature = sig
+		return true
+	}
+	return false
+}
+
+func (tx *UnjailTx) String() string {
+	return fmt.Sprintf("UnjailTx{fee: %v, holder: %v}", tx.Fee, tx.Holder)
+}
+
+// EjectStakeTx withdraws the stake of the source from the holder, the same way as a WithdrawStakeTx of the source
+// does: the stake is locked for the return locking period, then returned to the source. It is signed by the
+// holder, e.g. to stop backing its node with the stake of a sanctioned address, and the source can not cancel
+// the withdrawal. The holder withdraws its self stake with a WithdrawStakeTx, it can not eject it.
+type EjectStakeTx struct {
+	Fee     Coins    `json:"fee"`     // Fee
+	Holder  TxInput  `json:"holder"`  // stake holder account, pays the fee, its coins are ignored
+	Source  TxOutput `json:"source"`  // source staker account, the stake is returned to
+	Purpose uint8    `json:"purpose"` // purpose e.g. stake for validator/guardian
+}
+
+type EjectStakeTxJSON struct {
+	Fee     Coins                 `json:"fee"`
+	Holder  TxInput               `json:"holder"`
+	Source  TxOutput              `json:"source"`
+	Purpose core.StakePurposeJSON `json:"purpose"` // the name of the purpose, the value is accepted too
+}
+
+func NewEjectStakeTxJSON(a EjectStakeTx) EjectStakeTxJSON {
+	return EjectStakeTxJSON{
+		Fee:     a.Fee,
+		Holder:  a.Holder,
+		Source:  a.Source,
+		Purpose: core.StakePurposeJSON(a.Purpose),
+	}
+}
+
+func (a EjectStakeTxJSON) EjectStakeTx() EjectStakeTx {
+	return EjectStakeTx{
+		Fee:     a.Fee,
+		Holder:  a.Holder,
+		Source:  a.Source,
+		Purpose: uint8(a.Purpose),
+	}
+}
+
+func (a EjectStakeTx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewEjectStakeTxJSON(a))
+}
+
+func (a *EjectStakeTx) UnmarshalJSON(data []byte) error {
+	var b EjectStakeTxJSON
+	if err := json.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	*a = b.EjectStakeTx()
+	return nil
+}
+
+func (_ *EjectStakeTx) AssertIsTx() {}
+
+func (tx *EjectStakeTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
+func (tx *EjectStakeTx) SignBytes(chainID string) []byte {
+	sig, sigs := tx.Holder.Signature, tx.Holder.Signatures
+	tx.Holder.Signature, tx.Holder.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
+
+	tx.Holder.Signature, tx.Holder.Signatures = sig, sigs
+	return signBytes
+}
+
+func (tx *EjectStakeTx) SetSignature(addr common.Address, sig *crypto.Signature) bool {
+	if tx.Holder.Address == addr {
+		tx.Holder.Signature = sig
+		return true
+	}
+	return false
+}
+
+func (tx *EjectStakeTx) String() string {
+	return fmt.Sprintf("EjectStakeTx{%v -> %v, purpose: %v}",
+		tx.Holder.Address, tx.Source.Address, core.StakePurposeName(tx.Purpose))
+}
+
+// UpdateValidatorKeyTx moves the stakes of the holder, the active and the withdrawn ones, to the new holder address,
+// so a validator whose signing key is compromised keeps validating with a new key instead of unstaking. It is signed
+// by both the current and the new key. The validator set switches to the new key at the effective height of the
+// stake change, and the current key can no longer be staked to.
+type UpdateValidatorKeyTx struct {
+	Fee       Coins   `json:"fee"`        // Fee
+	Holder    TxInput `json:"holder"`     // current stake holder account, pays the fee, its coins are ignored
+	NewHolder TxInput `json:"new_holder"` // new stake holder account, only its signature is used
+}
+
+func (_ *UpdateValidatorKeyTx) AssertIsTx() {}
+
+func (tx *UpdateValidatorKeyTx) Hash() common.Hash {
+	return txHash(tx)
+}
+
+func (tx *UpdateValidatorKeyTx) SignBytes(chainID string) []byte {
+	sig, sigs := tx.Holder.Signature, tx.Holder.Signatures
+	newSig, newSigs := tx.NewHolder.Signature, tx.NewHolder.Signatures
+	tx.Holder.Signature, tx.Holder.Signatures = nil, nil
+	tx.NewHolder.Signature, tx.NewHolder.Signatures = nil, nil
+	signBytes := chainSignBytes(chainID, tx)
+
+	tx.Holder.Signature, tx.Holder.Signatures = sig, sigs
+	tx.NewHolder.Signature, tx.NewHolder.Signatures = newSig, newSigs
+	return signBytes
+}
+
+func (tx *UpdateValidatorKeyTx) SetSignature(addr common.Address, sig *crypto.Signature) bool {
+	if tx.Holder.Address == addr {
+		tx.Holder.Signature = sig
+		return true
+	}
+	if tx.NewHolder.Address == addr {
+		tx.NewHolder.Signature = sig
+		return true
+	}
+	return false
+}
+
+func (tx *UpdateValidatorKeyTx) String() string {
+	return fmt.Sprintf("UpdateValidatorKeyTx{fee: %v, holder: %v, new holder: %v}", tx.Fee, tx.Holder, tx.NewHolder.Address)
 }
 
 // --------------- Utils --------------- //
@@ -0,0 +1,55 @@
+package types
+
+import (
+	"bytes"
+	"sort"
+)
+
+// The inputs of a SendTx are in canonical order when sorted by address, then by sequence. Otherwise two
+// SendTxs moving the same coins between the same accounts would have different SignBytes and hashes
+// depending on the order their inputs are listed in. The order of the outputs is preserved as the author
+// intends it, e.g. an exchange may match the outputs of a payout to its own records by position, so the
+// outputs are not required to be sorted.
+//
+// The canonical order is enforced starting from common.HeightEnableCanonicalTxInputOrder. Wallets should
+// call NormalizeTx before signing a transaction with several inputs. The transactions signed earlier with
+// unordered inputs remain valid before that height, but need to be normalized and signed again after it.
+
+// compareTxInputs orders the inputs by address, then by sequence
+func compareTxInputs(a, b *TxInput) int {
+	if c := bytes.Compare(a.Address[:], b.Address[:]); c != 0 {
+		return c
+	}
+	switch {
+	case a.Sequence < b.Sequence:
+		return -1
+	case a.Sequence > b.Sequence:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// HasCanonicalInputOrder returns whether the inputs are sorted by address, then by sequence
+func (tx *SendTx) HasCanonicalInputOrder() bool {
+	for i := 1; i < len(tx.Inputs); i++ {
+		if compareTxInputs(&tx.Inputs[i-1], &tx.Inputs[i]) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizeTx puts the transaction in canonical form, i.e. sorts the inputs of a SendTx by address, then by
+// sequence. It returns whether the transaction has changed, in which case its existing signatures are no
+// longer valid and the transaction needs to be signed again.
+func NormalizeTx(tx Tx) bool {
+	sendTx, ok := tx.(*SendTx)
+	if !ok || sendTx.HasCanonicalInputOrder() {
+		return false
+	}
+	sort.SliceStable(sendTx.Inputs, func(i, j int) bool {
+		return compareTxInputs(&sendTx.Inputs[i], &sendTx.Inputs[j]) < 0
+	})
+	return true
+}
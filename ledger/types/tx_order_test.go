@@ -0,0 +1,49 @@
+package types
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+)
+
+func TestNormalizeTx(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	addresses := []common.Address{getTestAddress("a"), getTestAddress("b"), getTestAddress("c")}
+	for i := 1; i < len(addresses); i++ {
+		require.True(bytes.Compare(addresses[i-1][:], addresses[i][:]) < 0)
+	}
+	output := TxOutput{Address: getTestAddress("output"), Coins: NewCoins(6, 0)}
+	newSendTx := func(inputs ...TxInput) *SendTx {
+		return &SendTx{Fee: NewCoins(0, 1), Inputs: inputs, Outputs: []TxOutput{output, output}}
+	}
+
+	// Sorted by address, then by sequence
+	tx := newSendTx(TxInput{Address: addresses[2], Sequence: 1}, TxInput{Address: addresses[0], Sequence: 9},
+		TxInput{Address: addresses[1], Sequence: 3}, TxInput{Address: addresses[0], Sequence: 2})
+	hash := tx.Hash()
+	assert.False(tx.HasCanonicalInputOrder())
+	assert.True(NormalizeTx(tx))
+	assert.True(tx.HasCanonicalInputOrder())
+	assert.NotEqual(hash, tx.Hash())
+	assert.Equal(newSendTx(TxInput{Address: addresses[0], Sequence: 2}, TxInput{Address: addresses[0], Sequence: 9},
+		TxInput{Address: addresses[1], Sequence: 3}, TxInput{Address: addresses[2], Sequence: 1}), tx)
+
+	// The listing order of the inputs does not matter once normalized
+	reordered := newSendTx(tx.Inputs[3], tx.Inputs[1], tx.Inputs[0], tx.Inputs[2])
+	NormalizeTx(reordered)
+	assert.Equal(tx.Hash(), reordered.Hash())
+
+	// Already canonical
+	hash = tx.Hash()
+	assert.False(NormalizeTx(tx))
+	assert.Equal(hash, tx.Hash())
+	assert.True(newSendTx().HasCanonicalInputOrder())
+
+	// The other transactions are left as is
+	assert.False(NormalizeTx(&BurnTx{Source: TxInput{Address: addresses[0]}}))
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -673,6 +674,290 @@ func TestSplitRuleTxProto(t *testing.T) {
 	assert.False(tx2.Initiator.Signature.IsEmpty())
 }
 
+func TestSendTxData(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	privAcc := PrivAccountFromSecret("input1")
+	newSendTx := func(data common.Bytes) *SendTx {
+		tx := &SendTx{
+			Fee:     NewCoins(0, 123),
+			Inputs:  []TxInput{{Address: privAcc.Address, Coins: NewCoins(0, 579), Sequence: 1}},
+			Outputs: []TxOutput{{Address: getTestAddress("output1"), Coins: NewCoins(0, 456)}},
+			Data:    data,
+		}
+		tx.Inputs[0].Signature = privAcc.Sign(tx.SignBytes(chainID))
+		return tx
+	}
+
+	// The encoding of the transactions without a memo is unchanged
+	legacy := struct {
+		Fee     Coins
+		Inputs  []TxInput
+		Outputs []TxOutput
+	}{}
+	tx := newSendTx(nil)
+	legacy.Fee, legacy.Inputs, legacy.Outputs = tx.Fee, tx.Inputs, tx.Outputs
+	legacyBytes, err := rlp.EncodeToBytes(legacy)
+	require.Nil(err)
+	txBytes, err := rlp.EncodeToBytes(tx)
+	require.Nil(err)
+	assert.Equal(legacyBytes, txBytes)
+
+	var decoded SendTx
+	require.Nil(rlp.DecodeBytes(legacyBytes, &decoded))
+	assert.Nil(decoded.Data)
+	assert.Equal(tx.Inputs[0].Signature, decoded.Inputs[0].Signature)
+
+	// The memo is serialized and signed
+	tx = newSendTx(common.Bytes("destination tag 42"))
+	raw, err := TxToBytes(tx)
+	require.Nil(err)
+	decodedTx, err := TxFromBytes(raw)
+	require.Nil(err)
+	assert.Equal(tx.Data, decodedTx.(*SendTx).Data)
+	assert.Equal(tx.Outputs[0].Coins, decodedTx.(*SendTx).Outputs[0].Coins)
+	assert.NotEqual(newSendTx(nil).SignBytes(chainID), tx.SignBytes(chainID))
+
+	s, err := json.Marshal(tx)
+	require.Nil(err)
+	var d SendTx
+	require.Nil(json.Unmarshal(s, &d))
+	assert.Equal(tx.Data, d.Data)
+
+	s, err = json.Marshal(newSendTx(nil))
+	require.Nil(err)
+	assert.NotContains(string(s), "data")
+}
+
+func TestSendTxValidUntilHeight(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	privAcc := PrivAccountFromSecret("input1")
+	newSendTx := func(data common.Bytes, validUntilHeight uint64) *SendTx {
+		tx := &SendTx{
+			Fee:              NewCoins(0, 123),
+			Inputs:           []TxInput{{Address: privAcc.Address, Coins: NewCoins(0, 579), Sequence: 1}},
+			Outputs:          []TxOutput{{Address: getTestAddress("output1"), Coins: NewCoins(0, 456)}},
+			Data:             data,
+			ValidUntilHeight: validUntilHeight,
+		}
+		tx.Inputs[0].Signature = privAcc.Sign(tx.SignBytes(chainID))
+		return tx
+	}
+
+	// The valid-until height is serialized and signed, with or without a memo
+	for _, data := range []common.Bytes{nil, common.Bytes("memo")} {
+		tx := newSendTx(data, 1000)
+		raw, err := TxToBytes(tx)
+		require.Nil(err)
+		decoded, err := TxFromBytes(raw)
+		require.Nil(err)
+		assert.Equal(tx, decoded)
+		assert.NotEqual(newSendTx(data, 0).SignBytes(chainID), tx.SignBytes(chainID))
+		assert.NotEqual(newSendTx(data, 1001).SignBytes(chainID), tx.SignBytes(chainID))
+	}
+
+	// The zero valid-until height is omitted, and rejected if present
+	noExpiry, err := rlp.EncodeToBytes(newSendTx(common.Bytes("memo"), 0))
+	require.Nil(err)
+	withMemo := struct {
+		Fee     Coins
+		Inputs  []TxInput
+		Outputs []TxOutput
+		Data    common.Bytes
+	}{}
+	tx := newSendTx(common.Bytes("memo"), 0)
+	withMemo.Fee, withMemo.Inputs, withMemo.Outputs, withMemo.Data = tx.Fee, tx.Inputs, tx.Outputs, tx.Data
+	withMemoBytes, err := rlp.EncodeToBytes(withMemo)
+	require.Nil(err)
+	assert.Equal(withMemoBytes, noExpiry)
+
+	zeroExpiry := struct {
+		Fee              Coins
+		Inputs           []TxInput
+		Outputs          []TxOutput
+		Data             common.Bytes
+		ValidUntilHeight uint64
+	}{tx.Fee, tx.Inputs, tx.Outputs, tx.Data, 0}
+	zeroExpiryBytes, err := rlp.EncodeToBytes(zeroExpiry)
+	require.Nil(err)
+	var decoded SendTx
+	assert.NotNil(rlp.DecodeBytes(zeroExpiryBytes, &decoded))
+
+	assert.False(newSendTx(nil, 0).IsExpiredAt(1 << 60))
+	assert.False(newSendTx(nil, 100).IsExpiredAt(99))
+	assert.False(newSendTx(nil, 100).IsExpiredAt(100))
+	assert.True(newSendTx(nil, 100).IsExpiredAt(101))
+
+	s, err := json.Marshal(newSendTx(nil, 1000))
+	require.Nil(err)
+	assert.Contains(string(s), `"valid_until_height":"1000"`)
+	var d SendTx
+	require.Nil(json.Unmarshal(s, &d))
+	assert.Equal(uint64(1000), d.ValidUntilHeight)
+
+	s, err = json.Marshal(newSendTx(nil, 0))
+	require.Nil(err)
+	assert.NotContains(string(s), "valid_until_height")
+}
+
+func TestDepositStakeTxIdempotencyNonce(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	privAcc := PrivAccountFromSecret("source1")
+	newDepositStakeTx := func(sequence uint64, nonce uint64) *DepositStakeTx {
+		tx := &DepositStakeTx{
+			Fee:              NewCoins(0, 123),
+			Source:           TxInput{Address: privAcc.Address, Coins: NewCoins(1000, 0), Sequence: sequence},
+			Holder:           TxOutput{Address: getTestAddress("holder1")},
+			Purpose:          0,
+			IdempotencyNonce: nonce,
+		}
+		tx.Source.Signature = privAcc.Sign(tx.SignBytes(chainID))
+		return tx
+	}
+
+	// The nonce is serialized and signed
+	tx := newDepositStakeTx(1, 42)
+	raw, err := TxToBytes(tx)
+	require.Nil(err)
+	decoded, err := TxFromBytes(raw)
+	require.Nil(err)
+	assert.Equal(tx.Hash(), decoded.Hash())
+	assert.Equal(uint64(42), decoded.(*DepositStakeTx).IdempotencyNonce)
+	assert.NotEqual(newDepositStakeTx(1, 0).SignBytes(chainID), tx.SignBytes(chainID))
+	assert.NotEqual(newDepositStakeTx(1, 43).SignBytes(chainID), tx.SignBytes(chainID))
+
+	// A retry with a new sequence is a different transaction carrying the same nonce
+	retry := newDepositStakeTx(2, 42)
+	assert.NotEqual(tx.Hash(), retry.Hash())
+	assert.Equal(tx.IdempotencyNonce, retry.IdempotencyNonce)
+
+	// Without it the encoding is the legacy one
+	tx = newDepositStakeTx(1, 0)
+	legacy := struct {
+		Fee     Coins
+		Source  TxInput
+		Holder  TxOutput
+		Purpose uint8
+	}{tx.Fee, tx.Source, tx.Holder, tx.Purpose}
+	legacyBytes, err := rlp.EncodeToBytes(legacy)
+	require.Nil(err)
+	encoded, err := rlp.EncodeToBytes(tx)
+	require.Nil(err)
+	assert.Equal(legacyBytes, encoded)
+
+	// The zero nonce is omitted when encoding, so an explicit one is not canonical
+	withZero := struct {
+		Fee     Coins
+		Source  TxInput
+		Holder  TxOutput
+		Purpose uint8
+		Nonce   uint64
+	}{tx.Fee, tx.Source, tx.Holder, tx.Purpose, 0}
+	withZeroBytes, err := rlp.EncodeToBytes(withZero)
+	require.Nil(err)
+	var d DepositStakeTx
+	assert.NotNil(rlp.DecodeBytes(withZeroBytes, &d))
+
+	tooLong := struct {
+		Fee     Coins
+		Source  TxInput
+		Holder  TxOutput
+		Purpose uint8
+		A, B    uint64
+	}{tx.Fee, tx.Source, tx.Holder, tx.Purpose, 42, 43}
+	tooLongBytes, err := rlp.EncodeToBytes(tooLong)
+	require.Nil(err)
+	assert.NotNil(rlp.DecodeBytes(tooLongBytes, &d))
+
+	s, err := json.Marshal(newDepositStakeTx(1, 42))
+	require.Nil(err)
+	assert.Contains(string(s), `"idempotency_nonce":"42"`)
+	d = DepositStakeTx{}
+	require.Nil(json.Unmarshal(s, &d))
+	assert.Equal(uint64(42), d.IdempotencyNonce)
+
+	s, err = json.Marshal(newDepositStakeTx(1, 0))
+	require.Nil(err)
+	assert.NotContains(string(s), "idempotency_nonce")
+}
+
+func TestWithdrawStakeTxReturnAddress(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	privAcc := PrivAccountFromSecret("source1")
+	newWithdrawStakeTx := func(returnAddress *common.Address) *WithdrawStakeTx {
+		tx := &WithdrawStakeTx{
+			Fee:           NewCoins(0, 123),
+			Source:        TxInput{Address: privAcc.Address, Sequence: 1},
+			Holder:        TxOutput{Address: getTestAddress("holder1")},
+			Purpose:       0,
+			ReturnAddress: returnAddress,
+		}
+		tx.Source.Signature = privAcc.Sign(tx.SignBytes(chainID))
+		return tx
+	}
+	returnAddress := getTestAddress("cold1")
+
+	// The return address is serialized and signed
+	tx := newWithdrawStakeTx(&returnAddress)
+	raw, err := TxToBytes(tx)
+	require.Nil(err)
+	decoded, err := TxFromBytes(raw)
+	require.Nil(err)
+	assert.Equal(tx.Hash(), decoded.Hash())
+	require.NotNil(decoded.(*WithdrawStakeTx).ReturnAddress)
+	assert.Equal(returnAddress, *decoded.(*WithdrawStakeTx).ReturnAddress)
+	assert.Equal(returnAddress, tx.ReturnTo())
+	assert.NotEqual(newWithdrawStakeTx(nil).SignBytes(chainID), tx.SignBytes(chainID))
+	otherAddress := getTestAddress("cold2")
+	assert.NotEqual(newWithdrawStakeTx(&otherAddress).SignBytes(chainID), tx.SignBytes(chainID))
+
+	// Without it the encoding is the legacy one, and the stake returns to the source
+	tx = newWithdrawStakeTx(nil)
+	legacy := struct {
+		Fee     Coins
+		Source  TxInput
+		Holder  TxOutput
+		Purpose uint8
+	}{tx.Fee, tx.Source, tx.Holder, tx.Purpose}
+	legacyBytes, err := rlp.EncodeToBytes(legacy)
+	require.Nil(err)
+	encoded, err := rlp.EncodeToBytes(tx)
+	require.Nil(err)
+	assert.Equal(legacyBytes, encoded)
+	assert.Equal(privAcc.Address, tx.ReturnTo())
+
+	tooLong := struct {
+		Fee     Coins
+		Source  TxInput
+		Holder  TxOutput
+		Purpose uint8
+		A, B    common.Address
+	}{tx.Fee, tx.Source, tx.Holder, tx.Purpose, returnAddress, returnAddress}
+	tooLongBytes, err := rlp.EncodeToBytes(tooLong)
+	require.Nil(err)
+	var d WithdrawStakeTx
+	assert.NotNil(rlp.DecodeBytes(tooLongBytes, &d))
+
+	s, err := json.Marshal(newWithdrawStakeTx(&returnAddress))
+	require.Nil(err)
+	assert.Contains(string(s), `"return_address":"`+strings.ToLower(returnAddress.Hex())+`"`)
+	d = WithdrawStakeTx{}
+	require.Nil(json.Unmarshal(s, &d))
+	require.NotNil(d.ReturnAddress)
+	assert.Equal(returnAddress, *d.ReturnAddress)
+
+	s, err = json.Marshal(newWithdrawStakeTx(nil))
+	require.Nil(err)
+	assert.NotContains(string(s), "return_address")
+}
+
 func TestCoinbaseTxJSON(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -787,3 +1072,37 @@ func TestSmartContractTxJSON(t *testing.T) {
 	assert.Equal(uint64(math.MaxUint64), d.GasLimit)
 	assert.Equal(0, gasPrice.Cmp(d.GasPrice))
 }
+
+// The sign bytes of every tx type, including the ones added later, need to be bound to the chain ID
+func TestTxSignBytesChainID(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	signBytesFuncs := func(tx Tx) []func(chainID string) []byte {
+		if spTx, ok := tx.(*ServicePaymentTx); ok {
+			return []func(chainID string) []byte{spTx.SourceSignBytes, spTx.TargetSignBytes}
+		}
+		return []func(chainID string) []byte{tx.SignBytes}
+	}
+
+	numTypes := 0
+	for txType := TxCoinbase; ; txType++ {
+		tx, err := newTxOfType(txType)
+		if err != nil {
+			break
+		}
+		numTypes++
+
+		for _, signBytes := range signBytesFuncs(tx) {
+			testnetBytes, mainnetBytes := signBytes("testnet"), signBytes("mainnet")
+			assert.NotEqual(testnetBytes, mainnetBytes, "%T", tx)
+
+			// Derived from the shared helper, thus prefixed with the chain ID
+			assert.Equal(chainSignBytes("testnet", tx), testnetBytes, "%T", tx)
+			var wrapper EthereumTxWrapper
+			require.Nil(rlp.DecodeBytes(testnetBytes, &wrapper), "%T", tx)
+			assert.Equal(encodeToBytes("testnet"), wrapper.Payload[:len(encodeToBytes("testnet"))], "%T", tx)
+		}
+	}
+	assert.Equal(int(TxUpdateValidatorKey)+1, numTypes)
+}
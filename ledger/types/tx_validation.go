@@ -0,0 +1,316 @@
+package types
+
+import (
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+)
+
+// The Validate methods check the invariants of the transactions that do not depend on the state, so that
+// a malformed transaction, e.g. one constructed programmatically with a nil fee, is rejected with a result
+// code before it reaches the executor. The nil components of the transferred coins are taken as zero, as
+// in TxInput.ValidateBasic, but the fee and the gas price need to be set.
+
+func (tx *CoinbaseTx) Validate() result.Result {
+	if res := validateInput(tx.Proposer); res.IsError() {
+		return res
+	}
+	return validateOutputs(tx.Outputs)
+}
+
+func (tx *SlashTx) Validate() result.Result {
+	if res := validateInput(tx.Proposer); res.IsError() {
+		return res
+	}
+	return validateAddress(tx.SlashedAddress, "slashed")
+}
+
+func (tx *SendTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	for _, in := range tx.PayingInputs() {
+		if res := validateSignerInput(in); res.IsError() {
+			return res
+		}
+	}
+	return validateOutputs(tx.Outputs)
+}
+
+func (tx *ReserveFundTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	if res := validateSignerInput(tx.Source); res.IsError() {
+		return res
+	}
+	return validateCoins(tx.Collateral, "collateral")
+}
+
+func (tx *ReleaseFundTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	return validateSignerInput(tx.Source)
+}
+
+func (tx *ServicePaymentTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	if res := validateInput(tx.Source); res.IsError() {
+		return res
+	}
+	return validateSignerInput(tx.Target) // the target submits the payment and pays the fee
+}
+
+func (tx *SplitRuleTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	if res := validateSignerInput(tx.Initiator); res.IsError() {
+		return res
+	}
+	for _, split := range tx.Splits {
+		if res := validateAddress(split.Address, "split"); res.IsError() {
+			return res
+		}
+	}
+	return result.OK
+}
+
+func (tx *SmartContractTx) Validate() result.Result {
+	if tx.GasPrice == nil || tx.GasPrice.Sign() < 0 {
+		return result.Error("Invalid gas price: %v", tx.GasPrice).WithErrorCode(result.CodeInvalidGasPrice)
+	}
+	if res := validateSignerInput(tx.From); res.IsError() {
+		return res
+	}
+	// The zero address deploys a new contract
+	if len(tx.To.Address) != 20 {
+		return result.Error("Invalid address length").WithErrorCode(result.CodeInvalidAddress)
+	}
+	return validateCoins(tx.To.Coins, "value")
+}
+
+func (tx *DepositStakeTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	if res := validateSignerInput(tx.Source); res.IsError() {
+		return res
+	}
+	if res := validateAddress(tx.Holder.Address, "holder"); res.IsError() {
+		return res
+	}
+	return validateStakePurpose(tx.Purpose)
+}
+
+func (tx *WithdrawStakeTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	if res := validateSignerInput(tx.Source); res.IsError() {
+		return res
+	}
+	if res := validateAddress(tx.Holder.Address, "holder"); res.IsError() {
+		return res
+	}
+	return validateStakePurpose(tx.Purpose)
+}
+
+func (tx *UpdateMultisigTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	return validateSignerInput(tx.Account)
+}
+
+func (tx *PartialReleaseFundTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	if res := validateSignerInput(tx.Source); res.IsError() {
+		return res
+	}
+	if res := validateInput(tx.Target); res.IsError() {
+		return res
+	}
+	return validateCoins(tx.Amount, "amount")
+}
+
+func (tx *ExtendSplitRuleTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	return validateSignerInput(tx.Initiator)
+}
+
+func (tx *SweepAccountTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	if res := validateSignerInput(tx.Source); res.IsError() {
+		return res
+	}
+	if tx.Target == (common.Address{}) {
+		return result.Error("Cannot sweep to the zero address, use a BurnTx to burn coins").
+			WithErrorCode(result.CodeSendToZeroAddress)
+	}
+	return result.OK
+}
+
+func (tx *BurnTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	return validateSignerInput(tx.Source)
+}
+
+func (tx *DoubleSignSlashTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	if res := validateSignerInput(tx.Reporter); res.IsError() {
+		return res
+	}
+	if len(tx.Evidence) == 0 {
+		return result.Error("The evidence is missing").WithErrorCode(result.CodeInvalidDoubleSignEvidence)
+	}
+	return result.OK
+}
+
+func (tx *StakeCommissionTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	if res := validateSignerInput(tx.Holder); res.IsError() {
+		return res
+	}
+	if tx.Commission > MaxStakeCommission {
+		return result.Error("The commission %v%% exceeds %v%%", tx.Commission, MaxStakeCommission).
+			WithErrorCode(result.CodeInvalidStakeCommission)
+	}
+	return result.OK
+}
+
+func (tx *CancelWithdrawTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	if res := validateSignerInput(tx.Source); res.IsError() {
+		return res
+	}
+	return validateAddress(tx.Holder.Address, "holder")
+}
+
+func (tx *UpdateValidatorMetadataTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	if res := validateSignerInput(tx.Holder); res.IsError() {
+		return res
+	}
+	return tx.Metadata.Validate()
+}
+
+func (tx *UnjailTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	return validateSignerInput(tx.Holder)
+}
+
+func (tx *EjectStakeTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	if res := validateSignerInput(tx.Holder); res.IsError() {
+		return res
+	}
+	if res := validateAddress(tx.Source.Address, "source"); res.IsError() {
+		return res
+	}
+	return validateStakePurpose(tx.Purpose)
+}
+
+func (tx *UpdateValidatorKeyTx) Validate() result.Result {
+	if res := validateFee(tx.Fee); res.IsError() {
+		return res
+	}
+	if res := validateSignerInput(tx.Holder); res.IsError() {
+		return res
+	}
+	if res := validateInput(tx.NewHolder); res.IsError() {
+		return res
+	}
+	if tx.NewHolder.Address == tx.Holder.Address {
+		return result.Error("The new holder needs to differ from the holder %v", tx.Holder.Address.Hex()).
+			WithErrorCode(result.CodeInvalidNewValidatorKey)
+	}
+	return result.OK
+}
+
+// validateFee checks that both components of the fee are set and non-negative
+func validateFee(fee Coins) result.Result {
+	if fee.ThetaWei == nil || fee.TFuelWei == nil {
+		return result.Error("The fee needs to be set: %v", fee).WithErrorCode(result.CodeInvalidFee)
+	}
+	if !fee.IsValid() {
+		return result.Error("Invalid fee: %v", fee).WithErrorCode(result.CodeInvalidFee)
+	}
+	return result.OK
+}
+
+// validateCoins checks that the coins are non-negative, the nil components are taken as zero
+func validateCoins(coins Coins, name string) result.Result {
+	if !coins.NoNil().IsValid() {
+		return result.Error("Invalid %v: %v", name, coins).WithErrorCode(result.CodeInvalidCoins)
+	}
+	return result.OK
+}
+
+func validateAddress(address common.Address, name string) result.Result {
+	if address == (common.Address{}) {
+		return result.Error("The %v address cannot be the zero address", name).WithErrorCode(result.CodeInvalidAddress)
+	}
+	return result.OK
+}
+
+// validateInput checks an input that is not charged for the transaction, e.g. the counterparty of a payment
+func validateInput(in TxInput) result.Result {
+	if res := in.ValidateBasic(); res.IsError() {
+		return res
+	}
+	return validateAddress(in.Address, "input")
+}
+
+// validateSignerInput checks an input whose account sequence the transaction increments
+func validateSignerInput(in TxInput) result.Result {
+	if res := validateInput(in); res.IsError() {
+		return res
+	}
+	if in.Sequence == 0 {
+		return result.Error("The sequence of %v needs to be positive", in.Address.Hex()).
+			WithErrorCode(result.CodeSequenceTooLow)
+	}
+	return result.OK
+}
+
+func validateOutputs(outs []TxOutput) result.Result {
+	for _, out := range outs {
+		if res := out.ValidateBasic(); res.IsError() {
+			return res
+		}
+	}
+	return result.OK
+}
+
+// validateStakePurpose checks that the purpose is registered, whether it is active at the height of the
+// block is checked by the executor
+func validateStakePurpose(purpose uint8) result.Result {
+	if !core.IsKnownStakePurpose(purpose) {
+		return result.Error("Invalid stake purpose: %v", purpose).WithErrorCode(result.CodeInvalidStakePurpose)
+	}
+	return result.OK
+}
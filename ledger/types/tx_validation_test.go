@@ -0,0 +1,80 @@
+package types
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+)
+
+func TestTxValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	// The canonical test txs are well formed
+	for name, tx := range canonicalTestTxs() {
+		res := tx.Validate()
+		assert.True(res.IsOK(), "%v: %v", name, res.Message)
+	}
+
+	source := TxInput{Address: getTestAddress("source"), Sequence: 1}
+	holder := TxOutput{Address: getTestAddress("holder")}
+	fee := NewCoins(0, 1000000000000)
+
+	// The unset amounts are taken as zero, the unset fee and gas price are rejected
+	assert.True((&WithdrawStakeTx{Fee: fee, Source: source, Holder: holder}).Validate().IsOK())
+
+	testCases := []struct {
+		name string
+		tx   Tx
+		code result.ErrorCode
+	}{
+		{"nil fee", &ReleaseFundTx{Source: source, ReserveSequence: 1}, result.CodeInvalidFee},
+		{"nil fee component", &ReleaseFundTx{Fee: Coins{TFuelWei: big.NewInt(1)}, Source: source}, result.CodeInvalidFee},
+		{"negative fee", &ReleaseFundTx{Fee: NewCoins(0, -1), Source: source}, result.CodeInvalidFee},
+		{"nil gas price", &SmartContractTx{From: source, To: holder, GasLimit: 100000}, result.CodeInvalidGasPrice},
+		{"negative coins", &SendTx{Fee: fee, Inputs: []TxInput{{Address: source.Address, Coins: NewCoins(-1, 0), Sequence: 1}}},
+			result.CodeInvalidCoins},
+		{"negative collateral", &ReserveFundTx{Fee: fee, Source: source, Collateral: NewCoins(0, -1)}, result.CodeInvalidCoins},
+		{"zero sequence", &BurnTx{Fee: fee, Source: TxInput{Address: source.Address}}, result.CodeSequenceTooLow},
+		{"zero input address", &UpdateMultisigTx{Fee: fee, Account: TxInput{Sequence: 1}}, result.CodeInvalidAddress},
+		{"zero holder address", &DepositStakeTx{Fee: fee, Source: source}, result.CodeInvalidAddress},
+		{"zero cancel holder address", &CancelWithdrawTx{Fee: fee, Source: source}, result.CodeInvalidAddress},
+		{"zero split address", &SplitRuleTx{Fee: fee, Initiator: source, Splits: []Split{{Percentage: 10}}},
+			result.CodeInvalidAddress},
+		{"zero sweep target", &SweepAccountTx{Fee: fee, Source: source}, result.CodeSendToZeroAddress},
+		{"stake purpose", &WithdrawStakeTx{Fee: fee, Source: source, Holder: holder, Purpose: 2}, result.CodeInvalidStakePurpose},
+		{"stake commission", &StakeCommissionTx{Fee: fee, Holder: source, Commission: 101}, result.CodeInvalidStakeCommission},
+		{"validator name length", &UpdateValidatorMetadataTx{Fee: fee, Holder: source,
+			Metadata: ValidatorMetadata{Name: strings.Repeat("n", MaxValidatorNameLength+1)}}, result.CodeInvalidValidatorMetadata},
+		{"validator website utf8", &UpdateValidatorMetadataTx{Fee: fee, Holder: source,
+			Metadata: ValidatorMetadata{Website: "https://\xff.example"}}, result.CodeInvalidValidatorMetadata},
+		{"validator security contact length", &UpdateValidatorMetadataTx{Fee: fee, Holder: source,
+			Metadata: ValidatorMetadata{SecurityContact: strings.Repeat("é", MaxValidatorSecurityContactLength/2+1)}},
+			result.CodeInvalidValidatorMetadata},
+		{"zero unjail holder address", &UnjailTx{Fee: fee, Holder: TxInput{Sequence: 1}}, result.CodeInvalidAddress},
+		{"zero ejected source address", &EjectStakeTx{Fee: fee, Holder: source}, result.CodeInvalidAddress},
+		{"zero new holder address", &UpdateValidatorKeyTx{Fee: fee, Holder: source}, result.CodeInvalidAddress},
+		{"same new holder address", &UpdateValidatorKeyTx{Fee: fee, Holder: source, NewHolder: TxInput{Address: source.Address}},
+			result.CodeInvalidNewValidatorKey},
+		{"service payment target", &ServicePaymentTx{Fee: fee, Source: source, Target: TxInput{Address: getTestAddress("target")}},
+			result.CodeSequenceTooLow},
+	}
+	for _, tc := range testCases {
+		assert.Equal(tc.code, tc.tx.Validate().Code, tc.name)
+	}
+
+	// The caps are in bytes, and the empty metadata clears it
+	metadata := ValidatorMetadata{Name: strings.Repeat("é", MaxValidatorNameLength/2), Website: "https://example.org"}
+	assert.True((&UpdateValidatorMetadataTx{Fee: fee, Holder: source, Metadata: metadata}).Validate().IsOK())
+	assert.True((&UpdateValidatorMetadataTx{Fee: fee, Holder: source}).Validate().IsOK())
+
+	// The outputs to the zero address are well formed, the executor rejects them from common.HeightEnableBurn
+	assert.True((&SendTx{Fee: fee, Inputs: []TxInput{source}, Outputs: []TxOutput{{}}}).Validate().IsOK())
+
+	// The zero address deploys a contract
+	tx := &SmartContractTx{From: source, To: TxOutput{Address: common.Address{}}, GasLimit: 100000, GasPrice: big.NewInt(1)}
+	assert.True(tx.Validate().IsOK())
+}
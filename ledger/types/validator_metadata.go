@@ -0,0 +1,43 @@
+package types
+
+import (
+	"unicode/utf8"
+
+	"github.com/thetatoken/theta/common/result"
+)
+
+// ValidatorMetadata is the self-reported description of a stake holder, for the explorers to show along with
+// its address. It is set by the holder with an UpdateValidatorMetadataTx.
+type ValidatorMetadata struct {
+	Name            string `json:"name"`
+	Website         string `json:"website"`
+	SecurityContact string `json:"security_contact"`
+}
+
+// IsEmpty returns whether none of the fields is set
+func (m ValidatorMetadata) IsEmpty() bool {
+	return m.Name == "" && m.Website == "" && m.SecurityContact == ""
+}
+
+// Validate checks that the fields are valid UTF-8 within their length caps
+func (m ValidatorMetadata) Validate() result.Result {
+	fields := []struct {
+		name      string
+		value     string
+		maxLength int
+	}{
+		{"name", m.Name, MaxValidatorNameLength},
+		{"website", m.Website, MaxValidatorWebsiteLength},
+		{"security contact", m.SecurityContact, MaxValidatorSecurityContactLength},
+	}
+	for _, field := range fields {
+		if len(field.value) > field.maxLength {
+			return result.Error("The %v is %v bytes long, at most %v bytes are allowed", field.name, len(field.value), field.maxLength).
+				WithErrorCode(result.CodeInvalidValidatorMetadata)
+		}
+		if !utf8.ValidString(field.value) {
+			return result.Error("The %v is not valid UTF-8", field.name).WithErrorCode(result.CodeInvalidValidatorMetadata)
+		}
+	}
+	return result.OK
+}
@@ -0,0 +1,155 @@
+package ledger
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/consensus"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/kvstore"
+	"github.com/thetatoken/theta/store/trie"
+)
+
+const validatorSetExportVersion = byte(1)
+
+// ValidatorSetExport is the validator set of a finalized block, along with the proof of the state entries it is
+// derived from. The validator set of a block is selected from the state of its ancestor ValidatorSetUpdateDelay HCC
+// links up, so the proof is against the state root of that ancestor, at StateHeight.
+type ValidatorSetExport struct {
+	BlockHash   common.Hash
+	Height      uint64
+	StateHeight uint64
+	StateRoot   common.Hash
+	Validators  []ValidatorSetExportEntry // ordered by address, like core.ValidatorSet
+	Proof       core.VCPProof             // the trie nodes of the validatorSetStateKeys, present or not
+}
+
+// ValidatorSetExportEntry is a validator and its stake weight
+type ValidatorSetExportEntry struct {
+	Address common.Address
+	Stake   *big.Int
+}
+
+//
+// The wire format of an exported validator set is a version byte, currently 1, followed by the RLP encoding of the
+// ValidatorSetExport. The set is the top stake holders of the candidate pool out of jail, up to the max number of
+// validators, all three read off the entries proven against the state root, so it is verified without a node.
+//
+
+// validatorSetStateKeys returns the keys of the state entries the validator set is selected from
+func validatorSetStateKeys() []common.Bytes {
+	return []common.Bytes{
+		state.ValidatorCandidatePoolKey(),
+		state.ValidatorLivenessKey(),
+		state.MaxNumValidatorsKey(),
+	}
+}
+
+// ExportValidatorSet returns the validator set of the finalized block in the wire format, with the proof of the
+// state entries it is selected from. It returns an error if the block is not finalized, or if the state the set
+// is selected from has been pruned.
+func (ledger *Ledger) ExportValidatorSet(blockHash common.Hash) ([]byte, error) {
+	block, err := findBlock(kvstore.NewKVStore(ledger.state.DB()), blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil || !block.Status.IsFinalized() {
+		return nil, fmt.Errorf("Block %v is not finalized", blockHash.Hex())
+	}
+
+	sv, err := ledger.getFinalizedStoreView(blockHash, false)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &ValidatorSetExport{
+		BlockHash:   blockHash,
+		Height:      block.Height,
+		StateHeight: sv.Height(),
+		StateRoot:   sv.Hash(),
+	}
+	for _, key := range validatorSetStateKeys() {
+		if err := sv.ProveVCP(key, &export.Proof); err != nil {
+			return nil, fmt.Errorf("Failed to prove the state entry %v: %v", string(key), err)
+		}
+	}
+	vcp := sv.GetValidatorLivenessTracker().ExcludeJailed(sv.GetValidatorCandidatePool())
+	valSet := consensus.SelectTopStakeHoldersAsValidatorsWithLimit(vcp, sv.GetMaxNumValidators())
+	for _, validator := range valSet.Validators() {
+		export.Validators = append(export.Validators, ValidatorSetExportEntry{
+			Address: validator.Address,
+			Stake:   validator.Stake,
+		})
+	}
+
+	data, err := rlp.EncodeToBytes(export)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{validatorSetExportVersion}, data...), nil
+}
+
+// VerifyValidatorSet decodes the exported validator set, checks its proof against the state root, and checks
+// that the validators are the ones selected from the proven state entries. The state root is the one of the block
+// at the StateHeight of the export, which the caller gets from the block headers it trusts.
+func VerifyValidatorSet(blob []byte, stateRoot common.Hash) (*ValidatorSetExport, *core.ValidatorSet, error) {
+	if len(blob) == 0 {
+		return nil, nil, fmt.Errorf("Empty validator set export")
+	}
+	if blob[0] != validatorSetExportVersion {
+		return nil, nil, fmt.Errorf("Unsupported validator set export version: %v", blob[0])
+	}
+	export := &ValidatorSetExport{}
+	if err := rlp.DecodeBytes(blob[1:], export); err != nil {
+		return nil, nil, fmt.Errorf("Failed to decode the validator set export: %v", err)
+	}
+	if export.StateRoot != stateRoot {
+		return nil, nil, fmt.Errorf("The export is for state root %v, not %v", export.StateRoot.Hex(), stateRoot.Hex())
+	}
+
+	entries := [][]byte{}
+	for _, key := range validatorSetStateKeys() {
+		value, _, err := trie.VerifyProof(stateRoot, key, &export.Proof)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid proof of the state entry %v: %v", string(key), err)
+		}
+		entries = append(entries, value)
+	}
+
+	// Decoded the same way as the StoreView getters, the absent entries take their default values
+	vcp := &core.ValidatorCandidatePool{}
+	if len(entries[0]) > 0 {
+		if err := types.FromBytes(entries[0], vcp); err != nil {
+			return nil, nil, fmt.Errorf("Failed to decode the validator candidate pool: %v", err)
+		}
+	}
+	vlt := &core.ValidatorLivenessTracker{}
+	if len(entries[1]) > 0 {
+		if err := types.FromBytes(entries[1], vlt); err != nil {
+			return nil, nil, fmt.Errorf("Failed to decode the validator liveness tracker: %v", err)
+		}
+	}
+	maxNumValidators := uint64(core.DefaultMaxNumValidators)
+	if len(entries[2]) > 0 {
+		if err := types.FromBytes(entries[2], &maxNumValidators); err != nil {
+			return nil, nil, fmt.Errorf("Failed to decode the max number of validators: %v", err)
+		}
+	}
+
+	valSet := consensus.SelectTopStakeHoldersAsValidatorsWithLimit(vlt.ExcludeJailed(vcp), int(maxNumValidators))
+	validators := valSet.Validators()
+	if len(validators) != len(export.Validators) {
+		return nil, nil, fmt.Errorf("The export lists %v validators, the state selects %v", len(export.Validators), len(validators))
+	}
+	for i, validator := range validators {
+		entry := export.Validators[i]
+		if entry.Address != validator.Address || entry.Stake.Cmp(validator.Stake) != 0 {
+			return nil, nil, fmt.Errorf("The validator %v of the export does not match the state", entry.Address.Hex())
+		}
+	}
+	return export, valSet, nil
+}
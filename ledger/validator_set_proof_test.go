@@ -0,0 +1,101 @@
+package ledger
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestLedgerExportValidatorSet(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID := "test_chain_001"
+	db := backend.NewMemDatabase()
+
+	snapshot, _, valPrivAccs := genSimSnapshot(chainID, db)
+	es := newExecSim(chainID, db, snapshot, valPrivAccs[0])
+	ledger := es.consensus.GetLedger().(*Ledger)
+
+	addBlock := func(parent *core.Block) *core.Block {
+		block := core.NewBlock()
+		block.ChainID = chainID
+		block.Height = parent.Height + 1
+		block.Epoch = parent.Epoch + 1
+		block.Parent = parent.Hash()
+		block.HCC.BlockHash = block.Parent
+		block.StateHash = es.state.Commit()
+		es.addBlock(block)
+		return block
+	}
+
+	// A validator is jailed, and the max number of validators leaves another one out
+	view := es.state.Delivered()
+	vlt := &core.ValidatorLivenessTracker{}
+	jailed := valPrivAccs[1].Address
+	for height := uint64(1); height <= core.MaxMissedBlocksInWindow+1; height++ {
+		vlt.RecordBlock(height, []common.Address{jailed, valPrivAccs[0].Address}, map[common.Address]bool{valPrivAccs[0].Address: true})
+	}
+	require.True(vlt.IsJailed(jailed))
+	view.UpdateValidatorLivenessTracker(vlt)
+	numCandidates := len(view.GetValidatorCandidatePool().SortedCandidates)
+	view.UpdateMaxNumValidators(numCandidates - 2)
+
+	b0 := es.getTipBlock().Block
+	b1 := addBlock(b0)
+	b2 := addBlock(b1)
+	b3 := addBlock(b2)
+
+	// Only the finalized blocks are exported
+	_, err := ledger.ExportValidatorSet(b3.Hash())
+	assert.NotNil(err)
+	require.Nil(es.chain.FinalizePreviousBlocks(b3.Hash()))
+	blob, err := ledger.ExportValidatorSet(b3.Hash())
+	require.Nil(err)
+
+	// The export verifies against the state root of the block the set is selected from, and matches the set of
+	// the validator manager
+	var stateRoot common.Hash
+	for _, block := range es.findBlocksByHeight(b1.Height) {
+		stateRoot = block.StateHash
+	}
+	export, valSet, err := VerifyValidatorSet(blob, stateRoot)
+	require.Nil(err)
+	assert.Equal(b3.Hash(), export.BlockHash)
+	assert.Equal(b3.Height, export.Height)
+	assert.Equal(b1.Height, export.StateHeight)
+	expected := es.consensus.GetValidatorManager().GetValidatorSet(b3.Hash())
+	assert.True(expected.Equals(valSet), "%v vs %v", expected, valSet)
+	assert.Equal(numCandidates-2, valSet.Size())
+	_, err = valSet.GetValidator(jailed)
+	assert.NotNil(err)
+
+	// A different state root, a tampered validator set or an unknown version is rejected
+	_, _, err = VerifyValidatorSet(blob, b0.StateHash)
+	assert.NotNil(err)
+
+	tampered := &ValidatorSetExport{}
+	require.Nil(rlp.DecodeBytes(blob[1:], tampered))
+	tampered.Validators[0].Stake = new(big.Int).Add(tampered.Validators[0].Stake, big.NewInt(1))
+	data, err := rlp.EncodeToBytes(tampered)
+	require.Nil(err)
+	_, _, err = VerifyValidatorSet(append([]byte{validatorSetExportVersion}, data...), stateRoot)
+	assert.NotNil(err)
+
+	tampered = &ValidatorSetExport{}
+	require.Nil(rlp.DecodeBytes(blob[1:], tampered))
+	tampered.Proof = core.VCPProof{}
+	data, err = rlp.EncodeToBytes(tampered)
+	require.Nil(err)
+	_, _, err = VerifyValidatorSet(append([]byte{validatorSetExportVersion}, data...), stateRoot)
+	assert.NotNil(err)
+
+	_, _, err = VerifyValidatorSet(append([]byte{validatorSetExportVersion + 1}, blob[1:]...), stateRoot)
+	assert.NotNil(err)
+}
@@ -0,0 +1,133 @@
+package ledger
+
+import (
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+// BlockVerificationResult holds the outcome of the dry-run execution of a proposed block's transactions
+type BlockVerificationResult struct {
+	Height    uint64             // Height of the committed state the transactions were executed on
+	StateRoot common.Hash        // Resulting state root, only set if all the transactions succeed
+	Receipts  []*types.TxReceipt // Execution results of the transactions, in the block order
+	Failures  []int              // Indices of the failed transactions
+}
+
+// VerifyBlockTxs executes the transactions of a proposed block on top of the latest committed state,
+// i.e. the state of the block it extends, and checks the resulting state root against the expected
+// one. Everything is executed against a scratch checkout and discarded afterwards, so neither the
+// delivered state nor the checked and screened views the mempool relies on are touched. It does not
+// acquire the ledger lock, and is safe to run concurrently with the mempool screening and the block
+// application.
+//
+// Unlike the block application, the execution continues after a failed transaction, so that all the
+// failures are reported. The state root is only compared if all the transactions succeed.
+func (ledger *Ledger) VerifyBlockTxs(rawTxs []common.Bytes, expectedStateRoot common.Hash) (verification *BlockVerificationResult, res result.Result) {
+	view := ledger.state.Committed()
+	if view == nil {
+		return nil, result.Error("Failed to load the committed state").WithErrorCode(result.CodeInternalStoreError)
+	}
+	height, stateRoot := view.Height(), view.Hash()
+
+	block := &core.Block{
+		BlockHeader: &core.BlockHeader{
+			ChainID:   ledger.state.GetChainID(),
+			Epoch:     ledger.consensus.GetEpoch(),
+			Height:    height + 1,
+			Parent:    ledger.findCommittedBlockHash(height, stateRoot),
+			StateHash: expectedStateRoot,
+		},
+		Txs: rawTxs,
+	}
+	consensus := &reproConsensusEngine{block: block}
+	scratch, err := newScratchLedger(block.ChainID, ledger.state.DB(), height, stateRoot, consensus, ledger.valMgr,
+		ledger.executor.RewardSchedule())
+	if err != nil {
+		return nil, result.Error("Failed to checkout the committed state: %v", err).
+			WithErrorCode(result.CodeInternalStoreError)
+	}
+	consensus.ledger = scratch
+	scratch.currentBlock = block
+
+	defer func() {
+		if r := recover(); r != nil {
+			res = result.Error("%v", panicFailure(r))
+		}
+	}()
+
+	verification = &BlockVerificationResult{
+		Height:   height,
+		Receipts: []*types.TxReceipt{},
+		Failures: []int{},
+	}
+	if res := checkDuplicateTxs(rawTxs); res.IsError() {
+		return verification, res
+	}
+	if res := checkBlockTxSizes(rawTxs, view); res.IsError() {
+		return verification, res
+	}
+
+	firstFailure := result.OK
+	txs := []types.Tx{}
+	for i, rawTx := range rawTxs {
+		txHash := crypto.Keccak256Hash(rawTx)
+		var txRes result.Result
+		tx, err := decodeBlockTx(rawTx, block.Height)
+		if err != nil {
+			tx = nil // might be partially decoded
+			txRes = result.Error("Failed to parse transaction: %v", err)
+		} else {
+			if coinbaseTx, ok := tx.(*types.CoinbaseTx); ok {
+				block.Proposer = coinbaseTx.Proposer.Address // the fullness of the block is recorded against it
+			}
+			txs = append(txs, tx)
+			_, txRes = scratch.executor.ExecuteTx(tx)
+		}
+		verification.Receipts = append(verification.Receipts, newTxReceipt(txHash, tx, txRes))
+
+		if txRes.IsError() {
+			verification.Failures = append(verification.Failures, i)
+			if firstFailure.IsOK() {
+				firstFailure = blockTxError(tx, result.Error("Transaction %v failed: %v", i, txRes.Message).WithErrorCode(txRes.Code))
+			}
+		}
+	}
+	if firstFailure.IsError() {
+		return verification, firstFailure
+	}
+	if res := checkBlockGasBudget(txs, view); res.IsError() {
+		return verification, res
+	}
+	if res := checkBlockRegularTxCount(block, txs, view); res.IsError() {
+		return verification, res
+	}
+
+	scratchView := scratch.state.Delivered()
+	scratch.handleDelayedStateUpdates(scratchView, countRegularTxs(txs))
+	if err := scratchView.StoreError(); err != nil {
+		return verification, result.Error("Failed to access the state: %v", err).WithErrorCode(result.CodeInternalStoreError)
+	}
+
+	verification.StateRoot = scratchView.Hash()
+	if verification.StateRoot != expectedStateRoot {
+		return verification, stateRootMismatchError(verification.StateRoot, expectedStateRoot)
+	}
+	return verification, result.OK
+}
+
+// findCommittedBlockHash returns the hash of the block the committed state of the given height and
+// root belongs to, or an empty hash if it can not be found
+func (ledger *Ledger) findCommittedBlockHash(height uint64, stateRoot common.Hash) common.Hash {
+	if ledger.chain == nil {
+		return common.Hash{}
+	}
+	for _, block := range ledger.chain.FindBlocksByHeight(height) {
+		if block.StateHash == stateRoot {
+			return block.Hash()
+		}
+	}
+	return common.Hash{}
+}
@@ -0,0 +1,134 @@
+package ledger
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+func TestLedgerVerifyBlockTxs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 4)
+
+	baseHeight := ledger.state.Height()
+	baseRoot := ledger.state.Delivered().Hash()
+
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = baseHeight
+	root.StateHash = baseRoot
+	ledger.chain = blockchain.NewChain(chainID, kvstore.NewKVStore(ledger.state.DB()), root)
+	assert.Equal(root.Hash(), ledger.findCommittedBlockHash(baseHeight, baseRoot))
+
+	// A valid proposal
+	for _, accIn := range accIns[:2] {
+		require.Nil(mempool.InsertTransaction(newRawSendTx(chainID, 1, true, accOut, accIn, false)))
+	}
+	stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+	require.Equal(2, len(blockRawTxs))
+	screenedRoot := ledger.state.Screened().Hash()
+
+	verification, res := ledger.VerifyBlockTxs(blockRawTxs, stateRoot)
+	require.True(res.IsOK(), res.Message)
+	assert.Equal(baseHeight, verification.Height)
+	assert.Equal(stateRoot, verification.StateRoot)
+	assert.Equal(2, len(verification.Receipts))
+	assert.Equal(0, len(verification.Failures))
+
+	// Nothing is committed, and the views used by the ledger and the mempool are untouched
+	assert.Equal(baseHeight, ledger.state.Height())
+	assert.Equal(baseRoot, ledger.state.Delivered().Hash())
+	assert.Equal(screenedRoot, ledger.state.Screened().Hash())
+	assert.Equal(uint64(0), ledger.View().GetAccount(accIns[0].Address).Sequence)
+	assert.Equal(baseRoot, ledger.state.Committed().Hash())
+
+	// The state root mismatch
+	verification, res = ledger.VerifyBlockTxs(blockRawTxs, common.BytesToHash([]byte("bad root")))
+	assert.True(res.IsError())
+	assert.Contains(res.Message, "State root mismatch")
+	assert.Equal(result.CodeStateRootMismatch, res.Code)
+	assert.Equal(stateRoot, verification.StateRoot)
+	assert.Equal(0, len(verification.Failures))
+
+	// All the failed txs are reported
+	rawTxs := []common.Bytes{
+		newRawSendTx(chainID, 1, true, accOut, accIns[2], false),
+		newRawSendTx(chainID, 2, true, accOut, accIns[3], false), // invalid sequence
+		common.Bytes("not a tx"),
+		newRawSendTx(chainID, 2, true, accOut, accIns[2], false),
+	}
+	verification, res = ledger.VerifyBlockTxs(rawTxs, stateRoot)
+	assert.True(res.IsError())
+	assert.Contains(res.Message, "Transaction 1 failed")
+	assert.Equal(result.CodeInvalidTx, res.Code)
+	assert.Equal([]int{1, 2}, verification.Failures)
+	require.Equal(4, len(verification.Receipts))
+	assert.Equal(uint64(result.CodeOK), verification.Receipts[0].Code)
+	assert.NotEqual(uint64(result.CodeOK), verification.Receipts[1].Code)
+	assert.Contains(verification.Receipts[2].Message, "Failed to parse transaction")
+	assert.Equal(uint64(result.CodeOK), verification.Receipts[3].Code)
+	assert.Equal(common.Hash{}, verification.StateRoot)
+	assert.Equal(baseRoot, ledger.state.Delivered().Hash())
+}
+
+func TestLedgerVerifyBlockTxsConcurrentWithScreening(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, _ := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 8)
+
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = ledger.state.Height()
+	root.StateHash = ledger.state.Delivered().Hash()
+	ledger.chain = blockchain.NewChain(chainID, kvstore.NewKVStore(ledger.state.DB()), root)
+
+	blockRawTxs := []common.Bytes{}
+	for _, accIn := range accIns[:4] {
+		blockRawTxs = append(blockRawTxs, newRawSendTx(chainID, 1, true, accOut, accIn, false))
+	}
+	stateRoot := simulateBlockStateRoot(t, ledger, blockRawTxs...)
+
+	// The mempool screens the txs one at a time, while the proposals are being verified
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, accIn := range accIns[4:] {
+			_, res := ledger.ScreenTx(newRawSendTx(chainID, 1, true, accOut, accIn, false))
+			assert.True(res.IsOK(), res.Message)
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, res := ledger.VerifyBlockTxs(blockRawTxs, stateRoot)
+			assert.True(res.IsOK(), res.Message)
+		}()
+	}
+	wg.Wait()
+
+	// The screened view reflects the screened txs only
+	for i, accIn := range accIns {
+		account := ledger.state.Screened().GetAccount(accIn.Address)
+		require.NotNil(account)
+		if i < 4 {
+			assert.Equal(uint64(0), account.Sequence)
+		} else {
+			assert.Equal(uint64(1), account.Sequence)
+		}
+	}
+}
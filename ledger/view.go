@@ -0,0 +1,144 @@
+package ledger
+
+import (
+	"sync"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	st "github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+//
+// LedgerView is a read-only view of the ledger state pinned to a state root. Since the state root is
+// fixed, the view stays consistent while the ledger applies the later blocks, and is safe to use from
+// multiple goroutines. The returned objects are decoded on each call, modifying them does not affect
+// the view.
+//
+type LedgerView interface {
+	Height() uint64
+	StateRoot() common.Hash
+	GetAccount(address common.Address) *types.Account
+	GetCode(address common.Address) common.Bytes
+	GetState(address common.Address, key common.Hash) common.Hash
+	GetSplitRule(resourceID string) *types.SplitRule
+	GetValidatorCandidatePool() *core.ValidatorCandidatePool
+	GetStake(source common.Address, holder common.Address) *core.Stake
+	GetBlockGasLimit() uint64
+	GetIntrinsicGasSchedule() *types.IntrinsicGasSchedule
+	GetMaxTxSize() uint64
+	GetMaxNumRegularTxsPerBlock(height uint64) int
+}
+
+var _ LedgerView = (*ledgerView)(nil)
+
+// ledgerView implements the LedgerView interface on top of a store view that is never written to
+type ledgerView struct {
+	mu   *sync.Mutex // the trie caches the resolved nodes on reads
+	view *st.StoreView
+}
+
+// View returns a read-only view of the last committed state. It does not acquire the ledger lock,
+// and can be held across the subsequent block applications.
+func (ledger *Ledger) View() LedgerView {
+	view := ledger.state.Committed()
+	if view == nil {
+		logger.Panicf("Failed to load the committed state")
+	}
+	return &ledgerView{
+		mu:   &sync.Mutex{},
+		view: view,
+	}
+}
+
+func (lv *ledgerView) Height() uint64 {
+	return lv.view.Height()
+}
+
+func (lv *ledgerView) StateRoot() common.Hash {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+
+	return lv.view.Hash()
+}
+
+func (lv *ledgerView) GetAccount(address common.Address) *types.Account {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+
+	return lv.view.GetAccount(address)
+}
+
+func (lv *ledgerView) GetCode(address common.Address) common.Bytes {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+
+	return lv.view.GetCode(address)
+}
+
+func (lv *ledgerView) GetState(address common.Address, key common.Hash) common.Hash {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+
+	return lv.view.GetState(address, key)
+}
+
+func (lv *ledgerView) GetSplitRule(resourceID string) *types.SplitRule {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+
+	return lv.view.GetSplitRule(resourceID)
+}
+
+func (lv *ledgerView) GetValidatorCandidatePool() *core.ValidatorCandidatePool {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+
+	return lv.view.GetValidatorCandidatePool()
+}
+
+func (lv *ledgerView) GetBlockGasLimit() uint64 {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+
+	return lv.view.GetBlockGasLimit()
+}
+
+func (lv *ledgerView) GetIntrinsicGasSchedule() *types.IntrinsicGasSchedule {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+
+	return lv.view.GetIntrinsicGasSchedule()
+}
+
+func (lv *ledgerView) GetMaxTxSize() uint64 {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+
+	return lv.view.GetMaxTxSize()
+}
+
+func (lv *ledgerView) GetMaxNumRegularTxsPerBlock(height uint64) int {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+
+	return lv.view.GetMaxNumRegularTxsPerBlock(height)
+}
+
+// GetStake returns the stake deposited by the source to the holder, or nil if there is none
+func (lv *ledgerView) GetStake(source common.Address, holder common.Address) *core.Stake {
+	vcp := lv.GetValidatorCandidatePool()
+	if vcp == nil {
+		return nil
+	}
+	stakeHolder := vcp.FindStakeDelegate(holder)
+	if stakeHolder == nil {
+		return nil
+	}
+	for _, stake := range stakeHolder.Stakes {
+		if stake.Source == source {
+			return stake
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package ledger
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/result"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+func TestLedgerView(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainID, ledger, mempool := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 4)
+
+	view := ledger.View()
+	baseHeight := ledger.state.Height()
+	baseRoot := ledger.state.Delivered().Hash()
+	assert.Equal(baseHeight, view.Height())
+	assert.Equal(baseRoot, view.StateRoot())
+	require.NotNil(view.GetAccount(accIns[0].Address))
+	assert.Equal(uint64(0), view.GetAccount(accIns[0].Address).Sequence)
+	assert.Nil(view.GetAccount(common.HexToAddress("0x1234")))
+
+	// Modifying the returned objects does not affect the view
+	account := view.GetAccount(accOut.Address)
+	account.Balance = types.NewCoins(1, 1)
+	assert.Equal(accOut.Account.Balance, view.GetAccount(accOut.Address).Balance)
+
+	// The view stays pinned to its root while the later blocks are applied, and can be read concurrently
+	require.Nil(mempool.InsertTransaction(newRawSendTx(chainID, 1, true, accOut, accIns[0], false)))
+	stateRoot, blockRawTxs, res := ledger.ProposeBlockTxs(nil)
+	require.True(res.IsOK(), res.Message)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				assert.Equal(baseRoot, view.StateRoot())
+				assert.Equal(uint64(0), view.GetAccount(accIns[0].Address).Sequence)
+			}
+		}()
+	}
+	block := core.NewBlock()
+	block.ChainID = chainID
+	block.Height = baseHeight
+	block.StateHash = stateRoot
+	block.Txs = blockRawTxs
+	res = ledger.ApplyBlockTxs(block)
+	require.True(res.IsOK(), res.Message)
+	wg.Wait()
+
+	assert.Equal(baseRoot, view.StateRoot())
+	assert.Equal(uint64(0), view.GetAccount(accIns[0].Address).Sequence)
+
+	latest := ledger.View()
+	assert.Equal(stateRoot, latest.StateRoot())
+	assert.Equal(baseHeight+1, latest.Height())
+	assert.Equal(uint64(1), latest.GetAccount(accIns[0].Address).Sequence)
+
+	// The txs already committed are rejected
+	_, res = ledger.ScreenTx(newRawSendTx(chainID, 1, true, accOut, accIns[0], false))
+	assert.True(res.IsError())
+	assert.Equal(result.CodeSequenceTooLow, res.Code)
+	assert.Contains(res.Message, "Stale sequence")
+	_, res = ledger.ScreenTx(newRawSendTx(chainID, 2, true, accOut, accIns[0], false))
+	assert.True(res.IsOK(), res.Message)
+}
+
+func TestLedgerViewGetStake(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, ledger, _ := newTestLedger()
+	accOut, accIns := prepareInitLedgerState(ledger, 2)
+
+	stakeAmount := new(big.Int).Mul(core.MinValidatorStakeDeposit, big.NewInt(3))
+	vcp := &core.ValidatorCandidatePool{}
+	require.Nil(vcp.DepositStake(accIns[0].Address, accOut.Address, core.MinValidatorStakeDeposit))
+	require.Nil(vcp.DepositStake(accIns[1].Address, accOut.Address, stakeAmount))
+	ledger.state.Delivered().UpdateValidatorCandidatePool(vcp)
+	ledger.state.Commit()
+
+	view := ledger.View()
+	stake := view.GetStake(accIns[1].Address, accOut.Address)
+	require.NotNil(stake)
+	assert.Equal(stakeAmount, stake.Amount)
+	assert.False(stake.Withdrawn)
+	assert.Nil(view.GetStake(accOut.Address, accOut.Address))
+	assert.Nil(view.GetStake(accIns[0].Address, accIns[1].Address))
+	assert.Equal(1, len(view.GetValidatorCandidatePool().SortedCandidates))
+}
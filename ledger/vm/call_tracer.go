@@ -0,0 +1,118 @@
+package vm
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/hexutil"
+	"github.com/thetatoken/theta/common/math"
+)
+
+var _ FrameTracer = (*CallTracer)(nil)
+
+// CallFrame is a call frame of the call tree captured by a CallTracer
+type CallFrame struct {
+	Type    string                `json:"type"` // CALL, CALLCODE, DELEGATECALL, STATICCALL, CREATE or CREATE2
+	From    common.Address        `json:"from"`
+	To      common.Address        `json:"to"`
+	Input   hexutil.Bytes         `json:"input"`
+	Output  hexutil.Bytes         `json:"output,omitempty"`
+	Gas     math.HexOrDecimal64   `json:"gas"`
+	GasUsed math.HexOrDecimal64   `json:"gasUsed"`
+	Value   *math.HexOrDecimal256 `json:"value,omitempty"` // nil for DELEGATECALL and STATICCALL
+	Error   string                `json:"error,omitempty"`
+	Calls   []*CallFrame          `json:"calls,omitempty"`
+}
+
+// CallTracer is a FrameTracer capturing the call tree of an execution, i.e. the top-level frame and the
+// calls and contract creations nested in it, without the individual steps.
+type CallTracer struct {
+	root  *CallFrame
+	stack []*CallFrame // the frames entered but not exited yet, innermost last
+}
+
+// NewCallTracer returns a new call tracer
+func NewCallTracer() *CallTracer {
+	return &CallTracer{}
+}
+
+// CaptureStart implements the Tracer interface to start the top-level frame.
+func (t *CallTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	typ := CALL
+	if create {
+		typ = CREATE
+	}
+	t.root = newCallFrame(typ, from, to, input, gas, value)
+	t.stack = []*CallFrame{t.root}
+	return nil
+}
+
+// CaptureState implements the Tracer interface, the steps are not captured.
+func (t *CallTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureFault implements the Tracer interface, the faults are captured with the frames they end.
+func (t *CallTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnter implements the FrameTracer interface to start a nested frame.
+func (t *CallTracer) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	if len(t.stack) == 0 {
+		return
+	}
+	frame := newCallFrame(typ, from, to, input, gas, value)
+	parent := t.stack[len(t.stack)-1]
+	parent.Calls = append(parent.Calls, frame)
+	t.stack = append(t.stack, frame)
+}
+
+// CaptureExit implements the FrameTracer interface to end the innermost nested frame.
+func (t *CallTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	if len(t.stack) <= 1 { // the top-level frame is ended by CaptureEnd
+		return
+	}
+	frame := t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+	frame.end(output, gasUsed, err)
+}
+
+// CaptureEnd implements the Tracer interface to end the top-level frame.
+func (t *CallTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	if t.root != nil {
+		t.root.end(output, gasUsed, err)
+	}
+	t.stack = nil
+	return nil
+}
+
+// Result returns the top-level frame of the captured call tree, or nil if the execution did not get to run
+// any code, e.g. for running out of gas on the intrinsic gas. The gas used by the top-level frame excludes the
+// intrinsic gas.
+func (t *CallTracer) Result() *CallFrame {
+	return t.root
+}
+
+func newCallFrame(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) *CallFrame {
+	frame := &CallFrame{
+		Type:  typ.String(),
+		From:  from,
+		To:    to,
+		Input: common.CopyBytes(input),
+		Gas:   math.HexOrDecimal64(gas),
+	}
+	if value != nil {
+		frame.Value = (*math.HexOrDecimal256)(new(big.Int).Set(value))
+	}
+	return frame
+}
+
+func (frame *CallFrame) end(output []byte, gasUsed uint64, err error) {
+	frame.Output = common.CopyBytes(output)
+	frame.GasUsed = math.HexOrDecimal64(gasUsed)
+	if err != nil {
+		frame.Error = err.Error()
+	}
+}
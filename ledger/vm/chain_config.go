@@ -0,0 +1,76 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/vm/params"
+)
+
+// ChainConfig schedules the forks of the EVM of a chain, i.e. the block heights from which the instructions and
+// the gas costs of each fork apply, so that a test network can run the latest rules from genesis while the main
+// network activates them at a fork height. A contract executes with the rules at the height of the state it is
+// executed against, so a block is always validated with the rules of its own height, whatever the tip of the node.
+type ChainConfig struct {
+	Create2Height uint64 // CREATE2, see types.CreateContractAddress2
+	EIP1884Height uint64 // SELFBALANCE, and the repriced SLOAD, BALANCE and EXTCODEHASH, see params.ThetaEIP1884GasTable
+}
+
+// MainnetChainConfig activates the forks at the heights of common/heights.go
+var MainnetChainConfig = &ChainConfig{
+	Create2Height: common.HeightEnableCreate2,
+	EIP1884Height: common.HeightEnableEIP1884,
+}
+
+// TestnetChainConfig activates all the forks from genesis
+var TestnetChainConfig = &ChainConfig{}
+
+// ChainConfigForChainID returns the EVM configuration of the chain with the given ID, i.e. the TestnetChainConfig for
+// the test network, and the MainnetChainConfig for any other chain
+func ChainConfigForChainID(chainID string) *ChainConfig {
+	if chainID == core.TestnetChainID {
+		return TestnetChainConfig
+	}
+	return MainnetChainConfig
+}
+
+// Validate checks that the forks are scheduled in order, since each instruction set extends the one of the previous
+// fork
+func (c *ChainConfig) Validate() error {
+	if c.EIP1884Height < c.Create2Height {
+		return fmt.Errorf("The EIP-1884 fork at height %v precedes the CREATE2 fork at height %v",
+			c.EIP1884Height, c.Create2Height)
+	}
+	return nil
+}
+
+// IsCreate2 returns whether CREATE2 is active at the given block height
+func (c *ChainConfig) IsCreate2(height uint64) bool {
+	return height >= c.Create2Height
+}
+
+// IsEIP1884 returns whether the EIP-1884 fork is active at the given block height
+func (c *ChainConfig) IsEIP1884(height uint64) bool {
+	return height >= c.EIP1884Height
+}
+
+// GasTable returns the gas costs of the instructions at the given block height
+func (c *ChainConfig) GasTable(height uint64) params.GasTable {
+	if c.IsEIP1884(height) {
+		return params.ThetaEIP1884GasTable
+	}
+	return params.ThetaGasTable
+}
+
+// instructionSet returns the instructions valid at the given block height
+func (c *ChainConfig) instructionSet(height uint64) [256]operation {
+	switch {
+	case c.IsEIP1884(height):
+		return eip1884InstructionSet
+	case c.IsCreate2(height):
+		return create2InstructionSet
+	default:
+		return constantinopleInstructionSet
+	}
+}
@@ -0,0 +1,81 @@
+package vm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func TestChainConfigForkSchedule(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	chainConfig := &ChainConfig{Create2Height: 10, EIP1884Height: 20}
+	require.Nil(chainConfig.Validate())
+
+	storeView := state.NewStoreView(18, common.Hash{}, backend.NewMemDatabase())
+	privAccounts := prepareInitState(storeView, 1) // at height 19
+	callerAddr := privAccounts[0].Account.Address
+
+	// ASM: selfbalance, push 0x0, sstore, stop
+	selfBalanceAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	storeView.SetCode(selfBalanceAddr, common.Hex2Bytes("4760005500"))
+	storeView.AddBalance(selfBalanceAddr, big.NewInt(1234))
+
+	// ASM: push 0x0, sload, pop, stop
+	sloadAddr := common.HexToAddress("0x1000000000000000000000000000000000000002")
+	storeView.SetCode(sloadAddr, common.Hex2Bytes("6000545000"))
+
+	newTx := func(to common.Address) *types.SmartContractTx {
+		return &types.SmartContractTx{
+			From:     types.TxInput{Address: callerAddr},
+			To:       types.TxOutput{Address: to},
+			GasLimit: 100000,
+			GasPrice: big.NewInt(5000),
+		}
+	}
+	execute := func(to common.Address) (gasUsed uint64, vmErr error) {
+		_, _, gasUsed, _, vmErr = ExecuteWithChainConfig(newTx(to), storeView, chainConfig, 0, nil)
+		return gasUsed, vmErr
+	}
+
+	// SELFBALANCE is an invalid opcode before the fork
+	_, vmErr := execute(selfBalanceAddr)
+	assert.NotNil(vmErr)
+	assert.Equal(common.Hash{}, storeView.GetState(selfBalanceAddr, common.Hash{}))
+	gasBefore, vmErr := execute(sloadAddr)
+	require.Nil(vmErr)
+
+	// The same code executes with the rules of the fork from its height on
+	storeView.IncrementHeight()
+	_, vmErr = execute(selfBalanceAddr)
+	require.Nil(vmErr)
+	assert.Equal(common.BigToHash(big.NewInt(1234)), storeView.GetState(selfBalanceAddr, common.Hash{}))
+	gasAfter, vmErr := execute(sloadAddr)
+	require.Nil(vmErr)
+	assert.Equal(gasBefore+600, gasAfter) // SLOAD is repriced from 200 to 800
+
+	// The main network configuration has not reached the fork at this height
+	_, _, _, _, vmErr = ExecuteWithChainConfig(newTx(selfBalanceAddr), storeView, MainnetChainConfig, 0, nil)
+	assert.NotNil(vmErr)
+}
+
+func TestChainConfigValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(MainnetChainConfig.Validate())
+	assert.Nil(TestnetChainConfig.Validate())
+	assert.NotNil((&ChainConfig{Create2Height: 20, EIP1884Height: 10}).Validate())
+
+	assert.Equal(TestnetChainConfig, ChainConfigForChainID(core.TestnetChainID))
+	assert.Equal(MainnetChainConfig, ChainConfigForChainID("privatenet"))
+	assert.True(TestnetChainConfig.IsEIP1884(0))
+	assert.False(MainnetChainConfig.IsEIP1884(common.HeightEnableEIP1884 - 1))
+}
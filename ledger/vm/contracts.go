@@ -19,6 +19,7 @@ package vm
 import (
 	"crypto/sha256"
 	"errors"
+	"fmt"
 	"math/big"
 
 	"github.com/thetatoken/theta/common"
@@ -37,6 +38,14 @@ type PrecompiledContract interface {
 	Run(input []byte) ([]byte, error) // Run runs the precompiled contract
 }
 
+// StatefulPrecompiledContract is a precompiled contract which runs against the EVM, e.g. to update the state on
+// behalf of its caller. Its gas cost must still be deterministic. Since it acts for its caller, it can only be
+// called directly, the delegated calls (i.e. the DELEGATECALL and CALLCODE) fail with ErrDelegatedPrecompile.
+type StatefulPrecompiledContract interface {
+	PrecompiledContract
+	RunWithEVM(evm *EVM, contract *Contract, input []byte, readOnly bool) ([]byte, error) // readOnly for a STATICCALL
+}
+
 // PrecompiledContractsHomestead contains the default set of pre-compiled Ethereum
 // contracts used in the Frontier and Homestead releases.
 var PrecompiledContractsHomestead = map[common.Address]PrecompiledContract{
@@ -59,6 +68,51 @@ var PrecompiledContractsByzantium = map[common.Address]PrecompiledContract{
 	common.BytesToAddress([]byte{8}): &bn256Pairing{},
 }
 
+// precompiledContractActivation is a chain specific precompiled contract, and the block height it is
+// active from
+type precompiledContractActivation struct {
+	height   uint64
+	contract PrecompiledContract
+}
+
+// chainPrecompiledContracts contains the chain specific precompiled contracts, in addition to the Byzantium set
+var chainPrecompiledContracts = map[common.Address]precompiledContractActivation{}
+
+// RegisterPrecompiledContract registers a chain specific precompiled contract at the given address, active
+// from the given block height, typically a fork height defined in common/heights.go. Its gas cost must be
+// deterministic, as for the Byzantium set. It is not thread safe, and should only be called on initialization,
+// e.g. from an init() function. It panics if the address is already taken by another precompiled contract.
+func RegisterPrecompiledContract(addr common.Address, height uint64, p PrecompiledContract) {
+	if _, ok := PrecompiledContractsByzantium[addr]; ok {
+		panic(fmt.Sprintf("Address %v is taken by a Byzantium precompiled contract", addr.Hex()))
+	}
+	if _, ok := chainPrecompiledContracts[addr]; ok {
+		panic(fmt.Sprintf("Address %v is taken by another precompiled contract", addr.Hex()))
+	}
+	chainPrecompiledContracts[addr] = precompiledContractActivation{height: height, contract: p}
+}
+
+// ActivePrecompiledContracts returns the precompiled contracts active at the given block height, i.e. the
+// Byzantium set at any height, and the chain specific precompiled contracts from their activation heights.
+func ActivePrecompiledContracts(blockHeight uint64) map[common.Address]PrecompiledContract {
+	precompiles := PrecompiledContractsByzantium
+	copied := false
+	for addr, activation := range chainPrecompiledContracts {
+		if blockHeight < activation.height {
+			continue
+		}
+		if !copied { // the Byzantium set is shared, copy it before adding to it
+			precompiles = make(map[common.Address]PrecompiledContract, len(PrecompiledContractsByzantium)+len(chainPrecompiledContracts))
+			for byzantiumAddr, p := range PrecompiledContractsByzantium {
+				precompiles[byzantiumAddr] = p
+			}
+			copied = true
+		}
+		precompiles[addr] = activation.contract
+	}
+	return precompiles
+}
+
 // RunPrecompiledContract runs and evaluates the output of a precompiled contract.
 func RunPrecompiledContract(p PrecompiledContract, input []byte, contract *Contract) (ret []byte, err error) {
 	gas := p.RequiredGas(input)
@@ -68,6 +122,21 @@ func RunPrecompiledContract(p PrecompiledContract, input []byte, contract *Contr
 	return nil, ErrOutOfGas
 }
 
+// runStatefulPrecompiledContract runs and evaluates the output of a stateful precompiled contract
+func runStatefulPrecompiledContract(evm *EVM, p StatefulPrecompiledContract, input []byte, contract *Contract, readOnly bool) (ret []byte, err error) {
+	if contract.CodeAddr == nil || contract.Address() != *contract.CodeAddr {
+		return nil, ErrDelegatedPrecompile
+	}
+	if in, ok := evm.interpreter.(*EVMInterpreter); ok && in.readOnly {
+		readOnly = true // e.g. a CALL from within a STATICCALL
+	}
+	gas := p.RequiredGas(input)
+	if contract.UseGas(gas) {
+		return p.RunWithEVM(evm, contract, input, readOnly)
+	}
+	return nil, ErrOutOfGas
+}
+
 // ECRECOVER implemented as a native contract.
 type ecrecover struct{}
 
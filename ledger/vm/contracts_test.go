@@ -21,6 +21,7 @@ import (
 	"math/big"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/thetatoken/theta/common"
 )
 
@@ -32,6 +33,71 @@ type precompiledTest struct {
 	noBenchmark     bool // Benchmark primarily the worst-cases
 }
 
+// ecrecoverTests are the test data for the ecrecover precompiled contract.
+var ecrecoverTests = []precompiledTest{
+	{
+		input:    "38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e000000000000000000000000000000000000000000000000000000000000001b38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e789d1dd423d25f0772d2748d60f7e4b81bb14d086eba8e8e8efb6dcff8a4ae02",
+		expected: "000000000000000000000000ceaccac640adf55b2028469bd36ba501f28b699d",
+		gas:      3000,
+		name:     "valid",
+	}, {
+		input:    "38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e000000000000000000000000000000000000000000000000000000000000001d38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e789d1dd423d25f0772d2748d60f7e4b81bb14d086eba8e8e8efb6dcff8a4ae02",
+		expected: "",
+		gas:      3000,
+		name:     "invalid_v",
+	}, {
+		input:    "",
+		expected: "",
+		gas:      3000,
+		name:     "empty",
+	},
+}
+
+// sha256Tests are the test data for the sha256 precompiled contract.
+var sha256Tests = []precompiledTest{
+	{
+		input:    "38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e000000000000000000000000000000000000000000000000000000000000001b38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e789d1dd423d25f0772d2748d60f7e4b81bb14d086eba8e8e8efb6dcff8a4ae02",
+		expected: "811c7003375852fabd0d362e40e68607a12bdabae61a7d068fe5fdd1dbbf2a5d",
+		gas:      108,
+		name:     "128",
+	}, {
+		input:    "",
+		expected: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		gas:      60,
+		name:     "empty",
+	},
+}
+
+// ripemd160Tests are the test data for the ripemd160 precompiled contract.
+var ripemd160Tests = []precompiledTest{
+	{
+		input:    "38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e000000000000000000000000000000000000000000000000000000000000001b38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e789d1dd423d25f0772d2748d60f7e4b81bb14d086eba8e8e8efb6dcff8a4ae02",
+		expected: "0000000000000000000000009215b8d9882ff46f0dfde6684d78e831467f65e6",
+		gas:      1080,
+		name:     "128",
+	}, {
+		input:    "",
+		expected: "0000000000000000000000009c1185a5c5e9fc54612808977ee8f548b2258d31",
+		gas:      600,
+		name:     "empty",
+	},
+}
+
+// identityTests are the test data for the identity precompiled contract.
+var identityTests = []precompiledTest{
+	{
+		input:    "38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e000000000000000000000000000000000000000000000000000000000000001b38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e789d1dd423d25f0772d2748d60f7e4b81bb14d086eba8e8e8efb6dcff8a4ae02",
+		expected: "38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e000000000000000000000000000000000000000000000000000000000000001b38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e789d1dd423d25f0772d2748d60f7e4b81bb14d086eba8e8e8efb6dcff8a4ae02",
+		gas:      27,
+		name:     "128",
+	}, {
+		input:    "01",
+		expected: "01",
+		gas:      18,
+		name:     "1",
+	},
+}
+
 // modexpTests are the test and benchmark data for the modexp precompiled contract.
 var modexpTests = []precompiledTest{
 	{
@@ -342,6 +408,9 @@ func testPrecompiled(addr string, test precompiledTest, t *testing.T) {
 	contract := NewContract(AccountRef(common.HexToAddress("1337")),
 		nil, new(big.Int), p.RequiredGas(in))
 	t.Run(fmt.Sprintf("%s-Gas=%d", test.name, contract.Gas), func(t *testing.T) {
+		if test.gas != 0 && contract.Gas != test.gas {
+			t.Errorf("Expected %v gas, got %v", test.gas, contract.Gas)
+		}
 		if res, err := RunPrecompiledContract(p, in, contract); err != nil {
 			t.Error(err)
 		} else if common.Bytes2Hex(res) != test.expected {
@@ -426,6 +495,60 @@ func BenchmarkPrecompiledIdentity(bench *testing.B) {
 	benchmarkPrecompiled("04", t, bench)
 }
 
+// Tests the sample inputs of the precompiled contracts of the Frontier release.
+func TestPrecompiledFrontier(t *testing.T) {
+	for _, test := range ecrecoverTests {
+		testPrecompiled("01", test, t)
+	}
+	for _, test := range sha256Tests {
+		testPrecompiled("02", test, t)
+	}
+	for _, test := range ripemd160Tests {
+		testPrecompiled("03", test, t)
+	}
+	for _, test := range identityTests {
+		testPrecompiled("04", test, t)
+	}
+}
+
+type testPrecompiledContract struct{}
+
+func (c *testPrecompiledContract) RequiredGas(input []byte) uint64 {
+	return 100 + uint64(len(input))
+}
+
+func (c *testPrecompiledContract) Run(input []byte) ([]byte, error) {
+	return append([]byte("test:"), input...), nil
+}
+
+func TestPrecompiledContractActivation(t *testing.T) {
+	assert := assert.New(t)
+
+	addr := common.BytesToAddress([]byte{0x01, 0x00})
+	activationHeight := uint64(100)
+	RegisterPrecompiledContract(addr, activationHeight, &testPrecompiledContract{})
+	defer delete(chainPrecompiledContracts, addr)
+
+	// The Byzantium set is active at any height, the chain specific precompiled contracts from their
+	// activation heights
+	assert.Equal(PrecompiledContractsByzantium, ActivePrecompiledContracts(0))
+	assert.Equal(PrecompiledContractsByzantium, ActivePrecompiledContracts(activationHeight-1))
+	precompiles := ActivePrecompiledContracts(activationHeight)
+	assert.Equal(len(PrecompiledContractsByzantium)+1, len(precompiles))
+	assert.Equal(&testPrecompiledContract{}, precompiles[addr])
+	assert.Equal(8, len(PrecompiledContractsByzantium)) // the shared set is not modified
+
+	newEVM := func(height uint64) *EVM {
+		return NewEVM(Context{BlockNumber: new(big.Int).SetUint64(height)}, nil, nil, Config{})
+	}
+	assert.Nil(newEVM(activationHeight - 1).precompiles[addr])
+	assert.NotNil(newEVM(activationHeight).precompiles[addr])
+
+	// The addresses can not be reused
+	assert.Panics(func() { RegisterPrecompiledContract(addr, 0, &testPrecompiledContract{}) })
+	assert.Panics(func() { RegisterPrecompiledContract(common.BytesToAddress([]byte{2}), 0, &testPrecompiledContract{}) })
+}
+
 // Tests the sample inputs from the ModExp EIP 198.
 func TestPrecompiledModExp(t *testing.T) {
 	for _, test := range modexpTests {
@@ -27,4 +27,9 @@ var (
 	ErrInsufficientBalance      = errors.New("insufficient balance for transfer")
 	ErrContractAddressCollision = errors.New("contract address collision")
 	ErrNoCompatibleInterpreter  = errors.New("no compatible interpreter")
+	ErrExecutionAborted         = errors.New("execution aborted")
+	ErrExecutionReverted        = errors.New("evm: execution reverted")
+	ErrMaxCodeSizeExceeded      = errors.New("evm: max code size exceeded")
+	ErrIntrinsicGasNotCovered   = errors.New("gas limit does not cover the intrinsic gas")
+	ErrDelegatedPrecompile      = errors.New("evm: delegated call to a stateful precompiled contract")
 )
@@ -14,6 +14,38 @@ import (
 // Execute executes the given smart contract
 func Execute(tx *types.SmartContractTx, storeView *state.StoreView) (evmRet common.Bytes,
 	contractAddr common.Address, gasUsed uint64, evmErr error) {
+	return ExecuteWithTimeLimit(tx, storeView, 0)
+}
+
+// ExecuteWithTimeLimit is similar to Execute, but aborts the execution with ErrExecutionAborted once it
+// takes longer than the time limit, or never if the time limit is not positive. Unlike running out of gas,
+// whether the execution is aborted depends on the speed of the machine, so it must never decide the validity
+// of a transaction in a block. Also, the caller is responsible for reverting the store view if aborted.
+func ExecuteWithTimeLimit(tx *types.SmartContractTx, storeView *state.StoreView, timeLimit time.Duration) (evmRet common.Bytes,
+	contractAddr common.Address, gasUsed uint64, evmErr error) {
+	return ExecuteWithTracer(tx, storeView, timeLimit, nil)
+}
+
+// ExecuteWithTracer is similar to ExecuteWithTimeLimit, but also reports each step of the execution to the
+// tracer, as well as each call frame if it is a FrameTracer. The execution is not traced if the tracer is nil.
+// The tracer is not invoked if the gas limit does not cover the intrinsic gas.
+func ExecuteWithTracer(tx *types.SmartContractTx, storeView *state.StoreView, timeLimit time.Duration, tracer Tracer) (evmRet common.Bytes,
+	contractAddr common.Address, gasUsed uint64, evmErr error) {
+	evmRet, contractAddr, gasUsed, _, evmErr = ExecuteWithInternalTransfers(tx, storeView, timeLimit, tracer)
+	return evmRet, contractAddr, gasUsed, evmErr
+}
+
+// ExecuteWithInternalTransfers is similar to ExecuteWithTracer, but also returns the value transfers made by the
+// contracts during the execution. The top-level transfer of the transaction is not included.
+func ExecuteWithInternalTransfers(tx *types.SmartContractTx, storeView *state.StoreView, timeLimit time.Duration, tracer Tracer) (evmRet common.Bytes,
+	contractAddr common.Address, gasUsed uint64, transfers *InternalTransferLog, evmErr error) {
+	return ExecuteWithChainConfig(tx, storeView, MainnetChainConfig, timeLimit, tracer)
+}
+
+// ExecuteWithChainConfig is similar to ExecuteWithInternalTransfers, but executes with the forks scheduled by the
+// given chain configuration, at the height of the store view, rather than with the MainnetChainConfig
+func ExecuteWithChainConfig(tx *types.SmartContractTx, storeView *state.StoreView, chainConfig *ChainConfig, timeLimit time.Duration,
+	tracer Tracer) (evmRet common.Bytes, contractAddr common.Address, gasUsed uint64, transfers *InternalTransferLog, evmErr error) {
 	context := Context{
 		GasPrice:    tx.GasPrice,
 		GasLimit:    tx.GasLimit,
@@ -21,9 +53,16 @@ func Execute(tx *types.SmartContractTx, storeView *state.StoreView) (evmRet comm
 		Time:        new(big.Int).SetInt64(time.Now().Unix()),
 		Difficulty:  new(big.Int).SetInt64(0),
 	}
-	chainConfig := &params.ChainConfig{}
-	config := Config{}
-	evm := NewEVM(context, storeView, chainConfig, config)
+	config := Config{ChainConfig: chainConfig}
+	if tracer != nil {
+		config.Debug = true
+		config.Tracer = tracer
+	}
+	evm := NewEVM(context, storeView, &params.ChainConfig{}, config)
+	if timeLimit > 0 {
+		timer := time.AfterFunc(timeLimit, evm.Cancel)
+		defer timer.Stop()
+	}
 
 	value := tx.From.Coins.TFuelWei
 	if value == nil {
@@ -36,10 +75,10 @@ func Execute(tx *types.SmartContractTx, storeView *state.StoreView) (evmRet comm
 
 	intrinsicGas, err := calculateIntrinsicGas(tx.Data, createContract)
 	if err != nil {
-		return common.Bytes{}, common.Address{}, 0, err
+		return common.Bytes{}, common.Address{}, 0, evm.InternalTransfers(), err
 	}
 	if intrinsicGas > gasLimit {
-		return common.Bytes{}, common.Address{}, 0, ErrOutOfGas
+		return common.Bytes{}, common.Address{}, 0, evm.InternalTransfers(), ErrOutOfGas
 	}
 
 	var leftOverGas uint64
@@ -58,7 +97,7 @@ func Execute(tx *types.SmartContractTx, storeView *state.StoreView) (evmRet comm
 		gasUsed = gasLimit - leftOverGas
 	}
 
-	return evmRet, contractAddr, gasUsed, evmErr
+	return evmRet, contractAddr, gasUsed, evm.InternalTransfers(), evmErr
 }
 
 // calculateIntrinsicGas computes the 'intrinsic gas' for a message with the given data.
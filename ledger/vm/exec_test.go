@@ -9,12 +9,15 @@ import (
 	"math/big"
 	"strconv"
 	"testing"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/ledger/state"
 	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/ledger/vm/params"
 	"github.com/thetatoken/theta/store/database/backend"
 )
 
@@ -341,8 +344,453 @@ func TestVMExecutionDeployERC20TokenContract(t *testing.T) {
 	log.Infof("Call   Contract -- symbol: %v", symbol)
 }
 
+func TestVMExecuteWithTracer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	storeView := state.NewStoreView(0, common.Hash{}, backend.NewMemDatabase())
+	privAccounts := prepareInitState(storeView, 1)
+	callerAddr := privAccounts[0].Account.Address
+
+	// ASM:
+	// push 0x1
+	// push 0x0
+	// sstore
+	// stop
+	calleeAddr := common.HexToAddress("0x1000000000000000000000000000000000000002")
+	storeView.SetCode(calleeAddr, common.Hex2Bytes("600160005500"))
+
+	// ASM:
+	// push 0x0 (x5, i.e. no output, no input and no value)
+	// push20 calleeAddr
+	// gas
+	// call
+	// stop
+	callerCode := "6000600060006000600073" + hex.EncodeToString(calleeAddr.Bytes()) + "5af100"
+	contractAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	storeView.SetCode(contractAddr, common.Hex2Bytes(callerCode))
+	storeView.Save()
+
+	callSCTx := &types.SmartContractTx{
+		From:     types.TxInput{Address: callerAddr, Coins: types.NewCoins(0, 0)},
+		To:       types.TxOutput{Address: contractAddr},
+		GasLimit: 100000,
+		GasPrice: big.NewInt(5000),
+	}
+	copyView := func() *state.StoreView {
+		view, err := storeView.Copy()
+		require.Nil(err)
+		return view
+	}
+
+	// The call tree has the nested call
+	callTracer := NewCallTracer()
+	_, _, gasUsed, vmErr := ExecuteWithTracer(callSCTx, copyView(), 0, callTracer)
+	require.Nil(vmErr)
+	root := callTracer.Result()
+	require.NotNil(root)
+	assert.Equal("CALL", root.Type)
+	assert.Equal(callerAddr, root.From)
+	assert.Equal(contractAddr, root.To)
+	assert.Equal("", root.Error)
+	require.Equal(1, len(root.Calls))
+	nested := root.Calls[0]
+	assert.Equal("CALL", nested.Type)
+	assert.Equal(contractAddr, nested.From)
+	assert.Equal(calleeAddr, nested.To)
+	assert.True(nested.GasUsed > 0)
+	assert.True(root.GasUsed > nested.GasUsed)
+	assert.Equal(uint64(root.GasUsed)+21000, gasUsed) // the intrinsic gas is not part of the top-level frame
+
+	data, err := json.Marshal(root)
+	require.Nil(err)
+	var decoded map[string]interface{}
+	require.Nil(json.Unmarshal(data, &decoded))
+	assert.Equal("CALL", decoded["type"])
+	assert.Equal(1, len(decoded["calls"].([]interface{})))
+
+	// The struct log has each step, with the depth and the address of the executing contract
+	logger := NewStructLogger(&LogConfig{DisableMemory: true})
+	_, _, _, vmErr = ExecuteWithTracer(callSCTx, copyView(), 0, logger)
+	require.Nil(vmErr)
+	logs := logger.StructLogs()
+	require.Equal(13, len(logs)) // 9 steps of the caller, and 4 of the callee
+	assert.Equal(PUSH1, logs[0].Op)
+	assert.Equal(1, logs[0].Depth)
+	assert.Equal(contractAddr, logs[0].Address)
+	assert.Equal(CALL, logs[7].Op)
+	assert.Equal(SSTORE, logs[10].Op)
+	assert.Equal(2, logs[10].Depth)
+	assert.Equal(calleeAddr, logs[10].Address)
+	assert.Equal(STOP, logs[len(logs)-1].Op)
+	assert.Equal(1, logs[len(logs)-1].Depth)
+
+	res := logger.Result()
+	assert.False(res.Failed)
+	assert.Equal(uint64(root.GasUsed), uint64(res.Gas))
+	data, err = json.Marshal(res)
+	require.Nil(err)
+	require.Nil(json.Unmarshal(data, &decoded))
+	assert.Equal(13, len(decoded["structLogs"].([]interface{})))
+
+	// The trace does not affect the execution
+	_, _, untracedGasUsed, vmErr := Execute(callSCTx, copyView())
+	require.Nil(vmErr)
+	assert.Equal(gasUsed, untracedGasUsed)
+}
+
+func TestVMExecutePrecompiledContracts(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	storeView := state.NewStoreView(0, common.Hash{}, backend.NewMemDatabase())
+	privAccounts := prepareInitState(storeView, 1)
+	callerAcc := privAccounts[0].Account
+
+	// The contract forwards its input to the precompiled contract, and returns the first 32 bytes of the output
+	// ASM:
+	// calldatasize, push 0x0, push 0x0, calldatacopy
+	// push 0x20, push 0x0, calldatasize, push 0x0, push precompileAddr, gas, staticcall, pop
+	// push 0x20, push 0x0, return
+	newForwarder := func(precompileAddr byte) common.Address {
+		contractAddr := common.BigToAddress(new(big.Int).SetUint64(0x1000 + uint64(precompileAddr)))
+		storeView.SetCode(contractAddr, common.Hex2Bytes(fmt.Sprintf("366000600037"+"60206000366000"+"60%02x"+"5afa50"+"60206000f3", precompileAddr)))
+		return contractAddr
+	}
+	newTx := func(to common.Address, data string) *types.SmartContractTx {
+		return &types.SmartContractTx{
+			From:     types.TxInput{Address: callerAcc.Address},
+			To:       types.TxOutput{Address: to},
+			GasLimit: 100000,
+			GasPrice: big.NewInt(5000),
+			Data:     common.Hex2Bytes(data),
+		}
+	}
+	vectors := []struct {
+		addr  byte
+		tests []precompiledTest
+	}{
+		{1, ecrecoverTests[:1]},
+		{2, sha256Tests},
+		{3, ripemd160Tests},
+		{4, identityTests[:1]},
+	}
+	for _, vector := range vectors {
+		precompileAddr := common.BytesToAddress([]byte{vector.addr})
+		forwarderAddr := newForwarder(vector.addr)
+		for _, test := range vector.tests {
+			// Called by a contract
+			vmRet, _, _, vmErr := Execute(newTx(forwarderAddr, test.input), storeView)
+			require.Nil(vmErr)
+			assert.Equal(test.expected[:64], common.Bytes2Hex(vmRet), "%v %v", vector.addr, test.name)
+
+			// Called by the transaction, with the gas of the precompiled contract charged on top of the
+			// intrinsic gas
+			tx := newTx(precompileAddr, test.input)
+			vmRet, _, gasUsed, vmErr := Execute(tx, storeView)
+			require.Nil(vmErr)
+			assert.Equal(test.expected, common.Bytes2Hex(vmRet), "%v %v", vector.addr, test.name)
+			intrinsicGas, err := calculateIntrinsicGas(tx.Data, false)
+			require.Nil(err)
+			assert.Equal(intrinsicGas+test.gas, gasUsed, "%v %v", vector.addr, test.name)
+		}
+	}
+
+	// Out of gas
+	tx := newTx(common.BytesToAddress([]byte{1}), ecrecoverTests[0].input)
+	intrinsicGas, err := calculateIntrinsicGas(tx.Data, false)
+	require.Nil(err)
+	tx.GasLimit = intrinsicGas + 2999
+	_, _, gasUsed, vmErr := Execute(tx, storeView)
+	assert.Equal(ErrOutOfGas, vmErr)
+	assert.Equal(tx.GasLimit, gasUsed)
+
+	// The chain specific precompiled contracts are only available from their activation heights
+	chainPrecompileAddr := common.BytesToAddress([]byte{0x01, 0x00})
+	RegisterPrecompiledContract(chainPrecompileAddr, storeView.Height()+1, &testPrecompiledContract{})
+	defer delete(chainPrecompiledContracts, chainPrecompileAddr)
+
+	vmRet, _, _, vmErr := Execute(newTx(chainPrecompileAddr, "2a"), storeView)
+	require.Nil(vmErr)
+	assert.Equal(0, len(vmRet))
+	storeView.IncrementHeight()
+	vmRet, _, gasUsed, vmErr = Execute(newTx(chainPrecompileAddr, "2a"), storeView)
+	require.Nil(vmErr)
+	assert.Equal(append([]byte("test:"), 0x2a), []byte(vmRet))
+	assert.Equal(uint64(21000+68+101), gasUsed)
+}
+
+func TestVMExecuteInternalTransfers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	storeView := state.NewStoreView(0, common.Hash{}, backend.NewMemDatabase())
+	privAccounts := prepareInitState(storeView, 1)
+	callerAddr := privAccounts[0].Account.Address
+
+	// ASM:
+	// push 0x0, push 0x0, push 0x0, push 0x0, push value, push20 addr, gas, call, pop
+	callCode := func(addr common.Address, value int) string {
+		return fmt.Sprintf("6000600060006000"+"61%04x"+"73%x"+"5af150", value, addr.Bytes())
+	}
+	contractA := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	contractB := common.HexToAddress("0x1000000000000000000000000000000000000002")
+	contractD := common.HexToAddress("0x1000000000000000000000000000000000000004")
+	contractE := common.HexToAddress("0x1000000000000000000000000000000000000005")
+	accountC := common.HexToAddress("0x2000000000000000000000000000000000000001")
+	beneficiary := common.HexToAddress("0x2000000000000000000000000000000000000002")
+
+	// A sends 100 to B, which forwards 30 to C. A then sends 5 to D, which reverts, and calls E, which
+	// self-destructs to the beneficiary.
+	storeView.SetCode(contractA, common.Hex2Bytes(callCode(contractB, 100)+callCode(contractD, 5)+callCode(contractE, 0)+"00"))
+	storeView.SetCode(contractB, common.Hex2Bytes(callCode(accountC, 30)+"00"))
+	storeView.SetCode(contractD, common.Hex2Bytes("60006000fd"))
+	storeView.SetCode(contractE, common.Hex2Bytes(fmt.Sprintf("73%xff", beneficiary.Bytes())))
+	storeView.AddBalance(contractE, big.NewInt(7))
+	storeView.CreateAccount(beneficiary)
+	storeView.Save()
+
+	addresses := []common.Address{callerAddr, contractA, contractB, contractD, contractE, accountC, beneficiary}
+	balances := func() map[common.Address]*big.Int {
+		balances := make(map[common.Address]*big.Int)
+		for _, addr := range addresses {
+			balances[addr] = big.NewInt(0)
+			if account := storeView.GetAccount(addr); account != nil {
+				balances[addr] = account.Balance.TFuelWei
+			}
+		}
+		return balances
+	}
+	newTx := func(to common.Address, value int64, gasLimit uint64) *types.SmartContractTx {
+		return &types.SmartContractTx{
+			From:     types.TxInput{Address: callerAddr, Coins: types.NewCoins(0, value)},
+			To:       types.TxOutput{Address: to},
+			GasLimit: gasLimit,
+			GasPrice: big.NewInt(5000),
+		}
+	}
+
+	before := balances()
+	_, _, _, transfers, vmErr := ExecuteWithInternalTransfers(newTx(contractA, 1000, 200000), storeView, 0, nil)
+	require.Nil(vmErr)
+	assert.False(transfers.Truncated)
+	require.Equal(4, len(transfers.Transfers))
+	expected := []types.InternalTransfer{
+		{Type: "CALL", From: contractA, To: contractB, Amount: types.NewCoins(0, 100), Depth: 1, Success: true},
+		{Type: "CALL", From: contractB, To: accountC, Amount: types.NewCoins(0, 30), Depth: 2, Success: true},
+		{Type: "CALL", From: contractA, To: contractD, Amount: types.NewCoins(0, 5), Depth: 1, Success: false},
+		{Type: "SELFDESTRUCT", From: contractE, To: beneficiary, Amount: types.NewCoins(0, 7), Depth: 2, Success: true},
+	}
+	for i, transfer := range transfers.Transfers {
+		assert.Equal(expected[i].Type, transfer.Type)
+		assert.Equal(expected[i].From, transfer.From)
+		assert.Equal(expected[i].To, transfer.To)
+		assert.True(expected[i].Amount.IsEqual(transfer.Amount), "%v: %v", i, transfer.Amount)
+		assert.Equal(expected[i].Depth, transfer.Depth)
+		assert.Equal(expected[i].Success, transfer.Success)
+	}
+
+	// The top-level transfer and the successful internal transfers explain the balance changes
+	deltas := make(map[common.Address]*big.Int)
+	for _, addr := range addresses {
+		deltas[addr] = big.NewInt(0)
+	}
+	deltas[callerAddr].Sub(deltas[callerAddr], big.NewInt(1000))
+	deltas[contractA].Add(deltas[contractA], big.NewInt(1000))
+	for _, transfer := range transfers.Transfers {
+		if transfer.Success {
+			deltas[transfer.From].Sub(deltas[transfer.From], transfer.Amount.TFuelWei)
+			deltas[transfer.To].Add(deltas[transfer.To], transfer.Amount.TFuelWei)
+		}
+	}
+	after := balances()
+	for _, addr := range addresses {
+		assert.Equal(0, new(big.Int).Sub(after[addr], before[addr]).Cmp(deltas[addr]), addr.Hex())
+	}
+
+	// When the contract called by the transaction reverts, all the internal transfers are reverted
+	contractG := common.HexToAddress("0x1000000000000000000000000000000000000007")
+	storeView.SetCode(contractG, common.Hex2Bytes(callCode(contractB, 100)+"60006000fd"))
+	_, _, _, transfers, vmErr = ExecuteWithInternalTransfers(newTx(contractG, 1000, 200000), storeView, 0, nil)
+	assert.Equal(ErrExecutionReverted, vmErr)
+	require.Equal(2, len(transfers.Transfers))
+	for _, transfer := range transfers.Transfers {
+		assert.False(transfer.Success)
+	}
+
+	// The recorded transfers are capped
+	code := ""
+	for i := 0; i < types.MaxInternalTransfersPerTx+2; i++ {
+		code += callCode(accountC, 1)
+	}
+	contractF := common.HexToAddress("0x1000000000000000000000000000000000000006")
+	storeView.SetCode(contractF, common.Hex2Bytes(code+"00"))
+	_, _, _, transfers, vmErr = ExecuteWithInternalTransfers(newTx(contractF, 1000, types.MaximumTxGasLimit), storeView, 0, nil)
+	require.Nil(vmErr)
+	assert.True(transfers.Truncated)
+	assert.Equal(types.MaxInternalTransfersPerTx, len(transfers.Transfers))
+}
+
+func TestVMExecuteCreate2(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	storeView := state.NewStoreView(common.HeightEnableCreate2-2, common.Hash{}, backend.NewMemDatabase())
+	privAccounts := prepareInitState(storeView, 1) // at height common.HeightEnableCreate2-1
+	callerAddr := privAccounts[0].Account.Address
+
+	// The factory deploys the init code passed as the input with CREATE2 and salt 0x2a, and returns the address
+	// ASM:
+	// calldatasize, push 0x0, push 0x0, calldatacopy
+	// push 0x2a, calldatasize, push 0x0, push 0x0, create2
+	// push 0x0, mstore, push 0x20, push 0x0, return
+	factoryAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	storeView.SetCode(factoryAddr, common.Hex2Bytes("366000600037"+"602a3660006000f5"+"60005260206000f3"))
+
+	// The init code increments slot 0, and deploys a contract self-destructing when called
+	// ASM:
+	// push 0x0, sload, push 0x1, add, push 0x0, sstore
+	// push2 0x33ff (caller, selfdestruct), push 0x0, mstore, push 0x2, push 0x1e, return
+	initCode := common.Hex2Bytes("600054600101600055" + "6133ff600052" + "6002601ef3")
+	childAddr := types.CreateContractAddress2(factoryAddr, common.BigToHash(big.NewInt(0x2a)), initCode)
+
+	newTx := func(to common.Address, data []byte) *types.SmartContractTx {
+		return &types.SmartContractTx{
+			From:     types.TxInput{Address: callerAddr},
+			To:       types.TxOutput{Address: to},
+			GasLimit: 200000,
+			GasPrice: big.NewInt(5000),
+			Data:     data,
+		}
+	}
+	deploy := func() common.Address {
+		vmRet, _, _, vmErr := Execute(newTx(factoryAddr, initCode), storeView)
+		require.Nil(vmErr)
+		return common.BytesToAddress(vmRet)
+	}
+
+	// Not available before the fork
+	_, _, gasUsed, vmErr := Execute(newTx(factoryAddr, initCode), storeView)
+	assert.NotNil(vmErr)
+	assert.Equal(uint64(200000), gasUsed)
+	assert.Nil(storeView.GetAccount(childAddr))
+
+	// Deployed at the precomputed address
+	storeView.IncrementHeight()
+	assert.Equal(childAddr, deploy())
+	assert.Equal(common.Hex2Bytes("33ff"), storeView.GetCode(childAddr))
+	assert.Equal(common.BigToHash(big.NewInt(1)), storeView.GetState(childAddr, common.Hash{}))
+
+	// Can not be deployed again while the contract exists
+	assert.Equal(common.Address{}, deploy())
+	assert.Equal(common.BigToHash(big.NewInt(1)), storeView.GetState(childAddr, common.Hash{}))
+
+	// Redeployed at the same address after the contract self-destructs, with a fresh storage
+	_, _, _, vmErr = Execute(newTx(childAddr, nil), storeView)
+	require.Nil(vmErr)
+	assert.Nil(storeView.GetAccount(childAddr))
+	assert.Equal(childAddr, deploy())
+	assert.Equal(common.Hex2Bytes("33ff"), storeView.GetCode(childAddr))
+	assert.Equal(common.BigToHash(big.NewInt(1)), storeView.GetState(childAddr, common.Hash{}))
+
+	// Nor into an address with a non-zero sequence
+	_, _, _, vmErr = Execute(newTx(childAddr, nil), storeView)
+	require.Nil(vmErr)
+	storeView.SetAccount(childAddr, &types.Account{Address: childAddr, Sequence: 1, Root: common.Hash{},
+		CodeHash: types.EmptyCodeHash, Balance: types.NewCoins(0, 0)})
+	assert.Equal(common.Address{}, deploy())
+	assert.Equal(0, len(storeView.GetCode(childAddr)))
+
+	// The gas of CREATE2 covers the hashing of the init code on top of the gas of CREATE
+	stack := newstack()
+	stack.push(big.NewInt(0x2a))
+	stack.push(big.NewInt(int64(len(initCode))))
+	stack.push(big.NewInt(0))
+	stack.push(big.NewInt(0))
+	gas, err := gasCreate2(params.GasTable{}, nil, nil, stack, NewMemory(), 0)
+	require.Nil(err)
+	assert.Equal(params.Create2Gas+params.Sha3WordGas, gas)
+}
+
 // ----------- Utilities ----------- //
 
+func TestVMExecuteStorageSlotDeletion(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// ASM:
+	// push 0x0, push 0x0, sstore, stop
+	contractAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	clear := func(height uint64) (*state.StoreView, common.Hash) {
+		storeView := state.NewStoreView(height-1, common.Hash{}, backend.NewMemDatabase())
+		privAccounts := prepareInitState(storeView, 1) // at the given height
+		storeView.SetCode(contractAddr, common.Hex2Bytes("600060005500"))
+		storeView.SetState(contractAddr, common.Hash{}, common.BigToHash(big.NewInt(1)))
+		storageRoot := storeView.GetAccount(contractAddr).Root
+
+		tx := &types.SmartContractTx{
+			From:     types.TxInput{Address: privAccounts[0].Account.Address},
+			To:       types.TxOutput{Address: contractAddr},
+			GasLimit: 100000,
+			GasPrice: big.NewInt(5000),
+		}
+		_, _, _, vmErr := Execute(tx, storeView)
+		require.Nil(vmErr)
+		return storeView, storageRoot
+	}
+
+	// Before the fork, the cleared slot keeps its value, as the blocks executed then did
+	storeView, storageRoot := clear(common.HeightEnableStorageSlotDeletion - 2)
+	assert.Equal(common.BigToHash(big.NewInt(1)), storeView.GetState(contractAddr, common.Hash{}))
+	assert.Equal(storageRoot, storeView.GetAccount(contractAddr).Root)
+
+	// From the fork, it is deleted from the storage of the contract
+	storeView, storageRoot = clear(common.HeightEnableStorageSlotDeletion - 1)
+	assert.Equal(common.Hash{}, storeView.GetState(contractAddr, common.Hash{}))
+	assert.NotEqual(storageRoot, storeView.GetAccount(contractAddr).Root)
+}
+
+func TestVMExecuteInfiniteLoop(t *testing.T) {
+	assert := assert.New(t)
+
+	storeView := state.NewStoreView(0, common.Hash{}, backend.NewMemDatabase())
+	privAccounts := prepareInitState(storeView, 1)
+	callerAcc := privAccounts[0].Account
+
+	// ASM:
+	// jumpdest
+	// push 0x0
+	// jump
+	contractAddr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	storeView.SetCode(contractAddr, common.Hex2Bytes("5b600056"))
+	storeView.Save()
+
+	callSCTx := &types.SmartContractTx{
+		From:     types.TxInput{Address: callerAcc.Address, Coins: types.NewCoins(0, 1000)},
+		To:       types.TxOutput{Address: contractAddr},
+		GasLimit: types.MaximumTxGasLimit,
+		GasPrice: big.NewInt(5000),
+	}
+
+	// The loop runs out of gas deterministically
+	_, _, gasUsed, vmErr := Execute(callSCTx, storeView)
+	assert.Equal(ErrOutOfGas, vmErr)
+	assert.Equal(types.MaximumTxGasLimit, gasUsed)
+	assert.Equal(0, storeView.GetBalance(contractAddr).Sign())
+
+	// Or is aborted once it exceeds the time limit
+	start := time.Now()
+	_, _, _, vmErr = ExecuteWithTimeLimit(callSCTx, storeView, time.Millisecond)
+	assert.Equal(ErrExecutionAborted, vmErr)
+	assert.True(time.Since(start) < time.Second)
+	assert.Equal(0, storeView.GetBalance(contractAddr).Sign())
+
+	// The time limit does not affect the fast executions
+	_, _, gasUsed, vmErr = ExecuteWithTimeLimit(callSCTx, storeView, time.Minute)
+	assert.Equal(ErrOutOfGas, vmErr)
+	assert.Equal(types.MaximumTxGasLimit, gasUsed)
+}
+
 func prepareInitState(storeView *state.StoreView, numAccounts int) (privAccounts []types.PrivAccount) {
 	for i := 0; i < numAccounts; i++ {
 		secret := "acc_secret_" + strconv.FormatInt(int64(i), 16)
@@ -24,6 +24,7 @@ func (s StructLog) MarshalJSON() ([]byte, error) {
 		Stack       []*math.HexOrDecimal256     `json:"stack"`
 		Storage     map[common.Hash]common.Hash `json:"-"`
 		Depth       int                         `json:"depth"`
+		Address     common.Address              `json:"address"`
 		Err         error                       `json:"-"`
 		OpName      string                      `json:"opName"`
 		ErrorString string                      `json:"error"`
@@ -43,6 +44,7 @@ func (s StructLog) MarshalJSON() ([]byte, error) {
 	}
 	enc.Storage = s.Storage
 	enc.Depth = s.Depth
+	enc.Address = s.Address
 	enc.Err = s.Err
 	enc.OpName = s.OpName()
 	enc.ErrorString = s.ErrorString()
@@ -60,6 +62,7 @@ func (s *StructLog) UnmarshalJSON(input []byte) error {
 		Stack      []*math.HexOrDecimal256     `json:"stack"`
 		Storage    map[common.Hash]common.Hash `json:"-"`
 		Depth      *int                        `json:"depth"`
+		Address    *common.Address             `json:"address"`
 		Err        error                       `json:"-"`
 	}
 	var dec StructLog
@@ -96,6 +99,9 @@ func (s *StructLog) UnmarshalJSON(input []byte) error {
 	if dec.Depth != nil {
 		s.Depth = *dec.Depth
 	}
+	if dec.Address != nil {
+		s.Address = *dec.Address
+	}
 	if dec.Err != nil {
 		s.Err = dec.Err
 	}
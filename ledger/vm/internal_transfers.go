@@ -0,0 +1,47 @@
+package vm
+
+import (
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/ledger/types"
+)
+
+// InternalTransferLog records the value transfers made by the contracts during an execution, in the order they
+// are made, i.e. the transfers of the CALL, CREATE and CREATE2 frames entered with a value, and of SELFDESTRUCT.
+// It is derived from the call frames alone, the same as a FrameTracer would see them, so it is deterministic.
+type InternalTransferLog struct {
+	Transfers []*types.InternalTransfer
+	Truncated bool // True if the transfers beyond types.MaxInternalTransfersPerTx were dropped
+}
+
+// record appends a transfer made by a contract at the given depth. The zero transfers are not recorded.
+func (l *InternalTransferLog) record(typ OpCode, from, to common.Address, amount *big.Int, depth int) {
+	if amount.Sign() == 0 {
+		return
+	}
+	if len(l.Transfers) >= types.MaxInternalTransfersPerTx {
+		l.Truncated = true
+		return
+	}
+	l.Transfers = append(l.Transfers, &types.InternalTransfer{
+		Type:    typ.String(),
+		From:    from,
+		To:      to,
+		Amount:  types.Coins{ThetaWei: big.NewInt(0), TFuelWei: new(big.Int).Set(amount)},
+		Depth:   uint64(depth),
+		Success: true,
+	})
+}
+
+// revert marks the transfers recorded since the given mark, i.e. by a failed frame and its sub-frames, as reverted
+func (l *InternalTransferLog) revert(mark int) {
+	for _, transfer := range l.Transfers[mark:] {
+		transfer.Success = false
+	}
+}
+
+// mark returns the position of the next transfer to record, to revert the transfers of a frame if it fails
+func (l *InternalTransferLog) mark() int {
+	return len(l.Transfers)
+}
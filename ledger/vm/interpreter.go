@@ -44,6 +44,10 @@ type Config struct {
 	EWASMInterpreter string
 	// Type of the EVM interpreter
 	EVMInterpreter string
+
+	// ChainConfig schedules the forks, which select the instructions and the gas
+	// costs at the block number of the EVM. The MainnetChainConfig is used if nil.
+	ChainConfig *ChainConfig
 }
 
 // Interpreter is used to run Ethereum based contracts and will utilise the
@@ -84,15 +88,22 @@ func NewEVMInterpreter(evm *EVM, cfg Config) *EVMInterpreter {
 	// We use the STOP instruction whether to see
 	// the jump table was initialised. If it was not
 	// we'll set the default jump table.
+	chainConfig := cfg.ChainConfig
+	if chainConfig == nil {
+		chainConfig = MainnetChainConfig
+	}
+	blockHeight := uint64(0)
+	if evm.BlockNumber != nil {
+		blockHeight = evm.BlockNumber.Uint64()
+	}
 	if !cfg.JumpTable[STOP].valid {
-		cfg.JumpTable = constantinopleInstructionSet
+		cfg.JumpTable = chainConfig.instructionSet(blockHeight)
 	}
 
 	return &EVMInterpreter{
-		evm: evm,
-		cfg: cfg,
-		// gasTable: evm.ChainConfig().GasTable(evm.BlockNumber),
-		gasTable: params.ThetaGasTable,
+		evm:      evm,
+		cfg:      cfg,
+		gasTable: chainConfig.GasTable(blockHeight),
 	}
 }
 
@@ -115,7 +126,7 @@ func (in *EVMInterpreter) enforceRestrictions(op OpCode, operation operation, st
 //
 // It's important to note that any errors returned by the interpreter should be
 // considered a revert-and-consume-all-gas operation except for
-// errExecutionReverted which means revert-and-keep-gas-left.
+// ErrExecutionReverted which means revert-and-keep-gas-left.
 func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (ret []byte, err error) {
 	if in.intPool == nil {
 		in.intPool = poolOfIntPools.get()
@@ -178,7 +189,7 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 	// The Interpreter main run loop (contextual). This loop runs until either an
 	// explicit STOP, RETURN or SELFDESTRUCT is executed, an error occurred during
 	// the execution of one of the operations or until the done flag is set by the
-	// parent context.
+	// parent context, in which case the execution fails with ErrExecutionAborted.
 	for atomic.LoadInt32(&in.evm.abort) == 0 {
 		if in.cfg.Debug {
 			// Capture pre-execution values for tracing.
@@ -246,14 +257,14 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 		case err != nil:
 			return nil, err
 		case operation.reverts:
-			return res, errExecutionReverted
+			return res, ErrExecutionReverted
 		case operation.halts:
 			return res, nil
 		case !operation.jumps:
 			pc++
 		}
 	}
-	return nil, nil
+	return nil, ErrExecutionAborted
 }
 
 // CanRun tells if the contract, passed as an argument, can be
@@ -55,10 +55,41 @@ var (
 	homesteadInstructionSet      = newHomesteadInstructionSet()
 	byzantiumInstructionSet      = newByzantiumInstructionSet()
 	constantinopleInstructionSet = newConstantinopleInstructionSet()
+	create2InstructionSet        = newCreate2InstructionSet()
+	eip1884InstructionSet        = newEIP1884InstructionSet()
 )
 
+// newEIP1884InstructionSet returns the CREATE2 instruction set along with
+// SELFBALANCE, which is activated by the EIP-1884 fork, see ChainConfig.
+func newEIP1884InstructionSet() [256]operation {
+	instructionSet := newCreate2InstructionSet()
+	instructionSet[SELFBALANCE] = operation{
+		execute:       opSelfBalance,
+		gasCost:       constGasFunc(GasFastStep),
+		validateStack: makeStackFunc(0, 1),
+		valid:         true,
+	}
+	return instructionSet
+}
+
+// newCreate2InstructionSet returns the constantinople instructions along
+// with CREATE2, which is activated by the CREATE2 fork, see ChainConfig.
+func newCreate2InstructionSet() [256]operation {
+	instructionSet := newConstantinopleInstructionSet()
+	instructionSet[CREATE2] = operation{
+		execute:       opCreate2,
+		gasCost:       gasCreate2,
+		validateStack: makeStackFunc(4, 1),
+		memorySize:    memoryCreate2,
+		valid:         true,
+		writes:        true,
+		returns:       true,
+	}
+	return instructionSet
+}
+
 // NewConstantinopleInstructionSet returns the frontier, homestead
-// byzantium and contantinople instructions.
+// byzantium and contantinople instructions, except for CREATE2.
 func newConstantinopleInstructionSet() [256]operation {
 	// instructions that can be executed during the byzantium phase.
 	instructionSet := newByzantiumInstructionSet()
@@ -86,15 +117,6 @@ func newConstantinopleInstructionSet() [256]operation {
 		validateStack: makeStackFunc(1, 1),
 		valid:         true,
 	}
-	instructionSet[CREATE2] = operation{
-		execute:       opCreate2,
-		gasCost:       gasCreate2,
-		validateStack: makeStackFunc(4, 1),
-		memorySize:    memoryCreate2,
-		valid:         true,
-		writes:        true,
-		returns:       true,
-	}
 	return instructionSet
 }
 
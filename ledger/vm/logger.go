@@ -64,6 +64,7 @@ type StructLog struct {
 	Stack      []*big.Int                  `json:"stack"`
 	Storage    map[common.Hash]common.Hash `json:"-"`
 	Depth      int                         `json:"depth"`
+	Address    common.Address              `json:"address"` // the address of the executing contract
 	Err        error                       `json:"-"`
 }
 
@@ -102,6 +103,17 @@ type Tracer interface {
 	CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error
 }
 
+// FrameTracer is a Tracer that is also notified of the nested call frames, i.e. the calls and
+// contract creations made by the contracts. CaptureEnter is called before the code of the frame
+// runs, and CaptureExit once it returns. The frames failing before their code runs, e.g. for
+// exceeding the call depth limit, are not reported. The top-level frame is still reported with
+// CaptureStart and CaptureEnd.
+type FrameTracer interface {
+	Tracer
+	CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int)
+	CaptureExit(output []byte, gasUsed uint64, err error)
+}
+
 // StructLogger is an EVM state logger and implements Tracer.
 //
 // StructLogger can capture state based on the given Log configuration and also keeps
@@ -113,6 +125,7 @@ type StructLogger struct {
 	logs          []StructLog
 	changedValues map[common.Address]Storage
 	output        []byte
+	gasUsed       uint64
 	err           error
 }
 
@@ -176,7 +189,7 @@ func (l *StructLogger) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost ui
 		storage = l.changedValues[contract.Address()].Copy()
 	}
 	// create a new snaptshot of the EVM.
-	log := StructLog{pc, op, gas, cost, mem, memory.Len(), stck, storage, depth, err}
+	log := StructLog{pc, op, gas, cost, mem, memory.Len(), stck, storage, depth, contract.Address(), err}
 
 	l.logs = append(l.logs, log)
 	return nil
@@ -191,6 +204,7 @@ func (l *StructLogger) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost ui
 // CaptureEnd is called after the call finishes to finalize the tracing.
 func (l *StructLogger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
 	l.output = output
+	l.gasUsed = gasUsed
 	l.err = err
 	if l.cfg.Debug {
 		fmt.Printf("0x%x\n", output)
@@ -210,6 +224,32 @@ func (l *StructLogger) Error() error { return l.err }
 // Output returns the VM return value captured by the trace.
 func (l *StructLogger) Output() []byte { return l.output }
 
+// StructLoggerResult is the JSON form of the trace captured by a StructLogger
+type StructLoggerResult struct {
+	Gas         math.HexOrDecimal64 `json:"gas"` // the gas used by the top-level frame, excluding the intrinsic gas
+	Failed      bool                `json:"failed"`
+	Error       string              `json:"error,omitempty"`
+	ReturnValue hexutil.Bytes       `json:"returnValue"`
+	StructLogs  []StructLog         `json:"structLogs"`
+}
+
+// Result returns the trace captured by the logger in its JSON form.
+func (l *StructLogger) Result() *StructLoggerResult {
+	res := &StructLoggerResult{
+		Gas:         math.HexOrDecimal64(l.gasUsed),
+		Failed:      l.err != nil,
+		ReturnValue: l.output,
+		StructLogs:  l.logs,
+	}
+	if l.err != nil {
+		res.Error = l.err.Error()
+	}
+	if res.StructLogs == nil {
+		res.StructLogs = []StructLog{}
+	}
+	return res
+}
+
 // WriteTrace writes a formatted trace to the given writer
 func WriteTrace(writer io.Writer, logs []StructLog) {
 	for _, log := range logs {
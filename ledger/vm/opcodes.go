@@ -103,6 +103,9 @@ const (
 	GASLIMIT
 )
 
+// SELFBALANCE is activated by the EIP-1884 fork, see ChainConfig
+const SELFBALANCE OpCode = 0x47
+
 // 0x50 range - 'storage' and execution.
 const (
 	POP OpCode = 0x50 + iota
@@ -278,6 +281,8 @@ var opCodeToString = map[OpCode]string{
 	DIFFICULTY: "DIFFICULTY",
 	GASLIMIT:   "GASLIMIT",
 
+	SELFBALANCE: "SELFBALANCE",
+
 	// 0x50 range - 'storage' and execution.
 	POP: "POP",
 	//DUP:     "DUP",
@@ -444,6 +449,7 @@ var stringToOp = map[string]OpCode{
 	"NUMBER":         NUMBER,
 	"DIFFICULTY":     DIFFICULTY,
 	"GASLIMIT":       GASLIMIT,
+	"SELFBALANCE":    SELFBALANCE,
 	"POP":            POP,
 	"MLOAD":          MLOAD,
 	"MSTORE":         MSTORE,
@@ -50,4 +50,18 @@ var (
 
 		CreateBySuicide: 25000,
 	}
+
+	// ThetaEIP1884GasTable reprices the state access instructions as of EIP-1884
+	ThetaEIP1884GasTable = GasTable{
+		ExtcodeSize: 700,
+		ExtcodeCopy: 700,
+		ExtcodeHash: 700,
+		Balance:     700,
+		SLoad:       800,
+		Calls:       700,
+		Suicide:     5000,
+		ExpByte:     50,
+
+		CreateBySuicide: 25000,
+	}
 )
@@ -0,0 +1,58 @@
+package vm
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/thetatoken/theta/common"
+)
+
+// revertSelector is the selector of the standard Error(string) revert reason, i.e. the first 4 bytes of
+// keccak256("Error(string)")
+var revertSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+
+// UnpackRevertReason decodes the message of the standard Error(string) revert reason from the data returned by
+// a reverted execution, e.g. require(condition, "message") in Solidity. It returns false if the data is not a
+// well-formed Error(string), e.g. a custom error, in which case only the raw data is available.
+func UnpackRevertReason(data []byte) (string, bool) {
+	if len(data) < len(revertSelector) || !bytes.Equal(data[:len(revertSelector)], revertSelector) {
+		return "", false
+	}
+	args := data[len(revertSelector):]
+
+	offset, ok := abiWord(args, 0)
+	if !ok {
+		return "", false
+	}
+	length, ok := abiWord(args, offset)
+	if !ok {
+		return "", false
+	}
+	start := offset + 32
+	if length > uint64(len(args))-start {
+		return "", false
+	}
+	return string(args[start : start+length]), true
+}
+
+// PackRevertReason encodes the message as the standard Error(string) revert reason, e.g. for a precompiled
+// contract to revert its call with a message like require(condition, "message") in Solidity
+func PackRevertReason(reason string) []byte {
+	data := append([]byte{}, revertSelector...)
+	data = append(data, common.BigToHash(big.NewInt(32)).Bytes()...)
+	data = append(data, common.BigToHash(big.NewInt(int64(len(reason)))).Bytes()...)
+	return append(data, common.RightPadBytes([]byte(reason), (len(reason)+31)/32*32)...)
+}
+
+// abiWord returns the 32 byte big-endian word at the offset of the ABI encoded data as an uint64, and false if
+// the word is out of bounds or does not fit
+func abiWord(data []byte, offset uint64) (uint64, bool) {
+	if offset > uint64(len(data)) || uint64(len(data))-offset < 32 {
+		return 0, false
+	}
+	word := new(big.Int).SetBytes(data[offset : offset+32])
+	if !word.IsUint64() || word.Uint64() > uint64(len(data)) {
+		return 0, false
+	}
+	return word.Uint64(), true
+}
@@ -0,0 +1,52 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thetatoken/theta/common"
+)
+
+func TestUnpackRevertReason(t *testing.T) {
+	assert := assert.New(t)
+
+	// Error("insufficient balance"), as returned by require(condition, "insufficient balance")
+	data := common.Hex2Bytes("08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000014" +
+		"696e73756666696369656e742062616c616e6365000000000000000000000000")
+	reason, ok := UnpackRevertReason(data)
+	assert.True(ok)
+	assert.Equal("insufficient balance", reason)
+	assert.Equal(data, PackRevertReason("insufficient balance"))
+
+	// The empty message
+	reason, ok = UnpackRevertReason(common.Hex2Bytes("08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000000"))
+	assert.True(ok)
+	assert.Equal("", reason)
+
+	// A custom error, or no data at all
+	_, ok = UnpackRevertReason(common.Hex2Bytes("deadbeef" +
+		"000000000000000000000000000000000000000000000000000000000000002a"))
+	assert.False(ok)
+	_, ok = UnpackRevertReason(nil)
+	assert.False(ok)
+	_, ok = UnpackRevertReason(data[:4])
+	assert.False(ok)
+
+	// The message is truncated
+	_, ok = UnpackRevertReason(data[:len(data)-20])
+	assert.False(ok)
+
+	// The offset or the length is out of bounds
+	badOffset := append([]byte{}, data...)
+	badOffset[35] = 0x80
+	_, ok = UnpackRevertReason(badOffset)
+	assert.False(ok)
+	badLength := append([]byte{}, data...)
+	badLength[4+32] = 0xff
+	_, ok = UnpackRevertReason(badLength)
+	assert.False(ok)
+}
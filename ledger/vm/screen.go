@@ -0,0 +1,118 @@
+package vm
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+// ScreenDeployment checks whether the given contract deployment is bound to fail, whatever the state it is executed
+// against at the given height, with the forks scheduled by the given chain configuration. It returns the error the
+// execution fails with, and the revert data if it reverts, or a nil error if the deployment might succeed. The
+// deployment fails with ErrIntrinsicGasNotCovered if the gas limit does not cover the intrinsic gas of the init code.
+//
+// If gasCap is positive, the init code is also run in a sandbox with an empty state, with at most gasCap gas on top
+// of the intrinsic gas. The outcome of the sandbox only counts if the init code ran none of the instructions whose
+// outcome depends on the state or the block, e.g. SLOAD, BALANCE, TIMESTAMP or the calls, and failed for a reason
+// other than running out of gas, e.g. ErrExecutionReverted or ErrMaxCodeSizeExceeded, in which case the execution
+// follows the same path in any state until it fails the same way, or runs out of gas before.
+//
+// A PUSH truncated by the end of the init code is not screened out, since the bytes missing read as zeros, and the
+// metadata the Solidity compiler appends to the code often ends with one.
+func ScreenDeployment(tx *types.SmartContractTx, chainConfig *ChainConfig, height uint64, gasCap uint64) (revertData common.Bytes, err error) {
+	intrinsicGas, err := calculateIntrinsicGas(tx.Data, true)
+	if err != nil || intrinsicGas > tx.GasLimit {
+		return nil, ErrIntrinsicGasNotCovered
+	}
+	if gasCap == 0 {
+		return nil, nil
+	}
+
+	// The sandbox tx has the same sender, sequence, value and init code, so that the deterministic instructions
+	// behave the same as in the actual execution
+	sandboxTx := *tx
+	if remainingGas := tx.GasLimit - intrinsicGas; remainingGas > gasCap {
+		sandboxTx.GasLimit = intrinsicGas + gasCap
+	}
+	sandbox := state.NewStoreView(height, common.Hash{}, backend.NewMemDatabase())
+	value := tx.From.Coins.TFuelWei
+	if value == nil {
+		value = big.NewInt(0)
+	}
+	sequence := tx.From.Sequence
+	if sequence > 0 {
+		sequence-- // the sequence of the tx is validated against the next sequence of the account
+	}
+	sandbox.SetAccount(tx.From.Address, &types.Account{
+		Address:  tx.From.Address,
+		Sequence: sequence,
+		Balance:  types.Coins{ThetaWei: big.NewInt(0), TFuelWei: new(big.Int).Set(value)},
+	})
+
+	tracer := &stateDependencyTracer{}
+	evmRet, _, _, _, evmErr := ExecuteWithChainConfig(&sandboxTx, sandbox, chainConfig, 0, tracer)
+	if evmErr == nil || tracer.dependent {
+		return nil, nil
+	}
+	switch evmErr {
+	case ErrOutOfGas, ErrCodeStoreOutOfGas, errGasUintOverflow, ErrExecutionAborted, ErrDepth,
+		ErrInsufficientBalance, ErrContractAddressCollision:
+		return nil, nil // depends on the gas cap, or on the state
+	case ErrExecutionReverted:
+		return common.Bytes(evmRet), evmErr
+	}
+	return nil, evmErr
+}
+
+// stateDependencyTracer records whether the execution ran an instruction whose outcome might depend on the state or
+// the block the tx is executed in, in which case the execution is aborted
+type stateDependencyTracer struct {
+	dependent bool
+}
+
+// CaptureStart implements the Tracer interface
+func (t *stateDependencyTracer) CaptureStart(from common.Address, to common.Address, call bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureState implements the Tracer interface. It is called with the instructions that fail before they run as
+// well, e.g. for an invalid opcode.
+func (t *stateDependencyTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack,
+	contract *Contract, depth int, err error) error {
+	if !isDeterministicOp(op) {
+		t.dependent = true
+		env.Cancel()
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface
+func (t *stateDependencyTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack,
+	contract *Contract, depth int, err error) error {
+	return t.CaptureState(env, pc, op, gas, cost, memory, stack, contract, depth, err)
+}
+
+// CaptureEnd implements the Tracer interface
+func (t *stateDependencyTracer) CaptureEnd(output []byte, gasUsed uint64, duration time.Duration, err error) error {
+	return nil
+}
+
+// isDeterministicOp returns whether the outcome of the instruction only depends on the tx, the code and the
+// instructions before it in a deployment, apart from the gas it costs. The opcodes undefined at all heights are
+// deterministic too, they always fail.
+func isDeterministicOp(op OpCode) bool {
+	switch {
+	case op <= SIGNEXTEND, op >= LT && op <= SAR, op >= PUSH1 && op <= SWAP16, op >= LOG0 && op <= LOG4:
+		return true
+	}
+	switch op {
+	case SHA3, CALLER, CALLVALUE, CALLDATALOAD, CALLDATASIZE, CALLDATACOPY, CODESIZE, CODECOPY, GASPRICE,
+		POP, MLOAD, MSTORE, MSTORE8, SSTORE, JUMP, JUMPI, PC, MSIZE, JUMPDEST, RETURN, REVERT:
+		return true
+	}
+	return !eip1884InstructionSet[op].valid // the latest instruction set
+}
@@ -0,0 +1,146 @@
+package vm
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+const screeningGasCap = 500000
+
+type screeningCase struct {
+	name     string
+	tx       *types.SmartContractTx
+	rejected bool // whether the deployment is expected to be rejected, only checked for the hand-made cases
+}
+
+func TestScreenDeploymentCorpus(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cases := []screeningCase{}
+	for _, file := range []string{"erc20_token.json", "square_calculator.json", "time_locked_safe.json"} {
+		var cbc contractByteCode
+		require.Nil(loadJSONTest("testdata/"+file, &cbc))
+		deploymentCode, err := hex.DecodeString(cbc.DeploymentCode)
+		require.Nil(err)
+
+		// The deployments of the corpus succeed, and are never rejected
+		cases = append(cases, screeningCase{name: file, tx: newDeploymentTx(deploymentCode, 0, 3000000)})
+
+		// Truncated at various offsets, the init code either jumps past its end, returns the truncated
+		// code, or might hit a truncated PUSH
+		for n := 1; n < len(deploymentCode); n += 1 + n/8 {
+			cases = append(cases, screeningCase{
+				name: fmt.Sprintf("%v truncated at %v", file, n),
+				tx:   newDeploymentTx(deploymentCode[:n], 0, 3000000),
+			})
+		}
+
+		// With a value, the non-payable constructors revert
+		cases = append(cases, screeningCase{name: file + " with value", tx: newDeploymentTx(deploymentCode, 1000, 3000000)})
+
+		// With a gas limit too low for the intrinsic gas of the init code, the deployment runs out of gas in any state
+		cases = append(cases, screeningCase{name: file + " with low gas", tx: newDeploymentTx(deploymentCode, 0, 60000)})
+	}
+
+	// Hand-made init codes with known outcomes
+	handMade := []struct {
+		name     string
+		code     string
+		gasLimit uint64
+		rejected bool
+	}{
+		{"revert", "60006000fd", 100000, true},                             // PUSH1 0 PUSH1 0 REVERT
+		{"revert with reason", "60206000fd", 100000, true},                 // PUSH1 32 PUSH1 0 REVERT
+		{"invalid opcode", "fe", 100000, true},                             // INVALID
+		{"undefined opcode", "600160020c", 100000, true},                   // PUSH1 1 PUSH1 2 0x0c
+		{"stack underflow", "01", 100000, true},                            // ADD
+		{"invalid jump", "600556", 100000, true},                           // PUSH1 5 JUMP
+		{"oversized code", "620060016000f3", 10000000, true},               // PUSH3 24577 PUSH1 0 RETURN
+		{"truncated push", "6001600055601f", 100000, false},                // PUSH1 1 PUSH1 0 SSTORE PUSH1 <missing>
+		{"intrinsic gas not covered", "00", 50000, true},                   // STOP
+		{"depends on the balance", "3031600057fe5b00", 100000, false},      // ADDRESS BALANCE PUSH1 0 JUMPI INVALID JUMPDEST STOP
+		{"depends on the timestamp", "42600757fe5b00", 100000, false},      // TIMESTAMP PUSH1 7 JUMPI INVALID JUMPDEST STOP
+		{"runs out of gas", "5b600056", 100000, false},                     // JUMPDEST PUSH1 0 JUMP
+		{"revert after storage", "6001600055600060006000fd", 100000, true}, // PUSH1 1 PUSH1 0 SSTORE PUSH1 0 PUSH1 0 REVERT
+	}
+	for _, c := range handMade {
+		code, err := hex.DecodeString(c.code)
+		require.Nil(err)
+		cases = append(cases, screeningCase{name: c.name, tx: newDeploymentTx(code, 0, c.gasLimit), rejected: c.rejected})
+	}
+
+	numRejected := 0
+	for i, c := range cases {
+		revertData, screenErr := ScreenDeployment(c.tx, MainnetChainConfig, 1, screeningGasCap)
+
+		// The differential check: the deployments rejected at screening fail the same way when actually
+		// executed against a funded state
+		storeView := state.NewStoreView(0, common.Hash{}, backend.NewMemDatabase())
+		privAccounts := prepareInitState(storeView, 1)
+		tx := *c.tx
+		tx.From.Address = privAccounts[0].Address
+		tx.From.Sequence = 1
+		evmRet, _, _, evmErr := Execute(&tx, storeView)
+
+		if screenErr == nil {
+			assert.Nil(revertData, c.name)
+		} else {
+			numRejected++
+			require.NotNil(evmErr, "case #%v %v: rejected with %v, but the execution succeeds", i, c.name, screenErr)
+			if screenErr == ErrIntrinsicGasNotCovered {
+				assert.Equal(ErrOutOfGas, evmErr, c.name)
+			} else {
+				assert.Equal(evmErr.Error(), screenErr.Error(), c.name)
+			}
+			if screenErr == ErrExecutionReverted {
+				assert.Equal(common.Bytes(evmRet), revertData, c.name)
+			}
+		}
+
+		if i < len(cases)-len(handMade) {
+			if c.tx.From.Coins.TFuelWei.Sign() == 0 && c.tx.GasLimit == 3000000 && evmErr == nil {
+				assert.Nil(screenErr, c.name)
+			}
+			continue
+		}
+		assert.Equal(c.rejected, screenErr != nil, "%v: %v", c.name, screenErr)
+	}
+
+	// Some of the mutations of the corpus are caught
+	assert.True(numRejected > len(handMade), "only %v rejected", numRejected)
+}
+
+func TestScreenDeploymentWithoutSandbox(t *testing.T) {
+	assert := assert.New(t)
+
+	revert, _ := hex.DecodeString("60006000fd")
+	revertData, err := ScreenDeployment(newDeploymentTx(revert, 0, 100000), MainnetChainConfig, 1, 0)
+	assert.Nil(err)
+	assert.Nil(revertData)
+
+	_, err = ScreenDeployment(newDeploymentTx(revert, 0, 53000), MainnetChainConfig, 1, 0)
+	assert.Equal(ErrIntrinsicGasNotCovered, err)
+}
+
+func newDeploymentTx(code []byte, value int64, gasLimit uint64) *types.SmartContractTx {
+	return &types.SmartContractTx{
+		From: types.TxInput{
+			Address:  common.HexToAddress("0x2e833968e5bb786ae419c4d13189fb081cc43bab"),
+			Coins:    types.NewCoins(0, value),
+			Sequence: 1,
+		},
+		GasLimit: gasLimit,
+		GasPrice: big.NewInt(50),
+		Data:     code,
+	}
+}
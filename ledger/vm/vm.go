@@ -52,8 +52,10 @@ func Transfer(db StateDB, sender, recipient common.Address, amount *big.Int) {
 // run runs the given contract and takes care of running precompiles with a fallback to the byte code interpreter.
 func run(evm *EVM, contract *Contract, input []byte, readOnly bool) ([]byte, error) {
 	if contract.CodeAddr != nil {
-		precompiles := PrecompiledContractsByzantium
-		if p := precompiles[*contract.CodeAddr]; p != nil {
+		if p := evm.precompiles[*contract.CodeAddr]; p != nil {
+			if sp, ok := p.(StatefulPrecompiledContract); ok {
+				return runStatefulPrecompiledContract(evm, sp, input, contract, readOnly)
+			}
 			return RunPrecompiledContract(p, input, contract)
 		}
 	}
@@ -117,6 +119,10 @@ type EVM struct {
 	chainConfig *params.ChainConfig
 	// chain rules contains the chain rules for the current epoch
 	chainRules params.Rules
+	// precompiles contains the precompiled contracts active at the block number
+	precompiles map[common.Address]PrecompiledContract
+	// transfers records the value transfers made by the contracts
+	transfers *InternalTransferLog
 	// virtual machine configuration options used to initialise the
 	// evm.
 	vmConfig Config
@@ -143,6 +149,7 @@ func NewEVM(ctx Context, statedb StateDB, chainConfig *params.ChainConfig, vmCon
 		chainConfig: chainConfig,
 		// chainRules:   chainConfig.Rules(ctx.BlockNumber),
 		interpreters: make([]Interpreter, 0, 1),
+		transfers:    &InternalTransferLog{},
 	}
 
 	// vmConfig.EVMInterpreter will be used by EVM-C, it won't be checked here
@@ -150,6 +157,12 @@ func NewEVM(ctx Context, statedb StateDB, chainConfig *params.ChainConfig, vmCon
 	evm.interpreters = append(evm.interpreters, NewEVMInterpreter(evm, vmConfig))
 	evm.interpreter = evm.interpreters[0]
 
+	blockHeight := uint64(0)
+	if ctx.BlockNumber != nil {
+		blockHeight = ctx.BlockNumber.Uint64()
+	}
+	evm.precompiles = ActivePrecompiledContracts(blockHeight)
+
 	return evm
 }
 
@@ -164,6 +177,11 @@ func (evm *EVM) Interpreter() Interpreter {
 	return evm.interpreter
 }
 
+// InternalTransfers returns the value transfers made by the contracts so far
+func (evm *EVM) InternalTransfers() *InternalTransferLog {
+	return evm.transfers
+}
+
 // Call executes the contract associated with the addr with the given input as
 // parameters. It also handles any necessary value transfer required and takes
 // the necessary steps to create accounts and reverses the state in case of an
@@ -183,12 +201,12 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 	}
 
 	var (
-		to       = AccountRef(addr)
-		snapshot = evm.StateDB.Snapshot()
+		to           = AccountRef(addr)
+		snapshot     = evm.StateDB.Snapshot()
+		transferMark = evm.transfers.mark()
 	)
 	if !evm.StateDB.Exist(addr) {
-		precompiles := PrecompiledContractsByzantium
-		if precompiles[addr] == nil && value.Sign() == 0 {
+		if evm.precompiles[addr] == nil && value.Sign() == 0 {
 			// Calling a non existing account, don't do anything, but ping the tracer
 			if evm.vmConfig.Debug && evm.depth == 0 {
 				evm.vmConfig.Tracer.CaptureStart(caller.Address(), addr, false, input, gas, value)
@@ -199,11 +217,27 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 		evm.StateDB.CreateAccount(addr)
 	}
 	Transfer(evm.StateDB, caller.Address(), to.Address(), value)
+	if evm.depth > 0 {
+		evm.transfers.record(CALL, caller.Address(), to.Address(), value, evm.depth)
+	}
 	// Initialise a new contract and set the code that is to be used by the EVM.
 	// The contract is a scoped environment for this execution context only.
 	contract := NewContract(caller, to, value, gas)
 	contract.SetCallCode(&addr, evm.StateDB.GetCodeHash(addr), evm.StateDB.GetCode(addr))
 
+	// Capture the tracer start/end events in debug mode
+	if evm.vmConfig.Debug && evm.depth == 0 {
+		evm.vmConfig.Tracer.CaptureStart(caller.Address(), addr, false, input, gas, value)
+		start := time.Now()
+		defer func() {
+			evm.vmConfig.Tracer.CaptureEnd(ret, gas-contract.Gas, time.Since(start), err)
+		}()
+	}
+	if tracer := evm.frameTracer(); tracer != nil {
+		tracer.CaptureEnter(CALL, caller.Address(), addr, input, gas, value)
+		defer func() { tracer.CaptureExit(ret, gas-contract.Gas, err) }()
+	}
+
 	ret, err = run(evm, contract, input, false)
 
 	// When an error was returned by the EVM or when setting the creation code
@@ -211,7 +245,8 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 	// when we're in homestead this also counts for code storage gas errors.
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
-		if err != errExecutionReverted {
+		evm.transfers.revert(transferMark)
+		if err != ErrExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
 	}
@@ -240,8 +275,9 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 	}
 
 	var (
-		snapshot = evm.StateDB.Snapshot()
-		to       = AccountRef(caller.Address())
+		snapshot     = evm.StateDB.Snapshot()
+		transferMark = evm.transfers.mark()
+		to           = AccountRef(caller.Address())
 	)
 	// initialise a new contract and set the code that is to be used by the
 	// EVM. The contract is a scoped environment for this execution context
@@ -249,10 +285,16 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 	contract := NewContract(caller, to, value, gas)
 	contract.SetCallCode(&addr, evm.StateDB.GetCodeHash(addr), evm.StateDB.GetCode(addr))
 
+	if tracer := evm.frameTracer(); tracer != nil {
+		tracer.CaptureEnter(CALLCODE, caller.Address(), addr, input, gas, value)
+		defer func() { tracer.CaptureExit(ret, gas-contract.Gas, err) }()
+	}
+
 	ret, err = run(evm, contract, input, false)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
-		if err != errExecutionReverted {
+		evm.transfers.revert(transferMark)
+		if err != ErrExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
 	}
@@ -274,18 +316,25 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 	}
 
 	var (
-		snapshot = evm.StateDB.Snapshot()
-		to       = AccountRef(caller.Address())
+		snapshot     = evm.StateDB.Snapshot()
+		transferMark = evm.transfers.mark()
+		to           = AccountRef(caller.Address())
 	)
 
 	// Initialise a new contract and make initialise the delegate values
 	contract := NewContract(caller, to, nil, gas).AsDelegate()
 	contract.SetCallCode(&addr, evm.StateDB.GetCodeHash(addr), evm.StateDB.GetCode(addr))
 
+	if tracer := evm.frameTracer(); tracer != nil {
+		tracer.CaptureEnter(DELEGATECALL, caller.Address(), addr, input, gas, nil)
+		defer func() { tracer.CaptureExit(ret, gas-contract.Gas, err) }()
+	}
+
 	ret, err = run(evm, contract, input, false)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
-		if err != errExecutionReverted {
+		evm.transfers.revert(transferMark)
+		if err != ErrExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
 	}
@@ -306,8 +355,9 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 	}
 
 	var (
-		to       = AccountRef(addr)
-		snapshot = evm.StateDB.Snapshot()
+		to           = AccountRef(addr)
+		snapshot     = evm.StateDB.Snapshot()
+		transferMark = evm.transfers.mark()
 	)
 	// Initialise a new contract and set the code that is to be used by the
 	// EVM. The contract is a scoped environment for this execution context
@@ -315,13 +365,19 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 	contract := NewContract(caller, to, new(big.Int), gas)
 	contract.SetCallCode(&addr, evm.StateDB.GetCodeHash(addr), evm.StateDB.GetCode(addr))
 
+	if tracer := evm.frameTracer(); tracer != nil {
+		tracer.CaptureEnter(STATICCALL, caller.Address(), addr, input, gas, nil)
+		defer func() { tracer.CaptureExit(ret, gas-contract.Gas, err) }()
+	}
+
 	// When an error was returned by the EVM or when setting the creation code
 	// above we revert to the snapshot and consume any gas remaining. Additionally
 	// when we're in Homestead this also counts for code storage gas errors.
 	ret, err = run(evm, contract, input, true)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
-		if err != errExecutionReverted {
+		evm.transfers.revert(transferMark)
+		if err != ErrExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
 	}
@@ -340,8 +396,9 @@ func (c *codeAndHash) Hash() common.Hash {
 	return c.hash
 }
 
-// create creates a new contract using code as deployment code.
-func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64, value *big.Int, address common.Address) ([]byte, common.Address, uint64, error) {
+// create creates a new contract using code as deployment code. The op code, i.e. CREATE or CREATE2, is
+// reported to the tracer.
+func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64, value *big.Int, address common.Address, typ OpCode) ([]byte, common.Address, uint64, error) {
 	// Depth check execution. Fail if we're trying to execute above the
 	// limit.
 	if evm.depth > int(params.CallCreateDepth) {
@@ -360,8 +417,12 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	}
 	// Create a new account on the state
 	snapshot := evm.StateDB.Snapshot()
+	transferMark := evm.transfers.mark()
 	evm.StateDB.CreateAccount(address)
 	Transfer(evm.StateDB, caller.Address(), address, value)
+	if evm.depth > 0 {
+		evm.transfers.record(typ, caller.Address(), address, value, evm.depth)
+	}
 
 	// initialise a new contract and set the code that is to be used by the
 	// EVM. The contract is a scoped environment for this execution context
@@ -376,6 +437,10 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	if evm.vmConfig.Debug && evm.depth == 0 {
 		evm.vmConfig.Tracer.CaptureStart(caller.Address(), address, true, codeAndHash.code, gas, value)
 	}
+	tracer := evm.frameTracer()
+	if tracer != nil {
+		tracer.CaptureEnter(typ, caller.Address(), address, codeAndHash.code, gas, value)
+	}
 	start := time.Now()
 
 	ret, err := run(evm, contract, nil, false)
@@ -400,25 +465,29 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	// when we're in homestead this also counts for code storage gas errors.
 	if maxCodeSizeExceeded || err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
-		if err != errExecutionReverted {
+		evm.transfers.revert(transferMark)
+		if err != ErrExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
 	}
 	// Assign err if contract code size exceeds the max while the err is still empty.
 	if maxCodeSizeExceeded && err == nil {
-		err = errMaxCodeSizeExceeded
+		err = ErrMaxCodeSizeExceeded
 	}
 	if evm.vmConfig.Debug && evm.depth == 0 {
 		evm.vmConfig.Tracer.CaptureEnd(ret, gas-contract.Gas, time.Since(start), err)
 	}
+	if tracer != nil {
+		tracer.CaptureExit(ret, gas-contract.Gas, err)
+	}
 	return ret, address, contract.Gas, err
 
 }
 
 // Create creates a new contract using code as deployment code.
 func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.Int) (ret []byte, contractAddr common.Address, leftOverGas uint64, err error) {
-	contractAddr = crypto.CreateAddress(caller.Address(), evm.StateDB.GetNonce(caller.Address()))
-	return evm.create(caller, &codeAndHash{code: code}, gas, value, contractAddr)
+	contractAddr = types.CreateContractAddress(caller.Address(), evm.StateDB.GetNonce(caller.Address()))
+	return evm.create(caller, &codeAndHash{code: code}, gas, value, contractAddr, CREATE)
 }
 
 // Create2 creates a new contract using code as deployment code.
@@ -427,8 +496,17 @@ func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.I
 // instead of the usual sender-and-nonce-hash as the address where the contract is initialized at.
 func (evm *EVM) Create2(caller ContractRef, code []byte, gas uint64, endowment *big.Int, salt *big.Int) (ret []byte, contractAddr common.Address, leftOverGas uint64, err error) {
 	codeAndHash := &codeAndHash{code: code}
-	contractAddr = crypto.CreateAddress2(caller.Address(), common.BigToHash(salt), codeAndHash.Hash().Bytes())
-	return evm.create(caller, codeAndHash, gas, endowment, contractAddr)
+	contractAddr = types.CreateContractAddress2WithHash(caller.Address(), common.BigToHash(salt), codeAndHash.Hash())
+	return evm.create(caller, codeAndHash, gas, endowment, contractAddr, CREATE2)
+}
+
+// frameTracer returns the tracer to report the nested call frames to, or nil if there is none
+func (evm *EVM) frameTracer() FrameTracer {
+	if !evm.vmConfig.Debug || evm.depth == 0 {
+		return nil
+	}
+	tracer, _ := evm.vmConfig.Tracer.(FrameTracer)
+	return tracer
 }
 
 // ChainConfig returns the environment's chain configuration
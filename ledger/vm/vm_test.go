@@ -110,6 +110,52 @@ func TestVMCreate(t *testing.T) {
 	assert.Equal(common.BigToHash(big.NewInt(0x3)), actual)
 }
 
+func TestVMRevertedCallLogs(t *testing.T) {
+	assert := assert.New(t)
+
+	callerAddr := common.HexToAddress("1133")
+	calleeAddr := common.HexToAddress("2266")
+	store := state.NewStoreView(0, common.Hash{}, backend.NewMemDatabase())
+	account := store.GetOrCreateAccount(callerAddr)
+	account.Balance = types.NewCoins(1000, 2000)
+	store.SetAccount(callerAddr, account)
+
+	// ASM:
+	// push 0x0
+	// push 0x0
+	// log0
+	// push 0x0
+	// push 0x0
+	// revert
+	store.CreateAccount(calleeAddr)
+	store.SetCode(calleeAddr, common.Hex2Bytes("60006000a060006000fd"))
+
+	// ASM:
+	// push 0x0
+	// push 0x0
+	// log0
+	// push 0x0 (x5, the output, the input and the value)
+	// push20 calleeAddr
+	// gas
+	// call
+	// pop
+	// stop
+	contractAddr := common.HexToAddress("3399")
+	store.CreateAccount(contractAddr)
+	store.SetCode(contractAddr, common.Hex2Bytes("60006000a0"+"60006000600060006000"+
+		"73"+hex.EncodeToString(calleeAddr.Bytes())+"5af15000"))
+
+	evm := NewEVM(Context{}, store, nil, Config{})
+	_, _, err := evm.Call(AccountRef(callerAddr), contractAddr, nil, 1000000, big.NewInt(0))
+	assert.Nil(err)
+
+	// The log of the reverted call is dropped, the one of the caller is kept
+	logs := store.PopLogs()
+	if assert.Equal(1, len(logs)) {
+		assert.Equal(contractAddr, logs[0].Address)
+	}
+}
+
 func TestContractDeployment(t *testing.T) {
 	assert := assert.New(t)
 
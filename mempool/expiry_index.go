@@ -0,0 +1,83 @@
+package mempool
+
+import (
+	"math/big"
+
+	"github.com/thetatoken/theta/common/pqueue"
+)
+
+//
+// txExpiryEntry implements the pqueue.Element interface. It references a mempool transaction
+// with a non-zero expiration height.
+//
+type txExpiryEntry struct {
+	mptx  *mempoolTransaction
+	index int
+}
+
+var _ pqueue.Element = (*txExpiryEntry)(nil)
+
+// Priority returns the negated expiration height, so the earliest expiring entry is popped first
+func (entry *txExpiryEntry) Priority() *big.Int {
+	expirationHeight := new(big.Int).SetUint64(entry.mptx.txInfo.ExpirationHeight)
+	return expirationHeight.Neg(expirationHeight)
+}
+
+func (entry *txExpiryEntry) SetIndex(index int) {
+	entry.index = index
+}
+
+func (entry *txExpiryEntry) GetIndex() int {
+	return entry.index
+}
+
+//
+// txExpiryIndex orders the mempool transactions by their expiration heights, so the expired
+// transactions can be swept without scanning the whole candidate pool. Entries are removed
+// lazily, i.e. an entry whose transaction has already left the pool (reaped or committed)
+// is simply discarded when it reaches the front of the index.
+//
+type txExpiryIndex struct {
+	entries *pqueue.PriorityQueue
+
+	numVisited uint64 // number of entries examined by the sweeps, for instrumentation
+}
+
+func createTxExpiryIndex() *txExpiryIndex {
+	return &txExpiryIndex{
+		entries: pqueue.CreatePriorityQueue(),
+	}
+}
+
+// add indexes the given transaction. Transactions that never expire are not indexed.
+func (ei *txExpiryIndex) add(mptx *mempoolTransaction) {
+	if mptx.txInfo.ExpirationHeight == 0 {
+		return
+	}
+	ei.entries.Push(&txExpiryEntry{mptx: mptx})
+}
+
+// popExpired removes and returns all the indexed transactions that are ineligible for a block
+// at the given height, i.e. transactions with expiration height <= height.
+// RUNTIME COMPLEXITY: k*log(n), where k is the number of expired entries, and n is the size of the index.
+func (ei *txExpiryIndex) popExpired(height uint64) []*mempoolTransaction {
+	expired := []*mempoolTransaction{}
+	for !ei.entries.IsEmpty() {
+		entry := ei.entries.Peek().(*txExpiryEntry)
+		if entry.mptx.txInfo.ExpirationHeight > height {
+			break
+		}
+		ei.entries.Pop()
+		ei.numVisited++
+		expired = append(expired, entry.mptx)
+	}
+	return expired
+}
+
+func (ei *txExpiryIndex) size() int {
+	return ei.entries.NumElements()
+}
+
+func (ei *txExpiryIndex) reset() {
+	ei.entries = pqueue.CreatePriorityQueue()
+}
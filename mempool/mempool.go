@@ -3,18 +3,21 @@ package mempool
 import (
 	"context"
 	"encoding/hex"
-	"errors"
 	"math/big"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/common/clist"
 	"github.com/thetatoken/theta/common/math"
 	"github.com/thetatoken/theta/common/pqueue"
+	"github.com/thetatoken/theta/common/result"
 	"github.com/thetatoken/theta/core"
 	dp "github.com/thetatoken/theta/dispatcher"
+	"github.com/thetatoken/theta/ledger/types"
 )
 
 var logger *log.Entry = log.WithFields(log.Fields{"prefix": "mempool"})
@@ -27,6 +30,23 @@ func (m MempoolError) Error() string {
 
 const DuplicateTxError = MempoolError("Transaction already seen")
 
+// TxRejectedError is returned when the transaction fails the screening. The result code
+// identifies the reason, while the message is only informative.
+type TxRejectedError struct {
+	Result result.Result
+}
+
+func (e *TxRejectedError) Error() string {
+	return e.Result.Message
+}
+
+// Code returns the code of the screening result
+func (e *TxRejectedError) Code() result.ErrorCode {
+	return e.Result.Code
+}
+
+const relaySuspendedCheckInterval = 1 * time.Second
+
 //
 // mempoolTransaction implements the pqueue.Element interface
 //
@@ -85,9 +105,10 @@ func (mtg *mempoolTransactionGroup) GetIndex() int {
 	return mtg.index
 }
 
-func (mtg *mempoolTransactionGroup) AddTx(rawTx common.Bytes, txInfo *core.TxInfo) {
+func (mtg *mempoolTransactionGroup) AddTx(rawTx common.Bytes, txInfo *core.TxInfo) *mempoolTransaction {
 	mpx := createMempoolTransaction(rawTx, txInfo)
 	mtg.txs.Push(mpx)
+	return mpx
 }
 
 func (mtg *mempoolTransactionGroup) PopTx() (common.Bytes, *core.TxInfo) {
@@ -99,6 +120,15 @@ func (mtg *mempoolTransactionGroup) IsEmpty() bool {
 	return mtg.txs.IsEmpty()
 }
 
+// containsTx checks whether the given transaction is still held by the group. A transaction
+// popped or removed from the group has its index set to -1 by the priority queue.
+func (mtg *mempoolTransactionGroup) containsTx(mptx *mempoolTransaction) bool {
+	if mptx.index < 0 || mptx.index >= mtg.txs.NumElements() {
+		return false
+	}
+	return (*mtg.txs.ElementList())[mptx.index] == mptx
+}
+
 // RemoveTxs removes matching Txs from transaction group. Returns number of Txs removed.
 func (mtg *mempoolTransactionGroup) RemoveTxs(committedRawTxMap map[string]bool) (numRemoved int) {
 	elementList := mtg.txs.ElementList()
@@ -118,12 +148,11 @@ func (mtg *mempoolTransactionGroup) RemoveTxs(committedRawTxMap map[string]bool)
 	return
 }
 
-func createMempoolTransactionGroup(rawTx common.Bytes, txInfo *core.TxInfo) *mempoolTransactionGroup {
+func createMempoolTransactionGroup(address common.Address) *mempoolTransactionGroup {
 	txGroup := &mempoolTransactionGroup{
-		address: txInfo.Address,
+		address: address,
 		txs:     pqueue.CreatePriorityQueue(),
 	}
-	txGroup.AddTx(rawTx, txInfo)
 	return txGroup
 }
 
@@ -136,11 +165,16 @@ type Mempool struct {
 
 	ledger     core.Ledger
 	dispatcher *dp.Dispatcher
+	safeMode   *core.SafeMode // transactions are queued but not relayed in safe mode
+
+	latencyTracker *core.TxLatencyTracker // records the admission time of the transactions
 
 	newTxs           *clist.CList          // new transactions, to be gossiped to other nodes
 	candidateTxs     *pqueue.PriorityQueue // candidate transactions for new block assembly, ordered by the transaction fee (high to low)
 	txBookeepper     transactionBookkeeper
 	addressToTxGroup map[common.Address]*mempoolTransactionGroup
+	expiryIndex      *txExpiryIndex   // candidate transactions with expiration heights, ordered by the expiration height (low to high)
+	expirySweepTicks <-chan time.Time // drives the timer sweep of the expired transactions, for testing only
 	size             int
 
 	// Life cycle
@@ -159,6 +193,7 @@ func CreateMempool(dispatcher *dp.Dispatcher) *Mempool {
 		newTxs:           clist.New(),
 		candidateTxs:     pqueue.CreatePriorityQueue(),
 		addressToTxGroup: make(map[common.Address]*mempoolTransactionGroup),
+		expiryIndex:      createTxExpiryIndex(),
 		txBookeepper:     createTransactionBookkeeper(defaultMaxNumTxs),
 		wg:               &sync.WaitGroup{},
 	}
@@ -169,8 +204,30 @@ func (mp *Mempool) SetLedger(ledger core.Ledger) {
 	mp.ledger = ledger
 }
 
+// SetSafeMode sets the safe mode controller for the mempool
+func (mp *Mempool) SetSafeMode(safeMode *core.SafeMode) {
+	mp.safeMode = safeMode
+}
+
+// SetTxLatencyTracker sets the tracker measuring the inclusion and finality latencies of the transactions
+func (mp *Mempool) SetTxLatencyTracker(latencyTracker *core.TxLatencyTracker) {
+	mp.latencyTracker = latencyTracker
+}
+
+// IsRelaySuspended indicates whether the transaction relay is suspended, i.e. the newly
+// inserted transactions are queued but not broadcasted to the peers
+func (mp *Mempool) IsRelaySuspended() bool {
+	return mp.safeMode.Enabled()
+}
+
 // InsertTransaction inserts the incoming transaction to mempool (submitted by the clients or relayed from peers)
 func (mp *Mempool) InsertTransaction(rawTx common.Bytes) error {
+	// Rejected before it is hashed or decoded
+	if maxTxSize := mp.ledger.MaxTxSize(); uint64(len(rawTx)) > maxTxSize {
+		return &TxRejectedError{Result: result.Error("Transaction too large: %v bytes, at most %v bytes are allowed",
+			len(rawTx), maxTxSize).WithErrorCode(result.CodeTxTooLarge)}
+	}
+
 	mp.mutex.Lock()
 	defer mp.mutex.Unlock()
 
@@ -183,7 +240,7 @@ func (mp *Mempool) InsertTransaction(rawTx common.Bytes) error {
 	txInfo, checkTxRes := mp.ledger.ScreenTx(rawTx)
 	if !checkTxRes.IsOK() {
 		logger.Debugf("Transaction screening failed, tx: %v, error: %v", hex.EncodeToString(rawTx), checkTxRes.Message)
-		return errors.New(checkTxRes.Message)
+		return &TxRejectedError{Result: checkTxRes}
 	}
 
 	logger.Infof("Insert tx, tx.hash: 0x%v", getTransactionHash(rawTx))
@@ -196,15 +253,18 @@ func (mp *Mempool) InsertTransaction(rawTx common.Bytes) error {
 	// should not be rejected even though it has been submitted earlier.
 	mp.txBookeepper.record(rawTx)
 
+	mp.latencyTracker.RecordAdmission(types.RawTxHash(rawTx), txInfo.EffectiveGasPrice)
+
 	txGroup, ok := mp.addressToTxGroup[txInfo.Address]
 	if ok {
-		txGroup.AddTx(rawTx, txInfo)
 		mp.candidateTxs.Remove(txGroup.index) // Need to re-insert txGroup into queue since its priority could change.
 	} else {
-		txGroup = createMempoolTransactionGroup(rawTx, txInfo)
+		txGroup = createMempoolTransactionGroup(txInfo.Address)
 		mp.addressToTxGroup[txInfo.Address] = txGroup
 	}
+	mptx := txGroup.AddTx(rawTx, txInfo)
 	mp.candidateTxs.Push(txGroup)
+	mp.expiryIndex.add(mptx)
 
 	mp.newTxs.PushBack(rawTx)
 	mp.size++
@@ -220,12 +280,21 @@ func (mp *Mempool) Start(ctx context.Context) error {
 	mp.wg.Add(1)
 	go mp.broadcastTransactionsRoutine()
 
+	if !viper.GetBool(common.CfgMempoolHeightDrivenExpirySweep) {
+		mp.wg.Add(1)
+		go mp.expirySweepRoutine()
+	}
+
 	return nil
 }
 
 // Stop needs to be called when the Mempool stops
 func (mp *Mempool) Stop() {
 	mp.cancel()
+
+	// Wake up the broadcast routine in case it waits for new transactions, it
+	// then exits without broadcasting the placeholder
+	mp.newTxs.PushBack(common.Bytes{})
 }
 
 // Wait suspends the caller goroutine
@@ -296,6 +365,17 @@ func (mp *Mempool) ReapUnsafe(maxNumTxs int) []common.Bytes {
 	return txs
 }
 
+// PeekUnsafe returns the transaction the next ReapUnsafe(1) call would return without removing it
+// from the candidate pool, or nil if the pool is empty. Caller must call Mempool.Lock() before
+// calling this method.
+func (mp *Mempool) PeekUnsafe() common.Bytes {
+	if mp.candidateTxs.IsEmpty() {
+		return nil
+	}
+	txGroup := mp.candidateTxs.Peek().(*mempoolTransactionGroup)
+	return txGroup.txs.Peek().(*mempoolTransaction).rawTransaction
+}
+
 // Update removes the committed transactions from the transaction candidate list
 // RUNTIME COMPLEXITY: O(k + n), where k is the number committed raw transactions,
 // and n is the number of transactions in the candidate pool.
@@ -329,6 +409,49 @@ func (mp *Mempool) UpdateUnsafe(committedRawTxs []common.Bytes) {
 	mp.removeTxs(invalidTxs)
 }
 
+// SweepExpired removes the transactions that are ineligible for a block at the given height,
+// i.e. transactions whose expiration height is less than or equal to the height. It is driven
+// either by a timer, or by the ledger at the block proposal and application time if
+// common.CfgMempoolHeightDrivenExpirySweep is set. Returns the number of transactions removed.
+// RUNTIME COMPLEXITY: k*log(n), where k is the number of expired entries in the expiry index,
+// and n is the number of transactions in the candidate pool.
+func (mp *Mempool) SweepExpired(height uint64) int {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	return mp.SweepExpiredUnsafe(height)
+}
+
+// SweepExpiredUnsafe is the non-locking version of SweepExpired. Caller must call Mempool.Lock() before
+// calling this method.
+func (mp *Mempool) SweepExpiredUnsafe(height uint64) int {
+	numRemoved := 0
+	for _, mptx := range mp.expiryIndex.popExpired(height) {
+		txGroup, ok := mp.addressToTxGroup[mptx.txInfo.Address]
+		if !ok || !txGroup.containsTx(mptx) {
+			continue // already reaped or removed from the candidate pool
+		}
+
+		txGroup.txs.Remove(mptx.index)
+		mp.candidateTxs.Remove(txGroup.index) // Need to re-insert txGroup into queue since its priority could change.
+		if txGroup.IsEmpty() {
+			delete(mp.addressToTxGroup, txGroup.address)
+		} else {
+			mp.candidateTxs.Push(txGroup)
+		}
+		mp.txBookeepper.markAbandoned(mptx.rawTransaction)
+		mp.size--
+		numRemoved++
+
+		logger.Debugf("Expired tx: %v, txInfo: %v, height: %v",
+			hex.EncodeToString(mptx.rawTransaction), mptx.txInfo, height)
+	}
+
+	if numRemoved > 0 {
+		logger.Infof("Removed %d expired Txs at height %v", numRemoved, height)
+	}
+	return numRemoved
+}
+
 func (mp *Mempool) removeTxs(committedRawTxs []common.Bytes) {
 	committedRawTxMap := make(map[string]bool)
 	for _, rawtx := range committedRawTxs {
@@ -389,9 +512,43 @@ func (mp *Mempool) Flush() {
 	for !mp.candidateTxs.IsEmpty() {
 		mp.candidateTxs.Pop()
 	}
+	mp.expiryIndex.reset()
 	mp.size = 0
 }
 
+// nextBlockHeightProvider is implemented by the ledgers providing the height of the next block, which the
+// timer sweep removes the ineligible transactions for
+type nextBlockHeightProvider interface {
+	NextBlockHeight() uint64
+}
+
+// expirySweepRoutine periodically sweeps the expired transactions, unless the ledger sweeps them at each
+// block proposal and application, see common.CfgMempoolHeightDrivenExpirySweep
+func (mp *Mempool) expirySweepRoutine() {
+	defer mp.wg.Done()
+
+	provider, ok := mp.ledger.(nextBlockHeightProvider)
+	if !ok {
+		return
+	}
+
+	ticks := mp.expirySweepTicks
+	if ticks == nil {
+		ticker := time.NewTicker(time.Duration(viper.GetInt(common.CfgMempoolExpirySweepInterval)) * time.Second)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		select {
+		case <-mp.ctx.Done():
+			return
+		case <-ticks:
+			mp.SweepExpired(provider.NextBlockHeight())
+		}
+	}
+}
+
 // broadcastTransactionRoutine broadcasts transactions to neighoring peers
 func (mp *Mempool) broadcastTransactionsRoutine() {
 	defer mp.wg.Done()
@@ -405,8 +562,17 @@ func (mp *Mempool) broadcastTransactionsRoutine() {
 		default:
 		}
 
+		if mp.IsRelaySuspended() {
+			select {
+			case <-mp.ctx.Done():
+			case <-time.After(relaySuspendedCheckInterval):
+			}
+			continue
+		}
+
 		if next == nil {
 			next = mp.newTxs.FrontWait() // Wait until a tx is available
+			continue                     // re-check the relay suspension after waiting
 		}
 
 		rawTx := next.Value.(common.Bytes)
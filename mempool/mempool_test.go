@@ -14,6 +14,7 @@ import (
 	"github.com/thetatoken/theta/common/result"
 	"github.com/thetatoken/theta/core"
 	dp "github.com/thetatoken/theta/dispatcher"
+	"github.com/thetatoken/theta/ledger/types"
 	p2psim "github.com/thetatoken/theta/p2p/simulation"
 	p2ptypes "github.com/thetatoken/theta/p2p/types"
 	"github.com/thetatoken/theta/rlp"
@@ -351,6 +352,161 @@ func TestMempoolBigBatchUpdateAndReaping(t *testing.T) {
 	assert.Equal(numInitCandidateTxs-2*core.MaxNumRegularTxsPerBlock, numFinalCandidateTxs)
 }
 
+func TestMempoolRejectedTxCode(t *testing.T) {
+	assert := assert.New(t)
+
+	p2psimnet := p2psim.NewSimnetWithHandler(nil)
+	mempool, _ := newTestMempool("peer0", p2psimnet)
+	screened := result.Error("Insufficient fund").WithErrorCode(result.CodeInsufficientFund)
+	mempool.ledger.(*TestLedger).rejections = map[string]result.Result{"tx2": screened}
+
+	assert.Nil(mempool.InsertTransaction(createTestRawTx("tx1")))
+
+	// The screening result is propagated as is
+	err := mempool.InsertTransaction(createTestRawTx("tx2"))
+	rejected, ok := err.(*TxRejectedError)
+	if assert.True(ok, "%v", err) {
+		assert.Equal(result.CodeInsufficientFund, rejected.Code())
+		assert.Equal(screened, rejected.Result)
+	}
+	assert.Equal(1, mempool.Size())
+
+	// The rejected txs are not recorded, so they can be resubmitted
+	mempool.ledger.(*TestLedger).rejections = nil
+	assert.Nil(mempool.InsertTransaction(createTestRawTx("tx2")))
+	assert.Equal(DuplicateTxError, mempool.InsertTransaction(createTestRawTx("tx2")))
+}
+
+func TestMempoolTxSizeLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	p2psimnet := p2psim.NewSimnetWithHandler(nil)
+	mempool, _ := newTestMempool("peer0", p2psimnet)
+	rawTx := createTestRawTx("tx1")
+	mempool.ledger.(*TestLedger).maxTxSize = uint64(len(rawTx)) - 1
+
+	// One byte over the limit, rejected before the screening
+	err := mempool.InsertTransaction(rawTx)
+	rejected, ok := err.(*TxRejectedError)
+	if assert.True(ok, "%v", err) {
+		assert.Equal(result.CodeTxTooLarge, rejected.Code())
+	}
+	assert.Equal(0, mempool.Size())
+	assert.Equal(0, mempool.ledger.(*TestLedger).counter)
+
+	// Exactly at the limit
+	mempool.ledger.(*TestLedger).maxTxSize = uint64(len(rawTx))
+	assert.Nil(mempool.InsertTransaction(rawTx))
+	assert.Equal(1, mempool.Size())
+}
+
+func TestMempoolSweepExpired(t *testing.T) {
+	assert := assert.New(t)
+
+	p2psimnet := p2psim.NewSimnetWithHandler(nil)
+	mempool, _ := newTestMempool("peer0", p2psimnet)
+	mempool.ledger.(*TestLedger).expirationHeightList = testExpirationHeightList
+
+	for i := 1; i <= 10; i++ {
+		assert.Nil(mempool.InsertTransaction(createTestRawTx("tx" + strconv.Itoa(i))))
+	}
+	assert.Equal(10, mempool.Size())
+	assert.Equal(3, mempool.expiryIndex.size()) // txs that never expire are not indexed
+
+	// Nothing expires below height 5
+	assert.Equal(0, mempool.SweepExpired(4))
+	assert.Equal(uint64(0), mempool.expiryIndex.numVisited)
+	assert.Equal(10, mempool.Size())
+
+	// tx1 expires at height 5, and is thus ineligible for a block at height 5
+	assert.Equal(1, mempool.SweepExpired(5))
+	assert.Equal(uint64(1), mempool.expiryIndex.numVisited)
+	assert.Equal(9, mempool.Size())
+
+	// tx2 expires at height 6, tx5 is still eligible
+	assert.Equal(1, mempool.SweepExpired(6))
+	assert.Equal(uint64(2), mempool.expiryIndex.numVisited)
+	assert.Equal(8, mempool.Size())
+
+	status, ok := mempool.GetTransactionStatus(getTransactionHash(createTestRawTx("tx1")))
+	assert.True(ok)
+	assert.Equal(TxStatusAbandoned, status)
+
+	reapedRawTxs := mempool.Reap(-1)
+	assert.Equal(8, len(reapedRawTxs))
+	for _, rawTx := range reapedRawTxs {
+		assert.NotEqual("tx1", string(rawTx))
+		assert.NotEqual("tx2", string(rawTx))
+	}
+	assert.Contains(reapedRawTxs, createTestRawTx("tx5"))
+
+	// tx5 has already been reaped, the sweep only discards its stale index entry
+	assert.Equal(0, mempool.SweepExpired(100))
+	assert.Equal(uint64(3), mempool.expiryIndex.numVisited)
+	assert.Equal(0, mempool.expiryIndex.size())
+	assert.Equal(0, mempool.Size())
+}
+
+func TestMempoolTimerSweepExpired(t *testing.T) {
+	assert := assert.New(t)
+
+	p2psimnet := p2psim.NewSimnetWithHandler(nil)
+	mempool, ctx := newTestMempool("peer0", p2psimnet)
+	tl := mempool.ledger.(*TestLedger)
+	tl.expirationHeightList = testExpirationHeightList
+	tl.nextBlockHeight = 6
+
+	for i := 1; i <= 10; i++ {
+		assert.Nil(mempool.InsertTransaction(createTestRawTx("tx" + strconv.Itoa(i))))
+	}
+
+	// Without the height-driven sweep, the expired txs are swept on the timer
+	ticks := make(chan time.Time)
+	mempool.expirySweepTicks = ticks
+	mempool.Start(ctx)
+	ticks <- time.Now()
+	ticks <- time.Now() // only received once the first sweep is done
+	mempool.Stop()
+	mempool.Wait()
+
+	// tx1 and tx2 are ineligible for a block at height 6
+	assert.Equal(8, mempool.Size())
+	status, ok := mempool.GetTransactionStatus(getTransactionHash(createTestRawTx("tx2")))
+	assert.True(ok)
+	assert.Equal(TxStatusAbandoned, status)
+}
+
+func TestMempoolSweepExpiredCost(t *testing.T) {
+	assert := assert.New(t)
+
+	p2psimnet := p2psim.NewSimnetWithHandler(nil)
+	mempool, _ := newTestMempool("peer0", p2psimnet)
+	tl := mempool.ledger.(*TestLedger)
+	tl.expirationHeightList = make([]uint64, len(tl.effectiveGasPriceList))
+
+	// Only one out of every ten txs expires, and they expire at different heights
+	numTxs := 10 * core.MaxNumRegularTxsPerBlock
+	for i := 0; i < numTxs; i++ {
+		idx := i % len(tl.expirationHeightList)
+		if idx == 0 {
+			tl.expirationHeightList[idx] = uint64(i/len(tl.expirationHeightList) + 1)
+		} else {
+			tl.expirationHeightList[idx] = 0
+		}
+		assert.Nil(mempool.InsertTransaction(createTestRawTx("tx_" + strconv.Itoa(i))))
+	}
+	assert.Equal(numTxs, mempool.Size())
+
+	// The sweep cost is proportional to the number of expired txs rather than the pool size
+	numExpired := 5
+	assert.Equal(numExpired, mempool.SweepExpired(uint64(numExpired)))
+	assert.Equal(uint64(numExpired), mempool.expiryIndex.numVisited)
+	assert.Equal(numTxs-numExpired, mempool.Size())
+
+	assert.Equal(0, mempool.SweepExpired(uint64(numExpired)))
+	assert.Equal(uint64(numExpired), mempool.expiryIndex.numVisited)
+}
+
 func TestMempoolTransactionGossip(t *testing.T) {
 	assert := assert.New(t)
 
@@ -411,6 +567,23 @@ type TestLedger struct {
 	effectiveGasPriceList []uint64
 	addressList           []string
 	sequenceList          []uint64
+	expirationHeightList  []uint64                 // optional, txs never expire if not set
+	rejections            map[string]result.Result // optional, the screening results of the invalid txs
+	maxTxSize             uint64                   // optional, types.DefaultMaxTxSize if not set
+	nextBlockHeight       uint64                   // height the timer sweep removes the ineligible txs for
+}
+
+var testExpirationHeightList = []uint64{
+	5, // tx1
+	6, // tx2
+	0, // tx3
+	0, // tx4
+	7, // tx5
+	0, // tx6
+	0, // tx7
+	0, // tx8
+	0, // tx9
+	0, // tx10
 }
 
 func newTestLedger() core.Ledger {
@@ -461,15 +634,32 @@ func (tl *TestLedger) ScreenTxUnsafe(rawTx common.Bytes) result.Result {
 }
 
 func (tl *TestLedger) ScreenTx(rawTx common.Bytes) (*core.TxInfo, result.Result) {
+	if res, rejected := tl.rejections[string(rawTx)]; rejected {
+		return nil, res
+	}
 	txInfo := &core.TxInfo{
 		EffectiveGasPrice: new(big.Int).SetUint64(tl.effectiveGasPriceList[tl.counter]),
 		Address:           common.HexToAddress(tl.addressList[tl.counter]),
 		Sequence:          tl.sequenceList[tl.counter],
 	}
+	if tl.expirationHeightList != nil {
+		txInfo.ExpirationHeight = tl.expirationHeightList[tl.counter]
+	}
 	tl.counter = (tl.counter + 1) % len(tl.effectiveGasPriceList)
 	return txInfo, result.OK
 }
 
+func (tl *TestLedger) MaxTxSize() uint64 {
+	if tl.maxTxSize == 0 {
+		return types.DefaultMaxTxSize
+	}
+	return tl.maxTxSize
+}
+
+func (tl *TestLedger) NextBlockHeight() uint64 {
+	return tl.nextBlockHeight
+}
+
 func (tl *TestLedger) GetCurrentBlock() *core.Block {
 	return nil
 }
@@ -478,6 +668,18 @@ func (tl *TestLedger) ProposeBlockTxs(block *core.Block) (stateRootHash common.H
 	return common.Hash{}, []common.Bytes{}, result.OK
 }
 
+func (tl *TestLedger) ProposeBlockTxsWithDeadline(ctx context.Context, block *core.Block) (stateRootHash common.Hash, blockRawTxs []common.Bytes, res result.Result) {
+	return common.Hash{}, []common.Bytes{}, result.OK
+}
+
+func (tl *TestLedger) ProposeEmptyBlockTxs(block *core.Block) (stateRootHash common.Hash, blockRawTxs []common.Bytes, res result.Result) {
+	return common.Hash{}, []common.Bytes{}, result.OK
+}
+
+func (tl *TestLedger) HasPendingTxs() bool {
+	return false
+}
+
 func (tl *TestLedger) ApplyBlockTxs(block *core.Block) result.Result {
 	return result.OK
 }
@@ -494,6 +696,10 @@ func (tl *TestLedger) GetFinalizedValidatorCandidatePool(blockHash common.Hash,
 	return nil, nil
 }
 
+func (tl *TestLedger) GetFinalizedMaxNumValidators(blockHash common.Hash, isNext bool) (int, error) {
+	return core.DefaultMaxNumValidators, nil
+}
+
 func (tl *TestLedger) PruneState(endHeight uint64) error {
 	return nil
 }
@@ -6,7 +6,7 @@ import (
 	"sync"
 
 	"github.com/thetatoken/theta/common"
-	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/ledger/types"
 )
 
 const defaultMaxNumTxs = uint(200000)
@@ -102,7 +102,7 @@ func (tb *transactionBookkeeper) remove(rawTx common.Bytes) {
 }
 
 func getTransactionHash(rawTx common.Bytes) string {
-	txhash := crypto.Keccak256Hash(rawTx)
+	txhash := types.RawTxHash(rawTx)
 	txhashStr := hex.EncodeToString(txhash[:])
 	return txhashStr
 }
@@ -8,11 +8,13 @@ import (
 	"github.com/spf13/viper"
 	"github.com/thetatoken/theta/blockchain"
 	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/metrics"
 	"github.com/thetatoken/theta/consensus"
 	"github.com/thetatoken/theta/core"
 	"github.com/thetatoken/theta/crypto"
 	dp "github.com/thetatoken/theta/dispatcher"
 	ld "github.com/thetatoken/theta/ledger"
+	exec "github.com/thetatoken/theta/ledger/execution"
 	mp "github.com/thetatoken/theta/mempool"
 	"github.com/thetatoken/theta/netsync"
 	"github.com/thetatoken/theta/p2p"
@@ -51,6 +53,8 @@ type Params struct {
 	SnapshotPath        string
 	ChainImportDirPath  string
 	ChainCorrectionPath string
+
+	RewardSchedule exec.RewardSchedule // optional, uses the DefaultRewardSchedule if not specified
 }
 
 func NewNode(params *Params) *Node {
@@ -62,11 +66,18 @@ func NewNode(params *Params) *Node {
 
 	syncMgr := netsync.NewSyncManager(chain, consensus, params.Network, dispatcher, consensus)
 	mempool := mp.CreateMempool(dispatcher)
-	ledger := ld.NewLedger(params.ChainID, params.DB, chain, consensus, validatorManager, mempool)
+	ledger := ld.NewLedgerWithRewardSchedule(params.ChainID, params.DB, chain, consensus, validatorManager, mempool, params.RewardSchedule)
 
 	validatorManager.SetConsensusEngine(consensus)
 	consensus.SetLedger(ledger)
 	mempool.SetLedger(ledger)
+	mempool.SetSafeMode(consensus.SafeMode())
+	latencyTracker := core.NewTxLatencyTracker(common.SystemClock)
+	mempool.SetTxLatencyTracker(latencyTracker)
+	ledger.SetTxLatencyTracker(latencyTracker)
+	if metrics.Enabled {
+		ledger.SetInstrumentation(ld.NewMetricsInstrumentation(metrics.DefaultRegistry))
+	}
 	txMsgHandler := mp.CreateMempoolMessageHandler(mempool)
 	params.Network.RegisterMessageHandler(txMsgHandler)
 
@@ -193,6 +193,13 @@ func (peer *Peer) Handshake(sourceNodeInfo *p2ptypes.NodeInfo) error {
 		return recvError
 	}
 
+	// The encrypted transport performs an ECDH key exchange, which requires secp256k1 node keys
+	if sourceNodeInfo.PrivKey.Scheme() != crypto.SchemeSecp256k1 || targetNodePubKey.Scheme() != crypto.SchemeSecp256k1 {
+		err := fmt.Errorf("encrypted transport requires secp256k1 node keys, remote: %v", targetNodePubKey.Address())
+		logger.Errorf("Error during handshake/key exchange: %v", err)
+		return err
+	}
+
 	remotePub, err := peer.connection.DoEncHandshake(
 		crypto.PrivKeyToECDSA(sourceNodeInfo.PrivKey), crypto.PubKeyToECDSA(targetNodePubKey))
 	if err != nil {
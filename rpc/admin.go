@@ -0,0 +1,66 @@
+package rpc
+
+import (
+	"errors"
+	"net"
+	"net/http"
+)
+
+// ThetaAdminRPCService provides the operator RPC methods under the "admin" namespace. Unlike the "theta"
+// namespace, it is only served to the local host, see localOnly().
+type ThetaAdminRPCService struct {
+	service *ThetaRPCService
+}
+
+// ------------------------------- SetSafeMode -----------------------------------
+
+type SetSafeModeArgs struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+type SetSafeModeResult struct {
+	SafeMode bool   `json:"safe_mode"`
+	Reason   string `json:"reason"`
+}
+
+// SetSafeMode lets the operator enter or exit the safe mode. While in safe mode, the queries are served
+// from the last finalized state only, the broadcasted transactions are queued but not relayed, and
+// block proposals are suspended. Exiting the safe mode re-runs the startup integrity checks, and fails
+// if the checks do not pass.
+func (a *ThetaAdminRPCService) SetSafeMode(args *SetSafeModeArgs, result *SetSafeModeResult) (err error) {
+	safeMode := a.service.consensus.SafeMode()
+	if args.Enabled {
+		if args.Reason == "" {
+			return errors.New("Reason must be specified to enter safe mode")
+		}
+		logger.Warnf("Entering safe mode, reason: %v", args.Reason)
+		safeMode.Enter(args.Reason)
+	} else {
+		logger.Infof("Exiting safe mode")
+		err = safeMode.Exit()
+	}
+
+	status := safeMode.Status()
+	result.SafeMode = status.Enabled
+	result.Reason = status.Reason
+	return err
+}
+
+// -------------------------- Utilities -------------------------- //
+
+func (t *ThetaRPCService) inSafeMode() bool {
+	return t.consensus.SafeMode().Enabled()
+}
+
+// localOnly rejects the requests not originating from the local host
+func localOnly(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			http.Error(w, "Admin RPC is only accessible from the local host", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -3,6 +3,7 @@ package rpc
 import (
 	"os"
 	"path"
+	"strconv"
 
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/snapshot"
@@ -35,6 +36,39 @@ func (t *ThetaRPCService) BackupSnapshot(args *BackupSnapshotArgs, result *Backu
 	return err
 }
 
+// ------------------------------- BackupStakeSnapshot -----------------------------------
+
+type BackupStakeSnapshotArgs struct {
+	Config string `json:"config"`
+	Height uint64 `json:"height"`
+}
+
+type BackupStakeSnapshotResult struct {
+	StakeSnapshotFile string            `json:"stake_snapshot_file"`
+	StateRoot         common.Hash       `json:"state_root"`
+	NumRecords        common.JSONUint64 `json:"num_records"`
+	Commitment        common.Hash       `json:"commitment"`
+}
+
+func (t *ThetaRPCService) BackupStakeSnapshot(args *BackupStakeSnapshotArgs, result *BackupStakeSnapshotResult) error {
+	backupDir := path.Join(args.Config, "backup", "stake")
+	if _, err := os.Stat(backupDir); os.IsNotExist(err) {
+		os.MkdirAll(backupDir, os.ModePerm)
+	}
+
+	filePath := path.Join(backupDir, "theta_stakes-"+strconv.FormatUint(args.Height, 10)+".csv")
+	header, err := t.ledger.ExportStakeSnapshot(args.Height, filePath)
+	if err != nil {
+		return err
+	}
+	result.StakeSnapshotFile = filePath
+	result.StateRoot = header.StateRoot
+	result.NumRecords = common.JSONUint64(header.NumRecords)
+	result.Commitment = header.Commitment
+
+	return nil
+}
+
 // ------------------------------- BackupChain -----------------------------------
 
 type BackupChainArgs struct {
@@ -0,0 +1,80 @@
+package rpc
+
+import (
+	"net/http"
+	"net/rpc"
+	"sync"
+
+	"github.com/gorilla/mux"
+
+	"github.com/thetatoken/theta/ledger"
+	"github.com/thetatoken/theta/rpc/lib/rpc-codec/jsonrpc2"
+)
+
+const chainIDPathVar = "chain_id"
+
+type chainHandler struct {
+	instance *ledger.ChainInstance
+	handler  http.Handler
+}
+
+//
+// ChainRouter dispatches the RPC requests to the chains of a LedgerSet, based on the chainID
+// in the request path, i.e. /rpc/{chain_id}. Each chain is served by its own ThetaRPCService.
+//
+type ChainRouter struct {
+	ledgerSet *ledger.LedgerSet
+
+	mu       *sync.Mutex
+	handlers map[string]*chainHandler
+}
+
+// NewChainRouter creates an instance of ChainRouter
+func NewChainRouter(ledgerSet *ledger.LedgerSet) *ChainRouter {
+	return &ChainRouter{
+		ledgerSet: ledgerSet,
+		mu:        &sync.Mutex{},
+		handlers:  make(map[string]*chainHandler),
+	}
+}
+
+// ServeHTTP implements the http.Handler interface
+func (r *ChainRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	chainID := mux.Vars(req)[chainIDPathVar]
+	instance, err := r.ledgerSet.GetChain(chainID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	r.getHandler(instance).ServeHTTP(w, req)
+}
+
+// getHandler returns the handler of the given chain. The handler is re-created if the chain
+// has been removed and added back since the last request.
+func (r *ChainRouter) getHandler(instance *ledger.ChainInstance) http.Handler {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ch, ok := r.handlers[instance.ChainID]
+	if ok && ch.instance == instance {
+		return ch.handler
+	}
+
+	service := &ThetaRPCService{
+		mempool:    instance.Mempool,
+		ledger:     instance.Ledger,
+		dispatcher: instance.Dispatcher,
+		chain:      instance.Chain,
+		consensus:  instance.Consensus,
+		wg:         &sync.WaitGroup{},
+	}
+	s := rpc.NewServer()
+	s.RegisterName("theta", service)
+
+	ch = &chainHandler{
+		instance: instance,
+		handler:  jsonrpc2.HTTPHandler(s),
+	}
+	r.handlers[instance.ChainID] = ch
+	return ch.handler
+}
@@ -0,0 +1,107 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	ld "github.com/thetatoken/theta/ledger"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	p2psim "github.com/thetatoken/theta/p2p/simulation"
+	"github.com/thetatoken/theta/store/database/backend"
+)
+
+func addRouterTestChain(t *testing.T, ls *ld.LedgerSet, chainID string, address common.Address, thetaWei int64) {
+	require := require.New(t)
+
+	db, err := ls.NamespaceDB(chainID)
+	require.Nil(err)
+	view := state.NewStoreView(1, common.Hash{}, db)
+	account := types.NewAccount(address)
+	account.Balance = types.NewCoins(thetaWei, 0)
+	view.SetAccount(address, account)
+
+	root := core.NewBlock()
+	root.ChainID = chainID
+	root.Height = 1
+	root.StateHash = view.Save()
+	root.Timestamp = big.NewInt(time.Now().Unix())
+
+	privKey, _, _ := crypto.GenerateKeyPair()
+	_, err = ls.AddChain(&ld.ChainParams{
+		ChainID:    chainID,
+		PrivateKey: privKey,
+		Root:       root,
+		Network:    p2psim.NewSimnetWithHandler(nil).AddEndpoint("peer_" + chainID),
+	})
+	require.Nil(err)
+}
+
+func getBalanceByRPC(t *testing.T, url string, address common.Address) (thetaWei string, statusCode int) {
+	request := fmt.Sprintf(`{"jsonrpc":"2.0","method":"theta.GetAccount","params":[{"address":"%v"}],"id":1}`, address.Hex())
+	resp, err := http.Post(url, "application/json", bytes.NewBufferString(request))
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", resp.StatusCode
+	}
+
+	var response struct {
+		Result struct {
+			Coins struct {
+				ThetaWei string `json:"thetawei"`
+			} `json:"coins"`
+		} `json:"result"`
+	}
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&response))
+	return response.Result.Coins.ThetaWei, resp.StatusCode
+}
+
+func TestChainRouter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ls := ld.NewLedgerSet(context.Background(), backend.NewMemDatabase())
+	defer ls.Stop()
+
+	address := types.MakeAcc("router").Address
+	addRouterTestChain(t, ls, "chain1", address, 1000)
+	addRouterTestChain(t, ls, "chain2", address, 2000)
+
+	server := NewThetaRPCServer(nil, nil, nil, nil, nil)
+	server.RouteLedgerSet(ls)
+	httpServer := httptest.NewServer(server.router)
+	defer httpServer.Close()
+
+	balance, status := getBalanceByRPC(t, httpServer.URL+"/rpc/chain1", address)
+	require.Equal(http.StatusOK, status)
+	assert.Equal("1000", balance)
+	balance, status = getBalanceByRPC(t, httpServer.URL+"/rpc/chain2", address)
+	require.Equal(http.StatusOK, status)
+	assert.Equal("2000", balance)
+
+	_, status = getBalanceByRPC(t, httpServer.URL+"/rpc/chain3", address)
+	assert.Equal(http.StatusNotFound, status)
+
+	// Chains can be removed and added at runtime
+	require.Nil(ls.RemoveChain("chain2"))
+	_, status = getBalanceByRPC(t, httpServer.URL+"/rpc/chain2", address)
+	assert.Equal(http.StatusNotFound, status)
+
+	addRouterTestChain(t, ls, "chain3", address, 3000)
+	balance, status = getBalanceByRPC(t, httpServer.URL+"/rpc/chain3", address)
+	require.Equal(http.StatusOK, status)
+	assert.Equal("3000", balance)
+}
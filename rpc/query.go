@@ -1,6 +1,7 @@
 package rpc
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
@@ -43,7 +44,26 @@ type GetAccountArgs struct {
 
 type GetAccountResult struct {
 	*types.Account
-	Address string `json:"address"`
+	Address  string `json:"address"`
+	SafeMode bool   `json:"safe_mode"`
+}
+
+// MarshalJSON keeps the Address and SafeMode fields, which would otherwise be hidden by the
+// promoted types.Account.MarshalJSON method
+func (r GetAccountResult) MarshalJSON() ([]byte, error) {
+	type accountResultJSON struct {
+		types.AccountJSON
+		Address  string `json:"address"`
+		SafeMode bool   `json:"safe_mode"`
+	}
+	res := accountResultJSON{
+		Address:  r.Address,
+		SafeMode: r.SafeMode,
+	}
+	if r.Account != nil {
+		res.AccountJSON = types.NewAccountJSON(*r.Account)
+	}
+	return json.Marshal(res)
 }
 
 func (t *ThetaRPCService) GetAccount(args *GetAccountArgs, result *GetAccountResult) (err error) {
@@ -53,8 +73,10 @@ func (t *ThetaRPCService) GetAccount(args *GetAccountArgs, result *GetAccountRes
 	address := common.HexToAddress(args.Address)
 	result.Address = args.Address
 
+	result.SafeMode = t.inSafeMode()
+
 	var ledgerState *state.StoreView
-	if args.Preview {
+	if args.Preview && !result.SafeMode { // the screened view is derived from unfinalized blocks
 		ledgerState, err = t.ledger.GetScreenedSnapshot()
 	} else {
 		ledgerState, err = t.ledger.GetFinalizedSnapshot()
@@ -81,6 +103,20 @@ type GetSplitRuleArgs struct {
 
 type GetSplitRuleResult struct {
 	*types.SplitRule
+	SafeMode bool `json:"safe_mode"`
+}
+
+// MarshalJSON keeps the SafeMode field, which would otherwise be hidden by the promoted
+// types.SplitRule.MarshalJSON method
+func (r GetSplitRuleResult) MarshalJSON() ([]byte, error) {
+	type splitRuleResultJSON struct {
+		*types.SplitRuleJSON
+		SafeMode bool `json:"safe_mode"`
+	}
+	return json.Marshal(splitRuleResultJSON{
+		SplitRuleJSON: types.NewSplitRuleJSON(r.SplitRule),
+		SafeMode:      r.SafeMode,
+	})
 }
 
 func (t *ThetaRPCService) GetSplitRule(args *GetSplitRuleArgs, result *GetSplitRuleResult) (err error) {
@@ -88,7 +124,14 @@ func (t *ThetaRPCService) GetSplitRule(args *GetSplitRuleArgs, result *GetSplitR
 		return errors.New("ResourceID must be specified")
 	}
 	resourceID := args.ResourceID
-	ledgerState, err := t.ledger.GetDeliveredSnapshot()
+	result.SafeMode = t.inSafeMode()
+
+	var ledgerState *state.StoreView
+	if result.SafeMode {
+		ledgerState, err = t.ledger.GetFinalizedSnapshot()
+	} else {
+		ledgerState, err = t.ledger.GetDeliveredSnapshot()
+	}
 	if err != nil {
 		return err
 	}
@@ -109,6 +152,7 @@ type GetTransactionResult struct {
 	TxHash      common.Hash       `json:"hash"`
 	Type        byte              `json:"type"`
 	Tx          types.Tx          `json:"transaction"`
+	SafeMode    bool              `json:"safe_mode"`
 }
 
 type TxStatus string
@@ -126,8 +170,15 @@ func (t *ThetaRPCService) GetTransaction(args *GetTransactionArgs, result *GetTr
 	}
 	hash := common.HexToHash(args.Hash)
 	result.TxHash = hash
+	result.SafeMode = t.inSafeMode()
 
 	raw, block, found := t.chain.FindTxByHash(hash)
+	if found && result.SafeMode && !block.Status.IsFinalized() {
+		// In safe mode, the transactions in unfinalized blocks are reported as pending,
+		// without revealing the unfinalized blocks
+		result.Status = TxStatusPending
+		return nil
+	}
 	if !found {
 		txStatus, exists := t.mempool.GetTransactionStatus(args.Hash)
 		if exists {
@@ -206,6 +257,8 @@ type GetBlockResultInner struct {
 
 	Hash common.Hash `json:"hash"`
 	Txs  []Tx        `json:"transactions"`
+
+	SafeMode bool `json:"safe_mode"`
 }
 
 type TxType byte
@@ -221,6 +274,18 @@ const (
 	TxTypeSmartContract
 	TxTypeDepositStake
 	TxTypeWithdrawStake
+	TxTypeUpdateMultisig
+	TxTypePartialReleaseFund
+	TxTypeExtendSplitRule
+	TxTypeSweepAccount
+	TxTypeBurn
+	TxTypeDoubleSignSlash
+	TxTypeStakeCommission
+	TxTypeCancelWithdraw
+	TxTypeUpdateValidatorMetadata
+	TxTypeUnjail
+	TxTypeEjectStake
+	TxTypeUpdateValidatorKey
 )
 
 func (t *ThetaRPCService) GetBlock(args *GetBlockArgs, result *GetBlockResult) (err error) {
@@ -232,8 +297,13 @@ func (t *ThetaRPCService) GetBlock(args *GetBlockArgs, result *GetBlockResult) (
 	if err != nil {
 		return err
 	}
+	safeMode := t.inSafeMode()
+	if safeMode && !block.Status.IsFinalized() {
+		return fmt.Errorf("Block %v is not finalized, unfinalized blocks are not served in safe mode", args.Hash.Hex())
+	}
 
 	result.GetBlockResultInner = &GetBlockResultInner{}
+	result.SafeMode = safeMode
 	result.ChainID = block.ChainID
 	result.Epoch = common.JSONUint64(block.Epoch)
 	result.Height = common.JSONUint64(block.Height)
@@ -293,6 +363,7 @@ func (t *ThetaRPCService) GetBlockByHeight(args *GetBlockByHeightArgs, result *G
 	}
 
 	result.GetBlockResultInner = &GetBlockResultInner{}
+	result.SafeMode = t.inSafeMode()
 	result.ChainID = block.ChainID
 	result.Epoch = common.JSONUint64(block.Epoch)
 	result.Height = common.JSONUint64(block.Height)
@@ -340,6 +411,9 @@ type GetStatusResult struct {
 	CurrentEpoch               common.JSONUint64 `json:"current_epoch"`
 	CurrentTime                *common.JSONBig   `json:"current_time"`
 	Syncing                    bool              `json:"syncing"`
+	SafeMode                   bool              `json:"safe_mode"`
+	SafeModeReason             string            `json:"safe_mode_reason,omitempty"`
+	TxLatency                  *TxLatencyResult  `json:"tx_latency,omitempty"`
 }
 
 func (t *ThetaRPCService) GetStatus(args *GetStatusArgs, result *GetStatusResult) (err error) {
@@ -361,9 +435,165 @@ func (t *ThetaRPCService) GetStatus(args *GetStatusArgs, result *GetStatusResult
 	result.CurrentEpoch = common.JSONUint64(s.Epoch)
 	result.CurrentTime = (*common.JSONBig)(big.NewInt(time.Now().Unix()))
 
+	safeModeStatus := t.consensus.SafeMode().Status()
+	result.SafeMode = safeModeStatus.Enabled
+	result.SafeModeReason = safeModeStatus.Reason
+
+	if latencyTracker := t.ledger.TxLatencyTracker(); latencyTracker != nil {
+		result.TxLatency = newTxLatencyResult(latencyTracker.Stats())
+	}
+
+	return
+}
+
+// ------------------------------ GetFeeStats -----------------------------------
+
+type GetFeeStatsArgs struct{}
+
+// LatencyPercentilesResult holds the latency percentiles in milliseconds
+type LatencyPercentilesResult struct {
+	P50 common.JSONUint64 `json:"p50_ms"`
+	P90 common.JSONUint64 `json:"p90_ms"`
+	P99 common.JSONUint64 `json:"p99_ms"`
+}
+
+type TxLatencyResult struct {
+	NumTxs           common.JSONUint64        `json:"num_txs"`
+	InclusionLatency LatencyPercentilesResult `json:"inclusion_latency"`
+	FinalityLatency  LatencyPercentilesResult `json:"finality_latency"`
+}
+
+type FeeLevelResult struct {
+	MinGasPrice *common.JSONBig `json:"min_gas_price"`
+	MaxGasPrice *common.JSONBig `json:"max_gas_price"`
+	TxLatencyResult
+}
+
+type GetFeeStatsResult struct {
+	Overall   *TxLatencyResult  `json:"overall"`
+	FeeLevels []*FeeLevelResult `json:"fee_levels"`
+}
+
+// GetFeeStats returns the inclusion and finality latencies of the recently finalized transactions
+// observed by this node, overall and by gas price level, ordered from the lowest to the highest
+func (t *ThetaRPCService) GetFeeStats(args *GetFeeStatsArgs, result *GetFeeStatsResult) (err error) {
+	latencyTracker := t.ledger.TxLatencyTracker()
+	if latencyTracker == nil {
+		return errors.New("Transaction latency tracking is not enabled")
+	}
+
+	result.Overall = newTxLatencyResult(latencyTracker.Stats())
+	result.FeeLevels = []*FeeLevelResult{}
+	for _, level := range latencyTracker.FeeLevelStats() {
+		result.FeeLevels = append(result.FeeLevels, &FeeLevelResult{
+			MinGasPrice:     (*common.JSONBig)(level.MinGasPrice),
+			MaxGasPrice:     (*common.JSONBig)(level.MaxGasPrice),
+			TxLatencyResult: *newTxLatencyResult(level.TxLatencyStats),
+		})
+	}
+
 	return
 }
 
+// ------------------------------ EstimateTxFee -----------------------------------
+
+type EstimateTxFeeArgs struct {
+	TxBytes string `json:"tx_bytes"`
+}
+
+type EstimateTxFeeResult struct {
+	MinimumFee   *common.JSONBig   `json:"minimum_fee"`
+	BaseFee      *common.JSONBig   `json:"base_fee"`
+	PerByteFee   *common.JSONBig   `json:"per_byte_fee"`
+	IntrinsicGas common.JSONUint64 `json:"intrinsic_gas"`
+	MinGasPrice  *common.JSONBig   `json:"min_gas_price"`
+}
+
+// EstimateTxFee returns the minimum fee of the given raw transaction under the fee schedule of the chain. The
+// transaction does not need to be signed, so the fee can be set before signing it.
+func (t *ThetaRPCService) EstimateTxFee(args *EstimateTxFeeArgs, result *EstimateTxFeeResult) (err error) {
+	rawTx, err := decodeTxHexBytes(args.TxBytes)
+	if err != nil {
+		return err
+	}
+	tx, err := types.TxFromBytes(rawTx)
+	if err != nil {
+		return err
+	}
+	var ledgerState *state.StoreView
+	if t.inSafeMode() {
+		ledgerState, err = t.ledger.GetFinalizedSnapshot()
+	} else {
+		ledgerState, err = t.ledger.GetScreenedSnapshot()
+	}
+	if err != nil {
+		return err
+	}
+
+	feeSchedule := ledgerState.GetFeeSchedule()
+	gasSchedule := ledgerState.GetIntrinsicGasSchedule()
+	minimumFee, err := types.EstimateMinimumFee(feeSchedule, gasSchedule, tx)
+	if err != nil {
+		return err
+	}
+	result.MinimumFee = (*common.JSONBig)(minimumFee)
+	result.BaseFee = (*common.JSONBig)(gasSchedule.TxBaseFee(feeSchedule, tx))
+	result.PerByteFee = (*common.JSONBig)(feeSchedule.PerByteFee())
+	result.IntrinsicGas = common.JSONUint64(gasSchedule.TxGas(tx))
+	result.MinGasPrice = (*common.JSONBig)(gasSchedule.MinGasPrice())
+	return nil
+}
+
+func newTxLatencyResult(stats core.TxLatencyStats) *TxLatencyResult {
+	return &TxLatencyResult{
+		NumTxs:           common.JSONUint64(stats.NumTxs),
+		InclusionLatency: newLatencyPercentilesResult(stats.InclusionLatency),
+		FinalityLatency:  newLatencyPercentilesResult(stats.FinalityLatency),
+	}
+}
+
+func newLatencyPercentilesResult(percentiles core.LatencyPercentiles) LatencyPercentilesResult {
+	return LatencyPercentilesResult{
+		P50: common.JSONUint64(percentiles.P50 / time.Millisecond),
+		P90: common.JSONUint64(percentiles.P90 / time.Millisecond),
+		P99: common.JSONUint64(percentiles.P99 / time.Millisecond),
+	}
+}
+
+// ------------------------------ GetTotalSupply -----------------------------------
+
+type GetTotalSupplyArgs struct{}
+
+type GetTotalSupplyResult struct {
+	Height              common.JSONUint64 `json:"height"`
+	TotalThetaWeiSupply *common.JSONBig   `json:"total_theta_wei_supply"`
+	TotalTFuelWeiSupply *common.JSONBig   `json:"total_tfuel_wei_supply"`
+	BurnedThetaWeiFees  *common.JSONBig   `json:"burned_theta_wei_fees"`
+	BurnedTFuelWeiFees  *common.JSONBig   `json:"burned_tfuel_wei_fees"`
+}
+
+// GetTotalSupply returns the total coin supply as of the last finalized block, i.e. the coins issued at genesis
+// and by the coinbase transactions, less the burned fees and the coins destroyed by the BurnTxs. The burned fees
+// are the cumulative fees burned since common.HeightEnableFeeDistribution.
+func (t *ThetaRPCService) GetTotalSupply(args *GetTotalSupplyArgs, result *GetTotalSupplyResult) (err error) {
+	ledgerState, err := t.ledger.GetFinalizedSnapshot()
+	if err != nil {
+		return err
+	}
+
+	supply := ledgerState.GetTotalSupply()
+	if supply == nil {
+		return errors.New("The total supply is not tracked by this chain")
+	}
+	result.Height = common.JSONUint64(ledgerState.Height())
+	result.TotalThetaWeiSupply = (*common.JSONBig)(supply.ThetaWei)
+	result.TotalTFuelWeiSupply = (*common.JSONBig)(supply.TFuelWei)
+	burnedFees := ledgerState.GetBurnedFees()
+	result.BurnedThetaWeiFees = (*common.JSONBig)(burnedFees.ThetaWei)
+	result.BurnedTFuelWeiFees = (*common.JSONBig)(burnedFees.TFuelWei)
+	return nil
+}
+
 // ------------------------------ GetPeers -----------------------------------
 
 type GetPeersArgs struct{}
@@ -387,12 +617,14 @@ type GetVcpByHeightArgs struct {
 
 type GetVcpResult struct {
 	BlockHashVcpPairs []BlockHashVcpPair
+	SafeMode          bool `json:"safe_mode"`
 }
 
 type BlockHashVcpPair struct {
-	BlockHash  common.Hash
-	Vcp        *core.ValidatorCandidatePool
-	HeightList *types.HeightList
+	BlockHash         common.Hash
+	Vcp               *core.ValidatorCandidatePool
+	HeightList        *types.HeightList
+	ValidatorMetadata map[common.Address]*types.ValidatorMetadata // of the candidates which set it
 }
 
 func (t *ThetaRPCService) GetVcpByHeight(args *GetVcpByHeightArgs, result *GetVcpResult) (err error) {
@@ -404,9 +636,24 @@ func (t *ThetaRPCService) GetVcpByHeight(args *GetVcpByHeightArgs, result *GetVc
 	db := deliveredView.GetDB()
 	height := uint64(args.Height)
 
+	result.SafeMode = t.inSafeMode()
+	if result.SafeMode {
+		// Heights above the last finalized block resolve to the last finalized block
+		finalizedView, err := t.ledger.GetFinalizedSnapshot()
+		if err != nil {
+			return err
+		}
+		if height > finalizedView.Height() {
+			height = finalizedView.Height()
+		}
+	}
+
 	blockHashVcpPairs := []BlockHashVcpPair{}
 	blocks := t.chain.FindBlocksByHeight(height)
 	for _, b := range blocks {
+		if result.SafeMode && !b.Status.IsFinalized() {
+			continue
+		}
 		blockHash := b.Hash()
 		stateRoot := b.StateHash
 		blockStoreView := state.NewStoreView(height, stateRoot, db)
@@ -415,10 +662,19 @@ func (t *ThetaRPCService) GetVcpByHeight(args *GetVcpByHeightArgs, result *GetVc
 		}
 		vcp := blockStoreView.GetValidatorCandidatePool()
 		hl := blockStoreView.GetStakeTransactionHeightList()
+		validatorMetadata := map[common.Address]*types.ValidatorMetadata{}
+		if vcp != nil {
+			for _, candidate := range vcp.SortedCandidates {
+				if metadata := blockStoreView.GetValidatorMetadata(candidate.Holder); metadata != nil {
+					validatorMetadata[candidate.Holder] = metadata
+				}
+			}
+		}
 		blockHashVcpPairs = append(blockHashVcpPairs, BlockHashVcpPair{
-			BlockHash:  blockHash,
-			Vcp:        vcp,
-			HeightList: hl,
+			BlockHash:         blockHash,
+			Vcp:               vcp,
+			HeightList:        hl,
+			ValidatorMetadata: validatorMetadata,
 		})
 	}
 
@@ -452,6 +708,30 @@ func getTxType(tx types.Tx) byte {
 		t = TxTypeDepositStake
 	case *types.WithdrawStakeTx:
 		t = TxTypeWithdrawStake
+	case *types.UpdateMultisigTx:
+		t = TxTypeUpdateMultisig
+	case *types.PartialReleaseFundTx:
+		t = TxTypePartialReleaseFund
+	case *types.ExtendSplitRuleTx:
+		t = TxTypeExtendSplitRule
+	case *types.SweepAccountTx:
+		t = TxTypeSweepAccount
+	case *types.BurnTx:
+		t = TxTypeBurn
+	case *types.DoubleSignSlashTx:
+		t = TxTypeDoubleSignSlash
+	case *types.StakeCommissionTx:
+		t = TxTypeStakeCommission
+	case *types.CancelWithdrawTx:
+		t = TxTypeCancelWithdraw
+	case *types.UpdateValidatorMetadataTx:
+		t = TxTypeUpdateValidatorMetadata
+	case *types.UnjailTx:
+		t = TxTypeUnjail
+	case *types.EjectStakeTx:
+		t = TxTypeEjectStake
+	case *types.UpdateValidatorKeyTx:
+		t = TxTypeUpdateValidatorKey
 	}
 
 	return t
@@ -464,3 +744,116 @@ func isSyncing(block *core.ExtendedBlock) bool {
 	isSyncing := block.Timestamp.Cmp(threshold) < 0
 	return isSyncing
 }
+
+// ------------------------------ GetPendingStakeReturns -----------------------------------
+
+type GetPendingStakeReturnsArgs struct {
+	Address string `json:"address"`
+}
+
+type PendingStakeReturnResult struct {
+	Holder         common.Address           `json:"holder"`
+	HolderMetadata *types.ValidatorMetadata `json:"holder_metadata,omitempty"`
+	Purpose        core.StakePurposeJSON    `json:"purpose"`
+	Amount         *common.JSONBig          `json:"amount"`
+	ReturnHeight   common.JSONUint64        `json:"return_height"`
+}
+
+type GetPendingStakeReturnsResult struct {
+	Height         common.JSONUint64          `json:"height"`
+	PendingReturns []PendingStakeReturnResult `json:"pending_returns"`
+	SafeMode       bool                       `json:"safe_mode"`
+}
+
+// GetPendingStakeReturns lists the validator and guardian stakes the source has withdrawn that are not returned
+// yet as of the last finalized block, ordered by return height. A stake returns at the end of the first block whose parent is at
+// or above its return height.
+func (t *ThetaRPCService) GetPendingStakeReturns(args *GetPendingStakeReturnsArgs, result *GetPendingStakeReturnsResult) (err error) {
+	if args.Address == "" {
+		return errors.New("Address must be specified")
+	}
+	source := common.HexToAddress(args.Address)
+
+	result.SafeMode = t.inSafeMode()
+	ledgerState, err := t.ledger.GetFinalizedSnapshot()
+	if err != nil {
+		return err
+	}
+
+	result.Height = common.JSONUint64(ledgerState.Height())
+	result.PendingReturns = []PendingStakeReturnResult{}
+	for _, pending := range ledgerState.GetPendingStakeReturns(source) {
+		result.PendingReturns = append(result.PendingReturns, PendingStakeReturnResult{
+			Holder:         pending.Holder,
+			HolderMetadata: ledgerState.GetValidatorMetadata(pending.Holder),
+			Purpose:        core.StakePurposeJSON(pending.Purpose),
+			Amount:         (*common.JSONBig)(pending.Amount),
+			ReturnHeight:   common.JSONUint64(pending.ReturnHeight),
+		})
+	}
+	return nil
+}
+
+// ------------------------------ GetStakeHistory -----------------------------------
+
+// MaxStakeHistoryPageSize is the max number of entries returned by a GetStakeHistory call
+const MaxStakeHistoryPageSize = 1000
+
+type GetStakeHistoryArgs struct {
+	Address    string            `json:"address"`
+	FromHeight common.JSONUint64 `json:"from_height"`
+	ToHeight   common.JSONUint64 `json:"to_height"` // the last finalized block if zero
+	Limit      common.JSONUint64 `json:"limit"`     // MaxStakeHistoryPageSize if zero or above
+}
+
+type StakeHistoryEntryResult struct {
+	Height     common.JSONUint64 `json:"height"`
+	TotalStake *common.JSONBig   `json:"total_stake"`
+}
+
+type GetStakeHistoryResult struct {
+	Height         common.JSONUint64         `json:"height"`
+	Entries        []StakeHistoryEntryResult `json:"entries"`
+	NextFromHeight common.JSONUint64         `json:"next_from_height"` // the from_height of the next page, zero on the last page
+	SafeMode       bool                      `json:"safe_mode"`
+}
+
+// GetStakeHistory lists the changes of the total active stake of the validator stake holder between the heights,
+// as of the last finalized block. Each entry is the total stake at the end of the block at its height, which holds
+// until the next entry. The changes are recorded from common.HeightEnableStakeHistory on.
+func (t *ThetaRPCService) GetStakeHistory(args *GetStakeHistoryArgs, result *GetStakeHistoryResult) (err error) {
+	if args.Address == "" {
+		return errors.New("Address must be specified")
+	}
+	holder := common.HexToAddress(args.Address)
+
+	result.SafeMode = t.inSafeMode()
+	ledgerState, err := t.ledger.GetFinalizedSnapshot()
+	if err != nil {
+		return err
+	}
+
+	toHeight := uint64(args.ToHeight)
+	if toHeight == 0 || toHeight > ledgerState.Height() {
+		toHeight = ledgerState.Height()
+	}
+	limit := int(args.Limit)
+	if limit <= 0 || limit > MaxStakeHistoryPageSize {
+		limit = MaxStakeHistoryPageSize
+	}
+
+	result.Height = common.JSONUint64(ledgerState.Height())
+	result.Entries = []StakeHistoryEntryResult{}
+	entries := ledgerState.GetStakeHistory(holder, uint64(args.FromHeight), toHeight, limit+1)
+	if len(entries) > limit {
+		result.NextFromHeight = common.JSONUint64(entries[limit].Height)
+		entries = entries[:limit]
+	}
+	for _, entry := range entries {
+		result.Entries = append(result.Entries, StakeHistoryEntryResult{
+			Height:     common.JSONUint64(entry.Height),
+			TotalStake: (*common.JSONBig)(entry.TotalStake),
+		})
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/blockchain"
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/common/util"
+	"github.com/thetatoken/theta/consensus"
+	"github.com/thetatoken/theta/core"
+	"github.com/thetatoken/theta/crypto"
+	dp "github.com/thetatoken/theta/dispatcher"
+	ld "github.com/thetatoken/theta/ledger"
+	exec "github.com/thetatoken/theta/ledger/execution"
+	"github.com/thetatoken/theta/ledger/state"
+	"github.com/thetatoken/theta/ledger/types"
+	mp "github.com/thetatoken/theta/mempool"
+	p2psim "github.com/thetatoken/theta/p2p/simulation"
+	"github.com/thetatoken/theta/store/database/backend"
+	"github.com/thetatoken/theta/store/kvstore"
+)
+
+const testChainID = "test_chain_id"
+
+type safeModeTestEnv struct {
+	service    *ThetaRPCService
+	admin      *ThetaAdminRPCService
+	root       *core.ExtendedBlock // finalized
+	tip        *core.ExtendedBlock // not finalized
+	tipTxHash  common.Hash
+	srcAcc     types.PrivAccount
+	resourceID string
+}
+
+// newSafeModeTestEnv sets up a chain with a finalized root block and an unfinalized tip block.
+// The source account has different balances in the two blocks, and the split rule only exists
+// in the state of the tip block.
+func newSafeModeTestEnv(t *testing.T) *safeModeTestEnv {
+	require := require.New(t)
+
+	logger = util.GetLoggerForModule("rpc")
+
+	db := backend.NewMemDatabase()
+	store := kvstore.NewKVStore(db)
+
+	txFee := int64(types.MinimumTransactionFeeTFuelWei)
+	srcAcc := types.MakeAccWithInitBalance("src", types.NewCoins(1000, 100*txFee))
+	tipAcc := types.MakeAccWithInitBalance("tip", types.NewCoins(1000, 100*txFee))
+	resourceID := "rid001"
+
+	view := state.NewStoreView(0, common.Hash{}, db)
+	exec.LowerDustThresholds(view)
+	view.SetAccount(srcAcc.Address, &srcAcc.Account)
+	view.SetAccount(tipAcc.Address, &tipAcc.Account)
+	finalizedRoot := view.Save()
+
+	tipSrcAcc := srcAcc.Account
+	tipSrcAcc.Balance = types.NewCoins(2000, 100*txFee)
+	view.SetAccount(srcAcc.Address, &tipSrcAcc)
+	view.SetSplitRule(resourceID, &types.SplitRule{
+		InitiatorAddress: srcAcc.Address,
+		ResourceID:       resourceID,
+		EndBlockHeight:   100,
+	})
+	tipRoot := view.Save()
+
+	rootBlock := core.NewBlock()
+	rootBlock.ChainID = testChainID
+	rootBlock.Height = 1
+	rootBlock.StateHash = finalizedRoot
+	rootBlock.Timestamp = big.NewInt(time.Now().Unix())
+	chain := blockchain.NewChain(testChainID, store, rootBlock)
+
+	tipTx := newTestSendTx(t, tipAcc, srcAcc.Address, 1)
+	tipBlock := core.NewBlock()
+	tipBlock.ChainID = testChainID
+	tipBlock.Height = 2
+	tipBlock.Parent = chain.Root().Hash()
+	tipBlock.StateHash = tipRoot
+	tipBlock.Timestamp = big.NewInt(time.Now().Unix())
+	tipBlock.Txs = []common.Bytes{tipTx}
+	tip, err := chain.AddBlock(tipBlock)
+	require.Nil(err)
+
+	privKey, _, _ := crypto.GenerateKeyPair()
+	proposer := core.NewValidator(privKey.PublicKey().Address().Hex(), big.NewInt(10000))
+	valSet := core.NewValidatorSet()
+	valSet.AddValidator(proposer)
+	valMgr := exec.NewTestValidatorManager(proposer, valSet)
+
+	messenger := p2psim.NewSimnetWithHandler(nil).AddEndpoint("peer0")
+	dispatcher := dp.NewDispatcher(messenger)
+	ce := consensus.NewConsensusEngine(privKey, store, chain, dispatcher, valMgr)
+	mempool := mp.CreateMempool(dispatcher)
+	ledger := ld.NewLedger(testChainID, db, chain, ce, valMgr, mempool)
+	ce.SetLedger(ledger)
+	mempool.SetLedger(ledger)
+	mempool.SetSafeMode(ce.SafeMode())
+
+	require.True(ledger.ResetState(2, tipRoot).IsOK())
+	require.True(ledger.FinalizeState(1, finalizedRoot).IsOK())
+
+	service := &ThetaRPCService{
+		mempool:    mempool,
+		ledger:     ledger,
+		dispatcher: dispatcher,
+		chain:      chain,
+		consensus:  ce,
+	}
+	return &safeModeTestEnv{
+		service:    service,
+		admin:      &ThetaAdminRPCService{service: service},
+		root:       chain.Root(),
+		tip:        tip,
+		tipTxHash:  crypto.Keccak256Hash(tipTx),
+		srcAcc:     srcAcc,
+		resourceID: resourceID,
+	}
+}
+
+func newTestSendTx(t *testing.T, from types.PrivAccount, to common.Address, sequence uint64) common.Bytes {
+	txFee := int64(types.MinimumTransactionFeeTFuelWei)
+	sendTx := &types.SendTx{
+		Fee: types.NewCoins(0, txFee),
+		Inputs: []types.TxInput{
+			{
+				Sequence: sequence,
+				Address:  from.Address,
+				Coins:    types.NewCoins(15, txFee),
+			},
+		},
+		Outputs: []types.TxOutput{
+			{
+				Address: to,
+				Coins:   types.NewCoins(15, 0),
+			},
+		},
+	}
+	sig, err := from.PrivKey.Sign(sendTx.SignBytes(testChainID))
+	require.Nil(t, err)
+	sendTx.SetSignature(from.Address, sig)
+
+	raw, err := types.TxToBytes(sendTx)
+	require.Nil(t, err)
+	return raw
+}
+
+func TestSafeModeQueryPinning(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	env := newSafeModeTestEnv(t)
+	service := env.service
+
+	// Normal mode, the preview, split rule, block and transaction queries reflect the unfinalized tip
+	accResult := &GetAccountResult{}
+	require.Nil(service.GetAccount(&GetAccountArgs{Address: env.srcAcc.Address.Hex(), Preview: true}, accResult))
+	assert.Equal(int64(2000), accResult.Balance.ThetaWei.Int64())
+	assert.False(accResult.SafeMode)
+
+	srResult := &GetSplitRuleResult{}
+	require.Nil(service.GetSplitRule(&GetSplitRuleArgs{ResourceID: env.resourceID}, srResult))
+	assert.NotNil(srResult.SplitRule)
+
+	blockResult := &GetBlockResult{}
+	require.Nil(service.GetBlock(&GetBlockArgs{Hash: env.tip.Hash()}, blockResult))
+	assert.Equal(env.tip.Hash(), blockResult.Hash)
+
+	txResult := &GetTransactionResult{}
+	require.Nil(service.GetTransaction(&GetTransactionArgs{Hash: env.tipTxHash.Hex()}, txResult))
+	assert.Equal(TxStatus(TxStatusPending), txResult.Status)
+	assert.Equal(env.tip.Hash(), txResult.BlockHash)
+
+	vcpResult := &GetVcpResult{}
+	require.Nil(service.GetVcpByHeight(&GetVcpByHeightArgs{Height: 2}, vcpResult))
+	require.Equal(1, len(vcpResult.BlockHashVcpPairs))
+	assert.Equal(env.tip.Hash(), vcpResult.BlockHashVcpPairs[0].BlockHash)
+
+	// Safe mode, all the queries resolve against the last finalized block
+	require.Nil(env.admin.SetSafeMode(&SetSafeModeArgs{Enabled: true, Reason: "suspected fork"}, &SetSafeModeResult{}))
+
+	accResult = &GetAccountResult{}
+	require.Nil(service.GetAccount(&GetAccountArgs{Address: env.srcAcc.Address.Hex(), Preview: true}, accResult))
+	assert.Equal(int64(1000), accResult.Balance.ThetaWei.Int64())
+	assert.True(accResult.SafeMode)
+
+	accJSON, err := json.Marshal(accResult)
+	require.Nil(err)
+	assert.Contains(string(accJSON), `"safe_mode":true`)
+	assert.Contains(string(accJSON), `"address":"`+env.srcAcc.Address.Hex()+`"`)
+	assert.Contains(string(accJSON), `"coins":`)
+
+	srResult = &GetSplitRuleResult{}
+	require.Nil(service.GetSplitRule(&GetSplitRuleArgs{ResourceID: env.resourceID}, srResult))
+	assert.Nil(srResult.SplitRule)
+	assert.True(srResult.SafeMode)
+
+	srJSON, err := json.Marshal(srResult)
+	require.Nil(err)
+	assert.Contains(string(srJSON), `"safe_mode":true`)
+
+	blockResult = &GetBlockResult{}
+	assert.NotNil(service.GetBlock(&GetBlockArgs{Hash: env.tip.Hash()}, blockResult))
+	blockResult = &GetBlockResult{}
+	require.Nil(service.GetBlock(&GetBlockArgs{Hash: env.root.Hash()}, blockResult))
+	assert.True(blockResult.SafeMode)
+
+	txResult = &GetTransactionResult{}
+	require.Nil(service.GetTransaction(&GetTransactionArgs{Hash: env.tipTxHash.Hex()}, txResult))
+	assert.Equal(TxStatus(TxStatusPending), txResult.Status)
+	assert.True(txResult.BlockHash.IsEmpty())
+	assert.Nil(txResult.Tx)
+	assert.True(txResult.SafeMode)
+
+	vcpResult = &GetVcpResult{}
+	require.Nil(service.GetVcpByHeight(&GetVcpByHeightArgs{Height: 2}, vcpResult))
+	require.Equal(1, len(vcpResult.BlockHashVcpPairs))
+	assert.Equal(env.root.Hash(), vcpResult.BlockHashVcpPairs[0].BlockHash)
+	assert.True(vcpResult.SafeMode)
+
+	statusResult := &GetStatusResult{}
+	require.Nil(service.GetStatus(&GetStatusArgs{}, statusResult))
+	assert.True(statusResult.SafeMode)
+	assert.Equal("suspected fork", statusResult.SafeModeReason)
+	assert.Equal(env.root.Hash(), statusResult.LatestFinalizedBlockHash)
+
+	// Back to the normal mode
+	require.Nil(env.admin.SetSafeMode(&SetSafeModeArgs{Enabled: false}, &SetSafeModeResult{}))
+
+	accResult = &GetAccountResult{}
+	require.Nil(service.GetAccount(&GetAccountArgs{Address: env.srcAcc.Address.Hex(), Preview: true}, accResult))
+	assert.Equal(int64(2000), accResult.Balance.ThetaWei.Int64())
+	assert.False(accResult.SafeMode)
+
+	statusResult = &GetStatusResult{}
+	require.Nil(service.GetStatus(&GetStatusArgs{}, statusResult))
+	assert.False(statusResult.SafeMode)
+}
+
+func TestSafeModeBroadcast(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	env := newSafeModeTestEnv(t)
+	service := env.service
+
+	require.Nil(env.admin.SetSafeMode(&SetSafeModeArgs{Enabled: true, Reason: "suspected fork"}, &SetSafeModeResult{}))
+	assert.True(service.mempool.IsRelaySuspended())
+
+	recipient := types.MakeAcc("recipient").Address
+
+	// The transactions are accepted into the mempool, but marked as queued-not-relayed
+	asyncResult := &BroadcastRawTransactionAsyncResult{}
+	rawTx := newTestSendTx(t, env.srcAcc, recipient, 1)
+	require.Nil(service.BroadcastRawTransactionAsync(
+		&BroadcastRawTransactionAsyncArgs{TxBytes: hex.EncodeToString(rawTx)}, asyncResult))
+	assert.Equal(crypto.Keccak256Hash(rawTx).Hex(), asyncResult.TxHash)
+	assert.Equal(BroadcastStatusQueuedNotRelayed, asyncResult.Status)
+	assert.True(asyncResult.SafeMode)
+
+	syncResult := &BroadcastRawTransactionResult{}
+	rawTx = newTestSendTx(t, env.srcAcc, recipient, 2)
+	require.Nil(service.BroadcastRawTransaction(
+		&BroadcastRawTransactionArgs{TxBytes: hex.EncodeToString(rawTx)}, syncResult))
+	assert.Equal(BroadcastStatusQueuedNotRelayed, syncResult.Status)
+	assert.True(syncResult.SafeMode)
+	assert.Nil(syncResult.Block)
+
+	assert.Equal(2, service.mempool.Size())
+
+	require.Nil(env.admin.SetSafeMode(&SetSafeModeArgs{Enabled: false}, &SetSafeModeResult{}))
+	assert.False(service.mempool.IsRelaySuspended())
+
+	asyncResult = &BroadcastRawTransactionAsyncResult{}
+	rawTx = newTestSendTx(t, env.srcAcc, recipient, 3)
+	require.Nil(service.BroadcastRawTransactionAsync(
+		&BroadcastRawTransactionAsyncArgs{TxBytes: hex.EncodeToString(rawTx)}, asyncResult))
+	assert.Equal("", asyncResult.Status)
+	assert.False(asyncResult.SafeMode)
+}
+
+func TestSafeModeExitIntegrityCheck(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	env := newSafeModeTestEnv(t)
+	service := env.service
+
+	assert.NotNil(env.admin.SetSafeMode(&SetSafeModeArgs{Enabled: true}, &SetSafeModeResult{}), "Reason is required")
+	require.Nil(env.admin.SetSafeMode(&SetSafeModeArgs{Enabled: true, Reason: "operator"}, &SetSafeModeResult{}))
+
+	// Exiting fails, and the node stays in safe mode, if the integrity checks do not pass
+	maxEpochLength := viper.GetInt(common.CfgConsensusMaxEpochLength)
+	minProposalWait := viper.GetInt(common.CfgConsensusMinProposalWait)
+	viper.Set(common.CfgConsensusMaxEpochLength, minProposalWait)
+	result := &SetSafeModeResult{}
+	err := env.admin.SetSafeMode(&SetSafeModeArgs{Enabled: false}, result)
+	viper.Set(common.CfgConsensusMaxEpochLength, maxEpochLength)
+	assert.NotNil(err)
+	assert.True(result.SafeMode)
+	assert.Equal("operator", result.Reason)
+	assert.True(service.inSafeMode())
+
+	result = &SetSafeModeResult{}
+	require.Nil(env.admin.SetSafeMode(&SetSafeModeArgs{Enabled: false}, result))
+	assert.False(result.SafeMode)
+	assert.False(service.inSafeMode())
+}
+
+func TestGetFeeStats(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	env := newSafeModeTestEnv(t)
+	service := env.service
+
+	assert.NotNil(service.GetFeeStats(&GetFeeStatsArgs{}, &GetFeeStatsResult{}))
+
+	clock := common.NewManualClock(time.Unix(1000, 0))
+	tracker := core.NewTxLatencyTracker(clock)
+	service.ledger.SetTxLatencyTracker(tracker)
+
+	block := env.tip.Hash()
+	for i := 1; i <= 2; i++ {
+		txHash := common.BigToHash(big.NewInt(int64(i)))
+		tracker.RecordAdmission(txHash, big.NewInt(int64(i*1000)))
+		clock.Advance(time.Duration(3-i) * time.Second)
+		tracker.RecordInclusion(block, env.tip.Height, []common.Hash{txHash})
+		clock.Advance(500 * time.Millisecond)
+		tracker.RecordFinalization(env.tip.Height, map[common.Hash]bool{block: true})
+	}
+
+	result := &GetFeeStatsResult{}
+	require.Nil(service.GetFeeStats(&GetFeeStatsArgs{}, result))
+	assert.Equal(common.JSONUint64(2), result.Overall.NumTxs)
+	assert.Equal(common.JSONUint64(1000), result.Overall.InclusionLatency.P50)
+	assert.Equal(common.JSONUint64(2500), result.Overall.FinalityLatency.P90)
+	require.Equal(2, len(result.FeeLevels))
+	assert.Equal(big.NewInt(1000), (*big.Int)(result.FeeLevels[0].MinGasPrice))
+	assert.Equal(common.JSONUint64(2000), result.FeeLevels[0].InclusionLatency.P50)
+	assert.Equal(big.NewInt(2000), (*big.Int)(result.FeeLevels[1].MaxGasPrice))
+	assert.Equal(common.JSONUint64(1000), result.FeeLevels[1].InclusionLatency.P50)
+
+	resultJSON, err := json.Marshal(result)
+	require.Nil(err)
+	assert.Contains(string(resultJSON), `"inclusion_latency":{"p50_ms":"1000"`)
+	assert.Contains(string(resultJSON), `"min_gas_price":"1000"`)
+}
+
+func TestEstimateTxFee(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	env := newSafeModeTestEnv(t)
+	service := env.service
+
+	// An unsigned transaction, as built by a wallet before signing it
+	sendTx := &types.SendTx{
+		Fee:     types.NewCoins(0, 0),
+		Inputs:  []types.TxInput{{Address: env.srcAcc.Address, Coins: types.NewCoins(15, 0), Sequence: 1}},
+		Outputs: []types.TxOutput{{Address: env.srcAcc.Address, Coins: types.NewCoins(15, 0)}},
+	}
+	raw, err := types.TxToBytes(sendTx)
+	require.Nil(err)
+
+	result := &EstimateTxFeeResult{}
+	require.Nil(service.EstimateTxFee(&EstimateTxFeeArgs{TxBytes: hex.EncodeToString(raw)}, result))
+	minimumFee := new(big.Int).SetUint64(types.MinimumTransactionFeeTFuelWei)
+	assert.Equal(minimumFee, result.MinimumFee.ToInt())
+	assert.Equal(minimumFee, result.BaseFee.ToInt())
+	assert.Equal(big.NewInt(0), result.PerByteFee.ToInt())
+
+	assert.NotNil(service.EstimateTxFee(&EstimateTxFeeArgs{TxBytes: "0xzz"}, &EstimateTxFeeResult{}))
+	raw, err = types.TxToBytes(&types.CoinbaseTx{})
+	require.Nil(err)
+	assert.NotNil(service.EstimateTxFee(&EstimateTxFeeArgs{TxBytes: hex.EncodeToString(raw)}, &EstimateTxFeeResult{}))
+}
+
+func TestAdminRPCLocalOnly(t *testing.T) {
+	assert := assert.New(t)
+
+	handler := localOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for remoteAddr, status := range map[string]int{
+		"127.0.0.1:5000":   http.StatusOK,
+		"[::1]:5000":       http.StatusOK,
+		"10.0.0.1:5000":    http.StatusForbidden,
+		"203.0.113.7:5000": http.StatusForbidden,
+		"invalid":          http.StatusForbidden,
+	} {
+		req := httptest.NewRequest("POST", "/admin", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(status, rec.Code, remoteAddr)
+	}
+}
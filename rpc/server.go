@@ -70,11 +70,15 @@ func NewThetaRPCServer(mempool *mempool.Mempool, ledger *ledger.Ledger, dispatch
 
 	t.handler = s
 
+	admin := rpc.NewServer()
+	admin.RegisterName("admin", &ThetaAdminRPCService{service: t.ThetaRPCService})
+
 	t.router = mux.NewRouter()
 	t.router.Handle("/rpc", jsonrpc2.HTTPHandler(s))
 	t.router.Handle("/ws", websocket.Handler(func(ws *websocket.Conn) {
 		s.ServeCodec(jsonrpc2.NewServerCodec(ws, s))
 	}))
+	t.router.Handle("/admin", localOnly(jsonrpc2.HTTPHandler(admin)))
 
 	t.server = &http.Server{
 		Handler: t.router,
@@ -85,6 +89,11 @@ func NewThetaRPCServer(mempool *mempool.Mempool, ledger *ledger.Ledger, dispatch
 	return t
 }
 
+// RouteLedgerSet serves the chains of the given LedgerSet at /rpc/{chain_id}
+func (t *ThetaRPCServer) RouteLedgerSet(ledgerSet *ledger.LedgerSet) {
+	t.router.Handle("/rpc/{"+chainIDPathVar+"}", NewChainRouter(ledgerSet))
+}
+
 // Start creates the main goroutine.
 func (t *ThetaRPCServer) Start(ctx context.Context) {
 	c, cancel := context.WithCancel(ctx)
@@ -10,10 +10,16 @@ import (
 	"github.com/thetatoken/theta/common/hexutil"
 	"github.com/thetatoken/theta/core"
 	"github.com/thetatoken/theta/crypto"
+	"github.com/thetatoken/theta/mempool"
+	"github.com/thetatoken/theta/rpc/lib/rpc-codec/jsonrpc2"
 )
 
 const txTimeout = 60 * time.Second
 
+// BroadcastStatusQueuedNotRelayed indicates the transaction is accepted into the local mempool,
+// but not relayed to the peers since the node is in safe mode
+const BroadcastStatusQueuedNotRelayed = "queued_not_relayed"
+
 type Callback struct {
 	txHash   string
 	created  time.Time
@@ -111,8 +117,10 @@ type BroadcastRawTransactionArgs struct {
 }
 
 type BroadcastRawTransactionResult struct {
-	TxHash string            `json:"hash"`
-	Block  *core.BlockHeader `json:"block",rlp:"nil"`
+	TxHash   string            `json:"hash"`
+	Block    *core.BlockHeader `json:"block",rlp:"nil"`
+	Status   string            `json:"status,omitempty"`
+	SafeMode bool              `json:"safe_mode"`
 }
 
 func (t *ThetaRPCService) BroadcastRawTransaction(
@@ -129,7 +137,14 @@ func (t *ThetaRPCService) BroadcastRawTransaction(
 
 	err = t.mempool.InsertTransaction(txBytes)
 	if err != nil {
-		return err
+		return txRejectedError(err)
+	}
+
+	// The transaction cannot be included while the node is in safe mode, hence no need to wait
+	result.SafeMode = t.inSafeMode()
+	if result.SafeMode {
+		result.Status = BroadcastStatusQueuedNotRelayed
+		return nil
 	}
 
 	finalized := make(chan *core.Block)
@@ -156,7 +171,9 @@ type BroadcastRawTransactionAsyncArgs struct {
 }
 
 type BroadcastRawTransactionAsyncResult struct {
-	TxHash string `json:"hash"`
+	TxHash   string `json:"hash"`
+	Status   string `json:"status,omitempty"`
+	SafeMode bool   `json:"safe_mode"`
 }
 
 func (t *ThetaRPCService) BroadcastRawTransactionAsync(
@@ -171,11 +188,29 @@ func (t *ThetaRPCService) BroadcastRawTransactionAsync(
 
 	logger.Infof("Broadcast raw transaction (async): %v, hash: %v", hex.EncodeToString(txBytes), hash.Hex())
 
-	return t.mempool.InsertTransaction(txBytes)
+	err = t.mempool.InsertTransaction(txBytes)
+	if err != nil {
+		return txRejectedError(err)
+	}
+
+	result.SafeMode = t.inSafeMode()
+	if result.SafeMode {
+		result.Status = BroadcastStatusQueuedNotRelayed
+	}
+	return nil
 }
 
 // -------------------------- Utilities -------------------------- //
 
+// txRejectedError returns the screening failure as a JSON-RPC error with the result code as its
+// code, so that the clients can tell the reason without interpreting the message
+func txRejectedError(err error) error {
+	if rejected, ok := err.(*mempool.TxRejectedError); ok {
+		return jsonrpc2.NewError(int(rejected.Code()), rejected.Error())
+	}
+	return err
+}
+
 func decodeTxHexBytes(txBytes string) ([]byte, error) {
 	if hexutil.Has0xPrefix(txBytes) {
 		txBytes = txBytes[2:]
@@ -659,12 +659,13 @@ func getValidatorSetFromVCPProof(stateHash common.Hash, recoverredVp *core.VCPPr
 	if err != nil {
 		return nil, err
 	}
+	// The proof covers the pool only, so the validators are selected under the default max number of validators
 	return consensus.SelectTopStakeHoldersAsValidators(vcp), nil
 }
 
 func getValidatorSetFromSV(sv *state.StoreView) *core.ValidatorSet {
-	vcp := sv.GetValidatorCandidatePool()
-	return consensus.SelectTopStakeHoldersAsValidators(vcp)
+	vcp := sv.GetValidatorLivenessTracker().ExcludeJailed(sv.GetValidatorCandidatePool())
+	return consensus.SelectTopStakeHoldersAsValidatorsWithLimit(vcp, sv.GetMaxNumValidators())
 }
 
 func validateVotes(validatorSet *core.ValidatorSet, block *core.BlockHeader, voteSet *core.VoteSet) error {
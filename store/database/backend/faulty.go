@@ -0,0 +1,73 @@
+package backend
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/thetatoken/theta/store/database"
+)
+
+// ErrInjectedFault is returned by the reads a FaultyDatabase is set to fail
+var ErrInjectedFault = errors.New("injected database fault")
+
+// FaultyDatabase fails the selected reads from the host database, e.g. to test that the failures
+// of the underlying storage (disk errors, corruption) are told apart from the missing keys. The
+// other operations pass through to the host database.
+type FaultyDatabase struct {
+	database.Database
+
+	mu        *sync.Mutex
+	failRead  func(key []byte) bool
+	numFaults int
+}
+
+var _ database.Database = (*FaultyDatabase)(nil)
+
+// NewFaultyDatabase creates a faulty view of the given host database, which fails no reads until
+// FailReads is called
+func NewFaultyDatabase(db database.Database) *FaultyDatabase {
+	return &FaultyDatabase{
+		Database: db,
+		mu:       &sync.Mutex{},
+	}
+}
+
+// FailReads makes the reads of the keys for which failRead returns true fail with ErrInjectedFault,
+// or no reads if failRead is nil. The calls to failRead are serialized, so it can keep a state,
+// e.g. to only fail the n-th read.
+func (fdb *FaultyDatabase) FailReads(failRead func(key []byte) bool) {
+	fdb.mu.Lock()
+	defer fdb.mu.Unlock()
+	fdb.failRead = failRead
+}
+
+// NumFaults returns the number of the reads failed so far
+func (fdb *FaultyDatabase) NumFaults() int {
+	fdb.mu.Lock()
+	defer fdb.mu.Unlock()
+	return fdb.numFaults
+}
+
+func (fdb *FaultyDatabase) shouldFail(key []byte) bool {
+	fdb.mu.Lock()
+	defer fdb.mu.Unlock()
+	if fdb.failRead == nil || !fdb.failRead(key) {
+		return false
+	}
+	fdb.numFaults++
+	return true
+}
+
+func (fdb *FaultyDatabase) Get(key []byte) ([]byte, error) {
+	if fdb.shouldFail(key) {
+		return nil, ErrInjectedFault
+	}
+	return fdb.Database.Get(key)
+}
+
+func (fdb *FaultyDatabase) Has(key []byte) (bool, error) {
+	if fdb.shouldFail(key) {
+		return false, ErrInjectedFault
+	}
+	return fdb.Database.Has(key)
+}
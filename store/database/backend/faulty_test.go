@@ -0,0 +1,51 @@
+package backend
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/store"
+)
+
+func TestFaultyDB_PutGet(t *testing.T) {
+	fdb := NewFaultyDatabase(NewMemDatabase())
+	testPutGet(fdb, fdb.NewBatch(), t)
+}
+
+func TestFaultyDBFailReads(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	host := NewMemDatabase()
+	require.Nil(host.Put([]byte("healthy"), []byte("value1")))
+	require.Nil(host.Put([]byte("faulty"), []byte("value2")))
+
+	fdb := NewFaultyDatabase(host)
+	fdb.FailReads(func(key []byte) bool { return bytes.Equal(key, []byte("faulty")) })
+	_, err := fdb.Get([]byte("faulty"))
+	assert.Equal(ErrInjectedFault, err)
+	_, err = fdb.Has([]byte("faulty"))
+	assert.Equal(ErrInjectedFault, err)
+	value, err := fdb.Get([]byte("healthy"))
+	require.Nil(err)
+	assert.Equal([]byte("value1"), value)
+
+	// A missing key is not a fault
+	_, err = fdb.Get([]byte("missing"))
+	assert.Equal(store.ErrKeyNotFound, err)
+	assert.Equal(2, fdb.NumFaults())
+
+	// The writes are passed to the host database
+	require.Nil(fdb.Put([]byte("written"), []byte("value3")))
+	value, err = host.Get([]byte("written"))
+	require.Nil(err)
+	assert.Equal([]byte("value3"), value)
+
+	fdb.FailReads(nil)
+	value, err = fdb.Get([]byte("faulty"))
+	require.Nil(err)
+	assert.Equal([]byte("value2"), value)
+	assert.Equal(2, fdb.NumFaults())
+}
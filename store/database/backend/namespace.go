@@ -0,0 +1,111 @@
+package backend
+
+import (
+	"github.com/thetatoken/theta/store/database"
+)
+
+//
+// NamespacedDatabase isolates a logical database inside a shared host database, by prefixing all its
+// keys with the namespace prefix. Several namespaced databases can share one host database without
+// seeing each other's keys.
+//
+type NamespacedDatabase struct {
+	db     database.Database
+	prefix []byte
+}
+
+var _ database.Database = (*NamespacedDatabase)(nil)
+
+// NewNamespacedDatabase creates a namespaced view of the given host database
+func NewNamespacedDatabase(db database.Database, namespace string) (*NamespacedDatabase, error) {
+	if err := database.ValidateNamespace(namespace); err != nil {
+		return nil, err
+	}
+	return &NamespacedDatabase{
+		db:     db,
+		prefix: database.NamespacePrefix(namespace),
+	}, nil
+}
+
+func (ndb *NamespacedDatabase) key(key []byte) []byte {
+	nsKey := make([]byte, len(ndb.prefix)+len(key))
+	copy(nsKey, ndb.prefix)
+	copy(nsKey[len(ndb.prefix):], key)
+	return nsKey
+}
+
+// Prefix returns the key prefix of the namespace in the host database
+func (ndb *NamespacedDatabase) Prefix() []byte {
+	return ndb.prefix
+}
+
+func (ndb *NamespacedDatabase) Put(key []byte, value []byte) error {
+	return ndb.db.Put(ndb.key(key), value)
+}
+
+func (ndb *NamespacedDatabase) Delete(key []byte) error {
+	return ndb.db.Delete(ndb.key(key))
+}
+
+func (ndb *NamespacedDatabase) Reference(key []byte) error {
+	return ndb.db.Reference(ndb.key(key))
+}
+
+func (ndb *NamespacedDatabase) Dereference(key []byte) error {
+	return ndb.db.Dereference(ndb.key(key))
+}
+
+func (ndb *NamespacedDatabase) Get(key []byte) ([]byte, error) {
+	return ndb.db.Get(ndb.key(key))
+}
+
+func (ndb *NamespacedDatabase) Has(key []byte) (bool, error) {
+	return ndb.db.Has(ndb.key(key))
+}
+
+func (ndb *NamespacedDatabase) CountReference(key []byte) (int, error) {
+	return ndb.db.CountReference(ndb.key(key))
+}
+
+// Close is a no-op, the host database is shared with the other namespaces and needs to be closed by its owner
+func (ndb *NamespacedDatabase) Close() {}
+
+func (ndb *NamespacedDatabase) NewBatch() database.Batch {
+	return &namespacedBatch{
+		ndb:   ndb,
+		batch: ndb.db.NewBatch(),
+	}
+}
+
+type namespacedBatch struct {
+	ndb   *NamespacedDatabase
+	batch database.Batch
+}
+
+func (b *namespacedBatch) Put(key, value []byte) error {
+	return b.batch.Put(b.ndb.key(key), value)
+}
+
+func (b *namespacedBatch) Delete(key []byte) error {
+	return b.batch.Delete(b.ndb.key(key))
+}
+
+func (b *namespacedBatch) Reference(key []byte) error {
+	return b.batch.Reference(b.ndb.key(key))
+}
+
+func (b *namespacedBatch) Dereference(key []byte) error {
+	return b.batch.Dereference(b.ndb.key(key))
+}
+
+func (b *namespacedBatch) ValueSize() int {
+	return b.batch.ValueSize()
+}
+
+func (b *namespacedBatch) Write() error {
+	return b.batch.Write()
+}
+
+func (b *namespacedBatch) Reset() {
+	b.batch.Reset()
+}
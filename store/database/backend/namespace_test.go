@@ -0,0 +1,70 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/store"
+)
+
+func TestNamespacedDB_PutGet(t *testing.T) {
+	ndb, err := NewNamespacedDatabase(NewMemDatabase(), "chain1")
+	require.Nil(t, err)
+	testPutGet(ndb, ndb.NewBatch(), t)
+}
+
+func TestNamespacedDB_ParallelPutGet(t *testing.T) {
+	ndb, err := NewNamespacedDatabase(NewMemDatabase(), "chain1")
+	require.Nil(t, err)
+	testParallelPutGet(ndb, t)
+}
+
+func TestNamespacedDBIsolation(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	host := NewMemDatabase()
+	ndb1, err := NewNamespacedDatabase(host, "chain1")
+	require.Nil(err)
+	ndb2, err := NewNamespacedDatabase(host, "chain2")
+	require.Nil(err)
+
+	require.Nil(ndb1.Put([]byte("key"), []byte("value1")))
+	require.Nil(ndb2.Put([]byte("key"), []byte("value2")))
+
+	value, err := ndb1.Get([]byte("key"))
+	require.Nil(err)
+	assert.Equal([]byte("value1"), value)
+	value, err = ndb2.Get([]byte("key"))
+	require.Nil(err)
+	assert.Equal([]byte("value2"), value)
+	value, err = host.Get([]byte("ns/chain1/key"))
+	require.Nil(err)
+	assert.Equal([]byte("value1"), value)
+	_, err = host.Get([]byte("key"))
+	assert.Equal(store.ErrKeyNotFound, err)
+
+	batch := ndb1.NewBatch()
+	require.Nil(batch.Put([]byte("batched"), []byte("value1")))
+	require.Nil(batch.Write())
+	has, err := ndb1.Has([]byte("batched"))
+	require.Nil(err)
+	assert.True(has)
+	has, err = ndb2.Has([]byte("batched"))
+	require.Nil(err)
+	assert.False(has)
+
+	require.Nil(ndb1.Delete([]byte("key")))
+	_, err = ndb1.Get([]byte("key"))
+	assert.Equal(store.ErrKeyNotFound, err)
+	value, err = ndb2.Get([]byte("key"))
+	require.Nil(err)
+	assert.Equal([]byte("value2"), value)
+
+	// Namespaces with overlapping key ranges are rejected
+	_, err = NewNamespacedDatabase(host, "chain1/sub")
+	assert.NotNil(err)
+	_, err = NewNamespacedDatabase(host, "")
+	assert.NotNil(err)
+}
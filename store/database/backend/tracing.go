@@ -0,0 +1,102 @@
+package backend
+
+import (
+	"sync"
+
+	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/store/database"
+)
+
+//
+// TracingDatabase records the key-value pairs read from the host database, i.e. the read-set of
+// the operations executed against it. The writes are kept in memory and never reach the host
+// database, so executions can be traced against a live database without modifying it.
+//
+type TracingDatabase struct {
+	db     database.Database
+	writes *MemDatabase
+
+	mu      *sync.Mutex
+	readSet map[string][]byte
+}
+
+var _ database.Database = (*TracingDatabase)(nil)
+
+// NewTracingDatabase creates a tracing view of the given host database
+func NewTracingDatabase(db database.Database) *TracingDatabase {
+	return &TracingDatabase{
+		db:      db,
+		writes:  NewMemDatabase(),
+		mu:      &sync.Mutex{},
+		readSet: make(map[string][]byte),
+	}
+}
+
+// ReadSet returns the key-value pairs read from the host database so far
+func (tdb *TracingDatabase) ReadSet() map[string][]byte {
+	tdb.mu.Lock()
+	defer tdb.mu.Unlock()
+
+	readSet := make(map[string][]byte, len(tdb.readSet))
+	for key, value := range tdb.readSet {
+		readSet[key] = value
+	}
+	return readSet
+}
+
+func (tdb *TracingDatabase) Put(key []byte, value []byte) error {
+	return tdb.writes.Put(key, value)
+}
+
+// Delete only removes the key from the in-memory writes
+func (tdb *TracingDatabase) Delete(key []byte) error {
+	return tdb.writes.Delete(key)
+}
+
+func (tdb *TracingDatabase) Reference(key []byte) error {
+	return tdb.writes.Reference(key)
+}
+
+func (tdb *TracingDatabase) Dereference(key []byte) error {
+	return tdb.writes.Dereference(key)
+}
+
+func (tdb *TracingDatabase) Get(key []byte) ([]byte, error) {
+	if has, _ := tdb.writes.Has(key); has {
+		return tdb.writes.Get(key)
+	}
+
+	value, err := tdb.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	tdb.mu.Lock()
+	tdb.readSet[string(key)] = common.CopyBytes(value)
+	tdb.mu.Unlock()
+
+	return value, nil
+}
+
+func (tdb *TracingDatabase) Has(key []byte) (bool, error) {
+	if has, _ := tdb.writes.Has(key); has {
+		return true, nil
+	}
+	has, err := tdb.db.Has(key)
+	if err != nil || !has {
+		return has, err
+	}
+	_, err = tdb.Get(key) // records the value in the read-set
+	return err == nil, err
+}
+
+func (tdb *TracingDatabase) CountReference(key []byte) (int, error) {
+	return tdb.writes.CountReference(key)
+}
+
+// Close is a no-op, the host database needs to be closed by its owner
+func (tdb *TracingDatabase) Close() {}
+
+func (tdb *TracingDatabase) NewBatch() database.Batch {
+	return tdb.writes.NewBatch()
+}
@@ -0,0 +1,47 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thetatoken/theta/store"
+)
+
+func TestTracingDB_PutGet(t *testing.T) {
+	tdb := NewTracingDatabase(NewMemDatabase())
+	testPutGet(tdb, tdb.NewBatch(), t)
+}
+
+func TestTracingDBReadSet(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	host := NewMemDatabase()
+	require.Nil(host.Put([]byte("read"), []byte("value1")))
+	require.Nil(host.Put([]byte("checked"), []byte("value2")))
+	require.Nil(host.Put([]byte("untouched"), []byte("value3")))
+
+	tdb := NewTracingDatabase(host)
+	value, err := tdb.Get([]byte("read"))
+	require.Nil(err)
+	assert.Equal([]byte("value1"), value)
+	has, err := tdb.Has([]byte("checked"))
+	require.Nil(err)
+	assert.True(has)
+	_, err = tdb.Get([]byte("missing"))
+	assert.Equal(store.ErrKeyNotFound, err)
+
+	// The writes are not passed to the host database, nor recorded as reads
+	require.Nil(tdb.Put([]byte("written"), []byte("value4")))
+	value, err = tdb.Get([]byte("written"))
+	require.Nil(err)
+	assert.Equal([]byte("value4"), value)
+	_, err = host.Get([]byte("written"))
+	assert.Equal(store.ErrKeyNotFound, err)
+
+	assert.Equal(map[string][]byte{
+		"read":    []byte("value1"),
+		"checked": []byte("value2"),
+	}, tdb.ReadSet())
+}
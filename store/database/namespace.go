@@ -0,0 +1,26 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NamespaceKeyPrefix is prepended to all the keys of a namespaced database
+const NamespaceKeyPrefix = "ns/"
+
+// NamespacePrefix returns the key prefix of the given namespace
+func NamespacePrefix(namespace string) []byte {
+	return []byte(NamespaceKeyPrefix + namespace + "/")
+}
+
+// ValidateNamespace checks whether the given namespace is valid. Namespaces must be non-empty and
+// must not contain "/", otherwise the key ranges of two namespaces could overlap (e.g. "a" and "a/b").
+func ValidateNamespace(namespace string) error {
+	if namespace == "" {
+		return fmt.Errorf("Namespace must not be empty")
+	}
+	if strings.Contains(namespace, "/") {
+		return fmt.Errorf("Namespace %v must not contain \"/\"", namespace)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package treestore
 
 import (
 	"bytes"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/thetatoken/theta/common"
@@ -19,12 +20,40 @@ func NewTreeStore(root common.Hash, db database.Database) *TreeStore {
 		log.Errorf("Failed to create tree store for: %v: %v", root.Hex(), err)
 		return nil
 	}
-	return &TreeStore{tr, db}
+	return &TreeStore{Trie: tr, db: db}
 }
 
 type TreeStore struct {
 	*trie.Trie
 	db database.Database
+
+	errMu sync.Mutex
+	err   error // the first trie error not returned to the caller, e.g. a missing trie node
+}
+
+// Err returns the first error encountered by Get, Set, Delete or Traverse. These methods
+// keep the interface of a map, and the failed lookups return nil as if the key did not exist.
+// The caller should check Err() before trusting the results, e.g. the state root. The error is
+// carried over to the copies and the reverted stores.
+func (store *TreeStore) Err() error {
+	store.errMu.Lock()
+	defer store.errMu.Unlock()
+	return store.err
+}
+
+// SetErr records an error encountered on behalf of the store, e.g. by a storage trie loaded
+// from the same database, unless an error is recorded already
+func (store *TreeStore) SetErr(err error) {
+	if err == nil {
+		return
+	}
+	log.Errorf("Unhandled trie error: %v", err)
+
+	store.errMu.Lock()
+	defer store.errMu.Unlock()
+	if store.err == nil {
+		store.err = err
+	}
 }
 
 // GetDB returns the underlying database.
@@ -60,6 +89,7 @@ func (store *TreeStore) Revert(root common.Hash) (*TreeStore, error) {
 	revertedStore := &TreeStore{
 		Trie: revertedTrie,
 		db:   store.db,
+		err:  store.Err(), // the remaining changes might still depend on a failed lookup
 	}
 	return revertedStore, nil
 }
@@ -72,13 +102,15 @@ func (store *TreeStore) Copy() (*TreeStore, error) {
 		return nil, err
 	}
 
-	copiedStore := &TreeStore{copiedTrie, store.db}
+	copiedStore := &TreeStore{Trie: copiedTrie, db: store.db, err: store.Err()}
 	return copiedStore, nil
 }
 
 // Get retrieves value of given key.
 func (store *TreeStore) Get(key common.Bytes) common.Bytes {
-	return store.Trie.Get(key)
+	value, err := store.Trie.TryGet(key)
+	store.SetErr(err)
+	return value
 }
 
 func (store *TreeStore) ProveVCP(vcpKey []byte, vp *core.VCPProof) error {
@@ -87,7 +119,7 @@ func (store *TreeStore) ProveVCP(vcpKey []byte, vp *core.VCPProof) error {
 
 // Set sets value of given key.
 func (store *TreeStore) Set(key, value common.Bytes) {
-	store.Trie.Update(key, value)
+	store.SetErr(store.Trie.TryUpdate(key, value))
 }
 
 // Traverse traverses the trie and calls cb callback func on every key/value pair
@@ -102,12 +134,13 @@ func (store *TreeStore) Traverse(prefix common.Bytes, cb func(k, v common.Bytes)
 			break
 		}
 	}
+	store.SetErr(it.Err)
 	return true
 }
 
 // Delete deletes the key/value pair.
 func (store *TreeStore) Delete(key common.Bytes) (deleted bool) {
-	store.Trie.Delete(key)
+	store.SetErr(store.Trie.TryDelete(key))
 	return true
 }
 
@@ -27,6 +27,7 @@ import (
 	"github.com/thetatoken/theta/common"
 	"github.com/thetatoken/theta/common/metrics"
 	"github.com/thetatoken/theta/rlp"
+	"github.com/thetatoken/theta/store"
 	"github.com/thetatoken/theta/store/database"
 )
 
@@ -352,6 +353,26 @@ func (db *Database) node(hash common.Hash, cachegen uint16) node {
 	return mustDecodeNode(hash[:], enc, cachegen)
 }
 
+// resolveNode is similar to node, but tells an absent node apart from a failure to
+// read it from the database (e.g. an I/O error), which is returned.
+func (db *Database) resolveNode(hash common.Hash, cachegen uint16) (node, error) {
+	db.lock.RLock()
+	node := db.nodes[hash]
+	db.lock.RUnlock()
+
+	if node != nil {
+		return node.obj(hash, cachegen), nil
+	}
+	enc, err := db.diskdb.Get(hash[:])
+	if err == store.ErrKeyNotFound || (err == nil && enc == nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mustDecodeNode(hash[:], enc, cachegen), nil
+}
+
 // Node retrieves an encoded cached trie node from memory. If it cannot be found
 // cached, the method queries the persistent database for the content.
 func (db *Database) Node(hash common.Hash) ([]byte, error) {
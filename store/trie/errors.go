@@ -29,8 +29,12 @@ import (
 type MissingNodeError struct {
 	NodeHash common.Hash // hash of the missing node
 	Path     []byte      // hex-encoded path to the missing node
+	Err      error       // the failure to read the node, nil if the node is not present
 }
 
 func (err *MissingNodeError) Error() string {
+	if err.Err != nil {
+		return fmt.Sprintf("missing trie node %x (path %x): %v", err.NodeHash, err.Path, err.Err)
+	}
 	return fmt.Sprintf("missing trie node %x (path %x)", err.NodeHash, err.Path)
 }
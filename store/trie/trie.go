@@ -452,10 +452,11 @@ func (t *Trie) resolveHash(n hashNode, prefix []byte) (node, error) {
 	cacheMissCounter.Inc(1)
 
 	hash := common.BytesToHash(n)
-	if node := t.db.node(hash, t.cachegen); node != nil {
+	node, err := t.db.resolveNode(hash, t.cachegen)
+	if node != nil && err == nil {
 		return node, nil
 	}
-	return nil, &MissingNodeError{NodeHash: hash, Path: prefix}
+	return nil, &MissingNodeError{NodeHash: hash, Path: prefix, Err: err}
 }
 
 // Root returns the root hash of the trie.
@@ -162,6 +162,34 @@ func testMissingNode(t *testing.T, memonly bool) {
 	}
 }
 
+func TestMissingNodeCause(t *testing.T) {
+	diskdb := dbbackend.NewFaultyDatabase(dbbackend.NewMemDatabase())
+	triedb := NewDatabase(diskdb)
+
+	trie, _ := New(common.Hash{}, triedb)
+	updateString(trie, "120000", "qwerqwerqwerqwerqwerqwerqwerqwer")
+	updateString(trie, "123456", "asdfasdfasdfasdfasdfasdfasdfasdf")
+	root, _ := trie.Commit(nil)
+	triedb.Commit(root, true)
+	hash := common.HexToHash("0xe1d943cc8f061a0c0b98162830b970395ac9315654824bf21b73b891365262f9")
+
+	// A failed read is not an absent node
+	diskdb.FailReads(func(key []byte) bool { return bytes.Equal(key, hash[:]) })
+	trie, _ = New(root, triedb)
+	_, err := trie.TryGet([]byte("120000"))
+	if missing, ok := err.(*MissingNodeError); !ok || missing.Err != dbbackend.ErrInjectedFault {
+		t.Errorf("Wrong error: %v", err)
+	}
+	diskdb.FailReads(nil)
+
+	diskdb.Delete(hash[:])
+	trie, _ = New(root, triedb)
+	_, err = trie.TryGet([]byte("120000"))
+	if missing, ok := err.(*MissingNodeError); !ok || missing.Err != nil {
+		t.Errorf("Wrong error: %v", err)
+	}
+}
+
 func TestInsert(t *testing.T) {
 	trie := newEmpty()
 
@@ -205,7 +205,12 @@ func encryptKey(key *Key, auth string, scryptN, scryptP int) ([]byte, error) {
 		return nil, err
 	}
 	encryptKey := derivedKey[:16]
-	keyBytes := math.PaddedBigBytes(key.PrivateKey.D(), 32)
+	var keyBytes []byte
+	if key.PrivateKey.Scheme() == crypto.SchemeEd25519 {
+		keyBytes = key.PrivateKey.ToBytes()
+	} else {
+		keyBytes = math.PaddedBigBytes(key.PrivateKey.D(), 32)
+	}
 
 	iv := make([]byte, aes.BlockSize) // 16
 	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
@@ -25,6 +25,7 @@ import (
 	"testing"
 
 	"github.com/thetatoken/theta/common"
+	"github.com/thetatoken/theta/crypto"
 )
 
 func Test_PBKDF2_1(t *testing.T) {
@@ -116,3 +117,28 @@ func TestKeyEncryptDecrypt(t *testing.T) {
 		}
 	}
 }
+
+// Tests that an Ed25519 key survives an encryption round trip.
+func TestKeyEncryptDecryptEd25519(t *testing.T) {
+	privKey, _, err := crypto.GenerateEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := NewKey(privKey)
+
+	password := "foo"
+	keyjson, err := encryptKey(key, password, veryLightScryptN, veryLightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := decryptKey(keyjson, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted.Address != key.Address {
+		t.Errorf("key address mismatch: have %x, want %x", decrypted.Address, key.Address)
+	}
+	if decrypted.PrivateKey.Scheme() != crypto.SchemeEd25519 {
+		t.Errorf("key scheme mismatch: have %v, want %v", decrypted.PrivateKey.Scheme(), crypto.SchemeEd25519)
+	}
+}